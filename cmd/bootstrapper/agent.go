@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/agent"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+)
+
+var (
+	// agentCmd describes the agent command
+	agentCmd = &cobra.Command{
+		Use:   "agent",
+		Short: "Applies the configuration changes requested through the node annotations",
+		Long: "Applies the configuration changes requested by the cluster administrators through the " +
+			agent.AnnotationPrefix + "<request> annotations of the node, or a shared ConfigMap: " +
+			agent.KubeletLogLevel + ", " + agent.RestartKubelet + " and " + agent.CollectDiagnostics + ". " +
+			"With --install the agent is installed as a Windows service instead of being run in the foreground.",
+		Run: runAgentCmd,
+	}
+
+	// agentOpts holds the agent CLI options
+	agentOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// kubeconfig is the kubeconfig the agent reads the requests with
+		kubeconfig string
+		// nodeName is the name of the node object to read the requests from
+		nodeName string
+		// configMap is the <namespace>/<name> of the ConfigMap holding the requests shared by the nodes
+		configMap string
+		// interval is the time between two checks of the requests
+		interval time.Duration
+		// install indicates that the agent should be installed as a Windows service
+		install bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.PersistentFlags().StringVar(&agentOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	agentCmd.PersistentFlags().StringVar(&agentOpts.kubeconfig, "kubeconfig", "",
+		"The kubeconfig to read the requests with. Defaults to the kubeconfig of the kubelet in the install directory")
+	agentCmd.PersistentFlags().StringVar(&agentOpts.nodeName, "node-name", "",
+		"The name of the node to read the requests from. Defaults to the lower cased hostname, as used by the kubelet")
+	agentCmd.PersistentFlags().StringVar(&agentOpts.configMap, "config-map", "",
+		"The ConfigMap holding the requests shared by the nodes, as <namespace>/<name>. The annotations of the node "+
+			"take precedence over it. The kubeconfig must allow reading it")
+	agentCmd.PersistentFlags().DurationVar(&agentOpts.interval, "interval", 30*time.Second,
+		"The interval between two checks of the requests")
+	agentCmd.PersistentFlags().BoolVar(&agentOpts.install, "install", false,
+		"Install the agent as a Windows service")
+}
+
+// runAgentCmd runs or installs the node agent
+func runAgentCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	if agentOpts.nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Error(err, "could not get hostname")
+			os.Exit(1)
+		}
+		agentOpts.nodeName = strings.ToLower(hostname)
+	}
+	if agentOpts.kubeconfig == "" {
+		agentOpts.kubeconfig = filepath.Join(agentOpts.installDir, "kubeconfig")
+	}
+	var configMap *agent.ConfigMapRef
+	if agentOpts.configMap != "" {
+		var err error
+		if configMap, err = agent.ParseConfigMapRef(agentOpts.configMap); err != nil {
+			log.Error(err, "invalid --config-map")
+			os.Exit(1)
+		}
+	}
+
+	if agentOpts.install {
+		if err := installAgent(); err != nil {
+			log.Error(err, "could not install agent")
+			os.Exit(1)
+		}
+		log.Info("agent installed successfully", "service", agent.ServiceName)
+		return
+	}
+
+	a, err := agent.NewAgent(agentOpts.kubeconfig, agentOpts.nodeName, configMap)
+	if err != nil {
+		log.Error(err, "could not create agent")
+		os.Exit(1)
+	}
+
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		log.Error(err, "could not determine if running as a Windows service")
+		os.Exit(1)
+	}
+	if interactive {
+		a.Run(agentOpts.interval, make(chan struct{}), logf)
+		return
+	}
+	if err = svc.Run(agent.ServiceName, &agentService{agent: a}); err != nil {
+		log.Error(err, "agent service failed")
+		os.Exit(1)
+	}
+}
+
+// installAgent installs the agent as a Windows service running this executable with the current options
+func installAgent() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not get executable path: %v", err)
+	}
+	args := []string{"agent",
+		"--install-dir=" + agentOpts.installDir,
+		"--kubeconfig=" + agentOpts.kubeconfig,
+		"--node-name=" + agentOpts.nodeName,
+		"--interval=" + agentOpts.interval.String()}
+	if agentOpts.configMap != "" {
+		args = append(args, "--config-map="+agentOpts.configMap)
+	}
+	if err = agent.InstallService(exePath, args...); err != nil {
+		return err
+	}
+	return bootstrapper.NewJournal(agentOpts.installDir, "agent").Record(journal.Created,
+		journal.Service, agent.ServiceName, exePath+" "+strings.Join(args, " "))
+}
+
+// agentService runs the agent under the Windows service control manager
+type agentService struct {
+	agent *agent.Agent
+}
+
+// Execute implements svc.Handler, running the agent until the service is stopped
+func (s *agentService) Execute(_ []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.agent.Run(agentOpts.interval, stop, logf)
+		close(done)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			close(stop)
+			<-done
+			return false, 0
+		}
+	}
+	return false, 0
+}
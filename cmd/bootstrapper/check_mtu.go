@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/mtu"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// checkMTUCmd describes the check-mtu command
+	checkMTUCmd = &cobra.Command{
+		Use:   "check-mtu",
+		Short: "Validates the MTU of the Windows node against the cluster network MTU",
+		Long: "Validates the MTU of the uplink interface of the Windows node, which has to carry the cluster network " +
+			"MTU plus the VXLAN overhead of the hybrid overlay, and of the host interfaces of the HNS networks, which " +
+			"have to match the cluster network MTU, and prints the result of each interface as JSON. With --configure, " +
+			"the invalid MTUs are set to their expected value. Exits with a non zero code if an MTU is invalid.",
+		Run: runCheckMTUCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("cluster-network-mtu")
+		},
+	}
+
+	// checkMTUOpts holds the check-mtu CLI options
+	checkMTUOpts struct {
+		// clusterNetworkMTU is the MTU of the cluster network
+		clusterNetworkMTU int
+		// hnsNetworks are the HNS networks whose host interfaces are validated
+		hnsNetworks []string
+		// configure sets the invalid MTUs to their expected value
+		configure bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(checkMTUCmd)
+	checkMTUCmd.PersistentFlags().IntVar(&checkMTUOpts.clusterNetworkMTU, "cluster-network-mtu", 0,
+		"The MTU of the cluster network, as reported by the clusterNetworkMTU status of the network configuration")
+	checkMTUCmd.PersistentFlags().StringSliceVar(&checkMTUOpts.hnsNetworks, "hns-network", mtu.DefaultHNSNetworks,
+		"HNS networks whose host interfaces are validated, the missing ones are skipped")
+	checkMTUCmd.PersistentFlags().BoolVar(&checkMTUOpts.configure, "configure", false,
+		"Set the invalid MTUs to their expected value")
+}
+
+// runCheckMTUCmd validates the MTU of the interfaces of the node, prints the results as JSON on stdout and exits with a
+// non zero code if an MTU is invalid
+func runCheckMTUCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	if err := mtu.ValidateClusterMTU(checkMTUOpts.clusterNetworkMTU); err != nil {
+		log.Error(err, "invalid options")
+		os.Exit(1)
+	}
+	interfaces, err := mtu.Interfaces(checkMTUOpts.hnsNetworks)
+	if err != nil {
+		log.Error(err, "could not get the MTU of the network interfaces")
+		os.Exit(1)
+	}
+	results := mtu.Check(checkMTUOpts.clusterNetworkMTU, interfaces)
+	if checkMTUOpts.configure {
+		if err = mtu.Configure(results); err != nil {
+			log.Error(err, "could not configure the MTU")
+			os.Exit(1)
+		}
+		// The MTU is checked again, as the network of the node may not support the MTU that was set
+		if interfaces, err = mtu.Interfaces(checkMTUOpts.hnsNetworks); err != nil {
+			log.Error(err, "could not get the MTU of the network interfaces")
+			os.Exit(1)
+		}
+		results = mtu.Check(checkMTUOpts.clusterNetworkMTU, interfaces)
+	}
+
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		log.Error(err, "could not marshal MTU results")
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+	invalid := 0
+	for _, result := range results {
+		if !result.Valid {
+			invalid++
+			log.Info("invalid MTU", "interface", result.Name, "mtu", result.MTU, "expected", result.Expected,
+				"reason", result.Reason)
+		}
+	}
+	if invalid > 0 {
+		log.Error(fmt.Errorf("%d of %d interfaces have an invalid MTU", invalid, len(results)), "MTU check failed")
+		os.Exit(1)
+	}
+	log.Info("MTU check completed successfully")
+}
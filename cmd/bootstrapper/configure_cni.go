@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/hooks"
 	"github.com/spf13/cobra"
 )
 
@@ -67,6 +68,10 @@ func runConfigureCNICmd(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 	log.Info("CNI configuration completed successfully")
+	if err = runHooks(hooks.PostJoin); err != nil {
+		log.Error(err, "post-join hooks failed")
+		os.Exit(1)
+	}
 
 	err = wmcb.Disconnect()
 	if err != nil {
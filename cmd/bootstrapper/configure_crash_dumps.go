@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/crashdump"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configureCrashDumpsCmd describes the configure-crash-dumps command
+	configureCrashDumpsCmd = &cobra.Command{
+		Use:   "configure-crash-dumps",
+		Short: "Configures crash dump collection on the Windows node",
+		Long: "Configures Windows Error Reporting to write dumps of the kubelet, kube-proxy, containerd, " +
+			"hybrid-overlay and CNI binaries to the dump directory when they crash.",
+		Run: runConfigureCrashDumpsCmd,
+	}
+
+	// configureCrashDumpsOpts holds the configure-crash-dumps CLI options
+	configureCrashDumpsOpts struct {
+		// dumpDir is the location where the dumps are written
+		dumpDir string
+		// dumpType is the type of dump to write, mini or full
+		dumpType string
+		// dumpCount is the maximum number of dumps kept per binary
+		dumpCount uint32
+		// cniDir is the location of the CNI binaries
+		cniDir string
+		// binaries are additional executable names to collect dumps for
+		binaries []string
+		// installDir is the main installation directory, holding the journal
+		installDir string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configureCrashDumpsCmd)
+	configureCrashDumpsCmd.PersistentFlags().StringVar(&configureCrashDumpsOpts.dumpDir, "dump-dir",
+		"c:\\k\\dumps", "The location where the dumps are written. Defaults to C:\\k\\dumps")
+	configureCrashDumpsCmd.PersistentFlags().StringVar(&configureCrashDumpsOpts.dumpType, "dump-type", "mini",
+		"The type of dump to write, mini or full")
+	configureCrashDumpsCmd.PersistentFlags().Uint32Var(&configureCrashDumpsOpts.dumpCount, "dump-count", 10,
+		"The maximum number of dumps kept per binary")
+	configureCrashDumpsCmd.PersistentFlags().StringVar(&configureCrashDumpsOpts.cniDir, "cni-dir", "c:\\k\\cni",
+		"The location of the CNI binaries. Dumps are collected for every executable in it, if it exists")
+	configureCrashDumpsCmd.PersistentFlags().StringSliceVar(&configureCrashDumpsOpts.binaries, "binaries", nil,
+		"Additional executable names to collect dumps for")
+	configureCrashDumpsCmd.PersistentFlags().StringVar(&configureCrashDumpsOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+}
+
+// runConfigureCrashDumpsCmd configures crash dump collection on the Windows node
+func runConfigureCrashDumpsCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	dumpType, err := crashdump.ParseDumpType(configureCrashDumpsOpts.dumpType)
+	if err != nil {
+		log.Error(err, "invalid dump type")
+		os.Exit(1)
+	}
+
+	binaries, err := crashdump.NodeBinaries(configureCrashDumpsOpts.cniDir, configureCrashDumpsOpts.binaries)
+	if err != nil {
+		log.Error(err, "could not get the binaries to collect dumps for")
+		os.Exit(1)
+	}
+
+	if err = crashdump.Configure(configureCrashDumpsOpts.dumpDir, dumpType, configureCrashDumpsOpts.dumpCount,
+		binaries); err != nil {
+		log.Error(err, "could not configure crash dumps")
+		os.Exit(1)
+	}
+	// The dump directory is not recorded so that the dumps are preserved by uninstall, like the logs
+	j := bootstrapper.NewJournal(configureCrashDumpsOpts.installDir, cmd.Name())
+	for _, binary := range binaries {
+		if err = j.Record(journal.Created, journal.Registry, crashdump.RegistryKey(binary),
+			"dumps written to "+configureCrashDumpsOpts.dumpDir); err != nil {
+			log.Error(err, "could not record crash dump configuration")
+			os.Exit(1)
+		}
+	}
+	log.Info("crash dump configuration completed successfully", "binaries", binaries)
+}
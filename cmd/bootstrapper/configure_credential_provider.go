@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configureCredentialProviderCmd describes the configure-credential-provider command
+	configureCredentialProviderCmd = &cobra.Command{
+		Use:   "configure-credential-provider",
+		Short: "Configures a kubelet image credential provider plugin on the Windows node",
+		Long: "Installs a kubelet image credential provider plugin like ecr-credential-provider and configures the " +
+			"kubelet to use it for the matching images, so that images can be pulled from cloud registries without " +
+			"static pull secrets. This command needs to be executed every time initialize-kubelet is executed.",
+		Run: runConfigureCredentialProviderCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			err := cmd.MarkPersistentFlagRequired("provider-binary")
+			if err != nil {
+				return err
+			}
+			err = cmd.MarkPersistentFlagRequired("match-images")
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	// configureCredentialProviderOpts holds the configure-credential-provider CLI options
+	configureCredentialProviderOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// binary is the location of the credential provider plugin binary
+		binary string
+		// matchImages are the image patterns the plugin is used for
+		matchImages []string
+		// defaultCacheDuration is the default duration the kubelet caches the credentials for
+		defaultCacheDuration time.Duration
+		// args are the arguments the plugin is invoked with
+		args []string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configureCredentialProviderCmd)
+	configureCredentialProviderCmd.PersistentFlags().StringVar(&configureCredentialProviderOpts.installDir,
+		"install-dir", "c:\\k", "Installation directory. Defaults to C:\\k")
+	configureCredentialProviderCmd.PersistentFlags().StringVar(&configureCredentialProviderOpts.binary,
+		"provider-binary", "", "The location of the credential provider plugin binary")
+	configureCredentialProviderCmd.PersistentFlags().StringSliceVar(&configureCredentialProviderOpts.matchImages,
+		"match-images", nil, "The image patterns the plugin is used for, for example *.dkr.ecr.*.amazonaws.com")
+	configureCredentialProviderCmd.PersistentFlags().DurationVar(
+		&configureCredentialProviderOpts.defaultCacheDuration, "default-cache-duration", 12*time.Hour,
+		"The duration the kubelet caches the credentials for if the plugin does not specify one")
+	configureCredentialProviderCmd.PersistentFlags().StringSliceVar(&configureCredentialProviderOpts.args,
+		"provider-args", nil, "The arguments the plugin is invoked with")
+}
+
+// runConfigureCredentialProviderCmd configures the credential provider plugin on the Windows node
+func runConfigureCredentialProviderCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	wmcb, err := bootstrapper.NewWinNodeBootstrapper(configureCredentialProviderOpts.installDir, "", "", "", "")
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	err = wmcb.SetCredentialProvider(configureCredentialProviderOpts.binary,
+		configureCredentialProviderOpts.matchImages, configureCredentialProviderOpts.defaultCacheDuration,
+		configureCredentialProviderOpts.args)
+	if err != nil {
+		log.Error(err, "invalid credential provider options")
+		os.Exit(1)
+	}
+
+	err = wmcb.Configure()
+	if err != nil {
+		log.Error(err, "could not configure credential provider")
+		os.Exit(1)
+	}
+	log.Info("credential provider configuration completed successfully")
+
+	err = wmcb.Disconnect()
+	if err != nil {
+		log.Error(err, "can't clean up bootstrapper")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/logrotate"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/winservice"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// configureLogRotationCmd describes the configure-log-rotation command
+	configureLogRotationCmd = &cobra.Command{
+		Use:   "configure-log-rotation",
+		Short: "Configures the rotation of the logs of the Windows node",
+		Long: "Writes the log rotation configuration of the kubelet, kube-proxy, CNI and containerd logs to the " +
+			"install directory and installs the " + logrotate.ServiceName + " Windows service, which runs " +
+			"rotate-logs to rotate the logs larger than the maximum size and remove the old backups periodically.",
+		Run: runConfigureLogRotationCmd,
+	}
+
+	// configureLogRotationOpts holds the configure-log-rotation CLI options
+	configureLogRotationOpts struct {
+		// installDir is the main installation directory, holding the configuration and the journal
+		installDir string
+		// logDir is the directory of the kubelet, kube-proxy, hybrid-overlay and containerd logs
+		logDir string
+		// cniDir is the location of the CNI binaries and their logs
+		cniDir string
+		// maxSize is the size above which a log file is rotated, as a quantity, e.g. 100Mi
+		maxSize string
+		// maxAge is how long the backups are kept
+		maxAge time.Duration
+		// maxBackups is the number of backups kept per log file
+		maxBackups int
+		// interval is the time between two rotations
+		interval time.Duration
+		// logs are the <name>=<pattern> log targets replacing or adding to the default ones
+		logs []string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configureLogRotationCmd)
+	configureLogRotationCmd.PersistentFlags().StringVar(&configureLogRotationOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	configureLogRotationCmd.PersistentFlags().StringVar(&configureLogRotationOpts.logDir, "log-dir", "",
+		"The directory of the kubelet, kube-proxy, hybrid-overlay and containerd logs. Defaults to the log "+
+			"directory under the install directory")
+	configureLogRotationCmd.PersistentFlags().StringVar(&configureLogRotationOpts.cniDir, "cni-dir", "c:\\k\\cni",
+		"The location of the CNI binaries, whose *.log files are rotated")
+	configureLogRotationCmd.PersistentFlags().StringVar(&configureLogRotationOpts.maxSize, "max-size", "100Mi",
+		"The size above which a log file is rotated, e.g. 100Mi")
+	configureLogRotationCmd.PersistentFlags().DurationVar(&configureLogRotationOpts.maxAge, "max-age",
+		logrotate.DefaultMaxAge, "How long the backups are kept, 0 to keep them regardless of their age")
+	configureLogRotationCmd.PersistentFlags().IntVar(&configureLogRotationOpts.maxBackups, "max-backups",
+		logrotate.DefaultMaxBackups, "The number of backups kept per log file, 0 to keep them all")
+	configureLogRotationCmd.PersistentFlags().DurationVar(&configureLogRotationOpts.interval, "interval",
+		logrotate.DefaultInterval, "The interval between two rotations")
+	configureLogRotationCmd.PersistentFlags().StringSliceVar(&configureLogRotationOpts.logs, "log", nil,
+		"A log target as <name>=<pattern>[;<pattern>...], replacing the default target of the same name, e.g. "+
+			"kubelet, kube-proxy, cni or containerd, or adding a new one. Can be given multiple times")
+}
+
+// runConfigureLogRotationCmd writes the log rotation configuration and installs the log rotation service
+func runConfigureLogRotationCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	config, err := logRotationConfig()
+	if err != nil {
+		log.Error(err, "invalid log rotation configuration")
+		os.Exit(1)
+	}
+	configPath := filepath.Join(configureLogRotationOpts.installDir, logrotate.ConfigFileName)
+	if err = logrotate.WriteConfig(configPath, config); err != nil {
+		log.Error(err, "could not write log rotation configuration")
+		os.Exit(1)
+	}
+	j := bootstrapper.NewJournal(configureLogRotationOpts.installDir, cmd.Name())
+	if err = j.Record(journal.Created, journal.File, configPath, "log rotation configuration"); err != nil {
+		log.Error(err, "could not record log rotation configuration")
+		os.Exit(1)
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Error(err, "could not get executable path")
+		os.Exit(1)
+	}
+	serviceArgs := []string{"rotate-logs", "--config=" + configPath}
+	err = winservice.Install(logrotate.ServiceName, "OpenShift Windows node log rotation", exePath, serviceArgs...)
+	if err != nil {
+		log.Error(err, "could not install log rotation service")
+		os.Exit(1)
+	}
+	// The backups are not recorded so that they are preserved by uninstall, like the logs
+	if err = j.Record(journal.Created, journal.Service, logrotate.ServiceName,
+		exePath+" "+strings.Join(serviceArgs, " ")); err != nil {
+		log.Error(err, "could not record log rotation service")
+		os.Exit(1)
+	}
+	log.Info("log rotation configuration completed successfully", "service", logrotate.ServiceName,
+		"config", configPath)
+}
+
+// logRotationConfig returns the log rotation configuration of the current options
+func logRotationConfig() (*logrotate.Config, error) {
+	maxSize, err := resource.ParseQuantity(configureLogRotationOpts.maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maximum size %s: %v", configureLogRotationOpts.maxSize, err)
+	}
+	logDir := configureLogRotationOpts.logDir
+	if logDir == "" {
+		logDir = filepath.Join(configureLogRotationOpts.installDir, "log")
+	}
+	config := &logrotate.Config{
+		MaxSize:    maxSize.Value(),
+		MaxAge:     logrotate.Duration(configureLogRotationOpts.maxAge),
+		MaxBackups: configureLogRotationOpts.maxBackups,
+		Interval:   logrotate.Duration(configureLogRotationOpts.interval),
+		Targets:    logrotate.DefaultTargets(logDir, configureLogRotationOpts.cniDir),
+	}
+	for _, spec := range configureLogRotationOpts.logs {
+		target, err := logrotate.ParseTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		replaced := false
+		for i := range config.Targets {
+			if config.Targets[i].Name == target.Name {
+				config.Targets[i], replaced = target, true
+			}
+		}
+		if !replaced {
+			config.Targets = append(config.Targets, target)
+		}
+	}
+	return config, config.Validate()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/registrymirror"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configureRegistryMirrorsCmd describes the configure-registry-mirrors command
+	configureRegistryMirrorsCmd = &cobra.Command{
+		Use:   "configure-registry-mirrors",
+		Short: "Configures the registry mirrors of the cluster on the Windows node",
+		Long: "Configures the container runtime of the Windows node to pull images from the mirrors listed by the " +
+			"ImageContentSourcePolicies of the cluster, as the Linux nodes do, e.g. in disconnected clusters. " +
+			"containerd is configured with a hosts.toml file per registry in its registry configuration directory, " +
+			"which has to be the config_path of its CRI registry configuration. Docker is configured with the " +
+			"registry-mirrors of its daemon configuration and restarted. The mirrors the runtime cannot express are " +
+			"logged and skipped.",
+		Run: runConfigureRegistryMirrorsCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("icsp-file")
+		},
+	}
+
+	// configureRegistryMirrorsOpts holds the configure-registry-mirrors CLI options
+	configureRegistryMirrorsOpts struct {
+		// icspFile is the location of the ImageContentSourcePolicies of the cluster in JSON
+		icspFile string
+		// runtime is the container runtime the mirrors are configured for
+		runtime string
+		// containerdHostsDir is the containerd registry configuration directory
+		containerdHostsDir string
+		// dockerConfig is the location of the Docker daemon configuration
+		dockerConfig string
+		// installDir is the main installation directory, holding the journal
+		installDir string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(configureRegistryMirrorsCmd)
+	configureRegistryMirrorsCmd.PersistentFlags().StringVar(&configureRegistryMirrorsOpts.icspFile, "icsp-file", "",
+		"The location of the ImageContentSourcePolicies of the cluster, as returned by "+
+			"oc get imagecontentsourcepolicy -o json")
+	configureRegistryMirrorsCmd.PersistentFlags().StringVar(&configureRegistryMirrorsOpts.runtime, "runtime",
+		string(containerruntime.Auto), "The container runtime the mirrors are configured for: docker, containerd or auto "+
+			"to detect it")
+	configureRegistryMirrorsCmd.PersistentFlags().StringVar(&configureRegistryMirrorsOpts.containerdHostsDir,
+		"containerd-hosts-dir", "C:\\Program Files\\containerd\\certs.d",
+		"The containerd registry configuration directory the hosts.toml files are written to")
+	configureRegistryMirrorsCmd.PersistentFlags().StringVar(&configureRegistryMirrorsOpts.dockerConfig,
+		"docker-config", "C:\\ProgramData\\docker\\config\\daemon.json", "The location of the Docker daemon "+
+			"configuration")
+	configureRegistryMirrorsCmd.PersistentFlags().StringVar(&configureRegistryMirrorsOpts.installDir, "install-dir",
+		"c:\\k", "Installation directory. Defaults to C:\\k")
+}
+
+// runConfigureRegistryMirrorsCmd configures the registry mirrors of the cluster on the Windows node
+func runConfigureRegistryMirrorsCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	runtime, err := containerruntime.Parse(configureRegistryMirrorsOpts.runtime)
+	if err != nil {
+		log.Error(err, "invalid container runtime")
+		os.Exit(1)
+	}
+	if runtime, err = containerruntime.Resolve(runtime); err != nil {
+		log.Error(err, "could not detect container runtime")
+		os.Exit(1)
+	}
+	policies, err := ioutil.ReadFile(configureRegistryMirrorsOpts.icspFile)
+	if err != nil {
+		log.Error(err, "could not read ImageContentSourcePolicies")
+		os.Exit(1)
+	}
+	mirrors, err := registrymirror.ParseImageContentSourcePolicies(policies)
+	if err != nil {
+		log.Error(err, "invalid ImageContentSourcePolicies")
+		os.Exit(1)
+	}
+	if len(mirrors) == 0 {
+		log.Info("no registry mirrors to configure")
+		return
+	}
+
+	j := bootstrapper.NewJournal(configureRegistryMirrorsOpts.installDir, cmd.Name())
+	var unsupported []error
+	if runtime == containerruntime.Docker {
+		unsupported, err = configureDockerMirrors(j, mirrors)
+	} else {
+		unsupported, err = configureContainerdMirrors(j, mirrors)
+	}
+	for _, mirror := range unsupported {
+		log.Info("skipping registry mirror", "reason", mirror.Error())
+	}
+	if err != nil {
+		log.Error(err, "could not configure registry mirrors")
+		os.Exit(1)
+	}
+	log.Info("registry mirror configuration completed successfully", "runtime", runtime, "sources", len(mirrors))
+}
+
+// configureContainerdMirrors writes the containerd hosts.toml files of the given mirrors and records them in the
+// given journal. containerd reads them on every pull, so it does not need to be restarted.
+func configureContainerdMirrors(j *journal.Journal, mirrors []registrymirror.Mirror) ([]error, error) {
+	paths, unsupported, err := registrymirror.WriteContainerdHosts(configureRegistryMirrorsOpts.containerdHostsDir,
+		mirrors)
+	for _, path := range paths {
+		if recordErr := j.Record(journal.Created, journal.File, path, "registry mirrors"); recordErr != nil {
+			return unsupported, recordErr
+		}
+	}
+	return unsupported, err
+}
+
+// configureDockerMirrors adds the given mirrors to the Docker daemon configuration, records the change in the given
+// journal and restarts Docker to apply it
+func configureDockerMirrors(j *journal.Journal, mirrors []registrymirror.Mirror) ([]error, error) {
+	configPath := configureRegistryMirrorsOpts.dockerConfig
+	existing, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	created := os.IsNotExist(err)
+	config, unsupported, err := registrymirror.DockerDaemonConfig(existing, mirrors)
+	if err != nil {
+		return unsupported, err
+	}
+	if err = os.MkdirAll(filepath.Dir(configPath), os.ModeDir); err != nil {
+		return unsupported, err
+	}
+	if err = ioutil.WriteFile(configPath, config, 0644); err != nil {
+		return unsupported, err
+	}
+	// A configuration that existed before is only recorded as a setting, so that uninstall does not remove it
+	if created {
+		err = j.Record(journal.Created, journal.File, configPath, "registry mirrors")
+	} else {
+		err = j.Record(journal.Modified, journal.Setting, "docker registry-mirrors", configPath)
+	}
+	if err != nil {
+		return unsupported, err
+	}
+	if out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"Restart-Service docker").CombinedOutput(); err != nil {
+		log.Info("could not restart docker", "output", string(out))
+		return unsupported, err
+	}
+	return unsupported, nil
+}
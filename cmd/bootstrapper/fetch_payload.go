@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/hooks"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// fetchPayloadCmd describes the fetch-payload command
+	fetchPayloadCmd = &cobra.Command{
+		Use:   "fetch-payload",
+		Short: "Fetches the artifacts needed to bootstrap the Windows node",
+		Long: "Fetches artifacts like the kubelet, the CNI plugins or the hybrid overlay from a payload source to a " +
+			"directory of the node, before running initialize-kubelet and configure-cni. The source is a local " +
+			"directory (dir:<path> or an absolute path), an HTTP mirror (http:// or https:// URL), a GitHub release " +
+			"(github:<owner>/<repo>[@<tag>]) or the directory of a component image of an OpenShift release image " +
+			"(release:<component>[:<dir>]@<release image>). The artifacts of a release image are extracted from the " +
+			"layers of its component image, pulled with --pull-secret, so that they match the version of the cluster.",
+		Run: runFetchPayloadCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			err := cmd.MarkPersistentFlagRequired("source")
+			if err != nil {
+				return err
+			}
+			return cmd.MarkPersistentFlagRequired("artifact")
+		},
+	}
+
+	// fetchPayloadOpts holds the fetch-payload CLI options
+	fetchPayloadOpts struct {
+		// source is the spec of the payload source
+		source string
+		// artifacts are the names of the artifacts to fetch
+		artifacts []string
+		// dir is the directory the artifacts are written to
+		dir string
+		// pullSecret is the location of the pull secret used to pull the release images
+		pullSecret string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(fetchPayloadCmd)
+	fetchPayloadCmd.PersistentFlags().StringVar(&fetchPayloadOpts.source, "source", "",
+		"The payload source, e.g. dir:C:\\payload, https://mirror.example.com/4.6 or "+
+			"github:openshift/windows-machine-config-bootstrapper@v4.6.0")
+	fetchPayloadCmd.PersistentFlags().StringSliceVar(&fetchPayloadOpts.artifacts, "artifact", nil,
+		"The names of the artifacts to fetch, e.g. kubelet.exe,hybrid-overlay.exe")
+	fetchPayloadCmd.PersistentFlags().StringVar(&fetchPayloadOpts.dir, "dir", "c:\\k",
+		"The directory the artifacts are written to. Defaults to C:\\k")
+	fetchPayloadCmd.PersistentFlags().StringVar(&fetchPayloadOpts.pullSecret, "pull-secret", "",
+		"The location of the pull secret used to pull the images of a release image source, e.g. the pull secret "+
+			"of the cluster")
+}
+
+// runFetchPayloadCmd fetches the artifacts from the payload source
+func runFetchPayloadCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	source, err := payload.ParseSource(fetchPayloadOpts.source)
+	if err != nil {
+		log.Error(err, "invalid payload source")
+		os.Exit(1)
+	}
+	if release, ok := source.(*payload.ReleaseImage); ok {
+		release.PullSecret = fetchPayloadOpts.pullSecret
+	}
+	if err = runHooks(hooks.PreDownload); err != nil {
+		log.Error(err, "pre-download hooks failed")
+		os.Exit(1)
+	}
+	if err = payload.FetchAll(source, fetchPayloadOpts.artifacts, fetchPayloadOpts.dir); err != nil {
+		log.Error(err, "could not fetch payload")
+		os.Exit(1)
+	}
+	log.Info("payload fetched successfully", "source", source.String(), "artifacts", fetchPayloadOpts.artifacts)
+}
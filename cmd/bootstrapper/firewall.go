@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/firewall"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// firewallCmd describes the firewall command
+	firewallCmd = &cobra.Command{
+		Use:   "firewall",
+		Short: "Snapshots and diffs the Windows Firewall rules of the node",
+		Long: "Takes a snapshot of the Windows Firewall rules of the node. With --save the snapshot is written to the " +
+			"given file, which is meant to be done before the first bootstrap. With --compare the rules of the node " +
+			"are compared with the snapshot written to the given file and the rules added, removed and changed since " +
+			"are printed, the command failing if there are any. Comparing after uninstall proves that the node was " +
+			"returned to the firewall it had before the bootstrap.",
+		Run: runFirewallCmd,
+	}
+
+	// firewallOpts holds the firewall CLI options
+	firewallOpts struct {
+		// save is the file to write the snapshot to
+		save string
+		// compare is the file of the snapshot to compare the rules of the node with
+		compare string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(firewallCmd)
+	firewallCmd.PersistentFlags().StringVar(&firewallOpts.save, "save", "",
+		"File to write the snapshot of the rules to")
+	firewallCmd.PersistentFlags().StringVar(&firewallOpts.compare, "compare", "",
+		"File of the snapshot to compare the rules of the node with")
+}
+
+// runFirewallCmd saves a snapshot of the firewall rules or compares them with a saved one, exiting with a non zero
+// code if they differ
+func runFirewallCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	if (firewallOpts.save == "") == (firewallOpts.compare == "") {
+		log.Error(fmt.Errorf("one of --save or --compare is required"), "invalid arguments")
+		os.Exit(1)
+	}
+	snapshot, err := firewall.Take()
+	if err != nil {
+		log.Error(err, "could not take firewall snapshot")
+		os.Exit(1)
+	}
+	if firewallOpts.save != "" {
+		if err = snapshot.Write(firewallOpts.save); err != nil {
+			log.Error(err, "could not save firewall snapshot")
+			os.Exit(1)
+		}
+		log.Info("firewall snapshot saved", "file", firewallOpts.save, "rules", len(snapshot.Rules))
+		return
+	}
+
+	before, err := firewall.Read(firewallOpts.compare)
+	if err != nil {
+		log.Error(err, "could not read firewall snapshot")
+		os.Exit(1)
+	}
+	diff := firewall.Compare(before, snapshot)
+	if !diff.Empty() {
+		fmt.Println(diff.String())
+		log.Error(fmt.Errorf("%d rules added, %d removed and %d changed since %s", len(diff.Added),
+			len(diff.Removed), len(diff.Changed), before.Time), "firewall differs from the snapshot")
+		os.Exit(1)
+	}
+	log.Info("firewall matches the snapshot", "file", firewallOpts.compare)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/hooks"
+)
+
+// runHooks runs the hook scripts of the given point of the bootstrap, returning an error if one of them fails
+func runHooks(point hooks.Point) error {
+	runner, err := hooks.NewRunner(rootOpts.hooksDir, rootOpts.hookLogDir, rootOpts.hookTimeout,
+		rootOpts.allowUnsignedHooks)
+	if err != nil {
+		return err
+	}
+	scripts, err := runner.Scripts(point)
+	if err != nil || len(scripts) == 0 {
+		return err
+	}
+	log.Info("running hooks", "point", point, "scripts", scripts)
+	if err = runner.Run(point); err != nil {
+		return err
+	}
+	log.Info("hooks completed successfully", "point", point, "log-dir", rootOpts.hookLogDir)
+	return nil
+}
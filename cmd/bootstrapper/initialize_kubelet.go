@@ -2,9 +2,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bitlocker"
 	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/hooks"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ignition"
 	"github.com/spf13/cobra"
 )
 
@@ -31,10 +37,60 @@ var (
 	initializeKubeletOpts struct {
 		// The location of the ignition file
 		ignitionFile string
+		// The URL the ignition file is fetched from to the location of the ignition file
+		ignitionURL string
+		// The CA the certificate of the server of the ignition file is verified against
+		ignitionCAFile string
+		// Skip the verification of the certificate of the server of the ignition file
+		insecureIgnition bool
+		// How long the transient failures to fetch the ignition file are retried for
+		ignitionTimeout time.Duration
 		// The location where the kubelet.exe has been downloaded to
 		kubeletPath string
 		// The directory to install the kubelet and related files
 		installDir string
+		// The IP addresses of the cluster DNS service, overriding the ones in the ignition file
+		clusterDNS []string
+		// The cluster domain, overriding the one in the ignition file
+		clusterDomain string
+		// Add the cluster domain to the DNS suffix search list of the node
+		configureDNSSearchList bool
+		// The size of the pagefile in MB, -1 leaves it unchanged and 0 disables it
+		pagefileSize int
+		// The kubelet hard eviction thresholds, overriding the ones in the ignition file
+		evictionHard string
+		// The container isolation mode of the node, process or hyperv
+		containerIsolation string
+		// The image of the pod infra containers, overriding the default pause image
+		pauseImage string
+		// Skip the check of the Windows activation status
+		skipActivationCheck bool
+		// Skip the check that the node is not pending a reboot
+		skipPendingRebootCheck bool
+		// The kubelet feature gates, as <gate>=<true|false>
+		featureGates []string
+		// The extra kubelet arguments, as <name>=<value>
+		kubeletArgs []string
+		// The IP family of the node, ipv4, ipv6 or dual
+		ipFamily string
+		// The addresses the node registers with
+		nodeIPs []string
+		// The directory the kubelet writes its log file to
+		logDir string
+		// The container runtime of the node, docker, containerd or auto
+		containerRuntime string
+		// The directory the kubelet keeps its state in
+		kubeletRootDir string
+		// The directory of the kubelet certificates
+		kubeletCertDir string
+		// The directory of the static pod manifests
+		podManifestDir string
+		// The provider ID of the node, auto to compute it or none to leave it to the kubelet
+		providerID string
+		// Verify or enable the BitLocker encryption of the data volume of the node
+		bitLocker string
+		// The key protector the data volume is encrypted with, tpm or password-file=<path>
+		bitLockerProtector string
 	}
 )
 
@@ -42,10 +98,77 @@ func init() {
 	rootCmd.AddCommand(initializeKubeletCmd)
 	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.ignitionFile, "ignition-file", "",
 		"Ignition file location to bootstrap the Windows node")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.ignitionURL, "ignition-url", "",
+		"URL of the ignition file, e.g. https://api-int.<cluster>:22623/config/worker, fetched to the ignition "+
+			"file location before bootstrapping. Defaults to using the existing ignition file")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.ignitionCAFile, "ignition-ca-file", "",
+		"PEM file of the cluster CA the certificate of the ignition server is verified against, e.g. the ca.crt "+
+			"of the root-ca ConfigMap of kube-system. Required for https ignition URLs unless --insecure-ignition is set")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.insecureIgnition, "insecure-ignition",
+		false, "Skip the verification of the certificate of the ignition server. Required for http ignition URLs")
+	initializeKubeletCmd.PersistentFlags().DurationVar(&initializeKubeletOpts.ignitionTimeout, "ignition-timeout",
+		ignition.DefaultTimeout, "How long the transient failures to fetch the ignition file are retried for")
 	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.kubeletPath, "kubelet-path", "",
 		"Kubelet file location to bootstrap the Windows node")
 	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.installDir, "install-dir", "c:\\k",
 		"Kubelet file location to bootstrap the Windows node. Defaults to C:\\k")
+	initializeKubeletCmd.PersistentFlags().StringSliceVar(&initializeKubeletOpts.clusterDNS, "cluster-dns", nil,
+		"IP addresses of the cluster DNS service. Defaults to the value in the ignition file")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.clusterDomain, "cluster-domain", "",
+		"The cluster domain. Defaults to the value in the ignition file")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.configureDNSSearchList,
+		"configure-dns-search-list", false, "Add the cluster domain to the DNS suffix search list of the node")
+	initializeKubeletCmd.PersistentFlags().IntVar(&initializeKubeletOpts.pagefileSize, "pagefile-size", -1,
+		"The size of the pagefile in MB, 0 disables the pagefile. Takes effect after a reboot. "+
+			"Defaults to leaving the pagefile unchanged")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.evictionHard, "eviction-hard", "",
+		"The kubelet hard eviction thresholds, e.g. memory.available<500Mi. Defaults to the value in the ignition file")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.containerIsolation, "container-isolation",
+		bootstrapper.ProcessIsolation, "The container isolation mode of the node, process or hyperv. "+
+			"Hyper-V isolation requires the Hyper-V Windows feature to be installed")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.pauseImage, "pause-image", "",
+		"The image of the pod infra containers. Defaults to a multi-arch pause image matching the node")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.skipActivationCheck,
+		"skip-activation-check", false, "Skip the check that the Windows evaluation or activation grace period "+
+			"of the node has not ended")
+	initializeKubeletCmd.PersistentFlags().BoolVar(&initializeKubeletOpts.skipPendingRebootCheck,
+		"skip-pending-reboot-check", false, "Skip the check that the node is not pending a reboot to complete the "+
+			"installation of a Windows feature or a computer rename")
+	initializeKubeletCmd.PersistentFlags().StringSliceVar(&initializeKubeletOpts.featureGates, "feature-gates", nil,
+		"Kubelet feature gates to set, as <gate>=<true|false>, e.g. WindowsHostProcessContainers=true. Only the "+
+			"Windows related alpha and beta feature gates are allowed")
+	initializeKubeletCmd.PersistentFlags().StringArrayVar(&initializeKubeletOpts.kubeletArgs, "kubelet-arg", nil,
+		"Extra kubelet argument, as <name>=<value>, e.g. node-ip=10.0.0.5. Can be repeated. Only the arguments "+
+			"not managed by WMCB are allowed")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.ipFamily, "ip-family", "",
+		"The IP family of the node, ipv4, ipv6 or dual. Defaults to letting the kubelet pick the node IP")
+	initializeKubeletCmd.PersistentFlags().StringSliceVar(&initializeKubeletOpts.nodeIPs, "node-ip", nil,
+		"The addresses the node registers with, one of each family for a dual-stack node. Requires --ip-family. "+
+			"Defaults to the first address of each family of the network interfaces of the node")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.logDir, "log-dir", "",
+		"The directory the kubelet writes kubelet.log to, e.g. a directory read by the log collector of the "+
+			"cluster. Defaults to the log directory under the install directory")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.containerRuntime, "container-runtime",
+		string(containerruntime.Auto), "The container runtime of the node: docker, containerd or auto to detect "+
+			"the one installed. The kubelet service depends on the Windows service of the runtime")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.kubeletRootDir, "kubelet-root-dir", "",
+		"The directory the kubelet keeps its state in, e.g. d:\\kubelet. Defaults to c:\\var\\lib\\kubelet")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.kubeletCertDir, "kubelet-cert-dir", "",
+		"The directory of the kubelet certificates. Defaults to the pki directory under the kubelet root directory")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.podManifestDir, "pod-manifest-dir", "",
+		"The directory of the static pod manifests. Defaults to etc\\kubernetes\\manifests under the install directory")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.providerID, "provider-id",
+		bootstrapper.ProviderIDAuto, "The provider ID the node registers with, which the cloud controller manager "+
+			"finds its instance by, e.g. to add it to the load balancers. auto computes it on AWS, Azure and vSphere "+
+			"from the cloud provider of the ignition file, none leaves it to the kubelet")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.bitLocker, "bitlocker", "",
+		"Require the volume of the kubelet root directory to be encrypted with BitLocker: verify fails if it is "+
+			"not, enable encrypts it with --bitlocker-protector if it is not. Defaults to leaving it unchecked")
+	initializeKubeletCmd.PersistentFlags().StringVar(&initializeKubeletOpts.bitLockerProtector,
+		"bitlocker-protector", string(bitlocker.TPM), "The key protector --bitlocker enable encrypts the volume "+
+			"with: tpm, the virtual TPM of the instance for the system volume or a recovery password for a data "+
+			"volume, or password-file=<path>, a file holding a password supplied by the cloud, for a data volume. "+
+			"A data volume is unlocked at boot and requires the system volume to be encrypted")
 }
 
 // runInitializeKubeletCmd starts the Windows Machine Config Bootstrapper
@@ -53,6 +176,28 @@ func runInitializeKubeletCmd(cmd *cobra.Command, args []string) {
 	flag.Parse()
 	// TODO: add validation for flags
 
+	if initializeKubeletOpts.ignitionURL != "" {
+		if initializeKubeletOpts.insecureIgnition {
+			log.Info("the certificate of the ignition server is not verified", "url",
+				initializeKubeletOpts.ignitionURL)
+		}
+		attempts, err := ignition.Fetch(ignition.FetchOptions{
+			URL:      initializeKubeletOpts.ignitionURL,
+			CAFile:   initializeKubeletOpts.ignitionCAFile,
+			Insecure: initializeKubeletOpts.insecureIgnition,
+			Timeout:  initializeKubeletOpts.ignitionTimeout,
+		}, initializeKubeletOpts.ignitionFile)
+		if err != nil {
+			log.Error(err, "could not fetch the ignition file")
+			os.Exit(1)
+		}
+		log.Info("fetched the ignition file", "url", initializeKubeletOpts.ignitionURL, "attempts", attempts)
+	} else if initializeKubeletOpts.ignitionCAFile != "" || initializeKubeletOpts.insecureIgnition {
+		log.Error(fmt.Errorf("--ignition-ca-file and --insecure-ignition require --ignition-url"),
+			"invalid ignition options")
+		os.Exit(1)
+	}
+
 	wmcb, err := bootstrapper.NewWinNodeBootstrapper(initializeKubeletOpts.installDir,
 		initializeKubeletOpts.ignitionFile, initializeKubeletOpts.kubeletPath, "", "")
 	if err != nil {
@@ -60,13 +205,108 @@ func runInitializeKubeletCmd(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if len(initializeKubeletOpts.clusterDNS) > 0 || initializeKubeletOpts.clusterDomain != "" ||
+		initializeKubeletOpts.configureDNSSearchList {
+		err = wmcb.SetDNSOptions(initializeKubeletOpts.clusterDNS, initializeKubeletOpts.clusterDomain,
+			initializeKubeletOpts.configureDNSSearchList)
+		if err != nil {
+			log.Error(err, "invalid DNS options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.pagefileSize != -1 || initializeKubeletOpts.evictionHard != "" {
+		err = wmcb.SetMemoryOptions(initializeKubeletOpts.pagefileSize, initializeKubeletOpts.evictionHard)
+		if err != nil {
+			log.Error(err, "invalid memory options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.containerIsolation != bootstrapper.ProcessIsolation ||
+		initializeKubeletOpts.pauseImage != "" {
+		err = wmcb.SetIsolationOptions(initializeKubeletOpts.containerIsolation, initializeKubeletOpts.pauseImage)
+		if err != nil {
+			log.Error(err, "invalid isolation options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.ipFamily != "" {
+		err = wmcb.SetNodeIPOptions(initializeKubeletOpts.ipFamily, initializeKubeletOpts.nodeIPs)
+		if err != nil {
+			log.Error(err, "invalid node IP options")
+			os.Exit(1)
+		}
+	} else if len(initializeKubeletOpts.nodeIPs) > 0 {
+		log.Error(fmt.Errorf("--node-ip requires --ip-family"), "invalid node IP options")
+		os.Exit(1)
+	}
+
+	if len(initializeKubeletOpts.featureGates) > 0 || len(initializeKubeletOpts.kubeletArgs) > 0 {
+		err = wmcb.SetKubeletOptions(initializeKubeletOpts.featureGates, initializeKubeletOpts.kubeletArgs)
+		if err != nil {
+			log.Error(err, "invalid kubelet options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.logDir != "" {
+		if err = wmcb.SetLogOptions(initializeKubeletOpts.logDir); err != nil {
+			log.Error(err, "invalid log options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.kubeletRootDir != "" || initializeKubeletOpts.kubeletCertDir != "" ||
+		initializeKubeletOpts.podManifestDir != "" {
+		err = wmcb.SetKubeletDirOptions(initializeKubeletOpts.kubeletRootDir, initializeKubeletOpts.kubeletCertDir,
+			initializeKubeletOpts.podManifestDir)
+		if err != nil {
+			log.Error(err, "invalid kubelet directory options")
+			os.Exit(1)
+		}
+	}
+
+	if err = wmcb.SetProviderIDOptions(initializeKubeletOpts.providerID); err != nil {
+		log.Error(err, "invalid provider ID options")
+		os.Exit(1)
+	}
+
+	if err = wmcb.SetContainerRuntimeOptions(initializeKubeletOpts.containerRuntime); err != nil {
+		log.Error(err, "invalid container runtime options")
+		os.Exit(1)
+	}
+
+	if initializeKubeletOpts.bitLocker != "" {
+		err = wmcb.SetBitLockerOptions(initializeKubeletOpts.bitLocker, initializeKubeletOpts.bitLockerProtector)
+		if err != nil {
+			log.Error(err, "invalid BitLocker options")
+			os.Exit(1)
+		}
+	}
+
+	if initializeKubeletOpts.skipActivationCheck {
+		wmcb.SkipActivationCheck()
+	}
+	if initializeKubeletOpts.skipPendingRebootCheck {
+		wmcb.SkipPendingRebootCheck()
+	}
+
 	err = wmcb.InitializeKubelet()
+	for _, warning := range wmcb.Warnings() {
+		log.Info("warning", "warning", warning)
+	}
 	if err != nil {
 		log.Error(err, "could not run bootstrapper")
 		os.Exit(1)
 	} else {
 		log.Info("Bootstrapping completed successfully")
 	}
+	if err = runHooks(hooks.PostKubeletInstall); err != nil {
+		log.Error(err, "post-kubelet-install hooks failed")
+		os.Exit(1)
+	}
 
 	err = wmcb.Disconnect()
 	if err != nil {
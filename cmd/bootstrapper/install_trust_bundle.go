@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/registrymirror"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/trustbundle"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	// installTrustBundleCmd describes the install-trust-bundle command
+	installTrustBundleCmd = &cobra.Command{
+		Use:   "install-trust-bundle",
+		Short: "Installs the additional trust bundle of the cluster on the Windows node",
+		Long: "Installs the certificates of the additional trust bundle of the cluster, like the CA of a proxy or of a " +
+			"custom registry, in the certificate store of the Windows node, which the container runtime and the " +
+			"kubelet verify the servers they connect to against. The self-signed certificates are added to the " +
+			"trusted root store and the others to the intermediate store. The bundle is also written as the CA file " +
+			"of the registries given with --registry in the registry configuration of the container runtime. The " +
+			"certificates are picked up without restarting any service.",
+		Run: runInstallTrustBundleCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("ca-bundle")
+		},
+	}
+
+	// installTrustBundleOpts holds the install-trust-bundle CLI options
+	installTrustBundleOpts struct {
+		// caBundle is the location of the trust bundle, a PEM file or the ConfigMap holding it in JSON
+		caBundle string
+		// registries are the registry hosts whose CA file is the trust bundle
+		registries []string
+		// runtime is the container runtime the registry CA files are written for
+		runtime string
+		// containerdHostsDir is the containerd registry configuration directory
+		containerdHostsDir string
+		// dockerCertsDir is the Docker registry certificates directory
+		dockerCertsDir string
+		// installDir is the main installation directory, holding the journal
+		installDir string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(installTrustBundleCmd)
+	installTrustBundleCmd.PersistentFlags().StringVar(&installTrustBundleOpts.caBundle, "ca-bundle", "",
+		"The location of the trust bundle, a PEM file or the ConfigMap holding it as returned by "+
+			"oc get configmap user-ca-bundle -n openshift-config -o json")
+	installTrustBundleCmd.PersistentFlags().StringSliceVar(&installTrustBundleOpts.registries, "registry", nil,
+		"The registries whose CA file is the trust bundle, e.g. registry.example.com:5000")
+	installTrustBundleCmd.PersistentFlags().StringVar(&installTrustBundleOpts.runtime, "runtime",
+		string(containerruntime.Auto), "The container runtime the registry CA files are written for: docker, "+
+			"containerd or auto to detect it")
+	installTrustBundleCmd.PersistentFlags().StringVar(&installTrustBundleOpts.containerdHostsDir,
+		"containerd-hosts-dir", "C:\\Program Files\\containerd\\certs.d",
+		"The containerd registry configuration directory the registry CA files are written to")
+	installTrustBundleCmd.PersistentFlags().StringVar(&installTrustBundleOpts.dockerCertsDir, "docker-certs-dir",
+		"C:\\ProgramData\\docker\\certs.d", "The Docker registry certificates directory the registry CA files are "+
+			"written to")
+	installTrustBundleCmd.PersistentFlags().StringVar(&installTrustBundleOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+}
+
+// runInstallTrustBundleCmd installs the trust bundle on the Windows node
+func runInstallTrustBundleCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	data, err := ioutil.ReadFile(installTrustBundleOpts.caBundle)
+	if err != nil {
+		log.Error(err, "could not read trust bundle")
+		os.Exit(1)
+	}
+	certs, err := trustbundle.Parse(data)
+	if err != nil {
+		log.Error(err, "invalid trust bundle")
+		os.Exit(1)
+	}
+
+	j := bootstrapper.NewJournal(installTrustBundleOpts.installDir, cmd.Name())
+	for _, cert := range certs {
+		installed, err := installCertificate(j, cert)
+		if err != nil {
+			log.Error(err, "could not install certificate", "certificate", trustbundle.Describe(cert))
+			os.Exit(1)
+		}
+		if installed {
+			log.Info("installed certificate", "certificate", trustbundle.Describe(cert))
+		}
+	}
+
+	if len(installTrustBundleOpts.registries) > 0 {
+		runtime, err := containerruntime.Parse(installTrustBundleOpts.runtime)
+		if err != nil {
+			log.Error(err, "invalid container runtime")
+			os.Exit(1)
+		}
+		if runtime, err = containerruntime.Resolve(runtime); err != nil {
+			log.Error(err, "could not detect container runtime")
+			os.Exit(1)
+		}
+		if err = writeRegistryCAs(j, runtime, trustbundle.EncodePEM(certs)); err != nil {
+			log.Error(err, "could not configure the registry CAs")
+			os.Exit(1)
+		}
+	}
+	log.Info("trust bundle installed successfully", "certificates", len(certs),
+		"registries", installTrustBundleOpts.registries)
+}
+
+// installCertificate adds the given certificate to its store of the machine and records it in the given journal,
+// returning false if it was already present. The certificates already present are not recorded, so that uninstall
+// does not remove certificates WMCB did not install.
+func installCertificate(j *journal.Journal, cert *x509.Certificate) (bool, error) {
+	key := trustbundle.RegistryKey(cert)
+	if existing, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE); err == nil {
+		existing.Close()
+		return false, nil
+	}
+	dir, err := ioutil.TempDir("", "trust-bundle")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, trustbundle.Thumbprint(cert)+".crt")
+	if err = ioutil.WriteFile(path, trustbundle.EncodePEM([]*x509.Certificate{cert}), 0644); err != nil {
+		return false, err
+	}
+	if out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"Import-Certificate -FilePath '"+strings.ReplaceAll(path, "'", "''")+
+			"' -CertStoreLocation Cert:\\LocalMachine\\"+trustbundle.Store(cert)).CombinedOutput(); err != nil {
+		return false, fmt.Errorf("%v: %s", err, out)
+	}
+	return true, j.Record(journal.Created, journal.Registry, `HKLM\`+key, trustbundle.Describe(cert))
+}
+
+// writeRegistryCAs writes the given bundle as the CA file of each of the registries in the registry configuration of
+// the given container runtime, and records the files in the given journal. The containerd hosts.toml files of the
+// registries, e.g. written by configure-registry-mirrors, are updated to use the CA file.
+func writeRegistryCAs(j *journal.Journal, runtime containerruntime.Runtime, bundle []byte) error {
+	configDir := installTrustBundleOpts.dockerCertsDir
+	if runtime == containerruntime.Containerd {
+		configDir = installTrustBundleOpts.containerdHostsDir
+	}
+	for _, host := range installTrustBundleOpts.registries {
+		host = strings.TrimSpace(host)
+		dir := filepath.Join(configDir, registrymirror.HostsDirName(host))
+		if err := os.MkdirAll(dir, os.ModeDir); err != nil {
+			return fmt.Errorf("could not make %s directory: %v", dir, err)
+		}
+		caPath := filepath.Join(dir, trustbundle.CAFileName)
+		if err := ioutil.WriteFile(caPath, bundle, 0644); err != nil {
+			return fmt.Errorf("could not write %s: %v", caPath, err)
+		}
+		if err := j.Record(journal.Created, journal.File, caPath, "trust bundle of "+host); err != nil {
+			return err
+		}
+		if runtime != containerruntime.Containerd {
+			continue
+		}
+		hostsPath := filepath.Join(dir, registrymirror.HostsFileName)
+		hosts, err := ioutil.ReadFile(hostsPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(hostsPath, trustbundle.ContainerdHostsWithCA(hosts, caPath), 0644); err != nil {
+			return fmt.Errorf("could not write %s: %v", hostsPath, err)
+		}
+		if err = j.Record(journal.Modified, journal.Setting, "containerd ca of "+host, hostsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
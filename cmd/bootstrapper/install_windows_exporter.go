@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/windowsexporter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// installWindowsExporterCmd describes the install-windows-exporter command
+	installWindowsExporterCmd = &cobra.Command{
+		Use:   "install-windows-exporter",
+		Short: "Installs the windows_exporter Prometheus exporter on the Windows node",
+		Long: "Copies the given windows_exporter executable to the install directory, installs the " +
+			windowsexporter.ServiceName + " Windows service running it with a curated set of collectors and opens " +
+			"its metrics port in the Windows Firewall, so that the node can be scraped by Prometheus.",
+		Run: runInstallWindowsExporterCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("exporter-binary")
+		},
+	}
+
+	// installWindowsExporterOpts holds the install-windows-exporter CLI options
+	installWindowsExporterOpts struct {
+		// installDir is the main installation directory, holding the executable and the journal
+		installDir string
+		// exporterBinary is the location of the windows_exporter executable to install
+		exporterBinary string
+		// port is the port the metrics are served on
+		port int
+		// collectors are the windows_exporter collectors enabled
+		collectors []string
+		// remoteAddress is the remote address allowed to the metrics port by the firewall rule
+		remoteAddress string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(installWindowsExporterCmd)
+	installWindowsExporterCmd.PersistentFlags().StringVar(&installWindowsExporterOpts.installDir, "install-dir",
+		"c:\\k", "Installation directory. Defaults to C:\\k")
+	installWindowsExporterCmd.PersistentFlags().StringVar(&installWindowsExporterOpts.exporterBinary,
+		"exporter-binary", "", "The location of the windows_exporter executable to install")
+	installWindowsExporterCmd.PersistentFlags().IntVar(&installWindowsExporterOpts.port, "port",
+		windowsexporter.DefaultPort, "The port the metrics are served on")
+	installWindowsExporterCmd.PersistentFlags().StringSliceVar(&installWindowsExporterOpts.collectors, "collectors",
+		windowsexporter.DefaultCollectors, "The windows_exporter collectors enabled")
+	installWindowsExporterCmd.PersistentFlags().StringVar(&installWindowsExporterOpts.remoteAddress,
+		"remote-address", "Any", "The remote addresses allowed to the metrics port, e.g. the machine network CIDR")
+}
+
+// runInstallWindowsExporterCmd installs the windows_exporter service and opens its port in the Windows Firewall
+func runInstallWindowsExporterCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	j := bootstrapper.NewJournal(installWindowsExporterOpts.installDir, cmd.Name())
+	exePath, serviceArgs, err := windowsexporter.Install(installWindowsExporterOpts.exporterBinary,
+		installWindowsExporterOpts.installDir, installWindowsExporterOpts.port, installWindowsExporterOpts.collectors)
+	if err != nil {
+		log.Error(err, "could not install windows_exporter")
+		os.Exit(1)
+	}
+	if err = j.Record(journal.Created, journal.File, exePath, "windows_exporter executable"); err != nil {
+		log.Error(err, "could not record windows_exporter executable")
+		os.Exit(1)
+	}
+	if err = j.Record(journal.Created, journal.Service, windowsexporter.ServiceName,
+		exePath+" "+strings.Join(serviceArgs, " ")); err != nil {
+		log.Error(err, "could not record windows_exporter service")
+		os.Exit(1)
+	}
+
+	if err = windowsexporter.OpenFirewall(installWindowsExporterOpts.port,
+		installWindowsExporterOpts.remoteAddress); err != nil {
+		log.Error(err, "could not open windows_exporter port")
+		os.Exit(1)
+	}
+	rule := "TCP " + strconv.Itoa(installWindowsExporterOpts.port) + " from " + installWindowsExporterOpts.remoteAddress
+	if err = j.Record(journal.Created, journal.FirewallRule, windowsexporter.FirewallRuleName, rule); err != nil {
+		log.Error(err, "could not record windows_exporter firewall rule")
+		os.Exit(1)
+	}
+	log.Info("windows_exporter installed successfully", "service", windowsexporter.ServiceName,
+		"port", installWindowsExporterOpts.port, "collectors", installWindowsExporterOpts.collectors)
+}
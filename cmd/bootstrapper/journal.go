@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/firewall"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// journalCmd describes the journal command
+	journalCmd = &cobra.Command{
+		Use:   "journal",
+		Short: "Prints the changes WMCB made to the Windows node",
+		Long: "Prints the journal of the files and directories written, services created, registry keys set and " +
+			"host settings modified by WMCB on the Windows node. With --footprint only the objects that are still " +
+			"present on the node are printed, which are the ones reverted by uninstall. With --audit-firewall the " +
+			"firewall rules recorded are audited against the difference between the rules of the node and the " +
+			"snapshot written by firewall --save before the bootstrap, the command failing on any discrepancy.",
+		Run: runJournalCmd,
+	}
+
+	// journalOpts holds the journal CLI options
+	journalOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// footprint indicates that only the objects still present on the node should be printed
+		footprint bool
+		// json indicates that the entries should be printed as JSON lines
+		json bool
+		// auditFirewall is the file of the firewall snapshot to audit the recorded firewall rules against
+		auditFirewall string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(journalCmd)
+	journalCmd.PersistentFlags().StringVar(&journalOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	journalCmd.PersistentFlags().BoolVar(&journalOpts.footprint, "footprint", false,
+		"Only print the objects that are still present on the node")
+	journalCmd.PersistentFlags().BoolVar(&journalOpts.json, "json", false, "Print the entries as JSON lines")
+	journalCmd.PersistentFlags().StringVar(&journalOpts.auditFirewall, "audit-firewall", "",
+		"File of the firewall snapshot taken before the bootstrap to audit the recorded firewall rules against")
+}
+
+// runJournalCmd prints the journal of the node
+func runJournalCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	entries, err := journal.Read(bootstrapper.NewJournal(journalOpts.installDir, cmd.Name()).Path())
+	if err != nil {
+		log.Error(err, "could not read journal")
+		os.Exit(1)
+	}
+	if journalOpts.auditFirewall != "" {
+		auditFirewall(entries)
+		return
+	}
+	if journalOpts.footprint {
+		entries = journal.Footprint(entries)
+	}
+	for _, entry := range entries {
+		if !journalOpts.json {
+			fmt.Println(entry.String())
+			continue
+		}
+		out, err := json.Marshal(entry)
+		if err != nil {
+			log.Error(err, "could not marshal journal entry")
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	}
+}
+
+// auditFirewall prints the discrepancies between the firewall rules recorded in the given entries and the changes of
+// the rules of the node since the snapshot, exiting with a non zero code if there are any
+func auditFirewall(entries []journal.Entry) {
+	before, err := firewall.Read(journalOpts.auditFirewall)
+	if err != nil {
+		log.Error(err, "could not read firewall snapshot")
+		os.Exit(1)
+	}
+	after, err := firewall.Take()
+	if err != nil {
+		log.Error(err, "could not take firewall snapshot")
+		os.Exit(1)
+	}
+	discrepancies := firewall.Audit(before, after, entries)
+	for _, discrepancy := range discrepancies {
+		fmt.Println(discrepancy)
+	}
+	if len(discrepancies) > 0 {
+		log.Error(fmt.Errorf("%d discrepancies", len(discrepancies)), "journal does not match the firewall")
+		os.Exit(1)
+	}
+	log.Info("journal matches the firewall")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/imagebundle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// loadImagesCmd describes the load-images command
+	loadImagesCmd = &cobra.Command{
+		Use:   "load-images",
+		Short: "Loads container images from a local bundle on the Windows node",
+		Long: "Loads the pre-exported container images of a bundle copied to the node into its container runtime, " +
+			"so that they do not need to be pulled from a registry, e.g. on disconnected nodes. The bundle is a " +
+			"directory of .tar image archives or a single archive, created with docker save or ctr images export. " +
+			"The archives whose images are all present already are skipped.",
+		Run: runLoadImagesCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("bundle")
+		},
+	}
+
+	// loadImagesOpts holds the load-images CLI options
+	loadImagesOpts struct {
+		// bundle is the location of the image bundle
+		bundle string
+		// runtime is the container runtime the images are loaded into
+		runtime string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(loadImagesCmd)
+	loadImagesCmd.PersistentFlags().StringVar(&loadImagesOpts.bundle, "bundle", "",
+		"The location of the image bundle, a directory of .tar image archives or a single archive")
+	loadImagesCmd.PersistentFlags().StringVar(&loadImagesOpts.runtime, "runtime", string(containerruntime.Auto),
+		"The container runtime the images are loaded into: docker, containerd or auto to detect it")
+}
+
+// runLoadImagesCmd loads the images of the bundle into the container runtime of the Windows node
+func runLoadImagesCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	runtime, err := containerruntime.Parse(loadImagesOpts.runtime)
+	if err != nil {
+		log.Error(err, "invalid container runtime")
+		os.Exit(1)
+	}
+	results, err := imagebundle.Load(runtime, loadImagesOpts.bundle)
+	for _, result := range results {
+		log.Info("image archive processed", "archive", result.Archive, "images", result.Images,
+			"skipped", result.Skipped)
+	}
+	if err != nil {
+		log.Error(err, "could not load images")
+		os.Exit(1)
+	}
+	// The images are not recorded in the journal, they are kept by uninstall like the pulled ones
+	log.Info("images loaded successfully", "archives", len(results))
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"flag"
+	"os"
+	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/hooks"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
 	logger "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -18,17 +24,85 @@ var (
 		Short: "Run Windows machine config bootstrapper",
 		Long: "Runs the Machine Config Bootstrapper which is responsible for bootstrapping the windows to ensure that" +
 			"the node can join existing OpenShift cluster",
+		PersistentPreRun: setupTracing,
 	}
 	log = logger.Log.WithName("wmcb")
+
+	// rootOpts holds the values of the flags common to all the commands
+	rootOpts struct {
+		// otlpEndpoint is the OTLP/HTTP endpoint the spans are exported to
+		otlpEndpoint string
+		// traceFile is the file the spans are appended to as JSON
+		traceFile string
+		// hooksDir is the directory holding the hook scripts of each point of the bootstrap
+		hooksDir string
+		// hookLogDir is the directory the output of the hook scripts is written to
+		hookLogDir string
+		// hookTimeout is the time each hook script is given to complete
+		hookTimeout time.Duration
+		// allowUnsignedHooks runs the hook scripts without checking their signature
+		allowUnsignedHooks bool
+		// runContext is the context of the test run WMCB is invoked by, attached to the log lines and spans
+		runContext string
+	}
+	// rootSpan is the span of the command being run, it is started by setupTracing
+	rootSpan trace.Span
+	// shutdownTracing flushes the spans, it is set by setupTracing
+	shutdownTracing = func() error { return nil }
 )
 
 func init() {
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	rootCmd.PersistentFlags().StringVar(&rootOpts.otlpEndpoint, "otlp-endpoint", os.Getenv(tracing.EndpointEnvVar),
+		"OTLP/HTTP endpoint the spans of the command are exported to, e.g. http://localhost:4318. Defaults to the "+
+			tracing.EndpointEnvVar+" environment variable")
+	rootCmd.PersistentFlags().StringVar(&rootOpts.traceFile, "trace-file", "c:\\k\\log\\"+tracing.FileName,
+		"File the spans of the command are appended to as JSON. Empty to disable")
+	rootCmd.PersistentFlags().StringVar(&rootOpts.hooksDir, "hooks-dir", "c:\\k\\hooks",
+		"Directory holding the PowerShell hook scripts run at the points of the bootstrap, in a directory per point: "+
+			string(hooks.PreDownload)+", "+string(hooks.PostKubeletInstall)+" and "+string(hooks.PostJoin))
+	rootCmd.PersistentFlags().StringVar(&rootOpts.hookLogDir, "hook-log-dir", "c:\\k\\log",
+		"Directory the output of the hook scripts is written to")
+	rootCmd.PersistentFlags().DurationVar(&rootOpts.hookTimeout, "hook-timeout", hooks.DefaultTimeout,
+		"Time each hook script is given to complete")
+	rootCmd.PersistentFlags().BoolVar(&rootOpts.allowUnsignedHooks, "allow-unsigned-hooks", false,
+		"Run the hook scripts without checking that they are signed by a trusted publisher. Only meant to "+
+			"develop hooks")
+	rootCmd.PersistentFlags().StringVar(&rootOpts.runContext, "run-context", os.Getenv(runcontext.EnvVar),
+		"Context of the test run WMCB is invoked by, as run=<ID>,cluster=<ID>,build=<build>,provider=<name>, attached "+
+			"to every log line and span. Defaults to the "+runcontext.EnvVar+" environment variable")
 	logger.SetLogger(zap.New())
 }
 
+// setupTracing attaches the run context to the log lines, sets up the export of the spans and starts the span of the
+// command being run. Failing to set up tracing does not prevent the command from running.
+func setupTracing(cmd *cobra.Command, args []string) {
+	runContext, err := runcontext.Parse(rootOpts.runContext)
+	if err != nil {
+		log.Error(err, "ignoring the run context")
+	}
+	if !runContext.Empty() {
+		log = log.WithValues(runContext.KeyValues()...)
+	}
+	shutdown, err := tracing.Setup(componentName, rootOpts.otlpEndpoint, rootOpts.traceFile,
+		runContext.Attributes()...)
+	if err != nil {
+		log.Error(err, "unable to set up tracing")
+		return
+	}
+	shutdownTracing = shutdown
+	rootSpan = tracing.StartRoot(cmd.CommandPath())
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if rootSpan != nil {
+		tracing.End(rootSpan, err)
+	}
+	if shutdownErr := shutdownTracing(); shutdownErr != nil {
+		log.Error(shutdownErr, "unable to flush spans")
+	}
+	if err != nil {
 		log.Error(err, "wmcb execution failed")
 	}
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/monitor"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+)
+
+var (
+	// monitorCmd describes the monitor command
+	monitorCmd = &cobra.Command{
+		Use:   "monitor",
+		Short: "Monitors the health of the Windows node",
+		Long: "Monitors the health of the kubelet and kube-proxy services, the HNS networks and the disk space of " +
+			"the Windows node and reports them as node annotations and events. " +
+			"With --install the monitor is installed as a Windows service instead of being run in the foreground.",
+		Run: runMonitorCmd,
+	}
+
+	// monitorOpts holds the monitor CLI options
+	monitorOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// nodeName is the name of the node object to report against
+		nodeName string
+		// interval is the time between two health checks
+		interval time.Duration
+		// hnsNetworks are the HNS networks expected to be present on the node
+		hnsNetworks []string
+		// minFreeDiskPercent is the percentage of free disk space below which disk pressure is reported
+		minFreeDiskPercent int
+		// install indicates that the monitor should be installed as a Windows service
+		install bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	monitorCmd.PersistentFlags().StringVar(&monitorOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	monitorCmd.PersistentFlags().StringVar(&monitorOpts.nodeName, "node-name", "",
+		"The name of the node to report against. Defaults to the lower cased hostname, as used by the kubelet")
+	monitorCmd.PersistentFlags().DurationVar(&monitorOpts.interval, "interval", time.Minute,
+		"The interval between health checks")
+	monitorCmd.PersistentFlags().StringSliceVar(&monitorOpts.hnsNetworks, "hns-networks", monitor.DefaultHNSNetworks,
+		"The HNS networks expected to be present on the node")
+	monitorCmd.PersistentFlags().IntVar(&monitorOpts.minFreeDiskPercent, "min-free-disk-percent", 10,
+		"The percentage of free disk space below which disk pressure is reported")
+	monitorCmd.PersistentFlags().BoolVar(&monitorOpts.install, "install", false,
+		"Install the monitor as a Windows service")
+}
+
+// runMonitorCmd runs or installs the node health monitor
+func runMonitorCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	if monitorOpts.nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Error(err, "could not get hostname")
+			os.Exit(1)
+		}
+		monitorOpts.nodeName = strings.ToLower(hostname)
+	}
+
+	if monitorOpts.install {
+		if err := installMonitor(); err != nil {
+			log.Error(err, "could not install monitor")
+			os.Exit(1)
+		}
+		log.Info("monitor installed successfully", "service", monitor.ServiceName)
+		return
+	}
+
+	m, err := monitor.NewMonitor(filepath.Join(monitorOpts.installDir, "kubeconfig"), monitorOpts.nodeName,
+		monitorOpts.installDir, monitorOpts.hnsNetworks, monitorOpts.minFreeDiskPercent)
+	if err != nil {
+		log.Error(err, "could not create monitor")
+		os.Exit(1)
+	}
+	defer m.Close()
+
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		log.Error(err, "could not determine if running as a Windows service")
+		os.Exit(1)
+	}
+	if interactive {
+		m.Run(monitorOpts.interval, make(chan struct{}), logf)
+		return
+	}
+	if err = svc.Run(monitor.ServiceName, &monitorService{monitor: m}); err != nil {
+		log.Error(err, "monitor service failed")
+		os.Exit(1)
+	}
+}
+
+// installMonitor installs the monitor as a Windows service running this executable with the current options
+func installMonitor() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not get executable path: %v", err)
+	}
+	args := []string{"monitor",
+		"--install-dir=" + monitorOpts.installDir,
+		"--node-name=" + monitorOpts.nodeName,
+		"--interval=" + monitorOpts.interval.String(),
+		"--hns-networks=" + strings.Join(monitorOpts.hnsNetworks, ","),
+		"--min-free-disk-percent=" + strconv.Itoa(monitorOpts.minFreeDiskPercent)}
+	if err = monitor.InstallService(exePath, args...); err != nil {
+		return err
+	}
+	return bootstrapper.NewJournal(monitorOpts.installDir, "monitor").Record(journal.Created,
+		journal.Service, monitor.ServiceName, exePath+" "+strings.Join(args, " "))
+}
+
+// logf logs the formatted message through the wmcb logger
+func logf(format string, args ...interface{}) {
+	log.Info(fmt.Sprintf(format, args...))
+}
+
+// monitorService runs the monitor under the Windows service control manager
+type monitorService struct {
+	monitor *monitor.Monitor
+}
+
+// Execute implements svc.Handler, running the monitor until the service is stopped
+func (s *monitorService) Execute(_ []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.monitor.Run(monitorOpts.interval, stop, logf)
+		close(done)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			close(stop)
+			<-done
+			return false, 0
+		}
+	}
+	return false, 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// probeEndpointsCmd describes the probe-endpoints command
+	probeEndpointsCmd = &cobra.Command{
+		Use:   "probe-endpoints",
+		Short: "Probes the cluster services the Windows node needs to reach",
+		Long: "Probes from the Windows node the reachability of the API server, the ignition server, the image " +
+			"registries and the resolution of the given host names, and prints the result of each endpoint as JSON, " +
+			"including the stage at which it failed: dns, connect, tls or http. The API server is read from the " +
+			"ignition file unless --api-server is given. Exits with a non zero code if an endpoint is unreachable.",
+		Run: runProbeEndpointsCmd,
+	}
+
+	// probeEndpointsOpts holds the probe-endpoints CLI options
+	probeEndpointsOpts struct {
+		// ignitionFile is the location of the worker ignition file the API server is read from
+		ignitionFile string
+		// apiServer is the URL of the API server
+		apiServer string
+		// ignitionServer is the URL of the ignition server
+		ignitionServer string
+		// registries are the image registries the node pulls from
+		registries []string
+		// dnsNames are the host names the node needs to resolve
+		dnsNames []string
+		// timeout is the time given to each endpoint to answer
+		timeout time.Duration
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(probeEndpointsCmd)
+	probeEndpointsCmd.PersistentFlags().StringVar(&probeEndpointsOpts.ignitionFile, "ignition-file", "",
+		"Ignition file location the API server is read from")
+	probeEndpointsCmd.PersistentFlags().StringVar(&probeEndpointsOpts.apiServer, "api-server", "",
+		"API server URL, e.g. https://api-int.<cluster_address>:6443. Overrides the ignition file")
+	probeEndpointsCmd.PersistentFlags().StringVar(&probeEndpointsOpts.ignitionServer, "ignition-server", "",
+		"Ignition server URL. Defaults to the machine config server on the API server host")
+	probeEndpointsCmd.PersistentFlags().StringSliceVar(&probeEndpointsOpts.registries, "registry",
+		[]string{"quay.io", "mcr.microsoft.com"}, "Image registries to probe")
+	probeEndpointsCmd.PersistentFlags().StringSliceVar(&probeEndpointsOpts.dnsNames, "dns-name", nil,
+		"Host names to resolve")
+	probeEndpointsCmd.PersistentFlags().DurationVar(&probeEndpointsOpts.timeout, "timeout", probe.DefaultTimeout,
+		"Time given to each endpoint to answer")
+}
+
+// runProbeEndpointsCmd probes the endpoints, prints the results as JSON on stdout and exits with a non zero code if an
+// endpoint is unreachable
+func runProbeEndpointsCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	apiServer := probeEndpointsOpts.apiServer
+	if apiServer == "" {
+		if probeEndpointsOpts.ignitionFile == "" {
+			log.Error(fmt.Errorf("--api-server or --ignition-file is required"), "invalid options")
+			os.Exit(1)
+		}
+		contents, err := ioutil.ReadFile(probeEndpointsOpts.ignitionFile)
+		if err != nil {
+			log.Error(err, "could not read ignition file")
+			os.Exit(1)
+		}
+		if apiServer, err = probe.APIServerFromIgnition(contents); err != nil {
+			log.Error(err, "could not find the API server")
+			os.Exit(1)
+		}
+	}
+	endpoints, err := probe.ClusterEndpoints(apiServer, probeEndpointsOpts.ignitionServer,
+		probeEndpointsOpts.registries, probeEndpointsOpts.dnsNames)
+	if err != nil {
+		log.Error(err, "invalid endpoints")
+		os.Exit(1)
+	}
+
+	results := probe.NewProber(probeEndpointsOpts.timeout).Probe(endpoints)
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		log.Error(err, "could not marshal probe results")
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+	unreachable := 0
+	for _, result := range results {
+		if !result.Reachable {
+			unreachable++
+			log.Info("endpoint unreachable", "name", result.Name, "address", result.Address,
+				"stage", result.FailedStage, "error", result.Error)
+		}
+	}
+	if unreachable > 0 {
+		log.Error(fmt.Errorf("%d of %d endpoints unreachable", unreachable, len(results)), "probe failed")
+		os.Exit(1)
+	}
+	log.Info("all endpoints reachable")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/logrotate"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+)
+
+var (
+	// rotateLogsCmd describes the rotate-logs command
+	rotateLogsCmd = &cobra.Command{
+		Use:   "rotate-logs",
+		Short: "Rotates the logs of the Windows node",
+		Long: "Rotates the logs of the log rotation configuration written by configure-log-rotation larger than " +
+			"the maximum size and removes the old backups, at the configured interval. " +
+			"With --once the logs are rotated a single time instead.",
+		Run: runRotateLogsCmd,
+	}
+
+	// rotateLogsOpts holds the rotate-logs CLI options
+	rotateLogsOpts struct {
+		// configPath is the location of the log rotation configuration
+		configPath string
+		// once indicates that the logs should be rotated a single time
+		once bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(rotateLogsCmd)
+	rotateLogsCmd.PersistentFlags().StringVar(&rotateLogsOpts.configPath, "config",
+		filepath.Join("c:\\k", logrotate.ConfigFileName), "The location of the log rotation configuration")
+	rotateLogsCmd.PersistentFlags().BoolVar(&rotateLogsOpts.once, "once", false,
+		"Rotate the logs a single time instead of at the configured interval")
+}
+
+// runRotateLogsCmd rotates the logs once or periodically, in the foreground or as a Windows service
+func runRotateLogsCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	config, err := logrotate.ReadConfig(rotateLogsOpts.configPath)
+	if err != nil {
+		log.Error(err, "could not read log rotation configuration")
+		os.Exit(1)
+	}
+	if rotateLogsOpts.once {
+		if err = rotateLogs(config); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		log.Error(err, "could not determine if running as a Windows service")
+		os.Exit(1)
+	}
+	if interactive {
+		runLogRotation(config, make(chan struct{}))
+		return
+	}
+	if err = svc.Run(logrotate.ServiceName, &logRotationService{config: config}); err != nil {
+		log.Error(err, "log rotation service failed")
+		os.Exit(1)
+	}
+}
+
+// rotateLogs rotates the logs of the given configuration once, logging the changes and the error
+func rotateLogs(config *logrotate.Config) error {
+	result, err := logrotate.Rotate(config, time.Now())
+	for _, backup := range result.Rotated {
+		log.Info("log rotated", "backup", backup)
+	}
+	for _, backup := range result.Removed {
+		log.Info("backup removed", "backup", backup)
+	}
+	if err != nil {
+		log.Error(err, "log rotation failed")
+	}
+	return err
+}
+
+// runLogRotation rotates the logs of the given configuration at its interval until stop is closed. Failed rotations
+// are retried at the next interval.
+func runLogRotation(config *logrotate.Config, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(config.Interval))
+	defer ticker.Stop()
+	for {
+		rotateLogs(config)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logRotationService runs the log rotation under the Windows service control manager
+type logRotationService struct {
+	config *logrotate.Config
+}
+
+// Execute implements svc.Handler, rotating the logs until the service is stopped
+func (s *logRotationService) Execute(_ []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runLogRotation(s.config, stop)
+		close(done)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			close(stop)
+			<-done
+			return false, 0
+		}
+	}
+	return false, 0
+}
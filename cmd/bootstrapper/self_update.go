@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/agent"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/monitor"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// selfUpdateCmd describes the self-update command
+	selfUpdateCmd = &cobra.Command{
+		Use:   "self-update",
+		Short: "Replaces the WMCB binary of the node with a verified one",
+		Long: "Fetches a WMCB binary from a payload source, verifies its SHA256 and that it reports its version, and " +
+			"swaps it with the running binary, which is kept as wmcb.exe.old. The monitor and agent services, if " +
+			"installed, are restarted to run the new binary, and the previous binary is restored if one fails to restart.",
+		Run: runSelfUpdateCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			err := cmd.MarkPersistentFlagRequired("source")
+			if err != nil {
+				return err
+			}
+			return cmd.MarkPersistentFlagRequired("sha256")
+		},
+	}
+
+	// selfUpdateOpts holds the self-update CLI options
+	selfUpdateOpts struct {
+		// source is the spec of the payload source of the new binary
+		source string
+		// artifact is the name of the new binary in the payload source
+		artifact string
+		// sha256 is the expected SHA256 of the new binary
+		sha256 string
+		// pullSecret is the location of the pull secret used to pull the release images
+		pullSecret string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.PersistentFlags().StringVar(&selfUpdateOpts.source, "source", "",
+		"The payload source of the new binary, in the format of the fetch-payload --source option")
+	selfUpdateCmd.PersistentFlags().StringVar(&selfUpdateOpts.artifact, "artifact", "wmcb.exe",
+		"The name of the new binary in the payload source")
+	selfUpdateCmd.PersistentFlags().StringVar(&selfUpdateOpts.sha256, "sha256", "",
+		"The expected SHA256 of the new binary")
+	selfUpdateCmd.PersistentFlags().StringVar(&selfUpdateOpts.pullSecret, "pull-secret", "",
+		"The location of the pull secret used to pull the images of a release image source")
+}
+
+// runSelfUpdateCmd replaces the running WMCB binary with the one of the payload source
+func runSelfUpdateCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	if err := selfUpdate(); err != nil {
+		log.Error(err, "self-update failed")
+		os.Exit(1)
+	}
+}
+
+// selfUpdate fetches the new binary into a temporary directory, which is removed on return, swaps it with the running
+// binary and restarts the services, rolling back to the previous binary if they fail to restart
+func selfUpdate() error {
+	source, err := payload.ParseSource(selfUpdateOpts.source)
+	if err != nil {
+		return fmt.Errorf("invalid payload source: %v", err)
+	}
+	if release, ok := source.(*payload.ReleaseImage); ok {
+		release.PullSecret = selfUpdateOpts.pullSecret
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not locate the running binary: %v", err)
+	}
+	downloadDir, err := ioutil.TempDir("", "wmcb-update")
+	if err != nil {
+		return fmt.Errorf("could not create download directory: %v", err)
+	}
+	defer os.RemoveAll(downloadDir)
+	if err = payload.FetchAll(source, []string{selfUpdateOpts.artifact}, downloadDir); err != nil {
+		return fmt.Errorf("could not fetch the new binary: %v", err)
+	}
+
+	info, err := version.Update(executable, filepath.Join(downloadDir, filepath.Base(selfUpdateOpts.artifact)),
+		selfUpdateOpts.sha256)
+	if err != nil {
+		return fmt.Errorf("could not update the binary: %v", err)
+	}
+	if err = restartServices(); err != nil {
+		log.Error(err, "services failed to restart with the new binary, rolling back")
+		if rollbackErr := version.Rollback(executable); rollbackErr != nil {
+			log.Error(rollbackErr, "could not roll back the binary")
+		} else if restartErr := restartServices(); restartErr != nil {
+			log.Error(restartErr, "could not restart the services with the previous binary")
+		}
+		return fmt.Errorf("services failed to restart with the new binary: %v", err)
+	}
+	log.Info("binary updated successfully", "previous", version.Version, "version", info.Version,
+		"commit", info.Commit)
+	return nil
+}
+
+// restartServices restarts the installed services running the WMCB binary, the monitor and the agent
+func restartServices() error {
+	for _, service := range []struct {
+		name    string
+		restart func() (bool, error)
+	}{
+		{monitor.ServiceName, monitor.RestartService},
+		{agent.ServiceName, agent.RestartService},
+	} {
+		restarted, err := service.restart()
+		if err != nil {
+			return err
+		}
+		if restarted {
+			log.Info("service restarted", "service", service.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/nodereset"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// uninstallCmd describes the uninstall command
+	uninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "Uninstalls the node components from the Windows node",
+		Long: "Stops and removes the kubelet and monitor services and removes the node credentials and the files " +
+			"installed by WMCB, so that the node can be bootstrapped again. The node object needs to be deleted " +
+			"from the cluster separately. With --reset-node, the containers, images and HNS endpoints left by the " +
+			"workloads are removed as well, so that the node can be reused without their stale state.",
+		Run: runUninstallCmd,
+	}
+
+	// uninstallOpts holds the uninstall CLI options
+	uninstallOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// resetNode removes the containers, images and HNS endpoints of the node
+		resetNode bool
+		// keepImages keeps the images of the container runtime when resetting the node
+		keepImages bool
+		// containerRuntime is the container runtime whose containers and images are removed
+		containerRuntime string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+	uninstallCmd.PersistentFlags().StringVar(&uninstallOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	uninstallCmd.PersistentFlags().BoolVar(&uninstallOpts.resetNode, "reset-node", false,
+		"Also remove the containers, images and HNS endpoints left by the workloads of the node")
+	uninstallCmd.PersistentFlags().BoolVar(&uninstallOpts.keepImages, "keep-images", false,
+		"Keep the images of the container runtime when resetting the node, e.g. to spare pulling them again")
+	uninstallCmd.PersistentFlags().StringVar(&uninstallOpts.containerRuntime, "container-runtime",
+		string(containerruntime.Auto), "The container runtime whose containers and images are removed when "+
+			"resetting the node: auto, docker or containerd. Defaults to the runtime installed on the node")
+}
+
+// runUninstallCmd uninstalls the node components
+func runUninstallCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	runtime, err := containerruntime.Parse(uninstallOpts.containerRuntime)
+	if err != nil {
+		log.Error(err, "invalid container runtime")
+		os.Exit(1)
+	}
+
+	wmcb, err := bootstrapper.NewWinNodeBootstrapper(uninstallOpts.installDir, "", "", "", "")
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+
+	err = wmcb.Uninstall()
+	if err != nil {
+		log.Error(err, "could not uninstall")
+		os.Exit(1)
+	}
+	log.Info("uninstall completed successfully")
+
+	if uninstallOpts.resetNode {
+		report, err := nodereset.Reset(runtime, uninstallOpts.keepImages)
+		if err != nil {
+			log.Error(err, "could not reset the node")
+			os.Exit(1)
+		}
+		log.Info("node reset completed successfully", "report", report.String())
+	}
+
+	err = wmcb.Disconnect()
+	if err != nil {
+		log.Error(err, "can't clean up bootstrapper")
+	}
+}
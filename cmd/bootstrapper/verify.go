@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// verifyCmd describes the verify command
+	verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Verifies the files installed on the Windows node",
+		Long: "Verifies that the binaries and configuration files installed by initialize-kubelet and the configure " +
+			"commands have not drifted from the recorded versions, for example by a manually replaced kubelet. " +
+			"With --restore the drifted files are restored from the recorded payload and the kubelet is restarted.",
+		Run: runVerifyCmd,
+	}
+
+	// verifyOpts holds the verify CLI options
+	verifyOpts struct {
+		// installDir is the main installation directory
+		installDir string
+		// restore indicates that drifted files should be restored
+		restore bool
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.PersistentFlags().StringVar(&verifyOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+	verifyCmd.PersistentFlags().BoolVar(&verifyOpts.restore, "restore", false,
+		"Restore the drifted files from the recorded payload")
+}
+
+// runVerifyCmd verifies the installed files and exits with a non zero code on unrestored drift
+func runVerifyCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	wmcb, err := bootstrapper.NewWinNodeBootstrapper(verifyOpts.installDir, "", "", "", "")
+	if err != nil {
+		log.Error(err, "could not create bootstrapper")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := wmcb.Disconnect(); err != nil {
+			log.Error(err, "can't clean up bootstrapper")
+		}
+	}()
+
+	drifts, err := wmcb.Verify(verifyOpts.restore)
+	for _, drift := range drifts {
+		log.Info("drift detected", "file", drift.File.Path, "details", drift.String(), "restored", drift.Restored)
+	}
+	if err != nil {
+		log.Error(err, "could not verify installed files")
+		os.Exit(1)
+	}
+	if len(drifts) > 0 && !verifyOpts.restore {
+		log.Error(fmt.Errorf("%d files drifted", len(drifts)), "verification failed")
+		os.Exit(1)
+	}
+	log.Info("verification completed successfully")
+}
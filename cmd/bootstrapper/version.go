@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// versionCmd describes the version command
+	versionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "Prints the version of WMCB and of the payload it installed",
+		Long: "Prints the version, git commit and build date of WMCB as JSON, along with the SHA256 and version of the " +
+			"files it installed on the node, as recorded by initialize-kubelet and the configure commands.",
+		Run: runVersionCmd,
+	}
+
+	// versionOpts holds the version CLI options
+	versionOpts struct {
+		// installDir is the main installation directory
+		installDir string
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.PersistentFlags().StringVar(&versionOpts.installDir, "install-dir", "c:\\k",
+		"Installation directory. Defaults to C:\\k")
+}
+
+// runVersionCmd prints the version info as JSON on stdout, so that it can be parsed by scripts and by self-update
+func runVersionCmd(cmd *cobra.Command, args []string) {
+	flag.Parse()
+
+	info := version.Get()
+	// The payload is best effort, the version of WMCB is reported even on a node it did not bootstrap
+	files, err := bootstrapper.InstalledFiles(versionOpts.installDir)
+	if err != nil {
+		log.Error(err, "could not read the installed files")
+	}
+	for _, file := range files {
+		info.Payload = append(info.Payload, version.PayloadFile{Path: file.Path, SHA256: file.SHA256,
+			Version: file.Version})
+	}
+	out, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		log.Error(err, "could not marshal version info")
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
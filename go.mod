@@ -6,6 +6,10 @@ go 1.12
 // Use 'replace' to point to the sub-go.mod directory for building a binary in the root directory and always build by
 // package instead of file.
 replace (
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/payload => ./pkg/payload
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll => ./pkg/poll
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext => ./pkg/runcontext
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing => ./pkg/tracing
 	k8s.io/api => k8s.io/api v0.0.0-20190313235455-40a48860b5ab // kubernetes-1.14.0
 	k8s.io/apimachinery => k8s.io/apimachinery v0.0.0-20190313205120-d7deff9243b1 // kubernetes-1.14.0
 )
@@ -15,17 +19,27 @@ require (
 	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e // indirect
 	github.com/coreos/ignition v0.33.0
 	github.com/go-logr/zapr v0.1.0
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/payload v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing v0.0.0-20261017032934-936b0ff8372a
 	github.com/gogo/protobuf v1.2.1 // indirect
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.3
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.7.0
 	github.com/vincent-petithory/dataurl v0.0.0-20160330182126-9a301d65acbb
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/zap v1.10.0
 	go4.org v0.0.0-20190919214946-0cfe6e5be80f // indirect
-	golang.org/x/net v0.0.0-20190522155817-f3200d17e092 // indirect
-	golang.org/x/sys v0.0.0-20190403152447-81d4e9dc473e
+	golang.org/x/sys v0.0.0-20210423185535-09eb48e85fd7
+	k8s.io/api v0.0.0-20190923155552-eac758366a00
 	k8s.io/apimachinery v0.0.0-20190923155427-ec87dd743e08
+	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
 	k8s.io/kubelet v0.0.0-20190923161547-13146ddde0d1
 	sigs.k8s.io/controller-runtime v0.2.1
 )
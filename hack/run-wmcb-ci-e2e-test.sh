@@ -5,8 +5,11 @@ set -o pipefail
 
 SKIP_VM_SETUP=""
 VM_CREDS=""
+SCALE_NODES=0
+IMAGES=""
+LOAD_PODS=0
 
-while getopts ":v:s" opt; do
+while getopts ":v:sn:i:l:r:" opt; do
   case ${opt} in
     v ) # process option for providing existing VM credentials
       VM_CREDS=$OPTARG
@@ -14,8 +17,20 @@ while getopts ":v:s" opt; do
     s ) # process option for skipping setup in VMs
       SKIP_VM_SETUP="-skipVMSetup"
       ;;
+    n ) # process option for bootstrapping the given number of nodes concurrently in the scale test mode
+      SCALE_NODES=$OPTARG
+      ;;
+    i ) # process option for running the tests against each of the given Windows images
+      IMAGES=$OPTARG
+      ;;
+    l ) # process option for running the given number of pods at once on each node in the load test
+      LOAD_PODS=$OPTARG
+      ;;
+    r ) # process option for bootstrapping the nodes with the given container runtime, docker or containerd
+      export E2E_CONTAINER_RUNTIME=$OPTARG
+      ;;
     \? )
-      echo "Usage: $0 [-v] [-s]"
+      echo "Usage: $0 [-v] [-s] [-n] [-i] [-l] [-r]"
       exit 0
       ;;
   esac
@@ -38,5 +53,11 @@ oc patch network.operator cluster --type=merge -p '{"spec":{"defaultNetwork":{"o
 CLUSTER_ADDR=$(oc cluster-info | head -n1 | sed 's/.*\/\/api.//g'| sed 's/:.*//g')
 
 cd "${WMCB_TEST_DIR}"
+TEST_FILES="../../../wmcb_unit_test.exe,../../../wmcb_e2e_test.exe,powershell/wget-ignore-cert.ps1"
+if [ "$SCALE_NODES" -gt 0 ]; then
+  # Provision and bootstrap the nodes concurrently and report the aggregated results
+  CGO_ENABLED=0 GO111MODULE=on CLUSTER_ADDR=$CLUSTER_ADDR go test -v -run=TestScale -filesToBeTransferred="$TEST_FILES" -vmCreds="$VM_CREDS" -images="$IMAGES" -scaleNodes="$SCALE_NODES" $SKIP_VM_SETUP -timeout=90m .
+  exit 0
+fi
 # Transfer the files and run the unit and e2e tests
-CGO_ENABLED=0 GO111MODULE=on CLUSTER_ADDR=$CLUSTER_ADDR go test -v -run=TestWMCB -filesToBeTransferred="../../../wmcb_unit_test.exe,../../../wmcb_e2e_test.exe,powershell/wget-ignore-cert.ps1" -vmCreds="$VM_CREDS" $SKIP_VM_SETUP -timeout=30m .
+CGO_ENABLED=0 GO111MODULE=on CLUSTER_ADDR=$CLUSTER_ADDR go test -v -run=TestWMCB -filesToBeTransferred="$TEST_FILES" -vmCreds="$VM_CREDS" -images="$IMAGES" -loadPods="$LOAD_PODS" $SKIP_VM_SETUP -timeout=60m .
@@ -7,7 +7,7 @@ set -o pipefail
 SKIP_VM_SETUP=""
 VM_CREDS=""
 
-while getopts ":v:s" opt; do
+while getopts ":v:sr:" opt; do
   case ${opt} in
     v ) # process option for providing existing VM credentials
       VM_CREDS=$OPTARG
@@ -15,8 +15,11 @@ while getopts ":v:s" opt; do
     s ) # process option for skipping setup in VMs
       SKIP_VM_SETUP="-skipVMSetup"
       ;;
+    r ) # process option for bootstrapping the nodes with the given container runtime, docker or containerd
+      export E2E_CONTAINER_RUNTIME=$OPTARG
+      ;;
     \? )
-      echo "Usage: $0 [-v] [-s]"
+      echo "Usage: $0 [-v] [-s] [-r]"
       exit 0
       ;;
   esac
@@ -0,0 +1,24 @@
+#!/bin/bash
+# Verifies that the changes to the exported API of the pkg/e2efw module since its latest release are compatible, so
+# that they can be released as a minor version. Incompatible changes require a new major version of the module.
+set -o errexit
+set -o nounset
+set -o pipefail
+WMCO_ROOT=$(dirname "${BASH_SOURCE}")/..
+TAG_PREFIX=pkg/e2efw/
+
+cd "${WMCO_ROOT}"
+BASE=$(git tag --list "${TAG_PREFIX}v*" --sort=-version:refname | head -n1)
+if [[ -z "${BASE}" ]]; then
+  echo "pkg/e2efw has not been released yet, skipping the API compatibility check."
+  exit 0
+fi
+BASE=${BASE#${TAG_PREFIX}}
+
+# The next minor version, e.g. v1.3.0 after v1.2.4
+IFS=. read -r MAJOR MINOR _ <<< "${BASE}"
+NEXT="${MAJOR}.$((MINOR + 1)).0"
+
+GO111MODULE=on go install golang.org/x/exp/cmd/gorelease@latest
+cd pkg/e2efw
+"$(go env GOPATH)/bin/gorelease" -base="${BASE}" -version="${NEXT}"
@@ -5,30 +5,46 @@ go 1.12
 replace (
 	github.com/openshift/api => github.com/openshift/api v0.0.0-20200205145930-e9d93e317dd1 // OpenShift 4.3
 	github.com/openshift/client-go => github.com/openshift/client-go v0.0.0-20191125132246-f6563a70e19a // OpenShift 4.3
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw => ../../pkg/e2efw
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/payload => ../../pkg/payload
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll => ../../pkg/poll
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext => ../../pkg/runcontext
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing => ../../pkg/tracing
+	github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer => ../../tools/windows-node-installer
 	k8s.io/api => k8s.io/api v0.16.7
 	k8s.io/apimachinery => k8s.io/apimachinery v0.16.7
 	k8s.io/client-go => k8s.io/client-go v0.16.7
 )
 
 require (
+	github.com/aws/aws-sdk-go v1.25.38
 	github.com/gogo/protobuf v1.3.1 // indirect
-	github.com/golang/protobuf v1.3.3 // indirect
 	github.com/google/go-github/v29 v29.0.2
 	github.com/google/gofuzz v1.1.0 // indirect
 	github.com/googleapis/gnostic v0.4.0 // indirect
 	github.com/imdario/mergo v0.3.8 // indirect
 	github.com/json-iterator/go v1.1.9 // indirect
 	github.com/masterzen/winrm v0.0.0-20190308153735-1d17eaf15943
-	github.com/openshift/client-go v0.0.0-00010101000000-000000000000
-	github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer v0.0.0-20200219203823-675f779e3e8e
-	github.com/pkg/sftp v1.10.1
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20191122220453-ac88ee75c92c
+	github.com/openshift/client-go v0.0.0-20191125132246-f6563a70e19a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/payload v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer v0.0.0-20261017032934-936b0ff8372a
+	github.com/pkg/sftp v1.11.0
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
 	k8s.io/api v0.16.7
-	k8s.io/apimachinery v0.17.3
-	k8s.io/client-go v0.0.0-00010101000000-000000000000
+	k8s.io/apimachinery v0.16.7
+	k8s.io/client-go v0.16.7
 	k8s.io/utils v0.0.0-20200124190032-861946025e34 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,27 @@
+package wmcb
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/require"
+)
+
+// testSecurityBaseline checks the bootstrapped node of the VM against the security baseline and writes the compliance
+// report to the artifact directory for the security review, failing on the checks which are neither passed nor waived
+func (vm *wmcbVM) testSecurityBaseline(t *testing.T) {
+	report, err := e2ef.CheckSecurityBaseline(vm)
+	require.NoError(t, err, "unable to check the security baseline")
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	require.NoError(t, err, "unable to marshal the security baseline report")
+	reportName := "security-baseline-" + vm.GetCredentials().GetInstanceId() + ".json"
+	if err = framework.WriteToArtifactDir(out, vm.GetImage().Version, reportName); err != nil {
+		log.Printf("unable to write %s: %v", reportName, err)
+	}
+	for _, check := range report.Failed() {
+		t.Errorf("security baseline check %s failed: %v", check.Name, check.Findings)
+	}
+}
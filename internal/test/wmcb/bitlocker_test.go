@@ -0,0 +1,90 @@
+package wmcb
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// bitLockerEnvVar is the environment variable the WMCB e2e tests read the BitLocker mode of the node from
+	bitLockerEnvVar = "WMCB_E2E_BITLOCKER"
+	// bitLockerMountPath is where the emptyDir volume, which lives in the kubelet root directory, is mounted in the
+	// pod writing to the encrypted volume
+	bitLockerMountPath = "C:\\data"
+	// bitLockerMarker is written to the emptyDir volume and read back by the pod
+	bitLockerMarker = "written-to-the-encrypted-volume"
+	// bitLockerFeature is the Windows feature providing BitLocker and its PowerShell module
+	bitLockerFeature = "BitLocker"
+)
+
+// bitLocker enables the BitLocker test, which requires the VMs to have a virtual TPM, e.g. NitroTPM on AWS
+var bitLocker = flag.Bool("bitlocker", false, "Encrypt the data volume of the Windows nodes with BitLocker and "+
+	"test the kubelet and the container runtime on it. Requires the VMs to have a virtual TPM")
+
+// testBitLocker bootstraps the node again with its data volume encrypted with BitLocker by WMCB, then asserts through
+// the WMCB e2e test that the volume is encrypted and the kubelet writes to it, and that a pod whose emptyDir volume
+// lives on it runs on the node. The node is left encrypted.
+func (vm *wmcbVM) testBitLocker(t *testing.T) {
+	if !*bitLocker {
+		t.Skip("the BitLocker test is enabled with -bitlocker")
+	}
+	_, err := e2ef.EnsureWindowsFeature(vm, bitLockerFeature)
+	require.NoError(t, err, "unable to install the BitLocker feature")
+
+	vm.bitLocker = "enable"
+	err = vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
+	require.NoError(t, err, "TestBootstrapper failed with BitLocker enabled")
+	// The CNI configuration is lost when the kubelet is initialized again
+	vm.runTestConfigureCNI(t)
+	err = vm.runTest(e2eExecutable + " --test.run TestBitLocker --test.v")
+	require.NoError(t, err, "TestBitLocker failed")
+
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	node, err = waitForNodeReady(node.GetName())
+	require.NoError(t, err, "node did not become Ready with BitLocker enabled")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+	pod, err := createEmptyDirPod(e2ef.RunScopedName("bitlocker-"+vm.GetCredentials().GetInstanceId()), image,
+		node.Name)
+	require.NoError(t, err, "unable to create the emptyDir pod")
+	defer framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Delete(pod.Name, &metav1.DeleteOptions{})
+	err = waitForPodOutput(pod.Name, bitLockerMarker, e2ef.Timeout(e2ef.TestsPhase, podAvailableTimeout))
+	assert.NoError(t, err, "pod did not write to its emptyDir volume on the encrypted volume of node %s", node.Name)
+}
+
+// createEmptyDirPod creates a pod of the given Windows image on the node with the given name, which writes a marker to
+// its emptyDir volume and prints it once read back
+func createEmptyDirPod(name, image, nodeName string) (*v1.Pod, error) {
+	pod := windowsPod(name, image, nodeName)
+	pod.Spec.Volumes = []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	pod.Spec.Containers[0].VolumeMounts = []v1.VolumeMount{{Name: "data", MountPath: bitLockerMountPath}}
+	marker := bitLockerMountPath + "\\marker.txt"
+	pod.Spec.Containers[0].Command = []string{"powershell.exe", "-command",
+		"Set-Content -Path " + marker + " -Value " + bitLockerMarker + "; Get-Content -Path " + marker +
+			"; Start-Sleep -Seconds 3600"}
+	return framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Create(pod)
+}
+
+// waitForPodOutput waits until the output of the pod with the given name has a line containing the given string
+func waitForPodOutput(name, line string, timeout time.Duration) error {
+	return e2ef.Poll(context.Background(), line+" in the output of pod "+name,
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: timeout, Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			out, err := framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).GetLogs(name,
+				&v1.PodLogOptions{}).DoRaw()
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return strings.Contains(string(out), line), "the line is not in the output", nil
+		})
+}
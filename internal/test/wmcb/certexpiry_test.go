@@ -0,0 +1,98 @@
+package wmcb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// rotationPoint is the fraction of the lifetime of the kubelet client certificate the clock of the node is skewed
+	// to. The kubelet rotates its certificate at a random point between 70% and 84% of its lifetime.
+	rotationPoint = 0.9
+	// certRotationTimeout is the time given to the kubelet to rotate its client certificate once past its rotation
+	// deadline, the CSR approval included
+	certRotationTimeout = 5 * time.Minute
+)
+
+// testCertificateExpiry skews the clock of the node close to the expiry of the kubelet client certificate, as happens
+// in long-lived clusters, and asserts that the kubelet renews its certificate through a new CSR and that the node is
+// Ready with a certificate valid for the cluster once the clock is restored
+func (vm *wmcbVM) testCertificateExpiry(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	certs, err := e2ef.Certificates(vm, kubeletClientCert)
+	require.NoError(t, err, "unable to read the kubelet client certificate")
+	oldCertHash, err := vm.kubeletClientCertHash()
+	require.NoError(t, err, "unable to get kubelet client certificate hash")
+	nodeTime, _, err := e2ef.NodeTime(vm)
+	require.NoError(t, err, "unable to read the clock of the VM")
+
+	approver := newCSRApprover()
+	stop := make(chan struct{})
+	defer close(stop)
+	go approver.run(stop)
+
+	skew := rotationSkew(certs[0], nodeTime)
+	skewed := time.Now()
+	require.NoError(t, e2ef.SkewClock(vm, skew), "unable to skew the clock")
+	restored := false
+	defer func() {
+		if !restored {
+			assert.NoError(t, e2ef.RestoreClock(vm), "unable to restore the clock")
+		}
+	}()
+	// The kubelet waits for its rotation deadline on a timer, which the skew does not shorten, so that it is restarted
+	// to compute the deadline again from the skewed clock
+	_, stderr, err := vm.Run(e2ef.PowerShellScript("Restart-Service -Name "+e2ef.PowerShellString(kubeletServiceName)),
+		true)
+	require.NoError(t, err, "unable to restart the kubelet: %s", stderr)
+
+	err = e2ef.Poll(context.Background(), "the kubelet client certificate of node "+node.Name+" to be rotated",
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, certRotationTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			hash, err := vm.kubeletClientCertHash()
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return hash != oldCertHash, "the certificate was not rotated", nil
+		})
+	assert.NoError(t, err, "kubelet did not renew its client certificate with the clock skewed by %s", skew)
+
+	require.NoError(t, e2ef.RestoreClock(vm), "unable to restore the clock")
+	restored = true
+	_, err = waitForNodeReady(node.GetName())
+	require.NoError(t, err, "node did not recover from the clock skew")
+	if t.Failed() {
+		return
+	}
+
+	certs, err = e2ef.Certificates(vm, kubeletClientCert)
+	require.NoError(t, err, "unable to read the renewed kubelet client certificate")
+	now := time.Now()
+	assert.True(t, certs[0].NotBefore.Before(now) && certs[0].NotAfter.After(now),
+		"renewed kubelet client certificate is not valid now: valid from %s to %s", certs[0].NotBefore,
+		certs[0].NotAfter)
+
+	csrs, err := framework.K8sclientset.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+	require.NoError(t, err, "unable to get CSR list")
+	renewed := false
+	for _, csr := range csrs.Items {
+		if csr.Spec.Username == nodeCSRRequestor+node.GetName() && csr.GetCreationTimestamp().After(skewed) {
+			renewed = true
+		}
+	}
+	assert.True(t, renewed, "node did not request its renewed certificate with a CSR")
+}
+
+// rotationSkew returns the skew moving the given node time to rotationPoint of the lifetime of the given certificate
+func rotationSkew(cert e2ef.CertificateInfo, nodeTime time.Time) time.Duration {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(time.Duration(float64(lifetime) * rotationPoint)).Sub(nodeTime)
+}
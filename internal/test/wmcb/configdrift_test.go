@@ -0,0 +1,36 @@
+package wmcb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"testing"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/require"
+)
+
+// configDriftDir is the artifact directory the configuration drift reports are written to
+const configDriftDir = "config-drift"
+
+// testConfigDrift compares the configuration of the first bootstrapped node with each of the others and writes the
+// drift reports to the artifact directory, so that a test failing on only some of the nodes can be traced to what
+// differs between them. The drifts are expected between nodes of different Windows versions and are not failures.
+func testConfigDrift(t *testing.T) {
+	reference := framework.WinVMs[0]
+	for _, vm := range framework.WinVMs[1:] {
+		report, err := e2ef.CompareNodeConfigs(reference, vm)
+		require.NoError(t, err, "unable to compare the configuration of the nodes")
+		log.Printf("%d configuration items differ between %s and %s", len(report.Drifts), report.A, report.B)
+
+		out, err := json.MarshalIndent(report, "", "  ")
+		require.NoError(t, err, "unable to marshal the configuration drift report")
+		name := fmt.Sprintf("%s-%s", reference.GetCredentials().GetInstanceId(), vm.GetCredentials().GetInstanceId())
+		if err = framework.WriteToArtifactDir(out, configDriftDir, name+".json"); err != nil {
+			log.Printf("unable to write the configuration drift report %s: %v", name, err)
+		}
+		if err = framework.WriteToArtifactDir([]byte(report.String()), configDriftDir, name+".txt"); err != nil {
+			log.Printf("unable to write the configuration drift report %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package wmcb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashingBinary is the executable the WMCB e2e test crashes once the crash dumps are configured
+const crashingBinary = "powershell.exe"
+
+// testCrashDumps configures the crash dumps of the node through the WMCB e2e test, which crashes a configured
+// executable, then asserts that its dump is retrieved from the node along with the other node artifacts
+func (vm *wmcbVM) testCrashDumps(t *testing.T) {
+	err := vm.runTest(e2eExecutable + " --test.run TestCrashDumps --test.v")
+	require.NoError(t, err, "TestCrashDumps failed")
+
+	dir, err := ioutil.TempDir("", "dumps")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, e2ef.RetrieveCrashDumps(vm, dir), "error retrieving the crash dumps")
+	var dumps []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if matched, _ := filepath.Match(crashingBinary+".*.dmp", info.Name()); matched {
+				dumps = append(dumps, path)
+			}
+		}
+		return err
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, dumps, "the dump of %s was not retrieved", crashingBinary)
+}
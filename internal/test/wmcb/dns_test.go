@@ -0,0 +1,193 @@
+package wmcb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dnsTargetService is the ClusterIP service of the test namespace the pods resolve
+	dnsTargetService = "dns-target"
+	// dnsExternalService is the ExternalName service of the test namespace, an alias of the external name
+	dnsExternalService = "dns-external"
+	// dnsRecordTimeout is the time given to the cluster DNS to serve the records of the services of the test
+	dnsRecordTimeout = 5 * time.Minute
+	// dnsSeparator separates the resolutions of the names in the output of a DNS probe pod
+	dnsSeparator = "----"
+)
+
+// dnsCase is a name resolved from a Windows pod
+type dnsCase struct {
+	// description tells what the resolution of the name checks
+	description string
+	// name is the name resolved
+	name string
+	// address is the IP address the name should resolve to, any address if empty
+	address string
+}
+
+// testDNS asserts that the Windows host resolves the external name and the API server, and that a Windows pod
+// resolves the cluster services by their fully qualified name and through its DNS suffix search list, the ExternalName
+// services and the external name. The DNS client configuration of the host and of a pod is written to ARTIFACT_DIR if
+// the resolution fails.
+func (vm *wmcbVM) testDNS(t *testing.T) {
+	externalName := e2ef.DNSExternalNameFromEnv()
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+
+	name := e2ef.RunScopedName("dns-" + strings.ToLower(vm.GetCredentials().GetInstanceId()))
+	namespace, err := framework.K8sclientset.CoreV1().Namespaces().Create(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: e2ef.RunLabels(nil)},
+	})
+	require.NoError(t, err, "unable to create the DNS test namespace")
+	defer framework.K8sclientset.CoreV1().Namespaces().Delete(namespace.Name, &metav1.DeleteOptions{})
+	probe := &podProbe{namespace: namespace.Name, image: image, nodeName: node.Name}
+	defer func() {
+		if t.Failed() {
+			vm.writeDNSDiagnostics(probe)
+		}
+	}()
+
+	t.Run("Host", func(t *testing.T) {
+		addresses, err := e2ef.ResolveHost(vm, externalName)
+		assert.NoError(t, err, "the Windows host does not resolve external names")
+		assert.NotEmpty(t, addresses)
+
+		apiServer, err := framework.APIServerURL()
+		require.NoError(t, err)
+		apiServerURL, err := url.Parse(apiServer)
+		require.NoError(t, err, "invalid API server URL %s", apiServer)
+		if net.ParseIP(apiServerURL.Hostname()) != nil {
+			return
+		}
+		_, err = e2ef.ResolveHost(vm, apiServerURL.Hostname())
+		assert.NoError(t, err, "the Windows host does not resolve the API server")
+	})
+
+	t.Run("Pod", func(t *testing.T) {
+		services := framework.K8sclientset.CoreV1().Services(namespace.Name)
+		target, err := services.Create(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: dnsTargetService, Labels: e2ef.RunLabels(nil)},
+			Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80}}},
+		})
+		require.NoError(t, err, "unable to create the ClusterIP service")
+		_, err = services.Create(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: dnsExternalService, Labels: e2ef.RunLabels(nil)},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: externalName},
+		})
+		require.NoError(t, err, "unable to create the ExternalName service")
+		kubernetes, err := framework.K8sclientset.CoreV1().Services(v1.NamespaceDefault).Get("kubernetes",
+			metav1.GetOptions{})
+		require.NoError(t, err, "unable to get the kubernetes service")
+
+		cases := []dnsCase{
+			{"cluster service", e2ef.ServiceFQDN("kubernetes", v1.NamespaceDefault), kubernetes.Spec.ClusterIP},
+			{"service of the pod namespace", e2ef.ServiceFQDN(dnsTargetService, namespace.Name),
+				target.Spec.ClusterIP},
+			{"short name in the pod namespace", dnsTargetService, target.Spec.ClusterIP},
+			{"short name in another namespace", "kubernetes." + v1.NamespaceDefault, kubernetes.Spec.ClusterIP},
+			{"ExternalName service", e2ef.ServiceFQDN(dnsExternalService, namespace.Name), ""},
+			{"external name", externalName, ""},
+		}
+		var failures map[dnsCase]error
+		// The records of the new services are served once the cluster DNS watched them
+		err = e2ef.Poll(context.Background(), "the names to be resolved from a Windows pod",
+			e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, dnsRecordTimeout),
+				Jitter: e2ef.DefaultPollJitter},
+			func() (bool, string, error) {
+				failures, err = probe.resolve(cases)
+				if err != nil {
+					return false, err.Error(), nil
+				}
+				return len(failures) == 0, fmt.Sprintf("%d names not resolved", len(failures)), nil
+			})
+		for _, c := range cases {
+			assert.NoError(t, failures[c], "%s %s is not resolved from a Windows pod", c.description, c.name)
+		}
+		assert.NoError(t, err)
+	})
+}
+
+// resolve resolves the names of the given cases in a single pod of the Windows node and returns the cases which
+// failed, with the reason
+func (p *podProbe) resolve(cases []dnsCase) (map[dnsCase]error, error) {
+	var scripts []string
+	for _, c := range cases {
+		scripts = append(scripts, e2ef.DNSResolveScript(c.name)+"; '"+dnsSeparator+"'")
+	}
+	out, err := p.run("dns", strings.Join(scripts, "; "))
+	if err != nil {
+		return nil, err
+	}
+	var outputs []string
+	var current strings.Builder
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == dnsSeparator {
+			outputs = append(outputs, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteString(line + "\n")
+	}
+	failures := make(map[dnsCase]error)
+	for i, c := range cases {
+		if i >= len(outputs) {
+			failures[c] = fmt.Errorf("no resolution output")
+			continue
+		}
+		addresses, err := e2ef.ParseDNSResolution(outputs[i])
+		switch {
+		case err != nil:
+			failures[c] = err
+		case c.address != "" && !containsAddress(addresses, c.address):
+			failures[c] = fmt.Errorf("resolved to %s instead of %s", strings.Join(addresses, ", "), c.address)
+		}
+	}
+	return failures, nil
+}
+
+// containsAddress returns true if the given addresses contain the given IP address
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if net.ParseIP(a).Equal(net.ParseIP(address)) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDNSDiagnostics writes the DNS client configuration of the Windows host and of a pod of the given probe to the
+// dns directory of the VM in ARTIFACT_DIR
+func (vm *wmcbVM) writeDNSDiagnostics(probe *podProbe) {
+	subDir := filepath.Join(vm.GetImage().Version, "dns", vm.GetCredentials().GetInstanceId())
+	host, err := e2ef.DNSClientConfig(vm)
+	if err != nil {
+		log.Printf("incomplete DNS client configuration of the host: %v", err)
+	}
+	if err := framework.WriteToArtifactDir([]byte(host), subDir, "host.txt"); err != nil {
+		log.Printf("unable to write the DNS client configuration of the host: %v", err)
+	}
+	pod, err := probe.run("dns-config", e2ef.DNSClientConfigScript())
+	if err != nil {
+		log.Printf("unable to get the DNS client configuration of a pod: %v", err)
+		return
+	}
+	if err := framework.WriteToArtifactDir([]byte(pod), subDir, "pod.txt"); err != nil {
+		log.Printf("unable to write the DNS client configuration of a pod: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package wmcb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// drainGracePeriod is the termination grace period of the drain test pod
+	drainGracePeriod = 60 * time.Second
+	// drainPreStopDuration is how long the preStop hook of the drain test pod delays its termination. It is shorter
+	// than the grace period, so the pod is only deleted after the hook if the kubelet terminates it gracefully.
+	drainPreStopDuration = 20 * time.Second
+	// drainTimeout is the time given to the drain of the node, which includes the graceful termination of its pods
+	drainTimeout = 5 * time.Minute
+	// podAvailableTimeout is the time given to the drain test pod to run, which includes pulling the Windows Server
+	// Core image the first time
+	podAvailableTimeout = 15 * time.Minute
+)
+
+// serverCoreTags are the tags of the Windows Server Core image matching the build of the Windows node, as containers
+// with process isolation need the same build as the host
+var serverCoreTags = map[string]string{
+	"17763": "ltsc2019",
+	"18363": "1909",
+	"19041": "2004",
+	"19042": "20H2",
+	"20348": "ltsc2022",
+}
+
+// testNodeDrain drains the node of the VM and asserts that its pod is evicted after a graceful termination and stays
+// pending while the node is cordoned, and that the replacement pod runs on the node once it is uncordoned
+func (vm *wmcbVM) testNodeDrain(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+
+	deployment, err := createDrainTestDeployment(e2ef.RunScopedName("drain-test-"+vm.GetCredentials().GetInstanceId()),
+		image, node.Name)
+	require.NoError(t, err, "unable to create the drain test deployment")
+	defer framework.K8sclientset.AppsV1().Deployments(v1.NamespaceDefault).Delete(deployment.Name,
+		&metav1.DeleteOptions{})
+	// Leave the node schedulable for the following tests, whatever the outcome of this one
+	defer framework.UncordonNode(node.Name)
+
+	pod, err := waitForDeploymentPod(deployment, "", node.Name, e2ef.Timeout(e2ef.TestsPhase, podAvailableTimeout))
+	require.NoError(t, err, "drain test pod did not run on node %s", node.Name)
+
+	start := time.Now()
+	evicted, err := framework.DrainNode(node.Name, e2ef.Timeout(e2ef.TestsPhase, drainTimeout))
+	require.NoError(t, err, "unable to drain node %s", node.Name)
+	terminationDuration := time.Since(start)
+	var evictedUIDs []k8stypes.UID
+	for _, evictedPod := range evicted {
+		evictedUIDs = append(evictedUIDs, evictedPod.UID)
+	}
+	assert.Contains(t, evictedUIDs, pod.UID, "drain test pod was not evicted")
+	// The pod is deleted once its containers stopped, after the preStop hook and at the latest once the grace period
+	// is over
+	assert.True(t, terminationDuration >= drainPreStopDuration,
+		"pod was deleted after %v, before its preStop hook completed", terminationDuration)
+	assert.True(t, terminationDuration < drainGracePeriod+time.Minute,
+		"pod was deleted after %v, long after its %v grace period", terminationDuration, drainGracePeriod)
+
+	cordoned, err := framework.K8sclientset.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	require.NoError(t, err, "unable to get node %s", node.Name)
+	assert.True(t, cordoned.Spec.Unschedulable, "node %s is not cordoned after the drain", node.Name)
+	_, err = waitForUnschedulablePod(deployment, pod.UID)
+	require.NoError(t, err, "replacement pod was not kept pending on the cordoned node")
+
+	require.NoError(t, framework.UncordonNode(node.Name), "unable to uncordon node %s", node.Name)
+	_, err = waitForDeploymentPod(deployment, pod.UID, node.Name, e2ef.Timeout(e2ef.TestsPhase, podAvailableTimeout))
+	assert.NoError(t, err, "replacement pod did not run on node %s once uncordoned", node.Name)
+}
+
+// serverCoreImage returns the Windows Server Core image matching the Windows build of the given node
+func serverCoreImage(node *v1.Node) (string, error) {
+	// The kernel version of a Windows node is <major>.<minor>.<build>.<revision>, e.g. 10.0.17763.1158
+	parts := strings.Split(node.Status.NodeInfo.KernelVersion, ".")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("unexpected kernel version %s of node %s", node.Status.NodeInfo.KernelVersion,
+			node.Name)
+	}
+	tag, ok := serverCoreTags[parts[2]]
+	if !ok {
+		return "", fmt.Errorf("no Windows Server Core image for build %s of node %s", parts[2], node.Name)
+	}
+	return "mcr.microsoft.com/windows/servercore:" + tag, nil
+}
+
+// createDrainTestDeployment creates a single replica deployment of the given Windows image, pinned to the node with
+// the given name. Its preStop hook delays the termination of the pod for drainPreStopDuration.
+func createDrainTestDeployment(name, image, nodeName string) (*appsv1.Deployment, error) {
+	replicas := int32(1)
+	gracePeriod := int64(drainGracePeriod.Seconds())
+	labels := map[string]string{"app": name}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: e2ef.RunLabels(nil)},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: e2ef.RunLabels(labels)},
+				Spec: v1.PodSpec{
+					NodeSelector: map[string]string{"kubernetes.io/hostname": nodeName},
+					Tolerations: []v1.Toleration{
+						{Key: windowsTaint.Key, Value: windowsTaint.Value, Effect: windowsTaint.Effect},
+					},
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Containers: []v1.Container{
+						{
+							Name:            name,
+							Image:           image,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Command:         []string{"powershell.exe", "-command", "while ($true) { Start-Sleep 1 }"},
+							Lifecycle: &v1.Lifecycle{
+								PreStop: &v1.Handler{
+									Exec: &v1.ExecAction{Command: []string{"powershell.exe", "-command",
+										fmt.Sprintf("Start-Sleep %d", int(drainPreStopDuration.Seconds()))}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return framework.K8sclientset.AppsV1().Deployments(v1.NamespaceDefault).Create(deployment)
+}
+
+// deploymentPods returns the pods of the given deployment, apart from the one with the given UID
+func deploymentPods(deployment *appsv1.Deployment, excludedUID k8stypes.UID) ([]v1.Pod, error) {
+	podList, err := framework.K8sclientset.CoreV1().Pods(deployment.Namespace).List(metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector)})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the pods of deployment %s: %v", deployment.Name, err)
+	}
+	var pods []v1.Pod
+	for _, pod := range podList.Items {
+		if pod.UID != excludedUID && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// waitForDeploymentPod waits until a pod of the given deployment, other than the one with the given UID, is ready on
+// the node with the given name and returns it
+func waitForDeploymentPod(deployment *appsv1.Deployment, excludedUID k8stypes.UID, nodeName string,
+	timeout time.Duration) (*v1.Pod, error) {
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(e2ef.RetryInterval) {
+		pods, err := deploymentPods(deployment, excludedUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Spec.NodeName == nodeName && e2ef.IsPodReady(&pod) {
+				return &pod, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("timeout waiting for a pod of deployment %s to be ready on node %s", deployment.Name,
+		nodeName)
+}
+
+// waitForUnschedulablePod waits until a pod of the given deployment, other than the one with the given UID, is
+// reported unschedulable by the scheduler and returns it
+func waitForUnschedulablePod(deployment *appsv1.Deployment, excludedUID k8stypes.UID) (*v1.Pod, error) {
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		pods, err := deploymentPods(deployment, excludedUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Spec.NodeName != "" {
+				return nil, fmt.Errorf("pod %s was scheduled on node %s", pod.Name, pod.Spec.NodeName)
+			}
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+					condition.Reason == v1.PodReasonUnschedulable {
+					return &pod, nil
+				}
+			}
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	return nil, fmt.Errorf("timeout waiting for an unschedulable pod of deployment %s", deployment.Name)
+}
@@ -0,0 +1,309 @@
+package wmcb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// egressRuleTimeout is the time given to OVN-Kubernetes to apply or remove the rules of an EgressFirewall
+	egressRuleTimeout = 5 * time.Minute
+	// egressIPAssignmentTimeout is the time given to OVN-Kubernetes to assign an EgressIP to a node
+	egressIPAssignmentTimeout = 5 * time.Minute
+	// podProbeTimeout is the time given to a probe pod to complete, which includes starting its container
+	podProbeTimeout = 5 * time.Minute
+	// egressConnectTimeout is the time the egress probes give a connection to be established
+	egressConnectTimeout = 10 * time.Second
+	// egressConnected is the output of the connection probe when the connection was established
+	egressConnected = "connected"
+	// egressNamespaceLabel is the label of the test namespace the EgressIP selects
+	egressNamespaceLabel = "windows-machine-config-bootstrapper/egress"
+)
+
+// testEgress asserts that the pods of the Windows node respect the OVN-Kubernetes EgressFirewall of their namespace
+// and egress with the EgressIP assigned to it. The tests run in a namespace of their own, as an EgressFirewall applies
+// to a whole namespace. The HNS state of the node and the status of the egress objects are written to ARTIFACT_DIR if
+// they fail.
+func (vm *wmcbVM) testEgress(t *testing.T) {
+	networkType, err := framework.NetworkType()
+	require.NoError(t, err)
+	if networkType != e2ef.OVNKubernetesNetworkType {
+		t.Skipf("egress firewalls and EgressIPs are only tested on %s clusters, not %s",
+			e2ef.OVNKubernetesNetworkType, networkType)
+	}
+	config, err := e2ef.EgressConfigFromEnv()
+	require.NoError(t, err)
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+
+	name := e2ef.RunScopedName("egress-" + strings.ToLower(vm.GetCredentials().GetInstanceId()))
+	namespace, err := framework.K8sclientset.CoreV1().Namespaces().Create(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: e2ef.RunLabels(map[string]string{egressNamespaceLabel: name})},
+	})
+	require.NoError(t, err, "unable to create the egress test namespace")
+	defer framework.K8sclientset.CoreV1().Namespaces().Delete(namespace.Name, &metav1.DeleteOptions{})
+	defer func() {
+		if t.Failed() {
+			vm.writeEgressDiagnostics(namespace.Name)
+		}
+	}()
+	probe := &podProbe{namespace: namespace.Name, image: image, nodeName: node.Name}
+
+	t.Run("Egress firewall", func(t *testing.T) {
+		probe.testEgressFirewall(t, config.Target)
+	})
+	t.Run("EgressIP", func(t *testing.T) {
+		if config.EgressIP == "" {
+			t.Skip("E2E_EGRESS_IP and E2E_EGRESS_ECHO_URL are not set")
+		}
+		probe.testEgressIP(t, namespace.Name, config.EgressIP, config.EchoURL)
+	})
+}
+
+// podProbe runs the probes of the tests, PowerShell scripts, in pods of the Windows node
+type podProbe struct {
+	// namespace is the test namespace the probe pods run in
+	namespace string
+	// image is the Windows Server Core image of the probe pods
+	image string
+	// nodeName is the name of the Windows node the probe pods run on
+	nodeName string
+	// count is the number of probes run so far, which names the probe pods
+	count int
+}
+
+// testEgressFirewall asserts that the connections to the given target are denied once an EgressFirewall denying them
+// is created in the namespace of the probes, and allowed again once it is deleted
+func (p *podProbe) testEgressFirewall(t *testing.T, target string) {
+	out, err := p.connect(target)
+	require.NoError(t, err)
+	require.Equal(t, egressConnected, out, "%s cannot be reached from the Windows node without an egress firewall, "+
+		"set E2E_EGRESS_TARGET to a reachable <host>:<port> outside of the cluster", target)
+
+	firewall, err := e2ef.EgressFirewall(p.namespace, target)
+	require.NoError(t, err)
+	firewalls := framework.DynamicClient.Resource(e2ef.EgressFirewallResource).Namespace(p.namespace)
+	_, err = firewalls.Create(firewall, metav1.CreateOptions{})
+	require.NoError(t, err, "unable to create the EgressFirewall")
+	deleted := false
+	defer func() {
+		if !deleted {
+			firewalls.Delete(firewall.GetName(), &metav1.DeleteOptions{})
+		}
+	}()
+
+	err = p.pollConnect("the connections to "+target+" to be denied by the EgressFirewall", target,
+		func(out string) bool { return out != egressConnected })
+	require.NoError(t, err, "the EgressFirewall denying %s is not enforced on the Windows node", target)
+
+	require.NoError(t, firewalls.Delete(firewall.GetName(), &metav1.DeleteOptions{}),
+		"unable to delete the EgressFirewall")
+	deleted = true
+	err = p.pollConnect("the connections to "+target+" to be allowed once the EgressFirewall is deleted", target,
+		func(out string) bool { return out == egressConnected })
+	assert.NoError(t, err, "the connections to %s are still denied once the EgressFirewall is deleted", target)
+}
+
+// testEgressIP asserts that the pods of the given namespace egress with the given IP address once it is assigned to a
+// node by an EgressIP, as seen by the server of the given echo URL. A Linux worker is made egress-assignable if no
+// node is.
+func (p *podProbe) testEgressIP(t *testing.T, namespace, ip, echoURL string) {
+	unlabel, err := ensureEgressAssignableNode()
+	require.NoError(t, err)
+	defer unlabel()
+
+	egressIP := e2ef.EgressIP(namespace, ip, map[string]string{egressNamespaceLabel: namespace})
+	egressIPs := framework.DynamicClient.Resource(e2ef.EgressIPResource)
+	_, err = egressIPs.Create(egressIP, metav1.CreateOptions{})
+	require.NoError(t, err, "unable to create the EgressIP")
+	defer egressIPs.Delete(egressIP.GetName(), &metav1.DeleteOptions{})
+
+	assignedNode := ""
+	err = e2ef.Poll(context.Background(), "EgressIP "+ip+" to be assigned to a node",
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase,
+			egressIPAssignmentTimeout), Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			current, err := egressIPs.Get(egressIP.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			assignedNode = e2ef.EgressIPNode(current, ip)
+			return assignedNode != "", "not assigned", nil
+		})
+	require.NoError(t, err, "EgressIP %s was not assigned to an egress-assignable node", ip)
+
+	source := ""
+	err = e2ef.Poll(context.Background(), "the pods of the Windows node to egress with "+ip,
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, egressRuleTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			out, err := p.run("echo", echoScript(echoURL))
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			source = out
+			return net.ParseIP(source).Equal(net.ParseIP(ip)), "egressed with " + source, nil
+		})
+	assert.NoError(t, err, "the pods of the Windows node egressed with %q instead of EgressIP %s assigned to node %s",
+		source, ip, assignedNode)
+}
+
+// pollConnect probes the connections to the given target until the given condition holds on the output of the probe
+func (p *podProbe) pollConnect(description, target string, condition func(out string) bool) error {
+	return e2ef.Poll(context.Background(), description,
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, egressRuleTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			out, err := p.connect(target)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return condition(out), out, nil
+		})
+}
+
+// connect returns egressConnected if a pod of the Windows node establishes a TCP connection to the given
+// <host>:<port> target, and why it did not otherwise
+func (p *podProbe) connect(target string) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %s: %v", target, err)
+	}
+	return p.run("connect", connectScript(host, port))
+}
+
+// run runs the given PowerShell script in a pod of the Windows node and returns its trimmed output once it completed.
+// The pod is deleted afterwards.
+func (p *podProbe) run(kind, script string) (string, error) {
+	p.count++
+	pod := windowsPod(fmt.Sprintf("%s-%s-%d", p.namespace, kind, p.count), p.image, p.nodeName)
+	pod.Namespace = p.namespace
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	pod.Spec.Containers[0].Command = []string{"powershell.exe", "-command", script}
+	pods := framework.K8sclientset.CoreV1().Pods(p.namespace)
+	pod, err := pods.Create(pod)
+	if err != nil {
+		return "", fmt.Errorf("error creating probe pod: %v", err)
+	}
+	defer pods.Delete(pod.Name, &metav1.DeleteOptions{})
+
+	phase := v1.PodUnknown
+	err = e2ef.Poll(context.Background(), "probe pod "+pod.Name+" to complete",
+		e2ef.PollOptions{Interval: 5 * time.Second, Timeout: podProbeTimeout, Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			current, err := pods.Get(pod.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			phase = current.Status.Phase
+			return phase == v1.PodSucceeded || phase == v1.PodFailed, string(phase), nil
+		})
+	if err != nil {
+		return "", err
+	}
+	out, err := pods.GetLogs(pod.Name, &v1.PodLogOptions{}).DoRaw()
+	if err != nil {
+		return "", fmt.Errorf("error getting the output of probe pod %s: %v", pod.Name, err)
+	}
+	if phase == v1.PodFailed {
+		return "", fmt.Errorf("probe pod %s failed: %s", pod.Name, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// connectScript returns the PowerShell script writing egressConnected if a TCP connection to the given host and port
+// is established within egressConnectTimeout, and why it was not otherwise
+func connectScript(host, port string) string {
+	return fmt.Sprintf("$client = New-Object System.Net.Sockets.TcpClient; "+
+		"try { if ($client.ConnectAsync(%s, %s).Wait(%d)) { '%s' } else { 'timeout' } } "+
+		"catch { 'failed: ' + $_.Exception.InnerException.Message } finally { $client.Dispose() }",
+		e2ef.PowerShellString(host), port, int(egressConnectTimeout/time.Millisecond), egressConnected)
+}
+
+// echoScript returns the PowerShell script writing the answer of the given echo URL, the source IP address of the
+// request
+func echoScript(echoURL string) string {
+	return fmt.Sprintf("(Invoke-WebRequest -UseBasicParsing -TimeoutSec %d -Uri %s).Content",
+		int(egressConnectTimeout.Seconds()), e2ef.PowerShellString(echoURL))
+}
+
+// ensureEgressAssignableNode labels a Linux worker node egress-assignable if no node is, and returns the function
+// removing the label it added
+func ensureEgressAssignableNode() (func(), error) {
+	nodes := framework.K8sclientset.CoreV1().Nodes()
+	assignable, err := nodes.List(metav1.ListOptions{LabelSelector: e2ef.EgressAssignableLabel})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the egress-assignable nodes: %v", err)
+	}
+	if len(assignable.Items) > 0 {
+		return func() {}, nil
+	}
+	workers, err := nodes.List(metav1.ListOptions{LabelSelector: "node-role.kubernetes.io/worker,kubernetes.io/os=linux"})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the Linux workers: %v", err)
+	}
+	if len(workers.Items) == 0 {
+		return nil, fmt.Errorf("no Linux worker to assign the EgressIP to")
+	}
+	name := workers.Items[0].Name
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:""}}}`, e2ef.EgressAssignableLabel)
+	if _, err = nodes.Patch(name, k8stypes.StrategicMergePatchType, []byte(patch)); err != nil {
+		return nil, fmt.Errorf("error labeling node %s egress-assignable: %v", name, err)
+	}
+	return func() {
+		patch := fmt.Sprintf(`{"metadata":{"labels":{%q:null}}}`, e2ef.EgressAssignableLabel)
+		if _, err := nodes.Patch(name, k8stypes.StrategicMergePatchType, []byte(patch)); err != nil {
+			log.Printf("unable to remove the egress-assignable label of node %s: %v", name, err)
+		}
+	}, nil
+}
+
+// writeEgressDiagnostics writes the HNS state of the Windows node and the EgressFirewall and EgressIP of the given
+// namespace, with their status, to the egress directory of the VM in ARTIFACT_DIR
+func (vm *wmcbVM) writeEgressDiagnostics(namespace string) {
+	subDir := filepath.Join(vm.GetImage().Version, "egress", vm.GetCredentials().GetInstanceId())
+	hns, err := e2ef.HNSDiagnostics(vm)
+	if err != nil {
+		log.Printf("incomplete HNS diagnostics: %v", err)
+	}
+	if err := framework.WriteToArtifactDir([]byte(hns), subDir, "hns.txt"); err != nil {
+		log.Printf("unable to write the HNS diagnostics: %v", err)
+	}
+
+	var objects []unstructured.Unstructured
+	if firewalls, err := framework.DynamicClient.Resource(e2ef.EgressFirewallResource).Namespace(namespace).List(
+		metav1.ListOptions{}); err == nil {
+		objects = append(objects, firewalls.Items...)
+	}
+	// The EgressIP of the test is named after its namespace
+	if egressIP, err := framework.DynamicClient.Resource(e2ef.EgressIPResource).Get(namespace,
+		metav1.GetOptions{}); err == nil {
+		objects = append(objects, *egressIP)
+	}
+	for _, object := range objects {
+		contents, err := object.MarshalJSON()
+		if err != nil {
+			continue
+		}
+		filename := strings.ToLower(object.GetKind()) + "-" + object.GetName() + ".json"
+		if err := framework.WriteToArtifactDir(contents, subDir, filename); err != nil {
+			log.Printf("unable to write %s %s: %v", object.GetKind(), object.GetName(), err)
+		}
+	}
+}
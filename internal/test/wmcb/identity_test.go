@@ -0,0 +1,79 @@
+package wmcb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// kubeletServiceName is the name of the kubelet Windows service
+const kubeletServiceName = "kubelet"
+
+// testNodeIdentityRestore backs up the identity of the node, wipes it from the VM like a replacement of its disk would,
+// and restores it, asserting that the node rejoins the cluster as the same node with the same certificate, without
+// going through the CSR approval again
+func (vm *wmcbVM) testNodeIdentityRestore(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	certHash, err := vm.kubeletClientCertHash()
+	require.NoError(t, err, "unable to get kubelet client certificate hash")
+
+	backupDir, err := framework.BackupNodeIdentity(vm, vm.GetCredentials().GetInstanceId())
+	require.NoError(t, err, "unable to back up the node identity")
+
+	_, stderr, err := vm.Run(e2ef.PowerShellScript("Stop-Service -Name "+e2ef.PowerShellString(kubeletServiceName)), true)
+	require.NoError(t, err, "unable to stop the kubelet: %s", stderr)
+	var paths []string
+	for _, path := range e2ef.NodeIdentityPaths {
+		paths = append(paths, e2ef.PowerShellString(path))
+	}
+	_, stderr, err = vm.Run(e2ef.PowerShellScript("Remove-Item -Recurse -Force -ErrorAction SilentlyContinue -Path "+
+		strings.Join(paths, ",")), true)
+	require.NoError(t, err, "unable to remove the node identity: %s", stderr)
+
+	restored := time.Now()
+	err = framework.RestoreNodeIdentity(vm, backupDir)
+	require.NoError(t, err, "unable to restore the node identity")
+	_, stderr, err = vm.Run(e2ef.PowerShellScript("Start-Service -Name "+e2ef.PowerShellString(kubeletServiceName)), true)
+	require.NoError(t, err, "unable to start the kubelet: %s", stderr)
+
+	restartedNode, err := waitForNodeHeartbeat(node.GetName(), restored)
+	require.NoError(t, err, "node did not rejoin the cluster with the restored identity")
+	assert.Equal(t, node.GetUID(), restartedNode.GetUID(), "node object was recreated")
+	newCertHash, err := vm.kubeletClientCertHash()
+	require.NoError(t, err, "unable to get kubelet client certificate hash after the restore")
+	assert.Equal(t, certHash, newCertHash, "kubelet client certificate was not restored")
+
+	csrs, err := framework.K8sclientset.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+	require.NoError(t, err, "unable to get CSR list")
+	for _, csr := range csrs.Items {
+		if csr.Spec.Username == nodeCSRRequestor+node.GetName() && csr.GetCreationTimestamp().After(restored) {
+			t.Errorf("node requested a new certificate with CSR %s despite the restored identity", csr.GetName())
+		}
+	}
+}
+
+// waitForNodeHeartbeat waits until the node with the given name reports being Ready after the given time, i.e. once
+// its kubelet has been restarted, and returns it
+func waitForNodeHeartbeat(nodeName string, since time.Time) (*v1.Node, error) {
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		node, err := framework.K8sclientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err == nil {
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue &&
+					condition.LastHeartbeatTime.After(since) {
+					return node, nil
+				}
+			}
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	return nil, fmt.Errorf("timeout waiting for node %s to report being ready", nodeName)
+}
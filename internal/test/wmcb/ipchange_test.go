@@ -0,0 +1,88 @@
+package wmcb
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testNodeIPChange stops and starts the VM, which gives it a new IP address as a change of its DHCP lease would, and
+// asserts that the framework reconnects to the VM and that the node rejoins the cluster as the same node, reporting
+// its new addresses
+func (vm *wmcbVM) testNodeIPChange(t *testing.T) {
+	oldIP := vm.GetCredentials().GetIPAddress()
+	node, err := framework.GetNode(oldIP)
+	require.NoError(t, err, "unable to get node object for VM")
+
+	restarted := time.Now()
+	err = e2ef.StopStart(vm)
+	if err == e2ef.ErrStopStartUnsupported {
+		t.Skipf("the IP address of the VM cannot be changed: %v", err)
+	}
+	require.NoError(t, err, "unable to stop and start the VM")
+	newIP := vm.GetCredentials().GetIPAddress()
+
+	// The framework reaches the VM at its new address over both ssh and WinRM
+	_, stderr, err := vm.Run(e2ef.PowerShellScript("hostname"), true)
+	require.NoError(t, err, "unable to run a command over ssh at %s: %s", newIP, stderr)
+	_, stderr, err = vm.Run(e2ef.PowerShellScript("hostname"), false)
+	require.NoError(t, err, "unable to run a command over WinRM at %s: %s", newIP, stderr)
+
+	stdout, stderr, err := vm.Run(e2ef.PowerShellScript("(Get-Service -Name "+
+		e2ef.PowerShellString(kubeletServiceName)+").Status"), true)
+	require.NoError(t, err, "unable to get the kubelet service status: %s", stderr)
+	assert.Equal(t, "Running", strings.TrimSpace(stdout), "kubelet service did not start with the VM")
+
+	restartedNode, err := waitForNodeHeartbeat(node.GetName(), restarted)
+	require.NoError(t, err, "node did not rejoin the cluster after the IP address change")
+	assert.Equal(t, node.GetUID(), restartedNode.GetUID(), "node object was recreated")
+
+	if newIP == oldIP {
+		t.Logf("the VM is reached through its private IP %s, which was kept", oldIP)
+	} else {
+		restartedNode, err = waitForNodeAddress(node.GetName(), v1.NodeExternalIP, newIP)
+		require.NoError(t, err, "node did not report its new IP address")
+	}
+	// The internal address the kubelet reports must be one the VM has after the restart, not a stale one
+	adapters, err := e2ef.NetworkAdapters(vm)
+	require.NoError(t, err, "could not list the network adapters of the VM")
+	for _, address := range restartedNode.Status.Addresses {
+		if address.Type != v1.NodeInternalIP {
+			continue
+		}
+		assert.NotNil(t, e2ef.FindNetworkAdapter(adapters, net.ParseIP(address.Address)),
+			"node reports internal IP %s, which is not an address of the VM: %v", address.Address, adapters)
+	}
+
+	// The hybrid overlay does not run as a service and has to be started again on the restarted VM
+	err = vm.handleHybridOverlay(node.GetName())
+	require.NoError(t, err, "unable to run the hybrid overlay after the IP address change")
+}
+
+// waitForNodeAddress waits until the node with the given name reports the given address of the given type and returns
+// it
+func waitForNodeAddress(nodeName string, addressType v1.NodeAddressType, address string) (*v1.Node, error) {
+	var addresses []v1.NodeAddress
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		node, err := framework.K8sclientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err == nil {
+			addresses = node.Status.Addresses
+			for _, nodeAddress := range addresses {
+				if nodeAddress.Type == addressType && nodeAddress.Address == address {
+					return node, nil
+				}
+			}
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	return nil, fmt.Errorf("timeout waiting for node %s to report %s %s, last reported %v", nodeName, addressType,
+		address, addresses)
+}
@@ -0,0 +1,61 @@
+package wmcb
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadReportName is the name of the load test report written to the artifact directory
+const loadReportName = "load-report.json"
+
+var (
+	// loadPods is the number of pods run at once on the node in the load test. The load test is disabled if it is 0.
+	loadPods = flag.Int("loadPods", 0, "Number of Windows pods to run at once on the node in the load test")
+	// loadChurnRate is the number of pods replaced per second in the load test, once ramped up
+	loadChurnRate = flag.Float64("loadChurnRate", 0.2, "Number of pods replaced per second in the load test")
+	// loadDuration is the time the pods are churned for in the load test, ramp up included
+	loadDuration = flag.Duration("loadDuration", 10*time.Minute, "Time the pods are churned for in the load test")
+)
+
+// testNodeLoad runs -loadPods pods on the node of the VM and churns them, asserting that the node copes with the load
+// and stays ready. The startup and deletion times of the pods and the kubelet and HNS errors over the run are reported.
+func (vm *wmcbVM) testNodeLoad(t *testing.T) {
+	if *loadPods == 0 {
+		t.Skip("load test is disabled, set -loadPods to enable it")
+	}
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+
+	report, err := framework.GenerateLoad(vm, e2ef.LoadConfig{
+		Name:     e2ef.RunScopedName("load-" + vm.GetCredentials().GetInstanceId()),
+		NodeName: node.Name,
+		Image:    image,
+		Pods:     *loadPods,
+		// Ramp the churn up over the first third of the run
+		ChurnRate: *loadChurnRate,
+		RampUp:    *loadDuration / 3,
+		Duration:  e2ef.Timeout(e2ef.TestsPhase, *loadDuration),
+		// Pulling the Windows Server Core image can take a while the first time
+		PodTimeout: e2ef.Timeout(e2ef.TestsPhase, podAvailableTimeout),
+	})
+	require.NoError(t, err, "unable to generate load on node %s", node.Name)
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	require.NoError(t, err, "unable to marshal load report")
+	log.Printf("load report:\n%s", out)
+	if err = framework.WriteToArtifactDir(out, vm.GetImage().Version, loadReportName); err != nil {
+		log.Printf("unable to write %s: %v", loadReportName, err)
+	}
+
+	_, err = waitForNodeReady(node.Name)
+	assert.NoError(t, err, "node is not ready after the load")
+}
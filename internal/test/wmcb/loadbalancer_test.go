@@ -0,0 +1,76 @@
+package wmcb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// loadBalancerTimeout is the time given to the service controller to provision the load balancer of a service and to
+// register the instances of the nodes with it
+const loadBalancerTimeout = 10 * time.Minute
+
+// testLoadBalancerMembership asserts that the node registered with the provider ID of its instance, and that the
+// service controller registers the instance with the load balancer of a LoadBalancer service, which it only does for
+// the nodes whose instance it finds by their provider ID
+func (vm *wmcbVM) testLoadBalancerMembership(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	assert.True(t, strings.HasSuffix(node.Spec.ProviderID, "/"+vm.GetCredentials().GetInstanceId()),
+		"node registered with provider ID %q, expected the one of instance %s", node.Spec.ProviderID,
+		vm.GetCredentials().GetInstanceId())
+
+	// The load balancer gets the instances of all the schedulable nodes, the service needs no endpoint
+	services := framework.K8sclientset.CoreV1().Services(v1.NamespaceDefault)
+	service, err := services.Create(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "lb-" + strings.ToLower(vm.GetCredentials().GetInstanceId()), Labels: e2ef.RunLabels(nil)},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80}},
+		},
+	})
+	require.NoError(t, err, "unable to create the LoadBalancer service")
+	defer func() {
+		assert.NoError(t, services.Delete(service.GetName(), &metav1.DeleteOptions{}),
+			"unable to delete the LoadBalancer service")
+	}()
+
+	hostname := ""
+	err = e2ef.Poll(context.Background(), "the load balancer of service "+service.GetName()+" to be provisioned",
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, loadBalancerTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			svc, err := services.Get(service.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			if len(svc.Status.LoadBalancer.Ingress) == 0 {
+				return false, "no ingress", nil
+			}
+			hostname = svc.Status.LoadBalancer.Ingress[0].Hostname
+			return hostname != "", "ingress without hostname", nil
+		})
+	require.NoError(t, err, "load balancer was not provisioned")
+	if _, err := e2ef.LoadBalancerMember(vm, hostname); err == e2ef.ErrLoadBalancerUnsupported {
+		t.Skipf("the load balancer membership cannot be checked: %v", err)
+	}
+
+	err = e2ef.Poll(context.Background(), "node "+node.GetName()+" to be registered with load balancer "+hostname,
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, loadBalancerTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			member, err := e2ef.LoadBalancerMember(vm, hostname)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return member, "the instance is not registered", nil
+		})
+	assert.NoError(t, err, "node was not added to the load balancer")
+}
@@ -0,0 +1,140 @@
+package wmcb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// logDirEnvVar is the environment variable the WMCB e2e tests read the kubelet log directory from
+	logDirEnvVar = "WMCB_E2E_LOG_DIR"
+	// collectorLogDir is the directory of the node read by the log collector, which the kubelet is bootstrapped to
+	// write its log to
+	collectorLogDir = "C:\\var\\log\\kubelet"
+	// collectorMountPath is where the log directory of the node is mounted in the log collector container
+	collectorMountPath = "C:\\host\\log"
+	// markerRegistry is the registry of the image of the marker pod. The invalid top level domain never resolves,
+	// so that pulling the image fails and the kubelet logs the image reference whatever its verbosity.
+	markerRegistry = "log-shipping.invalid"
+	// logShippingTimeout is the time given to a line of the kubelet log to reach the log collector
+	logShippingTimeout = 5 * time.Minute
+)
+
+// testKubeletLogShipping bootstraps the node again with the kubelet log in the directory read by the log collector and
+// asserts that the lines logged by the kubelet reach the cluster through a stand-in collector: a pod on the node
+// following the kubelet log of the host, as the DaemonSets of the cluster logging collector do. The node is
+// bootstrapped again with the default log directory afterwards, which the log artifacts are retrieved from.
+func (vm *wmcbVM) testKubeletLogShipping(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	image, err := serverCoreImage(node)
+	require.NoError(t, err)
+
+	vm.kubeletLogDir = collectorLogDir
+	defer vm.restoreKubeletLogDir(t)
+	err = vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
+	require.NoError(t, err, "TestBootstrapper failed with log directory %s", collectorLogDir)
+	// The CNI configuration is lost when the kubelet is initialized again
+	vm.runTestConfigureCNI(t)
+
+	collector, err := createLogCollectorPod(e2ef.RunScopedName("log-collector-"+vm.GetCredentials().GetInstanceId()),
+		image, node.Name)
+	require.NoError(t, err, "unable to create the log collector pod")
+	defer framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Delete(collector.Name, &metav1.DeleteOptions{})
+	err = waitForPodReady(collector.Name, e2ef.Timeout(e2ef.TestsPhase, podAvailableTimeout))
+	require.NoError(t, err, "log collector pod did not run on node %s", node.Name)
+
+	// The kubelet logs the failure to pull the image of the marker pod, which is unique to this run
+	markerImage := fmt.Sprintf("%s/%s:%d", markerRegistry, collector.Name, time.Now().Unix())
+	marker, err := createMarkerPod(e2ef.RunScopedName("log-marker-"+vm.GetCredentials().GetInstanceId()),
+		markerImage, node.Name)
+	require.NoError(t, err, "unable to create the marker pod")
+	defer framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Delete(marker.Name, &metav1.DeleteOptions{})
+
+	err = waitForCollectedLine(collector.Name, markerImage, e2ef.Timeout(e2ef.TestsPhase, logShippingTimeout))
+	assert.NoError(t, err, "kubelet log of node %s was not shipped", node.Name)
+}
+
+// restoreKubeletLogDir bootstraps the node again with the default log directory of the kubelet
+func (vm *wmcbVM) restoreKubeletLogDir(t *testing.T) {
+	vm.kubeletLogDir = ""
+	err := vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
+	if !assert.NoError(t, err, "TestBootstrapper failed when restoring the log directory") {
+		return
+	}
+	vm.runTestConfigureCNI(t)
+}
+
+// createLogCollectorPod creates a pod of the given Windows image on the node with the given name, which follows the
+// kubelet log in the log directory of the node mounted from the host and writes it to its output
+func createLogCollectorPod(name, image, nodeName string) (*v1.Pod, error) {
+	pod := windowsPod(name, image, nodeName)
+	pod.Spec.Volumes = []v1.Volume{{
+		Name:         "log",
+		VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: collectorLogDir}},
+	}}
+	pod.Spec.Containers[0].VolumeMounts = []v1.VolumeMount{{Name: "log", MountPath: collectorMountPath, ReadOnly: true}}
+	pod.Spec.Containers[0].Command = []string{"powershell.exe", "-command",
+		"Get-Content -Path " + remotepath.WindowsPathJoin(collectorMountPath, "kubelet.log") + " -Tail 100 -Wait"}
+	return framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Create(pod)
+}
+
+// createMarkerPod creates a pod of the given image, which cannot be pulled, on the node with the given name
+func createMarkerPod(name, image, nodeName string) (*v1.Pod, error) {
+	pod := windowsPod(name, image, nodeName)
+	pod.Spec.Containers[0].ImagePullPolicy = v1.PullAlways
+	return framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Create(pod)
+}
+
+// windowsPod returns a pod with a single container of the given image, pinned to the Windows node with the given name
+func windowsPod(name, image, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: e2ef.RunLabels(nil)},
+		Spec: v1.PodSpec{
+			NodeSelector: map[string]string{"kubernetes.io/hostname": nodeName},
+			Tolerations: []v1.Toleration{
+				{Key: windowsTaint.Key, Value: windowsTaint.Value, Effect: windowsTaint.Effect},
+			},
+			Containers: []v1.Container{
+				{
+					Name:            name,
+					Image:           image,
+					ImagePullPolicy: v1.PullIfNotPresent,
+				},
+			},
+		},
+	}
+}
+
+// waitForPodReady waits until the pod with the given name is ready
+func waitForPodReady(name string, timeout time.Duration) error {
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(e2ef.RetryInterval) {
+		pod, err := framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Get(name, metav1.GetOptions{})
+		if err == nil && e2ef.IsPodReady(pod) {
+			return nil
+		}
+	}
+	return fmt.Errorf("timeout waiting for pod %s to be ready", name)
+}
+
+// waitForCollectedLine waits until the output of the log collector pod with the given name has a line containing the
+// given string
+func waitForCollectedLine(name, line string, timeout time.Duration) error {
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(e2ef.RetryInterval) {
+		out, err := framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).GetLogs(name,
+			&v1.PodLogOptions{}).DoRaw()
+		if err == nil && strings.Contains(string(out), line) {
+			return nil
+		}
+	}
+	return fmt.Errorf("timeout waiting for %s in the output of log collector pod %s", line, name)
+}
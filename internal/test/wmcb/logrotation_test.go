@@ -0,0 +1,43 @@
+package wmcb
+
+import (
+	"testing"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotatedLogTargets are the node components whose logs WMCB rotates by default
+var rotatedLogTargets = []string{"kubelet", "kube-proxy", "cni", "containerd"}
+
+// testLogRotation rotates the logs of the bootstrapped node through the WMCB e2e test, then asserts that the log
+// rotation configuration covers the node components and that the kubelet log backups are limited to the configured
+// number
+func (vm *wmcbVM) testLogRotation(t *testing.T) {
+	err := vm.runTest(e2eExecutable + " --test.run TestLogRotation --test.v")
+	require.NoError(t, err, "TestLogRotation failed")
+
+	config, err := e2ef.LogRotationConfigOf(vm)
+	require.NoError(t, err, "error reading the log rotation configuration")
+	require.NotNil(t, config, "log rotation is not configured")
+	assert.Positive(t, config.MaxSize)
+	_, err = config.MaxAgeDuration()
+	assert.NoError(t, err, "invalid maximum age")
+	_, err = config.IntervalDuration()
+	assert.NoError(t, err, "invalid interval")
+	for _, name := range rotatedLogTargets {
+		target := config.Target(name)
+		if assert.NotNil(t, target, "%s logs are not rotated", name) {
+			assert.NotEmpty(t, target.Patterns, "%s logs have no patterns", name)
+		}
+	}
+
+	kubeletTarget := config.Target("kubelet")
+	require.True(t, kubeletTarget != nil && len(kubeletTarget.Patterns) > 0, "kubelet log is not rotated")
+	kubeletLog := kubeletTarget.Patterns[0]
+	backups, err := e2ef.LogBackups(vm, kubeletLog)
+	require.NoError(t, err, "error listing the kubelet log backups")
+	assert.NotEmpty(t, backups, "kubelet log %s was not rotated", kubeletLog)
+	assert.LessOrEqual(t, len(backups), config.MaxBackups, "old kubelet log backups were not removed")
+}
@@ -6,14 +6,13 @@ import (
 	"os"
 	"testing"
 
-	e2ef "github.com/openshift/windows-machine-config-bootstrapper/internal/test/framework"
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
 )
 
 // framework holds the instantiation of test suite being executed. As of now, temp dir is hardcoded.
 var (
 	framework = &e2ef.TestFramework{}
-	// TODO: expose this to the end user as a command line flag
-	// vmCount is the number of VMs the test suite requires
+	// vmCount is the number of VMs the test suite requires. It is overridden by -scaleNodes in the scale test mode.
 	vmCount = 1
 )
 
@@ -23,7 +22,22 @@ func TestMain(m *testing.M) {
 
 	flag.Var(&vmCreds, "vmCreds", "List of VM credentials")
 	flag.BoolVar(&skipVMSetup, "skipVMSetup", false, "Option to disable setup in the VMs")
+	framework.Inputs.RegisterFlags(flag.CommandLine)
+	flag.Var(&framework.ArtifactSinks, "artifactSinks", "Comma separated list of directories, s3://<bucket>/<prefix> "+
+		"and gs://<bucket>/<prefix> locations the artifacts are stored in at the end of the run. Defaults to "+
+		"E2E_ARTIFACT_SINKS")
+	flag.Var(&framework.Notifiers, "notify", "Comma separated list of webhook URLs, Slack incoming webhooks or "+
+		"endpoints receiving JSON, notified of the creation, bootstrap and teardown of the VMs. Defaults to "+
+		"E2E_NOTIFY")
+	flag.Var(&framework.SSHKeys, "sshKeys", "Comma separated list of <key pair name>=<private key path> key pairs "+
+		"the VMs are created with in turn, and generated for a key pair generated for the run. Defaults to "+
+		"E2E_SSH_KEYS")
+	flag.Var(&framework.Images, "images", "Comma separated list of <version>=<image ID> Windows images to run the "+
+		"test suite against. Defaults to the latest Windows image")
 	flag.Parse()
+	if *scaleNodes > 0 {
+		vmCount = *scaleNodes
+	}
 
 	err := framework.Setup(vmCount, vmCreds, skipVMSetup)
 	if err != nil {
@@ -32,7 +46,10 @@ func TestMain(m *testing.M) {
 	}
 	testStatus := m.Run()
 	// Retrieve artifacts after running the test
-	framework.RetrieveArtifacts()
+	if err := framework.RetrieveArtifacts(); err != nil {
+		// Missing artifacts do not fail the run, they are reported for the failures to be investigated
+		log.Print(err)
+	}
 	// TODO: Add one more check to remove lingering cloud resources
 	framework.TearDown()
 	os.Exit(testStatus)
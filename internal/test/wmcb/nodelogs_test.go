@@ -0,0 +1,49 @@
+package wmcb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nodeLogsTimeout is the time given to the kubelet log to be served through the API server once the node is ready
+const nodeLogsTimeout = 2 * time.Minute
+
+// testNodeLogs asserts that the kubelet log of the node is served through the node proxy of the API server, the path
+// `oc adm node-logs --path=kubelet/kubelet.log` reads, and not only retrievable over ssh
+func (vm *wmcbVM) testNodeLogs(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+
+	var kubeletLog []byte
+	err = e2ef.Poll(context.Background(), "the kubelet log of node "+node.Name+" to be served",
+		e2ef.PollOptions{Interval: e2ef.RetryInterval, Timeout: e2ef.Timeout(e2ef.TestsPhase, nodeLogsTimeout),
+			Jitter: e2ef.DefaultPollJitter},
+		func() (bool, string, error) {
+			out, err := nodeLogs(node.Name, "kubelet/kubelet.log")
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			kubeletLog = out
+			return len(out) > 0, "the kubelet log is empty", nil
+		})
+	require.NoError(t, err)
+	// The kubelet logs the name of the node it registers
+	assert.Contains(t, string(kubeletLog), node.Name, "the kubelet log served does not mention node %s", node.Name)
+}
+
+// nodeLogs returns the file at the given path of the /logs endpoint of the kubelet of the node with the given name,
+// through the node proxy of the API server
+func nodeLogs(nodeName, path string) ([]byte, error) {
+	out, err := framework.K8sclientset.CoreV1().RESTClient().Get().Resource("nodes").Name(nodeName).
+		SubResource("proxy").Suffix("logs", path).DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get logs/%s of node %s: %v", path, nodeName, err)
+	}
+	return out, nil
+}
@@ -1,7 +1,9 @@
-# Script that downloads a file from the server to the output location ignoring the server certificate
+# Script that downloads a file from the server to the output location ignoring the server certificate, sending the
+# given HTTP headers, e.g. the authorization required by the ignition server of a hosted control plane
 param (
     [Parameter(Mandatory=$true)][string]$server,
-    [Parameter(Mandatory=$true)][string]$output
+    [Parameter(Mandatory=$true)][string]$output,
+    [hashtable]$headers = @{}
 )
 
 if (-not("dummy" -as [type])) {
@@ -23,4 +25,4 @@ public static class Dummy {
 }
 [System.Net.ServicePointManager]::ServerCertificateValidationCallback = [dummy]::GetDelegate()
 
-wget $server -o $output
+wget $server -Headers $headers -o $output
@@ -0,0 +1,124 @@
+package wmcb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// kubeletClientCert is the current kubelet client certificate on the Windows VM
+const kubeletClientCert = "C:\\var\\lib\\kubelet\\pki\\kubelet-client-current.pem"
+
+// testNodeRemovalAndRebootstrap deletes the node object, runs the uninstall path on the VM and bootstraps the VM again,
+// asserting that the node rejoins the cluster with a new certificate
+func (vm *wmcbVM) testNodeRemovalAndRebootstrap(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	oldCertHash, err := vm.kubeletClientCertHash()
+	require.NoError(t, err, "unable to get kubelet client certificate hash")
+
+	err = framework.K8sclientset.CoreV1().Nodes().Delete(node.GetName(), &metav1.DeleteOptions{})
+	require.NoError(t, err, "unable to delete node %s", node.GetName())
+	err = waitForNodeDeletion(node.GetName())
+	require.NoError(t, err, "node %s was not deleted", node.GetName())
+
+	err = vm.runTest(e2eExecutable + " --test.run TestUninstall --test.v")
+	require.NoError(t, err, "TestUninstall failed")
+	processes, err := e2ef.ListProcesses(vm, "kubelet")
+	require.NoError(t, err, "error listing kubelet processes")
+	assert.Empty(t, processes, "kubelet is still running after uninstall")
+	entries, err := e2ef.ChangeJournal(vm)
+	require.NoError(t, err, "error reading the change journal")
+	assert.Equal(t, "removed", lastJournalAction(entries, "service", "kubelet"),
+		"kubelet service removal not recorded in the change journal")
+	assert.Equal(t, "removed", lastJournalAction(entries, "file", "C:\\k\\kubelet.exe"),
+		"kubelet removal not recorded in the change journal")
+	// Ensure no stale kubelet holds the files that are replaced when bootstrapping again
+	err = e2ef.KillProcesses(vm, "kubelet")
+	require.NoError(t, err, "error stopping stale kubelet processes")
+
+	// Bootstrap the node again, which requires the bootstrap and node CSRs to be approved again
+	err = vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
+	require.NoError(t, err, "TestBootstrapper failed after uninstall")
+	err = handleCSRs()
+	require.NoError(t, err, "error handling CSRs after uninstall")
+
+	newNode, err := waitForNodeReady(node.GetName())
+	require.NoError(t, err, "node did not rejoin the cluster")
+	assert.NotEqual(t, node.GetUID(), newNode.GetUID(), "node object was not recreated")
+
+	newCertHash, err := vm.kubeletClientCertHash()
+	require.NoError(t, err, "unable to get kubelet client certificate hash after re-bootstrap")
+	assert.NotEqual(t, oldCertHash, newCertHash, "kubelet client certificate was not renewed")
+
+	// The CNI configuration is lost when the kubelet is initialized again
+	vm.runTestConfigureCNI(t)
+}
+
+// kubeletClientCertHash returns the SHA256 of the current kubelet client certificate on the VM
+func (vm *wmcbVM) kubeletClientCertHash() (string, error) {
+	stdout, stderr, err := vm.Run(e2ef.PowerShellScript("(Get-FileHash -Algorithm SHA256 "+
+		e2ef.PowerShellString(kubeletClientCert)+").Hash"), true)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash %s: %v\n%s", kubeletClientCert, err, stderr)
+	}
+	hash := strings.TrimSpace(stdout)
+	if hash == "" {
+		return "", fmt.Errorf("empty hash for %s", kubeletClientCert)
+	}
+	return hash, nil
+}
+
+// lastJournalAction returns the last action recorded in the journal entries for the given object, or an empty string
+// if none was recorded
+func lastJournalAction(entries []e2ef.JournalEntry, kind, target string) string {
+	action := ""
+	for _, entry := range entries {
+		if entry.Kind == kind && strings.EqualFold(entry.Target, target) {
+			action = entry.Action
+		}
+	}
+	return action
+}
+
+// waitForNodeDeletion waits until the node object with the given name is gone
+func waitForNodeDeletion(nodeName string) error {
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		_, err := framework.K8sclientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	return fmt.Errorf("timeout waiting for node %s to be deleted", nodeName)
+}
+
+// waitForNodeReady waits until the node object with the given name exists and is Ready and returns it
+func waitForNodeReady(nodeName string) (*v1.Node, error) {
+	var lastUID k8stypes.UID
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		node, err := framework.K8sclientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err == nil {
+			lastUID = node.GetUID()
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+					return node, nil
+				}
+			}
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	if lastUID == "" {
+		return nil, fmt.Errorf("timeout waiting for node %s to be created", nodeName)
+	}
+	return nil, fmt.Errorf("timeout waiting for node %s to be ready", nodeName)
+}
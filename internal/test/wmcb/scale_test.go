@@ -0,0 +1,289 @@
+package wmcb
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// csrPollInterval is the interval at which the scale test looks for CSRs to approve
+	csrPollInterval = 2 * time.Second
+	// scaleReportName is the name of the scale test report written to the artifact directory
+	scaleReportName = "scale-report.json"
+	// bootstrapCSRRequestor is the requestor of the CSRs created with the bootstrap kubeconfig
+	bootstrapCSRRequestor = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+	// nodeCSRRequestor is the requestor prefix of the CSRs created by the kubelets
+	nodeCSRRequestor = "system:node:"
+)
+
+// The phases each node goes through in the scale test, in order
+const (
+	phaseSetup        = "setup"
+	phaseBootstrap    = "bootstrap"
+	phaseRegistration = "registration"
+	phaseCNI          = "cni"
+	phaseReady        = "ready"
+)
+
+var (
+	// scaleNodes is the number of Windows nodes bootstrapped concurrently in the scale test mode. The scale test mode
+	// is disabled if it is 0.
+	scaleNodes = flag.Int("scaleNodes", 0,
+		"Number of Windows nodes to provision and bootstrap concurrently in the scale test mode")
+	// scalePhases are the phases of the scale test in the order they are reported
+	scalePhases = []string{phaseSetup, phaseBootstrap, phaseRegistration, phaseCNI, phaseReady}
+)
+
+// nodeResult is the outcome of bootstrapping a single node in the scale test
+type nodeResult struct {
+	// Instance is the cloud instance ID of the VM
+	Instance string `json:"instance"`
+	// Version is the Windows version of the image the VM was created from, if the VMs were created from multiple images
+	Version string `json:"version,omitempty"`
+	// Node is the name of the node object, once the node registered
+	Node string `json:"node,omitempty"`
+	// Success is true if the node went through all the phases
+	Success bool `json:"success"`
+	// FailedPhase is the phase the node failed in
+	FailedPhase string `json:"failedPhase,omitempty"`
+	// PhaseSeconds is the duration of each completed phase in seconds
+	PhaseSeconds map[string]float64 `json:"phaseSeconds"`
+}
+
+// scaleReport is the aggregated report of the scale test
+type scaleReport struct {
+	// Nodes is the number of nodes bootstrapped concurrently
+	Nodes int `json:"nodes"`
+	// Succeeded is the number of nodes that became Ready
+	Succeeded int `json:"succeeded"`
+	// SuccessRate is the percentage of nodes that became Ready
+	SuccessRate float64 `json:"successRate"`
+	// CSRsApproved is the number of bootstrap and node CSRs approved during the test
+	CSRsApproved int `json:"csrsApproved"`
+	// MaxPendingCSRs is the highest number of CSRs observed pending approval at the same time
+	MaxPendingCSRs int `json:"maxPendingCSRs"`
+	// CSRApprovalSeconds summarizes the time from the creation of each CSR to its approval
+	CSRApprovalSeconds e2ef.DurationSummary `json:"csrApprovalSeconds"`
+	// PhaseSeconds summarizes the duration of each phase across the nodes that completed it
+	PhaseSeconds map[string]e2ef.DurationSummary `json:"phaseSeconds"`
+	// Results are the per node results
+	Results []nodeResult `json:"results"`
+}
+
+// csrApprover approves the bootstrap and node CSRs of all the nodes in the scale test, recording the CSR pressure on
+// the API server
+type csrApprover struct {
+	// approved holds the names of the CSRs approved so far
+	approved map[string]bool
+	// latencies are the durations from the creation of each CSR to its approval
+	latencies []time.Duration
+	// maxPending is the highest number of CSRs observed pending approval at the same time
+	maxPending int
+}
+
+// newCSRApprover returns a csrApprover without any recorded approvals
+func newCSRApprover() *csrApprover {
+	return &csrApprover{approved: make(map[string]bool)}
+}
+
+// run approves the pending bootstrap and node CSRs until stop is closed
+func (a *csrApprover) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(csrPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := a.approvePending(); err != nil {
+				log.Printf("error approving CSRs: %v", err)
+			}
+		}
+	}
+}
+
+// approvePending approves all the bootstrap and node CSRs that have not been handled yet
+func (a *csrApprover) approvePending() error {
+	csrs, err := framework.K8sclientset.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get CSR list: %v", err)
+	}
+
+	var pending []certificates.CertificateSigningRequest
+	for _, csr := range csrs.Items {
+		if a.approved[csr.GetName()] || isHandled(&csr) {
+			continue
+		}
+		if csr.Spec.Username != bootstrapCSRRequestor && !strings.HasPrefix(csr.Spec.Username, nodeCSRRequestor) {
+			continue
+		}
+		pending = append(pending, csr)
+	}
+	if len(pending) > a.maxPending {
+		a.maxPending = len(pending)
+	}
+
+	for i := range pending {
+		if err = approve(&pending[i]); err != nil {
+			return fmt.Errorf("unable to approve CSR %s: %v", pending[i].GetName(), err)
+		}
+		a.approved[pending[i].GetName()] = true
+		a.latencies = append(a.latencies, time.Since(pending[i].GetCreationTimestamp().Time))
+	}
+	return nil
+}
+
+// isHandled returns true if the CSR has been approved or denied
+func isHandled(csr *certificates.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == certificates.CertificateApproved || c.Type == certificates.CertificateDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// TestScale provisions the number of VMs given by -scaleNodes and bootstraps them concurrently, reporting the per node
+// success rate, the duration of each bootstrap phase and the CSR pressure
+func TestScale(t *testing.T) {
+	if *scaleNodes == 0 {
+		t.Skip("scale test mode is disabled, set -scaleNodes to enable it")
+	}
+
+	// The CSRs of all the nodes are approved centrally, as handleCSRs approves a single pair of CSRs
+	approver := newCSRApprover()
+	stop := make(chan struct{})
+	var approverDone sync.WaitGroup
+	approverDone.Add(1)
+	go func() {
+		defer approverDone.Done()
+		approver.run(stop)
+	}()
+
+	results := make([]nodeResult, len(framework.WinVMs))
+	// The group subtest returns only once all of its parallel subtests have completed
+	t.Run("Bootstrap", func(t *testing.T) {
+		for i, vm := range framework.WinVMs {
+			result := &results[i]
+			wVM := &wmcbVM{WindowsVM: vm}
+			t.Run(fmt.Sprintf("node %d", i), func(t *testing.T) {
+				t.Parallel()
+				wVM.bootstrapForScale(t, result)
+			})
+		}
+	})
+	close(stop)
+	approverDone.Wait()
+
+	report := newScaleReport(results, approver)
+	out, err := json.MarshalIndent(report, "", "  ")
+	require.NoError(t, err, "unable to marshal scale report")
+	log.Printf("scale report:\n%s", out)
+	if err = framework.WriteToArtifactDir(out, "", scaleReportName); err != nil {
+		log.Printf("unable to write %s: %v", scaleReportName, err)
+	}
+	assert.Equal(t, report.Nodes, report.Succeeded, "not all nodes were bootstrapped successfully")
+}
+
+// bootstrapForScale bootstraps the VM and configures CNI on it, recording the duration of each phase in the result. The
+// CSRs are expected to be approved by the csrApprover.
+func (vm *wmcbVM) bootstrapForScale(t *testing.T, result *nodeResult) {
+	result.Instance = vm.GetCredentials().GetInstanceId()
+	result.Version = vm.GetImage().Version
+	result.PhaseSeconds = make(map[string]float64)
+	phase := phaseSetup
+	start := time.Now()
+	// completePhase records the duration of the current phase and moves on to the next one
+	completePhase := func(next string) {
+		result.PhaseSeconds[phase] = time.Since(start).Seconds()
+		phase = next
+		start = time.Now()
+	}
+	defer func() {
+		result.Success = !t.Failed()
+		if t.Failed() {
+			result.FailedPhase = phase
+		}
+	}()
+
+	for _, file := range strings.Split(*filesToBeTransferred, ",") {
+		err := vm.CopyFile(file, remoteDir)
+		require.NoError(t, err, "error copying %s to the Windows VM", file)
+	}
+	err := vm.initializeTestBootstrapperFiles()
+	require.NoError(t, err, "error initializing files required for TestBootstrapper")
+	completePhase(phaseBootstrap)
+
+	err = vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
+	require.NoError(t, err, "TestBootstrapper failed")
+	completePhase(phaseRegistration)
+
+	nodeName, err := waitForNodeRegistration(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "node did not register")
+	result.Node = nodeName
+	completePhase(phaseCNI)
+
+	vm.runTestConfigureCNI(t)
+	completePhase(phaseReady)
+
+	_, err = waitForNodeReady(nodeName)
+	require.NoError(t, err, "node did not become ready")
+	completePhase("")
+}
+
+// waitForNodeRegistration waits until a node object with the given external IP exists and returns its name
+func waitForNodeRegistration(externalIP string) (string, error) {
+	var err error
+	for retries := 0; retries < e2ef.RetryCount; retries++ {
+		var nodeName string
+		nodeName, err = framework.GetNodeName(externalIP)
+		if err == nil {
+			return nodeName, nil
+		}
+		time.Sleep(e2ef.RetryInterval)
+	}
+	return "", fmt.Errorf("timeout waiting for node with IP %s to register: %v", externalIP, err)
+}
+
+// newScaleReport aggregates the per node results and the CSR statistics into a report
+func newScaleReport(results []nodeResult, approver *csrApprover) *scaleReport {
+	report := &scaleReport{
+		Nodes:              len(results),
+		CSRsApproved:       len(approver.approved),
+		MaxPendingCSRs:     approver.maxPending,
+		CSRApprovalSeconds: e2ef.SummarizeDurations(approver.latencies),
+		PhaseSeconds:       make(map[string]e2ef.DurationSummary),
+		Results:            results,
+	}
+	for _, result := range results {
+		if result.Success {
+			report.Succeeded++
+		}
+	}
+	if report.Nodes > 0 {
+		report.SuccessRate = float64(report.Succeeded) / float64(report.Nodes) * 100
+	}
+
+	for _, phase := range scalePhases {
+		var durations []time.Duration
+		for _, result := range results {
+			if seconds, found := result.PhaseSeconds[phase]; found {
+				durations = append(durations, time.Duration(seconds*float64(time.Second)))
+			}
+		}
+		report.PhaseSeconds[phase] = e2ef.SummarizeDurations(durations)
+	}
+	return report
+}
@@ -0,0 +1,81 @@
+package wmcb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// windowsExporterEnvVar is the environment variable the WMCB e2e tests read the windows_exporter executable from
+	windowsExporterEnvVar = "WMCB_E2E_WINDOWS_EXPORTER"
+	// windowsExporterPort is the port windows_exporter is installed with by the WMCB e2e tests
+	windowsExporterPort = 9182
+	// windowsExporterRule is the Windows Firewall rule opening the windows_exporter port
+	windowsExporterRule = "OpenShift windows_exporter"
+)
+
+var (
+	// windowsExporter is the windows_exporter release installed on the node
+	windowsExporter = pkgInfo{
+		name: "windows_exporter-0.16.0-amd64.exe",
+		source: &payload.HTTPMirror{
+			BaseURL: "https://github.com/prometheus-community/windows_exporter/releases/download/v0.16.0"},
+	}
+	// windowsExporterExecutable is the remote location of the downloaded windows_exporter executable
+	windowsExporterExecutable = remotepath.WindowsPathJoin(remoteDir, windowsExporter.name)
+	// windowsExporterCollectors are the collectors WMCB enables by default
+	windowsExporterCollectors = []string{"cpu", "cs", "container", "logical_disk", "memory", "net", "os", "service",
+		"system", "tcp"}
+)
+
+// testWindowsExporter installs windows_exporter through the WMCB e2e test, then asserts that its port is opened in
+// the Windows Firewall and that a scrape from outside the node reports the default collectors as successful
+func (vm *wmcbVM) testWindowsExporter(t *testing.T) {
+	require.NoError(t, vm.remoteDownload(windowsExporter, windowsExporterExecutable),
+		"error downloading windows_exporter")
+	err := vm.runTest("$env:" + windowsExporterEnvVar + "=" + e2ef.PowerShellString(windowsExporterExecutable) +
+		"; " + e2eExecutable + " --test.run TestWindowsExporter --test.v")
+	require.NoError(t, err, "TestWindowsExporter failed")
+
+	firewall, err := e2ef.FirewallStateOf(vm)
+	require.NoError(t, err, "error getting the Windows Firewall state")
+	var rule *e2ef.FirewallRule
+	for i := range firewall.Rules {
+		if firewall.Rules[i].Name == windowsExporterRule {
+			rule = &firewall.Rules[i]
+		}
+	}
+	if assert.NotNil(t, rule, "the windows_exporter port is not opened in the Windows Firewall") {
+		assert.Equal(t, "Allow", rule.Action)
+		assert.Equal(t, "TCP", rule.Protocol)
+		assert.Equal(t, []string{fmt.Sprint(windowsExporterPort)}, rule.LocalPorts)
+	}
+
+	tunnel, err := vm.Tunnel(0, windowsExporterPort)
+	require.NoError(t, err, "error opening a tunnel to windows_exporter")
+	defer tunnel.Close()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get("http://" + tunnel.LocalAddr() + "/metrics")
+	require.NoError(t, err, "error scraping windows_exporter")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	metrics, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "error reading the windows_exporter metrics")
+	require.NoError(t, framework.WriteToArtifactDir(metrics, "windows-exporter",
+		vm.GetCredentials().GetInstanceId()+".prom"), "error saving the windows_exporter metrics")
+	for _, collector := range windowsExporterCollectors {
+		assert.True(t, strings.Contains(string(metrics),
+			"windows_exporter_collector_success{collector=\""+collector+"\"} 1"),
+			"collector %s is not reported as successful", collector)
+	}
+}
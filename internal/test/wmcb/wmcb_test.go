@@ -5,17 +5,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"text/template"
 	"time"
 
-	"github.com/openshift/windows-machine-config-bootstrapper/internal/test"
-	e2ef "github.com/openshift/windows-machine-config-bootstrapper/internal/test/framework"
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	certificates "k8s.io/api/certificates/v1beta1"
@@ -26,30 +26,32 @@ import (
 
 const (
 	// remoteDir is the remote temporary directory that the e2e test uses
-	remoteDir = "C:\\Temp\\"
+	remoteDir = "C:\\Temp"
 	// winTemp is the default Windows temporary directory
-	winTemp = "C:\\Windows\\Temp\\"
-	// winCNIDir is the directory where the CNI files are placed
-	winCNIDir = winTemp + "\\cni\\"
-	// winCNIConfigPath is the CNI configuration file path on the Windows VM
-	winCNIConfigPath = "C:\\Windows\\Temp\\cni\\config\\"
+	winTemp = "C:\\Windows\\Temp"
 	// logDir is the remote kubernetes log director
-	kLog = "C:\\k\\log\\"
+	kLog = "C:\\k\\log"
 	// cniConfigTemplate is the location of the cni.conf template file
 	cniConfigTemplate = "templates/cni.template"
-	// wgetIgnoreCertCmd is the remote location of the wget-ignore-cert.ps1 script
-	wgetIgnoreCertCmd = remoteDir + "wget-ignore-cert.ps1"
-	// e2eExecutable is the remote location of the WMCB e2e test binary
-	e2eExecutable = remoteDir + "wmcb_e2e_test.exe"
-	// unitExecutable is the remote location of the WMCB unit test binary
-	unitExecutable = remoteDir + "wmcb_unit_test.exe"
 	// hybridOverlayName is the name of the hybrid overlay executable
 	hybridOverlayName = "hybrid-overlay.exe"
-	// hybridOverExecutable is the remote location of the hybrid overlay binary
-	hybridOverlayExecutable = remoteDir + hybridOverlayName
+	// containerRuntimeEnvVar is the environment variable the WMCB e2e tests read the container runtime of the node from
+	containerRuntimeEnvVar = "WMCB_E2E_CONTAINER_RUNTIME"
 )
 
 var (
+	// winCNIDir is the directory where the CNI files are placed
+	winCNIDir = remotepath.WindowsPathJoin(winTemp, "cni")
+	// winCNIConfigPath is the CNI configuration file path on the Windows VM
+	winCNIConfigPath = remotepath.WindowsPathJoin(winCNIDir, "config")
+	// wgetIgnoreCertCmd is the remote location of the wget-ignore-cert.ps1 script
+	wgetIgnoreCertCmd = remotepath.WindowsPathJoin(remoteDir, "wget-ignore-cert.ps1")
+	// e2eExecutable is the remote location of the WMCB e2e test binary
+	e2eExecutable = remotepath.WindowsPathJoin(remoteDir, "wmcb_e2e_test.exe")
+	// unitExecutable is the remote location of the WMCB unit test binary
+	unitExecutable = remotepath.WindowsPathJoin(remoteDir, "wmcb_unit_test.exe")
+	// hybridOverExecutable is the remote location of the hybrid overlay binary
+	hybridOverlayExecutable = remotepath.WindowsPathJoin(remoteDir, hybridOverlayName)
 	// windowsTaint is the taint that needs to be applied to the Windows node
 	windowsTaint = v1.Taint{
 		Key:    "os",
@@ -61,13 +63,15 @@ var (
 		"Comma separated list of files to be transferred")
 	// kubeNode contains the information about  the kubernetes node package for Windows
 	kubeNode = pkgInfo{
-		url:     "https://dl.k8s.io/v1.16.2/kubernetes-node-windows-amd64.tar.gz",
+		name:    "kubernetes-node-windows-amd64.tar.gz",
+		source:  &payload.HTTPMirror{BaseURL: "https://dl.k8s.io/v1.16.2"},
 		sha:     "a88e7a1c6f72ea6073dbb4ddfe2e7c8bd37c9a56d94a33823f531e303a9915e7a844ac5880097724e44dfa7f4a9659d14b79cc46e2067f6b13e6df3f3f1b0f64",
 		shaType: "sha512",
 	}
 	// cniPlugins contains information about the CNI plugin package
 	cniPlugins = pkgInfo{
-		url:     "https://github.com/containernetworking/plugins/releases/download/v0.8.2/cni-plugins-windows-amd64-v0.8.2.tgz",
+		name:    "cni-plugins-windows-amd64-v0.8.2.tgz",
+		source:  &payload.GitHubRelease{Owner: "containernetworking", Repo: "plugins", Tag: "v0.8.2"},
 		sha:     "705a760673fd9e2164ac38f0df7d739ca6c3ec4f4204b0c439227ec6da7cb153859013c917e7f8f1a9456365dd9193f627a7e9e4e1981725cab89bb5ab881ec0",
 		shaType: "sha512",
 	}
@@ -76,36 +80,76 @@ var (
 // wmcbVM is a wrapper for the WindowsVM interface that associates it with WMCB specific testing
 type wmcbVM struct {
 	e2ef.WindowsVM
+	// kubeletLogDir is the directory the kubelet is bootstrapped to write its log to by the WMCB e2e tests, the
+	// default one if empty
+	kubeletLogDir string
+	// bitLocker is the BitLocker mode the kubelet is bootstrapped with by the WMCB e2e tests, the data volume is left
+	// unchecked if empty
+	bitLocker string
 }
 
 // pkg encapsulates information about a package
 type pkgInfo struct {
-	// url is the URL of the package
-	url string
-	// sha is the SHA hash of the package
+	// name is the name of the package in its payload source
+	name string
+	// source is the payload source of the package, unless overridden with E2E_PAYLOAD_SOURCE
+	source e2ef.PayloadSource
+	// sha is the SHA hash of the package, the one published by the payload source is used if empty
 	sha string
 	// shaType is the type of SHA used, example: 256 or 512
 	shaType string
 }
 
-// TestWMCB runs the unit and e2e tests for WMCB on the remote VMs
+// TestWMCB runs the unit and e2e tests for WMCB on the remote VMs. When the VMs were created from multiple images, the
+// tests of each VM are grouped under the Windows version of its image.
 func TestWMCB(t *testing.T) {
-	remoteDir := "C:\\Temp"
+	if *scaleNodes > 0 {
+		t.Skip("the WMCB tests expect a single VM and are not run in the scale test mode")
+	}
 	for _, vm := range framework.WinVMs {
-		wVM := &wmcbVM{vm}
-		files := strings.Split(*filesToBeTransferred, ",")
-		for _, file := range files {
-			err := wVM.CopyFile(file, remoteDir)
-			require.NoError(t, err, "error copying %s to the Windows VM", file)
+		wVM := &wmcbVM{WindowsVM: vm}
+		if version := vm.GetImage().Version; version != "" {
+			t.Run(version, wVM.runTestSuite)
+		} else {
+			wVM.runTestSuite(t)
 		}
-		t.Run("Unit", func(t *testing.T) {
-			assert.NoError(t, wVM.runTest(unitExecutable+" --test.v"), "WMCB unit test failed")
-		})
-		t.Run("E2E", func(t *testing.T) {
-			wVM.runE2ETestSuite(t)
-		})
-		t.Run("WMCB cluster tests", testWMCBCluster)
 	}
+	if len(framework.WinVMs) > 1 {
+		t.Run("Configuration drift", testConfigDrift)
+	}
+}
+
+// runTestSuite runs the unit and e2e tests for WMCB on the VM
+func (vm *wmcbVM) runTestSuite(t *testing.T) {
+	files := strings.Split(*filesToBeTransferred, ",")
+	for _, file := range files {
+		err := vm.CopyFile(file, remoteDir)
+		require.NoError(t, err, "error copying %s to the Windows VM", file)
+	}
+	t.Run("Unit", func(t *testing.T) {
+		assert.NoError(t, vm.runTest(unitExecutable+" --test.v"), "WMCB unit test failed")
+	})
+	t.Run("E2E", func(t *testing.T) {
+		vm.runE2ETestSuite(t)
+	})
+	t.Run("WMCB cluster tests", vm.testWMCBCluster)
+	t.Run("Load balancer membership", vm.testLoadBalancerMembership)
+	t.Run("Egress firewall and EgressIP", vm.testEgress)
+	t.Run("DNS resolution", vm.testDNS)
+	t.Run("Security baseline", vm.testSecurityBaseline)
+	t.Run("Node logs", vm.testNodeLogs)
+	t.Run("Node drain", vm.testNodeDrain)
+	t.Run("Node load", vm.testNodeLoad)
+	t.Run("Node identity backup and restore", vm.testNodeIdentityRestore)
+	t.Run("Kubelet certificate expiry", vm.testCertificateExpiry)
+	t.Run("Node removal and re-bootstrap", vm.testNodeRemovalAndRebootstrap)
+	t.Run("Kubelet log shipping", vm.testKubeletLogShipping)
+	t.Run("Log rotation", vm.testLogRotation)
+	t.Run("Windows exporter", vm.testWindowsExporter)
+	t.Run("Crash dumps", vm.testCrashDumps)
+	t.Run("Node IP address change", vm.testNodeIPChange)
+	// The data volume is left encrypted, so the BitLocker test runs last
+	t.Run("BitLocker encrypted volume", vm.testBitLocker)
 }
 
 // runE2ETestSuite runs the WmCB e2e tests suite on the VM
@@ -117,11 +161,32 @@ func (vm *wmcbVM) runE2ETestSuite(t *testing.T) {
 	require.NoError(t, err, "error handling CSRs")
 
 	vm.runTestConfigureCNI(t)
+
+	// The node is Ready once the CNI is configured
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	node, err = waitForNodeReady(node.GetName())
+	require.NoError(t, err, "node did not become Ready")
+	assert.NoError(t, e2ef.RecordNodeReady(vm.GetCredentials().GetIPAddress(), node),
+		"node did not become Ready in time")
+
+	// The node is bootstrapped, the later tests reach it over ssh only if WinRM is hardened
+	require.NoError(t, e2ef.HardenWinRM(vm), "unable to harden WinRM")
 }
 
 // runTest runs the testCmd in the given VM
 func (vm *wmcbVM) runTest(testCmd string) error {
-	stdout, stderr, err := vm.Run(testCmd, true)
+	testCmd = "$env:" + containerRuntimeEnvVar + "=" + e2ef.PowerShellString(e2ef.ContainerRuntime) + "; " + testCmd
+	if vm.kubeletLogDir != "" {
+		testCmd = "$env:" + logDirEnvVar + "=" + e2ef.PowerShellString(vm.kubeletLogDir) + "; " + testCmd
+	}
+	if vm.bitLocker != "" {
+		testCmd = "$env:" + bitLockerEnvVar + "=" + e2ef.PowerShellString(vm.bitLocker) + "; " + testCmd
+	}
+	// WMCB attaches the run context to its log lines and spans
+	testCmd = "$env:" + e2ef.RunContextEnvVar + "=" + e2ef.PowerShellString(e2ef.RunContextOf(vm).String()) + "; " +
+		testCmd
+	stdout, stderr, err := vm.Run(e2ef.PowerShellScript(testCmd), true)
 
 	// Logging the output so that it is visible on the CI page
 	log.Printf("\n%s\n", stdout)
@@ -147,6 +212,7 @@ func (vm *wmcbVM) runTestBootstrapper(t *testing.T) {
 	err := vm.initializeTestBootstrapperFiles()
 	require.NoError(t, err, "error initializing files required for TestBootstrapper")
 
+	e2ef.RecordWMCBInvoked(vm.GetCredentials().GetIPAddress())
 	err = vm.runTest(e2eExecutable + " --test.run TestBootstrapper --test.v")
 	require.NoError(t, err, "TestBootstrapper failed")
 }
@@ -163,7 +229,7 @@ func (vm *wmcbVM) runTestConfigureCNI(t *testing.T) {
 	require.NoError(t, err, "unable to handle hybrid-overlay")
 
 	// It is guaranteed that the hybrid overlay annotations are present as we have already checked for it
-	hybridOverlayAnnotation := node.GetAnnotations()[test.HybridOverlaySubnet]
+	hybridOverlayAnnotation := node.GetAnnotations()[e2ef.HybridOverlaySubnet]
 	err = vm.initializeTestConfigureCNIFiles(hybridOverlayAnnotation)
 	require.NoError(t, err, "error initializing files required for TestConfigureCNI")
 
@@ -180,19 +246,29 @@ func (vm *wmcbVM) initializeTestBootstrapperFiles() error {
 	}
 
 	// Download and extract the kube package on the VM
-	err = vm.remoteDownloadExtract(kubeNode, remoteDir+"kube.tar.gz", remoteDir)
+	err = vm.remoteDownloadExtract(kubeNode, remotepath.WindowsPathJoin(remoteDir, "kube.tar.gz"), remoteDir)
 	if err != nil {
 		return fmt.Errorf("unable to download kube package: %v", err)
 	}
 
 	// Copy kubelet.exe to C:\Windows\Temp\
-	_, _, err = vm.Run("cp "+remoteDir+"kubernetes\\node\\bin\\kubelet.exe "+winTemp, true)
+	_, _, err = vm.Run(e2ef.PowerShellScript("Copy-Item -Path "+
+		e2ef.PowerShellString(remotepath.WindowsPathJoin(remoteDir, "kubernetes", "node", "bin", "kubelet.exe"))+
+		" -Destination "+
+		e2ef.PowerShellString(winTemp)), true)
 	if err != nil {
 		return fmt.Errorf("unable to copy kubelet.exe to %s", winTemp)
 	}
 
-	// Download the worker ignition to C:\Windows\Tenp\ using the script that ignores the server cert
-	_, _, err = vm.Run(wgetIgnoreCertCmd+" -server https://api-int."+e2ef.ClusterAddress+":22623/config/worker"+" -output "+winTemp+"worker.ign", true)
+	// Download the worker ignition to C:\Windows\Tenp\ using the script that ignores the server cert. It is served
+	// by the machine config server, or by the ignition server of the control plane of a hosted cluster.
+	ignitionURL, headers, err := framework.WorkerIgnitionEndpoint()
+	if err != nil {
+		return fmt.Errorf("unable to get the worker ignition endpoint: %v", err)
+	}
+	_, _, err = vm.Run(e2ef.PowerShellScript("& "+e2ef.PowerShellString(wgetIgnoreCertCmd)+" -server "+
+		e2ef.PowerShellString(ignitionURL)+headersArg(headers)+" -output "+
+		e2ef.PowerShellString(remotepath.WindowsPathJoin(winTemp, "worker.ign"))), true)
 	if err != nil {
 		return fmt.Errorf("unable to download worker.ign: %v", err)
 	}
@@ -200,20 +276,40 @@ func (vm *wmcbVM) initializeTestBootstrapperFiles() error {
 	return nil
 }
 
-// remoteDownload downloads the tar file in url to the remoteDownloadFile location and checks if the SHA matches
+// headersArg returns the -headers argument of the wget-ignore-cert.ps1 script for the given HTTP headers, or an empty
+// string if there are none
+func headersArg(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	var entries []string
+	for name, value := range headers {
+		entries = append(entries, e2ef.PowerShellString(name)+"="+e2ef.PowerShellString(value))
+	}
+	sort.Strings(entries)
+	return " -headers @{" + strings.Join(entries, ";") + "}"
+}
+
+// remoteDownload downloads the package to the remoteDownloadFile location and checks if the SHA matches
 func (vm *wmcbVM) remoteDownload(pkg pkgInfo, remoteDownloadFile string) error {
-	_, stderr, err := vm.Run("if (!(Test-Path "+remoteDownloadFile+")) { wget "+pkg.url+" -o "+remoteDownloadFile+" }",
-		true)
+	err := framework.FetchPayloadArtifact(vm, pkg.source, pkg.name, remoteDownloadFile)
 	if err != nil {
-		return fmt.Errorf("unable to download %s: %v\n%s", pkg.url, err, stderr)
+		return err
 	}
 
 	if pkg.sha == "" {
-		return nil
+		source, ok := framework.PayloadSource(pkg.source).(e2ef.ChecksumPayloadSource)
+		if !ok {
+			return nil
+		}
+		if pkg.sha, err = source.SHA256(pkg.name); err != nil {
+			return fmt.Errorf("unable to get %s SHA: %v", pkg.name, err)
+		}
+		pkg.shaType = "sha256"
 	}
 
 	// Perform a checksum check
-	stdout, _, err := vm.Run("certutil -hashfile "+remoteDownloadFile+" "+pkg.shaType, true)
+	stdout, _, err := vm.Run(e2ef.CmdLine("certutil", "-hashfile", remoteDownloadFile, pkg.shaType), false)
 	if err != nil {
 		return fmt.Errorf("unable to check SHA of %s: %v", remoteDownloadFile, err)
 	}
@@ -230,11 +326,11 @@ func (vm *wmcbVM) remoteDownloadExtract(pkg pkgInfo, remoteDownloadFile, remoteE
 	// Download the file from the URL
 	err := vm.remoteDownload(pkg, remoteDownloadFile)
 	if err != nil {
-		return fmt.Errorf("unable to download %s: %v", pkg.url, err)
+		return fmt.Errorf("unable to download %s: %v", pkg.name, err)
 	}
 
 	// Extract files from the archive
-	_, stderr, err := vm.Run("tar -xf "+remoteDownloadFile+" -C "+remoteExtractDir, true)
+	_, stderr, err := vm.Run(e2ef.CmdLine("tar", "-xf", remoteDownloadFile, "-C", remoteExtractDir), false)
 	if err != nil {
 		return fmt.Errorf("unable to extract %s: %v\n%s", remoteDownloadFile, err, stderr)
 	}
@@ -249,13 +345,8 @@ func (vm *wmcbVM) initializeTestConfigureCNIFiles(ovnHostSubnet string) error {
 		return fmt.Errorf("unable to create remote directory %s: %v\n%s", remoteDir, err, stderr)
 	}
 
-	cniUrl, err := url.Parse(cniPlugins.url)
-	if err != nil {
-		return fmt.Errorf("error parsing %s: %v", cniPlugins.url, err)
-	}
-
 	// Download and extract the CNI binaries on the Windows VM
-	err = vm.remoteDownloadExtract(cniPlugins, remoteDir+path.Base(cniUrl.Path), winCNIDir)
+	err = vm.remoteDownloadExtract(cniPlugins, remotepath.WindowsPathJoin(remoteDir, cniPlugins.name), winCNIDir)
 	if err != nil {
 		return fmt.Errorf("unable to download CNI package: %v", err)
 	}
@@ -276,25 +367,15 @@ func (vm *wmcbVM) initializeTestConfigureCNIFiles(ovnHostSubnet string) error {
 
 // initializeHybridOverlayBinary creates the files on the Windows node needed for running "configure-cni"
 func (vm *wmcbVM) initializeHybridOverlayBinary() error {
-	hybridOverlayURL, err := framework.GetReleaseArtifactURL(hybridOverlayName)
-	if err != nil {
-		return fmt.Errorf("unable to get %s URL: %v", hybridOverlayName, err)
-	}
-
-	hybridOverlaySHA, err := framework.GetReleaseArtifactSHA(hybridOverlayName)
-	if err != nil {
-		return fmt.Errorf("unable to get %s SHA: %v", hybridOverlayName, err)
-	}
-
+	// The SHA of the hybrid overlay is the one published with the WMCB release
 	hybridOverlay := pkgInfo{
-		url:     hybridOverlayURL,
-		sha:     hybridOverlaySHA,
-		shaType: "sha256",
+		name:   hybridOverlayName,
+		source: framework.WMCBPayload,
 	}
 
-	err = vm.remoteDownload(hybridOverlay, hybridOverlayExecutable)
+	err := vm.remoteDownload(hybridOverlay, hybridOverlayExecutable)
 	if err != nil {
-		return fmt.Errorf("unable to download %s on VM: %s", hybridOverlayURL, err)
+		return fmt.Errorf("unable to download %s on VM: %s", hybridOverlayName, err)
 	}
 	return nil
 }
@@ -302,7 +383,7 @@ func (vm *wmcbVM) initializeHybridOverlayBinary() error {
 // handleHybridOverlay ensures that the hybrid overlay is running on the node
 func (vm *wmcbVM) handleHybridOverlay(nodeName string) error {
 	// Check if the hybrid-overlay is running
-	_, stderr, err := vm.Run("Get-Process -Name \"hybrid-overlay\"", true)
+	_, stderr, err := vm.Run(e2ef.PowerShellScript("Get-Process -Name 'hybrid-overlay'"), true)
 
 	// stderr being empty implies that an hybrid-overlay was running. This is to help with local development.
 	if err == nil || stderr == "" {
@@ -323,8 +404,8 @@ func (vm *wmcbVM) handleHybridOverlay(nodeName string) error {
 	// Start the hybrid-overlay in the background over ssh. We cannot use vm.Run() and by extension WinRM.Run() here as
 	// we observed WinRM.Run() returning before the commands completes execution. The reason for that is unclear and
 	// requires further investigation.
-	go vm.RunOverSSH(hybridOverlayExecutable+" --node "+nodeName+
-		" --k8s-kubeconfig c:\\k\\kubeconfig > "+kLog+"hybrid-overlay.log 2>&1", false)
+	go vm.RunOverSSH(e2ef.CmdLine(hybridOverlayExecutable, "--node", nodeName, "--k8s-kubeconfig", "c:\\k\\kubeconfig")+
+		" > "+e2ef.CmdArg(remotepath.WindowsPathJoin(kLog, "hybrid-overlay.log"))+" 2>&1", false)
 
 	err = vm.waitForHybridOverlayToRun()
 	if err != nil {
@@ -347,39 +428,38 @@ func (vm *wmcbVM) handleHybridOverlay(nodeName string) error {
 // waitForOpenShiftHSNNetworks waits for the OpenShift HNS networks to be created until the timeout is reached
 func (vm *wmcbVM) waitForOpenShiftHNSNetworks() error {
 	var stdout string
-	var err error
-	for retries := 0; retries < e2ef.RetryCount; retries++ {
-		stdout, _, err = vm.Run("Get-HnsNetwork", true)
-		if err != nil {
-			// retry
-			continue
-		}
-
-		if strings.Contains(stdout, "BaseOpenShiftNetwork") &&
-			strings.Contains(stdout, "OpenShiftNetwork") {
+	err := e2ef.Retry("wait for OpenShift HNS networks", vm.GetCredentials().GetIPAddress(), e2ef.RetryCount,
+		e2ef.RetryInterval, func() error {
+			var err error
+			stdout, _, err = vm.Run(e2ef.PowerShellScript("Get-HnsNetwork"), true)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(stdout, "BaseOpenShiftNetwork") || !strings.Contains(stdout, "OpenShiftNetwork") {
+				return fmt.Errorf("OpenShift HNS networks not found")
+			}
 			return nil
-		}
-		time.Sleep(e2ef.RetryInterval)
+		})
+	if err != nil {
+		// OpenShift HNS networks were not found
+		log.Printf("Get-HnsNetwork:\n%s", stdout)
+		return fmt.Errorf("timeout waiting for OpenShift HNS networks: %v", err)
 	}
-
-	// OpenShift HNS networks were not found
-	log.Printf("Get-HnsNetwork:\n%s", stdout)
-	return fmt.Errorf("timeout waiting for OpenShift HNS networks: %v", err)
+	return nil
 }
 
 // waitForHybridOverlayToRun waits for the hybrid-overlay.exe to run until the timeout is reached
 func (vm *wmcbVM) waitForHybridOverlayToRun() error {
-	var err error
-	for retries := 0; retries < e2ef.RetryCount; retries++ {
-		_, _, err = vm.Run("Get-Process -Name \"hybrid-overlay\"", true)
-		if err == nil {
-			return nil
-		}
-		time.Sleep(e2ef.RetryInterval)
+	err := e2ef.Retry("wait for hybrid-overlay", vm.GetCredentials().GetIPAddress(), e2ef.RetryCount,
+		e2ef.RetryInterval, func() error {
+			_, _, err := vm.Run(e2ef.PowerShellScript("Get-Process -Name 'hybrid-overlay'"), true)
+			return err
+		})
+	if err != nil {
+		// hybrid-overlay never started running
+		return fmt.Errorf("timeout waiting for hybrid-overlay: %v", err)
 	}
-
-	// hybrid-overlay never started running
-	return fmt.Errorf("timeout waiting for hybrid-overlay: %v", err)
+	return nil
 }
 
 // approve approves the given CSR if it has not already been approved
@@ -492,7 +572,7 @@ func handleCSRs() error {
 
 // mkdirCmd returns the Windows command to create a directory if it does not exists
 func mkdirCmd(dirName string) string {
-	return "if not exist " + dirName + " mkdir " + dirName
+	return "if not exist " + e2ef.CmdArg(dirName) + " mkdir " + e2ef.CmdArg(dirName)
 }
 
 // createCNIConf create the local cni.conf and returns its path
@@ -580,37 +660,33 @@ func waitForHybridOverlayAnnotation(nodeName string) error {
 		if err != nil {
 			return fmt.Errorf("error getting node %s: %v", nodeName, err)
 		}
-		_, found := node.Annotations[test.HybridOverlaySubnet]
+		_, found := node.Annotations[e2ef.HybridOverlaySubnet]
 		if found {
 			return nil
 		}
 		time.Sleep(e2ef.RetryInterval)
 	}
-	return fmt.Errorf("timeout waiting for %s node annotation", test.HybridOverlaySubnet)
+	return fmt.Errorf("timeout waiting for %s node annotation", e2ef.HybridOverlaySubnet)
 }
 
 // hasWindowsTaint returns true if the given Windows node has the Windows taint
-func hasWindowsTaint(winNodes []v1.Node) bool {
-	// We've just created one Windows node as part of our CI suite. So, it's ok to return instead of checking for all
-	// the items in the node
-	for _, node := range winNodes {
-		for _, taint := range node.Spec.Taints {
-			if taint.Key == windowsTaint.Key && taint.Value == windowsTaint.Value && taint.Effect == windowsTaint.Effect {
-				return true
-			}
+func hasWindowsTaint(node *v1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == windowsTaint.Key && taint.Value == windowsTaint.Value && taint.Effect == windowsTaint.Effect {
+			return true
 		}
 	}
 	return false
 }
 
-// testWMCBCluster runs the cluster tests for the nodes
-func testWMCBCluster(t *testing.T) {
-	// TODO: Fix this test for multiple VMs
-	client := framework.K8sclientset
-	winNodes, err := client.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: "kubernetes.io/os=windows"})
-	require.NoErrorf(t, err, "error while getting Windows node: %v", err)
-	assert.Equal(t, hasWindowsTaint(winNodes.Items), true, "expected Windows Taint to be present on the Windows Node")
-	winNodes, err = client.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: e2ef.WindowsLabel})
-	require.NoErrorf(t, err, "error while getting Windows node: %v", err)
-	assert.Lenf(t, winNodes.Items, 1, "expected one node to have node label but found: %v", len(winNodes.Items))
+// testWMCBCluster runs the cluster tests for the node of the VM
+func (vm *wmcbVM) testWMCBCluster(t *testing.T) {
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "unable to get node object for VM")
+	assert.Equal(t, "windows", node.GetLabels()["kubernetes.io/os"], "expected node to be a Windows node")
+	assert.True(t, hasWindowsTaint(node), "expected Windows Taint to be present on the Windows Node")
+	labelKV := strings.SplitN(e2ef.WindowsLabel, "=", 2)
+	assert.Equal(t, labelKV[1], node.GetLabels()[labelKV[0]], "expected %s label to be present on the Windows node",
+		e2ef.WindowsLabel)
+	assert.NoError(t, e2ef.VerifyNodeMetadata(vm, node), "node registered with unexpected metadata")
 }
@@ -2,20 +2,27 @@ package wsu
 
 import (
 	"flag"
-	e2ef "github.com/openshift/windows-machine-config-bootstrapper/internal/test/framework"
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
 	"log"
 	"os"
 	"testing"
 )
 
 var (
-	// Initialize wsuFramework which specializes TestFramework by adding some properties specific to WSU tests
-	framework = wsuFramework{}
+	// Initialize wsuFramework which specializes TestFramework by adding some properties specific to WSU tests. The
+	// TestFramework is created upfront for the flags to be bound to its fields.
+	framework = wsuFramework{TestFramework: &e2ef.TestFramework{}}
 	// TODO: expose this to the end user as a command line flag
 	// vmCount is the number of VMs the test suite requires
 	// Bring up 2 vms to test wsu run with automatic download of WMCB based on cluster version as well as built from
 	// source version
 	vmCount = 2
+	// hypervIsolation runs the WSU with Hyper-V isolation and tests running a Hyper-V isolated pod. The VMs need nested
+	// virtualization for this, e.g. a metal instance type on AWS.
+	hypervIsolation bool
+	// ipFamily is the IP family the WSU bootstraps the nodes with, ipv4, ipv6 or dual. Empty lets the kubelet pick the
+	// node IP. IPv6 pod traffic is tested for ipv6 and dual, which requires a cluster with IPv6 networks.
+	ipFamily string
 )
 
 func TestMain(m *testing.M) {
@@ -24,6 +31,20 @@ func TestMain(m *testing.M) {
 
 	flag.Var(&vmCreds, "vmCreds", "List of VM credentials")
 	flag.BoolVar(&skipVMSetup, "skipVMSetup", false, "Option to disable setup in the VMs")
+	framework.Inputs.RegisterFlags(flag.CommandLine)
+	flag.Var(&framework.ArtifactSinks, "artifactSinks", "Comma separated list of directories, s3://<bucket>/<prefix> "+
+		"and gs://<bucket>/<prefix> locations the artifacts are stored in at the end of the run. Defaults to "+
+		"E2E_ARTIFACT_SINKS")
+	flag.Var(&framework.Notifiers, "notify", "Comma separated list of webhook URLs, Slack incoming webhooks or "+
+		"endpoints receiving JSON, notified of the creation, bootstrap and teardown of the VMs. Defaults to "+
+		"E2E_NOTIFY")
+	flag.Var(&framework.SSHKeys, "sshKeys", "Comma separated list of <key pair name>=<private key path> key pairs "+
+		"the VMs are created with in turn, and generated for a key pair generated for the run. Defaults to "+
+		"E2E_SSH_KEYS")
+	flag.BoolVar(&hypervIsolation, "hypervIsolation", false,
+		"Option to configure the VMs for Hyper-V isolation, requires nested virtualization")
+	flag.StringVar(&ipFamily, "ipFamily", "",
+		"IP family of the nodes, ipv4, ipv6 or dual. Defaults to letting the kubelet pick the node IP")
 	flag.Parse()
 
 	err := framework.Setup(vmCount, vmCreds, skipVMSetup)
@@ -33,7 +54,10 @@ func TestMain(m *testing.M) {
 	}
 	testStatus := m.Run()
 	// Retrieve artifacts after running the test
-	framework.RetrieveArtifacts()
+	if err := framework.RetrieveArtifacts(); err != nil {
+		// Missing artifacts do not fail the run, they are reported for the failures to be investigated
+		log.Print(err)
+	}
 	// TODO: Add one more check to remove lingering cloud resources
 	framework.TearDown()
 	os.Exit(testStatus)
@@ -1,9 +1,12 @@
 package wsu
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -13,8 +16,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/openshift/windows-machine-config-bootstrapper/internal/test"
-	e2ef "github.com/openshift/windows-machine-config-bootstrapper/internal/test/framework"
+	e2ef "github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -37,6 +40,10 @@ var (
 	windowsServerImage = "mcr.microsoft.com/windows/servercore:ltsc2019"
 	// ubi8Image is the name/location of the linux image we will use for testing
 	ubi8Image = "registry.access.redhat.com/ubi8/ubi:latest"
+	// isolationAnnotation is the pod annotation requesting the isolation of its Windows containers
+	isolationAnnotation = "experimental.windows.kubernetes.io/isolation-type"
+	// wsuTimeout is the time the WSU playbook is given to bootstrap a VM, shrunk to stay within the job deadline
+	wsuTimeout = 45 * time.Minute
 )
 
 type wsuFramework struct {
@@ -49,7 +56,10 @@ type wsuFramework struct {
 
 // Setup initializes the wsuFramework.
 func (f *wsuFramework) Setup(vmCount int, credentials []*types.Credentials, skipVMsetup bool) error {
-	f.TestFramework = &e2ef.TestFramework{}
+	// The TestFramework holds the values of the flags, it is only created here when none was
+	if f.TestFramework == nil {
+		f.TestFramework = &e2ef.TestFramework{}
+	}
 
 	// If vmCount is 3 and vmCountWithBuiltWMCB is 2, 2 VMs will run WSU that will build WMCB and 1 VM will
 	// auto-download the latest WMCB based on the cluster version
@@ -105,7 +115,7 @@ ansible_winrm_server_cert_validation=ignore
 
 // TestWSU creates a Windows instance, runs the WSU, and then runs a series of tests to ensure all expected
 // behavior was achieved. The following environment variables must be set for this test to run: KUBECONFIG,
-// AWS_SHARED_CREDENTIALS_FILE, ARTIFACT_DIR, KUBE_SSH_KEY_PATH, WSU_PATH, CLUSTER_ADDR
+// AWS_SHARED_CREDENTIALS_FILE, ARTIFACT_DIR, WSU_PATH, CLUSTER_ADDR
 func TestWSU(t *testing.T) {
 	require.NotEmptyf(t, playbookPath, "WSU_PATH environment variable not set")
 
@@ -199,8 +209,6 @@ func captureWSULogs(wsuOut []byte, vm e2ef.WindowsVM, logFileName string) {
 
 // runWSU runs the WSU playbook against a VM. Returns WSU stdout
 func runWSU(vm e2ef.WindowsVM) ([]byte, error) {
-	var ansibleCmd *exec.Cmd
-
 	// In order to run the ansible playbook we create an inventory file:
 	// https://docs.ansible.com/ansible/latest/user_guide/intro_inventory.html
 	hostFilePath, err := createHostFile([]e2ef.WindowsVM{vm})
@@ -209,17 +217,39 @@ func runWSU(vm e2ef.WindowsVM) ([]byte, error) {
 	}
 
 	// Run the WSU against the VM
+	args := []string{"-v", "-i", hostFilePath, playbookPath}
 	if vm.BuildWMCB() {
 		// Build WMCB
-		ansibleCmd = exec.Command("ansible-playbook", "-v", "-i", hostFilePath, playbookPath, "-e",
-			"{build_wmcb: True}")
-	} else {
-		// Download latest released version of WMCB based on cluster version
-		ansibleCmd = exec.Command("ansible-playbook", "-v", "-i", hostFilePath, playbookPath)
+		args = append(args, "-e", "{build_wmcb: True}")
+	}
+	// Otherwise the latest released version of WMCB based on cluster version is downloaded
+	if hypervIsolation {
+		args = append(args, "-e", "{container_isolation: hyperv}")
+	}
+	if ipFamily != "" {
+		args = append(args, "-e", "ip_family="+ipFamily)
 	}
+	args = append(args, "-e", "container_runtime="+e2ef.ContainerRuntime)
+	// Make the spans of the WMCB commands run by the playbook part of the test suite trace
+	if traceParent := e2ef.TraceParent(); traceParent != "" {
+		args = append(args, "-e", "traceparent="+traceParent)
+	}
+	// The playbook is killed if it runs into the time reserved for the tests and the teardown
+	ctx, cancel := context.WithTimeout(context.Background(), e2ef.Timeout(e2ef.BootstrapPhase, wsuTimeout))
+	defer cancel()
+	ansibleCmd := exec.CommandContext(ctx, "ansible-playbook", args...)
 
+	// The playbook invokes WMCB once the files are copied, which is when the node joins
+	e2ef.RecordWMCBInvoked(vm.GetCredentials().GetIPAddress())
 	// Run the playbook
-	wsuOut, err := ansibleCmd.CombinedOutput()
+	var wsuOut []byte
+	err = e2ef.Phase("run WSU", func() error {
+		wsuOut, err = ansibleCmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("WSU playbook timed out: %v", err)
+		}
+		return err
+	})
 	return wsuOut, err
 }
 
@@ -261,10 +291,15 @@ func runE2ETestSuite(t *testing.T, vm e2ef.WindowsVM, ansibleOutput string) {
 	}
 	t.Run("Node is in ready state", func(t *testing.T) {
 		testNodeReady(t, node)
+		assert.NoError(t, e2ef.RecordNodeReady(vm.GetCredentials().GetIPAddress(), node),
+			"node did not become Ready in time")
 	})
 	t.Run("Check if worker label has been applied to the Windows node", func(t *testing.T) {
 		testWorkerLabelsArePresent(t, node)
 	})
+	t.Run("Node metadata matches the VM", func(t *testing.T) {
+		testNodeMetadata(t, vm)
+	})
 	t.Run("Network annotations were applied to node", func(t *testing.T) {
 		testHybridOverlayAnnotations(t, node)
 	})
@@ -274,12 +309,136 @@ func runE2ETestSuite(t *testing.T, vm e2ef.WindowsVM, ansibleOutput string) {
 	t.Run("Check cni config generated on the Windows host", func(t *testing.T) {
 		testCNIConfig(t, node, vm, tempDirPath)
 	})
+	t.Run("Required ports are open", func(t *testing.T) {
+		testPortMatrix(t, vm)
+	})
 	t.Run("East-west networking", func(t *testing.T) {
 		testEastWestNetworking(t, node, vm)
 	})
 	t.Run("North-south networking", func(t *testing.T) {
 		testNorthSouthNetworking(t, node, vm)
 	})
+	t.Run("Hyper-V isolated pod", func(t *testing.T) {
+		testHyperVIsolatedPod(t, node, vm)
+	})
+	t.Run("IPv6 pod traffic", func(t *testing.T) {
+		testIPv6PodTraffic(t, node, vm)
+	})
+	t.Run("Pulls follow the registry mirrors", func(t *testing.T) {
+		testRegistryMirrors(t, vm)
+	})
+}
+
+// testRegistryMirrors checks that the registry mirrors of the ImageContentSourcePolicies of the cluster were
+// configured on the node by pulling the mirrored image given by E2E_MIRRORED_IMAGE with its source registry
+// blackholed, as it is unreachable in a disconnected cluster
+func testRegistryMirrors(t *testing.T, vm e2ef.WindowsVM) {
+	image := e2ef.MirroredImage()
+	if image == "" {
+		t.Skip("no mirrored image given")
+	}
+	mirrors, err := framework.RegistryMirrors()
+	require.NoError(t, err, "could not get the registry mirrors of the cluster")
+	if len(mirrors) == 0 {
+		t.Skip("the cluster has no registry mirrors")
+	}
+	blockedHosts := e2ef.SourceRegistryHosts(image, mirrors)
+	require.NotEmpty(t, blockedHosts, "%s is not mirrored by the ImageContentSourcePolicies of the cluster", image)
+	assert.NoError(t, e2ef.PullImageFromMirror(vm, image, blockedHosts), "could not pull %s from the mirrors", image)
+}
+
+// testPortMatrix checks that the Windows Firewall and the security groups of the node allow the ports of the port
+// matrix of the Windows nodes. The drift is written to the artifact directory, as a closed VXLAN or kubelet port
+// leaves the node half working and makes the later networking tests fail in misleading ways.
+func testPortMatrix(t *testing.T, vm e2ef.WindowsVM) {
+	drifts, err := e2ef.CheckPortMatrix(vm)
+	require.NoError(t, err, "could not check the port matrix")
+	out, err := json.MarshalIndent(drifts, "", "  ")
+	require.NoError(t, err)
+	if err = framework.WriteToArtifactDir(out, vm.GetImage().Version,
+		"port-drift-"+vm.GetCredentials().GetInstanceId()+".json"); err != nil {
+		log.Printf("could not write the port drift: %v", err)
+	}
+	for _, drift := range drifts {
+		t.Errorf("required port not open: %s", drift)
+	}
+}
+
+// testIPv6PodTraffic checks that an IPv6 or dual-stack node registered with an IPv6 address and that a Windows web
+// server pod on the node is reachable over IPv6 from a Linux pod
+func testIPv6PodTraffic(t *testing.T, node *v1.Node, vm e2ef.WindowsVM) {
+	if ipFamily != "ipv6" && ipFamily != "dual" {
+		t.Skip("the nodes are not bootstrapped with IPv6")
+	}
+	// The node object passed to the tests is the one read before the tests, which has the registered addresses
+	var nodeIPv6 string
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP && strings.Contains(address.Address, ":") {
+			nodeIPv6 = address.Address
+		}
+	}
+	assert.NotEmpty(t, nodeIPv6, "node registered without an IPv6 address: %v", node.Status.Addresses)
+	if nodeIPv6 != "" {
+		assertNodeIPSelected(t, vm, nodeIPv6)
+	}
+
+	affinity, err := getAffinityForNode(node)
+	require.NoError(t, err, "could not get affinity for node")
+	name := e2ef.RunScopedName("win-webserver-ipv6-" + vm.GetCredentials().GetInstanceId())
+	deployment, err := deployWindowsWebServer(name, vm, affinity)
+	require.NoError(t, err, "could not create Windows Server deployment")
+	defer deleteDeployment(deployment.Name)
+
+	podIPv6, err := getPodIPv6(*deployment.Spec.Selector)
+	require.NoError(t, err, "could not get the IPv6 address of the Windows web server pod")
+	curlCommand := []string{"bash", "-c", "yum update; yum install curl -y; curl -6 -g http://[" + podIPv6 + "]"}
+	job, err := createLinuxJob(e2ef.RunScopedName("linux-curler-ipv6-"+vm.GetCredentials().GetInstanceId()),
+		curlCommand)
+	require.NoError(t, err, "could not create Linux job")
+	defer deleteJob(job.Name)
+	err = waitUntilJobSucceeds(job.Name)
+	assert.NoError(t, err, "could not curl the Windows web server over IPv6 from a Linux container")
+}
+
+// testHyperVIsolatedPod runs a Hyper-V isolated Windows Server job on the node and checks that its container was
+// created with Hyper-V isolation
+func testHyperVIsolatedPod(t *testing.T, node *v1.Node, vm e2ef.WindowsVM) {
+	if !hypervIsolation {
+		t.Skip("Hyper-V isolation is not enabled")
+	}
+	// The isolation of the containers is only inspected through the Docker API
+	if e2ef.ContainerRuntime != e2ef.DockerRuntime {
+		t.Skipf("Hyper-V isolation is not verified with the %s container runtime", e2ef.ContainerRuntime)
+	}
+	affinity, err := getAffinityForNode(node)
+	require.NoError(t, err, "could not get affinity for node")
+
+	name := e2ef.RunScopedName("hyperv-" + vm.GetCredentials().GetInstanceId())
+	job, err := createJob(name, windowsServerImage, []string{"cmd.exe", "/c", "ver"},
+		map[string]string{"beta.kubernetes.io/os": "windows"},
+		[]v1.Toleration{{Key: "os", Value: "Windows", Effect: v1.TaintEffectNoSchedule}},
+		func(spec *v1.PodTemplateSpec) {
+			spec.Annotations = map[string]string{isolationAnnotation: "hyperv"}
+			spec.Spec.Affinity = affinity
+		})
+	require.NoError(t, err, "could not create Hyper-V isolated job")
+	defer deleteJob(job.Name)
+	err = waitUntilJobSucceeds(job.Name)
+	require.NoError(t, err, "Hyper-V isolated job did not succeed")
+
+	// Exited containers are kept by the kubelet until the pod is deleted. The pods of the previous WSU runs may still
+	// be around, so all the containers of the job are checked.
+	stdout, _, err := vm.Run(e2ef.CmdLine("docker", "ps", "-a", "-q", "--filter",
+		"label=io.kubernetes.container.name="+name), false)
+	require.NoError(t, err, "could not list the containers of the job")
+	containerIDs := strings.Fields(stdout)
+	require.NotEmpty(t, containerIDs, "container of the job not found")
+	for _, containerID := range containerIDs {
+		isolation, _, err := vm.Run(e2ef.CmdLine("docker", "inspect", "--format", "{{.HostConfig.Isolation}}",
+			containerID), false)
+		require.NoError(t, err, "could not inspect container %s of the job", containerID)
+		assert.Equal(t, "hyperv", strings.TrimSpace(isolation), "container %s is not Hyper-V isolated", containerID)
+	}
 }
 
 // testDownloadedWMCB checks if the task 'Download WMCB' in the Ansible output was executed, not skipped
@@ -313,7 +472,7 @@ func testCNIConfig(t *testing.T, node *v1.Node, vm e2ef.WindowsVM, ansibleTempDi
 	require.NoError(t, err, "Could not get CNI config contents")
 
 	// By the time, we reach here the annotation should be present, so need to validate again
-	hostSubnet := node.Annotations[test.HybridOverlaySubnet]
+	hostSubnet := node.Annotations[e2ef.HybridOverlaySubnet]
 	// Check if the host subnet matches our expected value
 	assert.Contains(t, cniConfigFileContents, hostSubnet, "CNI config does not contain host subnet")
 
@@ -334,9 +493,9 @@ func testFilesCopied(t *testing.T, vm e2ef.WindowsVM, ansibleTempDir string) {
 
 	// Check if each of the files we expect on the Windows host are there
 	for _, filename := range expectedFileList {
-		fullPath := ansibleTempDir + "\\" + filename
+		fullPath := remotepath.WindowsPathJoin(ansibleTempDir, filename)
 		// This command will write to stdout, only if the file we are looking for does not exist
-		command := fmt.Sprintf("if not exist %s echo fail", fullPath)
+		command := "if not exist " + e2ef.CmdArg(fullPath) + " echo fail"
 		stdout, _, err := vm.Run(command, false)
 		assert.NoError(t, err, "Error looking for %s: %s", fullPath, err)
 		assert.Emptyf(t, stdout, "Missing file: %s", fullPath)
@@ -379,24 +538,34 @@ func testWorkerLabelsArePresent(t *testing.T, node *v1.Node) {
 		"expected worker label to be present on the Windows node but did not find any")
 }
 
+// testNodeMetadata asserts that the node of the VM registered with the labels, addresses, provider ID and capacity
+// expected from the VM on its platform
+func testNodeMetadata(t *testing.T, vm e2ef.WindowsVM) {
+	// The addresses and capacity are reported once the node is Ready
+	node, err := framework.GetNode(vm.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "Could not get Windows node object")
+	assert.NoError(t, e2ef.VerifyNodeMetadata(vm, node), "node registered with unexpected metadata")
+}
+
 // readRemoteFile returns the contents of a remote file. Returns an error on winRM failure, or if it does not exist.
 func readRemoteFile(fileName string, vm e2ef.WindowsVM) (string, error) {
-	stdout, _, err := vm.Run("cat "+fileName, true)
+	stdout, _, err := vm.Run(e2ef.PowerShellScript("Get-Content -Path "+e2ef.PowerShellString(fileName)), true)
 	if err != nil {
-		return "", fmt.Errorf("WinRM failure trying to run cat: %s", err)
+		return "", fmt.Errorf("WinRM failure trying to read %s: %s", fileName, err)
 	}
 	return stdout, nil
 }
 
 // testHybridOverlayAnnotations tests that the correct annotations have been added to the bootstrapped node
 func testHybridOverlayAnnotations(t *testing.T, node *v1.Node) {
-	assert.Contains(t, node.Annotations, test.HybridOverlaySubnet)
+	assert.Contains(t, node.Annotations, e2ef.HybridOverlaySubnet)
 	assert.Contains(t, node.Annotations, hybridOverlayMac)
+	assert.NoError(t, e2ef.CheckNodeSubnets([]v1.Node{*node}))
 }
 
 // testHNSNetworksCreated tests that the required HNS Networks have been created on the bootstrapped node
 func testHNSNetworksCreated(t *testing.T, vm e2ef.WindowsVM) {
-	stdout, _, err := vm.Run("Get-HnsNetwork", true)
+	stdout, _, err := vm.Run(e2ef.PowerShellScript("Get-HnsNetwork"), true)
 	require.NoError(t, err, "Could not run Get-HnsNetwork command")
 	assert.Contains(t, stdout, "Name                   : BaseOpenShiftNetwork",
 		"Could not find BaseOpenShiftNetwork in list of HNS Networks")
@@ -448,21 +617,27 @@ func testEastWestNetworking(t *testing.T, node *v1.Node, vm e2ef.WindowsVM) {
 	require.NoError(t, err, "Could not get affinity for node")
 
 	// Deploy a webserver pod on the new node
-	winServerDeployment, err := deployWindowsWebServer("win-webserver-"+vm.GetCredentials().GetInstanceId(), vm, affinity)
+	winServerDeployment, err := deployWindowsWebServer(e2ef.RunScopedName("win-webserver-"+vm.GetCredentials().GetInstanceId()),
+		vm, affinity)
 	require.NoError(t, err, "Could not create Windows Server deployment")
 	defer deleteDeployment(winServerDeployment.Name)
 
 	// Get the pod so we can use its IP
-	winServerIP, err := getPodIP(*winServerDeployment.Spec.Selector)
+	winServerPod, err := getPod(*winServerDeployment.Spec.Selector)
 	require.NoError(t, err, "Could not retrieve pod with selector %v", *winServerDeployment.Spec.Selector)
+	winServerIP := winServerPod.Status.PodIP
+	e2ef.RecordPodRunning(winServerPod)
+	// A pod IP outside the subnet of the node fails the connections below in a way that does not point at the cause
+	require.NoError(t, framework.CheckPodIPs(node.Name), "Windows pods did not get IPs from the subnet of the node")
 
 	// test Windows <-> Linux
 	// This will install curl and then curl the windows server.
 	// TODO: This delay was added to work around a bug in OVN
 	//       Remove this sleep once https://bugzilla.redhat.com/show_bug.cgi?id=1789881 is fixed
-	time.Sleep(time.Minute * 10)
+	time.Sleep(e2ef.Timeout(e2ef.TestsPhase, time.Minute*10))
 	linuxCurlerCommand := []string{"bash", "-c", "yum update; yum install curl -y; curl " + winServerIP}
-	linuxCurlerJob, err := createLinuxJob("linux-curler-"+vm.GetCredentials().GetInstanceId(), linuxCurlerCommand)
+	linuxCurlerJob, err := createLinuxJob(e2ef.RunScopedName("linux-curler-"+vm.GetCredentials().GetInstanceId()),
+		linuxCurlerCommand)
 	require.NoError(t, err, "Could not create Linux job")
 	defer deleteJob(linuxCurlerJob.Name)
 	err = waitUntilJobSucceeds(linuxCurlerJob.Name)
@@ -485,11 +660,17 @@ func testEastWestNetworkingAcrossWindowsNodes(t *testing.T, firstVM e2ef.Windows
 	require.NoError(t, err, "Could not get affinity for first node")
 
 	// Deploy a webserver pod on the first node
-	winServerDeploymentOnFirstNode, err := deployWindowsWebServer("win-webserver-"+firstVM.GetCredentials().GetInstanceId(),
-		firstVM, affinityForFirstNode)
+	winServerName := e2ef.RunScopedName("win-webserver-" + firstVM.GetCredentials().GetInstanceId())
+	winServerDeploymentOnFirstNode, err := deployWindowsWebServer(winServerName, firstVM, affinityForFirstNode)
 	require.NoError(t, err, "Could not create Windows Server deployment on first Node")
 	defer deleteDeployment(winServerDeploymentOnFirstNode.Name)
 
+	// The connections across the nodes are routed by the subnets of the nodes, which must not overlap
+	secondNode, err := framework.GetNode(secondVM.GetCredentials().GetIPAddress())
+	require.NoError(t, err, "Could not get Windows node object from second VM")
+	require.NoError(t, e2ef.CheckNodeSubnets([]v1.Node{*firstNode, *secondNode}),
+		"Windows nodes were not allocated distinct subnets")
+
 	// Get the pod so we can use its IP
 	winServerIP, err := getPodIP(*winServerDeploymentOnFirstNode.Spec.Selector)
 	require.NoError(t, err, "Could not retrieve pod with selector %v", *winServerDeploymentOnFirstNode.Spec.Selector)
@@ -506,7 +687,8 @@ func testEastWestNetworkingAcrossWindowsNodes(t *testing.T, firstVM e2ef.Windows
 //  createWinCurlerJob creates a Job to curl Windows server at given IP address
 func createWinCurlerJob(vm e2ef.WindowsVM, winServerIP string) (*batchv1.Job, error) {
 	winCurlerCommand := getWinCurlerCommand(winServerIP)
-	winCurlerJob, err := createWindowsServerJob("win-curler-"+vm.GetCredentials().GetInstanceId(), winCurlerCommand)
+	winCurlerJob, err := createWindowsServerJob(e2ef.RunScopedName("win-curler-"+vm.GetCredentials().GetInstanceId()),
+		winCurlerCommand)
 	return winCurlerJob, err
 }
 
@@ -525,7 +707,7 @@ func getWinCurlerCommand(winServerIP string) []string {
 func deployWindowsWebServer(name string, vm e2ef.WindowsVM, affinity *v1.Affinity) (*appsv1.Deployment, error) {
 	// Preload the image that will be used on the Windows node, to prevent download timeouts
 	// and separate possible failure conditions into multiple operations
-	err := pullDockerImage(windowsServerImage, vm)
+	err := pullImage(windowsServerImage, vm)
 	if err != nil {
 		return nil, fmt.Errorf("could not pull Windows Server image: %s", err)
 	}
@@ -594,6 +776,43 @@ func waitUntilDeploymentScaled(name string) error {
 // getPodIP returns the IP of the pod that matches the label selector. If more than one pod match the
 // selector, the function will return an error
 func getPodIP(selector metav1.LabelSelector) (string, error) {
+	pod, err := getPod(selector)
+	if err != nil {
+		return "", err
+	}
+	return pod.Status.PodIP, nil
+}
+
+// getPod returns the pod that matches the label selector. If more than one pod match the selector, the function will
+// return an error
+func getPod(selector metav1.LabelSelector) (*v1.Pod, error) {
+	selectorString := labels.Set(selector.MatchLabels).String()
+	podList, err := framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).List(metav1.ListOptions{
+		LabelSelector: selectorString})
+	if err != nil {
+		return nil, err
+	}
+	if len(podList.Items) != 1 {
+		return nil, fmt.Errorf("expected one pod matching %s, but found %d", selectorString, len(podList.Items))
+	}
+
+	return &podList.Items[0], nil
+}
+
+// assertNodeIPSelected asserts that the given node IP, selected by WMCB, is an address of a network adapter of the VM
+// that is up, other than the host adapter of the NAT network
+func assertNodeIPSelected(t *testing.T, vm e2ef.WindowsVM, nodeIP string) {
+	adapters, err := e2ef.NetworkAdapters(vm)
+	require.NoError(t, err, "could not list the network adapters of the VM")
+	adapter := e2ef.FindNetworkAdapter(adapters, net.ParseIP(nodeIP))
+	require.NotNil(t, adapter, "node IP %s is not an address of the VM: %v", nodeIP, adapters)
+	assert.Equal(t, "Up", adapter.Status, "node IP %s is an address of adapter %s, which is not up", nodeIP,
+		adapter.Name)
+	assert.NotEqual(t, "vEthernet (nat)", adapter.Name, "node IP %s is an address of the NAT network", nodeIP)
+}
+
+// getPodIPv6 returns the IPv6 address of the pod matching the selector
+func getPodIPv6(selector metav1.LabelSelector) (string, error) {
 	selectorString := labels.Set(selector.MatchLabels).String()
 	podList, err := framework.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).List(metav1.ListOptions{
 		LabelSelector: selectorString})
@@ -603,32 +822,40 @@ func getPodIP(selector metav1.LabelSelector) (string, error) {
 	if len(podList.Items) != 1 {
 		return "", fmt.Errorf("expected one pod matching %s, but found %d", selectorString, len(podList.Items))
 	}
-
-	return podList.Items[0].Status.PodIP, nil
+	for _, podIP := range podList.Items[0].Status.PodIPs {
+		if strings.Contains(podIP.IP, ":") {
+			return podIP.IP, nil
+		}
+	}
+	return "", fmt.Errorf("pod %s has no IPv6 address: %v", podList.Items[0].Name, podList.Items[0].Status.PodIPs)
 }
 
 // createWindowsServerJob creates a job which will run the provided command with a Windows Server image
 func createWindowsServerJob(name string, command []string) (*batchv1.Job, error) {
 	windowsNodeSelector := map[string]string{"beta.kubernetes.io/os": "windows"}
 	windowsTolerations := []v1.Toleration{{Key: "os", Value: "Windows", Effect: v1.TaintEffectNoSchedule}}
-	return createJob(name, windowsServerImage, command, windowsNodeSelector, windowsTolerations)
+	return createJob(name, windowsServerImage, command, windowsNodeSelector, windowsTolerations, nil)
 }
 
 // createLinuxJob creates a job which will run the provided command with a ubi8 image
 func createLinuxJob(name string, command []string) (*batchv1.Job, error) {
 	linuxNodeSelector := map[string]string{"beta.kubernetes.io/os": "linux"}
-	return createJob(name, ubi8Image, command, linuxNodeSelector, []v1.Toleration{})
+	return createJob(name, ubi8Image, command, linuxNodeSelector, []v1.Toleration{}, nil)
 }
 
+// createJob creates a job running the provided command with the given image. The pod template can be customized with
+// the optional mutate function.
 func createJob(name, image string, command []string, selector map[string]string,
-	tolerations []v1.Toleration) (*batchv1.Job, error) {
+	tolerations []v1.Toleration, mutate func(*v1.PodTemplateSpec)) (*batchv1.Job, error) {
 	jobsClient := framework.K8sclientset.BatchV1().Jobs(v1.NamespaceDefault)
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name + "-job",
+			Name:   name + "-job",
+			Labels: e2ef.RunLabels(nil),
 		},
 		Spec: batchv1.JobSpec{
 			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: e2ef.RunLabels(nil)},
 				Spec: v1.PodSpec{
 					RestartPolicy: v1.RestartPolicyNever,
 					Tolerations:   tolerations,
@@ -646,6 +873,10 @@ func createJob(name, image string, command []string, selector map[string]string,
 		},
 	}
 
+	if mutate != nil {
+		mutate(&job.Spec.Template)
+	}
+
 	// Create job
 	job, err := jobsClient.Create(job)
 	if err != nil {
@@ -666,7 +897,8 @@ func createWindowsServerDeployment(name string, command []string, affinity *v1.A
 	replicaCount := int32(1)
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name + "-deployment",
+			Name:   name + "-deployment",
+			Labels: e2ef.RunLabels(nil),
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicaCount,
@@ -677,9 +909,9 @@ func createWindowsServerDeployment(name string, command []string, affinity *v1.A
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
+					Labels: e2ef.RunLabels(map[string]string{
 						"app": name,
-					},
+					}),
 				},
 				Spec: v1.PodSpec{
 					Affinity: affinity,
@@ -725,12 +957,15 @@ func deleteDeployment(name string) error {
 	return deploymentsClient.Delete(name, &metav1.DeleteOptions{})
 }
 
-// pullDockerImage pulls the designated image on the remote host
-func pullDockerImage(name string, vm e2ef.WindowsVM) error {
-	command := "docker pull " + name
+// pullImage pulls the designated image on the remote host with the container runtime of the node
+func pullImage(name string, vm e2ef.WindowsVM) error {
+	command := e2ef.CmdLine("docker", "pull", name)
+	if e2ef.ContainerRuntime == e2ef.ContainerdRuntime {
+		command = e2ef.CmdLine("ctr", "--namespace", "k8s.io", "images", "pull", name)
+	}
 	_, _, err := vm.Run(command, false)
 	if err != nil {
-		return fmt.Errorf("failed to remotely run docker pull: %s", err)
+		return fmt.Errorf("failed to remotely run %s: %s", command, err)
 	}
 	return nil
 }
@@ -741,12 +976,14 @@ func testNorthSouthNetworking(t *testing.T, node *v1.Node, vm e2ef.WindowsVM) {
 	require.NoError(t, err, "Could not get affinity for node")
 
 	// Deploy a webserver pod on the new node
-	winServerDeployment, err := deployWindowsWebServer("win-webserver-"+vm.GetCredentials().GetInstanceId(), vm, affinity)
+	winServerDeployment, err := deployWindowsWebServer(e2ef.RunScopedName("win-webserver-"+vm.GetCredentials().GetInstanceId()),
+		vm, affinity)
 	require.NoError(t, err, "Could not create Windows Server deployment")
 	defer deleteDeployment(winServerDeployment.Name)
 
 	// Create a load balancer svc to expose the webserver
-	loadBalancer, err := createLoadBalancer("win-webserver-"+vm.GetCredentials().GetInstanceId(), *winServerDeployment.Spec.Selector)
+	loadBalancer, err := createLoadBalancer(e2ef.RunScopedName("win-webserver-"+vm.GetCredentials().GetInstanceId()),
+		*winServerDeployment.Spec.Selector)
 	require.NoError(t, err, "Could not create load balancer for Windows Server")
 	defer deleteService(loadBalancer.Name)
 	loadBalancer, err = waitForLoadBalancerIngress(loadBalancer.Name)
@@ -778,7 +1015,8 @@ func retryGET(url string, retryInterval time.Duration) (*http.Response, error) {
 func createLoadBalancer(name string, selector metav1.LabelSelector) (*v1.Service, error) {
 	svcSpec := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:   name,
+			Labels: e2ef.RunLabels(nil),
 		},
 		Spec: v1.ServiceSpec{
 			Type: v1.ServiceTypeLoadBalancer,
@@ -0,0 +1,159 @@
+package activation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+	activation reports the Windows activation status of the node. Evaluation images shut the node down every hour once
+	their evaluation period expired, and non activated nodes do so once their grace period ended, which silently breaks
+	long-running environments. The status is checked before the kubelet is initialized and by the node monitor, so that
+	the cause of the reboots is reported.
+*/
+
+// LicenseStatus is the license status of a Windows product, as reported by the SoftwareLicensingProduct WMI class
+type LicenseStatus int
+
+const (
+	// Unlicensed means that Windows is neither activated nor in a grace period
+	Unlicensed LicenseStatus = iota
+	// Licensed means that Windows is activated
+	Licensed
+	// OOBGrace means that Windows is in the initial grace period, before activation
+	OOBGrace
+	// OOTGrace means that Windows is in the grace period given after a hardware change
+	OOTGrace
+	// NonGenuineGrace means that Windows is in the grace period given after failing the genuine validation
+	NonGenuineGrace
+	// Notification means that the grace period ended, and that Windows notifies the user and shuts down periodically
+	Notification
+	// ExtendedGrace means that Windows is in an extended grace period
+	ExtendedGrace
+)
+
+// windowsApplicationID is the application ID of the Windows products in the SoftwareLicensingProduct WMI class
+const windowsApplicationID = "55c92734-d682-4d71-983e-d6ec3f16059f"
+
+// DefaultWarningPeriod is how long before the end of the evaluation or grace period a warning is reported
+const DefaultWarningPeriod = 7 * 24 * time.Hour
+
+// String returns the name of the license status
+func (s LicenseStatus) String() string {
+	switch s {
+	case Unlicensed:
+		return "Unlicensed"
+	case Licensed:
+		return "Licensed"
+	case OOBGrace:
+		return "OOBGrace"
+	case OOTGrace:
+		return "OOTGrace"
+	case NonGenuineGrace:
+		return "NonGenuineGrace"
+	case Notification:
+		return "Notification"
+	case ExtendedGrace:
+		return "ExtendedGrace"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(s))
+	}
+}
+
+// Status is the activation status of the Windows product installed on the node
+type Status struct {
+	// Name is the name of the product, e.g. "Windows(R), ServerDatacenterEval edition"
+	Name string
+	// Description is the description of the product, e.g. "Windows(R) Operating System, TIMEBASED_EVAL channel"
+	Description string
+	// LicenseStatus is the license status of the product
+	LicenseStatus LicenseStatus
+	// GracePeriodRemaining is the time left in the evaluation or grace period, zero if activated or expired
+	GracePeriodRemaining time.Duration
+}
+
+// product is the SoftwareLicensingProduct WMI object as converted to JSON by PowerShell
+type product struct {
+	Name                 string
+	Description          string
+	LicenseStatus        int
+	GracePeriodRemaining int64
+}
+
+// Get queries the activation status of the Windows product installed on the node
+func Get() (*Status, error) {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"ConvertTo-Json -InputObject @(Get-CimInstance SoftwareLicensingProduct -Filter "+
+			"\"ApplicationID='"+windowsApplicationID+"' AND PartialProductKey IS NOT NULL\" | "+
+			"Select-Object Name, Description, LicenseStatus, GracePeriodRemaining)").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not query Windows activation status: %v, %s", err, out)
+	}
+	return parseStatus(out)
+}
+
+// parseStatus parses the SoftwareLicensingProduct objects of the Windows products with a product key. Only one of
+// them is installed on a node.
+func parseStatus(out []byte) (*Status, error) {
+	var products []product
+	if err := json.Unmarshal(out, &products); err != nil {
+		return nil, fmt.Errorf("could not parse Windows activation status %s: %v", out, err)
+	}
+	if len(products) == 0 {
+		return nil, fmt.Errorf("no Windows product key installed")
+	}
+	p := products[0]
+	return &Status{
+		Name:                 p.Name,
+		Description:          p.Description,
+		LicenseStatus:        LicenseStatus(p.LicenseStatus),
+		GracePeriodRemaining: time.Duration(p.GracePeriodRemaining) * time.Minute,
+	}, nil
+}
+
+// Evaluation returns true if the product is an evaluation edition, which has to be reinstalled once its evaluation
+// period expired
+func (s *Status) Evaluation() bool {
+	return strings.Contains(s.Description, "TIMEBASED_EVAL") || strings.Contains(s.Name, "Eval")
+}
+
+// String describes the activation status
+func (s *Status) String() string {
+	description := fmt.Sprintf("%s is %s", s.Name, s.LicenseStatus)
+	if s.GracePeriodRemaining > 0 {
+		description += ", " + formatRemaining(s.GracePeriodRemaining) + " left"
+	}
+	return description
+}
+
+// formatRemaining returns the given duration in days, or in hours and minutes if it is less than a day
+func formatRemaining(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return d.Round(time.Minute).String()
+}
+
+// Check returns an error if the node shuts down periodically because its evaluation or grace period ended. A warning
+// is returned if the period ends within the given warning period, or if Windows is not activated.
+func (s *Status) Check(warningPeriod time.Duration) (string, error) {
+	switch {
+	case s.Evaluation() && s.GracePeriodRemaining == 0 && s.LicenseStatus != Licensed:
+		return "", fmt.Errorf("the evaluation period of %s expired, the node shuts down every hour: use a licensed "+
+			"image", s.Name)
+	case s.LicenseStatus == Notification || s.LicenseStatus == Unlicensed:
+		return "", fmt.Errorf("%s is not activated and its grace period ended, the node shuts down every hour: "+
+			"activate Windows", s.Name)
+	case s.LicenseStatus == Licensed && !s.Evaluation():
+		return "", nil
+	case s.GracePeriodRemaining < warningPeriod:
+		return fmt.Sprintf("%s, the node will shut down every hour once the period ends", s), nil
+	case s.LicenseStatus != Licensed:
+		return fmt.Sprintf("%s, activate Windows before the period ends", s), nil
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,63 @@
+package activation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseStatus tests the parsing of the SoftwareLicensingProduct objects
+func TestParseStatus(t *testing.T) {
+	status, err := parseStatus([]byte(`[{"Name": "Windows(R), ServerDatacenterEval edition",
+		"Description": "Windows(R) Operating System, TIMEBASED_EVAL channel", "LicenseStatus": 1,
+		"GracePeriodRemaining": 14400}]`))
+	require.NoError(t, err)
+	assert.Equal(t, &Status{
+		Name:                 "Windows(R), ServerDatacenterEval edition",
+		Description:          "Windows(R) Operating System, TIMEBASED_EVAL channel",
+		LicenseStatus:        Licensed,
+		GracePeriodRemaining: 10 * 24 * time.Hour,
+	}, status)
+	assert.True(t, status.Evaluation())
+	assert.Equal(t, "Windows(R), ServerDatacenterEval edition is Licensed, 10 days left", status.String())
+
+	_, err = parseStatus([]byte(`[]`))
+	assert.Error(t, err, "no product key installed")
+	_, err = parseStatus([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+// TestCheck tests that the expired evaluation and grace periods are errors, and that the ones about to expire are
+// warnings
+func TestCheck(t *testing.T) {
+	const (
+		datacenter = "Windows(R), ServerDatacenter edition"
+		evaluation = "Windows(R), ServerDatacenterEval edition"
+	)
+	tests := []struct {
+		name    string
+		status  Status
+		warning bool
+		err     bool
+	}{
+		{"activated", Status{Name: datacenter, LicenseStatus: Licensed}, false, false},
+		{"evaluation", Status{Name: evaluation, LicenseStatus: Licensed, GracePeriodRemaining: 90 * 24 * time.Hour},
+			false, false},
+		{"evaluation expiring", Status{Name: evaluation, LicenseStatus: Licensed,
+			GracePeriodRemaining: 2 * 24 * time.Hour}, true, false},
+		{"evaluation expired", Status{Name: evaluation, LicenseStatus: Notification}, false, true},
+		{"grace period", Status{Name: datacenter, LicenseStatus: OOBGrace, GracePeriodRemaining: 30 * 24 * time.Hour},
+			true, false},
+		{"grace period ended", Status{Name: datacenter, LicenseStatus: Notification}, false, true},
+		{"unlicensed", Status{Name: datacenter, LicenseStatus: Unlicensed}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warning, err := test.status.Check(DefaultWarningPeriod)
+			assert.Equal(t, test.err, err != nil, "unexpected error %v", err)
+			assert.Equal(t, test.warning, warning != "", "unexpected warning %q", warning)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/winservice"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	// DiagnosticsDirName is the name of the directory the diagnostics bundles are written to, under the directory the
+	// kubelet serves to `oc adm node-logs --path`
+	DiagnosticsDirName = "wmcb-diagnostics"
+	// diagnosticsDir is the directory the diagnostics bundles are written to, under c:\var\log which the kubelet serves
+	// on its /logs endpoint
+	diagnosticsDir = "c:\\var\\log\\" + DiagnosticsDirName
+	// maxDiagnosticsBundles is the number of diagnostics bundles kept on the node, the oldest ones being removed
+	maxDiagnosticsBundles = 5
+	// bundleTimeFormat is the format of the time of the collection in the name of the diagnostics bundles
+	bundleTimeFormat = "20060102T150405"
+	// kubeletServiceName is the name of the kubelet Windows service
+	kubeletServiceName = "kubelet"
+)
+
+// logLevelArg matches the log level argument of a kubelet command line
+var logLevelArg = regexp.MustCompile(`(^|\s)--v=\S*`)
+
+// diagnosticsScripts are the read-only PowerShell scripts of the diagnostics bundle, by the name of the file their
+// output is written to
+var diagnosticsScripts = map[string]string{
+	"services.txt": "Get-Service -Name kubelet,kube-proxy,hybrid-overlay-node,docker,containerd,hns,vmcompute " +
+		"-ErrorAction SilentlyContinue | Format-Table -AutoSize Name, Status, StartType | Out-String -Width 200",
+	"hns-networks.txt": "Get-HnsNetwork | Format-List Name, Type, Subnets, ManagementIP | Out-String -Width 200",
+	"hns-endpoints.txt": "Get-HnsEndpoint | Format-Table -AutoSize Name, IPAddress, VirtualNetworkName, State | " +
+		"Out-String -Width 200",
+	"network-adapters.txt": "Get-NetIPConfiguration -Detailed | Out-String -Width 200",
+	"hotfixes.txt": "Get-HotFix | Sort-Object InstalledOn | Format-Table -AutoSize HotFixID, Description, " +
+		"InstalledOn | Out-String -Width 200",
+	"processes.txt": "Get-Process | Sort-Object CPU -Descending | Select-Object -First 30 | Format-Table -AutoSize " +
+		"Name, Id, CPU, WorkingSet | Out-String -Width 200",
+	"volumes.txt": "Get-Volume | Format-Table -AutoSize DriveLetter, FileSystemLabel, SizeRemaining, Size | " +
+		"Out-String -Width 200",
+	"container-runtime-events.txt": "Get-WinEvent -MaxEvents 100 -ErrorAction SilentlyContinue -FilterHashtable " +
+		"@{LogName='Application'; ProviderName='docker','containerd'} | Format-List TimeCreated, LevelDisplayName, " +
+		"Message | Out-String -Width 200",
+}
+
+// nodeActions applies the requests on the Windows node
+type nodeActions struct {
+	// diagnosticsDir is the directory the diagnostics bundles are written to
+	diagnosticsDir string
+}
+
+// SetKubeletLogLevel updates the log level argument of the kubelet service and restarts it
+func (n *nodeActions) SetKubeletLogLevel(level int) error {
+	return withKubeletService(func(service *mgr.Service) error {
+		config, err := service.Config()
+		if err != nil {
+			return fmt.Errorf("could not get kubelet service config: %v", err)
+		}
+		config.BinaryPathName = setLogLevel(config.BinaryPathName, level)
+		if err = winservice.Stop(service); err != nil {
+			return err
+		}
+		if err = service.UpdateConfig(config); err != nil {
+			return fmt.Errorf("could not update kubelet service: %v", err)
+		}
+		if err = service.Start(); err != nil {
+			return fmt.Errorf("could not start kubelet service: %v", err)
+		}
+		return nil
+	})
+}
+
+// RestartKubelet restarts the kubelet service
+func (n *nodeActions) RestartKubelet() error {
+	return withKubeletService(func(service *mgr.Service) error {
+		if err := winservice.Stop(service); err != nil {
+			return err
+		}
+		if err := service.Start(); err != nil {
+			return fmt.Errorf("could not start kubelet service: %v", err)
+		}
+		return nil
+	})
+}
+
+// CollectDiagnostics writes the outputs of the diagnostics scripts to a new bundle directory, removes the oldest
+// bundles and returns the path of the new one for `oc adm node-logs --path`. The scripts which fail are reported in
+// the file of their output.
+func (n *nodeActions) CollectDiagnostics() (string, error) {
+	name := time.Now().UTC().Format(bundleTimeFormat)
+	dir := filepath.Join(n.diagnosticsDir, name)
+	if err := os.MkdirAll(dir, os.ModeDir); err != nil {
+		return "", fmt.Errorf("could not make %s directory: %v", dir, err)
+	}
+	for file, script := range diagnosticsScripts {
+		out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+			script).CombinedOutput()
+		if err != nil {
+			out = append(out, []byte(fmt.Sprintf("\r\nerror: %v\r\n", err))...)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, file), out, 0644); err != nil {
+			return "", fmt.Errorf("could not write %s: %v", file, err)
+		}
+	}
+	if err := removeOldBundles(n.diagnosticsDir, maxDiagnosticsBundles); err != nil {
+		return "", err
+	}
+	return DiagnosticsDirName + "/" + name, nil
+}
+
+// setLogLevel returns the given kubelet command line with its log level argument set to the given level
+func setLogLevel(cmd string, level int) string {
+	arg := "--v=" + strconv.Itoa(level)
+	if logLevelArg.MatchString(cmd) {
+		return logLevelArg.ReplaceAllString(cmd, "${1}"+arg)
+	}
+	return cmd + " " + arg
+}
+
+// removeOldBundles removes the oldest diagnostics bundles of the given directory beyond the given number
+func removeOldBundles(dir string, keep int) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not list %s: %v", dir, err)
+	}
+	var bundles []string
+	for _, entry := range entries {
+		if _, err := time.Parse(bundleTimeFormat, entry.Name()); err == nil && entry.IsDir() {
+			bundles = append(bundles, entry.Name())
+		}
+	}
+	// The names sort in the order the bundles were collected
+	sort.Strings(bundles)
+	for len(bundles) > keep {
+		if err = os.RemoveAll(filepath.Join(dir, bundles[0])); err != nil {
+			return fmt.Errorf("could not remove diagnostics bundle %s: %v", bundles[0], err)
+		}
+		bundles = bundles[1:]
+	}
+	return nil
+}
+
+// withKubeletService calls the given function with the kubelet Windows service
+func withKubeletService(f func(*mgr.Service) error) error {
+	svcMgr, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	defer svcMgr.Disconnect()
+	service, err := svcMgr.OpenService(kubeletServiceName)
+	if err != nil {
+		return fmt.Errorf("kubelet service not found: %v", err)
+	}
+	defer service.Close()
+	return f(service)
+}
@@ -0,0 +1,308 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+/*
+	agent is a small agent running on the Windows node which applies the configuration changes requested by the cluster
+	administrators through annotations of the node object, or through a ConfigMap shared by the nodes, so that the
+	nodes can be operated without ssh or WinRM access. It raises the log level of the kubelet, restarts the kubelet and
+	collects a diagnostics bundle, which is served by the kubelet to `oc adm node-logs`. Every request is applied once,
+	when its value changes, and its outcome is reported in the status annotation of the node and as a node event.
+*/
+
+const (
+	// ServiceName is the name of the Windows service the agent runs under
+	ServiceName = "wmcb-agent"
+	// AnnotationPrefix is the prefix of the node annotations the requests are made and reported with
+	AnnotationPrefix = "agent.wmcb.openshift.io/"
+	// StatusAnnotation is the node annotation the agent reports the requests it applied in, as JSON
+	StatusAnnotation = AnnotationPrefix + "status"
+
+	// KubeletLogLevel requests the kubelet to be restarted with the given log level, from 0 to 10
+	KubeletLogLevel = "kubelet-log-level"
+	// RestartKubelet requests the kubelet to be restarted every time its value changes, e.g. to the current time
+	RestartKubelet = "restart-kubelet"
+	// CollectDiagnostics requests a diagnostics bundle to be collected every time its value changes
+	CollectDiagnostics = "collect-diagnostics"
+
+	// maxLogLevel is the highest log level of the kubelet
+	maxLogLevel = 10
+	// eventSource is the component name used as the source of the events recorded by the agent
+	eventSource = "wmcb-agent"
+	// eventNamespace is the namespace in which the node events are recorded, this matches the kubelet behaviour
+	eventNamespace = "default"
+)
+
+// requests are the requests the agent applies, in the order they are applied
+var requests = []string{KubeletLogLevel, RestartKubelet, CollectDiagnostics}
+
+// Actions applies the requests on the node
+type Actions interface {
+	// SetKubeletLogLevel restarts the kubelet with the given log level
+	SetKubeletLogLevel(level int) error
+	// RestartKubelet restarts the kubelet
+	RestartKubelet() error
+	// CollectDiagnostics collects a diagnostics bundle and returns where it can be retrieved from
+	CollectDiagnostics() (string, error)
+}
+
+// AppliedRequest is the outcome of a request applied by the agent
+type AppliedRequest struct {
+	// Value is the value of the request applied
+	Value string `json:"value"`
+	// Applied is when the request was applied
+	Applied time.Time `json:"applied"`
+	// Result describes the outcome of the request, e.g. where the diagnostics bundle can be retrieved from
+	Result string `json:"result,omitempty"`
+	// Error is the error the request failed with, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Status holds the requests applied by the agent, by name
+type Status map[string]AppliedRequest
+
+// ConfigMapRef is the namespace and name of the ConfigMap holding the requests shared by the nodes
+type ConfigMapRef struct {
+	Namespace string
+	Name      string
+}
+
+// ParseConfigMapRef returns the ConfigMap of the given <namespace>/<name> reference
+func ParseConfigMapRef(ref string) (*ConfigMapRef, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid ConfigMap %s, expected <namespace>/<name>", ref)
+	}
+	return &ConfigMapRef{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// Agent applies the requests made to the Windows node
+type Agent struct {
+	// client is used to read the requests and report their outcome
+	client kubernetes.Interface
+	// nodeName is the name of the node object the requests are read from
+	nodeName string
+	// configMap is the ConfigMap holding the requests shared by the nodes, nil if there is none
+	configMap *ConfigMapRef
+	// actions applies the requests
+	actions Actions
+	// now returns the current time
+	now func() time.Time
+}
+
+// NewAgent returns an Agent applying the requests made to the given node using the given kubeconfig, and to the given
+// shared ConfigMap if not nil
+func NewAgent(kubeconfigPath, nodeName string, configMap *ConfigMapRef) (*Agent, error) {
+	if nodeName == "" {
+		return nil, fmt.Errorf("node name cannot be empty")
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not build config from %s: %v", kubeconfigPath, err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes client: %v", err)
+	}
+	return newAgent(client, nodeName, configMap, &nodeActions{diagnosticsDir: diagnosticsDir}), nil
+}
+
+// newAgent returns an Agent applying the requests made to the given node with the given actions
+func newAgent(client kubernetes.Interface, nodeName string, configMap *ConfigMapRef, actions Actions) *Agent {
+	return &Agent{client: client, nodeName: nodeName, configMap: configMap, actions: actions, now: time.Now}
+}
+
+// Run applies the requests every interval until the stop channel is closed. Failures are logged through the given
+// function and do not stop the agent.
+func (a *Agent) Run(interval time.Duration, stop <-chan struct{}, logf func(string, ...interface{})) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Sync(); err != nil {
+			logf("error applying the requests: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync applies the requests whose value changed since they were last applied, and reports their outcome
+func (a *Agent) Sync() error {
+	node, err := a.client.CoreV1().Nodes().Get(a.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get node %s: %v", a.nodeName, err)
+	}
+	desired, err := a.desired(node)
+	if err != nil {
+		return err
+	}
+	status := make(Status)
+	if value, ok := node.Annotations[StatusAnnotation]; ok {
+		if err = json.Unmarshal([]byte(value), &status); err != nil {
+			// The requests are applied again rather than never
+			status = make(Status)
+		}
+	}
+
+	names := pending(desired, status)
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		status[name] = a.apply(name, desired[name])
+	}
+	if err = a.report(status); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = a.recordEvent(name, status[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desired returns the values of the requests made through the shared ConfigMap, overridden by the annotations of the
+// given node
+func (a *Agent) desired(node *v1.Node) (map[string]string, error) {
+	desired := make(map[string]string)
+	if a.configMap != nil {
+		configMap, err := a.client.CoreV1().ConfigMaps(a.configMap.Namespace).Get(a.configMap.Name,
+			metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("could not get ConfigMap %s/%s: %v", a.configMap.Namespace, a.configMap.Name, err)
+		}
+		if err == nil {
+			for _, name := range requests {
+				if value, ok := configMap.Data[name]; ok {
+					desired[name] = value
+				}
+			}
+		}
+	}
+	for _, name := range requests {
+		if value, ok := node.Annotations[AnnotationPrefix+name]; ok {
+			desired[name] = value
+		}
+	}
+	return desired, nil
+}
+
+// pending returns the names of the requests whose desired value differs from the one last applied, in the order they
+// are applied. A request which failed is not retried until its value changes, so that a failing kubelet restart is
+// not repeated every interval.
+func pending(desired map[string]string, status Status) []string {
+	var names []string
+	for _, name := range requests {
+		value, ok := desired[name]
+		if !ok {
+			continue
+		}
+		if applied, ok := status[name]; ok && applied.Value == value {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// apply applies the given request with the given value and returns its outcome
+func (a *Agent) apply(name, value string) AppliedRequest {
+	request := AppliedRequest{Value: value}
+	var err error
+	switch name {
+	case KubeletLogLevel:
+		var level int
+		if level, err = parseLogLevel(value); err == nil {
+			err = a.actions.SetKubeletLogLevel(level)
+			request.Result = fmt.Sprintf("kubelet restarted with log level %d", level)
+		}
+	case RestartKubelet:
+		err = a.actions.RestartKubelet()
+		request.Result = "kubelet restarted"
+	case CollectDiagnostics:
+		var location string
+		location, err = a.actions.CollectDiagnostics()
+		request.Result = "diagnostics collected to " + location
+	}
+	request.Applied = a.now().UTC()
+	if err != nil {
+		request.Result, request.Error = "", err.Error()
+	}
+	return request
+}
+
+// parseLogLevel returns the kubelet log level of the given value
+func parseLogLevel(value string) (int, error) {
+	level, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || level < 0 || level > maxLogLevel {
+		return 0, fmt.Errorf("invalid kubelet log level %q, expected 0 to %d", value, maxLogLevel)
+	}
+	return level, nil
+}
+
+// report updates the status annotation of the node with the given status
+func (a *Agent) report(status Status) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("could not marshal agent status: %v", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{StatusAnnotation: string(value)}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal node patch: %v", err)
+	}
+	if _, err = a.client.CoreV1().Nodes().Patch(a.nodeName, types.StrategicMergePatchType, patch); err != nil {
+		return fmt.Errorf("could not annotate node %s: %v", a.nodeName, err)
+	}
+	return nil
+}
+
+// recordEvent records an event against the node describing the outcome of the given request
+func (a *Agent) recordEvent(name string, request AppliedRequest) error {
+	eventType, reason, message := v1.EventTypeNormal, "AgentRequestApplied", name+": "+request.Result
+	if request.Error != "" {
+		eventType, reason, message = v1.EventTypeWarning, "AgentRequestFailed", name+": "+request.Error
+	}
+	now := metav1.NewTime(a.now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: a.nodeName + ".",
+			Namespace:    eventNamespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind: "Node",
+			Name: a.nodeName,
+			// The kubelet uses the node name as the UID of node events, we follow the same convention
+			UID: types.UID(a.nodeName),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: eventSource, Host: a.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := a.client.CoreV1().Events(eventNamespace).Create(event); err != nil {
+		return fmt.Errorf("could not record %s event for node %s: %v", reason, a.nodeName, err)
+	}
+	return nil
+}
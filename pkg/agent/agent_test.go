@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeActions records the requests applied, failing the kubelet restarts if restartErr is set
+type fakeActions struct {
+	// logLevels are the log levels the kubelet was set to
+	logLevels []int
+	// restarts is the number of kubelet restarts
+	restarts int
+	// collections is the number of diagnostics bundles collected
+	collections int
+	// restartErr is the error the kubelet restarts fail with
+	restartErr error
+}
+
+func (f *fakeActions) SetKubeletLogLevel(level int) error {
+	f.logLevels = append(f.logLevels, level)
+	return nil
+}
+
+func (f *fakeActions) RestartKubelet() error {
+	f.restarts++
+	return f.restartErr
+}
+
+func (f *fakeActions) CollectDiagnostics() (string, error) {
+	f.collections++
+	return fmt.Sprintf("%s/bundle-%d", DiagnosticsDirName, f.collections), nil
+}
+
+// newFakeClient returns a fake client holding the given objects, which names the events it creates from their
+// GenerateName as the API server does
+func newFakeClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	generated := 0
+	client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*v1.Event)
+		if event.Name == "" {
+			generated++
+			event.Name = fmt.Sprintf("%s%d", event.GenerateName, generated)
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+// nodeStatus returns the status reported in the annotation of the given node
+func nodeStatus(t *testing.T, node *v1.Node) Status {
+	var status Status
+	require.NoError(t, json.Unmarshal([]byte(node.Annotations[StatusAnnotation]), &status))
+	return status
+}
+
+// TestSync tests that the requests are applied once per value, that the failed ones are not retried until their value
+// changes, and that their outcome is reported
+func TestSync(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "winnode", Annotations: map[string]string{
+		AnnotationPrefix + KubeletLogLevel:    "5",
+		AnnotationPrefix + CollectDiagnostics: "1",
+	}}}
+	client := newFakeClient(node)
+	actions := &fakeActions{}
+	a := newAgent(client, "winnode", nil, actions)
+
+	require.NoError(t, a.Sync())
+	require.NoError(t, a.Sync())
+	assert.Equal(t, []int{5}, actions.logLevels)
+	assert.Equal(t, 1, actions.collections)
+	node, err := client.CoreV1().Nodes().Get("winnode", metav1.GetOptions{})
+	require.NoError(t, err)
+	status := nodeStatus(t, node)
+	assert.Equal(t, "5", status[KubeletLogLevel].Value)
+	assert.Equal(t, "kubelet restarted with log level 5", status[KubeletLogLevel].Result)
+	assert.Equal(t, "diagnostics collected to wmcb-diagnostics/bundle-1", status[CollectDiagnostics].Result)
+	events, err := client.CoreV1().Events(eventNamespace).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, events.Items, 2)
+
+	// A failed restart is reported, and not retried until its value changes
+	actions.restartErr = fmt.Errorf("kubelet service not found")
+	node.Annotations[AnnotationPrefix+RestartKubelet] = "2021-01-01T00:00:00Z"
+	node.Annotations[AnnotationPrefix+KubeletLogLevel] = "11"
+	_, err = client.CoreV1().Nodes().Update(node)
+	require.NoError(t, err)
+	require.NoError(t, a.Sync())
+	require.NoError(t, a.Sync())
+	assert.Equal(t, 1, actions.restarts)
+	assert.Equal(t, []int{5}, actions.logLevels, "an invalid log level is applied")
+	node, err = client.CoreV1().Nodes().Get("winnode", metav1.GetOptions{})
+	require.NoError(t, err)
+	status = nodeStatus(t, node)
+	assert.Equal(t, "kubelet service not found", status[RestartKubelet].Error)
+	assert.Contains(t, status[KubeletLogLevel].Error, "invalid kubelet log level")
+	events, err = client.CoreV1().Events(eventNamespace).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, events.Items, 4)
+}
+
+// TestSyncConfigMap tests that the requests of the shared ConfigMap are applied, and that the annotations of the node
+// take precedence over them
+func TestSyncConfigMap(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "winnode", Annotations: map[string]string{
+		AnnotationPrefix + KubeletLogLevel: "2",
+	}}}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-windows", Name: "wmcb-agent"},
+		Data:       map[string]string{KubeletLogLevel: "6", RestartKubelet: "1", "unknown": "1"},
+	}
+	client := newFakeClient(node, configMap)
+	actions := &fakeActions{}
+	a := newAgent(client, "winnode", &ConfigMapRef{Namespace: "openshift-windows", Name: "wmcb-agent"}, actions)
+	require.NoError(t, a.Sync())
+	assert.Equal(t, []int{2}, actions.logLevels)
+	assert.Equal(t, 1, actions.restarts)
+
+	// A missing ConfigMap has no requests
+	a = newAgent(client, "winnode", &ConfigMapRef{Namespace: "openshift-windows", Name: "missing"}, actions)
+	require.NoError(t, a.Sync())
+	assert.Equal(t, 1, actions.restarts)
+}
+
+// TestPending tests that only the requests whose value changed since they were last applied are pending, in the order
+// they are applied
+func TestPending(t *testing.T) {
+	status := Status{KubeletLogLevel: {Value: "4"}, RestartKubelet: {Value: "a", Error: "failed"}}
+	assert.Empty(t, pending(map[string]string{KubeletLogLevel: "4", RestartKubelet: "a"}, status))
+	assert.Equal(t, []string{KubeletLogLevel, RestartKubelet, CollectDiagnostics},
+		pending(map[string]string{CollectDiagnostics: "", RestartKubelet: "b", KubeletLogLevel: "2"}, status))
+}
+
+// TestSetLogLevel tests that the log level argument of the kubelet command line is replaced, or added if missing
+func TestSetLogLevel(t *testing.T) {
+	assert.Equal(t, `c:\k\kubelet.exe --windows-service --v=6 --node-ip=10.0.0.5`,
+		setLogLevel(`c:\k\kubelet.exe --windows-service --v=3 --node-ip=10.0.0.5`, 6))
+	assert.Equal(t, `c:\k\kubelet.exe --windows-service --v=2`, setLogLevel(`c:\k\kubelet.exe --windows-service`, 2))
+	assert.Equal(t, `c:\k\kubelet.exe --vmodule=x=1 --v=2`, setLogLevel(`c:\k\kubelet.exe --vmodule=x=1`, 2))
+}
+
+// TestRemoveOldBundles tests that only the newest diagnostics bundles are kept
+func TestRemoveOldBundles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, start.Add(time.Duration(i)*time.Hour).Format(bundleTimeFormat)),
+			0755))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+
+	require.NoError(t, removeOldBundles(dir, 2))
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"20210101T020000", "20210101T030000", "notes.txt"}, names)
+}
+
+// TestParseConfigMapRef tests the parsing of the ConfigMap references
+func TestParseConfigMapRef(t *testing.T) {
+	ref, err := ParseConfigMapRef("openshift-windows/wmcb-agent")
+	require.NoError(t, err)
+	assert.Equal(t, &ConfigMapRef{Namespace: "openshift-windows", Name: "wmcb-agent"}, ref)
+	for _, invalid := range []string{"wmcb-agent", "/wmcb-agent", "a/b/c"} {
+		_, err = ParseConfigMapRef(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/winservice"
+)
+
+// InstallService creates the agent Windows service running the given executable with the given arguments. An
+// existing agent service is replaced.
+func InstallService(exePath string, args ...string) error {
+	return winservice.Install(ServiceName, "OpenShift Windows node agent", exePath, args...)
+}
+
+// RemoveService removes the agent Windows service if it exists
+func RemoveService() error {
+	return winservice.Remove(ServiceName)
+}
+
+// RestartService restarts the agent Windows service, e.g. for it to run an updated executable, returning false if
+// the service is not installed
+func RestartService() (bool, error) {
+	return winservice.Restart(ServiceName)
+}
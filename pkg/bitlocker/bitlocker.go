@@ -0,0 +1,251 @@
+package bitlocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/*
+	bitlocker verifies and enables the BitLocker encryption of the volume the kubelet and the container runtime keep
+	their data in, for the clusters whose policy requires encrypted node disks. The operating system volume is protected
+	by the TPM of the node, the virtual TPM exposed by the cloud, as no password can be typed at boot. A data volume is
+	protected by a recovery password or by a password supplied by the cloud, and is unlocked at boot with a key stored
+	on the operating system volume, which therefore has to be protected first.
+*/
+
+// VolumeStatus is the encryption status of a volume, as reported by Get-BitLockerVolume
+type VolumeStatus string
+
+const (
+	// FullyDecrypted means that the volume is not encrypted
+	FullyDecrypted VolumeStatus = "FullyDecrypted"
+	// FullyEncrypted means that the volume is encrypted
+	FullyEncrypted VolumeStatus = "FullyEncrypted"
+	// EncryptionInProgress means that the volume is being encrypted, while it is in use
+	EncryptionInProgress VolumeStatus = "EncryptionInProgress"
+	// EncryptionPaused means that the encryption of the volume was paused
+	EncryptionPaused VolumeStatus = "EncryptionPaused"
+	// DecryptionInProgress means that the volume is being decrypted
+	DecryptionInProgress VolumeStatus = "DecryptionInProgress"
+	// DecryptionPaused means that the decryption of the volume was paused
+	DecryptionPaused VolumeStatus = "DecryptionPaused"
+)
+
+const (
+	// operatingSystemVolume is the type of the volume Windows boots from
+	operatingSystemVolume = "OperatingSystem"
+	// protectionOn is the protection status of an encrypted volume whose key protectors are enabled
+	protectionOn = "On"
+	// encryptionMethod is the encryption method of the volumes enabled by WMCB
+	encryptionMethod = "XtsAes256"
+)
+
+// Volume is the BitLocker status of a volume of the node
+type Volume struct {
+	// MountPoint is the drive letter of the volume, e.g. C:
+	MountPoint string
+	// VolumeType is OperatingSystem for the volume Windows boots from, Data otherwise
+	VolumeType string
+	// VolumeStatus is the encryption status of the volume
+	VolumeStatus VolumeStatus
+	// ProtectionStatus is On once the volume is encrypted and its key protectors are enabled, Off otherwise
+	ProtectionStatus string
+	// EncryptionPercentage is the share of the volume encrypted so far
+	EncryptionPercentage float64
+	// AutoUnlockEnabled is true if a data volume is unlocked at boot with a key stored on the operating system volume
+	AutoUnlockEnabled bool
+	// KeyProtectors are the types of the key protectors of the volume, e.g. Tpm or RecoveryPassword
+	KeyProtectors []string
+	// TPMReady is true if the node has a TPM ready to protect the operating system volume
+	TPMReady bool `json:"TpmReady"`
+}
+
+// Get queries the BitLocker status of the volume with the given drive letter, e.g. C:. It fails if the BitLocker
+// feature is not installed on the node.
+func Get(mountPoint string) (*Volume, error) {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		statusScript(mountPoint)).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not query the BitLocker status of %s, is the BitLocker feature installed? "+
+			"%v, %s", mountPoint, err, out)
+	}
+	return parseVolume(out)
+}
+
+// statusScript returns the PowerShell script printing the BitLocker status of the given volume as JSON. The enums are
+// converted to their names, which ConvertTo-Json would print as numbers.
+func statusScript(mountPoint string) string {
+	return "$volume = Get-BitLockerVolume -MountPoint " + quote(mountPoint) + " -ErrorAction Stop; " +
+		"$tpm = Get-Tpm -ErrorAction SilentlyContinue; " +
+		"ConvertTo-Json -Compress -InputObject ([pscustomobject]@{" +
+		"MountPoint = $volume.MountPoint; " +
+		"VolumeType = $volume.VolumeType.ToString(); " +
+		"VolumeStatus = $volume.VolumeStatus.ToString(); " +
+		"ProtectionStatus = $volume.ProtectionStatus.ToString(); " +
+		"EncryptionPercentage = $volume.EncryptionPercentage; " +
+		"AutoUnlockEnabled = ($volume.AutoUnlockEnabled -eq $true); " +
+		"KeyProtectors = @($volume.KeyProtector | ForEach-Object { $_.KeyProtectorType.ToString() }); " +
+		"TpmReady = ($tpm -ne $null -and $tpm.TpmReady)})"
+}
+
+// parseVolume parses the BitLocker status printed by statusScript
+func parseVolume(out []byte) (*Volume, error) {
+	var volume Volume
+	if err := json.Unmarshal(out, &volume); err != nil {
+		return nil, fmt.Errorf("could not parse BitLocker status %s: %v", out, err)
+	}
+	return &volume, nil
+}
+
+// OperatingSystem returns true if Windows boots from the volume
+func (v *Volume) OperatingSystem() bool {
+	return v.VolumeType == operatingSystemVolume
+}
+
+// Encrypted returns true if the volume is encrypted or being encrypted, with key protectors
+func (v *Volume) Encrypted() bool {
+	return (v.VolumeStatus == FullyEncrypted || v.VolumeStatus == EncryptionInProgress ||
+		v.VolumeStatus == EncryptionPaused) && len(v.KeyProtectors) > 0
+}
+
+// String describes the BitLocker status of the volume
+func (v *Volume) String() string {
+	description := fmt.Sprintf("volume %s is %s", v.MountPoint, v.VolumeStatus)
+	if v.VolumeStatus == EncryptionInProgress || v.VolumeStatus == EncryptionPaused {
+		description += fmt.Sprintf(", %.0f%% encrypted", v.EncryptionPercentage)
+	}
+	return description
+}
+
+// Check returns an error if the volume is not encrypted, if its protection is suspended, which leaves its key in
+// clear on the disk, or if it is a data volume that is not unlocked at boot, which would prevent the kubelet from
+// starting after a reboot. A warning is returned while the volume is being encrypted.
+func (v *Volume) Check() (string, error) {
+	if !v.Encrypted() {
+		return "", fmt.Errorf("%s, expected it to be encrypted with BitLocker", v)
+	}
+	if v.VolumeStatus == FullyEncrypted && v.ProtectionStatus != protectionOn {
+		return "", fmt.Errorf("the BitLocker protection of volume %s is suspended, resume it with Resume-BitLocker",
+			v.MountPoint)
+	}
+	if !v.OperatingSystem() && !v.AutoUnlockEnabled {
+		return "", fmt.Errorf("data volume %s is not unlocked automatically at boot, the kubelet would not start "+
+			"after a reboot", v.MountPoint)
+	}
+	switch v.VolumeStatus {
+	case EncryptionInProgress:
+		return fmt.Sprintf("%s, its data is encrypted as it is written", v), nil
+	case EncryptionPaused:
+		return fmt.Sprintf("%s, resume the encryption with Resume-BitLocker", v), nil
+	default:
+		return "", nil
+	}
+}
+
+// ProtectorKind is the kind of key protector the volumes are encrypted with
+type ProtectorKind string
+
+const (
+	// TPM protects the operating system volume with the TPM of the node, and a data volume with a recovery password,
+	// the volume being unlocked at boot with a key stored on the operating system volume
+	TPM ProtectorKind = "tpm"
+	// PasswordFile protects a data volume with the password held by a file, e.g. written by the cloud-init of the
+	// node from a secret of the cloud provider, the volume being unlocked at boot with a key stored on the operating
+	// system volume
+	PasswordFile ProtectorKind = "password-file"
+)
+
+// Protector is the key protector the volume is encrypted with
+type Protector struct {
+	// Kind is the kind of the protector
+	Kind ProtectorKind
+	// PasswordFile is the file holding the password of a PasswordFile protector
+	PasswordFile string
+}
+
+// ParseProtector parses a protector given as tpm or password-file=<path>
+func ParseProtector(value string) (*Protector, error) {
+	kind := strings.SplitN(value, "=", 2)
+	switch {
+	case value == string(TPM):
+		return &Protector{Kind: TPM}, nil
+	case kind[0] == string(PasswordFile) && len(kind) == 2 && kind[1] != "":
+		return &Protector{Kind: PasswordFile, PasswordFile: kind[1]}, nil
+	default:
+		return nil, fmt.Errorf("invalid BitLocker protector %q, expected %s or %s=<path>", value, TPM, PasswordFile)
+	}
+}
+
+// String returns the protector in the form ParseProtector parses
+func (p *Protector) String() string {
+	if p.Kind == PasswordFile {
+		return string(PasswordFile) + "=" + p.PasswordFile
+	}
+	return string(p.Kind)
+}
+
+// Validate returns an error if the given volume cannot be encrypted with the protector: the operating system volume
+// can only be protected by a TPM that is ready, as nobody can type a password at boot, and a data volume can only be
+// unlocked at boot once the given operating system volume is encrypted.
+func (p *Protector) Validate(volume, osVolume *Volume) error {
+	if volume.OperatingSystem() {
+		if p.Kind != TPM {
+			return fmt.Errorf("operating system volume %s can only be protected by the TPM of the node",
+				volume.MountPoint)
+		}
+		if !volume.TPMReady {
+			return fmt.Errorf("the node has no TPM ready to protect volume %s, enable the virtual TPM of the "+
+				"instance", volume.MountPoint)
+		}
+		return nil
+	}
+	if !osVolume.Encrypted() {
+		return fmt.Errorf("data volume %s cannot be unlocked at boot unless operating system volume %s is "+
+			"encrypted", volume.MountPoint, osVolume.MountPoint)
+	}
+	return nil
+}
+
+// Enable encrypts the given volume with the protector, along with the data written to it from then on. The volume
+// stays usable while it is being encrypted. A data volume is set to be unlocked at boot.
+func (p *Protector) Enable(volume *Volume) error {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		p.enableScript(volume)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not enable BitLocker on volume %s: %v, %s", volume.MountPoint, err, out)
+	}
+	return nil
+}
+
+// enableScript returns the PowerShell script enabling BitLocker on the given volume. Only the used space is
+// encrypted, as the free space of a new volume holds no data, and the hardware test, which needs a reboot, is
+// skipped. The warnings, which show the recovery password, are not printed, and the password of a PasswordFile
+// protector is read by the script rather than passed on its command line.
+func (p *Protector) enableScript(volume *Volume) string {
+	mountPoint := quote(volume.MountPoint)
+	script := "$ErrorActionPreference = 'Stop'; "
+	enable := "Enable-BitLocker -MountPoint " + mountPoint + " -EncryptionMethod " + encryptionMethod +
+		" -UsedSpaceOnly -SkipHardwareTest -WarningAction SilentlyContinue"
+	switch {
+	case volume.OperatingSystem():
+		enable += " -TpmProtector"
+	case p.Kind == PasswordFile:
+		script += "$password = ConvertTo-SecureString -AsPlainText -Force -String " +
+			"(Get-Content -Raw -LiteralPath " + quote(p.PasswordFile) + ").Trim(); "
+		enable += " -PasswordProtector -Password $password"
+	default:
+		enable += " -RecoveryPasswordProtector"
+	}
+	script += enable + " | Out-Null"
+	if !volume.OperatingSystem() {
+		script += "; Enable-BitLockerAutoUnlock -MountPoint " + mountPoint + " | Out-Null"
+	}
+	return script
+}
+
+// quote returns the given string as a single-quoted PowerShell string
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,115 @@
+package bitlocker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseVolume tests the parsing of the BitLocker status printed by the status script
+func TestParseVolume(t *testing.T) {
+	volume, err := parseVolume([]byte(`{"MountPoint":"D:","VolumeType":"Data","VolumeStatus":"EncryptionInProgress",` +
+		`"ProtectionStatus":"Off","EncryptionPercentage":42.5,"AutoUnlockEnabled":true,` +
+		`"KeyProtectors":["RecoveryPassword","ExternalKey"],"TpmReady":false}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Volume{MountPoint: "D:", VolumeType: "Data", VolumeStatus: EncryptionInProgress,
+		ProtectionStatus: "Off", EncryptionPercentage: 42.5, AutoUnlockEnabled: true,
+		KeyProtectors: []string{"RecoveryPassword", "ExternalKey"}}, volume)
+	assert.False(t, volume.OperatingSystem())
+	assert.Equal(t, "volume D: is EncryptionInProgress, 42% encrypted", volume.String())
+
+	_, err = parseVolume([]byte("Get-BitLockerVolume : The term 'Get-BitLockerVolume' is not recognized"))
+	assert.Error(t, err)
+}
+
+// TestCheck tests that the volumes which are not encrypted, whose protection is suspended or which are not unlocked at
+// boot are errors, and that the volumes being encrypted are warnings
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		volume  Volume
+		warning bool
+		err     bool
+	}{
+		{"encrypted", Volume{VolumeType: "OperatingSystem", VolumeStatus: FullyEncrypted, ProtectionStatus: "On",
+			KeyProtectors: []string{"Tpm"}}, false, false},
+		{"decrypted", Volume{VolumeType: "OperatingSystem", VolumeStatus: FullyDecrypted}, false, true},
+		{"being decrypted", Volume{VolumeType: "OperatingSystem", VolumeStatus: DecryptionInProgress,
+			KeyProtectors: []string{"Tpm"}}, false, true},
+		{"suspended", Volume{VolumeType: "OperatingSystem", VolumeStatus: FullyEncrypted, ProtectionStatus: "Off",
+			KeyProtectors: []string{"Tpm"}}, false, true},
+		{"no protector", Volume{VolumeType: "OperatingSystem", VolumeStatus: FullyEncrypted,
+			ProtectionStatus: "On"}, false, true},
+		{"being encrypted", Volume{VolumeType: "OperatingSystem", VolumeStatus: EncryptionInProgress,
+			KeyProtectors: []string{"Tpm"}}, true, false},
+		{"paused", Volume{VolumeType: "OperatingSystem", VolumeStatus: EncryptionPaused,
+			KeyProtectors: []string{"Tpm"}}, true, false},
+		{"data unlocked at boot", Volume{VolumeType: "Data", VolumeStatus: FullyEncrypted, ProtectionStatus: "On",
+			AutoUnlockEnabled: true, KeyProtectors: []string{"Password", "ExternalKey"}}, false, false},
+		{"data locked at boot", Volume{VolumeType: "Data", VolumeStatus: FullyEncrypted, ProtectionStatus: "On",
+			KeyProtectors: []string{"Password"}}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warning, err := test.volume.Check()
+			assert.Equal(t, test.err, err != nil, "unexpected error %v", err)
+			assert.Equal(t, test.warning, warning != "", "unexpected warning %q", warning)
+		})
+	}
+}
+
+// TestParseProtector tests the parsing of the protectors
+func TestParseProtector(t *testing.T) {
+	protector, err := ParseProtector("tpm")
+	require.NoError(t, err)
+	assert.Equal(t, &Protector{Kind: TPM}, protector)
+	protector, err = ParseProtector(`password-file=C:\k\bitlocker=password`)
+	require.NoError(t, err)
+	assert.Equal(t, &Protector{Kind: PasswordFile, PasswordFile: `C:\k\bitlocker=password`}, protector)
+	assert.Equal(t, `password-file=C:\k\bitlocker=password`, protector.String())
+
+	for _, invalid := range []string{"", "TPM", "password-file", "password-file=", "recovery-password"} {
+		_, err = ParseProtector(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestValidate tests that the operating system volume requires a TPM and that a data volume requires the operating
+// system volume to be encrypted
+func TestValidate(t *testing.T) {
+	osVolume := &Volume{MountPoint: "C:", VolumeType: "OperatingSystem", VolumeStatus: FullyDecrypted, TPMReady: true}
+	data := &Volume{MountPoint: "D:", VolumeType: "Data", VolumeStatus: FullyDecrypted}
+	tpm := &Protector{Kind: TPM}
+	password := &Protector{Kind: PasswordFile, PasswordFile: `C:\k\bitlocker-password`}
+
+	assert.NoError(t, tpm.Validate(osVolume, osVolume))
+	assert.Error(t, password.Validate(osVolume, osVolume), "a password cannot be typed at boot")
+	assert.Error(t, tpm.Validate(&Volume{MountPoint: "C:", VolumeType: "OperatingSystem"}, osVolume),
+		"the node has no TPM")
+	assert.Error(t, password.Validate(data, osVolume), "the data volume cannot be unlocked at boot")
+
+	osVolume.VolumeStatus, osVolume.KeyProtectors = EncryptionInProgress, []string{"Tpm"}
+	assert.NoError(t, password.Validate(data, osVolume))
+	assert.NoError(t, tpm.Validate(data, osVolume))
+}
+
+// TestEnableScript tests the scripts enabling BitLocker with the protectors on the operating system and data volumes
+func TestEnableScript(t *testing.T) {
+	osVolume := &Volume{MountPoint: "C:", VolumeType: "OperatingSystem"}
+	data := &Volume{MountPoint: "D:", VolumeType: "Data"}
+	tpm := &Protector{Kind: TPM}
+	password := &Protector{Kind: PasswordFile, PasswordFile: `C:\k\node's password`}
+
+	assert.Equal(t, "$ErrorActionPreference = 'Stop'; Enable-BitLocker -MountPoint 'C:' -EncryptionMethod XtsAes256 "+
+		"-UsedSpaceOnly -SkipHardwareTest -WarningAction SilentlyContinue -TpmProtector | Out-Null",
+		tpm.enableScript(osVolume))
+	assert.Equal(t, "$ErrorActionPreference = 'Stop'; Enable-BitLocker -MountPoint 'D:' -EncryptionMethod XtsAes256 "+
+		"-UsedSpaceOnly -SkipHardwareTest -WarningAction SilentlyContinue -RecoveryPasswordProtector | Out-Null; "+
+		"Enable-BitLockerAutoUnlock -MountPoint 'D:' | Out-Null", tpm.enableScript(data))
+	assert.Equal(t, "$ErrorActionPreference = 'Stop'; $password = ConvertTo-SecureString -AsPlainText -Force "+
+		"-String (Get-Content -Raw -LiteralPath 'C:\\k\\node''s password').Trim(); Enable-BitLocker -MountPoint 'D:' "+
+		"-EncryptionMethod XtsAes256 -UsedSpaceOnly -SkipHardwareTest -WarningAction SilentlyContinue "+
+		"-PasswordProtector -Password $password | Out-Null; Enable-BitLockerAutoUnlock -MountPoint 'D:' | Out-Null",
+		password.enableScript(data))
+}
@@ -0,0 +1,37 @@
+package bootstrapper
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/activation"
+)
+
+// SkipActivationCheck disables the preflight check of the Windows activation status, e.g. for short-lived test nodes
+// running an evaluation image
+func (wmcb *winNodeBootstrapper) SkipActivationCheck() {
+	wmcb.skipActivationCheck = true
+}
+
+// Warnings returns the issues found by the preflight checks that did not prevent the kubelet from being initialized
+func (wmcb *winNodeBootstrapper) Warnings() []string {
+	return wmcb.warnings
+}
+
+// preflightActivation returns an error if the node shuts down periodically because its evaluation or activation grace
+// period ended, which would make it flap in the cluster. A warning is recorded if the period is about to end, or if
+// the activation status cannot be queried.
+func (wmcb *winNodeBootstrapper) preflightActivation() error {
+	status, err := activation.Get()
+	if err != nil {
+		wmcb.warnings = append(wmcb.warnings, fmt.Sprintf("could not check Windows activation: %v", err))
+		return nil
+	}
+	warning, err := status.Check(activation.DefaultWarningPeriod)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		wmcb.warnings = append(wmcb.warnings, warning)
+	}
+	return nil
+}
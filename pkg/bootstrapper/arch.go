@@ -0,0 +1,103 @@
+package bootstrapper
+
+import (
+	"debug/pe"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// machineArchitectures maps the machine types of Windows executables to the GOARCH names of the architectures
+var machineArchitectures = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+}
+
+// isWow64Process2 is the kernel32 procedure used to query the native architecture of the node. It is not present
+// before Windows 10 1511.
+var isWow64Process2 = windows.NewLazySystemDLL("kernel32.dll").NewProc("IsWow64Process2")
+
+// hostArchitecture returns the native architecture of the node. The architecture WMCB was built for is not used as it
+// can differ from the native one, for example an amd64 WMCB runs emulated on arm64 nodes.
+func hostArchitecture() string {
+	if isWow64Process2.Find() != nil {
+		return runtime.GOARCH
+	}
+	currentProcess, err := windows.GetCurrentProcess()
+	if err != nil {
+		return runtime.GOARCH
+	}
+	var processMachine, nativeMachine uint16
+	ret, _, _ := isWow64Process2.Call(uintptr(currentProcess), uintptr(unsafe.Pointer(&processMachine)),
+		uintptr(unsafe.Pointer(&nativeMachine)))
+	if ret == 0 {
+		return runtime.GOARCH
+	}
+	if arch, found := machineArchitectures[nativeMachine]; found {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// binaryArchitecture returns the architecture the given Windows executable was built for
+func binaryArchitecture(path string) (string, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s as a Windows executable: %v", path, err)
+	}
+	defer f.Close()
+
+	arch, found := machineArchitectures[f.Machine]
+	if !found {
+		return "", fmt.Errorf("%s has unknown machine type 0x%x", path, f.Machine)
+	}
+	return arch, nil
+}
+
+// ensureBinaryArchitecture returns an error if the given Windows executable was not built for the given architecture.
+// Emulated binaries are refused as the node components are not supported under emulation.
+func ensureBinaryArchitecture(path, arch string) error {
+	binaryArch, err := binaryArchitecture(path)
+	if err != nil {
+		return err
+	}
+	if binaryArch != arch {
+		return fmt.Errorf("%s is built for %s and cannot be run on this %s node", path, binaryArch, arch)
+	}
+	return nil
+}
+
+// ensurePluginArchitectures returns an error if any of the CNI or credential provider plugin executables to be
+// configured was not built for the architecture of the node
+func (wmcb *winNodeBootstrapper) ensurePluginArchitectures() error {
+	arch := hostArchitecture()
+	var binaries []string
+	if wmcb.cni != nil {
+		files, err := ioutil.ReadDir(wmcb.cni.dir)
+		if err != nil {
+			return fmt.Errorf("error reading CNI dir %s: %v", wmcb.cni.dir, err)
+		}
+		for _, file := range files {
+			if !file.IsDir() && strings.EqualFold(filepath.Ext(file.Name()), ".exe") {
+				binaries = append(binaries, filepath.Join(wmcb.cni.dir, file.Name()))
+			}
+		}
+	}
+	if wmcb.credentialProvider != nil {
+		binaries = append(binaries, wmcb.credentialProvider.binary)
+	}
+
+	for _, binary := range binaries {
+		if err := ensureBinaryArchitecture(binary, arch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
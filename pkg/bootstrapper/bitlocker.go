@@ -0,0 +1,125 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bitlocker"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+)
+
+const (
+	// BitLockerVerify fails the bootstrap if the data volume of the node is not encrypted with BitLocker
+	BitLockerVerify = "verify"
+	// BitLockerEnable encrypts the data volume of the node with BitLocker if it is not encrypted yet
+	BitLockerEnable = "enable"
+)
+
+// bitLockerOptions holds the BitLocker configuration of the data volume of the node
+type bitLockerOptions struct {
+	// mode is BitLockerVerify or BitLockerEnable
+	mode string
+	// protector is the key protector the data volume is encrypted with in the BitLockerEnable mode
+	protector *bitlocker.Protector
+	// volume is the BitLocker status of the data volume, queried by the preflight check
+	volume *bitlocker.Volume
+}
+
+// SetBitLockerOptions sets whether the data volume of the node, the volume of the kubelet root directory, has to be
+// encrypted with BitLocker: BitLockerVerify fails the bootstrap if it is not, BitLockerEnable encrypts it with the
+// given protector, tpm or password-file=<path>, if it is not. A data volume other than the operating system volume
+// requires the operating system volume, which holds the container runtime data, to be encrypted as well.
+func (wmcb *winNodeBootstrapper) SetBitLockerOptions(mode, protector string) error {
+	options := &bitLockerOptions{mode: mode}
+	switch mode {
+	case BitLockerVerify:
+	case BitLockerEnable:
+		var err error
+		if options.protector, err = bitlocker.ParseProtector(protector); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid BitLocker mode %q, expected %s or %s", mode, BitLockerVerify, BitLockerEnable)
+	}
+	wmcb.bitLocker = options
+	return nil
+}
+
+// dataVolume returns the drive letter of the volume the kubelet keeps its state in, e.g. C:
+func (wmcb *winNodeBootstrapper) dataVolume() string {
+	rootDir := defaultKubeletRootDir
+	if wmcb.kubeletDirs != nil {
+		rootDir = wmcb.kubeletDirs.rootDir
+	}
+	return strings.ToUpper(filepath.VolumeName(rootDir))
+}
+
+// preflightBitLocker returns an error if the data volume is not encrypted in the BitLockerVerify mode, or if it cannot
+// be encrypted with the protector in the BitLockerEnable mode. A warning is recorded while the volume is being
+// encrypted.
+func (wmcb *winNodeBootstrapper) preflightBitLocker() error {
+	volume, err := bitlocker.Get(wmcb.dataVolume())
+	if err != nil {
+		return err
+	}
+	wmcb.bitLocker.volume = volume
+	if wmcb.bitLocker.mode == BitLockerVerify || volume.Encrypted() {
+		return wmcb.checkBitLocker(volume)
+	}
+
+	osVolume := volume
+	if !volume.OperatingSystem() {
+		if osVolume, err = bitlocker.Get(os.Getenv("SystemDrive")); err != nil {
+			return err
+		}
+	}
+	protector := wmcb.bitLocker.protector
+	if err = protector.Validate(volume, osVolume); err != nil {
+		return err
+	}
+	if protector.Kind == bitlocker.PasswordFile {
+		if _, err = os.Stat(protector.PasswordFile); err != nil {
+			return fmt.Errorf("could not read the BitLocker password: %v", err)
+		}
+	}
+	return nil
+}
+
+// enableBitLocker encrypts the data volume with the protector in the BitLockerEnable mode, unless it is encrypted
+// already. The kubelet and the container runtime keep running while the volume is encrypted, the data they write
+// being encrypted from then on.
+func (wmcb *winNodeBootstrapper) enableBitLocker() error {
+	volume := wmcb.bitLocker.volume
+	if wmcb.bitLocker.mode != BitLockerEnable || volume.Encrypted() {
+		return nil
+	}
+	protector := wmcb.bitLocker.protector
+	if err := protector.Enable(volume); err != nil {
+		return err
+	}
+	if err := wmcb.record(journal.Modified, journal.Setting, "bitlocker-"+volume.MountPoint,
+		fmt.Sprintf("encrypted with the %s protector", protector.Kind)); err != nil {
+		return err
+	}
+	volume, err := bitlocker.Get(volume.MountPoint)
+	if err != nil {
+		return err
+	}
+	wmcb.bitLocker.volume = volume
+	return wmcb.checkBitLocker(volume)
+}
+
+// checkBitLocker returns an error if the given volume is not encrypted, and records a warning while it is being
+// encrypted
+func (wmcb *winNodeBootstrapper) checkBitLocker(volume *bitlocker.Volume) error {
+	warning, err := volume.Check()
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		wmcb.warnings = append(wmcb.warnings, warning)
+	}
+	return nil
+}
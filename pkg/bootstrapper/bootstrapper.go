@@ -3,6 +3,7 @@ package bootstrapper
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	ignitionv2 "github.com/coreos/ignition/config/v2_2"
@@ -16,6 +17,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/util/yaml"
@@ -45,7 +50,9 @@ const (
 	kubeletPauseContainerImage = "mcr.microsoft.com/k8s/core/pause:1.2.0"
 	// serviceWaitTime is an arbitrary amount of time to wait for the Windows service API to complete requests
 	serviceWaitTime = time.Second * 10
-	// certDirectory is where the kubelet will look for certificates
+	// servicePollInterval is the time between two checks of the state of a Windows service
+	servicePollInterval = 300 * time.Millisecond
+	// certDirectory is where the kubelet will look for certificates, unless set by SetKubeletDirOptions
 	certDirectory = "c:\\var\\lib\\kubelet\\pki\\"
 	// cloudConfigOption is kubelet CLI option for cloud configuration
 	cloudConfigOption = "cloud-config"
@@ -124,13 +131,42 @@ type winNodeBootstrapper struct {
 	svcMgr *mgr.Mgr
 	// installDir is the directory the the kubelet service will be installed
 	installDir string
-	// logDir is the directory that captures log outputs of Kubelet
+	// logDir is the directory that captures log outputs of Kubelet, see SetLogOptions
 	// TODO: make this directory available in Artifacts
 	logDir string
 	// kubeletArgs is a map of the variable arguments that will be passed to the kubelet
 	kubeletArgs map[string]string
 	// cni holds all the CNI specific information
 	cni *cniOptions
+	// credentialProvider holds the kubelet image credential provider plugin information
+	credentialProvider *credentialProviderOptions
+	// dns holds the DNS configuration overrides of the node
+	dns *dnsOptions
+	// memory holds the pagefile and eviction configuration of the node
+	memory *memoryOptions
+	// isolation holds the container isolation configuration of the node
+	isolation *isolationOptions
+	// nodeIP holds the IP family and the addresses of the node
+	nodeIP *nodeIPOptions
+	// providerID holds the provider ID of the node
+	providerID *providerIDOptions
+	// containerRuntime is the container runtime of the node, empty to leave the kubelet defaults
+	containerRuntime containerruntime.Runtime
+	// kubelet holds the feature gates and extra arguments passed through to the kubelet
+	kubelet *kubeletOptions
+	// kubeletDirs holds the root, certificate and static pod manifest directories of the kubelet
+	kubeletDirs *kubeletDirOptions
+	// bitLocker holds the BitLocker configuration of the data volume of the node
+	bitLocker *bitLockerOptions
+	// journal records the changes made to the node
+	journal *journal.Journal
+	// skipActivationCheck disables the preflight check of the Windows activation status
+	skipActivationCheck bool
+	// skipPendingRebootCheck disables the preflight check that the node is not pending a reboot
+	skipPendingRebootCheck bool
+	// warnings are the issues found by the preflight checks that did not prevent the kubelet from being initialized,
+	// and the actions left to the user, like the reboot required by a pagefile change
+	warnings []string
 }
 
 // cniOptions is responsible for reconfiguring the kubelet service with CNI configuration
@@ -170,6 +206,7 @@ func NewWinNodeBootstrapper(k8sInstallDir, ignitionFile, kubeletPath string, cni
 		initialKubeletPath: kubeletPath,
 		svcMgr:             svcMgr,
 		kubeletArgs:        make(map[string]string),
+		journal:            NewJournal(k8sInstallDir, commandName()),
 	}
 	// populate the CNI struct if CNI options are present
 	if cniDir != "" && cniConfig != "" {
@@ -240,6 +277,15 @@ func prepKubeletConfForWindows(wmcb *winNodeBootstrapper, initialConfig []byte)
 	cgroupsPerQOS := false
 	config.CgroupsPerQOS = &cgroupsPerQOS
 	config.Authentication.X509.ClientCAFile = filepath.Join(wmcb.installDir, "kubelet-ca.crt")
+	if wmcb.dns != nil {
+		wmcb.dns.applyToKubeletConfig(&config)
+	}
+	if wmcb.memory != nil {
+		wmcb.memory.applyToKubeletConfig(&config)
+	}
+	if wmcb.kubeletDirs != nil {
+		config.StaticPodPath = wmcb.kubeletDirs.manifestDir
+	}
 
 	// We need to set EnforceNodeAllocatable with an empty slice, "enforceNodeAllocatable:[]"
 	// the json tags have the field set as `omitempty`, and the field defaults to enforceNodeAllocatable:["pods"]
@@ -339,6 +385,10 @@ func (wmcb *winNodeBootstrapper) parseIgnitionFileContents(ignitionFileContents
 			if err = ioutil.WriteFile(filePair.dest, newContents, 0644); err != nil {
 				return fmt.Errorf("could not write to %s: %s", filePair.dest, err)
 			}
+			if err = wmcb.record(journal.Created, journal.File, filePair.dest,
+				"translated from "+ignFile.Node.Path); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -362,12 +412,9 @@ func (wmcb *winNodeBootstrapper) initializeKubeletFiles() error {
 
 	// Create the manifest directory needed by kubelet for the static pods, we shouldn't override if the pod manifest
 	// directory already exists
-	podManifestDirectory := filepath.Join(wmcb.installDir, "etc", "kubernetes", "manifests")
-	if _, err := os.Stat(podManifestDirectory); os.IsNotExist(err) {
-		err := os.MkdirAll(podManifestDirectory, os.ModeDir)
-		if err != nil {
-			return fmt.Errorf("could not make pod manifest directory: %s", err)
-		}
+	podManifestDirectory := wmcb.podManifestDir()
+	if err := wmcb.recordDir(podManifestDirectory, os.ModeDir); err != nil {
+		return fmt.Errorf("could not make pod manifest directory: %s", err)
 	}
 
 	err := os.MkdirAll(wmcb.installDir, os.ModeDir)
@@ -379,6 +426,11 @@ func (wmcb *winNodeBootstrapper) initializeKubeletFiles() error {
 		if err != nil {
 			return fmt.Errorf("could not copy kubelet: %s", err)
 		}
+		err = wmcb.record(journal.Created, journal.File, filepath.Join(wmcb.installDir, "kubelet.exe"),
+			"copied from "+wmcb.initialKubeletPath)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Create log directory
@@ -409,15 +461,24 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 	// configuration will be lost. The assumption is that every time initialize-kubelet is run, configure-cni needs to
 	// be run again. This is how the WSU playbook is written and we don't expect users to execute WMCB directly.
 	// TBD: If this is not desirable then it should be fixed in a follow up PR.
+	pauseImage := kubeletPauseContainerImage
+	if wmcb.isolation != nil {
+		pauseImage = wmcb.isolation.pauseContainerImage()
+	}
 	kubeletArgs := []string{
 		"--config=" + wmcb.kubeletConfPath,
 		"--bootstrap-kubeconfig=" + filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
 		"--kubeconfig=" + wmcb.kubeconfigPath,
-		"--pod-infra-container-image=" + kubeletPauseContainerImage,
-		"--cert-dir=" + certDirectory,
+		"--pod-infra-container-image=" + pauseImage,
+		certDirOption + "=" + wmcb.certDir(),
 		"--windows-service",
 		"--logtostderr=false",
-		"--log-file=" + filepath.Join(wmcb.logDir, "kubelet.log"),
+		"--log-file=" + filepath.Join(wmcb.logDir, kubeletLogFile),
+		// Serves the /logs endpoint, which `oc adm node-logs` reads the kubelet log from through the API server
+		enableDebuggingHandlersOption + "=true",
+		// There is no resolv.conf on Windows, an empty value prevents the kubelet from looking for one. The pods get
+		// the cluster DNS settings from the kubelet configuration.
+		resolvOption + "=" + resolvValue,
 		// Registers the Kubelet with Windows specific taints so that linux pods won't get scheduled onto
 		// Windows nodes.
 		// TODO: Write a `against the cluster` e2e test which checks for the Windows node object created
@@ -438,6 +499,28 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 	if nodeWorkerLabel, ok := wmcb.kubeletArgs["node-labels"]; ok {
 		kubeletArgs = append(kubeletArgs, "--"+"node-labels"+"="+nodeWorkerLabel)
 	}
+	if wmcb.isolation != nil {
+		kubeletArgs = append(kubeletArgs, wmcb.isolation.kubeletArgs()...)
+	}
+	if wmcb.nodeIP != nil {
+		kubeletArgs = append(kubeletArgs, wmcb.nodeIP.kubeletArgs()...)
+	}
+	if wmcb.providerID != nil {
+		kubeletArgs = append(kubeletArgs, wmcb.providerID.kubeletArgs()...)
+	}
+	if wmcb.kubeletDirs != nil {
+		kubeletArgs = append(kubeletArgs, wmcb.kubeletDirs.kubeletArgs()...)
+	}
+	var dependencies []string
+	if wmcb.containerRuntime != "" {
+		kubeletArgs = append(kubeletArgs, wmcb.containerRuntime.KubeletArgs()...)
+		// The kubelet is started after the runtime when the node boots
+		dependencies = []string{wmcb.containerRuntime.ServiceName()}
+	}
+	kubeletArgs = mergeFeatureGateArgs(kubeletArgs)
+	if wmcb.kubelet != nil {
+		kubeletArgs = wmcb.kubelet.apply(kubeletArgs)
+	}
 
 	// Mostly default values here
 	c := mgr.Config{
@@ -449,7 +532,7 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 		BinaryPathName:   filepath.Join(wmcb.installDir, "kubelet.exe"),
 		LoadOrderGroup:   "",
 		TagId:            0,
-		Dependencies:     nil,
+		Dependencies:     dependencies,
 		ServiceStartName: "",
 		DisplayName:      "",
 		Password:         "",
@@ -459,6 +542,10 @@ func (wmcb *winNodeBootstrapper) createKubeletService() error {
 	if err != nil {
 		return err
 	}
+	if err = wmcb.record(journal.Created, journal.Service, KubeletServiceName,
+		strings.Join(kubeletArgs, " ")); err != nil {
+		return err
+	}
 	err = wmcb.kubeletSVC.SetRecoveryActions([]mgr.RecoveryAction{
 		{Type: mgr.ServiceRestart, Delay: 5},
 	}, 600)
@@ -496,18 +583,16 @@ func (wmcb *winNodeBootstrapper) controlService(cmd svc.Cmd, desiredState svc.St
 	}
 	// Most of the rest of the function borrowed from the package (golang.org/x/sys/windows/svc/mgr) example
 	// Arbitrary wait time
-	timeout := time.Now().Add(serviceWaitTime)
-	for status.State != desiredState {
-		if timeout.Before(time.Now()) {
-			return fmt.Errorf("timeout waiting for service to go to state=%d", desiredState)
-		}
-		time.Sleep(300 * time.Millisecond)
-		status, err = wmcb.kubeletSVC.Query()
-		if err != nil {
-			return fmt.Errorf("could not retrieve service status: %v", err)
-		}
-	}
-	return nil
+	options := poll.Options{Interval: servicePollInterval, Timeout: serviceWaitTime, Jitter: poll.DefaultJitter}
+	return poll.Until(context.Background(), fmt.Sprintf("service to go to state=%d", desiredState), options,
+		func() (bool, string, error) {
+			if status.State != desiredState {
+				if status, err = wmcb.kubeletSVC.Query(); err != nil {
+					return false, "", fmt.Errorf("could not retrieve service status: %v", err)
+				}
+			}
+			return status.State == desiredState, fmt.Sprintf("state=%d", status.State), nil
+		})
 }
 
 // stopKubeletService stops the kubelet via the Windows service API
@@ -577,41 +662,126 @@ func (wmcb *winNodeBootstrapper) refreshKubeletService(config mgr.Config) error
 	return nil
 }
 
+// preflight runs the checks which have to pass before the kubelet is initialized
+func (wmcb *winNodeBootstrapper) preflight() error {
+	if err := ensureBinaryArchitecture(wmcb.initialKubeletPath, hostArchitecture()); err != nil {
+		return fmt.Errorf("kubelet architecture check failed: %v", err)
+	}
+	if wmcb.memory != nil {
+		if err := wmcb.preflightMemory(); err != nil {
+			return fmt.Errorf("memory preflight check failed: %v", err)
+		}
+	}
+	if wmcb.isolation != nil {
+		if err := wmcb.isolation.preflight(); err != nil {
+			return fmt.Errorf("isolation preflight check failed: %v", err)
+		}
+	}
+	if wmcb.kubeletDirs != nil {
+		if err := wmcb.kubeletDirs.preflight(); err != nil {
+			return fmt.Errorf("kubelet directories preflight check failed: %v", err)
+		}
+	}
+	if wmcb.bitLocker != nil {
+		if err := wmcb.preflightBitLocker(); err != nil {
+			return fmt.Errorf("BitLocker preflight check failed: %v", err)
+		}
+	}
+	if wmcb.containerRuntime != "" {
+		if err := wmcb.preflightContainerRuntime(); err != nil {
+			return fmt.Errorf("container runtime preflight check failed: %v", err)
+		}
+	}
+	if !wmcb.skipActivationCheck {
+		if err := wmcb.preflightActivation(); err != nil {
+			return fmt.Errorf("activation preflight check failed: %v", err)
+		}
+	}
+	if !wmcb.skipPendingRebootCheck {
+		if err := wmcb.preflightPendingReboot(); err != nil {
+			return fmt.Errorf("pending reboot preflight check failed: %v", err)
+		}
+	}
+	return nil
+}
+
 // InitializeKubelet performs the initial kubelet configuration. It sets up the install directory, creates the kubelet
 // service, and then starts the kubelet service
 func (wmcb *winNodeBootstrapper) InitializeKubelet() error {
 	var err error
+	if err = tracing.Phase("preflight checks", wmcb.preflight); err != nil {
+		return err
+	}
+	// The data volume is encrypted before the kubelet writes its state to it
+	if wmcb.bitLocker != nil {
+		if err = tracing.Phase("enable BitLocker", wmcb.enableBitLocker); err != nil {
+			return fmt.Errorf("failed to enable BitLocker: %v", err)
+		}
+	}
 	if wmcb.kubeletSVC != nil {
 		// if the kubelet service exists, we silently remove it and continue, to preserve idempotency
-		err = wmcb.StopAndRemoveServices()
-		if err != nil {
-			return err
-		}
-		// We need to refresh the service to allow the service to be removed by Windows
-		err = wmcb.refreshServiceManager()
+		err = tracing.Phase("remove kubelet service", func() error {
+			if err := wmcb.StopAndRemoveServices(); err != nil {
+				return err
+			}
+			// We need to refresh the service to allow the service to be removed by Windows
+			return wmcb.refreshServiceManager()
+		})
 		if err != nil {
 			return err
 		}
 	}
-	err = wmcb.initializeKubeletFiles()
+	// The link is replaced before the log directory is created, in case the log directory is the link itself
+	if err = tracing.Phase("expose kubelet logs", wmcb.exposeLogs); err != nil {
+		return fmt.Errorf("failed to expose kubelet logs: %v", err)
+	}
+	err = tracing.Phase("initialize kubelet files", wmcb.initializeKubeletFiles)
 	if err != nil {
 		return fmt.Errorf("failed to initialize kubelet: %v", err)
 	}
-	err = wmcb.createKubeletService()
+	// The platform of the node is known once the cloud provider is read from the ignition file
+	if err = tracing.Phase("resolve provider ID", wmcb.resolveProviderID); err != nil {
+		return fmt.Errorf("failed to resolve the provider ID: %v", err)
+	}
+	// The pagefile is configured before the kubelet starts, so that a node rebooted for the change to take effect
+	// comes back with the kubelet already running against the new commit limit
+	if wmcb.memory != nil && wmcb.memory.pagefileSizeMB != pagefileUnchanged {
+		if err = tracing.Phase("configure pagefile", wmcb.memory.configurePagefile); err != nil {
+			return fmt.Errorf("failed to configure pagefile: %v", err)
+		}
+		if err = wmcb.record(journal.Modified, journal.Setting, "pagefile",
+			fmt.Sprintf("size set to %d MB", wmcb.memory.pagefileSizeMB)); err != nil {
+			return err
+		}
+		wmcb.warnings = append(wmcb.warnings, wmcb.memory.rebootWarning())
+	}
+	err = tracing.Phase("create kubelet service", wmcb.createKubeletService)
 	if err != nil {
 		return fmt.Errorf("failed to create kubelet windows service: %v", err)
 	}
-	err = wmcb.startKubeletService()
+	err = tracing.Phase("start kubelet service", wmcb.startKubeletService)
 	if err != nil {
 		return fmt.Errorf("failed to start kubelet windows service: %v", err)
 	}
+	if wmcb.dns != nil && wmcb.dns.configureSearchList {
+		if err = tracing.Phase("configure DNS suffix search list", wmcb.dns.configureSearchListOnHost); err != nil {
+			return fmt.Errorf("failed to configure DNS suffix search list: %v", err)
+		}
+		if err = wmcb.record(journal.Modified, journal.Setting, "dns-suffix-search-list",
+			"added "+strings.Join(wmcb.dns.searchList(), ",")); err != nil {
+			return err
+		}
+	}
+	if err = wmcb.recordInstalledFiles(); err != nil {
+		return fmt.Errorf("failed to record installed files: %v", err)
+	}
 	return nil
 }
 
-// Configure configures the kubelet service for plugins like CNI
+// Configure configures the kubelet service for plugins like CNI and image credential providers
 func (wmcb *winNodeBootstrapper) Configure() error {
 	// TODO: add && wmcb.csi == null check here when we add CSI support
-	if wmcb.cni == nil {
+	if wmcb.cni == nil && wmcb.credentialProvider == nil {
 		return fmt.Errorf("cannot configure without required plugin inputs")
 	}
 
@@ -621,6 +791,10 @@ func (wmcb *winNodeBootstrapper) Configure() error {
 		return fmt.Errorf("kubelet service is not present")
 	}
 
+	if err := wmcb.ensurePluginArchitectures(); err != nil {
+		return fmt.Errorf("plugin architecture check failed: %v", err)
+	}
+
 	// Stop the kubelet service as there could be open file handles from kubelet.exe on the plugin files
 	if err := wmcb.stopKubeletService(); err != nil {
 		return fmt.Errorf("unable to stop kubelet service: %v", err)
@@ -631,15 +805,34 @@ func (wmcb *winNodeBootstrapper) Configure() error {
 		return fmt.Errorf("error getting kubelet service config: %v", err)
 	}
 
-	// TODO: add wmcb.cni != null check here when we add CSI support as this function will be called in both cases
-	if err = wmcb.cni.configure(&config.BinaryPathName); err != nil {
-		return fmt.Errorf("error configuring kubelet service for CNI: %v", err)
+	if wmcb.cni != nil {
+		if err = tracing.Phase("configure CNI", func() error {
+			return wmcb.cni.configure(&config.BinaryPathName)
+		}); err != nil {
+			return fmt.Errorf("error configuring kubelet service for CNI: %v", err)
+		}
 	}
 
-	if err = wmcb.refreshKubeletService(config); err != nil {
+	if wmcb.credentialProvider != nil {
+		if err = tracing.Phase("configure credential provider", func() error {
+			return wmcb.credentialProvider.configure(&config.BinaryPathName)
+		}); err != nil {
+			return fmt.Errorf("error configuring kubelet service for credential provider: %v", err)
+		}
+	}
+
+	if err = tracing.Phase("refresh kubelet service", func() error {
+		return wmcb.refreshKubeletService(config)
+	}); err != nil {
 		return fmt.Errorf("unable to refresh kubelet service: %v", err)
 	}
+	if err = wmcb.recordPlugins(config.BinaryPathName); err != nil {
+		return err
+	}
 
+	if err = wmcb.recordInstalledFiles(); err != nil {
+		return fmt.Errorf("failed to record installed files: %v", err)
+	}
 	return nil
 }
 
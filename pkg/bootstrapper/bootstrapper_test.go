@@ -3,11 +3,17 @@ package bootstrapper
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bitlocker"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -573,3 +579,555 @@ func TestKubeletDirectoriesCreation(t *testing.T) {
 	assert.DirExists(t, podManifestDirectory, "pod manifest directory was not created")
 	assert.DirExists(t, logDirectory, "log directory was not created")
 }
+
+// TestCredentialProvider tests the credential provider functions newCredentialProviderOptions(), configure() and
+// setFeatureGate()
+func TestCredentialProvider(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(installDir)
+	binary, err := ioutil.TempFile(installDir, "ecr-credential-provider*.exe")
+	require.NoError(t, err, "error creating credential provider binary")
+	binary.Close()
+
+	t.Run("invalid inputs", func(t *testing.T) {
+		_, err := newCredentialProviderOptions(installDir, "C:\\DoesNotExist.exe", []string{"*.io"}, time.Hour, nil)
+		require.Error(t, err, "no error on passing bad binary")
+		assert.Contains(t, err.Error(), "error accessing credential provider binary")
+
+		_, err = newCredentialProviderOptions(installDir, binary.Name(), nil, time.Hour, nil)
+		require.Error(t, err, "no error on passing no images to match")
+		assert.Contains(t, err.Error(), "at least one image to match is required")
+
+		_, err = newCredentialProviderOptions(installDir, binary.Name(), []string{"*.io"}, 0, nil)
+		require.Error(t, err, "no error on passing zero cache duration")
+		assert.Contains(t, err.Error(), "invalid default cache duration")
+	})
+
+	t.Run("configure()", func(t *testing.T) {
+		cp, err := newCredentialProviderOptions(installDir, binary.Name(), []string{"*.dkr.ecr.*.amazonaws.com"},
+			12*time.Hour, nil)
+		require.NoError(t, err, "error initializing credential provider options")
+
+		kubeletCmd := "c:\\k\\kubelet.exe --config=c:\\k\\kubelet.conf --windows-service " +
+			"--feature-gates=RotateKubeletServerCertificate=true"
+		require.NoError(t, cp.configure(&kubeletCmd), "error configuring credential provider")
+
+		assert.FileExists(t, filepath.Join(cp.binDir, filepath.Base(binary.Name())), "binary was not copied")
+		config, err := ioutil.ReadFile(cp.configPath)
+		require.NoError(t, err, "error reading credential provider config")
+		assert.Contains(t, string(config), "\"kind\": \"CredentialProviderConfig\"")
+		assert.Contains(t, string(config), "\"name\": \""+strings.TrimSuffix(filepath.Base(binary.Name()), ".exe")+"\"")
+		assert.Contains(t, string(config), "\"defaultCacheDuration\": \"12h0m0s\"")
+
+		assert.Contains(t, kubeletCmd, " --image-credential-provider-config="+cp.configPath)
+		assert.Contains(t, kubeletCmd, " --image-credential-provider-bin-dir="+cp.binDir)
+		assert.Contains(t, kubeletCmd,
+			" --feature-gates=RotateKubeletServerCertificate=true,KubeletCredentialProviders=true")
+	})
+
+	t.Run("setFeatureGate()", func(t *testing.T) {
+		assert.Equal(t, "A=true", setFeatureGate("", "A", true))
+		assert.Equal(t, "B=true,A=false", setFeatureGate("A=true,B=true", "A", false))
+	})
+
+	t.Run("checkCredentialProviderSupport()", func(t *testing.T) {
+		err := checkCredentialProviderSupport("Kubernetes v1.16.2\r\n")
+		require.Error(t, err, "no error on kubelet older than 1.20")
+		assert.Contains(t, err.Error(), "kubelet Kubernetes v1.16.2 does not support credential provider plugins")
+
+		err = checkCredentialProviderSupport("")
+		require.Error(t, err, "no error on unknown kubelet version")
+		assert.Contains(t, err.Error(), "could not determine the kubelet version")
+
+		assert.NoError(t, checkCredentialProviderSupport("Kubernetes v1.20.0"))
+		assert.NoError(t, checkCredentialProviderSupport("Kubernetes v1.21.1+4a5f1c7"))
+	})
+
+	t.Run("kubelet without version refused", func(t *testing.T) {
+		wnb := winNodeBootstrapper{installDir: installDir}
+		err := wnb.SetCredentialProvider(binary.Name(), []string{"*.io"}, time.Hour, nil)
+		require.Error(t, err, "no error on configuring the credential provider without a supported kubelet")
+		assert.Contains(t, err.Error(), "cannot configure the credential provider")
+	})
+}
+
+// TestDNSOptions tests that the DNS options are validated and applied to the kubelet configuration
+func TestDNSOptions(t *testing.T) {
+	t.Run("invalid inputs", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		err := wnb.SetDNSOptions([]string{"172.30.0.300"}, "", false)
+		require.Error(t, err, "no error on passing invalid cluster DNS IP")
+		assert.Contains(t, err.Error(), "invalid cluster DNS IP address")
+
+		err = wnb.SetDNSOptions(nil, "Cluster_Local", false)
+		require.Error(t, err, "no error on passing invalid cluster domain")
+		assert.Contains(t, err.Error(), "invalid cluster domain")
+	})
+
+	t.Run("overrides applied to kubelet config", func(t *testing.T) {
+		wnb := winNodeBootstrapper{installDir: `C:\k`}
+		require.NoError(t, wnb.SetDNSOptions([]string{"172.30.0.53"}, "example.local", false))
+		out, err := prepKubeletConfForWindows(&wnb, []byte(`{"kind":"KubeletConfiguration",`+
+			`"apiVersion":"kubelet.config.k8s.io/v1beta1","clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"]}`))
+		require.NoError(t, err)
+		assert.Contains(t, string(out), `"clusterDomain":"example.local","clusterDNS":["172.30.0.53"]`)
+		assert.Equal(t, []string{"svc.example.local", "example.local"}, wnb.dns.searchList())
+	})
+
+	t.Run("cluster domain taken from kubelet config", func(t *testing.T) {
+		wnb := winNodeBootstrapper{installDir: `C:\k`}
+		require.NoError(t, wnb.SetDNSOptions(nil, "", true))
+		out, err := prepKubeletConfForWindows(&wnb, []byte(`{"kind":"KubeletConfiguration",`+
+			`"apiVersion":"kubelet.config.k8s.io/v1beta1","clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"]}`))
+		require.NoError(t, err)
+		assert.Contains(t, string(out), `"clusterDomain":"cluster.local","clusterDNS":["172.30.0.10"]`)
+		assert.Equal(t, "cluster.local", wnb.dns.clusterDomain)
+	})
+
+	t.Run("mergeSearchList()", func(t *testing.T) {
+		assert.Equal(t, []string{"ec2.internal", "svc.cluster.local", "cluster.local"},
+			mergeSearchList([]string{"ec2.internal", "svc.cluster.local"}, []string{"svc.cluster.local", "cluster.local"}))
+	})
+}
+
+// TestMemoryOptions tests that the pagefile and eviction options are validated, applied to the kubelet configuration
+// and verified against the node memory
+func TestMemoryOptions(t *testing.T) {
+	t.Run("invalid inputs", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		err := wnb.SetMemoryOptions(-2, "")
+		require.Error(t, err, "no error on passing invalid pagefile size")
+		assert.Contains(t, err.Error(), "invalid pagefile size")
+
+		err = wnb.SetMemoryOptions(-1, "memory.available")
+		require.Error(t, err, "no error on passing threshold without quantity")
+		assert.Contains(t, err.Error(), "invalid eviction threshold")
+
+		err = wnb.SetMemoryOptions(-1, "memory.available<lots")
+		require.Error(t, err, "no error on passing invalid quantity")
+		assert.Contains(t, err.Error(), "invalid eviction threshold quantity")
+	})
+
+	t.Run("eviction thresholds applied to kubelet config", func(t *testing.T) {
+		wnb := winNodeBootstrapper{installDir: `C:\k`}
+		require.NoError(t, wnb.SetMemoryOptions(-1, "memory.available<500Mi,nodefs.available<10%"))
+		out, err := prepKubeletConfForWindows(&wnb, []byte(`{"kind":"KubeletConfiguration",`+
+			`"apiVersion":"kubelet.config.k8s.io/v1beta1","evictionHard":{"imagefs.available":"15%"}}`))
+		require.NoError(t, err)
+		assert.Contains(t, string(out),
+			`"evictionHard":{"imagefs.available":"15%","memory.available":"500Mi","nodefs.available":"10%"}`)
+	})
+
+	t.Run("preflight()", func(t *testing.T) {
+		gi := uint64(1024 * 1024 * 1024)
+		m := &memoryOptions{pagefileSizeMB: 0, evictionHard: map[string]string{}}
+		assert.Error(t, m.preflight(4*gi), "no error disabling pagefile on small node")
+		assert.NoError(t, m.preflight(16*gi), "error disabling pagefile on large node")
+
+		m = &memoryOptions{pagefileSizeMB: -1, evictionHard: map[string]string{"memory.available": "5Gi"}}
+		assert.Error(t, m.preflight(4*gi), "no error with threshold exceeding node memory")
+		assert.NoError(t, m.preflight(8*gi), "error with threshold below node memory")
+
+		m.evictionHard["memory.available"] = "100%"
+		assert.Error(t, m.preflight(8*gi), "no error with 100% threshold")
+	})
+
+	t.Run("rebootWarning()", func(t *testing.T) {
+		assert.Equal(t, "reboot required: the pagefile was set to 4096 MB, which only takes effect after the node is "+
+			"rebooted", (&memoryOptions{pagefileSizeMB: 4096}).rebootWarning())
+		assert.Contains(t, (&memoryOptions{pagefileSizeMB: 0}).rebootWarning(), "the pagefile was disabled")
+	})
+}
+
+// TestIsolationOptions tests that the isolation options are validated and translated into kubelet arguments
+func TestIsolationOptions(t *testing.T) {
+	t.Run("invalid inputs", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		err := wnb.SetIsolationOptions("hyper-v", "")
+		require.Error(t, err, "no error on passing invalid isolation")
+		assert.Contains(t, err.Error(), "invalid container isolation")
+	})
+
+	tests := []struct {
+		name               string
+		isolation          string
+		pauseImage         string
+		expectedPauseImage string
+		expectedArgs       []string
+	}{
+		{"process isolation", ProcessIsolation, "", kubeletPauseContainerImage, nil},
+		{"hyperv isolation", HyperVIsolation, "", kubeletPauseContainerImage,
+			[]string{"--feature-gates=HyperVContainer=true"}},
+		{"hyperv isolation with pause image", HyperVIsolation, "mcr.microsoft.com/oss/kubernetes/pause:1.4.0",
+			"mcr.microsoft.com/oss/kubernetes/pause:1.4.0", []string{"--feature-gates=HyperVContainer=true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wnb := winNodeBootstrapper{}
+			require.NoError(t, wnb.SetIsolationOptions(tt.isolation, tt.pauseImage))
+			assert.Equal(t, tt.expectedPauseImage, wnb.isolation.pauseContainerImage())
+			assert.Equal(t, tt.expectedArgs, wnb.isolation.kubeletArgs())
+		})
+	}
+
+	t.Run("feature gate preserved by credential provider", func(t *testing.T) {
+		i := &isolationOptions{isolation: HyperVIsolation}
+		kubeletCmd := "c:\\k\\kubelet.exe --windows-service " + strings.Join(i.kubeletArgs(), " ")
+		cp := &credentialProviderOptions{configPath: "c:\\k\\config.yaml", binDir: "c:\\k\\bin"}
+		require.NoError(t, cp.updateKubeletArgs(&kubeletCmd))
+		assert.Contains(t, kubeletCmd, "--feature-gates=HyperVContainer=true,KubeletCredentialProviders=true")
+	})
+}
+
+// TestLogOptions tests that the log directory of the kubelet is validated
+func TestLogOptions(t *testing.T) {
+	wnb := winNodeBootstrapper{logDir: `C:\k\log`}
+	err := wnb.SetLogOptions(`var\log\kubelet`)
+	require.Error(t, err, "no error on passing relative log directory")
+	assert.Contains(t, err.Error(), "expected an absolute path")
+
+	err = wnb.SetLogOptions(`C:\var\log\kube let`)
+	require.Error(t, err, "no error on passing log directory with spaces")
+	assert.Contains(t, err.Error(), "spaces and quotes are not supported")
+	assert.Equal(t, `C:\k\log`, wnb.logDir, "log directory changed by invalid input")
+
+	require.NoError(t, wnb.SetLogOptions(`C:\var\log\kubelet\`))
+	assert.Equal(t, `C:\var\log\kubelet`, wnb.logDir)
+}
+
+// TestUnderNodeLogDir tests that only the log directories under c:\var\log are served by the kubelet without a link
+func TestUnderNodeLogDir(t *testing.T) {
+	assert.True(t, underNodeLogDir(`C:\var\log\kubelet`))
+	assert.True(t, underNodeLogDir(`c:\var\log\`))
+	assert.False(t, underNodeLogDir(`C:\k\log`))
+	assert.False(t, underNodeLogDir(`C:\var\logs`))
+	assert.False(t, underNodeLogDir(`D:\var\log\kubelet`))
+}
+
+// TestKubeletDirOptions tests the validation of the kubelet directories and their propagation into the kubelet
+// configuration and arguments, including through the CNI configuration
+func TestKubeletDirOptions(t *testing.T) {
+	invalid := []struct {
+		name          string
+		rootDir       string
+		certDir       string
+		manifestDir   string
+		expectedError string
+	}{
+		{"relative root dir", `var\lib\kubelet`, "", "", "expected an absolute path"},
+		{"root dir without drive", `\var\lib\kubelet`, "", "", "expected an absolute path"},
+		{"cert dir with spaces", "", `D:\kubelet certs`, "", "spaces and quotes are not supported"},
+		{"manifest dir in root dir", `D:\kubelet`, "", `d:\Kubelet\manifests`, "cannot hold one another"},
+		{"cert dir in manifest dir", "", `D:\manifests\pki`, `D:\manifests`, "cannot hold one another"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			wnb := winNodeBootstrapper{installDir: `C:\k`}
+			err := wnb.SetKubeletDirOptions(tt.rootDir, tt.certDir, tt.manifestDir)
+			require.Error(t, err, "no error on passing invalid kubelet directories")
+			assert.Contains(t, err.Error(), tt.expectedError)
+			assert.Nil(t, wnb.kubeletDirs, "kubelet directories set by invalid input")
+		})
+	}
+
+	t.Run("default layout", func(t *testing.T) {
+		wnb := winNodeBootstrapper{installDir: `C:\k`}
+		assert.Equal(t, certDirectory, wnb.certDir())
+		assert.Equal(t, `C:\k\etc\kubernetes\manifests`, wnb.podManifestDir())
+		require.NoError(t, wnb.SetKubeletDirOptions("", "", ""))
+		assert.Empty(t, wnb.kubeletDirs.kubeletArgs(), "default root dir passed to the kubelet")
+	})
+
+	t.Run("non-default layout", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "wmcb")
+		require.NoError(t, err, "error creating temp directory")
+		defer os.RemoveAll(dir)
+		rootDir := filepath.Join(dir, "kubelet")
+		manifestDir := filepath.Join(dir, "manifests")
+
+		wnb := winNodeBootstrapper{installDir: dir, logDir: filepath.Join(dir, "log"),
+			kubeletArgs: make(map[string]string)}
+		require.NoError(t, wnb.SetKubeletDirOptions(rootDir+`\`, "", manifestDir))
+		assert.Equal(t, filepath.Join(rootDir, "pki"), wnb.certDir())
+		assert.Equal(t, []string{"--root-dir=" + rootDir}, wnb.kubeletDirs.kubeletArgs())
+		require.NoError(t, wnb.kubeletDirs.preflight())
+
+		require.NoError(t, wnb.initializeKubeletFiles())
+		assert.DirExists(t, manifestDir, "pod manifest directory was not created")
+
+		config, err := prepKubeletConfForWindows(&wnb, []byte(`{"kind":"KubeletConfiguration",`+
+			`"apiVersion":"kubelet.config.k8s.io/v1beta1","staticPodPath":"/etc/kubernetes/manifests"}`))
+		require.NoError(t, err)
+		assert.Contains(t, string(config), `"staticPodPath":"`+strings.ReplaceAll(manifestDir, `\`, `\\`)+`"`)
+
+		// configure-cni rebuilds the kubelet command, which keeps the directories
+		kubeletCmd := "c:\\k\\kubelet.exe --windows-service --cert-dir=" + wnb.certDir() + " " +
+			strings.Join(wnb.kubeletDirs.kubeletArgs(), " ")
+		cni := &cniOptions{binDir: `c:\k\cni`, confDir: `c:\k\cni\config`}
+		require.NoError(t, cni.updateKubeletArgs(&kubeletCmd))
+		assert.Contains(t, kubeletCmd, " --root-dir="+rootDir)
+		assert.Contains(t, kubeletCmd, " --cert-dir="+filepath.Join(rootDir, "pki"))
+		assert.Equal(t, filepath.Join(rootDir, "pki"), wnb.installedCertDir())
+	})
+
+	t.Run("missing drive", func(t *testing.T) {
+		k := &kubeletDirOptions{rootDir: `Q:\kubelet`, certDir: `Q:\kubelet\pki`, manifestDir: `C:\k\manifests`}
+		if _, err := os.Stat(`Q:\`); err == nil {
+			t.Skip("drive Q: exists")
+		}
+		err := k.preflight()
+		require.Error(t, err, "no error on passing a directory on a missing drive")
+		assert.Contains(t, err.Error(), "drive Q:")
+	})
+}
+
+// TestContainerRuntimeOptions tests the validation of the container runtime of the node
+func TestContainerRuntimeOptions(t *testing.T) {
+	wnb := winNodeBootstrapper{}
+	err := wnb.SetContainerRuntimeOptions("cri-o")
+	require.Error(t, err, "no error on passing unknown container runtime")
+	assert.Contains(t, err.Error(), "unknown container runtime")
+	assert.Empty(t, wnb.containerRuntime, "container runtime changed by invalid input")
+
+	require.NoError(t, wnb.SetContainerRuntimeOptions("containerd"))
+	assert.Equal(t, containerruntime.Containerd, wnb.containerRuntime)
+	require.NoError(t, wnb.SetContainerRuntimeOptions("Docker"))
+	assert.Equal(t, containerruntime.Docker, wnb.containerRuntime)
+}
+
+// TestBitLockerOptions tests the validation of the BitLocker mode and protector, and that the data volume is the
+// volume of the kubelet root directory
+func TestBitLockerOptions(t *testing.T) {
+	wnb := winNodeBootstrapper{installDir: `C:\k`}
+	for _, invalid := range [][2]string{{"encrypt", "tpm"}, {BitLockerEnable, "recovery-password"},
+		{BitLockerEnable, "password-file="}} {
+		assert.Error(t, wnb.SetBitLockerOptions(invalid[0], invalid[1]), "no error on passing %v", invalid)
+		assert.Nil(t, wnb.bitLocker, "BitLocker options set by invalid input")
+	}
+
+	require.NoError(t, wnb.SetBitLockerOptions(BitLockerVerify, ""))
+	assert.Nil(t, wnb.bitLocker.protector)
+	require.NoError(t, wnb.SetBitLockerOptions(BitLockerEnable, `password-file=C:\k\bitlocker-password`))
+	assert.Equal(t, &bitlocker.Protector{Kind: bitlocker.PasswordFile, PasswordFile: `C:\k\bitlocker-password`},
+		wnb.bitLocker.protector)
+
+	assert.Equal(t, "C:", wnb.dataVolume())
+	require.NoError(t, wnb.SetKubeletDirOptions(`d:\kubelet`, "", ""))
+	assert.Equal(t, "D:", wnb.dataVolume())
+}
+
+// TestKubeletOptions tests the validation of the kubelet feature gates and extra arguments and their merging into
+// the kubelet arguments
+func TestKubeletOptions(t *testing.T) {
+	invalid := []struct {
+		name         string
+		featureGates []string
+		extraArgs    []string
+		errorMessage string
+	}{
+		{"unknown feature gate", []string{"DynamicKubeletConfig=true"}, nil, "not allowed"},
+		{"feature gate without value", []string{"WindowsGMSA"}, nil, "invalid feature gate"},
+		{"feature gate with invalid value", []string{"WindowsGMSA=yes"}, nil, "invalid value"},
+		{"managed argument", nil, []string{"node-labels=foo=bar"}, "not allowed"},
+		{"argument without value", nil, []string{"--max-pods"}, "invalid kubelet argument"},
+		{"argument with spaces", nil, []string{"system-reserved=cpu=500m, memory=1Gi"}, "spaces"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			wnb := winNodeBootstrapper{}
+			err := wnb.SetKubeletOptions(tt.featureGates, tt.extraArgs)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMessage)
+		})
+	}
+
+	t.Run("merged arguments", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		require.NoError(t, wnb.SetKubeletOptions([]string{"WindowsHostProcessContainers=true", "HyperVContainer=false"},
+			[]string{"--v=5", "node-ip=10.0.0.5"}))
+		args := wnb.kubelet.apply([]string{"--windows-service", "--v=3", "--feature-gates=HyperVContainer=true"})
+		// The feature gates required by the isolation mode take precedence
+		assert.Equal(t, []string{"--windows-service",
+			"--feature-gates=WindowsHostProcessContainers=true,HyperVContainer=true", "--node-ip=10.0.0.5", "--v=5"},
+			args)
+	})
+
+	t.Run("arguments preserved by CNI configuration", func(t *testing.T) {
+		k, err := newKubeletOptions([]string{"WindowsGMSA=true"}, []string{"max-pods=100"})
+		require.NoError(t, err)
+		kubeletCmd := "c:\\k\\kubelet.exe " + strings.Join(k.apply([]string{"--windows-service"}), " ")
+		cni := &cniOptions{binDir: "c:\\k\\cni", confDir: "c:\\k\\cni\\config"}
+		require.NoError(t, cni.updateKubeletArgs(&kubeletCmd))
+		assert.Contains(t, kubeletCmd, "--feature-gates=WindowsGMSA=true")
+		assert.Contains(t, kubeletCmd, "--max-pods=100")
+	})
+}
+
+// TestNodeIPOptions tests the kubelet arguments of single-stack and dual-stack nodes
+func TestNodeIPOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		family       string
+		nodeIPs      []string
+		expectedArgs []string
+	}{
+		{"ipv4", "ipv4", []string{"10.0.128.5"}, []string{"--node-ip=10.0.128.5"}},
+		{"ipv6", "ipv6", []string{"2600:1f18::5"}, []string{"--node-ip=2600:1f18::5"}},
+		{"dual-stack", "dual", []string{"2600:1f18::5", "10.0.128.5"},
+			[]string{"--node-ip=10.0.128.5,2600:1f18::5", "--feature-gates=IPv6DualStack=true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wnb := winNodeBootstrapper{}
+			require.NoError(t, wnb.SetNodeIPOptions(tt.family, tt.nodeIPs))
+			assert.Equal(t, tt.expectedArgs, wnb.nodeIP.kubeletArgs())
+		})
+	}
+
+	t.Run("invalid inputs", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		assert.Error(t, wnb.SetNodeIPOptions("dual-stack", nil), "no error on passing invalid family")
+		assert.Error(t, wnb.SetNodeIPOptions("dual", []string{"10.0.128.5"}), "no error on missing IPv6 address")
+	})
+
+	t.Run("address of the node", func(t *testing.T) {
+		wnb := winNodeBootstrapper{}
+		require.NoError(t, wnb.SetNodeIPOptions("ipv4", nil), "no IPv4 address found on the node")
+		require.Len(t, wnb.nodeIP.nodeIPs, 1)
+		assert.True(t, wnb.nodeIP.nodeIPs[0].IsGlobalUnicast())
+	})
+
+	t.Run("feature gates merged", func(t *testing.T) {
+		args := mergeFeatureGateArgs([]string{"--windows-service", "--feature-gates=HyperVContainer=true",
+			"--node-ip=10.0.128.5,2600:1f18::5", "--feature-gates=IPv6DualStack=true"})
+		assert.Equal(t, []string{"--windows-service", "--feature-gates=HyperVContainer=true,IPv6DualStack=true",
+			"--node-ip=10.0.128.5,2600:1f18::5"}, args)
+	})
+}
+
+// TestProviderIDOptions tests that the provider ID is computed on the platform of the cloud provider of the kubelet,
+// that the given provider IDs are checked against its format, and that a provider ID that cannot be computed is a
+// warning
+func TestProviderIDOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			fmt.Fprint(w, "token")
+		case "/latest/meta-data/placement/availability-zone":
+			fmt.Fprint(w, "us-east-1a")
+		case "/latest/meta-data/instance-id":
+			fmt.Fprint(w, "i-0123456789abcdef0")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	// newBootstrapper returns a bootstrapper of a node with the given kubelet cloud provider and provider ID option
+	newBootstrapper := func(cloudProvider, providerID string) *winNodeBootstrapper {
+		wnb := &winNodeBootstrapper{kubeletArgs: map[string]string{}}
+		if cloudProvider != "" {
+			wnb.kubeletArgs["cloud-provider"] = cloudProvider
+		}
+		require.NoError(t, wnb.SetProviderIDOptions(providerID))
+		wnb.providerID.resolver.MetadataEndpoint = server.URL
+		return wnb
+	}
+
+	wnb := newBootstrapper("aws", "")
+	require.NoError(t, wnb.resolveProviderID())
+	assert.Equal(t, []string{"--provider-id=aws:///us-east-1a/i-0123456789abcdef0"}, wnb.providerID.kubeletArgs())
+	assert.Empty(t, wnb.warnings)
+
+	wnb = newBootstrapper("azure", ProviderIDAuto)
+	require.NoError(t, wnb.resolveProviderID())
+	assert.Empty(t, wnb.providerID.kubeletArgs(), "provider ID passed without its metadata")
+	assert.Len(t, wnb.warnings, 1)
+
+	for _, providerID := range []string{ProviderIDAuto, ProviderIDNone} {
+		wnb = newBootstrapper("", providerID)
+		require.NoError(t, wnb.resolveProviderID())
+		assert.Empty(t, wnb.providerID.kubeletArgs(), "provider ID of a node without cloud provider")
+	}
+	wnb = newBootstrapper("aws", ProviderIDNone)
+	require.NoError(t, wnb.resolveProviderID())
+	assert.Empty(t, wnb.providerID.kubeletArgs())
+
+	wnb = newBootstrapper("vsphere", "vsphere://421e2f5c-3d4b-6a7e-8f9a-0b1c2d3e4f50")
+	require.NoError(t, wnb.resolveProviderID())
+	assert.Equal(t, []string{"--provider-id=vsphere://421e2f5c-3d4b-6a7e-8f9a-0b1c2d3e4f50"},
+		wnb.providerID.kubeletArgs())
+	wnb = newBootstrapper("aws", "i-0123456789abcdef0")
+	assert.Error(t, wnb.resolveProviderID(), "provider ID not in the format of the platform")
+
+	assert.Error(t, (&winNodeBootstrapper{}).SetProviderIDOptions("aws:///us-east-1a/i-0123 --v=10"))
+}
+
+// TestVerify tests that drift of the recorded files is detected and restored
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmcb")
+	require.NoError(t, err, "error creating temp directory")
+	// Ignore the return error as there is not much we can do if the temporary directory is not deleted
+	defer os.RemoveAll(dir)
+
+	wnb := winNodeBootstrapper{
+		installDir:      dir,
+		kubeletConfPath: filepath.Join(dir, "kubelet.conf"),
+		kubeletArgs:     make(map[string]string),
+	}
+	require.NoError(t, ioutil.WriteFile(wnb.kubeletConfPath, []byte("original"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "kubelet-ca.crt"), []byte("ca"), 0644))
+	require.NoError(t, wnb.recordInstalledFiles(), "error recording installed files")
+
+	drifts, err := wnb.Verify(false)
+	require.NoError(t, err)
+	assert.Empty(t, drifts, "drift detected on unmodified files")
+
+	require.NoError(t, ioutil.WriteFile(wnb.kubeletConfPath, []byte("modified by hand"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "kubelet-ca.crt")))
+	drifts, err = wnb.Verify(false)
+	require.NoError(t, err)
+	require.Len(t, drifts, 2, "drift not detected")
+
+	drifts, err = wnb.Verify(true)
+	require.NoError(t, err)
+	require.Len(t, drifts, 2)
+	assert.True(t, drifts[0].Restored && drifts[1].Restored, "drifted files were not restored")
+	contents, err := ioutil.ReadFile(wnb.kubeletConfPath)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(contents))
+	assert.FileExists(t, filepath.Join(dir, "kubelet-ca.crt"))
+
+	drifts, err = wnb.Verify(false)
+	require.NoError(t, err)
+	assert.Empty(t, drifts, "drift detected after restore")
+}
+
+// TestBinaryArchitecture tests that the architecture of Windows executables is detected and checked
+func TestBinaryArchitecture(t *testing.T) {
+	// The test binary is built for the architecture it is being run on
+	testBinary, err := os.Executable()
+	require.NoError(t, err, "error getting test binary path")
+
+	t.Run("matching architecture", func(t *testing.T) {
+		arch, err := binaryArchitecture(testBinary)
+		require.NoError(t, err, "error getting test binary architecture")
+		assert.Equal(t, runtime.GOARCH, arch)
+		assert.NoError(t, ensureBinaryArchitecture(testBinary, runtime.GOARCH))
+	})
+	t.Run("mismatched architecture", func(t *testing.T) {
+		err := ensureBinaryArchitecture(testBinary, "mips")
+		require.Error(t, err, "no error returned for mismatched architecture")
+		assert.Contains(t, err.Error(), "is built for "+runtime.GOARCH)
+	})
+	t.Run("not an executable", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "notexe")
+		require.NoError(t, err, "error creating temp file")
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("not an executable")
+		require.NoError(t, err, "error writing temp file")
+		require.NoError(t, f.Close())
+		assert.Error(t, ensureBinaryArchitecture(f.Name(), runtime.GOARCH))
+	})
+}
@@ -0,0 +1,43 @@
+package bootstrapper
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"golang.org/x/sys/windows/svc"
+)
+
+// SetContainerRuntimeOptions sets the container runtime the kubelet runs the containers with: docker, containerd or
+// auto to detect the one installed on the node. The kubelet service depends on the Windows service of the runtime,
+// which is verified to be running before the kubelet is initialized.
+func (wmcb *winNodeBootstrapper) SetContainerRuntimeOptions(runtime string) error {
+	r, err := containerruntime.Parse(runtime)
+	if err != nil {
+		return err
+	}
+	if r, err = containerruntime.Resolve(r); err != nil {
+		return fmt.Errorf("could not detect container runtime: %v", err)
+	}
+	wmcb.containerRuntime = r
+	return nil
+}
+
+// preflightContainerRuntime returns an error if the Windows service of the container runtime is not running, as the
+// kubelet would fail to start or would never become ready
+func (wmcb *winNodeBootstrapper) preflightContainerRuntime() error {
+	name := wmcb.containerRuntime.ServiceName()
+	service, err := wmcb.svcMgr.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("%s service of the %s container runtime not found: %v", name, wmcb.containerRuntime, err)
+	}
+	defer service.Close()
+	status, err := service.Query()
+	if err != nil {
+		return fmt.Errorf("could not query %s service: %v", name, err)
+	}
+	if status.State != svc.Running {
+		return fmt.Errorf("%s service of the %s container runtime is in state %d, expected running", name,
+			wmcb.containerRuntime, status.State)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package bootstrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// credentialProviderDirName is the directory within the install dir where the credential provider binaries are
+	// placed
+	credentialProviderDirName = "credential-provider"
+	// credentialProviderConfigName is the name of the CredentialProviderConfig file generated in the install dir
+	credentialProviderConfigName = "credential-provider-config.yaml"
+	// credentialProviderConfigAPIVersion is the API version of the CredentialProviderConfig consumed by the kubelet
+	credentialProviderConfigAPIVersion = "kubelet.config.k8s.io/v1alpha1"
+	// credentialProviderAPIVersion is the API version of the exec plugin request and response
+	credentialProviderAPIVersion = "credentialprovider.kubelet.k8s.io/v1alpha1"
+	// credentialProviderFeatureGate is the kubelet feature gate that enables credential provider plugins
+	credentialProviderFeatureGate = "KubeletCredentialProviders"
+	// credentialProviderMinKubeletMinor is the minor version of the first 1.x kubelet supporting credential provider
+	// plugins, older kubelets fail to start with the credential provider options
+	credentialProviderMinKubeletMinor = 20
+
+	// kubelet CLI options for credential providers
+	// imageCredentialProviderConfigOption is to specify the CredentialProviderConfig file
+	imageCredentialProviderConfigOption = "--image-credential-provider-config"
+	// imageCredentialProviderBinDirOption is to specify the directory the credential provider binaries are in
+	imageCredentialProviderBinDirOption = "--image-credential-provider-bin-dir"
+	// featureGatesOption is to specify the kubelet feature gates
+	featureGatesOption = "--feature-gates"
+)
+
+// kubeletVersionRegex matches the major and minor version in the output of kubelet --version, e.g. Kubernetes v1.20.0
+var kubeletVersionRegex = regexp.MustCompile(`v(\d+)\.(\d+)\.`)
+
+// credentialProviderConfig is the CredentialProviderConfig consumed by the kubelet. The upstream type is not available
+// in the vendored kubelet API, so we define the subset of it that we generate.
+type credentialProviderConfig struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Providers  []credentialProvider `json:"providers"`
+}
+
+// credentialProvider describes a single exec based credential provider plugin
+type credentialProvider struct {
+	// Name is the name of the plugin binary in the credential provider bin dir
+	Name string `json:"name"`
+	// MatchImages are the image patterns the plugin is invoked for, for example "*.dkr.ecr.*.amazonaws.com"
+	MatchImages []string `json:"matchImages"`
+	// DefaultCacheDuration is how long the kubelet caches the credentials if the plugin does not specify a duration
+	DefaultCacheDuration string `json:"defaultCacheDuration"`
+	// APIVersion is the version of the request sent to and the response expected from the plugin
+	APIVersion string `json:"apiVersion"`
+	// Args are the arguments the plugin is invoked with
+	Args []string `json:"args,omitempty"`
+}
+
+// credentialProviderOptions is responsible for reconfiguring the kubelet service with a credential provider plugin
+type credentialProviderOptions struct {
+	// k8sInstallDir is the main installation directory
+	k8sInstallDir string
+	// binary is the input credential provider plugin binary
+	binary string
+	// binDir is the directory where the credential provider binaries will be placed
+	binDir string
+	// configPath is the path of the generated CredentialProviderConfig
+	configPath string
+	// provider is the configuration of the plugin
+	provider credentialProvider
+}
+
+// newCredentialProviderOptions takes the path to the kubelet installation, the plugin binary and the plugin settings as
+// input and returns the credentialProviderOptions object
+func newCredentialProviderOptions(k8sInstallDir, binary string, matchImages []string, defaultCacheDuration time.Duration,
+	args []string) (*credentialProviderOptions, error) {
+	if _, err := os.Stat(k8sInstallDir); err != nil {
+		return nil, fmt.Errorf("error accessing install directory %s: %v", k8sInstallDir, err)
+	}
+	binaryInfo, err := os.Stat(binary)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing credential provider binary %s: %v", binary, err)
+	}
+	if binaryInfo.IsDir() {
+		return nil, fmt.Errorf("credential provider binary cannot be a directory")
+	}
+	if len(matchImages) == 0 {
+		return nil, fmt.Errorf("at least one image to match is required for the credential provider")
+	}
+	if defaultCacheDuration <= 0 {
+		return nil, fmt.Errorf("invalid default cache duration %v", defaultCacheDuration)
+	}
+
+	return &credentialProviderOptions{
+		k8sInstallDir: k8sInstallDir,
+		binary:        binary,
+		binDir:        filepath.Join(k8sInstallDir, credentialProviderDirName),
+		configPath:    filepath.Join(k8sInstallDir, credentialProviderConfigName),
+		provider: credentialProvider{
+			// The kubelet resolves the name against the bin dir and the .exe extension is implied on Windows
+			Name:                 strings.TrimSuffix(filepath.Base(binary), filepath.Ext(binary)),
+			MatchImages:          matchImages,
+			DefaultCacheDuration: defaultCacheDuration.String(),
+			APIVersion:           credentialProviderAPIVersion,
+			Args:                 args,
+		},
+	}, nil
+}
+
+// SetCredentialProvider sets up the bootstrapper to install the given credential provider plugin binary for the given
+// image patterns on the next call to Configure. It returns an error if the installed kubelet is older than v1.20.
+func (wmcb *winNodeBootstrapper) SetCredentialProvider(binary string, matchImages []string,
+	defaultCacheDuration time.Duration, args []string) error {
+	kubelet := filepath.Join(wmcb.installDir, "kubelet.exe")
+	if err := checkCredentialProviderSupport(binaryVersion(kubelet)); err != nil {
+		return fmt.Errorf("cannot configure the credential provider for %s: %v", kubelet, err)
+	}
+	credentialProvider, err := newCredentialProviderOptions(wmcb.installDir, binary, matchImages,
+		defaultCacheDuration, args)
+	if err != nil {
+		return fmt.Errorf("could not initialize credentialProviderOptions: %v", err)
+	}
+	wmcb.credentialProvider = credentialProvider
+	return nil
+}
+
+// checkCredentialProviderSupport returns an error if the kubelet reporting the given version, the output of its
+// --version option, does not support credential provider plugins
+func checkCredentialProviderSupport(version string) error {
+	match := kubeletVersionRegex.FindStringSubmatch(version)
+	if match == nil {
+		return fmt.Errorf("could not determine the kubelet version from %q", version)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	if major == 1 && minor < credentialProviderMinKubeletMinor {
+		return fmt.Errorf("kubelet %s does not support credential provider plugins, which require kubelet v1.%d or "+
+			"later", strings.TrimSpace(version), credentialProviderMinKubeletMinor)
+	}
+	return nil
+}
+
+// writeConfig generates the CredentialProviderConfig. As JSON is a subset of YAML, the kubelet can parse the JSON
+// output.
+func (cp *credentialProviderOptions) writeConfig() error {
+	config := credentialProviderConfig{
+		APIVersion: credentialProviderConfigAPIVersion,
+		Kind:       "CredentialProviderConfig",
+		Providers:  []credentialProvider{cp.provider},
+	}
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal credential provider config: %v", err)
+	}
+	if err = ioutil.WriteFile(cp.configPath, out, 0644); err != nil {
+		return fmt.Errorf("could not write to %s: %v", cp.configPath, err)
+	}
+	return nil
+}
+
+// updateKubeletArgs updates the given kubelet command with the credential provider args.
+// Example: --image-credential-provider-config=c:\k\credential-provider-config.yaml
+// --image-credential-provider-bin-dir=c:\k\credential-provider --feature-gates=KubeletCredentialProviders=true
+func (cp *credentialProviderOptions) updateKubeletArgs(kubeletCmd *string) error {
+	if kubeletCmd == nil {
+		return fmt.Errorf("nil kubelet cmd passed")
+	}
+
+	kubeletKeyValueArgs, err := deconstructKubeletCmd(kubeletCmd)
+	if err != nil {
+		return fmt.Errorf("unable to deconstruct kubelet command %s: %v", *kubeletCmd, err)
+	}
+
+	kubeletKeyValueArgs[imageCredentialProviderConfigOption] = cp.configPath
+	kubeletKeyValueArgs[imageCredentialProviderBinDirOption] = cp.binDir
+	kubeletKeyValueArgs[featureGatesOption] = setFeatureGate(kubeletKeyValueArgs[featureGatesOption],
+		credentialProviderFeatureGate, true)
+
+	if *kubeletCmd, err = reconstructKubeletCmd(kubeletKeyValueArgs); err != nil {
+		return fmt.Errorf("unable to reconstruct kubelet command %v: %v", kubeletKeyValueArgs, err)
+	}
+	return nil
+}
+
+// configure installs the plugin binary, generates the CredentialProviderConfig and updates the kubelet command with
+// the credential provider arguments. Updating and restarting the kubelet service is outside of its purview.
+func (cp *credentialProviderOptions) configure(kubeletCmd *string) error {
+	if err := os.MkdirAll(cp.binDir, os.ModeDir); err != nil {
+		return fmt.Errorf("unable to create credential provider directory %s: %v", cp.binDir, err)
+	}
+
+	dest := filepath.Join(cp.binDir, filepath.Base(cp.binary))
+	if err := copyFile(cp.binary, dest); err != nil {
+		return fmt.Errorf("error copying %s --> %s: %v", cp.binary, dest, err)
+	}
+
+	if err := cp.writeConfig(); err != nil {
+		return err
+	}
+
+	if err := cp.updateKubeletArgs(kubeletCmd); err != nil {
+		return fmt.Errorf("unable to update the kubelet arguments: %v", err)
+	}
+	return nil
+}
+
+// setFeatureGate sets the given gate in the comma separated feature gates value, preserving the other gates.
+// Example: setFeatureGate("A=true", "B", false) returns "A=true,B=false"
+func setFeatureGate(featureGates, gate string, enabled bool) string {
+	var gates []string
+	for _, existing := range strings.Split(featureGates, ",") {
+		if existing == "" || strings.SplitN(existing, "=", 2)[0] == gate {
+			continue
+		}
+		gates = append(gates, existing)
+	}
+	return strings.Join(append(gates, fmt.Sprintf("%s=%t", gate, enabled)), ",")
+}
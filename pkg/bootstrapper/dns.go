@@ -0,0 +1,109 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	kubeletConfig "k8s.io/kubelet/config/v1beta1"
+)
+
+// dnsOptions holds the DNS configuration of the node. Windows has no resolv.conf, so the kubelet gets the cluster DNS
+// settings only through its configuration and the host resolves through the DNS client settings of its NICs.
+type dnsOptions struct {
+	// clusterDNS are the IP addresses of the cluster DNS service, overriding the ones in the ignition kubelet config
+	clusterDNS []string
+	// clusterDomain is the cluster domain, overriding the one in the ignition kubelet config
+	clusterDomain string
+	// configureSearchList indicates that the cluster domain should be added to the DNS suffix search list of the node
+	configureSearchList bool
+}
+
+// SetDNSOptions sets the cluster DNS servers and domain to be used by the kubelet instead of the ones given in the
+// ignition file. Empty values keep the ignition values. If configureSearchList is true, the cluster domain is added
+// to the DNS suffix search list of the node when the kubelet is initialized.
+func (wmcb *winNodeBootstrapper) SetDNSOptions(clusterDNS []string, clusterDomain string,
+	configureSearchList bool) error {
+	for _, ip := range clusterDNS {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid cluster DNS IP address %s", ip)
+		}
+	}
+	if clusterDomain != "" {
+		if errs := validation.IsDNS1123Subdomain(clusterDomain); len(errs) > 0 {
+			return fmt.Errorf("invalid cluster domain %s: %s", clusterDomain, strings.Join(errs, ", "))
+		}
+	}
+	wmcb.dns = &dnsOptions{
+		clusterDNS:          clusterDNS,
+		clusterDomain:       clusterDomain,
+		configureSearchList: configureSearchList,
+	}
+	return nil
+}
+
+// applyToKubeletConfig overrides the DNS settings of the kubelet configuration with the given options. The cluster
+// domain of the options is updated with the one from the configuration if none was given, so that it can be used to
+// configure the search list.
+func (dns *dnsOptions) applyToKubeletConfig(config *kubeletConfig.KubeletConfiguration) {
+	if len(dns.clusterDNS) > 0 {
+		config.ClusterDNS = dns.clusterDNS
+	}
+	if dns.clusterDomain != "" {
+		config.ClusterDomain = dns.clusterDomain
+	} else {
+		dns.clusterDomain = config.ClusterDomain
+	}
+}
+
+// searchList returns the DNS suffixes that need to be present in the search list of the node for cluster names to
+// resolve from the host, for example svc.cluster.local and cluster.local
+func (dns *dnsOptions) searchList() []string {
+	return []string{"svc." + dns.clusterDomain, dns.clusterDomain}
+}
+
+// configureSearchListOnHost adds the cluster domain suffixes to the global DNS suffix search list of the node, which
+// applies to all the NICs. Existing suffixes are preserved.
+func (dns *dnsOptions) configureSearchListOnHost() error {
+	if dns.clusterDomain == "" {
+		return fmt.Errorf("cluster domain not present in the kubelet configuration")
+	}
+
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"(Get-DnsClientGlobalSetting).SuffixSearchList").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not get DNS suffix search list: %v: %s", err, out)
+	}
+	suffixes := mergeSearchList(strings.Fields(string(out)), dns.searchList())
+
+	quoted := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		quoted[i] = "'" + suffix + "'"
+	}
+	out, err = exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"Set-DnsClientGlobalSetting -SuffixSearchList @("+strings.Join(quoted, ",")+")").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not set DNS suffix search list to %v: %v: %s", suffixes, err, out)
+	}
+	return nil
+}
+
+// mergeSearchList appends the given suffixes to the existing search list, skipping the ones already present
+func mergeSearchList(existing, suffixes []string) []string {
+	merged := append([]string{}, existing...)
+	for _, suffix := range suffixes {
+		found := false
+		for _, e := range existing {
+			if strings.EqualFold(e, suffix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, suffix)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,81 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// ProcessIsolation runs the containers as processes sharing the kernel of the node. The container images need to be
+	// built for the same Windows build as the node.
+	ProcessIsolation = "process"
+	// HyperVIsolation runs the containers in lightweight Hyper-V VMs, allowing images built for older Windows builds
+	// than the node to be run. It requires the Hyper-V feature on the node.
+	HyperVIsolation = "hyperv"
+	// hyperVFeatureGate is the kubelet feature gate enabling Hyper-V isolated containers for the pods requesting it
+	// with the experimental.windows.kubernetes.io/isolation-type annotation
+	hyperVFeatureGate = "HyperVContainer"
+	// hyperVFeature is the name of the Windows feature required for Hyper-V isolation
+	hyperVFeature = "Hyper-V"
+)
+
+// isolationOptions holds the container isolation configuration of the node
+type isolationOptions struct {
+	// isolation is the container isolation mode, ProcessIsolation or HyperVIsolation
+	isolation string
+	// pauseImage is the image of the pod infra containers, overriding kubeletPauseContainerImage
+	pauseImage string
+}
+
+// SetIsolationOptions sets the container isolation mode of the node, ProcessIsolation or HyperVIsolation, and the
+// image used for the pod infra containers. An empty pause image keeps the default one, which is a multi-arch image
+// matching the Windows build of the node. With Hyper-V isolation the pause image can be built for an older Windows
+// build than the node. The Hyper-V feature is verified before the kubelet is initialized.
+func (wmcb *winNodeBootstrapper) SetIsolationOptions(isolation, pauseImage string) error {
+	switch isolation {
+	case ProcessIsolation, HyperVIsolation:
+	default:
+		return fmt.Errorf("invalid container isolation %s, expected %s or %s", isolation, ProcessIsolation,
+			HyperVIsolation)
+	}
+	wmcb.isolation = &isolationOptions{
+		isolation:  isolation,
+		pauseImage: pauseImage,
+	}
+	return nil
+}
+
+// preflight returns an error if the Hyper-V feature is not installed on the node while Hyper-V isolation is
+// requested. The feature is not installed by WMCB as it requires a reboot.
+func (i *isolationOptions) preflight() error {
+	if i.isolation != HyperVIsolation {
+		return nil
+	}
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"(Get-WindowsFeature -Name "+hyperVFeature+").InstallState").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error getting state of Windows feature %s: %v, %s", hyperVFeature, err, out)
+	}
+	if state := strings.TrimSpace(string(out)); state != "Installed" {
+		return fmt.Errorf("Windows feature %s required for Hyper-V isolation is %s, install it and reboot the node",
+			hyperVFeature, state)
+	}
+	return nil
+}
+
+// pauseContainerImage returns the image of the pod infra containers
+func (i *isolationOptions) pauseContainerImage() string {
+	if i.pauseImage != "" {
+		return i.pauseImage
+	}
+	return kubeletPauseContainerImage
+}
+
+// kubeletArgs returns the kubelet arguments for the isolation mode
+func (i *isolationOptions) kubeletArgs() []string {
+	if i.isolation != HyperVIsolation {
+		return nil
+	}
+	return []string{featureGatesOption + "=" + setFeatureGate("", hyperVFeatureGate, true)}
+}
@@ -0,0 +1,133 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+)
+
+// registryRoot is the prefix of the registry keys recorded in the journal, all of which live under HKEY_LOCAL_MACHINE
+const registryRoot = `HKLM\`
+
+// NewJournal returns the journal of the node with the given install dir, recording the changes made by the given
+// command. The journal lives in the log directory so that it survives uninstall.
+func NewJournal(installDir, command string) *journal.Journal {
+	return journal.New(filepath.Join(installDir, "log"), command)
+}
+
+// commandName returns the WMCB command being run, e.g. initialize-kubelet, which is the first argument that is not a
+// flag
+func commandName() string {
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// record records a change in the journal. It is a no-op if the bootstrapper has no journal.
+func (wmcb *winNodeBootstrapper) record(action journal.Action, kind journal.Kind, target, detail string) error {
+	if wmcb.journal == nil {
+		return nil
+	}
+	if err := wmcb.journal.Record(action, kind, target, detail); err != nil {
+		return fmt.Errorf("could not record %s %s %s: %v", action, kind, target, err)
+	}
+	return nil
+}
+
+// recordDir records the creation of the given directory and runs mkdirAll on it if it does not exist yet. Existing
+// directories are not recorded, so that uninstall does not remove directories WMCB did not create.
+func (wmcb *winNodeBootstrapper) recordDir(dir string, perm os.FileMode) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return fmt.Errorf("could not make %s directory: %v", dir, err)
+	}
+	return wmcb.record(journal.Created, journal.Directory, dir, "")
+}
+
+// recordPlugins records the plugin files installed by Configure and the resulting kubelet service command
+func (wmcb *winNodeBootstrapper) recordPlugins(kubeletCmd string) error {
+	if wmcb.cni != nil {
+		if err := wmcb.record(journal.Created, journal.Directory, wmcb.cni.binDir,
+			"CNI plugins copied from "+wmcb.cni.dir); err != nil {
+			return err
+		}
+	}
+	if wmcb.credentialProvider != nil {
+		if err := wmcb.record(journal.Created, journal.Directory, wmcb.credentialProvider.binDir,
+			"credential provider copied from "+wmcb.credentialProvider.binary); err != nil {
+			return err
+		}
+		if err := wmcb.record(journal.Created, journal.File, wmcb.credentialProvider.configPath, ""); err != nil {
+			return err
+		}
+	}
+	return wmcb.record(journal.Modified, journal.Service, KubeletServiceName, kubeletCmd)
+}
+
+// revertJournal reverts the changes recorded in the journal that are still present on the node, most recent first,
+// and records their removal. Host settings changed in place are left as they are.
+func (wmcb *winNodeBootstrapper) revertJournal() error {
+	if wmcb.journal == nil {
+		return nil
+	}
+	entries, err := journal.Read(wmcb.journal.Path())
+	if err != nil {
+		return err
+	}
+	footprint := journal.Footprint(entries)
+	for i := len(footprint) - 1; i >= 0; i-- {
+		entry := footprint[i]
+		switch entry.Kind {
+		case journal.File, journal.Directory:
+			err = os.RemoveAll(entry.Target)
+		case journal.Service:
+			err = wmcb.deleteService(entry.Target)
+		case journal.Registry:
+			err = registry.DeleteKey(registry.LOCAL_MACHINE, strings.TrimPrefix(entry.Target, registryRoot))
+			if err == registry.ErrNotExist {
+				err = nil
+			}
+		case journal.FirewallRule:
+			var out []byte
+			out, err = exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+				"Remove-NetFirewallRule -DisplayName '"+strings.ReplaceAll(entry.Target, "'", "''")+
+					"' -ErrorAction SilentlyContinue").CombinedOutput()
+			if err != nil {
+				err = fmt.Errorf("%v: %s", err, out)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to remove %s %s: %v", entry.Kind, entry.Target, err)
+		}
+		if err = wmcb.record(journal.Removed, entry.Kind, entry.Target, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteService stops the given Windows service and marks it for deletion if it exists. Stopping is best effort, as
+// services like the kubelet are already stopped.
+func (wmcb *winNodeBootstrapper) deleteService(name string) error {
+	service, err := wmcb.svcMgr.OpenService(name)
+	if err != nil {
+		// Nothing to remove
+		return nil
+	}
+	defer service.Close()
+	service.Control(svc.Stop)
+	return service.Delete()
+}
@@ -0,0 +1,142 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// defaultKubeletRootDir is the directory the kubelet keeps its state in, like the volumes and the plugin sockets,
+	// unless told otherwise
+	defaultKubeletRootDir = "c:\\var\\lib\\kubelet"
+	// pkiDirName is the directory within the kubelet root directory where the kubelet keeps its certificates
+	pkiDirName = "pki"
+	// rootDirOption is the kubelet CLI option for the kubelet root directory
+	rootDirOption = "--root-dir"
+	// certDirOption is the kubelet CLI option for the directory of the kubelet certificates
+	certDirOption = "--cert-dir"
+)
+
+// kubeletDirOptions holds the directories of the kubelet, for nodes whose drive and path layout is mandated by policy
+type kubeletDirOptions struct {
+	// rootDir is the directory the kubelet keeps its state in
+	rootDir string
+	// certDir is the directory of the kubelet certificates, which are the identity of the node
+	certDir string
+	// manifestDir is the directory of the static pod manifests
+	manifestDir string
+}
+
+// SetKubeletDirOptions sets the kubelet root directory, the directory of the kubelet certificates and the directory of
+// the static pod manifests, instead of c:\var\lib\kubelet, c:\var\lib\kubelet\pki and the etc\kubernetes\manifests
+// directory under the install directory. An empty certificate directory defaults to the pki directory under the root
+// directory, and an empty root or manifest directory keeps the default one. The directories need to be absolute paths
+// without spaces, on a drive of the node, and none of them can hold another one.
+func (wmcb *winNodeBootstrapper) SetKubeletDirOptions(rootDir, certDir, manifestDir string) error {
+	options := &kubeletDirOptions{
+		rootDir:     defaultKubeletRootDir,
+		manifestDir: filepath.Join(wmcb.installDir, "etc", "kubernetes", "manifests"),
+	}
+	for _, dir := range []struct {
+		name  string
+		value string
+		dest  *string
+	}{
+		{"kubelet root", rootDir, &options.rootDir},
+		{"kubelet certificate", certDir, &options.certDir},
+		{"static pod manifest", manifestDir, &options.manifestDir},
+	} {
+		if dir.value == "" {
+			continue
+		}
+		if err := validateKubeletDir(dir.name, dir.value); err != nil {
+			return err
+		}
+		*dir.dest = filepath.Clean(dir.value)
+	}
+	if options.certDir == "" {
+		options.certDir = filepath.Join(options.rootDir, pkiDirName)
+	}
+	if isSubdir(options.rootDir, options.manifestDir) || isSubdir(options.manifestDir, options.rootDir) {
+		return fmt.Errorf("the static pod manifest directory %s and the kubelet root directory %s cannot hold "+
+			"one another", options.manifestDir, options.rootDir)
+	}
+	if isSubdir(options.certDir, options.manifestDir) || isSubdir(options.manifestDir, options.certDir) {
+		return fmt.Errorf("the static pod manifest directory %s and the kubelet certificate directory %s cannot "+
+			"hold one another", options.manifestDir, options.certDir)
+	}
+	wmcb.kubeletDirs = options
+	return nil
+}
+
+// validateKubeletDir returns an error if the given directory cannot be passed to the kubelet
+func validateKubeletDir(name, dir string) error {
+	if !filepath.IsAbs(dir) || filepath.VolumeName(dir) == "" {
+		return fmt.Errorf("invalid %s directory %s, expected an absolute path with a drive letter", name, dir)
+	}
+	return validateKubeletArgValue(name+" directory", dir)
+}
+
+// isSubdir returns true if the given directory is the given parent directory or is under it. Windows paths are
+// compared case insensitively.
+func isSubdir(parent, dir string) bool {
+	rel, err := filepath.Rel(strings.ToLower(parent), strings.ToLower(dir))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// preflight returns an error if the drive of one of the directories does not exist on the node, which the kubelet
+// would only report once it is running as a service
+func (k *kubeletDirOptions) preflight() error {
+	for _, dir := range []string{k.rootDir, k.certDir, k.manifestDir} {
+		drive := filepath.VolumeName(dir) + string(filepath.Separator)
+		if _, err := os.Stat(drive); err != nil {
+			return fmt.Errorf("drive %s of directory %s is not available: %v", drive, dir, err)
+		}
+	}
+	return nil
+}
+
+// kubeletArgs returns the kubelet arguments for the directories. The root directory is only passed when it is not the
+// default, so that the kubelet command of the default layout is unchanged.
+func (k *kubeletDirOptions) kubeletArgs() []string {
+	var args []string
+	if !strings.EqualFold(k.rootDir, defaultKubeletRootDir) {
+		args = append(args, rootDirOption+"="+k.rootDir)
+	}
+	return args
+}
+
+// certDir returns the directory of the kubelet certificates
+func (wmcb *winNodeBootstrapper) certDir() string {
+	if wmcb.kubeletDirs != nil {
+		return wmcb.kubeletDirs.certDir
+	}
+	return certDirectory
+}
+
+// podManifestDir returns the directory of the static pod manifests
+func (wmcb *winNodeBootstrapper) podManifestDir() string {
+	if wmcb.kubeletDirs != nil {
+		return wmcb.kubeletDirs.manifestDir
+	}
+	return filepath.Join(wmcb.installDir, "etc", "kubernetes", "manifests")
+}
+
+// installedCertDir returns the directory of the certificates of the installed kubelet service, which the node was
+// bootstrapped with, falling back to the configured one if there is no kubelet service or it cannot be read
+func (wmcb *winNodeBootstrapper) installedCertDir() string {
+	if wmcb.kubeletSVC == nil {
+		return wmcb.certDir()
+	}
+	config, err := wmcb.kubeletSVC.Config()
+	if err != nil {
+		return wmcb.certDir()
+	}
+	args, err := deconstructKubeletCmd(&config.BinaryPathName)
+	if err != nil || args[certDirOption] == "" {
+		return wmcb.certDir()
+	}
+	return args[certDirOption]
+}
@@ -0,0 +1,196 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// allowedFeatureGates are the kubelet feature gates that can be set with SetKubeletOptions. They are the Windows
+// related alpha and beta features of the kubelet that are useful to test on a node bootstrapped by WMCB.
+var allowedFeatureGates = map[string]bool{
+	"HyperVContainer":                true,
+	"IPv6DualStack":                  true,
+	"KubeletCredentialProviders":     true,
+	"KubeletPodResources":            true,
+	"LocalStorageCapacityIsolation":  true,
+	"RotateKubeletServerCertificate": true,
+	"WindowsGMSA":                    true,
+	"WindowsHostProcessContainers":   true,
+	"WindowsRunAsUserName":           true,
+}
+
+// allowedKubeletArgs are the kubelet arguments that can be passed through with SetKubeletOptions. The arguments WMCB
+// sets itself, like --config, --node-labels or the CNI arguments, are not allowed, as overriding them breaks the
+// bootstrap or is lost when WMCB reconfigures the kubelet.
+var allowedKubeletArgs = map[string]bool{
+	"container-log-max-files":      true,
+	"container-log-max-size":       true,
+	"hostname-override":            true,
+	"image-pull-progress-deadline": true,
+	"kube-reserved":                true,
+	"log-file-max-size":            true,
+	"max-pods":                     true,
+	"node-ip":                      true,
+	"node-status-update-frequency": true,
+	"runtime-request-timeout":      true,
+	"serialize-image-pulls":        true,
+	"system-reserved":              true,
+	"v":                            true,
+	"vmodule":                      true,
+}
+
+// kubeletOptions holds the feature gates and extra arguments passed through to the kubelet
+type kubeletOptions struct {
+	// featureGates are the feature gates to set, by name
+	featureGates map[string]bool
+	// extraArgs are the values of the extra arguments, by name without the leading dashes
+	extraArgs map[string]string
+}
+
+// SetKubeletOptions sets the kubelet feature gates, given as <gate>=<true|false>, and the extra kubelet arguments,
+// given as <name>=<value> with or without the leading dashes, to pass through to the kubelet service. Both are
+// validated against the allowed feature gates and arguments. An extra argument replaces the one WMCB derives from the
+// ignition file, like --v. The feature gates WMCB sets for its own options, like HyperVContainer for Hyper-V
+// isolation, take precedence.
+func (wmcb *winNodeBootstrapper) SetKubeletOptions(featureGates, extraArgs []string) error {
+	options, err := newKubeletOptions(featureGates, extraArgs)
+	if err != nil {
+		return err
+	}
+	wmcb.kubelet = options
+	return nil
+}
+
+// newKubeletOptions validates and parses the feature gates and extra arguments
+func newKubeletOptions(featureGates, extraArgs []string) (*kubeletOptions, error) {
+	options := &kubeletOptions{featureGates: make(map[string]bool), extraArgs: make(map[string]string)}
+	for _, featureGate := range featureGates {
+		kv := strings.SplitN(featureGate, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid feature gate %s, expected <gate>=<true|false>", featureGate)
+		}
+		if !allowedFeatureGates[kv[0]] {
+			return nil, fmt.Errorf("feature gate %s is not allowed, allowed feature gates: %s", kv[0],
+				strings.Join(sortedKeys(allowedFeatureGates), ", "))
+		}
+		enabled, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s of feature gate %s: %v", kv[1], kv[0], err)
+		}
+		options.featureGates[kv[0]] = enabled
+	}
+	for _, arg := range extraArgs {
+		kv := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid kubelet argument %s, expected <name>=<value>", arg)
+		}
+		if !allowedKubeletArgs[kv[0]] {
+			return nil, fmt.Errorf("kubelet argument %s is not allowed, allowed arguments: %s", kv[0],
+				strings.Join(sortedKeys(allowedKubeletArgs), ", "))
+		}
+		if err := validateKubeletArgValue("kubelet argument "+kv[0], kv[1]); err != nil {
+			return nil, err
+		}
+		options.extraArgs[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
+// apply returns the given kubelet arguments with the feature gates merged into the --feature-gates argument and the
+// extra arguments replacing the ones with the same name
+func (k *kubeletOptions) apply(args []string) []string {
+	var result []string
+	var wmcbFeatureGates string
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if kv[0] == featureGatesOption && len(kv) == 2 {
+			wmcbFeatureGates = kv[1]
+			continue
+		}
+		if _, ok := k.extraArgs[strings.TrimLeft(kv[0], "-")]; ok {
+			continue
+		}
+		result = append(result, arg)
+	}
+
+	featureGates := ""
+	for _, gate := range sortedKeys(k.featureGates) {
+		featureGates = setFeatureGate(featureGates, gate, k.featureGates[gate])
+	}
+	featureGates = mergeFeatureGates(featureGates, wmcbFeatureGates)
+	if featureGates != "" {
+		result = append(result, featureGatesOption+"="+featureGates)
+	}
+
+	var names []string
+	for name := range k.extraArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, "--"+name+"="+k.extraArgs[name])
+	}
+	return result
+}
+
+// mergeFeatureGates sets the gates of the comma separated feature gates value gates in featureGates, preserving the
+// other gates of featureGates.
+// Example: mergeFeatureGates("A=true,B=true", "B=false,C=true") returns "A=true,B=false,C=true"
+func mergeFeatureGates(featureGates, gates string) string {
+	for _, gate := range strings.Split(gates, ",") {
+		kv := strings.SplitN(gate, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		enabled, _ := strconv.ParseBool(kv[1])
+		featureGates = setFeatureGate(featureGates, kv[0], enabled)
+	}
+	return featureGates
+}
+
+// mergeFeatureGateArgs returns the given kubelet arguments with their --feature-gates arguments merged into one, in
+// place of the first of them. Each option of WMCB sets the feature gates it needs with its own argument, while the
+// kubelet only takes the last one into account.
+func mergeFeatureGateArgs(args []string) []string {
+	var result []string
+	featureGates := ""
+	index := -1
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if kv[0] != featureGatesOption || len(kv) != 2 {
+			result = append(result, arg)
+			continue
+		}
+		featureGates = mergeFeatureGates(featureGates, kv[1])
+		if index == -1 {
+			index = len(result)
+			result = append(result, "")
+		}
+	}
+	if index != -1 {
+		result[index] = featureGatesOption + "=" + featureGates
+	}
+	return result
+}
+
+// validateKubeletArgValue returns an error if the given value, named after what it configures, cannot be passed as a
+// kubelet argument. The kubelet command of the service is split on spaces when WMCB reconfigures the kubelet, so values
+// with spaces or quotes would be split or mangled.
+func validateKubeletArgValue(name, value string) error {
+	if strings.ContainsAny(value, " \t\"") {
+		return fmt.Errorf("invalid %s %q, spaces and quotes are not supported", name, value)
+	}
+	return nil
+}
+
+// sortedKeys returns the sorted keys of the given set
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
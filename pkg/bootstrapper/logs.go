@@ -0,0 +1,78 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+)
+
+const (
+	// kubeletLogFile is the name of the log file of the kubelet in the log directory
+	kubeletLogFile = "kubelet.log"
+	// nodeLogDir is the directory the kubelet serves on its /logs endpoint, /var/log on the system drive, which the
+	// API server proxies to for `oc adm node-logs --path`
+	nodeLogDir = "c:\\var\\log"
+	// nodeLogLink is the link to the log directory of the kubelet created in nodeLogDir, so that its log is served as
+	// kubelet/kubelet.log
+	nodeLogLink = nodeLogDir + "\\kubelet"
+	// enableDebuggingHandlersOption is the kubelet CLI option enabling the /logs endpoint among others
+	enableDebuggingHandlersOption = "--enable-debugging-handlers"
+)
+
+// SetLogOptions sets the directory the kubelet writes kubelet.log to, e.g. a directory read by the log collector of the
+// cluster, instead of the log directory under the install directory. The directory is created if needed.
+func (wmcb *winNodeBootstrapper) SetLogOptions(logDir string) error {
+	if !filepath.IsAbs(logDir) {
+		return fmt.Errorf("invalid log directory %s, expected an absolute path", logDir)
+	}
+	if err := validateKubeletArgValue("log directory", logDir); err != nil {
+		return err
+	}
+	wmcb.logDir = filepath.Clean(logDir)
+	return nil
+}
+
+// underNodeLogDir returns true if the given log directory is under nodeLogDir, and so served by the kubelet as it is
+func underNodeLogDir(logDir string) bool {
+	rel, err := filepath.Rel(nodeLogDir, filepath.Clean(logDir))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// exposeLogs makes the log directory of the kubelet available to `oc adm node-logs`, by linking nodeLogLink to it
+// unless it is already under nodeLogDir. A link left by a previous bootstrap is replaced, while a directory which is not
+// a link is left alone with a warning, as its content is not WMCB's to remove.
+func (wmcb *winNodeBootstrapper) exposeLogs() error {
+	info, err := os.Lstat(nodeLogLink)
+	exists := err == nil
+	if exists && info.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Readlink(nodeLogLink); err == nil && strings.EqualFold(target, wmcb.logDir) {
+			return nil
+		}
+		if err := os.Remove(nodeLogLink); err != nil {
+			return fmt.Errorf("could not remove link %s: %v", nodeLogLink, err)
+		}
+		if err := wmcb.record(journal.Removed, journal.File, nodeLogLink, ""); err != nil {
+			return err
+		}
+		exists = false
+	}
+	if underNodeLogDir(wmcb.logDir) {
+		return nil
+	}
+	if exists {
+		wmcb.warnings = append(wmcb.warnings, fmt.Sprintf("%s exists, the kubelet log in %s is not available to "+
+			"oc adm node-logs", nodeLogLink, wmcb.logDir))
+		return nil
+	}
+	// The directory is not recorded, so that uninstall does not remove the logs written to it since
+	if err = os.MkdirAll(nodeLogDir, os.ModeDir); err != nil {
+		return fmt.Errorf("could not make %s directory: %v", nodeLogDir, err)
+	}
+	if err = os.Symlink(wmcb.logDir, nodeLogLink); err != nil {
+		return fmt.Errorf("could not link %s to %s: %v", nodeLogLink, wmcb.logDir, err)
+	}
+	return wmcb.record(journal.Created, journal.File, nodeLogLink, "link to "+wmcb.logDir)
+}
@@ -0,0 +1,297 @@
+package bootstrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+)
+
+const (
+	// manifestFileName is the name of the file in the install dir recording the files installed by WMCB
+	manifestFileName = "wmcb-manifest.json"
+	// payloadDirName is the directory in the install dir holding a pristine copy of every recorded file, used to
+	// restore drifted files
+	payloadDirName = "wmcb-payload"
+)
+
+// InstalledFile describes a file installed by WMCB at the time it was recorded
+type InstalledFile struct {
+	// Path is the location of the file on the node
+	Path string `json:"path"`
+	// SHA256 is the hex encoded SHA256 of the file contents
+	SHA256 string `json:"sha256"`
+	// Size is the size of the file in bytes
+	Size int64 `json:"size"`
+	// Version is the version reported by the binary, if it reports one
+	Version string `json:"version,omitempty"`
+}
+
+// manifest records the files installed by WMCB
+type manifest struct {
+	// Recorded is the time the manifest was last updated
+	Recorded time.Time `json:"recorded"`
+	// Files are the recorded files keyed by their lower cased path
+	Files map[string]InstalledFile `json:"files"`
+}
+
+// Drift describes a recorded file that no longer matches its recorded state
+type Drift struct {
+	// File is the recorded state of the file
+	File InstalledFile
+	// ActualSHA256 is the current SHA256 of the file, empty if the file is missing
+	ActualSHA256 string
+	// Restored is true if the file was restored from the payload
+	Restored bool
+}
+
+// String returns a human readable description of the drift
+func (d Drift) String() string {
+	if d.ActualSHA256 == "" {
+		return fmt.Sprintf("%s is missing", d.File.Path)
+	}
+	return fmt.Sprintf("%s has SHA256 %s, expected %s", d.File.Path, d.ActualSHA256, d.File.SHA256)
+}
+
+// fileSHA256 returns the hex encoded SHA256 of the given file
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// EnsureBinaryVersion ensures that the file at path has the given SHA256. If it does not and a source is given, the
+// source is copied over it, provided the source has the expected SHA256.
+func EnsureBinaryVersion(path, expectedSHA256, source string) error {
+	actual, _, err := fileSHA256(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error hashing %s: %v", path, err)
+	}
+	if strings.EqualFold(actual, expectedSHA256) {
+		return nil
+	}
+	if source == "" {
+		return fmt.Errorf("%s has SHA256 %s, expected %s", path, actual, expectedSHA256)
+	}
+
+	sourceSHA256, _, err := fileSHA256(source)
+	if err != nil {
+		return fmt.Errorf("error hashing %s: %v", source, err)
+	}
+	if !strings.EqualFold(sourceSHA256, expectedSHA256) {
+		return fmt.Errorf("source %s has SHA256 %s, expected %s", source, sourceSHA256, expectedSHA256)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModeDir); err != nil {
+		return fmt.Errorf("could not make %s directory: %v", filepath.Dir(path), err)
+	}
+	// copyFile does not truncate, remove the existing file so that a larger drifted file is not left with a tail
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove %s: %v", path, err)
+	}
+	if err = copyFile(source, path); err != nil {
+		return fmt.Errorf("error copying %s --> %s: %v", source, path, err)
+	}
+	return nil
+}
+
+// manifestPath returns the location of the manifest
+func (wmcb *winNodeBootstrapper) manifestPath() string {
+	return filepath.Join(wmcb.installDir, manifestFileName)
+}
+
+// readManifest reads the manifest from the install dir. An empty manifest is returned if none was recorded.
+func (wmcb *winNodeBootstrapper) readManifest() (*manifest, error) {
+	return readManifestFile(wmcb.manifestPath())
+}
+
+// readManifestFile reads the manifest at the given location. An empty manifest is returned if none was recorded.
+func readManifestFile(manifestPath string) (*manifest, error) {
+	m := &manifest{Files: make(map[string]InstalledFile)}
+	contents, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("could not read %s: %v", manifestPath, err)
+	}
+	if err = json.Unmarshal(contents, m); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", manifestPath, err)
+	}
+	return m, nil
+}
+
+// InstalledFiles returns the files recorded as installed by WMCB in the given install dir, sorted by path, without
+// connecting to the Windows services like NewWinNodeBootstrapper
+func InstalledFiles(installDir string) ([]InstalledFile, error) {
+	m, err := readManifestFile(filepath.Join(installDir, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]InstalledFile, 0, len(m.Files))
+	for _, file := range m.Files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// installedFiles returns the files currently installed by WMCB in the install dir
+func (wmcb *winNodeBootstrapper) installedFiles() []string {
+	files := []string{
+		filepath.Join(wmcb.installDir, "kubelet.exe"),
+		wmcb.kubeletConfPath,
+		filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
+		filepath.Join(wmcb.installDir, "kubelet-ca.crt"),
+	}
+	if cloudConfig, ok := wmcb.kubeletArgs[cloudConfigOption]; ok {
+		files = append(files, cloudConfig)
+	}
+	// The plugin directories are walked as a whole so that the plugins configured by an earlier invocation are
+	// recorded as well
+	for _, dir := range []string{filepath.Join(wmcb.installDir, cniDirName),
+		filepath.Join(wmcb.installDir, credentialProviderDirName)} {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	if _, err := os.Stat(filepath.Join(wmcb.installDir, credentialProviderConfigName)); err == nil {
+		files = append(files, filepath.Join(wmcb.installDir, credentialProviderConfigName))
+	}
+	return files
+}
+
+// recordInstalledFiles records the hash and version of the installed files in the manifest and copies them to the
+// payload directory so that they can be restored if they drift
+func (wmcb *winNodeBootstrapper) recordInstalledFiles() error {
+	m, err := wmcb.readManifest()
+	if err != nil {
+		return err
+	}
+	payloadDir := filepath.Join(wmcb.installDir, payloadDirName)
+	if err = wmcb.recordDir(payloadDir, os.ModeDir); err != nil {
+		return err
+	}
+
+	for _, path := range wmcb.installedFiles() {
+		sha, size, err := fileSHA256(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("error hashing %s: %v", path, err)
+		}
+		file := InstalledFile{Path: path, SHA256: sha, Size: size}
+		if strings.EqualFold(filepath.Base(path), "kubelet.exe") {
+			file.Version = binaryVersion(path)
+		}
+
+		// The payload copy is stored by hash, as different files can have the same name
+		payloadFile := filepath.Join(payloadDir, sha)
+		if _, err := os.Stat(payloadFile); os.IsNotExist(err) {
+			if err = copyFile(path, payloadFile); err != nil {
+				return fmt.Errorf("error copying %s --> %s: %v", path, payloadFile, err)
+			}
+		}
+		m.Files[strings.ToLower(path)] = file
+	}
+
+	m.Recorded = time.Now()
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %v", err)
+	}
+	if err = ioutil.WriteFile(wmcb.manifestPath(), out, 0644); err != nil {
+		return fmt.Errorf("could not write to %s: %v", wmcb.manifestPath(), err)
+	}
+	return wmcb.record(journal.Created, journal.File, wmcb.manifestPath(), "")
+}
+
+// binaryVersion returns the version reported by the binary's --version option, or an empty string if it does not
+// report one
+func binaryVersion(path string) string {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Verify compares the installed files against the manifest and returns the files that drifted from their recorded
+// state. If restore is true, the drifted files are restored from the payload and the kubelet service is restarted.
+func (wmcb *winNodeBootstrapper) Verify(restore bool) ([]Drift, error) {
+	m, err := wmcb.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("no files recorded in %s", wmcb.manifestPath())
+	}
+
+	// Sort the files for a stable output
+	keys := make([]string, 0, len(m.Files))
+	for key := range m.Files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var drifts []Drift
+	for _, key := range keys {
+		file := m.Files[key]
+		actual, _, err := fileSHA256(file.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error hashing %s: %v", file.Path, err)
+		}
+		if strings.EqualFold(actual, file.SHA256) {
+			continue
+		}
+		drifts = append(drifts, Drift{File: file, ActualSHA256: actual})
+	}
+	if !restore || len(drifts) == 0 {
+		return drifts, nil
+	}
+
+	// Stop the kubelet service as there could be open file handles from kubelet.exe on the drifted files
+	if wmcb.kubeletSVC != nil {
+		if err = wmcb.stopKubeletService(); err != nil {
+			return drifts, fmt.Errorf("unable to stop kubelet service: %v", err)
+		}
+	}
+	for i := range drifts {
+		payloadFile := filepath.Join(wmcb.installDir, payloadDirName, drifts[i].File.SHA256)
+		if err = EnsureBinaryVersion(drifts[i].File.Path, drifts[i].File.SHA256, payloadFile); err != nil {
+			return drifts, fmt.Errorf("unable to restore %s: %v", drifts[i].File.Path, err)
+		}
+		drifts[i].Restored = true
+		if err = wmcb.record(journal.Created, journal.File, drifts[i].File.Path, "restored from payload"); err != nil {
+			return drifts, err
+		}
+	}
+	if wmcb.kubeletSVC != nil {
+		if err = wmcb.startKubeletService(); err != nil {
+			return drifts, fmt.Errorf("unable to start kubelet service: %v", err)
+		}
+	}
+	return drifts, nil
+}
@@ -0,0 +1,188 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"k8s.io/apimachinery/pkg/api/resource"
+	kubeletConfig "k8s.io/kubelet/config/v1beta1"
+)
+
+const (
+	// memoryAvailableSignal is the eviction signal for the available memory of the node
+	memoryAvailableSignal = "memory.available"
+	// pagefileUnchanged is the pagefile size indicating that the pagefile configuration should be left as is
+	pagefileUnchanged = -1
+	// minMemoryWithoutPagefile is the minimum physical memory of a node for the pagefile to be disabled. On Windows the
+	// commit limit is the sum of the physical memory and the pagefile, so without a pagefile smaller nodes run out of
+	// commit and the kubelet is killed before it gets a chance to evict pods.
+	minMemoryWithoutPagefile = 8 * 1024 * 1024 * 1024
+	// pagefilePath is the location of the pagefile configured by WMCB
+	pagefilePath = "C:\\pagefile.sys"
+)
+
+// memoryOptions holds the pagefile and eviction configuration of the node
+type memoryOptions struct {
+	// pagefileSizeMB is the size of the pagefile in MB. 0 disables the pagefile and pagefileUnchanged leaves the
+	// existing configuration as is.
+	pagefileSizeMB int
+	// evictionHard are the hard eviction thresholds of the kubelet, overriding the ones in the ignition kubelet config
+	evictionHard map[string]string
+}
+
+// SetMemoryOptions sets the pagefile size in MB and the kubelet hard eviction thresholds, given in the kubelet
+// --eviction-hard format, e.g. "memory.available<500Mi,nodefs.available<10%". A pagefile size of -1 leaves the
+// pagefile configuration as is, 0 disables the pagefile. The options are verified against the node before the kubelet
+// is initialized.
+func (wmcb *winNodeBootstrapper) SetMemoryOptions(pagefileSizeMB int, evictionHard string) error {
+	if pagefileSizeMB < pagefileUnchanged {
+		return fmt.Errorf("invalid pagefile size %d", pagefileSizeMB)
+	}
+	thresholds, err := parseEvictionThresholds(evictionHard)
+	if err != nil {
+		return err
+	}
+	wmcb.memory = &memoryOptions{
+		pagefileSizeMB: pagefileSizeMB,
+		evictionHard:   thresholds,
+	}
+	return nil
+}
+
+// parseEvictionThresholds parses thresholds in the kubelet --eviction-hard format into the map used in the kubelet
+// configuration
+func parseEvictionThresholds(evictionHard string) (map[string]string, error) {
+	thresholds := make(map[string]string)
+	if evictionHard == "" {
+		return thresholds, nil
+	}
+	for _, threshold := range strings.Split(evictionHard, ",") {
+		kv := strings.SplitN(threshold, "<", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid eviction threshold %s, expected <signal><<quantity>", threshold)
+		}
+		if !strings.HasSuffix(kv[1], "%") {
+			if _, err := resource.ParseQuantity(kv[1]); err != nil {
+				return nil, fmt.Errorf("invalid eviction threshold quantity %s: %v", kv[1], err)
+			}
+		}
+		thresholds[kv[0]] = kv[1]
+	}
+	return thresholds, nil
+}
+
+// applyToKubeletConfig overrides the hard eviction thresholds of the kubelet configuration
+func (m *memoryOptions) applyToKubeletConfig(config *kubeletConfig.KubeletConfiguration) {
+	if len(m.evictionHard) == 0 {
+		return
+	}
+	if config.EvictionHard == nil {
+		config.EvictionHard = make(map[string]string)
+	}
+	for signal, quantity := range m.evictionHard {
+		config.EvictionHard[signal] = quantity
+	}
+}
+
+// preflight verifies that the memory options are sane for the physical memory of the node
+func (m *memoryOptions) preflight(totalMemory uint64) error {
+	if m.pagefileSizeMB == 0 && totalMemory < minMemoryWithoutPagefile {
+		return fmt.Errorf("cannot disable the pagefile on a node with %d bytes of memory, at least %d bytes are "+
+			"required", totalMemory, uint64(minMemoryWithoutPagefile))
+	}
+
+	threshold, found := m.evictionHard[memoryAvailableSignal]
+	if !found {
+		return nil
+	}
+	var thresholdBytes uint64
+	if strings.HasSuffix(threshold, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil || percentage < 0 || percentage >= 100 {
+			return fmt.Errorf("invalid %s eviction percentage %s", memoryAvailableSignal, threshold)
+		}
+		thresholdBytes = uint64(percentage / 100 * float64(totalMemory))
+	} else {
+		quantity, err := resource.ParseQuantity(threshold)
+		if err != nil {
+			return fmt.Errorf("invalid %s eviction threshold %s: %v", memoryAvailableSignal, threshold, err)
+		}
+		thresholdBytes = uint64(quantity.Value())
+	}
+	if thresholdBytes >= totalMemory {
+		return fmt.Errorf("%s eviction threshold %s exceeds the node memory of %d bytes", memoryAvailableSignal,
+			threshold, totalMemory)
+	}
+	return nil
+}
+
+// preflightMemory verifies the memory options against the physical memory of the node
+func (wmcb *winNodeBootstrapper) preflightMemory() error {
+	totalMemory, err := totalPhysicalMemory()
+	if err != nil {
+		return err
+	}
+	return wmcb.memory.preflight(totalMemory)
+}
+
+// configurePagefile sets the pagefile to a fixed size or disables it. The change takes effect after a reboot.
+func (m *memoryOptions) configurePagefile() error {
+	if m.pagefileSizeMB == pagefileUnchanged {
+		return nil
+	}
+	// Automatic management has to be turned off before the pagefile settings can be changed
+	cmd := "Get-CimInstance Win32_ComputerSystem | Set-CimInstance -Property @{AutomaticManagedPagefile=$false}; " +
+		"Get-CimInstance Win32_PageFileSetting | Remove-CimInstance"
+	if m.pagefileSizeMB > 0 {
+		cmd += fmt.Sprintf("; New-CimInstance -ClassName Win32_PageFileSetting -Property "+
+			"@{Name='%s'; InitialSize=[uint32]%d; MaximumSize=[uint32]%d}", pagefilePath, m.pagefileSizeMB,
+			m.pagefileSizeMB)
+	}
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		cmd).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not configure pagefile: %v: %s", err, out)
+	}
+	return nil
+}
+
+// rebootWarning returns the warning telling that the node has to be rebooted for the pagefile change to take effect
+func (m *memoryOptions) rebootWarning() string {
+	change := fmt.Sprintf("set to %d MB", m.pagefileSizeMB)
+	if m.pagefileSizeMB == 0 {
+		change = "disabled"
+	}
+	return fmt.Sprintf("reboot required: the pagefile was %s, which only takes effect after the node is rebooted",
+		change)
+}
+
+// memoryStatusEx is the MEMORYSTATUSEX structure used by GlobalMemoryStatusEx
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// globalMemoryStatusEx is the kernel32 procedure used to query the memory of the node
+var globalMemoryStatusEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+// totalPhysicalMemory returns the physical memory of the node in bytes
+func totalPhysicalMemory() (uint64, error) {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	ret, _, err := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return 0, fmt.Errorf("could not get memory status: %v", err)
+	}
+	return status.totalPhys, nil
+}
@@ -0,0 +1,84 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/ipfamily"
+)
+
+const (
+	// nodeIPOption is the kubelet CLI option for the addresses the node registers with
+	nodeIPOption = "--node-ip"
+	// natInterfaceName is the name of the host interface of the NAT network created by Docker, whose addresses are
+	// not reachable from the cluster
+	natInterfaceName = "vEthernet (nat)"
+)
+
+// nodeIPOptions holds the IP family and the addresses of the node
+type nodeIPOptions struct {
+	// family is the IP family of the node
+	family ipfamily.Family
+	// nodeIPs are the addresses of the node, the primary one first
+	nodeIPs []net.IP
+}
+
+// SetNodeIPOptions sets the IP family of the node, ipv4, ipv6 or dual, and the addresses the kubelet registers the
+// node with: one for a single-stack node, one of each family for a dual-stack node. Without addresses, the first
+// global unicast address of each family of the network interfaces of the node is used. Dual-stack nodes get the
+// IPv6DualStack feature gate.
+func (wmcb *winNodeBootstrapper) SetNodeIPOptions(family string, nodeIPs []string) error {
+	f, err := ipfamily.Parse(family)
+	if err != nil {
+		return err
+	}
+	var ips []net.IP
+	if len(nodeIPs) > 0 {
+		ips, err = ipfamily.ParseNodeIPs(f, nodeIPs)
+	} else {
+		var candidates []net.IP
+		if candidates, err = hostAddresses(); err != nil {
+			return err
+		}
+		ips, err = ipfamily.SelectNodeIPs(f, candidates)
+	}
+	if err != nil {
+		return err
+	}
+	wmcb.nodeIP = &nodeIPOptions{family: f, nodeIPs: ips}
+	return nil
+}
+
+// hostAddresses returns the addresses of the network interfaces of the node that are up, in the order of the
+// interfaces
+func hostAddresses() ([]net.IP, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("could not list network interfaces: %v", err)
+	}
+	var addresses []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Name == natInterfaceName {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("could not get the addresses of network interface %s: %v", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				addresses = append(addresses, ipNet.IP)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// kubeletArgs returns the kubelet arguments for the addresses and the family of the node
+func (n *nodeIPOptions) kubeletArgs() []string {
+	args := []string{nodeIPOption + "=" + ipfamily.NodeIPArg(n.nodeIPs)}
+	if n.family == ipfamily.DualStack {
+		args = append(args, featureGatesOption+"="+setFeatureGate("", ipfamily.DualStackFeatureGate, true))
+	}
+	return args
+}
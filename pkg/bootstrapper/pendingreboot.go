@@ -0,0 +1,32 @@
+package bootstrapper
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/pendingreboot"
+)
+
+// SkipPendingRebootCheck disables the preflight check that the node is not pending a reboot, e.g. when the reboot is
+// known to be unrelated to the node components
+func (wmcb *winNodeBootstrapper) SkipPendingRebootCheck() {
+	wmcb.skipPendingRebootCheck = true
+}
+
+// preflightPendingReboot returns an error if the node waits for a reboot to complete the installation of a Windows
+// feature or a computer rename, as the kubelet would then fail to start or register under the wrong name. A warning is
+// recorded for the other pending reboots, or if they cannot be detected.
+func (wmcb *winNodeBootstrapper) preflightPendingReboot() error {
+	reasons, err := pendingreboot.Get()
+	if err != nil {
+		wmcb.warnings = append(wmcb.warnings, fmt.Sprintf("could not check for a pending reboot: %v", err))
+		return nil
+	}
+	warning, err := pendingreboot.Check(reasons)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		wmcb.warnings = append(wmcb.warnings, warning)
+	}
+	return nil
+}
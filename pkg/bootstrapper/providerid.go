@@ -0,0 +1,80 @@
+package bootstrapper
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/providerid"
+)
+
+const (
+	// providerIDOption is the kubelet CLI option for the provider ID the node registers with
+	providerIDOption = "--provider-id"
+	// ProviderIDAuto computes the provider ID of the node on the platform of its kubelet cloud provider
+	ProviderIDAuto = "auto"
+	// ProviderIDNone does not pass a provider ID to the kubelet, leaving it to the kubelet cloud provider
+	ProviderIDNone = "none"
+)
+
+// providerIDOptions holds the provider ID of the node, which the cloud controller managers find its instance by
+type providerIDOptions struct {
+	// value is the provider ID given to SetProviderIDOptions, ProviderIDAuto or ProviderIDNone
+	value string
+	// resolver computes the provider ID of the node on its platform
+	resolver *providerid.Resolver
+	// providerID is the provider ID the kubelet registers the node with, empty if none is passed
+	providerID string
+}
+
+// SetProviderIDOptions sets the provider ID the kubelet registers the node with: ProviderIDAuto to compute it on the
+// platform of the cloud provider of the kubelet from the ignition file, ProviderIDNone to leave it to the kubelet, or
+// the provider ID itself, which is checked against the format of the platform. The nodes without a cloud provider get
+// no computed provider ID. A provider ID that cannot be computed is reported as a warning, so that the node still
+// joins the cluster.
+func (wmcb *winNodeBootstrapper) SetProviderIDOptions(providerID string) error {
+	if providerID == "" {
+		providerID = ProviderIDAuto
+	}
+	if err := validateKubeletArgValue("provider ID", providerID); err != nil {
+		return err
+	}
+	wmcb.providerID = &providerIDOptions{value: providerID, resolver: providerid.NewResolver()}
+	return nil
+}
+
+// resolveProviderID sets the provider ID the kubelet registers the node with, once the cloud provider of the kubelet
+// is known from the ignition file
+func (wmcb *winNodeBootstrapper) resolveProviderID() error {
+	options := wmcb.providerID
+	if options == nil || options.value == ProviderIDNone {
+		return nil
+	}
+	platform, known := providerid.ParsePlatform(wmcb.kubeletArgs["cloud-provider"])
+	if options.value != ProviderIDAuto {
+		if known {
+			if err := providerid.Validate(platform, options.value); err != nil {
+				return err
+			}
+		}
+		options.providerID = options.value
+		return nil
+	}
+	if !known {
+		return nil
+	}
+	providerID, err := options.resolver.ProviderID(platform)
+	if err != nil {
+		wmcb.warnings = append(wmcb.warnings, fmt.Sprintf("could not compute the provider ID of the node on %s, "+
+			"the cloud controller manager may not recognize the node: %v", platform, err))
+		return nil
+	}
+	options.providerID = providerID
+	return nil
+}
+
+// kubeletArgs returns the kubelet arguments for the provider ID of the node
+func (p *providerIDOptions) kubeletArgs() []string {
+	if p.providerID == "" {
+		return nil
+	}
+	return []string{providerIDOption + "=" + p.providerID}
+}
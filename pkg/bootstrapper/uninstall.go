@@ -0,0 +1,72 @@
+package bootstrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/agent"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/monitor"
+)
+
+// Uninstall reverts the node to its state before it was bootstrapped. It stops and removes the kubelet, monitor
+// and agent services, reverts the changes recorded in the journal and removes the node credentials along with the files
+// installed by WMCB, so that the node can be bootstrapped again with a new identity. The log directory, holding the
+// journal, is preserved.
+func (wmcb *winNodeBootstrapper) Uninstall() error {
+	// The certificates are wherever the kubelet service was told to keep them, which is lost once it is removed
+	certDir := wmcb.installedCertDir()
+	if wmcb.kubeletSVC != nil {
+		if err := wmcb.StopAndRemoveServices(); err != nil {
+			return fmt.Errorf("unable to remove kubelet service: %v", err)
+		}
+		// We need to refresh the service manager to allow the service to be removed by Windows
+		if err := wmcb.refreshServiceManager(); err != nil {
+			return fmt.Errorf("unable to refresh service manager: %v", err)
+		}
+		wmcb.kubeletSVC = nil
+	}
+	if err := monitor.RemoveService(); err != nil {
+		return err
+	}
+	if err := agent.RemoveService(); err != nil {
+		return err
+	}
+	if err := wmcb.revertJournal(); err != nil {
+		return fmt.Errorf("unable to revert journal: %v", err)
+	}
+
+	paths := []string{
+		// The files generated by the kubelet are not recorded in the journal, neither are the files installed by
+		// versions of WMCB without a journal. The kubelet certificates and kubeconfig are the identity of the node.
+		certDir,
+		wmcb.kubeconfigPath,
+		filepath.Join(wmcb.installDir, "bootstrap-kubeconfig"),
+		wmcb.kubeletConfPath,
+		filepath.Join(wmcb.installDir, "kubelet-ca.crt"),
+		filepath.Join(wmcb.installDir, "kubelet.exe"),
+		filepath.Join(wmcb.installDir, cniDirName),
+		filepath.Join(wmcb.installDir, credentialProviderDirName),
+		filepath.Join(wmcb.installDir, credentialProviderConfigName),
+		filepath.Join(wmcb.installDir, manifestFileName),
+		filepath.Join(wmcb.installDir, payloadDirName),
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if err = os.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove %s: %v", path, err)
+		}
+		kind := journal.File
+		if info.IsDir() {
+			kind = journal.Directory
+		}
+		if err = wmcb.record(journal.Removed, kind, path, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
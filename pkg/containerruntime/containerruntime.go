@@ -0,0 +1,78 @@
+package containerruntime
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/*
+	containerruntime describes the container runtimes a Windows node can run its containers with, Docker through the
+	dockershim of the kubelet or containerd through CRI, so that the kubelet arguments, the Windows service the kubelet
+	depends on and the tools used to manage the images all follow from the runtime selected for the node.
+*/
+
+// Runtime is a container runtime of a Windows node
+type Runtime string
+
+const (
+	// Auto detects the runtime of the node, preferring Docker when both are installed
+	Auto Runtime = "auto"
+	// Docker is the Docker engine, used by the kubelet through its dockershim
+	Docker Runtime = "docker"
+	// Containerd is containerd, used by the kubelet through CRI
+	Containerd Runtime = "containerd"
+
+	// containerdEndpoint is the CRI endpoint of containerd on Windows
+	containerdEndpoint = "npipe:////./pipe/containerd-containerd"
+)
+
+// Parse returns the Runtime for the given name: auto, docker or containerd
+func Parse(name string) (Runtime, error) {
+	switch runtime := Runtime(strings.ToLower(name)); runtime {
+	case Auto, Docker, Containerd:
+		return runtime, nil
+	}
+	return "", fmt.Errorf("unknown container runtime %s, expected auto, docker or containerd", name)
+}
+
+// Detect returns the container runtime installed on the node, Docker if both are installed
+func Detect() (Runtime, error) {
+	if _, err := exec.LookPath("docker"); err == nil {
+		return Docker, nil
+	}
+	if _, err := exec.LookPath("ctr"); err == nil {
+		return Containerd, nil
+	}
+	return "", fmt.Errorf("neither docker nor ctr found in the Path")
+}
+
+// Resolve returns the given runtime, or the runtime installed on the node if it is Auto
+func Resolve(runtime Runtime) (Runtime, error) {
+	if runtime == Auto {
+		return Detect()
+	}
+	return runtime, nil
+}
+
+// ServiceName returns the name of the Windows service of the runtime
+func (r Runtime) ServiceName() string {
+	return string(r)
+}
+
+// CRIEndpoint returns the CRI endpoint of the runtime, empty for Docker which the kubelet talks to through its
+// dockershim
+func (r Runtime) CRIEndpoint() string {
+	if r == Containerd {
+		return containerdEndpoint
+	}
+	return ""
+}
+
+// KubeletArgs returns the kubelet arguments selecting the runtime
+func (r Runtime) KubeletArgs() []string {
+	if r == Containerd {
+		return []string{"--container-runtime=remote", "--container-runtime-endpoint=" + r.CRIEndpoint()}
+	}
+	return []string{"--container-runtime=docker"}
+}
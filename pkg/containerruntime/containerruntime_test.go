@@ -0,0 +1,30 @@
+package containerruntime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParse tests the parsing of the runtime names
+func TestParse(t *testing.T) {
+	runtime, err := Parse("Containerd")
+	require.NoError(t, err)
+	assert.Equal(t, Containerd, runtime)
+	runtime, err = Parse("auto")
+	require.NoError(t, err)
+	assert.Equal(t, Auto, runtime)
+	_, err = Parse("cri-o")
+	assert.Error(t, err)
+}
+
+// TestKubeletArgs tests that containerd is used through its CRI endpoint and Docker through the dockershim
+func TestKubeletArgs(t *testing.T) {
+	assert.Equal(t, []string{"--container-runtime=remote",
+		"--container-runtime-endpoint=npipe:////./pipe/containerd-containerd"}, Containerd.KubeletArgs())
+	assert.Equal(t, []string{"--container-runtime=docker"}, Docker.KubeletArgs())
+	assert.Empty(t, Docker.CRIEndpoint())
+	assert.Equal(t, "containerd", Containerd.ServiceName())
+	assert.Equal(t, "docker", Docker.ServiceName())
+}
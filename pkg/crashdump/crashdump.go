@@ -0,0 +1,124 @@
+package crashdump
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+/*
+	crashdump configures Windows Error Reporting to write LocalDumps for the node components. Without it an access
+	violation in the kubelet, containerd or one of the CNI plugins leaves nothing behind on the node. The dumps are
+	written to a single directory so that they can be retrieved along with the logs.
+	https://docs.microsoft.com/en-us/windows/win32/wer/collecting-user-mode-dumps
+*/
+
+// DumpType is the type of dump written by Windows Error Reporting
+type DumpType uint32
+
+const (
+	// MiniDump only captures the stack and the loaded modules of the crashed process
+	MiniDump DumpType = 1
+	// FullDump captures the entire memory of the crashed process
+	FullDump DumpType = 2
+
+	// localDumpsKey is the registry key under which the per executable LocalDumps configuration lives
+	localDumpsKey = `SOFTWARE\Microsoft\Windows\Windows Error Reporting\LocalDumps`
+)
+
+// DefaultBinaries are the node component executables for which dumps are collected. CNI plugins are added separately
+// as they depend on the CNI package deployed on the node.
+var DefaultBinaries = []string{"kubelet.exe", "kube-proxy.exe", "containerd.exe", "hybrid-overlay.exe"}
+
+// ParseDumpType returns the DumpType for the given name, either "mini" or "full"
+func ParseDumpType(name string) (DumpType, error) {
+	switch strings.ToLower(name) {
+	case "mini":
+		return MiniDump, nil
+	case "full":
+		return FullDump, nil
+	}
+	return 0, fmt.Errorf("unknown dump type %s, expected mini or full", name)
+}
+
+// Configure creates the dump directory and configures LocalDumps for each of the given executable names so that
+// at most dumpCount dumps of the given type are kept in dumpDir
+func Configure(dumpDir string, dumpType DumpType, dumpCount uint32, binaries []string) error {
+	if dumpType != MiniDump && dumpType != FullDump {
+		return fmt.Errorf("invalid dump type %d", dumpType)
+	}
+	if dumpCount == 0 {
+		return fmt.Errorf("dump count must be greater than 0")
+	}
+	if err := os.MkdirAll(dumpDir, os.ModeDir); err != nil {
+		return fmt.Errorf("could not make %s directory: %v", dumpDir, err)
+	}
+
+	for _, binary := range binaries {
+		if err := configureBinary(binary, dumpDir, dumpType, dumpCount); err != nil {
+			return fmt.Errorf("could not configure LocalDumps for %s: %v", binary, err)
+		}
+	}
+	return nil
+}
+
+// RegistryKey returns the LocalDumps registry key of the given executable, prefixed with HKLM
+func RegistryKey(binary string) string {
+	return `HKLM\` + localDumpsKey + `\` + binary
+}
+
+// configureBinary writes the LocalDumps registry values for a single executable
+func configureBinary(binary, dumpDir string, dumpType DumpType, dumpCount uint32) error {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, localDumpsKey+`\`+binary, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("could not create registry key: %v", err)
+	}
+	defer key.Close()
+
+	if err = key.SetExpandStringValue("DumpFolder", dumpDir); err != nil {
+		return fmt.Errorf("could not set DumpFolder: %v", err)
+	}
+	if err = key.SetDWordValue("DumpType", uint32(dumpType)); err != nil {
+		return fmt.Errorf("could not set DumpType: %v", err)
+	}
+	if err = key.SetDWordValue("DumpCount", dumpCount); err != nil {
+		return fmt.Errorf("could not set DumpCount: %v", err)
+	}
+	return nil
+}
+
+// NodeBinaries returns the names of the executables dumps are collected for: the DefaultBinaries, the given additional
+// ones and the CNI plugins of the given directory. The CNI plugins are only present once the CNI was configured, a
+// missing directory is not an error.
+func NodeBinaries(cniDir string, extra []string) ([]string, error) {
+	binaries := append(append([]string{}, DefaultBinaries...), extra...)
+	if _, err := os.Stat(cniDir); err != nil {
+		return binaries, nil
+	}
+	cniBinaries, err := Binaries(cniDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not get CNI binaries: %v", err)
+	}
+	return append(binaries, cniBinaries...), nil
+}
+
+// Binaries returns the names of the executables in the given directory. It is used to collect dumps for every CNI
+// plugin deployed on the node.
+func Binaries(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	var binaries []string
+	for _, file := range files {
+		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), ".exe") {
+			continue
+		}
+		binaries = append(binaries, file.Name())
+	}
+	return binaries, nil
+}
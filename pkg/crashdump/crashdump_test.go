@@ -0,0 +1,66 @@
+package crashdump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDumpType tests that the dump types are parsed case insensitively and that unknown ones are rejected
+func TestParseDumpType(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    DumpType
+		expectedErr bool
+	}{
+		{"mini", MiniDump, false},
+		{"full", FullDump, false},
+		{"Full", FullDump, false},
+		{"MINI", MiniDump, false},
+		{"", 0, true},
+		{"heap", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dumpType, err := ParseDumpType(test.name)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, dumpType)
+		})
+	}
+}
+
+// TestBinaries tests that only the executables of the CNI directory are returned
+func TestBinaries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cni")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"flannel.exe", "host-local.EXE", "win-overlay.exe", "cni.conf", "README"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "config.exe"), 0755))
+
+	binaries, err := Binaries(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"flannel.exe", "host-local.EXE", "win-overlay.exe"}, binaries)
+
+	_, err = Binaries(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+
+	binaries, err = NodeBinaries(dir, []string{"containerd-shim-runhcs-v1.exe"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, append(append([]string{}, DefaultBinaries...), "containerd-shim-runhcs-v1.exe",
+		"flannel.exe", "host-local.EXE", "win-overlay.exe"), binaries)
+
+	// The CNI directory does not exist until the CNI is configured
+	binaries, err = NodeBinaries(filepath.Join(dir, "missing"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBinaries, binaries)
+}
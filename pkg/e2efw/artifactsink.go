@@ -0,0 +1,247 @@
+package e2efw
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// artifactSinksEnvVar is the environment variable giving the artifact sinks when -artifactSinks is not given
+	artifactSinksEnvVar = "E2E_ARTIFACT_SINKS"
+	// gcsEndpoint is the endpoint of the S3 compatible XML API of Google Cloud Storage
+	gcsEndpoint = "https://storage.googleapis.com"
+	// gcsAccessKeyEnvVar and gcsSecretEnvVar are the environment variables holding the HMAC key the artifacts are
+	// stored in Google Cloud Storage with
+	gcsAccessKeyEnvVar = "GCS_HMAC_ACCESS_KEY_ID"
+	gcsSecretEnvVar    = "GCS_HMAC_SECRET"
+	// defaultS3Region is the region of the S3 buckets given without one
+	defaultS3Region = "us-east-1"
+	// artifactUploadConcurrency is the number of parts of a large artifact uploaded in parallel
+	artifactUploadConcurrency = 4
+)
+
+// ArtifactSink stores the artifacts of the run beyond the lifetime of the test host, e.g. an ephemeral CI runner
+type ArtifactSink interface {
+	// Store stores the artifact of the given name, a slash separated path relative to the artifact directory, with the
+	// given content
+	Store(name string, content io.Reader) error
+	// String returns the location of the sink, e.g. s3://<bucket>/<prefix>
+	String() string
+}
+
+// ArtifactSinks is used for parsing the artifactSinks command line argument
+type ArtifactSinks []ArtifactSink
+
+// Set populates the artifact sinks from the comma separated list of locations of the artifactSinks command line
+// argument: directories, given by absolute path or as file:///<path>, s3://<bucket>/<prefix>?region=<region> S3
+// prefixes and gs://<bucket>/<prefix> Google Cloud Storage prefixes
+func (s *ArtifactSinks) Set(value string) error {
+	for _, location := range strings.Split(value, ",") {
+		if location = strings.TrimSpace(location); location == "" {
+			continue
+		}
+		sink, err := ParseArtifactSink(location)
+		if err != nil {
+			return err
+		}
+		*s = append(*s, sink)
+	}
+	return nil
+}
+
+func (s *ArtifactSinks) String() string {
+	var locations []string
+	for _, sink := range *s {
+		locations = append(locations, sink.String())
+	}
+	return strings.Join(locations, ",")
+}
+
+// ParseArtifactSink returns the artifact sink of the given location, a directory, given by absolute path or as
+// file:///<path>, an s3://<bucket>/<prefix>?region=<region> S3 prefix, or a gs://<bucket>/<prefix> Google Cloud Storage
+// prefix. The S3 sinks use the AWS credentials of the test suite and the Google Cloud Storage ones the HMAC key given by
+// GCS_HMAC_ACCESS_KEY_ID and GCS_HMAC_SECRET.
+func ParseArtifactSink(location string) (ArtifactSink, error) {
+	if filepath.IsAbs(location) {
+		return &dirSink{dir: filepath.Clean(location)}, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact sink %q: %v", location, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid artifact sink %q, no directory given", location)
+		}
+		return &dirSink{dir: filepath.FromSlash(u.Path)}, nil
+	case "s3", "gs":
+	default:
+		return nil, fmt.Errorf("invalid artifact sink %q, expected a directory, s3://<bucket>/<prefix> or "+
+			"gs://<bucket>/<prefix>", location)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid artifact sink %q, no bucket given", location)
+	}
+	config := awssdk.NewConfig()
+	if u.Scheme == "gs" {
+		accessKey, secret := os.Getenv(gcsAccessKeyEnvVar), os.Getenv(gcsSecretEnvVar)
+		if accessKey == "" || secret == "" {
+			return nil, fmt.Errorf("artifact sink %s requires %s and %s", location, gcsAccessKeyEnvVar,
+				gcsSecretEnvVar)
+		}
+		config = config.WithEndpoint(gcsEndpoint).WithRegion("auto").WithS3ForcePathStyle(true).
+			WithCredentials(credentials.NewStaticCredentials(accessKey, secret, ""))
+	} else {
+		region := u.Query().Get("region")
+		if region == "" {
+			region = defaultS3Region
+		}
+		config = config.WithRegion(region)
+		// The flags are parsed before the CI variables are initialized
+		if path := os.Getenv(awsCredentialsEnvVar); path != "" {
+			config = config.WithCredentials(credentials.NewSharedCredentials(path, "default"))
+		}
+	}
+	return newObjectSink(u.Scheme, u.Host, u.Path, config)
+}
+
+// artifactSinksFromEnv returns the artifact sinks given by E2E_ARTIFACT_SINKS
+func artifactSinksFromEnv() (ArtifactSinks, error) {
+	var sinks ArtifactSinks
+	if err := sinks.Set(os.Getenv(artifactSinksEnvVar)); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", artifactSinksEnvVar, err)
+	}
+	return sinks, nil
+}
+
+// dirSink stores the artifacts in a directory, e.g. a volume outliving the CI runner
+type dirSink struct {
+	// dir is the directory the artifacts are stored in
+	dir string
+}
+
+func (d *dirSink) Store(name string, content io.Reader) error {
+	dest := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create %s: %v", filepath.Dir(dest), err)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (d *dirSink) String() string {
+	return d.dir
+}
+
+// objectSink stores the artifacts in an S3 compatible object storage bucket, S3 or Google Cloud Storage, under a prefix
+type objectSink struct {
+	// scheme is the scheme of the location of the sink, s3 or gs
+	scheme string
+	// bucket is the name of the bucket
+	bucket string
+	// prefix is the prefix of the keys of the artifacts, empty or ending with /
+	prefix string
+	// uploader uploads the artifacts, in parallel parts for the large ones
+	uploader *s3manager.Uploader
+}
+
+// newObjectSink returns the sink storing the artifacts in the given bucket under the given prefix, with a client of
+// the given configuration
+func newObjectSink(scheme, bucket, prefix string, config *awssdk.Config) (*objectSink, error) {
+	session, err := awssession.NewSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the session of artifact sink %s://%s: %v", scheme, bucket, err)
+	}
+	sink := &objectSink{scheme: scheme, bucket: bucket}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		sink.prefix = prefix + "/"
+	}
+	sink.uploader = s3manager.NewUploaderWithClient(s3.New(session), func(u *s3manager.Uploader) {
+		u.Concurrency = artifactUploadConcurrency
+	})
+	return sink, nil
+}
+
+func (o *objectSink) Store(name string, content io.Reader) error {
+	// The objects carry the run context, so that they can be related to their run outside of its directory
+	_, err := o.uploader.Upload(&s3manager.UploadInput{Bucket: awssdk.String(o.bucket),
+		Key: awssdk.String(o.prefix + name), Body: content, Metadata: runContextMetadata(CurrentRunContext())})
+	return err
+}
+
+func (o *objectSink) String() string {
+	return o.scheme + "://" + o.bucket + "/" + o.prefix
+}
+
+// storeArtifacts stores the artifact directory in the artifact sinks of the test suite. Failing to store them does not
+// fail the run, as the local artifacts are still there for the CI system to collect.
+func (f *TestFramework) storeArtifacts() {
+	if artifactDir == "" || len(f.ArtifactSinks) == 0 {
+		return
+	}
+	if err := storeArtifacts(artifactDir, f.ArtifactSinks); err != nil {
+		log.Print(err)
+	}
+}
+
+// storeArtifacts stores the files of the given artifact directory in each of the given sinks, under the e2e-<run ID>
+// directory so that the runs sharing a sink do not overwrite each other. All the files are attempted, the errors are
+// returned together.
+func storeArtifacts(dir string, sinks ArtifactSinks) error {
+	errs := NewMultiError("store the artifacts")
+	for _, sink := range sinks {
+		start := time.Now()
+		stored := 0
+		err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				errs.Append(err)
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, filePath)
+			if err != nil {
+				errs.Append(err)
+				return nil
+			}
+			name := path.Join("e2e-"+runID, filepath.ToSlash(rel))
+			f, err := os.Open(filePath)
+			if err != nil {
+				errs.Append(err)
+				return nil
+			}
+			defer f.Close()
+			if err = sink.Store(name, f); err != nil {
+				errs.Appendf("error storing %s in %s: %v", name, sink, err)
+				return nil
+			}
+			stored++
+			return nil
+		})
+		errs.Append(err)
+		log.Printf("stored %d artifacts in %s in %v", stored, sink, time.Since(start).Round(time.Second))
+	}
+	return errs.ErrorOrNil()
+}
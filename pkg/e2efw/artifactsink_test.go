@@ -0,0 +1,110 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseArtifactSink tests the parsing of the locations of the artifact sinks
+func TestParseArtifactSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := ParseArtifactSink(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &dirSink{dir: dir}, sink)
+	sink, err = ParseArtifactSink("file://" + filepath.ToSlash(dir))
+	require.NoError(t, err)
+	assert.Equal(t, dir, sink.String())
+
+	sink, err = ParseArtifactSink("s3://ci-artifacts/windows/e2e/?region=us-east-2")
+	require.NoError(t, err)
+	assert.Equal(t, "s3://ci-artifacts/windows/e2e/", sink.String())
+	sink, err = ParseArtifactSink("s3://ci-artifacts")
+	require.NoError(t, err)
+	assert.Equal(t, "s3://ci-artifacts/", sink.String())
+
+	defer os.Setenv(gcsAccessKeyEnvVar, os.Getenv(gcsAccessKeyEnvVar))
+	defer os.Setenv(gcsSecretEnvVar, os.Getenv(gcsSecretEnvVar))
+	os.Unsetenv(gcsAccessKeyEnvVar)
+	_, err = ParseArtifactSink("gs://ci-artifacts/windows")
+	assert.EqualError(t, err, "artifact sink gs://ci-artifacts/windows requires GCS_HMAC_ACCESS_KEY_ID and "+
+		"GCS_HMAC_SECRET")
+	os.Setenv(gcsAccessKeyEnvVar, "GOOG1EXAMPLE")
+	os.Setenv(gcsSecretEnvVar, "secret")
+	sink, err = ParseArtifactSink("gs://ci-artifacts/windows")
+	require.NoError(t, err)
+	assert.Equal(t, "gs://ci-artifacts/windows/", sink.String())
+
+	for _, location := range []string{"artifacts", "ftp://host/artifacts", "s3:///artifacts", "file://"} {
+		_, err = ParseArtifactSink(location)
+		assert.Error(t, err, "no error parsing artifact sink %q", location)
+	}
+
+	var sinks ArtifactSinks
+	require.NoError(t, sinks.Set(dir+", s3://ci-artifacts/windows"))
+	assert.Equal(t, dir+",s3://ci-artifacts/windows/", sinks.String())
+}
+
+// TestStoreArtifacts tests that the files of the artifact directory are stored in every sink under the directory of the
+// run, and that the failures of a sink do not prevent the other sinks from getting the artifacts
+func TestStoreArtifacts(t *testing.T) {
+	defer func(id string) { runID = id }(runID)
+	runID = "abc12"
+	dir, err := ioutil.TempDir("", "artifacts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "2019", "nodes", "node-1"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "flake-report.json"), []byte("{}"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2019", "nodes", "node-1", "kubelet.log"),
+		[]byte("I0301 kubelet started"), 0644))
+
+	var mutex sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		objects[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+	objectStore, err := newObjectSink("s3", "ci-artifacts", "/windows/", awssdk.NewConfig().
+		WithEndpoint(server.URL).WithRegion("us-east-1").WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("AKID", "secret", "")))
+	require.NoError(t, err)
+	failing, err := newObjectSink("s3", "missing", "", awssdk.NewConfig().WithEndpoint("http://127.0.0.1:1").
+		WithRegion("us-east-1").WithS3ForcePathStyle(true).WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("AKID", "secret", "")))
+	require.NoError(t, err)
+	sinkDir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(sinkDir)
+
+	err = storeArtifacts(dir, ArtifactSinks{failing, objectStore, &dirSink{dir: sinkDir}})
+	require.Error(t, err)
+	assert.Len(t, Failures(err), 2, "each artifact should fail to be stored in the failing sink")
+
+	assert.Equal(t, map[string]string{
+		"/ci-artifacts/windows/e2e-abc12/flake-report.json":             "{}",
+		"/ci-artifacts/windows/e2e-abc12/2019/nodes/node-1/kubelet.log": "I0301 kubelet started",
+	}, objects)
+	contents, err := ioutil.ReadFile(filepath.Join(sinkDir, "e2e-abc12", "2019", "nodes", "node-1", "kubelet.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "I0301 kubelet started", string(contents))
+	assert.FileExists(t, filepath.Join(sinkDir, "e2e-abc12", "flake-report.json"))
+}
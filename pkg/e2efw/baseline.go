@@ -0,0 +1,369 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The checks of the security baseline of the bootstrapped Windows nodes
+const (
+	// BaselineListeningPorts checks that only the expected processes listen on the non-loopback TCP ports
+	BaselineListeningPorts = "listening-ports"
+	// BaselineSSHD checks that the OpenSSH server does not allow empty passwords, remote port forwarding to other
+	// hosts or lax permissions on the key files
+	BaselineSSHD = "sshd"
+	// BaselineWinRMBasicAuth checks that WinRM does not accept basic authentication nor unencrypted traffic
+	BaselineWinRMBasicAuth = "winrm-basic-auth"
+	// BaselineFirewallDefaultDeny checks that all the Windows Firewall profiles are enabled and block the inbound
+	// connections no rule allows
+	BaselineFirewallDefaultDeny = "firewall-default-deny"
+	// BaselineKubeletAnonymousAuth checks that the kubelet does not serve anonymous requests
+	BaselineKubeletAnonymousAuth = "kubelet-anonymous-auth"
+)
+
+// The statuses of a baseline check
+const (
+	// BaselinePassed is the status of a check the node complies with
+	BaselinePassed = "passed"
+	// BaselineFailed is the status of a check the node does not comply with
+	BaselineFailed = "failed"
+	// BaselineWaived is the status of a check the node does not comply with, for a reason given by its waiver
+	BaselineWaived = "waived"
+)
+
+const (
+	// sshdConfigPath is the configuration of the OpenSSH server on the Windows VMs
+	sshdConfigPath = "C:\\ProgramData\\ssh\\sshd_config"
+	// kubeletConfigPath is the kubelet configuration written by WMCB on the Windows VMs
+	kubeletConfigPath = "C:\\k\\kubelet.conf"
+)
+
+// AllowedListener is a process allowed to listen on some TCP ports of a bootstrapped Windows node
+type AllowedListener struct {
+	// Ports is the port, or the range like 49152-65535, the process can listen on
+	Ports string `json:"ports"`
+	// Process is the name of the process, without the .exe extension
+	Process string `json:"process"`
+	// Reason tells why the process listens on the ports
+	Reason string `json:"reason"`
+}
+
+// BaselineAllowedListeners are the processes allowed to listen on the non-loopback TCP ports of a bootstrapped Windows
+// node: the components of the node, the management services the tests connect to, and the RPC services of Windows.
+// Any other listener is reported by the BaselineListeningPorts check.
+var BaselineAllowedListeners = []AllowedListener{
+	{Ports: "10250", Process: "kubelet", Reason: "kubelet API"},
+	{Ports: "10256", Process: "kube-proxy", Reason: "kube-proxy health check"},
+	{Ports: "22", Process: "sshd", Reason: "OpenSSH server"},
+	{Ports: "5985", Process: "System", Reason: "WinRM over HTTP"},
+	{Ports: "5986", Process: "System", Reason: "WinRM over HTTPS"},
+	{Ports: "47001", Process: "System", Reason: "WinRM listener of the local services"},
+	{Ports: "445", Process: "System", Reason: "SMB"},
+	{Ports: "135", Process: "svchost", Reason: "RPC endpoint mapper"},
+	{Ports: "3389", Process: "svchost", Reason: "Remote Desktop"},
+	{Ports: "49152-65535", Process: "lsass", Reason: "dynamic RPC"},
+	{Ports: "49152-65535", Process: "wininit", Reason: "dynamic RPC"},
+	{Ports: "49152-65535", Process: "services", Reason: "dynamic RPC"},
+	{Ports: "49152-65535", Process: "svchost", Reason: "dynamic RPC"},
+	{Ports: "49152-65535", Process: "spoolsv", Reason: "dynamic RPC"},
+}
+
+// BaselineWaivers are the reasons the node is allowed not to comply with some baseline checks, by check. The waived
+// checks are still run and their findings reported.
+var BaselineWaivers = map[string]string{
+	BaselineWinRMBasicAuth: "the test framework runs its commands over WinRM with basic authentication over HTTPS",
+}
+
+// SecurityState is the security-related configuration of a Windows VM, which the security baseline is checked against
+type SecurityState struct {
+	// Listeners are the listening TCP sockets
+	Listeners []Listener `json:"listeners"`
+	// SSHDConfig is the content of the sshd_config file, empty if there is none
+	SSHDConfig string `json:"sshdConfig"`
+	// WinRMBasicAuth is true if the WinRM service runs and accepts basic authentication
+	WinRMBasicAuth bool `json:"winrmBasicAuth"`
+	// WinRMAllowUnencrypted is true if the WinRM service runs and accepts unencrypted traffic
+	WinRMAllowUnencrypted bool `json:"winrmAllowUnencrypted"`
+	// FirewallProfiles are the Windows Firewall profiles
+	FirewallProfiles []FirewallProfile `json:"firewallProfiles"`
+	// KubeletConfig is the content of the kubelet configuration file, empty if there is none
+	KubeletConfig string `json:"kubeletConfig"`
+	// KubeletCommand is the command line of the kubelet service, empty if there is none
+	KubeletCommand string `json:"kubeletCommand"`
+}
+
+// Listener is a listening TCP socket of a Windows VM
+type Listener struct {
+	// Address is the local address of the socket, e.g. 0.0.0.0 or ::
+	Address string `json:"address"`
+	// Port is the local port of the socket
+	Port int64 `json:"port"`
+	// Process is the name of the process owning the socket
+	Process string `json:"process"`
+}
+
+// FirewallProfile is a Windows Firewall profile
+type FirewallProfile struct {
+	// Name is Domain, Private or Public
+	Name string `json:"name"`
+	// Enabled is True, False or NotConfigured
+	Enabled string `json:"enabled"`
+	// DefaultInboundAction is Allow, Block or NotConfigured, which blocks
+	DefaultInboundAction string `json:"defaultInboundAction"`
+}
+
+// BaselineCheck is the result of a check of the security baseline
+type BaselineCheck struct {
+	// Name is the name of the check, e.g. BaselineSSHD
+	Name string `json:"name"`
+	// Description tells what the check verifies
+	Description string `json:"description"`
+	// Status is BaselinePassed, BaselineFailed or BaselineWaived
+	Status string `json:"status"`
+	// Findings are the deviations of the node from the check
+	Findings []string `json:"findings,omitempty"`
+	// Waiver is the reason the deviations are allowed, for the waived checks
+	Waiver string `json:"waiver,omitempty"`
+}
+
+// SecurityBaselineReport is the compliance of a bootstrapped Windows node with the security baseline, written to the
+// artifact directory for the security review
+type SecurityBaselineReport struct {
+	// Host is the IP address of the Windows VM
+	Host string `json:"host"`
+	// Time is when the baseline was checked
+	Time time.Time `json:"time"`
+	// Checks are the results of the checks
+	Checks []BaselineCheck `json:"checks"`
+}
+
+// Failed returns the checks the node does not comply with, the waived checks excluded
+func (r *SecurityBaselineReport) Failed() []BaselineCheck {
+	var failed []BaselineCheck
+	for _, check := range r.Checks {
+		if check.Status == BaselineFailed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// SecurityStateOf returns the listening TCP sockets, the sshd, WinRM, Windows Firewall and kubelet configuration of the
+// Windows VM
+func SecurityStateOf(vm WindowsVM) (*SecurityState, error) {
+	return vm.handle().securityState()
+}
+
+// securityState implements SecurityStateOf
+func (w *windowsVM) securityState() (*SecurityState, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("$processes = @{}; "+
+		"Get-Process | ForEach-Object { $processes[$_.Id] = $_.ProcessName }; "+
+		"$listeners = @(Get-NetTCPConnection -State Listen | ForEach-Object { @{address = $_.LocalAddress; "+
+		"port = [int]$_.LocalPort; process = $processes[[int]$_.OwningProcess]} }); "+
+		"$profiles = @(Get-NetFirewallProfile | ForEach-Object { @{name = $_.Name; enabled = [string]$_.Enabled; "+
+		"defaultInboundAction = [string]$_.DefaultInboundAction} }); "+
+		"function Read-Config($path) { if (Test-Path -LiteralPath $path) { Get-Content -Raw -LiteralPath $path } "+
+		"else { '' } }; "+
+		"$kubelet = Get-CimInstance Win32_Service -Filter \"Name='kubelet'\"; "+
+		// The WSMan drive is only available while WinRM runs, which it does not once hardened
+		"$winrm = (Get-Service -Name WinRM).Status -eq 'Running'; "+
+		"ConvertTo-Json -Compress -Depth 4 -InputObject @{listeners = $listeners; "+
+		"sshdConfig = [string](Read-Config "+PowerShellString(sshdConfigPath)+"); "+
+		"winrmBasicAuth = $winrm -and (Get-Item WSMan:\\localhost\\Service\\Auth\\Basic).Value -eq 'true'; "+
+		"winrmAllowUnencrypted = $winrm -and "+
+		"(Get-Item WSMan:\\localhost\\Service\\AllowUnencrypted).Value -eq 'true'; "+
+		"firewallProfiles = $profiles; kubeletConfig = [string](Read-Config "+PowerShellString(kubeletConfigPath)+
+		"); kubeletCommand = [string]$kubelet.PathName}"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the security state: %v, %s", err, stderr)
+	}
+	var state SecurityState
+	if err = json.Unmarshal([]byte(strings.TrimSpace(stdout)), &state); err != nil {
+		return nil, fmt.Errorf("error parsing the security state: %v", err)
+	}
+	return &state, nil
+}
+
+// CheckSecurityBaseline checks the bootstrapped Windows VM against the security baseline and returns the compliance
+// report. The checks waived by BaselineWaivers are reported as waived rather than failed.
+func CheckSecurityBaseline(vm WindowsVM) (*SecurityBaselineReport, error) {
+	state, err := SecurityStateOf(vm)
+	if err != nil {
+		return nil, err
+	}
+	host := ""
+	if credentials := vm.GetCredentials(); credentials != nil {
+		host = credentials.GetIPAddress()
+	}
+	return evaluateSecurityBaseline(host, clk.Now(), state, BaselineAllowedListeners, BaselineWaivers), nil
+}
+
+// evaluateSecurityBaseline returns the compliance report of the given security state
+func evaluateSecurityBaseline(host string, now time.Time, state *SecurityState, allowed []AllowedListener,
+	waivers map[string]string) *SecurityBaselineReport {
+	report := &SecurityBaselineReport{Host: host, Time: now.UTC()}
+	for _, check := range []struct {
+		name        string
+		description string
+		findings    []string
+	}{
+		{BaselineListeningPorts, "only the expected processes listen on the non-loopback TCP ports",
+			listenerFindings(state.Listeners, allowed)},
+		{BaselineSSHD, "sshd does not allow empty passwords, gateway ports or lax key file permissions",
+			sshdFindings(state.SSHDConfig)},
+		{BaselineWinRMBasicAuth, "WinRM does not accept basic authentication nor unencrypted traffic",
+			winRMFindings(state)},
+		{BaselineFirewallDefaultDeny, "all the Windows Firewall profiles are enabled and block inbound by default",
+			firewallProfileFindings(state.FirewallProfiles)},
+		{BaselineKubeletAnonymousAuth, "the kubelet does not serve anonymous requests",
+			kubeletFindings(state.KubeletConfig, state.KubeletCommand)},
+	} {
+		result := BaselineCheck{Name: check.name, Description: check.description, Status: BaselinePassed,
+			Findings: check.findings}
+		if len(check.findings) > 0 {
+			result.Status = BaselineFailed
+			if waiver, ok := waivers[check.name]; ok {
+				result.Status = BaselineWaived
+				result.Waiver = waiver
+			}
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// listenerFindings returns the listeners on non-loopback addresses that no allowed listener covers, once per port and
+// process as the IPv4 and IPv6 sockets of a service are the same finding
+func listenerFindings(listeners []Listener, allowed []AllowedListener) []string {
+	found := map[string]bool{}
+	for _, listener := range listeners {
+		if ip := net.ParseIP(listener.Address); ip != nil && ip.IsLoopback() {
+			continue
+		}
+		if listenerAllowed(listener, allowed) {
+			continue
+		}
+		found[fmt.Sprintf("unexpected listener %s on port %d", listener.Process, listener.Port)] = true
+	}
+	var findings []string
+	for finding := range found {
+		findings = append(findings, finding)
+	}
+	sort.Strings(findings)
+	return findings
+}
+
+// listenerAllowed returns true if one of the allowed listeners covers the given listener
+func listenerAllowed(listener Listener, allowed []AllowedListener) bool {
+	for _, allowedListener := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(listener.Process, ".exe"), allowedListener.Process) &&
+			portInRange(allowedListener.Ports, listener.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// sshdFindings returns the deviations of the given sshd_config from the baseline. As sshd does, the first value of
+// each keyword wins and the Match blocks are ignored for the global settings.
+func sshdFindings(config string) []string {
+	settings := map[string]string{}
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		keyword := strings.ToLower(fields[0])
+		if keyword == "match" {
+			break
+		}
+		if _, ok := settings[keyword]; !ok && len(fields) > 1 {
+			settings[keyword] = strings.ToLower(strings.Join(fields[1:], " "))
+		}
+	}
+
+	var findings []string
+	if settings["permitemptypasswords"] == "yes" {
+		findings = append(findings, "PermitEmptyPasswords is yes")
+	}
+	if settings["strictmodes"] == "no" {
+		findings = append(findings, "StrictModes is no")
+	}
+	if gatewayPorts := settings["gatewayports"]; gatewayPorts == "yes" || gatewayPorts == "clientspecified" {
+		findings = append(findings, "GatewayPorts is "+gatewayPorts)
+	}
+	return findings
+}
+
+// winRMFindings returns the deviations of the WinRM service from the baseline
+func winRMFindings(state *SecurityState) []string {
+	var findings []string
+	if state.WinRMBasicAuth {
+		findings = append(findings, "WinRM accepts basic authentication")
+	}
+	if state.WinRMAllowUnencrypted {
+		findings = append(findings, "WinRM accepts unencrypted traffic")
+	}
+	return findings
+}
+
+// firewallProfileFindings returns the Windows Firewall profiles which are disabled or allow inbound connections by
+// default. NotConfigured blocks the inbound connections, the default of Windows.
+func firewallProfileFindings(profiles []FirewallProfile) []string {
+	if len(profiles) == 0 {
+		return []string{"no Windows Firewall profile found"}
+	}
+	var findings []string
+	for _, profile := range profiles {
+		if !strings.EqualFold(profile.Enabled, "True") {
+			findings = append(findings, fmt.Sprintf("firewall profile %s is not enabled", profile.Name))
+		}
+		if strings.EqualFold(profile.DefaultInboundAction, "Allow") {
+			findings = append(findings, fmt.Sprintf("firewall profile %s allows inbound by default", profile.Name))
+		}
+	}
+	return findings
+}
+
+// kubeletFindings returns the deviations of the kubelet from the baseline, given its configuration file and the
+// command line of its service. The anonymous requests are served if the command line enables them, which overrides
+// the configuration, or if the configuration enables them.
+func kubeletFindings(config, command string) []string {
+	if config == "" && command == "" {
+		return []string{"kubelet is not installed"}
+	}
+	for _, arg := range strings.Fields(command) {
+		if !strings.HasPrefix(arg, "--anonymous-auth") {
+			continue
+		}
+		value := strings.TrimPrefix(strings.TrimPrefix(arg, "--anonymous-auth"), "=")
+		// A boolean flag without value is true
+		if enabled, err := strconv.ParseBool(value); value == "" || (err == nil && enabled) {
+			return []string{"kubelet command line enables anonymous authentication: " + arg}
+		}
+		return nil
+	}
+	if config == "" {
+		return []string{"kubelet configuration " + kubeletConfigPath + " not found"}
+	}
+	var kubeletConfig struct {
+		Authentication struct {
+			Anonymous struct {
+				Enabled *bool `json:"enabled"`
+			} `json:"anonymous"`
+		} `json:"authentication"`
+	}
+	if err := json.Unmarshal([]byte(config), &kubeletConfig); err != nil {
+		return []string{fmt.Sprintf("kubelet configuration %s is not valid JSON: %v", kubeletConfigPath, err)}
+	}
+	// The anonymous requests are rejected by default in the v1beta1 KubeletConfiguration
+	if enabled := kubeletConfig.Authentication.Anonymous.Enabled; enabled != nil && *enabled {
+		return []string{"kubelet configuration enables anonymous authentication"}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package e2efw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compliantState is the security state of a bootstrapped node complying with the baseline
+var compliantState = SecurityState{
+	Listeners: []Listener{
+		{Address: "0.0.0.0", Port: 22, Process: "sshd"},
+		{Address: "::", Port: 22, Process: "sshd"},
+		{Address: "::", Port: 10250, Process: "kubelet"},
+		{Address: "0.0.0.0", Port: 49664, Process: "lsass"},
+		{Address: "127.0.0.1", Port: 9000, Process: "hybrid-overlay-node"},
+	},
+	SSHDConfig: "# Defaults\nPermitEmptyPasswords no\nSubsystem sftp sftp-server.exe\n" +
+		"Match Group administrators\n  GatewayPorts yes\n",
+	FirewallProfiles: []FirewallProfile{
+		{Name: "Domain", Enabled: "True", DefaultInboundAction: "NotConfigured"},
+		{Name: "Public", Enabled: "True", DefaultInboundAction: "Block"},
+	},
+	KubeletConfig:  `{"authentication":{"anonymous":{"enabled":false}}}`,
+	KubeletCommand: "c:\\k\\kubelet.exe --config=c:\\k\\kubelet.conf --windows-service",
+}
+
+// TestEvaluateSecurityBaseline tests the compliance report of a compliant and a non-compliant node
+func TestEvaluateSecurityBaseline(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	report := evaluateSecurityBaseline("10.0.0.1", now, &compliantState, BaselineAllowedListeners, nil)
+	assert.Equal(t, "10.0.0.1", report.Host)
+	assert.Equal(t, now, report.Time)
+	require.Len(t, report.Checks, 5)
+	for _, check := range report.Checks {
+		assert.Equal(t, BaselinePassed, check.Status, "%s: %v", check.Name, check.Findings)
+	}
+	assert.Empty(t, report.Failed())
+
+	state := compliantState
+	state.Listeners = append(state.Listeners, Listener{Address: "0.0.0.0", Port: 8080, Process: "python"},
+		Listener{Address: "::", Port: 8080, Process: "python"})
+	state.WinRMBasicAuth = true
+	state.KubeletCommand += " --anonymous-auth=true"
+	report = evaluateSecurityBaseline("10.0.0.1", now, &state, BaselineAllowedListeners,
+		map[string]string{BaselineWinRMBasicAuth: "used by the tests"})
+	statuses := map[string]string{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	assert.Equal(t, map[string]string{
+		BaselineListeningPorts:       BaselineFailed,
+		BaselineSSHD:                 BaselinePassed,
+		BaselineWinRMBasicAuth:       BaselineWaived,
+		BaselineFirewallDefaultDeny:  BaselinePassed,
+		BaselineKubeletAnonymousAuth: BaselineFailed,
+	}, statuses)
+	assert.Equal(t, []string{"unexpected listener python on port 8080"}, report.Checks[0].Findings)
+	assert.Equal(t, "used by the tests", report.Checks[2].Waiver)
+	assert.Len(t, report.Failed(), 2)
+}
+
+// TestSSHDFindings tests the checks of the sshd configuration
+func TestSSHDFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{"defaults", "", nil},
+		{"compliant", "StrictModes yes\nPermitEmptyPasswords no\n", nil},
+		{"lax", "permitemptypasswords Yes\nStrictModes no\nGatewayPorts clientspecified\n",
+			[]string{"PermitEmptyPasswords is yes", "StrictModes is no", "GatewayPorts is clientspecified"}},
+		{"first value wins", "PermitEmptyPasswords no\nPermitEmptyPasswords yes\n", nil},
+		{"commented out", "#PermitEmptyPasswords yes\n", nil},
+		{"match block ignored", "Match User admin\n  StrictModes no\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sshdFindings(tt.config))
+		})
+	}
+}
+
+// TestFirewallProfileFindings tests the checks of the Windows Firewall profiles
+func TestFirewallProfileFindings(t *testing.T) {
+	assert.Nil(t, firewallProfileFindings(compliantState.FirewallProfiles))
+	assert.Equal(t, []string{"no Windows Firewall profile found"}, firewallProfileFindings(nil))
+	assert.Equal(t, []string{"firewall profile Private is not enabled",
+		"firewall profile Public allows inbound by default"}, firewallProfileFindings([]FirewallProfile{
+		{Name: "Private", Enabled: "False", DefaultInboundAction: "Block"},
+		{Name: "Public", Enabled: "True", DefaultInboundAction: "Allow"},
+	}))
+}
+
+// TestKubeletFindings tests the checks of the anonymous authentication of the kubelet
+func TestKubeletFindings(t *testing.T) {
+	const command = "c:\\k\\kubelet.exe --config=c:\\k\\kubelet.conf"
+	tests := []struct {
+		name      string
+		config    string
+		command   string
+		compliant bool
+	}{
+		{"disabled in the configuration", `{"authentication":{"anonymous":{"enabled":false}}}`, command, true},
+		{"unset", `{"authentication":{}}`, command, true},
+		{"enabled in the configuration", `{"authentication":{"anonymous":{"enabled":true}}}`, command, false},
+		{"enabled on the command line", `{}`, command + " --anonymous-auth", false},
+		{"disabled on the command line", `{"authentication":{"anonymous":{"enabled":true}}}`,
+			command + " --anonymous-auth=false", true},
+		{"invalid configuration", `authentication:`, command, false},
+		{"not installed", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := kubeletFindings(tt.config, tt.command)
+			if tt.compliant {
+				assert.Empty(t, findings)
+			} else {
+				assert.NotEmpty(t, findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package e2efw
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// BudgetPhase is a phase of the test job the remaining time is allocated to. The phases run in the order of their
+// values.
+type BudgetPhase int
+
+const (
+	// CreatePhase creates the Windows VMs
+	CreatePhase BudgetPhase = iota
+	// SetupPhase connects to the cluster and sets the VMs and the cluster up for the tests
+	SetupPhase
+	// BootstrapPhase bootstraps the VMs as nodes, e.g. by running WSU
+	BootstrapPhase
+	// TestsPhase runs the tests against the nodes
+	TestsPhase
+	// TeardownPhase retrieves the artifacts and destroys the VMs
+	TeardownPhase
+)
+
+const (
+	// DeadlineEnvVar is the environment variable holding the deadline of the test job in RFC 3339 format, e.g.
+	// 2020-06-01T12:00:00Z, which is used when it is earlier than the deadline of go test -timeout
+	DeadlineEnvVar = "E2E_DEADLINE"
+	// testTimeoutFlag is the flag of the go test -timeout value, after which the test binary panics without tearing
+	// down the VMs
+	testTimeoutFlag = "test.timeout"
+)
+
+// String returns the name of the phase
+func (p BudgetPhase) String() string {
+	switch p {
+	case CreatePhase:
+		return "create"
+	case SetupPhase:
+		return "setup"
+	case BootstrapPhase:
+		return "bootstrap"
+	case TestsPhase:
+		return "tests"
+	case TeardownPhase:
+		return "teardown"
+	}
+	return fmt.Sprintf("phase %d", int(p))
+}
+
+// defaultReserves is the time reserved for each phase. A phase is not given time reserved for the phases after it, so
+// that a slow phase cannot starve the next ones, and teardown in particular always has time to run.
+var defaultReserves = map[BudgetPhase]time.Duration{
+	SetupPhase:     2 * time.Minute,
+	BootstrapPhase: 10 * time.Minute,
+	TestsPhase:     10 * time.Minute,
+	TeardownPhase:  10 * time.Minute,
+}
+
+// Budget allocates the time remaining until the deadline of the test job across its phases
+type Budget struct {
+	// deadline is the deadline of the test job, zero if there is none
+	deadline time.Time
+	// reserves is the time reserved for each phase
+	reserves map[BudgetPhase]time.Duration
+	// now returns the current time, overridden by the tests
+	now func() time.Time
+}
+
+// NewBudget returns a Budget allocating the time until the given deadline, with the given time reserved for each phase.
+// A zero deadline means that there is no deadline, in which case the timeouts are not shrunk.
+func NewBudget(deadline time.Time, reserves map[BudgetPhase]time.Duration) *Budget {
+	return &Budget{deadline: deadline, reserves: reserves, now: time.Now}
+}
+
+// Remaining returns the time remaining until the deadline, or -1 if there is no deadline
+func (b *Budget) Remaining() time.Duration {
+	if b.deadline.IsZero() {
+		return -1
+	}
+	if remaining := b.deadline.Sub(b.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Available returns the time the given phase can use, which is the time remaining until the deadline minus the time
+// reserved for the phases after it, or -1 if there is no deadline
+func (b *Budget) Available(phase BudgetPhase) time.Duration {
+	remaining := b.Remaining()
+	if remaining < 0 {
+		return -1
+	}
+	for p, reserve := range b.reserves {
+		if p > phase {
+			remaining -= reserve
+		}
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Timeout returns the given timeout of an operation of the given phase, shrunk to the time available to the phase.
+// It is 0 once the phase has used up its time, so that the operation fails right away and the next phases still run.
+func (b *Budget) Timeout(phase BudgetPhase, timeout time.Duration) time.Duration {
+	available := b.Available(phase)
+	if available >= 0 && available < timeout {
+		if available < timeout/2 {
+			log.Printf("%s timeout shrunk from %v to %v to stay within the job deadline", phase, timeout, available)
+		}
+		return available
+	}
+	return timeout
+}
+
+var (
+	// budgetLock protects budget
+	budgetLock sync.Mutex
+	// budget allocates the time of the test job, without deadline until Setup reads it
+	budget = NewBudget(time.Time{}, defaultReserves)
+	// processStart is when the test binary started, from which the go test -timeout runs
+	processStart = time.Now()
+)
+
+// setupBudget sets the deadline of the budget to the earliest of the go test -timeout deadline and the deadline of the
+// deadline environment variable
+func setupBudget() error {
+	var deadline time.Time
+	if f := flag.Lookup(testTimeoutFlag); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if timeout, ok := getter.Get().(time.Duration); ok && timeout > 0 {
+				deadline = processStart.Add(timeout)
+			}
+		}
+	}
+	if value := os.Getenv(DeadlineEnvVar); value != "" {
+		envDeadline, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %s: %v", DeadlineEnvVar, value, err)
+		}
+		if deadline.IsZero() || envDeadline.Before(deadline) {
+			deadline = envDeadline
+		}
+	}
+	budgetLock.Lock()
+	defer budgetLock.Unlock()
+	budget = NewBudget(deadline, defaultReserves)
+	if !deadline.IsZero() {
+		log.Printf("job deadline in %v, %v reserved for teardown", budget.Remaining().Round(time.Second),
+			defaultReserves[TeardownPhase])
+	}
+	return nil
+}
+
+// Timeout returns the given timeout of an operation of the given phase, shrunk so that the phases after it, and
+// teardown in particular, still have time to run before the job deadline. Test suites should use it for their long
+// waits, e.g. framework.Timeout(framework.TestsPhase, 10*time.Minute).
+func Timeout(phase BudgetPhase, timeout time.Duration) time.Duration {
+	budgetLock.Lock()
+	defer budgetLock.Unlock()
+	return budget.Timeout(phase, timeout)
+}
+
+// remainingTime returns the time remaining until the job deadline, or -1 if there is no deadline
+func remainingTime() time.Duration {
+	budgetLock.Lock()
+	defer budgetLock.Unlock()
+	return budget.Remaining()
+}
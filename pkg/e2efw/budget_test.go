@@ -0,0 +1,73 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBudget tests that the timeouts are shrunk so that the later phases keep their reserved time
+func TestBudget(t *testing.T) {
+	now := time.Now()
+	b := NewBudget(now.Add(90*time.Minute), defaultReserves)
+	b.now = func() time.Time { return now }
+
+	assert.Equal(t, 90*time.Minute, b.Remaining())
+	tests := []struct {
+		name     string
+		phase    BudgetPhase
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{"create shrunk to the time left after the reserves", CreatePhase, 80 * time.Minute, 58 * time.Minute},
+		{"create within budget", CreatePhase, 30 * time.Minute, 30 * time.Minute},
+		{"bootstrap keeps time for tests and teardown", BootstrapPhase, 75 * time.Minute, 70 * time.Minute},
+		{"tests keep time for teardown", TestsPhase, 2 * time.Hour, 80 * time.Minute},
+		{"teardown gets all the remaining time", TeardownPhase, 2 * time.Hour, 90 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, b.Timeout(test.phase, test.timeout))
+		})
+	}
+
+	// Once the time of a phase is used up, its operations time out right away
+	now = now.Add(85 * time.Minute)
+	assert.Equal(t, time.Duration(0), b.Timeout(TestsPhase, time.Minute))
+	assert.Equal(t, 5*time.Minute, b.Timeout(TeardownPhase, 10*time.Minute))
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), b.Remaining())
+
+	// Without deadline, the timeouts are kept
+	b = NewBudget(time.Time{}, defaultReserves)
+	assert.Equal(t, time.Duration(-1), b.Remaining())
+	assert.Equal(t, 15*time.Minute, b.Timeout(CreatePhase, 15*time.Minute))
+}
+
+// TestSetupBudget tests that the earliest of the go test -timeout and the environment variable deadlines is used
+func TestSetupBudget(t *testing.T) {
+	defer func() { budget = NewBudget(time.Time{}, defaultReserves) }()
+	defer os.Unsetenv(DeadlineEnvVar)
+
+	// The tests run with the go test -timeout, 10 minutes by default
+	require.NoError(t, setupBudget())
+	if budget.deadline.IsZero() {
+		t.Skip("go test -timeout is disabled")
+	}
+	testDeadline := budget.deadline
+
+	deadline := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	require.NoError(t, os.Setenv(DeadlineEnvVar, deadline.Format(time.RFC3339)))
+	require.NoError(t, setupBudget())
+	assert.True(t, deadline.Equal(budget.deadline), "the earlier environment variable deadline is used")
+
+	require.NoError(t, os.Setenv(DeadlineEnvVar, testDeadline.Add(time.Hour).Format(time.RFC3339)))
+	require.NoError(t, setupBudget())
+	assert.True(t, testDeadline.Equal(budget.deadline), "the earlier go test deadline is used")
+
+	require.NoError(t, os.Setenv(DeadlineEnvVar, "in an hour"))
+	assert.Error(t, setupBudget())
+}
@@ -0,0 +1,26 @@
+package e2efw
+
+import "time"
+
+// Clock tells the time and sleeps. The retries and waits for the Windows VMs and the cluster take the time from clk
+// rather than from the time package, so that they can be unit tested with a fake clock instead of waiting for minutes.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep pauses the current goroutine for the given duration
+	Sleep(time.Duration)
+}
+
+// clk is the clock the retries and waits take the time from
+var clk Clock = realClock{}
+
+// realClock is the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
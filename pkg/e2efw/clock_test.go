@@ -0,0 +1,102 @@
+package e2efw
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeClock is a Clock whose time only passes when slept, which returns at once
+type fakeClock struct {
+	// lock guards now and sleeps
+	lock sync.Mutex
+	// now is the current time of the clock
+	now time.Time
+	// sleeps are the durations slept, in order
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+// slept returns the durations slept so far
+func (c *fakeClock) slept() []time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// useFakeClock makes the retries and waits use a fake clock until the returned function is called
+func useFakeClock() (*fakeClock, func()) {
+	previous := clk
+	fake := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clk = fake
+	return fake, func() { clk = previous }
+}
+
+// TestRetryInterval tests that Retry waits for the interval between the attempts, and not after the last one
+func TestRetryInterval(t *testing.T) {
+	defer func(recorder *flakeRecorder) { flakes = recorder }(flakes)
+	flakes = newFlakeRecorder()
+	fake, restore := useFakeClock()
+	defer restore()
+
+	err := Retry("run", "10.0.0.1", 4, time.Minute, func() error { return fmt.Errorf("unreachable") })
+	assert.EqualError(t, err, "unreachable")
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute, time.Minute}, fake.slept())
+}
+
+// TestWaitForReady tests that WaitForReady polls the VM until it can be reached again, and gives up once the timeout
+// expires, without waiting for real
+func TestWaitForReady(t *testing.T) {
+	defer func(recorder *flakeRecorder) { flakes = recorder }(flakes)
+	flakes = newFlakeRecorder()
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	fake, restore := useFakeClock()
+	defer restore()
+
+	// The VM is reachable again on the third attempt
+	dials := 0
+	w := &windowsVM{credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator")}
+	w.sshConn = newSSHConnection("127.0.0.1", func() (*ssh.Client, error) {
+		if dials++; dials < 3 {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return server.dial()
+	})
+	defer func() { w.ssh().close() }()
+	require.NoError(t, w.waitForReady(10*time.Minute))
+	assert.Equal(t, []time.Duration{RetryInterval, RetryInterval}, fake.slept())
+
+	// The VM never comes back
+	w.setSSHConnection(newSSHConnection("127.0.0.1", func() (*ssh.Client, error) {
+		return nil, fmt.Errorf("connection refused")
+	}))
+	start := fake.Now()
+	err := w.waitForReady(time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout waiting for 127.0.0.1 to be ready")
+	assert.True(t, fake.Now().Sub(start) >= time.Minute, "gave up after %v", fake.Now().Sub(start))
+
+	stats := flakes.report().Operations
+	require.Len(t, stats, 1)
+	assert.Equal(t, waitForReadyOperation, stats[0].Operation)
+	assert.Equal(t, 1, stats[0].Failed)
+}
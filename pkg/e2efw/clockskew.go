@@ -0,0 +1,111 @@
+package e2efw
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// timeServiceName is the Windows Time service, which would correct the skewed clock of the Windows VM
+	timeServiceName = "w32time"
+	// nodeTimeScript prints the UTC time of the Windows VM in Unix milliseconds
+	nodeTimeScript = "[DateTimeOffset]::UtcNow.ToUnixTimeMilliseconds()"
+)
+
+// NodeTime returns the time of the clock of the Windows VM, and the skew of the clock, i.e. how far ahead of the test
+// host it is. The time is read at the middle of the round trip to the VM.
+func NodeTime(vm WindowsVM) (time.Time, time.Duration, error) {
+	return vm.handle().nodeTime()
+}
+
+// nodeTime implements NodeTime
+func (w *windowsVM) nodeTime() (time.Time, time.Duration, error) {
+	sent := clk.Now()
+	stdout, stderr, err := w.Run(PowerShellScript(nodeTimeScript), true)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("error reading the clock: %v, %s", err, stderr)
+	}
+	received := clk.Now()
+	return parseNodeTime(stdout, sent, received)
+}
+
+// parseNodeTime parses the Unix milliseconds printed by nodeTimeScript, and returns the time and its skew from the
+// middle of the given round trip
+func parseNodeTime(out string, sent, received time.Time) (time.Time, time.Duration, error) {
+	ms, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("unexpected node time %q", strings.TrimSpace(out))
+	}
+	nodeTime := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	middle := sent.Add(received.Sub(sent) / 2)
+	return nodeTime, nodeTime.Sub(middle), nil
+}
+
+// SkewClock stops the Windows Time service of the Windows VM, so that the clock is not corrected, and moves the clock
+// by the given offset, forward if it is positive. RestoreClock sets it right again.
+func SkewClock(vm WindowsVM, offset time.Duration) error {
+	return vm.handle().skewClock(offset)
+}
+
+// skewClock implements SkewClock
+func (w *windowsVM) skewClock(offset time.Duration) error {
+	_, stderr, err := w.Run(PowerShellScript(skewClockScript(offset)), true)
+	if err != nil {
+		return fmt.Errorf("error skewing the clock by %s: %v, %s", offset, err, stderr)
+	}
+	return nil
+}
+
+// skewClockScript returns the script stopping the Windows Time service and moving the clock by the given offset
+func skewClockScript(offset time.Duration) string {
+	return fmt.Sprintf("Stop-Service -Force -Name %s; Set-Date -Adjust ([TimeSpan]::FromMilliseconds(%d)) | "+
+		"Out-Null", PowerShellString(timeServiceName), int64(offset/time.Millisecond))
+}
+
+// RestoreClock moves the clock of the Windows VM back by its skew from the test host and starts the Windows Time
+// service again, so that the clock stays in sync. The synchronization is not forced, as the time source may not be
+// reachable from the VM, e.g. from a VPC without internet access.
+func RestoreClock(vm WindowsVM) error {
+	return vm.handle().restoreClock()
+}
+
+// restoreClock implements RestoreClock
+func (w *windowsVM) restoreClock() error {
+	_, skew, err := w.nodeTime()
+	if err != nil {
+		return err
+	}
+	_, stderr, err := w.Run(PowerShellScript(restoreClockScript(skew)), true)
+	if err != nil {
+		return fmt.Errorf("error restoring the clock skewed by %s: %v, %s", skew, err, stderr)
+	}
+	return nil
+}
+
+// restoreClockScript returns the script moving the clock back by the given skew and starting the Windows Time service
+// again
+func restoreClockScript(skew time.Duration) string {
+	return fmt.Sprintf("Set-Date -Adjust ([TimeSpan]::FromMilliseconds(%d)) | Out-Null; Start-Service -Name %s",
+		-int64(skew/time.Millisecond), PowerShellString(timeServiceName))
+}
+
+// Certificates reads the PEM file at the given path on the Windows VM, e.g. the kubelet client certificate, and
+// summarizes its certificates
+func Certificates(vm WindowsVM, path string) ([]CertificateInfo, error) {
+	return vm.handle().certificates(path)
+}
+
+// certificates implements Certificates
+func (w *windowsVM) certificates(path string) ([]CertificateInfo, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("Get-Content -Raw -LiteralPath "+PowerShellString(path)), true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v, %s", path, err, stderr)
+	}
+	infos := certificateInfos([]byte(stdout))
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	return infos, nil
+}
@@ -0,0 +1,36 @@
+package e2efw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseNodeTime tests that the skew of the clock of the VM is measured from the middle of the round trip
+func TestParseNodeTime(t *testing.T) {
+	sent := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	received := sent.Add(2 * time.Second)
+	nodeTime, skew, err := parseNodeTime("1614600001000\r\n", sent, received)
+	require.NoError(t, err)
+	assert.Equal(t, sent.Add(time.Second), nodeTime)
+	assert.Equal(t, time.Duration(0), skew)
+
+	_, skew, err = parseNodeTime("1614603601500", sent, received)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour+500*time.Millisecond, skew)
+
+	_, _, err = parseNodeTime("Access is denied.", sent, received)
+	assert.EqualError(t, err, `unexpected node time "Access is denied."`)
+}
+
+// TestClockScripts tests that the time service is stopped before the clock is skewed, and that the clock is moved back
+// by its skew when restored
+func TestClockScripts(t *testing.T) {
+	assert.Equal(t, "Stop-Service -Force -Name 'w32time'; Set-Date -Adjust ([TimeSpan]::FromMilliseconds(7200000)) | "+
+		"Out-Null", skewClockScript(2*time.Hour))
+	assert.Equal(t, "Set-Date -Adjust ([TimeSpan]::FromMilliseconds(-7200500)) | Out-Null; Start-Service -Name "+
+		"'w32time'", restoreClockScript(2*time.Hour+500*time.Millisecond))
+	assert.Contains(t, restoreClockScript(-time.Minute), "FromMilliseconds(60000)")
+}
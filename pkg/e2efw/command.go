@@ -0,0 +1,92 @@
+package e2efw
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxCmdLineLength is the maximum length of a command line of the Windows command shell
+const maxCmdLineLength = 8191
+
+// cmdSpecialChars are the characters that make an argument need quoting on the Windows command line: the separators
+// of CommandLineToArgvW and the metacharacters of the Windows command shell, which are literal within double quotes
+const cmdSpecialChars = " \t\n\v\"&|<>^(),;="
+
+// PowerShellScript returns the command running the given PowerShell script, to be passed to Run with psCmd set. The
+// script is encoded in base64, so that it passes through the Windows command shell unchanged whatever it contains:
+// pipes, double quotes, JSON payloads or non-ASCII characters. The errors are written as text instead of the CLIXML
+// PowerShell defaults to for encoded commands. The encoded script must fit the maxCmdLineLength characters of a command
+// line of the Windows command shell, i.e. the script must be shorter than about 3000 characters; longer scripts are run
+// with RunPowerShellScriptFile.
+func PowerShellScript(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	raw := make([]byte, 2*len(encoded))
+	for i, c := range encoded {
+		raw[2*i] = byte(c)
+		raw[2*i+1] = byte(c >> 8)
+	}
+	return "-OutputFormat Text -EncodedCommand " + base64.StdEncoding.EncodeToString(raw)
+}
+
+// PowerShellString returns the given value as a single quoted PowerShell string literal, in which no character is
+// interpreted but the single quote, which is doubled. Typographic single quotes are treated as quotes by PowerShell,
+// so they are doubled as well.
+func PowerShellString(value string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range value {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// CmdArg quotes the given argument for a command run by the Windows command shell, i.e. with Run without psCmd, so that
+// the program receives it as a single argument following the rules of CommandLineToArgvW. Arguments without spaces
+// or special characters are returned as is. The environment variables in % are still expanded by the command shell,
+// as they cannot be escaped on its command line.
+func CmdArg(arg string) string {
+	if arg == "" {
+		return "\"\""
+	}
+	if !strings.ContainsAny(arg, cmdSpecialChars) {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for _, r := range arg {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// The backslashes preceding a double quote are escaped, as is the double quote
+			b.WriteString(strings.Repeat("\\", 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat("\\", backslashes))
+		}
+		backslashes = 0
+		b.WriteRune(r)
+	}
+	// The backslashes preceding the closing double quote are escaped
+	b.WriteString(strings.Repeat("\\", 2*backslashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// CmdLine returns the command line of the Windows command shell running the given program with the given arguments,
+// each quoted with CmdArg
+func CmdLine(program string, args ...string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, CmdArg(program))
+	for _, arg := range args {
+		quoted = append(quoted, CmdArg(arg))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,81 @@
+package e2efw
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPowerShellString tests that values are quoted as PowerShell string literals
+func TestPowerShellString(t *testing.T) {
+	assert.Equal(t, "'C:\\k\\kubeconfig'", PowerShellString("C:\\k\\kubeconfig"))
+	assert.Equal(t, "'it''s'", PowerShellString("it's"))
+	assert.Equal(t, "'it’’s \"$env:TEMP\"'", PowerShellString("it’s \"$env:TEMP\""))
+	assert.Equal(t, "''", PowerShellString(""))
+}
+
+// TestPowerShellScript tests that scripts are encoded as UTF-16LE, so that nothing is left for the Windows command
+// shell to interpret
+func TestPowerShellScript(t *testing.T) {
+	script := "Get-Process | ConvertTo-Json -InputObject @{\"name\" = 'café'}"
+	cmd := PowerShellScript(script)
+	const prefix = "-OutputFormat Text -EncodedCommand "
+	require.Contains(t, cmd, prefix)
+	assert.NotContainsf(t, cmd[len(prefix):], " ", "the encoded script is a single argument")
+	raw, err := base64.StdEncoding.DecodeString(cmd[len(prefix):])
+	require.NoError(t, err)
+	require.Equal(t, 0, len(raw)%2)
+	decoded := make([]uint16, len(raw)/2)
+	for i := range decoded {
+		decoded[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+	}
+	assert.Equal(t, script, string(utf16.Decode(decoded)))
+}
+
+// TestScriptsFitCommandLine tests that the longest scripts of the framework fit a command line once encoded
+func TestScriptsFitCommandLine(t *testing.T) {
+	files := make([]BackupFile, len(NodeIdentityPaths))
+	for i, path := range NodeIdentityPaths {
+		files[i] = BackupFile{Path: path, File: strconv.Itoa(i), SHA256: strings.Repeat("0", 64)}
+	}
+	for name, script := range map[string]string{
+		"stage identity files": stageIdentityFilesScript(files, true),
+		"install containerd":   installContainerdScript(),
+		"mount SMB share": mountSMBShareScript(&SMBShare{Server: "fs-0123456789abcdef0.example.com", Name: "share",
+			Username: "Administrator"}, "Z:", "C:\\Temp\\smb-credentials.xml"),
+	} {
+		assert.Less(t, len(remotePowerShellCmdPrefix+PowerShellScript(script)), maxCmdLineLength, name)
+	}
+}
+
+// TestCmdArg tests that arguments are quoted following the rules of CommandLineToArgvW
+func TestCmdArg(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{"C:\\k\\kubelet.exe", "C:\\k\\kubelet.exe"},
+		{"", "\"\""},
+		{"C:\\Program Files\\containerd", "\"C:\\Program Files\\containerd\""},
+		{"C:\\Program Files\\", "\"C:\\Program Files\\\\\""},
+		{"{\"key\": \"value\"}", "\"{\\\"key\\\": \\\"value\\\"}\""},
+		{"a\\\"b", "\"a\\\\\\\"b\""},
+		{"a&b|c", "\"a&b|c\""},
+	}
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			assert.Equal(t, test.expected, CmdArg(test.arg))
+		})
+	}
+}
+
+// TestCmdLine tests that the program and each of its arguments are quoted
+func TestCmdLine(t *testing.T) {
+	assert.Equal(t, "\"C:\\Program Files\\tool.exe\" --name \"my node\" --flag",
+		CmdLine("C:\\Program Files\\tool.exe", "--name", "my node", "--flag"))
+}
@@ -0,0 +1,226 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fingerprintRoot is the directory whose files are hashed in the configuration fingerprint of the nodes, where
+	// WMCB writes the binaries and configuration of the node
+	fingerprintRoot = "C:\\k\\"
+	// configDriftMissing is the value of a configuration item missing from one of the nodes in a drift report
+	configDriftMissing = "<missing>"
+)
+
+// The categories of the configuration items of the nodes
+const (
+	// ConfigService is the start mode and command line of a node service
+	ConfigService = "service"
+	// ConfigFile is the SHA256 hash of a file under C:\k
+	ConfigFile = "file"
+	// ConfigFirewallRule is the action, protocol and local ports of an enabled inbound Windows Firewall rule
+	ConfigFirewallRule = "firewall rule"
+	// ConfigFirewallProfile is an enabled Windows Firewall profile
+	ConfigFirewallProfile = "firewall profile"
+	// ConfigHNSNetwork is the type and number of subnets of an HNS network
+	ConfigHNSNetwork = "HNS network"
+)
+
+// fingerprintServices are the services whose start mode and command line are part of the configuration fingerprint
+var fingerprintServices = []string{"kubelet", "kube-proxy", "hybrid-overlay-node", "containerd", "docker",
+	"windows_exporter"}
+
+// ConfigFingerprint is the configuration of a Windows node which is expected to be the same on the nodes bootstrapped
+// from the same payload, by category and item
+type ConfigFingerprint struct {
+	// Host is the IP address of the Windows VM
+	Host string `json:"host"`
+	// Items are the values of the configuration items by category, e.g. the hash of C:\k\kubelet.exe is
+	// Items[ConfigFile]["kubelet.exe"]
+	Items map[string]map[string]string `json:"items"`
+}
+
+// ConfigDrift is a configuration item which differs between two nodes
+type ConfigDrift struct {
+	// Category is the category of the item, e.g. ConfigFile
+	Category string `json:"category"`
+	// Item is the name of the item, e.g. the path of a file relative to C:\k
+	Item string `json:"item"`
+	// A is the value of the item on the first node, <missing> if it has none
+	A string `json:"a"`
+	// B is the value of the item on the second node, <missing> if it has none
+	B string `json:"b"`
+}
+
+// ConfigDriftReport is the difference between the configuration of two nodes, which tells why a test passes on one of
+// them and fails on the other, e.g. after a partial upgrade
+type ConfigDriftReport struct {
+	// A is the IP address of the first node
+	A string `json:"a"`
+	// B is the IP address of the second node
+	B string `json:"b"`
+	// Time is when the nodes were compared
+	Time time.Time `json:"time"`
+	// Drifts are the items which differ, by category and item
+	Drifts []ConfigDrift `json:"drifts"`
+}
+
+// String returns the items which differ, one per line
+func (r *ConfigDriftReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "configuration drift between %s (A) and %s (B): %d items\n", r.A, r.B, len(r.Drifts))
+	for _, drift := range r.Drifts {
+		fmt.Fprintf(&b, "%s %s:\n  A: %s\n  B: %s\n", drift.Category, drift.Item, drift.A, drift.B)
+	}
+	return b.String()
+}
+
+// configFingerprintScript prints the services, the hashes of the files under C:\k but its logs and the HNS networks of
+// the node as JSON
+func configFingerprintScript() string {
+	var names []string
+	for _, name := range fingerprintServices {
+		names = append(names, PowerShellString(name))
+	}
+	root := PowerShellString(fingerprintRoot)
+	return "$names = @(" + strings.Join(names, ", ") + "); $services = @{}; " +
+		"Get-CimInstance Win32_Service | Where-Object { $names -contains $_.Name } | " +
+		"ForEach-Object { $services[$_.Name] = \"$($_.StartMode) $($_.PathName)\" }; " +
+		"$files = @{}; if (Test-Path -LiteralPath " + root + ") { " +
+		"Get-ChildItem -LiteralPath " + root + " -Recurse -File | " +
+		"Where-Object { -not $_.FullName.StartsWith(" + PowerShellString(remoteLogPath) + ", " +
+		"[StringComparison]::OrdinalIgnoreCase) } | ForEach-Object { " +
+		// The files locked by their service cannot be hashed, they are fingerprinted without a hash
+		"$hash = Get-FileHash -Algorithm SHA256 -LiteralPath $_.FullName -ErrorAction SilentlyContinue; " +
+		"$files[$_.FullName.Substring(" + fmt.Sprint(len(fingerprintRoot)) + ")] = [string]$hash.Hash } }; " +
+		"$networks = @{}; if (Get-Command Get-HnsNetwork -ErrorAction SilentlyContinue) { " +
+		"Get-HnsNetwork | ForEach-Object { $networks[$_.Name] = \"type=$($_.Type) subnets=$(@($_.Subnets).Count)\" } }; " +
+		"ConvertTo-Json -Compress -InputObject @{services = $services; files = $files; hnsNetworks = $networks}"
+}
+
+// ConfigFingerprintOf returns the start mode and command line of the node services, the hashes of the files under C:\k
+// but its logs, the enabled inbound Windows Firewall rules and profiles, and the HNS networks of the Windows VM
+func ConfigFingerprintOf(vm WindowsVM) (*ConfigFingerprint, error) {
+	return vm.handle().configFingerprint()
+}
+
+// configFingerprint implements ConfigFingerprintOf
+func (w *windowsVM) configFingerprint() (*ConfigFingerprint, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(configFingerprintScript()), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the configuration fingerprint of %s: %v, %s",
+			w.GetCredentials().GetIPAddress(), err, stderr)
+	}
+	var out struct {
+		Services    map[string]string `json:"services"`
+		Files       map[string]string `json:"files"`
+		HNSNetworks map[string]string `json:"hnsNetworks"`
+	}
+	if err = json.Unmarshal([]byte(strings.TrimSpace(stdout)), &out); err != nil {
+		return nil, fmt.Errorf("error parsing the configuration fingerprint of %s: %v",
+			w.GetCredentials().GetIPAddress(), err)
+	}
+	firewall, err := w.firewallState()
+	if err != nil {
+		return nil, err
+	}
+	return newConfigFingerprint(w.GetCredentials().GetIPAddress(), out.Services, out.Files, out.HNSNetworks,
+		firewall), nil
+}
+
+// newConfigFingerprint returns the fingerprint of the given host with the given services, file hashes, HNS networks
+// and Windows Firewall state
+func newConfigFingerprint(host string, services, files, hnsNetworks map[string]string,
+	firewall *FirewallState) *ConfigFingerprint {
+	rules := make(map[string]string, len(firewall.Rules))
+	for _, rule := range firewall.Rules {
+		ports := append([]string(nil), rule.LocalPorts...)
+		sort.Strings(ports)
+		rules[rule.Name] = fmt.Sprintf("%s %s %s", rule.Action, rule.Protocol, strings.Join(ports, ","))
+	}
+	profiles := make(map[string]string, len(firewall.EnabledProfiles))
+	for _, profile := range firewall.EnabledProfiles {
+		profiles[profile] = "enabled"
+	}
+	return &ConfigFingerprint{Host: host, Items: map[string]map[string]string{
+		ConfigService:         services,
+		ConfigFile:            files,
+		ConfigFirewallRule:    rules,
+		ConfigFirewallProfile: profiles,
+		ConfigHNSNetwork:      hnsNetworks,
+	}}
+}
+
+// DiffConfigFingerprints returns the items which differ between the given fingerprints, sorted by category and item
+func DiffConfigFingerprints(a, b *ConfigFingerprint) []ConfigDrift {
+	var drifts []ConfigDrift
+	categories := make(map[string]bool)
+	for category := range a.Items {
+		categories[category] = true
+	}
+	for category := range b.Items {
+		categories[category] = true
+	}
+	for category := range categories {
+		items := make(map[string]bool)
+		for item := range a.Items[category] {
+			items[item] = true
+		}
+		for item := range b.Items[category] {
+			items[item] = true
+		}
+		for item := range items {
+			valueA, okA := a.Items[category][item]
+			valueB, okB := b.Items[category][item]
+			if okA && okB && valueA == valueB {
+				continue
+			}
+			if !okA {
+				valueA = configDriftMissing
+			}
+			if !okB {
+				valueB = configDriftMissing
+			}
+			drifts = append(drifts, ConfigDrift{Category: category, Item: item, A: valueA, B: valueB})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Category != drifts[j].Category {
+			return drifts[i].Category < drifts[j].Category
+		}
+		return drifts[i].Item < drifts[j].Item
+	})
+	return drifts
+}
+
+// CompareNodeConfigs collects the configuration fingerprints of the given Windows VMs concurrently and returns the
+// items which differ between them
+func CompareNodeConfigs(a, b WindowsVM) (*ConfigDriftReport, error) {
+	vms := []WindowsVM{a, b}
+	fingerprints := make([]*ConfigFingerprint, len(vms))
+	errs := NewMultiError("compare the configuration of the nodes")
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i, vm := range vms {
+		wg.Add(1)
+		go func(i int, vm WindowsVM) {
+			defer wg.Done()
+			fingerprint, err := ConfigFingerprintOf(vm)
+			lock.Lock()
+			defer lock.Unlock()
+			fingerprints[i] = fingerprint
+			errs.Append(err)
+		}(i, vm)
+	}
+	wg.Wait()
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return &ConfigDriftReport{A: fingerprints[0].Host, B: fingerprints[1].Host, Time: clk.Now(),
+		Drifts: DiffConfigFingerprints(fingerprints[0], fingerprints[1])}, nil
+}
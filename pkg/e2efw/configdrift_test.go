@@ -0,0 +1,51 @@
+package e2efw
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDiffConfigFingerprints tests that the items which differ, or are missing from one of the nodes, are reported
+// sorted by category and item
+func TestDiffConfigFingerprints(t *testing.T) {
+	firewallA := &FirewallState{EnabledProfiles: []string{"Domain", "Private", "Public"}, Rules: []FirewallRule{
+		{Name: "kubelet", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"10250"}},
+		{Name: "sshd", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"22"}},
+	}}
+	firewallB := &FirewallState{EnabledProfiles: []string{"Domain", "Private"}, Rules: []FirewallRule{
+		{Name: "sshd", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"22"}},
+		{Name: "kubelet", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"10250", "10255"}},
+	}}
+	a := newConfigFingerprint("10.0.1.2",
+		map[string]string{"kubelet": "Auto C:\\k\\kubelet.exe --v=3", "kube-proxy": "Auto C:\\k\\kube-proxy.exe"},
+		map[string]string{"kubelet.exe": "1A2B", "kubelet.conf": "3C4D", "cni\\config\\cni.conf": "5E6F"},
+		map[string]string{"OVNKubernetesHybridOverlayNetwork": "type=Overlay subnets=1"}, firewallA)
+	b := newConfigFingerprint("10.0.1.3",
+		map[string]string{"kubelet": "Auto C:\\k\\kubelet.exe --v=4", "kube-proxy": "Auto C:\\k\\kube-proxy.exe"},
+		map[string]string{"kubelet.exe": "7A8B", "kubelet.conf": "3C4D"},
+		map[string]string{"OVNKubernetesHybridOverlayNetwork": "type=Overlay subnets=1"}, firewallB)
+
+	assert.Empty(t, DiffConfigFingerprints(a, a))
+	assert.Equal(t, []ConfigDrift{
+		{Category: ConfigFile, Item: "cni\\config\\cni.conf", A: "5E6F", B: configDriftMissing},
+		{Category: ConfigFile, Item: "kubelet.exe", A: "1A2B", B: "7A8B"},
+		{Category: ConfigFirewallProfile, Item: "Public", A: "enabled", B: configDriftMissing},
+		{Category: ConfigFirewallRule, Item: "kubelet", A: "Allow TCP 10250", B: "Allow TCP 10250,10255"},
+		{Category: ConfigService, Item: "kubelet", A: "Auto C:\\k\\kubelet.exe --v=3", B: "Auto C:\\k\\kubelet.exe --v=4"},
+	}, DiffConfigFingerprints(a, b))
+
+	report := &ConfigDriftReport{A: b.Host, B: a.Host, Drifts: DiffConfigFingerprints(b, a)}
+	assert.True(t, strings.HasPrefix(report.String(), "configuration drift between 10.0.1.3 (A) and 10.0.1.2 (B): 5 "+
+		"items\n"), report.String())
+	assert.Contains(t, report.String(), "file cni\\config\\cni.conf:\n  A: <missing>\n  B: 5E6F\n")
+}
+
+// TestConfigFingerprintScript tests that the logs are left out of the fingerprint and the paths made relative to C:\k
+func TestConfigFingerprintScript(t *testing.T) {
+	script := configFingerprintScript()
+	assert.Contains(t, script, "$names = @('kubelet', 'kube-proxy', ")
+	assert.Contains(t, script, "-not $_.FullName.StartsWith('C:\\k\\log\\', ")
+	assert.Contains(t, script, "$_.FullName.Substring(5)")
+}
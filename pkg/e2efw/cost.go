@@ -0,0 +1,130 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+)
+
+const (
+	// priceListEnvVar is the environment variable holding the path of a JSON price list, in the format of the --prices
+	// option of `wni aws cost`, whose prices take precedence over the built-in ones
+	priceListEnvVar = "E2E_PRICE_LIST"
+	// costReportFile is the file of the artifact directory the estimated spend of the run is written to
+	costReportFile = "cost.json"
+)
+
+// errBillingUnsupported is returned when the billed resources of a VM cannot be described on its cloud provider
+var errBillingUnsupported = errors.New("describing the billed resources is only supported on AWS")
+
+// CostReport is the estimated spend of the Windows VMs of a run
+type CostReport struct {
+	// Context is the context of the run
+	Context RunContext `json:"context"`
+	// Report is the estimated spend of the VMs, estimated as `wni aws cost` does
+	*cost.Report
+}
+
+// Billing returns the instance type, disks and running time until now of the Windows VM. Only AWS is supported.
+func Billing(vm WindowsVM) (*cost.Resource, error) {
+	return vm.handle().billing()
+}
+
+// billing implements Billing
+func (w *windowsVM) billing() (*cost.Resource, error) {
+	awsCloud, ok := w.cloudProvider.(*aws.AwsProvider)
+	if !ok {
+		return nil, errBillingUnsupported
+	}
+	instance, err := awsCloud.GetInstance(w.GetCredentials().GetInstanceId())
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance %s: %v", w.GetCredentials().GetInstanceId(), err)
+	}
+	var volumeIDs []*string
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs != nil && mapping.Ebs.VolumeId != nil {
+			volumeIDs = append(volumeIDs, mapping.Ebs.VolumeId)
+		}
+	}
+	volumes := make(map[string]*ec2.Volume)
+	if len(volumeIDs) > 0 {
+		output, err := awsCloud.EC2.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: volumeIDs})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the volumes of instance %s: %v", w.GetCredentials().GetInstanceId(),
+				err)
+		}
+		for _, volume := range output.Volumes {
+			volumes[awssdk.StringValue(volume.VolumeId)] = volume
+		}
+	}
+	resource := aws.CostResource(instance, volumes, time.Now())
+	return &resource, nil
+}
+
+// priceListFromEnv returns the built-in prices, overridden by the price list given by the E2E_PRICE_LIST environment
+// variable, if any. The built-in prices are in USD, so they are not used with a price list in another currency.
+func priceListFromEnv() (*cost.PriceList, error) {
+	prices := cost.DefaultPriceList()
+	filePath := os.Getenv(priceListEnvVar)
+	if filePath == "" {
+		return prices, nil
+	}
+	overrides, err := cost.ReadPriceList(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", priceListEnvVar, err)
+	}
+	if overrides.Currency != prices.Currency {
+		return overrides, nil
+	}
+	for instanceType, price := range overrides.InstanceHourly {
+		prices.InstanceHourly[instanceType] = price
+	}
+	for diskType, price := range overrides.DiskMonthly {
+		prices.DiskMonthly[diskType] = price
+	}
+	return prices, nil
+}
+
+// writeCostReport estimates the spend of the Windows VMs created by the run until now and writes it to the artifact
+// directory. It is nice to have, so failures are only logged.
+func (f *TestFramework) writeCostReport() {
+	prices, err := priceListFromEnv()
+	if err != nil {
+		log.Printf("unable to estimate the spend of the run: %v", err)
+		return
+	}
+	var resources []cost.Resource
+	for i, vm := range f.WinVMs {
+		if vm == nil || vm.GetCredentials() == nil {
+			continue
+		}
+		resource, err := Billing(vm)
+		if err != nil {
+			log.Printf("unable to estimate the spend of vm %d: %v", i, err)
+			continue
+		}
+		resources = append(resources, *resource)
+	}
+	report := &CostReport{Context: CurrentRunContext(), Report: cost.Estimate(resources, prices)}
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("error marshalling the cost report: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(artifactDir, costReportFile), contents, 0644); err != nil {
+		log.Printf("unable to write the cost report: %v", err)
+		return
+	}
+	log.Printf("estimated spend of the %d Windows VMs of the run: %.2f %s", len(report.Instances), report.Total,
+		report.Currency)
+}
@@ -0,0 +1,51 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPriceListFromEnv tests that the given price list takes precedence over the built-in prices, which are not used
+// with another currency
+func TestPriceListFromEnv(t *testing.T) {
+	defer os.Setenv(priceListEnvVar, os.Getenv(priceListEnvVar))
+	os.Unsetenv(priceListEnvVar)
+
+	prices, err := priceListFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cost.DefaultPriceList(), prices)
+
+	dir, err := ioutil.TempDir("", "prices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "prices.json")
+	os.Setenv(priceListEnvVar, filePath)
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`{"instanceHourly": {"m5a.large": 0.15}}`), 0644))
+	prices, err = priceListFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 0.15, prices.InstanceHourly["m5a.large"])
+	assert.Equal(t, cost.DefaultPriceList().InstanceHourly["m5.large"], prices.InstanceHourly["m5.large"])
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`{"currency": "EUR", "diskMonthly": {"gp2": 0.09}}`),
+		0644))
+	prices, err = priceListFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &cost.PriceList{Currency: "EUR", DiskMonthly: map[string]float64{"gp2": 0.09}}, prices)
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`{`), 0644))
+	_, err = priceListFromEnv()
+	assert.Error(t, err)
+}
+
+// TestBillingUnsupported tests that the billed resources of VMs on other cloud providers are not described
+func TestBillingUnsupported(t *testing.T) {
+	_, err := (&windowsVM{}).billing()
+	assert.Equal(t, errBillingUnsupported, err)
+}
@@ -0,0 +1,128 @@
+package e2efw
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	// dnsExternalNameEnvVar is the environment variable holding the host name outside of the cluster the DNS tests
+	// resolve from the Windows nodes and pods
+	dnsExternalNameEnvVar = "E2E_DNS_EXTERNAL_NAME"
+	// defaultDNSExternalName is the external host name resolved unless E2E_DNS_EXTERNAL_NAME is set
+	defaultDNSExternalName = "www.redhat.com"
+	// ClusterDomain is the DNS domain of the services of the cluster
+	ClusterDomain = "cluster.local"
+	// dnsFailed prefixes the output of DNSResolveScript when the name is not resolved
+	dnsFailed = "failed: "
+)
+
+// dnsClientSections are the sections of the DNS client configuration, with the PowerShell script printing each of them
+var dnsClientSections = []struct{ name, script string }{
+	// The global settings hold the suffix search list and the devolution of the names
+	{"DNS client global settings", "Get-DnsClientGlobalSetting | Format-List * | Out-String -Width 200"},
+	{"DNS servers", "Get-DnsClientServerAddress | Format-Table -AutoSize | Out-String -Width 200"},
+	{"DNS clients", "Get-DnsClient | Format-Table InterfaceAlias, ConnectionSpecificSuffix, " +
+		"ConnectionSpecificSuffixSearchList -AutoSize | Out-String -Width 200"},
+	{"DNS client cache", "Get-DnsClientCache | Format-Table -AutoSize | Out-String -Width 200"},
+	{"hosts file", "Get-Content -Path 'C:\\Windows\\System32\\drivers\\etc\\hosts'"},
+	{"ipconfig", "ipconfig /all"},
+}
+
+// DNSExternalNameFromEnv returns the host name outside of the cluster given by E2E_DNS_EXTERNAL_NAME, www.redhat.com
+// if not set
+func DNSExternalNameFromEnv() string {
+	if name := strings.TrimSpace(os.Getenv(dnsExternalNameEnvVar)); name != "" {
+		return name
+	}
+	return defaultDNSExternalName
+}
+
+// ServiceFQDN returns the fully qualified name of the service with the given name in the given namespace
+func ServiceFQDN(name, namespace string) string {
+	return name + "." + namespace + ".svc." + ClusterDomain
+}
+
+// DNSResolveScript returns the PowerShell script printing the IP addresses the given name resolves to, one per line.
+// The name is resolved like applications do, with the hosts file and the DNS suffix search list applied to it, which
+// Resolve-DnsName bypasses.
+func DNSResolveScript(name string) string {
+	return "try { [System.Net.Dns]::GetHostAddresses(" + PowerShellString(name) + ") | " +
+		"ForEach-Object { $_.IPAddressToString } } " +
+		"catch { '" + dnsFailed + "' + $_.Exception.GetBaseException().Message }"
+}
+
+// ParseDNSResolution returns the IP addresses printed by DNSResolveScript, or why the name was not resolved
+func ParseDNSResolution(out string) ([]string, error) {
+	var addresses []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, dnsFailed) {
+			return nil, fmt.Errorf("%s", strings.TrimPrefix(line, dnsFailed))
+		}
+		if net.ParseIP(line) == nil {
+			return nil, fmt.Errorf("unexpected resolution output %q", line)
+		}
+		addresses = append(addresses, line)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no address")
+	}
+	return addresses, nil
+}
+
+// DNSClientConfigScript returns the PowerShell script printing the DNS client configuration of the host or container
+// it is run in, a section at a time, like DNSClientConfig
+func DNSClientConfigScript() string {
+	var script strings.Builder
+	for _, section := range dnsClientSections {
+		fmt.Fprintf(&script, "'==== %s ===='; try { %s } catch { $_.Exception.Message }; ''; ", section.name,
+			section.script)
+	}
+	return script.String()
+}
+
+// ResolveHost returns the IP addresses the given name resolves to on the Windows VM
+func ResolveHost(vm WindowsVM, name string) ([]string, error) {
+	return vm.handle().resolveHost(name)
+}
+
+// resolveHost implements ResolveHost
+func (w *windowsVM) resolveHost(name string) ([]string, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(DNSResolveScript(name)), true)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s on %s: %v, %s", name, w.GetCredentials().GetIPAddress(), err,
+			stderr)
+	}
+	addresses, err := ParseDNSResolution(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve %s on %s: %v", name, w.GetCredentials().GetIPAddress(), err)
+	}
+	return addresses, nil
+}
+
+// DNSClientConfig returns the DNS client settings, servers and cache of the Windows VM, with its hosts file and IP
+// configuration, which tell how it resolves names
+func DNSClientConfig(vm WindowsVM) (string, error) {
+	return vm.handle().dNSClientConfig()
+}
+
+// dNSClientConfig implements DNSClientConfig
+func (w *windowsVM) dNSClientConfig() (string, error) {
+	errs := NewMultiError("collect the DNS client configuration of " + w.GetCredentials().GetIPAddress())
+	var config strings.Builder
+	for _, section := range dnsClientSections {
+		stdout, stderr, err := w.Run(PowerShellScript(section.script), true)
+		if err != nil {
+			errs.Appendf("error getting the %s: %v, %s", section.name, err, stderr)
+			continue
+		}
+		fmt.Fprintf(&config, "==== %s ====\n%s\n", section.name, stdout)
+	}
+	return config.String(), errs.ErrorOrNil()
+}
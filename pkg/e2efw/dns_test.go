@@ -0,0 +1,46 @@
+package e2efw
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDNSResolution tests the parsing of the addresses a name resolves to, and of the resolution failures
+func TestParseDNSResolution(t *testing.T) {
+	addresses, err := ParseDNSResolution("172.30.0.1\r\nfd02::1\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"172.30.0.1", "fd02::1"}, addresses)
+
+	_, err = ParseDNSResolution("failed: No such host is known\r\n")
+	require.Error(t, err)
+	assert.Equal(t, "No such host is known", err.Error())
+	for _, out := range []string{"", "\r\n", "Exception calling \"GetHostAddresses\""} {
+		_, err = ParseDNSResolution(out)
+		assert.Error(t, err, out)
+	}
+}
+
+// TestDNSScripts tests that the resolved name is quoted and that each section of the DNS client configuration is
+// printed with its header
+func TestDNSScripts(t *testing.T) {
+	assert.Contains(t, DNSResolveScript("kubernetes.default"), "GetHostAddresses('kubernetes.default')")
+	script := DNSClientConfigScript()
+	for _, section := range dnsClientSections {
+		assert.Contains(t, script, "'==== "+section.name+" ===='; try { "+section.script+" }")
+	}
+	assert.Equal(t, len(dnsClientSections), strings.Count(script, "catch"))
+	assert.Equal(t, "kubernetes.default.svc.cluster.local", ServiceFQDN("kubernetes", "default"))
+}
+
+// TestDNSExternalNameFromEnv tests that the external name defaults to www.redhat.com
+func TestDNSExternalNameFromEnv(t *testing.T) {
+	defer os.Setenv(dnsExternalNameEnvVar, os.Getenv(dnsExternalNameEnvVar))
+	require.NoError(t, os.Setenv(dnsExternalNameEnvVar, ""))
+	assert.Equal(t, defaultDNSExternalName, DNSExternalNameFromEnv())
+	require.NoError(t, os.Setenv(dnsExternalNameEnvVar, " example.com "))
+	assert.Equal(t, "example.com", DNSExternalNameFromEnv())
+}
@@ -0,0 +1,132 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// downloadProxyEnvVar is the environment variable holding the proxy the Windows VMs download artifacts through, e.g.
+// http://proxy.example.com:3128, when they cannot reach the artifact servers directly
+const downloadProxyEnvVar = "E2E_DOWNLOAD_PROXY"
+
+var (
+	// sha256Regex matches a SHA256 checksum in hexadecimal
+	sha256Regex = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+	// remotePathRegex matches the absolute paths of files on the Windows VMs, e.g. C:\k\kubelet.exe
+	remotePathRegex = regexp.MustCompile(`^[A-Za-z]:\\[^\r\n]*[^\\\r\n]$`)
+)
+
+// validateDownload returns an error if the given artifact cannot be downloaded to the given remote path and verified
+func validateDownload(artifactURL, remotePath, sha256 string) error {
+	parsed, err := url.Parse(artifactURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid artifact URL %q, expected an http or https URL", artifactURL)
+	}
+	if !remotePathRegex.MatchString(remotePath) {
+		return fmt.Errorf("invalid remote path %q, expected an absolute path with a drive letter", remotePath)
+	}
+	if !sha256Regex.MatchString(sha256) {
+		return fmt.Errorf("invalid SHA256 checksum %q of %s", sha256, artifactURL)
+	}
+	return nil
+}
+
+// downloadProxy returns the proxy given by E2E_DOWNLOAD_PROXY, or an empty string if the VMs download directly or
+// through their system proxy
+func downloadProxy() (string, error) {
+	proxy := os.Getenv(downloadProxyEnvVar)
+	if proxy == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(proxy)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid %s %q, expected an http or https URL", downloadProxyEnvVar, proxy)
+	}
+	return proxy, nil
+}
+
+// DownloadToVM makes the Windows VM download the artifact of the given URL to the given remote path and verify it
+// against the given SHA256 checksum, instead of routing it through the SFTP connection of the test host, which is
+// slow when the test host has poor bandwidth to the VM. The artifact is downloaded with Invoke-WebRequest, falling
+// back to BITS, through the proxy given by E2E_DOWNLOAD_PROXY if any, and is only moved to the remote path once
+// verified. It is not downloaded again if the remote path already has the checksum.
+func DownloadToVM(vm WindowsVM, artifactURL, remotePath, sha256 string) (err error) {
+	return vm.handle().downloadToVM(artifactURL, remotePath, sha256)
+}
+
+// downloadToVM implements DownloadToVM
+func (w *windowsVM) downloadToVM(artifactURL, remotePath, sha256 string) (err error) {
+	_, span := startSpan(suiteCtx, "download to vm", w.hostAttribute(), attribute.String("url", artifactURL),
+		attribute.String("remote-path", remotePath))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateDownload(artifactURL, remotePath, sha256); err != nil {
+		return err
+	}
+	proxy, err := downloadProxy()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	script := downloadScript(PowerShellString(artifactURL), remotePath, sha256, proxy, false)
+	stdout, stderr, err := w.Run(PowerShellScript(script), true)
+	if err != nil {
+		return fmt.Errorf("error downloading %s to %s: %v, %s", artifactURL, remotePath, err, stderr)
+	}
+	if strings.TrimSpace(stdout) == "cached" {
+		log.Printf("%s already downloaded to %s of %s", artifactURL, remotePath, w.GetCredentials().GetIPAddress())
+		return nil
+	}
+	log.Printf("downloaded %s to %s of %s in %v", artifactURL, remotePath, w.GetCredentials().GetIPAddress(),
+		time.Since(start).Round(time.Second))
+	return nil
+}
+
+// downloadScript returns the PowerShell script downloading the artifact of the URL the given PowerShell expression
+// evaluates to, to a temporary file next to the given remote path, through the given proxy if not empty, verifying its
+// SHA256 checksum and moving it to the remote path. The artifact is downloaded with Invoke-WebRequest, falling back to
+// BITS, or the other way around if preferBITS is set. It writes cached if the remote path already has the checksum. The
+// progress bar of Invoke-WebRequest is turned off, as it slows the downloads down by an order of magnitude. The remote
+// path is passed with -LiteralPath, and the temporary file is named after the checksum as -OutFile takes wildcards,
+// so that names with brackets or spaces are not mistaken for patterns.
+func downloadScript(source, remotePath, sha256, proxy string, preferBITS bool) string {
+	path := PowerShellString(remotePath)
+	partial := PowerShellString(remotepath.WindowsPathJoin(remotepath.Dir(remotePath),
+		strings.ToLower(sha256)+".download"))
+	expected := PowerShellString(strings.ToUpper(sha256))
+	webProxy, bitsProxy := "", ""
+	if proxy != "" {
+		webProxy = " -Proxy " + PowerShellString(proxy)
+		bitsProxy = " -ProxyUsage Override -ProxyList " + PowerShellString(strings.TrimPrefix(strings.TrimPrefix(
+			proxy, "http://"), "https://"))
+	}
+	// The URL is only written once, as the presigned URLs of the staged artifacts take a good part of the command line
+	web := "Invoke-WebRequest -UseBasicParsing -Uri $source -OutFile " + partial + webProxy
+	bits := "Start-BitsTransfer -Priority Foreground -Source $source -Destination " + partial + bitsProxy
+	first, firstName, second, secondName := web, "Invoke-WebRequest", bits, "BITS"
+	if preferBITS {
+		first, firstName, second, secondName = bits, "BITS", web, "Invoke-WebRequest"
+	}
+	return "$ErrorActionPreference = 'Stop'; $ProgressPreference = 'SilentlyContinue'; " +
+		"[Net.ServicePointManager]::SecurityProtocol = [Net.ServicePointManager]::SecurityProtocol -bor " +
+		"[Net.SecurityProtocolType]::Tls12; " +
+		"$source = " + source + "; " +
+		"if ((Test-Path -LiteralPath " + path + ") -and (Get-FileHash -Algorithm SHA256 -LiteralPath " + path +
+		").Hash -eq " + expected + ") { 'cached'; exit 0 }; " +
+		"New-Item -ItemType Directory -Force -Path " + PowerShellString(remotepath.Dir(remotePath)) + " | Out-Null; " +
+		"try { " + first + " } catch { $firstError = $_; try { " + second + " } catch { " +
+		"throw \"" + firstName + " failed: $firstError, " + secondName + " failed: $_\" } }; " +
+		"$actual = (Get-FileHash -Algorithm SHA256 -LiteralPath " + partial + ").Hash; " +
+		"if ($actual -ne " + expected + ") { Remove-Item -Force -LiteralPath " + partial + "; " +
+		"throw \"checksum mismatch: expected " + strings.ToUpper(sha256) + ", got $actual\" }; " +
+		"Move-Item -Force -LiteralPath " + partial + " -Destination " + path
+}
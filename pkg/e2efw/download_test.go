@@ -0,0 +1,108 @@
+package e2efw
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// artifactChecksum is the SHA256 checksum of the artifacts of the tests
+const artifactChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// TestValidateDownload tests that the downloads which cannot be verified or written on the VM are rejected
+func TestValidateDownload(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		remotePath string
+		sha256     string
+		valid      bool
+	}{
+		{"valid", "https://dl.k8s.io/v1.19.0/kubernetes-node-windows-amd64.tar.gz", "C:\\k\\node.tar.gz", artifactChecksum,
+			true},
+		{"uppercase checksum", "http://mirror.example.com/cni.zip", "d:\\cni\\cni.zip",
+			"9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08", true},
+		{"ftp URL", "ftp://mirror.example.com/cni.zip", "C:\\cni.zip", artifactChecksum, false},
+		{"relative URL", "/cni.zip", "C:\\cni.zip", artifactChecksum, false},
+		{"relative path", "https://mirror.example.com/cni.zip", "cni.zip", artifactChecksum, false},
+		{"directory", "https://mirror.example.com/cni.zip", "C:\\cni\\", artifactChecksum, false},
+		{"new line in path", "https://mirror.example.com/cni.zip", "C:\\cni\n.zip", artifactChecksum, false},
+		{"no checksum", "https://mirror.example.com/cni.zip", "C:\\cni.zip", "", false},
+		{"SHA1 checksum", "https://mirror.example.com/cni.zip", "C:\\cni.zip",
+			"a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDownload(tt.url, tt.remotePath, tt.sha256)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+// TestDownloadProxy tests the proxy given by the environment
+func TestDownloadProxy(t *testing.T) {
+	defer os.Unsetenv(downloadProxyEnvVar)
+
+	os.Unsetenv(downloadProxyEnvVar)
+	proxy, err := downloadProxy()
+	require.NoError(t, err)
+	assert.Empty(t, proxy)
+
+	os.Setenv(downloadProxyEnvVar, "http://proxy.example.com:3128")
+	proxy, err = downloadProxy()
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxy)
+
+	os.Setenv(downloadProxyEnvVar, "proxy.example.com:3128")
+	_, err = downloadProxy()
+	assert.Error(t, err)
+}
+
+// TestDownloadScript tests that the artifact is verified before being moved to the remote path, and that the proxy is
+// passed to both Invoke-WebRequest and BITS
+func TestDownloadScript(t *testing.T) {
+	script := downloadScript(PowerShellString("https://mirror.example.com/o'cni.zip"), "C:\\cni\\cni.zip",
+		artifactChecksum, "", false)
+	partial := "'C:\\cni\\" + artifactChecksum + ".download'"
+	assert.Contains(t, script, "$source = 'https://mirror.example.com/o''cni.zip'; ")
+	assert.Contains(t, script, "try { Invoke-WebRequest -UseBasicParsing -Uri $source "+
+		"-OutFile "+partial+" }")
+	assert.Contains(t, script, "try { Start-BitsTransfer -Priority Foreground -Source $source "+
+		"-Destination "+partial+" }")
+	assert.True(t, strings.Index(script, "Invoke-WebRequest") < strings.Index(script, "Start-BitsTransfer"))
+	assert.Contains(t, script, "-eq '9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08') { 'cached'")
+	assert.NotContains(t, script, "Proxy")
+	assert.True(t, len(PowerShellScript(script)) < maxCmdLineLength)
+	hashed := strings.Index(script, "$actual = (Get-FileHash")
+	moved := strings.Index(script, "Move-Item -Force -LiteralPath "+partial+" -Destination 'C:\\cni\\cni.zip'")
+	require.True(t, hashed > 0 && moved > 0)
+	assert.True(t, hashed < moved, "the artifact is verified before being moved")
+
+	script = downloadScript("$stagedURL", "C:\\cni\\cni.zip", artifactChecksum,
+		"http://proxy.example.com:3128", true)
+	assert.True(t, strings.Index(script, "Start-BitsTransfer") < strings.Index(script, "Invoke-WebRequest"),
+		"BITS is tried first")
+	assert.Contains(t, script, "$source = $stagedURL; ")
+	assert.Contains(t, script, "-OutFile "+partial+" -Proxy 'http://proxy.example.com:3128' }")
+	assert.Contains(t, script, "-Destination "+partial+" -ProxyUsage Override "+
+		"-ProxyList 'proxy.example.com:3128' }")
+}
+
+// TestDownloadScriptLiteralPath tests that the remote paths with spaces, brackets and non-ASCII characters are not
+// taken as wildcard patterns
+func TestDownloadScriptLiteralPath(t *testing.T) {
+	script := downloadScript("$stagedURL", "C:\\k\\logs [2021-01-01]\\kubelet été's.log", artifactChecksum, "",
+		false)
+	assert.Contains(t, script, "(Test-Path -LiteralPath 'C:\\k\\logs [2021-01-01]\\kubelet été''s.log')")
+	assert.Contains(t, script, "New-Item -ItemType Directory -Force -Path 'C:\\k\\logs [2021-01-01]' | Out-Null")
+	assert.Contains(t, script, "-OutFile 'C:\\k\\logs [2021-01-01]\\"+artifactChecksum+".download'")
+	assert.Contains(t, script, "-Destination 'C:\\k\\logs [2021-01-01]\\kubelet été''s.log'")
+	assert.NotContains(t, script, "-Path 'C:\\k\\logs [2021-01-01]\\")
+}
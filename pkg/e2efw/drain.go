@@ -0,0 +1,121 @@
+package e2efw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// mirrorPodAnnotation is the annotation of the mirror pods of static pods, which cannot be evicted through the API
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// CordonNode marks the node with the given name unschedulable
+func (f *TestFramework) CordonNode(name string) error {
+	return f.setUnschedulable(name, true)
+}
+
+// UncordonNode marks the node with the given name schedulable again
+func (f *TestFramework) UncordonNode(name string) error {
+	return f.setUnschedulable(name, false)
+}
+
+// setUnschedulable sets whether new pods can be scheduled on the node with the given name
+func (f *TestFramework) setUnschedulable(name string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := f.K8sclientset.CoreV1().Nodes().Patch(name, k8stypes.StrategicMergePatchType, []byte(patch))
+	if err != nil {
+		return fmt.Errorf("error setting node %s unschedulable to %t: %v", name, unschedulable, err)
+	}
+	return nil
+}
+
+// DrainNode cordons the node with the given name and evicts its pods like kubectl drain does, skipping the DaemonSet
+// and mirror pods. It waits until the evicted pods are gone, which takes as long as their graceful termination, and
+// returns them. The node is left cordoned.
+func (f *TestFramework) DrainNode(name string, timeout time.Duration) ([]v1.Pod, error) {
+	if err := f.CordonNode(name); err != nil {
+		return nil, err
+	}
+	podList, err := f.K8sclientset.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + name})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the pods of node %s: %v", name, err)
+	}
+	pods := podsToEvict(podList.Items)
+
+	deadline := clk.Now().Add(timeout)
+	for _, pod := range pods {
+		if err := f.evictPod(pod, deadline); err != nil {
+			return nil, err
+		}
+	}
+	for _, pod := range pods {
+		if err := f.waitForPodDeletion(pod, deadline); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("drained %d pods from node %s", len(pods), name)
+	return pods, nil
+}
+
+// podsToEvict returns the pods that are evicted when draining a node: the DaemonSet pods would be recreated on the
+// node right away, the mirror pods are managed by the kubelet and the completed pods do not run anymore
+func podsToEvict(pods []v1.Pod) []v1.Pod {
+	var evict []v1.Pod
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		evict = append(evict, pod)
+	}
+	return evict
+}
+
+// evictPod evicts the given pod, retrying until the deadline while a pod disruption budget does not allow it
+func (f *TestFramework) evictPod(pod v1.Pod, deadline time.Time) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	options := PollOptions{Interval: RetryInterval, Deadline: deadline, Jitter: DefaultPollJitter}
+	return Poll(context.Background(), fmt.Sprintf("the eviction of pod %s/%s", pod.Namespace, pod.Name), options,
+		func() (bool, string, error) {
+			err := f.K8sclientset.CoreV1().Pods(pod.Namespace).Evict(eviction)
+			switch {
+			case err == nil, errors.IsNotFound(err):
+				return true, "", nil
+			case !errors.IsTooManyRequests(err):
+				return false, "", fmt.Errorf("error evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			}
+			return false, err.Error(), nil
+		})
+}
+
+// waitForPodDeletion waits until the deadline for the given pod to be deleted. A pod with the same name but another
+// UID, like a recreated StatefulSet pod, is a different pod.
+func (f *TestFramework) waitForPodDeletion(pod v1.Pod, deadline time.Time) error {
+	options := PollOptions{Interval: time.Second, Deadline: deadline, Jitter: DefaultPollJitter}
+	return Poll(context.Background(), fmt.Sprintf("pod %s/%s to be deleted", pod.Namespace, pod.Name), options,
+		func() (bool, string, error) {
+			current, err := f.K8sclientset.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			switch {
+			case errors.IsNotFound(err):
+				return true, "", nil
+			case err != nil:
+				return false, err.Error(), nil
+			}
+			return current.UID != pod.UID, "the pod is " + string(current.Status.Phase), nil
+		})
+}
@@ -0,0 +1,38 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestPodsToEvict tests that draining a node skips the DaemonSet, mirror and completed pods
+func TestPodsToEvict(t *testing.T) {
+	controller := true
+	pod := func(name, ownerKind string, phase v1.PodPhase, annotations map[string]string) v1.Pod {
+		p := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+		if ownerKind != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner", Controller: &controller}}
+		}
+		return p
+	}
+	pods := []v1.Pod{
+		pod("replicaset", "ReplicaSet", v1.PodRunning, nil),
+		pod("daemonset", "DaemonSet", v1.PodRunning, nil),
+		pod("mirror", "Node", v1.PodRunning, map[string]string{mirrorPodAnnotation: "hash"}),
+		pod("bare", "", v1.PodPending, nil),
+		pod("succeeded", "Job", v1.PodSucceeded, nil),
+		pod("failed", "", v1.PodFailed, nil),
+	}
+
+	var names []string
+	for _, p := range podsToEvict(pods) {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"replicaset", "bare"}, names)
+}
@@ -0,0 +1,197 @@
+package e2efw
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	// egressTargetEnvVar is the environment variable holding the <host>:<port> outside of the cluster the egress
+	// firewall tests connect to, the API server of the cluster through its load balancer if not set
+	egressTargetEnvVar = "E2E_EGRESS_TARGET"
+	// egressIPEnvVar is the environment variable holding the free IP address of the machine network the EgressIP tests
+	// assign to the test namespace. The EgressIP tests are skipped if not set.
+	egressIPEnvVar = "E2E_EGRESS_IP"
+	// egressEchoURLEnvVar is the environment variable holding the URL of a server outside of the cluster answering with
+	// the source IP address of the request, which tells the EgressIP tests the address the pods egress with
+	egressEchoURLEnvVar = "E2E_EGRESS_ECHO_URL"
+	// OVNKubernetesNetworkType is the network type of the clusters whose egress firewalls and EgressIPs are tested
+	OVNKubernetesNetworkType = "OVNKubernetes"
+	// EgressAssignableLabel is the label of the nodes OVN-Kubernetes may assign the EgressIPs to
+	EgressAssignableLabel = "k8s.ovn.org/egress-assignable"
+	// egressFirewallName is the name of the only EgressFirewall OVN-Kubernetes enforces in a namespace
+	egressFirewallName = "default"
+)
+
+var (
+	// EgressFirewallResource is the resource of the OVN-Kubernetes EgressFirewalls
+	EgressFirewallResource = schema.GroupVersionResource{Group: "k8s.ovn.org", Version: "v1",
+		Resource: "egressfirewalls"}
+	// EgressIPResource is the resource of the OVN-Kubernetes EgressIPs
+	EgressIPResource = schema.GroupVersionResource{Group: "k8s.ovn.org", Version: "v1", Resource: "egressips"}
+)
+
+// EgressConfig is the configuration of the egress tests, given by the E2E_EGRESS_* environment variables
+type EgressConfig struct {
+	// Target is the <host>:<port> outside of the cluster the egress firewall tests connect to
+	Target string
+	// EgressIP is the IP address assigned to the test namespace, empty if the EgressIP tests are skipped
+	EgressIP string
+	// EchoURL is the URL answering with the source IP address of the request
+	EchoURL string
+}
+
+// getDynamicClient gets a new dynamic client, serving the custom resources of the cluster without a typed client
+func (f *TestFramework) getDynamicClient(config *restclient.Config) error {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create dynamic client: %v", err)
+	}
+	f.DynamicClient = dynamicClient
+	return nil
+}
+
+// NetworkType returns the network type of the cluster, e.g. OVNKubernetes
+func (f *TestFramework) NetworkType() (string, error) {
+	network, err := f.OSConfigClient.ConfigV1().Networks().Get("cluster", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting cluster network object: %v", err)
+	}
+	return network.Status.NetworkType, nil
+}
+
+// EgressConfigFromEnv returns the configuration of the egress tests given by E2E_EGRESS_TARGET, E2E_EGRESS_IP and
+// E2E_EGRESS_ECHO_URL. The target defaults to the API server of the cluster.
+func EgressConfigFromEnv() (*EgressConfig, error) {
+	config := &EgressConfig{
+		Target:   strings.TrimSpace(os.Getenv(egressTargetEnvVar)),
+		EgressIP: strings.TrimSpace(os.Getenv(egressIPEnvVar)),
+		EchoURL:  strings.TrimSpace(os.Getenv(egressEchoURLEnvVar)),
+	}
+	if config.Target == "" {
+		config.Target = net.JoinHostPort("api."+ClusterAddress, apiServerPort)
+	}
+	if _, port, err := net.SplitHostPort(config.Target); err != nil || port == "" {
+		return nil, fmt.Errorf("invalid %s %s, expected <host>:<port>", egressTargetEnvVar, config.Target)
+	}
+	if config.EgressIP == "" && config.EchoURL == "" {
+		return config, nil
+	}
+	if ip := net.ParseIP(config.EgressIP); ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid %s %q, expected an IPv4 address", egressIPEnvVar, config.EgressIP)
+	}
+	if echoURL, err := url.Parse(config.EchoURL); err != nil || (echoURL.Scheme != "http" &&
+		echoURL.Scheme != "https") || echoURL.Host == "" {
+		return nil, fmt.Errorf("invalid %s %q, expected an http or https URL, required along with %s",
+			egressEchoURLEnvVar, config.EchoURL, egressIPEnvVar)
+	}
+	return config, nil
+}
+
+// EgressFirewall returns the EgressFirewall of the given namespace denying the connections to the host of the given
+// <host>:<port> target and allowing the others. The host is denied by address if it is an IP address, and by DNS name
+// otherwise.
+func EgressFirewall(namespace, target string) (*unstructured.Unstructured, error) {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %s: %v", target, err)
+	}
+	to := map[string]interface{}{"dnsName": host}
+	if ip := net.ParseIP(host); ip != nil {
+		to = map[string]interface{}{"cidrSelector": host + "/32"}
+		if ip.To4() == nil {
+			to = map[string]interface{}{"cidrSelector": host + "/128"}
+		}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": EgressFirewallResource.GroupVersion().String(),
+		"kind":       "EgressFirewall",
+		"metadata": map[string]interface{}{
+			"name":      egressFirewallName,
+			"namespace": namespace,
+			"labels":    stringMapToInterface(RunLabels(nil)),
+		},
+		"spec": map[string]interface{}{
+			"egress": []interface{}{
+				map[string]interface{}{"type": "Deny", "to": to},
+				map[string]interface{}{"type": "Allow", "to": map[string]interface{}{"cidrSelector": "0.0.0.0/0"}},
+			},
+		},
+	}}, nil
+}
+
+// EgressIP returns the EgressIP of the given name assigning the given IP address to the namespaces with the given
+// labels
+func EgressIP(name, ip string, namespaceLabels map[string]string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": EgressIPResource.GroupVersion().String(),
+		"kind":       "EgressIP",
+		"metadata":   map[string]interface{}{"name": name, "labels": stringMapToInterface(RunLabels(nil))},
+		"spec": map[string]interface{}{
+			"egressIPs":         []interface{}{ip},
+			"namespaceSelector": map[string]interface{}{"matchLabels": stringMapToInterface(namespaceLabels)},
+		},
+	}}
+}
+
+// EgressIPNode returns the node the given IP address of the given EgressIP is assigned to, empty if it is not assigned
+func EgressIPNode(egressIP *unstructured.Unstructured, ip string) string {
+	items, _, _ := unstructured.NestedSlice(egressIP.Object, "status", "items")
+	for _, item := range items {
+		status, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if address, _ := status["egressIP"].(string); address == ip {
+			node, _ := status["node"].(string)
+			return node
+		}
+	}
+	return ""
+}
+
+// stringMapToInterface returns the given string map as the map of an unstructured object
+func stringMapToInterface(m map[string]string) map[string]interface{} {
+	converted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		converted[key] = value
+	}
+	return converted
+}
+
+// HNSDiagnostics returns the HNS networks, endpoints and policy lists of the Windows VM, the NAT and routes of its host
+// and the end of the hybrid overlay log, which tell how the traffic of the pods leaves the node
+func HNSDiagnostics(vm WindowsVM) (string, error) {
+	return vm.handle().hNSDiagnostics()
+}
+
+// hNSDiagnostics implements HNSDiagnostics
+func (w *windowsVM) hNSDiagnostics() (string, error) {
+	errs := NewMultiError("collect the HNS diagnostics of " + w.GetCredentials().GetIPAddress())
+	var diagnostics strings.Builder
+	for _, section := range []struct{ name, script string }{
+		{"HNS networks", "Get-HnsNetwork | ConvertTo-Json -Depth 10"},
+		{"HNS endpoints", "Get-HnsEndpoint | ConvertTo-Json -Depth 10"},
+		{"HNS policy lists", "Get-HnsPolicyList | ConvertTo-Json -Depth 10"},
+		{"NAT", "Get-NetNat | Format-List * | Out-String -Width 200"},
+		{"routes", "Get-NetRoute -AddressFamily IPv4 | Format-Table -AutoSize | Out-String -Width 200"},
+		{"hybrid overlay log", "Get-Content -Tail 200 -Path " + PowerShellString(remoteLogPath+"hybrid-overlay.log")},
+	} {
+		stdout, stderr, err := w.Run(PowerShellScript(section.script), true)
+		if err != nil {
+			errs.Appendf("error getting the %s: %v, %s", section.name, err, stderr)
+			continue
+		}
+		fmt.Fprintf(&diagnostics, "==== %s ====\n%s\n", section.name, stdout)
+	}
+	return diagnostics.String(), errs.ErrorOrNil()
+}
@@ -0,0 +1,84 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestEgressConfigFromEnv tests that the egress target defaults to the API server of the cluster, and that the EgressIP
+// tests need both an IPv4 address and an echo URL
+func TestEgressConfigFromEnv(t *testing.T) {
+	for _, envVar := range []string{egressTargetEnvVar, egressIPEnvVar, egressEchoURLEnvVar} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+	}
+	defer func(address string) { ClusterAddress = address }(ClusterAddress)
+	ClusterAddress = "windows.example.com"
+	setEnv := func(target, ip, echoURL string) {
+		require.NoError(t, os.Setenv(egressTargetEnvVar, target))
+		require.NoError(t, os.Setenv(egressIPEnvVar, ip))
+		require.NoError(t, os.Setenv(egressEchoURLEnvVar, echoURL))
+	}
+
+	setEnv("", "", "")
+	config, err := EgressConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &EgressConfig{Target: "api.windows.example.com:6443"}, config)
+
+	setEnv("203.0.113.10:443", "10.0.128.50", "http://10.0.0.5:8080/ip")
+	config, err = EgressConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &EgressConfig{Target: "203.0.113.10:443", EgressIP: "10.0.128.50",
+		EchoURL: "http://10.0.0.5:8080/ip"}, config)
+
+	for _, invalid := range [][]string{
+		{"203.0.113.10", "", ""},
+		{"", "10.0.128.50", ""},
+		{"", "", "http://10.0.0.5:8080/ip"},
+		{"", "fd00::50", "http://10.0.0.5:8080/ip"},
+		{"", "10.0.128.50", "10.0.0.5:8080"},
+	} {
+		setEnv(invalid[0], invalid[1], invalid[2])
+		_, err = EgressConfigFromEnv()
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+// TestEgressFirewall tests that the target is denied by address or DNS name, and the rest of the traffic allowed
+func TestEgressFirewall(t *testing.T) {
+	for target, to := range map[string]map[string]interface{}{
+		"203.0.113.10:443":             {"cidrSelector": "203.0.113.10/32"},
+		"[2001:db8::10]:443":           {"cidrSelector": "2001:db8::10/128"},
+		"api.windows.example.com:6443": {"dnsName": "api.windows.example.com"},
+	} {
+		firewall, err := EgressFirewall("e2e-jdoe-egress", target)
+		require.NoError(t, err, target)
+		assert.Equal(t, "default", firewall.GetName())
+		assert.Equal(t, "e2e-jdoe-egress", firewall.GetNamespace())
+		rules, _, _ := unstructured.NestedSlice(firewall.Object, "spec", "egress")
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "Deny", "to": to},
+			map[string]interface{}{"type": "Allow", "to": map[string]interface{}{"cidrSelector": "0.0.0.0/0"}},
+		}, rules, target)
+	}
+	_, err := EgressFirewall("e2e-jdoe-egress", "203.0.113.10")
+	assert.Error(t, err)
+}
+
+// TestEgressIPNode tests that the node an egress IP is assigned to is read from the status of the EgressIP
+func TestEgressIPNode(t *testing.T) {
+	egressIP := EgressIP("e2e-jdoe-egress", "10.0.128.50", map[string]string{"egress": "e2e-jdoe"})
+	selector, _, _ := unstructured.NestedStringMap(egressIP.Object, "spec", "namespaceSelector", "matchLabels")
+	assert.Equal(t, map[string]string{"egress": "e2e-jdoe"}, selector)
+	assert.Empty(t, EgressIPNode(egressIP, "10.0.128.50"))
+
+	require.NoError(t, unstructured.SetNestedSlice(egressIP.Object, []interface{}{
+		map[string]interface{}{"egressIP": "10.0.128.51", "node": "ip-10-0-128-7.ec2.internal"},
+		map[string]interface{}{"egressIP": "10.0.128.50", "node": "ip-10-0-128-9.ec2.internal"},
+	}, "status", "items"))
+	assert.Equal(t, "ip-10-0-128-9.ec2.internal", EgressIPNode(egressIP, "10.0.128.50"))
+	assert.Empty(t, EgressIPNode(egressIP, "10.0.128.52"))
+}
@@ -0,0 +1,108 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// pathEnvVar is the name of the environment variable holding the search path of executables
+const pathEnvVar = "Path"
+
+// GetEnv returns the value of the given machine-level environment variable on the Windows VM. An empty value is
+// returned if the variable is not set.
+func GetEnv(vm WindowsVM, name string) (string, error) {
+	return vm.handle().getEnv(name)
+}
+
+// getEnv implements GetEnv
+func (w *windowsVM) getEnv(name string) (string, error) {
+	if err := validateEnvArgs(name); err != nil {
+		return "", err
+	}
+	stdout, stderr, err := w.Run(PowerShellScript("[Environment]::GetEnvironmentVariable("+
+		PowerShellString(name)+", 'Machine')"), true)
+	if err != nil {
+		return "", fmt.Errorf("error getting environment variable %s: %v, %s", name, err, stderr)
+	}
+	return strings.TrimRight(stdout, "\r\n"), nil
+}
+
+// SetEnv persistently sets the given machine-level environment variable on the Windows VM, or removes it if the value
+// is empty. It returns true if the value was changed, in which case the processes and services that need the new
+// value have to be restarted.
+func SetEnv(vm WindowsVM, name, value string) (bool, error) {
+	return vm.handle().setEnv(name, value)
+}
+
+// setEnv implements SetEnv
+func (w *windowsVM) setEnv(name, value string) (bool, error) {
+	if err := validateEnvArgs(name, value); err != nil {
+		return false, err
+	}
+	current, err := w.getEnv(name)
+	if err != nil {
+		return false, err
+	}
+	if current == value {
+		return false, nil
+	}
+	newValue := "$null"
+	if value != "" {
+		newValue = PowerShellString(value)
+	}
+	_, stderr, err := w.Run(PowerShellScript("[Environment]::SetEnvironmentVariable("+PowerShellString(name)+
+		", "+newValue+", 'Machine')"), true)
+	if err != nil {
+		return false, fmt.Errorf("error setting environment variable %s: %v, %s", name, err, stderr)
+	}
+	log.Printf("environment variable %s changed on %s: running processes keep the previous value until restarted, "+
+		"and services only see the new value once the node is rebooted", name, w.GetCredentials().GetIPAddress())
+	return true, nil
+}
+
+// AppendToPath persistently appends the given directory to the machine-level Path of the Windows VM, unless it is
+// already present. It returns true if the Path was changed, in which case the processes and services that need the new
+// Path have to be restarted.
+func AppendToPath(vm WindowsVM, dir string) (bool, error) {
+	return vm.handle().appendToPath(dir)
+}
+
+// appendToPath implements AppendToPath
+func (w *windowsVM) appendToPath(dir string) (bool, error) {
+	path, err := w.getEnv(pathEnvVar)
+	if err != nil {
+		return false, err
+	}
+	newPath, changed := appendToPath(path, dir)
+	if !changed {
+		return false, nil
+	}
+	return w.setEnv(pathEnvVar, newPath)
+}
+
+// appendToPath returns the given Path with the directory appended, and true if it was not already present. Directories
+// are compared case-insensitively and without trailing backslashes, as Windows does.
+func appendToPath(path, dir string) (string, bool) {
+	normalize := func(entry string) string {
+		return strings.ToLower(strings.TrimRight(strings.TrimSpace(entry), "\\"))
+	}
+	for _, entry := range strings.Split(path, ";") {
+		if normalize(entry) == normalize(dir) {
+			return path, false
+		}
+	}
+	path = strings.TrimRight(path, ";")
+	if path == "" {
+		return dir, true
+	}
+	return path + ";" + dir, true
+}
+
+// validateEnvArgs returns an error if the name of the given environment variable, followed by its value, is empty
+func validateEnvArgs(args ...string) error {
+	if args[0] == "" {
+		return fmt.Errorf("environment variable name cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAppendToPath tests that directories are appended to the Path only if they are not already present
+func TestAppendToPath(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		dir             string
+		expectedPath    string
+		expectedChanged bool
+	}{
+		{"empty path", "", "C:\\k", "C:\\k", true},
+		{"new directory", "C:\\Windows;C:\\Windows\\system32", "C:\\k",
+			"C:\\Windows;C:\\Windows\\system32;C:\\k", true},
+		{"trailing separator", "C:\\Windows;", "C:\\k", "C:\\Windows;C:\\k", true},
+		{"existing directory", "C:\\Windows;C:\\k", "C:\\k", "C:\\Windows;C:\\k", false},
+		{"existing directory with different case", "C:\\Windows;c:\\K", "C:\\k", "C:\\Windows;c:\\K", false},
+		{"existing directory with trailing backslash", "C:\\k\\;C:\\Windows", "C:\\k", "C:\\k\\;C:\\Windows", false},
+		{"prefix of existing directory", "C:\\k\\cni", "C:\\k", "C:\\k\\cni;C:\\k", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, changed := appendToPath(tt.path, tt.dir)
+			assert.Equal(t, tt.expectedPath, path)
+			assert.Equal(t, tt.expectedChanged, changed)
+		})
+	}
+}
+
+// TestValidateEnvArgs tests that only empty environment variable names are refused
+func TestValidateEnvArgs(t *testing.T) {
+	assert.NoError(t, validateEnvArgs("KUBECONFIG", "\"C:\\k\""), "double quotes are passed as is")
+	assert.Error(t, validateEnvArgs(""), "empty names should be refused")
+	assert.NoError(t, validateEnvArgs("KUBECONFIG", ""))
+}
@@ -0,0 +1,183 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// flakeReportFile is the file of ARTIFACT_DIR the flakiness report of the run is written to
+	flakeReportFile = "flakes.json"
+	// maxFlakeErrors is the number of distinct errors kept for each operation, so that a failure looping on the same
+	// operation does not grow the report
+	maxFlakeErrors = 5
+)
+
+// FlakeStats are the attempts of a remote operation that can be retried, over all its calls during the run. A call
+// that needed more than one attempt is flaky, and one that failed after all its attempts is failed.
+type FlakeStats struct {
+	// Operation is the name of the operation, e.g. ssh session
+	Operation string `json:"operation"`
+	// Calls is the number of times the operation was run
+	Calls int `json:"calls"`
+	// Retried is the number of calls that needed more than one attempt, whether they eventually succeeded or not
+	Retried int `json:"retried"`
+	// Flaky is the number of calls that succeeded only after being retried
+	Flaky int `json:"flaky"`
+	// Failed is the number of calls that failed after all their attempts
+	Failed int `json:"failed"`
+	// Attempts is the number of attempts of all the calls
+	Attempts int `json:"attempts"`
+	// MaxAttempts is the largest number of attempts of a call
+	MaxAttempts int `json:"maxAttempts"`
+	// FlakeRate is the share of the calls that succeeded only after being retried
+	FlakeRate float64 `json:"flakeRate"`
+	// Hosts are the Windows VMs the operation was retried on
+	Hosts []string `json:"hosts,omitempty"`
+	// Errors are the distinct errors of the failed attempts, at most maxFlakeErrors
+	Errors []string `json:"errors,omitempty"`
+}
+
+// FlakeReport is the flakiness report of the run, listing the remote operations that were retried, most flaky first
+type FlakeReport struct {
+	// Context is the context of the run
+	Context RunContext `json:"context"`
+	// Operations are the statistics of the operations retried at least once, or failed
+	Operations []FlakeStats `json:"operations"`
+}
+
+// flakeRecorder accumulates the attempts of the remote operations of the run
+type flakeRecorder struct {
+	// lock guards stats, as the operations run concurrently on the VMs
+	lock sync.Mutex
+	// stats are the statistics of each operation by name
+	stats map[string]*FlakeStats
+}
+
+// flakes records the attempts of the remote operations of the test suite
+var flakes = newFlakeRecorder()
+
+// newFlakeRecorder returns an empty flakeRecorder
+func newFlakeRecorder() *flakeRecorder {
+	return &flakeRecorder{stats: make(map[string]*FlakeStats)}
+}
+
+// record records a call of the given operation on the given host that took the given number of attempts and ended
+// with the given error, nil if it succeeded. The errors of the attempts that were retried are given by attemptErrs.
+func (r *flakeRecorder) record(operation, host string, attempts int, err error, attemptErrs []error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stats, found := r.stats[operation]
+	if !found {
+		stats = &FlakeStats{Operation: operation}
+		r.stats[operation] = stats
+	}
+	stats.Calls++
+	stats.Attempts += attempts
+	if attempts > stats.MaxAttempts {
+		stats.MaxAttempts = attempts
+	}
+	if attempts > 1 {
+		stats.Retried++
+		if err == nil {
+			stats.Flaky++
+		}
+	}
+	if err != nil {
+		stats.Failed++
+		attemptErrs = append(attemptErrs, err)
+	}
+	if (attempts > 1 || err != nil) && host != "" && !containsString(stats.Hosts, host) {
+		stats.Hosts = append(stats.Hosts, host)
+	}
+	for _, attemptErr := range attemptErrs {
+		if attemptErr != nil && len(stats.Errors) < maxFlakeErrors && !containsString(stats.Errors, attemptErr.Error()) {
+			stats.Errors = append(stats.Errors, attemptErr.Error())
+		}
+	}
+}
+
+// report returns the flakiness report of the operations recorded so far
+func (r *flakeRecorder) report() *FlakeReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := &FlakeReport{Operations: []FlakeStats{}}
+	for _, stats := range r.stats {
+		if stats.Retried == 0 && stats.Failed == 0 {
+			continue
+		}
+		entry := *stats
+		entry.FlakeRate = float64(entry.Flaky) / float64(entry.Calls)
+		sort.Strings(entry.Hosts)
+		report.Operations = append(report.Operations, entry)
+	}
+	sort.Slice(report.Operations, func(i, j int) bool {
+		a, b := report.Operations[i], report.Operations[j]
+		if a.FlakeRate != b.FlakeRate {
+			return a.FlakeRate > b.FlakeRate
+		}
+		if a.Failed != b.Failed {
+			return a.Failed > b.Failed
+		}
+		return a.Operation < b.Operation
+	})
+	return report
+}
+
+// containsString returns true if the given value is in the given values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordAttempts records a call of a remote operation on the given host, the IP address of the Windows VM, that took
+// the given number of attempts and ended with the given error, nil if it succeeded. It is used by the operations that
+// retry in their own way; the others are run with Retry. The calls are reported in flakes.json in ARTIFACT_DIR once
+// the tests are done, to find the operations that need hardening.
+func RecordAttempts(operation, host string, attempts int, err error) {
+	flakes.record(operation, host, attempts, err, nil)
+}
+
+// Retry runs the given remote operation on the given host until it succeeds or was attempted the given number of
+// times, waiting for the given interval between the attempts, and records its attempts like RecordAttempts. It
+// returns the error of the last attempt.
+func Retry(operation, host string, attempts int, interval time.Duration, fn func() error) error {
+	var attemptErrs []error
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts {
+			flakes.record(operation, host, attempt, err, attemptErrs)
+			return err
+		}
+		attemptErrs = append(attemptErrs, err)
+		clk.Sleep(interval)
+	}
+}
+
+// writeFlakeReport writes the flakiness report of the run to flakes.json in ARTIFACT_DIR
+func writeFlakeReport() {
+	report := flakes.report()
+	report.Context = CurrentRunContext()
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("error marshalling the flakiness report: %v", err)
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(artifactDir, flakeReportFile), contents, 0644); err != nil {
+		log.Printf("unable to write the flakiness report: %v", err)
+		return
+	}
+	for _, stats := range report.Operations {
+		log.Printf("%s retried in %d of %d calls, up to %d attempts, failed %d times", stats.Operation,
+			stats.Retried, stats.Calls, stats.MaxAttempts, stats.Failed)
+	}
+}
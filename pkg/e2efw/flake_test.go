@@ -0,0 +1,57 @@
+package e2efw
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFlakeReport tests that only the retried or failed operations are reported, most flaky first
+func TestFlakeReport(t *testing.T) {
+	recorder := newFlakeRecorder()
+	recorder.record("copy file", "10.0.0.1", 1, nil, nil)
+	recorder.record("copy file", "10.0.0.2", 1, nil, nil)
+	recorder.record("ssh session", "10.0.0.2", 2, nil, []error{fmt.Errorf("EOF")})
+	recorder.record("ssh session", "10.0.0.1", 1, nil, nil)
+	recorder.record("wait for ready", "10.0.0.1", 3, fmt.Errorf("timeout"),
+		[]error{fmt.Errorf("refused"), fmt.Errorf("refused")})
+	recorder.record("wait for ready", "10.0.0.2", 1, nil, nil)
+	recorder.record("wait for ready", "10.0.0.3", 1, nil, nil)
+
+	report := recorder.report()
+	require.Len(t, report.Operations, 2, "operations never retried are not reported")
+	assert.Equal(t, FlakeStats{Operation: "ssh session", Calls: 2, Retried: 1, Flaky: 1, Attempts: 3, MaxAttempts: 2,
+		FlakeRate: 0.5, Hosts: []string{"10.0.0.2"}, Errors: []string{"EOF"}}, report.Operations[0])
+	assert.Equal(t, FlakeStats{Operation: "wait for ready", Calls: 3, Retried: 1, Failed: 1, Attempts: 5,
+		MaxAttempts: 3, Hosts: []string{"10.0.0.1"}, Errors: []string{"refused", "timeout"}}, report.Operations[1])
+}
+
+// TestRetry tests that the attempts are stopped by a success or once exhausted, and recorded
+func TestRetry(t *testing.T) {
+	defer func(recorder *flakeRecorder) { flakes = recorder }(flakes)
+	flakes = newFlakeRecorder()
+
+	calls := 0
+	err := Retry("run", "10.0.0.1", 5, 0, func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("attempt %d failed", calls)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	err = Retry("run", "10.0.0.1", 2, 0, func() error { return fmt.Errorf("unreachable") })
+	assert.EqualError(t, err, "unreachable")
+
+	stats := flakes.report().Operations
+	require.Len(t, stats, 1)
+	assert.Equal(t, 2, stats[0].Calls)
+	assert.Equal(t, 1, stats[0].Flaky)
+	assert.Equal(t, 1, stats[0].Failed)
+	assert.Equal(t, 5, stats[0].Attempts)
+	assert.Equal(t, []string{"attempt 1 failed", "attempt 2 failed", "unreachable"}, stats[0].Errors)
+}
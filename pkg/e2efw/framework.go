@@ -0,0 +1,906 @@
+// Package e2efw is the end to end test framework of the Windows nodes of OpenShift clusters. It creates the Windows VMs
+// of a test suite on the cloud provider of the cluster, or takes over given ones, gives the suites handles running
+// commands and transferring files on them, collects their diagnostics and reports, and tears them down. Its exported
+// API is versioned semantically, the module being released with pkg/e2efw/vX.Y.Z tags.
+package e2efw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	operatorv1 "github.com/openshift/client-go/operator/clientset/versioned/typed/operator/v1"
+	operatorv1alpha1 "github.com/openshift/client-go/operator/clientset/versioned/typed/operator/v1alpha1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// RetryCount is the amount of times we will retry an api operation
+	RetryCount = 20
+	// RetryInterval is the interval of time until we retry after a failure
+	RetryInterval = 5 * time.Second
+	// WindowsLabel represents the node label that need to be applied to the Windows node created
+	WindowsLabel = "node.openshift.io/os_id=Windows"
+	// HybridOverlaySubnet is an annotation applied by the cluster network operator which is used by the hybrid overlay
+	HybridOverlaySubnet = "k8s.ovn.org/hybrid-overlay-node-subnet"
+	// HybridOverlayGatewayMAC is an annotation applied by the cluster network operator and used by the hybrid overlay
+	HybridOverlayGatewayMAC = "k8s.ovn.org/hybrid-overlay-distributed-router-gateway-mac"
+
+	// awsUsername is the default windows username on AWS
+	awsUsername = "Administrator"
+	// remoteLogPath is the directory where all the log files related to components that we need are generated on the
+	// Windows VM
+	remoteLogPath = "C:\\k\\log\\"
+	// remoteDumpPath is the directory where crash dumps of the node components are written on the Windows VM, when
+	// crash dump collection has been configured by WMCB
+	remoteDumpPath = "C:\\k\\dumps\\"
+)
+
+var (
+	// kubeconfig is the location of the kubeconfig for the cluster the test suite will run on
+	kubeconfig string
+	// awsCredentials is the Credentials file for the aws account the cluster will be created with
+	awsCredentials string
+	// artifactDir is the directory CI will read from once the test suite has finished execution
+	artifactDir string
+	// networkShape is the shape of the simulated degraded link to the VMs, nil if the links are not altered
+	networkShape *NetworkShape
+	// clusterAddress is the address of the OpenShift cluster e.g. "foo.fah.com".
+	// This should not include "https://api-" or a port
+	ClusterAddress string
+)
+
+// TestFramework holds the info to run the test suite.
+type TestFramework struct {
+	// WinVms contains the Windows VMs that are created to execute the test suite
+	WinVMs []WindowsVM
+	// k8sclientset is the kubernetes clientset we will use to query the cluster's status
+	K8sclientset *kubernetes.Clientset
+	// OSConfigClient is the OpenShift config client, we will use to query the OpenShift api object status
+	OSConfigClient *configclient.Clientset
+	// OSOperatorClient is the OpenShift operator client, we will use to interact with OpenShift operator objects
+	OSOperatorClient *operatorv1.OperatorV1Client
+	// OSOperatorV1alpha1Client is the OpenShift operator v1alpha1 client, we will use to read the
+	// ImageContentSourcePolicies
+	OSOperatorV1alpha1Client *operatorv1alpha1.OperatorV1alpha1Client
+	// DynamicClient is the dynamic client, we will use to interact with the custom resources without a typed client,
+	// like the OVN-Kubernetes EgressFirewalls and EgressIPs
+	DynamicClient dynamic.Interface
+	// noTeardown is an indicator that the user supplied the VMs and they should not be destroyed
+	noTeardown bool
+	// ClusterVersion is the major.minor.patch version of the OpenShift cluster
+	ClusterVersion string
+	// WMCBPayload is the source of the artifacts of the latest WMCB release for the cluster version, like the hybrid
+	// overlay, or the source overriding it
+	WMCBPayload PayloadSource
+	// payloadOverride is the payload source overriding the sources of all the artifacts, if any
+	payloadOverride PayloadSource
+	// Images are the Windows images the VMs are created from. The test suite is run against each of them. If empty,
+	// Setup uses the latest Windows image.
+	Images Images
+	// perVMResourceTracker indicates that each Windows VM tracks its cloud resources separately and has to be
+	// destroyed individually
+	perVMResourceTracker bool
+	// Progress receives the progress events of Setup as JSON lines, in addition to the progress.jsonl file in the
+	// artifact directory. It can be nil.
+	Progress io.Writer
+	// Topology is the topology of the control plane of the cluster
+	Topology Topology
+	// MachineAPIAvailable is true if the cluster serves the machine API. Hosted clusters do not, so the tests using
+	// Machines or MachineSets have to be skipped when it is false.
+	MachineAPIAvailable bool
+	// hosted is the hosted cluster the test suite runs against, nil for a self-managed cluster
+	hosted *hostedCluster
+	// Inputs are the required inputs given by flags, overriding their environment variable
+	Inputs Inputs
+	// ArtifactSinks are where the artifact directory is stored at the end of the run, in addition to the local
+	// directory. If empty, Setup reads them from E2E_ARTIFACT_SINKS.
+	ArtifactSinks ArtifactSinks
+	// vmLeases are the leases of the Windows VMs given by their credentials or inventory held by the run
+	vmLeases []*VMLease
+	// leaseClient is the client of the cluster the leases are held in
+	leaseClient kubernetes.Interface
+	// Notifiers are notified of the outcome of the creation of the Windows VMs, of their bootstrap and of their
+	// teardown. If empty, Setup reads them from E2E_NOTIFY.
+	Notifiers Notifiers
+	// SSHKeys are the key pairs the Windows VMs are created with in turn, whose private keys retrieve the password of
+	// the VMs. If empty, Setup reads them from E2E_SSH_KEYS, or else E2E_SSH_KEY and KUBE_SSH_KEY_PATH, and generates
+	// a key pair for the run if none is given.
+	SSHKeys SSHKeys
+}
+
+// Creds is used for parsing the vmCreds command line argument
+type Creds []*types.Credentials
+
+// Set populates the list of credentials from the vmCreds command line argument
+func (c *Creds) Set(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	splitValue := strings.Split(value, ",")
+	// Credentials consists of three elements, so this has to be
+	if len(splitValue)%3 != 0 {
+		return fmt.Errorf("incomplete VM credentials provided")
+	}
+
+	// TODO: Add input validation if we want to use this in production
+	// TODO: Change username based on cloud provider if this is to be used for clouds other than AWS
+	for i := 0; i < len(splitValue); i += 3 {
+		cred := types.NewCredentials(splitValue[i], splitValue[i+1], splitValue[i+2], awsUsername)
+		*c = append(*c, cred)
+	}
+	return nil
+}
+
+// String returns the string representation of Creds. This is required for Creds to be used with flags.
+func (c *Creds) String() string {
+	return fmt.Sprintf("%v", *c)
+}
+
+// WindowsImage is a Windows Server image that the test suite is run against
+type WindowsImage struct {
+	// Version is the Windows Server version of the image, e.g. 2019 or 20H2. It is used to tag the test results and
+	// artifacts of the VMs created from the image.
+	Version string
+	// ImageID is the cloud image ID, e.g. an AMI. If empty, WNI uses the latest Windows image.
+	ImageID string
+}
+
+// String returns the version and image ID of the image
+func (i WindowsImage) String() string {
+	if i.ImageID == "" {
+		return "latest"
+	}
+	return i.Version + "=" + i.ImageID
+}
+
+// Images is used for parsing the images command line argument
+type Images []WindowsImage
+
+// Set populates the list of images from the images command line argument, a comma separated list of
+// <version>=<image ID> pairs, e.g. 2019=ami-0123,20H2=ami-4567. If the version is omitted, the image ID is used as the
+// version.
+func (i *Images) Set(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	versions := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		image := WindowsImage{}
+		if kv := strings.SplitN(entry, "=", 2); len(kv) == 2 {
+			image.Version, image.ImageID = kv[0], kv[1]
+		} else {
+			image.Version, image.ImageID = entry, entry
+		}
+		if image.Version == "" || image.ImageID == "" {
+			return fmt.Errorf("invalid image %s, expected <version>=<image ID>", entry)
+		}
+		// The version is used in artifact paths and test names, so it has to be unique
+		if versions[image.Version] {
+			return fmt.Errorf("duplicate image version %s", image.Version)
+		}
+		versions[image.Version] = true
+		*i = append(*i, image)
+	}
+	return nil
+}
+
+// String returns the string representation of Images. This is required for Images to be used with flags.
+func (i *Images) String() string {
+	return fmt.Sprintf("%v", *i)
+}
+
+// initCIvars gathers the values of the given inputs, taken from their environment variable when not given, and of
+// the environment variables which configure the test suite
+func initCIvars(given Inputs) error {
+	path, err := inventoryFromEnv()
+	if err != nil {
+		return err
+	}
+	inventoryPath = path
+	// The hosts of an inventory are reached directly, without the cloud provider, and the address of a hosted cluster
+	// defaults to the one of its API server endpoint
+	inputs := given.withEnv()
+	if err = inputs.validate(inventoryPath != "", os.Getenv(hostedClusterEnvVar) != ""); err != nil {
+		return err
+	}
+	if kubeconfig, err = prepareKubeconfig(inputs.Kubeconfig); err != nil {
+		return err
+	}
+	awsCredentials = inputs.AWSCredentials
+	artifactDir = inputs.ArtifactDir
+	ClusterAddress = strings.TrimSpace(inputs.ClusterAddress)
+	var runIDGiven bool
+	if runID, runIDGiven, err = runIDFromEnv(); err != nil {
+		return err
+	}
+	// The runs given an ID may share the artifact directory, each one writes to its own directory in it
+	if runIDGiven && artifactDir != "" {
+		artifactDir = filepath.Join(artifactDir, "run-"+runID)
+		if err = os.MkdirAll(artifactDir, os.ModePerm); err != nil {
+			return fmt.Errorf("unable to create the artifact directory of run %s: %v", runID, err)
+		}
+	}
+	updateRunContext(func(c *RunContext) { c.RunID = runID })
+	log.Printf("run ID %s, the cluster objects of the run are labeled %s=%s", runID, RunIDLabel, runID)
+	if spec := os.Getenv(networkShapeEnvVar); spec != "" {
+		shape, err := ParseNetworkShape(spec)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", networkShapeEnvVar, err)
+		}
+		log.Printf("simulating a degraded network to the Windows VMs: %v", shape)
+		networkShape = shape
+	}
+	if vmWinRMOptions, err = winRMOptionsFromEnv(); err != nil {
+		return err
+	}
+	policy, err := windowsUpdatePolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	windowsUpdatePolicy = policy
+	if ContainerRuntime, err = containerRuntimeFromEnv(); err != nil {
+		return err
+	}
+	if sshCertAuthority, err = sshCAFromEnv(); err != nil {
+		return err
+	}
+	if slowCommandThreshold, err = slowCommandThresholdFromEnv(); err != nil {
+		return err
+	}
+	if transferStaging, err = transferBackendFromEnv(); err != nil {
+		return err
+	}
+	if timeToReadySLO, err = timeToReadySLOFromEnv(); err != nil {
+		return err
+	}
+	if commandPolicy, err = commandPolicyFromEnv(); err != nil {
+		return err
+	}
+	if winRMHardening, err = winRMHardeningFromEnv(); err != nil {
+		return err
+	}
+	if outputSpillThreshold, err = outputSpillThresholdFromEnv(); err != nil {
+		return err
+	}
+	if remoteConcurrency, err = remoteConcurrencyFromEnv(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Setup creates and initializes a variable amount of Windows VMs for each of the Images. If the array of credentials are
+// passed then it will be used in lieu of creating new VMs. If skipVMsetup is true then it will result in the VM setup
+// not being run. These two options are mainly used during test development. If E2E_INVENTORY is set, the hosts of the
+// inventory file are used in lieu of creating new VMs, without involving the cloud provider.
+func (f *TestFramework) Setup(vmCount int, credentials []*types.Credentials, skipVMsetup bool) (err error) {
+	if len(f.Images) == 0 {
+		// An empty imageID results in WNI using the latest Windows image
+		f.Images = Images{{}}
+	}
+	if credentials != nil {
+		if len(credentials) != vmCount*len(f.Images) {
+			return fmt.Errorf("vmCount %d for %d images does not match length %d of credentials", vmCount,
+				len(f.Images), len(credentials))
+		}
+		f.noTeardown = true
+	}
+	// Using an AMD instance type, as the Windows hybrid overlay currently does not work on on machines using
+	// the Intel 82599 network driver
+	instanceType := "m5a.large"
+	if err := initCIvars(f.Inputs); err != nil {
+		return fmt.Errorf("unable to initialize CI variables: %v", err)
+	}
+	// The Windows build is part of the context of the whole run only if all its VMs share it
+	if len(f.Images) == 1 && f.Images[0].Version != "" {
+		updateRunContext(func(c *RunContext) { c.WindowsBuild = f.Images[0].Version })
+	}
+	if len(f.ArtifactSinks) == 0 {
+		if f.ArtifactSinks, err = artifactSinksFromEnv(); err != nil {
+			return err
+		}
+	}
+	if len(f.Notifiers) == 0 {
+		if f.Notifiers, err = notifiersFromEnv(); err != nil {
+			return err
+		}
+	}
+	setupNotifiers(f.Notifiers, f.ArtifactSinks)
+	var existing []WindowsVM
+	if inventoryPath != "" {
+		if credentials != nil {
+			return fmt.Errorf("credentials cannot be given along with %s", inventoryEnvVar)
+		}
+		if existing, err = newWindowsVMFromInventory(inventoryPath); err != nil {
+			return err
+		}
+		if len(existing) != vmCount*len(f.Images) {
+			return fmt.Errorf("vmCount %d for %d images does not match the %d hosts of inventory %s", vmCount,
+				len(f.Images), len(existing), inventoryPath)
+		}
+		f.noTeardown = true
+	}
+	// The VMs given by their credentials or inventory may be shared with other runs, which must not configure them at
+	// the same time
+	var reusedHosts []string
+	for _, creds := range credentials {
+		reusedHosts = append(reusedHosts, creds.GetIPAddress())
+	}
+	for _, vm := range existing {
+		reusedHosts = append(reusedHosts, vm.GetCredentials().GetIPAddress())
+	}
+	if len(reusedHosts) > 0 {
+		if err := f.leaseVMs(reusedHosts); err != nil {
+			return err
+		}
+	}
+	if err := f.setupTopology(); err != nil {
+		return fmt.Errorf("unable to set up the hosted cluster: %v", err)
+	}
+	if err := setupBudget(); err != nil {
+		return fmt.Errorf("unable to set up the timeout budget: %v", err)
+	}
+	// Tracing and progress reporting are nice to have, the suite runs without them
+	if err := setupTracing(filepath.Base(os.Args[0])); err != nil {
+		log.Printf("unable to set up tracing: %v", err)
+	}
+	if err := setupProgress(f.Progress); err != nil {
+		log.Printf("unable to set up progress reporting: %v", err)
+	}
+	// Each VM is a phase, and so is connecting to the cluster
+	progress := startProgress("Setup", vmCount*len(f.Images)+1)
+	defer func() { progress.end(err) }()
+
+	create := credentials == nil && existing == nil
+	if create && Timeout(CreatePhase, time.Minute) < time.Minute {
+		return fmt.Errorf("not enough time left before the job deadline to create the Windows VMs")
+	}
+	// Fail before spending the budget on VMs that cannot all be created
+	if create {
+		if err := checkQuotas(vmCount*len(f.Images), instanceType); err != nil {
+			return err
+		}
+		keys, err := setupKeyPairs(f.SSHKeys)
+		if err != nil {
+			return fmt.Errorf("unable to set up the key pairs of the Windows VMs: %v", err)
+		}
+		f.SSHKeys = keys
+	}
+	vmErr := Phase("create Windows VMs", func() error {
+		return f.createWindowsVMs(vmCount, instanceType, credentials, existing, skipVMsetup, progress)
+	})
+	if create {
+		notify(NotifyVMCreation, vmErr, "created and set up %d Windows VMs", vmCount*len(f.Images))
+	} else {
+		notify(NotifyVMCreation, vmErr, "set up the %d given Windows VMs", vmCount*len(f.Images))
+	}
+	if vmErr != nil {
+		return vmErr
+	}
+	return progress.phase("connect to the cluster", f.connect)
+}
+
+// connect creates the clients of the cluster and gets the versions the test suites depend on
+func (f *TestFramework) connect() error {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to build config from kubeconfig: %s", err)
+	}
+	if err := f.getKubeClient(config); err != nil {
+		return fmt.Errorf("unable to get kube client: %v", err)
+	}
+	if err := f.getOpenShiftConfigClient(config); err != nil {
+		return fmt.Errorf("unable to get OpenShift client: %v", err)
+	}
+	if err := f.getOpenShiftOperatorClient(config); err != nil {
+		return fmt.Errorf("unable to get OpenShift operator client: %v", err)
+	}
+	if err := f.getOpenShiftOperatorV1alpha1Client(config); err != nil {
+		return fmt.Errorf("unable to get OpenShift operator v1alpha1 client: %v", err)
+	}
+	if err := f.getDynamicClient(config); err != nil {
+		return fmt.Errorf("unable to get dynamic client: %v", err)
+	}
+	if err := f.getClusterVersion(); err != nil {
+		return fmt.Errorf("unable to get OpenShift cluster version, authenticating with %s: %v", authMethod(config),
+			err)
+	}
+	machineAPIAvailable, err := hasMachineAPI(f.K8sclientset.Discovery())
+	if err != nil {
+		return fmt.Errorf("unable to discover the machine API: %v", err)
+	}
+	f.MachineAPIAvailable = machineAPIAvailable
+	f.setClusterRunContext()
+	if spec := os.Getenv(payloadSourceEnvVar); spec != "" {
+		source, err := payload.ParseSource(spec)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", payloadSourceEnvVar, err)
+		}
+		f.payloadOverride = source
+	}
+	f.WMCBPayload = f.PayloadSource(newWMCBReleaseSource(f.ClusterVersion))
+	return nil
+}
+
+// createWindowsVMs creates and sets up vmCount Windows VMs for each of the Images in parallel. When more than one VM is
+// created, each VM tracks its cloud resources in its own directory under the artifact directory, as the WNI resource
+// tracker file cannot be updated concurrently. The creation of each VM is reported as a phase of the given operation.
+// The existing VMs, if given, are set up in lieu of creating new ones.
+func (f *TestFramework) createWindowsVMs(vmCount int, instanceType string, credentials []*types.Credentials,
+	existing []WindowsVM, skipVMsetup bool, progress *progressOperation) error {
+	total := vmCount * len(f.Images)
+	f.WinVMs = make([]WindowsVM, total)
+	f.perVMResourceTracker = total > 1
+	errs := make([]error, total)
+
+	var wg sync.WaitGroup
+	for i := 0; i < total; i++ {
+		var creds *types.Credentials
+		if credentials != nil {
+			creds = credentials[i]
+		}
+		resourceTrackerDir := artifactDir
+		if f.perVMResourceTracker {
+			resourceTrackerDir = filepath.Join(artifactDir, "vms", strconv.Itoa(i))
+		}
+		wg.Add(1)
+		go func(i int, image WindowsImage, key *SSHKey, creds *types.Credentials, resourceTrackerDir string) {
+			defer wg.Done()
+			_, span := startSpan(suiteCtx, "create Windows VM", attribute.Int("vm", i),
+				attribute.String("image", image.String()))
+			errs[i] = progress.phase(fmt.Sprintf("create Windows VM %d", i), func() error {
+				var err error
+				if existing != nil {
+					f.WinVMs[i] = existing[i]
+				} else {
+					f.WinVMs[i], err = newWindowsVM(image, instanceType, key, creds, skipVMsetup,
+						resourceTrackerDir)
+				}
+				if err != nil || skipVMsetup {
+					return err
+				}
+				// Only the created VMs are frozen, the VMs given by their credentials or inventory are left as they are
+				if creds == nil && existing == nil {
+					if err = ConfigureWindowsUpdate(f.WinVMs[i], windowsUpdatePolicy); err != nil {
+						return fmt.Errorf("unable to configure Windows Update: %v", err)
+					}
+				}
+				if err = SetupContainerRuntime(f.WinVMs[i]); err != nil {
+					return fmt.Errorf("unable to set up the %s container runtime: %v", ContainerRuntime, err)
+				}
+				// The VMs given by their credentials or inventory are reused across runs, so what the previous runs left is
+				// removed. Their images are kept, as they spare the tests from pulling them again.
+				if creds != nil || existing != nil {
+					if _, err = ResetNode(f.WinVMs[i], true); err != nil {
+						return err
+					}
+				}
+				// Preloading the images spares the tests from pulling them from the registries
+				if bundle := os.Getenv(imageBundleEnvVar); bundle != "" {
+					if err = LoadImages(f.WinVMs[i], bundle); err != nil {
+						return fmt.Errorf("unable to load image bundle %s: %v", bundle, err)
+					}
+				}
+				return nil
+			})
+			tracing.End(span, errs[i])
+		}(i, f.Images[i/vmCount], f.SSHKeys.forVM(i), creds, resourceTrackerDir)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("unable to instantiate Windows VM %d for image %s: %v", i, f.Images[i/vmCount], err)
+		}
+	}
+	return nil
+}
+
+// getKubeClient setups the kubeclient that can be used across all the test suites.
+func (f *TestFramework) getKubeClient(config *restclient.Config) error {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create k8s clientset: %v", err)
+	}
+	f.K8sclientset = clientset
+	return nil
+}
+
+// getOpenShiftConfigClient gets the new OpenShift config v1 client
+func (f *TestFramework) getOpenShiftConfigClient(config *restclient.Config) error {
+	// Get openshift api config client.
+	configClient, err := configclient.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create config clientset: %v", err)
+	}
+	f.OSConfigClient = configClient
+	return nil
+}
+
+// getOpenShiftConfigClient gets a new OpenShift operator v1 client
+func (f *TestFramework) getOpenShiftOperatorClient(config *restclient.Config) error {
+	// Get openshift operator client
+	operatorClient, err := operatorv1.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create operator clientset: %v", err)
+	}
+	f.OSOperatorClient = operatorClient
+	return nil
+}
+
+// getClusterVersion gets the OpenShift cluster version in major.minor format. This is being done this way, and not with
+// oc get clusterversion, as OpenShift CI doesn't have the actual version attached to its clusters, instead replacing it
+// with 0.0.1 and information about the release creation date
+func (f *TestFramework) getClusterVersion() error {
+	versionInfo, err := f.OSConfigClient.Discovery().ServerVersion()
+	if err != nil {
+		return err
+	}
+
+	// Convert kubernetes version to major.minor format. v1.17.0 -> 1.17
+	k8sVersion := strings.TrimLeft(versionInfo.GitVersion, "v")
+	k8sSemver := strings.Split(k8sVersion, ".")
+	k8sMinorVersion, err := strconv.Atoi(k8sSemver[1])
+	if err != nil {
+		return fmt.Errorf("could not conver k8s minor version %s to int", err)
+	}
+
+	// Map kubernetes version to OpenShift version
+	openshiftVersion, err := k8sVersionToOpenShiftVersion(k8sMinorVersion)
+	if err != nil {
+		return fmt.Errorf("could not map kubernetes version to an OpenShift version: %s", err)
+	}
+
+	f.ClusterVersion = openshiftVersion
+	return nil
+}
+
+// GetNode returns a pointer to the node object associated with the external IP provided
+func (f *TestFramework) GetNode(externalIP string) (*v1.Node, error) {
+	var matchedNode *v1.Node
+
+	nodes, err := f.K8sclientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get list of nodes")
+	}
+	if len(nodes.Items) == 0 {
+		return nil, fmt.Errorf("no nodes found")
+	}
+
+	// Find the node that has the given IP
+	for _, node := range nodes.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type == "ExternalIP" && address.Address == externalIP {
+				matchedNode = &node
+				break
+			}
+		}
+		if matchedNode != nil {
+			break
+		}
+	}
+	if matchedNode == nil {
+		return nil, fmt.Errorf("could not find node with IP: %s", externalIP)
+	}
+	return matchedNode, nil
+}
+
+// WriteToArtifactDir will write contents to $ARTIFACT_DIR/subDirName/filename. If subDirName is empty, contents
+// will be written to $ARTIFACT_DIR/filename
+func (f *TestFramework) WriteToArtifactDir(contents []byte, subDirName, filename string) error {
+	path := filepath.Join(artifactDir, subDirName, filename)
+	dir, _ := filepath.Split(path)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %s", dir, err)
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+// GetNode uses external IP and finds out the name associated with the node
+func (f *TestFramework) GetNodeName(externalIP string) (string, error) {
+	node, err := f.GetNode(externalIP)
+	if err != nil {
+		return "", fmt.Errorf("error while getting required kubernetes node object: %v", err)
+	}
+	return node.Name, nil
+}
+
+// RetrieveArtifacts should retrieve artifacts related the test run. Ideally this should retrieve all the logs related
+// to the Windows VM. The retrieval is best effort as log collection is nice to have rather than a must have: every
+// artifact of every VM is attempted, and a *MultiError lists the ones which could not be retrieved, so that callers
+// decide whether the partial artifacts are acceptable.
+// TODO: Think about how we can retrieve stdout from ansible out within this function
+func (f *TestFramework) RetrieveArtifacts() (err error) {
+	_, span := startSpan(suiteCtx, "retrieve artifacts")
+	defer func() { tracing.End(span, err) }()
+	errs := NewMultiError("retrieve artifacts")
+	for i, vm := range f.WinVMs {
+		if vm == nil {
+			continue
+		}
+		if vm.GetCredentials() == nil {
+			errs.Appendf("no credentials provided for vm %d", i)
+			continue
+		}
+
+		instanceID := vm.GetCredentials().GetInstanceId()
+		if len(instanceID) == 0 {
+			errs.Appendf("no instance id provided for vm %d", i)
+			continue
+		}
+
+		externalIP := vm.GetCredentials().GetIPAddress()
+		if len(externalIP) == 0 {
+			errs.Appendf("no external ip address found for the vm with instance ID %s", instanceID)
+			continue
+		}
+		errs.Append(f.retrieveVMArtifacts(vm))
+	}
+	return errs.ErrorOrNil()
+}
+
+// retrieveVMArtifacts retrieves the artifacts of the given Windows VM, attempting all of them even when some fail
+func (f *TestFramework) retrieveVMArtifacts(vm WindowsVM) error {
+	instanceID := vm.GetCredentials().GetInstanceId()
+	errs := NewMultiError("retrieve artifacts of vm " + instanceID)
+	nodeName, err := f.GetNodeName(vm.GetCredentials().GetIPAddress())
+	if err != nil {
+		errs.Appendf("error while getting node name associated with the vm: %v", err)
+	}
+
+	// We want a format like "nodes/ip-10-0-141-99.ec2.internal/logs/wsu/kubelet", prefixed with the Windows version
+	// of the VM when the suite is run against multiple images
+	nodeArtifactDir := filepath.Join(artifactDir, vm.GetImage().Version, "nodes", nodeName)
+	recordNodeArtifactDir(vm.GetCredentials().GetIPAddress(), nodeName, nodeArtifactDir)
+	localKubeletLogPath := filepath.Join(nodeArtifactDir, "logs")
+
+	// Let's reinitialize the ssh client as hybrid overlay is known to cause ssh connections to be dropped
+	// TODO: Reduce the usage of Reinitialize as much as possible, this is to ensure that when we move to operator
+	// 		model, the reconnectivity should be handled automatically.
+	if err := vm.Reinitialize(); err != nil {
+		errs.Appendf("failed re-initializing ssh connectivity: %v", err)
+	}
+	// Get the VM's private ip and populate log files in the test container.
+	// Make this a map["'"artifact_that_we_want_to_pull"]="log_file.name"
+	if err := vm.RetrieveFiles(remoteLogPath, localKubeletLogPath); err != nil {
+		errs.Appendf("failed retrieving log files: %v", err)
+	}
+	if err := RetrieveCrashDumps(vm, filepath.Join(nodeArtifactDir, "dumps")); err != nil {
+		errs.Appendf("failed retrieving crash dumps: %v", err)
+	}
+	if err := writeHotfixes(vm, filepath.Join(nodeArtifactDir, hotfixesFile)); err != nil {
+		errs.Appendf("failed listing the hotfixes: %v", err)
+	}
+	if err := writeNetworkAdapters(vm, filepath.Join(nodeArtifactDir, networkAdaptersFile)); err != nil {
+		errs.Appendf("failed listing the network adapters: %v", err)
+	}
+	if err := writeContainerRuntimeEvents(vm, filepath.Join(nodeArtifactDir, containerRuntimeEventsFile)); err != nil {
+		errs.Appendf("failed retrieving the %s events: %v", ContainerRuntime, err)
+	}
+	return errs.ErrorOrNil()
+}
+
+// RetrieveCrashDumps retrieves the crash dumps written by the node components on the Windows VM to the local
+// directory. It is not an error if no dumps were written.
+func RetrieveCrashDumps(vm WindowsVM, localDir string) error {
+	// Test-Path returns True or False, it does not fail when the directory is missing
+	stdout, _, err := vm.Run(PowerShellScript("Test-Path "+PowerShellString(remoteDumpPath)), true)
+	if err != nil {
+		return fmt.Errorf("error checking for %s: %v", remoteDumpPath, err)
+	}
+	if strings.TrimSpace(stdout) != "True" {
+		return nil
+	}
+	return vm.RetrieveFiles(remoteDumpPath, localDir)
+}
+
+// writeHotfixes writes the list of the hotfixes installed on the Windows VM to the given local file, so that the
+// results of the tests can be related to the updates of the VM
+func writeHotfixes(vm WindowsVM, path string) error {
+	hotfixes, err := ListHotfixes(vm)
+	if err != nil {
+		return err
+	}
+	return writeJSONArtifact(hotfixes, path)
+}
+
+// writeNetworkAdapters writes the network adapters of the Windows VM to the given local file, so that networking
+// failures can be debugged from the addresses, MTU and DNS settings of the VM
+func writeNetworkAdapters(vm WindowsVM, path string) error {
+	adapters, err := NetworkAdapters(vm)
+	if err != nil {
+		return err
+	}
+	return writeJSONArtifact(adapters, path)
+}
+
+// writeJSONArtifact writes the given value as indented JSON to the given local file, creating its directory
+func writeJSONArtifact(v interface{}, path string) error {
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling %s: %v", filepath.Base(path), err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create %s: %v", filepath.Dir(path), err)
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+// ApplyHybridOverlayPatch will enable the hybrid overlay on the cluster
+func (f *TestFramework) ApplyHybridOverlayPatch() error {
+	jsonPatch := []byte(fmt.Sprintf(`{"spec":{"defaultNetwork":{"ovnKubernetesConfig":{"hybridOverlayConfig":`+
+		`{"hybridClusterNetwork":[{"cidr":"%s","hostPrefix":%d}]}}}}}`, HybridClusterNetwork, hybridHostPrefix))
+
+	_, err := f.OSOperatorClient.Networks().Patch("cluster", k8stypes.MergePatchType, jsonPatch)
+	if err != nil {
+		return fmt.Errorf("could not apply patch %s to cluster network: %s", string(jsonPatch), err)
+	}
+
+	// Wait until the hybrid overlay changes are complete
+	if err = f.waitUntilHybridOverlayReady(); err != nil {
+		return fmt.Errorf("error waiting for the hybrid overlay changes to be complete: %s", err)
+	}
+	return nil
+}
+
+// waitUntilHybridOverlayReady returns once OVN is ready again, after applying the hybrid overlay patch.
+func (f *TestFramework) waitUntilHybridOverlayReady() error {
+	if err := f.waitUntilNodesAnnotated(); err != nil {
+		return fmt.Errorf("error waiting for nodes to be annotated: %s", err)
+	}
+
+	// This is being done after we wait for the master nodes, as we need to make sure the patch is being acted on,
+	// and we are not checking the pods before they begin to restart with the hybrid overlay changes
+	if err := f.waitUntilOVNPodsReady(); err != nil {
+		return fmt.Errorf("error waiting for all pods in the OVN namespace to be ready: %s", err)
+	}
+
+	return nil
+}
+
+// waitUntilOVNPodsReady returns when either all pods in the openshift-ovn-kubernetes namespace are ready, or the
+// timeout limit has been reached.
+func (f *TestFramework) waitUntilOVNPodsReady() error {
+	options := PollOptions{Interval: RetryInterval, Timeout: RetryCount * RetryInterval, Jitter: DefaultPollJitter}
+	return Poll(context.Background(), "pods in namespace \"openshift-ovn-kubernetes\" to be ready", options,
+		func() (bool, string, error) {
+			pods, err := f.K8sclientset.CoreV1().Pods("openshift-ovn-kubernetes").List(metav1.ListOptions{})
+			if err != nil {
+				return false, "", fmt.Errorf("could not get pods: %s", err)
+			}
+			for _, pod := range pods.Items {
+				podReady := false
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodReady {
+						podReady = true
+						break
+					}
+				}
+				if !podReady {
+					return false, "pod " + pod.Name + " is not ready", nil
+				}
+			}
+			return true, "", nil
+		})
+}
+
+// waitUntilNodesAnnotated returns when either all nodes have had the proper annotations applied to them,
+// or reaches a timeout limit.
+func (f *TestFramework) waitUntilNodesAnnotated() error {
+	options := PollOptions{Interval: RetryInterval, Timeout: RetryCount * RetryInterval, Jitter: DefaultPollJitter}
+	return Poll(context.Background(), "nodes to be annotated with "+HybridOverlayGatewayMAC, options,
+		func() (bool, string, error) {
+			nodes, err := f.K8sclientset.CoreV1().Nodes().List(metav1.ListOptions{})
+			if err != nil {
+				return false, "", fmt.Errorf("could not retrieve list of nodes: %s", err)
+			}
+			for _, node := range nodes.Items {
+				for _, annotation := range []string{HybridOverlayGatewayMAC, HybridOverlaySubnet} {
+					if _, ok := node.Annotations[annotation]; !ok {
+						return false, "node " + node.Name + " is not annotated with " + annotation, nil
+					}
+				}
+			}
+			return true, "", nil
+		})
+}
+
+// TearDown destroys the resources created by the Setup function and flushes the spans of the test suite
+func (f *TestFramework) TearDown() {
+	// The artifacts are stored once all the reports are written, along with their manifest
+	defer f.storeArtifacts()
+	defer writeArtifactManifest()
+	// The HTML report summarizes the other reports, once the progress file is closed
+	defer writeHTMLReport()
+	defer endTracing()
+	defer closeProgress()
+	defer closeSessions()
+	// The retries of the teardown are part of the report
+	defer writeFlakeReport()
+	// The commands of the teardown are part of the timing report
+	defer writeCommandTimingReport()
+	defer writeNodeJoinReport()
+	// The VMs given by their credentials or inventory are released once the run is done with them
+	defer f.releaseVMLeases()
+	// The key pair is deleted once the VMs using it are destroyed
+	defer deleteKeyPair()
+	defer removePreparedKubeconfigs()
+	if f.hosted != nil {
+		defer f.hosted.cleanup()
+	}
+	// The VMs given by their credentials or inventory are kept, but not the objects the run left in the cluster
+	if f.K8sclientset != nil {
+		if err := deleteRunObjects(f.K8sclientset); err != nil {
+			log.Print(err)
+		}
+	}
+	if f.noTeardown || f.WinVMs == nil {
+		return
+	}
+
+	if remaining := remainingTime(); remaining >= 0 && remaining < defaultReserves[TeardownPhase] {
+		log.Printf("only %v left before the job deadline to tear down", remaining.Round(time.Second))
+	}
+	_, span := startSpan(suiteCtx, "tear down")
+	defer span.End()
+	// The VMs are described before they are destroyed
+	f.writeCostReport()
+	errs := NewMultiError("tear down the Windows VMs")
+	for _, vm := range f.WinVMs {
+		if vm == nil {
+			continue
+		}
+		err := vm.Destroy()
+		errs.Append(err)
+		if err == nil && !f.perVMResourceTracker {
+			// WNI will delete all the VMs in windows-node-installer.json so we need this to succeed only once
+			break
+		}
+	}
+	err := errs.ErrorOrNil()
+	notify(NotifyGC, err, "tore down the Windows VMs of the run")
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// k8sVersionToOpenShiftVersion converts a Kubernetes minor version to an OpenShift version in format
+// "major.minor". This function works under the assumption that for OpenShift 4, every OpenShift minor version increase
+// corresponds with a kubernetes minor version increase
+func k8sVersionToOpenShiftVersion(k8sMinorVersion int) (string, error) {
+	openshiftMajorVersion := "4"
+	baseKubernetesMinorVersion := 16
+	baseOpenShiftMinorVersion := 3
+
+	if k8sMinorVersion < baseKubernetesMinorVersion {
+		return "", fmt.Errorf("kubernetes minor version %d is not supported", k8sMinorVersion)
+	}
+
+	// find how many minor versions past OpenShift 4.3 we are
+	versionIncrements := k8sMinorVersion - baseKubernetesMinorVersion
+	openShiftMinorVersion := strconv.Itoa(versionIncrements + baseOpenShiftMinorVersion)
+	return openshiftMajorVersion + "." + openShiftMinorVersion, nil
+}
@@ -0,0 +1,126 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// winRMHardeningEnvVar is the environment variable holding how WinRM is hardened on the Windows VMs once they are
+	// bootstrapped, WinRMHardeningDisable or WinRMHardeningRestrict, WinRM being left as is if not set
+	winRMHardeningEnvVar = "E2E_WINRM_HARDENING"
+	// WinRMHardeningDisable stops and disables the WinRM service, which closes its listeners
+	WinRMHardeningDisable = "disable"
+	// WinRMHardeningRestrict restricts the Windows Firewall rules allowing WinRM to the CIDR of the VPC of the VM
+	WinRMHardeningRestrict = "restrict"
+	// winRMHTTPPort is the port of the unencrypted WinRM listener, restricted along with the one the tests use
+	winRMHTTPPort = 5985
+)
+
+// winRMHardening is how WinRM is hardened by HardenWinRM, empty if it is left as is
+var winRMHardening string
+
+// errWinRMHardened is the reason WinRM is unavailable once hardened, the commands being run over ssh
+var errWinRMHardened = fmt.Errorf("WinRM was hardened after the bootstrap, the commands are run over ssh only")
+
+// winRMHardeningFromEnv returns the WinRM hardening given by E2E_WINRM_HARDENING, empty if not set
+func winRMHardeningFromEnv() (string, error) {
+	mode := os.Getenv(winRMHardeningEnvVar)
+	switch mode {
+	case "", WinRMHardeningDisable, WinRMHardeningRestrict:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid %s %s, expected %s or %s", winRMHardeningEnvVar, mode, WinRMHardeningDisable,
+		WinRMHardeningRestrict)
+}
+
+// HardenWinRM disables WinRM on the Windows VM, or restricts it to the VPC, as given by E2E_WINRM_HARDENING, once the
+// VM can be reached over ssh with key authentication. The commands are then run over ssh only. Nothing is done if
+// E2E_WINRM_HARDENING is not set.
+func HardenWinRM(vm WindowsVM) error {
+	return vm.handle().hardenWinRM()
+}
+
+// hardenWinRM implements HardenWinRM
+func (w *windowsVM) hardenWinRM() error {
+	if winRMHardening == "" {
+		return nil
+	}
+	// WinRM is the way back in if ssh does not work with the key alone, e.g. once the password is rotated
+	if err := w.checkSSHKeyAuth(); err != nil {
+		return fmt.Errorf("not hardening WinRM on %s: %v", w.GetCredentials().GetIPAddress(), err)
+	}
+
+	script := disableWinRMScript()
+	if winRMHardening == WinRMHardeningRestrict {
+		groups, err := w.securityGroups()
+		if err == errSecurityGroupsUnsupported {
+			return fmt.Errorf("WinRM can only be restricted to the VPC on AWS")
+		}
+		if err != nil {
+			return fmt.Errorf("error getting the VPC of %s: %v", w.GetCredentials().GetIPAddress(), err)
+		}
+		script = restrictWinRMScript(groups.VPCCIDR, winRMHTTPPort, w.endpoint.winRMPort())
+	}
+	// Stopping WinRM over WinRM would cut the command short
+	if _, stderr, err := w.runOverSSHWithStderr(PowerShellScript(script), true); err != nil {
+		return fmt.Errorf("error hardening WinRM on %s: %v, %s", w.GetCredentials().GetIPAddress(), err, stderr)
+	}
+	w.transports.disable(winRMTransport, errWinRMHardened)
+	log.Printf("WinRM hardened on %s with mode %s, the commands are run over ssh only",
+		w.GetCredentials().GetIPAddress(), winRMHardening)
+	return nil
+}
+
+// checkSSHKeyAuth returns an error if the Windows VM cannot be reached over ssh with the user certificate or the
+// private key alone, without the password
+func (w *windowsVM) checkSSHKeyAuth() error {
+	auth := w.sshKeyAuth()
+	if len(auth) == 0 {
+		return fmt.Errorf("no ssh certificate nor private key to authenticate with")
+	}
+	client, err := w.dialSSHWithAuth(auth)
+	if err != nil {
+		return fmt.Errorf("ssh key authentication failed: %v", err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("error opening a ssh session with key authentication: %v", err)
+	}
+	defer session.Close()
+	if err = session.Run("hostname"); err != nil {
+		return fmt.Errorf("error running a command over ssh with key authentication: %v", err)
+	}
+	return nil
+}
+
+// sshKeyAuth returns the methods authenticating over ssh with the user certificate and the private key, if any
+func (w *windowsVM) sshKeyAuth() []ssh.AuthMethod {
+	return append(sshCertAuthority.authMethods(), w.endpoint.sshAuth("")...)
+}
+
+// disableWinRMScript returns the PowerShell script stopping the WinRM service and keeping it from starting again
+func disableWinRMScript() string {
+	return "Set-Service -Name WinRM -StartupType Disabled; Stop-Service -Name WinRM -Force"
+}
+
+// restrictWinRMScript returns the PowerShell script restricting the inbound Windows Firewall rules allowing the given
+// WinRM ports to the given CIDR. It fails if no rule allows them, as WinRM is then open in a way it cannot restrict.
+func restrictWinRMScript(cidr string, ports ...int) string {
+	var quoted []string
+	for _, port := range ports {
+		quoted = append(quoted, PowerShellString(strconv.Itoa(port)))
+	}
+	return "$ports = @(" + strings.Join(quoted, ", ") + "); " +
+		"$rules = @(Get-NetFirewallPortFilter -Protocol TCP | " +
+		"Where-Object { @($_.LocalPort | Where-Object { $ports -contains $_ }).Count -gt 0 } | Get-NetFirewallRule | " +
+		"Where-Object { $_.Direction -eq 'Inbound' -and $_.Action -eq 'Allow' }); " +
+		"if ($rules.Count -eq 0) { throw 'no Windows Firewall rule allows WinRM' }; " +
+		"$rules | Set-NetFirewallRule -RemoteAddress " + PowerShellString(cidr)
+}
@@ -0,0 +1,79 @@
+package e2efw
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestWinRMHardeningFromEnv tests the parsing of E2E_WINRM_HARDENING
+func TestWinRMHardeningFromEnv(t *testing.T) {
+	defer os.Setenv(winRMHardeningEnvVar, os.Getenv(winRMHardeningEnvVar))
+	for _, mode := range []string{"", WinRMHardeningDisable, WinRMHardeningRestrict} {
+		require.NoError(t, os.Setenv(winRMHardeningEnvVar, mode))
+		parsed, err := winRMHardeningFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	require.NoError(t, os.Setenv(winRMHardeningEnvVar, "remove"))
+	_, err := winRMHardeningFromEnv()
+	assert.Error(t, err)
+}
+
+// TestHardenWinRM tests that WinRM is only hardened once ssh works with key authentication, and that the commands are
+// then run over ssh only, even once WinRM is checked again
+func TestHardenWinRM(t *testing.T) {
+	defer func(mode string) { winRMHardening = mode }(winRMHardening)
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	_, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+	sshPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+		link:        newLink(nil),
+		endpoint:    &vmEndpoint{sshPortOverride: sshPort},
+	}
+	defer w.sshConn.close()
+
+	winRMHardening = ""
+	require.NoError(t, w.hardenWinRM())
+	assert.Empty(t, w.degradedTransports())
+
+	winRMHardening = WinRMHardeningDisable
+	err = w.hardenWinRM()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no ssh certificate nor private key")
+	assert.Empty(t, w.degradedTransports(), "WinRM should be left as is")
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	w.endpoint.signer, err = ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	require.NoError(t, w.hardenWinRM())
+	assert.Equal(t, map[string]error{"WinRM": errWinRMHardened}, w.degradedTransports())
+
+	w.transports.markAvailable(winRMTransport)
+	require.NoError(t, w.checkTransports())
+	assert.Equal(t, map[string]error{"WinRM": errWinRMHardened}, w.degradedTransports())
+	stdout, _, err := w.Run("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", stdout, "the command should be run over ssh")
+}
+
+// TestRestrictWinRMScript tests that the firewall rules of all the given WinRM ports are restricted to the CIDR
+func TestRestrictWinRMScript(t *testing.T) {
+	script := restrictWinRMScript("10.0.0.0/16", winRMHTTPPort, winRMPort)
+	assert.Contains(t, script, "$ports = @('5985', '5986')")
+	assert.Contains(t, script, "Set-NetFirewallRule -RemoteAddress '10.0.0.0/16'")
+}
@@ -0,0 +1,278 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// hostedClusterEnvVar is the environment variable holding the <namespace>/<name> of the HyperShift HostedCluster
+	// the test suite runs against. KUBECONFIG is then the kubeconfig of the management cluster.
+	hostedClusterEnvVar = "E2E_HOSTED_CLUSTER"
+	// hostedNodePoolEnvVar is the environment variable holding the name of the NodePool of the HostedCluster whose
+	// worker ignition bootstraps the Windows nodes. Defaults to the name of the HostedCluster.
+	hostedNodePoolEnvVar = "E2E_HOSTED_NODEPOOL"
+	// userDataSecretPrefix is the prefix of the secrets holding the worker ignition stub of a NodePool, in the
+	// namespace of the HostedCluster
+	userDataSecretPrefix = "user-data-"
+	// userDataSecretKey is the key of the ignition stub in the user data secrets
+	userDataSecretKey = "value"
+	// hostedKubeconfigSecretKey is the key of the kubeconfig in the kubeconfig secret of a HostedCluster
+	hostedKubeconfigSecretKey = "kubeconfig"
+	// machineAPIGroup is the API group of the machine API, which is not served by hosted clusters
+	machineAPIGroup = "machine.openshift.io"
+	// machineConfigServerPort is the port the machine config server serves the worker ignition on
+	machineConfigServerPort = "22623"
+)
+
+// Topology is the topology of the control plane of the cluster the test suite runs against
+type Topology string
+
+const (
+	// SelfManagedTopology is a cluster running its control plane on its own master nodes
+	SelfManagedTopology Topology = "SelfManaged"
+	// HostedTopology is a cluster whose control plane runs in a namespace of a management cluster, like a HyperShift
+	// HostedCluster. It has no master nodes, no machine config server and no machine API.
+	HostedTopology Topology = "Hosted"
+)
+
+// hostedClusterResource is the resource of the HyperShift HostedClusters on the management cluster
+var hostedClusterResource = schema.GroupVersionResource{Group: "hypershift.openshift.io", Version: "v1beta1",
+	Resource: "hostedclusters"}
+
+// hostedCluster is a HyperShift HostedCluster, whose worker ignition and kubeconfig are in its namespace on the
+// management cluster
+type hostedCluster struct {
+	// namespace is the namespace of the HostedCluster on the management cluster
+	namespace string
+	// name is the name of the HostedCluster
+	name string
+	// nodePool is the name of the NodePool whose worker ignition is used
+	nodePool string
+	// managementClient is the client of the management cluster
+	managementClient kubernetes.Interface
+	// apiServerHost is the host of the API server endpoint of the hosted cluster
+	apiServerHost string
+	// kubeconfigPath is the location the kubeconfig of the hosted cluster was written to
+	kubeconfigPath string
+}
+
+// newHostedCluster gets the HostedCluster given as <namespace>/<name> from the management cluster and writes its
+// kubeconfig to a temporary file, so that the clients of the framework and WNI target the API server of the hosted
+// cluster
+func newHostedCluster(managementKubeconfig, spec, nodePool string) (*hostedCluster, error) {
+	namespace, name, err := parseHostedCluster(spec)
+	if err != nil {
+		return nil, err
+	}
+	if nodePool == "" {
+		nodePool = name
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", managementKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build config from the management cluster kubeconfig: %v", err)
+	}
+	managementClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create management cluster clientset: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create management cluster dynamic client: %v", err)
+	}
+	obj, err := dynamicClient.Resource(hostedClusterResource).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get HostedCluster %s: %v", spec, err)
+	}
+	kubeconfigSecret, apiServerHost, err := hostedClusterStatus(obj)
+	if err != nil {
+		return nil, fmt.Errorf("HostedCluster %s is not available: %v", spec, err)
+	}
+	secret, err := managementClient.CoreV1().Secrets(namespace).Get(kubeconfigSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the kubeconfig of HostedCluster %s: %v", spec, err)
+	}
+	contents, ok := secret.Data[hostedKubeconfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %s", namespace, kubeconfigSecret, hostedKubeconfigSecretKey)
+	}
+	// The kubeconfig holds admin credentials, so it is not written to the artifact directory
+	kubeconfigFile, err := ioutil.TempFile("", "hosted-kubeconfig")
+	if err != nil {
+		return nil, fmt.Errorf("could not create the hosted cluster kubeconfig: %v", err)
+	}
+	defer kubeconfigFile.Close()
+	if _, err = kubeconfigFile.Write(contents); err != nil {
+		os.Remove(kubeconfigFile.Name())
+		return nil, fmt.Errorf("could not write the hosted cluster kubeconfig: %v", err)
+	}
+	return &hostedCluster{namespace: namespace, name: name, nodePool: nodePool, managementClient: managementClient,
+		apiServerHost: apiServerHost, kubeconfigPath: kubeconfigFile.Name()}, nil
+}
+
+// parseHostedCluster returns the namespace and name of the HostedCluster given as <namespace>/<name>
+func parseHostedCluster(spec string) (string, string, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid HostedCluster %q, expected <namespace>/<name>", spec)
+	}
+	return parts[0], parts[1], nil
+}
+
+// hostedClusterStatus returns the name of the kubeconfig secret and the host of the API server endpoint from the
+// status of the HostedCluster
+func hostedClusterStatus(obj *unstructured.Unstructured) (string, string, error) {
+	kubeconfigSecret, _, err := unstructured.NestedString(obj.Object, "status", "kubeconfig", "name")
+	if err != nil || kubeconfigSecret == "" {
+		return "", "", fmt.Errorf("no kubeconfig in status")
+	}
+	host, _, err := unstructured.NestedString(obj.Object, "status", "controlPlaneEndpoint", "host")
+	if err != nil || host == "" {
+		return "", "", fmt.Errorf("no control plane endpoint in status")
+	}
+	return kubeconfigSecret, host, nil
+}
+
+// clusterAddress returns the address of the hosted cluster e.g. "foo.fah.com", from the host of its API server
+// endpoint
+func (h *hostedCluster) clusterAddress() string {
+	return strings.TrimPrefix(h.apiServerHost, "api.")
+}
+
+// workerIgnition returns the URL the worker ignition of the NodePool is served from by the ignition server of the
+// hosted control plane, and the HTTP headers authorizing the request, from the newest ignition stub of the NodePool
+func (h *hostedCluster) workerIgnition() (string, map[string]string, error) {
+	secrets, err := h.managementClient.CoreV1().Secrets(h.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("could not list the secrets of %s: %v", h.namespace, err)
+	}
+	secret := latestUserDataSecret(secrets.Items, h.nodePool)
+	if secret == nil {
+		return "", nil, fmt.Errorf("no user data secret of NodePool %s in %s", h.nodePool, h.namespace)
+	}
+	url, headers, err := parseIgnitionStub(secret.Data[userDataSecretKey])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid ignition stub in secret %s/%s: %v", h.namespace, secret.Name, err)
+	}
+	return url, headers, nil
+}
+
+// cleanup removes the kubeconfig of the hosted cluster
+func (h *hostedCluster) cleanup() {
+	os.Remove(h.kubeconfigPath)
+}
+
+// latestUserDataSecret returns the newest user data secret of the given NodePool, as a NodePool gets a new one
+// whenever its configuration changes, or nil if there is none
+func latestUserDataSecret(secrets []v1.Secret, nodePool string) *v1.Secret {
+	var latest *v1.Secret
+	for i, secret := range secrets {
+		// The secrets are named user-data-<NodePool>-<hash>, the hash telling apart NodePools named with a prefix of
+		// another one
+		prefix := userDataSecretPrefix + nodePool + "-"
+		if !strings.HasPrefix(secret.Name, prefix) || strings.Contains(strings.TrimPrefix(secret.Name, prefix), "-") {
+			continue
+		}
+		if _, ok := secret.Data[userDataSecretKey]; !ok {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&secret.CreationTimestamp) {
+			latest = &secrets[i]
+		}
+	}
+	return latest
+}
+
+// parseIgnitionStub returns the source of the config merged by the given ignition stub, and the HTTP headers to get
+// it with
+func parseIgnitionStub(stub []byte) (string, map[string]string, error) {
+	var config struct {
+		Ignition struct {
+			Config struct {
+				Merge []struct {
+					Source      string `json:"source"`
+					HTTPHeaders []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"httpHeaders"`
+				} `json:"merge"`
+			} `json:"config"`
+		} `json:"ignition"`
+	}
+	if err := json.Unmarshal(stub, &config); err != nil {
+		return "", nil, err
+	}
+	if len(config.Ignition.Config.Merge) != 1 || config.Ignition.Config.Merge[0].Source == "" {
+		return "", nil, fmt.Errorf("expected a single merged config")
+	}
+	merge := config.Ignition.Config.Merge[0]
+	headers := make(map[string]string, len(merge.HTTPHeaders))
+	for _, header := range merge.HTTPHeaders {
+		headers[header.Name] = header.Value
+	}
+	return merge.Source, headers, nil
+}
+
+// hasMachineAPI returns true if the cluster serves the machine API
+func hasMachineAPI(client discovery.DiscoveryInterface) (bool, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups.Groups {
+		if group.Name == machineAPIGroup {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WorkerIgnitionEndpoint returns the URL the worker ignition of the cluster is served from and the HTTP headers
+// required to get it. It is served by the machine config server of a self-managed cluster, and by the ignition
+// server of the hosted control plane of a hosted cluster.
+func (f *TestFramework) WorkerIgnitionEndpoint() (string, map[string]string, error) {
+	if f.hosted == nil {
+		return "https://" + net.JoinHostPort("api-int."+ClusterAddress, machineConfigServerPort) + "/config/worker",
+			nil, nil
+	}
+	return f.hosted.workerIgnition()
+}
+
+// setupTopology finds the topology of the cluster. For a hosted cluster, the kubeconfig of the hosted cluster replaces
+// the one of the management cluster, and the cluster address defaults to the one of its API server endpoint.
+func (f *TestFramework) setupTopology() error {
+	f.Topology = SelfManagedTopology
+	spec := os.Getenv(hostedClusterEnvVar)
+	if spec == "" {
+		return nil
+	}
+	hosted, err := newHostedCluster(kubeconfig, spec, os.Getenv(hostedNodePoolEnvVar))
+	if err != nil {
+		return err
+	}
+	f.hosted = hosted
+	f.Topology = HostedTopology
+	if kubeconfig, err = prepareKubeconfig(hosted.kubeconfigPath); err != nil {
+		return err
+	}
+	if ClusterAddress == "" {
+		ClusterAddress = hosted.clusterAddress()
+	}
+	log.Printf("running against HostedCluster %s with the worker ignition of NodePool %s, API server %s", spec,
+		hosted.nodePool, hosted.apiServerHost)
+	return nil
+}
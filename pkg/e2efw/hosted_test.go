@@ -0,0 +1,90 @@
+package e2efw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestParseHostedCluster tests that the HostedCluster is given as <namespace>/<name>
+func TestParseHostedCluster(t *testing.T) {
+	namespace, name, err := parseHostedCluster("clusters/windows")
+	require.NoError(t, err)
+	assert.Equal(t, "clusters", namespace)
+	assert.Equal(t, "windows", name)
+	for _, spec := range []string{"windows", "clusters/", "/windows", "clusters/windows/extra"} {
+		_, _, err = parseHostedCluster(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestHostedClusterStatus tests that the kubeconfig secret and the API server endpoint are read from the status of
+// the HostedCluster
+func TestHostedClusterStatus(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"kubeconfig":           map[string]interface{}{"name": "windows-admin-kubeconfig"},
+			"controlPlaneEndpoint": map[string]interface{}{"host": "api.windows.example.com", "port": int64(6443)},
+		},
+	}}
+	secret, host, err := hostedClusterStatus(obj)
+	require.NoError(t, err)
+	assert.Equal(t, "windows-admin-kubeconfig", secret)
+	assert.Equal(t, "api.windows.example.com", host)
+	assert.Equal(t, "windows.example.com", (&hostedCluster{apiServerHost: host}).clusterAddress())
+
+	_, _, err = hostedClusterStatus(&unstructured.Unstructured{Object: map[string]interface{}{}})
+	assert.Error(t, err, "a HostedCluster without status is not available")
+}
+
+// TestLatestUserDataSecret tests that the newest ignition stub of the NodePool is used
+func TestLatestUserDataSecret(t *testing.T) {
+	now := time.Now()
+	secret := func(name string, created time.Time) v1.Secret {
+		return v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Data:       map[string][]byte{userDataSecretKey: []byte("{}")},
+		}
+	}
+	secrets := []v1.Secret{
+		secret("user-data-windows-1a2b3c", now.Add(-time.Hour)),
+		secret("user-data-windows-4d5e6f", now),
+		secret("user-data-windows-extra-7a8b9c", now.Add(time.Hour)),
+		secret("token-windows-4d5e6f", now.Add(time.Hour)),
+	}
+	assert.Equal(t, "user-data-windows-4d5e6f", latestUserDataSecret(secrets, "windows").Name)
+	assert.Equal(t, "user-data-windows-extra-7a8b9c", latestUserDataSecret(secrets, "windows-extra").Name)
+	assert.Nil(t, latestUserDataSecret(secrets, "linux"))
+}
+
+// TestParseIgnitionStub tests that the source of the worker ignition and its headers are read from the stub
+func TestParseIgnitionStub(t *testing.T) {
+	url, headers, err := parseIgnitionStub([]byte(`{"ignition": {"version": "3.1.0", "config": {"merge": [{
+		"source": "https://ignition-server.example.com/ignition",
+		"httpHeaders": [{"name": "Authorization", "value": "Bearer dG9rZW4="},
+			{"name": "NodePool", "value": "clusters/windows"}]}]}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://ignition-server.example.com/ignition", url)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer dG9rZW4=", "NodePool": "clusters/windows"}, headers)
+
+	_, _, err = parseIgnitionStub([]byte(`{"ignition": {"version": "3.1.0"}}`))
+	assert.Error(t, err, "a stub without a merged config is invalid")
+	_, _, err = parseIgnitionStub([]byte("{"))
+	assert.Error(t, err)
+}
+
+// TestWorkerIgnitionEndpoint tests that the worker ignition of a self-managed cluster is served by the machine
+// config server
+func TestWorkerIgnitionEndpoint(t *testing.T) {
+	defer func(address string) { ClusterAddress = address }(ClusterAddress)
+	ClusterAddress = "windows.example.com"
+	url, headers, err := (&TestFramework{}).WorkerIgnitionEndpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "https://api-int.windows.example.com:22623/config/worker", url)
+	assert.Empty(t, headers)
+}
@@ -0,0 +1,233 @@
+package e2efw
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+)
+
+const (
+	// nodeIdentityDir is the directory of the artifact directory the node identity backups are written to
+	nodeIdentityDir = "node-identity"
+	// nodeIdentityManifest is the name of the manifest of a node identity backup
+	nodeIdentityManifest = "manifest.json"
+	// remoteIdentityStagingDir is the directory the node identity files are staged in on the VM, as files are copied
+	// to and from the VM by directory
+	remoteIdentityStagingDir = "C:\\Temp\\node-identity"
+)
+
+// NodeIdentityPaths are the files and directories making up the identity of a bootstrapped node: its bootstrap
+// kubeconfig, its kubeconfig, its kubelet certificates and the configuration generated by WMCB. The ones that do not
+// exist on the node, like the credential provider configuration when none was configured, are skipped.
+var NodeIdentityPaths = []string{
+	"C:\\k\\bootstrap-kubeconfig",
+	"C:\\k\\kubeconfig",
+	"C:\\k\\kubelet.conf",
+	"C:\\k\\cni\\config\\cni.conf",
+	"C:\\k\\credential-provider-config.yaml",
+	"C:\\var\\lib\\kubelet\\pki",
+}
+
+// NodeIdentityBackup is the manifest of a node identity backup
+type NodeIdentityBackup struct {
+	// Name is the name of the backup
+	Name string `json:"name"`
+	// Host is the IP address of the VM the backup was taken from
+	Host string `json:"host"`
+	// Time is when the backup was taken
+	Time time.Time `json:"time"`
+	// Files are the backed up files
+	Files []BackupFile `json:"files"`
+}
+
+// BackupFile is a file of a node identity backup
+type BackupFile struct {
+	// Path is the path of the file on the VM
+	Path string `json:"path"`
+	// File is the name of the file in the backup directory
+	File string `json:"file"`
+	// SHA256 is the hex encoded SHA256 of the file
+	SHA256 string `json:"sha256"`
+	// Certificates summarize the PEM certificates of the file, to help debugging TLS issues
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+}
+
+// CertificateInfo summarizes a certificate
+type CertificateInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	DNSNames    []string  `json:"dnsNames,omitempty"`
+	IPAddresses []string  `json:"ipAddresses,omitempty"`
+}
+
+// BackupNodeIdentity backs up the NodeIdentityPaths of the given VM to the node-identity/<name> directory of the
+// artifact directory, along with a manifest of the files, their checksums and a summary of their certificates. The
+// backup directory is returned. The identity can be restored onto another VM with RestoreNodeIdentity. The backup holds
+// the private keys of the node, so it is only meant for test clusters.
+func (f *TestFramework) BackupNodeIdentity(vm WindowsVM, name string) (string, error) {
+	backupDir := filepath.Join(artifactDir, nodeIdentityDir, name)
+	if err := os.RemoveAll(backupDir); err != nil {
+		return "", fmt.Errorf("error removing previous backup %s: %v", backupDir, err)
+	}
+	stdout, stderr, err := vm.Run(PowerShellScript(listIdentityFilesScript(NodeIdentityPaths)), true)
+	if err != nil {
+		return "", fmt.Errorf("error listing the node identity files: %v, %s", err, stderr)
+	}
+	var files []BackupFile
+	for _, path := range strings.Split(stdout, "\n") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		files = append(files, BackupFile{Path: path, File: fmt.Sprintf("%02d-%s", len(files), remotepath.Base(path))})
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no node identity files found on %s", vm.GetCredentials().GetIPAddress())
+	}
+
+	// The files are staged in a single directory with unique names, symlinks like kubelet-client-current.pem being
+	// replaced by the file they point to
+	if _, stderr, err = vm.Run(PowerShellScript(stageIdentityFilesScript(files, false)), true); err != nil {
+		return "", fmt.Errorf("error staging the node identity files: %v, %s", err, stderr)
+	}
+	defer vm.Run(PowerShellScript("Remove-Item -Recurse -Force "+PowerShellString(remoteIdentityStagingDir)), true)
+	if err = vm.RetrieveFiles(remoteIdentityStagingDir, backupDir); err != nil {
+		return "", fmt.Errorf("error retrieving the node identity files: %v", err)
+	}
+
+	for i := range files {
+		localPath := filepath.Join(backupDir, files[i].File)
+		if files[i].SHA256, err = fileSHA256(localPath); err != nil {
+			return "", fmt.Errorf("node identity file %s was not backed up: %v", files[i].Path, err)
+		}
+		contents, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return "", err
+		}
+		files[i].Certificates = certificateInfos(contents)
+	}
+	backup := NodeIdentityBackup{
+		Name:  name,
+		Host:  vm.GetCredentials().GetIPAddress(),
+		Time:  time.Now(),
+		Files: files,
+	}
+	out, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshalling the node identity manifest: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(backupDir, nodeIdentityManifest), out, 0644); err != nil {
+		return "", fmt.Errorf("error writing the node identity manifest: %v", err)
+	}
+	return backupDir, nil
+}
+
+// RestoreNodeIdentity restores the node identity backed up to the given directory by BackupNodeIdentity onto the given
+// VM, e.g. a fresh VM replacing the one the backup was taken from. The files are verified against the checksums of the
+// manifest before being restored. The kubelet needs to be stopped before and started after the restore by the caller,
+// as it does not reload its kubeconfig and certificates.
+func (f *TestFramework) RestoreNodeIdentity(vm WindowsVM, backupDir string) error {
+	backup, err := readNodeIdentityBackup(backupDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range backup.Files {
+		localPath := filepath.Join(backupDir, file.File)
+		hash, err := fileSHA256(localPath)
+		if err != nil {
+			return err
+		}
+		if hash != file.SHA256 {
+			return fmt.Errorf("backup of %s is corrupted, its SHA256 is %s instead of %s", file.Path, hash, file.SHA256)
+		}
+		if err = vm.CopyFile(localPath, remoteIdentityStagingDir); err != nil {
+			return fmt.Errorf("error copying backup of %s: %v", file.Path, err)
+		}
+	}
+	defer vm.Run(PowerShellScript("Remove-Item -Recurse -Force "+PowerShellString(remoteIdentityStagingDir)), true)
+	if _, stderr, err := vm.Run(PowerShellScript(stageIdentityFilesScript(backup.Files, true)), true); err != nil {
+		return fmt.Errorf("error restoring the node identity files: %v, %s", err, stderr)
+	}
+	return nil
+}
+
+// readNodeIdentityBackup reads the manifest of the node identity backup in the given directory
+func readNodeIdentityBackup(backupDir string) (*NodeIdentityBackup, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(backupDir, nodeIdentityManifest))
+	if err != nil {
+		return nil, fmt.Errorf("error reading node identity manifest: %v", err)
+	}
+	var backup NodeIdentityBackup
+	if err = json.Unmarshal(contents, &backup); err != nil {
+		return nil, fmt.Errorf("error parsing node identity manifest: %v", err)
+	}
+	if len(backup.Files) == 0 {
+		return nil, fmt.Errorf("node identity backup %s has no files", backupDir)
+	}
+	return &backup, nil
+}
+
+// listIdentityFilesScript returns the PowerShell script listing the full path of the existing files among the given
+// files and directories, one per line
+func listIdentityFilesScript(paths []string) string {
+	var quoted []string
+	for _, path := range paths {
+		quoted = append(quoted, PowerShellString(path))
+	}
+	return "Get-ChildItem -File -ErrorAction SilentlyContinue -Path " + strings.Join(quoted, ",") +
+		" | ForEach-Object { $_.FullName }"
+}
+
+// stageIdentityFilesScript returns the PowerShell script copying the given files to the staging directory under their
+// backup name, or from the staging directory to their path if restore is set
+func stageIdentityFilesScript(files []BackupFile, restore bool) string {
+	staging := PowerShellString(remoteIdentityStagingDir)
+	script := []string{"New-Item -ItemType Directory -Force -Path " + staging + " | Out-Null"}
+	for _, file := range files {
+		staged := PowerShellString(remotepath.WindowsPathJoin(remoteIdentityStagingDir, file.File))
+		path := PowerShellString(file.Path)
+		if restore {
+			script = append(script, "New-Item -ItemType Directory -Force -Path (Split-Path "+path+") | Out-Null",
+				"Copy-Item -Force -LiteralPath "+staged+" -Destination "+path)
+		} else {
+			script = append(script, "Copy-Item -Force -LiteralPath "+path+" -Destination "+staged)
+		}
+	}
+	return "$ErrorActionPreference = 'Stop'; " + strings.Join(script, "; ")
+}
+
+// certificateInfos summarizes the PEM certificates in the given contents, ignoring the other PEM blocks like the
+// private keys
+func certificateInfos(contents []byte) []CertificateInfo {
+	var infos []CertificateInfo
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		info := CertificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			DNSNames:  cert.DNSNames,
+		}
+		for _, ip := range cert.IPAddresses {
+			info.IPAddresses = append(info.IPAddresses, ip.String())
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,87 @@
+package e2efw
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCertificateInfos tests that the certificates of a PEM file are summarized and its private key is ignored
+func TestCertificateInfos(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	notBefore := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system:node:winnode", Organization: []string{"system:nodes"}},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(30 * 24 * time.Hour),
+		DNSNames:     []string{"winnode"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	contents := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+
+	assert.Equal(t, []CertificateInfo{{
+		Subject:     "CN=system:node:winnode,O=system:nodes",
+		Issuer:      "CN=system:node:winnode,O=system:nodes",
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.Add(30 * 24 * time.Hour),
+		DNSNames:    []string{"winnode"},
+		IPAddresses: []string{"10.0.0.5"},
+	}}, certificateInfos(contents))
+	assert.Empty(t, certificateInfos([]byte("apiVersion: v1\nkind: Config\n")))
+}
+
+// TestStageIdentityFilesScript tests the staging of the node identity files for a backup and a restore
+func TestStageIdentityFilesScript(t *testing.T) {
+	files := []BackupFile{{Path: "C:\\var\\lib\\kubelet\\pki\\kubelet.crt", File: "00-kubelet.crt"}}
+	assert.Equal(t, "$ErrorActionPreference = 'Stop'; "+
+		"New-Item -ItemType Directory -Force -Path 'C:\\Temp\\node-identity' | Out-Null; "+
+		"Copy-Item -Force -LiteralPath 'C:\\var\\lib\\kubelet\\pki\\kubelet.crt' "+
+		"-Destination 'C:\\Temp\\node-identity\\00-kubelet.crt'", stageIdentityFilesScript(files, false))
+	assert.Equal(t, "$ErrorActionPreference = 'Stop'; "+
+		"New-Item -ItemType Directory -Force -Path 'C:\\Temp\\node-identity' | Out-Null; "+
+		"New-Item -ItemType Directory -Force -Path (Split-Path 'C:\\var\\lib\\kubelet\\pki\\kubelet.crt') | Out-Null; "+
+		"Copy-Item -Force -LiteralPath 'C:\\Temp\\node-identity\\00-kubelet.crt' "+
+		"-Destination 'C:\\var\\lib\\kubelet\\pki\\kubelet.crt'", stageIdentityFilesScript(files, true))
+	assert.Equal(t, "Get-ChildItem -File -ErrorAction SilentlyContinue -Path "+
+		"'C:\\k\\kubeconfig','C:\\var\\lib\\kubelet\\pki' | ForEach-Object { $_.FullName }",
+		listIdentityFilesScript([]string{"C:\\k\\kubeconfig", "C:\\var\\lib\\kubelet\\pki"}))
+}
+
+// TestReadNodeIdentityBackup tests the reading of the backup manifest
+func TestReadNodeIdentityBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-identity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = readNodeIdentityBackup(dir)
+	assert.Error(t, err, "missing manifest")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, nodeIdentityManifest), []byte(`{"files": []}`), 0644))
+	_, err = readNodeIdentityBackup(dir)
+	assert.Error(t, err, "empty backup")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, nodeIdentityManifest),
+		[]byte(`{"name": "before", "files": [{"path": "C:\\k\\kubeconfig", "file": "00-kubeconfig", "sha256": "abc"}]}`),
+		0644))
+	backup, err := readNodeIdentityBackup(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []BackupFile{{Path: "C:\\k\\kubeconfig", File: "00-kubeconfig", SHA256: "abc"}}, backup.Files)
+}
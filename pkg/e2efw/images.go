@@ -0,0 +1,129 @@
+package e2efw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+)
+
+const (
+	// imageBundleEnvVar is the environment variable holding the local image bundle loaded on the VMs during Setup, a
+	// directory of .tar image archives or a single archive
+	imageBundleEnvVar = "E2E_IMAGE_BUNDLE"
+	// remoteImageBundleDir is the directory the image archives are copied to on the VM before being loaded
+	remoteImageBundleDir = "C:\\Temp\\image-bundle"
+	// loadedArchivesFile lists the SHA256 of the image archives loaded on the VM, one per line
+	loadedArchivesFile = remoteImageBundleDir + "\\loaded.txt"
+	// imageArchiveExtension is the extension of the image archives in a bundle directory
+	imageArchiveExtension = ".tar"
+)
+
+// LoadImages loads the container images of the given local bundle into the container runtime of the Windows VM, with
+// docker load or ctr images import, so that the tests do not pull the multi-GB Windows base images over the WAN on
+// every run, or can run without a registry. The bundle is a directory of .tar image archives or a single archive, in
+// the docker save or OCI image layout format. The archives already loaded on the VM are not copied again.
+func LoadImages(vm WindowsVM, bundle string) error {
+	return vm.handle().loadImages(bundle)
+}
+
+// loadImages implements LoadImages
+func (w *windowsVM) loadImages(bundle string) error {
+	archives, err := imageArchives(bundle)
+	if err != nil {
+		return err
+	}
+	stdout, _, err := w.Run(PowerShellScript("Get-Content -ErrorAction SilentlyContinue "+
+		PowerShellString(loadedArchivesFile)), true)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", loadedArchivesFile, err)
+	}
+	loaded := make(map[string]bool)
+	for _, hash := range strings.Fields(stdout) {
+		loaded[hash] = true
+	}
+
+	for _, archive := range archives {
+		hash, err := fileSHA256(archive)
+		if err != nil {
+			return err
+		}
+		if loaded[hash] {
+			log.Printf("image archive %s is already loaded on %s", archive, w.GetCredentials().GetIPAddress())
+			continue
+		}
+		if err = w.CopyFile(archive, remoteImageBundleDir); err != nil {
+			return fmt.Errorf("error copying image archive %s: %v", archive, err)
+		}
+		remoteArchive := remotepath.WindowsPathJoin(remoteImageBundleDir, filepath.Base(archive))
+		if _, stderr, err := w.Run(PowerShellScript(loadImagesScript(remoteArchive, hash)), true); err != nil {
+			return fmt.Errorf("error loading image archive %s: %v, %s", archive, err, stderr)
+		}
+		log.Printf("loaded image archive %s on %s", archive, w.GetCredentials().GetIPAddress())
+	}
+	return nil
+}
+
+// loadImagesScript returns the PowerShell script loading the given archive on the VM into the container runtime of the
+// nodes, and recording the given hash of the archive once loaded. The archive is removed to
+// free the disk space.
+func loadImagesScript(remoteArchive, hash string) string {
+	archive := PowerShellString(remoteArchive)
+	load := "docker load --input " + archive
+	if ContainerRuntime == ContainerdRuntime {
+		load = "ctr --namespace k8s.io images import " + archive
+	}
+	return load + "; " +
+		"if ($LASTEXITCODE -ne 0) { throw 'loading ' + " + archive + " + ' failed' }; " +
+		"Remove-Item -LiteralPath " + archive + "; " +
+		"Add-Content -Path " + PowerShellString(loadedArchivesFile) + " -Value " + PowerShellString(hash)
+}
+
+// imageArchives returns the image archives of the given local bundle: the archives of a bundle directory sorted by
+// name, or the bundle itself if it is an archive
+func imageArchives(bundle string) ([]string, error) {
+	info, err := os.Stat(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing image bundle %s: %v", bundle, err)
+	}
+	if !info.IsDir() {
+		return []string{bundle}, nil
+	}
+	files, err := ioutil.ReadDir(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image bundle %s: %v", bundle, err)
+	}
+	var archives []string
+	for _, file := range files {
+		if !file.IsDir() && strings.EqualFold(filepath.Ext(file.Name()), imageArchiveExtension) {
+			archives = append(archives, filepath.Join(bundle, file.Name()))
+		}
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no %s image archives in image bundle %s", imageArchiveExtension, bundle)
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// fileSHA256 returns the hex encoded SHA256 of the given local file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error hashing %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,52 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageArchives tests that the archives of a bundle directory are returned in order, and that an archive is a
+// bundle
+func TestImageArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = imageArchives(dir)
+	assert.Error(t, err, "empty bundle")
+	for _, name := range []string{"servercore.tar", "pause.TAR", "README.md"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	archives, err := imageArchives(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "pause.TAR"), filepath.Join(dir, "servercore.tar")}, archives)
+	archives, err = imageArchives(filepath.Join(dir, "servercore.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "servercore.tar")}, archives)
+
+	hash, err := fileSHA256(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "b335630551682c19a781afebcf4d07bf978fb1f8ac04c6bf87428ed5106870f5", hash)
+}
+
+// TestLoadImagesScript tests that the script loading an archive quotes its path and loads the archive into the
+// selected container runtime
+func TestLoadImagesScript(t *testing.T) {
+	script := loadImagesScript("C:\\Temp\\image-bundle\\it's.tar", "abc")
+	assert.NotContains(t, script, "\"")
+	assert.Contains(t, script, "docker load --input 'C:\\Temp\\image-bundle\\it''s.tar'")
+	assert.NotContains(t, script, "ctr")
+	assert.Contains(t, script, "Add-Content -Path 'C:\\Temp\\image-bundle\\loaded.txt' -Value 'abc'")
+
+	ContainerRuntime = ContainerdRuntime
+	defer func() { ContainerRuntime = DockerRuntime }()
+	script = loadImagesScript("C:\\Temp\\image-bundle\\it's.tar", "abc")
+	assert.Contains(t, script, "ctr --namespace k8s.io images import 'C:\\Temp\\image-bundle\\it''s.tar'")
+	assert.NotContains(t, script, "docker")
+}
@@ -0,0 +1,113 @@
+package e2efw
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The environment variables of the required inputs of the test suite
+const (
+	// kubeconfigEnvVar is the environment variable holding the kubeconfig of the cluster
+	kubeconfigEnvVar = "KUBECONFIG"
+	// awsCredentialsEnvVar is the environment variable holding the shared credentials file of the AWS account
+	awsCredentialsEnvVar = "AWS_SHARED_CREDENTIALS_FILE"
+	// artifactDirEnvVar is the environment variable holding the directory the artifacts are written to
+	artifactDirEnvVar = "ARTIFACT_DIR"
+	// clusterAddressEnvVar is the environment variable holding the address of the cluster
+	clusterAddressEnvVar = "CLUSTER_ADDR"
+)
+
+// Inputs are the required inputs of the test suite, which the test binaries take as flags overriding their
+// environment variable, so that a local run does not depend on the environment of the shell it is started from
+type Inputs struct {
+	// Kubeconfig is the kubeconfig of the cluster, overriding KUBECONFIG
+	Kubeconfig string
+	// AWSCredentials is the shared credentials file of the AWS account the VMs are created in, overriding
+	// AWS_SHARED_CREDENTIALS_FILE
+	AWSCredentials string
+	// ArtifactDir is the directory the artifacts are written to, overriding ARTIFACT_DIR
+	ArtifactDir string
+	// ClusterAddress is the address of the cluster, e.g. foo.fah.com, overriding CLUSTER_ADDR
+	ClusterAddress string
+}
+
+// RegisterFlags registers the flags of the inputs in the given flag set
+func (i *Inputs) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&i.Kubeconfig, "kubeconfig", "", "Kubeconfig of the cluster. Defaults to "+kubeconfigEnvVar)
+	flags.StringVar(&i.AWSCredentials, "awsCredentials", "", "Shared credentials file of the AWS account the VMs "+
+		"are created in. Defaults to "+awsCredentialsEnvVar)
+	flags.StringVar(&i.ArtifactDir, "artifactDir", "", "Directory the artifacts are written to, created if needed. "+
+		"Defaults to "+artifactDirEnvVar)
+	flags.StringVar(&i.ClusterAddress, "clusterAddr", "", "Address of the cluster, e.g. foo.fah.com, without the "+
+		"api. prefix or port. Defaults to "+clusterAddressEnvVar)
+}
+
+// withEnv returns the inputs with the ones which are not given by flags taken from their environment variable. The
+// first file of KUBECONFIG is used when it lists several ones, separated by colons, or semicolons on Windows test
+// hosts.
+func (i Inputs) withEnv() Inputs {
+	if i.Kubeconfig == "" {
+		for _, path := range filepath.SplitList(os.Getenv(kubeconfigEnvVar)) {
+			if path != "" {
+				i.Kubeconfig = path
+				break
+			}
+		}
+	}
+	if i.AWSCredentials == "" {
+		i.AWSCredentials = os.Getenv(awsCredentialsEnvVar)
+	}
+	if i.ArtifactDir == "" {
+		i.ArtifactDir = os.Getenv(artifactDirEnvVar)
+	}
+	if i.ClusterAddress == "" {
+		i.ClusterAddress = os.Getenv(clusterAddressEnvVar)
+	}
+	return i
+}
+
+// validate returns an error listing every input which is missing or invalid, with the flag and the environment
+// variable giving it. The AWS credentials are not required to run against the hosts of an inventory, nor the cluster
+// address to run against a hosted cluster.
+func (i Inputs) validate(inventory, hosted bool) error {
+	errs := NewMultiError("invalid test suite inputs, set them with their flag or environment variable")
+	missing := func(flagName, envVar, description string) {
+		errs.Appendf("missing %s: set -%s or %s", description, flagName, envVar)
+	}
+	if i.Kubeconfig == "" {
+		missing("kubeconfig", kubeconfigEnvVar, "kubeconfig of the cluster")
+	} else if err := requireFile(i.Kubeconfig); err != nil {
+		errs.Appendf("invalid kubeconfig: %v", err)
+	}
+	if i.AWSCredentials == "" {
+		if !inventory {
+			missing("awsCredentials", awsCredentialsEnvVar, "AWS credentials file")
+		}
+	} else if err := requireFile(i.AWSCredentials); err != nil {
+		errs.Appendf("invalid AWS credentials file: %v", err)
+	}
+	if i.ArtifactDir == "" {
+		missing("artifactDir", artifactDirEnvVar, "artifact directory")
+	} else if err := os.MkdirAll(i.ArtifactDir, os.ModePerm); err != nil {
+		errs.Appendf("invalid artifact directory: %v", err)
+	}
+	if strings.TrimSpace(i.ClusterAddress) == "" && !hosted {
+		missing("clusterAddr", clusterAddressEnvVar, "cluster address")
+	}
+	return errs.ErrorOrNil()
+}
+
+// requireFile returns an error unless the given path is a regular file
+func requireFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package e2efw
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInputsWithEnv tests that the inputs given by flags override their environment variable
+func TestInputsWithEnv(t *testing.T) {
+	for _, envVar := range []string{kubeconfigEnvVar, awsCredentialsEnvVar, artifactDirEnvVar, clusterAddressEnvVar} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+	}
+	require.NoError(t, os.Setenv(kubeconfigEnvVar, string(filepath.ListSeparator)+"/env/kubeconfig"+
+		string(filepath.ListSeparator)+"/env/other"))
+	require.NoError(t, os.Setenv(awsCredentialsEnvVar, "/env/credentials"))
+	require.NoError(t, os.Setenv(artifactDirEnvVar, "/env/artifacts"))
+	require.NoError(t, os.Setenv(clusterAddressEnvVar, "env.example.com"))
+
+	var inputs Inputs
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	inputs.RegisterFlags(flags)
+	require.NoError(t, flags.Parse([]string{"-kubeconfig", "/flag/kubeconfig", "-clusterAddr", "flag.example.com"}))
+	assert.Equal(t, Inputs{Kubeconfig: "/flag/kubeconfig", AWSCredentials: "/env/credentials",
+		ArtifactDir: "/env/artifacts", ClusterAddress: "flag.example.com"}, inputs.withEnv())
+	assert.Equal(t, "/env/kubeconfig", Inputs{}.withEnv().Kubeconfig, "the first kubeconfig should be used")
+}
+
+// TestInputsValidate tests that every missing or invalid input is reported with its flag and environment variable
+func TestInputsValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	kubeconfigPath := filepath.Join(dir, "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(kubeconfigPath, []byte("apiVersion: v1"), 0600))
+
+	err = Inputs{}.validate(false, false)
+	require.Error(t, err)
+	failures := Failures(err)
+	require.Len(t, failures, 4)
+	assert.Equal(t, "missing kubeconfig of the cluster: set -kubeconfig or KUBECONFIG", failures[0].Error())
+	assert.Equal(t, "missing cluster address: set -clusterAddr or CLUSTER_ADDR", failures[3].Error())
+
+	artifacts := filepath.Join(dir, "artifacts", "run")
+	inputs := Inputs{Kubeconfig: kubeconfigPath, ArtifactDir: artifacts}
+	assert.NoError(t, inputs.validate(true, true), "inventory runs against hosted clusters need neither AWS "+
+		"credentials nor the cluster address")
+	assert.DirExists(t, artifacts, "the artifact directory should be created")
+
+	inputs = Inputs{Kubeconfig: dir, AWSCredentials: filepath.Join(dir, "missing"), ArtifactDir: artifacts,
+		ClusterAddress: "windows.example.com"}
+	assert.Len(t, Failures(inputs.validate(false, false)), 2, "a directory kubeconfig and a missing credentials "+
+		"file should be rejected")
+}
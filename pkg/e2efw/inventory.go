@@ -0,0 +1,248 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/yaml"
+)
+
+// inventoryEnvVar is the environment variable holding the path of an inventory file of existing Windows hosts, which
+// the tests run against instead of creating Windows VMs on a cloud provider
+const inventoryEnvVar = "E2E_INVENTORY"
+
+// inventoryPath is the path of the inventory file of the hosts the tests run against, empty to create Windows VMs
+var inventoryPath string
+
+// Inventory lists existing Windows hosts, e.g. lab hardware, reached directly over WinRM and ssh. It is read from a
+// YAML or JSON file.
+type Inventory struct {
+	// Hosts are the Windows hosts of the inventory
+	Hosts []InventoryHost `json:"hosts"`
+}
+
+// InventoryHost is a Windows host of an inventory
+type InventoryHost struct {
+	// Name identifies the host in the logs and artifacts in place of the instance ID of the cloud VMs. The IP address
+	// is used if empty.
+	Name string `json:"name,omitempty"`
+	// IP is the IP address or DNS name the host is reached at
+	IP string `json:"ip"`
+	// User is the user the commands are run as, Administrator if empty
+	User string `json:"user,omitempty"`
+	// Password is the password of the user. It is required by WinRM; a host without one is only reached over ssh.
+	Password string `json:"password,omitempty"`
+	// PrivateKeyPath is the path of the private key authenticating the user over ssh, in addition to the password
+	PrivateKeyPath string `json:"privateKeyPath,omitempty"`
+	// CertificatePath is the path of the ssh certificate of the private key, signed by a certificate authority the
+	// host trusts, which the private key authenticates with instead of a key of the authorized keys of the user
+	CertificatePath string `json:"certificatePath,omitempty"`
+	// SSHPort is the port of the OpenSSH server of the host, 22 if not set
+	SSHPort int `json:"sshPort,omitempty"`
+	// WinRMPort is the port of the WinRM listener of the host, 5986 if not set
+	WinRMPort int `json:"winrmPort,omitempty"`
+	// WinRMHTTP connects to an unencrypted WinRM listener, usually on port 5985, instead of an HTTPS one
+	WinRMHTTP bool `json:"winrmHTTP,omitempty"`
+}
+
+// vmEndpoint holds how a Windows VM is reached when it differs from the defaults of the cloud VMs. The methods of a nil
+// vmEndpoint return the defaults.
+type vmEndpoint struct {
+	// sshPortOverride is the port of the OpenSSH server, 0 for the default one
+	sshPortOverride int
+	// winRMPortOverride is the port of the WinRM listener, 0 for the default one
+	winRMPortOverride int
+	// winRMHTTP is true if the WinRM listener is unencrypted
+	winRMHTTP bool
+	// signer is the private key or certificate authenticating over ssh, nil to authenticate with the password only
+	signer ssh.Signer
+}
+
+// ParseInventory parses the given YAML or JSON inventory and validates its hosts
+func ParseInventory(data []byte) (*Inventory, error) {
+	inventory := &Inventory{}
+	if err := yaml.UnmarshalStrict(data, inventory); err != nil {
+		return nil, fmt.Errorf("error parsing inventory: %v", err)
+	}
+	if len(inventory.Hosts) == 0 {
+		return nil, fmt.Errorf("inventory has no hosts")
+	}
+	names := make(map[string]bool)
+	for i, host := range inventory.Hosts {
+		if host.IP == "" {
+			return nil, fmt.Errorf("host %d of the inventory has no IP address", i)
+		}
+		if host.Password == "" && host.PrivateKeyPath == "" {
+			return nil, fmt.Errorf("host %s has neither a password nor a private key", host.IP)
+		}
+		if host.CertificatePath != "" && host.PrivateKeyPath == "" {
+			return nil, fmt.Errorf("host %s has a certificate but no private key", host.IP)
+		}
+		for _, port := range []int{host.SSHPort, host.WinRMPort} {
+			if port < 0 || port > 65535 {
+				return nil, fmt.Errorf("host %s has invalid port %d", host.IP, port)
+			}
+		}
+		if names[host.name()] {
+			return nil, fmt.Errorf("host %s is listed more than once in the inventory", host.name())
+		}
+		names[host.name()] = true
+	}
+	return inventory, nil
+}
+
+// name returns the name of the host, its IP address if it has none
+func (h *InventoryHost) name() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.IP
+}
+
+// userName returns the user the commands are run as on the host
+func (h *InventoryHost) userName() string {
+	if h.User != "" {
+		return h.User
+	}
+	return user
+}
+
+// endpoint returns how the host is reached, reading its private key if any
+func (h *InventoryHost) endpoint() (*vmEndpoint, error) {
+	endpoint := &vmEndpoint{sshPortOverride: h.SSHPort, winRMPortOverride: h.WinRMPort, winRMHTTP: h.WinRMHTTP}
+	if h.PrivateKeyPath == "" {
+		return endpoint, nil
+	}
+	if h.CertificatePath != "" {
+		var caKey ssh.PublicKey
+		if sshCertAuthority != nil {
+			caKey = sshCertAuthority.key
+		}
+		signer, err := readCertSigner(h.CertificatePath, h.PrivateKeyPath, caKey, h.userName())
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", h.name(), err)
+		}
+		endpoint.signer = signer
+		return endpoint, nil
+	}
+	key, err := ioutil.ReadFile(h.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the private key of host %s: %v", h.name(), err)
+	}
+	if endpoint.signer, err = ssh.ParsePrivateKey(key); err != nil {
+		return nil, fmt.Errorf("error parsing the private key %s of host %s: %v", h.PrivateKeyPath, h.name(), err)
+	}
+	return endpoint, nil
+}
+
+// newWindowsVMFromInventory returns the Windows VMs of the hosts of the given inventory file, connected over WinRM and
+// ssh without any cloud provider. The hosts are used as they are: nothing is installed on them and they are not
+// destroyed by TearDown, and the operations needing a cloud provider, like Snapshot or Billing, return an error.
+func newWindowsVMFromInventory(path string) ([]WindowsVM, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory %s: %v", path, err)
+	}
+	inventory, err := ParseInventory(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %v", path, err)
+	}
+	vms := make([]WindowsVM, len(inventory.Hosts))
+	errs := make([]error, len(inventory.Hosts))
+	var wg sync.WaitGroup
+	for i := range inventory.Hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vms[i], errs[i] = newInventoryWindowsVM(&inventory.Hosts[i])
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to host %s of inventory %s: %v", inventory.Hosts[i].name(), path,
+				err)
+		}
+	}
+	return vms, nil
+}
+
+// newInventoryWindowsVM returns the Windows VM of the given inventory host, connected over the transports it can be
+// reached with
+func newInventoryWindowsVM(host *InventoryHost) (WindowsVM, error) {
+	endpoint, err := host.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	w := &windowsVM{
+		credentials: types.NewCredentials(host.name(), host.IP, host.Password, host.User),
+		link:        newLink(networkShape),
+		endpoint:    endpoint,
+	}
+	if err := w.setupWinRMClient(); err != nil {
+		return nil, fmt.Errorf("failed to setup winRM client: %v", err)
+	}
+	w.setSSHConnection(newSSHConnection(host.IP, w.dialSSH))
+	// The host is usable as long as one of WinRM and ssh works, the commands are run over the other one
+	if err := w.checkTransports(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// inventoryFromEnv returns the path of the inventory file given by E2E_INVENTORY, empty if not set
+func inventoryFromEnv() (string, error) {
+	path := os.Getenv(inventoryEnvVar)
+	if path == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", inventoryEnvVar, err)
+	}
+	return path, nil
+}
+
+// userName returns the user the commands are run as on the Windows VM
+func (w *windowsVM) userName() string {
+	if credentials := w.GetCredentials(); credentials != nil && credentials.GetUserName() != "" {
+		return credentials.GetUserName()
+	}
+	return user
+}
+
+// sshPort returns the port of the OpenSSH server
+func (e *vmEndpoint) sshPort() int {
+	if e == nil || e.sshPortOverride == 0 {
+		return defaultSSHPort
+	}
+	return e.sshPortOverride
+}
+
+// winRMPort returns the port of the WinRM listener
+func (e *vmEndpoint) winRMPort() int {
+	if e == nil || e.winRMPortOverride == 0 {
+		return winRMPort
+	}
+	return e.winRMPortOverride
+}
+
+// winRMOverHTTP returns true if the WinRM listener is unencrypted
+func (e *vmEndpoint) winRMOverHTTP() bool {
+	return e != nil && e.winRMHTTP
+}
+
+// sshAuth returns the methods authenticating over ssh with the given password and the private key if any
+func (e *vmEndpoint) sshAuth(password string) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if e != nil && e.signer != nil {
+		methods = append(methods, ssh.PublicKeys(e.signer))
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods
+}
@@ -0,0 +1,65 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseInventory tests that YAML and JSON inventories are parsed and that the hosts which cannot be reached are
+// rejected
+func TestParseInventory(t *testing.T) {
+	yamlInventory := `hosts:
+- name: lab-1
+  ip: 10.0.0.10
+  password: secret
+  winrmPort: 5985
+  winrmHTTP: true
+- ip: 10.0.0.11
+  user: admin
+  privateKeyPath: /keys/lab
+  sshPort: 2222
+`
+	inventory, err := ParseInventory([]byte(yamlInventory))
+	require.NoError(t, err)
+	require.Len(t, inventory.Hosts, 2)
+	assert.Equal(t, InventoryHost{Name: "lab-1", IP: "10.0.0.10", Password: "secret", WinRMPort: 5985,
+		WinRMHTTP: true}, inventory.Hosts[0])
+	assert.Equal(t, InventoryHost{IP: "10.0.0.11", User: "admin", PrivateKeyPath: "/keys/lab", SSHPort: 2222},
+		inventory.Hosts[1])
+	assert.Equal(t, "lab-1", inventory.Hosts[0].name())
+	assert.Equal(t, "10.0.0.11", inventory.Hosts[1].name())
+
+	inventory, err = ParseInventory([]byte(`{"hosts": [{"ip": "10.0.0.12", "password": "secret"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []InventoryHost{{IP: "10.0.0.12", Password: "secret"}}, inventory.Hosts)
+
+	for name, data := range map[string]string{
+		"no hosts":                `hosts: []`,
+		"no IP":                   `hosts: [{password: secret}]`,
+		"no credentials":          `hosts: [{ip: 10.0.0.10}]`,
+		"invalid port":            `hosts: [{ip: 10.0.0.10, password: secret, sshPort: 70000}]`,
+		"certificate without key": `hosts: [{ip: 10.0.0.10, password: secret, certificatePath: /keys/lab-cert.pub}]`,
+		"duplicate host":          `hosts: [{ip: 10.0.0.10, password: a}, {ip: 10.0.0.10, password: b}]`,
+		"unknown field":           `hosts: [{ip: 10.0.0.10, password: secret, port: 22}]`,
+	} {
+		_, err := ParseInventory([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+// TestVMEndpoint tests that the cloud VMs, which have no endpoint, are reached with the default ports and protocol
+func TestVMEndpoint(t *testing.T) {
+	var cloud *vmEndpoint
+	assert.Equal(t, defaultSSHPort, cloud.sshPort())
+	assert.Equal(t, winRMPort, cloud.winRMPort())
+	assert.False(t, cloud.winRMOverHTTP())
+	assert.Len(t, cloud.sshAuth("secret"), 1)
+
+	lab := &vmEndpoint{sshPortOverride: 2222, winRMPortOverride: 5985, winRMHTTP: true}
+	assert.Equal(t, 2222, lab.sshPort())
+	assert.Equal(t, 5985, lab.winRMPort())
+	assert.True(t, lab.winRMOverHTTP())
+	assert.Empty(t, lab.sshAuth(""))
+}
@@ -0,0 +1,94 @@
+package e2efw
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+// ErrStopStartUnsupported is returned by StopStart when the cloud provider of the Windows VM does not release its
+// addresses when stopped
+var ErrStopStartUnsupported = errors.New("stopping and starting the VM is only supported on AWS")
+
+// StopStart stops the Windows VM and starts it again, which releases its public IP address so that it comes back
+// with a new one, as a node whose DHCP lease changed would. The framework reconnects to the new address and the VM
+// is ready once it returns.
+func StopStart(vm WindowsVM) error {
+	return vm.handle().stopStart()
+}
+
+// stopStart implements StopStart
+func (w *windowsVM) stopStart() error {
+	awsCloud, ok := w.cloudProvider.(*aws.AwsProvider)
+	if !ok {
+		return ErrStopStartUnsupported
+	}
+	instanceID := w.GetCredentials().GetInstanceId()
+	oldIP := w.GetCredentials().GetIPAddress()
+	log.Printf("stopping %s at %s", instanceID, oldIP)
+	if err := stopInstance(awsCloud.EC2, instanceID); err != nil {
+		return err
+	}
+	instanceIDs := awssdk.StringSlice([]string{instanceID})
+	if _, err := awsCloud.EC2.StartInstances(&ec2.StartInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return fmt.Errorf("error starting instance %s: %v", instanceID, err)
+	}
+	if err := awsCloud.EC2.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return fmt.Errorf("error waiting for instance %s to run: %v", instanceID, err)
+	}
+	if err := w.reconnect(); err != nil {
+		return err
+	}
+	log.Printf("started %s at %s, previously %s", instanceID, w.GetCredentials().GetIPAddress(), oldIP)
+	return nil
+}
+
+// reconnect updates the credentials and the connections of the Windows VM once it was started again, as it gets a
+// new public IP then, and waits for it to be ready. The VM needs to be running.
+func (w *windowsVM) reconnect() error {
+	awsCloud, ok := w.cloudProvider.(*aws.AwsProvider)
+	if !ok {
+		return ErrStopStartUnsupported
+	}
+	instanceID := w.GetCredentials().GetInstanceId()
+	instance, err := awsCloud.GetInstance(instanceID)
+	if err != nil {
+		return fmt.Errorf("error getting instance %s: %v", instanceID, err)
+	}
+	if state := instance.State; state == nil || awssdk.StringValue(state.Name) != ec2.InstanceStateNameRunning {
+		return fmt.Errorf("instance %s is not running", instanceID)
+	}
+	credentials := types.NewCredentials(instanceID, awssdk.StringValue(instance.PublicIpAddress),
+		w.GetCredentials().GetPassword(), w.GetCredentials().GetUserName())
+	if credentials, err = privateCredentials(w.cloudProvider, credentials); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	w.credentials = credentials
+	w.lock.Unlock()
+	// The lost connections of the new ssh connection are reported with the new IP address
+	if w.ssh() != nil {
+		w.setSSHConnection(newSSHConnection(credentials.GetIPAddress(), w.dialSSH))
+	}
+	if err = w.setupWinRMClient(); err != nil {
+		return err
+	}
+	return w.waitForReady(Timeout(TestsPhase, rebootTimeout))
+}
+
+// stopInstance stops the given instance and waits until it is stopped
+func stopInstance(ec2Client *ec2.EC2, instanceID string) error {
+	instanceIDs := awssdk.StringSlice([]string{instanceID})
+	if _, err := ec2Client.StopInstances(&ec2.StopInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return fmt.Errorf("error stopping instance %s: %v", instanceID, err)
+	}
+	if err := ec2Client.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return fmt.Errorf("error waiting for instance %s to stop: %v", instanceID, err)
+	}
+	return nil
+}
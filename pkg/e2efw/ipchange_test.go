@@ -0,0 +1,15 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStopStartUnsupported tests that the VMs which are not on AWS, like the inventory hosts, are not stopped
+func TestStopStartUnsupported(t *testing.T) {
+	w := &windowsVM{credentials: types.NewCredentials("host", "10.0.0.5", "password", "Administrator")}
+	assert.Equal(t, ErrStopStartUnsupported, w.stopStart())
+	assert.Equal(t, "10.0.0.5", w.credentials.GetIPAddress(), "the address of the VM changed")
+}
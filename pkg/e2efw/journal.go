@@ -0,0 +1,60 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// remoteJournalPath is the location of the journal of the changes made by WMCB on the Windows VM
+const remoteJournalPath = remoteLogPath + "wmcb-journal.json"
+
+// JournalEntry is a change recorded by WMCB in its journal, mirroring the WMCB journal entries
+type JournalEntry struct {
+	// Time is when the change was made
+	Time time.Time `json:"time"`
+	// Command is the WMCB command that made the change
+	Command string `json:"command"`
+	// Action is the change made to the object: created, modified or removed
+	Action string `json:"action"`
+	// Kind is the kind of object changed, e.g. file, directory, service, registry or setting
+	Kind string `json:"kind"`
+	// Target identifies the object, e.g. its path or name
+	Target string `json:"target"`
+	// Detail is an optional human readable description of the change
+	Detail string `json:"detail,omitempty"`
+}
+
+// ChangeJournal returns the changes recorded by WMCB in its journal on the Windows VM, in the order they were made.
+// No entries are returned if WMCB has not made any change yet.
+func ChangeJournal(vm WindowsVM) ([]JournalEntry, error) {
+	return vm.handle().changeJournal()
+}
+
+// changeJournal implements ChangeJournal
+func (w *windowsVM) changeJournal() ([]JournalEntry, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("if (Test-Path "+PowerShellString(remoteJournalPath)+
+		") { Get-Content -Path "+PowerShellString(remoteJournalPath)+" }"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v, %s", remoteJournalPath, err, stderr)
+	}
+	return parseJournal(stdout)
+}
+
+// parseJournal parses the JSON lines of the WMCB journal, skipping empty lines
+func parseJournal(out string) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("could not parse journal line %d: %v", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
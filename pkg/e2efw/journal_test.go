@@ -0,0 +1,30 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseJournal tests that the journal lines read from the Windows VM are parsed in order
+func TestParseJournal(t *testing.T) {
+	entries, err := parseJournal("")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = parseJournal(`{"time":"2020-03-01T10:00:00Z","command":"initialize-kubelet","action":"created",` +
+		`"kind":"file","target":"C:\\k\\kubelet.exe","detail":"copied from C:\\tmp\\kubelet.exe"}` + "\r\n\r\n" +
+		`{"time":"2020-03-01T10:05:00Z","command":"uninstall","action":"removed","kind":"service","target":"kubelet"}` +
+		"\r\n")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "C:\\k\\kubelet.exe", entries[0].Target)
+	assert.Equal(t, "copied from C:\\tmp\\kubelet.exe", entries[0].Detail)
+	assert.Equal(t, "removed", entries[1].Action)
+	assert.Equal(t, "kubelet", entries[1].Target)
+
+	_, err = parseJournal(`{"command":"uninstall"}` + "\n{")
+	require.Error(t, err, "no error parsing truncated journal")
+	assert.Contains(t, err.Error(), "line 2")
+}
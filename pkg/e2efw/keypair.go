@@ -0,0 +1,312 @@
+package e2efw
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshKeysEnvVar is the environment variable holding the key pairs the Windows VMs are created with, in the format
+	// of the SSHKeys flag, when the test suite does not set them
+	sshKeysEnvVar = "E2E_SSH_KEYS"
+	// sshKeyEnvVar is the environment variable holding the name of an existing key pair to create the Windows VMs
+	// with, whose private key is given by KUBE_SSH_KEY_PATH. It is the single key pair form of E2E_SSH_KEYS.
+	sshKeyEnvVar = "E2E_SSH_KEY"
+	// privateKeyPathEnvVar is the environment variable holding the path of the private key of the existing key pair
+	privateKeyPathEnvVar = "KUBE_SSH_KEY_PATH"
+	// generatedKeyEntry is the entry of the SSHKeys flag standing for the key pair generated for the run
+	generatedKeyEntry = "generated"
+	// keyPairBits is the size of the generated keys, AWS decrypts the password of Windows instances with 2048-bit
+	// RSA keys
+	keyPairBits = 2048
+)
+
+var (
+	// generatedKeyPair is the key pair generated for the run, nil if only existing key pairs are used
+	generatedKeyPair *keyPair
+	// keyDir is the temporary directory the private keys held in memory are written to for WNI, which reads them from
+	// files. It is outside the artifact directory, so that the private keys are not published with the artifacts of
+	// the job. It is created with the first of them and removed in TearDown.
+	keyDir string
+	// keyDirLock guards keyDir
+	keyDirLock sync.Mutex
+)
+
+// SSHKey is a key pair the Windows VMs are created with, whose private key decrypts the password of the VMs
+type SSHKey struct {
+	// Name is the name of the key pair in the cloud
+	Name string
+	// PrivateKeyPath is the path of the PEM encoded private key of the key pair, empty if PrivateKey is given
+	PrivateKeyPath string
+	// PrivateKey is the PEM encoded private key of the key pair held in memory, if PrivateKeyPath is not given
+	PrivateKey []byte
+	// Generated is set for the key pair generated for the run, which is imported in the cloud when the VMs are created
+	// and deleted in TearDown. Its name and private key are set once it is generated.
+	Generated bool
+
+	// lock guards path
+	lock sync.Mutex
+	// path is the file the private key held in memory is written to, empty until it is
+	path string
+}
+
+// String returns the name of the key pair, without its private key
+func (k *SSHKey) String() string {
+	if k.Generated && k.Name == "" {
+		return generatedKeyEntry
+	}
+	return k.Name
+}
+
+// validate returns an error if the key pair has no name or its private key cannot be parsed
+func (k *SSHKey) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("key pair without a name")
+	}
+	key := k.PrivateKey
+	if k.PrivateKeyPath != "" {
+		var err error
+		if key, err = ioutil.ReadFile(k.PrivateKeyPath); err != nil {
+			return fmt.Errorf("error reading the private key of key pair %s: %v", k.Name, err)
+		}
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("key pair %s has no private key", k.Name)
+	}
+	if _, err := ssh.ParseRawPrivateKey(key); err != nil {
+		return fmt.Errorf("error parsing the private key of key pair %s: %v", k.Name, err)
+	}
+	return nil
+}
+
+// privateKeyFile returns the path of the private key of the key pair, which WNI reads the private key from. The
+// private key held in memory is written to the key directory the first time.
+func (k *SSHKey) privateKeyFile() (string, error) {
+	if k.PrivateKeyPath != "" {
+		return k.PrivateKeyPath, nil
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.path != "" {
+		return k.path, nil
+	}
+	dir, err := ensureKeyDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, k.Name+".pem")
+	// The private key is not encrypted, as WNI reads it as is to decrypt the password of the VMs
+	if err = ioutil.WriteFile(path, k.PrivateKey, 0600); err != nil {
+		return "", fmt.Errorf("error writing the private key of key pair %s: %v", k.Name, err)
+	}
+	k.path = path
+	return path, nil
+}
+
+// ensureKeyDir returns the key directory, creating it if needed
+func ensureKeyDir() (string, error) {
+	keyDirLock.Lock()
+	defer keyDirLock.Unlock()
+	if keyDir == "" {
+		dir, err := ioutil.TempDir("", "e2e-key-pair")
+		if err != nil {
+			return "", fmt.Errorf("error creating the directory of the private keys: %v", err)
+		}
+		keyDir = dir
+	}
+	return keyDir, nil
+}
+
+// SSHKeys are the key pairs the Windows VMs are created with. When there are several, the VMs use them in turn, the
+// VM i using the key pair i modulo their number, so that VMs created with different key pairs can be mixed in a run.
+type SSHKeys []*SSHKey
+
+// Set populates the key pairs from a comma separated list of <key pair name>=<private key path> entries, e.g.
+// win-2019=/keys/win-2019.pem, in which the generated entry stands for a key pair generated for the run
+func (k *SSHKeys) Set(value string) error {
+	if value == "" {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		if entry == generatedKeyEntry {
+			if names[generatedKeyEntry] {
+				return fmt.Errorf("only one key pair can be generated for the run")
+			}
+			names[generatedKeyEntry] = true
+			*k = append(*k, &SSHKey{Generated: true})
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid key pair %s, expected <key pair name>=<private key path> or %s", entry,
+				generatedKeyEntry)
+		}
+		if names[kv[0]] {
+			return fmt.Errorf("duplicate key pair %s", kv[0])
+		}
+		names[kv[0]] = true
+		*k = append(*k, &SSHKey{Name: kv[0], PrivateKeyPath: kv[1]})
+	}
+	return nil
+}
+
+// String returns the names of the key pairs. This is required for SSHKeys to be used with flags.
+func (k *SSHKeys) String() string {
+	var names []string
+	for _, key := range *k {
+		names = append(names, key.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// forVM returns the key pair the VM of the given index is created with, nil if there is none
+func (k SSHKeys) forVM(i int) *SSHKey {
+	if len(k) == 0 {
+		return nil
+	}
+	return k[i%len(k)]
+}
+
+// sshKeysFromEnv returns the key pairs given by E2E_SSH_KEYS, or else by E2E_SSH_KEY and KUBE_SSH_KEY_PATH. A key pair
+// is generated for the run if none is given.
+func sshKeysFromEnv() (SSHKeys, error) {
+	var keys SSHKeys
+	if err := keys.Set(os.Getenv(sshKeysEnvVar)); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", sshKeysEnvVar, err)
+	}
+	if len(keys) > 0 {
+		return keys, nil
+	}
+	if name := os.Getenv(sshKeyEnvVar); name != "" {
+		path := os.Getenv(privateKeyPathEnvVar)
+		if path == "" {
+			return nil, fmt.Errorf("%s environment variable not set, it is required with %s", privateKeyPathEnvVar,
+				sshKeyEnvVar)
+		}
+		return SSHKeys{{Name: name, PrivateKeyPath: path}}, nil
+	}
+	return SSHKeys{{Generated: true}}, nil
+}
+
+// keyPair is a key pair generated for the run, deleted in TearDown
+type keyPair struct {
+	// name is the name of the key pair on AWS
+	name string
+	// ec2 is the client the key pair was imported with
+	ec2 *ec2.EC2
+}
+
+// setupKeyPairs returns the key pairs the Windows VMs are created with: the given ones, or else the ones given by the
+// environment. The key pair standing for the one generated for the run, if any, is generated and imported, so that no
+// key pair has to be created in the account beforehand. The private keys of the others are checked.
+func setupKeyPairs(keys SSHKeys) (SSHKeys, error) {
+	if len(keys) == 0 {
+		var err error
+		if keys, err = sshKeysFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range keys {
+		if key.Generated && key.Name == "" {
+			if err := generateKeyPair(key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// generateKeyPair generates the given key pair for the run and imports it on AWS. Its private key is kept in memory.
+func generateKeyPair(key *SSHKey) error {
+	cloud, err := cloudprovider.CloudProviderFactory(kubeconfig, awsCredentials, "default", artifactDir, "", "", "",
+		"")
+	if err != nil {
+		return fmt.Errorf("error instantiating cloud provider %v", err)
+	}
+	awsCloud, ok := cloud.(*aws.AwsProvider)
+	if !ok {
+		return fmt.Errorf("key pairs can only be generated on AWS, set %s, or %s and %s, to use existing key pairs",
+			sshKeysEnvVar, sshKeyEnvVar, privateKeyPathEnvVar)
+	}
+	infraID, err := awsCloud.GetInfraID()
+	if err != nil {
+		return err
+	}
+	privateKey, authorizedKey, err := generateKey()
+	if err != nil {
+		return err
+	}
+	name := keyPairName(infraID, runID)
+	_, err = awsCloud.EC2.ImportKeyPair(&ec2.ImportKeyPairInput{KeyName: awssdk.String(name),
+		PublicKeyMaterial: authorizedKey})
+	if err != nil {
+		return fmt.Errorf("error importing key pair %s: %v", name, err)
+	}
+	generatedKeyPair = &keyPair{name: name, ec2: awsCloud.EC2}
+	key.Name = name
+	key.PrivateKey = privateKey
+	log.Printf("generated key pair %s for the Windows VMs", name)
+	return nil
+}
+
+// keyPairName returns the name of the key pair generated for a run against the cluster with the given infrastructure
+// ID, with the given run ID
+func keyPairName(infraID, runID string) string {
+	return fmt.Sprintf("%s-e2e-%s", infraID, runID)
+}
+
+// generateKey generates an RSA key and returns its PEM encoded private key and its public key in the OpenSSH
+// authorized_keys format, which AWS imports key pairs from
+func generateKey() ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyPairBits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating RSA key: %v", err)
+	}
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error converting public key: %v", err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return privateKey, ssh.MarshalAuthorizedKey(publicKey), nil
+}
+
+// deleteKeyPair deletes the key pair generated for the run, if any, and the private keys written to the key
+// directory. Failures are logged, as the tear down goes on regardless.
+func deleteKeyPair() {
+	keyDirLock.Lock()
+	if keyDir != "" {
+		if err := os.RemoveAll(keyDir); err != nil {
+			log.Printf("failed to delete the private keys in %s: %v", keyDir, err)
+		}
+		keyDir = ""
+	}
+	keyDirLock.Unlock()
+	if generatedKeyPair == nil {
+		return
+	}
+	_, err := generatedKeyPair.ec2.DeleteKeyPair(&ec2.DeleteKeyPairInput{KeyName: awssdk.String(generatedKeyPair.name)})
+	if err != nil {
+		log.Printf("failed to delete key pair %s: %v", generatedKeyPair.name, err)
+	}
+	generatedKeyPair = nil
+}
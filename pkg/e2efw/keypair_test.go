@@ -0,0 +1,133 @@
+package e2efw
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestKeyPairName tests that the generated key pairs are named after the cluster
+func TestKeyPairName(t *testing.T) {
+	assert.Equal(t, "mycluster-x7k2p-e2e-abcde", keyPairName("mycluster-x7k2p", "abcde"))
+}
+
+// TestGenerateKey tests that the private key is written unencrypted, as WNI reads it as is, and that the public key
+// matches it in the format AWS imports
+func TestGenerateKey(t *testing.T) {
+	privateKey, authorizedKey, err := generateKey()
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(privateKey)
+	require.NotNil(t, block)
+	assert.False(t, x509.IsEncryptedPEMBlock(block))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, keyPairBits, key.N.BitLen())
+
+	assert.True(t, bytes.HasPrefix(authorizedKey, []byte("ssh-rsa ")))
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	require.NoError(t, err)
+	expected, err := ssh.NewPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Marshal(), publicKey.Marshal())
+}
+
+// TestSSHKeysSet tests the parsing of the key pairs given by the -sshKeys flag
+func TestSSHKeysSet(t *testing.T) {
+	var keys SSHKeys
+	require.NoError(t, keys.Set("win-2019=/keys/win-2019.pem,generated,win-20h2=/keys/win-20h2.pem"))
+	require.Len(t, keys, 3)
+	assert.Equal(t, &SSHKey{Name: "win-2019", PrivateKeyPath: "/keys/win-2019.pem"}, keys[0])
+	assert.Equal(t, &SSHKey{Generated: true}, keys[1])
+	assert.Equal(t, "win-2019,generated,win-20h2", keys.String())
+
+	for _, invalid := range []string{"win-2019", "win-2019=", "=/keys/win-2019.pem", "generated,generated",
+		"win-2019=/keys/a.pem,win-2019=/keys/b.pem"} {
+		var keys SSHKeys
+		assert.Error(t, keys.Set(invalid), invalid)
+	}
+}
+
+// TestSSHKeysForVM tests that the VMs use the key pairs in turn
+func TestSSHKeysForVM(t *testing.T) {
+	keys := SSHKeys{{Name: "win-2019"}, {Name: "generated-key"}}
+	assert.Equal(t, "win-2019", keys.forVM(0).Name)
+	assert.Equal(t, "generated-key", keys.forVM(1).Name)
+	assert.Equal(t, "win-2019", keys.forVM(4).Name)
+	assert.Nil(t, SSHKeys(nil).forVM(0))
+}
+
+// TestSSHKeysFromEnv tests that E2E_SSH_KEYS takes precedence over the single key pair of E2E_SSH_KEY, and that a key
+// pair is generated if none is given
+func TestSSHKeysFromEnv(t *testing.T) {
+	for _, envVar := range []string{sshKeysEnvVar, sshKeyEnvVar, privateKeyPathEnvVar} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+		require.NoError(t, os.Setenv(envVar, ""))
+	}
+	keys, err := sshKeysFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, SSHKeys{{Generated: true}}, keys)
+
+	require.NoError(t, os.Setenv(sshKeyEnvVar, "win-2019"))
+	_, err = sshKeysFromEnv()
+	assert.Error(t, err, "KUBE_SSH_KEY_PATH is required with E2E_SSH_KEY")
+	require.NoError(t, os.Setenv(privateKeyPathEnvVar, "/keys/win-2019.pem"))
+	keys, err = sshKeysFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, SSHKeys{{Name: "win-2019", PrivateKeyPath: "/keys/win-2019.pem"}}, keys)
+
+	require.NoError(t, os.Setenv(sshKeysEnvVar, "generated,win-20h2=/keys/win-20h2.pem"))
+	keys, err = sshKeysFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "generated,win-20h2", keys.String())
+}
+
+// TestSSHKeyPrivateKeyFile tests that the private keys are checked, and that the ones held in memory are written to
+// the key directory once, readable by their owner only, and deleted in the tear down
+func TestSSHKeyPrivateKeyFile(t *testing.T) {
+	privateKey, _, err := generateKey()
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "win-2019.pem")
+	require.NoError(t, ioutil.WriteFile(path, privateKey, 0600))
+
+	onDisk := &SSHKey{Name: "win-2019", PrivateKeyPath: path}
+	require.NoError(t, onDisk.validate())
+	file, err := onDisk.privateKeyFile()
+	require.NoError(t, err)
+	assert.Equal(t, path, file)
+
+	inMemory := &SSHKey{Name: "win-20h2", PrivateKey: privateKey}
+	require.NoError(t, inMemory.validate())
+	file, err = inMemory.privateKeyFile()
+	require.NoError(t, err)
+	defer deleteKeyPair()
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	contents, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, privateKey, contents)
+	again, err := inMemory.privateKeyFile()
+	require.NoError(t, err)
+	assert.Equal(t, file, again)
+
+	deleteKeyPair()
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err), "the private key held in memory was not deleted")
+
+	assert.Error(t, (&SSHKey{Name: "win-2019", PrivateKeyPath: filepath.Join(dir, "missing.pem")}).validate())
+	assert.Error(t, (&SSHKey{Name: "win-2019", PrivateKey: []byte("not a key")}).validate())
+	assert.Error(t, (&SSHKey{Name: "win-2019"}).validate())
+	assert.Error(t, (&SSHKey{PrivateKey: privateKey}).validate())
+}
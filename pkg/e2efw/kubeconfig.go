@@ -0,0 +1,187 @@
+package e2efw
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// apiServerCABundleEnvVar is the environment variable holding the path of a PEM bundle of the CAs the API server
+	// certificates may be signed by in addition to the CAs of the kubeconfigs, e.g. the CA of an on-prem environment
+	apiServerCABundleEnvVar = "E2E_API_SERVER_CA_BUNDLE"
+	// execAPIVersionV1 is the version of the exec credential plugin API the client of the framework does not support
+	execAPIVersionV1 = "client.authentication.k8s.io/v1"
+	// execAPIVersionV1beta1 is the latest version of the exec credential plugin API the client of the framework
+	// supports, which the plugins of the v1 API serve as well when requested
+	execAPIVersionV1beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+var (
+	// preparedKubeconfigsLock protects preparedKubeconfigs
+	preparedKubeconfigsLock sync.Mutex
+	// preparedKubeconfigs are the kubeconfigs written by prepareKubeconfig, removed once the run is done
+	preparedKubeconfigs []string
+)
+
+// prepareKubeconfig returns the path of a kubeconfig equivalent to the one of the given path, which the clients of the
+// framework and of WNI can use. Client certificates and custom CAs are supported as they are, but the kubeconfig is
+// rewritten to a temporary file, only readable by the user, when:
+//   - its exec credential plugins request the v1 API, which the client does not support, in which case they are
+//     requested the v1beta1 API instead
+//   - its exec credential plugin commands are relative paths, which the client would run from the working directory
+//     rather than from the directory of the kubeconfig
+//   - E2E_API_SERVER_CA_BUNDLE is set, in which case its CAs are trusted by every cluster in addition to the CA of the
+//     cluster. The clusters without a CA, which trust the system roots, then trust the bundle only.
+//
+// The relative paths of the rewritten kubeconfig are made absolute. The given path is returned if the kubeconfig needs
+// no change.
+func prepareKubeconfig(path string) (string, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to load kubeconfig %s: %v", path, err)
+	}
+	caBundle, err := apiServerCABundleFromEnv()
+	if err != nil {
+		return "", err
+	}
+	changed, err := adaptKubeconfig(config, filepath.Dir(path), caBundle)
+	if err != nil || !changed {
+		return path, err
+	}
+
+	// The kubeconfig is converted to its v1 form and marshalled with encoding/json, which, unlike the codec of
+	// clientcmd.Write, supports the map extensions of every Go release
+	var v1Config clientcmdapiv1.Config
+	if err = clientcmdlatest.Scheme.Convert(config, &v1Config, nil); err != nil {
+		return "", fmt.Errorf("unable to convert the prepared kubeconfig: %v", err)
+	}
+	v1Config.APIVersion, v1Config.Kind = clientcmdapiv1.SchemeGroupVersion.Version, "Config"
+	content, err := yaml.Marshal(v1Config)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal the prepared kubeconfig: %v", err)
+	}
+	file, err := ioutil.TempFile("", "e2e-kubeconfig")
+	if err != nil {
+		return "", fmt.Errorf("unable to create the prepared kubeconfig: %v", err)
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("unable to write the prepared kubeconfig: %v", err)
+	}
+	preparedKubeconfigsLock.Lock()
+	defer preparedKubeconfigsLock.Unlock()
+	preparedKubeconfigs = append(preparedKubeconfigs, file.Name())
+	return file.Name(), nil
+}
+
+// adaptKubeconfig requests the v1beta1 API from the exec credential plugins of the given kubeconfig requesting the v1
+// API, and adds the CAs of the given bundle, if any, to the CAs of its clusters. The relative paths of the kubeconfig
+// are resolved against its location and, for the plugin commands, against the given directory. It returns whether
+// the kubeconfig has to be rewritten for the client to use it.
+func adaptKubeconfig(config *clientcmdapi.Config, dir string, caBundle []byte) (bool, error) {
+	if err := clientcmd.ResolveLocalPaths(config); err != nil {
+		return false, fmt.Errorf("unable to resolve the paths of the kubeconfig: %v", err)
+	}
+	changed := false
+	for name, authInfo := range config.AuthInfos {
+		exec := authInfo.Exec
+		if exec == nil {
+			continue
+		}
+		if exec.APIVersion == execAPIVersionV1 {
+			log.Printf("requesting %s instead of %s from the exec credential plugin of user %s", execAPIVersionV1beta1,
+				execAPIVersionV1, name)
+			exec.APIVersion = execAPIVersionV1beta1
+			changed = true
+		}
+		// A command with a path separator is relative to the kubeconfig, a command without one is looked up in PATH
+		if strings.ContainsAny(exec.Command, `/\`) && !filepath.IsAbs(exec.Command) {
+			exec.Command = filepath.Join(dir, exec.Command)
+			changed = true
+		}
+	}
+
+	if len(caBundle) == 0 {
+		return changed, nil
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.InsecureSkipTLSVerify {
+			continue
+		}
+		ca := cluster.CertificateAuthorityData
+		if cluster.CertificateAuthority != "" {
+			var err error
+			if ca, err = ioutil.ReadFile(cluster.CertificateAuthority); err != nil {
+				return false, fmt.Errorf("unable to read the CA of cluster %s: %v", name, err)
+			}
+		}
+		if len(ca) > 0 && !bytes.HasSuffix(ca, []byte("\n")) {
+			ca = append(ca, '\n')
+		}
+		cluster.CertificateAuthorityData = append(ca, caBundle...)
+		cluster.CertificateAuthority = ""
+	}
+	return true, nil
+}
+
+// apiServerCABundleFromEnv returns the PEM bundle of the CAs given by E2E_API_SERVER_CA_BUNDLE, nil if it is not set
+func apiServerCABundleFromEnv() ([]byte, error) {
+	path := os.Getenv(apiServerCABundleEnvVar)
+	if path == "" {
+		return nil, nil
+	}
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", apiServerCABundleEnvVar, err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("invalid %s: %s holds no PEM certificate", apiServerCABundleEnvVar, path)
+	}
+	return bundle, nil
+}
+
+// removePreparedKubeconfigs removes the kubeconfigs written by prepareKubeconfig
+func removePreparedKubeconfigs() {
+	preparedKubeconfigsLock.Lock()
+	defer preparedKubeconfigsLock.Unlock()
+	for _, path := range preparedKubeconfigs {
+		os.Remove(path)
+	}
+	preparedKubeconfigs = nil
+}
+
+// authMethod describes how the given config authenticates to the API server, to tell what failed when it cannot
+func authMethod(config *restclient.Config) string {
+	switch {
+	case config.ExecProvider != nil:
+		return "the exec credential plugin " + config.ExecProvider.Command
+	case config.AuthProvider != nil:
+		return "the auth provider " + config.AuthProvider.Name
+	case config.CertFile != "" || len(config.CertData) > 0:
+		return "a client certificate"
+	case config.BearerToken != "" || config.BearerTokenFile != "":
+		return "a bearer token"
+	case config.Username != "":
+		return "basic authentication"
+	default:
+		return "no credentials"
+	}
+}
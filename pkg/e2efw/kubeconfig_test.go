@@ -0,0 +1,141 @@
+package e2efw
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// testKubeconfig authenticates with an exec credential plugin of the v1 API, relative to the kubeconfig, and a client
+// certificate, against a cluster whose CA is a file relative to the kubeconfig
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: onprem
+  cluster:
+    server: https://api.onprem.example.com:6443
+    certificate-authority: ca.crt
+- name: insecure
+  cluster:
+    server: https://api.insecure.example.com:6443
+    insecure-skip-tls-verify: true
+users:
+- name: sso
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: ./bin/get-token
+      interactiveMode: Never
+- name: admin
+  user:
+    client-certificate: admin.crt
+    client-key: admin.key
+contexts:
+- name: onprem
+  context:
+    cluster: onprem
+    user: sso
+current-context: onprem
+`
+
+// testCA returns a self-signed CA certificate as PEM
+func testCA(t *testing.T, name string) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// TestPrepareKubeconfig tests that the exec credential plugins of the v1 API are requested the v1beta1 API, that the
+// relative paths are resolved against the kubeconfig and that the CA bundle is trusted in addition to the cluster CA
+func TestPrepareKubeconfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clusterCA, bundle := testCA(t, "cluster"), testCA(t, "on-prem")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.crt"), clusterCA, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bundle.crt"), bundle, 0600))
+	path := filepath.Join(dir, "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testKubeconfig), 0600))
+	defer os.Setenv(apiServerCABundleEnvVar, os.Getenv(apiServerCABundleEnvVar))
+	os.Setenv(apiServerCABundleEnvVar, filepath.Join(dir, "bundle.crt"))
+	defer removePreparedKubeconfigs()
+
+	prepared, err := prepareKubeconfig(path)
+	require.NoError(t, err)
+	assert.NotEqual(t, path, prepared)
+	config, err := clientcmd.LoadFromFile(prepared)
+	require.NoError(t, err)
+	exec := config.AuthInfos["sso"].Exec
+	assert.Equal(t, execAPIVersionV1beta1, exec.APIVersion)
+	assert.Equal(t, filepath.Join(dir, "bin", "get-token"), exec.Command)
+	assert.Equal(t, filepath.Join(dir, "admin.crt"), config.AuthInfos["admin"].ClientCertificate)
+	assert.Empty(t, config.Clusters["onprem"].CertificateAuthority)
+	assert.Equal(t, string(clusterCA)+string(bundle), string(config.Clusters["onprem"].CertificateAuthorityData))
+	assert.Empty(t, config.Clusters["insecure"].CertificateAuthorityData)
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", prepared)
+	require.NoError(t, err, "the client supports the prepared kubeconfig")
+	assert.Equal(t, "the exec credential plugin "+exec.Command, authMethod(restConfig))
+
+	removePreparedKubeconfigs()
+	_, err = os.Stat(prepared)
+	assert.True(t, os.IsNotExist(err))
+
+	// A bundle without certificates is invalid
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bundle.crt"), []byte("not a certificate"), 0600))
+	_, err = prepareKubeconfig(path)
+	assert.Error(t, err)
+}
+
+// TestPrepareKubeconfigUnchanged tests that a kubeconfig the client supports as is is not rewritten
+func TestPrepareKubeconfigUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://api.example.com:6443
+    certificate-authority: ca.crt
+users:
+- name: admin
+  user:
+    token: sha256~token
+`), 0600))
+	defer os.Setenv(apiServerCABundleEnvVar, os.Getenv(apiServerCABundleEnvVar))
+	os.Unsetenv(apiServerCABundleEnvVar)
+
+	prepared, err := prepareKubeconfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, prepared)
+	_, err = prepareKubeconfig(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+// TestAuthMethod tests the description of the authentication methods of the client configs
+func TestAuthMethod(t *testing.T) {
+	assert.Equal(t, "a client certificate", authMethod(&restclient.Config{
+		TLSClientConfig: restclient.TLSClientConfig{CertFile: "admin.crt", KeyFile: "admin.key"}}))
+	assert.Equal(t, "a bearer token", authMethod(&restclient.Config{BearerToken: "token"}))
+	assert.Equal(t, "no credentials", authMethod(&restclient.Config{}))
+}
@@ -0,0 +1,319 @@
+package e2efw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// vmLeaseDurationEnvVar is the environment variable holding how long a run leases the Windows VMs given by their
+	// credentials or inventory, e.g. 3h. The VMs are not leased if it is not set.
+	vmLeaseDurationEnvVar = "E2E_VM_LEASE_DURATION"
+	// vmLeaseWaitEnvVar is the environment variable holding how long a run waits for the VMs leased by another run,
+	// e.g. 30m, 0 to fail right away
+	vmLeaseWaitEnvVar = "E2E_VM_LEASE_WAIT"
+	// vmLeaseKubeconfigEnvVar is the environment variable holding the kubeconfig of the cluster the leases are held in,
+	// so that runs against different clusters can share a pool of VMs, the kubeconfig of the run if not set
+	vmLeaseKubeconfigEnvVar = "E2E_VM_LEASE_KUBECONFIG"
+	// vmLeaseNamespaceEnvVar is the environment variable holding the namespace of the leases, default if not set
+	vmLeaseNamespaceEnvVar = "E2E_VM_LEASE_NAMESPACE"
+	// VMLeaseLabel labels the ConfigMaps holding the leases of the Windows VMs
+	VMLeaseLabel = "e2e.openshift.io/vm-lease"
+	// vmLeasePrefix prefixes the names of the ConfigMaps holding the leases
+	vmLeasePrefix = "windows-e2e-lease-"
+	// vmLeasePollInterval is the interval the leases held by another run are checked at while waiting for them
+	vmLeasePollInterval = 30 * time.Second
+
+	// The keys of the data of the ConfigMap of a lease
+	leaseHostKey     = "host"
+	leaseHolderKey   = "holder"
+	leaseAcquiredKey = "acquired"
+	leaseExpiresKey  = "expires"
+)
+
+// invalidLeaseNameChars matches the characters of a host which are not valid in the name of a ConfigMap
+var invalidLeaseNameChars = regexp.MustCompile(`[^a-z0-9.-]`)
+
+// VMLeaseConfig tells whether and how the Windows VMs given by their credentials or inventory are leased, so that two
+// runs sharing a pool of long-lived VMs do not configure the same VM at the same time
+type VMLeaseConfig struct {
+	// Duration is how long a run holds the VMs, after which another run may take them over. The VMs are not leased if
+	// it is 0.
+	Duration time.Duration
+	// Wait is how long a run waits for the VMs held by another run, 0 to fail right away
+	Wait time.Duration
+	// Kubeconfig is the kubeconfig of the cluster the leases are held in
+	Kubeconfig string
+	// Namespace is the namespace of the ConfigMaps holding the leases
+	Namespace string
+}
+
+// VMLease is the exclusive access of a run to a Windows VM until it expires
+type VMLease struct {
+	// Host is the IP address of the leased VM
+	Host string
+	// Holder identifies the run holding the lease, i.e. its run ID and the host it runs on
+	Holder string
+	// Acquired is when the lease was acquired
+	Acquired time.Time
+	// Expires is when the lease expires
+	Expires time.Time
+	// namespace and name are the ones of the ConfigMap holding the lease
+	namespace, name string
+}
+
+// LeaseHeldError is the error of a lease held by another run
+type LeaseHeldError struct {
+	// Lease is the lease held
+	Lease VMLease
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("VM %s is leased by %s until %s", e.Lease.Host, e.Lease.Holder,
+		e.Lease.Expires.Format(time.RFC3339))
+}
+
+// vmLeaseConfigFromEnv returns the lease configuration given by E2E_VM_LEASE_DURATION, E2E_VM_LEASE_WAIT,
+// E2E_VM_LEASE_KUBECONFIG and E2E_VM_LEASE_NAMESPACE, the VMs not being leased if the duration is not set
+func vmLeaseConfigFromEnv() (VMLeaseConfig, error) {
+	config := VMLeaseConfig{Kubeconfig: os.Getenv(vmLeaseKubeconfigEnvVar), Namespace: v1.NamespaceDefault}
+	if namespace := strings.TrimSpace(os.Getenv(vmLeaseNamespaceEnvVar)); namespace != "" {
+		config.Namespace = namespace
+	}
+	for _, setting := range []struct {
+		envVar string
+		value  *time.Duration
+	}{{vmLeaseDurationEnvVar, &config.Duration}, {vmLeaseWaitEnvVar, &config.Wait}} {
+		value := strings.TrimSpace(os.Getenv(setting.envVar))
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return VMLeaseConfig{}, fmt.Errorf("invalid %s %s, expected a duration, e.g. 3h", setting.envVar, value)
+		}
+		*setting.value = duration
+	}
+	return config, nil
+}
+
+// leaseHolder returns the identity of the run holding the leases: its run ID and the host it runs on, so that the
+// engineer or CI job holding a VM can be told
+func leaseHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return runID + "@" + hostname
+}
+
+// vmLeaseName returns the name of the ConfigMap holding the lease of the given host
+func vmLeaseName(host string) string {
+	name := vmLeasePrefix + strings.Trim(invalidLeaseNameChars.ReplaceAllString(strings.ToLower(host), "-"), "-.")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
+
+// parseVMLease returns the lease held by the given ConfigMap
+func parseVMLease(configMap *v1.ConfigMap) (*VMLease, error) {
+	lease := &VMLease{Host: configMap.Data[leaseHostKey], Holder: configMap.Data[leaseHolderKey],
+		namespace: configMap.Namespace, name: configMap.Name}
+	var err error
+	if lease.Acquired, err = time.Parse(time.RFC3339, configMap.Data[leaseAcquiredKey]); err != nil {
+		return nil, fmt.Errorf("invalid lease %s/%s: %v", configMap.Namespace, configMap.Name, err)
+	}
+	if lease.Expires, err = time.Parse(time.RFC3339, configMap.Data[leaseExpiresKey]); err != nil {
+		return nil, fmt.Errorf("invalid lease %s/%s: %v", configMap.Namespace, configMap.Name, err)
+	}
+	return lease, nil
+}
+
+// setData sets the data of the given ConfigMap to the lease
+func (l *VMLease) setData(configMap *v1.ConfigMap) {
+	configMap.Labels = map[string]string{VMLeaseLabel: "true"}
+	configMap.Data = map[string]string{
+		leaseHostKey:     l.Host,
+		leaseHolderKey:   l.Holder,
+		leaseAcquiredKey: l.Acquired.UTC().Format(time.RFC3339),
+		leaseExpiresKey:  l.Expires.UTC().Format(time.RFC3339),
+	}
+}
+
+// AcquireVMLease leases the Windows VM of the given host to the given holder for the given duration, in a ConfigMap of
+// the given namespace. The lease is acquired if the VM is not leased, if its lease expired or if it is already held by
+// the holder, in which case it is extended. It returns a *LeaseHeldError if the VM is leased by another holder. The
+// updates of the ConfigMap are conditioned on its resource version, so that of two runs acquiring the lease at the same
+// time, only one gets it, the other one getting an AlreadyExists or Conflict error.
+func AcquireVMLease(client kubernetes.Interface, namespace, host, holder string,
+	duration time.Duration) (*VMLease, error) {
+	now := clk.Now().Truncate(time.Second)
+	lease := &VMLease{Host: host, Holder: holder, Acquired: now, Expires: now.Add(duration), namespace: namespace,
+		name: vmLeaseName(host)}
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(lease.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: lease.name, Namespace: namespace}}
+		lease.setData(configMap)
+		if _, err = configMaps.Create(configMap); err != nil {
+			return nil, acquireError(host, err)
+		}
+		return lease, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting the lease of VM %s: %v", host, err)
+	}
+	// A lease which cannot be parsed is taken over, as nothing tells whether it is still held
+	if held, err := parseVMLease(configMap); err != nil {
+		log.Printf("taking over the lease of VM %s: %v", host, err)
+	} else if held.Holder != holder && now.Before(held.Expires) {
+		return nil, &LeaseHeldError{Lease: *held}
+	} else if held.Holder == holder {
+		lease.Acquired = held.Acquired
+	} else {
+		log.Printf("taking over the lease of VM %s held by %s, which expired at %s", host, held.Holder,
+			held.Expires.Format(time.RFC3339))
+		notify(NotifyGC, nil, "took over the lease of VM %s held by %s, which expired at %s", host, held.Holder,
+			held.Expires.Format(time.RFC3339))
+	}
+	lease.setData(configMap)
+	if _, err = configMaps.Update(configMap); err != nil {
+		return nil, acquireError(host, err)
+	}
+	return lease, nil
+}
+
+// acquireError returns the error acquiring the lease of the given host, which is returned as is if another run
+// created or updated the lease since it was read, so that it can be told by apierrors.IsAlreadyExists and
+// apierrors.IsConflict
+func acquireError(host string, err error) error {
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		return err
+	}
+	return fmt.Errorf("error acquiring the lease of VM %s: %v", host, err)
+}
+
+// ReleaseVMLease releases the given lease, unless it was taken over by another holder once it expired
+func ReleaseVMLease(client kubernetes.Interface, lease *VMLease) error {
+	configMaps := client.CoreV1().ConfigMaps(lease.namespace)
+	configMap, err := configMaps.Get(lease.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting the lease of VM %s: %v", lease.Host, err)
+	}
+	if held, err := parseVMLease(configMap); err == nil && held.Holder != lease.Holder {
+		return fmt.Errorf("the lease of VM %s expired at %s and was taken over by %s", lease.Host,
+			lease.Expires.Format(time.RFC3339), held.Holder)
+	}
+	// The lease is only deleted if it was not taken over since it was read
+	resourceVersion := configMap.ResourceVersion
+	err = configMaps.Delete(lease.name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error releasing the lease of VM %s: %v", lease.Host, err)
+	}
+	return nil
+}
+
+// acquireVMLeases leases the Windows VMs of the given hosts to the holder for the duration of the given configuration,
+// waiting for the ones leased by other runs up to its wait time. The hosts are leased in order, so that two runs
+// waiting for the same VMs do not each hold some of them. Either all the VMs are leased or none is.
+func acquireVMLeases(client kubernetes.Interface, config VMLeaseConfig, holder string,
+	hosts []string) ([]*VMLease, error) {
+	hosts = append([]string{}, hosts...)
+	sort.Strings(hosts)
+	// Without a wait, the leases updated by another run at the same time are still checked again once
+	timeout := config.Wait
+	if timeout == 0 {
+		timeout = vmLeasePollInterval
+	}
+	var leases []*VMLease
+	for _, host := range hosts {
+		var lease *VMLease
+		err := Poll(context.Background(), "the lease of VM "+host, PollOptions{Interval: vmLeasePollInterval,
+			Timeout: timeout, Jitter: DefaultPollJitter}, func() (bool, string, error) {
+			var err error
+			lease, err = AcquireVMLease(client, config.Namespace, host, holder, config.Duration)
+			if held, ok := err.(*LeaseHeldError); ok {
+				if config.Wait == 0 {
+					return false, "", held
+				}
+				return false, held.Error(), nil
+			}
+			// The lease updated by another run since it was read is checked again
+			if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+				return false, err.Error(), nil
+			}
+			return err == nil, "", err
+		})
+		if err != nil {
+			for _, acquired := range leases {
+				if releaseErr := ReleaseVMLease(client, acquired); releaseErr != nil {
+					log.Print(releaseErr)
+				}
+			}
+			return nil, err
+		}
+		log.Printf("VM %s leased by %s until %s", host, holder, lease.Expires.Format(time.RFC3339))
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// leaseVMs leases the Windows VMs of the given hosts, given by their credentials or inventory, if
+// E2E_VM_LEASE_DURATION is set
+func (f *TestFramework) leaseVMs(hosts []string) error {
+	config, err := vmLeaseConfigFromEnv()
+	if err != nil || config.Duration == 0 {
+		return err
+	}
+	if config.Kubeconfig == "" {
+		config.Kubeconfig = kubeconfig
+	} else if config.Kubeconfig, err = prepareKubeconfig(config.Kubeconfig); err != nil {
+		return err
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", config.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to build config from the kubeconfig of the leases: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("unable to get the kube client of the leases: %v", err)
+	}
+	if f.vmLeases, err = acquireVMLeases(client, config, leaseHolder(), hosts); err != nil {
+		return fmt.Errorf("unable to lease the Windows VMs: %v", err)
+	}
+	f.leaseClient = client
+	return nil
+}
+
+// releaseVMLeases releases the leases of the Windows VMs held by the run, logging those which expired during the run
+func (f *TestFramework) releaseVMLeases() {
+	for _, lease := range f.vmLeases {
+		if clk.Now().After(lease.Expires) {
+			log.Printf("the lease of VM %s expired at %s, before the end of the run", lease.Host,
+				lease.Expires.Format(time.RFC3339))
+		}
+		if err := ReleaseVMLease(f.leaseClient, lease); err != nil {
+			log.Print(err)
+			continue
+		}
+		log.Printf("VM %s released", lease.Host)
+	}
+	f.vmLeases = nil
+}
@@ -0,0 +1,131 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestAcquireVMLease tests that a VM is leased exclusively until its lease expires, and that a lease taken over once
+// expired is not released by its former holder
+func TestAcquireVMLease(t *testing.T) {
+	fakeClock, restore := useFakeClock()
+	defer restore()
+	client := fake.NewSimpleClientset()
+
+	lease, err := AcquireVMLease(client, "default", "10.0.0.1", "alice@laptop", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, fakeClock.Now().Add(time.Hour), lease.Expires)
+	configMap, err := client.CoreV1().ConfigMaps("default").Get("windows-e2e-lease-10.0.0.1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "alice@laptop", configMap.Data[leaseHolderKey])
+	assert.Equal(t, "true", configMap.Labels[VMLeaseLabel])
+
+	_, err = AcquireVMLease(client, "default", "10.0.0.1", "bob@ci", time.Hour)
+	require.IsType(t, &LeaseHeldError{}, err)
+	assert.EqualError(t, err, "VM 10.0.0.1 is leased by alice@laptop until 2021-01-01T01:00:00Z")
+
+	// The holder extends its lease
+	fakeClock.Sleep(30 * time.Minute)
+	extended, err := AcquireVMLease(client, "default", "10.0.0.1", "alice@laptop", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, lease.Acquired, extended.Acquired)
+	assert.Equal(t, fakeClock.Now().Add(time.Hour), extended.Expires)
+
+	// Once expired, the lease is taken over, and not released by its former holder
+	fakeClock.Sleep(2 * time.Hour)
+	taken, err := AcquireVMLease(client, "default", "10.0.0.1", "bob@ci", time.Hour)
+	require.NoError(t, err)
+	assert.EqualError(t, ReleaseVMLease(client, extended),
+		"the lease of VM 10.0.0.1 expired at 2021-01-01T01:30:00Z and was taken over by bob@ci")
+	require.NoError(t, ReleaseVMLease(client, taken))
+	_, err = client.CoreV1().ConfigMaps("default").Get("windows-e2e-lease-10.0.0.1", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	// Releasing a released lease is not an error
+	assert.NoError(t, ReleaseVMLease(client, taken))
+}
+
+// TestAcquireVMLeases tests that either all the VMs are leased or none is, and that the VMs leased by another run are
+// waited for
+func TestAcquireVMLeases(t *testing.T) {
+	fakeClock, restore := useFakeClock()
+	defer restore()
+	client := fake.NewSimpleClientset()
+	_, err := AcquireVMLease(client, "default", "10.0.0.2", "bob@ci", 10*time.Minute)
+	require.NoError(t, err)
+
+	config := VMLeaseConfig{Duration: time.Hour, Namespace: "default"}
+	_, err = acquireVMLeases(client, config, "alice@laptop", []string{"10.0.0.2", "10.0.0.1"})
+	require.IsType(t, &LeaseHeldError{}, err)
+	_, err = client.CoreV1().ConfigMaps("default").Get("windows-e2e-lease-10.0.0.1", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the lease of 10.0.0.1 is not released")
+
+	config.Wait = 30 * time.Minute
+	start := fakeClock.Now()
+	leases, err := acquireVMLeases(client, config, "alice@laptop", []string{"10.0.0.2", "10.0.0.1"})
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, "10.0.0.1", leases[0].Host)
+	assert.Equal(t, "10.0.0.2", leases[1].Host)
+	assert.True(t, fakeClock.Now().Sub(start) >= 10*time.Minute, "the lease of 10.0.0.2 was not waited for")
+}
+
+// TestAcquireVMLeasesConflict tests that a lease updated by another run since it was read is checked again
+func TestAcquireVMLeasesConflict(t *testing.T) {
+	_, restore := useFakeClock()
+	defer restore()
+	client := fake.NewSimpleClientset()
+	_, err := AcquireVMLease(client, "default", "10.0.0.1", "bob@ci", -time.Minute)
+	require.NoError(t, err)
+	conflicts := 0
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		conflicts++
+		return conflicts == 1, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"},
+			"windows-e2e-lease-10.0.0.1", nil)
+	})
+
+	leases, err := acquireVMLeases(client, VMLeaseConfig{Duration: time.Hour, Namespace: "default"},
+		"alice@laptop", []string{"10.0.0.1"})
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	assert.Equal(t, 2, conflicts)
+}
+
+// TestVMLeaseConfigFromEnv tests the parsing of the lease environment variables
+func TestVMLeaseConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv(vmLeaseDurationEnvVar)
+	defer os.Unsetenv(vmLeaseWaitEnvVar)
+	defer os.Unsetenv(vmLeaseNamespaceEnvVar)
+
+	config, err := vmLeaseConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, VMLeaseConfig{Namespace: v1.NamespaceDefault}, config)
+
+	os.Setenv(vmLeaseDurationEnvVar, "3h")
+	os.Setenv(vmLeaseWaitEnvVar, "30m")
+	os.Setenv(vmLeaseNamespaceEnvVar, "windows-pool")
+	config, err = vmLeaseConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, VMLeaseConfig{Duration: 3 * time.Hour, Wait: 30 * time.Minute, Namespace: "windows-pool"}, config)
+
+	os.Setenv(vmLeaseWaitEnvVar, "-1m")
+	_, err = vmLeaseConfigFromEnv()
+	assert.Error(t, err)
+}
+
+// TestVMLeaseName tests that the names of the leases are valid ConfigMap names
+func TestVMLeaseName(t *testing.T) {
+	assert.Equal(t, "windows-e2e-lease-10.0.0.1", vmLeaseName("10.0.0.1"))
+	assert.Equal(t, "windows-e2e-lease-win-lab-01.example.com", vmLeaseName("WIN_LAB_01.example.com"))
+	assert.Equal(t, "windows-e2e-lease-fe80--1", vmLeaseName("[fe80::1]"))
+}
@@ -0,0 +1,542 @@
+package e2efw
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// loadLabel is the label of the pods created by the load generator, holding the name of the load
+	loadLabel = "windows-load"
+	// loadPollInterval is the interval at which the load generator checks the state of its pods
+	loadPollInterval = time.Second
+	// loadPodGracePeriod is the termination grace period of the load pods
+	loadPodGracePeriod = 5
+	// maxLoadErrors is the number of errors kept in the load report, the others are only counted
+	maxLoadErrors = 100
+	// hnsEventLog is the Windows event log the Host Network Service reports its errors to
+	hnsEventLog = "Microsoft-Windows-Host-Network-Service-Admin"
+	// defaultLoadPodTimeout is the default time given to the load pods to become ready, and to be deleted
+	defaultLoadPodTimeout = 10 * time.Minute
+)
+
+// The components the errors of the load are attributed to
+const (
+	kubeletComponent = "kubelet"
+	hnsComponent     = "hns"
+)
+
+// The sources the errors of the load are collected from
+const (
+	podEventSource    = "pod-event"
+	kubeletLogSource  = "kubelet-log"
+	hnsEventLogSource = "hns-event-log"
+)
+
+// klogErrorRegex matches an error line of the kubelet log, capturing its source location and message, e.g.
+// E0612 10:11:12.123456    1234 pod_workers.go:191] Error syncing pod
+var klogErrorRegex = regexp.MustCompile(`^E\d{4} \S+\s+\d+ ([^\]]+)\] (.*)$`)
+
+// LoadConfig configures the load generated on a Windows node
+type LoadConfig struct {
+	// Name prefixes the names of the load pods
+	Name string
+	// NodeName is the name of the node the load pods are run on
+	NodeName string
+	// Image is the Windows container image of the load pods, which needs to match the Windows build of the node
+	Image string
+	// Pods is the number of load pods run at once on the node
+	Pods int
+	// ChurnRate is the number of load pods replaced per second once the churn is ramped up
+	ChurnRate float64
+	// RampUp is the time the churn takes to increase linearly to ChurnRate
+	RampUp time.Duration
+	// Duration is the time the pods are churned for, including the ramp up. The pods are not churned if it is 0.
+	Duration time.Duration
+	// PodTimeout is the time given to the load pods to become ready and to be deleted, defaultLoadPodTimeout if 0
+	PodTimeout time.Duration
+}
+
+// LoadError is an error reported by the node while under load
+type LoadError struct {
+	// Time is when the error was reported
+	Time time.Time `json:"time"`
+	// Component is the component the error is attributed to, kubelet or hns
+	Component string `json:"component"`
+	// Source is where the error was collected from: pod-event, kubelet-log or hns-event-log
+	Source string `json:"source"`
+	// Pod is the load pod the error is about, if known
+	Pod string `json:"pod,omitempty"`
+	// Message is the error message
+	Message string `json:"message"`
+}
+
+// LoadReport is the outcome of the load generated on a node
+type LoadReport struct {
+	// Context is the context of the run, with the Windows build of the node
+	Context RunContext `json:"context"`
+	// Node is the name of the node
+	Node string `json:"node"`
+	// Pods is the number of load pods run at once
+	Pods int `json:"pods"`
+	// PodsCreated is the number of load pods created, including the replacements
+	PodsCreated int `json:"podsCreated"`
+	// PodsReplaced is the number of load pods replaced by the churn
+	PodsReplaced int `json:"podsReplaced"`
+	// PodsNeverReady is the number of load pods that did not become ready before being deleted or timing out
+	PodsNeverReady int `json:"podsNeverReady"`
+	// PeakChurnRate is the number of load pods replaced per second once the churn was ramped up
+	PeakChurnRate float64 `json:"peakChurnRate"`
+	// StartupSeconds summarizes the time from the creation of each load pod to it being ready
+	StartupSeconds DurationSummary `json:"startupSeconds"`
+	// DeletionSeconds summarizes the time from the deletion of each load pod to it being gone
+	DeletionSeconds DurationSummary `json:"deletionSeconds"`
+	// ErrorCounts is the number of errors per component
+	ErrorCounts map[string]int `json:"errorCounts"`
+	// Errors are the first maxLoadErrors errors reported by the node
+	Errors []LoadError `json:"errors"`
+}
+
+// loadPod is the lifecycle of a load pod, as observed by the load generator
+type loadPod struct {
+	created time.Time
+	ready   time.Time
+	deleted time.Time
+	gone    time.Time
+}
+
+// loadGenerator runs the load pods on a node and records their lifecycle and the errors of the node
+type loadGenerator struct {
+	f      *TestFramework
+	vm     WindowsVM
+	config LoadConfig
+	// start is when the load generation started
+	start time.Time
+	// lock guards the fields below
+	lock sync.Mutex
+	// pods holds the lifecycle of the load pods by name
+	pods map[string]*loadPod
+	// created is the number of load pods created so far, used to name them
+	created int
+	// errorCounts is the number of errors per component
+	errorCounts map[string]int
+	// errors are the first maxLoadErrors errors
+	errors []LoadError
+}
+
+// GenerateLoad runs config.Pods load pods at once on the node, then replaces them at a rate ramping up to
+// config.ChurnRate for config.Duration, and finally deletes them. The startup and deletion times of the pods are
+// reported, along with the kubelet and HNS errors of the node over the run, collected from the pod events, the kubelet
+// log and the HNS event log of the given VM of the node. An error is only returned if the load could not be generated,
+// the errors of the node are left to the caller to assess.
+func (f *TestFramework) GenerateLoad(vm WindowsVM, config LoadConfig) (*LoadReport, error) {
+	if config.Name == "" || config.NodeName == "" || config.Image == "" {
+		return nil, fmt.Errorf("the name, node and image of the load are required")
+	}
+	if config.Pods <= 0 {
+		return nil, fmt.Errorf("invalid number of load pods %d", config.Pods)
+	}
+	if config.Duration > 0 && config.ChurnRate <= 0 {
+		return nil, fmt.Errorf("invalid churn rate %v", config.ChurnRate)
+	}
+	if config.PodTimeout == 0 {
+		config.PodTimeout = defaultLoadPodTimeout
+	}
+	g := &loadGenerator{
+		f:           f,
+		vm:          vm,
+		config:      config,
+		start:       time.Now(),
+		pods:        make(map[string]*loadPod),
+		errorCounts: make(map[string]int),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		g.track(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		g.tailKubeletLog(ctx)
+	}()
+
+	err := g.run()
+	cancel()
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if err = g.collectPodEvents(); err != nil {
+		log.Printf("error collecting the events of the load pods: %v", err)
+	}
+	if err = g.collectHNSErrors(); err != nil {
+		log.Printf("error collecting the HNS errors: %v", err)
+	}
+	report := g.report()
+	report.Context = RunContextOf(vm)
+	return report, nil
+}
+
+// run creates the load pods, churns them and deletes them, always deleting them if an error occurs
+func (g *loadGenerator) run() error {
+	defer g.deleteAll()
+
+	var active []string
+	for i := 0; i < g.config.Pods; i++ {
+		name, err := g.createPod()
+		if err != nil {
+			return err
+		}
+		active = append(active, name)
+	}
+	if err := g.waitForReady(active); err != nil {
+		return err
+	}
+	log.Printf("%d load pods are running on node %s", len(active), g.config.NodeName)
+
+	churnStart := time.Now()
+	for elapsed := time.Duration(0); elapsed < g.config.Duration; elapsed = time.Since(churnStart) {
+		time.Sleep(churnInterval(g.config.ChurnRate, g.config.RampUp, elapsed))
+		if err := g.deletePod(active[0]); err != nil {
+			return err
+		}
+		name, err := g.createPod()
+		if err != nil {
+			return err
+		}
+		active = append(active[1:], name)
+	}
+	// The node needs to recover from the churn
+	return g.waitForReady(active)
+}
+
+// churnInterval returns the time between two pod replacements after the given time of churn, the rate increasing
+// linearly from its first step to the given peak rate over the ramp up
+func churnInterval(peakRate float64, rampUp, elapsed time.Duration) time.Duration {
+	rate := peakRate
+	if elapsed < rampUp {
+		// Start from the rate of the first second, rather than 0
+		rate = peakRate * float64(elapsed+time.Second) / float64(rampUp+time.Second)
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// createPod creates a new load pod on the node and returns its name
+func (g *loadGenerator) createPod() (string, error) {
+	g.lock.Lock()
+	name := fmt.Sprintf("%s-%d", g.config.Name, g.created)
+	g.created++
+	g.lock.Unlock()
+
+	gracePeriod := int64(loadPodGracePeriod)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: RunLabels(map[string]string{loadLabel: g.config.Name}),
+		},
+		Spec: v1.PodSpec{
+			// The pods are bound to the node directly, the load is on the node and not on the scheduler
+			NodeName: g.config.NodeName,
+			Tolerations: []v1.Toleration{
+				{Key: "os", Value: "Windows", Effect: v1.TaintEffectNoSchedule},
+			},
+			TerminationGracePeriodSeconds: &gracePeriod,
+			RestartPolicy:                 v1.RestartPolicyNever,
+			Containers: []v1.Container{
+				{
+					Name:            "load",
+					Image:           g.config.Image,
+					ImagePullPolicy: v1.PullIfNotPresent,
+					Command:         []string{"powershell.exe", "-command", "while ($true) { Start-Sleep 1 }"},
+				},
+			},
+		},
+	}
+	created := time.Now()
+	if _, err := g.f.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Create(pod); err != nil {
+		return "", fmt.Errorf("error creating load pod %s: %v", name, err)
+	}
+	g.lock.Lock()
+	g.pods[name] = &loadPod{created: created}
+	g.lock.Unlock()
+	return name, nil
+}
+
+// deletePod deletes the given load pod
+func (g *loadGenerator) deletePod(name string) error {
+	deleted := time.Now()
+	err := g.f.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting load pod %s: %v", name, err)
+	}
+	g.lock.Lock()
+	g.pods[name].deleted = deleted
+	g.lock.Unlock()
+	return nil
+}
+
+// deleteAll deletes all the load pods and waits until they are gone, including the ones replaced by the churn
+func (g *loadGenerator) deleteAll() {
+	g.lock.Lock()
+	var names, toDelete []string
+	for name, pod := range g.pods {
+		names = append(names, name)
+		if pod.deleted.IsZero() {
+			toDelete = append(toDelete, name)
+		}
+	}
+	g.lock.Unlock()
+	for _, name := range toDelete {
+		if err := g.deletePod(name); err != nil {
+			log.Print(err)
+		}
+	}
+	if err := g.waitFor(func(pod *loadPod) bool { return !pod.gone.IsZero() }, names); err != nil {
+		log.Printf("load pods were not deleted: %v", err)
+	}
+}
+
+// waitForReady waits until the given load pods are ready
+func (g *loadGenerator) waitForReady(names []string) error {
+	return g.waitFor(func(pod *loadPod) bool { return !pod.ready.IsZero() }, names)
+}
+
+// waitFor waits until the given condition is true for all the given load pods, as observed by track
+func (g *loadGenerator) waitFor(condition func(*loadPod) bool, names []string) error {
+	for start := time.Now(); ; time.Sleep(loadPollInterval) {
+		var pending []string
+		g.lock.Lock()
+		for _, name := range names {
+			if !condition(g.pods[name]) {
+				pending = append(pending, name)
+			}
+		}
+		g.lock.Unlock()
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Since(start) > g.config.PodTimeout {
+			return fmt.Errorf("timeout waiting for %d load pods, e.g. %s", len(pending), pending[0])
+		}
+	}
+}
+
+// track records when the load pods become ready and when the deleted ones are gone, until the context is cancelled
+func (g *loadGenerator) track(ctx context.Context) {
+	ticker := time.NewTicker(loadPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		podList, err := g.f.K8sclientset.CoreV1().Pods(v1.NamespaceDefault).List(metav1.ListOptions{
+			LabelSelector: loadLabel + "=" + g.config.Name + "," + RunIDLabel + "=" + runID})
+		if err != nil {
+			log.Printf("error listing the load pods: %v", err)
+			continue
+		}
+		now := time.Now()
+		existing := make(map[string]bool)
+		g.lock.Lock()
+		for _, pod := range podList.Items {
+			existing[pod.Name] = true
+			if tracked, ok := g.pods[pod.Name]; ok && tracked.ready.IsZero() && IsPodReady(&pod) {
+				tracked.ready = now
+			}
+		}
+		for name, tracked := range g.pods {
+			if !existing[name] && !tracked.deleted.IsZero() && tracked.gone.IsZero() {
+				tracked.gone = now
+			}
+		}
+		g.lock.Unlock()
+	}
+}
+
+// IsPodReady returns true if the given pod is running and ready
+func IsPodReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// tailKubeletLog records the errors of the kubelet log of the node until the context is cancelled
+func (g *loadGenerator) tailKubeletLog(ctx context.Context) {
+	reader, writer := io.Pipe()
+	go func() {
+		err := TailFile(g.vm, ctx, remoteLogPath+"kubelet.log", writer)
+		if err != nil {
+			log.Printf("kubelet errors of the load are not recorded: %v", err)
+		}
+		writer.CloseWithError(err)
+	}()
+	// The log is tailed from its beginning, only the errors of the load are recorded
+	for _, loadErr := range parseKubeletErrors(reader, time.Now(), g.start) {
+		g.recordError(loadErr)
+	}
+}
+
+// parseKubeletErrors returns the errors of the kubelet log read from the given reader, which are logged from the given
+// time on. klog does not log the year, so the lines are assumed to be from the year of now.
+func parseKubeletErrors(reader io.Reader, now, from time.Time) []LoadError {
+	var loadErrs []LoadError
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		matches := klogErrorRegex.FindStringSubmatch(line)
+		if matches == nil || len(line) < 21 {
+			continue
+		}
+		// The header starts with Emmdd hh:mm:ss.uuuuuu
+		logged, err := time.ParseInLocation("0102 15:04:05.000000", line[1:21], time.Local)
+		if err != nil {
+			continue
+		}
+		logged = logged.AddDate(now.Year(), 0, 0)
+		if logged.Before(from) {
+			continue
+		}
+		loadErrs = append(loadErrs, LoadError{
+			Time:      logged,
+			Component: errorComponent(matches[2]),
+			Source:    kubeletLogSource,
+			Message:   matches[1] + "] " + matches[2],
+		})
+	}
+	return loadErrs
+}
+
+// collectPodEvents records the warning events of the load pods
+func (g *loadGenerator) collectPodEvents() error {
+	events, err := g.f.K8sclientset.CoreV1().Events(v1.NamespaceDefault).List(metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,type=" + v1.EventTypeWarning})
+	if err != nil {
+		return err
+	}
+	for _, event := range events.Items {
+		g.lock.Lock()
+		_, isLoadPod := g.pods[event.InvolvedObject.Name]
+		g.lock.Unlock()
+		if !isLoadPod || event.LastTimestamp.Time.Before(g.start) {
+			continue
+		}
+		g.recordError(LoadError{
+			Time:      event.LastTimestamp.Time,
+			Component: errorComponent(event.Message),
+			Source:    podEventSource,
+			Pod:       event.InvolvedObject.Name,
+			Message:   event.Reason + ": " + event.Message,
+		})
+	}
+	return nil
+}
+
+// collectHNSErrors records the errors of the HNS event log of the node since the start of the load
+func (g *loadGenerator) collectHNSErrors() error {
+	cmd := fmt.Sprintf("Get-WinEvent -ErrorAction SilentlyContinue -FilterHashtable @{LogName='%s'; Level=1,2; "+
+		"StartTime=[datetime]'%s'} | ForEach-Object { $_.TimeCreated.ToUniversalTime().ToString('o') + \"`t\" + "+
+		"($_.Message -replace \"`r?`n\", ' ') }", hnsEventLog, g.start.UTC().Format(time.RFC3339))
+	stdout, stderr, err := g.vm.Run(PowerShellScript(cmd), true)
+	if err != nil {
+		return fmt.Errorf("error getting the %s events: %v\n%s", hnsEventLog, err, stderr)
+	}
+	for _, loadErr := range parseHNSEvents(stdout) {
+		g.recordError(loadErr)
+	}
+	return nil
+}
+
+// parseHNSEvents returns the errors of the HNS event log, given as lines of the event time and its message separated
+// by a tab
+func parseHNSEvents(output string) []LoadError {
+	var loadErrs []LoadError
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		logged, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			continue
+		}
+		loadErrs = append(loadErrs, LoadError{
+			Time:      logged,
+			Component: hnsComponent,
+			Source:    hnsEventLogSource,
+			Message:   fields[1],
+		})
+	}
+	return loadErrs
+}
+
+// errorComponent returns the component an error message is attributed to: the errors about HNS networks and
+// endpoints, which the kubelet and the CNI plugins report, are attributed to HNS
+func errorComponent(message string) string {
+	lower := strings.ToLower(message)
+	if strings.Contains(lower, "hns") || strings.Contains(lower, "hcn") {
+		return hnsComponent
+	}
+	return kubeletComponent
+}
+
+// recordError counts the given error and keeps it if fewer than maxLoadErrors errors were kept
+func (g *loadGenerator) recordError(loadErr LoadError) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.errorCounts[loadErr.Component]++
+	if len(g.errors) < maxLoadErrors {
+		g.errors = append(g.errors, loadErr)
+	}
+}
+
+// report aggregates the lifecycle of the load pods and the errors of the node
+func (g *loadGenerator) report() *LoadReport {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	report := &LoadReport{
+		Node:          g.config.NodeName,
+		Pods:          g.config.Pods,
+		PodsCreated:   len(g.pods),
+		PodsReplaced:  len(g.pods) - g.config.Pods,
+		PeakChurnRate: g.config.ChurnRate,
+		ErrorCounts:   g.errorCounts,
+		Errors:        g.errors,
+	}
+	var startups, deletions []time.Duration
+	for _, pod := range g.pods {
+		if pod.ready.IsZero() {
+			report.PodsNeverReady++
+		} else {
+			startups = append(startups, pod.ready.Sub(pod.created))
+		}
+		if !pod.gone.IsZero() {
+			deletions = append(deletions, pod.gone.Sub(pod.deleted))
+		}
+	}
+	report.StartupSeconds = SummarizeDurations(startups)
+	report.DeletionSeconds = SummarizeDurations(deletions)
+	return report
+}
@@ -0,0 +1,94 @@
+package e2efw
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChurnInterval tests that the churn ramps up linearly to its peak rate
+func TestChurnInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		rampUp   time.Duration
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		{"no ramp up", 0, 0, 500 * time.Millisecond},
+		{"start of ramp up", 59 * time.Second, 0, 30 * time.Second},
+		{"middle of ramp up", 59 * time.Second, 29 * time.Second, time.Second},
+		{"end of ramp up", 59 * time.Second, 59 * time.Second, 500 * time.Millisecond},
+		{"after ramp up", 59 * time.Second, 5 * time.Minute, 500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, churnInterval(2, test.rampUp, test.elapsed))
+		})
+	}
+}
+
+// TestParseKubeletErrors tests that only the error lines of the kubelet log logged during the load are returned
+func TestParseKubeletErrors(t *testing.T) {
+	kubeletLog := `I0612 10:00:00.000000    1234 kubelet.go:1822] SyncLoop (ADD, "api"): "load-0_default"
+E0612 09:59:59.000000    1234 kubelet.go:2187] Container runtime network not ready
+E0612 10:00:01.500000    1234 pod_workers.go:191] Error syncing pod load-0: network is not ready
+E0612 10:00:02.000000    1234 cni.go:385] Error adding pod load-1 to network: hnsCall failed in Win32: The object already exists.
+W0612 10:00:03.000000    1234 docker_sandbox.go:394] failed to read pod IP from plugin/docker
+E0612 truncated
+`
+	from := time.Date(2020, 6, 12, 10, 0, 0, 0, time.Local)
+	loadErrs := parseKubeletErrors(strings.NewReader(kubeletLog), from.Add(time.Hour), from)
+	require.Len(t, loadErrs, 2)
+
+	assert.Equal(t, time.Date(2020, 6, 12, 10, 0, 1, 500000000, time.Local), loadErrs[0].Time)
+	assert.Equal(t, kubeletComponent, loadErrs[0].Component)
+	assert.Equal(t, kubeletLogSource, loadErrs[0].Source)
+	assert.Equal(t, "pod_workers.go:191] Error syncing pod load-0: network is not ready", loadErrs[0].Message)
+	assert.Equal(t, hnsComponent, loadErrs[1].Component)
+}
+
+// TestParseHNSEvents tests the parsing of the HNS event log errors
+func TestParseHNSEvents(t *testing.T) {
+	output := "2020-06-12T10:00:01.1234567Z\tHNS failed to create endpoint. Error: 0x803b0013\r\n" +
+		"\r\n" +
+		"not an event\r\n"
+	loadErrs := parseHNSEvents(output)
+	require.Len(t, loadErrs, 1)
+	assert.Equal(t, LoadError{
+		Time:      time.Date(2020, 6, 12, 10, 0, 1, 123456700, time.UTC),
+		Component: hnsComponent,
+		Source:    hnsEventLogSource,
+		Message:   "HNS failed to create endpoint. Error: 0x803b0013",
+	}, loadErrs[0])
+}
+
+// TestLoadReport tests the aggregation of the lifecycle of the load pods and of the errors
+func TestLoadReport(t *testing.T) {
+	start := time.Now()
+	g := &loadGenerator{
+		config: LoadConfig{NodeName: "node", Pods: 2, ChurnRate: 0.5},
+		pods: map[string]*loadPod{
+			"load-0": {created: start, ready: start.Add(10 * time.Second), deleted: start.Add(time.Minute),
+				gone: start.Add(time.Minute + 5*time.Second)},
+			"load-1": {created: start, ready: start.Add(20 * time.Second)},
+			"load-2": {created: start.Add(time.Minute), deleted: start.Add(2 * time.Minute)},
+		},
+		errorCounts: make(map[string]int),
+	}
+	for i := 0; i < maxLoadErrors+1; i++ {
+		g.recordError(LoadError{Component: hnsComponent})
+	}
+	g.recordError(LoadError{Component: kubeletComponent})
+
+	report := g.report()
+	assert.Equal(t, 3, report.PodsCreated)
+	assert.Equal(t, 1, report.PodsReplaced)
+	assert.Equal(t, 1, report.PodsNeverReady)
+	assert.Equal(t, DurationSummary{Count: 2, Min: 10, P50: 10, P90: 20, Max: 20}, report.StartupSeconds)
+	assert.Equal(t, DurationSummary{Count: 1, Min: 5, P50: 5, P90: 5, Max: 5}, report.DeletionSeconds)
+	assert.Equal(t, map[string]int{hnsComponent: maxLoadErrors + 1, kubeletComponent: 1}, report.ErrorCounts)
+	assert.Len(t, report.Errors, maxLoadErrors)
+}
@@ -0,0 +1,67 @@
+package e2efw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+)
+
+// ErrLoadBalancerUnsupported is returned by LoadBalancerMember when the load balancers of the cloud provider of the
+// Windows VM cannot be inspected
+var ErrLoadBalancerUnsupported = errors.New("the load balancer membership is only checked on AWS")
+
+// LoadBalancerMember returns true if the instance of the Windows VM is registered with the classic AWS load balancer
+// of the given hostname, the ingress hostname of a LoadBalancer service. The service controller registers the
+// instances of the nodes it finds by their provider ID.
+func LoadBalancerMember(vm WindowsVM, hostname string) (bool, error) {
+	return vm.handle().loadBalancerMember(hostname)
+}
+
+// loadBalancerMember implements LoadBalancerMember
+func (w *windowsVM) loadBalancerMember(hostname string) (bool, error) {
+	awsCloud, ok := w.cloudProvider.(*aws.AwsProvider)
+	if !ok {
+		return false, ErrLoadBalancerUnsupported
+	}
+	name, err := classicLoadBalancerName(hostname)
+	if err != nil {
+		return false, err
+	}
+	session, err := awssession.NewSession(awsCloud.EC2.Config.Copy())
+	if err != nil {
+		return false, fmt.Errorf("error creating the ELB session: %v", err)
+	}
+	out, err := elb.New(session).DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{
+		LoadBalancerNames: []*string{awssdk.String(name)}})
+	if err != nil {
+		return false, fmt.Errorf("error describing load balancer %s: %v", name, err)
+	}
+	instanceID := w.GetCredentials().GetInstanceId()
+	for _, lb := range out.LoadBalancerDescriptions {
+		for _, instance := range lb.Instances {
+			if awssdk.StringValue(instance.InstanceId) == instanceID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// classicLoadBalancerName returns the name of the classic AWS load balancer of the given hostname, e.g. a1b2c3 for
+// a1b2c3-1234567890.us-east-1.elb.amazonaws.com or internal-a1b2c3-1234567890.us-east-1.elb.amazonaws.com
+func classicLoadBalancerName(hostname string) (string, error) {
+	if !strings.HasSuffix(hostname, ".elb.amazonaws.com") {
+		return "", fmt.Errorf("%s is not the hostname of a classic AWS load balancer", hostname)
+	}
+	label := strings.TrimPrefix(strings.SplitN(hostname, ".", 2)[0], "internal-")
+	i := strings.LastIndex(label, "-")
+	if i <= 0 {
+		return "", fmt.Errorf("%s is not the hostname of a classic AWS load balancer", hostname)
+	}
+	return label[:i], nil
+}
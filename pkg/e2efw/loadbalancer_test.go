@@ -0,0 +1,25 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClassicLoadBalancerName tests that the name of a classic AWS load balancer is read from its hostname, internal
+// or not
+func TestClassicLoadBalancerName(t *testing.T) {
+	name, err := classicLoadBalancerName("a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6-1234567890.us-east-1.elb.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6", name)
+	name, err = classicLoadBalancerName("internal-a1b2c3-987654321.us-west-2.elb.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "a1b2c3", name)
+
+	for _, hostname := range []string{"a1b2c3-1234567890.elb.us-east-1.example.com",
+		"a1b2c3.us-east-1.elb.amazonaws.com", "10.0.1.20"} {
+		_, err = classicLoadBalancerName(hostname)
+		assert.Error(t, err, "load balancer name read from %s", hostname)
+	}
+}
@@ -0,0 +1,126 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+)
+
+// remoteLogRotationConfigPath is the location of the log rotation configuration written by WMCB on the Windows VM
+const remoteLogRotationConfigPath = "C:\\k\\log-rotation.json"
+
+// backupTimeRegex matches the time of the rotation WMCB appends to the name of the backups of a log file
+var backupTimeRegex = regexp.MustCompile(`^-\d{8}T\d{6}$`)
+
+// LogTarget is the set of log files of a node component rotated by WMCB, mirroring the WMCB log rotation targets
+type LogTarget struct {
+	// Name is the name of the component, e.g. kubelet
+	Name string `json:"name"`
+	// Patterns are the glob patterns of the log files of the component
+	Patterns []string `json:"patterns"`
+}
+
+// LogRotationConfig is the log rotation configuration written by WMCB, mirroring the WMCB configuration file
+type LogRotationConfig struct {
+	// MaxSize is the size in bytes above which a log file is rotated
+	MaxSize int64 `json:"maxSize"`
+	// MaxAge is how long the backups are kept, as a Go duration
+	MaxAge string `json:"maxAge"`
+	// MaxBackups is the number of backups kept per log file, 0 to keep them all
+	MaxBackups int `json:"maxBackups"`
+	// Interval is the time between two rotations, as a Go duration
+	Interval string `json:"interval"`
+	// Targets are the log files rotated
+	Targets []LogTarget `json:"targets"`
+}
+
+// Target returns the target of the given component, or nil if its logs are not rotated
+func (c *LogRotationConfig) Target(name string) *LogTarget {
+	for i := range c.Targets {
+		if c.Targets[i].Name == name {
+			return &c.Targets[i]
+		}
+	}
+	return nil
+}
+
+// MaxAgeDuration returns the maximum age of the backups
+func (c *LogRotationConfig) MaxAgeDuration() (time.Duration, error) {
+	return time.ParseDuration(c.MaxAge)
+}
+
+// IntervalDuration returns the time between two rotations
+func (c *LogRotationConfig) IntervalDuration() (time.Duration, error) {
+	return time.ParseDuration(c.Interval)
+}
+
+// LogRotationConfigOf returns the log rotation configuration written by WMCB on the Windows VM, or nil if log rotation
+// has not been configured
+func LogRotationConfigOf(vm WindowsVM) (*LogRotationConfig, error) {
+	return vm.handle().logRotationConfig()
+}
+
+// logRotationConfig implements LogRotationConfigOf
+func (w *windowsVM) logRotationConfig() (*LogRotationConfig, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("if (Test-Path "+PowerShellString(remoteLogRotationConfigPath)+
+		") { Get-Content -Raw -Path "+PowerShellString(remoteLogRotationConfigPath)+" }"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v, %s", remoteLogRotationConfigPath, err, stderr)
+	}
+	return parseLogRotationConfig(stdout)
+}
+
+// parseLogRotationConfig parses the log rotation configuration, returning nil if it is empty
+func parseLogRotationConfig(out string) (*LogRotationConfig, error) {
+	if strings.TrimSpace(out) == "" {
+		return nil, nil
+	}
+	var config LogRotationConfig
+	if err := json.Unmarshal([]byte(out), &config); err != nil {
+		return nil, fmt.Errorf("could not parse log rotation configuration: %v", err)
+	}
+	return &config, nil
+}
+
+// LogBackups returns the names of the backups of the given log file on the Windows VM created by the WMCB log
+// rotation, the newest first
+func LogBackups(vm WindowsVM, logPath string) ([]string, error) {
+	return vm.handle().logBackups(logPath)
+}
+
+// logBackups implements LogBackups
+func (w *windowsVM) logBackups(logPath string) ([]string, error) {
+	dir := remotepath.Dir(logPath)
+	stdout, stderr, err := w.Run(PowerShellScript("Get-ChildItem -File -Name -Path "+PowerShellString(dir)+
+		" -ErrorAction SilentlyContinue"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %v, %s", dir, err, stderr)
+	}
+	return filterLogBackups(remotepath.Base(logPath), stdout), nil
+}
+
+// filterLogBackups returns the backups of the given log file among the given file names, one per line, the newest
+// first
+func filterLogBackups(logName, out string) []string {
+	ext := path.Ext(logName)
+	base := strings.TrimSuffix(logName, ext)
+	var backups []string
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if backupTimeRegex.MatchString(strings.TrimSuffix(strings.TrimPrefix(name, base), ext)) {
+			backups = append(backups, name)
+		}
+	}
+	// The time of the rotation sorts lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
@@ -0,0 +1,45 @@
+package e2efw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseLogRotationConfig tests that the log rotation configuration read from the Windows VM is parsed
+func TestParseLogRotationConfig(t *testing.T) {
+	config, err := parseLogRotationConfig("\r\n")
+	require.NoError(t, err)
+	assert.Nil(t, config, "no configuration expected when log rotation is not configured")
+
+	config, err = parseLogRotationConfig(`{"maxSize": 104857600, "maxAge": "168h0m0s", "maxBackups": 5, ` +
+		`"interval": "10m0s", "targets": [{"name": "kubelet", "patterns": ["C:\\k\\log\\kubelet.log"]}]}` + "\r\n")
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	assert.Equal(t, int64(100*1024*1024), config.MaxSize)
+	assert.Equal(t, 5, config.MaxBackups)
+	maxAge, err := config.MaxAgeDuration()
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, maxAge)
+	interval, err := config.IntervalDuration()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, interval)
+	require.NotNil(t, config.Target("kubelet"))
+	assert.Equal(t, []string{"C:\\k\\log\\kubelet.log"}, config.Target("kubelet").Patterns)
+	assert.Nil(t, config.Target("containerd"))
+
+	_, err = parseLogRotationConfig("{")
+	assert.Error(t, err)
+}
+
+// TestFilterLogBackups tests that only the backups of the given log file are returned, the newest first
+func TestFilterLogBackups(t *testing.T) {
+	out := "kubelet.log\r\nkubelet-20200601T100000.log\r\nkube-proxy-20200601T110000.log\r\n" +
+		"kubelet-20200601T120000.log\r\nkubelet-old.log\r\nkubelet-20200601T130000.txt\r\nwmcb-journal.json\r\n"
+	assert.Equal(t, []string{"kubelet-20200601T120000.log", "kubelet-20200601T100000.log"},
+		filterLogBackups("kubelet.log", out))
+	assert.Equal(t, []string{"kube-proxy-20200601T110000.log"}, filterLogBackups("kube-proxy.log", out))
+	assert.Empty(t, filterLogBackups("containerd.log", out))
+}
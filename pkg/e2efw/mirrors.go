@@ -0,0 +1,136 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	operatorv1alpha1 "github.com/openshift/client-go/operator/clientset/versioned/typed/operator/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	// mirroredImageEnvVar is the environment variable holding an image referenced by digest whose repository is
+	// mirrored by the ImageContentSourcePolicies of the cluster, which the registry mirror tests pull
+	mirroredImageEnvVar = "E2E_MIRRORED_IMAGE"
+	// hostsFilePath is the hosts file of the Windows VM, where the source registries are blackholed
+	hostsFilePath = "C:\\Windows\\System32\\drivers\\etc\\hosts"
+	// containerdHostsDir is the containerd registry configuration directory configure-registry-mirrors writes to
+	containerdHostsDir = "C:\\Program Files\\containerd\\certs.d"
+	// dockerHub is the name of the Docker Hub registry in image references
+	dockerHub = "docker.io"
+	// dockerHubRegistry is the host actually serving the Docker Hub images
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// getOpenShiftOperatorV1alpha1Client gets a new OpenShift operator v1alpha1 client, serving the
+// ImageContentSourcePolicies
+func (f *TestFramework) getOpenShiftOperatorV1alpha1Client(config *restclient.Config) error {
+	operatorClient, err := operatorv1alpha1.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("could not create operator v1alpha1 clientset: %v", err)
+	}
+	f.OSOperatorV1alpha1Client = operatorClient
+	return nil
+}
+
+// MirroredImage returns the image given by the E2E_MIRRORED_IMAGE environment variable, or an empty string if it is
+// not set
+func MirroredImage() string {
+	return os.Getenv(mirroredImageEnvVar)
+}
+
+// RegistryMirrors returns the mirrors of every source repository of the ImageContentSourcePolicies of the cluster
+func (f *TestFramework) RegistryMirrors() (map[string][]string, error) {
+	policies, err := f.OSOperatorV1alpha1Client.ImageContentSourcePolicies().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ImageContentSourcePolicies: %v", err)
+	}
+	mirrors := make(map[string][]string)
+	for _, policy := range policies.Items {
+		for _, mirror := range policy.Spec.RepositoryDigestMirrors {
+			mirrors[mirror.Source] = append(mirrors[mirror.Source], mirror.Mirrors...)
+		}
+	}
+	return mirrors, nil
+}
+
+// SourceRegistryHosts returns the hosts of the source registry of the given image if its repository is mirrored by
+// the given mirrors, so that they can be blackholed to make sure the image is pulled from the mirrors. Nil is returned
+// if the image is not mirrored.
+func SourceRegistryHosts(image string, mirrors map[string][]string) []string {
+	repository := image
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository = repository[:i]
+	}
+	var sources []string
+	for source := range mirrors {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		if len(mirrors[source]) == 0 || (repository != source && !strings.HasPrefix(repository, source+"/")) {
+			continue
+		}
+		host := strings.SplitN(source, "/", 2)[0]
+		if host == dockerHub {
+			return []string{dockerHub, dockerHubRegistry}
+		}
+		// The port is not part of the host name resolved
+		return []string{strings.SplitN(host, ":", 2)[0]}
+	}
+	return nil
+}
+
+// PullImageFromMirror pulls the given image on the Windows VM with the given registry hosts blackholed in its hosts
+// file, so that the pull only succeeds through the registry mirrors configured on the VM. The image is removed first
+// so that it is not served from the local store, and the hosts file is restored afterwards.
+func PullImageFromMirror(vm WindowsVM, image string, blockedHosts []string) error {
+	return vm.handle().pullImageFromMirror(image, blockedHosts)
+}
+
+// pullImageFromMirror implements PullImageFromMirror
+func (w *windowsVM) pullImageFromMirror(image string, blockedHosts []string) error {
+	if len(blockedHosts) == 0 {
+		return fmt.Errorf("no registry hosts to block for %s", image)
+	}
+	for _, arg := range append([]string{image}, blockedHosts...) {
+		if strings.Contains(arg, "\"") {
+			return fmt.Errorf("images and hosts cannot contain double quotes: %s", arg)
+		}
+	}
+	if _, stderr, err := w.Run(PowerShellScript(pullFromMirrorScript(image, blockedHosts)), true); err != nil {
+		return fmt.Errorf("error pulling %s with %s blocked: %v, %s", image, strings.Join(blockedHosts, ", "), err,
+			stderr)
+	}
+	log.Printf("pulled %s on %s through the registry mirrors", image, w.GetCredentials().GetIPAddress())
+	return nil
+}
+
+// pullFromMirrorScript returns the PowerShell script pulling the given image with docker, or with ctr and the
+// containerd registry configuration if the nodes run containerd, with the given hosts resolving to an unroutable
+// address. The hosts file is restored even if the pull fails.
+func pullFromMirrorScript(image string, blockedHosts []string) string {
+	quotedImage := PowerShellString(image)
+	var entries []string
+	for _, host := range blockedHosts {
+		entries = append(entries, PowerShellString("0.0.0.0 "+host))
+	}
+	pull := "docker rmi " + quotedImage + " 2>$null; docker pull " + quotedImage
+	if ContainerRuntime == ContainerdRuntime {
+		pull = "ctr --namespace k8s.io images rm " + quotedImage + " 2>$null; " +
+			"ctr --namespace k8s.io images pull --hosts-dir " + PowerShellString(containerdHostsDir) + " " +
+			quotedImage
+	}
+	return "$hostsFile = " + PowerShellString(hostsFilePath) + "; " +
+		"$original = Get-Content -Raw -Path $hostsFile; " +
+		"try { " +
+		"Add-Content -Path $hostsFile -Value @(" + strings.Join(entries, ", ") + "); " +
+		"Clear-DnsClientCache; " +
+		pull + "; " +
+		"if ($LASTEXITCODE -ne 0) { throw 'pulling ' + " + quotedImage + " + ' failed' } " +
+		"} finally { Set-Content -Path $hostsFile -Value $original -NoNewline; Clear-DnsClientCache }"
+}
@@ -0,0 +1,59 @@
+package e2efw
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSourceRegistryHosts tests that the hosts of the source registry are returned for the images of the mirrored
+// repositories only
+func TestSourceRegistryHosts(t *testing.T) {
+	mirrors := map[string][]string{
+		"quay.io/openshift-release-dev/ocp-v4.0-art-dev": {"mirror.example.com:5000/ocp4/ocp-v4.0-art-dev"},
+		"registry.example.com:5000/windows":              {"mirror.example.com:5000/windows"},
+		"docker.io/library":                              {"hub.example.com/library"},
+		"quay.io/unmirrored":                             {},
+	}
+	tests := []struct {
+		image    string
+		expected []string
+	}{
+		{image: "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:0123", expected: []string{"quay.io"}},
+		{image: "registry.example.com:5000/windows/servercore@sha256:0123",
+			expected: []string{"registry.example.com"}},
+		{image: "docker.io/library/busybox@sha256:0123", expected: []string{"docker.io", "registry-1.docker.io"}},
+		{image: "quay.io/openshift-release-dev/ocp-v4.0-art-dev-other@sha256:0123"},
+		{image: "quay.io/unmirrored/image@sha256:0123"},
+		{image: "mcr.microsoft.com/windows/servercore@sha256:0123"},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			assert.Equal(t, test.expected, SourceRegistryHosts(test.image, mirrors))
+		})
+	}
+}
+
+// TestPullFromMirrorScript tests that the hosts are blackholed around the pull and that the hosts file is restored
+// even if the pull fails
+func TestPullFromMirrorScript(t *testing.T) {
+	script := pullFromMirrorScript("quay.io/org/image@sha256:0123", []string{"quay.io", "cdn.quay.io"})
+	assert.NotContains(t, script, "\"")
+	assert.Contains(t, script, "Add-Content -Path $hostsFile -Value @('0.0.0.0 quay.io', '0.0.0.0 cdn.quay.io')")
+	assert.Contains(t, script, "docker pull 'quay.io/org/image@sha256:0123'")
+	assert.True(t, strings.HasSuffix(script,
+		"} finally { Set-Content -Path $hostsFile -Value $original -NoNewline; Clear-DnsClientCache }"))
+
+	ContainerRuntime = ContainerdRuntime
+	defer func() { ContainerRuntime = DockerRuntime }()
+	script = pullFromMirrorScript("quay.io/org/image@sha256:0123", []string{"quay.io"})
+	assert.Contains(t, script, "images pull --hosts-dir 'C:\\Program Files\\containerd\\certs.d' "+
+		"'quay.io/org/image@sha256:0123'")
+	assert.NotContains(t, script, "docker pull")
+}
+
+// TestPullImageFromMirrorArgs tests that nothing is run without hosts to block
+func TestPullImageFromMirrorArgs(t *testing.T) {
+	assert.Error(t, (&windowsVM{}).pullImageFromMirror("quay.io/org/image@sha256:0123", nil))
+}
@@ -0,0 +1,154 @@
+package e2efw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	// nuGetMinVersion is the version of the NuGet package provider needed to install OpenSSHUtils
+	nuGetMinVersion = "2.8.5.201"
+	// moduleInventoryScript lists the PowerShell modules and package providers installed on a Windows VM as JSON.
+	// Listing the package providers does not bootstrap NuGet.
+	moduleInventoryScript = "ConvertTo-Json -Compress -Depth 3 -InputObject @{" +
+		"modules = @(Get-Module -ListAvailable -ErrorAction SilentlyContinue | " +
+		"ForEach-Object { @{name = $_.Name; version = \"$($_.Version)\"} }); " +
+		"packageProviders = @(Get-PackageProvider -ListAvailable -ErrorAction SilentlyContinue | " +
+		"ForEach-Object { @{name = $_.Name; version = \"$($_.Version)\"} })}"
+)
+
+// InstalledModule is a PowerShell module or package provider installed on a Windows VM
+type InstalledModule struct {
+	// Name is the name of the module, e.g. OpenSSHUtils
+	Name string `json:"name"`
+	// Version is the version of the module, e.g. 2.8.5.208
+	Version string `json:"version"`
+}
+
+// ModuleInventory is the PowerShell modules and package providers installed on a Windows VM, which tells the module
+// installs that can be skipped on pre-baked images
+type ModuleInventory struct {
+	// Modules are the modules available to all the sessions, several versions of a module being listed separately
+	Modules []InstalledModule `json:"modules"`
+	// PackageProviders are the package providers available, e.g. NuGet
+	PackageProviders []InstalledModule `json:"packageProviders"`
+}
+
+// HasModule returns true if a version of the module with the given name at least the given version is installed. Any
+// version matches an empty minimum version. Names are compared case insensitively.
+func (i *ModuleInventory) HasModule(name, minVersion string) bool {
+	return i != nil && hasModule(i.Modules, name, minVersion)
+}
+
+// HasPackageProvider returns true if a version of the package provider with the given name at least the given version
+// is installed. Any version matches an empty minimum version. Names are compared case insensitively.
+func (i *ModuleInventory) HasPackageProvider(name, minVersion string) bool {
+	return i != nil && hasModule(i.PackageProviders, name, minVersion)
+}
+
+// hasModule returns true if one of the given modules has the given name and at least the given version
+func hasModule(modules []InstalledModule, name, minVersion string) bool {
+	for _, module := range modules {
+		if strings.EqualFold(module.Name, name) && versionAtLeast(module.Version, minVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionAtLeast returns true if the given dotted version is at least the given minimum version, the missing
+// components counting as 0. A version that cannot be parsed only matches an empty minimum version.
+func versionAtLeast(version, minVersion string) bool {
+	if minVersion == "" {
+		return true
+	}
+	parse := func(v string) ([]int, bool) {
+		var components []int
+		for _, component := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(component)
+			if err != nil {
+				return nil, false
+			}
+			components = append(components, n)
+		}
+		return components, true
+	}
+	have, ok := parse(version)
+	if !ok {
+		return false
+	}
+	want, ok := parse(minVersion)
+	if !ok {
+		return false
+	}
+	for len(have) < len(want) {
+		have = append(have, 0)
+	}
+	for len(want) < len(have) {
+		want = append(want, 0)
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			return have[i] > want[i]
+		}
+	}
+	return true
+}
+
+// parseModuleInventory parses the output of moduleInventoryScript
+func parseModuleInventory(out string) (*ModuleInventory, error) {
+	inventory := &ModuleInventory{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), inventory); err != nil {
+		return nil, fmt.Errorf("unexpected module inventory %q: %v", out, err)
+	}
+	return inventory, nil
+}
+
+// ModuleInventoryOf returns the PowerShell modules and package providers installed on the Windows VM
+func ModuleInventoryOf(vm WindowsVM) (*ModuleInventory, error) {
+	return vm.handle().moduleInventory()
+}
+
+// moduleInventory implements ModuleInventoryOf
+func (w *windowsVM) moduleInventory() (*ModuleInventory, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(moduleInventoryScript), true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the modules installed on %s: %v, %s", w.GetCredentials().GetIPAddress(),
+			err, stderr)
+	}
+	return parseModuleInventory(stdout)
+}
+
+// winRMModuleInventory returns the modules installed on the Windows VM, listed over WinRM as ssh is not set up yet when
+// the OpenSSH server is configured
+func (w *windowsVM) winRMModuleInventory() (*ModuleInventory, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	exitCode, err := w.runWinRMCommand(remotePowerShellCmdPrefix+PowerShellScript(moduleInventoryScript), stdout,
+		stderr)
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exit code %d", exitCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing the modules installed on %s: %v, %s", w.GetCredentials().GetIPAddress(),
+			err, strings.TrimSpace(stderr.String()))
+	}
+	return parseModuleInventory(stdout.String())
+}
+
+// moduleInstallStep returns a setup step running the given install script over WinRM unless the given module is
+// already installed, according to the given function
+func (w *windowsVM) moduleInstallStep(module string, installed func() bool, script string) func() error {
+	install := w.winRMStep(script)
+	return func() error {
+		if installed() {
+			log.Printf("%s is already installed on %s, skipping its installation", module,
+				w.GetCredentials().GetIPAddress())
+			return nil
+		}
+		return install()
+	}
+}
@@ -0,0 +1,58 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseModuleInventory tests the parsing of the modules and package providers listed on a Windows VM
+func TestParseModuleInventory(t *testing.T) {
+	inventory, err := parseModuleInventory(`{"packageProviders":[{"version":"2.8.5.208","name":"NuGet"},` +
+		`{"version":"1.0.0.1","name":"PowerShellGet"}],"modules":[{"version":"1.0.0.1","name":"PackageManagement"},` +
+		`{"version":"0.0.2.0","name":"OpenSSHUtils"}]}` + "\r\n")
+	require.NoError(t, err)
+	assert.True(t, inventory.HasPackageProvider("nuget", nuGetMinVersion))
+	assert.False(t, inventory.HasPackageProvider("NuGet", "3.0"))
+	assert.True(t, inventory.HasModule("OpenSSHUtils", ""))
+	assert.True(t, inventory.HasModule("OpenSSHUtils", "0.0.2"))
+	assert.False(t, inventory.HasModule("PSWindowsUpdate", ""))
+
+	inventory, err = parseModuleInventory(`{"packageProviders":[],"modules":[]}`)
+	require.NoError(t, err)
+	assert.False(t, inventory.HasPackageProvider("NuGet", ""))
+
+	_, err = parseModuleInventory("Get-PackageProvider : access denied")
+	assert.Error(t, err)
+}
+
+// TestModuleInventoryNil tests that nothing is installed according to a missing inventory, so that the modules are
+// installed when they cannot be listed
+func TestModuleInventoryNil(t *testing.T) {
+	var inventory *ModuleInventory
+	assert.False(t, inventory.HasModule("OpenSSHUtils", ""))
+	assert.False(t, inventory.HasPackageProvider("NuGet", ""))
+}
+
+// TestVersionAtLeast tests the comparison of dotted versions
+func TestVersionAtLeast(t *testing.T) {
+	for _, test := range []struct {
+		version    string
+		minVersion string
+		expected   bool
+	}{
+		{"2.8.5.208", "2.8.5.201", true},
+		{"2.8.5.201", "2.8.5.201", true},
+		{"2.8.5.101", "2.8.5.201", false},
+		{"2.10", "2.8.5.201", true},
+		{"3", "2.8.5.201", true},
+		{"2.8.5", "2.8.5.0", true},
+		{"", "2.8.5.201", false},
+		{"2.8-beta", "2.8", false},
+		{"anything", "", true},
+	} {
+		assert.Equal(t, test.expected, versionAtLeast(test.version, test.minVersion), "%s >= %s", test.version,
+			test.minVersion)
+	}
+}
@@ -0,0 +1,71 @@
+package e2efw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MultiError is the error of a best-effort operation, like retrieving the artifacts of the VMs, whose steps are all
+// attempted even when some of them fail. It holds the failures of the steps, so that callers can decide whether the
+// partial success is acceptable and the CI output lists everything that failed rather than the first failure.
+type MultiError struct {
+	// Op describes the best-effort operation
+	Op string
+	// Errors holds the failures of the steps of the operation, in the order they happened
+	Errors []error
+}
+
+// NewMultiError returns an empty MultiError of the given operation
+func NewMultiError(op string) *MultiError {
+	return &MultiError{Op: op}
+}
+
+// Append records the given failure of a step. Nil errors are ignored, so that the results of the steps can be
+// appended as is.
+func (m *MultiError) Append(err error) {
+	if err != nil {
+		m.Errors = append(m.Errors, err)
+	}
+}
+
+// Appendf records the failure of a step described by the given format and arguments, as fmt.Errorf does
+func (m *MultiError) Appendf(format string, args ...interface{}) {
+	m.Errors = append(m.Errors, fmt.Errorf(format, args...))
+}
+
+// ErrorOrNil returns the MultiError if any step failed and nil otherwise. Operations return it rather than the
+// MultiError itself, so that a success is a nil error interface.
+func (m *MultiError) ErrorOrNil() error {
+	if m == nil || len(m.Errors) == 0 {
+		return nil
+	}
+	return m
+}
+
+// Error lists the failures of the steps, one per line. The lines of the failures spanning several lines, like nested
+// MultiErrors, are indented.
+func (m *MultiError) Error() string {
+	if len(m.Errors) == 1 {
+		return fmt.Sprintf("%s: %v", m.Op, m.Errors[0])
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d errors occurred:", m.Op, len(m.Errors))
+	for _, err := range m.Errors {
+		b.WriteString("\n\t* " + strings.Replace(err.Error(), "\n", "\n\t", -1))
+	}
+	return b.String()
+}
+
+// Failures returns the failures of the steps of the given error of a best-effort operation, or the error itself if it
+// is not a MultiError, e.g. when the operation could not start. There are none for a nil error.
+func Failures(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var m *MultiError
+	if errors.As(err, &m) {
+		return m.Errors
+	}
+	return []error{err}
+}
@@ -0,0 +1,45 @@
+package e2efw
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMultiError tests that the failures of the steps of a best-effort operation are aggregated
+func TestMultiError(t *testing.T) {
+	errs := NewMultiError("retrieve artifacts")
+	errs.Append(nil)
+	assert.Nil(t, errs.ErrorOrNil(), "an operation without failures is a success")
+
+	errs.Appendf("vm %s: %v", "i-1", errors.New("no route to host"))
+	err := errs.ErrorOrNil()
+	assert.EqualError(t, err, "retrieve artifacts: vm i-1: no route to host")
+
+	nested := NewMultiError("retrieve files of C:\\k\\log")
+	nested.Append(errors.New("kubelet.log: permission denied"))
+	nested.Append(errors.New("hybrid-overlay.log: EOF"))
+	errs.Append(nested.ErrorOrNil())
+	assert.EqualError(t, errs, "retrieve artifacts: 2 errors occurred:\n"+
+		"\t* vm i-1: no route to host\n"+
+		"\t* retrieve files of C:\\k\\log: 2 errors occurred:\n"+
+		"\t\t* kubelet.log: permission denied\n"+
+		"\t\t* hybrid-overlay.log: EOF")
+}
+
+// TestFailures tests that the failures of the steps are returned from the error of a best-effort operation
+func TestFailures(t *testing.T) {
+	assert.Empty(t, Failures(nil))
+	single := errors.New("ssh is not available")
+	assert.Equal(t, []error{single}, Failures(single))
+
+	errs := NewMultiError("tear down the Windows VMs")
+	first, second := errors.New("instance not found"), errors.New("throttled")
+	errs.Append(first)
+	errs.Append(second)
+	assert.Equal(t, []error{first, second}, Failures(errs.ErrorOrNil()))
+	assert.Equal(t, []error{first, second}, Failures(fmt.Errorf("teardown failed: %w", errs)),
+		"the failures of a wrapped MultiError are not returned")
+}
@@ -0,0 +1,108 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// networkAdaptersFile is the file of the node artifacts describing the network adapters of the VM
+const networkAdaptersFile = "network-adapters.json"
+
+// NetworkAdapter is a network adapter of a Windows VM, as returned by Get-NetAdapter
+type NetworkAdapter struct {
+	// Name is the name of the adapter, e.g. Ethernet or vEthernet (nat)
+	Name string `json:"name"`
+	// Description is the description of the interface of the adapter, e.g. Amazon Elastic Network Adapter
+	Description string `json:"description"`
+	// Index is the index of the interface of the adapter
+	Index int `json:"index"`
+	// Status is the operational status of the adapter, e.g. Up or Disconnected
+	Status string `json:"status"`
+	// MACAddress is the MAC address of the adapter, e.g. 0A-1B-2C-3D-4E-5F
+	MACAddress string `json:"macAddress"`
+	// MTU is the MTU of the adapter in bytes
+	MTU int `json:"mtu"`
+	// Addresses are the IP addresses of the adapter
+	Addresses []NetworkAddress `json:"addresses"`
+	// DNSServers are the addresses of the DNS servers of the adapter, of both families
+	DNSServers []string `json:"dnsServers"`
+	// DNSSuffix is the connection specific DNS suffix of the adapter, empty if none
+	DNSSuffix string `json:"dnsSuffix,omitempty"`
+}
+
+// NetworkAddress is an IP address of a network adapter
+type NetworkAddress struct {
+	// IP is the address, with its zone index for IPv6 link local addresses, e.g. fe80::1%5
+	IP string `json:"ip"`
+	// PrefixLength is the length of the prefix of the subnet of the address
+	PrefixLength int `json:"prefixLength"`
+	// Family is the family of the address, IPv4 or IPv6
+	Family string `json:"family"`
+}
+
+// ParsedIP returns the address without its zone index, nil if it cannot be parsed
+func (a NetworkAddress) ParsedIP() net.IP {
+	return net.ParseIP(strings.SplitN(a.IP, "%", 2)[0])
+}
+
+// HasIP returns true if the given address is one of the addresses of the adapter
+func (n *NetworkAdapter) HasIP(ip net.IP) bool {
+	for _, address := range n.Addresses {
+		if address.ParsedIP().Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindNetworkAdapter returns the adapter holding the given address among the given adapters, nil if none does
+func FindNetworkAdapter(adapters []NetworkAdapter, ip net.IP) *NetworkAdapter {
+	for i := range adapters {
+		if adapters[i].HasIP(ip) {
+			return &adapters[i]
+		}
+	}
+	return nil
+}
+
+// NetworkAdapters returns the network adapters of the Windows VM with their addresses and DNS settings
+func NetworkAdapters(vm WindowsVM) ([]NetworkAdapter, error) {
+	return vm.handle().networkAdapters()
+}
+
+// networkAdapters implements NetworkAdapters
+func (w *windowsVM) networkAdapters() ([]NetworkAdapter, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("ConvertTo-Json -Compress -Depth 4 -InputObject @(Get-NetAdapter | "+
+		"ForEach-Object { $dns = Get-DnsClient -InterfaceIndex $_.ifIndex -ErrorAction SilentlyContinue; "+
+		"@{name = $_.Name; description = $_.InterfaceDescription; index = [int]$_.ifIndex; "+
+		"status = \"$($_.Status)\"; macAddress = $_.MacAddress; mtu = [int]$_.MtuSize; "+
+		"addresses = @(Get-NetIPAddress -InterfaceIndex $_.ifIndex -ErrorAction SilentlyContinue | "+
+		"ForEach-Object { @{ip = $_.IPAddress; prefixLength = [int]$_.PrefixLength; "+
+		"family = \"$($_.AddressFamily)\"} }); "+
+		"dnsServers = @(Get-DnsClientServerAddress -InterfaceIndex $_.ifIndex -ErrorAction SilentlyContinue | "+
+		"ForEach-Object { $_.ServerAddresses }); "+
+		"dnsSuffix = $(if ($dns) { $dns.ConnectionSpecificSuffix } else { '' })} })"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing network adapters: %v, %s", err, stderr)
+	}
+	return parseNetworkAdapters(stdout)
+}
+
+// parseNetworkAdapters parses the JSON output of NetworkAdapters. A single adapter is serialized as an object instead
+// of an array by older versions of PowerShell.
+func parseNetworkAdapters(out string) ([]NetworkAdapter, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(out, "{") {
+		out = "[" + out + "]"
+	}
+	var adapters []NetworkAdapter
+	if err := json.Unmarshal([]byte(out), &adapters); err != nil {
+		return nil, fmt.Errorf("error parsing network adapters %s: %v", out, err)
+	}
+	return adapters, nil
+}
@@ -0,0 +1,47 @@
+package e2efw
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseNetworkAdapters tests the parsing of the network adapters, of which a single one is not serialized as an
+// array
+func TestParseNetworkAdapters(t *testing.T) {
+	adapters, err := parseNetworkAdapters(`[{"name":"Ethernet","description":"Amazon Elastic Network Adapter",` +
+		`"index":6,"status":"Up","macAddress":"0A-1B-2C-3D-4E-5F","mtu":9001,"addresses":[` +
+		`{"ip":"fe80::1c2d:3e4f:5a6b:7c8d%6","prefixLength":64,"family":"IPv6"},` +
+		`{"ip":"10.0.0.5","prefixLength":24,"family":"IPv4"}],"dnsServers":["10.0.0.2"],` +
+		`"dnsSuffix":"ec2.internal"},` +
+		`{"name":"vEthernet (nat)","description":"Hyper-V Virtual Ethernet Adapter","index":12,"status":"Up",` +
+		`"macAddress":"00-15-5D-00-01-02","mtu":1500,"addresses":[{"ip":"172.20.0.1","prefixLength":20,` +
+		`"family":"IPv4"}],"dnsServers":[],"dnsSuffix":""}]`)
+	require.NoError(t, err)
+	require.Len(t, adapters, 2)
+	assert.Equal(t, NetworkAdapter{Name: "Ethernet", Description: "Amazon Elastic Network Adapter", Index: 6,
+		Status: "Up", MACAddress: "0A-1B-2C-3D-4E-5F", MTU: 9001, Addresses: []NetworkAddress{
+			{IP: "fe80::1c2d:3e4f:5a6b:7c8d%6", PrefixLength: 64, Family: "IPv6"},
+			{IP: "10.0.0.5", PrefixLength: 24, Family: "IPv4"}},
+		DNSServers: []string{"10.0.0.2"}, DNSSuffix: "ec2.internal"}, adapters[0])
+
+	assert.Equal(t, "Ethernet", FindNetworkAdapter(adapters, net.ParseIP("10.0.0.5")).Name)
+	assert.Equal(t, "Ethernet", FindNetworkAdapter(adapters, net.ParseIP("fe80::1c2d:3e4f:5a6b:7c8d")).Name,
+		"the zone index should be ignored")
+	assert.Equal(t, "vEthernet (nat)", FindNetworkAdapter(adapters, net.ParseIP("172.20.0.1")).Name)
+	assert.Nil(t, FindNetworkAdapter(adapters, net.ParseIP("10.0.0.6")))
+
+	adapters, err = parseNetworkAdapters(`{"name":"Ethernet","index":6,"status":"Disconnected","addresses":[]}` +
+		"\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []NetworkAdapter{{Name: "Ethernet", Index: 6, Status: "Disconnected",
+		Addresses: []NetworkAddress{}}}, adapters)
+
+	adapters, err = parseNetworkAdapters("")
+	assert.NoError(t, err)
+	assert.Empty(t, adapters)
+	_, err = parseNetworkAdapters("[")
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+const (
+	// networkModeEnvVar is the environment variable selecting how the VMs are reached: public, private or auto, the
+	// default, which uses the private IP of the VMs when the test runner is in their VPC
+	networkModeEnvVar = "E2E_NETWORK_MODE"
+)
+
+var (
+	// runnerVPCOnce ensures that the VPC of the test runner is only looked up once
+	runnerVPCOnce sync.Once
+	// runnerVPC is the ID of the VPC the test runner is in, empty if it is not on EC2
+	runnerVPC string
+)
+
+// usePrivateIP returns true if a VM in the given VPC is to be reached through its private IP, which is the case when
+// the test runner is in the same VPC, e.g. in accounts that disallow public IPs
+func usePrivateIP(vpcID string) (bool, error) {
+	switch mode := os.Getenv(networkModeEnvVar); mode {
+	case "private":
+		return true, nil
+	case "public":
+		return false, nil
+	case "", "auto":
+	default:
+		return false, fmt.Errorf("invalid %s %s, expected public, private or auto", networkModeEnvVar, mode)
+	}
+	runnerVPCOnce.Do(func() {
+		var err error
+		if runnerVPC, err = aws.GetRunnerVPC(); err != nil {
+			log.Printf("using public IPs, could not detect the VPC the test runner is in: %v", err)
+		}
+	})
+	return runnerVPC != "" && runnerVPC == vpcID, nil
+}
+
+// privateCredentials returns the credentials of the VM with the private IP of the instance instead of its public IP,
+// if the VM is to be reached through its private IP. The given credentials are returned otherwise.
+func privateCredentials(cloud cloudprovider.Cloud, credentials *types.Credentials) (*types.Credentials, error) {
+	awsCloud, ok := cloud.(*aws.AwsProvider)
+	if !ok {
+		return credentials, nil
+	}
+	instance, err := awsCloud.GetInstance(credentials.GetInstanceId())
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance %s: %v", credentials.GetInstanceId(), err)
+	}
+	if instance.VpcId == nil || instance.PrivateIpAddress == nil {
+		return credentials, nil
+	}
+	private, err := usePrivateIP(*instance.VpcId)
+	if err != nil || !private {
+		return credentials, err
+	}
+	log.Printf("reaching instance %s through its private IP %s", credentials.GetInstanceId(),
+		*instance.PrivateIpAddress)
+	return types.NewCredentials(credentials.GetInstanceId(), *instance.PrivateIpAddress, credentials.GetPassword(),
+		credentials.GetUserName()), nil
+}
@@ -0,0 +1,61 @@
+package e2efw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUsePrivateIP tests that the private IP is used when requested, or when the test runner is in the VPC of the VM
+func TestUsePrivateIP(t *testing.T) {
+	const token = "session-token"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/token":
+			w.Write([]byte(token))
+		case r.Header.Get("X-aws-ec2-metadata-token") != token:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/meta-data/mac":
+			w.Write([]byte("0e:49:61:0f:c3:11\n"))
+		case r.URL.Path == "/meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/vpc-id":
+			w.Write([]byte("vpc-runner"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(endpoint string) { aws.MetadataEndpoint = endpoint }(aws.MetadataEndpoint)
+	aws.MetadataEndpoint = server.URL
+	defer os.Unsetenv(networkModeEnvVar)
+
+	tests := []struct {
+		name     string
+		mode     string
+		vpcID    string
+		expected bool
+	}{
+		{"auto in the VPC of the runner", "", "vpc-runner", true},
+		{"auto in another VPC", "auto", "vpc-cluster", false},
+		{"private", "private", "vpc-cluster", true},
+		{"public", "public", "vpc-runner", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runnerVPCOnce = sync.Once{}
+			require.NoError(t, os.Setenv(networkModeEnvVar, test.mode))
+			private, err := usePrivateIP(test.vpcID)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, private)
+		})
+	}
+
+	require.NoError(t, os.Setenv(networkModeEnvVar, "vpn"))
+	_, err := usePrivateIP("vpc-runner")
+	assert.Error(t, err)
+}
@@ -0,0 +1,264 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// nodeJoinReportFile is the file of ARTIFACT_DIR the node join latencies of the run are written to
+	nodeJoinReportFile = "node-join.json"
+	// timeToReadySLOEnvVar is the environment variable holding the time the nodes have to become Ready in once WMCB is
+	// invoked, e.g. 10m, over which the run fails. It is not enforced if not set.
+	timeToReadySLOEnvVar = "E2E_TIME_TO_READY_SLO"
+)
+
+// timeToReadySLO is the time the nodes have to become Ready in once WMCB is invoked, 0 if it is not enforced
+var timeToReadySLO time.Duration
+
+// NodeJoin is the latency of a Windows VM joining the cluster as a node, measured from the invocation of WMCB. The
+// times of the node and pod events are the ones recorded by the cluster, so they do not depend on when the tests
+// observe them.
+type NodeJoin struct {
+	// Host is the IP address of the Windows VM
+	Host string `json:"host"`
+	// Node is the name of the node of the VM, once it is Ready
+	Node string `json:"node,omitempty"`
+	// WMCBInvoked is when WMCB was invoked to bootstrap the VM
+	WMCBInvoked time.Time `json:"wmcbInvoked"`
+	// NodeReadySeconds is the time from the invocation of WMCB until the node became Ready, 0 if it did not
+	NodeReadySeconds float64 `json:"nodeReadySeconds,omitempty"`
+	// FirstPodRunningSeconds is the time from the invocation of WMCB until the first pod of the tests on the node was
+	// running, 0 if none was
+	FirstPodRunningSeconds float64 `json:"firstPodRunningSeconds,omitempty"`
+}
+
+// NodeJoinReport is the report of the node join latencies of the run
+type NodeJoinReport struct {
+	// Context is the context of the run
+	Context RunContext `json:"context"`
+	// TimeToReadySLOSeconds is the time the nodes have to become Ready in, 0 if it is not enforced
+	TimeToReadySLOSeconds float64 `json:"timeToReadySLOSeconds,omitempty"`
+	// NodeReadySeconds summarizes the time the nodes took to become Ready
+	NodeReadySeconds DurationSummary `json:"nodeReadySeconds"`
+	// FirstPodRunningSeconds summarizes the time the nodes took to run their first pod
+	FirstPodRunningSeconds DurationSummary `json:"firstPodRunningSeconds"`
+	// Joins are the joins of the run, in the order WMCB was invoked
+	Joins []NodeJoin `json:"joins"`
+}
+
+// nodeJoinRecorder accumulates the node joins of the run
+type nodeJoinRecorder struct {
+	// lock guards joins and pending, as the VMs are bootstrapped concurrently
+	lock sync.Mutex
+	// joins are the joins of the run, in the order WMCB was invoked
+	joins []*NodeJoin
+	// pending are the joins of the VMs whose node is not Ready yet by host
+	pending map[string]*NodeJoin
+}
+
+// nodeJoins records the node joins of the test suite
+var nodeJoins = newNodeJoinRecorder()
+
+// newNodeJoinRecorder returns an empty nodeJoinRecorder
+func newNodeJoinRecorder() *nodeJoinRecorder {
+	return &nodeJoinRecorder{pending: make(map[string]*NodeJoin)}
+}
+
+// invoked records that WMCB was invoked on the given host at the given time, replacing the join of the host still
+// pending if any
+func (r *nodeJoinRecorder) invoked(host string, at time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	join := &NodeJoin{Host: host, WMCBInvoked: at}
+	if previous, ok := r.pending[host]; ok {
+		for i := range r.joins {
+			if r.joins[i] == previous {
+				r.joins = append(r.joins[:i], r.joins[i+1:]...)
+				break
+			}
+		}
+	}
+	r.joins = append(r.joins, join)
+	r.pending[host] = join
+}
+
+// ready records that the given node of the given host is Ready, and returns the time it took to become Ready since
+// WMCB was invoked, 0 if no join of the host is pending. A node which was Ready before WMCB was invoked, e.g. when
+// bootstrapping it again, did not join, and its join is dropped.
+func (r *nodeJoinRecorder) ready(host string, node *v1.Node) (time.Duration, error) {
+	readyAt, ok := nodeReadyTime(node)
+	if !ok {
+		return 0, fmt.Errorf("node %s is not Ready", node.Name)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	join, ok := r.pending[host]
+	if !ok {
+		return 0, nil
+	}
+	delete(r.pending, host)
+	latency := readyAt.Sub(join.WMCBInvoked)
+	if latency <= 0 {
+		for i := range r.joins {
+			if r.joins[i] == join {
+				r.joins = append(r.joins[:i], r.joins[i+1:]...)
+				break
+			}
+		}
+		log.Printf("node %s was already Ready before WMCB was invoked, its join is not measured", node.Name)
+		return 0, nil
+	}
+	join.Node = node.Name
+	join.NodeReadySeconds = latency.Seconds()
+	return latency, nil
+}
+
+// podRunning records the given pod as the first pod of its node if the node joined and ran no pod yet
+func (r *nodeJoinRecorder) podRunning(pod *v1.Pod) {
+	startedAt, ok := podStartTime(pod)
+	if !ok {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := len(r.joins) - 1; i >= 0; i-- {
+		join := r.joins[i]
+		if join.Node != pod.Spec.NodeName {
+			continue
+		}
+		if join.FirstPodRunningSeconds == 0 && startedAt.After(join.WMCBInvoked) {
+			join.FirstPodRunningSeconds = startedAt.Sub(join.WMCBInvoked).Seconds()
+		}
+		return
+	}
+}
+
+// report returns the report of the node joins recorded so far
+func (r *nodeJoinRecorder) report() *NodeJoinReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := &NodeJoinReport{TimeToReadySLOSeconds: timeToReadySLO.Seconds(), Joins: []NodeJoin{}}
+	var ready, running []time.Duration
+	for _, join := range r.joins {
+		report.Joins = append(report.Joins, *join)
+		if join.NodeReadySeconds > 0 {
+			ready = append(ready, time.Duration(join.NodeReadySeconds*float64(time.Second)))
+		}
+		if join.FirstPodRunningSeconds > 0 {
+			running = append(running, time.Duration(join.FirstPodRunningSeconds*float64(time.Second)))
+		}
+	}
+	report.NodeReadySeconds = SummarizeDurations(ready)
+	report.FirstPodRunningSeconds = SummarizeDurations(running)
+	return report
+}
+
+// nodeReadyTime returns when the given node last became Ready, false if it is not Ready
+func nodeReadyTime(node *v1.Node) (time.Time, bool) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+			return condition.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// podStartTime returns when the first container of the given pod started running, false if none did
+func podStartTime(pod *v1.Pod) (time.Time, bool) {
+	var started time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		var at time.Time
+		switch {
+		case status.State.Running != nil:
+			at = status.State.Running.StartedAt.Time
+		case status.State.Terminated != nil:
+			at = status.State.Terminated.StartedAt.Time
+		default:
+			continue
+		}
+		if started.IsZero() || at.Before(started) {
+			started = at
+		}
+	}
+	return started, !started.IsZero()
+}
+
+// timeToReadySLOFromEnv returns the time-to-ready SLO given by E2E_TIME_TO_READY_SLO, 0 if not set
+func timeToReadySLOFromEnv() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(timeToReadySLOEnvVar))
+	if value == "" {
+		return 0, nil
+	}
+	slo, err := time.ParseDuration(value)
+	if err != nil || slo <= 0 {
+		return 0, fmt.Errorf("invalid %s %s, expected a positive duration, e.g. 10m", timeToReadySLOEnvVar, value)
+	}
+	return slo, nil
+}
+
+// RecordWMCBInvoked records that WMCB is being invoked to bootstrap the Windows VM of the given host, its IP address,
+// which starts the measurement of the time it takes to join the cluster as a node. The joins are reported in
+// node-join.json in ARTIFACT_DIR once the tests are done.
+func RecordWMCBInvoked(host string) {
+	nodeJoins.invoked(host, time.Now())
+}
+
+// RecordNodeReady records that the given node of the Windows VM of the given host is Ready. It returns an error if the
+// node is not Ready, or if it took longer than the time-to-ready SLO given by E2E_TIME_TO_READY_SLO to become Ready
+// since WMCB was invoked, which fails the run. The outcome of the bootstrap is notified to the notifiers of the run.
+func RecordNodeReady(host string, node *v1.Node) error {
+	latency, err := nodeJoins.ready(host, node)
+	if err != nil {
+		notify(NotifyBootstrap, err, "bootstrap of %s", host)
+		return err
+	}
+	if latency == 0 {
+		return nil
+	}
+	log.Printf("node %s became Ready %v after WMCB was invoked", node.Name, latency.Round(time.Second))
+	if timeToReadySLO > 0 && latency > timeToReadySLO {
+		err = fmt.Errorf("node %s became Ready %v after WMCB was invoked, over the time-to-ready SLO of %v",
+			node.Name, latency.Round(time.Second), timeToReadySLO)
+		notify(NotifyBootstrap, err, "bootstrap of %s", host)
+		return err
+	}
+	notify(NotifyBootstrap, nil, "node %s of %s became Ready %v after WMCB was invoked", node.Name, host,
+		latency.Round(time.Second))
+	return nil
+}
+
+// RecordPodRunning records the given pod as the first pod running on its node, if the node joined during the run and
+// no pod was recorded for it yet
+func RecordPodRunning(pod *v1.Pod) {
+	nodeJoins.podRunning(pod)
+}
+
+// writeNodeJoinReport writes the node join report of the run to node-join.json in ARTIFACT_DIR
+func writeNodeJoinReport() {
+	report := nodeJoins.report()
+	report.Context = CurrentRunContext()
+	if len(report.Joins) == 0 {
+		return
+	}
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("error marshalling the node join report: %v", err)
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(artifactDir, nodeJoinReportFile), contents, 0644); err != nil {
+		log.Printf("unable to write the node join report: %v", err)
+		return
+	}
+	log.Printf("%d nodes became Ready in %.0fs at the median, and ran their first pod in %.0fs",
+		report.NodeReadySeconds.Count, report.NodeReadySeconds.P50, report.FirstPodRunningSeconds.P50)
+}
@@ -0,0 +1,120 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// readyNode returns a node of the given name which became Ready at the given time
+func readyNode(name string, readyAt time.Time) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+			{Type: v1.NodeReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(readyAt)},
+		}},
+	}
+}
+
+// runningPod returns a pod of the given node whose container started running at the given time
+func runningPod(nodeName string, startedAt time.Time) *v1.Pod {
+	return &v1.Pod{
+		Spec: v1.PodSpec{NodeName: nodeName},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(startedAt)}}},
+		}},
+	}
+}
+
+// TestNodeJoinReport tests that the latencies are measured from the invocation of WMCB with the times recorded by the
+// cluster, and that only the first pod of a node is recorded
+func TestNodeJoinReport(t *testing.T) {
+	invoked := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	recorder := newNodeJoinRecorder()
+	recorder.invoked("10.0.0.1", invoked)
+	recorder.invoked("10.0.0.2", invoked)
+
+	latency, err := recorder.ready("10.0.0.1", readyNode("node-1", invoked.Add(4*time.Minute)))
+	require.NoError(t, err)
+	assert.Equal(t, 4*time.Minute, latency)
+	latency, err = recorder.ready("10.0.0.1", readyNode("node-1", invoked.Add(5*time.Minute)))
+	require.NoError(t, err)
+	assert.Zero(t, latency, "a node is only measured once per invocation")
+	recorder.podRunning(runningPod("node-1", invoked.Add(6*time.Minute)))
+	recorder.podRunning(runningPod("node-1", invoked.Add(7*time.Minute)))
+	recorder.podRunning(runningPod("node-2", invoked.Add(7*time.Minute)))
+
+	report := recorder.report()
+	require.Len(t, report.Joins, 2)
+	assert.Equal(t, NodeJoin{Host: "10.0.0.1", Node: "node-1", WMCBInvoked: invoked, NodeReadySeconds: 240,
+		FirstPodRunningSeconds: 360}, report.Joins[0])
+	assert.Equal(t, NodeJoin{Host: "10.0.0.2", WMCBInvoked: invoked}, report.Joins[1],
+		"a node which is not Ready has no latencies")
+	assert.Equal(t, 1, report.NodeReadySeconds.Count)
+	assert.Equal(t, 240.0, report.NodeReadySeconds.P50)
+	assert.Equal(t, 360.0, report.FirstPodRunningSeconds.P50)
+}
+
+// TestNodeJoinAlreadyReady tests that a node which was Ready before WMCB was invoked is not measured
+func TestNodeJoinAlreadyReady(t *testing.T) {
+	invoked := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	recorder := newNodeJoinRecorder()
+	recorder.invoked("10.0.0.1", invoked)
+
+	latency, err := recorder.ready("10.0.0.1", readyNode("node-1", invoked.Add(-time.Hour)))
+	require.NoError(t, err)
+	assert.Zero(t, latency)
+	assert.Empty(t, recorder.report().Joins)
+
+	_, err = recorder.ready("10.0.0.1", &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	assert.Error(t, err, "a node without Ready condition is not Ready")
+}
+
+// TestRecordNodeReadySLO tests that a node taking longer than the time-to-ready SLO to become Ready fails
+func TestRecordNodeReadySLO(t *testing.T) {
+	defer func(recorder *nodeJoinRecorder, slo time.Duration) {
+		nodeJoins = recorder
+		timeToReadySLO = slo
+	}(nodeJoins, timeToReadySLO)
+	nodeJoins = newNodeJoinRecorder()
+	timeToReadySLO = 10 * time.Minute
+
+	RecordWMCBInvoked("10.0.0.1")
+	RecordWMCBInvoked("10.0.0.2")
+	now := time.Now()
+	assert.NoError(t, RecordNodeReady("10.0.0.1", readyNode("node-1", now.Add(5*time.Minute))))
+	assert.Error(t, RecordNodeReady("10.0.0.2", readyNode("node-2", now.Add(15*time.Minute))))
+	assert.NoError(t, RecordNodeReady("10.0.0.3", readyNode("node-3", now)), "a node WMCB was not invoked on "+
+		"is not measured")
+}
+
+// TestTimeToReadySLOFromEnv tests the parsing of the time-to-ready SLO
+func TestTimeToReadySLOFromEnv(t *testing.T) {
+	defer os.Setenv(timeToReadySLOEnvVar, os.Getenv(timeToReadySLOEnvVar))
+	for _, test := range []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"", 0, true},
+		{"10m", 10 * time.Minute, true},
+		{"0", 0, false},
+		{"ten minutes", 0, false},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			require.NoError(t, os.Setenv(timeToReadySLOEnvVar, test.value))
+			slo, err := timeToReadySLOFromEnv()
+			if !test.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, slo)
+		})
+	}
+}
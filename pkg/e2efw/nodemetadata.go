@@ -0,0 +1,193 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/azure"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// windowsBuildLabel is the label the kubelet sets to the build of Windows of the node, e.g. 10.0.17763
+	windowsBuildLabel = "node.kubernetes.io/windows-build"
+	// memoryCapacityTolerance is the share of the memory of the Windows VM its node capacity can differ by, as the
+	// kubelet and WMI do not round the physical memory the same way
+	memoryCapacityTolerance = 0.01
+	// nodeFactsScript prints the build of Windows, the number of logical processors and the physical memory in bytes of
+	// the Windows VM as JSON
+	nodeFactsScript = "$v = [Environment]::OSVersion.Version; $cs = Get-CimInstance -ClassName Win32_ComputerSystem; " +
+		"@{build = \"$($v.Major).$($v.Minor).$($v.Build)\"; logicalProcessors = $cs.NumberOfLogicalProcessors; " +
+		"memoryBytes = $cs.TotalPhysicalMemory} | ConvertTo-Json -Compress"
+)
+
+// NodeExpectations are the metadata the node of a Windows VM is expected to register with, as bootstrapped on its
+// platform
+type NodeExpectations struct {
+	// Platform is the cloud provider of the Windows VM, e.g. AWS
+	Platform string
+	// Labels are the labels the node must have, with their values
+	Labels map[string]string
+	// InternalIPs are the IP addresses of the Windows VM, which the internal IPs of the node must be among
+	InternalIPs []string
+	// ProviderID matches the provider ID of the node, which must be empty if it is nil
+	ProviderID *regexp.Regexp
+	// CPUs is the number of logical processors of the Windows VM, which is the CPU capacity of the node
+	CPUs int64
+	// MemoryBytes is the physical memory of the Windows VM, which is the memory capacity of the node
+	MemoryBytes int64
+}
+
+// nodeFacts are the properties of the Windows VM its node metadata derives from, as printed by nodeFactsScript
+type nodeFacts struct {
+	Build             string `json:"build"`
+	LogicalProcessors int64  `json:"logicalProcessors"`
+	MemoryBytes       int64  `json:"memoryBytes"`
+}
+
+// NodeExpectationsOf returns the metadata the node of the Windows VM is expected to register with: the Windows labels
+// with the build of the VM, the addresses of its network adapters, the provider ID of its instance on its cloud
+// provider, and its logical processors and memory as capacity
+func NodeExpectationsOf(vm WindowsVM) (*NodeExpectations, error) {
+	return vm.handle().nodeExpectations()
+}
+
+// nodeExpectations implements NodeExpectationsOf
+func (w *windowsVM) nodeExpectations() (*NodeExpectations, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(nodeFactsScript), true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the build and resources of the VM: %v, %s", err, stderr)
+	}
+	var facts nodeFacts
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &facts); err != nil {
+		return nil, fmt.Errorf("unexpected build and resources of the VM %q: %v", strings.TrimSpace(stdout), err)
+	}
+	adapters, err := w.networkAdapters()
+	if err != nil {
+		return nil, err
+	}
+	expected := &NodeExpectations{
+		Labels: map[string]string{"kubernetes.io/os": "windows", "beta.kubernetes.io/os": "windows",
+			"kubernetes.io/arch": "amd64", windowsBuildLabel: facts.Build},
+		CPUs:        facts.LogicalProcessors,
+		MemoryBytes: facts.MemoryBytes,
+	}
+	for _, adapter := range adapters {
+		for _, address := range adapter.Addresses {
+			expected.InternalIPs = append(expected.InternalIPs, address.IP)
+		}
+	}
+
+	instanceID := w.GetCredentials().GetInstanceId()
+	switch cloud := w.cloudProvider.(type) {
+	case *aws.AwsProvider:
+		expected.Platform = "AWS"
+		instance, err := cloud.GetInstance(instanceID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting instance %s: %v", instanceID, err)
+		}
+		zone := ""
+		if instance.Placement != nil && instance.Placement.AvailabilityZone != nil {
+			zone = *instance.Placement.AvailabilityZone
+		}
+		expected.ProviderID = regexp.MustCompile("^" + regexp.QuoteMeta("aws:///"+zone+"/"+instanceID) + "$")
+	case *azure.AzureProvider:
+		expected.Platform = "Azure"
+		// The resource group of the VM is the one of the cluster, which the framework does not know
+		expected.ProviderID = regexp.MustCompile("(?i)^azure:///subscriptions/[^/]+/resourceGroups/[^/]+/providers/" +
+			"Microsoft.Compute/virtualMachines/" + regexp.QuoteMeta(instanceID) + "$")
+	}
+	return expected, nil
+}
+
+// CheckNodeMetadata checks the metadata the given node registered with against the given expectations, so that a
+// node bootstrapped with the wrong configuration fails the tests even though it is Ready. All the mismatches are
+// returned together.
+func CheckNodeMetadata(node *v1.Node, expected *NodeExpectations) error {
+	errs := NewMultiError("check the metadata of node " + node.Name)
+	for key, value := range expected.Labels {
+		if actual, ok := node.Labels[key]; !ok {
+			errs.Appendf("label %s is missing, expected %q", key, value)
+		} else if actual != value {
+			errs.Appendf("label %s is %q, expected %q", key, actual, value)
+		}
+	}
+
+	var internalIPs []string
+	hostname := false
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeInternalIP:
+			internalIPs = append(internalIPs, address.Address)
+			if !containsIP(expected.InternalIPs, address.Address) {
+				errs.Appendf("internal IP %s is not an address of the VM, expected one of %v", address.Address,
+					expected.InternalIPs)
+			}
+		case v1.NodeHostName:
+			hostname = address.Address != ""
+		}
+	}
+	if len(internalIPs) == 0 {
+		errs.Appendf("no internal IP, expected one of %v", expected.InternalIPs)
+	}
+	if !hostname {
+		errs.Appendf("no hostname address")
+	}
+
+	switch {
+	case expected.ProviderID == nil && node.Spec.ProviderID != "":
+		errs.Appendf("provider ID is %q, expected none", node.Spec.ProviderID)
+	case expected.ProviderID != nil && !expected.ProviderID.MatchString(node.Spec.ProviderID):
+		errs.Appendf("provider ID %q does not match the %s instance of the VM, %s", node.Spec.ProviderID,
+			expected.Platform, expected.ProviderID)
+	}
+
+	capacity, allocatable := node.Status.Capacity, node.Status.Allocatable
+	if cpus := capacity.Cpu().Value(); expected.CPUs > 0 && cpus != expected.CPUs {
+		errs.Appendf("CPU capacity is %d, expected the %d logical processors of the VM", cpus, expected.CPUs)
+	}
+	if memory := capacity.Memory().Value(); expected.MemoryBytes > 0 &&
+		math.Abs(float64(memory-expected.MemoryBytes)) > memoryCapacityTolerance*float64(expected.MemoryBytes) {
+		errs.Appendf("memory capacity is %d bytes, expected the %d bytes of the VM", memory, expected.MemoryBytes)
+	}
+	for _, resource := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourcePods} {
+		quantity, ok := allocatable[resource]
+		if !ok || quantity.Sign() <= 0 {
+			errs.Appendf("no allocatable %s", resource)
+			continue
+		}
+		if limit, ok := capacity[resource]; ok && quantity.Cmp(limit) > 0 {
+			errs.Appendf("allocatable %s %s is over its capacity %s", resource, quantity.String(), limit.String())
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// containsIP returns true if the given IP address is among the given ones, which may have an IPv6 zone index
+func containsIP(ips []string, ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, candidate := range ips {
+		if i := strings.Index(candidate, "%"); i >= 0 {
+			candidate = candidate[:i]
+		}
+		if parsed != nil && parsed.Equal(net.ParseIP(candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyNodeMetadata checks the metadata the given node of the given Windows VM registered with against the ones
+// expected from the VM and its platform, like CheckNodeMetadata
+func VerifyNodeMetadata(vm WindowsVM, node *v1.Node) error {
+	expected, err := NodeExpectationsOf(vm)
+	if err != nil {
+		return fmt.Errorf("error getting the expected metadata of node %s: %v", node.Name, err)
+	}
+	return CheckNodeMetadata(node, expected)
+}
@@ -0,0 +1,84 @@
+package e2efw
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestCheckNodeMetadata tests that a node registered with the labels, addresses, provider ID and capacity expected
+// from its VM passes, and that every mismatch of a node present but wrong is reported
+func TestCheckNodeMetadata(t *testing.T) {
+	expected := &NodeExpectations{
+		Platform: "AWS",
+		Labels: map[string]string{"kubernetes.io/os": "windows", "kubernetes.io/arch": "amd64",
+			windowsBuildLabel: "10.0.17763"},
+		InternalIPs: []string{"10.0.1.20", "fe80::1%5"},
+		ProviderID:  regexp.MustCompile("^" + regexp.QuoteMeta("aws:///us-east-1a/i-0123456789") + "$"),
+		CPUs:        2,
+		MemoryBytes: 8 * 1024 * 1024 * 1024,
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "winnode", Labels: map[string]string{"kubernetes.io/os": "windows",
+			"kubernetes.io/arch": "amd64", windowsBuildLabel: "10.0.17763"}},
+		Spec: v1.NodeSpec{ProviderID: "aws:///us-east-1a/i-0123456789"},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.1.20"},
+				{Type: v1.NodeHostName, Address: "winnode"}},
+			Capacity: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("8388148Ki"), v1.ResourcePods: resource.MustParse("250")},
+			Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1500m"),
+				v1.ResourceMemory: resource.MustParse("7261812Ki"), v1.ResourcePods: resource.MustParse("250")},
+		},
+	}
+	require.NoError(t, CheckNodeMetadata(node, expected))
+
+	node.Labels[windowsBuildLabel] = "10.0.14393"
+	delete(node.Labels, "kubernetes.io/arch")
+	node.Spec.ProviderID = ""
+	node.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "172.17.0.1"}}
+	node.Status.Capacity[v1.ResourceCPU] = resource.MustParse("1")
+	node.Status.Allocatable[v1.ResourceMemory] = resource.MustParse("16Gi")
+	delete(node.Status.Allocatable, v1.ResourcePods)
+	err := CheckNodeMetadata(node, expected)
+	require.Error(t, err)
+	assert.ElementsMatch(t, []string{
+		`label node.kubernetes.io/windows-build is "10.0.14393", expected "10.0.17763"`,
+		`label kubernetes.io/arch is missing, expected "amd64"`,
+		"internal IP 172.17.0.1 is not an address of the VM, expected one of [10.0.1.20 fe80::1%5]",
+		"no hostname address",
+		`provider ID "" does not match the AWS instance of the VM, ^aws:///us-east-1a/i-0123456789$`,
+		"CPU capacity is 1, expected the 2 logical processors of the VM",
+		"allocatable cpu 1500m is over its capacity 1",
+		"allocatable memory 16Gi is over its capacity 8388148Ki",
+		"no allocatable pods",
+	}, failureMessages(err))
+
+	// The nodes of the platforms without a cloud provider have no provider ID
+	expected.ProviderID = nil
+	node.Spec.ProviderID = "aws:///us-east-1a/i-0123456789"
+	assert.Contains(t, failureMessages(CheckNodeMetadata(node, expected)),
+		`provider ID is "aws:///us-east-1a/i-0123456789", expected none`)
+}
+
+// failureMessages returns the messages of the failures of the given error
+func failureMessages(err error) []string {
+	var messages []string
+	for _, failure := range Failures(err) {
+		messages = append(messages, failure.Error())
+	}
+	return messages
+}
+
+// TestContainsIP tests that the addresses of the VM match regardless of their notation and zone index
+func TestContainsIP(t *testing.T) {
+	assert.True(t, containsIP([]string{"10.0.1.20"}, "10.0.1.20"))
+	assert.True(t, containsIP([]string{"fe80::1%5"}, "fe80:0::1"))
+	assert.False(t, containsIP([]string{"10.0.1.20"}, "10.0.1.2"))
+	assert.False(t, containsIP([]string{"10.0.1.20"}, "winnode"))
+}
@@ -0,0 +1,221 @@
+package e2efw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// notifiersEnvVar is the environment variable giving the notifiers when -notify is not given
+	notifiersEnvVar = "E2E_NOTIFY"
+	// slackWebhookHost is the host of the Slack incoming webhooks, which are sent Slack messages
+	slackWebhookHost = "hooks.slack.com"
+	// notifyTimeout is how long a notifier is given to deliver a notification
+	notifyTimeout = 10 * time.Second
+
+	// NotifyVMCreation is the event of the creation and the set up of the Windows VMs of the run
+	NotifyVMCreation = "vm-creation"
+	// NotifyBootstrap is the event of the node of a Windows VM becoming Ready, or failing to, once WMCB is invoked
+	NotifyBootstrap = "bootstrap"
+	// NotifyGC is the event of the run collecting cloud resources or leases, i.e. the teardown of the Windows VMs and
+	// the takeover of the expired leases of other runs
+	NotifyGC = "gc"
+)
+
+// Notification tells the outcome of a long-running operation of the run, so that the teams running long scale tests
+// do not have to poll the CI logs
+type Notification struct {
+	// Event is one of NotifyVMCreation, NotifyBootstrap and NotifyGC
+	Event string `json:"event"`
+	// RunID is the ID of the run
+	RunID string `json:"runId"`
+	// Failed is true if the operation failed
+	Failed bool `json:"failed"`
+	// Message describes the outcome of the operation
+	Message string `json:"message"`
+	// Links are the locations the artifacts of the run are stored in
+	Links []string `json:"links,omitempty"`
+	// Time is when the operation ended
+	Time time.Time `json:"time"`
+}
+
+// Notifier delivers the notifications of the run, e.g. to a chat channel
+type Notifier interface {
+	// Notify delivers the given notification
+	Notify(Notification) error
+	// String returns the location of the notifier, without the secret parts of its URL
+	String() string
+}
+
+// Notifiers is used for parsing the notify command line argument
+type Notifiers []Notifier
+
+// Set populates the notifiers from the comma separated list of webhook URLs of the notify command line argument. The
+// Slack incoming webhooks, on hooks.slack.com, are sent Slack messages and the other URLs the notifications as JSON.
+func (n *Notifiers) Set(value string) error {
+	for _, location := range strings.Split(value, ",") {
+		if location = strings.TrimSpace(location); location == "" {
+			continue
+		}
+		notifier, err := ParseNotifier(location)
+		if err != nil {
+			return err
+		}
+		*n = append(*n, notifier)
+	}
+	return nil
+}
+
+func (n *Notifiers) String() string {
+	var locations []string
+	for _, notifier := range *n {
+		locations = append(locations, notifier.String())
+	}
+	return strings.Join(locations, ",")
+}
+
+// ParseNotifier returns the notifier of the given http or https webhook URL, which is sent Slack messages if it is a
+// Slack incoming webhook and the notifications as JSON otherwise
+func ParseNotifier(location string) (Notifier, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifier %s: %v", location, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid notifier %s, expected an http or https webhook URL", location)
+	}
+	hook := &webhook{url: u.String(), client: &http.Client{Timeout: notifyTimeout}}
+	if u.Hostname() == slackWebhookHost {
+		return &slackNotifier{webhook: hook}, nil
+	}
+	return &webhookNotifier{webhook: hook}, nil
+}
+
+// notifiersFromEnv returns the notifiers given by E2E_NOTIFY
+func notifiersFromEnv() (Notifiers, error) {
+	var notifiers Notifiers
+	if err := notifiers.Set(os.Getenv(notifiersEnvVar)); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", notifiersEnvVar, err)
+	}
+	return notifiers, nil
+}
+
+// webhook posts JSON payloads to a URL
+type webhook struct {
+	// url is the URL of the webhook, which usually holds a secret token
+	url string
+	// client posts the payloads
+	client *http.Client
+}
+
+// post posts the given payload as JSON
+func (w *webhook) post(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error holds the URL and its token
+		return fmt.Errorf("error posting to %s", w)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", w, resp.Status)
+	}
+	return nil
+}
+
+// String returns the scheme and host of the webhook, as its path and query usually hold a token
+func (w *webhook) String() string {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// webhookNotifier posts the notifications as JSON
+type webhookNotifier struct {
+	*webhook
+}
+
+func (w *webhookNotifier) Notify(n Notification) error {
+	return w.post(n)
+}
+
+// slackNotifier posts the notifications as messages to a Slack incoming webhook
+type slackNotifier struct {
+	*webhook
+}
+
+func (s *slackNotifier) Notify(n Notification) error {
+	return s.post(map[string]string{"text": slackText(n)})
+}
+
+// slackText returns the text of the Slack message of the given notification
+func slackText(n Notification) string {
+	status := ":white_check_mark:"
+	if n.Failed {
+		status = ":x:"
+	}
+	text := fmt.Sprintf("%s *%s* of e2e run `%s`: %s", status, n.Event, n.RunID, n.Message)
+	for _, link := range n.Links {
+		text += "\n" + link
+	}
+	return text
+}
+
+var (
+	// notifiersLock protects notifiers and notificationLinks
+	notifiersLock sync.RWMutex
+	// notifiers deliver the notifications of the run
+	notifiers Notifiers
+	// notificationLinks are the locations of the artifacts of the run, linked from the notifications
+	notificationLinks []string
+)
+
+// setupNotifiers sets the notifiers of the run, and links the notifications to where the given sinks store the
+// artifacts of the run
+func setupNotifiers(n Notifiers, sinks ArtifactSinks) {
+	var links []string
+	for _, sink := range sinks {
+		if _, ok := sink.(*dirSink); ok {
+			links = append(links, filepath.Join(sink.String(), "e2e-"+runID))
+		} else {
+			links = append(links, strings.TrimSuffix(sink.String(), "/")+"/e2e-"+runID+"/")
+		}
+	}
+	notifiersLock.Lock()
+	defer notifiersLock.Unlock()
+	notifiers = n
+	notificationLinks = links
+}
+
+// notify delivers the notification of the given event to the notifiers of the run, as failed if the given error is
+// not nil. Failing to deliver it is logged and does not fail the run.
+func notify(event string, err error, format string, args ...interface{}) {
+	notifiersLock.RLock()
+	n := Notification{Event: event, RunID: runID, Message: fmt.Sprintf(format, args...), Links: notificationLinks,
+		Time: time.Now().UTC()}
+	targets := notifiers
+	notifiersLock.RUnlock()
+	if err != nil {
+		n.Failed = true
+		n.Message += ": " + err.Error()
+	}
+	for _, notifier := range targets {
+		if err := notifier.Notify(n); err != nil {
+			log.Printf("unable to deliver the %s notification: %v", event, err)
+		}
+	}
+}
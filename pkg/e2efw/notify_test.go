@@ -0,0 +1,85 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseNotifier tests that the Slack incoming webhooks are told from the other webhooks, and that the tokens of
+// their URLs are not shown
+func TestParseNotifier(t *testing.T) {
+	notifier, err := ParseNotifier("https://hooks.slack.com/services/T000/B000/XXXX")
+	require.NoError(t, err)
+	assert.IsType(t, &slackNotifier{}, notifier)
+	assert.Equal(t, "https://hooks.slack.com", notifier.String())
+	notifier, err = ParseNotifier("http://ci-bot.example.com:8080/hooks/e2e?token=secret")
+	require.NoError(t, err)
+	assert.IsType(t, &webhookNotifier{}, notifier)
+	assert.Equal(t, "http://ci-bot.example.com:8080", notifier.String())
+
+	for _, invalid := range []string{"ci-bot.example.com/hook", "ftp://ci-bot.example.com/hook", "https://", "%zz"} {
+		_, err = ParseNotifier(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	var notifiers Notifiers
+	require.NoError(t, notifiers.Set(" https://hooks.slack.com/services/T000/B000/XXXX, ,https://example.com/hook"))
+	assert.Equal(t, "https://hooks.slack.com,https://example.com", notifiers.String())
+}
+
+// TestNotify tests that the notifications are posted to the webhooks as JSON or Slack messages, with the locations of
+// the artifacts of the run, and that failing to deliver them is not fatal
+func TestNotify(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		bodies = append(bodies, string(body))
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	webhook, err := ParseNotifier(server.URL + "/hook")
+	require.NoError(t, err)
+	broken, err := ParseNotifier(server.URL + "/broken")
+	require.NoError(t, err)
+	slack := &slackNotifier{webhook: webhook.(*webhookNotifier).webhook}
+	sinks := ArtifactSinks{&dirSink{dir: "/mnt/artifacts"}, &objectSink{scheme: "s3", bucket: "ci", prefix: "win/"}}
+	defer func(id string) { runID = id }(runID)
+	runID = "1a2b3c"
+	setupNotifiers(Notifiers{broken, webhook, slack}, sinks)
+	defer setupNotifiers(nil, nil)
+
+	notify(NotifyBootstrap, fmt.Errorf("node winnode is not Ready"), "bootstrap of %s", "10.0.0.5")
+	require.Len(t, bodies, 3)
+	var n Notification
+	require.NoError(t, json.Unmarshal([]byte(bodies[1]), &n))
+	assert.Equal(t, NotifyBootstrap, n.Event)
+	assert.Equal(t, "1a2b3c", n.RunID)
+	assert.True(t, n.Failed)
+	assert.Equal(t, "bootstrap of 10.0.0.5: node winnode is not Ready", n.Message)
+	assert.Equal(t, []string{"/mnt/artifacts/e2e-1a2b3c", "s3://ci/win/e2e-1a2b3c/"}, n.Links)
+
+	var message map[string]string
+	require.NoError(t, json.Unmarshal([]byte(bodies[2]), &message))
+	assert.Equal(t, ":x: *bootstrap* of e2e run `1a2b3c`: bootstrap of 10.0.0.5: node winnode is not Ready\n"+
+		"/mnt/artifacts/e2e-1a2b3c\ns3://ci/win/e2e-1a2b3c/", message["text"])
+
+	// Without notifiers, the notifications are dropped
+	setupNotifiers(nil, nil)
+	notify(NotifyGC, nil, "tore down the Windows VMs of the run")
+	assert.Len(t, bodies, 3)
+}
@@ -0,0 +1,198 @@
+package e2efw
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// outputSpillThresholdEnvVar is the environment variable holding the size over which the output of a command is
+	// spilled to a file of ARTIFACT_DIR instead of being held in memory, e.g. 64Mi, defaultOutputSpillThreshold if not
+	// set
+	outputSpillThresholdEnvVar = "E2E_OUTPUT_SPILL_THRESHOLD"
+	// defaultOutputSpillThreshold is the size over which the output of a command is spilled to a file by default
+	defaultOutputSpillThreshold = 16 * 1024 * 1024
+	// outputPreviewSize is the maximum size of the beginning and of the end of a spilled output that are kept in the
+	// preview returned in its place
+	outputPreviewSize = 32 * 1024
+	// outputSpillDir is the directory of ARTIFACT_DIR the spilled outputs are written to
+	outputSpillDir = "command-output"
+)
+
+// outputSpillThreshold is the size over which the output of a command is spilled to a file
+var outputSpillThreshold int64 = defaultOutputSpillThreshold
+
+// outputCaptures is the number of outputs captured so far, which numbers the files they are spilled to
+var outputCaptures int64
+
+// outputSpillThresholdFromEnv returns the spill threshold given by E2E_OUTPUT_SPILL_THRESHOLD,
+// defaultOutputSpillThreshold if not set
+func outputSpillThresholdFromEnv() (int64, error) {
+	value := strings.TrimSpace(os.Getenv(outputSpillThresholdEnvVar))
+	if value == "" {
+		return defaultOutputSpillThreshold, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Value() <= 0 {
+		return 0, fmt.Errorf("invalid %s %s, expected a positive size, e.g. 64Mi", outputSpillThresholdEnvVar, value)
+	}
+	return quantity.Value(), nil
+}
+
+// OutputCapture captures the output of a command, or of a stream such as the one of TailFile, in memory until it
+// exceeds the spill threshold given by E2E_OUTPUT_SPILL_THRESHOLD. The output is then written to a file of the
+// command-output directory of ARTIFACT_DIR, and only its beginning and end are kept in memory. It is safe for
+// concurrent writes, e.g. of the stdout and stderr of a ssh session.
+type OutputCapture struct {
+	// name is the name of the file the output is spilled to, without its number
+	name string
+	// threshold is the size over which the output is spilled
+	threshold int64
+	// previewSize is the size of the beginning and of the end of the output kept once it is spilled
+	previewSize int
+
+	lock sync.Mutex
+	// buf holds the output until it is spilled
+	buf bytes.Buffer
+	// file is the file the output is spilled to, nil until it is
+	file *os.File
+	// path is the path of the file the output is spilled to
+	path string
+	// spilled is set once the output exceeds the threshold
+	spilled bool
+	// head and tail are the beginning and the end of the spilled output
+	head, tail []byte
+	// size is the size of the output written so far
+	size int64
+	// err is the error writing the spilled output, after which the output is only counted
+	err error
+}
+
+// NewOutputCapture returns a capture of the output of the given host, whose spill file is named after the host and the
+// given stream, e.g. stdout
+func NewOutputCapture(host, stream string) *OutputCapture {
+	return newOutputCapture(host+"-"+stream, outputSpillThreshold)
+}
+
+// newOutputCapture returns a capture spilling to a file of the given name once over the given threshold
+func newOutputCapture(name string, threshold int64) *OutputCapture {
+	previewSize := outputPreviewSize
+	if int64(previewSize) > threshold/2 {
+		previewSize = int(threshold / 2)
+	}
+	return &OutputCapture{name: strings.NewReplacer(":", "-", "/", "-", "\\", "-").Replace(name),
+		threshold: threshold, previewSize: previewSize}
+}
+
+// Write captures the given output. It never fails, the errors writing the spill file being reported by String, so
+// that a command is not interrupted by the capture of its output.
+func (c *OutputCapture) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size += int64(len(p))
+	if !c.spilled {
+		if int64(c.buf.Len()+len(p)) <= c.threshold {
+			return c.buf.Write(p)
+		}
+		c.buf.Write(p)
+		c.spill()
+		return len(p), nil
+	}
+	c.tail = appendTail(c.tail, p, c.previewSize)
+	if c.file != nil && c.err == nil {
+		if _, err := c.file.Write(p); err != nil {
+			c.err = fmt.Errorf("error writing %s: %v", c.path, err)
+		}
+	}
+	return len(p), nil
+}
+
+// spill writes the output held in memory to the spill file and releases it, keeping its beginning and end
+func (c *OutputCapture) spill() {
+	c.spilled = true
+	data := c.buf.Bytes()
+	c.head = append([]byte(nil), data[:c.previewSize]...)
+	c.tail = appendTail(nil, data, c.previewSize)
+	defer func() { c.buf = bytes.Buffer{} }()
+
+	dir := filepath.Join(artifactDir, outputSpillDir)
+	if artifactDir == "" {
+		dir = filepath.Join(os.TempDir(), outputSpillDir)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		c.err = fmt.Errorf("error creating %s: %v", dir, err)
+		return
+	}
+	c.path = filepath.Join(dir, fmt.Sprintf("%s-%d.log", c.name, atomic.AddInt64(&outputCaptures, 1)))
+	file, err := os.Create(c.path)
+	if err != nil {
+		c.err = fmt.Errorf("error creating %s: %v", c.path, err)
+		return
+	}
+	c.file = file
+	if _, err = file.Write(data); err != nil {
+		c.err = fmt.Errorf("error writing %s: %v", c.path, err)
+		return
+	}
+	log.Printf("output over %d bytes spilled to %s", c.threshold, c.path)
+}
+
+// appendTail returns the last size bytes of tail followed by p
+func appendTail(tail, p []byte, size int) []byte {
+	if len(p) >= size {
+		return append(tail[:0], p[len(p)-size:]...)
+	}
+	if overflow := len(tail) + len(p) - size; overflow > 0 {
+		tail = append(tail[:0], tail[overflow:]...)
+	}
+	return append(tail, p...)
+}
+
+// String returns the captured output, or the beginning and the end of it along with the path of the file holding all
+// of it once it is spilled
+func (c *OutputCapture) String() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.spilled {
+		return c.buf.String()
+	}
+	omitted := c.size - int64(len(c.head)) - int64(len(c.tail))
+	note := fmt.Sprintf("\n... %d bytes truncated, the full output of %d bytes is in %s ...\n", omitted, c.size,
+		c.path)
+	if c.err != nil {
+		note = fmt.Sprintf("\n... %d bytes truncated, the full output of %d bytes could not be kept: %v ...\n",
+			omitted, c.size, c.err)
+	}
+	return string(c.head) + note + string(c.tail)
+}
+
+// Path returns the path of the file the output is spilled to, empty if it is held in memory
+func (c *OutputCapture) Path() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.path
+}
+
+// Close closes the spill file, if any
+func (c *OutputCapture) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	if c.err == nil && err != nil {
+		c.err = fmt.Errorf("error closing %s: %v", c.path, err)
+		return c.err
+	}
+	return nil
+}
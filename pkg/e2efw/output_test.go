@@ -0,0 +1,98 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOutputSpillThresholdFromEnv tests the parsing of E2E_OUTPUT_SPILL_THRESHOLD
+func TestOutputSpillThresholdFromEnv(t *testing.T) {
+	defer os.Setenv(outputSpillThresholdEnvVar, os.Getenv(outputSpillThresholdEnvVar))
+	for value, expected := range map[string]int64{"": defaultOutputSpillThreshold, "64Mi": 64 * 1024 * 1024,
+		"1000": 1000} {
+		require.NoError(t, os.Setenv(outputSpillThresholdEnvVar, value))
+		threshold, err := outputSpillThresholdFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, expected, threshold, value)
+	}
+	for _, value := range []string{"0", "-1Mi", "large"} {
+		require.NoError(t, os.Setenv(outputSpillThresholdEnvVar, value))
+		_, err := outputSpillThresholdFromEnv()
+		assert.Error(t, err, value)
+	}
+}
+
+// TestOutputCapture tests that the outputs under the threshold are held in memory, and that the larger ones are
+// written to a file of ARTIFACT_DIR in full with only their beginning and end returned
+func TestOutputCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+
+	small := newOutputCapture("10.0.1.2-stdout", 16)
+	_, err = small.Write([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	require.NoError(t, small.Close())
+	assert.Equal(t, "0123456789abcdef", small.String())
+	assert.Empty(t, small.Path())
+
+	large := newOutputCapture("fd00::1-stdout", 16)
+	for _, chunk := range []string{"0123456789", "abcdefghij", "klmnopqrst", "uvwxyz"} {
+		n, err := large.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, large.Close())
+	path := large.Path()
+	assert.Equal(t, filepath.Join(dir, outputSpillDir), filepath.Dir(path))
+	assert.True(t, strings.HasPrefix(filepath.Base(path), "fd00--1-stdout-"), path)
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdefghijklmnopqrstuvwxyz", string(contents))
+	assert.Equal(t, "01234567\n... 20 bytes truncated, the full output of 36 bytes is in "+path+" ...\nstuvwxyz",
+		large.String())
+}
+
+// TestRunOverSSHSpillsOutput tests that the output of a command over the threshold is spilled to a file
+func TestRunOverSSHSpillsOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+	defer func(threshold int64) { outputSpillThreshold = threshold }(outputSpillThreshold)
+	outputSpillThreshold = 16
+
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+	}
+	defer func() { w.ssh().close() }()
+
+	out, err := w.runOverSSH("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", out)
+
+	cmd := "Get-Content -Path C:\\k\\kubelet.log"
+	out, err = w.runOverSSH(cmd, false)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "Get-Cont\n... "), out)
+	assert.True(t, strings.HasSuffix(out, " ...\nelet.log"), out)
+	files, err := ioutil.ReadDir(filepath.Join(dir, outputSpillDir))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, outputSpillDir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, cmd, string(contents))
+}
@@ -0,0 +1,91 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+)
+
+const (
+	// payloadSourceEnvVar is the environment variable holding the spec of the payload source overriding the sources
+	// of all the artifacts used by the test suites, e.g. a local directory or an HTTP mirror for disconnected clusters,
+	// in the format of the --source option of the fetch-payload command of WMCB
+	payloadSourceEnvVar = "E2E_PAYLOAD_SOURCE"
+	// wmcbOwner is the owner of the WMCB GitHub repository
+	wmcbOwner = "openshift"
+	// wmcbRepo is the name of the WMCB GitHub repository
+	wmcbRepo = "windows-machine-config-bootstrapper"
+)
+
+// PayloadSource is a source of the artifacts used by the test suites, like the kubelet, the CNI plugins, the hybrid
+// overlay or WMCB itself. The sources of the payload package of WMCB, e.g. payload.HTTPMirror, are used.
+type PayloadSource = payload.PayloadSource
+
+// RemotePayloadSource is implemented by the payload sources whose artifacts can be downloaded by the VMs themselves,
+// instead of being fetched locally and copied to the VMs
+type RemotePayloadSource = payload.RemoteSource
+
+// ChecksumPayloadSource is implemented by the payload sources publishing the SHA256 of their artifacts
+type ChecksumPayloadSource = payload.ChecksumSource
+
+// PayloadSource returns the payload source set with the E2E_PAYLOAD_SOURCE environment variable if any, the given
+// default source of an artifact otherwise
+func (f *TestFramework) PayloadSource(defaultSource PayloadSource) PayloadSource {
+	if f.payloadOverride != nil {
+		return f.payloadOverride
+	}
+	return defaultSource
+}
+
+// FetchPayloadArtifact writes the artifact with the given name from the given source, or from the source overriding
+// it, to the given path on the VM. The artifact is downloaded by the VM if the source allows it, or fetched locally
+// and copied to the VM otherwise. An existing file is kept, which helps with local development.
+func (f *TestFramework) FetchPayloadArtifact(vm WindowsVM, source PayloadSource, name, remotePath string) error {
+	source = f.PayloadSource(source)
+	stdout, _, err := vm.Run(PowerShellScript("Test-Path "+PowerShellString(remotePath)), true)
+	if err != nil {
+		return fmt.Errorf("error checking if %s exists: %v", remotePath, err)
+	}
+	if strings.TrimSpace(stdout) == "True" {
+		return nil
+	}
+
+	if remoteSource, ok := source.(RemotePayloadSource); ok {
+		url, err := remoteSource.URL(name)
+		if err != nil {
+			return fmt.Errorf("error getting URL of %s from %s: %v", name, source, err)
+		}
+		_, stderr, err := vm.Run(PowerShellScript("Invoke-WebRequest -UseBasicParsing -Uri "+PowerShellString(url)+
+			" -OutFile "+PowerShellString(remotePath)), true)
+		if err != nil {
+			return fmt.Errorf("unable to download %s: %v\n%s", url, err, stderr)
+		}
+		return nil
+	}
+
+	localDir, err := ioutil.TempDir("", "payload")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(localDir)
+	// The artifact is fetched under the name of the remote file, as files are copied to a directory of the VM
+	localPath := filepath.Join(localDir, remotepath.Base(remotePath))
+	if err = source.Fetch(name, localPath); err != nil {
+		return fmt.Errorf("error fetching %s from %s: %v", name, source, err)
+	}
+	if err = vm.CopyFile(localPath, remotepath.Dir(remotePath)); err != nil {
+		return fmt.Errorf("error copying %s to the VM: %v", name, err)
+	}
+	return nil
+}
+
+// newWMCBReleaseSource returns the PayloadSource of the assets of the latest WMCB release for the given OpenShift
+// version, whose name contains the version
+func newWMCBReleaseSource(clusterVersion string) PayloadSource {
+	return &payload.GitHubRelease{Owner: wmcbOwner, Repo: wmcbRepo, NameContains: clusterVersion}
+}
@@ -0,0 +1,22 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPayloadSource tests that the WMCB release of the cluster version is used unless the sources are overridden
+func TestPayloadSource(t *testing.T) {
+	release := newWMCBReleaseSource("4.4")
+	assert.Equal(t, "latest 4.4 GitHub release of openshift/windows-machine-config-bootstrapper", release.String())
+	_, ok := release.(ChecksumPayloadSource)
+	assert.True(t, ok, "the SHA256 of the WMCB release assets should be published")
+
+	f := &TestFramework{}
+	assert.Equal(t, release, f.PayloadSource(release))
+	local := &payload.LocalDir{Dir: "payload"}
+	f.payloadOverride = local
+	assert.Equal(t, local, f.PayloadSource(release))
+}
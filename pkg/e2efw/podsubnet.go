@@ -0,0 +1,123 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// HybridClusterNetwork is the network the hybrid overlay allocates the subnets of the Windows nodes from, as
+	// configured by ApplyHybridOverlayPatch
+	HybridClusterNetwork = "10.132.0.0/14"
+	// hybridHostPrefix is the prefix length of the subnets the hybrid overlay allocates to the Windows nodes
+	hybridHostPrefix = 23
+)
+
+// isWindowsNode returns true if the given node is labeled as a Windows node
+func isWindowsNode(node *v1.Node) bool {
+	return node.Labels["kubernetes.io/os"] == "windows" || node.Labels["beta.kubernetes.io/os"] == "windows"
+}
+
+// PodSubnet returns the subnet the pods of the given node get their IPs from: the subnet the hybrid overlay allocated
+// to a Windows node, in its hybrid overlay subnet annotation, or the pod CIDR of any other node
+func PodSubnet(node *v1.Node) (*net.IPNet, error) {
+	cidr := node.Spec.PodCIDR
+	if isWindowsNode(node) {
+		var ok bool
+		if cidr, ok = node.Annotations[HybridOverlaySubnet]; !ok {
+			return nil, fmt.Errorf("the hybrid overlay did not allocate a subnet to node %s, it has no %s annotation",
+				node.Name, HybridOverlaySubnet)
+		}
+	} else if cidr == "" {
+		return nil, fmt.Errorf("no pod CIDR allocated to node %s", node.Name)
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod subnet %q of node %s: %v", cidr, node.Name, err)
+	}
+	return subnet, nil
+}
+
+// CheckNodeSubnets checks the subnets the hybrid overlay allocated to the given Windows nodes: each one has a subnet
+// of the host prefix in the hybrid cluster network, and no two subnets overlap
+func CheckNodeSubnets(nodes []v1.Node) error {
+	_, network, err := net.ParseCIDR(HybridClusterNetwork)
+	if err != nil {
+		return err
+	}
+	errs := NewMultiError("check the subnets of the Windows nodes")
+	subnets := make(map[string]*net.IPNet, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		subnet, err := PodSubnet(node)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		if ones, _ := subnet.Mask.Size(); ones != hybridHostPrefix || !network.Contains(subnet.IP) {
+			errs.Appendf("subnet %s of node %s is not a /%d of the hybrid cluster network %s", subnet, node.Name,
+				hybridHostPrefix, HybridClusterNetwork)
+		}
+		for name, other := range subnets {
+			if subnet.Contains(other.IP) || other.Contains(subnet.IP) {
+				errs.Appendf("subnet %s of node %s overlaps subnet %s of node %s", subnet, node.Name, other, name)
+			}
+		}
+		subnets[node.Name] = subnet
+	}
+	return errs.ErrorOrNil()
+}
+
+// CheckPodIP returns an error if the given pod has no IP yet, or an IP outside the given subnet of its node
+func CheckPodIP(pod *v1.Pod, subnet *net.IPNet) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod %s on node %s has no IP", pod.Name, pod.Spec.NodeName)
+	}
+	ip := net.ParseIP(pod.Status.PodIP)
+	if ip == nil || !subnet.Contains(ip) {
+		return fmt.Errorf("pod %s on node %s got IP %s, outside the subnet %s allocated to the node", pod.Name,
+			pod.Spec.NodeName, pod.Status.PodIP, subnet)
+	}
+	return nil
+}
+
+// CheckPodIPs checks that the running pods of the node with the given name got their IPs from the subnet allocated to
+// the node, which tells a subnet allocation bug of the hybrid overlay apart from the connection failures it causes.
+// The pods on the host network, which have the IP of the node, are skipped.
+func (f *TestFramework) CheckPodIPs(nodeName string) error {
+	return checkPodIPs(f.K8sclientset, nodeName)
+}
+
+// checkPodIPs checks the IPs of the running pods of the node with the given name with the given client
+func checkPodIPs(client kubernetes.Interface, nodeName string) error {
+	node, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting node %s: %v", nodeName, err)
+	}
+	subnet, err := PodSubnet(node)
+	if err != nil {
+		return err
+	}
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName})
+	if err != nil {
+		return fmt.Errorf("error listing the pods of node %s: %v", nodeName, err)
+	}
+	errs := NewMultiError(fmt.Sprintf("check the pod IPs of node %s in subnet %s", nodeName, subnet))
+	checked := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.HostNetwork || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		errs.Append(CheckPodIP(pod, subnet))
+		checked++
+	}
+	log.Printf("checked the IPs of %d pods of node %s against its subnet %s", checked, nodeName, subnet)
+	return errs.ErrorOrNil()
+}
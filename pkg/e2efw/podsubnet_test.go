@@ -0,0 +1,90 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// windowsNode returns a Windows node with the given name and hybrid overlay subnet, none if empty
+func windowsNode(name, subnet string) v1.Node {
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/os": "windows"},
+		Annotations: map[string]string{}}}
+	if subnet != "" {
+		node.Annotations[HybridOverlaySubnet] = subnet
+	}
+	return node
+}
+
+// TestPodSubnet tests that the subnet of the Windows nodes is read from the hybrid overlay annotation, and the one of
+// the other nodes from their pod CIDR
+func TestPodSubnet(t *testing.T) {
+	node := windowsNode("windows", "10.132.2.0/23")
+	node.Spec.PodCIDR = "10.128.0.0/23"
+	subnet, err := PodSubnet(&node)
+	require.NoError(t, err)
+	assert.Equal(t, "10.132.2.0/23", subnet.String())
+
+	linux := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "linux"}, Spec: v1.NodeSpec{PodCIDR: "10.128.0.0/23"}}
+	subnet, err = PodSubnet(&linux)
+	require.NoError(t, err)
+	assert.Equal(t, "10.128.0.0/23", subnet.String())
+
+	// A Windows node does not fall back to its pod CIDR, the hybrid overlay allocates its subnet
+	node = windowsNode("windows", "")
+	node.Spec.PodCIDR = "10.128.0.0/23"
+	_, err = PodSubnet(&node)
+	assert.Error(t, err)
+	node = windowsNode("windows", "10.132.2.0")
+	_, err = PodSubnet(&node)
+	assert.Error(t, err)
+	_, err = PodSubnet(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "linux"}})
+	assert.Error(t, err)
+}
+
+// TestCheckNodeSubnets tests that the subnets of the Windows nodes are checked against the hybrid cluster network and
+// against each other
+func TestCheckNodeSubnets(t *testing.T) {
+	assert.NoError(t, CheckNodeSubnets([]v1.Node{windowsNode("first", "10.132.0.0/23"),
+		windowsNode("second", "10.132.2.0/23")}))
+
+	err := CheckNodeSubnets([]v1.Node{windowsNode("first", "10.132.0.0/23"), windowsNode("second", "10.132.0.0/23"),
+		windowsNode("third", "10.128.0.0/23"), windowsNode("fourth", "10.132.4.0/24"), windowsNode("fifth", "")})
+	require.Error(t, err)
+	failures := Failures(err)
+	require.Len(t, failures, 4)
+	assert.Contains(t, failures[0].Error(), "subnet 10.132.0.0/23 of node second overlaps subnet 10.132.0.0/23 of "+
+		"node first")
+	assert.Contains(t, failures[1].Error(), "subnet 10.128.0.0/23 of node third is not a /23")
+	assert.Contains(t, failures[2].Error(), "subnet 10.132.4.0/24 of node fourth is not a /23")
+	assert.Contains(t, failures[3].Error(), "node fifth")
+}
+
+// TestCheckPodIPs tests that only the running pods off the host network are checked against the subnet of the node
+func TestCheckPodIPs(t *testing.T) {
+	node := windowsNode("windows", "10.132.2.0/23")
+	pod := func(name, ip string, hostNetwork bool, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: v1.NamespaceDefault},
+			Spec:   v1.PodSpec{NodeName: "windows", HostNetwork: hostNetwork},
+			Status: v1.PodStatus{PodIP: ip, Phase: phase}}
+	}
+	client := fake.NewSimpleClientset(&node, pod("in-subnet", "10.132.3.4", false, v1.PodRunning),
+		pod("host-network", "10.0.0.10", true, v1.PodRunning), pod("pending", "", false, v1.PodPending))
+	assert.NoError(t, checkPodIPs(client, "windows"))
+
+	client = fake.NewSimpleClientset(&node, pod("in-subnet", "10.132.3.4", false, v1.PodRunning),
+		pod("outside", "10.132.4.4", false, v1.PodRunning), pod("no-ip", "", false, v1.PodRunning))
+	err := checkPodIPs(client, "windows")
+	require.Error(t, err)
+	failures := Failures(err)
+	require.Len(t, failures, 2)
+	assert.ElementsMatch(t, []string{
+		"pod outside on node windows got IP 10.132.4.4, outside the subnet 10.132.2.0/23 allocated to the node",
+		"pod no-ip on node windows has no IP"}, []string{failures[0].Error(), failures[1].Error()})
+
+	assert.Error(t, checkPodIPs(client, "missing"))
+}
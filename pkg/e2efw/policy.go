@@ -0,0 +1,124 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+)
+
+const (
+	// commandPolicyEnvVar is the environment variable holding the path of the command policy restricting the remote
+	// commands run on the Windows VMs, none being restricted if not set
+	commandPolicyEnvVar = "E2E_COMMAND_POLICY"
+	// CommandPolicyEnforce is the mode of a command policy refusing to run the commands it does not allow
+	CommandPolicyEnforce = "enforce"
+	// CommandPolicyAudit is the mode of a command policy only logging the commands it does not allow, to build the
+	// allow-list of the tests before enforcing it
+	CommandPolicyAudit = "audit"
+)
+
+// commandPolicy is the policy the remote commands are checked against, nil if they are not restricted
+var commandPolicy *CommandPolicy
+
+// CommandPolicy restricts the remote commands the framework runs on the Windows VMs to an allow-list, as a guardrail
+// against the destructive test steps when the tests are pointed at shared, semi-production machines
+type CommandPolicy struct {
+	// Mode is CommandPolicyEnforce, the default, or CommandPolicyAudit
+	Mode string `json:"mode,omitempty"`
+	// Allow are the regular expressions of the allowed commands. A command is allowed if one of them matches it, with
+	// its PowerShell script decoded and its whitespace collapsed; they are not anchored.
+	Allow []string `json:"allow"`
+	// allow are the compiled Allow expressions
+	allow []*regexp.Regexp
+}
+
+// CommandDeniedError is the error of a remote command refused by the command policy
+type CommandDeniedError struct {
+	// Host is the IP address of the Windows VM the command was to run on
+	Host string
+	// Command is the denied command, decoded
+	Command string
+}
+
+func (e *CommandDeniedError) Error() string {
+	return fmt.Sprintf("command denied by the command policy on %s: %s", e.Host, displayCommand(e.Command))
+}
+
+// ParseCommandPolicy parses the given JSON command policy and compiles its allow-list
+func ParseCommandPolicy(content []byte) (*CommandPolicy, error) {
+	var policy CommandPolicy
+	if err := json.Unmarshal(content, &policy); err != nil {
+		return nil, err
+	}
+	switch policy.Mode {
+	case "":
+		policy.Mode = CommandPolicyEnforce
+	case CommandPolicyEnforce, CommandPolicyAudit:
+	default:
+		return nil, fmt.Errorf("invalid mode %s, expected %s or %s", policy.Mode, CommandPolicyEnforce,
+			CommandPolicyAudit)
+	}
+	for _, pattern := range policy.Allow {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed command %s: %v", pattern, err)
+		}
+		policy.allow = append(policy.allow, regex)
+	}
+	return &policy, nil
+}
+
+// commandPolicyFromEnv returns the command policy of the file given by E2E_COMMAND_POLICY, nil if not set
+func commandPolicyFromEnv() (*CommandPolicy, error) {
+	filePath := os.Getenv(commandPolicyEnvVar)
+	if filePath == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s %s: %v", commandPolicyEnvVar, filePath, err)
+	}
+	policy, err := ParseCommandPolicy(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s %s: %v", commandPolicyEnvVar, filePath, err)
+	}
+	log.Printf("the remote commands are restricted to the %d commands allowed by %s in %s mode", len(policy.allow),
+		filePath, policy.Mode)
+	return policy, nil
+}
+
+// Allows returns true if the policy allows the given remote command, which a nil policy always does
+func (p *CommandPolicy) Allows(cmd string) bool {
+	if p == nil {
+		return true
+	}
+	decoded := decodeCommand(cmd)
+	for _, regex := range p.allow {
+		if regex.MatchString(decoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCommand returns a *CommandDeniedError if the command policy does not allow the given command to run on the
+// Windows VM over the given transport. The denials are logged, and only logged in audit mode.
+func (w *windowsVM) checkCommand(transport, cmd string) error {
+	if commandPolicy.Allows(cmd) {
+		return nil
+	}
+	host := ""
+	if credentials := w.GetCredentials(); credentials != nil {
+		host = credentials.GetIPAddress()
+	}
+	if commandPolicy.Mode == CommandPolicyAudit {
+		log.Printf("%s command on %s not allowed by the command policy, audit mode: %s", transport, host,
+			displayCommand(cmd))
+		return nil
+	}
+	log.Printf("%s command on %s denied by the command policy: %s", transport, host, displayCommand(cmd))
+	return &CommandDeniedError{Host: host, Command: decodeCommand(cmd)}
+}
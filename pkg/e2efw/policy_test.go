@@ -0,0 +1,69 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCommandPolicy tests the parsing of the command policies
+func TestParseCommandPolicy(t *testing.T) {
+	policy, err := ParseCommandPolicy([]byte(`{"allow": ["^hostname$", "^Get-"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, CommandPolicyEnforce, policy.Mode)
+	assert.Len(t, policy.allow, 2)
+
+	policy, err = ParseCommandPolicy([]byte(`{"mode": "audit", "allow": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, CommandPolicyAudit, policy.Mode)
+
+	_, err = ParseCommandPolicy([]byte(`{"mode": "warn"}`))
+	assert.Error(t, err)
+	_, err = ParseCommandPolicy([]byte(`{"allow": ["Get-("]}`))
+	assert.Error(t, err)
+	_, err = ParseCommandPolicy([]byte(`allow: hostname`))
+	assert.Error(t, err)
+}
+
+// TestCommandPolicyAllows tests that the commands are matched with their PowerShell scripts decoded, and that a nil
+// policy allows every command
+func TestCommandPolicyAllows(t *testing.T) {
+	policy, err := ParseCommandPolicy([]byte(`{"allow": ["^hostname$", "^Get-Content "]}`))
+	require.NoError(t, err)
+	assert.True(t, policy.Allows("hostname"))
+	assert.True(t, policy.Allows(remotePowerShellCmdPrefix+PowerShellScript("Get-Content  -Path 'C:\\k\\log'")))
+	assert.False(t, policy.Allows(remotePowerShellCmdPrefix+PowerShellScript("Remove-Item -Recurse C:\\k")))
+	assert.False(t, policy.Allows("hostname; shutdown /s"))
+	assert.True(t, (*CommandPolicy)(nil).Allows("Format-Volume -DriveLetter C"))
+}
+
+// TestCheckCommand tests that the denied commands are not run in enforce mode, and are run in audit mode
+func TestCheckCommand(t *testing.T) {
+	defer func(policy *CommandPolicy) { commandPolicy = policy }(commandPolicy)
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+	}
+	defer func() { w.ssh().close() }()
+
+	var err error
+	commandPolicy, err = ParseCommandPolicy([]byte(`{"allow": ["^hostname$"]}`))
+	require.NoError(t, err)
+	out, err := w.runOverSSH("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", out)
+	_, err = w.runOverSSH("Restart-Computer -Force", true)
+	require.IsType(t, &CommandDeniedError{}, err)
+	assert.Equal(t, "command denied by the command policy on 127.0.0.1: Restart-Computer -Force", err.Error())
+	_, _, err = w.runOverSSHWithStderr(PowerShellScript("Restart-Computer -Force"), true)
+	assert.IsType(t, &CommandDeniedError{}, err)
+
+	commandPolicy.Mode = CommandPolicyAudit
+	out, err = w.runOverSSH("Restart-Computer -Force", false)
+	require.NoError(t, err)
+	assert.Equal(t, "Restart-Computer -Force", out)
+}
@@ -0,0 +1,30 @@
+package e2efw
+
+import (
+	"context"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+)
+
+// DefaultPollJitter is the jitter of the polls which do not need a specific one, adding up to 10% to their interval
+const DefaultPollJitter = poll.DefaultJitter
+
+// PollCondition checks whether the state waited for is reached. It is the condition of the poll module shared with
+// WMCB and the windows-node-installer.
+type PollCondition = poll.ConditionFunc
+
+// PollOptions are the options of Poll
+type PollOptions = poll.Options
+
+// PollTimeoutError is the error of a condition which was not reached before the timeout expired, the deadline passed
+// or the context was done
+type PollTimeoutError = poll.TimeoutError
+
+// Poll checks the condition until it is reached, as poll.Until does. The time is taken from clk unless the options
+// give a clock, so that the polls of the framework can be unit tested with a fake clock.
+func Poll(ctx context.Context, description string, options PollOptions, condition PollCondition) error {
+	if options.Clock == nil {
+		options.Clock = clk
+	}
+	return poll.Until(ctx, description, options, condition)
+}
@@ -0,0 +1,37 @@
+package e2efw
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPoll tests that the polls take the time from the clock of the framework
+func TestPoll(t *testing.T) {
+	fake, restore := useFakeClock()
+	defer restore()
+
+	checks := 0
+	err := Poll(context.Background(), "the third check", PollOptions{Interval: time.Second, Timeout: time.Minute,
+		Jitter: 0.5}, func() (bool, string, error) {
+		checks++
+		return checks == 3, fmt.Sprintf("check %d", checks), nil
+	})
+	require.NoError(t, err)
+	require.Len(t, fake.slept(), 2)
+	for _, wait := range fake.slept() {
+		assert.True(t, wait >= time.Second && wait <= 1500*time.Millisecond, "jittered wait %v", wait)
+	}
+
+	start := fake.Now()
+	err = Poll(context.Background(), "process 1234 to exit", PollOptions{Interval: 3 * time.Second,
+		Timeout: 10 * time.Second}, func() (bool, string, error) {
+		return false, "process 1234 is running", nil
+	})
+	assert.EqualError(t, err, "timed out after 10s waiting for process 1234 to exit, last state: process 1234 is running")
+	assert.Equal(t, 10*time.Second, fake.Now().Sub(start), "the last wait should be cut to the timeout")
+}
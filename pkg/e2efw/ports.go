@@ -0,0 +1,352 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+)
+
+// The sources a required port has to be reachable from
+const (
+	// SourceCluster is the cluster network, the nodes and the control plane in the VPC of the cluster
+	SourceCluster = "cluster"
+	// SourceManagement is the host managing the node, e.g. the test runner or the Ansible controller
+	SourceManagement = "management"
+)
+
+// The layers a required port is checked at
+const (
+	// LayerWindowsFirewall is the Windows Firewall of the node
+	LayerWindowsFirewall = "windows-firewall"
+	// LayerSecurityGroup is the cloud security groups of the node
+	LayerSecurityGroup = "security-group"
+)
+
+// errSecurityGroupsUnsupported is returned for the Windows VMs of the clouds without security group support
+var errSecurityGroupsUnsupported = fmt.Errorf("security groups are only supported on AWS")
+
+// RequiredPort is an inbound port a Windows node needs open to work
+type RequiredPort struct {
+	// Protocol is TCP or UDP
+	Protocol string `json:"protocol"`
+	// Port is the port number
+	Port int64 `json:"port"`
+	// Component is the component listening on the port
+	Component string `json:"component"`
+	// Source is where the port has to be reachable from, SourceCluster or SourceManagement
+	Source string `json:"source"`
+}
+
+// String returns the port as <port>/<protocol>
+func (p RequiredPort) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// RequiredPorts is the port matrix of the Windows nodes, documented in docs/README.md. A port missing from the
+// Windows Firewall or the security groups leaves the node half working, e.g. Ready but without pod networking when
+// the VXLAN port is closed, or without logs and exec when the kubelet port is closed.
+var RequiredPorts = []RequiredPort{
+	{Protocol: "TCP", Port: 10250, Component: "kubelet", Source: SourceCluster},
+	{Protocol: "UDP", Port: 4789, Component: "hybrid overlay VXLAN", Source: SourceCluster},
+	{Protocol: "TCP", Port: 22, Component: "OpenSSH server", Source: SourceManagement},
+	{Protocol: "TCP", Port: 5986, Component: "WinRM over HTTPS", Source: SourceManagement},
+}
+
+// PortDrift is a required port that is not open at one of the layers
+type PortDrift struct {
+	// Port is the required port
+	Port RequiredPort `json:"port"`
+	// Layer is the layer the port is not open at, LayerWindowsFirewall or LayerSecurityGroup
+	Layer string `json:"layer"`
+	// Reason tells why the port is not open
+	Reason string `json:"reason"`
+}
+
+// String returns a description of the drift
+func (d PortDrift) String() string {
+	return fmt.Sprintf("%s (%s) at %s: %s", d.Port, d.Port.Component, d.Layer, d.Reason)
+}
+
+// FirewallState is the effective inbound configuration of the Windows Firewall of a Windows VM
+type FirewallState struct {
+	// EnabledProfiles are the firewall profiles which are enabled, e.g. Domain, Private and Public. The firewall
+	// filters nothing if none is enabled.
+	EnabledProfiles []string `json:"enabledProfiles"`
+	// Rules are the enabled inbound rules
+	Rules []FirewallRule `json:"rules"`
+}
+
+// FirewallRule is an enabled inbound Windows Firewall rule
+type FirewallRule struct {
+	// Name is the name of the rule
+	Name string `json:"name"`
+	// Action is Allow or Block
+	Action string `json:"action"`
+	// Protocol is TCP, UDP, Any or a protocol number
+	Protocol string `json:"protocol"`
+	// LocalPorts are the ports of the rule, port numbers, ranges like 1000-2000, or Any
+	LocalPorts []string `json:"localPorts"`
+}
+
+// SecurityGroups is the ingress configuration of the cloud security groups of a Windows VM
+type SecurityGroups struct {
+	// VPCCIDR is the CIDR of the VPC of the Windows VM, which the cluster ports have to be open to
+	VPCCIDR string `json:"vpcCIDR"`
+	// Rules are the ingress rules of the security groups of the Windows VM
+	Rules []SecurityGroupRule `json:"rules"`
+}
+
+// SecurityGroupRule is an ingress rule of a cloud security group
+type SecurityGroupRule struct {
+	// GroupID is the ID of the security group of the rule
+	GroupID string `json:"groupID"`
+	// Protocol is tcp, udp, a protocol number, or -1 for all the protocols
+	Protocol string `json:"protocol"`
+	// FromPort is the first port of the rule, unset for all the protocols
+	FromPort int64 `json:"fromPort"`
+	// ToPort is the last port of the rule, unset for all the protocols
+	ToPort int64 `json:"toPort"`
+	// CIDRs are the IPv4 and IPv6 address ranges the rule allows
+	CIDRs []string `json:"cidrs,omitempty"`
+	// SourceGroups are the IDs of the security groups the rule allows
+	SourceGroups []string `json:"sourceGroups,omitempty"`
+}
+
+// FirewallStateOf returns the effective inbound configuration of the Windows Firewall of the Windows VM
+func FirewallStateOf(vm WindowsVM) (*FirewallState, error) {
+	return vm.handle().firewallState()
+}
+
+// firewallState implements FirewallStateOf
+func (w *windowsVM) firewallState() (*FirewallState, error) {
+	// Getting the port filters once is much faster than getting the filter of each rule, their instance ID is the
+	// name of their rule
+	stdout, stderr, err := w.Run(PowerShellScript("$filters = @{}; Get-NetFirewallPortFilter -All | "+
+		"ForEach-Object { $filters[$_.InstanceID] = $_ }; "+
+		"$rules = @(Get-NetFirewallRule -Enabled True -Direction Inbound | ForEach-Object { "+
+		"$filter = $filters[$_.Name]; @{name = $_.Name; action = [string]$_.Action; "+
+		"protocol = [string]$filter.Protocol; localPorts = @($filter.LocalPort)} }); "+
+		"$profiles = @(Get-NetFirewallProfile | Where-Object { $_.Enabled } | ForEach-Object { $_.Name }); "+
+		"ConvertTo-Json -Compress -Depth 4 -InputObject @{enabledProfiles = $profiles; rules = $rules}"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the Windows Firewall rules: %v, %s", err, stderr)
+	}
+	var state FirewallState
+	if err = json.Unmarshal([]byte(strings.TrimSpace(stdout)), &state); err != nil {
+		return nil, fmt.Errorf("error parsing the Windows Firewall rules: %v", err)
+	}
+	return &state, nil
+}
+
+// SecurityGroupsOf returns the ingress rules of the cloud security groups of the Windows VM. Only AWS is supported.
+func SecurityGroupsOf(vm WindowsVM) (*SecurityGroups, error) {
+	return vm.handle().securityGroups()
+}
+
+// securityGroups implements SecurityGroupsOf
+func (w *windowsVM) securityGroups() (*SecurityGroups, error) {
+	awsCloud, ok := w.cloudProvider.(*aws.AwsProvider)
+	if !ok {
+		return nil, errSecurityGroupsUnsupported
+	}
+	instance, err := awsCloud.GetInstance(w.GetCredentials().GetInstanceId())
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance %s: %v", w.GetCredentials().GetInstanceId(), err)
+	}
+	var groupIDs []*string
+	for _, group := range instance.SecurityGroups {
+		groupIDs = append(groupIDs, group.GroupId)
+	}
+	groups, err := awsCloud.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+	if err != nil {
+		return nil, fmt.Errorf("error getting the security groups of instance %s: %v",
+			w.GetCredentials().GetInstanceId(), err)
+	}
+	vpcs, err := awsCloud.EC2.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{instance.VpcId}})
+	if err != nil || len(vpcs.Vpcs) == 0 {
+		return nil, fmt.Errorf("error getting the VPC of instance %s: %v", w.GetCredentials().GetInstanceId(), err)
+	}
+	return &SecurityGroups{VPCCIDR: awssdk.StringValue(vpcs.Vpcs[0].CidrBlock),
+		Rules: securityGroupRules(groups.SecurityGroups)}, nil
+}
+
+// securityGroupRules returns the ingress rules of the given security groups
+func securityGroupRules(groups []*ec2.SecurityGroup) []SecurityGroupRule {
+	var rules []SecurityGroupRule
+	for _, group := range groups {
+		for _, permission := range group.IpPermissions {
+			rule := SecurityGroupRule{
+				GroupID:  awssdk.StringValue(group.GroupId),
+				Protocol: awssdk.StringValue(permission.IpProtocol),
+				FromPort: awssdk.Int64Value(permission.FromPort),
+				ToPort:   awssdk.Int64Value(permission.ToPort),
+			}
+			for _, ipRange := range permission.IpRanges {
+				rule.CIDRs = append(rule.CIDRs, awssdk.StringValue(ipRange.CidrIp))
+			}
+			for _, ipRange := range permission.Ipv6Ranges {
+				rule.CIDRs = append(rule.CIDRs, awssdk.StringValue(ipRange.CidrIpv6))
+			}
+			for _, pair := range permission.UserIdGroupPairs {
+				rule.SourceGroups = append(rule.SourceGroups, awssdk.StringValue(pair.GroupId))
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// CheckPortMatrix compares the Windows Firewall and the security groups of the Windows VM against RequiredPorts and
+// returns the required ports which are not open. The security groups are not checked on other clouds than AWS.
+func CheckPortMatrix(vm WindowsVM) ([]PortDrift, error) {
+	firewall, err := FirewallStateOf(vm)
+	if err != nil {
+		return nil, err
+	}
+	drifts := firewallDrift(firewall, RequiredPorts)
+	groups, err := SecurityGroupsOf(vm)
+	if err == errSecurityGroupsUnsupported {
+		return drifts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(drifts, securityGroupDrift(groups, RequiredPorts)...), nil
+}
+
+// firewallDrift returns the given ports which the Windows Firewall does not allow: the ports without an allow rule
+// and the ports with a block rule, which takes precedence over the allow rules
+func firewallDrift(state *FirewallState, ports []RequiredPort) []PortDrift {
+	var drifts []PortDrift
+	if len(state.EnabledProfiles) == 0 {
+		return nil
+	}
+	for _, port := range ports {
+		var allowed bool
+		var blockedBy string
+		for _, rule := range state.Rules {
+			if !firewallRuleCovers(rule, port) {
+				continue
+			}
+			switch {
+			case strings.EqualFold(rule.Action, "Block"):
+				blockedBy = rule.Name
+			case strings.EqualFold(rule.Action, "Allow"):
+				allowed = true
+			}
+		}
+		switch {
+		case blockedBy != "":
+			drifts = append(drifts, PortDrift{port, LayerWindowsFirewall, "blocked by rule " + blockedBy})
+		case !allowed:
+			drifts = append(drifts, PortDrift{port, LayerWindowsFirewall, "no enabled rule allows it"})
+		}
+	}
+	return drifts
+}
+
+// firewallRuleCovers returns true if the Windows Firewall rule applies to the given port
+func firewallRuleCovers(rule FirewallRule, port RequiredPort) bool {
+	if !strings.EqualFold(rule.Protocol, "Any") && !strings.EqualFold(rule.Protocol, port.Protocol) &&
+		rule.Protocol != protocolNumber(port.Protocol) {
+		return false
+	}
+	for _, localPort := range rule.LocalPorts {
+		if strings.EqualFold(localPort, "Any") || portInRange(localPort, port.Port) {
+			return true
+		}
+	}
+	// A rule without port filter, e.g. for any protocol, applies to all the ports
+	return len(rule.LocalPorts) == 0 && strings.EqualFold(rule.Protocol, "Any")
+}
+
+// portInRange returns true if the given port is the port, or in the range like 1000-2000, of the Windows Firewall
+// rule. Keywords like RPC do not match any port.
+func portInRange(localPort string, port int64) bool {
+	bounds := strings.SplitN(localPort, "-", 2)
+	from, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+	if err != nil {
+		return false
+	}
+	to := from
+	if len(bounds) == 2 {
+		if to, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64); err != nil {
+			return false
+		}
+	}
+	return from <= port && port <= to
+}
+
+// protocolNumber returns the IP protocol number of TCP or UDP
+func protocolNumber(protocol string) string {
+	switch strings.ToUpper(protocol) {
+	case "TCP":
+		return "6"
+	case "UDP":
+		return "17"
+	}
+	return ""
+}
+
+// securityGroupDrift returns the given ports which the security groups do not allow from their source: the cluster
+// ports have to be open to the whole VPC, or to a security group, while the management ports can be open to any
+// address
+func securityGroupDrift(groups *SecurityGroups, ports []RequiredPort) []PortDrift {
+	var drifts []PortDrift
+	for _, port := range ports {
+		var open, fromSource bool
+		for _, rule := range groups.Rules {
+			if !securityGroupRuleCovers(rule, port) {
+				continue
+			}
+			open = true
+			if port.Source != SourceCluster || len(rule.SourceGroups) > 0 {
+				fromSource = true
+			}
+			for _, cidr := range rule.CIDRs {
+				if cidrContains(cidr, groups.VPCCIDR) {
+					fromSource = true
+				}
+			}
+		}
+		switch {
+		case !open:
+			drifts = append(drifts, PortDrift{port, LayerSecurityGroup, "no ingress rule allows it"})
+		case !fromSource:
+			drifts = append(drifts, PortDrift{port, LayerSecurityGroup, "not open to the VPC " + groups.VPCCIDR})
+		}
+	}
+	return drifts
+}
+
+// securityGroupRuleCovers returns true if the security group rule applies to the given port
+func securityGroupRuleCovers(rule SecurityGroupRule, port RequiredPort) bool {
+	if rule.Protocol == "-1" {
+		return true
+	}
+	if !strings.EqualFold(rule.Protocol, port.Protocol) && rule.Protocol != protocolNumber(port.Protocol) {
+		return false
+	}
+	return rule.FromPort <= port.Port && port.Port <= rule.ToPort
+}
+
+// cidrContains returns true if the outer CIDR contains the whole inner CIDR
+func cidrContains(outer, inner string) bool {
+	_, outerNet, err := net.ParseCIDR(outer)
+	if err != nil {
+		return false
+	}
+	innerIP, innerNet, err := net.ParseCIDR(inner)
+	if err != nil {
+		return false
+	}
+	outerOnes, outerBits := outerNet.Mask.Size()
+	innerOnes, innerBits := innerNet.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outerNet.Contains(innerIP)
+}
@@ -0,0 +1,121 @@
+package e2efw
+
+import (
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+)
+
+// kubeletPort, vxlanPort and sshPort are the required ports of the tests
+var (
+	kubeletPort = RequiredPort{Protocol: "TCP", Port: 10250, Component: "kubelet", Source: SourceCluster}
+	vxlanPort   = RequiredPort{Protocol: "UDP", Port: 4789, Component: "hybrid overlay VXLAN", Source: SourceCluster}
+	sshPort     = RequiredPort{Protocol: "TCP", Port: 22, Component: "OpenSSH server", Source: SourceManagement}
+)
+
+// TestFirewallDrift tests the comparison of the Windows Firewall rules with the required ports
+func TestFirewallDrift(t *testing.T) {
+	ports := []RequiredPort{kubeletPort, vxlanPort, sshPort}
+	tests := []struct {
+		name     string
+		state    *FirewallState
+		expected []PortDrift
+	}{
+		{
+			name: "all ports allowed",
+			state: &FirewallState{EnabledProfiles: []string{"Public"}, Rules: []FirewallRule{
+				{Name: "ContainerLogsPort", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"10250"}},
+				{Name: "VXLAN", Action: "Allow", Protocol: "17", LocalPorts: []string{"4789"}},
+				{Name: "OpenSSH-Server-In-TCP", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"1-1024"}},
+			}},
+		},
+		{
+			name:  "firewall disabled",
+			state: &FirewallState{},
+		},
+		{
+			name: "missing and mismatched rules",
+			state: &FirewallState{EnabledProfiles: []string{"Public"}, Rules: []FirewallRule{
+				{Name: "ContainerLogsPort", Action: "Allow", Protocol: "UDP", LocalPorts: []string{"10250"}},
+				{Name: "RPC", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"RPC"}},
+				{Name: "OpenSSH-Server-In-TCP", Action: "Allow", Protocol: "TCP", LocalPorts: []string{"22"}},
+			}},
+			expected: []PortDrift{
+				{kubeletPort, LayerWindowsFirewall, "no enabled rule allows it"},
+				{vxlanPort, LayerWindowsFirewall, "no enabled rule allows it"},
+			},
+		},
+		{
+			name: "block rules take precedence",
+			state: &FirewallState{EnabledProfiles: []string{"Domain"}, Rules: []FirewallRule{
+				{Name: "AllowAll", Action: "Allow", Protocol: "Any", LocalPorts: []string{"Any"}},
+				{Name: "BlockVXLAN", Action: "Block", Protocol: "UDP", LocalPorts: []string{"4000-5000"}},
+			}},
+			expected: []PortDrift{{vxlanPort, LayerWindowsFirewall, "blocked by rule BlockVXLAN"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, firewallDrift(tt.state, ports))
+		})
+	}
+}
+
+// TestSecurityGroupDrift tests that the cluster ports have to be open to the VPC and the management ports to anyone
+func TestSecurityGroupDrift(t *testing.T) {
+	ports := []RequiredPort{kubeletPort, vxlanPort, sshPort}
+	tests := []struct {
+		name     string
+		rules    []SecurityGroupRule
+		expected []PortDrift
+	}{
+		{
+			name: "all traffic from the VPC",
+			rules: []SecurityGroupRule{{GroupID: "sg-1", Protocol: "-1", CIDRs: []string{"10.0.0.0/16"}},
+				{GroupID: "sg-1", Protocol: "tcp", FromPort: 22, ToPort: 22, CIDRs: []string{"203.0.113.5/32"}}},
+		},
+		{
+			name: "cluster ports from the worker security group",
+			rules: []SecurityGroupRule{{GroupID: "sg-2", Protocol: "tcp", FromPort: 10250, ToPort: 10250,
+				SourceGroups: []string{"sg-workers"}},
+				{GroupID: "sg-2", Protocol: "udp", FromPort: 4789, ToPort: 4789, CIDRs: []string{"0.0.0.0/0"}},
+				{GroupID: "sg-2", Protocol: "6", FromPort: 0, ToPort: 1024, CIDRs: []string{"203.0.113.5/32"}}},
+		},
+		{
+			name: "cluster port open to a part of the VPC only",
+			rules: []SecurityGroupRule{{GroupID: "sg-3", Protocol: "tcp", FromPort: 10250, ToPort: 10250,
+				CIDRs: []string{"10.0.128.0/20"}},
+				{GroupID: "sg-3", Protocol: "tcp", FromPort: 4789, ToPort: 4789, CIDRs: []string{"10.0.0.0/16"}}},
+			expected: []PortDrift{
+				{kubeletPort, LayerSecurityGroup, "not open to the VPC 10.0.0.0/16"},
+				{vxlanPort, LayerSecurityGroup, "no ingress rule allows it"},
+				{sshPort, LayerSecurityGroup, "no ingress rule allows it"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, securityGroupDrift(&SecurityGroups{VPCCIDR: "10.0.0.0/16", Rules: tt.rules},
+				ports))
+		})
+	}
+}
+
+// TestSecurityGroupRules tests the conversion of the ingress permissions of the security groups
+func TestSecurityGroupRules(t *testing.T) {
+	rules := securityGroupRules([]*ec2.SecurityGroup{{
+		GroupId: awssdk.String("sg-1"),
+		IpPermissions: []*ec2.IpPermission{
+			{IpProtocol: awssdk.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: awssdk.String("10.0.0.0/16")}},
+				Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: awssdk.String("2600:1f14::/56")}}},
+			{IpProtocol: awssdk.String("udp"), FromPort: awssdk.Int64(4789), ToPort: awssdk.Int64(4789),
+				UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: awssdk.String("sg-workers")}}},
+		},
+	}})
+	assert.Equal(t, []SecurityGroupRule{
+		{GroupID: "sg-1", Protocol: "-1", CIDRs: []string{"10.0.0.0/16", "2600:1f14::/56"}},
+		{GroupID: "sg-1", Protocol: "udp", FromPort: 4789, ToPort: 4789, SourceGroups: []string{"sg-workers"}},
+	}, rules)
+}
@@ -0,0 +1,103 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// apiServerPort is the port the API server of a self-managed cluster listens on
+const apiServerPort = "6443"
+
+// EndpointProbe is the result of the probe of a cluster service from a Windows VM, mirroring the results of the WMCB
+// probe-endpoints command
+type EndpointProbe struct {
+	// Name describes the service, e.g. api-server
+	Name string `json:"name"`
+	// Kind is the kind of check made on the endpoint: dns, tcp or https
+	Kind string `json:"kind"`
+	// Address is the host name, host:port or URL of the endpoint
+	Address string `json:"address"`
+	// Reachable is true if every stage of the check succeeded
+	Reachable bool `json:"reachable"`
+	// FailedStage is the stage the check failed at: dns, connect, tls or http. Empty if the endpoint is reachable.
+	FailedStage string `json:"failedStage,omitempty"`
+	// Error is the reason the check failed
+	Error string `json:"error,omitempty"`
+	// Addresses are the IP addresses the host name of the endpoint resolved to
+	Addresses []string `json:"addresses,omitempty"`
+	// StatusCode is the HTTP status code the endpoint answered with
+	StatusCode int `json:"statusCode,omitempty"`
+	// DurationMilliseconds is the time the check took
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
+}
+
+// String returns the name and address of the endpoint, and the stage and reason of the failure if it is unreachable
+func (e EndpointProbe) String() string {
+	if e.Reachable {
+		return fmt.Sprintf("%s (%s): reachable", e.Name, e.Address)
+	}
+	return fmt.Sprintf("%s (%s): failed at %s: %s", e.Name, e.Address, e.FailedStage, e.Error)
+}
+
+// APIServerURL returns the URL the Windows nodes reach the API server of the cluster at. It is the internal API
+// server endpoint of a self-managed cluster, and the API server endpoint of the hosted control plane of a hosted
+// cluster.
+func (f *TestFramework) APIServerURL() (string, error) {
+	if f.hosted == nil {
+		return "https://" + net.JoinHostPort("api-int."+ClusterAddress, apiServerPort), nil
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", f.hosted.kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to build config from the hosted cluster kubeconfig: %v", err)
+	}
+	return config.Host, nil
+}
+
+// ProbeClusterEndpoints runs the probe-endpoints command of the WMCB binary at the given path on the VM, which probes
+// the API server, the ignition server, the image registries and the resolution of the given host names from the VM,
+// and returns the result of each endpoint. An unreachable endpoint is not an error, the caller checks Reachable.
+func (f *TestFramework) ProbeClusterEndpoints(vm WindowsVM, wmcbPath string, dnsNames ...string) ([]EndpointProbe,
+	error) {
+	apiServer, err := f.APIServerURL()
+	if err != nil {
+		return nil, err
+	}
+	ignitionServer, _, err := f.WorkerIgnitionEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the worker ignition endpoint: %v", err)
+	}
+	cmd := "$env:" + RunContextEnvVar + "=" + PowerShellString(RunContextOf(vm).String()) + "; & " +
+		PowerShellString(wmcbPath) + " probe-endpoints --api-server " + PowerShellString(apiServer) +
+		" --ignition-server " + PowerShellString(ignitionServer)
+	for _, name := range dnsNames {
+		cmd += " --dns-name " + PowerShellString(name)
+	}
+	// The command exits with a non zero code if an endpoint is unreachable, which is only an error if it did not
+	// print the results
+	stdout, stderr, runErr := vm.Run(PowerShellScript(cmd), true)
+	probes, err := parseEndpointProbes(stdout)
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("error probing endpoints: %v, %s", runErr, stderr)
+		}
+		return nil, err
+	}
+	return probes, nil
+}
+
+// parseEndpointProbes parses the JSON results printed by the probe-endpoints command
+func parseEndpointProbes(out string) ([]EndpointProbe, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, fmt.Errorf("no probe results")
+	}
+	var probes []EndpointProbe
+	if err := json.Unmarshal([]byte(out), &probes); err != nil {
+		return nil, fmt.Errorf("could not parse probe results: %v", err)
+	}
+	return probes, nil
+}
@@ -0,0 +1,42 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseEndpointProbes tests the parsing of the results printed by the WMCB probe-endpoints command
+func TestParseEndpointProbes(t *testing.T) {
+	probes, err := parseEndpointProbes(`[
+  {"name": "api-server", "kind": "https", "address": "https://api-int.example.com:6443/readyz",
+   "reachable": true, "addresses": ["10.0.0.1"], "statusCode": 200, "durationMilliseconds": 12},
+  {"name": "ignition-server", "kind": "https", "address": "https://api-int.example.com:22623/config/worker",
+   "reachable": false, "failedStage": "connect", "error": "i/o timeout", "addresses": ["10.0.0.1"],
+   "durationMilliseconds": 10000}
+]
+`)
+	require.NoError(t, err)
+	require.Len(t, probes, 2)
+	assert.True(t, probes[0].Reachable)
+	assert.Equal(t, 200, probes[0].StatusCode)
+	assert.Equal(t, "api-server (https://api-int.example.com:6443/readyz): reachable", probes[0].String())
+	assert.False(t, probes[1].Reachable)
+	assert.Equal(t, "ignition-server (https://api-int.example.com:22623/config/worker): failed at connect: "+
+		"i/o timeout", probes[1].String())
+
+	_, err = parseEndpointProbes("")
+	assert.Error(t, err, "a command failing before probing prints no results")
+	_, err = parseEndpointProbes("unable to read ignition file")
+	assert.Error(t, err)
+}
+
+// TestAPIServerURL tests that the Windows nodes of a self-managed cluster reach its internal API server endpoint
+func TestAPIServerURL(t *testing.T) {
+	defer func(address string) { ClusterAddress = address }(ClusterAddress)
+	ClusterAddress = "windows.example.com"
+	url, err := (&TestFramework{}).APIServerURL()
+	require.NoError(t, err)
+	assert.Equal(t, "https://api-int.windows.example.com:6443", url)
+}
@@ -0,0 +1,138 @@
+package e2efw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// processPollInterval is the interval at which a process is checked while waiting for it to exit
+	processPollInterval = 2 * time.Second
+	// processExitTimeout is the time KillProcesses waits for the killed processes to exit
+	processExitTimeout = time.Minute
+)
+
+// Process is a process running on the Windows VM
+type Process struct {
+	// Name is the name of the process, without the .exe extension
+	Name string `json:"Name"`
+	// PID is the ID of the process
+	PID int `json:"Id"`
+	// Path is the path of the executable of the process. It is empty if it could not be read, e.g. for system
+	// processes.
+	Path string `json:"Path"`
+}
+
+// ListProcesses returns the processes with the given name running on the Windows VM, or all the processes if the
+// name is empty. The name is matched without the .exe extension and can contain wildcards.
+func ListProcesses(vm WindowsVM, name string) ([]Process, error) {
+	return vm.handle().listProcesses(name)
+}
+
+// listProcesses implements ListProcesses
+func (w *windowsVM) listProcesses(name string) ([]Process, error) {
+	getProcess := "Get-Process -ErrorAction SilentlyContinue"
+	if name != "" {
+		getProcess += " -Name '" + strings.TrimSuffix(name, ".exe") + "'"
+	}
+	stdout, stderr, err := w.Run(PowerShellScript("ConvertTo-Json -Compress -InputObject @("+getProcess+
+		" | Select-Object Name,Id,Path)"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing processes: %v, %s", err, stderr)
+	}
+	return parseProcesses(stdout)
+}
+
+// KillProcess forcefully stops the process with the given ID on the Windows VM
+func KillProcess(vm WindowsVM, pid int) error {
+	return vm.handle().killProcess(pid)
+}
+
+// killProcess implements KillProcess
+func (w *windowsVM) killProcess(pid int) error {
+	if _, stderr, err := w.Run(PowerShellScript(fmt.Sprintf("Stop-Process -Id %d -Force", pid)), true); err != nil {
+		return fmt.Errorf("error killing process %d: %v, %s", pid, err, stderr)
+	}
+	return nil
+}
+
+// KillProcesses forcefully stops all the processes with the given name on the Windows VM and waits for them to exit,
+// so that the files they held are released once it returns. It is not an error if no such process is running.
+func KillProcesses(vm WindowsVM, name string) error {
+	return vm.handle().killProcesses(name)
+}
+
+// killProcesses implements KillProcesses
+func (w *windowsVM) killProcesses(name string) error {
+	processes, err := w.listProcesses(name)
+	if err != nil {
+		return err
+	}
+	for _, process := range processes {
+		if err = w.killProcess(process.PID); err != nil {
+			// The process may have exited in the meantime
+			if exited, exitErr := w.hasExited(process.PID); exitErr != nil || !exited {
+				return err
+			}
+		}
+	}
+	for _, process := range processes {
+		if err = w.waitForProcessExit(process.PID, Timeout(TestsPhase, processExitTimeout)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitForProcessExit waits until the process with the given ID is no longer running on the Windows VM, or returns an
+// error once the timeout expires
+func WaitForProcessExit(vm WindowsVM, pid int, timeout time.Duration) error {
+	return vm.handle().waitForProcessExit(pid, timeout)
+}
+
+// waitForProcessExit implements WaitForProcessExit
+func (w *windowsVM) waitForProcessExit(pid int, timeout time.Duration) error {
+	options := PollOptions{Interval: processPollInterval, Timeout: timeout, Jitter: DefaultPollJitter}
+	return Poll(context.Background(), fmt.Sprintf("process %d to exit", pid), options, func() (bool, string, error) {
+		exited, err := w.hasExited(pid)
+		return exited, fmt.Sprintf("process %d is running", pid), err
+	})
+}
+
+// hasExited returns true if the process with the given ID is not running on the Windows VM
+func (w *windowsVM) hasExited(pid int) (bool, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(fmt.Sprintf("ConvertTo-Json -Compress -InputObject "+
+		"@(Get-Process -Id %d -ErrorAction SilentlyContinue | Select-Object Name,Id,Path)", pid)), true)
+	if err != nil {
+		return false, fmt.Errorf("error getting process %d: %v, %s", pid, err, stderr)
+	}
+	processes, err := parseProcesses(stdout)
+	if err != nil {
+		return false, err
+	}
+	return len(processes) == 0, nil
+}
+
+// parseProcesses parses the JSON output of Get-Process. A single process is serialized as an object instead of an
+// array by older versions of PowerShell, and no output is returned if there are no processes.
+func parseProcesses(out string) ([]Process, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, nil
+	}
+	var processes []Process
+	if strings.HasPrefix(out, "{") {
+		var process Process
+		if err := json.Unmarshal([]byte(out), &process); err != nil {
+			return nil, fmt.Errorf("error parsing process %s: %v", out, err)
+		}
+		return append(processes, process), nil
+	}
+	if err := json.Unmarshal([]byte(out), &processes); err != nil {
+		return nil, fmt.Errorf("error parsing processes %s: %v", out, err)
+	}
+	return processes, nil
+}
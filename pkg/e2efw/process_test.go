@@ -0,0 +1,38 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseProcesses tests that the different shapes of the Get-Process JSON output are parsed
+func TestParseProcesses(t *testing.T) {
+	kubelet := Process{Name: "kubelet", PID: 1234, Path: "C:\\k\\kubelet.exe"}
+	system := Process{Name: "System", PID: 4}
+	tests := []struct {
+		name     string
+		out      string
+		expected []Process
+	}{
+		{"no output", "", nil},
+		{"no processes", "[]\r\n", []Process{}},
+		{"single process as object", `{"Name":"kubelet","Id":1234,"Path":"C:\\k\\kubelet.exe"}`,
+			[]Process{kubelet}},
+		{"single process as array", `[{"Name":"kubelet","Id":1234,"Path":"C:\\k\\kubelet.exe"}]`,
+			[]Process{kubelet}},
+		{"multiple processes", `[{"Name":"kubelet","Id":1234,"Path":"C:\\k\\kubelet.exe"},` +
+			`{"Name":"System","Id":4,"Path":null}]`, []Process{kubelet, system}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processes, err := parseProcesses(tt.out)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, processes)
+		})
+	}
+
+	_, err := parseProcesses("Get-Process : error")
+	assert.Error(t, err, "invalid output should not be parsed")
+}
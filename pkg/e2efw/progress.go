@@ -0,0 +1,141 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// progressFileName is the name of the file in the artifact directory the progress events are written to
+	progressFileName = "progress.jsonl"
+	// progressStarted is the message of the events reporting that an operation or a phase started
+	progressStarted = "started"
+	// progressCompleted is the message of the events reporting that an operation or a phase completed
+	progressCompleted = "completed"
+	// progressFailed is the message of the events reporting that an operation or a phase failed
+	progressFailed = "failed"
+)
+
+// ProgressEvent reports the progress of a long-running operation of the framework, like Setup. It has the same format
+// as the progress events of WNI, so that the same tools can consume both.
+type ProgressEvent struct {
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+	// Operation is the name of the operation, e.g. Setup
+	Operation string `json:"operation"`
+	// Phase is the name of the phase of the operation the event is about, empty for the operation itself
+	Phase string `json:"phase,omitempty"`
+	// Percent is the percentage of the phases of the operation that completed
+	Percent int `json:"percent"`
+	// Message is one of started, completed and failed
+	Message string `json:"message"`
+	// Error is the error the operation or the phase failed with
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	// progressLock prevents the lines of concurrent events from being interleaved
+	progressLock sync.Mutex
+	// progressEncoder writes the progress events as JSON lines, nil if they are dropped
+	progressEncoder *json.Encoder
+	// closeProgress closes the progress file
+	closeProgress = func() {}
+)
+
+// setupProgress writes the progress events to the progress file in the artifact directory and, if not nil, to the
+// given writer
+func setupProgress(w io.Writer) error {
+	progressFile := filepath.Join(artifactDir, progressFileName)
+	file, err := os.Create(progressFile)
+	if err != nil {
+		return fmt.Errorf("could not create progress file %s: %v", progressFile, err)
+	}
+	var out io.Writer = file
+	if w != nil {
+		out = io.MultiWriter(file, w)
+	}
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	progressEncoder = json.NewEncoder(out)
+	closeProgress = func() {
+		progressLock.Lock()
+		defer progressLock.Unlock()
+		progressEncoder = nil
+		file.Close()
+	}
+	return nil
+}
+
+// reportProgress writes the given event, if progress reporting is set up. Write errors are ignored, as progress
+// reporting must not fail the test suite.
+func reportProgress(event ProgressEvent) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	if progressEncoder == nil {
+		return
+	}
+	event.Time = time.Now()
+	_ = progressEncoder.Encode(event)
+}
+
+// progressOperation tracks the progress of an operation made of a known number of phases
+type progressOperation struct {
+	// name is the name of the operation
+	name string
+	// phases is the number of phases of the operation
+	phases int
+	// lock protects completed
+	lock sync.Mutex
+	// completed is the number of phases that completed
+	completed int
+}
+
+// startProgress reports the start of the operation with the given name and number of phases, and returns it
+func startProgress(name string, phases int) *progressOperation {
+	reportProgress(ProgressEvent{Operation: name, Message: progressStarted})
+	return &progressOperation{name: name, phases: phases}
+}
+
+// percent returns the percentage of the phases that completed
+func (o *progressOperation) percent() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.phases <= 0 {
+		return 0
+	}
+	if o.completed >= o.phases {
+		return 100
+	}
+	return o.completed * 100 / o.phases
+}
+
+// phase runs fn as the phase of the operation with the given name, and reports its start and its completion or
+// failure. Phases can run concurrently.
+func (o *progressOperation) phase(name string, fn func() error) error {
+	reportProgress(ProgressEvent{Operation: o.name, Phase: name, Percent: o.percent(), Message: progressStarted})
+	if err := fn(); err != nil {
+		reportProgress(ProgressEvent{Operation: o.name, Phase: name, Percent: o.percent(), Message: progressFailed,
+			Error: err.Error()})
+		return err
+	}
+	o.lock.Lock()
+	o.completed++
+	o.lock.Unlock()
+	reportProgress(ProgressEvent{Operation: o.name, Phase: name, Percent: o.percent(), Message: progressCompleted})
+	return nil
+}
+
+// end reports the completion of the operation, or its failure with the given error if it is not nil
+func (o *progressOperation) end(err error) {
+	if err != nil {
+		reportProgress(ProgressEvent{Operation: o.name, Percent: o.percent(), Message: progressFailed,
+			Error: err.Error()})
+		return
+	}
+	reportProgress(ProgressEvent{Operation: o.name, Percent: 100, Message: progressCompleted})
+}
@@ -0,0 +1,73 @@
+package e2efw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProgress tests that the progress events are written as JSON lines to the progress file in the artifact
+// directory and to the given writer
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+
+	var buf bytes.Buffer
+	require.NoError(t, setupProgress(&buf))
+	progress := startProgress("Setup", 4)
+	// The VMs are created concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, progress.phase(fmt.Sprintf("create Windows VM %d", i), func() error { return nil }))
+		}(i)
+	}
+	wg.Wait()
+	require.Error(t, progress.phase("connect to the cluster", func() error { return fmt.Errorf("unauthorized") }))
+	progress.end(fmt.Errorf("unauthorized"))
+	closeProgress()
+	// Events reported once progress reporting is closed are dropped
+	startProgress("Setup", 1)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, progressFileName))
+	require.NoError(t, err)
+	assert.Equal(t, contents, buf.Bytes(), "the same events are written to the file and the writer")
+
+	var events []ProgressEvent
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		var event ProgressEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event), "each line is an event")
+		assert.Equal(t, "Setup", event.Operation)
+		events = append(events, event)
+	}
+	// Operation started, 3 VM phases started and completed, connect started and failed, operation failed
+	require.Len(t, events, 10)
+	assert.Equal(t, progressStarted, events[0].Message)
+	completed := 0
+	for _, event := range events[1:7] {
+		if event.Message == progressCompleted {
+			completed++
+			assert.Contains(t, []int{25, 50, 75}, event.Percent)
+		}
+	}
+	assert.Equal(t, 3, completed)
+	assert.Equal(t, ProgressEvent{Time: events[8].Time, Operation: "Setup", Phase: "connect to the cluster",
+		Percent: 75, Message: progressFailed, Error: "unauthorized"}, events[8])
+	assert.Equal(t, ProgressEvent{Time: events[9].Time, Operation: "Setup", Percent: 75, Message: progressFailed,
+		Error: "unauthorized"}, events[9])
+}
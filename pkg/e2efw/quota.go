@@ -0,0 +1,32 @@
+package e2efw
+
+import (
+	"fmt"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+)
+
+// checkQuotas fails fast if the given number of instances of the given type, along with the resources created with
+// them, do not fit the quotas of the cloud account, rather than after minutes of setup with a limit error, as
+// `wni aws create` does. The quotas that cannot be read, e.g. for lack of permissions, are not checked.
+func checkQuotas(count int, instanceType string) error {
+	cloud, err := cloudprovider.CloudProviderFactory(kubeconfig, awsCredentials, "default", artifactDir, "",
+		instanceType, "", "")
+	if err != nil {
+		return fmt.Errorf("error instantiating cloud provider %v", err)
+	}
+	return checkCloudQuotas(cloud, count)
+}
+
+// checkCloudQuotas checks the quotas of the given cloud provider for the given number of instances. Cloud providers
+// that cannot check their quotas are not checked.
+func checkCloudQuotas(cloud cloudprovider.Cloud, count int) error {
+	checker, ok := cloud.(cloudprovider.QuotaChecker)
+	if !ok {
+		return nil
+	}
+	if err := checker.CheckQuotas(count); err != nil {
+		return fmt.Errorf("unable to create %d Windows VMs: %v", count, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/quota"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCloud is a cloud provider that cannot check its quotas
+type fakeCloud struct{}
+
+func (fakeCloud) CreateWindowsVM() (types.WindowsVM, error) { return nil, nil }
+func (fakeCloud) DestroyWindowsVMs() error                  { return nil }
+
+// fakeQuotaCloud is a cloud provider whose quotas fit the given number of instances
+type fakeQuotaCloud struct {
+	fakeCloud
+	// limit is the number of instances fitting the quotas
+	limit int
+	// requested is the number of instances the quotas were checked for
+	requested int
+}
+
+func (c *fakeQuotaCloud) CheckQuotas(count int) error {
+	c.requested = count
+	return quota.Check([]quota.Quota{{Name: "instances", Code: "L-TEST", Limit: int64(c.limit),
+		Requested: int64(count)}})
+}
+
+// TestCheckCloudQuotas tests that the quotas are checked through the cloud provider, and not checked if it cannot
+func TestCheckCloudQuotas(t *testing.T) {
+	assert.NoError(t, checkCloudQuotas(fakeCloud{}, 4))
+
+	cloud := &fakeQuotaCloud{limit: 4}
+	assert.NoError(t, checkCloudQuotas(cloud, 4))
+	assert.Equal(t, 4, cloud.requested)
+
+	err := checkCloudQuotas(cloud, 6)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to create 6 Windows VMs")
+	assert.Contains(t, err.Error(), "instances (quota L-TEST): 0 in use + 6 requested, limit 4")
+}
+
+var _ cloudprovider.QuotaChecker = &fakeQuotaCloud{}
@@ -0,0 +1,300 @@
+package e2efw
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// rebootTimeout is the time the Windows VM is given to come back after a reboot
+	rebootTimeout = 15 * time.Minute
+	// bootTimeCmd prints the last boot time of the Windows VM
+	bootTimeCmd = "(Get-CimInstance -ClassName Win32_OperatingSystem).LastBootUpTime.ToFileTimeUtc()"
+	// waitForReadyOperation is the name the waits for the VM to be reachable are recorded with in the flakiness report
+	waitForReadyOperation = "wait for ready"
+)
+
+// Windows feature install states, as reported by Get-WindowsFeature
+const (
+	featureInstalled      = "Installed"
+	featureInstallPending = "InstallPending"
+	featureAvailable      = "Available"
+	featureRemoved        = "Removed"
+)
+
+// Reasons for which a Windows VM waits for a reboot, as printed by pendingRebootScript
+const (
+	// rebootComponentBasedServicing means that the installation or removal of a Windows feature or update is not
+	// complete
+	rebootComponentBasedServicing = "ComponentBasedServicing"
+	// rebootWindowsUpdate means that Windows Update installed updates which are applied on the next boot
+	rebootWindowsUpdate = "WindowsUpdate"
+	// rebootFileRenameOperations means that files in use are replaced or deleted on the next boot
+	rebootFileRenameOperations = "FileRenameOperations"
+	// rebootComputerRename means that the computer was renamed, the new name being effective on the next boot
+	rebootComputerRename = "ComputerRename"
+)
+
+// pendingRebootScript prints the reasons for which the Windows VM waits for a reboot, a line each, from the registry
+// flags WMCB checks before initializing the kubelet
+const pendingRebootScript = `$currentVersion = 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion'
+$control = 'HKLM:\SYSTEM\CurrentControlSet\Control'
+if (Test-Path "$currentVersion\Component Based Servicing\RebootPending") {
+    '` + rebootComponentBasedServicing + `'
+}
+if (Test-Path "$currentVersion\WindowsUpdate\Auto Update\RebootRequired") {
+    '` + rebootWindowsUpdate + `'
+}
+$renames = (Get-ItemProperty -Path "$control\Session Manager" -Name PendingFileRenameOperations ` +
+	`-ErrorAction SilentlyContinue).PendingFileRenameOperations
+if ($renames | Where-Object { $_ }) {
+    '` + rebootFileRenameOperations + `'
+}
+$active = (Get-ItemProperty -Path "$control\ComputerName\ActiveComputerName").ComputerName
+$next = (Get-ItemProperty -Path "$control\ComputerName\ComputerName").ComputerName
+if ($next -and $active -ne $next) {
+    '` + rebootComputerRename + `'
+}
+`
+
+// Reboot restarts the Windows VM and waits for it to be ready again
+func Reboot(vm WindowsVM) error {
+	return vm.handle().reboot()
+}
+
+// reboot implements Reboot
+func (w *windowsVM) reboot() error {
+	bootTime, err := w.bootTime()
+	if err != nil {
+		return err
+	}
+	log.Printf("rebooting %s", w.GetCredentials().GetIPAddress())
+	// The connection is usually dropped while the command runs, so errors are only reported if the VM does not reboot
+	_, _, restartErr := w.Run(PowerShellScript("Restart-Computer -Force"), true)
+
+	deadline := clk.Now().Add(Timeout(TestsPhase, rebootTimeout))
+	options := PollOptions{Interval: RetryInterval, Deadline: deadline, Jitter: DefaultPollJitter}
+	err = Poll(context.Background(), w.GetCredentials().GetIPAddress()+" to reboot", options,
+		func() (bool, string, error) {
+			// The VM is considered rebooted once its boot time has changed
+			newBootTime, err := w.bootTime()
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return newBootTime != bootTime, fmt.Sprintf("not rebooted, restart returned: %v", restartErr), nil
+		})
+	if err != nil {
+		return err
+	}
+	return w.waitForReady(deadline.Sub(clk.Now()))
+}
+
+// WaitForReady waits until the Windows VM can be reached over the transports, WinRM and ssh, that were available
+// before, reinitializing the ssh client, or returns an error once the timeout expires. The unavailable transports are
+// checked again once the VM is ready, in case the reboot brought them back.
+func WaitForReady(vm WindowsVM, timeout time.Duration) error {
+	return vm.handle().waitForReady(timeout)
+}
+
+// waitForReady implements WaitForReady
+func (w *windowsVM) waitForReady(timeout time.Duration) error {
+	deadline := clk.Now().Add(timeout)
+	for attempts := 1; ; attempts++ {
+		err := w.waitForTransports()
+		if err == nil {
+			RecordAttempts(waitForReadyOperation, w.GetCredentials().GetIPAddress(), attempts, nil)
+			if len(w.transports.all()) > 0 {
+				if checkErr := w.checkTransports(); checkErr != nil {
+					log.Printf("error checking the transports of %s: %v", w.GetCredentials().GetIPAddress(), checkErr)
+				}
+			}
+			return nil
+		}
+		if clk.Now().After(deadline) {
+			RecordAttempts(waitForReadyOperation, w.GetCredentials().GetIPAddress(), attempts, err)
+			return fmt.Errorf("timeout waiting for %s to be ready: %v", w.GetCredentials().GetIPAddress(), err)
+		}
+		clk.Sleep(RetryInterval)
+	}
+}
+
+// waitForTransports returns an error if the Windows VM cannot be reached over one of the available transports
+func (w *windowsVM) waitForTransports() error {
+	// The WinRM endpoint answers the Identify request once it is up, without a shell being opened
+	if w.hasWinRM() {
+		if _, err := w.identifyEndpoint(); err != nil {
+			return err
+		}
+	}
+	if w.transports.get(sshTransport) == nil {
+		return w.Reinitialize()
+	}
+	return nil
+}
+
+// EnsureWindowsFeature installs the given Windows features, e.g. Containers or Hyper-V, if they are not installed yet
+// and reboots the Windows VM if any of them requires it. It returns true if the VM was rebooted. A reboot pending for
+// the servicing of features or a computer rename is completed first, as the installation would not be effective until
+// then, and an error is returned if one is still pending once the features are installed.
+func EnsureWindowsFeature(vm WindowsVM, features ...string) (bool, error) {
+	return vm.handle().ensureWindowsFeature(features...)
+}
+
+// ensureWindowsFeature implements EnsureWindowsFeature
+func (w *windowsVM) ensureWindowsFeature(features ...string) (bool, error) {
+	rebooted, err := w.completePendingReboot("installing Windows features")
+	if err != nil {
+		return rebooted, err
+	}
+
+	rebootRequired := false
+	for _, feature := range features {
+		state, err := w.windowsFeatureState(feature)
+		if err != nil {
+			return rebooted, err
+		}
+		switch state {
+		case featureInstalled:
+			continue
+		case featureInstallPending:
+			rebootRequired = true
+			continue
+		}
+
+		log.Printf("installing Windows feature %s on %s", feature, w.GetCredentials().GetIPAddress())
+		stdout, stderr, err := w.Run(PowerShellScript("(Install-WindowsFeature -Name "+PowerShellString(feature)+
+			").RestartNeeded"), true)
+		if err != nil {
+			return rebooted, fmt.Errorf("error installing Windows feature %s: %v, %s", feature, err, stderr)
+		}
+		// RestartNeeded is Yes, No or Maybe
+		if strings.TrimSpace(stdout) != "No" {
+			rebootRequired = true
+		}
+	}
+	if !rebootRequired {
+		return rebooted, nil
+	}
+
+	if err := w.reboot(); err != nil {
+		return true, fmt.Errorf("error rebooting after installing Windows features: %v", err)
+	}
+	for _, feature := range features {
+		state, err := w.windowsFeatureState(feature)
+		if err != nil {
+			return true, err
+		}
+		if state != featureInstalled {
+			return true, fmt.Errorf("Windows feature %s is %s after reboot", feature, state)
+		}
+	}
+	reasons, err := w.pendingReboot()
+	if err != nil {
+		return true, err
+	}
+	if blocking := blockingRebootReasons(reasons); len(blocking) > 0 {
+		return true, fmt.Errorf("%s is still pending a reboot for %s after installing Windows features",
+			w.GetCredentials().GetIPAddress(), strings.Join(blocking, ", "))
+	}
+	return true, nil
+}
+
+// completePendingReboot reboots the Windows VM before the given step if it waits for a reboot that would make the step
+// fail, and returns true if it was rebooted
+func (w *windowsVM) completePendingReboot(step string) (bool, error) {
+	reasons, err := w.pendingReboot()
+	if err != nil {
+		return false, err
+	}
+	blocking := blockingRebootReasons(reasons)
+	if len(blocking) == 0 {
+		return false, nil
+	}
+	log.Printf("%s is pending a reboot for %s, rebooting before %s", w.GetCredentials().GetIPAddress(),
+		strings.Join(blocking, ", "), step)
+	if err := w.reboot(); err != nil {
+		return true, fmt.Errorf("error completing the pending reboot before %s: %v", step, err)
+	}
+	return true, nil
+}
+
+// PendingReboot returns the reasons for which the Windows VM waits for a reboot, none if it does not
+func PendingReboot(vm WindowsVM) ([]string, error) {
+	return vm.handle().pendingReboot()
+}
+
+// pendingReboot implements PendingReboot
+func (w *windowsVM) pendingReboot() ([]string, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(pendingRebootScript), true)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for a pending reboot: %v, %s", err, stderr)
+	}
+	return parsePendingReboot(stdout)
+}
+
+// parsePendingReboot parses the reasons for which a Windows VM waits for a reboot from the output of
+// pendingRebootScript
+func parsePendingReboot(out string) ([]string, error) {
+	var reasons []string
+	for _, line := range strings.Split(out, "\n") {
+		reason := strings.TrimSpace(line)
+		switch reason {
+		case "":
+			continue
+		case rebootComponentBasedServicing, rebootWindowsUpdate, rebootFileRenameOperations, rebootComputerRename:
+			reasons = append(reasons, reason)
+		default:
+			return nil, fmt.Errorf("unexpected pending reboot reason %q", reason)
+		}
+	}
+	return reasons, nil
+}
+
+// blockingRebootReasons returns the given reasons for a pending reboot which make the installation of features and
+// the bootstrap fail until the Windows VM is rebooted. The reboots pending for Windows Update or file replacements do
+// not.
+func blockingRebootReasons(reasons []string) []string {
+	var blocking []string
+	for _, reason := range reasons {
+		if reason == rebootComponentBasedServicing || reason == rebootComputerRename {
+			blocking = append(blocking, reason)
+		}
+	}
+	return blocking
+}
+
+// windowsFeatureState returns the install state of the given Windows feature
+func (w *windowsVM) windowsFeatureState(feature string) (string, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("(Get-WindowsFeature -Name "+PowerShellString(feature)+
+		").InstallState"), true)
+	if err != nil {
+		return "", fmt.Errorf("error getting state of Windows feature %s: %v, %s", feature, err, stderr)
+	}
+	return parseFeatureState(feature, stdout)
+}
+
+// parseFeatureState parses the install state of a Windows feature from the output of Get-WindowsFeature, returning an
+// error if the feature does not exist
+func parseFeatureState(feature, out string) (string, error) {
+	state := strings.TrimSpace(out)
+	switch state {
+	case featureInstalled, featureInstallPending, featureAvailable, featureRemoved:
+		return state, nil
+	case "":
+		return "", fmt.Errorf("Windows feature %s does not exist", feature)
+	default:
+		return "", fmt.Errorf("unexpected state %s of Windows feature %s", state, feature)
+	}
+}
+
+// bootTime returns the last boot time of the Windows VM
+func (w *windowsVM) bootTime() (string, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(bootTimeCmd), true)
+	if err != nil {
+		return "", fmt.Errorf("error getting boot time: %v, %s", err, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
@@ -0,0 +1,56 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseFeatureState tests that the install states of Windows features are parsed
+func TestParseFeatureState(t *testing.T) {
+	tests := []struct {
+		name          string
+		out           string
+		expected      string
+		expectedError bool
+	}{
+		{"installed", "Installed\r\n", featureInstalled, false},
+		{"pending reboot", "InstallPending\r\n", featureInstallPending, false},
+		{"available", "Available\r\n", featureAvailable, false},
+		{"removed", "Removed\r\n", featureRemoved, false},
+		{"missing feature", "\r\n", "", true},
+		{"unexpected output", "Get-WindowsFeature : error", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := parseFeatureState("Containers", tt.out)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, state)
+		})
+	}
+}
+
+// TestParsePendingReboot tests that the reasons for a pending reboot are parsed, and that only the servicing of
+// features and the computer renames block the installation of features
+func TestParsePendingReboot(t *testing.T) {
+	reasons, err := parsePendingReboot("")
+	require.NoError(t, err)
+	assert.Empty(t, reasons)
+
+	reasons, err = parsePendingReboot("WindowsUpdate\r\nFileRenameOperations\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{rebootWindowsUpdate, rebootFileRenameOperations}, reasons)
+	assert.Empty(t, blockingRebootReasons(reasons))
+
+	reasons, err = parsePendingReboot("ComponentBasedServicing\r\nWindowsUpdate\r\nComputerRename\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{rebootComponentBasedServicing, rebootComputerRename}, blockingRebootReasons(reasons))
+
+	_, err = parsePendingReboot("Test-Path : access denied")
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package e2efw
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxInlineFileSize is the largest file WriteFile and ReadFile transfer in memory, the larger ones are transferred
+// from and to local files with CopyFile and RetrieveFiles
+const maxInlineFileSize = 8 * 1024 * 1024
+
+func (w *windowsVM) WriteFile(remotePath string, content []byte, perm os.FileMode) (err error) {
+	_, span := startSpan(suiteCtx, "write file", w.hostAttribute(), attribute.String("remote-path", remotePath),
+		attribute.Int("size", len(content)))
+	defer func() { tracing.End(span, err) }()
+	return w.writeFile(remotePath, content, perm)
+}
+
+// writeFile writes the given content to the given remote file over SFTP, creating its directory if needed and
+// replacing the file if it exists, and sets its permissions
+func (w *windowsVM) writeFile(remotePath string, content []byte, perm os.FileMode) error {
+	if err := remotepath.Validate(remotePath); err != nil {
+		return err
+	}
+	remotePath = remotepath.ToWindowsPath(remotePath)
+	if len(content) > maxInlineFileSize {
+		return fmt.Errorf("cannot write %d bytes to %s, WriteFile is limited to %d bytes, use CopyFile instead",
+			len(content), remotePath, maxInlineFileSize)
+	}
+	if err := w.requireSSH("WriteFile"); err != nil {
+		return err
+	}
+	ftp, err := w.ssh().sftp()
+	if err != nil {
+		return err
+	}
+	if err = ftp.MkdirAll(sftpPath(remotepath.Dir(remotePath))); err != nil {
+		return fmt.Errorf("error creating remote directory of %s: %v", remotePath, err)
+	}
+	f, err := ftp.OpenFile(sftpPath(remotePath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("error creating %s on the Windows VM: %v", remotePath, err)
+	}
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s on the Windows VM: %v", remotePath, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing %s on the Windows VM: %v", remotePath, err)
+	}
+	// The OpenSSH server of Windows maps the permissions to the read-only attribute of the file
+	if err = ftp.Chmod(sftpPath(remotePath), perm); err != nil {
+		return fmt.Errorf("error setting the permissions of %s on the Windows VM: %v", remotePath, err)
+	}
+	return nil
+}
+
+func (w *windowsVM) ReadFile(remotePath string) (content []byte, err error) {
+	_, span := startSpan(suiteCtx, "read file", w.hostAttribute(), attribute.String("remote-path", remotePath))
+	defer func() { tracing.End(span, err) }()
+	return w.readFile(remotePath)
+}
+
+// readFile reads the given remote file over SFTP
+func (w *windowsVM) readFile(remotePath string) ([]byte, error) {
+	if err := remotepath.Validate(remotePath); err != nil {
+		return nil, err
+	}
+	remotePath = remotepath.ToWindowsPath(remotePath)
+	if err := w.requireSSH("ReadFile"); err != nil {
+		return nil, err
+	}
+	ftp, err := w.ssh().sftp()
+	if err != nil {
+		return nil, err
+	}
+	f, err := ftp.Open(sftpPath(remotePath))
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s on the Windows VM: %v", remotePath, err)
+	}
+	defer f.Close()
+	// The file may grow while it is read, so the limit is enforced on what is read rather than on its size
+	content, err := ioutil.ReadAll(io.LimitReader(f, maxInlineFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s on the Windows VM: %v", remotePath, err)
+	}
+	if len(content) > maxInlineFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes, the limit of ReadFile, use RetrieveFiles instead",
+			remotePath, maxInlineFileSize)
+	}
+	return content, nil
+}
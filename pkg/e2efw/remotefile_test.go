@@ -0,0 +1,62 @@
+package e2efw
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteAndReadFile tests that a file written on the VM with its directory is read back, and that the files over the
+// inline limit are rejected
+func TestWriteAndReadFile(t *testing.T) {
+	// The SFTP server of the fake ssh server serves the local file system, where C:/seed is relative to the working
+	// directory
+	dir, err := ioutil.TempDir("", "sftp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+	}
+	defer func() { w.ssh().close() }()
+
+	config := []byte("{\"logLevel\": 4}\r\n")
+	require.NoError(t, w.WriteFile("C:\\seed\\conf\\config.json", config, 0600))
+	local, err := ioutil.ReadFile(filepath.Join(dir, "C:", "seed", "conf", "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, config, local)
+	info, err := os.Stat(filepath.Join(dir, "C:", "seed", "conf", "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	require.NoError(t, w.WriteFile("C:/seed/conf/config.json", []byte("{}"), 0644), "the file should be replaced")
+	content, err := w.ReadFile("C:\\seed\\conf\\config.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("{}"), content)
+
+	_, err = w.ReadFile("C:\\seed\\missing.json")
+	assert.Error(t, err)
+	assert.Error(t, w.WriteFile("seed\\config.json", config, 0644), "relative paths should be rejected")
+	err = w.WriteFile("C:\\seed\\large.bin", make([]byte, maxInlineFileSize+1), 0644)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use CopyFile instead")
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "C:", "seed", "large.bin"),
+		bytes.Repeat([]byte{'x'}, maxInlineFileSize+1), 0644))
+	_, err = w.ReadFile("C:\\seed\\large.bin")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "use RetrieveFiles instead")
+}
@@ -0,0 +1,166 @@
+// Package remotepath composes and validates the paths on the Windows VMs, whatever the OS of the test host. The
+// path/filepath package only handles Windows paths when the test host runs Windows, and string concatenation with
+// backslashes doubles or drops the separators.
+package remotepath
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// Separator is the separator of the elements of the paths on the Windows VMs
+	Separator = "\\"
+	// longPathPrefix is the prefix lifting the MAX_PATH limit of the Windows APIs on a local path
+	longPathPrefix = "\\\\?\\"
+	// longUNCPathPrefix is the prefix lifting the MAX_PATH limit of the Windows APIs on a UNC path
+	longUNCPathPrefix = "\\\\?\\UNC\\"
+	// uncPrefix is the prefix of a UNC path, followed by the server and the share
+	uncPrefix = "\\\\"
+	// maxPath is the MAX_PATH limit of the Windows APIs on the length of a path without the long path prefix
+	maxPath = 260
+	// invalidChars are the characters that cannot appear in an element of a Windows path
+	invalidChars = "<>:\"|?*"
+)
+
+// splitPrefix splits the given path with backslashes into its prefix, the long path prefix, the UNC prefix, the drive
+// letter with or without a separator or the root separator, and the rest of the path. It also returns the number of
+// elements of the rest of the path that are part of the root, the server and share of a UNC path.
+func splitPrefix(path string) (string, string, int) {
+	switch {
+	case strings.HasPrefix(path, longUNCPathPrefix):
+		return longUNCPathPrefix, path[len(longUNCPathPrefix):], 2
+	case strings.HasPrefix(path, longPathPrefix):
+		prefix, rest, _ := splitPrefix(path[len(longPathPrefix):])
+		return longPathPrefix + prefix, rest, 0
+	case strings.HasPrefix(path, uncPrefix):
+		return uncPrefix, path[len(uncPrefix):], 2
+	case len(path) >= 2 && path[1] == ':' && isLetter(path[0]):
+		if len(path) > 2 && path[2] == '\\' {
+			return path[:3], path[3:], 0
+		}
+		return path[:2], path[2:], 0
+	case strings.HasPrefix(path, Separator):
+		return Separator, path[1:], 0
+	}
+	return "", path, 0
+}
+
+// isLetter returns true if the given character is an ASCII letter
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// ToWindowsPath returns the given path with backslashes as separators, without duplicated separators, . elements,
+// .. elements that can be resolved, nor trailing separator other than the one of the root of a drive. The long path
+// prefix and the server and share of a UNC path are kept.
+func ToWindowsPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	prefix, rest, root := splitPrefix(strings.ReplaceAll(path, "/", Separator))
+	rooted := prefix != "" && strings.HasSuffix(prefix, Separator)
+	var elems []string
+	for _, elem := range strings.Split(rest, Separator) {
+		switch {
+		case elem == "" || elem == ".":
+		case elem == ".." && len(elems) > root && elems[len(elems)-1] != "..":
+			elems = elems[:len(elems)-1]
+		case elem == ".." && rooted:
+			// There is nothing above the root
+		default:
+			elems = append(elems, elem)
+		}
+	}
+	joined := prefix + strings.Join(elems, Separator)
+	if joined == "" {
+		return "."
+	}
+	return joined
+}
+
+// WindowsPathJoin joins the given elements into a path on the Windows VMs, ignoring the empty ones, and returns it as
+// ToWindowsPath does
+func WindowsPathJoin(elem ...string) string {
+	var elems []string
+	for _, e := range elem {
+		if e != "" {
+			elems = append(elems, e)
+		}
+	}
+	return ToWindowsPath(strings.Join(elems, Separator))
+}
+
+// Base returns the last element of the given Windows path, ignoring its trailing separators
+func Base(path string) string {
+	path = strings.TrimRight(path, "\\/")
+	return path[strings.LastIndexAny(path, "\\/")+1:]
+}
+
+// Dir returns the given Windows path without its last element, the root of a drive being kept with its separator, or
+// an empty path if the path has a single element
+func Dir(path string) string {
+	path = ToWindowsPath(path)
+	prefix, rest, _ := splitPrefix(path)
+	i := strings.LastIndex(rest, Separator)
+	if i < 0 {
+		if rest == "" || !strings.HasSuffix(prefix, Separator) || prefix == uncPrefix {
+			return ""
+		}
+		return prefix
+	}
+	return prefix + rest[:i]
+}
+
+// IsAbs returns true if the given Windows path is absolute: a path from the root of a drive, a UNC path or a path
+// with the long path prefix
+func IsAbs(path string) bool {
+	path = strings.ReplaceAll(path, "/", Separator)
+	if strings.HasPrefix(path, uncPrefix) {
+		return true
+	}
+	prefix, _, _ := splitPrefix(path)
+	return len(prefix) == 3 && strings.HasSuffix(prefix, Separator)
+}
+
+// Validate returns an error if the given path cannot be used as an absolute path on the Windows VMs: it has no drive
+// letter nor UNC server and share, one of its elements has characters Windows does not allow, or it exceeds MAX_PATH
+// without the long path prefix
+func Validate(path string) error {
+	if path == "" {
+		return fmt.Errorf("empty Windows path")
+	}
+	if !IsAbs(path) {
+		return fmt.Errorf("invalid Windows path %s, expected an absolute path with a drive letter or a UNC path", path)
+	}
+	prefix, rest, root := splitPrefix(strings.ReplaceAll(path, "/", Separator))
+	elems := strings.Split(rest, Separator)
+	if root > 0 && (len(elems) < root || elems[0] == "" || elems[1] == "") {
+		return fmt.Errorf("invalid Windows path %s, expected the server and share of the UNC path", path)
+	}
+	for _, elem := range elems {
+		if i := strings.IndexFunc(elem, func(r rune) bool {
+			return r < 32 || strings.ContainsRune(invalidChars, r)
+		}); i >= 0 {
+			return fmt.Errorf("invalid Windows path %s, %q is not allowed in %s", path, elem[i], elem)
+		}
+	}
+	if !strings.HasPrefix(prefix, longPathPrefix) && len(path) >= maxPath {
+		return fmt.Errorf("Windows path %s is longer than %d characters, it needs the %s prefix", path, maxPath-1,
+			longPathPrefix)
+	}
+	return nil
+}
+
+// LongPath returns the given absolute Windows path with the long path prefix if it exceeds MAX_PATH, so that the
+// Windows APIs accept it. The other paths are returned as ToWindowsPath does.
+func LongPath(path string) string {
+	path = ToWindowsPath(path)
+	if len(path) < maxPath || strings.HasPrefix(path, longPathPrefix) || !IsAbs(path) {
+		return path
+	}
+	if strings.HasPrefix(path, uncPrefix) {
+		return longUNCPathPrefix + path[len(uncPrefix):]
+	}
+	return longPathPrefix + path
+}
@@ -0,0 +1,76 @@
+package remotepath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestToWindowsPath tests that the paths are normalized to backslashes, keeping their prefix
+func TestToWindowsPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"":                                  "",
+		"C:\\k\\":                           "C:\\k",
+		"C:/k/cni/config/":                  "C:\\k\\cni\\config",
+		"C:\\Windows\\Temp\\\\cni\\":        "C:\\Windows\\Temp\\cni",
+		"C:\\":                              "C:\\",
+		"c:\\k\\.\\log\\..\\kubelet.exe":    "c:\\k\\kubelet.exe",
+		"C:\\..\\k":                         "C:\\k",
+		"..\\k\\..\\..\\log":                "..\\..\\log",
+		"k\\..":                             ".",
+		"\\Temp\\images.tar":                "\\Temp\\images.tar",
+		"\\\\10.0.0.5\\fixtures\\..\\..":    "\\\\10.0.0.5\\fixtures",
+		"//10.0.0.5/fixtures/images.tar":    "\\\\10.0.0.5\\fixtures\\images.tar",
+		"\\\\?\\C:\\k\\\\kubelet.exe":       "\\\\?\\C:\\k\\kubelet.exe",
+		"\\\\?\\UNC\\10.0.0.5\\fixtures\\a": "\\\\?\\UNC\\10.0.0.5\\fixtures\\a",
+		"$env:TEMP\\cni.zip":                "$env:TEMP\\cni.zip",
+	} {
+		assert.Equal(t, expected, ToWindowsPath(path), "path %s", path)
+	}
+}
+
+// TestWindowsPathJoin tests that the elements are joined with single backslashes
+func TestWindowsPathJoin(t *testing.T) {
+	assert.Equal(t, "C:\\k\\kubelet.exe", WindowsPathJoin("C:\\k", "kubelet.exe"))
+	assert.Equal(t, "C:\\k\\kubelet.exe", WindowsPathJoin("C:\\k\\", "kubelet.exe"))
+	assert.Equal(t, "C:\\k\\cni\\config\\cni.conf", WindowsPathJoin("C:/k", "cni/config", "", "cni.conf"))
+	assert.Equal(t, "C:\\k", WindowsPathJoin("C:", "k"))
+	assert.Equal(t, "\\\\10.0.0.5\\fixtures\\images.tar", WindowsPathJoin("\\\\10.0.0.5\\fixtures", "images.tar"))
+	assert.Equal(t, "", WindowsPathJoin())
+}
+
+// TestBaseAndDir tests the splitting of the Windows paths
+func TestBaseAndDir(t *testing.T) {
+	assert.Equal(t, "kubelet.log", Base("C:\\var\\log\\kubelet\\kubelet.log"))
+	assert.Equal(t, "kubelet", Base("C:\\var\\log\\kubelet\\"))
+	assert.Equal(t, "kubelet.log", Base("C:/var/log/kubelet.log"))
+	assert.Equal(t, "kubelet.log", Base("kubelet.log"))
+	assert.Equal(t, "C:\\var\\log\\kubelet", Dir("C:\\var\\log\\kubelet\\kubelet.log"))
+	assert.Equal(t, "C:\\", Dir("C:\\kubelet.log"))
+	assert.Equal(t, "\\\\10.0.0.5\\fixtures", Dir("\\\\10.0.0.5\\fixtures\\images.tar"))
+	assert.Equal(t, "", Dir("kubelet.log"))
+}
+
+// TestValidate tests that only the absolute paths Windows accepts are valid
+func TestValidate(t *testing.T) {
+	for _, path := range []string{"C:\\k", "c:/k/log", "\\\\10.0.0.5\\fixtures", "\\\\?\\C:\\k",
+		"C:\\Program Files\\containerd", "C:\\" + strings.Repeat("a", 200)} {
+		assert.NoError(t, Validate(path), "path %s", path)
+	}
+	for _, path := range []string{"", "k\\log", "\\Temp", "C:k", "$env:TEMP\\cni", "C:\\k\\kube:let",
+		"C:\\k\\<log>", "\\\\10.0.0.5", "C:\\" + strings.Repeat("a", 300)} {
+		assert.Error(t, Validate(path), "path %s", path)
+	}
+	assert.NoError(t, Validate(LongPath("C:\\"+strings.Repeat("a", 300))))
+}
+
+// TestLongPath tests that only the paths exceeding MAX_PATH get the long path prefix
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	assert.Equal(t, "C:\\k", LongPath("C:\\k"))
+	assert.Equal(t, "\\\\?\\C:\\"+long, LongPath("C:\\"+long))
+	assert.Equal(t, "\\\\?\\C:\\"+long, LongPath("\\\\?\\C:\\"+long))
+	assert.Equal(t, "\\\\?\\UNC\\10.0.0.5\\fixtures\\"+long, LongPath("\\\\10.0.0.5\\fixtures\\"+long))
+	assert.Equal(t, "k\\"+long, LongPath("k\\"+long), "relative paths cannot have the prefix")
+}
@@ -0,0 +1,464 @@
+package e2efw
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// htmlReportFile is the file of ARTIFACT_DIR the HTML report of the run is written to
+	htmlReportFile = "report.html"
+	// transcriptDir is the directory of ARTIFACT_DIR the command transcripts of the Windows VMs are written to
+	transcriptDir = "transcripts"
+	// maxInlinedLogs is the number of log files of a Windows VM inlined in the report for each failure
+	maxInlinedLogs = 5
+	// maxInlinedLogLines is the number of last lines of a log file inlined in the report
+	maxInlinedLogLines = 100
+	// maxInlinedLogBytes is the size of the end of a log file its last lines are looked for in
+	maxInlinedLogBytes = 64 * 1024
+)
+
+// nodeArtifacts are the directories of ARTIFACT_DIR the artifacts of the Windows VMs were retrieved to
+var nodeArtifacts = struct {
+	// lock guards dirs and nodes
+	lock sync.Mutex
+	// dirs are the artifact directories by host
+	dirs map[string]string
+	// nodes are the names of the nodes by host
+	nodes map[string]string
+}{dirs: make(map[string]string), nodes: make(map[string]string)}
+
+// recordNodeArtifactDir records that the artifacts of the Windows VM of the given host, whose node has the given name,
+// are retrieved to the given directory, for the HTML report to link and inline them
+func recordNodeArtifactDir(host, node, dir string) {
+	nodeArtifacts.lock.Lock()
+	defer nodeArtifacts.lock.Unlock()
+	nodeArtifacts.dirs[host] = dir
+	nodeArtifacts.nodes[host] = node
+}
+
+// reportPhase is a phase of an operation of the framework, or the operation itself, as reported by its progress
+// events
+type reportPhase struct {
+	Operation string
+	Phase     string
+	Start     time.Time
+	Duration  time.Duration
+	// Status is one of started, completed and failed, started if the phase never ended
+	Status string
+	Error  string
+}
+
+// reportLog is the tail of a log file of a Windows VM
+type reportLog struct {
+	// Path is the path of the file relative to ARTIFACT_DIR
+	Path string
+	Tail string
+}
+
+// reportVM is the entry of a Windows VM in the report
+type reportVM struct {
+	Host string
+	Node string
+	// ArtifactDir is the directory of its artifacts relative to ARTIFACT_DIR, empty if none were retrieved
+	ArtifactDir string
+	// Transcript is the file of its command transcript relative to ARTIFACT_DIR, empty if none was written
+	Transcript string
+	Commands   int
+	Failed     int
+}
+
+// reportFailure is a failure of the run, with the logs of the Windows VMs it happened on
+type reportFailure struct {
+	Title string
+	Error string
+	Logs  []reportLog
+}
+
+// htmlReport is the data the HTML report is rendered from
+type htmlReport struct {
+	RunID     string
+	Context   RunContext
+	Generated time.Time
+	Phases    []reportPhase
+	Failures  []reportFailure
+	VMs       []reportVM
+	Commands  *CommandTimingReport
+	Flakes    *FlakeReport
+	NodeJoins *NodeJoinReport
+	// Files are the reports of ARTIFACT_DIR the HTML report summarizes, relative to it
+	Files []string
+}
+
+// htmlReportTemplate renders the report as a single page without external resources, so that it can be opened from
+// the CI artifacts as is
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(s float64) string { return fmt.Sprintf("%.1fs", s) },
+	"round":   func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+	"percent": func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Windows e2e run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; max-height: 30em; }
+.failed { color: #b00; font-weight: bold; }
+.started { color: #b60; }
+</style>
+</head>
+<body>
+<h1>Windows e2e run {{.RunID}}</h1>
+<p>Run context {{.Context}}. Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.
+{{- range .Files}} <a href="{{.}}">{{.}}</a>{{end}}</p>
+
+<h2>Failures</h2>
+{{- if not .Failures}}
+<p>No failure of the framework was recorded. The failures of the tests are in the test output.</p>
+{{- end}}
+{{- range .Failures}}
+<h3 class="failed">{{.Title}}</h3>
+<pre>{{.Error}}</pre>
+{{- range .Logs}}
+<details><summary>last lines of <a href="{{.Path}}">{{.Path}}</a></summary><pre>{{.Tail}}</pre></details>
+{{- end}}
+{{- end}}
+
+<h2>Phases</h2>
+<table>
+<tr><th>Operation</th><th>Phase</th><th>Start</th><th>Duration</th><th>Status</th></tr>
+{{- range .Phases}}
+<tr><td>{{.Operation}}</td><td>{{.Phase}}</td><td>{{.Start.Format "15:04:05"}}</td><td>{{round .Duration}}</td>
+<td class="{{.Status}}">{{.Status}}{{if .Error}}: {{.Error}}{{end}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Windows VMs</h2>
+<table>
+<tr><th>Host</th><th>Node</th><th>Commands</th><th>Failed commands</th><th>Artifacts</th></tr>
+{{- range .VMs}}
+<tr><td>{{.Host}}</td><td>{{.Node}}</td>
+<td>{{if .Transcript}}<a href="{{.Transcript}}">{{.Commands}}</a>{{else}}{{.Commands}}{{end}}</td>
+<td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td>
+<td>{{if .ArtifactDir}}<a href="{{.ArtifactDir}}">{{.ArtifactDir}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+
+{{- with .NodeJoins}}
+<h2>Node joins</h2>
+<p>Ready in {{seconds .NodeReadySeconds.P50}} at the median and {{seconds .NodeReadySeconds.Max}} at most, first pod
+running in {{seconds .FirstPodRunningSeconds.P50}} at the median.</p>
+{{- end}}
+
+{{- with .Commands}}
+<h2>Remote commands</h2>
+<table>
+<tr><th>Transport</th><th>Count</th><th>Median</th><th>90th percentile</th><th>Max</th></tr>
+{{- range $transport, $summary := .Transports}}
+<tr><td>{{$transport}}</td><td>{{$summary.Count}}</td><td>{{seconds $summary.P50}}</td><td>{{seconds $summary.P90}}</td>
+<td>{{seconds $summary.Max}}</td></tr>
+{{- end}}
+</table>
+<table>
+<tr><th>Host</th><th>Duration</th><th>Slowest commands</th></tr>
+{{- range .Slowest}}
+<tr><td>{{.Host}}</td><td>{{seconds .Seconds}}</td><td{{if .Failed}} class="failed"{{end}}><code>{{.Command}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- with .Flakes}}{{if .Operations}}
+<h2>Retried operations</h2>
+<table>
+<tr><th>Operation</th><th>Calls</th><th>Retried</th><th>Flaky</th><th>Failed</th><th>Flake rate</th><th>Hosts</th></tr>
+{{- range .Operations}}
+<tr><td>{{.Operation}}</td><td>{{.Calls}}</td><td>{{.Retried}}</td><td>{{.Flaky}}</td>
+<td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td><td>{{percent .FlakeRate}}</td><td>{{range .Hosts}}{{.}} {{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLReport writes the HTML report of the run to report.html in ARTIFACT_DIR, and the command transcripts of
+// the Windows VMs it links to. Failing to write it does not fail the run, as the reports it summarizes are there.
+func writeHTMLReport() {
+	if artifactDir == "" {
+		return
+	}
+	report := buildHTMLReport(artifactDir)
+	file, err := os.Create(filepath.Join(artifactDir, htmlReportFile))
+	if err != nil {
+		log.Printf("unable to write the HTML report: %v", err)
+		return
+	}
+	defer file.Close()
+	if err = htmlReportTemplate.Execute(file, report); err != nil {
+		log.Printf("error rendering the HTML report: %v", err)
+		return
+	}
+	log.Printf("HTML report of the run with %d failures written to %s", len(report.Failures), file.Name())
+}
+
+// buildHTMLReport returns the report of the run from the results recorded so far and the progress events and reports
+// written to the given artifact directory, and writes the command transcripts of the Windows VMs to it
+func buildHTMLReport(dir string) *htmlReport {
+	report := &htmlReport{RunID: runID, Context: CurrentRunContext(), Generated: time.Now(),
+		Commands: commandTimings.report(), Flakes: flakes.report()}
+	if joins := nodeJoins.report(); len(joins.Joins) > 0 {
+		report.NodeJoins = joins
+	}
+	for _, name := range []string{progressFileName, commandTimingFile, flakeReportFile, nodeJoinReportFile,
+		costReportFile, traceFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			report.Files = append(report.Files, name)
+		}
+	}
+
+	phases, err := readProgressPhases(filepath.Join(dir, progressFileName))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("unable to read the progress events for the HTML report: %v", err)
+	}
+	report.Phases = phases
+	for _, phase := range phases {
+		if phase.Status != progressFailed {
+			continue
+		}
+		title := phase.Operation + " failed"
+		if phase.Phase != "" {
+			title = phase.Operation + ": " + phase.Phase + " failed"
+		}
+		report.Failures = append(report.Failures, reportFailure{Title: title, Error: phase.Error})
+	}
+
+	report.VMs = reportVMs(dir)
+	for _, stats := range report.Flakes.Operations {
+		if stats.Failed == 0 {
+			continue
+		}
+		report.Failures = append(report.Failures, reportFailure{
+			Title: fmt.Sprintf("%s failed %d times", stats.Operation, stats.Failed),
+			Error: strings.Join(stats.Errors, "\n"), Logs: hostLogs(dir, stats.Hosts...)})
+	}
+	if report.NodeJoins != nil {
+		for _, join := range report.NodeJoins.Joins {
+			if join.NodeReadySeconds > 0 {
+				continue
+			}
+			report.Failures = append(report.Failures, reportFailure{
+				Title: "node of " + join.Host + " did not become Ready",
+				Error: fmt.Sprintf("WMCB was invoked at %s", join.WMCBInvoked.Format(time.RFC3339)),
+				Logs:  hostLogs(dir, join.Host)})
+		}
+	}
+	for _, vm := range report.VMs {
+		if vm.Failed == 0 {
+			continue
+		}
+		var failed []string
+		for _, timing := range commandTimings.transcript(vm.Host) {
+			if timing.Failed {
+				failed = append(failed, timing.Command)
+			}
+		}
+		report.Failures = append(report.Failures, reportFailure{
+			Title: fmt.Sprintf("%d commands failed on %s", vm.Failed, vm.Host), Error: strings.Join(failed, "\n"),
+			Logs: hostLogs(dir, vm.Host)})
+	}
+	return report
+}
+
+// readProgressPhases returns the operations and phases reported by the progress events of the given file, in the
+// order they started
+func readProgressPhases(path string) ([]reportPhase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var phases []reportPhase
+	started := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event ProgressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return phases, fmt.Errorf("invalid progress event %q: %v", scanner.Text(), err)
+		}
+		key := event.Operation + "/" + event.Phase
+		if event.Message == progressStarted {
+			started[key] = len(phases)
+			phases = append(phases, reportPhase{Operation: event.Operation, Phase: event.Phase, Start: event.Time,
+				Status: progressStarted})
+			continue
+		}
+		i, ok := started[key]
+		if !ok {
+			continue
+		}
+		phases[i].Duration = event.Time.Sub(phases[i].Start)
+		phases[i].Status = event.Message
+		phases[i].Error = event.Error
+	}
+	return phases, scanner.Err()
+}
+
+// reportVMs returns the Windows VMs of the run, the hosts commands were run on or artifacts were retrieved from, and
+// writes their command transcripts to the given artifact directory
+func reportVMs(dir string) []reportVM {
+	nodeArtifacts.lock.Lock()
+	hosts := commandTimings.hosts()
+	for host := range nodeArtifacts.dirs {
+		if !containsString(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	vms := make([]reportVM, 0, len(hosts))
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		vm := reportVM{Host: host, Node: nodeArtifacts.nodes[host]}
+		if nodeDir, ok := nodeArtifacts.dirs[host]; ok {
+			vm.ArtifactDir = relativeArtifact(dir, nodeDir)
+		}
+		vms = append(vms, vm)
+	}
+	nodeArtifacts.lock.Unlock()
+	sort.Slice(vms, func(i, j int) bool { return vms[i].Host < vms[j].Host })
+
+	for i := range vms {
+		transcript := commandTimings.transcript(vms[i].Host)
+		if len(transcript) == 0 {
+			continue
+		}
+		vms[i].Commands = len(transcript)
+		for _, timing := range transcript {
+			if timing.Failed {
+				vms[i].Failed++
+			}
+		}
+		name := filepath.Join(transcriptDir, vms[i].Host+".log")
+		if err := writeTranscript(filepath.Join(dir, name), transcript); err != nil {
+			log.Printf("unable to write the command transcript of %s: %v", vms[i].Host, err)
+			continue
+		}
+		vms[i].Transcript = filepath.ToSlash(name)
+	}
+	return vms
+}
+
+// writeTranscript writes the given commands to the given file, one per line with their start, duration and status,
+// after a line with the context of the run
+func writeTranscript(path string, transcript []CommandTiming) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	w.WriteString(runContextHeader(CurrentRunContext()))
+	for _, timing := range transcript {
+		status := "ok"
+		if timing.Failed {
+			status = "FAILED"
+		}
+		fmt.Fprintf(w, "%s %6.1fs %-6s %-5s %s\n", timing.Start.Format(time.RFC3339), timing.Seconds, status,
+			timing.Transport, timing.Command)
+	}
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// hostLogs returns the tails of the first maxInlinedLogs log files retrieved from the Windows VMs of the given hosts
+// to the given artifact directory
+func hostLogs(dir string, hosts ...string) []reportLog {
+	var logs []reportLog
+	for _, host := range hosts {
+		nodeArtifacts.lock.Lock()
+		nodeDir, ok := nodeArtifacts.dirs[host]
+		nodeArtifacts.lock.Unlock()
+		if !ok {
+			continue
+		}
+		found := 0
+		_ = filepath.Walk(nodeDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || found >= maxInlinedLogs {
+				return nil
+			}
+			if !info.Mode().IsRegular() || filepath.Ext(path) != ".log" {
+				return nil
+			}
+			tail, err := tailFile(path, maxInlinedLogLines)
+			if err != nil {
+				return nil
+			}
+			logs = append(logs, reportLog{Path: relativeArtifact(dir, path), Tail: tail})
+			found++
+			return nil
+		})
+	}
+	return logs
+}
+
+// tailFile returns the last lines of the given file, at most the given number, read from its last
+// maxInlinedLogBytes so that the large logs are not read whole
+func tailFile(path string, lines int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	truncated := info.Size() > maxInlinedLogBytes
+	if truncated {
+		if _, err = file.Seek(-maxInlinedLogBytes, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	all := strings.Split(strings.TrimRight(string(contents), "\r\n"), "\n")
+	if truncated && len(all) > 1 {
+		// The first line read is likely partial
+		all = all[1:]
+	}
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n"), nil
+}
+
+// relativeArtifact returns the given path relative to the given artifact directory with forward slashes, as linked
+// from the report, or the path itself if it is not under it
+func relativeArtifact(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
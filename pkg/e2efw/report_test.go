@@ -0,0 +1,105 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHTMLReport tests that the HTML report renders the phases of the run, links the command transcripts and the
+// artifacts of the Windows VMs, and inlines the logs of the VMs the failures happened on
+func TestHTMLReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+	defer func(id string) { runID = id }(runID)
+	runID = "abc12"
+	defer func(timer *commandTimer) { commandTimings = timer }(commandTimings)
+	commandTimings = newCommandTimer()
+	defer func(recorder *flakeRecorder) { flakes = recorder }(flakes)
+	flakes = newFlakeRecorder()
+	defer func(recorder *nodeJoinRecorder) { nodeJoins = recorder }(nodeJoins)
+	nodeJoins = newNodeJoinRecorder()
+	defer func(context RunContext) { runContext = context }(runContext)
+	runContext = RunContext{RunID: "abc12", Provider: "aws"}
+
+	require.NoError(t, setupProgress(nil))
+	progress := startProgress("Setup", 2)
+	require.NoError(t, progress.phase("create Windows VM 0", func() error { return nil }))
+	err = progress.phase("connect to the cluster", func() error { return fmt.Errorf("unauthorized") })
+	progress.end(err)
+	closeProgress()
+
+	nodeDir := filepath.Join(dir, "2019", "nodes", "winnode")
+	require.NoError(t, os.MkdirAll(filepath.Join(nodeDir, "logs"), os.ModePerm))
+	var kubeletLog strings.Builder
+	for i := 0; i < 2*maxInlinedLogLines; i++ {
+		fmt.Fprintf(&kubeletLog, "I0301 kubelet line %d\n", i)
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(nodeDir, "logs", "kubelet.log"), []byte(kubeletLog.String()),
+		0644))
+	defer func() {
+		nodeArtifacts.dirs = make(map[string]string)
+		nodeArtifacts.nodes = make(map[string]string)
+	}()
+	recordNodeArtifactDir("10.0.0.1", "winnode", nodeDir)
+	commandTimings.record("ssh", "10.0.0.1", "hostname", time.Now(), false)
+	commandTimings.record("ssh", "10.0.0.1", "Get-Service kubelet", time.Now(), true)
+	RecordAttempts("ssh session", "10.0.0.1", 3, fmt.Errorf("connection reset"))
+
+	writeHTMLReport()
+	contents, err := ioutil.ReadFile(filepath.Join(dir, htmlReportFile))
+	require.NoError(t, err)
+	html := string(contents)
+	assert.Contains(t, html, "Windows e2e run abc12")
+	assert.Contains(t, html, "Run context run=abc12,provider=aws.")
+	assert.Contains(t, html, "Setup: connect to the cluster failed")
+	assert.Contains(t, html, `<td class="failed">failed: unauthorized</td>`)
+	assert.Contains(t, html, "ssh session failed 1 times")
+	assert.Contains(t, html, "1 commands failed on 10.0.0.1")
+	assert.Contains(t, html, `<a href="transcripts/10.0.0.1.log">2</a>`)
+	assert.Contains(t, html, `<a href="2019/nodes/winnode">2019/nodes/winnode</a>`)
+	assert.Contains(t, html, `<a href="progress.jsonl">progress.jsonl</a>`)
+	assert.Contains(t, html, fmt.Sprintf("I0301 kubelet line %d", 2*maxInlinedLogLines-1))
+	assert.NotContains(t, html, fmt.Sprintf("I0301 kubelet line %d\n", maxInlinedLogLines-1),
+		"only the last lines of the logs should be inlined")
+
+	transcript, err := ioutil.ReadFile(filepath.Join(dir, transcriptDir, "10.0.0.1.log"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(transcript)), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "# run context: run=abc12,provider=aws", lines[0])
+	assert.Contains(t, lines[1], "ok     ssh   hostname")
+	assert.Contains(t, lines[2], "FAILED ssh   Get-Service kubelet")
+}
+
+// TestTailFile tests that only the last lines of the end of a large log file are returned, without the partial line
+// the end starts with
+func TestTailFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubelet.log")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	line := strings.Repeat("x", 99) + "\n"
+	_, err = file.WriteString(strings.Repeat(line, 2*maxInlinedLogBytes/len(line)) + "last\r\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	tail, err := tailFile(file.Name(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 99)+"\n"+strings.Repeat("x", 99)+"\nlast", tail)
+
+	tail, err = tailFile(file.Name(), maxInlinedLogBytes)
+	require.NoError(t, err)
+	for _, l := range strings.Split(tail, "\n")[:10] {
+		assert.Equal(t, strings.Repeat("x", 99), l, "the partial first line should be dropped")
+	}
+}
@@ -0,0 +1,101 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// NodeResetReport lists what a reset removed from a Windows VM, mirroring the report of the WMCB node reset
+type NodeResetReport struct {
+	// Containers is the number of containers removed
+	Containers int `json:"containers"`
+	// Images is the number of images removed
+	Images int `json:"images"`
+	// HNSEndpoints is the number of HNS endpoints removed
+	HNSEndpoints int `json:"hnsEndpoints"`
+	// ReclaimedBytes is the space freed on the system drive
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// Warnings are the steps that could not be done
+	Warnings []string `json:"warnings"`
+}
+
+// String returns a one line summary of the report
+func (r *NodeResetReport) String() string {
+	summary := fmt.Sprintf("removed %d containers, %d images and %d HNS endpoints, reclaimed %.1f MiB",
+		r.Containers, r.Images, r.HNSEndpoints, float64(r.ReclaimedBytes)/(1<<20))
+	if len(r.Warnings) > 0 {
+		summary += " (" + strings.Join(r.Warnings, "; ") + ")"
+	}
+	return summary
+}
+
+// nodeResetScript returns the PowerShell script removing the containers of the container runtime of the nodes, its
+// images unless keepImages is set, and the HNS endpoints, printing the report as JSON on its last line, like the WMCB
+// node reset. The record of the loaded image archives is removed along with the images, so that they are loaded
+// again.
+func nodeResetScript(keepImages bool) string {
+	listContainers, removeContainers := "docker ps -aq --no-trunc", "docker rm -f $containers"
+	listImages, removeImages := "docker images -aq --no-trunc | Select-Object -Unique", "docker rmi -f $images"
+	stopTasks := ""
+	if ContainerRuntime == ContainerdRuntime {
+		stopTasks = "foreach ($task in @(ctr -n k8s.io tasks ls -q)) { ctr -n k8s.io tasks rm -f $task | Out-Null }\n"
+		listContainers, removeContainers = "ctr -n k8s.io containers ls -q", "ctr -n k8s.io containers rm $containers"
+		listImages, removeImages = "ctr -n k8s.io images ls -q", "ctr -n k8s.io images rm $images"
+	}
+	script := `$ErrorActionPreference = 'Stop'
+$free = (Get-PSDrive -Name $env:SystemDrive.TrimEnd(':')).Free
+$report = @{containers = 0; images = 0; hnsEndpoints = 0; reclaimedBytes = 0; warnings = @()}
+` + stopTasks + `$containers = @(` + listContainers + `)
+if ($containers.Count -gt 0) { ` + removeContainers + ` | Out-Null }
+$report.containers = $containers.Count
+`
+	if !keepImages {
+		script += `$images = @(` + listImages + `)
+if ($images.Count -gt 0) { ` + removeImages + ` | Out-Null }
+$report.images = $images.Count
+Remove-Item -Force -ErrorAction SilentlyContinue -Path ` + PowerShellString(loadedArchivesFile) + `
+`
+	}
+	return script + `if (Get-Command -Name Get-HnsEndpoint -ErrorAction SilentlyContinue) {
+    $endpoints = @(Get-HnsEndpoint)
+    $endpoints | Remove-HnsEndpoint | Out-Null
+    $report.hnsEndpoints = $endpoints.Count
+} else {
+    $report.warnings += 'the HNS endpoints were not removed, Get-HnsEndpoint is not available'
+}
+$report.reclaimedBytes = (Get-PSDrive -Name $env:SystemDrive.TrimEnd(':')).Free - $free
+$report | ConvertTo-Json -Compress`
+}
+
+// parseNodeResetReport returns the report printed on the last line of the output of the node reset script
+func parseNodeResetReport(out string) (*NodeResetReport, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	report := &NodeResetReport{}
+	if err := json.Unmarshal([]byte(last), report); err != nil {
+		return nil, fmt.Errorf("invalid node reset report %q: %v", last, err)
+	}
+	return report, nil
+}
+
+// ResetNode removes the containers left on the Windows VM by previous tests, its images unless keepImages is set, and
+// its HNS endpoints, and returns what was removed
+func ResetNode(vm WindowsVM, keepImages bool) (*NodeResetReport, error) {
+	return vm.handle().resetNode(keepImages)
+}
+
+// resetNode implements ResetNode
+func (w *windowsVM) resetNode(keepImages bool) (*NodeResetReport, error) {
+	stdout, stderr, err := w.Run(PowerShellScript(nodeResetScript(keepImages)), true)
+	if err != nil {
+		return nil, fmt.Errorf("error resetting the node: %v, %s", err, stderr)
+	}
+	report, err := parseNodeResetReport(stdout)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("reset %s: %s", w.GetCredentials().GetIPAddress(), report)
+	return report, nil
+}
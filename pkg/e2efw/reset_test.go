@@ -0,0 +1,43 @@
+package e2efw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNodeResetScript tests that the node reset script removes the containers and images of the container runtime of
+// the nodes, forgetting the loaded image archives along with the images
+func TestNodeResetScript(t *testing.T) {
+	defer func(runtime string) { ContainerRuntime = runtime }(ContainerRuntime)
+
+	ContainerRuntime = DockerRuntime
+	script := nodeResetScript(false)
+	assert.Contains(t, script, "docker rm -f $containers")
+	assert.Contains(t, script, "docker rmi -f $images")
+	assert.Contains(t, script, loadedArchivesFile)
+	assert.Contains(t, script, "Remove-HnsEndpoint")
+
+	ContainerRuntime = ContainerdRuntime
+	script = nodeResetScript(true)
+	assert.Contains(t, script, "ctr -n k8s.io tasks rm -f $task")
+	assert.Contains(t, script, "ctr -n k8s.io containers rm $containers")
+	assert.NotContains(t, script, "images rm")
+	assert.NotContains(t, script, loadedArchivesFile)
+}
+
+// TestParseNodeResetReport tests that the report is read from the last line of the output of the node reset script
+func TestParseNodeResetReport(t *testing.T) {
+	report, err := parseNodeResetReport("Deleted: sha256:0a1b\r\n" +
+		`{"containers":2,"images":1,"hnsEndpoints":2,"reclaimedBytes":1048576,` +
+		`"warnings":["the HNS endpoints were not removed"]}` + "\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Containers)
+	assert.Equal(t, int64(1<<20), report.ReclaimedBytes)
+	assert.Equal(t, "removed 2 containers, 1 images and 2 HNS endpoints, reclaimed 1.0 MiB (the HNS endpoints were "+
+		"not removed)", report.String())
+
+	_, err = parseNodeResetReport("")
+	assert.Error(t, err)
+}
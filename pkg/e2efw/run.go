@@ -0,0 +1,137 @@
+package e2efw
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8srand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// runIDEnvVar is the environment variable holding the ID of the run, e.g. the name of the engineer or the ID of
+	// the CI job, so that several runs can share a cluster, a cloud account and an artifact directory. A random ID is
+	// generated if it is not set.
+	runIDEnvVar = "E2E_RUN_ID"
+	// RunIDLabel is the label holding the run ID of the cluster objects created by the test suites
+	RunIDLabel = "e2e.openshift.io/run-id"
+	// runIDTag is the tag holding the run ID of the cloud instances created by the run
+	runIDTag = "e2e-run-id"
+	// maxRunIDLength is the length of the longest run ID, which prefixes the names of the cluster objects
+	maxRunIDLength = 16
+	// generatedRunIDLength is the length of the generated run IDs
+	generatedRunIDLength = 5
+)
+
+var (
+	// runID is the ID of the run, scoping the names, labels and tags of the resources it creates
+	runID string
+	// runIDRegex matches the valid run IDs, which have to be valid in the names and label values of the cluster
+	// objects
+	runIDRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// runIDFromEnv returns the run ID given by E2E_RUN_ID and true, or a generated run ID and false if it is not set
+func runIDFromEnv() (string, bool, error) {
+	id := os.Getenv(runIDEnvVar)
+	if id == "" {
+		return k8srand.String(generatedRunIDLength), false, nil
+	}
+	if len(id) > maxRunIDLength || !runIDRegex.MatchString(id) {
+		return "", false, fmt.Errorf("invalid %s %q, expected at most %d lowercase alphanumeric characters or '-'",
+			runIDEnvVar, id, maxRunIDLength)
+	}
+	return id, true, nil
+}
+
+// RunID returns the ID of the run, given by E2E_RUN_ID or generated
+func RunID() string {
+	return runID
+}
+
+// RunScopedName returns the given name of a cluster object prefixed with the run ID, so that the objects of the runs
+// sharing the cluster do not collide
+func RunScopedName(name string) string {
+	return "e2e-" + runID + "-" + name
+}
+
+// RunLabels returns the given labels of a cluster object along with the run ID label, which TearDown deletes the
+// objects the run left in the cluster by. The given map is not modified.
+func RunLabels(labels map[string]string) map[string]string {
+	scoped := map[string]string{RunIDLabel: runID}
+	for key, value := range labels {
+		scoped[key] = value
+	}
+	return scoped
+}
+
+// runSelector returns the label selector of the cluster objects of the run
+func runSelector() metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: RunIDLabel + "=" + runID}
+}
+
+// deleteRunObjects deletes the deployments, jobs, services and pods labeled with the run ID from the default
+// namespace, and the namespaces labeled with it, which the test suites left behind, e.g. when they failed before
+// deleting them. The objects of the other runs sharing the cluster are left alone.
+func deleteRunObjects(client kubernetes.Interface) error {
+	errs := NewMultiError("delete the cluster objects of run " + runID)
+	propagation := metav1.DeletePropagationBackground
+	options := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+	namespace := v1.NamespaceDefault
+
+	if deployments, err := client.AppsV1().Deployments(namespace).List(runSelector()); err != nil {
+		errs.Appendf("error listing the deployments: %v", err)
+	} else {
+		for _, deployment := range deployments.Items {
+			errs.Append(client.AppsV1().Deployments(namespace).Delete(deployment.Name, options))
+		}
+	}
+	if jobs, err := client.BatchV1().Jobs(namespace).List(runSelector()); err != nil {
+		errs.Appendf("error listing the jobs: %v", err)
+	} else {
+		for _, job := range jobs.Items {
+			errs.Append(client.BatchV1().Jobs(namespace).Delete(job.Name, options))
+		}
+	}
+	if services, err := client.CoreV1().Services(namespace).List(runSelector()); err != nil {
+		errs.Appendf("error listing the services: %v", err)
+	} else {
+		for _, service := range services.Items {
+			errs.Append(client.CoreV1().Services(namespace).Delete(service.Name, options))
+		}
+	}
+	if pods, err := client.CoreV1().Pods(namespace).List(runSelector()); err != nil {
+		errs.Appendf("error listing the pods: %v", err)
+	} else {
+		for _, pod := range pods.Items {
+			errs.Append(client.CoreV1().Pods(namespace).Delete(pod.Name, options))
+		}
+	}
+	// The namespaces of the tests needing one of their own, e.g. for an EgressFirewall, are deleted with their objects
+	if namespaces, err := client.CoreV1().Namespaces().List(runSelector()); err != nil {
+		errs.Appendf("error listing the namespaces: %v", err)
+	} else {
+		for _, ns := range namespaces.Items {
+			errs.Append(client.CoreV1().Namespaces().Delete(ns.Name, options))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// tagRunInstance tags the given instance with the run ID, so that the instances of the runs sharing the cloud account
+// can be told apart
+func tagRunInstance(ec2Client *ec2.EC2, instanceID string) error {
+	_, err := ec2Client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{awssdk.String(instanceID)},
+		Tags:      []*ec2.Tag{{Key: awssdk.String(runIDTag), Value: awssdk.String(runID)}},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging instance %s with run ID %s: %v", instanceID, runID, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestRunIDFromEnv tests that the given run IDs are validated and that a run ID is generated if none is given
+func TestRunIDFromEnv(t *testing.T) {
+	defer os.Unsetenv(runIDEnvVar)
+
+	os.Unsetenv(runIDEnvVar)
+	id, given, err := runIDFromEnv()
+	require.NoError(t, err)
+	assert.False(t, given)
+	assert.Len(t, id, generatedRunIDLength)
+
+	for _, valid := range []string{"jdoe", "pr-1234", "0123456789abcdef"} {
+		os.Setenv(runIDEnvVar, valid)
+		id, given, err = runIDFromEnv()
+		require.NoError(t, err, valid)
+		assert.True(t, given)
+		assert.Equal(t, valid, id)
+	}
+	for _, invalid := range []string{"JDoe", "pr_1234", "-jdoe", "jdoe-", "0123456789abcdefg"} {
+		os.Setenv(runIDEnvVar, invalid)
+		_, _, err = runIDFromEnv()
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestRunScopedNames tests that the names and labels of the cluster objects are scoped by the run ID
+func TestRunScopedNames(t *testing.T) {
+	defer func(previous string) { runID = previous }(runID)
+	runID = "jdoe"
+
+	assert.Equal(t, "e2e-jdoe-win-webserver", RunScopedName("win-webserver"))
+
+	labels := map[string]string{"app": "win-webserver"}
+	assert.Equal(t, map[string]string{"app": "win-webserver", RunIDLabel: "jdoe"}, RunLabels(labels))
+	assert.Equal(t, map[string]string{"app": "win-webserver"}, labels)
+	assert.Equal(t, map[string]string{RunIDLabel: "jdoe"}, RunLabels(nil))
+}
+
+// TestDeleteRunObjects tests that only the cluster objects of the run are deleted
+func TestDeleteRunObjects(t *testing.T) {
+	defer func(previous string) { runID = previous }(runID)
+	runID = "jdoe"
+
+	meta := func(name, run string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: v1.NamespaceDefault, Labels: map[string]string{RunIDLabel: run}}
+	}
+	client := fake.NewSimpleClientset([]runtime.Object{
+		&appsv1.Deployment{ObjectMeta: meta("e2e-jdoe-deployment", "jdoe")},
+		&appsv1.Deployment{ObjectMeta: meta("e2e-other-deployment", "other")},
+		&v1.Service{ObjectMeta: meta("e2e-jdoe-service", "jdoe")},
+		&v1.Pod{ObjectMeta: meta("e2e-jdoe-pod", "jdoe")},
+		&v1.Pod{ObjectMeta: meta("e2e-other-pod", "other")},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: v1.NamespaceDefault}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-jdoe-egress",
+			Labels: map[string]string{RunIDLabel: "jdoe"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-other-egress",
+			Labels: map[string]string{RunIDLabel: "other"}}},
+	}...)
+
+	require.NoError(t, deleteRunObjects(client))
+
+	deployments, err := client.AppsV1().Deployments(v1.NamespaceDefault).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, deployments.Items, 1)
+	assert.Equal(t, "e2e-other-deployment", deployments.Items[0].Name)
+	services, err := client.CoreV1().Services(v1.NamespaceDefault).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, services.Items)
+	pods, err := client.CoreV1().Pods(v1.NamespaceDefault).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	assert.ElementsMatch(t, []string{"e2e-other-pod", "unlabeled"}, names)
+	namespaces, err := client.CoreV1().Namespaces().List(metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, namespaces.Items, 1)
+	assert.Equal(t, "e2e-other-egress", namespaces.Items[0].Name)
+}
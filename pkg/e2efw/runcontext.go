@@ -0,0 +1,141 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RunContextEnvVar is the environment variable the run context is passed to the commands run on the VMs in, so
+	// that WMCB attaches it to its log lines and spans
+	RunContextEnvVar = runcontext.EnvVar
+	// manifestFile is the name of the artifact listing the artifacts of the run along with its context
+	manifestFile = "manifest.json"
+)
+
+// RunContext identifies the run, the cluster, the Windows build and the cloud provider the logs, reports and spans of
+// a run come from, so that the data of large test matrices can be sliced by them. The fields are empty until known, and
+// the Windows build is only known for the whole run if it uses a single image. It is the context of the runcontext
+// module shared with WMCB and WNI.
+type RunContext = runcontext.Context
+
+// ArtifactManifest lists the artifacts of a run along with its context
+type ArtifactManifest struct {
+	// Context is the context of the run
+	Context RunContext `json:"context"`
+	// Artifacts are the files of the artifact directory, sorted by path
+	Artifacts []ManifestEntry `json:"artifacts"`
+}
+
+// ManifestEntry is a file of the artifact directory
+type ManifestEntry struct {
+	// Path is the path of the file relative to the artifact directory, with forward slashes
+	Path string `json:"path"`
+	// Size is the size of the file in bytes
+	Size int64 `json:"size"`
+}
+
+var (
+	// runContextLock guards runContext, as the VMs are created concurrently
+	runContextLock sync.Mutex
+	// runContext is the context of the run
+	runContext RunContext
+)
+
+// CurrentRunContext returns the context of the run, its fields being filled as the run is set up
+func CurrentRunContext() RunContext {
+	runContextLock.Lock()
+	defer runContextLock.Unlock()
+	return runContext
+}
+
+// RunContextOf returns the context of the run with the Windows build of the given VM, which is passed to the commands
+// run on it through E2E_RUN_CONTEXT
+func RunContextOf(vm WindowsVM) RunContext {
+	context := CurrentRunContext()
+	if version := vm.GetImage().Version; version != "" {
+		context.WindowsBuild = version
+	}
+	return context
+}
+
+// updateRunContext applies the given update to the context of the run and prefixes the log lines with it
+func updateRunContext(update func(*RunContext)) {
+	runContextLock.Lock()
+	defer runContextLock.Unlock()
+	update(&runContext)
+	log.SetPrefix("[" + runContext.String() + "] ")
+}
+
+// runContextMetadata returns the known fields of the given context as the metadata of the objects stored in a bucket
+func runContextMetadata(c RunContext) map[string]*string {
+	metadata := make(map[string]*string)
+	for _, field := range c.Fields() {
+		metadata["e2e-"+field[0]] = awssdk.String(field[1])
+	}
+	return metadata
+}
+
+// setClusterRunContext adds the ID and the cloud provider of the cluster to the context of the run. The run goes on
+// without them if they cannot be read.
+func (f *TestFramework) setClusterRunContext() {
+	clusterVersion, err := f.OSConfigClient.ConfigV1().ClusterVersions().Get("version", metav1.GetOptions{})
+	if err != nil {
+		log.Printf("unable to get the ID of the cluster: %v", err)
+	} else {
+		updateRunContext(func(c *RunContext) { c.ClusterID = string(clusterVersion.Spec.ClusterID) })
+	}
+	infrastructure, err := f.OSConfigClient.ConfigV1().Infrastructures().Get("cluster", metav1.GetOptions{})
+	if err != nil {
+		log.Printf("unable to get the cloud provider of the cluster: %v", err)
+		return
+	}
+	platform := infrastructure.Status.Platform
+	if infrastructure.Status.PlatformStatus != nil && infrastructure.Status.PlatformStatus.Type != "" {
+		platform = infrastructure.Status.PlatformStatus.Type
+	}
+	updateRunContext(func(c *RunContext) { c.Provider = strings.ToLower(string(platform)) })
+}
+
+// writeArtifactManifest writes the manifest of the files of the artifact directory along with the context of the run,
+// so that the artifacts stored in a sink can be related to the run they come from
+func writeArtifactManifest() {
+	if artifactDir == "" {
+		return
+	}
+	manifest := ArtifactManifest{Context: CurrentRunContext()}
+	err := filepath.Walk(artifactDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(artifactDir, path)
+		if err != nil {
+			return err
+		}
+		if rel != manifestFile {
+			manifest.Artifacts = append(manifest.Artifacts, ManifestEntry{Path: filepath.ToSlash(rel),
+				Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("unable to list the artifacts: %v", err)
+		return
+	}
+	if err = writeJSONArtifact(manifest, filepath.Join(artifactDir, manifestFile)); err != nil {
+		log.Printf("unable to write the artifact manifest: %v", err)
+	}
+}
+
+// runContextHeader returns the line heading the text artifacts with the given context
+func runContextHeader(c RunContext) string {
+	return fmt.Sprintf("# run context: %s\n", c)
+}
@@ -0,0 +1,67 @@
+package e2efw
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TestRunContext tests the rendering of the run context, its build on each VM and the prefixing of the log lines
+func TestRunContext(t *testing.T) {
+	defer func(context RunContext) { runContext = context }(runContext)
+	defer log.SetPrefix(log.Prefix())
+	defer log.SetOutput(os.Stderr)
+	runContext = RunContext{}
+
+	updateRunContext(func(c *RunContext) { c.RunID = "abc12" })
+	updateRunContext(func(c *RunContext) { c.ClusterID, c.Provider = "5e1c0bd2", "aws" })
+	c := CurrentRunContext()
+	assert.Equal(t, "run=abc12,cluster=5e1c0bd2,provider=aws", c.String())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("e2e.run", "abc12"),
+		attribute.String("e2e.cluster", "5e1c0bd2"), attribute.String("e2e.provider", "aws")}, c.Attributes())
+	assert.Equal(t, "aws", *runContextMetadata(c)["e2e-provider"])
+	assert.Len(t, runContextMetadata(c), 3)
+
+	assert.Equal(t, "run=abc12,cluster=5e1c0bd2,build=20H2,provider=aws",
+		RunContextOf(&windowsVM{image: WindowsImage{Version: "20H2"}}).String())
+	assert.Equal(t, c, RunContextOf(&windowsVM{}), "the VMs of the latest image have no known build")
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.Print("creating Windows VM")
+	assert.Contains(t, out.String(), "[run=abc12,cluster=5e1c0bd2,provider=aws] ")
+}
+
+// TestWriteArtifactManifest tests that the manifest lists the artifacts of the run along with its context
+func TestWriteArtifactManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+	defer func(context RunContext) { runContext = context }(runContext)
+	runContext = RunContext{RunID: "abc12", WindowsBuild: "2019"}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "2019", "nodes"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2019", "nodes", "kubelet.log"), []byte("started"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, flakeReportFile), []byte("{}"), 0644))
+
+	// Writing the manifest again does not list the previous manifest
+	writeArtifactManifest()
+	writeArtifactManifest()
+	contents, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	require.NoError(t, err)
+	var manifest ArtifactManifest
+	require.NoError(t, json.Unmarshal(contents, &manifest))
+	assert.Equal(t, ArtifactManifest{Context: RunContext{RunID: "abc12", WindowsBuild: "2019"},
+		Artifacts: []ManifestEntry{{Path: "2019/nodes/kubelet.log", Size: 7}, {Path: flakeReportFile, Size: 2}}},
+		manifest)
+}
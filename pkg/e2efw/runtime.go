@@ -0,0 +1,103 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// containerRuntimeEnvVar is the environment variable holding the container runtime the nodes are bootstrapped
+	// with, docker or containerd. It defaults to docker, which the Windows images with containers come with.
+	containerRuntimeEnvVar = "E2E_CONTAINER_RUNTIME"
+	// DockerRuntime is the Docker container runtime, used by the kubelet through its dockershim
+	DockerRuntime = "docker"
+	// ContainerdRuntime is the containerd container runtime, used by the kubelet through CRI
+	ContainerdRuntime = "containerd"
+	// containerdVersion is the version of containerd installed on the VMs when they run containerd
+	containerdVersion = "1.6.8"
+	// containerdDir is the directory containerd is installed in on the VMs
+	containerdDir = "C:\\Program Files\\containerd"
+	// containerRuntimeEventsFile is the file of the node artifacts holding the events logged by the container runtime
+	containerRuntimeEventsFile = "container-runtime-events.log"
+	// maxContainerRuntimeEvents is the number of the latest container runtime events collected from a VM
+	maxContainerRuntimeEvents = 1000
+)
+
+// ContainerRuntime is the container runtime the nodes are bootstrapped with, DockerRuntime or ContainerdRuntime
+var ContainerRuntime = DockerRuntime
+
+// containerRuntimeFromEnv returns the container runtime given by E2E_CONTAINER_RUNTIME, DockerRuntime if not set
+func containerRuntimeFromEnv() (string, error) {
+	switch runtime := strings.ToLower(os.Getenv(containerRuntimeEnvVar)); runtime {
+	case "":
+		return DockerRuntime, nil
+	case DockerRuntime, ContainerdRuntime:
+		return runtime, nil
+	default:
+		return "", fmt.Errorf("invalid %s %s, expected %s or %s", containerRuntimeEnvVar, runtime, DockerRuntime,
+			ContainerdRuntime)
+	}
+}
+
+// installContainerdScript returns the PowerShell script installing containerd on the VM as a Windows service, in the
+// directory added to the Path by SetupContainerRuntime. Nothing is done if the service exists already.
+func installContainerdScript() string {
+	archive := "containerd-" + containerdVersion + "-windows-amd64.tar.gz"
+	url := "https://github.com/containerd/containerd/releases/download/v" + containerdVersion + "/" + archive
+	dir := PowerShellString(containerdDir)
+	return "if (-not (Get-Service -Name containerd -ErrorAction SilentlyContinue)) { " +
+		"$ProgressPreference = 'SilentlyContinue'; " +
+		"Invoke-WebRequest -UseBasicParsing -Uri " + PowerShellString(url) + " -OutFile $env:TEMP\\" + archive +
+		"; " +
+		"New-Item -ItemType Directory -Force -Path " + dir + " | Out-Null; " +
+		"tar.exe -xzf $env:TEMP\\" + archive + " -C " + dir + " --strip-components 1; " +
+		"if ($LASTEXITCODE -ne 0) { throw 'extracting containerd failed' }; " +
+		"& (Join-Path " + dir + " 'containerd.exe') config default | " +
+		"Out-File -Encoding ascii -FilePath (Join-Path " + dir + " 'config.toml'); " +
+		"& (Join-Path " + dir + " 'containerd.exe') --register-service; " +
+		"if ($LASTEXITCODE -ne 0) { throw 'registering the containerd service failed' }; " +
+		"Remove-Item $env:TEMP\\" + archive + " }; " +
+		"Start-Service containerd"
+}
+
+// SetupContainerRuntime installs containerd on the Windows VM when the nodes run containerd. Docker comes with the
+// Windows images with containers.
+func SetupContainerRuntime(vm WindowsVM) error {
+	return vm.handle().setupContainerRuntime()
+}
+
+// setupContainerRuntime implements SetupContainerRuntime
+func (w *windowsVM) setupContainerRuntime() error {
+	if ContainerRuntime != ContainerdRuntime {
+		return nil
+	}
+	if _, err := w.ensureWindowsFeature("Containers"); err != nil {
+		return err
+	}
+	if _, err := w.appendToPath(containerdDir); err != nil {
+		return err
+	}
+	if _, stderr, err := w.Run(PowerShellScript(installContainerdScript()), true); err != nil {
+		return fmt.Errorf("error installing containerd %s: %v, %s", containerdVersion, err, stderr)
+	}
+	return nil
+}
+
+// writeContainerRuntimeEvents writes the latest events logged by the container runtime of the Windows VM to the
+// given local file. Both Docker and containerd log to the Application event log under the name of their service.
+func writeContainerRuntimeEvents(vm WindowsVM, path string) error {
+	stdout, stderr, err := vm.Run(PowerShellScript(fmt.Sprintf("Get-WinEvent -FilterHashtable "+
+		"@{LogName = 'Application'; ProviderName = '%s'} -MaxEvents %d -ErrorAction SilentlyContinue | "+
+		"Sort-Object TimeCreated | Format-List TimeCreated,LevelDisplayName,Message | Out-String -Width 4096",
+		ContainerRuntime, maxContainerRuntimeEvents)), true)
+	if err != nil {
+		return fmt.Errorf("error getting the %s events: %v, %s", ContainerRuntime, err, stderr)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create %s: %v", filepath.Dir(path), err)
+	}
+	return ioutil.WriteFile(path, []byte(stdout), 0644)
+}
@@ -0,0 +1,27 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestContainerRuntimeFromEnv tests that the nodes run Docker by default and that unknown runtimes are rejected
+func TestContainerRuntimeFromEnv(t *testing.T) {
+	defer os.Setenv(containerRuntimeEnvVar, os.Getenv(containerRuntimeEnvVar))
+	os.Unsetenv(containerRuntimeEnvVar)
+	runtime, err := containerRuntimeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DockerRuntime, runtime)
+
+	os.Setenv(containerRuntimeEnvVar, "Containerd")
+	runtime, err = containerRuntimeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ContainerdRuntime, runtime)
+
+	os.Setenv(containerRuntimeEnvVar, "cri-o")
+	_, err = containerRuntimeFromEnv()
+	assert.Error(t, err)
+}
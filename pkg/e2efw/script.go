@@ -0,0 +1,124 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// remoteScriptsDir is the directory the scripts run by RunPowerShellScriptFile are uploaded to on the VM, each in its
+// own subdirectory that is removed once the script is done
+const remoteScriptsDir = "C:\\Temp\\scripts"
+
+// parameterNameRegex matches the arguments that are the names of script parameters, e.g. -Server or -Force:, which are
+// passed to the script as is instead of as strings
+var parameterNameRegex = regexp.MustCompile(`^-[A-Za-z_][A-Za-z0-9_]*:?$`)
+
+// ScriptError is the error of a PowerShell script run by RunPowerShellScriptFile that exited with a non-zero code or
+// threw a terminating error
+type ScriptError struct {
+	// Script is the local path of the script
+	Script string
+	// ExitCode is the code the script exited with, or 1 if it threw a terminating error
+	ExitCode int
+	// Stderr is the error output of the script, which holds the message of the terminating error if any
+	Stderr string
+}
+
+func (e *ScriptError) Error() string {
+	msg := fmt.Sprintf("script %s exited with code %d", e.Script, e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// RunPowerShellScriptFile uploads the given local .ps1 script to the Windows VM, runs it with the given arguments and
+// removes it, returning its stdout and stderr. The arguments that are parameter names, e.g. -Server, are passed as
+// is and the others as strings. The script is run over ssh if overSSH is set, which is needed by the scripts starting
+// background processes, and over WinRM otherwise. A *ScriptError is returned if the script exits with a non-zero code
+// or throws a terminating error.
+func RunPowerShellScriptFile(vm WindowsVM, scriptPath string, args []string, overSSH bool) (stdout string,
+	stderr string, err error) {
+	return vm.handle().runPowerShellScriptFile(scriptPath, args, overSSH)
+}
+
+// runPowerShellScriptFile implements RunPowerShellScriptFile
+func (w *windowsVM) runPowerShellScriptFile(scriptPath string, args []string, overSSH bool) (stdout string,
+	stderr string, err error) {
+	_, span := startSpan(suiteCtx, "run script", w.hostAttribute(), attribute.String("script", scriptPath))
+	defer func() { tracing.End(span, err) }()
+
+	if err := validateScriptArgs(scriptPath, args); err != nil {
+		return "", "", err
+	}
+	if overSSH {
+		if err := w.requireSSH("RunPowerShellScriptFile over ssh"); err != nil {
+			return "", "", err
+		}
+	}
+
+	remoteDir := remoteScriptDir(scriptPath, time.Now())
+	if err := w.copyFile(scriptPath, remoteDir); err != nil {
+		return "", "", fmt.Errorf("error uploading script %s: %v", scriptPath, err)
+	}
+	defer func() {
+		if _, cleanupStderr, cleanupErr := w.run(PowerShellScript("Remove-Item -Recurse -Force -LiteralPath "+
+			PowerShellString(remoteDir)), true); cleanupErr != nil {
+			log.Printf("unable to remove script directory %s from %s: %v, %s", remoteDir,
+				w.GetCredentials().GetIPAddress(), cleanupErr, cleanupStderr)
+		}
+	}()
+
+	cmd := PowerShellScript(scriptCommand(remotepath.WindowsPathJoin(remoteDir, filepath.Base(scriptPath)), args))
+	if overSSH {
+		stdout, stderr, err = w.runOverSSHWithStderr(cmd, true)
+	} else {
+		stdout, stderr, err = w.run(cmd, true)
+	}
+	if exitErr, ok := err.(*exitCodeError); ok {
+		return stdout, stderr, &ScriptError{Script: scriptPath, ExitCode: exitErr.exitCode, Stderr: stderr}
+	}
+	if err != nil {
+		return stdout, stderr, fmt.Errorf("error running script %s: %v", scriptPath, err)
+	}
+	return stdout, stderr, nil
+}
+
+// validateScriptArgs returns an error if the given script is not a PowerShell script
+func validateScriptArgs(scriptPath string, args []string) error {
+	if !strings.EqualFold(filepath.Ext(scriptPath), ".ps1") {
+		return fmt.Errorf("%s is not a PowerShell script, expected a .ps1 file", scriptPath)
+	}
+	return nil
+}
+
+// remoteScriptDir returns the directory the given script is uploaded to on the VM at the given time, unique to the
+// run so that concurrent runs of the same script do not remove each other's copy
+func remoteScriptDir(scriptPath string, now time.Time) string {
+	name := strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath))
+	return remotepath.WindowsPathJoin(remoteScriptsDir, fmt.Sprintf("%s-%d", name, now.UnixNano()))
+}
+
+// scriptCommand returns the PowerShell command running the given remote script with the given arguments. The script is
+// invoked with & rather than -File, which would pass every argument as a string, so its exit code is returned
+// explicitly, and a terminating error is written to stderr and mapped to exit code 1 as -File does.
+func scriptCommand(remotePath string, args []string) string {
+	invocation := "& " + PowerShellString(remotePath)
+	for _, arg := range args {
+		if parameterNameRegex.MatchString(arg) {
+			invocation += " " + arg
+		} else {
+			invocation += " " + PowerShellString(arg)
+		}
+	}
+	return "$global:LASTEXITCODE = 0; try { " + invocation + "; exit $LASTEXITCODE } " +
+		"catch { [Console]::Error.WriteLine(($_ | Out-String).Trim()); exit 1 }"
+}
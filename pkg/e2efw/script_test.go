@@ -0,0 +1,75 @@
+package e2efw
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScriptCommand tests that the script is invoked with its parameter names as is and its other arguments quoted,
+// and that its exit code and terminating errors are returned
+func TestScriptCommand(t *testing.T) {
+	const wrapper = "$global:LASTEXITCODE = 0; try { %s; exit $LASTEXITCODE } " +
+		"catch { [Console]::Error.WriteLine(($_ | Out-String).Trim()); exit 1 }"
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "no arguments",
+			expected: "& 'C:\\Temp\\scripts\\wget-1\\wget.ps1'",
+		},
+		{
+			name:     "named parameters",
+			args:     []string{"-server", "https://10.0.0.1:22623", "-retries:", "3"},
+			expected: "& 'C:\\Temp\\scripts\\wget-1\\wget.ps1' -server 'https://10.0.0.1:22623' -retries: '3'",
+		},
+		{
+			name:     "arguments needing quotes",
+			args:     []string{"it's", "a b", "-5", "-", "--output"},
+			expected: "& 'C:\\Temp\\scripts\\wget-1\\wget.ps1' 'it''s' 'a b' '-5' '-' '--output'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, fmt.Sprintf(wrapper, test.expected),
+				scriptCommand("C:\\Temp\\scripts\\wget-1\\wget.ps1", test.args))
+		})
+	}
+}
+
+// TestValidateScriptArgs tests that only PowerShell scripts and arguments that can be quoted are accepted
+func TestValidateScriptArgs(t *testing.T) {
+	assert.NoError(t, validateScriptArgs("powershell/wget-ignore-cert.ps1", []string{"-server", "it's"}))
+	assert.NoError(t, validateScriptArgs("SETUP.PS1", nil))
+	assert.Error(t, validateScriptArgs("setup.sh", nil))
+	assert.Error(t, validateScriptArgs("setup", nil))
+	assert.NoError(t, validateScriptArgs("setup.ps1", []string{"say \"hi\""}))
+}
+
+// TestRemoteScriptDir tests that each run of a script is uploaded to its own directory
+func TestRemoteScriptDir(t *testing.T) {
+	now := time.Unix(1600000000, 5)
+	assert.Equal(t, "C:\\Temp\\scripts\\wget-ignore-cert-1600000000000000005",
+		remoteScriptDir("powershell/wget-ignore-cert.ps1", now))
+	assert.NotEqual(t, remoteScriptDir("wget.ps1", now), remoteScriptDir("wget.ps1", now.Add(time.Nanosecond)))
+}
+
+// TestScriptError tests that the error of a failed script holds its exit code and error output
+func TestScriptError(t *testing.T) {
+	err := &ScriptError{Script: "setup.ps1", ExitCode: 3}
+	assert.EqualError(t, err, "script setup.ps1 exited with code 3")
+	err.Stderr = "Cannot find path 'C:\\k' because it does not exist.\r\n"
+	assert.EqualError(t, err,
+		"script setup.ps1 exited with code 3: Cannot find path 'C:\\k' because it does not exist.")
+}
+
+// TestRunPowerShellScriptFileValidation tests that invalid scripts are rejected before anything is uploaded
+func TestRunPowerShellScriptFileValidation(t *testing.T) {
+	w := &windowsVM{}
+	_, _, err := w.runPowerShellScriptFile("setup.sh", nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package e2efw
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sessionDir is the directory of ARTIFACT_DIR the session recordings of the Windows VMs are written to
+	sessionDir = "sessions"
+	// maxSessionOutput is the size of the beginning of the stdout and of the stderr of a command kept in its session
+	// recording
+	maxSessionOutput = 16 * 1024
+	// maxSessionCommandLength is the length of the beginning of a command kept in its session recording, e.g. of a
+	// script copying a file inline
+	maxSessionCommandLength = 64 * 1024
+	// redacted replaces the password of the Windows VM in the session recordings
+	redacted = "<redacted>"
+)
+
+// SessionEntry is a command of the session recording of a Windows VM, as read by `wni replay`
+type SessionEntry struct {
+	// Seq is the number of the command in the session, from 1, in the order the commands completed
+	Seq int `json:"seq"`
+	// Transport is the transport the command was run over, WinRM or ssh
+	Transport string `json:"transport"`
+	// Host is the IP address of the Windows VM the command was run on
+	Host string `json:"host"`
+	// Context is the context of the run, with the Windows build of the VM
+	Context RunContext `json:"context"`
+	// Command is the command, with the PowerShell scripts decoded and their whitespace kept
+	Command string `json:"command"`
+	// Start is when the command was started
+	Start time.Time `json:"start"`
+	// Seconds is the duration of the command
+	Seconds float64 `json:"seconds"`
+	// ExitCode is the exit code of the command, -1 if it did not complete
+	ExitCode int `json:"exitCode"`
+	// Error is the error running the command, empty if it completed
+	Error string `json:"error,omitempty"`
+	// Stdout and Stderr are the beginning of the outputs of the command, Stdout holding both for the commands of
+	// RunOverSSH
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	// Truncated is true if the command or its outputs were cut to their beginning
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// sessionFile is the session recording of a Windows VM being written
+type sessionFile struct {
+	file    *os.File
+	encoder *json.Encoder
+	// seq is the number of commands recorded so far
+	seq int
+}
+
+// sessionRecorder writes the session recordings of the Windows VMs, a JSON line per command, as the commands complete
+// so that the recording of a run which is killed is kept
+type sessionRecorder struct {
+	// lock guards the files, as the commands run concurrently on the VMs
+	lock sync.Mutex
+	// files are the recordings of each host, opened by their first command
+	files map[string]*sessionFile
+	// failed are the hosts whose recording could not be written, which are not retried
+	failed map[string]bool
+	// closed is set once the recordings are closed, after which the commands are not recorded
+	closed bool
+}
+
+// sessions records the sessions of the Windows VMs of the test suite
+var sessions = &sessionRecorder{files: make(map[string]*sessionFile), failed: make(map[string]bool)}
+
+// record appends the given command to the session recording of its host in the given directory, with the given
+// secrets redacted. Nothing is recorded without a directory.
+func (r *sessionRecorder) record(dir string, entry SessionEntry, secrets ...string) {
+	if dir == "" {
+		return
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		entry.Command = strings.Replace(entry.Command, secret, redacted, -1)
+		entry.Error = strings.Replace(entry.Error, secret, redacted, -1)
+		entry.Stdout = strings.Replace(entry.Stdout, secret, redacted, -1)
+		entry.Stderr = strings.Replace(entry.Stderr, secret, redacted, -1)
+	}
+	if len(entry.Command) > maxSessionCommandLength {
+		entry.Command = entry.Command[:maxSessionCommandLength]
+		entry.Truncated = true
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed || r.failed[entry.Host] {
+		return
+	}
+	session, ok := r.files[entry.Host]
+	if !ok {
+		var err error
+		if session, err = createSessionFile(dir, entry.Host); err != nil {
+			log.Printf("unable to record the session of %s: %v", entry.Host, err)
+			r.failed[entry.Host] = true
+			return
+		}
+		r.files[entry.Host] = session
+	}
+	session.seq++
+	entry.Seq = session.seq
+	if err := session.encoder.Encode(entry); err != nil {
+		log.Printf("unable to record the session of %s: %v", entry.Host, err)
+		r.failed[entry.Host] = true
+	}
+}
+
+// createSessionFile creates the session recording of the given host in the given directory
+func createSessionFile(dir, host string) (*sessionFile, error) {
+	dir = filepath.Join(dir, sessionDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	name := strings.NewReplacer(":", "-", "/", "-", "\\", "-").Replace(host)
+	if name == "" {
+		name = "unknown"
+	}
+	file, err := os.Create(filepath.Join(dir, name+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	return &sessionFile{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// close closes the session recordings, the commands run afterwards are not recorded
+func (r *sessionRecorder) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for host, session := range r.files {
+		if err := session.file.Close(); err != nil {
+			log.Printf("error closing the session recording of %s: %v", host, err)
+		}
+	}
+	r.files = make(map[string]*sessionFile)
+	r.closed = true
+}
+
+// closeSessions closes the session recordings of the Windows VMs
+func closeSessions() {
+	sessions.close()
+}
+
+// sessionOutput keeps the beginning of an output of a command for its session recording. It is safe for concurrent
+// writes, e.g. of the stdout and stderr of a ssh session sharing it.
+type sessionOutput struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+	// truncated is set once the output exceeds maxSessionOutput
+	truncated bool
+}
+
+// Write keeps the given output until maxSessionOutput is reached. It never fails, so that a command is not
+// interrupted by its recording.
+func (o *sessionOutput) Write(p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if left := maxSessionOutput - o.buf.Len(); len(p) > left {
+		o.buf.Write(p[:left])
+		o.truncated = true
+	} else {
+		o.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// contents returns the output kept, and whether it was truncated
+func (o *sessionOutput) contents() (string, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.buf.String(), o.truncated
+}
+
+// commandResult is the outcome of a remote command recorded by recordCommand
+type commandResult struct {
+	// exitCode is the exit code of the command, ignored if err is set
+	exitCode int
+	// err is the error running the command
+	err error
+	// stdout and stderr are the outputs of the command, nil if it has none
+	stdout, stderr *sessionOutput
+}
+
+// failed returns true if the command failed or exited with a non-zero code
+func (c commandResult) failed() bool {
+	return c.err != nil || c.exitCode != 0
+}
+
+// sessionEntry returns the session entry of the given command run over the given transport on the given host from the
+// given start until now with this result
+func (c commandResult) sessionEntry(transport, host, cmd string, start time.Time) SessionEntry {
+	entry := SessionEntry{Transport: transport, Host: host, Command: decodeScript(cmd), Start: start,
+		Seconds: time.Since(start).Seconds(), ExitCode: c.exitCode}
+	if c.err != nil {
+		entry.ExitCode = -1
+		entry.Error = c.err.Error()
+	}
+	for _, output := range []struct {
+		from *sessionOutput
+		to   *string
+	}{{c.stdout, &entry.Stdout}, {c.stderr, &entry.Stderr}} {
+		if output.from == nil {
+			continue
+		}
+		var truncated bool
+		*output.to, truncated = output.from.contents()
+		entry.Truncated = entry.Truncated || truncated
+	}
+	return entry
+}
+
+// sshCommandResult returns the result of a command run over ssh which returned the given error, the exit code of the
+// command being carried by the error of the session
+func sshCommandResult(err error, stdout, stderr *sessionOutput) commandResult {
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return commandResult{exitCode: exitErr.ExitStatus(), stdout: stdout, stderr: stderr}
+	}
+	return commandResult{err: err, stdout: stdout, stderr: stderr}
+}
@@ -0,0 +1,103 @@
+package e2efw
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSessionRecorder tests that the commands are recorded a JSON line per command in the session of their host,
+// numbered, with the password redacted and the scripts decoded
+func TestSessionRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recorder := &sessionRecorder{files: make(map[string]*sessionFile), failed: make(map[string]bool)}
+	script := "$password = 'hunter2'\nGet-Service kubelet"
+	stdout := &sessionOutput{}
+	fmt.Fprint(stdout, "Running kubelet hunter2")
+	start := time.Now().Add(-time.Second)
+	recorder.record(dir, commandResult{stdout: stdout}.sessionEntry("WinRM", "10.0.0.1",
+		remotePowerShellCmdPrefix+PowerShellScript(script), start), "hunter2")
+	recorder.record(dir, commandResult{exitCode: 1}.sessionEntry("ssh", "10.0.0.1", "exit 1", start), "hunter2")
+	recorder.record(dir, commandResult{err: fmt.Errorf("EOF")}.sessionEntry("ssh", "10.0.0.2", "hostname", start))
+	recorder.close()
+	// The commands run once the recordings are closed are not recorded
+	recorder.record(dir, commandResult{}.sessionEntry("ssh", "10.0.0.1", "hostname", start))
+
+	entries := readSession(t, filepath.Join(dir, sessionDir, "10.0.0.1.jsonl"))
+	require.Len(t, entries, 2)
+	assert.Equal(t, 1, entries[0].Seq)
+	assert.Equal(t, "WinRM", entries[0].Transport)
+	assert.Equal(t, "$password = '"+redacted+"'\nGet-Service kubelet", entries[0].Command)
+	assert.Equal(t, "Running kubelet "+redacted, entries[0].Stdout)
+	assert.Equal(t, 0, entries[0].ExitCode)
+	assert.True(t, entries[0].Start.Equal(start))
+	assert.GreaterOrEqual(t, entries[0].Seconds, 1.0)
+	assert.Equal(t, 2, entries[1].Seq)
+	assert.Equal(t, 1, entries[1].ExitCode)
+
+	entries = readSession(t, filepath.Join(dir, sessionDir, "10.0.0.2.jsonl"))
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].Seq)
+	assert.Equal(t, -1, entries[0].ExitCode)
+	assert.Equal(t, "EOF", entries[0].Error)
+}
+
+// TestSessionRecorderTruncates tests that the long commands and outputs are cut to their beginning
+func TestSessionRecorderTruncates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recorder := &sessionRecorder{files: make(map[string]*sessionFile), failed: make(map[string]bool)}
+	stdout := &sessionOutput{}
+	for i := 0; i < 3; i++ {
+		fmt.Fprint(stdout, strings.Repeat("a", maxSessionOutput/2+1))
+	}
+	recorder.record(dir, commandResult{stdout: stdout}.sessionEntry("ssh", "10.0.0.1", "type log", time.Now()))
+	recorder.record(dir, commandResult{}.sessionEntry("ssh", "10.0.0.1",
+		strings.Repeat("b", maxSessionCommandLength+1), time.Now()))
+	recorder.close()
+
+	entries := readSession(t, filepath.Join(dir, sessionDir, "10.0.0.1.jsonl"))
+	require.Len(t, entries, 2)
+	assert.Len(t, entries[0].Stdout, maxSessionOutput)
+	assert.True(t, entries[0].Truncated)
+	assert.Len(t, entries[1].Command, maxSessionCommandLength)
+	assert.True(t, entries[1].Truncated)
+}
+
+// TestSessionRecorderWithoutDir tests that nothing is recorded without an artifact directory
+func TestSessionRecorderWithoutDir(t *testing.T) {
+	recorder := &sessionRecorder{files: make(map[string]*sessionFile), failed: make(map[string]bool)}
+	recorder.record("", commandResult{}.sessionEntry("ssh", "10.0.0.1", "hostname", time.Now()))
+	assert.Empty(t, recorder.files)
+}
+
+// readSession returns the entries of the given session recording
+func readSession(t *testing.T, path string) []SessionEntry {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var entries []SessionEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry SessionEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
@@ -0,0 +1,63 @@
+package e2efw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// setupStep is a step of the setup of a Windows VM, run once the steps it depends on succeeded
+type setupStep struct {
+	// name describes the step in the errors
+	name string
+	// after are the names of the steps the step depends on, which must come before it in the list of steps
+	after []string
+	// run runs the step
+	run func() error
+}
+
+// runSetupSteps runs the given steps concurrently, each one as soon as the steps it depends on succeeded, so that the
+// independent WinRM operations of the setup of a VM, each run in its own shell, overlap. The steps depending on a
+// failed step are not run. The failures are returned in the order of the steps, nil if all the steps succeeded.
+func runSetupSteps(op string, steps []setupStep) error {
+	done := make(map[string]chan struct{}, len(steps))
+	index := make(map[string]int, len(steps))
+	errs := make([]error, len(steps))
+	for i, step := range steps {
+		if _, ok := done[step.name]; ok {
+			return fmt.Errorf("%s: duplicate step %s", op, step.name)
+		}
+		// Requiring the dependencies to come first rules out cycles
+		for _, dependency := range step.after {
+			if _, ok := done[dependency]; !ok {
+				return fmt.Errorf("%s: step %s depends on %s, which does not come before it", op, step.name,
+					dependency)
+			}
+		}
+		done[step.name] = make(chan struct{})
+		index[step.name] = i
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(steps))
+	for i := range steps {
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[steps[i].name])
+			for _, dependency := range steps[i].after {
+				<-done[dependency]
+				if errs[index[dependency]] != nil {
+					errs[i] = fmt.Errorf("%s skipped, %s failed", steps[i].name, dependency)
+					return
+				}
+			}
+			errs[i] = steps[i].run()
+		}(i)
+	}
+	wg.Wait()
+
+	failures := NewMultiError(op)
+	for _, err := range errs {
+		failures.Append(err)
+	}
+	return failures.ErrorOrNil()
+}
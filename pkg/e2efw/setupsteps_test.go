@@ -0,0 +1,70 @@
+package e2efw
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunSetupSteps tests that the independent steps run concurrently and the dependent ones after their dependencies
+func TestRunSetupSteps(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	step := func(name string, delay time.Duration) func() error {
+		return func() error {
+			time.Sleep(delay)
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	start := time.Now()
+	require.NoError(t, runSetupSteps("setup", []setupStep{
+		{name: "a", run: step("a", 200*time.Millisecond)},
+		{name: "b", run: step("b", 200*time.Millisecond)},
+		{name: "c", after: []string{"a", "b"}, run: step("c", 0)},
+		{name: "d", after: []string{"c"}, run: step("d", 0)},
+	}))
+	// a and b overlap
+	assert.Less(t, int64(time.Since(start)), int64(400*time.Millisecond))
+	require.Len(t, order, 4)
+	assert.ElementsMatch(t, []string{"a", "b"}, order[:2])
+	assert.Equal(t, []string{"c", "d"}, order[2:])
+}
+
+// TestRunSetupStepsFailure tests that the steps depending on a failed step are skipped and the others run
+func TestRunSetupStepsFailure(t *testing.T) {
+	ran := make(chan string, 4)
+	ok := func(name string) func() error { return func() error { ran <- name; return nil } }
+	err := runSetupSteps("setup", []setupStep{
+		{name: "a", run: func() error { return fmt.Errorf("a failed") }},
+		{name: "b", run: ok("b")},
+		{name: "c", after: []string{"a"}, run: ok("c")},
+		{name: "d", after: []string{"c"}, run: ok("d")},
+	})
+	close(ran)
+	require.Error(t, err)
+	var names []string
+	for name := range ran {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"b"}, names)
+	failures := Failures(err)
+	require.Len(t, failures, 3)
+	assert.EqualError(t, failures[0], "a failed")
+	assert.EqualError(t, failures[1], "c skipped, a failed")
+	assert.EqualError(t, failures[2], "d skipped, c failed")
+}
+
+// TestRunSetupStepsOrder tests that the steps must come after their dependencies
+func TestRunSetupStepsOrder(t *testing.T) {
+	run := func() error { return nil }
+	assert.Error(t, runSetupSteps("setup", []setupStep{{name: "a", after: []string{"b"}, run: run},
+		{name: "b", run: run}}))
+	assert.Error(t, runSetupSteps("setup", []setupStep{{name: "a", run: run}, {name: "a", run: run}}))
+}
@@ -0,0 +1,411 @@
+package e2efw
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// networkShapeEnvVar is the environment variable holding the shape of the simulated degraded link between the test
+	// runner and the VMs, e.g. latency=100ms,jitter=20ms,bandwidth=10Mbps
+	networkShapeEnvVar = "E2E_NETWORK_SHAPE"
+	// shapedChunkSize is the maximum size of the chunks of data delayed by a shaped connection
+	shapedChunkSize = 32 * 1024
+	// shapedQueueLength is the number of chunks in flight in each direction of a shaped connection
+	shapedQueueLength = 64
+	// dialTimeout is the timeout of the connections to the VMs
+	dialTimeout = 30 * time.Second
+)
+
+// errShapedConnClosed is returned by the operations on a closed shaped connection
+var errShapedConnClosed = errors.New("use of closed shaped connection")
+
+// bandwidthUnits are the units of the bandwidth of a NetworkShape, from the largest one
+var bandwidthUnits = []struct {
+	// suffix is the suffix of the unit
+	suffix string
+	// bps is the number of bits per second of the unit
+	bps int64
+}{{"Gbps", 1000000000}, {"Mbps", 1000000}, {"Kbps", 1000}, {"bps", 1}}
+
+// NetworkShape describes a constrained link between the test runner and a VM, like the uplink of an edge site, to test
+// the behavior of the bootstrap and of the retries and timeouts over it
+type NetworkShape struct {
+	// Latency is the delay added to the data in each direction, the round trip time growing by twice the latency
+	Latency time.Duration
+	// Jitter is the maximum random variation of the latency. It is not larger than the latency.
+	Jitter time.Duration
+	// Bandwidth is the bandwidth of the link in each direction in bits per second, shared by all the connections to
+	// the VM. 0 is unlimited.
+	Bandwidth int64
+}
+
+// ParseNetworkShape parses a network shape given as comma separated latency=<duration>, jitter=<duration> and
+// bandwidth=<number><bps|Kbps|Mbps|Gbps> fields, e.g. latency=100ms,jitter=20ms,bandwidth=10Mbps
+func ParseNetworkShape(spec string) (*NetworkShape, error) {
+	shape := &NetworkShape{}
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid network shape field %q, expected <name>=<value>", field)
+		}
+		var err error
+		switch parts[0] {
+		case "latency":
+			shape.Latency, err = parseShapeDuration(parts[1])
+		case "jitter":
+			shape.Jitter, err = parseShapeDuration(parts[1])
+		case "bandwidth":
+			shape.Bandwidth, err = parseBandwidth(parts[1])
+		default:
+			return nil, fmt.Errorf("unknown network shape field %q, expected latency, jitter or bandwidth", parts[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if shape.Jitter > shape.Latency {
+		return nil, fmt.Errorf("jitter %v is larger than latency %v", shape.Jitter, shape.Latency)
+	}
+	return shape, nil
+}
+
+// parseShapeDuration parses a non-negative duration of a network shape
+func parseShapeDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return duration, nil
+}
+
+// parseBandwidth parses a bandwidth in bits per second given with its unit, e.g. 10Mbps
+func parseBandwidth(value string) (int64, error) {
+	for _, unit := range bandwidthUnits {
+		if !strings.HasSuffix(value, unit.suffix) {
+			continue
+		}
+		number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+		if err != nil || number <= 0 || int64(number*float64(unit.bps)) <= 0 {
+			break
+		}
+		return int64(number * float64(unit.bps)), nil
+	}
+	return 0, fmt.Errorf("invalid bandwidth %q, expected a positive number of bps, Kbps, Mbps or Gbps", value)
+}
+
+// String returns the network shape in the format of ParseNetworkShape
+func (s *NetworkShape) String() string {
+	spec := fmt.Sprintf("latency=%v,jitter=%v", s.Latency, s.Jitter)
+	if s.Bandwidth <= 0 {
+		return spec
+	}
+	for _, unit := range bandwidthUnits {
+		if s.Bandwidth%unit.bps == 0 {
+			return spec + ",bandwidth=" + strconv.FormatInt(s.Bandwidth/unit.bps, 10) + unit.suffix
+		}
+	}
+	return spec
+}
+
+// direction is a direction of the link between the test runner and a VM
+type direction int
+
+const (
+	// upstream is the direction from the test runner to the VM
+	upstream direction = iota
+	// downstream is the direction from the VM to the test runner
+	downstream
+)
+
+// link is the simulated link between the test runner and a Windows VM, which delays and throttles the data of the
+// connections to the VM according to its shape. The bandwidth is shared by all the connections to the VM. A nil link
+// or a link without shape does not alter the connections.
+type link struct {
+	// lock guards the fields of the link
+	lock sync.Mutex
+	// shape is the shape of the link, nil if the connections are not altered
+	shape *NetworkShape
+	// free is the time each direction of the link is done transmitting the data scheduled so far
+	free [2]time.Time
+	// random picks the jitter of the chunks
+	random *rand.Rand
+}
+
+// newLink returns a link with the given shape, which can be nil
+func newLink(shape *NetworkShape) *link {
+	return &link{shape: shape, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// setShape changes the shape of the link. The connections dialed without a shape are not altered.
+func (l *link) setShape(shape *NetworkShape) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.shape = shape
+}
+
+// currentShape returns the shape of the link, nil if the connections are not altered
+func (l *link) currentShape() *NetworkShape {
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.shape
+}
+
+// schedule reserves the given direction of the link to transmit n bytes, and returns the time the transmission ends
+// and the time the data is delivered to the other end
+func (l *link) schedule(dir direction, n int) (time.Time, time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if l.shape == nil {
+		return now, now
+	}
+	sent := now
+	if l.free[dir].After(sent) {
+		sent = l.free[dir]
+	}
+	if l.shape.Bandwidth > 0 {
+		sent = sent.Add(time.Duration(int64(n) * 8 * int64(time.Second) / l.shape.Bandwidth))
+	}
+	l.free[dir] = sent
+	delay := l.shape.Latency
+	if l.shape.Jitter > 0 {
+		delay += time.Duration(l.random.Int63n(2*int64(l.shape.Jitter)+1)) - l.shape.Jitter
+	}
+	return sent, sent.Add(delay)
+}
+
+// dial connects to the given address over the link
+func (l *link) dial(network, addr string) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if l.currentShape() == nil {
+		return conn, nil
+	}
+	return newShapedConn(conn, l), nil
+}
+
+// chunk is data in flight on a shaped connection
+type chunk struct {
+	// data is the data of the chunk
+	data []byte
+	// err is the error returned by the underlying connection instead of data
+	err error
+	// delivered is the time the chunk reaches the other end
+	delivered time.Time
+}
+
+// shapedConn is a connection delayed and throttled by a link. The writes return once their data is transmitted on the
+// link, and the data is written to the underlying connection once delivered. The data read from the underlying
+// connection is returned once delivered. The data in flight is pipelined like on a real link, so that the throughput
+// is limited by the bandwidth rather than the latency. The data in flight when the connection is closed is dropped.
+// The deadlines apply to the underlying connection.
+type shapedConn struct {
+	net.Conn
+	// link is the link delaying and throttling the connection
+	link *link
+	// outgoing is the data written, waiting to be delivered to the underlying connection
+	outgoing chan chunk
+	// incoming is the data read from the underlying connection, waiting to be delivered to the reader
+	incoming chan chunk
+	// done is closed once the connection is closed
+	done chan struct{}
+	// closeOnce ensures that the connection is closed once
+	closeOnce sync.Once
+	// writeLock serializes the writes
+	writeLock sync.Mutex
+	// lastWrite is the delivery time of the last chunk written, so that the chunks are delivered in order despite the
+	// jitter. It is guarded by writeLock.
+	lastWrite time.Time
+	// readLock serializes the reads
+	readLock sync.Mutex
+	// pending is the delivered data not read yet. It is guarded by readLock.
+	pending []byte
+	// readErr is the error ending the data read from the underlying connection. It is guarded by readLock.
+	readErr error
+	// errLock guards writeErr
+	errLock sync.Mutex
+	// writeErr is the error returned by the underlying connection when writing the data delivered to it
+	writeErr error
+}
+
+// newShapedConn returns the given connection delayed and throttled by the link
+func newShapedConn(conn net.Conn, l *link) *shapedConn {
+	c := &shapedConn{
+		Conn:     conn,
+		link:     l,
+		outgoing: make(chan chunk, shapedQueueLength),
+		incoming: make(chan chunk, shapedQueueLength),
+		done:     make(chan struct{}),
+	}
+	go c.deliverOutgoing()
+	go c.receiveIncoming()
+	return c
+}
+
+// Write transmits the data on the link, blocking while it is being transmitted
+func (c *shapedConn) Write(p []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	written := 0
+	for written < len(p) {
+		if err := c.getWriteErr(); err != nil {
+			return written, err
+		}
+		// The select below picks at random between a free slot and a closed connection
+		select {
+		case <-c.done:
+			return written, errShapedConnClosed
+		default:
+		}
+		n := len(p) - written
+		if n > shapedChunkSize {
+			n = shapedChunkSize
+		}
+		sent, delivered := c.link.schedule(upstream, n)
+		if delivered.Before(c.lastWrite) {
+			delivered = c.lastWrite
+		}
+		c.lastWrite = delivered
+		// Blocking the writer while the data is transmitted throttles it to the bandwidth of the link
+		if !c.sleepUntil(sent) {
+			return written, errShapedConnClosed
+		}
+		select {
+		case c.outgoing <- chunk{data: append([]byte(nil), p[written:written+n]...), delivered: delivered}:
+		case <-c.done:
+			return written, errShapedConnClosed
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// deliverOutgoing writes the data written to the underlying connection once it is delivered
+func (c *shapedConn) deliverOutgoing() {
+	for {
+		select {
+		case out := <-c.outgoing:
+			if !c.sleepUntil(out.delivered) {
+				return
+			}
+			// The data written after an error is dropped, the error being returned by the next write
+			if c.getWriteErr() != nil {
+				continue
+			}
+			if _, err := c.Conn.Write(out.data); err != nil {
+				c.errLock.Lock()
+				c.writeErr = err
+				c.errLock.Unlock()
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// getWriteErr returns the error returned by the underlying connection when writing, if any
+func (c *shapedConn) getWriteErr() error {
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	return c.writeErr
+}
+
+// receiveIncoming reads the data of the underlying connection and schedules its delivery to the reader
+func (c *shapedConn) receiveIncoming() {
+	var lastDelivered time.Time
+	for {
+		buf := make([]byte, shapedChunkSize)
+		n, err := c.Conn.Read(buf)
+		in := chunk{data: buf[:n], err: err, delivered: lastDelivered}
+		if n > 0 {
+			_, in.delivered = c.link.schedule(downstream, n)
+			if in.delivered.Before(lastDelivered) {
+				in.delivered = lastDelivered
+			}
+			lastDelivered = in.delivered
+		}
+		select {
+		case c.incoming <- in:
+		case <-c.done:
+			return
+		}
+		// A timeout of the underlying connection does not end it
+		if err != nil && !isTimeout(err) {
+			return
+		}
+	}
+}
+
+// Read returns the data delivered from the underlying connection, blocking until some is delivered
+func (c *shapedConn) Read(p []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		select {
+		case in := <-c.incoming:
+			if !c.sleepUntil(in.delivered) {
+				return 0, errShapedConnClosed
+			}
+			c.pending = in.data
+			if isTimeout(in.err) {
+				if len(in.data) == 0 {
+					return 0, in.err
+				}
+			} else if in.err != nil {
+				c.readErr = in.err
+			}
+		case <-c.done:
+			return 0, errShapedConnClosed
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Close closes the connection, dropping the data in flight
+func (c *shapedConn) Close() error {
+	err := errShapedConnClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// sleepUntil waits until the given time and returns true, or returns false if the connection is closed first
+func (c *shapedConn) sleepUntil(t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// isTimeout returns true if the error is a timeout of a connection
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,138 @@
+package e2efw
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseNetworkShape tests the parsing of the network shapes and their formatting
+func TestParseNetworkShape(t *testing.T) {
+	tests := []struct {
+		spec      string
+		expected  *NetworkShape
+		formatted string
+	}{
+		{"latency=100ms,jitter=20ms,bandwidth=10Mbps", &NetworkShape{100 * time.Millisecond, 20 * time.Millisecond,
+			10000000}, "latency=100ms,jitter=20ms,bandwidth=10Mbps"},
+		{"bandwidth=1.5Mbps", &NetworkShape{Bandwidth: 1500000}, "latency=0s,jitter=0s,bandwidth=1500Kbps"},
+		{"latency=1s, bandwidth=512bps", &NetworkShape{Latency: time.Second, Bandwidth: 512},
+			"latency=1s,jitter=0s,bandwidth=512bps"},
+		{"latency=50ms", &NetworkShape{Latency: 50 * time.Millisecond}, "latency=50ms,jitter=0s"},
+		{"jitter=20ms", nil, ""},
+		{"latency=-1s", nil, ""},
+		{"bandwidth=10MB", nil, ""},
+		{"bandwidth=0Mbps", nil, ""},
+		{"loss=1%", nil, ""},
+		{"latency", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			shape, err := ParseNetworkShape(tt.spec)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, shape)
+			assert.Equal(t, tt.formatted, shape.String())
+			reparsed, err := ParseNetworkShape(shape.String())
+			require.NoError(t, err)
+			assert.Equal(t, shape, reparsed)
+		})
+	}
+}
+
+// TestLinkSchedule tests that the data is transmitted at the bandwidth of the link and delivered after its latency
+func TestLinkSchedule(t *testing.T) {
+	l := newLink(&NetworkShape{Latency: time.Second, Bandwidth: 8000000})
+	start := time.Now()
+	sent, delivered := l.schedule(upstream, 100000)
+	assert.WithinDuration(t, start.Add(100*time.Millisecond), sent, 10*time.Millisecond)
+	assert.Equal(t, sent.Add(time.Second), delivered)
+	// The link is busy transmitting the first data, the other direction is not
+	sent, _ = l.schedule(upstream, 100000)
+	assert.WithinDuration(t, start.Add(200*time.Millisecond), sent, 10*time.Millisecond)
+	sent, _ = l.schedule(downstream, 100000)
+	assert.WithinDuration(t, start.Add(100*time.Millisecond), sent, 10*time.Millisecond)
+
+	l.setShape(&NetworkShape{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond})
+	for i := 0; i < 100; i++ {
+		sent, delivered = l.schedule(downstream, 100)
+		assert.True(t, delivered.Sub(sent) >= 50*time.Millisecond && delivered.Sub(sent) <= 150*time.Millisecond,
+			"delay %v out of the jitter", delivered.Sub(sent))
+	}
+}
+
+// echoServer starts a server echoing the data of its connections and returns its address
+func echoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+// TestShapedConn tests that the data of a shaped connection is delayed by the latency, throttled to the bandwidth and
+// delivered intact and in order despite the jitter
+func TestShapedConn(t *testing.T) {
+	listener := echoServer(t)
+	defer listener.Close()
+
+	unshaped, err := (*link)(nil).dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, ok := unshaped.(*shapedConn)
+	assert.False(t, ok, "a connection over a nil link should not be shaped")
+	unshaped.Close()
+
+	l := newLink(&NetworkShape{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, Bandwidth: 8000000})
+	conn, err := l.dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// A round trip takes twice the latency
+	start := time.Now()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+	assert.True(t, time.Since(start) >= 80*time.Millisecond, "round trip took %v", time.Since(start))
+
+	// 200KB take 200ms at 1MB/s in each direction, the transfers in both directions overlapping
+	data := make([]byte, 200000)
+	rand.Read(data)
+	start = time.Now()
+	go conn.Write(data)
+	received := make([]byte, len(data))
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, received), "data was altered")
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 200*time.Millisecond, "transfer took %v", elapsed)
+	assert.True(t, elapsed < 2*time.Second, "transfer took %v, the link is not pipelined", elapsed)
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Write([]byte("closed"))
+	assert.Error(t, err)
+	_, err = conn.Read(buf)
+	assert.Error(t, err)
+	assert.Error(t, conn.Close())
+}
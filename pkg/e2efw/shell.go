@@ -0,0 +1,30 @@
+package e2efw
+
+import (
+	"io"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// Shell opens an interactive PowerShell session on the Windows VM over SSH attached to the given input and outputs. If
+// the input is a terminal, it is put in raw mode for the duration of the session and a PTY of the same size is
+// requested, so that line editing, tab completion and key combinations like Ctrl+C are handled by the remote shell.
+// Shell returns once the session ends.
+func Shell(vm WindowsVM, stdin *os.File, stdout, stderr io.Writer) error {
+	return vm.handle().shell(stdin, stdout, stderr)
+}
+
+// shell implements Shell
+func (w *windowsVM) shell(stdin *os.File, stdout, stderr io.Writer) error {
+	if err := w.requireSSH("Shell"); err != nil {
+		return err
+	}
+	if err := w.checkCommand("ssh", types.ShellCmd); err != nil {
+		return err
+	}
+	return w.ssh().withSession(func(session *ssh.Session) error {
+		return types.RunShell(session, stdin, stdout, stderr)
+	})
+}
@@ -0,0 +1,293 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+)
+
+const (
+	// smbShareEnvVar is the environment variable holding the UNC path of an existing SMB share the tests can exchange
+	// fixtures with the VMs over, like an Azure Files or FSx share, e.g. \\account.file.core.windows.net\fixtures
+	smbShareEnvVar = "E2E_SMB_SHARE"
+	// smbUsernameEnvVar is the environment variable holding the user the SMB share is accessed as
+	smbUsernameEnvVar = "E2E_SMB_USERNAME"
+	// smbPasswordEnvVar is the environment variable holding the password of the SMB share user
+	smbPasswordEnvVar = "E2E_SMB_PASSWORD"
+	// smbPort is the port SMB is served on
+	smbPort = 445
+	// remoteSMBCredentialsDir is the directory the SMB credentials are copied to on the VM, to be read and removed by
+	// the mount script, so that the password is not part of the commands, which are logged and traced
+	remoteSMBCredentialsDir = "C:\\Temp\\smb"
+)
+
+// driveRegex matches the drive letters SMB shares can be mounted on, e.g. Z:
+var driveRegex = regexp.MustCompile(`^[A-Za-z]:$`)
+
+// SMBShare is an SMB share the tests exchange large fixtures with the Windows VMs over, as an alternative to copying
+// them over SFTP. It is either an existing share, like an Azure Files or FSx share, or a directory shared by a VM.
+type SMBShare struct {
+	// Server is the host name or IP address of the SMB server
+	Server string
+	// Name is the name of the share on the server
+	Name string
+	// Username is the user the share is accessed as, e.g. AZURE\account for an Azure Files share
+	Username string
+	// Password is the password of the user
+	Password string
+}
+
+// ParseSMBShare returns the share with the given UNC path, \\server\share or //server/share
+func ParseSMBShare(path string) (*SMBShare, error) {
+	parts := strings.Split(strings.TrimLeft(strings.ReplaceAll(path, "/", "\\"), "\\"), "\\")
+	if !strings.HasPrefix(path, "\\\\") && !strings.HasPrefix(path, "//") || len(parts) != 2 || parts[0] == "" ||
+		parts[1] == "" {
+		return nil, fmt.Errorf("invalid SMB share %q, expected \\\\server\\share", path)
+	}
+	return &SMBShare{Server: parts[0], Name: parts[1]}, nil
+}
+
+// SMBShareFromEnv returns the share given by the E2E_SMB_SHARE, E2E_SMB_USERNAME and E2E_SMB_PASSWORD environment
+// variables, or nil if no share is given
+func SMBShareFromEnv() (*SMBShare, error) {
+	path := os.Getenv(smbShareEnvVar)
+	if path == "" {
+		return nil, nil
+	}
+	share, err := ParseSMBShare(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", smbShareEnvVar, err)
+	}
+	share.Username = os.Getenv(smbUsernameEnvVar)
+	share.Password = os.Getenv(smbPasswordEnvVar)
+	return share, nil
+}
+
+// UNCPath returns the UNC path of the share, \\server\share
+func (s *SMBShare) UNCPath() string {
+	return "\\\\" + s.Server + "\\" + s.Name
+}
+
+// validate returns an error if the share cannot be passed to mount.cifs
+func (s *SMBShare) validate() error {
+	for _, value := range []string{s.Server, s.Name, s.Username, s.Password} {
+		if strings.Contains(value, "\n") {
+			return fmt.Errorf("SMB share fields cannot contain new lines")
+		}
+	}
+	if s.Server == "" || s.Name == "" || s.Username == "" {
+		return fmt.Errorf("SMB share %s requires a server, a name and a user", s.UNCPath())
+	}
+	return nil
+}
+
+// MountSMBShare mounts the share on the given drive of the Windows VM, e.g. Z:, replacing the share mounted on it if
+// any. The share is mounted globally and persistently, so that it is visible to all the sessions, the services and the
+// containers, and survives reboots.
+func MountSMBShare(vm WindowsVM, share *SMBShare, drive string) error {
+	return vm.handle().mountSMBShare(share, drive)
+}
+
+// mountSMBShare implements MountSMBShare
+func (w *windowsVM) mountSMBShare(share *SMBShare, drive string) error {
+	if err := share.validate(); err != nil {
+		return err
+	}
+	if !driveRegex.MatchString(drive) {
+		return fmt.Errorf("invalid drive %q, expected a drive letter like Z:", drive)
+	}
+	credentials, err := ioutil.TempFile("", "smb-credentials-")
+	if err != nil {
+		return fmt.Errorf("error creating SMB credentials file: %v", err)
+	}
+	defer os.Remove(credentials.Name())
+	_, err = credentials.WriteString(share.Username + "\n" + share.Password + "\n")
+	if closeErr := credentials.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing SMB credentials file: %v", err)
+	}
+	if err = w.CopyFile(credentials.Name(), remoteSMBCredentialsDir); err != nil {
+		return fmt.Errorf("error copying SMB credentials: %v", err)
+	}
+
+	remoteCredentials := remotepath.WindowsPathJoin(remoteSMBCredentialsDir, filepath.Base(credentials.Name()))
+	_, stderr, err := w.Run(PowerShellScript(mountSMBShareScript(share, drive, remoteCredentials)), true)
+	if err != nil {
+		return fmt.Errorf("error mounting %s on %s: %v, %s", share.UNCPath(), drive, err, stderr)
+	}
+	log.Printf("mounted %s on %s of %s", share.UNCPath(), drive, w.GetCredentials().GetIPAddress())
+	return nil
+}
+
+// mountSMBShareScript returns the PowerShell script mounting the share on the drive with the user and password read
+// from the given credentials file, which is removed before mounting
+func mountSMBShareScript(share *SMBShare, drive, remoteCredentials string) string {
+	credentials := PowerShellString(remoteCredentials)
+	localPath := PowerShellString(strings.ToUpper(drive))
+	return "$lines = Get-Content -Path " + credentials + "; Remove-Item -Path " + credentials + "; " +
+		"$password = ConvertTo-SecureString $lines[1] -AsPlainText -Force; " +
+		"$credential = New-Object System.Management.Automation.PSCredential($lines[0], $password); " +
+		"if (Get-SmbGlobalMapping -LocalPath " + localPath + " -ErrorAction SilentlyContinue) { " +
+		"Remove-SmbGlobalMapping -LocalPath " + localPath + " -Force }; " +
+		"New-SmbGlobalMapping -LocalPath " + localPath + " -RemotePath " + PowerShellString(share.UNCPath()) +
+		" -Credential $credential -Persistent $true | Out-Null"
+}
+
+// UnmountSMBShare unmounts the share mounted on the given drive of the Windows VM, if any
+func UnmountSMBShare(vm WindowsVM, drive string) error {
+	return vm.handle().unmountSMBShare(drive)
+}
+
+// unmountSMBShare implements UnmountSMBShare
+func (w *windowsVM) unmountSMBShare(drive string) error {
+	if !driveRegex.MatchString(drive) {
+		return fmt.Errorf("invalid drive %q, expected a drive letter like Z:", drive)
+	}
+	localPath := PowerShellString(strings.ToUpper(drive))
+	_, stderr, err := w.Run(PowerShellScript("if (Get-SmbGlobalMapping -LocalPath "+localPath+
+		" -ErrorAction SilentlyContinue) { Remove-SmbGlobalMapping -LocalPath "+localPath+" -Force }"), true)
+	if err != nil {
+		return fmt.Errorf("error unmounting %s: %v, %s", drive, err, stderr)
+	}
+	return nil
+}
+
+// ShareDirectory shares the given directory of the Windows VM, creating it if needed, with the given share name and
+// returns the share, accessed as the VM user. The SMB port is usually not reachable from the test host, so the share
+// is to be mounted through a Tunnel to port 445 of the VM.
+func ShareDirectory(vm WindowsVM, name, remoteDir string) (*SMBShare, error) {
+	return vm.handle().shareDirectory(name, remoteDir)
+}
+
+// shareDirectory implements ShareDirectory
+func (w *windowsVM) shareDirectory(name, remoteDir string) (*SMBShare, error) {
+	share := &SMBShare{Server: w.GetCredentials().GetIPAddress(), Name: name, Username: w.userName(),
+		Password: w.GetCredentials().GetPassword()}
+	if err := share.validate(); err != nil {
+		return nil, err
+	}
+	_, stderr, err := w.Run(PowerShellScript(shareDirectoryScript(name, remoteDir, share.Username)), true)
+	if err != nil {
+		return nil, fmt.Errorf("error sharing %s as %s: %v, %s", remoteDir, name, err, stderr)
+	}
+	return share, nil
+}
+
+// shareDirectoryScript returns the PowerShell script sharing the directory with full access for the given user,
+// unless it is already shared, and opening the SMB port in the firewall
+func shareDirectoryScript(name, remoteDir, user string) string {
+	quotedName := PowerShellString(name)
+	dir := PowerShellString(remoteDir)
+	return "New-Item -ItemType Directory -Force -Path " + dir + " | Out-Null; " +
+		"if (-not (Get-SmbShare -Name " + quotedName + " -ErrorAction SilentlyContinue)) { " +
+		"New-SmbShare -Name " + quotedName + " -Path " + dir + " -FullAccess " + PowerShellString(user) +
+		" | Out-Null }; " +
+		"Enable-NetFirewallRule -Name 'FPS-SMB-In-TCP'"
+}
+
+// UnshareDirectory stops sharing the share with the given name on the Windows VM, if it exists. The directory is kept.
+func UnshareDirectory(vm WindowsVM, name string) error {
+	return vm.handle().unshareDirectory(name)
+}
+
+// unshareDirectory implements UnshareDirectory
+func (w *windowsVM) unshareDirectory(name string) error {
+	if strings.Contains(name, "\"") {
+		return fmt.Errorf("share name cannot contain double quotes: %s", name)
+	}
+	quotedName := PowerShellString(name)
+	_, stderr, err := w.Run(PowerShellScript("if (Get-SmbShare -Name "+quotedName+
+		" -ErrorAction SilentlyContinue) { Remove-SmbShare -Name "+quotedName+" -Force }"), true)
+	if err != nil {
+		return fmt.Errorf("error removing share %s: %v, %s", name, err, stderr)
+	}
+	return nil
+}
+
+// MountSMBShareLocally mounts the share on the given mount point of the test host with mount.cifs, which requires root
+// privileges and the cifs-utils package. The share is reached at the given host:port address, e.g. the local address
+// of a Tunnel to port 445 of a VM sharing a directory, or at its server on port 445 if the address is empty. Only
+// Linux test hosts are supported.
+func MountSMBShareLocally(share *SMBShare, mountPoint, address string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("mounting SMB shares on the test host requires mount.cifs, which is not available on %s",
+			runtime.GOOS)
+	}
+	if err := share.validate(); err != nil {
+		return err
+	}
+	if address == "" {
+		address = net.JoinHostPort(share.Server, strconv.Itoa(smbPort))
+	}
+	credentials, err := ioutil.TempFile("", "smb-credentials-")
+	if err != nil {
+		return fmt.Errorf("error creating SMB credentials file: %v", err)
+	}
+	defer os.Remove(credentials.Name())
+	_, err = credentials.WriteString(cifsCredentials(share))
+	if closeErr := credentials.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing SMB credentials file: %v", err)
+	}
+	options, err := cifsMountOptions(credentials.Name(), address)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(mountPoint, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating mount point %s: %v", mountPoint, err)
+	}
+	out, err := exec.Command("mount", "-t", "cifs", "//"+share.Server+"/"+share.Name, mountPoint, "-o",
+		options).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error mounting %s on %s: %v, %s", share.UNCPath(), mountPoint, err, out)
+	}
+	return nil
+}
+
+// UnmountSMBShareLocally unmounts the share mounted on the given mount point of the test host
+func UnmountSMBShareLocally(mountPoint string) error {
+	if out, err := exec.Command("umount", mountPoint).CombinedOutput(); err != nil {
+		return fmt.Errorf("error unmounting %s: %v, %s", mountPoint, err, out)
+	}
+	return nil
+}
+
+// cifsCredentials returns the contents of the mount.cifs credentials file of the share. A user given as
+// DOMAIN\user is split into its domain and user, as mount.cifs expects.
+func cifsCredentials(share *SMBShare) string {
+	contents := ""
+	username := share.Username
+	if i := strings.Index(username, "\\"); i >= 0 {
+		contents += "domain=" + username[:i] + "\n"
+		username = username[i+1:]
+	}
+	return contents + "username=" + username + "\npassword=" + share.Password + "\n"
+}
+
+// cifsMountOptions returns the mount.cifs options reaching the share at the given host:port address with the
+// credentials of the given file. The files are owned by the current user, so that the tests can write them.
+func cifsMountOptions(credentialsFile, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid SMB address %s: %v", address, err)
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid SMB port %s: %v", port, err)
+	}
+	return fmt.Sprintf("credentials=%s,ip=%s,port=%s,vers=3.0,uid=%d,gid=%d", credentialsFile, host, port,
+		os.Getuid(), os.Getgid()), nil
+}
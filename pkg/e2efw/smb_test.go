@@ -0,0 +1,81 @@
+package e2efw
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSMBShare tests the parsing of the UNC paths of the SMB shares
+func TestParseSMBShare(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected *SMBShare
+	}{
+		{"\\\\account.file.core.windows.net\\fixtures", &SMBShare{Server: "account.file.core.windows.net",
+			Name: "fixtures"}},
+		{"//10.0.0.5/fixtures", &SMBShare{Server: "10.0.0.5", Name: "fixtures"}},
+		{"\\\\server", nil},
+		{"\\\\server\\share\\dir", nil},
+		{"server\\share", nil},
+		{"\\\\\\share", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			share, err := ParseSMBShare(tt.path)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, share)
+		})
+	}
+	share, err := ParseSMBShare("//10.0.0.5/fixtures")
+	require.NoError(t, err)
+	assert.Equal(t, "\\\\10.0.0.5\\fixtures", share.UNCPath())
+}
+
+// TestSMBShareValidate tests that the shares which cannot be passed to PowerShell or mount.cifs are rejected
+func TestSMBShareValidate(t *testing.T) {
+	assert.NoError(t, (&SMBShare{Server: "server", Name: "share", Username: "AZURE\\account",
+		Password: "p@ss'word"}).validate())
+	assert.Error(t, (&SMBShare{Server: "server", Name: "share"}).validate(), "a user is required")
+	assert.NoError(t, (&SMBShare{Server: "server", Name: "share", Username: "user", Password: "pass\"word"}).validate())
+	assert.Error(t, (&SMBShare{Server: "server", Name: "share", Username: "user", Password: "pass\nword"}).validate())
+}
+
+// TestMountSMBShareScript tests that the password is read from the credentials file and not passed in the script
+func TestMountSMBShareScript(t *testing.T) {
+	share := &SMBShare{Server: "server", Name: "o'share", Username: "user", Password: "secret"}
+	script := mountSMBShareScript(share, "z:", "C:\\Temp\\smb\\smb-credentials-1")
+	assert.NotContains(t, script, "secret")
+	assert.Contains(t, script, "Get-Content -Path 'C:\\Temp\\smb\\smb-credentials-1'; "+
+		"Remove-Item -Path 'C:\\Temp\\smb\\smb-credentials-1'")
+	assert.Contains(t, script, "New-SmbGlobalMapping -LocalPath 'Z:' -RemotePath '\\\\server\\o''share'")
+}
+
+// TestCIFSCredentials tests that the domain of the user is split from it for mount.cifs
+func TestCIFSCredentials(t *testing.T) {
+	assert.Equal(t, "domain=AZURE\nusername=account\npassword=secret\n",
+		cifsCredentials(&SMBShare{Username: "AZURE\\account", Password: "secret"}))
+	assert.Equal(t, "username=Administrator\npassword=secret\n",
+		cifsCredentials(&SMBShare{Username: "Administrator", Password: "secret"}))
+}
+
+// TestCIFSMountOptions tests that the share is reached at the given address, e.g. the local end of a tunnel
+func TestCIFSMountOptions(t *testing.T) {
+	options, err := cifsMountOptions("/tmp/credentials", "127.0.0.1:40445")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("credentials=/tmp/credentials,ip=127.0.0.1,port=40445,vers=3.0,uid=%d,gid=%d",
+		os.Getuid(), os.Getgid()), options)
+
+	_, err = cifsMountOptions("/tmp/credentials", "127.0.0.1")
+	assert.Error(t, err, "the port is required")
+	_, err = cifsMountOptions("/tmp/credentials", "127.0.0.1:smb")
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package e2efw
+
+import (
+	"errors"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+)
+
+// errSnapshotsUnsupported is returned when the cloud provider of the Windows VM does not support snapshots
+var errSnapshotsUnsupported = errors.New("snapshots are only supported on AWS")
+
+// Snapshot takes a snapshot with the given name of the EBS volumes of the Windows VM, as `wni aws snapshot` does. The
+// VM is stopped while the snapshots are created, so that they are consistent, and is ready again once it returns.
+func Snapshot(vm WindowsVM, name string) error {
+	return vm.handle().snapshot(name)
+}
+
+// snapshot implements Snapshot
+func (w *windowsVM) snapshot(name string) error {
+	snapshotter, ok := w.cloudProvider.(cloudprovider.Snapshotter)
+	if !ok {
+		return errSnapshotsUnsupported
+	}
+	err := snapshotter.Snapshot(w.GetCredentials().GetInstanceId(), name)
+	if err == nil {
+		w.lock.Lock()
+		w.snapshots = append(w.snapshots, name)
+		w.lock.Unlock()
+	}
+	// The VM is restarted with a new public IP even if the snapshots failed
+	if reconnectErr := w.reconnect(); err == nil {
+		err = reconnectErr
+	}
+	return err
+}
+
+// RestoreSnapshot rolls the Windows VM back to its snapshot with the given name, as `wni aws restore-snapshot` does,
+// and waits for it to be ready. The volumes of the VM are replaced by new volumes created from their snapshots.
+func RestoreSnapshot(vm WindowsVM, name string) error {
+	return vm.handle().restoreSnapshot(name)
+}
+
+// restoreSnapshot implements RestoreSnapshot
+func (w *windowsVM) restoreSnapshot(name string) error {
+	snapshotter, ok := w.cloudProvider.(cloudprovider.Snapshotter)
+	if !ok {
+		return errSnapshotsUnsupported
+	}
+	err := snapshotter.RestoreSnapshot(w.GetCredentials().GetInstanceId(), name)
+	if reconnectErr := w.reconnect(); err == nil {
+		err = reconnectErr
+	}
+	return err
+}
+
+// deleteSnapshots deletes the snapshots taken of the Windows VM. The other snapshots are still deleted when one fails,
+// and a *MultiError lists the snapshots which could not be deleted.
+func (w *windowsVM) deleteSnapshots() error {
+	snapshotter, ok := w.cloudProvider.(cloudprovider.Snapshotter)
+	if !ok {
+		return nil
+	}
+	instanceID := w.GetCredentials().GetInstanceId()
+	errs := NewMultiError("delete snapshots of " + instanceID)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, name := range w.snapshots {
+		if err := snapshotter.DeleteSnapshot(instanceID, name); err != nil {
+			errs.Appendf("snapshot %s: %v", name, err)
+		}
+	}
+	w.snapshots = nil
+	return errs.ErrorOrNil()
+}
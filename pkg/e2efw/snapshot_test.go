@@ -0,0 +1,48 @@
+package e2efw
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSnapshotCloud is a cloud provider recording the snapshots deleted, which fails to delete the given snapshot
+type fakeSnapshotCloud struct {
+	fakeCloud
+	// failing is the name of the snapshot which cannot be deleted
+	failing string
+	// deleted are the names of the snapshots deleted
+	deleted []string
+}
+
+func (c *fakeSnapshotCloud) Snapshot(string, string) error        { return nil }
+func (c *fakeSnapshotCloud) RestoreSnapshot(string, string) error { return nil }
+
+func (c *fakeSnapshotCloud) DeleteSnapshot(instanceID, name string) error {
+	if name == c.failing {
+		return fmt.Errorf("snapshot %s of %s is in use", name, instanceID)
+	}
+	c.deleted = append(c.deleted, name)
+	return nil
+}
+
+// TestDeleteSnapshots tests that the snapshots taken of a Windows VM are deleted through the cloud provider, and that
+// the failures do not prevent the other snapshots from being deleted
+func TestDeleteSnapshots(t *testing.T) {
+	cloud := &fakeSnapshotCloud{failing: "configured"}
+	vm := &windowsVM{cloudProvider: cloud, credentials: types.NewCredentials("i-0123", "10.0.0.1", "", ""),
+		snapshots: []string{"base", "configured", "upgraded"}}
+	err := vm.deleteSnapshots()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "snapshot configured: snapshot configured of i-0123 is in use")
+	assert.Equal(t, []string{"base", "upgraded"}, cloud.deleted)
+	assert.Empty(t, vm.snapshots)
+
+	// The cloud providers without snapshots have none to delete
+	vm = &windowsVM{cloudProvider: fakeCloud{}, credentials: types.NewCredentials("i-0123", "10.0.0.1", "", "")}
+	assert.NoError(t, vm.deleteSnapshots())
+	assert.Equal(t, errSnapshotsUnsupported, vm.snapshot("base"))
+}
@@ -0,0 +1,168 @@
+package e2efw
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshCAKeyEnvVar is the environment variable holding the path of the public key of an ssh certificate authority,
+	// in the authorized_keys format, which the OpenSSH server of the created VMs is configured to trust
+	sshCAKeyEnvVar = "E2E_SSH_CA_KEY"
+	// sshCertEnvVar is the environment variable holding the path of a user certificate signed by the ssh certificate
+	// authority, e.g. id_ed25519-cert.pub, which the tests authenticate over ssh with
+	sshCertEnvVar = "E2E_SSH_CERT"
+	// sshCertKeyEnvVar is the environment variable holding the path of the private key of the user certificate
+	sshCertKeyEnvVar = "E2E_SSH_CERT_KEY"
+	// trustedUserCAKeysFile is the file of the OpenSSH server configuration directory holding the trusted certificate
+	// authorities, relative to %ProgramData%
+	trustedUserCAKeysFile = "ssh\\trusted_user_ca_keys"
+)
+
+// sshCertAuthority is the ssh certificate authority of the run, nil if the Windows VMs are not accessed with
+// certificates
+var sshCertAuthority *sshCA
+
+// sshCA holds the ssh certificate authority trusted by the Windows VMs and the certificate the tests authenticate with
+type sshCA struct {
+	// key is the public key of the certificate authority, nil if the VMs are not configured to trust it, e.g. because
+	// they already do
+	key ssh.PublicKey
+	// signer authenticates with the user certificate, nil if the tests authenticate with the password only
+	signer ssh.Signer
+}
+
+// sshCAFromEnv returns the ssh certificate authority given by E2E_SSH_CA_KEY, E2E_SSH_CERT and E2E_SSH_CERT_KEY, nil if
+// none of them is set
+func sshCAFromEnv() (*sshCA, error) {
+	caKeyPath, certPath, keyPath := os.Getenv(sshCAKeyEnvVar), os.Getenv(sshCertEnvVar), os.Getenv(sshCertKeyEnvVar)
+	if caKeyPath == "" && certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	ca := &sshCA{}
+	if caKeyPath != "" {
+		data, err := ioutil.ReadFile(caKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", sshCAKeyEnvVar, err)
+		}
+		if ca.key, _, _, _, err = ssh.ParseAuthorizedKey(data); err != nil {
+			return nil, fmt.Errorf("invalid %s: error parsing the public key of the certificate authority: %v",
+				sshCAKeyEnvVar, err)
+		}
+	}
+	if certPath == "" && keyPath == "" {
+		return ca, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, fmt.Errorf("%s and %s have to be set together", sshCertEnvVar, sshCertKeyEnvVar)
+	}
+	signer, err := readCertSigner(certPath, keyPath, ca.key, user)
+	if err != nil {
+		return nil, err
+	}
+	ca.signer = signer
+	return ca, nil
+}
+
+// readCertSigner returns the signer authenticating as the given user with the certificate and private key at the
+// given paths, checking that the certificate is signed by the given certificate authority if not nil
+func readCertSigner(certPath, keyPath string, caKey ssh.PublicKey, userName string) (ssh.Signer, error) {
+	certData, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate: %v", err)
+	}
+	keyData, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the private key of certificate %s: %v", certPath, err)
+	}
+	signer, err := parseCertSigner(certData, keyData, caKey, userName, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate %s: %v", certPath, err)
+	}
+	return signer, nil
+}
+
+// parseCertSigner returns the signer authenticating as the given user with the given certificate, in the
+// authorized_keys format, and its private key. The certificate has to be a user certificate valid at the given time
+// for the user, and signed by the given certificate authority if not nil, as the OpenSSH server would otherwise
+// reject it with an error that does not say why.
+func parseCertSigner(certData, keyData []byte, caKey ssh.PublicKey, userName string, now time.Time) (ssh.Signer,
+	error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certData)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %v", err)
+	}
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a public key, not a certificate", publicKey.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("host certificate cannot authenticate users")
+	}
+	if caKey != nil && !bytes.Equal(cert.SignatureKey.Marshal(), caKey.Marshal()) {
+		return nil, fmt.Errorf("certificate is not signed by the certificate authority %s",
+			ssh.FingerprintSHA256(caKey))
+	}
+	// A certificate without principals is valid for any user
+	if len(cert.ValidPrincipals) > 0 && !containsString(cert.ValidPrincipals, userName) {
+		return nil, fmt.Errorf("certificate is not valid for user %s, only for %s", userName,
+			strings.Join(cert.ValidPrincipals, ", "))
+	}
+	unix := uint64(now.Unix())
+	if unix < cert.ValidAfter {
+		return nil, fmt.Errorf("certificate is not valid before %s", time.Unix(int64(cert.ValidAfter), 0).UTC())
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore {
+		return nil, fmt.Errorf("certificate expired at %s", time.Unix(int64(cert.ValidBefore), 0).UTC())
+	}
+	key, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %v", err)
+	}
+	signer, err := ssh.NewCertSigner(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("private key does not match: %v", err)
+	}
+	return signer, nil
+}
+
+// authMethods returns the methods authenticating with the user certificate, none for a nil sshCA
+func (ca *sshCA) authMethods() []ssh.AuthMethod {
+	if ca == nil || ca.signer == nil {
+		return nil
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(ca.signer)}
+}
+
+// trustSSHCertAuthority configures the OpenSSH server of the Windows VM to trust the certificate authority, so that
+// the certificates it signed authenticate users. Nothing is done for a nil sshCA or if the VMs are not configured to
+// trust it.
+func (w *windowsVM) trustSSHCertAuthority(ca *sshCA) error {
+	if ca == nil || ca.key == nil {
+		return nil
+	}
+	if _, stderr, err := w.runOverWinRM(PowerShellScript(trustedUserCAScript(ca.key)), true); err != nil {
+		return fmt.Errorf("error configuring the trusted certificate authority: %v, %s", err, stderr)
+	}
+	return nil
+}
+
+// trustedUserCAScript returns the PowerShell script writing the given certificate authority to the trusted user CA
+// keys of the OpenSSH server, pointing the TrustedUserCAKeys option of sshd_config to them and restarting the server.
+// The option is written at the top of sshd_config, as the options following its Match blocks only apply to the
+// matched users.
+func trustedUserCAScript(caKey ssh.PublicKey) string {
+	return "$keys = Join-Path $env:ProgramData " + PowerShellString(trustedUserCAKeysFile) + "; " +
+		"Set-Content -Path $keys -Value " + PowerShellString(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caKey)))) +
+		" -Encoding ascii; " +
+		"$config = Join-Path $env:ProgramData 'ssh\\sshd_config'; " +
+		"$lines = @(Get-Content -Path $config | Where-Object { $_ -notmatch '^\\s*TrustedUserCAKeys\\s' }); " +
+		"Set-Content -Path $config -Value (@('TrustedUserCAKeys __PROGRAMDATA__/ssh/trusted_user_ca_keys') + $lines) " +
+		"-Encoding ascii; Restart-Service sshd"
+}
@@ -0,0 +1,95 @@
+package e2efw
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestCA returns the signer of a new ssh certificate authority
+func newTestCA(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+// signCert returns the given certificate of the given public key signed by the given certificate authority, in the
+// authorized_keys format
+func signCert(t *testing.T, ca ssh.Signer, authorizedKey []byte, cert ssh.Certificate) []byte {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	require.NoError(t, err)
+	cert.Key = publicKey
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return ssh.MarshalAuthorizedKey(&cert)
+}
+
+// TestParseCertSigner tests that the certificates the OpenSSH server would reject are reported before connecting
+func TestParseCertSigner(t *testing.T) {
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	privateKey, authorizedKey, err := generateKey()
+	require.NoError(t, err)
+	otherKey, _, err := generateKey()
+	require.NoError(t, err)
+	now := time.Unix(1600000000, 0)
+	valid := ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"Administrator"},
+		ValidAfter: uint64(now.Add(-time.Hour).Unix()), ValidBefore: uint64(now.Add(time.Hour).Unix())}
+
+	signer, err := parseCertSigner(signCert(t, ca, authorizedKey, valid), privateKey, ca.PublicKey(), user, now)
+	require.NoError(t, err)
+	cert, ok := signer.PublicKey().(*ssh.Certificate)
+	require.True(t, ok)
+	assert.Equal(t, []string{"Administrator"}, cert.ValidPrincipals)
+
+	anyUser := valid
+	anyUser.ValidPrincipals, anyUser.ValidBefore = nil, ssh.CertTimeInfinity
+	_, err = parseCertSigner(signCert(t, ca, authorizedKey, anyUser), privateKey, nil, "admin", now)
+	assert.NoError(t, err)
+
+	hostCert := valid
+	hostCert.CertType = ssh.HostCert
+	expired := valid
+	expired.ValidBefore = uint64(now.Unix())
+	notYetValid := valid
+	notYetValid.ValidAfter = uint64(now.Add(time.Minute).Unix())
+	for name, test := range map[string]struct {
+		cert       []byte
+		privateKey []byte
+		user       string
+	}{
+		"public key":          {authorizedKey, privateKey, user},
+		"host certificate":    {signCert(t, ca, authorizedKey, hostCert), privateKey, user},
+		"other CA":            {signCert(t, otherCA, authorizedKey, valid), privateKey, user},
+		"other user":          {signCert(t, ca, authorizedKey, valid), privateKey, "admin"},
+		"expired":             {signCert(t, ca, authorizedKey, expired), privateKey, user},
+		"not yet valid":       {signCert(t, ca, authorizedKey, notYetValid), privateKey, user},
+		"other private key":   {signCert(t, ca, authorizedKey, valid), otherKey, user},
+		"invalid private key": {signCert(t, ca, authorizedKey, valid), []byte("key"), user},
+	} {
+		_, err := parseCertSigner(test.cert, test.privateKey, ca.PublicKey(), test.user, now)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestSSHCAAuthMethods tests that the tests authenticate with the certificate only if one is given
+func TestSSHCAAuthMethods(t *testing.T) {
+	var none *sshCA
+	assert.Empty(t, none.authMethods())
+	assert.Empty(t, (&sshCA{key: newTestCA(t).PublicKey()}).authMethods())
+	assert.Len(t, (&sshCA{signer: newTestCA(t)}).authMethods(), 1)
+}
+
+// TestTrustedUserCAScript tests that the certificate authority is trusted ahead of the Match blocks of sshd_config
+func TestTrustedUserCAScript(t *testing.T) {
+	ca := newTestCA(t)
+	script := trustedUserCAScript(ca.PublicKey())
+	assert.Contains(t, script, "-Value '"+string(ssh.MarshalAuthorizedKey(ca.PublicKey())[:20]))
+	assert.Contains(t, script, "@('TrustedUserCAKeys __PROGRAMDATA__/ssh/trusted_user_ca_keys') + $lines")
+	assert.Contains(t, script, "Restart-Service sshd")
+}
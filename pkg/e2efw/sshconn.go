@@ -0,0 +1,167 @@
+package e2efw
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSessionOperation is the name the ssh sessions are recorded with in the flakiness report
+const sshSessionOperation = "ssh session"
+
+// sshConnection is the ssh connection to a Windows VM shared by the command sessions, the SFTP client and the port
+// forwards, instead of each of them opening their own sessions or connections. High session churn during parallel
+// tests otherwise runs into the MaxSessions limit of Windows OpenSSH, which rejects the extra sessions.
+// The connection is dialed on first use and redialed if it was lost, e.g. after a reboot of the VM.
+type sshConnection struct {
+	// host is the address of the VM, which the lost connections are reported with
+	host string
+	// dial opens a new connection to the VM
+	dial func() (*ssh.Client, error)
+	// sessions limits the number of sessions open at once to the ones given by E2E_REMOTE_CONCURRENCY
+	sessions semaphore
+	// lock guards client and ftp
+	lock sync.Mutex
+	// client is the current connection, nil until dialed or once closed
+	client *ssh.Client
+	// ftp is the SFTP client of the current connection, nil until first used
+	ftp *sftp.Client
+}
+
+// newSSHConnection returns a connection to the given host using the given dial function, which is not dialed until
+// first used
+func newSSHConnection(host string, dial func() (*ssh.Client, error)) *sshConnection {
+	return &sshConnection{host: host, dial: dial}
+}
+
+// getClient returns the current connection, dialing it if needed
+func (c *sshConnection) getClient() (*ssh.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.clientLocked()
+}
+
+// clientLocked returns the current connection, dialing it if needed. The lock must be held.
+func (c *sshConnection) clientLocked() (*ssh.Client, error) {
+	if c.client == nil {
+		client, err := c.dial()
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial to ssh server: %v", err)
+		}
+		c.client = client
+	}
+	return c.client, nil
+}
+
+// sftp returns the SFTP client shared by all the file transfers, which can be used concurrently
+func (c *sshConnection) sftp() (*sftp.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	client, err := c.clientLocked()
+	if err != nil {
+		return nil, err
+	}
+	if c.ftp == nil {
+		ftp, err := sftp.NewClient(client)
+		if err != nil {
+			return nil, fmt.Errorf("sftp client initialization failed: %v", err)
+		}
+		c.ftp = ftp
+	}
+	return c.ftp, nil
+}
+
+// withSession runs fn with a new session, waiting for a free session slot first. If the session cannot be opened
+// because the connection was lost, the connection is redialed once. The redials are recorded as retries of the ssh
+// session operation.
+func (c *sshConnection) withSession(fn func(*ssh.Session) error) error {
+	c.sessions.acquire(remoteConcurrency.SSHSessions)
+	defer c.sessions.release()
+
+	session, err := c.newSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return fn(session)
+}
+
+// newSession opens a new session, redialing the connection once if it was lost
+func (c *sshConnection) newSession() (session *ssh.Session, err error) {
+	attempts := 1
+	defer func() { RecordAttempts(sshSessionOperation, c.host, attempts, err) }()
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+	session, err = client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+	// A rejected session is reported by the server, the connection is fine
+	if _, ok := err.(*ssh.OpenChannelError); ok {
+		return nil, fmt.Errorf("error creating ssh session: %v", err)
+	}
+	log.Printf("ssh connection lost, reconnecting: %v", err)
+	attempts++
+	c.reset(client)
+	if client, err = c.getClient(); err != nil {
+		return nil, err
+	}
+	if session, err = client.NewSession(); err != nil {
+		return nil, fmt.Errorf("error creating ssh session: %v", err)
+	}
+	return session, nil
+}
+
+// Dial opens a connection to the given address from the VM over the ssh connection. The forwarded connections are
+// channels of the connection and not sessions, so they are not limited.
+func (c *sshConnection) Dial(network, addr string) (net.Conn, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
+
+// reconnect closes the current connection and dials a new one. The sessions, transfers and forwarded connections in
+// progress on the closed connection fail.
+func (c *sshConnection) reconnect() error {
+	c.close()
+	_, err := c.getClient()
+	return err
+}
+
+// reset closes the given connection if it is still the current one, so that the next use dials a new one
+func (c *sshConnection) reset(client *ssh.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == client {
+		c.closeLocked()
+	}
+}
+
+// close closes the current connection, if any
+func (c *sshConnection) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closeLocked()
+}
+
+// closeLocked drops the SFTP client and closes the connection, which ends the SFTP session. The SFTP client is not
+// closed itself, as closing it races with the transfers still writing to it from other goroutines. The lock must be
+// held.
+func (c *sshConnection) closeLocked() {
+	c.ftp = nil
+	if c.client != nil {
+		// Close the existing client to be on the safe side
+		if err := c.client.Close(); err != nil {
+			log.Printf("error closing ssh client connection: %v", err)
+		}
+		c.client = nil
+	}
+}
@@ -0,0 +1,191 @@
+package e2efw
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer is an ssh server echoing the commands run on it and serving SFTP, which rejects the sessions above the OpenSSH MaxSessions
+// default like Windows OpenSSH does
+type sshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	// lock guards the fields below
+	lock sync.Mutex
+	// conns are the open connections
+	conns []*ssh.ServerConn
+	// accepted is the number of connections accepted
+	accepted int
+	// sessions is the number of sessions open at once, per connection
+	sessions map[*ssh.ServerConn]int
+	// maxSessions is the highest number of sessions open at once on a connection
+	maxSessions int
+}
+
+// newSSHServer starts an ssh server on a free local port
+func newSSHServer(t *testing.T) *sshServer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &sshServer{listener: listener, config: config, sessions: make(map[*ssh.ServerConn]int)}
+	go s.serve()
+	return s
+}
+
+// serve accepts the connections until the listener is closed
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle serves the sessions of a connection
+func (s *sshServer) handle(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	s.lock.Lock()
+	s.accepted++
+	s.conns = append(s.conns, serverConn)
+	s.lock.Unlock()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		s.lock.Lock()
+		if s.sessions[serverConn] >= 10 {
+			s.lock.Unlock()
+			newChannel.Reject(ssh.Prohibited, "MaxSessions reached")
+			continue
+		}
+		s.sessions[serverConn]++
+		if s.sessions[serverConn] > s.maxSessions {
+			s.maxSessions = s.sessions[serverConn]
+		}
+		s.lock.Unlock()
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.exec(serverConn, channel, channelRequests)
+	}
+}
+
+// exec echoes the command of the session back and closes it
+func (s *sshServer) exec(conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() {
+		s.lock.Lock()
+		s.sessions[conn]--
+		s.lock.Unlock()
+		channel.Close()
+	}()
+	for request := range requests {
+		// The SFTP sessions are served from the local file system
+		if request.Type == "subsystem" && len(request.Payload) > 4 && string(request.Payload[4:]) == "sftp" {
+			request.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			if server, err := sftp.NewServer(channel); err == nil {
+				server.Serve()
+			}
+			return
+		}
+		if request.Type != "exec" || len(request.Payload) < 4 {
+			request.Reply(false, nil)
+			continue
+		}
+		request.Reply(true, nil)
+		// Keep the session open for a while, so that the sessions of concurrent commands overlap
+		time.Sleep(20 * time.Millisecond)
+		channel.Write(request.Payload[4:])
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, 0)
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// dial connects to the server
+func (s *sshServer) dial() (*ssh.Client, error) {
+	return ssh.Dial("tcp", s.listener.Addr().String(), &ssh.ClientConfig{
+		User:            "Administrator",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+// dropConnections closes the open connections from the server side, like a reboot of the VM
+func (s *sshServer) dropConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// TestSSHConnectionSessions tests that concurrent commands share a single connection without exceeding the session
+// limit of the server, and that the connection is redialed once it was lost
+func TestSSHConnectionSessions(t *testing.T) {
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{sshConn: newSSHConnection("127.0.0.1", server.dial)}
+	defer w.sshConn.close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := fmt.Sprintf("hostname %d", i)
+			out, err := w.runOverSSH(cmd, false)
+			if err == nil && out != cmd {
+				err = fmt.Errorf("unexpected output %q of %q", out, cmd)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	server.lock.Lock()
+	assert.Equal(t, 1, server.accepted, "the commands should share a single connection")
+	assert.True(t, server.maxSessions <= remoteConcurrency.SSHSessions, "%d sessions were open at once", server.maxSessions)
+	server.lock.Unlock()
+
+	// The connection is redialed once it was lost
+	server.dropConnections()
+	out, err := w.runOverSSH("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", out)
+	server.lock.Lock()
+	assert.Equal(t, 2, server.accepted)
+	server.lock.Unlock()
+}
@@ -0,0 +1,173 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+)
+
+const (
+	// transferBackendEnvVar is the environment variable selecting how the large files are copied to the Windows VMs:
+	// sftp, the default, copies them over the ssh connection, and s3://<bucket>/<prefix> stages them in the given S3
+	// bucket for the VMs to download them
+	transferBackendEnvVar = "E2E_TRANSFER_BACKEND"
+	// stagingThreshold is the size from which the files are staged, the smaller ones are copied over SFTP as staging
+	// them costs more than it saves
+	stagingThreshold = 64 * 1024 * 1024
+	// stagingURLExpiry is how long the VMs can download a staged file for
+	stagingURLExpiry = time.Hour
+	// stagingUploadConcurrency is the number of parts of a staged file uploaded in parallel
+	stagingUploadConcurrency = 8
+	// remoteStagingURLDir is the directory the presigned URLs of the staged files are copied to on the VM, to be read
+	// and removed by the download script, so that the URLs, which grant access to the files, are not part of the
+	// commands, which are logged and traced
+	remoteStagingURLDir = "C:\\Temp\\staging"
+)
+
+// transferStaging is the S3 bucket the large files are staged in for the Windows VMs to download them, nil if they are
+// copied over SFTP
+var transferStaging *stagingBucket
+
+// stagingBucket is an S3 bucket the large files are staged in, so that they are uploaded in parallel parts by the test
+// host and downloaded by the Windows VMs from S3, instead of going through a single SFTP stream to each VM
+type stagingBucket struct {
+	// name is the name of the bucket, which has to be in the region of the cluster
+	name string
+	// prefix is the prefix of the keys of the staged files, empty or ending with /
+	prefix string
+}
+
+// parseTransferBackend returns the staging bucket of the given transfer backend, nil for the sftp backend
+func parseTransferBackend(backend string) (*stagingBucket, error) {
+	if backend == "" || backend == "sftp" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(backend, "s3://") {
+		return nil, fmt.Errorf("invalid %s %q, expected sftp or s3://<bucket>/<prefix>", transferBackendEnvVar,
+			backend)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(backend, "s3://"), "/", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("invalid %s %q, no bucket given", transferBackendEnvVar, backend)
+	}
+	bucket := &stagingBucket{name: parts[0]}
+	if len(parts) == 2 && strings.Trim(parts[1], "/") != "" {
+		bucket.prefix = strings.Trim(parts[1], "/") + "/"
+	}
+	return bucket, nil
+}
+
+// transferBackendFromEnv returns the staging bucket given by E2E_TRANSFER_BACKEND, nil if the files are copied over
+// SFTP
+func transferBackendFromEnv() (*stagingBucket, error) {
+	return parseTransferBackend(strings.TrimSpace(os.Getenv(transferBackendEnvVar)))
+}
+
+// key returns the key the given file is staged at for the Windows VM of the given address, unique to the run and the
+// time of the transfer, so that the concurrent transfers of the same file to several VMs do not collide
+func (b *stagingBucket) key(filePath, address string, now time.Time) string {
+	return path.Join(b.prefix+"e2e-"+runID, fmt.Sprintf("%s-%d", address, now.UnixNano()), filepath.Base(filePath))
+}
+
+// shouldStage returns true if the given file is large enough to be staged, and the files are staged for the Windows VM
+func (w *windowsVM) shouldStage(filePath string) bool {
+	if transferStaging == nil {
+		return false
+	}
+	if _, ok := w.cloudProvider.(*aws.AwsProvider); !ok {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	return err == nil && info.Size() >= stagingThreshold
+}
+
+// stagedCopy copies the given file to the remote directory of the Windows VM through the staging bucket: the file is
+// uploaded in parallel parts, the VM downloads it with BITS from a presigned URL and verifies its checksum, and the
+// staged file is deleted whether the download succeeded or not
+func (w *windowsVM) stagedCopy(filePath, remoteDir string) error {
+	awsCloud := w.cloudProvider.(*aws.AwsProvider)
+	session, err := awssession.NewSession(awsCloud.EC2.Config.Copy())
+	if err != nil {
+		return fmt.Errorf("error creating the S3 session: %v", err)
+	}
+	client := s3.New(session)
+	checksum, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	proxy, err := downloadProxy()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening %s file to be transferred: %v", filePath, err)
+	}
+	defer f.Close()
+	key := transferStaging.key(filePath, w.GetCredentials().GetIPAddress(), time.Now())
+	location := "s3://" + transferStaging.name + "/" + key
+	start := time.Now()
+	uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+		u.Concurrency = stagingUploadConcurrency
+	})
+	if _, err = uploader.Upload(&s3manager.UploadInput{Bucket: awssdk.String(transferStaging.name),
+		Key: awssdk.String(key), Body: f}); err != nil {
+		return fmt.Errorf("error staging %s at %s: %v", filePath, location, err)
+	}
+	defer func() {
+		if _, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: awssdk.String(transferStaging.name),
+			Key: awssdk.String(key)}); err != nil {
+			log.Printf("error deleting staged file %s: %v", location, err)
+		}
+	}()
+	log.Printf("staged %s at %s in %v", filePath, location, time.Since(start).Round(time.Second))
+
+	request, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: awssdk.String(transferStaging.name),
+		Key: awssdk.String(key)})
+	stagedURL, err := request.Presign(stagingURLExpiry)
+	if err != nil {
+		return fmt.Errorf("error presigning %s: %v", location, err)
+	}
+	urlFile, err := ioutil.TempFile("", "staged-url-")
+	if err != nil {
+		return fmt.Errorf("error creating presigned URL file: %v", err)
+	}
+	defer os.Remove(urlFile.Name())
+	_, err = urlFile.WriteString(stagedURL)
+	if closeErr := urlFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing presigned URL file: %v", err)
+	}
+	if err = w.CopyFile(urlFile.Name(), remoteStagingURLDir); err != nil {
+		return fmt.Errorf("error copying presigned URL of %s: %v", location, err)
+	}
+
+	remoteURLFile := PowerShellString(remotepath.WindowsPathJoin(remoteStagingURLDir,
+		filepath.Base(urlFile.Name())))
+	remotePath := remotepath.WindowsPathJoin(remoteDir, filepath.Base(filePath))
+	script := "$stagedURL = (Get-Content -Raw -LiteralPath " + remoteURLFile + ").Trim(); " +
+		"Remove-Item -Force -LiteralPath " + remoteURLFile + "; " +
+		downloadScript("$stagedURL", remotePath, checksum, proxy, true)
+	start = time.Now()
+	if _, stderr, err := w.Run(PowerShellScript(script), true); err != nil {
+		return fmt.Errorf("error downloading %s to %s: %v, %s", location, remotePath, err, stderr)
+	}
+	log.Printf("downloaded %s to %s of %s in %v", location, remotePath, w.GetCredentials().GetIPAddress(),
+		time.Since(start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,84 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseTransferBackend tests the parsing of the transfer backends
+func TestParseTransferBackend(t *testing.T) {
+	tests := []struct {
+		backend  string
+		expected *stagingBucket
+		valid    bool
+	}{
+		{"", nil, true},
+		{"sftp", nil, true},
+		{"s3://e2e-staging", &stagingBucket{name: "e2e-staging"}, true},
+		{"s3://e2e-staging/", &stagingBucket{name: "e2e-staging"}, true},
+		{"s3://e2e-staging/windows/artifacts/", &stagingBucket{name: "e2e-staging", prefix: "windows/artifacts/"},
+			true},
+		{"s3://", nil, false},
+		{"s3:///prefix", nil, false},
+		{"https://e2e-staging.s3.amazonaws.com", nil, false},
+		{"azure://container", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			bucket, err := parseTransferBackend(tt.backend)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, bucket)
+		})
+	}
+}
+
+// TestStagingKey tests that the keys of the staged files are scoped by run, VM and transfer
+func TestStagingKey(t *testing.T) {
+	defer func(id string) { runID = id }(runID)
+	runID = "ci-1234"
+
+	now := time.Unix(1614592800, 0)
+	bucket := &stagingBucket{name: "e2e-staging", prefix: "windows/"}
+	assert.Equal(t, "windows/e2e-ci-1234/10.0.1.5-1614592800000000000/images.tar",
+		bucket.key("/tmp/bundle/images.tar", "10.0.1.5", now))
+	assert.NotEqual(t, bucket.key("/tmp/bundle/images.tar", "10.0.1.5", now),
+		bucket.key("/tmp/bundle/images.tar", "10.0.1.6", now))
+	assert.Equal(t, "e2e-ci-1234/10.0.1.5-1614592800000000000/images.tar",
+		(&stagingBucket{name: "e2e-staging"}).key("images.tar", "10.0.1.5", now))
+}
+
+// TestShouldStage tests that only the large files copied to the AWS VMs are staged, and only with a staging bucket
+func TestShouldStage(t *testing.T) {
+	defer func(bucket *stagingBucket) { transferStaging = bucket }(transferStaging)
+	dir, err := ioutil.TempDir("", "staging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	small := filepath.Join(dir, "small.txt")
+	require.NoError(t, ioutil.WriteFile(small, []byte("small"), 0644))
+	large := filepath.Join(dir, "large.tar")
+	file, err := os.Create(large)
+	require.NoError(t, err)
+	require.NoError(t, file.Truncate(stagingThreshold))
+	require.NoError(t, file.Close())
+
+	w := &windowsVM{cloudProvider: &aws.AwsProvider{}}
+	transferStaging = nil
+	assert.False(t, w.shouldStage(large), "no staging bucket")
+
+	transferStaging = &stagingBucket{name: "e2e-staging"}
+	assert.True(t, w.shouldStage(large))
+	assert.False(t, w.shouldStage(small))
+	assert.False(t, w.shouldStage(filepath.Join(dir, "missing.tar")))
+	assert.False(t, (&windowsVM{}).shouldStage(large), "the inventory hosts have no cloud provider")
+}
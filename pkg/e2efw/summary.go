@@ -0,0 +1,39 @@
+package e2efw
+
+import (
+	"sort"
+	"time"
+)
+
+// DurationSummary summarizes a set of durations in seconds
+type DurationSummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	Max   float64 `json:"max"`
+}
+
+// SummarizeDurations returns the minimum, median, 90th percentile and maximum of the given durations in seconds
+func SummarizeDurations(durations []time.Duration) DurationSummary {
+	if len(durations) == 0 {
+		return DurationSummary{}
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// percentile returns the nearest-rank percentile of the sorted durations
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1].Seconds()
+	}
+	return DurationSummary{
+		Count: len(sorted),
+		Min:   sorted[0].Seconds(),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		Max:   sorted[len(sorted)-1].Seconds(),
+	}
+}
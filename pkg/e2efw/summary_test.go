@@ -0,0 +1,23 @@
+package e2efw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSummarizeDurations tests the nearest-rank percentiles of the summary
+func TestSummarizeDurations(t *testing.T) {
+	assert.Equal(t, DurationSummary{}, SummarizeDurations(nil))
+
+	var durations []time.Duration
+	for i := 10; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	assert.Equal(t, DurationSummary{Count: 10, Min: 1, P50: 5, P90: 9, Max: 10}, SummarizeDurations(durations))
+	assert.Equal(t, 10*time.Second, durations[0], "the given durations should not be sorted in place")
+
+	assert.Equal(t, DurationSummary{Count: 1, Min: 2, P50: 2, P90: 2, Max: 2},
+		SummarizeDurations([]time.Duration{2 * time.Second}))
+}
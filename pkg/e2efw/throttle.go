@@ -0,0 +1,103 @@
+package e2efw
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// remoteConcurrencyEnvVar is the environment variable holding the number of WinRM shells and ssh sessions open at
+	// once on each Windows VM, e.g. winrm=5,ssh=8
+	remoteConcurrencyEnvVar = "E2E_REMOTE_CONCURRENCY"
+	// defaultWinRMShells is the default number of WinRM shells open at once on a Windows VM, each command being run in
+	// its own shell. It stays well below the MaxShellsPerUser quota of the WinRM service, 30 on older Windows versions,
+	// as the shells of the failed commands linger until they time out.
+	defaultWinRMShells = 10
+	// defaultSSHSessions is the default number of ssh sessions, commands and shells, open at once on the connection to a
+	// Windows VM. It stays below the MaxSessions limit of the OpenSSH server, 10 by default, leaving room for the SFTP
+	// session.
+	defaultSSHSessions = 8
+)
+
+// remoteConcurrency is the number of remote operations open at once on each VM, set from E2E_REMOTE_CONCURRENCY
+var remoteConcurrency = DefaultRemoteConcurrency()
+
+// RemoteConcurrency is the number of remote operations open at once on each Windows VM. The operations above it wait
+// for one to end rather than being rejected by the quotas of the WinRM service or the OpenSSH server of the VM.
+type RemoteConcurrency struct {
+	// WinRMShells is the number of WinRM shells open at once
+	WinRMShells int
+	// SSHSessions is the number of ssh sessions open at once, the SFTP session and the port forwards excluded
+	SSHSessions int
+}
+
+// DefaultRemoteConcurrency returns the remote concurrency used unless E2E_REMOTE_CONCURRENCY is set
+func DefaultRemoteConcurrency() RemoteConcurrency {
+	return RemoteConcurrency{WinRMShells: defaultWinRMShells, SSHSessions: defaultSSHSessions}
+}
+
+// ParseRemoteConcurrency parses the remote concurrency given as comma separated winrm=<shells> and ssh=<sessions>
+// fields, e.g. winrm=5,ssh=8. The fields which are not given keep their default.
+func ParseRemoteConcurrency(spec string) (RemoteConcurrency, error) {
+	concurrency := DefaultRemoteConcurrency()
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return concurrency, fmt.Errorf("invalid remote concurrency %q, expected <transport>=<number>", field)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 {
+			return concurrency, fmt.Errorf("invalid remote concurrency %s, expected a positive number", field)
+		}
+		switch parts[0] {
+		case "winrm":
+			concurrency.WinRMShells = n
+		case "ssh":
+			concurrency.SSHSessions = n
+		default:
+			return concurrency, fmt.Errorf("unknown transport %q, expected winrm or ssh", parts[0])
+		}
+	}
+	return concurrency, nil
+}
+
+// String returns the remote concurrency in the format of ParseRemoteConcurrency
+func (c RemoteConcurrency) String() string {
+	return fmt.Sprintf("winrm=%d,ssh=%d", c.WinRMShells, c.SSHSessions)
+}
+
+// remoteConcurrencyFromEnv returns the remote concurrency given by E2E_REMOTE_CONCURRENCY, the default if not set
+func remoteConcurrencyFromEnv() (RemoteConcurrency, error) {
+	spec := strings.TrimSpace(os.Getenv(remoteConcurrencyEnvVar))
+	if spec == "" {
+		return DefaultRemoteConcurrency(), nil
+	}
+	concurrency, err := ParseRemoteConcurrency(spec)
+	if err != nil {
+		return concurrency, fmt.Errorf("invalid %s: %v", remoteConcurrencyEnvVar, err)
+	}
+	return concurrency, nil
+}
+
+// semaphore limits the number of operations in progress at once, the extra ones waiting for a slot. The zero value is
+// sized on first use.
+type semaphore struct {
+	// once sizes slots
+	once sync.Once
+	// slots holds a token per operation in progress
+	slots chan struct{}
+}
+
+// acquire waits for a free slot, sizing the semaphore with the given size on first use
+func (s *semaphore) acquire(size int) {
+	s.once.Do(func() { s.slots = make(chan struct{}, size) })
+	s.slots <- struct{}{}
+}
+
+// release frees the slot of an operation which ended
+func (s *semaphore) release() {
+	<-s.slots
+}
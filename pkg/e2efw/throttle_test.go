@@ -0,0 +1,106 @@
+package e2efw
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRemoteConcurrency tests the parsing and validation of the remote concurrency
+func TestParseRemoteConcurrency(t *testing.T) {
+	concurrency, err := ParseRemoteConcurrency("winrm=5, ssh=4")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteConcurrency{WinRMShells: 5, SSHSessions: 4}, concurrency)
+	parsed, err := ParseRemoteConcurrency(concurrency.String())
+	require.NoError(t, err)
+	assert.Equal(t, concurrency, parsed)
+
+	concurrency, err = ParseRemoteConcurrency("winrm=20")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteConcurrency{WinRMShells: 20, SSHSessions: defaultSSHSessions}, concurrency)
+
+	for _, spec := range []string{"", "winrm", "winrm=0", "ssh=-1", "ssh=many", "sftp=2"} {
+		_, err = ParseRemoteConcurrency(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestRemoteConcurrencyFromEnv tests that the remote concurrency defaults when E2E_REMOTE_CONCURRENCY is not set
+func TestRemoteConcurrencyFromEnv(t *testing.T) {
+	defer os.Setenv(remoteConcurrencyEnvVar, os.Getenv(remoteConcurrencyEnvVar))
+
+	require.NoError(t, os.Setenv(remoteConcurrencyEnvVar, ""))
+	concurrency, err := remoteConcurrencyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRemoteConcurrency(), concurrency)
+
+	require.NoError(t, os.Setenv(remoteConcurrencyEnvVar, "ssh=2"))
+	concurrency, err = remoteConcurrencyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 2, concurrency.SSHSessions)
+
+	require.NoError(t, os.Setenv(remoteConcurrencyEnvVar, "ssh=0"))
+	_, err = remoteConcurrencyFromEnv()
+	assert.Error(t, err)
+}
+
+// TestSemaphore tests that the operations above the size of the semaphore wait for a slot rather than fail
+func TestSemaphore(t *testing.T) {
+	var s semaphore
+	var lock sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.acquire(3)
+			defer s.release()
+			lock.Lock()
+			if running++; running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.True(t, maxRunning <= 3, "%d operations were running at once", maxRunning)
+	assert.Equal(t, 3, cap(s.slots))
+}
+
+// TestSSHSessionsThrottled tests that the ssh commands above the configured number of sessions are queued, and all
+// succeed
+func TestSSHSessionsThrottled(t *testing.T) {
+	defer func(concurrency RemoteConcurrency) { remoteConcurrency = concurrency }(remoteConcurrency)
+	remoteConcurrency = RemoteConcurrency{WinRMShells: defaultWinRMShells, SSHSessions: 2}
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{sshConn: newSSHConnection("127.0.0.1", server.dial)}
+	defer w.sshConn.close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 12)
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := w.runOverSSH(fmt.Sprintf("hostname %d", i), false)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	assert.True(t, server.maxSessions <= 2, "%d sessions were open at once", server.maxSessions)
+}
@@ -0,0 +1,241 @@
+package e2efw
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// commandTimingFile is the file of ARTIFACT_DIR the command timing report of the run is written to
+	commandTimingFile = "commands.json"
+	// slowCommandThresholdEnvVar is the environment variable holding the duration above which a remote command is
+	// logged as slow, e.g. 1m, 0 to log none
+	slowCommandThresholdEnvVar = "E2E_SLOW_COMMAND_THRESHOLD"
+	// defaultSlowCommandThreshold is the duration above which a remote command is logged as slow by default
+	defaultSlowCommandThreshold = 30 * time.Second
+	// maxSlowestCommands is the number of slowest commands kept in the report
+	maxSlowestCommands = 20
+	// maxLoggedSlowestCommands is the number of slowest commands logged once the tests are done
+	maxLoggedSlowestCommands = 5
+	// maxTranscriptCommands is the number of commands kept in the transcript of each host, so that a load test does
+	// not grow it without bound
+	maxTranscriptCommands = 5000
+	// maxCommandLength is the length above which the commands shown in the logs and the report are truncated
+	maxCommandLength = 256
+	// encodedCommandFlag is the PowerShell flag followed by the encoded script of the commands of PowerShellScript
+	encodedCommandFlag = "-EncodedCommand "
+)
+
+// slowCommandThreshold is the duration above which a remote command is logged as slow, 0 to log none
+var slowCommandThreshold = defaultSlowCommandThreshold
+
+// CommandTiming is the wall-clock duration of a remote command
+type CommandTiming struct {
+	// Transport is the transport the command was run over, WinRM or ssh
+	Transport string `json:"transport"`
+	// Host is the IP address of the Windows VM the command was run on
+	Host string `json:"host"`
+	// Command is the command, with the PowerShell scripts decoded and truncated
+	Command string `json:"command"`
+	// Start is when the command was started
+	Start time.Time `json:"start"`
+	// Seconds is the duration of the command
+	Seconds float64 `json:"seconds"`
+	// Failed is true if the command failed or exited with a non-zero code
+	Failed bool `json:"failed,omitempty"`
+}
+
+// CommandTimingReport is the command timing report of the run, summarizing the durations of the remote commands
+type CommandTimingReport struct {
+	// Context is the context of the run
+	Context RunContext `json:"context"`
+	// SlowThreshold is the duration in seconds above which a command was logged as slow, 0 if none was
+	SlowThreshold float64 `json:"slowThreshold"`
+	// Slow is the number of commands slower than the threshold
+	Slow int `json:"slow"`
+	// Transports summarizes the durations of the commands of each transport
+	Transports map[string]DurationSummary `json:"transports"`
+	// Slowest are the slowest commands of the run, at most maxSlowestCommands, slowest first
+	Slowest []CommandTiming `json:"slowest"`
+}
+
+// commandTimer accumulates the durations of the remote commands of the run
+type commandTimer struct {
+	// lock guards the fields below, as the commands run concurrently on the VMs
+	lock sync.Mutex
+	// durations are the durations of the commands of each transport
+	durations map[string][]time.Duration
+	// slow is the number of commands slower than slowCommandThreshold
+	slow int
+	// slowest are the slowest commands so far, slowest first
+	slowest []CommandTiming
+	// transcripts are the commands run on each host, in the order they completed, at most maxTranscriptCommands
+	transcripts map[string][]CommandTiming
+}
+
+// commandTimings records the durations of the remote commands of the test suite
+var commandTimings = newCommandTimer()
+
+// newCommandTimer returns an empty commandTimer
+func newCommandTimer() *commandTimer {
+	return &commandTimer{durations: make(map[string][]time.Duration), transcripts: make(map[string][]CommandTiming)}
+}
+
+// record records the given command run over the given transport on the given host from the given start until now,
+// failed or not, and logs it if it is slower than slowCommandThreshold
+func (t *commandTimer) record(transport, host, cmd string, start time.Time, failed bool) {
+	duration := time.Since(start)
+	timing := CommandTiming{Transport: transport, Host: host, Command: displayCommand(cmd), Start: start,
+		Seconds: duration.Seconds(), Failed: failed}
+	slow := slowCommandThreshold > 0 && duration > slowCommandThreshold
+	if slow {
+		log.Printf("slow %s command on %s took %v: %s", transport, host, duration.Round(time.Millisecond),
+			timing.Command)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.durations[transport] = append(t.durations[transport], duration)
+	if len(t.transcripts[host]) < maxTranscriptCommands {
+		t.transcripts[host] = append(t.transcripts[host], timing)
+	}
+	if slow {
+		t.slow++
+	}
+	i := sort.Search(len(t.slowest), func(i int) bool { return t.slowest[i].Seconds < timing.Seconds })
+	if i >= maxSlowestCommands {
+		return
+	}
+	t.slowest = append(t.slowest, CommandTiming{})
+	copy(t.slowest[i+1:], t.slowest[i:])
+	t.slowest[i] = timing
+	if len(t.slowest) > maxSlowestCommands {
+		t.slowest = t.slowest[:maxSlowestCommands]
+	}
+}
+
+// report returns the command timing report of the commands recorded so far
+func (t *commandTimer) report() *CommandTimingReport {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	report := &CommandTimingReport{SlowThreshold: slowCommandThreshold.Seconds(), Slow: t.slow,
+		Transports: make(map[string]DurationSummary), Slowest: append([]CommandTiming{}, t.slowest...)}
+	for transport, durations := range t.durations {
+		report.Transports[transport] = SummarizeDurations(durations)
+	}
+	return report
+}
+
+// transcript returns the commands recorded so far on the given host, in the order they completed
+func (t *commandTimer) transcript(host string) []CommandTiming {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]CommandTiming{}, t.transcripts[host]...)
+}
+
+// hosts returns the hosts commands were recorded on, sorted
+func (t *commandTimer) hosts() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var hosts []string
+	for host := range t.transcripts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// displayCommand returns the given command as shown in the logs and the report: decoded by decodeCommand, and
+// truncated to maxCommandLength
+func displayCommand(cmd string) string {
+	cmd = decodeCommand(cmd)
+	if len(cmd) > maxCommandLength {
+		cmd = cmd[:maxCommandLength] + "..."
+	}
+	return cmd
+}
+
+// decodeCommand returns the given command without the PowerShell prefix, with the script of the PowerShell commands of
+// PowerShellScript decoded and the whitespace collapsed
+func decodeCommand(cmd string) string {
+	return strings.Join(strings.Fields(decodeScript(cmd)), " ")
+}
+
+// decodeScript returns the given command without the PowerShell prefix, with the script of the PowerShell commands of
+// PowerShellScript decoded
+func decodeScript(cmd string) string {
+	cmd = strings.TrimPrefix(cmd, remotePowerShellCmdPrefix)
+	if i := strings.Index(cmd, encodedCommandFlag); i >= 0 {
+		encoded := strings.Fields(cmd[i+len(encodedCommandFlag):])
+		if len(encoded) > 0 {
+			if raw, err := base64.StdEncoding.DecodeString(encoded[0]); err == nil && len(raw)%2 == 0 {
+				units := make([]uint16, len(raw)/2)
+				for j := range units {
+					units[j] = uint16(raw[2*j]) | uint16(raw[2*j+1])<<8
+				}
+				cmd = string(utf16.Decode(units))
+			}
+		}
+	}
+	return cmd
+}
+
+// slowCommandThresholdFromEnv returns the slow command threshold given by E2E_SLOW_COMMAND_THRESHOLD, the default if
+// not set
+func slowCommandThresholdFromEnv() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(slowCommandThresholdEnvVar))
+	if value == "" {
+		return defaultSlowCommandThreshold, nil
+	}
+	threshold, err := time.ParseDuration(value)
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("invalid %s %s, expected a duration, e.g. 1m, or 0", slowCommandThresholdEnvVar, value)
+	}
+	return threshold, nil
+}
+
+// writeCommandTimingReport writes the command timing report of the run to commands.json in ARTIFACT_DIR and logs the
+// slowest commands
+func writeCommandTimingReport() {
+	report := commandTimings.report()
+	report.Context = CurrentRunContext()
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("error marshalling the command timing report: %v", err)
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(artifactDir, commandTimingFile), contents, 0644); err != nil {
+		log.Printf("unable to write the command timing report: %v", err)
+		return
+	}
+	for i, timing := range report.Slowest {
+		if i == maxLoggedSlowestCommands {
+			break
+		}
+		log.Printf("slowest %s command on %s took %.1fs: %s", timing.Transport, timing.Host, timing.Seconds,
+			timing.Command)
+	}
+}
+
+// recordCommand records the given command run over the given transport on the Windows VM from the given start until
+// now with the given result, in the timing report and in the session recording of the VM, with its password redacted
+func (w *windowsVM) recordCommand(transport, cmd string, start time.Time, result commandResult) {
+	host, password := "", ""
+	if credentials := w.GetCredentials(); credentials != nil {
+		host, password = credentials.GetIPAddress(), credentials.GetPassword()
+	}
+	commandTimings.record(transport, host, cmd, start, result.failed())
+	entry := result.sessionEntry(transport, host, cmd, start)
+	entry.Context = RunContextOf(w)
+	sessions.record(artifactDir, entry, password)
+}
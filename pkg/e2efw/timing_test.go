@@ -0,0 +1,103 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCommandTimer tests that the slowest commands are kept slowest first and capped, and the durations summarized per
+// transport
+func TestCommandTimer(t *testing.T) {
+	defer func(threshold time.Duration) { slowCommandThreshold = threshold }(slowCommandThreshold)
+	slowCommandThreshold = time.Hour
+
+	timer := newCommandTimer()
+	now := time.Now()
+	for i := 1; i <= maxSlowestCommands+5; i++ {
+		timer.record("WinRM", "10.0.0.1", fmt.Sprintf("command %d", i), now.Add(-time.Duration(i)*time.Minute),
+			i%2 == 0)
+	}
+	timer.record("ssh", "10.0.0.2", "hostname", now, false)
+
+	report := timer.report()
+	require.Len(t, report.Slowest, maxSlowestCommands)
+	assert.Equal(t, fmt.Sprintf("command %d", maxSlowestCommands+5), report.Slowest[0].Command)
+	assert.True(t, report.Slowest[1].Failed)
+	for i := 1; i < len(report.Slowest); i++ {
+		assert.GreaterOrEqual(t, report.Slowest[i-1].Seconds, report.Slowest[i].Seconds)
+	}
+	assert.Equal(t, maxSlowestCommands+5, report.Transports["WinRM"].Count)
+	assert.Equal(t, 1, report.Transports["ssh"].Count)
+	assert.Equal(t, 0, report.Slow)
+
+	slowCommandThreshold = 90 * time.Second
+	timer.record("WinRM", "10.0.0.1", "Install-Module", now.Add(-2*time.Minute), false)
+	assert.Equal(t, 1, timer.report().Slow)
+}
+
+// TestDisplayCommand tests that the PowerShell scripts are decoded and the long commands truncated
+func TestDisplayCommand(t *testing.T) {
+	script := "Get-Service -Name sshd\nStart-Service sshd"
+	assert.Equal(t, "Get-Service -Name sshd Start-Service sshd",
+		displayCommand(remotePowerShellCmdPrefix+PowerShellScript(script)))
+	assert.Equal(t, "hostname", displayCommand("hostname"))
+	long := displayCommand(strings.Repeat("a", 2*maxCommandLength))
+	assert.Equal(t, maxCommandLength+len("..."), len(long))
+}
+
+// TestSlowCommandThresholdFromEnv tests the parsing of E2E_SLOW_COMMAND_THRESHOLD
+func TestSlowCommandThresholdFromEnv(t *testing.T) {
+	defer os.Unsetenv(slowCommandThresholdEnvVar)
+	tests := []struct {
+		value     string
+		threshold time.Duration
+		wantErr   bool
+	}{
+		{"", defaultSlowCommandThreshold, false},
+		{"1m", time.Minute, false},
+		{"0", 0, false},
+		{"-1s", 0, true},
+		{"slow", 0, true},
+	}
+	for _, test := range tests {
+		os.Setenv(slowCommandThresholdEnvVar, test.value)
+		threshold, err := slowCommandThresholdFromEnv()
+		if test.wantErr {
+			assert.Error(t, err, test.value)
+			continue
+		}
+		require.NoError(t, err, test.value)
+		assert.Equal(t, test.threshold, threshold, test.value)
+	}
+}
+
+// TestWriteCommandTimingReport tests that the command timing report is written to the artifact directory
+func TestWriteCommandTimingReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+	defer func(timer *commandTimer) { commandTimings = timer }(commandTimings)
+	commandTimings = newCommandTimer()
+
+	commandTimings.record("ssh", "10.0.0.1", "hostname", time.Now().Add(-time.Second), false)
+	writeCommandTimingReport()
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, commandTimingFile))
+	require.NoError(t, err)
+	report := &CommandTimingReport{}
+	require.NoError(t, json.Unmarshal(contents, report))
+	require.Len(t, report.Slowest, 1)
+	assert.Equal(t, "hostname", report.Slowest[0].Command)
+	assert.Equal(t, 1, report.Transports["ssh"].Count)
+}
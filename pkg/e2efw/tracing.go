@@ -0,0 +1,73 @@
+package e2efw
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// traceFileName is the name of the file in the artifact directory the spans are written to as JSON
+	traceFileName = "trace.json"
+)
+
+var (
+	// suiteCtx is the context holding the span of the whole test suite, used as the parent of the framework spans
+	suiteCtx = context.Background()
+	// suiteSpan is the span of the whole test suite, ended by TearDown
+	suiteSpan trace.Span
+	// shutdownTracing flushes the spans and closes the trace file
+	shutdownTracing = func() error { return nil }
+)
+
+// setupTracing configures the global tracer provider to write the spans to the trace file in the artifact directory
+// and, if the OTLP endpoint environment variable is set, to export them to it. It then starts the span of the given
+// test suite, which is also the parent of the spans of the windows-node-installer.
+func setupTracing(suite string) error {
+	shutdown, err := tracing.Setup(suite, os.Getenv(tracing.EndpointEnvVar), filepath.Join(artifactDir, traceFileName))
+	if err != nil {
+		return err
+	}
+	shutdownTracing = shutdown
+	suiteSpan = tracing.StartRoot(suite, CurrentRunContext().Attributes()...)
+	suiteCtx = tracing.Context()
+	return nil
+}
+
+// endTracing ends the test suite span and flushes the spans. Errors are logged, as tracing is nice to have.
+func endTracing() {
+	if suiteSpan != nil {
+		suiteSpan.End()
+		suiteSpan = nil
+	}
+	if err := shutdownTracing(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	shutdownTracing = func() error { return nil }
+}
+
+// startSpan starts a span with the given name as a child of the span in the given context, with the given attributes
+// along with the run context known so far
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, append(CurrentRunContext().Attributes(), attrs...)...)
+}
+
+// Phase runs fn within a span with the given name, child of the test suite span, and returns its error. It can be
+// used by the test suites to make their slow steps visible in the trace.
+func Phase(name string, fn func() error) error {
+	_, span := startSpan(suiteCtx, name)
+	err := fn()
+	tracing.End(span, err)
+	return err
+}
+
+// TraceParent returns the W3C traceparent of the test suite span, which can be passed to WMCB through the TRACEPARENT
+// environment variable so that its spans are children of the test suite span. It is empty if tracing is not set up.
+func TraceParent() string {
+	return tracing.TraceParent(suiteCtx)
+}
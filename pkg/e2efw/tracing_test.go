@@ -0,0 +1,60 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTracing tests that the test suite spans are written to the trace file in the artifact directory
+func TestTracing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer func(dir string) { artifactDir = dir }(artifactDir)
+	artifactDir = dir
+
+	assert.Empty(t, TraceParent(), "traceparent without tracing set up")
+	require.NoError(t, setupTracing("wsu.test"))
+	traceParent := TraceParent()
+	require.Error(t, Phase("run WSU", func() error { return fmt.Errorf("playbook failed") }))
+	endTracing()
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, traceFileName))
+	require.NoError(t, err)
+	type exportedSpan struct {
+		Name        string
+		SpanContext struct {
+			TraceID string
+			SpanID  string
+		}
+		Parent struct {
+			SpanID string
+		}
+		Status struct {
+			Code string
+		}
+	}
+	spans := make(map[string]exportedSpan)
+	decoder := json.NewDecoder(strings.NewReader(string(contents)))
+	for decoder.More() {
+		var s exportedSpan
+		require.NoError(t, decoder.Decode(&s))
+		spans[s.Name] = s
+	}
+	require.Len(t, spans, 2)
+	suite := spans["wsu.test"]
+	assert.Equal(t, suite.SpanContext.SpanID, spans["run WSU"].Parent.SpanID)
+	assert.Equal(t, "Error", spans["run WSU"].Status.Code)
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", suite.SpanContext.TraceID, suite.SpanContext.SpanID), traceParent)
+}
@@ -0,0 +1,196 @@
+package e2efw
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// transport is a way of reaching the Windows VM
+type transport string
+
+const (
+	// winRMTransport runs commands over WinRM
+	winRMTransport transport = "WinRM"
+	// sshTransport runs commands, transfers files and forwards ports over ssh
+	sshTransport transport = "ssh"
+)
+
+// exitCodeError is the error of a command that was run on the Windows VM but returned a non-zero exit code
+type exitCodeError struct {
+	// cmd is the command that was run
+	cmd string
+	// exitCode is the exit code the command returned
+	exitCode int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("%s returned %d exit code", e.cmd, e.exitCode)
+}
+
+// transportState tracks the transports the Windows VM cannot be reached over. The commands are run over the other
+// transport, so that a WinRM or ssh hiccup does not fail the tests that do not specifically need it.
+type transportState struct {
+	// lock guards degraded and disabled
+	lock sync.Mutex
+	// degraded holds the error that made each unavailable transport unavailable
+	degraded map[transport]error
+	// disabled are the transports turned off on purpose, e.g. WinRM once hardened, which stay unavailable
+	disabled map[transport]bool
+}
+
+// markDegraded records that the transport is unavailable because of the given error
+func (s *transportState) markDegraded(t transport, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.degraded == nil {
+		s.degraded = make(map[transport]error)
+	}
+	s.degraded[t] = err
+}
+
+// markAvailable records that the transport is available again, unless it was disabled
+func (s *transportState) markAvailable(t transport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.disabled[t] {
+		delete(s.degraded, t)
+	}
+}
+
+// disable records that the transport was turned off for the given reason, which it stays unavailable for
+func (s *transportState) disable(t transport, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.degraded == nil {
+		s.degraded = make(map[transport]error)
+	}
+	if s.disabled == nil {
+		s.disabled = make(map[transport]bool)
+	}
+	s.degraded[t] = err
+	s.disabled[t] = true
+}
+
+// isDisabled returns true if the transport was turned off
+func (s *transportState) isDisabled(t transport) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.disabled[t]
+}
+
+// get returns the error that made the transport unavailable, or nil if it is available
+func (s *transportState) get(t transport) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.degraded[t]
+}
+
+// all returns the unavailable transports with the error that made them unavailable
+func (s *transportState) all() map[string]error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	degraded := make(map[string]error, len(s.degraded))
+	for t, err := range s.degraded {
+		degraded[string(t)] = err
+	}
+	return degraded
+}
+
+// DegradedTransports returns the transports the Windows VM cannot be reached over, with the error that made them
+// unavailable
+func DegradedTransports(vm WindowsVM) map[string]error {
+	return vm.handle().degradedTransports()
+}
+
+// degradedTransports implements DegradedTransports
+func (w *windowsVM) degradedTransports() map[string]error {
+	return w.transports.all()
+}
+
+// hasWinRM returns true if commands can be run over WinRM
+func (w *windowsVM) hasWinRM() bool {
+	return w.winRMClient() != nil && w.transports.get(winRMTransport) == nil
+}
+
+// hasSSH returns true if the ssh connection can be used
+func (w *windowsVM) hasSSH() bool {
+	return w.ssh() != nil && w.transports.get(sshTransport) == nil
+}
+
+// requireSSH returns an error if the given operation, which can only be done over ssh, cannot be done
+func (w *windowsVM) requireSSH(operation string) error {
+	if w.ssh() == nil {
+		return fmt.Errorf("%s cannot be called without a ssh client", operation)
+	}
+	if err := w.transports.get(sshTransport); err != nil {
+		return fmt.Errorf("%s needs ssh, which is unavailable on %s: %v", operation, w.GetCredentials().GetIPAddress(),
+			err)
+	}
+	return nil
+}
+
+// checkTransports checks that the Windows VM can be reached over both transports and records the unavailable ones.
+// The disabled transports are not checked. An error is returned if it cannot be reached at all.
+func (w *windowsVM) checkTransports() error {
+	if !w.transports.isDisabled(winRMTransport) {
+		if _, _, err := w.runOverWinRM("hostname", false); err != nil {
+			w.transports.markDegraded(winRMTransport, err)
+		} else {
+			w.transports.markAvailable(winRMTransport)
+		}
+	}
+	if _, err := w.ssh().getClient(); err != nil {
+		w.transports.markDegraded(sshTransport, err)
+	} else {
+		w.transports.markAvailable(sshTransport)
+	}
+
+	winRMErr, sshErr := w.transports.get(winRMTransport), w.transports.get(sshTransport)
+	switch {
+	case winRMErr != nil && sshErr != nil:
+		return fmt.Errorf("%s cannot be reached over WinRM: %v, nor over ssh: %v", w.GetCredentials().GetIPAddress(),
+			winRMErr, sshErr)
+	case winRMErr != nil:
+		log.Printf("WinRM is unavailable on %s, running the commands over ssh: %v", w.GetCredentials().GetIPAddress(),
+			winRMErr)
+	case sshErr != nil:
+		log.Printf("ssh is unavailable on %s, running the commands over WinRM, file transfers, tunnels and shells "+
+			"will fail: %v", w.GetCredentials().GetIPAddress(), sshErr)
+	}
+	return nil
+}
+
+// runOverSSHWithStderr executes the given command over ssh, returning its stdout and stderr separately like a command
+// run over WinRM
+func (w *windowsVM) runOverSSHWithStderr(cmd string, psCmd bool) (string, string, error) {
+	if psCmd {
+		cmd = remotePowerShellCmdPrefix + cmd
+	}
+	if err := w.checkCommand("ssh", cmd); err != nil {
+		return "", "", err
+	}
+	stdout := w.newOutputCapture("stdout")
+	defer stdout.Close()
+	stderr := w.newOutputCapture("stderr")
+	defer stderr.Close()
+	recordedStdout, recordedStderr := &sessionOutput{}, &sessionOutput{}
+	start := time.Now()
+	err := w.ssh().withSession(func(session *ssh.Session) error {
+		session.Stdout = io.MultiWriter(stdout, recordedStdout)
+		session.Stderr = io.MultiWriter(stderr, recordedStderr)
+		return session.Run(cmd)
+	})
+	w.recordCommand("ssh", cmd, start, sshCommandResult(err, recordedStdout, recordedStderr))
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return stdout.String(), stderr.String(), &exitCodeError{cmd: cmd, exitCode: exitErr.ExitStatus()}
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error while executing %s remotely: %v", cmd, err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,56 @@
+package e2efw
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestRunWithoutWinRM tests that the commands are run over ssh when WinRM is unavailable
+func TestRunWithoutWinRM(t *testing.T) {
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+	}
+	defer w.sshConn.close()
+
+	require.NoError(t, w.checkTransports())
+	assert.Contains(t, w.degradedTransports(), "WinRM")
+	assert.NotContains(t, w.degradedTransports(), "ssh")
+
+	stdout, stderr, err := w.Run("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", stdout)
+	assert.Empty(t, stderr)
+	stdout, _, err = w.Run("hostname", true)
+	require.NoError(t, err)
+	assert.Equal(t, remotePowerShellCmdPrefix+"hostname", stdout)
+}
+
+// TestUnreachableTransports tests that a VM reachable over neither transport is an error, and that the operations
+// needing ssh fail with the reason ssh is unavailable
+func TestUnreachableTransports(t *testing.T) {
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn: newSSHConnection("127.0.0.1", func() (*ssh.Client, error) {
+			return nil, fmt.Errorf("connection refused")
+		}),
+	}
+	err := w.checkTransports()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	assert.Contains(t, w.requireSSH("CopyFile").Error(), "CopyFile needs ssh, which is unavailable on 127.0.0.1")
+	_, err = w.Tunnel(0, 10250)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Tunnel needs ssh")
+
+	w.sshConn = nil
+	assert.EqualError(t, w.requireSSH("Shell"), "Shell cannot be called without a ssh client")
+}
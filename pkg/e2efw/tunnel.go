@@ -0,0 +1,10 @@
+package e2efw
+
+import (
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+// Tunnel forwards the connections made to a local port to a port on the Windows VM over ssh, so that services which
+// are not reachable from the local host, like the kubelet on a node with a private IP, can be accessed directly. It is
+// the tunnel of the windows-node-installer, opened over the ssh connection of the VM.
+type Tunnel = types.Tunnel
@@ -0,0 +1,96 @@
+package e2efw
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+const (
+	// windowsUpdateEnvVar is the environment variable holding the Windows Update mode of the created VMs, default,
+	// paused or disabled. It defaults to paused, as automatic updates reboot the VMs in the middle of the tests.
+	windowsUpdateEnvVar = "E2E_WINDOWS_UPDATE"
+	// windowsUpdateKBsEnvVar is the environment variable holding the comma separated IDs of the updates installed on
+	// the created VMs before freezing them, e.g. KB5005112
+	windowsUpdateKBsEnvVar = "E2E_WINDOWS_UPDATE_KBS"
+	// windowsUpdateTimeout is the time given to the requested updates to be installed
+	windowsUpdateTimeout = time.Hour
+	// hotfixesFile is the file of the node artifacts listing the hotfixes installed on the VM
+	hotfixesFile = "hotfixes.json"
+)
+
+// windowsUpdatePolicy is the Windows Update policy applied to the created VMs
+var windowsUpdatePolicy *types.WindowsUpdatePolicy
+
+// Hotfix is an update installed on the Windows VM
+type Hotfix struct {
+	// ID is the ID of the update, e.g. KB5005112
+	ID string `json:"id"`
+	// Description is the kind of update, e.g. Security Update
+	Description string `json:"description"`
+	// InstalledOn is the date the update was installed on, in yyyy-MM-dd format, empty if unknown
+	InstalledOn string `json:"installedOn,omitempty"`
+}
+
+// windowsUpdatePolicyFromEnv returns the Windows Update policy of the E2E_WINDOWS_UPDATE and E2E_WINDOWS_UPDATE_KBS
+// environment variables, in the --windows-update modes of wni. The VMs are frozen once the updates are installed, so
+// the mode defaults to disabled if updates are given, and to paused otherwise.
+func windowsUpdatePolicyFromEnv() (*types.WindowsUpdatePolicy, error) {
+	var kbs []string
+	if value := os.Getenv(windowsUpdateKBsEnvVar); value != "" {
+		kbs = strings.Split(value, ",")
+	}
+	mode := os.Getenv(windowsUpdateEnvVar)
+	if mode == "" && len(kbs) == 0 {
+		mode = string(types.WindowsUpdatePaused)
+	}
+	policy, err := types.NewWindowsUpdatePolicy(mode, kbs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s or %s: %v", windowsUpdateEnvVar, windowsUpdateKBsEnvVar, err)
+	}
+	return policy, nil
+}
+
+// ConfigureWindowsUpdate installs the updates of the given policy, rebooting the Windows VM if they require it, and
+// then turns the automatic updates off according to the mode of the policy, as wni does for the instances it creates.
+// Nothing is done for a nil policy.
+func ConfigureWindowsUpdate(vm WindowsVM, policy *types.WindowsUpdatePolicy) error {
+	return types.ApplyWindowsUpdatePolicy(vm, policy, Timeout(CreatePhase, windowsUpdateTimeout))
+}
+
+// ListHotfixes returns the updates installed on the Windows VM
+func ListHotfixes(vm WindowsVM) ([]Hotfix, error) {
+	return vm.handle().listHotfixes()
+}
+
+// listHotfixes implements ListHotfixes
+func (w *windowsVM) listHotfixes() ([]Hotfix, error) {
+	stdout, stderr, err := w.Run(PowerShellScript("ConvertTo-Json -Compress -InputObject @(Get-HotFix | "+
+		"ForEach-Object { @{id = $_.HotFixID; description = $_.Description; installedOn = "+
+		"$(if ($_.InstalledOn) { $_.InstalledOn.ToString('yyyy-MM-dd') } else { '' })} })"), true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing hotfixes: %v, %s", err, stderr)
+	}
+	return parseHotfixes(stdout)
+}
+
+// parseHotfixes parses the JSON output of ListHotfixes. A single hotfix is serialized as an object instead of an
+// array by older versions of PowerShell.
+func parseHotfixes(out string) ([]Hotfix, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(out, "{") {
+		out = "[" + out + "]"
+	}
+	var hotfixes []Hotfix
+	if err := json.Unmarshal([]byte(out), &hotfixes); err != nil {
+		return nil, fmt.Errorf("error parsing hotfixes %s: %v", out, err)
+	}
+	return hotfixes, nil
+}
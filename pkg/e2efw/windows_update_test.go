@@ -0,0 +1,59 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWindowsUpdatePolicyFromEnv tests that the automatic updates of the created VMs are paused by default
+func TestWindowsUpdatePolicyFromEnv(t *testing.T) {
+	for _, envVar := range []string{windowsUpdateEnvVar, windowsUpdateKBsEnvVar} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+		os.Unsetenv(envVar)
+	}
+	policy, err := windowsUpdatePolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &types.WindowsUpdatePolicy{Mode: types.WindowsUpdatePaused}, policy)
+
+	os.Setenv(windowsUpdateKBsEnvVar, "kb5005112, KB4577069")
+	policy, err = windowsUpdatePolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &types.WindowsUpdatePolicy{Mode: types.WindowsUpdateDisabled,
+		KBs: []string{"KB5005112", "KB4577069"}}, policy)
+
+	os.Setenv(windowsUpdateEnvVar, string(types.WindowsUpdatePaused))
+	policy, err = windowsUpdatePolicyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, types.WindowsUpdatePaused, policy.Mode, "the mode given is kept")
+
+	os.Setenv(windowsUpdateKBsEnvVar, "KB12")
+	_, err = windowsUpdatePolicyFromEnv()
+	assert.Error(t, err)
+	os.Unsetenv(windowsUpdateKBsEnvVar)
+	os.Setenv(windowsUpdateEnvVar, "never")
+	_, err = windowsUpdatePolicyFromEnv()
+	assert.Error(t, err)
+}
+
+// TestParseHotfixes tests the parsing of the hotfixes, of which a single one is not serialized as an array
+func TestParseHotfixes(t *testing.T) {
+	hotfixes, err := parseHotfixes(`[{"id":"KB5005112","description":"Security Update","installedOn":"2021-08-10"},` +
+		`{"id":"KB4577069","description":"Update","installedOn":""}]`)
+	require.NoError(t, err)
+	assert.Equal(t, []Hotfix{{"KB5005112", "Security Update", "2021-08-10"}, {"KB4577069", "Update", ""}}, hotfixes)
+
+	hotfixes, err = parseHotfixes(`{"id":"KB5005112","description":"Security Update","installedOn":"2021-08-10"}` +
+		"\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []Hotfix{{"KB5005112", "Security Update", "2021-08-10"}}, hotfixes)
+
+	hotfixes, err = parseHotfixes("")
+	assert.NoError(t, err)
+	assert.Empty(t, hotfixes)
+	_, err = parseHotfixes("[")
+	assert.Error(t, err)
+}
@@ -0,0 +1,795 @@
+package e2efw
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/masterzen/winrm"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/e2efw/remotepath"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/pkg/sftp"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// remotePowerShellCmdPrefix holds the PowerShell prefix that needs to be prefixed  for every remote PowerShell
+	// command executed on the remote Windows VM
+	remotePowerShellCmdPrefix = "powershell.exe -NonInteractive -ExecutionPolicy Bypass "
+	// user for the Windows node created.
+	// TODO: remove this hardcoding to any user.
+	user = "Administrator"
+	// winRMPort is port used for WinRM communication
+	winRMPort = 5986
+	// defaultSSHPort is the port of the OpenSSH server of the Windows VMs
+	defaultSSHPort = 22
+	// tailPollInterval is the interval at which TailFile checks the remote file for new content
+	tailPollInterval = time.Second
+	// openSSHServicesTimeout is how long the OpenSSH services take at most to be listed once the VM is reachable
+	openSSHServicesTimeout = time.Minute
+	// openSSHServicesInterval is the interval at which the OpenSSH services are checked for while waiting for them
+	openSSHServicesInterval = 5 * time.Second
+)
+
+// windowsVM represents a Windows VM in the test framework
+type windowsVM struct {
+	// lock guards credentials, sshConn, winrmClient, link and snapshots, which are replaced when the VM is
+	// reinitialized, restored or its link reshaped, so that the VM can be used from several goroutines
+	lock sync.RWMutex
+	// cloudProvider holds the information related to cloud provider
+	cloudProvider cloudprovider.Cloud
+	// credentials to access the Windows VM created
+	credentials *types.Credentials
+	// image is the Windows image the VM was created from
+	image WindowsImage
+	// sshConn is the ssh connection to the Windows VM shared by the commands, file transfers and tunnels
+	sshConn *sshConnection
+	// winrmClient to access the Windows VM created
+	winrmClient *winrm.Client
+	// winRMShells limits the number of WinRM shells open at once to the ones given by E2E_REMOTE_CONCURRENCY
+	winRMShells semaphore
+	// transports tracks whether WinRM or ssh is unavailable, in which case the commands are run over the other one
+	transports transportState
+	// link is the simulated link the connections to the Windows VM are made over
+	link *link
+	// winRM are the WinRM options of the Windows VM, nil for the ones given by E2E_WINRM_OPTIONS
+	winRM *WinRMOptions
+	// tunedWinRM are the options given by E2E_WINRM_OPTIONS adjusted to the WinRM endpoint of the Windows VM, nil until
+	// it is identified
+	tunedWinRM *WinRMOptions
+	// endpoint overrides the ports, protocol and ssh key used to reach the Windows VM, nil for the cloud VMs which are
+	// reached with the defaults
+	endpoint *vmEndpoint
+	// key is the key pair the Windows VM was created with, nil for the VMs given by their credentials or inventory
+	key *SSHKey
+	// snapshots are the names of the snapshots taken of the Windows VM
+	snapshots []string
+	// buildWMCB indicates if WSU should build WMCB and use it
+	// TODO This is a WSU specific property and should be moved to wsu_test -> https://issues.redhat.com/browse/WINC-249
+	buildWMCB bool
+}
+
+// WindowsVM is the interface for interacting with a Windows VM in the test framework. Test suites can embed it in
+// their own VM types, but only the framework implements it. It is limited to running commands on the VM, transferring
+// files and tunneling to it, and to its lifecycle: the operations built on these, e.g. ListProcesses or Reboot, are
+// functions of the package taking the WindowsVM.
+type WindowsVM interface {
+	// CopyFile copies the given file to the remote directory in the Windows VM. The remote directory is created if it
+	// does not exist. It needs to be an absolute Windows path, as checked by remotepath.Validate.
+	CopyFile(string, string) error
+	// RetrieveFiles retrieves the list of file from the directory in the remote Windows VM to the local host. As of
+	// now, we're limiting every file in the remote directory to be written to single directory on the local host.
+	// The retrieval is best effort: the other files are retrieved when one fails, and a *MultiError lists the files
+	// which could not be retrieved. The remote directory needs to be an absolute Windows path.
+	RetrieveFiles(string, string) error
+	// WriteFile writes the given content to the given remote file of the Windows VM with the given permissions over
+	// SFTP, creating its directory if needed, so that small files can be placed without a local file. The content is
+	// limited to 8 MiB, the larger files are copied with CopyFile.
+	WriteFile(string, []byte, os.FileMode) error
+	// ReadFile returns the content of the given remote file of the Windows VM, read over SFTP. The files larger than
+	// 8 MiB are retrieved with RetrieveFiles.
+	ReadFile(string) ([]byte, error)
+	// Run executes the given command remotely on the Windows VM and returns the output of stdout and stderr. If the
+	// bool is set, it implies that the cmd is to be execute in PowerShell. The commands are built with PowerShellScript
+	// for PowerShell, and with CmdLine for the Windows command shell, so that their arguments are passed as is.
+	Run(string, bool) (string, string, error)
+	// Run executes the given command remotely on the Windows VM over a ssh connection and returns the combined output
+	// of stdout and stderr. If the bool is set, it implies that the cmd is to be execute in PowerShell. This function
+	// should be used in scenarios where you want to execute a command that runs in the background. In these cases we
+	// have observed that Run() returns before the command completes and as a result killing the process.
+	RunOverSSH(string, bool) (string, error)
+	// GetCredentials returns the interface for accessing the VM credentials. It is up to the caller to check if non-nil
+	// Credentials are returned before usage.
+	GetCredentials() *types.Credentials
+	// GetImage returns the Windows image the VM was created from
+	GetImage() WindowsImage
+	// Reinitialize re-initializes the Windows VM. Presently only the ssh client is reinitialized. It can be called
+	// while other goroutines use the VM, the commands and transfers in progress on the previous ssh connection failing.
+	Reinitialize() error
+	// Tunnel forwards the connections made to the given local port to the given port on the Windows VM over ssh. A
+	// free local port is picked if the local port is 0. The returned Tunnel needs to be closed once done.
+	Tunnel(int, int) (*Tunnel, error)
+	// Destroy destroys the Windows VM and its snapshots. The VM is destroyed even if some snapshots cannot be deleted,
+	// and a *MultiError lists the failures.
+	Destroy() error
+	// BuildWMCB returns the value of buildWMCB. It can be used by WSU to decide if it should build WMCB before using it
+	BuildWMCB() bool
+	// SetBuildWMCB sets the value of buildWMCB. Setting buildWMCB to true would indicate WSU will build WMCB instead of
+	// downloading the latest as per the cluster version. False by default
+	SetBuildWMCB(bool)
+	// handle returns the implementation of the handle, which the functions of the package operate on. Being
+	// unexported, it keeps the interface from being implemented outside of the framework.
+	handle() *windowsVM
+}
+
+// newWindowsVM creates and sets up a Windows VM from the given image in the cloud with the given key pair and returns
+// the WindowsVM interface that can be used to interact with the VM. If credentials are passed then it is assumed that
+// VM already exists in the cloud and those credentials will be used to interact with the VM, the key pair being nil. If
+// no error is returned then it is guaranteed that the VM was created and can be interacted with. If skipSetup is true,
+// then configuration steps are skipped. The cloud resources created for the VM are tracked in resourceTrackerDir.
+func newWindowsVM(image WindowsImage, instanceType string, key *SSHKey, credentials *types.Credentials,
+	skipSetup bool, resourceTrackerDir string) (WindowsVM, error) {
+	w := &windowsVM{image: image, link: newLink(networkShape), key: key}
+	keyName, keyPath := "", ""
+	if key != nil {
+		var err error
+		if keyPath, err = key.privateKeyFile(); err != nil {
+			return nil, err
+		}
+		keyName = key.Name
+	}
+	var err error
+
+	w.cloudProvider, err = cloudprovider.CloudProviderFactory(kubeconfig, awsCredentials, "default", resourceTrackerDir,
+		image.ImageID, instanceType, keyName, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error instantiating cloud provider %v", err)
+	}
+
+	if credentials == nil {
+		vm, err := w.cloudProvider.CreateWindowsVM()
+		if err != nil {
+			return nil, fmt.Errorf("error creating Windows VM: %v", err)
+		}
+		w.credentials = vm.GetCredentials()
+		// The instances of the runs sharing the cloud account are told apart by their tag, the VM is usable without it
+		if awsCloud, ok := w.cloudProvider.(*aws.AwsProvider); ok {
+			if err := tagRunInstance(awsCloud.EC2, w.GetCredentials().GetInstanceId()); err != nil {
+				log.Print(err)
+			}
+		}
+		// The VM is reached through its private IP when the test runner is in the VPC of the cluster
+		if w.credentials, err = privateCredentials(w.cloudProvider, w.credentials); err != nil {
+			return nil, err
+		}
+	} else {
+		if credentials.GetIPAddress() == "" || credentials.GetPassword() == "" {
+			return nil, fmt.Errorf("password or IP address not specified in credentials")
+		}
+		w.credentials = credentials
+	}
+
+	if err := w.setupWinRMClient(); err != nil {
+		return w, fmt.Errorf("failed to setup winRM client for the Windows VM: %v", err)
+	}
+	if !skipSetup {
+		// The VM is still usable over WinRM if the OpenSSH server cannot be configured
+		if err := w.configureOpenSSHServer(); err != nil {
+			log.Printf("failed to configure OpenSSHServer on the Windows VM: %v", err)
+		} else if err := w.trustSSHCertAuthority(sshCertAuthority); err != nil {
+			// The password still authenticates over ssh
+			log.Printf("failed to configure the ssh certificate authority on the Windows VM: %v", err)
+		}
+	}
+	w.setSSHConnection(newSSHConnection(w.GetCredentials().GetIPAddress(), w.dialSSH))
+	// The VM is usable as long as one of WinRM and ssh works, the commands are run over the other one
+	if err := w.checkTransports(); err != nil {
+		return w, err
+	}
+	// The WinRM options are adjusted to what the WinRM service of the VM accepts rather than assumed
+	if w.hasWinRM() {
+		w.tuneWinRMOptions()
+	}
+
+	return w, nil
+}
+
+func (w *windowsVM) CopyFile(filePath, remoteDir string) (err error) {
+	_, span := startSpan(suiteCtx, "copy file", w.hostAttribute(), attribute.String("file", filePath),
+		attribute.String("remote-dir", remoteDir))
+	defer func() { tracing.End(span, err) }()
+	return w.copyFile(filePath, remoteDir)
+}
+
+// copyFile copies the given file to the remote directory, over SFTP or through the staging bucket
+func (w *windowsVM) copyFile(filePath, remoteDir string) error {
+	if err := remotepath.Validate(remoteDir); err != nil {
+		return err
+	}
+	remoteDir = remotepath.ToWindowsPath(remoteDir)
+	if err := w.requireSSH("CopyFile"); err != nil {
+		return err
+	}
+	// The large files are staged when E2E_TRANSFER_BACKEND selects a staging bucket, SFTP remains the fallback
+	if w.shouldStage(filePath) {
+		err := w.stagedCopy(filePath, remoteDir)
+		if err == nil {
+			return nil
+		}
+		log.Printf("error copying %s through the staging bucket, copying it over SFTP: %v", filePath, err)
+	}
+
+	ftp, err := w.ssh().sftp()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening %s file to be transferred: %v", filePath, err)
+	}
+	defer f.Close()
+
+	if err = ftp.MkdirAll(sftpPath(remoteDir)); err != nil {
+		return fmt.Errorf("error creating remote directory %s: %v", remoteDir, err)
+	}
+
+	remoteFile := remotepath.WindowsPathJoin(remoteDir, filepath.Base(filePath))
+	dstFile, err := ftp.Create(sftpPath(remoteFile))
+	if err != nil {
+		return fmt.Errorf("error initializing %s file on Windows VMs: %v", remoteFile, err)
+	}
+
+	_, err = io.Copy(dstFile, f)
+	if err != nil {
+		return fmt.Errorf("error copying %s to the Windows VM: %v", filePath, err)
+	}
+
+	// Forcefully close it so that we can execute the binary later
+	dstFile.Close()
+	return nil
+}
+
+func (w *windowsVM) RetrieveFiles(remoteDir, localDir string) (err error) {
+	_, span := startSpan(suiteCtx, "retrieve files", w.hostAttribute(), attribute.String("remote-dir", remoteDir))
+	defer func() { tracing.End(span, err) }()
+	return w.retrieveFiles(remoteDir, localDir)
+}
+
+// retrieveFiles retrieves list of files from remote directory to the local directory.
+// The implementation can be changed if the use-case arises. As of now, we're doing a best effort
+// to collect every log possible. If a retrieval of file fails, we would proceed with retrieval
+// of other log files, and a *MultiError lists the files which could not be retrieved.
+func (w *windowsVM) retrieveFiles(remoteDir, localDir string) error {
+	if err := remotepath.Validate(remoteDir); err != nil {
+		return err
+	}
+	remoteDir = remotepath.ToWindowsPath(remoteDir)
+	if err := w.requireSSH("RetrieveFiles"); err != nil {
+		return err
+	}
+
+	// Create local dir
+	err := os.MkdirAll(localDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", localDir, err)
+	}
+
+	ftp, err := w.ssh().sftp()
+	if err != nil {
+		return err
+	}
+
+	// Get the list of all files in the directory
+	remoteFiles, err := ftp.ReadDir(sftpPath(remoteDir))
+	if err != nil {
+		return fmt.Errorf("error opening remote file: %v", err)
+	}
+
+	errs := NewMultiError(fmt.Sprintf("retrieve files of %s", remoteDir))
+	for _, remoteFile := range remoteFiles {
+		// Assumption: We ignore the directories here the reason being RetrieveFiles should just retrieve files
+		// in a directory, if this is directory, we should have called RetrieveFiles on this directory
+		if remoteFile.IsDir() {
+			continue
+		}
+		fileName := remoteFile.Name()
+		// TODO: Check if there is some performance implication of multiple Open calls.
+		err = retrieveFile(ftp, remotepath.WindowsPathJoin(remoteDir, fileName), filepath.Join(localDir,
+			localFileName(fileName)))
+		if err != nil {
+			errs.Appendf("%s: %v", fileName, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// retrieveFile copies the given remote file to the given local file over SFTP
+func retrieveFile(ftp *sftp.Client, remotePath, localPath string) error {
+	srcFile, err := ftp.Open(sftpPath(remotePath))
+	if err != nil {
+		return fmt.Errorf("error opening file on the Windows VM: %v", err)
+	}
+	defer srcFile.Close()
+	dstFile, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("error creating file locally: %v", err)
+	}
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return fmt.Errorf("error retrieving file from Windows VM: %v", err)
+	}
+	// flush memory
+	if err = dstFile.Sync(); err != nil {
+		dstFile.Close()
+		return fmt.Errorf("error flushing memory: %v", err)
+	}
+	if err = dstFile.Close(); err != nil {
+		return fmt.Errorf("error closing file locally: %v", err)
+	}
+	return nil
+}
+
+// TailFile streams the contents of the given remote file to the writer, following the file as it grows, until the
+// context is cancelled. If the remote file is truncated or rotated, streaming restarts from its beginning.
+func TailFile(vm WindowsVM, ctx context.Context, remotePath string, writer io.Writer) error {
+	return vm.handle().tailFile(ctx, remotePath, writer)
+}
+
+// tailFile implements TailFile
+func (w *windowsVM) tailFile(ctx context.Context, remotePath string, writer io.Writer) error {
+	if err := w.requireSSH("TailFile"); err != nil {
+		return err
+	}
+
+	ftp, err := w.ssh().sftp()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		// The file may not have been created yet, for example kubelet.log before the kubelet has started, so wait
+		// for it to show up instead of failing
+		if info, err := ftp.Stat(sftpPath(remotePath)); err == nil {
+			if info.Size() < offset {
+				// The file has been truncated or rotated, start again from the beginning
+				offset = 0
+			}
+			if info.Size() > offset {
+				n, err := copyFrom(ftp, remotePath, offset, writer)
+				offset += n
+				if err != nil {
+					return fmt.Errorf("error streaming %s from the Windows VM: %v", remotePath, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// copyFrom copies the contents of the remote file starting at the given offset to the writer and returns the number
+// of bytes copied
+func copyFrom(ftp *sftp.Client, remotePath string, offset int64, writer io.Writer) (int64, error) {
+	f, err := ftp.Open(sftpPath(remotePath))
+	if err != nil {
+		return 0, fmt.Errorf("error opening remote file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("error seeking to %d: %v", offset, err)
+	}
+	return io.Copy(writer, f)
+}
+
+func (w *windowsVM) Run(cmd string, psCmd bool) (stdout string, stderr string, err error) {
+	_, span := startSpan(suiteCtx, "winrm run", w.hostAttribute(), tracing.Command(cmd))
+	defer func() { tracing.End(span, err) }()
+	return w.run(cmd, psCmd)
+}
+
+// run executes the given command remotely over WinRM, or over ssh if WinRM is unavailable
+func (w *windowsVM) run(cmd string, psCmd bool) (string, string, error) {
+	if !w.hasWinRM() && w.hasSSH() {
+		return w.runOverSSHWithStderr(cmd, psCmd)
+	}
+	if err := w.transports.get(winRMTransport); err != nil {
+		return "", "", fmt.Errorf("neither WinRM nor ssh is available on %s: %v", w.GetCredentials().GetIPAddress(), err)
+	}
+	return w.runOverWinRM(cmd, psCmd)
+}
+
+// runOverWinRM executes the given command remotely over WinRM
+func (w *windowsVM) runOverWinRM(cmd string, psCmd bool) (string, string, error) {
+	if w.winRMClient() == nil {
+		return "", "", fmt.Errorf("Run cannot be called without a WinRM client")
+	}
+
+	// Huge outputs, e.g. of Get-Content on a log file, are spilled to ARTIFACT_DIR instead of being held in memory
+	stdout := w.newOutputCapture("stdout")
+	defer stdout.Close()
+	stderr := w.newOutputCapture("stderr")
+	defer stderr.Close()
+
+	if psCmd {
+		cmd = remotePowerShellCmdPrefix + cmd
+	}
+	// Remotely execute the test binary.
+	exitCode, err := w.runWinRMCommand(cmd, stdout, stderr)
+	if _, ok := err.(*CommandDeniedError); ok {
+		return "", "", err
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error while executing %s remotely: %v", cmd, err)
+	}
+
+	if exitCode != 0 {
+		return stdout.String(), stderr.String(), &exitCodeError{cmd: cmd, exitCode: exitCode}
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
+
+func (w *windowsVM) RunOverSSH(cmd string, psCmd bool) (out string, err error) {
+	_, span := startSpan(suiteCtx, "ssh run", w.hostAttribute(), tracing.Command(cmd))
+	defer func() { tracing.End(span, err) }()
+	return w.runOverSSH(cmd, psCmd)
+}
+
+// runOverSSH executes the given command remotely over ssh, or over WinRM if ssh is unavailable
+func (w *windowsVM) runOverSSH(cmd string, psCmd bool) (string, error) {
+	if !w.hasSSH() && w.hasWinRM() {
+		stdout, stderr, err := w.runOverWinRM(cmd, psCmd)
+		return stdout + stderr, err
+	}
+	if err := w.requireSSH("RunOverSSH"); err != nil {
+		return "", err
+	}
+
+	if psCmd {
+		cmd = remotePowerShellCmdPrefix + cmd
+	}
+	if err := w.checkCommand("ssh", cmd); err != nil {
+		return "", err
+	}
+
+	out := w.newOutputCapture("output")
+	defer out.Close()
+	recorded := &sessionOutput{}
+	start := time.Now()
+	err := w.ssh().withSession(func(session *ssh.Session) error {
+		session.Stdout = io.MultiWriter(out, recorded)
+		session.Stderr = session.Stdout
+		return session.Run(cmd)
+	})
+	w.recordCommand("ssh", cmd, start, sshCommandResult(err, recorded, nil))
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (w *windowsVM) Tunnel(localPort, remotePort int) (*Tunnel, error) {
+	if err := w.requireSSH("Tunnel"); err != nil {
+		return nil, err
+	}
+	return types.NewTunnel(w.ssh(), localPort, fmt.Sprintf("127.0.0.1:%d", remotePort))
+}
+
+func (w *windowsVM) GetCredentials() *types.Credentials {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.credentials
+}
+
+// ssh returns the ssh connection to the Windows VM, nil if it has none
+func (w *windowsVM) ssh() *sshConnection {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.sshConn
+}
+
+// setSSHConnection replaces the ssh connection to the Windows VM by the given one, closing the previous one if any
+func (w *windowsVM) setSSHConnection(conn *sshConnection) {
+	w.lock.Lock()
+	previous := w.sshConn
+	w.sshConn = conn
+	w.lock.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+}
+
+// winRMClient returns the WinRM client of the Windows VM, nil if it has none
+func (w *windowsVM) winRMClient() *winrm.Client {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.winrmClient
+}
+
+// getLink returns the link the connections to the Windows VM are made over
+func (w *windowsVM) getLink() *link {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.link
+}
+
+func (w *windowsVM) handle() *windowsVM {
+	return w
+}
+
+func (w *windowsVM) GetImage() WindowsImage {
+	return w.image
+}
+
+// GetSSHKey returns the key pair the VM was created with, nil for the VMs given by their credentials or inventory
+func GetSSHKey(vm WindowsVM) *SSHKey {
+	return vm.handle().getSSHKey()
+}
+
+// getSSHKey implements GetSSHKey
+func (w *windowsVM) getSSHKey() *SSHKey {
+	return w.key
+}
+
+func (w *windowsVM) Reinitialize() error {
+	// The connections reinitialized concurrently share the ssh connection created by the first one
+	w.lock.Lock()
+	if w.sshConn == nil {
+		w.sshConn = newSSHConnection(w.credentials.GetIPAddress(), w.dialSSH)
+	}
+	conn := w.sshConn
+	w.lock.Unlock()
+	if err := conn.reconnect(); err != nil {
+		// An unavailable ssh is only an error if the VM cannot be reached over WinRM either
+		if w.transports.get(sshTransport) != nil && w.hasWinRM() {
+			log.Printf("ssh is still unavailable on %s: %v", w.GetCredentials().GetIPAddress(), err)
+			return nil
+		}
+		return fmt.Errorf("failed to reinitialize ssh client: %v", err)
+	}
+	w.transports.markAvailable(sshTransport)
+	return nil
+}
+
+func (w *windowsVM) Destroy() error {
+	// There is no VM to destroy
+	if w.cloudProvider == nil || w.GetCredentials() == nil {
+		return nil
+	}
+	if conn := w.ssh(); conn != nil {
+		conn.close()
+	}
+	// The VM is destroyed even if its snapshots could not all be deleted
+	errs := NewMultiError("destroy Windows VM " + w.GetCredentials().GetInstanceId())
+	errs.Append(w.deleteSnapshots())
+	_, span := startSpan(suiteCtx, "destroy Windows VM", w.hostAttribute())
+	err := w.cloudProvider.DestroyWindowsVMs()
+	tracing.End(span, err)
+	errs.Append(err)
+	return errs.ErrorOrNil()
+}
+
+// hostAttribute returns the attribute recording the IP address of the VM in the spans
+func (w *windowsVM) hostAttribute() attribute.KeyValue {
+	credentials := w.GetCredentials()
+	if credentials == nil {
+		return attribute.String("host", "")
+	}
+	return attribute.String("host", credentials.GetIPAddress())
+}
+
+// newOutputCapture returns a capture of the given output stream of a command run on the Windows VM
+func (w *windowsVM) newOutputCapture(stream string) *OutputCapture {
+	host := "unknown"
+	if credentials := w.GetCredentials(); credentials != nil {
+		host = credentials.GetIPAddress()
+	}
+	return NewOutputCapture(host, stream)
+}
+
+// setupWinRMClient sets up the winrm client to be used while accessing Windows node
+func (w *windowsVM) setupWinRMClient() error {
+	host := w.GetCredentials().GetIPAddress()
+	password := w.GetCredentials().GetPassword()
+
+	options := w.winRMOptions()
+	endpoint := winrm.NewEndpoint(host, w.endpoint.winRMPort(), !w.endpoint.winRMOverHTTP(), true,
+		nil, nil, nil, options.Timeout)
+	params := options.parameters()
+	params.Dial = w.getLink().dial
+	winrmClient, err := winrm.NewClientWithParameters(endpoint, w.userName(), password, params)
+	if err != nil {
+		return fmt.Errorf("failed to set up winrm client with error: %v", err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.winrmClient = winrmClient
+	return nil
+}
+
+// runWinRMCommand runs the given command with the WinRM client, writing its output to the given writers, and records
+// its duration
+func (w *windowsVM) runWinRMCommand(cmd string, stdout, stderr io.Writer) (int, error) {
+	if err := w.checkCommand("WinRM", cmd); err != nil {
+		return 0, err
+	}
+	// Each command is run in its own shell, the commands above the WinRM quota of the VM wait for a shell to close. The
+	// wait is not part of the duration of the command.
+	w.winRMShells.acquire(remoteConcurrency.WinRMShells)
+	defer w.winRMShells.release()
+	recordedStdout, recordedStderr := &sessionOutput{}, &sessionOutput{}
+	start := time.Now()
+	exitCode, err := w.winRMClient().Run(cmd, io.MultiWriter(stdout, recordedStdout),
+		io.MultiWriter(stderr, recordedStderr))
+	w.recordCommand("WinRM", cmd, start, commandResult{exitCode: exitCode, err: err, stdout: recordedStdout,
+		stderr: recordedStderr})
+	return exitCode, err
+}
+
+// configureOpenSSHServer configures the OpenSSH server using WinRM client installed on the Windows VM.
+// The OpenSSH server is installed as part of WNI tool's CreateVM method.
+func (w *windowsVM) configureOpenSSHServer() error {
+	// The modules already installed on pre-baked images are not installed again, which takes minutes and fails when
+	// the PowerShell Gallery is flaky. They are installed if they cannot be listed.
+	var inventory *ModuleInventory
+	// The NuGet provider and the OpenSSHUtils module are independent of the services, which are set up concurrently
+	// as soon as they are listed
+	return runSetupSteps("failed to configure the OpenSSH server", []setupStep{
+		{name: "wait for the OpenSSH services", run: w.waitForOpenSSHServices},
+		{name: "list the installed modules", run: func() error {
+			var err error
+			if inventory, err = w.winRMModuleInventory(); err != nil {
+				log.Print(err)
+			}
+			return nil
+		}},
+		// This dependency is needed for the subsequent module installation we're doing. This version of NuGet
+		// needed for OpenSSH server 0.0.1
+		{name: "install dependent packages", after: []string{"list the installed modules"},
+			run: w.moduleInstallStep("NuGet package provider", func() bool {
+				return inventory.HasPackageProvider("NuGet", nuGetMinVersion)
+			}, "Install-PackageProvider -Name NuGet -MinimumVersion "+nuGetMinVersion+" -Force")},
+		// Configure OpenSSH for all users.
+		// TODO: Limit this to Administrator.
+		{name: "install OpenSSHUtils for all users", after: []string{"install dependent packages"},
+			run: w.moduleInstallStep("OpenSSHUtils module", func() bool {
+				return inventory.HasModule("OpenSSHUtils", "")
+			}, "Install-Module -Force OpenSSHUtils -Scope AllUsers")},
+		{name: "set up the ssh-agent Windows service", after: []string{"wait for the OpenSSH services"},
+			run: w.winRMStep("Set-Service -Name ssh-agent -StartupType Automatic")},
+		{name: "set up the sshd Windows service", after: []string{"wait for the OpenSSH services"},
+			run: w.winRMStep("Set-Service -Name sshd -StartupType Automatic")},
+		{name: "start ssh-agent", after: []string{"set up the ssh-agent Windows service"},
+			run: w.winRMStep("Start-Service ssh-agent")},
+		{name: "start sshd", after: []string{"set up the sshd Windows service"},
+			run: w.winRMStep("Start-Service sshd")},
+	})
+}
+
+// waitForOpenSSHServices waits for up to openSSHServicesTimeout for the sshd and ssh-agent services to be listed on
+// the Windows VM, which takes a while after it booted
+func (w *windowsVM) waitForOpenSSHServices() error {
+	cmd := remotePowerShellCmdPrefix + PowerShellScript("Get-Service -Name sshd, ssh-agent -ErrorAction Stop")
+	attempts := int(openSSHServicesTimeout / openSSHServicesInterval)
+	return Retry("wait for the OpenSSH services", w.GetCredentials().GetIPAddress(), attempts, openSSHServicesInterval,
+		func() error {
+			stderr := new(bytes.Buffer)
+			exitCode, err := w.runWinRMCommand(cmd, new(bytes.Buffer), stderr)
+			if err != nil {
+				return err
+			}
+			if exitCode != 0 {
+				return fmt.Errorf("OpenSSH services not listed: %s", strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		})
+}
+
+// winRMStep returns a setup step running the given PowerShell script over WinRM in its own shell. Only the failures to
+// run the script fail the step, not its exit code.
+func (w *windowsVM) winRMStep(script string) func() error {
+	return func() error {
+		_, err := w.runWinRMCommand(remotePowerShellCmdPrefix+PowerShellScript(script), new(bytes.Buffer),
+			new(bytes.Buffer))
+		return err
+	}
+}
+
+// dialSSH opens a new ssh connection to the Windows VM
+func (w *windowsVM) dialSSH() (*ssh.Client, error) {
+	return w.dialSSHWithAuth(append(sshCertAuthority.authMethods(),
+		w.endpoint.sshAuth(w.GetCredentials().GetPassword())...))
+}
+
+// dialSSHWithAuth opens a new ssh connection to the Windows VM authenticating with the given methods
+func (w *windowsVM) dialSSHWithAuth(auth []ssh.AuthMethod) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            w.userName(),
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	addr := net.JoinHostPort(w.GetCredentials().GetIPAddress(), strconv.Itoa(w.endpoint.sshPort()))
+	conn, err := w.getLink().dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// SetNetworkShape changes the shape of the link to the Windows VM and reopens the connections over the new link
+func SetNetworkShape(vm WindowsVM, shape *NetworkShape) error {
+	return vm.handle().setNetworkShape(shape)
+}
+
+// setNetworkShape implements SetNetworkShape
+func (w *windowsVM) setNetworkShape(shape *NetworkShape) error {
+	w.lock.Lock()
+	if w.link == nil {
+		w.link = newLink(nil)
+	}
+	w.link.setShape(shape)
+	conn := w.sshConn
+	w.lock.Unlock()
+	if conn != nil {
+		conn.close()
+	}
+	return w.setupWinRMClient()
+}
+
+func (w *windowsVM) BuildWMCB() bool {
+	return w.buildWMCB
+}
+
+func (w *windowsVM) SetBuildWMCB(buildWMCB bool) {
+	w.buildWMCB = buildWMCB
+}
+
+// sftpPath returns the given path of the VM in the form passed to the SFTP server, C:/dir/file. The SFTP protocol
+// sends the path as is in UTF-8, so names with spaces, brackets or non-ASCII characters need no quoting, but the
+// backslashes are replaced as the SFTP client splits the paths on the separator of the local OS.
+func sftpPath(path string) string {
+	return strings.ReplaceAll(remotepath.ToWindowsPath(path), remotepath.Separator, "/")
+}
+
+// localFileName returns the name the given remote file is retrieved under locally. The characters Windows allows in
+// file names are kept, but on a Windows host the ones it reserves, like the colons of a timestamp, are replaced by _.
+func localFileName(name string) string {
+	if runtime.GOOS != "windows" {
+		return name
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,77 @@
+package e2efw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSFTPPath tests that the paths with spaces, brackets and non-ASCII characters are passed to the SFTP server as is,
+// with forward slashes
+func TestSFTPPath(t *testing.T) {
+	assert.Equal(t, "C:/k/logs [2021-01-01]/kubelet été.log", sftpPath("C:\\k\\logs [2021-01-01]\\kubelet été.log"))
+	assert.Equal(t, "C:/k/log", sftpPath("C:/k//log\\"))
+}
+
+// TestLocalFileName tests that the remote file names are only rewritten on Windows test hosts, where the characters
+// like the colons of a timestamp are reserved
+func TestLocalFileName(t *testing.T) {
+	name := "kubelet 2021-01-01T10:00:00 [été].log"
+	if runtime.GOOS == "windows" {
+		assert.Equal(t, "kubelet 2021-01-01T10_00_00 [été].log", localFileName(name))
+	} else {
+		assert.Equal(t, name, localFileName(name))
+	}
+}
+
+// TestWindowsVMConcurrentUse tests that a VM can be used from several goroutines while it is reinitialized, sharing its
+// ssh connection and SFTP client. It is meant to be run with -race.
+func TestWindowsVMConcurrentUse(t *testing.T) {
+	server := newSSHServer(t)
+	defer server.listener.Close()
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", "127.0.0.1", "", "Administrator"),
+		sshConn:     newSSHConnection("127.0.0.1", server.dial),
+	}
+	defer func() { w.ssh().close() }()
+	dir, err := ioutil.TempDir("", "sftp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		// The commands and transfers in progress on a reinitialized connection may fail, only the races matter
+		go func(i int) {
+			defer wg.Done()
+			w.runOverSSH(fmt.Sprintf("hostname %d", i), false)
+		}(i)
+		go func() {
+			defer wg.Done()
+			if ftp, err := w.ssh().sftp(); err == nil {
+				ftp.ReadDir(dir)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			w.Reinitialize()
+			w.hostAttribute()
+		}()
+	}
+	wg.Wait()
+
+	out, err := w.runOverSSH("hostname", false)
+	require.NoError(t, err)
+	assert.Equal(t, "hostname", out)
+	ftp, err := w.ssh().sftp()
+	require.NoError(t, err)
+	_, err = ftp.ReadDir(dir)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,155 @@
+package e2efw
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/masterzen/winrm"
+)
+
+const (
+	// winRMOptionsEnvVar is the environment variable holding the WinRM options of the VMs, e.g.
+	// timeout=2m,operation-timeout=30s,max-envelope-size=512000
+	winRMOptionsEnvVar = "E2E_WINRM_OPTIONS"
+	// defaultWinRMTimeout is the default time given to the WinRM endpoint to answer. It is high as the Windows Server
+	// image is slow to download.
+	defaultWinRMTimeout = 10 * time.Minute
+	// defaultWinRMOperationTimeout is the default WS-Management operation timeout
+	defaultWinRMOperationTimeout = 60 * time.Second
+	// defaultWinRMMaxEnvelopeSize is the default maximum size in bytes of the WS-Management messages
+	defaultWinRMMaxEnvelopeSize = 153600
+	// minWinRMMaxEnvelopeSize is the smallest maximum envelope size WS-Management accepts
+	minWinRMMaxEnvelopeSize = 8192
+	// winRMLocale is the locale of the WS-Management messages
+	winRMLocale = "en-US"
+)
+
+// vmWinRMOptions are the WinRM options of the VMs which were not given their own, set from E2E_WINRM_OPTIONS
+var vmWinRMOptions = DefaultWinRMOptions()
+
+// WinRMOptions are the settings of the WinRM client of a VM
+type WinRMOptions struct {
+	// Timeout is the time given to the WinRM endpoint to answer a request before it fails. It is larger than the
+	// operation timeout, as the endpoint waits for up to the operation timeout before answering.
+	Timeout time.Duration
+	// OperationTimeout is the WS-Management operation timeout, the time the endpoint waits for the output of a command
+	// before answering that there is none yet. It is rounded up to the second.
+	OperationTimeout time.Duration
+	// MaxEnvelopeSize is the maximum size in bytes of the WS-Management messages. The output of a command is received
+	// in chunks of at most this size, so large outputs need fewer round trips with a larger one. It cannot be larger
+	// than the MaxEnvelopeSizekb setting of the WinRM service of the VM, 500 KB by default.
+	MaxEnvelopeSize int
+}
+
+// DefaultWinRMOptions returns the WinRM options used unless E2E_WINRM_OPTIONS is set
+func DefaultWinRMOptions() WinRMOptions {
+	return WinRMOptions{
+		Timeout:          defaultWinRMTimeout,
+		OperationTimeout: defaultWinRMOperationTimeout,
+		MaxEnvelopeSize:  defaultWinRMMaxEnvelopeSize,
+	}
+}
+
+// ParseWinRMOptions parses WinRM options given as comma separated timeout=<duration>,
+// operation-timeout=<duration> and max-envelope-size=<bytes> fields, e.g. timeout=2m,max-envelope-size=512000. The
+// fields which are not given keep their default.
+func ParseWinRMOptions(spec string) (WinRMOptions, error) {
+	options := DefaultWinRMOptions()
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return options, fmt.Errorf("invalid WinRM option %q, expected <name>=<value>", field)
+		}
+		var err error
+		switch parts[0] {
+		case "timeout":
+			options.Timeout, err = time.ParseDuration(parts[1])
+		case "operation-timeout":
+			options.OperationTimeout, err = time.ParseDuration(parts[1])
+		case "max-envelope-size":
+			options.MaxEnvelopeSize, err = strconv.Atoi(parts[1])
+		default:
+			return options, fmt.Errorf("unknown WinRM option %q, expected timeout, operation-timeout or "+
+				"max-envelope-size", parts[0])
+		}
+		if err != nil {
+			return options, fmt.Errorf("invalid WinRM option %s: %v", parts[0], err)
+		}
+	}
+	return options, options.Validate()
+}
+
+// Validate returns an error if the WinRM options cannot be used
+func (o WinRMOptions) Validate() error {
+	if o.OperationTimeout < time.Second {
+		return fmt.Errorf("WinRM operation timeout %v is shorter than a second", o.OperationTimeout)
+	}
+	if o.Timeout <= o.OperationTimeout {
+		return fmt.Errorf("WinRM timeout %v is not longer than the operation timeout %v", o.Timeout,
+			o.OperationTimeout)
+	}
+	if o.MaxEnvelopeSize < minWinRMMaxEnvelopeSize {
+		return fmt.Errorf("WinRM maximum envelope size %d is smaller than %d bytes", o.MaxEnvelopeSize,
+			minWinRMMaxEnvelopeSize)
+	}
+	return nil
+}
+
+// String returns the WinRM options in the format of ParseWinRMOptions
+func (o WinRMOptions) String() string {
+	return fmt.Sprintf("timeout=%v,operation-timeout=%v,max-envelope-size=%d", o.Timeout, o.OperationTimeout,
+		o.MaxEnvelopeSize)
+}
+
+// parameters returns the parameters of the WinRM client of the options, with the operation timeout as an ISO 8601
+// duration
+func (o WinRMOptions) parameters() *winrm.Parameters {
+	seconds := int64(math.Ceil(o.OperationTimeout.Seconds()))
+	return winrm.NewParameters("PT"+strconv.FormatInt(seconds, 10)+"S", winRMLocale, o.MaxEnvelopeSize)
+}
+
+// winRMOptionsFromEnv returns the WinRM options given by E2E_WINRM_OPTIONS, the defaults if not set
+func winRMOptionsFromEnv() (WinRMOptions, error) {
+	spec := strings.TrimSpace(os.Getenv(winRMOptionsEnvVar))
+	if spec == "" {
+		return DefaultWinRMOptions(), nil
+	}
+	options, err := ParseWinRMOptions(spec)
+	if err != nil {
+		return options, fmt.Errorf("invalid %s: %v", winRMOptionsEnvVar, err)
+	}
+	return options, nil
+}
+
+// SetWinRMOptions changes the WinRM options of the Windows VM and reconnects to it with them. The VM gets the options
+// given by E2E_WINRM_OPTIONS, as tuned to its WinRM endpoint, back if the options are nil.
+func SetWinRMOptions(vm WindowsVM, options *WinRMOptions) error {
+	return vm.handle().setWinRMOptions(options)
+}
+
+// setWinRMOptions implements SetWinRMOptions
+func (w *windowsVM) setWinRMOptions(options *WinRMOptions) error {
+	if options != nil {
+		if err := options.Validate(); err != nil {
+			return err
+		}
+	}
+	w.winRM = options
+	return w.setupWinRMClient()
+}
+
+// winRMOptions returns the WinRM options of the Windows VM: its own, or else the ones given by E2E_WINRM_OPTIONS tuned to
+// its WinRM endpoint
+func (w *windowsVM) winRMOptions() WinRMOptions {
+	if w.winRM != nil {
+		return *w.winRM
+	}
+	if w.tunedWinRM != nil {
+		return *w.tunedWinRM
+	}
+	return vmWinRMOptions
+}
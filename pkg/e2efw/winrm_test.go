@@ -0,0 +1,66 @@
+package e2efw
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseWinRMOptions tests the parsing and validation of the WinRM options
+func TestParseWinRMOptions(t *testing.T) {
+	options, err := ParseWinRMOptions("timeout=2m, operation-timeout=1500ms,max-envelope-size=512000")
+	require.NoError(t, err)
+	assert.Equal(t, WinRMOptions{Timeout: 2 * time.Minute, OperationTimeout: 1500 * time.Millisecond,
+		MaxEnvelopeSize: 512000}, options)
+	assert.Equal(t, "PT2S", options.parameters().Timeout, "operation timeout should be rounded up to the second")
+	assert.Equal(t, 512000, options.parameters().EnvelopeSize)
+	parsed, err := ParseWinRMOptions(options.String())
+	require.NoError(t, err)
+	assert.Equal(t, options, parsed)
+
+	options, err = ParseWinRMOptions("max-envelope-size=512000")
+	require.NoError(t, err)
+	assert.Equal(t, defaultWinRMTimeout, options.Timeout, "options not given should keep their default")
+	assert.Equal(t, "PT60S", options.parameters().Timeout)
+
+	for _, spec := range []string{"", "timeout", "timeout=soon", "retries=3", "max-envelope-size=1024",
+		"operation-timeout=100ms", "timeout=30s,operation-timeout=1m"} {
+		_, err = ParseWinRMOptions(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestWinRMOptionsFromEnv tests that the WinRM options default when E2E_WINRM_OPTIONS is not set
+func TestWinRMOptionsFromEnv(t *testing.T) {
+	defer os.Setenv(winRMOptionsEnvVar, os.Getenv(winRMOptionsEnvVar))
+
+	require.NoError(t, os.Setenv(winRMOptionsEnvVar, ""))
+	options, err := winRMOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultWinRMOptions(), options)
+
+	require.NoError(t, os.Setenv(winRMOptionsEnvVar, "timeout=90s"))
+	options, err = winRMOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, options.Timeout)
+
+	require.NoError(t, os.Setenv(winRMOptionsEnvVar, "timeout=1s"))
+	_, err = winRMOptionsFromEnv()
+	assert.Error(t, err)
+}
+
+// TestSetWinRMOptions tests that the WinRM options of a VM override the ones of E2E_WINRM_OPTIONS until they are reset
+func TestSetWinRMOptions(t *testing.T) {
+	w := &windowsVM{}
+	assert.Equal(t, vmWinRMOptions, w.winRMOptions())
+
+	assert.Error(t, w.setWinRMOptions(&WinRMOptions{Timeout: time.Second}))
+	assert.Nil(t, w.winRM, "invalid options should not be set")
+
+	options := WinRMOptions{Timeout: time.Minute, OperationTimeout: 20 * time.Second, MaxEnvelopeSize: 512000}
+	w.winRM = &options
+	assert.Equal(t, options, w.winRMOptions())
+}
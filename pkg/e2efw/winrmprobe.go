@@ -0,0 +1,224 @@
+package e2efw
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// winRMIdentifyTimeout is the time given to the WinRM endpoint to answer an Identify request, which it answers
+	// without running anything
+	winRMIdentifyTimeout = 30 * time.Second
+	// winRMIdentifyRequest is the WS-Management Identify request, which the endpoint answers with its protocol version
+	// and product
+	winRMIdentifyRequest = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+		`<s:Header/><s:Body><wsmid:Identify/></s:Body></s:Envelope>`
+	// winRMConfigScript prints the WinRM service settings the client options depend on as JSON, with the enabled
+	// authentication methods
+	winRMConfigScript = "$auth = @(Get-ChildItem WSMan:\\localhost\\Service\\Auth | " +
+		"Where-Object { $_.Value -eq 'true' } | ForEach-Object { $_.Name }); " +
+		"@{MaxEnvelopeSizekb = (Get-Item WSMan:\\localhost\\MaxEnvelopeSizekb).Value; " +
+		"MaxTimeoutms = (Get-Item WSMan:\\localhost\\MaxTimeoutms).Value; " +
+		"AllowUnencrypted = (Get-Item WSMan:\\localhost\\Service\\AllowUnencrypted).Value; " +
+		"Auth = $auth} | ConvertTo-Json -Compress"
+)
+
+// WinRMIdentity is the identity and the capabilities of the WinRM endpoint of a Windows VM
+type WinRMIdentity struct {
+	// ProtocolVersion is the WS-Management protocol version of the endpoint, e.g.
+	// http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd
+	ProtocolVersion string
+	// ProductVendor is the vendor of the WS-Management implementation, e.g. Microsoft Corporation
+	ProductVendor string
+	// ProductVersion is the version of the OS and of the WS-Management stack, e.g. OS: 0.0.0 SP: 0.0 Stack: 3.0
+	ProductVersion string
+	// MaxEnvelopeSize is the largest WS-Management message in bytes the service accepts, 0 if it is unknown
+	MaxEnvelopeSize int
+	// MaxTimeout is the longest operation timeout the service accepts, 0 if it is unknown
+	MaxTimeout time.Duration
+	// AuthMethods are the authentication methods enabled on the service, e.g. Basic and Negotiate
+	AuthMethods []string
+	// AllowUnencrypted is true if the service accepts unencrypted messages over HTTP
+	AllowUnencrypted bool
+}
+
+// String returns the product, protocol and limits of the endpoint
+func (i *WinRMIdentity) String() string {
+	return fmt.Sprintf("%s %s, protocol %s, max envelope size %d, max timeout %v, auth %s", i.ProductVendor,
+		i.ProductVersion, i.ProtocolVersion, i.MaxEnvelopeSize, i.MaxTimeout, strings.Join(i.AuthMethods, ","))
+}
+
+// TuneOptions returns the given WinRM options adjusted to the endpoint: the maximum envelope size is raised to the
+// largest the service accepts, or only lowered to it if the given size is kept, and the operation timeout is capped at
+// the longest one the service accepts. The given options are returned as is if the adjusted ones are not valid.
+func (i *WinRMIdentity) TuneOptions(options WinRMOptions, keepEnvelopeSize bool) WinRMOptions {
+	tuned := options
+	if i.MaxEnvelopeSize > 0 && (!keepEnvelopeSize || tuned.MaxEnvelopeSize > i.MaxEnvelopeSize) {
+		tuned.MaxEnvelopeSize = i.MaxEnvelopeSize
+	}
+	// The operation timeout is rounded up to the second when sent, so it is capped at a whole number of seconds
+	if i.MaxTimeout > 0 && tuned.OperationTimeout > i.MaxTimeout {
+		tuned.OperationTimeout = i.MaxTimeout.Truncate(time.Second)
+	}
+	if tuned.Validate() != nil {
+		return options
+	}
+	return tuned
+}
+
+// identifyResponse is the body of the answer to the WS-Management Identify request
+type identifyResponse struct {
+	ProtocolVersion string `xml:"Body>IdentifyResponse>ProtocolVersion"`
+	ProductVendor   string `xml:"Body>IdentifyResponse>ProductVendor"`
+	ProductVersion  string `xml:"Body>IdentifyResponse>ProductVersion"`
+}
+
+// winRMConfig is the output of winRMConfigScript, whose values are strings as in the WSMan: drive
+type winRMConfig struct {
+	MaxEnvelopeSizekb string   `json:"MaxEnvelopeSizekb"`
+	MaxTimeoutms      string   `json:"MaxTimeoutms"`
+	AllowUnencrypted  string   `json:"AllowUnencrypted"`
+	Auth              []string `json:"Auth"`
+}
+
+// IdentifyWinRM sends a WS-Management Identify request to the WinRM endpoint of the Windows VM, and reads the limits
+// and authentication methods of its WinRM service, over WinRM or ssh
+func IdentifyWinRM(vm WindowsVM) (*WinRMIdentity, error) {
+	return vm.handle().identifyWinRM()
+}
+
+// identifyWinRM implements IdentifyWinRM
+func (w *windowsVM) identifyWinRM() (*WinRMIdentity, error) {
+	identity, err := w.identifyEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, err := w.Run(PowerShellScript(winRMConfigScript), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the WinRM configuration of %s: %v, %s",
+			w.GetCredentials().GetIPAddress(), err, stderr)
+	}
+	if err = parseWinRMConfig(stdout, identity); err != nil {
+		return nil, fmt.Errorf("error parsing the WinRM configuration of %s: %v", w.GetCredentials().GetIPAddress(),
+			err)
+	}
+	return identity, nil
+}
+
+// identifyEndpoint sends a WS-Management Identify request to the WinRM endpoint of the Windows VM and returns its
+// protocol version and product. The endpoint answers without opening a shell, so it is a cheap check that it is up and
+// accepts the credentials of the VM.
+func (w *windowsVM) identifyEndpoint() (*WinRMIdentity, error) {
+	scheme := "https"
+	if w.endpoint.winRMOverHTTP() {
+		scheme = "http"
+	}
+	host := w.GetCredentials().GetIPAddress()
+	url := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(w.endpoint.winRMPort())) + "/wsman"
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(winRMIdentifyRequest))
+	if err != nil {
+		return nil, fmt.Errorf("error creating the WinRM Identify request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	request.SetBasicAuth(w.userName(), w.GetCredentials().GetPassword())
+	// The certificate of the WinRM listener is self-signed, as for the WinRM client of the VM
+	client := &http.Client{
+		Timeout: winRMIdentifyTimeout,
+		Transport: &http.Transport{
+			Dial:              w.getLink().dial,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error identifying the WinRM endpoint of %s: %v", host, err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the WinRM Identify response of %s: %v", host, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("WinRM endpoint of %s answered the Identify request with %s", host, response.Status)
+	}
+	identity, err := parseIdentifyResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the WinRM Identify response of %s: %v", host, err)
+	}
+	return identity, nil
+}
+
+// parseIdentifyResponse parses the answer to the WS-Management Identify request
+func parseIdentifyResponse(body []byte) (*WinRMIdentity, error) {
+	var response identifyResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.ProtocolVersion == "" {
+		return nil, fmt.Errorf("no protocol version in %q", body)
+	}
+	return &WinRMIdentity{ProtocolVersion: response.ProtocolVersion, ProductVendor: response.ProductVendor,
+		ProductVersion: response.ProductVersion}, nil
+}
+
+// parseWinRMConfig parses the output of winRMConfigScript into the given identity
+func parseWinRMConfig(out string, identity *WinRMIdentity) error {
+	var config winRMConfig
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &config); err != nil {
+		return err
+	}
+	sizeKB, err := strconv.Atoi(config.MaxEnvelopeSizekb)
+	if err != nil {
+		return fmt.Errorf("invalid MaxEnvelopeSizekb %q", config.MaxEnvelopeSizekb)
+	}
+	timeoutMS, err := strconv.Atoi(config.MaxTimeoutms)
+	if err != nil {
+		return fmt.Errorf("invalid MaxTimeoutms %q", config.MaxTimeoutms)
+	}
+	identity.MaxEnvelopeSize = sizeKB * 1024
+	identity.MaxTimeout = time.Duration(timeoutMS) * time.Millisecond
+	identity.AuthMethods = config.Auth
+	identity.AllowUnencrypted = strings.EqualFold(config.AllowUnencrypted, "true")
+	return nil
+}
+
+// tuneWinRMOptions adjusts the WinRM options given by E2E_WINRM_OPTIONS to the WinRM endpoint of the Windows VM and
+// reconnects with them if they changed, unless the VM was given its own options. The maximum envelope size given by
+// E2E_WINRM_OPTIONS is kept if it fits. The failures are logged, as the VM is usable with the options as given.
+func (w *windowsVM) tuneWinRMOptions() {
+	if w.winRM != nil {
+		return
+	}
+	identity, err := w.identifyWinRM()
+	if err != nil {
+		log.Printf("keeping the WinRM options of %s: %v", w.GetCredentials().GetIPAddress(), err)
+		return
+	}
+	log.Printf("WinRM endpoint of %s: %v", w.GetCredentials().GetIPAddress(), identity)
+	options := identity.TuneOptions(vmWinRMOptions, winRMEnvelopeSizeGiven())
+	if options == w.winRMOptions() {
+		return
+	}
+	log.Printf("using WinRM options %v for %s", options, w.GetCredentials().GetIPAddress())
+	w.tunedWinRM = &options
+	if err := w.setupWinRMClient(); err != nil {
+		log.Printf("error reconnecting to %s with the tuned WinRM options: %v", w.GetCredentials().GetIPAddress(), err)
+	}
+}
+
+// winRMEnvelopeSizeGiven returns true if E2E_WINRM_OPTIONS sets the maximum envelope size
+func winRMEnvelopeSizeGiven() bool {
+	return strings.Contains(os.Getenv(winRMOptionsEnvVar), "max-envelope-size=")
+}
@@ -0,0 +1,108 @@
+package e2efw
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identifyResponseBody is the answer of Windows Server 2019 to the Identify request
+const identifyResponseBody = `<s:Envelope xml:lang="en-US" xmlns:s="http://www.w3.org/2003/05/soap-envelope">` +
+	`<s:Header/><s:Body><wsmid:IdentifyResponse ` +
+	`xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+	`<wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion>` +
+	`<wsmid:ProductVendor>Microsoft Corporation</wsmid:ProductVendor>` +
+	`<wsmid:ProductVersion>OS: 0.0.0 SP: 0.0 Stack: 3.0</wsmid:ProductVersion>` +
+	`</wsmid:IdentifyResponse></s:Body></s:Envelope>`
+
+// TestIdentifyWinRM tests that the Identify request is sent with the credentials of the VM, and its answer parsed
+func TestIdentifyWinRM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		user, password, ok := r.BasicAuth()
+		if r.URL.Path != "/wsman" || !ok || user != "Administrator" || password != "secret" ||
+			string(body) != winRMIdentifyRequest {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(identifyResponseBody))
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	w := &windowsVM{
+		credentials: types.NewCredentials("i-0123456789abcdef0", host, "secret", "Administrator"),
+		endpoint:    &vmEndpoint{winRMPortOverride: portNumber, winRMHTTP: true},
+		link:        newLink(nil),
+	}
+	identity, err := w.identifyEndpoint()
+	require.NoError(t, err)
+	assert.Equal(t, &WinRMIdentity{ProtocolVersion: "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd",
+		ProductVendor: "Microsoft Corporation", ProductVersion: "OS: 0.0.0 SP: 0.0 Stack: 3.0"}, identity)
+
+	w.credentials = types.NewCredentials("i-0123456789abcdef0", host, "wrong", "Administrator")
+	_, err = w.identifyEndpoint()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+}
+
+// TestParseIdentifyResponse tests that an answer without a protocol version is rejected
+func TestParseIdentifyResponse(t *testing.T) {
+	for _, body := range []string{"", "<html>Bad Gateway</html>", "<s:Envelope><s:Body/></s:Envelope>"} {
+		_, err := parseIdentifyResponse([]byte(body))
+		assert.Error(t, err, body)
+	}
+}
+
+// TestParseWinRMConfig tests the parsing of the limits and authentication methods of the WinRM service
+func TestParseWinRMConfig(t *testing.T) {
+	identity := &WinRMIdentity{}
+	require.NoError(t, parseWinRMConfig(`{"MaxTimeoutms":"60000","AllowUnencrypted":"false",`+
+		`"Auth":["Basic","Negotiate","CredSSP"],"MaxEnvelopeSizekb":"500"}`+"\r\n", identity))
+	assert.Equal(t, &WinRMIdentity{MaxEnvelopeSize: 512000, MaxTimeout: time.Minute,
+		AuthMethods: []string{"Basic", "Negotiate", "CredSSP"}}, identity)
+
+	for _, out := range []string{"", `{"MaxEnvelopeSizekb":"large","MaxTimeoutms":"60000"}`,
+		`{"MaxEnvelopeSizekb":"500","MaxTimeoutms":""}`} {
+		assert.Error(t, parseWinRMConfig(out, &WinRMIdentity{}), out)
+	}
+}
+
+// TestTuneWinRMOptions tests that the WinRM options are adjusted to the limits of the WinRM service
+func TestTuneWinRMOptions(t *testing.T) {
+	identity := &WinRMIdentity{MaxEnvelopeSize: 512000, MaxTimeout: 30500 * time.Millisecond}
+	options := DefaultWinRMOptions()
+	tuned := identity.TuneOptions(options, false)
+	assert.Equal(t, WinRMOptions{Timeout: defaultWinRMTimeout, OperationTimeout: 30 * time.Second,
+		MaxEnvelopeSize: 512000}, tuned)
+	assert.Equal(t, defaultWinRMMaxEnvelopeSize, identity.TuneOptions(options, true).MaxEnvelopeSize,
+		"a given envelope size which fits should be kept")
+
+	options.MaxEnvelopeSize = 1024000
+	assert.Equal(t, 512000, identity.TuneOptions(options, true).MaxEnvelopeSize)
+
+	assert.Equal(t, options, (&WinRMIdentity{}).TuneOptions(options, false), "unknown limits should be ignored")
+	assert.Equal(t, options, (&WinRMIdentity{MaxEnvelopeSize: 4096}).TuneOptions(options, false),
+		"invalid options should not be returned")
+}
+
+// TestWinRMEnvelopeSizeGiven tests that the envelope size is only kept when E2E_WINRM_OPTIONS sets it
+func TestWinRMEnvelopeSizeGiven(t *testing.T) {
+	defer os.Setenv(winRMOptionsEnvVar, os.Getenv(winRMOptionsEnvVar))
+	require.NoError(t, os.Setenv(winRMOptionsEnvVar, "timeout=2m"))
+	assert.False(t, winRMEnvelopeSizeGiven())
+	require.NoError(t, os.Setenv(winRMOptionsEnvVar, "timeout=2m,max-envelope-size=512000"))
+	assert.True(t, winRMEnvelopeSizeGiven())
+}
@@ -0,0 +1,251 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+)
+
+/*
+	firewall takes typed snapshots of the Windows Firewall rules of the node and diffs them, so that uninstall can be
+	proven to return the node to the firewall it had before the bootstrap. The diff is also audited against the
+	journal, the firewall being an independent source of the changes WMCB claims to have made: a rule added without
+	being recorded, or recorded without being present, means that the journal, and therefore uninstall, misses part of
+	the footprint of WMCB.
+*/
+
+// Rule is a Windows Firewall rule along with its port, address and application filters
+type Rule struct {
+	// Name is the unique name of the rule
+	Name string `json:"name"`
+	// DisplayName is the name the rule is shown with, which identifies the rules in the journal
+	DisplayName string `json:"displayName"`
+	// Group is the group the rule belongs to, empty if none
+	Group string `json:"group,omitempty"`
+	// Enabled is true if the rule is enforced
+	Enabled bool `json:"enabled"`
+	// Direction is Inbound or Outbound
+	Direction string `json:"direction"`
+	// Action is Allow or Block
+	Action string `json:"action"`
+	// Profile is the profiles the rule applies to, e.g. Any or Domain, Private
+	Profile string `json:"profile"`
+	// Protocol is TCP, UDP, Any or a protocol number
+	Protocol string `json:"protocol,omitempty"`
+	// LocalPort is the comma separated local ports of the rule, e.g. 9182 or Any
+	LocalPort string `json:"localPort,omitempty"`
+	// RemotePort is the comma separated remote ports of the rule
+	RemotePort string `json:"remotePort,omitempty"`
+	// RemoteAddress is the comma separated remote addresses of the rule, e.g. 10.0.0.0/16 or Any
+	RemoteAddress string `json:"remoteAddress,omitempty"`
+	// Program is the program the rule applies to, Any for all of them
+	Program string `json:"program,omitempty"`
+}
+
+// String describes the rule
+func (r Rule) String() string {
+	return fmt.Sprintf("%q (%s)", r.DisplayName, r.Name)
+}
+
+// fields returns the names and values of the fields of the rule compared by Compare
+func (r Rule) fields() [][2]string {
+	return [][2]string{{"displayName", r.DisplayName}, {"group", r.Group}, {"enabled", fmt.Sprint(r.Enabled)},
+		{"direction", r.Direction}, {"action", r.Action}, {"profile", r.Profile}, {"protocol", r.Protocol},
+		{"localPort", r.LocalPort}, {"remotePort", r.RemotePort}, {"remoteAddress", r.RemoteAddress},
+		{"program", r.Program}}
+}
+
+// Snapshot is the set of Windows Firewall rules of the node at a point in time
+type Snapshot struct {
+	// Time is when the snapshot was taken
+	Time time.Time `json:"time"`
+	// Rules are the rules of the node, sorted by name
+	Rules []Rule `json:"rules"`
+}
+
+// snapshotScript is the PowerShell script printing the rules of the node as JSON. Getting the filters once is much
+// faster than getting the filters of each rule, their instance ID is the name of their rule.
+const snapshotScript = "$ports = @{}; " +
+	"Get-NetFirewallPortFilter -All | ForEach-Object { $ports[$_.InstanceID] = $_ }; " +
+	"$addresses = @{}; Get-NetFirewallAddressFilter -All | ForEach-Object { $addresses[$_.InstanceID] = $_ }; " +
+	"$applications = @{}; Get-NetFirewallApplicationFilter -All | " +
+	"ForEach-Object { $applications[$_.InstanceID] = $_ }; " +
+	"ConvertTo-Json -Compress -InputObject @(Get-NetFirewallRule -All | ForEach-Object { " +
+	"$port = $ports[$_.Name]; $address = $addresses[$_.Name]; $application = $applications[$_.Name]; " +
+	"[pscustomobject]@{name = $_.Name; displayName = $_.DisplayName; group = [string]$_.Group; " +
+	"enabled = ([string]$_.Enabled -eq 'True'); direction = [string]$_.Direction; action = [string]$_.Action; " +
+	"profile = [string]$_.Profile; protocol = [string]$port.Protocol; localPort = @($port.LocalPort) -join ','; " +
+	"remotePort = @($port.RemotePort) -join ','; remoteAddress = @($address.RemoteAddress) -join ','; " +
+	"program = [string]$application.Program} })"
+
+// Take returns a snapshot of the Windows Firewall rules of the node
+func Take() (*Snapshot, error) {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		snapshotScript).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the Windows Firewall rules: %v, %s", err, out)
+	}
+	return parseRules(out, time.Now().UTC())
+}
+
+// parseRules parses the rules printed by snapshotScript into a snapshot taken at the given time
+func parseRules(out []byte, taken time.Time) (*Snapshot, error) {
+	snapshot := &Snapshot{Time: taken}
+	if err := json.Unmarshal(out, &snapshot.Rules); err != nil {
+		return nil, fmt.Errorf("could not parse the Windows Firewall rules %s: %v", out, err)
+	}
+	sort.Slice(snapshot.Rules, func(i, j int) bool { return snapshot.Rules[i].Name < snapshot.Rules[j].Name })
+	return snapshot, nil
+}
+
+// Read reads the snapshot written to the given file by Write
+func Read(path string) (*Snapshot, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read firewall snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err = json.Unmarshal(contents, &snapshot); err != nil {
+		return nil, fmt.Errorf("could not parse firewall snapshot %s: %v", path, err)
+	}
+	return &snapshot, nil
+}
+
+// Write writes the snapshot to the given file as JSON
+func (s *Snapshot) Write(path string) error {
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal firewall snapshot: %v", err)
+	}
+	if err = ioutil.WriteFile(path, contents, 0644); err != nil {
+		return fmt.Errorf("could not write firewall snapshot: %v", err)
+	}
+	return nil
+}
+
+// Change is a rule present in both snapshots whose fields differ
+type Change struct {
+	// Before is the rule in the first snapshot
+	Before Rule `json:"before"`
+	// After is the rule in the second snapshot
+	After Rule `json:"after"`
+}
+
+// String describes the fields of the rule that changed
+func (c Change) String() string {
+	var changes []string
+	before, after := c.Before.fields(), c.After.fields()
+	for i := range before {
+		if before[i][1] != after[i][1] {
+			changes = append(changes, fmt.Sprintf("%s %q -> %q", before[i][0], before[i][1], after[i][1]))
+		}
+	}
+	return fmt.Sprintf("%s: %s", c.After, strings.Join(changes, ", "))
+}
+
+// Diff is the difference between two snapshots, each list being sorted by rule name
+type Diff struct {
+	// Added are the rules of the second snapshot that are not in the first one
+	Added []Rule `json:"added,omitempty"`
+	// Removed are the rules of the first snapshot that are not in the second one
+	Removed []Rule `json:"removed,omitempty"`
+	// Changed are the rules of both snapshots whose fields differ
+	Changed []Change `json:"changed,omitempty"`
+}
+
+// Compare returns the difference between the rules of the given snapshots, the rules being matched by name
+func Compare(before, after *Snapshot) *Diff {
+	diff := &Diff{}
+	previous := make(map[string]Rule)
+	for _, rule := range before.Rules {
+		previous[rule.Name] = rule
+	}
+	for _, rule := range after.Rules {
+		old, ok := previous[rule.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, rule)
+		case old != rule:
+			diff.Changed = append(diff.Changed, Change{Before: old, After: rule})
+		}
+		delete(previous, rule.Name)
+	}
+	for _, rule := range previous {
+		diff.Removed = append(diff.Removed, rule)
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].After.Name < diff.Changed[j].After.Name })
+	return diff
+}
+
+// Empty returns true if the snapshots have the same rules
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String describes the diff, a line per rule prefixed with + if it was added, - if it was removed and ~ if it changed
+func (d *Diff) String() string {
+	var lines []string
+	for _, rule := range d.Added {
+		lines = append(lines, "+ "+rule.String())
+	}
+	for _, rule := range d.Removed {
+		lines = append(lines, "- "+rule.String())
+	}
+	for _, change := range d.Changed {
+		lines = append(lines, "~ "+change.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Audit compares the firewall rules the journal entries record with the difference between the given snapshots, the
+// first one taken before the changes were made, and returns the discrepancies: the rules added, removed or changed
+// without being recorded, and the rules recorded as present that are not. Rules are identified by their display name
+// in the journal.
+func Audit(before, after *Snapshot, entries []journal.Entry) []string {
+	recorded := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Kind == journal.FirewallRule {
+			recorded[strings.ToLower(entry.Target)] = true
+		}
+	}
+	var discrepancies []string
+	diff := Compare(before, after)
+	for _, rule := range diff.Added {
+		if !recorded[strings.ToLower(rule.DisplayName)] {
+			discrepancies = append(discrepancies, fmt.Sprintf("firewall rule %s was added without being recorded",
+				rule))
+		}
+	}
+	for _, rule := range diff.Removed {
+		if !recorded[strings.ToLower(rule.DisplayName)] {
+			discrepancies = append(discrepancies, fmt.Sprintf("firewall rule %s was removed without being recorded",
+				rule))
+		}
+	}
+	for _, change := range diff.Changed {
+		if !recorded[strings.ToLower(change.After.DisplayName)] {
+			discrepancies = append(discrepancies, fmt.Sprintf("firewall rule %s was changed without being recorded",
+				change))
+		}
+	}
+
+	present := make(map[string]bool)
+	for _, rule := range after.Rules {
+		present[strings.ToLower(rule.DisplayName)] = true
+	}
+	for _, entry := range journal.Footprint(entries) {
+		if entry.Kind == journal.FirewallRule && !present[strings.ToLower(entry.Target)] {
+			discrepancies = append(discrepancies, fmt.Sprintf("firewall rule %q is recorded but not present",
+				entry.Target))
+		}
+	}
+	return discrepancies
+}
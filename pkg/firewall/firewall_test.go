@@ -0,0 +1,101 @@
+package firewall
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exporterRule is the rule opening the port of windows_exporter
+var exporterRule = Rule{Name: "OpenShift windows_exporter", DisplayName: "OpenShift windows_exporter",
+	Enabled: true, Direction: "Inbound", Action: "Allow", Profile: "Any", Protocol: "TCP", LocalPort: "9182",
+	RemotePort: "Any", RemoteAddress: "Any", Program: "Any"}
+
+// winRMRule is the rule opening the port of WinRM over HTTPS
+var winRMRule = Rule{Name: "WINRM-HTTPS-In-TCP", DisplayName: "Windows Remote Management (HTTPS-In)",
+	Group: "Windows Remote Management", Enabled: true, Direction: "Inbound", Action: "Allow", Profile: "Any",
+	Protocol: "TCP", LocalPort: "5986", RemotePort: "Any", RemoteAddress: "Any", Program: "System"}
+
+// TestParseRules tests the parsing of the rules printed by the snapshot script
+func TestParseRules(t *testing.T) {
+	taken := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	snapshot, err := parseRules([]byte(`[{"name":"WINRM-HTTPS-In-TCP",`+
+		`"displayName":"Windows Remote Management (HTTPS-In)",`+
+		`"group":"Windows Remote Management","enabled":true,"direction":"Inbound","action":"Allow","profile":"Any",`+
+		`"protocol":"TCP","localPort":"5986","remotePort":"Any","remoteAddress":"Any","program":"System"},`+
+		`{"name":"OpenShift windows_exporter","displayName":"OpenShift windows_exporter","group":"",`+
+		`"enabled":true,"direction":"Inbound","action":"Allow","profile":"Any","protocol":"TCP","localPort":"9182",`+
+		`"remotePort":"Any","remoteAddress":"Any","program":"Any"}]`), taken)
+	require.NoError(t, err)
+	assert.Equal(t, &Snapshot{Time: taken, Rules: []Rule{exporterRule, winRMRule}}, snapshot,
+		"the rules are not sorted by name")
+
+	snapshot, err = parseRules([]byte("[]"), taken)
+	require.NoError(t, err)
+	assert.Empty(t, snapshot.Rules)
+
+	_, err = parseRules([]byte("Get-NetFirewallRule : Access is denied."), taken)
+	assert.Error(t, err)
+}
+
+// TestCompare tests that the rules added, removed and changed between two snapshots are reported
+func TestCompare(t *testing.T) {
+	before := &Snapshot{Rules: []Rule{winRMRule}}
+	assert.True(t, Compare(before, before).Empty())
+
+	restricted := winRMRule
+	restricted.RemoteAddress = "10.0.0.0/16"
+	diff := Compare(before, &Snapshot{Rules: []Rule{exporterRule, restricted}})
+	assert.Equal(t, &Diff{Added: []Rule{exporterRule}, Changed: []Change{{Before: winRMRule, After: restricted}}}, diff)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, `+ "OpenShift windows_exporter" (OpenShift windows_exporter)`+"\n"+
+		`~ "Windows Remote Management (HTTPS-In)" (WINRM-HTTPS-In-TCP): remoteAddress "Any" -> "10.0.0.0/16"`,
+		diff.String())
+
+	diff = Compare(&Snapshot{Rules: []Rule{exporterRule, winRMRule}}, before)
+	assert.Equal(t, &Diff{Removed: []Rule{exporterRule}}, diff)
+	assert.Equal(t, `- "OpenShift windows_exporter" (OpenShift windows_exporter)`, diff.String())
+}
+
+// TestReadWrite tests that a written snapshot is read back unchanged
+func TestReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "firewall")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "firewall.json")
+	_, err = Read(path)
+	assert.Error(t, err, "missing snapshot read")
+
+	snapshot := &Snapshot{Time: time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC), Rules: []Rule{exporterRule, winRMRule}}
+	require.NoError(t, snapshot.Write(path))
+	read, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, read)
+}
+
+// TestAudit tests that the firewall rules changed without being recorded in the journal, and the ones recorded
+// without being present, are reported
+func TestAudit(t *testing.T) {
+	before := &Snapshot{Rules: []Rule{winRMRule}}
+	after := &Snapshot{Rules: []Rule{exporterRule, winRMRule}}
+	recorded := []journal.Entry{{Command: "initialize-kubelet", Action: journal.Created, Kind: journal.FirewallRule,
+		Target: "openshift WINDOWS_EXPORTER"}}
+	assert.Empty(t, Audit(before, after, recorded))
+
+	assert.Equal(t, []string{`firewall rule "OpenShift windows_exporter" ` +
+		`(OpenShift windows_exporter) was added without being recorded`}, Audit(before, after, nil))
+
+	// A rule recorded as created is expected to be present, unless it was recorded as removed since
+	assert.Equal(t, []string{`firewall rule "openshift WINDOWS_EXPORTER" is recorded but not present`},
+		Audit(before, before, recorded))
+	removed := append(recorded, journal.Entry{Command: "uninstall", Action: journal.Removed,
+		Kind: journal.FirewallRule, Target: "OpenShift windows_exporter"})
+	assert.Empty(t, Audit(before, before, removed))
+}
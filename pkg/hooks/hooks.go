@@ -0,0 +1,205 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	hooks runs the PowerShell scripts cluster admins drop on the node to run site-specific steps, like installing an
+	antivirus agent or trusting the certificate of a proxy, at defined points of the bootstrap without forking WMCB.
+	The scripts of a point live in the directory of the point under the hooks directory, e.g.
+	C:\k\hooks\post-kubelet-install\10-antivirus.ps1, and run in the lexical order of their names. They have to be
+	signed by a publisher trusted by the node unless unsigned hooks are allowed.
+*/
+
+// Point is a point of the bootstrap at which hooks run
+type Point string
+
+const (
+	// PreDownload runs before fetch-payload downloads the artifacts of the node
+	PreDownload Point = "pre-download"
+	// PostKubeletInstall runs once initialize-kubelet has installed and started the kubelet service
+	PostKubeletInstall Point = "post-kubelet-install"
+	// PostJoin runs once configure-cni has configured the network of the node, which lets it join the cluster
+	PostJoin Point = "post-join"
+)
+
+const (
+	// DefaultTimeout is the time a hook script is given to complete by default
+	DefaultTimeout = 10 * time.Minute
+	// PointEnvVar is the environment variable holding the point the hook script runs at
+	PointEnvVar = "WMCB_HOOK_POINT"
+	// scriptExtension is the extension of the hook scripts, the other files of the directory of a point are ignored
+	scriptExtension = ".ps1"
+	// maxErrorOutput is the number of bytes of the output of a failed hook script included in its error
+	maxErrorOutput = 1024
+)
+
+// Runner runs the hook scripts of the points of the bootstrap
+type Runner struct {
+	// dir is the hooks directory, holding a directory for each point
+	dir string
+	// logDir is the directory the output of the hook scripts is written to
+	logDir string
+	// timeout is the time each hook script is given to complete
+	timeout time.Duration
+	// allowUnsigned runs the hook scripts without checking their signature
+	allowUnsigned bool
+	// verify returns an error if the given script is not signed by a trusted publisher, replaced in tests
+	verify func(script string) error
+	// command returns the command running the given script, replaced in tests
+	command func(ctx context.Context, script string, allowUnsigned bool) *exec.Cmd
+}
+
+// NewRunner returns the Runner of the hook scripts of the given hooks directory, which writes their output to the given
+// log directory and gives each of them the given timeout to complete. If allowUnsigned is true, the signature of the
+// scripts is not checked, which should only be used to develop hooks.
+func NewRunner(dir, logDir string, timeout time.Duration, allowUnsigned bool) (*Runner, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid hook timeout %s, expected a positive duration", timeout)
+	}
+	return &Runner{
+		dir:           dir,
+		logDir:        logDir,
+		timeout:       timeout,
+		allowUnsigned: allowUnsigned,
+		verify:        verifySignature,
+		command:       powershellCommand,
+	}, nil
+}
+
+// Scripts returns the paths of the hook scripts of the given point, in the order they run. There are none if the
+// directory of the point does not exist.
+func (r *Runner) Scripts(point Point) ([]string, error) {
+	pointDir := filepath.Join(r.dir, string(point))
+	entries, err := ioutil.ReadDir(pointDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read hooks directory %s: %v", pointDir, err)
+	}
+	var scripts []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), scriptExtension) {
+			continue
+		}
+		scripts = append(scripts, filepath.Join(pointDir, entry.Name()))
+	}
+	sort.Strings(scripts)
+	return scripts, nil
+}
+
+// Run runs the hook scripts of the given point in order, stopping at the first one that fails. The output of each
+// script is appended to <log dir>\hooks-<point>-<script>.log.
+func (r *Runner) Run(point Point) error {
+	scripts, err := r.Scripts(point)
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		if err = r.runScript(point, script); err != nil {
+			return fmt.Errorf("%s hook %s failed: %v", point, filepath.Base(script), err)
+		}
+	}
+	return nil
+}
+
+// runScript runs the given hook script of the given point
+func (r *Runner) runScript(point Point, script string) error {
+	if !r.allowUnsigned {
+		if err := r.verify(script); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(r.logDir, os.ModeDir); err != nil {
+		return fmt.Errorf("could not create log directory %s: %v", r.logDir, err)
+	}
+	logPath := filepath.Join(r.logDir, logFileName(point, script))
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log file %s: %v", logPath, err)
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "--- %s %s hook %s\n", time.Now().UTC().Format(time.RFC3339), point, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := r.command(ctx, script, r.allowUnsigned)
+	cmd.Env = append(os.Environ(), PointEnvVar+"="+string(point))
+	tail := &tailWriter{max: maxErrorOutput}
+	cmd.Stdout = io.MultiWriter(logFile, tail)
+	cmd.Stderr = cmd.Stdout
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s, see %s: %s", r.timeout, logPath, tail)
+	}
+	if err != nil {
+		return fmt.Errorf("%v, see %s: %s", err, logPath, tail)
+	}
+	return nil
+}
+
+// logFileName returns the name of the log file of the given hook script of the given point
+func logFileName(point Point, script string) string {
+	name := strings.TrimSuffix(filepath.Base(script), filepath.Ext(script))
+	return fmt.Sprintf("hooks-%s-%s.log", point, name)
+}
+
+// verifySignature returns an error if the given script does not have a valid Authenticode signature of a publisher
+// trusted by the node
+func verifySignature(script string) error {
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"(Get-AuthenticodeSignature -LiteralPath '"+strings.Replace(script, "'", "''", -1)+"').Status").
+		CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not check signature: %v, %s", err, out)
+	}
+	if status := strings.TrimSpace(string(out)); status != "Valid" {
+		return fmt.Errorf("signature status is %s, expected Valid", status)
+	}
+	return nil
+}
+
+// powershellCommand returns the command running the given script. Scripts are run with the AllSigned execution policy
+// unless unsigned scripts are allowed, so that PowerShell checks the signature of the scripts they call as well.
+func powershellCommand(ctx context.Context, script string, allowUnsigned bool) *exec.Cmd {
+	policy := "AllSigned"
+	if allowUnsigned {
+		policy = "Bypass"
+	}
+	return exec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", policy,
+		"-File", script)
+}
+
+// tailWriter keeps the last max bytes written to it
+type tailWriter struct {
+	// max is the number of bytes kept
+	max int
+	// buf holds the bytes kept
+	buf bytes.Buffer
+}
+
+// Write keeps the last bytes of p
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - t.max; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept, trimmed of white space
+func (t *tailWriter) String() string {
+	return strings.TrimSpace(t.buf.String())
+}
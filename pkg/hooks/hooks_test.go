@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRunner returns a Runner of the hooks of a temporary directory which runs the scripts with sh, and the hooks
+// directory. The scripts named unsigned-* fail the signature check.
+func testRunner(t *testing.T, timeout time.Duration, allowUnsigned bool) (*Runner, string) {
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	runner, err := NewRunner(filepath.Join(dir, "hooks"), filepath.Join(dir, "log"), timeout, allowUnsigned)
+	require.NoError(t, err)
+	runner.verify = func(script string) error {
+		if strings.HasPrefix(filepath.Base(script), "unsigned-") {
+			return fmt.Errorf("signature status is NotSigned, expected Valid")
+		}
+		return nil
+	}
+	runner.command = func(ctx context.Context, script string, _ bool) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", script)
+	}
+	return runner, filepath.Join(dir, "hooks")
+}
+
+// writeHook writes a hook script of the given point
+func writeHook(t *testing.T, hooksDir string, point Point, name, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(hooksDir, string(point)), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(hooksDir, string(point), name), []byte(contents), 0644))
+}
+
+// TestScripts tests that only the PowerShell scripts of the point are run, in the lexical order of their names
+func TestScripts(t *testing.T) {
+	runner, hooksDir := testRunner(t, time.Minute, false)
+	scripts, err := runner.Scripts(PreDownload)
+	require.NoError(t, err)
+	assert.Empty(t, scripts)
+
+	writeHook(t, hooksDir, PostKubeletInstall, "20-proxy.ps1", "")
+	writeHook(t, hooksDir, PostKubeletInstall, "10-antivirus.PS1", "")
+	writeHook(t, hooksDir, PostKubeletInstall, "README.md", "")
+	writeHook(t, hooksDir, PostJoin, "10-other.ps1", "")
+	require.NoError(t, os.MkdirAll(filepath.Join(hooksDir, string(PostKubeletInstall), "lib.ps1"), 0755))
+	scripts, err = runner.Scripts(PostKubeletInstall)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(hooksDir, string(PostKubeletInstall), "10-antivirus.PS1"),
+		filepath.Join(hooksDir, string(PostKubeletInstall), "20-proxy.ps1")}, scripts)
+}
+
+// TestRun tests that the hooks run in order with their point, and that their output is logged
+func TestRun(t *testing.T) {
+	runner, hooksDir := testRunner(t, time.Minute, false)
+	writeHook(t, hooksDir, PostJoin, "10-first.ps1", "echo first $"+PointEnvVar)
+	writeHook(t, hooksDir, PostJoin, "20-second.ps1", "echo second >&2")
+	require.NoError(t, runner.Run(PostJoin))
+	require.NoError(t, runner.Run(PostJoin))
+
+	out, err := ioutil.ReadFile(filepath.Join(runner.logDir, "hooks-post-join-10-first.log"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^--- \S+ post-join hook \S+10-first.ps1\nfirst post-join\n--- .*\nfirst post-join\n$`,
+		string(out))
+	out, err = ioutil.ReadFile(filepath.Join(runner.logDir, "hooks-post-join-20-second.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "second\n")
+}
+
+// TestRunFailure tests that the hooks stop at the first failure, reporting the end of its output
+func TestRunFailure(t *testing.T) {
+	runner, hooksDir := testRunner(t, time.Minute, false)
+	writeHook(t, hooksDir, PreDownload, "10-fail.ps1", "echo proxy certificate not found; exit 3")
+	writeHook(t, hooksDir, PreDownload, "20-next.ps1", "echo next")
+	err := runner.Run(PreDownload)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-download hook 10-fail.ps1 failed: exit status 3")
+	assert.Contains(t, err.Error(), "proxy certificate not found")
+	_, err = os.Stat(filepath.Join(runner.logDir, "hooks-pre-download-20-next.log"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestRunTimeout tests that a hook is stopped once its timeout is reached
+func TestRunTimeout(t *testing.T) {
+	runner, hooksDir := testRunner(t, 100*time.Millisecond, false)
+	writeHook(t, hooksDir, PostKubeletInstall, "10-hang.ps1", "exec sleep 10")
+	start := time.Now()
+	err := runner.Run(PostKubeletInstall)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 100ms")
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+// TestRunUnsigned tests that unsigned hooks are rejected unless they are allowed
+func TestRunUnsigned(t *testing.T) {
+	runner, hooksDir := testRunner(t, time.Minute, false)
+	writeHook(t, hooksDir, PostJoin, "unsigned-hook.ps1", "echo ran")
+	err := runner.Run(PostJoin)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signature status is NotSigned")
+
+	runner.allowUnsigned = true
+	assert.NoError(t, runner.Run(PostJoin))
+}
+
+// TestNewRunner tests that the hooks are given a positive timeout
+func TestNewRunner(t *testing.T) {
+	_, err := NewRunner("hooks", "log", 0, false)
+	assert.Error(t, err)
+}
+
+// TestTailWriter tests that only the end of the output is kept
+func TestTailWriter(t *testing.T) {
+	tail := &tailWriter{max: 8}
+	fmt.Fprint(tail, "0123456789")
+	fmt.Fprint(tail, "abc\n")
+	assert.Equal(t, "6789abc", tail.String())
+}
@@ -0,0 +1,175 @@
+package ignition
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	ignitionv2 "github.com/coreos/ignition/config/v2_2"
+)
+
+/*
+	ignition fetches the worker ignition file of a Windows node from the Machine Config Server (MCS) of the cluster.
+	The MCS is often not ready yet, or briefly unreachable, when a node is provisioned, so the transient failures, i.e.
+	the connection errors, the timeouts and the 5xx and 429 answers, are retried with an exponential backoff until a
+	deadline, while the others fail at once. The MCS serving certificate is signed by the root CA of the cluster, which
+	the node does not trust yet: the certificate is verified against the given cluster CA only, and verification is
+	skipped only when explicitly asked for. Plain http URLs, which are not authenticated at all, are only allowed when
+	the verification is skipped too.
+*/
+
+const (
+	// acceptHeader asks the MCS for the ignition spec version WMCB parses
+	acceptHeader = "application/vnd.coreos.ignition+json; version=2.2.0"
+	// requestTimeout is the timeout of a single request to the MCS
+	requestTimeout = 30 * time.Second
+	// DefaultTimeout is how long the transient failures are retried for by default
+	DefaultTimeout = 5 * time.Minute
+)
+
+var (
+	// initialBackoff is the wait before the first retry, doubled after each retry
+	initialBackoff = time.Second
+	// maxBackoff is the longest wait between two attempts
+	maxBackoff = 30 * time.Second
+)
+
+// FetchOptions configure the fetch of an ignition file
+type FetchOptions struct {
+	// URL is the URL of the ignition file, e.g. https://api-int.<cluster>:22623/config/worker
+	URL string
+	// CAFile is the PEM file of the CA the certificate of the server is verified against, e.g. the ca.crt of the
+	// root-ca ConfigMap of kube-system. Required for https URLs unless Insecure is set.
+	CAFile string
+	// Insecure skips the verification of the certificate of the server. Required for http URLs.
+	Insecure bool
+	// Timeout is how long the transient failures are retried for, DefaultTimeout if zero
+	Timeout time.Duration
+}
+
+// permanentError is a failure that is not retried
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Fetch writes the ignition file at the URL of the given options to the given path once it was verified to be a
+// valid ignition file, and returns the number of attempts it took
+func Fetch(options FetchOptions, dest string) (int, error) {
+	client, err := newClient(options)
+	if err != nil {
+		return 0, err
+	}
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		contents, err := get(client, options.URL)
+		if err == nil {
+			return attempt, writeFile(contents, dest)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || time.Now().Add(backoff).After(deadline) {
+			return attempt, fmt.Errorf("unable to fetch the ignition file from %s after %d attempts: %v", options.URL,
+				attempt, err)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// newClient returns the HTTP client verifying the certificate of the server as given by the options
+func newClient(options FetchOptions) (*http.Client, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ignition URL %s, expected an http or https URL", options.URL)
+	}
+	if options.Insecure && options.CAFile != "" {
+		return nil, fmt.Errorf("a CA file cannot be given when the certificate verification is skipped")
+	}
+	if u.Scheme == "http" && !options.Insecure {
+		return nil, fmt.Errorf("the ignition server %s cannot be verified over http, unless the verification is "+
+			"skipped", u.Host)
+	}
+	tlsConfig := &tls.Config{}
+	switch {
+	case options.Insecure:
+		tlsConfig.InsecureSkipVerify = true
+	case options.CAFile != "":
+		contents, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA file: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no PEM certificate in the CA file %s", options.CAFile)
+		}
+	case u.Scheme == "https":
+		return nil, fmt.Errorf("the CA of the cluster is required to verify %s, unless the verification is skipped",
+			u.Host)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: requestTimeout}, nil
+}
+
+// get returns the ignition file at the given URL, failing with a permanentError if retrying would not help
+func get(client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := client.Do(req)
+	if err != nil {
+		// An untrusted certificate stays untrusted
+		var unknownAuthority x509.UnknownAuthorityError
+		var invalid x509.CertificateInvalidError
+		var hostname x509.HostnameError
+		if errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname) {
+			return nil, &permanentError{err}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	default:
+		return nil, &permanentError{fmt.Errorf("GET %s returned %s", url, resp.Status)}
+	}
+	if _, _, err = ignitionv2.Parse(contents); err != nil {
+		return nil, &permanentError{fmt.Errorf("invalid ignition file: %v", err)}
+	}
+	return contents, nil
+}
+
+// writeFile writes the given contents to the given path, through a temporary file so that an interrupted write does
+// not leave a truncated ignition file behind
+func writeFile(contents []byte, dest string) error {
+	tmp := dest + ".partial"
+	if err := ioutil.WriteFile(tmp, contents, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", dest, err)
+	}
+	return os.Rename(tmp, dest)
+}
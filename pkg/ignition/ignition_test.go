@@ -0,0 +1,162 @@
+package ignition
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// workerIgnition is a minimal worker ignition file
+const workerIgnition = `{"ignition":{"version":"2.2.0"},"storage":{},"systemd":{}}`
+
+// newServer returns an MCS answering with the given status codes in turn, then with the worker ignition, and the path
+// of its CA file in the given directory
+func newServer(t *testing.T, dir string, statuses ...int) (*httptest.Server, string, *int32) {
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, acceptHeader, r.Header.Get("Accept"))
+		if i := int(atomic.AddInt32(&requests, 1)) - 1; i < len(statuses) {
+			w.WriteHeader(statuses[i])
+			return
+		}
+		w.Write([]byte(workerIgnition))
+	}))
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+	return server, caFile, &requests
+}
+
+// writeOtherCA writes a self-signed CA unrelated to the test servers to the given path
+func writeOtherCA(t *testing.T, path string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "other-ca"},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+}
+
+// setBackoff shortens the backoff until the returned function is called
+func setBackoff() func() {
+	initial, max := initialBackoff, maxBackoff
+	initialBackoff, maxBackoff = time.Millisecond, 4*time.Millisecond
+	return func() { initialBackoff, maxBackoff = initial, max }
+}
+
+// TestFetch tests that the transient failures are retried and the certificate is verified against the given CA
+func TestFetch(t *testing.T) {
+	defer setBackoff()()
+	dir, err := ioutil.TempDir("", "ignition")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "worker.ign")
+
+	server, caFile, requests := newServer(t, dir, http.StatusInternalServerError, http.StatusServiceUnavailable,
+		http.StatusTooManyRequests)
+	defer server.Close()
+	attempts, err := Fetch(FetchOptions{URL: server.URL + "/config/worker", CAFile: caFile, Timeout: time.Minute}, dest)
+	require.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+	assert.EqualValues(t, 4, atomic.LoadInt32(requests))
+	contents, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, workerIgnition, string(contents))
+	_, err = os.Stat(dest + ".partial")
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestFetchPermanentFailures tests that the failures retrying would not fix are not retried
+func TestFetchPermanentFailures(t *testing.T) {
+	defer setBackoff()()
+	dir, err := ioutil.TempDir("", "ignition")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "worker.ign")
+
+	server, caFile, requests := newServer(t, dir, http.StatusForbidden)
+	defer server.Close()
+	attempts, err := Fetch(FetchOptions{URL: server.URL, CAFile: caFile, Timeout: time.Minute}, dest)
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// The certificate of the server is not trusted by another CA
+	otherCA := filepath.Join(dir, "other-ca.crt")
+	writeOtherCA(t, otherCA)
+	attempts, err = Fetch(FetchOptions{URL: server.URL, CAFile: otherCA, Timeout: time.Minute}, dest)
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.EqualValues(t, 1, atomic.LoadInt32(requests))
+
+	invalid := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>not an ignition file</html>"))
+	}))
+	defer invalid.Close()
+	attempts, err = Fetch(FetchOptions{URL: invalid.URL, Insecure: true, Timeout: time.Minute}, dest)
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	_, err = os.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestFetchDeadline tests that the transient failures are retried until the deadline
+func TestFetchDeadline(t *testing.T) {
+	defer setBackoff()()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "ignition")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	attempts, err := Fetch(FetchOptions{URL: server.URL, Insecure: true, Timeout: 50 * time.Millisecond},
+		filepath.Join(dir, "worker.ign"))
+	assert.Error(t, err)
+	assert.Greater(t, attempts, 1)
+}
+
+// TestFetchOptions tests the validation of the fetch options
+func TestFetchOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignition")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notPEM := filepath.Join(dir, "ca.crt")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0644))
+	tests := []struct {
+		name    string
+		options FetchOptions
+	}{
+		{"no CA", FetchOptions{URL: "https://api-int.cluster.example.com:22623/config/worker"}},
+		{"CA and insecure", FetchOptions{URL: "https://api-int.cluster.example.com:22623/config/worker",
+			CAFile: notPEM, Insecure: true}},
+		{"invalid CA", FetchOptions{URL: "https://api-int.cluster.example.com:22623/config/worker", CAFile: notPEM}},
+		{"missing CA", FetchOptions{URL: "https://api-int.cluster.example.com:22623/config/worker",
+			CAFile: filepath.Join(dir, "missing.crt")}},
+		{"invalid URL", FetchOptions{URL: "api-int.cluster.example.com:22623", Insecure: true}},
+		{"http", FetchOptions{URL: "http://10.0.0.1:22624/config/worker"}},
+		{"http and CA", FetchOptions{URL: "http://10.0.0.1:22624/config/worker", CAFile: notPEM}},
+	}
+	for _, test := range tests {
+		_, err := newClient(test.options)
+		assert.Error(t, err, test.name)
+	}
+	_, err = newClient(FetchOptions{URL: "http://10.0.0.1:22624/config/worker", Insecure: true})
+	assert.NoError(t, err)
+}
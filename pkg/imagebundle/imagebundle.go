@@ -0,0 +1,253 @@
+package imagebundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+)
+
+/*
+	imagebundle loads pre-exported container images into the container runtime of the node, so that the images do not
+	need to be pulled from a registry. This allows disconnected nodes to run their workloads, and avoids pulling the
+	multi-GB Windows base images over the WAN on every node. A bundle is a directory of image archives, or a single
+	archive, in the docker save or the OCI image layout format, e.g. created by docker save or ctr images export.
+*/
+
+const (
+	// archiveExtension is the extension of the image archives in a bundle directory
+	archiveExtension = ".tar"
+	// containerdNamespace is the containerd namespace of the images used by the kubelet through CRI
+	containerdNamespace = "k8s.io"
+	// dockerManifestFile lists the images of a docker save archive
+	dockerManifestFile = "manifest.json"
+	// ociIndexFile lists the images of an OCI image layout archive
+	ociIndexFile = "index.json"
+	// containerdImageNameAnnotation holds the full image name in the OCI index of the ctr images export archives
+	containerdImageNameAnnotation = "io.containerd.image.name"
+	// ociRefNameAnnotation holds the reference name in the OCI index of OCI image layout archives
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// Result is the outcome of loading an image archive
+type Result struct {
+	// Archive is the path of the image archive
+	Archive string
+	// Images are the images of the archive
+	Images []string
+	// Skipped is true if the archive was not loaded as all its images were already present
+	Skipped bool
+}
+
+// Archives returns the image archives of the given bundle: the archives of a bundle directory sorted by name, or the
+// bundle itself if it is an archive
+func Archives(bundle string) ([]string, error) {
+	info, err := os.Stat(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing image bundle %s: %v", bundle, err)
+	}
+	if !info.IsDir() {
+		return []string{bundle}, nil
+	}
+	files, err := ioutil.ReadDir(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image bundle %s: %v", bundle, err)
+	}
+	var archives []string
+	for _, file := range files {
+		if !file.IsDir() && strings.EqualFold(filepath.Ext(file.Name()), archiveExtension) {
+			archives = append(archives, filepath.Join(bundle, file.Name()))
+		}
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no %s image archives in image bundle %s", archiveExtension, bundle)
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// Load loads the images of the given bundle into the container runtime, skipping the archives whose images are all
+// present already, so that loading a bundle again is cheap
+func Load(runtime containerruntime.Runtime, bundle string) ([]Result, error) {
+	runtime, err := containerruntime.Resolve(runtime)
+	if err != nil {
+		return nil, err
+	}
+	archives, err := Archives(bundle)
+	if err != nil {
+		return nil, err
+	}
+	present, err := listImages(runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, archive := range archives {
+		images, err := ArchiveImages(archive)
+		if err != nil {
+			return results, err
+		}
+		result := Result{Archive: archive, Images: images, Skipped: len(images) > 0}
+		for _, image := range images {
+			if !present[NormalizeReference(image)] {
+				result.Skipped = false
+				break
+			}
+		}
+		if !result.Skipped {
+			if err = loadArchive(runtime, archive); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ArchiveImages returns the names of the images of the given docker save or OCI image layout archive. Images without a
+// name, like the ones saved by ID, are not returned.
+func ArchiveImages(archive string) ([]string, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("error opening image archive %s: %v", archive, err)
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is neither a docker save nor an OCI image layout archive, no %s or %s found",
+				archive, dockerManifestFile, ociIndexFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading image archive %s: %v", archive, err)
+		}
+		switch strings.TrimPrefix(header.Name, "./") {
+		case dockerManifestFile:
+			images, err := dockerManifestImages(reader)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s of %s: %v", dockerManifestFile, archive, err)
+			}
+			return images, nil
+		case ociIndexFile:
+			images, err := ociIndexImages(reader)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s of %s: %v", ociIndexFile, archive, err)
+			}
+			return images, nil
+		}
+	}
+}
+
+// dockerManifestImages returns the image names of the manifest.json of a docker save archive
+func dockerManifestImages(reader io.Reader) ([]string, error) {
+	var manifest []struct {
+		RepoTags []string
+	}
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, entry := range manifest {
+		images = append(images, entry.RepoTags...)
+	}
+	return images, nil
+}
+
+// ociIndexImages returns the image names of the index.json of an OCI image layout archive
+func ociIndexImages(reader io.Reader) ([]string, error) {
+	var index struct {
+		Manifests []struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"manifests"`
+	}
+	if err := json.NewDecoder(reader).Decode(&index); err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, manifest := range index.Manifests {
+		// The ref name alone is usually only a tag, the containerd annotation holds the full name
+		if name := manifest.Annotations[containerdImageNameAnnotation]; name != "" {
+			images = append(images, name)
+		} else if name := manifest.Annotations[ociRefNameAnnotation]; strings.ContainsAny(name, "/:") {
+			images = append(images, name)
+		}
+	}
+	return images, nil
+}
+
+// NormalizeReference returns the fully qualified form of the given image reference, as containerd lists the images,
+// so that the references docker and containerd use for the same image can be compared.
+// Example: busybox becomes docker.io/library/busybox:latest
+func NormalizeReference(image string) string {
+	name, suffix := image, ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]
+	}
+	if suffix == "" {
+		suffix = ":latest"
+	}
+	parts := strings.SplitN(name, "/", 2)
+	// The first component is a registry if it looks like a host name
+	if len(parts) == 1 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if len(parts) == 1 {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	return name + suffix
+}
+
+// listImages returns the normalized references of the images present in the container runtime
+func listImages(runtime containerruntime.Runtime) (map[string]bool, error) {
+	var cmd *exec.Cmd
+	switch runtime {
+	case containerruntime.Docker:
+		cmd = exec.Command("docker", "images", "--format", "{{.Repository}}:{{.Tag}}")
+	case containerruntime.Containerd:
+		cmd = exec.Command("ctr", "--namespace", containerdNamespace, "images", "list", "--quiet")
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %s", runtime)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the %s images: %v", runtime, err)
+	}
+	images := make(map[string]bool)
+	for _, image := range strings.Fields(string(out)) {
+		// Untagged images are listed as <none>
+		if !strings.Contains(image, "<none>") {
+			images[NormalizeReference(image)] = true
+		}
+	}
+	return images, nil
+}
+
+// loadArchive loads the images of the given archive into the container runtime
+func loadArchive(runtime containerruntime.Runtime, archive string) error {
+	var cmd *exec.Cmd
+	switch runtime {
+	case containerruntime.Docker:
+		cmd = exec.Command("docker", "load", "--input", archive)
+	case containerruntime.Containerd:
+		cmd = exec.Command("ctr", "--namespace", containerdNamespace, "images", "import", archive)
+	default:
+		return fmt.Errorf("unsupported container runtime %s", runtime)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error loading image archive %s into %s: %v, %s", archive, runtime, err, out)
+	}
+	return nil
+}
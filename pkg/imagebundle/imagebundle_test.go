@@ -0,0 +1,115 @@
+package imagebundle
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArchive writes a tar archive with the given files to the given path
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	writer := tar.NewWriter(file)
+	// The layers come before the manifest in the archives, like in the ones written by docker save
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "layer.tar", Mode: 0644, Size: 5}))
+	_, err = writer.Write([]byte("layer"))
+	require.NoError(t, err)
+	for name, contents := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}))
+		_, err = writer.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+}
+
+// TestArchiveImages tests that the image names are read from docker save and OCI image layout archives
+func TestArchiveImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagebundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{"docker save", map[string]string{dockerManifestFile: `[{"Config": "abc.json", ` +
+			`"RepoTags": ["mcr.microsoft.com/windows/servercore:ltsc2019"]}, {"Config": "def.json", ` +
+			`"RepoTags": ["busybox:latest", "busybox:1.31"]}]`},
+			[]string{"mcr.microsoft.com/windows/servercore:ltsc2019", "busybox:latest", "busybox:1.31"}},
+		{"docker save by ID", map[string]string{dockerManifestFile: `[{"Config": "abc.json", "RepoTags": null}]`},
+			nil},
+		{"ctr export", map[string]string{"./" + ociIndexFile: `{"schemaVersion": 2, "manifests": [{"annotations": ` +
+			`{"io.containerd.image.name": "mcr.microsoft.com/oss/kubernetes/pause:1.4.0", ` +
+			`"org.opencontainers.image.ref.name": "1.4.0"}}]}`},
+			[]string{"mcr.microsoft.com/oss/kubernetes/pause:1.4.0"}},
+		{"OCI layout", map[string]string{ociIndexFile: `{"manifests": [{"annotations": ` +
+			`{"org.opencontainers.image.ref.name": "quay.io/example/app:v1"}}, {"annotations": ` +
+			`{"org.opencontainers.image.ref.name": "v1"}}]}`},
+			[]string{"quay.io/example/app:v1"}},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archive := filepath.Join(dir, string(rune('a'+i))+".tar")
+			writeArchive(t, archive, test.files)
+			images, err := ArchiveImages(archive)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, images)
+		})
+	}
+
+	archive := filepath.Join(dir, "invalid.tar")
+	writeArchive(t, archive, map[string]string{"repositories": "{}"})
+	_, err = ArchiveImages(archive)
+	assert.Error(t, err, "archive without manifest")
+}
+
+// TestArchives tests that the archives of a bundle directory are returned in order, and that an archive is a bundle
+func TestArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagebundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = Archives(dir)
+	assert.Error(t, err, "empty bundle")
+	for _, name := range []string{"b.tar", "a.TAR", "readme.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "c.tar"), 0755))
+
+	archives, err := Archives(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.TAR"), filepath.Join(dir, "b.tar")}, archives)
+
+	archives, err = Archives(filepath.Join(dir, "b.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "b.tar")}, archives)
+
+	_, err = Archives(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+// TestNormalizeReference tests that the references are fully qualified like containerd lists them
+func TestNormalizeReference(t *testing.T) {
+	tests := map[string]string{
+		"busybox":                 "docker.io/library/busybox:latest",
+		"busybox:1.31":            "docker.io/library/busybox:1.31",
+		"openshift/origin:v4":     "docker.io/openshift/origin:v4",
+		"docker.io/library/nginx": "docker.io/library/nginx:latest",
+		"mcr.microsoft.com/windows/servercore:ltsc2019": "mcr.microsoft.com/windows/servercore:ltsc2019",
+		"localhost/app":                   "localhost/app:latest",
+		"registry.example.com:5000/app":   "registry.example.com:5000/app:latest",
+		"registry.example.com:5000/app:1": "registry.example.com:5000/app:1",
+		"quay.io/app@sha256:abc":          "quay.io/app@sha256:abc",
+	}
+	for reference, expected := range tests {
+		assert.Equal(t, expected, NormalizeReference(reference), reference)
+	}
+}
@@ -0,0 +1,115 @@
+package ipfamily
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+/*
+	ipfamily selects and validates the IP addresses of a node for the IP families of the cluster: IPv4 only, IPv6 only
+	or dual-stack. The kubelet registers the node with the addresses given to --node-ip, the first one being the
+	primary address of the node. Dual-stack nodes are given one address of each family, the IPv4 one first, matching
+	the order of the cluster and service networks of OpenShift dual-stack clusters.
+*/
+
+// Family is the IP family of a node
+type Family string
+
+const (
+	// IPv4 is a node with only an IPv4 address
+	IPv4 Family = "ipv4"
+	// IPv6 is a node with only an IPv6 address
+	IPv6 Family = "ipv6"
+	// DualStack is a node with an IPv4 and an IPv6 address
+	DualStack Family = "dual"
+	// DualStackFeatureGate is the feature gate enabling dual-stack in the kubelet and kube-proxy
+	DualStackFeatureGate = "IPv6DualStack"
+)
+
+// Parse returns the family with the given name
+func Parse(name string) (Family, error) {
+	switch family := Family(strings.ToLower(name)); family {
+	case IPv4, IPv6, DualStack:
+		return family, nil
+	}
+	return "", fmt.Errorf("invalid IP family %s, expected %s, %s or %s", name, IPv4, IPv6, DualStack)
+}
+
+// families returns the families of the addresses a node of the family has, the primary one first
+func (f Family) families() []Family {
+	if f == DualStack {
+		return []Family{IPv4, IPv6}
+	}
+	return []Family{f}
+}
+
+// Of returns the family of the given address
+func Of(ip net.IP) Family {
+	if ip.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
+
+// SelectNodeIPs returns the addresses of the node for the family from the given candidates, usually the addresses of
+// the network interfaces of the node in their order. The first global unicast address of each family is selected,
+// skipping the loopback, link-local and unspecified addresses.
+func SelectNodeIPs(family Family, candidates []net.IP) ([]net.IP, error) {
+	var nodeIPs []net.IP
+	for _, f := range family.families() {
+		var selected net.IP
+		for _, ip := range candidates {
+			if Of(ip) == f && ip.IsGlobalUnicast() {
+				selected = ip
+				break
+			}
+		}
+		if selected == nil {
+			return nil, fmt.Errorf("no %s address found for a %s node", f, family)
+		}
+		nodeIPs = append(nodeIPs, selected)
+	}
+	return nodeIPs, nil
+}
+
+// ParseNodeIPs parses the given addresses of the node and checks that they match the family: one address for a
+// single-stack node, one of each family for a dual-stack node. The addresses are returned in the order of the family,
+// the primary one first.
+func ParseNodeIPs(family Family, addresses []string) ([]net.IP, error) {
+	byFamily := make(map[Family]net.IP)
+	for _, address := range addresses {
+		ip := net.ParseIP(strings.TrimSpace(address))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid node IP %s", address)
+		}
+		if ip.IsUnspecified() || ip.IsLoopback() {
+			return nil, fmt.Errorf("node IP %s is not the address of an interface", address)
+		}
+		if _, found := byFamily[Of(ip)]; found {
+			return nil, fmt.Errorf("more than one %s node IP given", Of(ip))
+		}
+		byFamily[Of(ip)] = ip
+	}
+	var nodeIPs []net.IP
+	for _, f := range family.families() {
+		ip, found := byFamily[f]
+		if !found {
+			return nil, fmt.Errorf("no %s node IP given for a %s node", f, family)
+		}
+		nodeIPs = append(nodeIPs, ip)
+	}
+	if len(nodeIPs) != len(byFamily) {
+		return nil, fmt.Errorf("%d node IPs given for a %s node", len(addresses), family)
+	}
+	return nodeIPs, nil
+}
+
+// NodeIPArg returns the value of the kubelet --node-ip argument for the given addresses
+func NodeIPArg(nodeIPs []net.IP) string {
+	var addresses []string
+	for _, ip := range nodeIPs {
+		addresses = append(addresses, ip.String())
+	}
+	return strings.Join(addresses, ",")
+}
@@ -0,0 +1,88 @@
+package ipfamily
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ips parses the given addresses
+func ips(addresses ...string) []net.IP {
+	var parsed []net.IP
+	for _, address := range addresses {
+		parsed = append(parsed, net.ParseIP(address))
+	}
+	return parsed
+}
+
+// TestParse tests the parsing of the family names
+func TestParse(t *testing.T) {
+	for name, expected := range map[string]Family{"ipv4": IPv4, "IPv6": IPv6, "dual": DualStack} {
+		family, err := Parse(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, family)
+	}
+	_, err := Parse("dual-stack")
+	assert.Error(t, err)
+}
+
+// TestSelectNodeIPs tests that the first global unicast address of each family of the node is selected
+func TestSelectNodeIPs(t *testing.T) {
+	candidates := ips("127.0.0.1", "::1", "fe80::1", "169.254.10.1", "10.0.128.5", "10.0.128.6",
+		"2600:1f18:1234:5600::5")
+	tests := []struct {
+		family     Family
+		candidates []net.IP
+		expected   string
+	}{
+		{IPv4, candidates, "10.0.128.5"},
+		{IPv6, candidates, "2600:1f18:1234:5600::5"},
+		{DualStack, candidates, "10.0.128.5,2600:1f18:1234:5600::5"},
+		{IPv6, ips("fd00::5"), "fd00::5"},
+		{DualStack, ips("10.0.128.5", "fe80::1"), ""},
+		{IPv4, ips("::1", "2600:1f18:1234:5600::5"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.family)+" "+NodeIPArg(tt.candidates), func(t *testing.T) {
+			nodeIPs, err := SelectNodeIPs(tt.family, tt.candidates)
+			if tt.expected == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, NodeIPArg(nodeIPs))
+		})
+	}
+}
+
+// TestParseNodeIPs tests that the given node IPs match the family and are ordered with the primary one first
+func TestParseNodeIPs(t *testing.T) {
+	tests := []struct {
+		family    Family
+		addresses []string
+		expected  string
+	}{
+		{IPv4, []string{"10.0.128.5"}, "10.0.128.5"},
+		{IPv6, []string{"2600:1f18::5"}, "2600:1f18::5"},
+		{DualStack, []string{"2600:1f18::5", "10.0.128.5"}, "10.0.128.5,2600:1f18::5"},
+		{DualStack, []string{"10.0.128.5"}, ""},
+		{DualStack, []string{"10.0.128.5", "10.0.128.6"}, ""},
+		{IPv4, []string{"10.0.128.5", "2600:1f18::5"}, ""},
+		{IPv6, []string{"10.0.128.5"}, ""},
+		{IPv4, []string{"0.0.0.0"}, ""},
+		{IPv4, []string{"10.0.128"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.family)+" "+NodeIPArg(ips(tt.addresses...)), func(t *testing.T) {
+			nodeIPs, err := ParseNodeIPs(tt.family, tt.addresses)
+			if tt.expected == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, NodeIPArg(nodeIPs))
+		})
+	}
+}
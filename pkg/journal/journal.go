@@ -0,0 +1,191 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	journal records every change WMCB makes to the node: the files and directories it writes, the services it creates,
+	the registry keys it sets and the host settings it modifies. The journal is a JSON lines file that is only ever
+	appended to, so that it holds the complete history of the node for security reviews. Replaying it gives the current
+	footprint of WMCB on the node, which uninstall reverts.
+*/
+
+// FileName is the name of the journal file. It lives in the log directory, which is preserved by uninstall.
+const FileName = "wmcb-journal.json"
+
+// Kind is the kind of object a change applies to
+type Kind string
+
+const (
+	// File is a file written on the node
+	File Kind = "file"
+	// Directory is a directory created on the node, along with its contents
+	Directory Kind = "directory"
+	// Service is a Windows service
+	Service Kind = "service"
+	// Registry is a registry key under HKEY_LOCAL_MACHINE
+	Registry Kind = "registry"
+	// FirewallRule is a Windows firewall rule, identified by its display name
+	FirewallRule Kind = "firewall-rule"
+	// Setting is a host setting, like the pagefile, which WMCB changes in place and cannot revert
+	Setting Kind = "setting"
+)
+
+// Action is the change made to an object
+type Action string
+
+const (
+	// Created indicates that the object was created or overwritten
+	Created Action = "created"
+	// Modified indicates that an existing object was changed in place
+	Modified Action = "modified"
+	// Removed indicates that the object was removed
+	Removed Action = "removed"
+)
+
+// Entry is a single change recorded in the journal
+type Entry struct {
+	// Time is when the change was made
+	Time time.Time `json:"time"`
+	// Command is the WMCB command that made the change
+	Command string `json:"command"`
+	// Action is the change made to the object
+	Action Action `json:"action"`
+	// Kind is the kind of object changed
+	Kind Kind `json:"kind"`
+	// Target identifies the object, e.g. its path or name
+	Target string `json:"target"`
+	// Detail is an optional human readable description of the change
+	Detail string `json:"detail,omitempty"`
+}
+
+// String returns a human readable description of the entry
+func (e Entry) String() string {
+	s := fmt.Sprintf("%s %s %s %s %s", e.Time.Format(time.RFC3339), e.Command, e.Action, e.Kind, e.Target)
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	return s
+}
+
+// Journal appends the changes made by a WMCB command to the journal file
+type Journal struct {
+	// path is the location of the journal file
+	path string
+	// command is the WMCB command recorded in every entry
+	command string
+}
+
+// New returns a Journal recording the changes made by the given command in the journal file of the given directory
+func New(dir, command string) *Journal {
+	return &Journal{path: filepath.Join(dir, FileName), command: command}
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Record appends a change to the journal file, creating it if needed
+func (j *Journal) Record(action Action, kind Kind, target, detail string) error {
+	out, err := json.Marshal(Entry{
+		Time:    time.Now().UTC(),
+		Command: j.command,
+		Action:  action,
+		Kind:    kind,
+		Target:  target,
+		Detail:  detail,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal journal entry: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(j.path), os.ModeDir); err != nil {
+		return fmt.Errorf("could not make %s directory: %v", filepath.Dir(j.path), err)
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", j.path, err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(out, '\n')); err != nil {
+		return fmt.Errorf("could not write to %s: %v", j.path, err)
+	}
+	return nil
+}
+
+// Read returns the entries of the given journal file in the order they were recorded. No entries are returned if the
+// file does not exist.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not open %s: %v", path, err)
+	}
+	defer f.Close()
+	return Parse(bufio.NewScanner(f))
+}
+
+// Parse returns the entries of a journal read through the given scanner. Empty lines are skipped.
+func Parse(scanner *bufio.Scanner) ([]Entry, error) {
+	var entries []Entry
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("could not parse journal line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read journal: %v", err)
+	}
+	return entries, nil
+}
+
+// Footprint replays the given entries and returns the latest entry of every object that is still present on the
+// node, ordered by when the object was created. Targets are compared case-insensitively, as Windows does.
+func Footprint(entries []Entry) []Entry {
+	type key struct {
+		kind   Kind
+		target string
+	}
+	// created holds the keys in the order the objects were created, an object removed and created again appearing
+	// at both positions
+	var created []key
+	latest := make(map[key]Entry)
+	for _, entry := range entries {
+		k := key{entry.Kind, strings.ToLower(entry.Target)}
+		if entry.Action == Removed {
+			delete(latest, k)
+			continue
+		}
+		if _, present := latest[k]; !present {
+			created = append(created, k)
+		}
+		latest[k] = entry
+	}
+
+	// Walk backwards so that an object created more than once is ordered by its last creation
+	var footprint []Entry
+	seen := make(map[key]bool)
+	for i := len(created) - 1; i >= 0; i-- {
+		k := created[i]
+		if entry, ok := latest[k]; ok && !seen[k] {
+			seen[k] = true
+			footprint = append([]Entry{entry}, footprint...)
+		}
+	}
+	return footprint
+}
@@ -0,0 +1,84 @@
+package journal
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordAndRead tests that recorded changes are appended to the journal file and read back in order
+func TestRecordAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entries, err := Read(New(dir, "initialize-kubelet").Path())
+	require.NoError(t, err, "error reading missing journal")
+	assert.Empty(t, entries)
+
+	j := New(dir, "initialize-kubelet")
+	require.NoError(t, j.Record(Created, File, `C:\k\kubelet.exe`, ""))
+	require.NoError(t, j.Record(Created, Service, "kubelet", "kubelet.exe --windows-service"))
+	// A new journal for another command appends to the same file
+	require.NoError(t, New(dir, "uninstall").Record(Removed, Service, "kubelet", ""))
+
+	entries, err = Read(j.Path())
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "initialize-kubelet", entries[0].Command)
+	assert.Equal(t, File, entries[0].Kind)
+	assert.Equal(t, `C:\k\kubelet.exe`, entries[0].Target)
+	assert.Equal(t, "kubelet.exe --windows-service", entries[1].Detail)
+	assert.Equal(t, "uninstall", entries[2].Command)
+	assert.Equal(t, Removed, entries[2].Action)
+	assert.False(t, entries[0].Time.IsZero(), "time not recorded")
+}
+
+// TestParse tests that journals are parsed line by line
+func TestParse(t *testing.T) {
+	entries, err := Parse(bufio.NewScanner(strings.NewReader("\r\n" +
+		`{"command":"uninstall","action":"removed","kind":"file","target":"C:\\k\\kubelet.exe"}` + "\r\n\r\n")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `C:\k\kubelet.exe`, entries[0].Target)
+
+	_, err = Parse(bufio.NewScanner(strings.NewReader(`{"command":"uninstall"}` + "\n{")))
+	require.Error(t, err, "no error parsing truncated journal")
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+// TestFootprint tests that replaying the journal returns the objects still present on the node
+func TestFootprint(t *testing.T) {
+	kubelet := Entry{Action: Created, Kind: File, Target: `C:\k\kubelet.exe`}
+	kubeletConf := Entry{Action: Created, Kind: File, Target: `C:\k\kubelet.conf`}
+	service := Entry{Action: Created, Kind: Service, Target: "kubelet"}
+	pagefile := Entry{Action: Modified, Kind: Setting, Target: "pagefile"}
+
+	tests := []struct {
+		name     string
+		entries  []Entry
+		expected []Entry
+	}{
+		{"empty journal", nil, nil},
+		{"created objects", []Entry{kubelet, service, pagefile}, []Entry{kubelet, service, pagefile}},
+		{"overwritten object keeps latest entry", []Entry{kubelet, service,
+			{Action: Created, Kind: File, Target: `c:\K\kubelet.exe`, Detail: "replaced"}},
+			[]Entry{{Action: Created, Kind: File, Target: `c:\K\kubelet.exe`, Detail: "replaced"}, service}},
+		{"removed object", []Entry{kubelet, service, {Action: Removed, Kind: Service, Target: "Kubelet"}},
+			[]Entry{kubelet}},
+		{"same target of another kind", []Entry{service, {Action: Removed, Kind: File, Target: "kubelet"}},
+			[]Entry{service}},
+		{"object created again is ordered by last creation", []Entry{kubelet, kubeletConf,
+			{Action: Removed, Kind: File, Target: `C:\k\kubelet.exe`}, kubelet}, []Entry{kubeletConf, kubelet}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Footprint(tt.entries))
+		})
+	}
+}
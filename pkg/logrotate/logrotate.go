@@ -0,0 +1,303 @@
+package logrotate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	logrotate rotates the log files of the node components, like the kubelet, kube-proxy, the CNI plugins and
+	containerd, so that nodes running for weeks do not fill their disks with logs. The components keep their log file
+	open and Windows does not let open files be renamed, so a log file larger than the maximum size is copied to a
+	timestamped backup next to it and truncated in place. The backups older than the maximum age, or beyond the
+	maximum number of backups, are removed.
+*/
+
+const (
+	// ServiceName is the name of the Windows service rotating the logs periodically
+	ServiceName = "wmcb-log-rotation"
+	// ConfigFileName is the name of the log rotation configuration file in the install directory
+	ConfigFileName = "log-rotation.json"
+	// DefaultMaxSize is the size in bytes above which a log file is rotated by default
+	DefaultMaxSize = 100 * 1024 * 1024
+	// DefaultMaxAge is how long the backups are kept by default
+	DefaultMaxAge = 7 * 24 * time.Hour
+	// DefaultMaxBackups is the number of backups kept per log file by default
+	DefaultMaxBackups = 5
+	// DefaultInterval is the time between two rotations by default
+	DefaultInterval = 10 * time.Minute
+	// backupTimeFormat is the format of the time of the rotation in the name of the backups
+	backupTimeFormat = "20060102T150405"
+)
+
+// backupRegex matches the name of a backup, <name>-<time of the rotation><extension>, capturing the name of the log
+// file without its extension, the time and the extension
+var backupRegex = regexp.MustCompile(`^(.+)-(\d{8}T\d{6})(\.[^.]*)?$`)
+
+// Duration is a time.Duration written to the configuration file as a string, e.g. 168h0m0s
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads the duration from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s: %v", s, err)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Target is the set of log files of a component
+type Target struct {
+	// Name is the name of the component, e.g. kubelet
+	Name string `json:"name"`
+	// Patterns are the glob patterns of the log files of the component, e.g. C:\k\log\kubelet.log
+	Patterns []string `json:"patterns"`
+}
+
+// Config is the log rotation configuration of the node
+type Config struct {
+	// MaxSize is the size in bytes above which a log file is rotated
+	MaxSize int64 `json:"maxSize"`
+	// MaxAge is how long the backups are kept, 0 to keep them regardless of their age
+	MaxAge Duration `json:"maxAge"`
+	// MaxBackups is the number of backups kept per log file, 0 to keep them all
+	MaxBackups int `json:"maxBackups"`
+	// Interval is the time between two rotations
+	Interval Duration `json:"interval"`
+	// Targets are the log files rotated
+	Targets []Target `json:"targets"`
+}
+
+// Result lists the files changed by a rotation
+type Result struct {
+	// Rotated are the backups created
+	Rotated []string
+	// Removed are the backups removed
+	Removed []string
+}
+
+// DefaultTargets returns the log files of the kubelet and kube-proxy in the given log directory, of the CNI plugins
+// and the hybrid overlay, and of containerd
+func DefaultTargets(logDir, cniDir string) []Target {
+	return []Target{
+		{Name: "kubelet", Patterns: []string{filepath.Join(logDir, "kubelet.log")}},
+		{Name: "kube-proxy", Patterns: []string{filepath.Join(logDir, "kube-proxy.log")}},
+		{Name: "cni", Patterns: []string{filepath.Join(logDir, "hybrid-overlay.log"), filepath.Join(cniDir, "*.log")}},
+		{Name: "containerd", Patterns: []string{filepath.Join(logDir, "containerd.log")}},
+	}
+}
+
+// ParseTarget returns the target of the given <name>=<pattern>[;<pattern>...] specification
+func ParseTarget(spec string) (Target, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+		return Target{}, fmt.Errorf("invalid log target %s, expected <name>=<pattern>[;<pattern>...]", spec)
+	}
+	target := Target{Name: strings.TrimSpace(kv[0])}
+	for _, pattern := range strings.Split(kv[1], ";") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return Target{}, fmt.Errorf("invalid pattern %s of log target %s: %v", pattern, target.Name, err)
+		}
+		target.Patterns = append(target.Patterns, pattern)
+	}
+	return target, nil
+}
+
+// Validate returns an error if the configuration cannot be applied
+func (c *Config) Validate() error {
+	if c.MaxSize <= 0 {
+		return fmt.Errorf("invalid maximum size %d, expected a positive number of bytes", c.MaxSize)
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("invalid maximum age %s", time.Duration(c.MaxAge))
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("invalid maximum number of backups %d", c.MaxBackups)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s, expected a positive duration", time.Duration(c.Interval))
+	}
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("no log files to rotate")
+	}
+	for _, target := range c.Targets {
+		if len(target.Patterns) == 0 {
+			return fmt.Errorf("log target %s has no patterns", target.Name)
+		}
+	}
+	return nil
+}
+
+// ReadConfig reads the configuration from the given file
+func ReadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read log rotation configuration: %v", err)
+	}
+	var config Config
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse log rotation configuration %s: %v", path, err)
+	}
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid log rotation configuration %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// WriteConfig writes the configuration to the given file
+func WriteConfig(path string, config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not write log rotation configuration: %v", err)
+	}
+	return nil
+}
+
+// Rotate rotates the log files of the configuration larger than the maximum size, as of the given time, and removes
+// the expired backups. The other files are still rotated when one fails, and the first error is returned.
+func Rotate(config *Config, now time.Time) (*Result, error) {
+	result := &Result{}
+	var firstErr error
+	for _, target := range config.Targets {
+		for _, pattern := range target.Patterns {
+			files, err := filepath.Glob(pattern)
+			if err != nil {
+				return result, fmt.Errorf("invalid pattern %s of log target %s: %v", pattern, target.Name, err)
+			}
+			for _, file := range files {
+				if err = rotateFile(config, file, now, result); err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("could not rotate %s log %s: %v", target.Name, file, err)
+				}
+			}
+		}
+	}
+	return result, firstErr
+}
+
+// rotateFile rotates the given log file if it is larger than the maximum size and removes its expired backups,
+// recording the changes in the given result. Backups matched by a pattern are skipped.
+func rotateFile(config *Config, file string, now time.Time, result *Result) error {
+	if backupRegex.MatchString(filepath.Base(file)) {
+		return nil
+	}
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return err
+	}
+	if info.Size() > config.MaxSize {
+		backup, err := copyTruncate(file, now)
+		if err != nil {
+			return err
+		}
+		result.Rotated = append(result.Rotated, backup)
+	}
+	removed, err := removeExpiredBackups(config, file, now)
+	result.Removed = append(result.Removed, removed...)
+	return err
+}
+
+// BackupPath returns the path of the backup of the given log file rotated at the given time
+func BackupPath(file string, rotated time.Time) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + rotated.UTC().Format(backupTimeFormat) + ext
+}
+
+// copyTruncate copies the given log file to its backup and truncates it, returning the path of the backup. The file is
+// truncated rather than moved as the component writing it keeps it open.
+func copyTruncate(file string, now time.Time) (string, error) {
+	backup := BackupPath(file, now)
+	src, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("could not create backup: %v", err)
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backup)
+		return "", fmt.Errorf("could not copy to backup %s: %v", backup, err)
+	}
+	if err = dst.Close(); err != nil {
+		os.Remove(backup)
+		return "", fmt.Errorf("could not close backup %s: %v", backup, err)
+	}
+	if err = os.Truncate(file, 0); err != nil {
+		return backup, fmt.Errorf("could not truncate: %v", err)
+	}
+	return backup, nil
+}
+
+// Backups returns the backups of the given log file, the newest first
+func Backups(file string) ([]string, error) {
+	dir := filepath.Dir(file)
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(filepath.Base(file), ext)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		match := backupRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil || match[1] != name || match[3] != ext {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, entry.Name()))
+	}
+	// The time of the rotation sorts lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// removeExpiredBackups removes the backups of the given log file older than the maximum age as of the given time, and
+// the oldest ones beyond the maximum number of backups, returning the removed backups
+func removeExpiredBackups(config *Config, file string, now time.Time) ([]string, error) {
+	backups, err := Backups(file)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i, backup := range backups {
+		match := backupRegex.FindStringSubmatch(filepath.Base(backup))
+		rotated, err := time.Parse(backupTimeFormat, match[2])
+		if err != nil {
+			continue
+		}
+		expired := config.MaxAge > 0 && now.Sub(rotated) > time.Duration(config.MaxAge)
+		if !expired && (config.MaxBackups == 0 || i < config.MaxBackups) {
+			continue
+		}
+		if err = os.Remove(backup); err != nil {
+			return removed, fmt.Errorf("could not remove backup %s: %v", backup, err)
+		}
+		removed = append(removed, backup)
+	}
+	return removed, nil
+}
@@ -0,0 +1,133 @@
+package logrotate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig returns a configuration rotating the logs of the given directory above 10 bytes
+func testConfig(dir string) *Config {
+	return &Config{
+		MaxSize:    10,
+		MaxAge:     Duration(24 * time.Hour),
+		MaxBackups: 2,
+		Interval:   Duration(time.Minute),
+		Targets: []Target{
+			{Name: "kubelet", Patterns: []string{filepath.Join(dir, "kubelet.log")}},
+			{Name: "cni", Patterns: []string{filepath.Join(dir, "*.txt")}},
+		},
+	}
+}
+
+// TestRotate tests that the log files larger than the maximum size are copied to a backup and truncated, and that
+// the backups beyond the maximum number are removed
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := testConfig(dir)
+	kubeletLog := filepath.Join(dir, "kubelet.log")
+	require.NoError(t, ioutil.WriteFile(kubeletLog, []byte("kubelet is starting"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "flannel.txt"), []byte("small"), 0644))
+
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	result, err := Rotate(config, now)
+	require.NoError(t, err)
+	backup := filepath.Join(dir, "kubelet-20200601T100000.log")
+	assert.Equal(t, []string{backup}, result.Rotated)
+	assert.Empty(t, result.Removed)
+	data, err := ioutil.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet is starting", string(data))
+	info, err := os.Stat(kubeletLog)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "the log file should be truncated in place")
+
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, ioutil.WriteFile(kubeletLog, []byte("kubelet is still running"), 0644))
+		result, err = Rotate(config, now.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, result.Rotated, 1)
+	}
+	assert.Equal(t, []string{backup}, result.Removed, "the oldest backup should be removed")
+	backups, err := Backups(kubeletLog)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "kubelet-20200601T120000.log"),
+		filepath.Join(dir, "kubelet-20200601T110000.log")}, backups)
+
+	_, err = os.Stat(filepath.Join(dir, "flannel.txt"))
+	assert.NoError(t, err, "log files under the maximum size should not be rotated")
+}
+
+// TestRotateExpired tests that the backups older than the maximum age are removed and that backups matched by a
+// pattern are not rotated themselves
+func TestRotateExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := testConfig(dir)
+	old := filepath.Join(dir, "cni-20200501T100000.txt")
+	recent := filepath.Join(dir, "cni-20200531T100000.txt")
+	for _, file := range []string{old, recent} {
+		require.NoError(t, ioutil.WriteFile(file, []byte(strings.Repeat("x", 100)), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cni.txt"), []byte("small"), 0644))
+
+	result, err := Rotate(config, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, result.Rotated, "backups should not be rotated")
+	assert.Equal(t, []string{old}, result.Removed)
+	_, err = os.Stat(recent)
+	assert.NoError(t, err)
+}
+
+// TestConfig tests that the configuration is validated and read back as written
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ConfigFileName)
+	config := testConfig(dir)
+	require.NoError(t, WriteConfig(path, config))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"maxAge": "24h0m0s"`)
+	read, err := ReadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, config, read)
+
+	config.Interval = 0
+	require.NoError(t, WriteConfig(path, config))
+	_, err = ReadConfig(path)
+	assert.Error(t, err)
+
+	invalid := []*Config{
+		{MaxSize: 0, Interval: Duration(time.Minute), Targets: config.Targets},
+		{MaxSize: 10, MaxBackups: -1, Interval: Duration(time.Minute), Targets: config.Targets},
+		{MaxSize: 10, Interval: Duration(time.Minute)},
+		{MaxSize: 10, Interval: Duration(time.Minute), Targets: []Target{{Name: "kubelet"}}},
+	}
+	for _, c := range invalid {
+		assert.Error(t, c.Validate(), "%+v should be invalid", c)
+	}
+}
+
+// TestParseTarget tests the parsing of the log targets given on the command line
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget(`containerd=C:\k\log\containerd.log;C:\k\log\containerd-shim*.log`)
+	require.NoError(t, err)
+	assert.Equal(t, Target{Name: "containerd",
+		Patterns: []string{`C:\k\log\containerd.log`, `C:\k\log\containerd-shim*.log`}}, target)
+
+	for _, spec := range []string{"kubelet", "=kubelet.log", "kubelet=", "kubelet=[.log"} {
+		_, err = ParseTarget(spec)
+		assert.Error(t, err, spec)
+	}
+}
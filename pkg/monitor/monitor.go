@@ -0,0 +1,396 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/activation"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/winservice"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+/*
+	Monitor is a lightweight node-problem-detector style health monitor for the Windows node. It periodically checks
+	the health of the kubelet and kube-proxy Windows services, the state of the HNS networks, the free disk space
+	of the volume the node components are installed on and the Windows activation status. The result of every check
+	is reported as an annotation on the node object and every change in the health of a check is recorded as an event
+	against the node, so that silent failures on the node are visible from the cluster.
+*/
+
+const (
+	// ServiceName is the name of the Windows service the monitor runs under
+	ServiceName = "wmcb-monitor"
+	// AnnotationPrefix is the prefix of the node annotations the monitor reports the checks under
+	AnnotationPrefix = "monitor.wmcb.openshift.io/"
+	// healthyValue is the annotation value reported for a healthy check
+	healthyValue = "Healthy"
+	// unhealthyValue is the annotation value prefix reported for an unhealthy check, it is followed by the reason
+	unhealthyValue = "Unhealthy"
+	// eventSource is the component name used as the source of the events recorded by the monitor
+	eventSource = "wmcb-monitor"
+	// eventNamespace is the namespace in which the node events are recorded, this matches the kubelet behaviour
+	eventNamespace = "default"
+	// hnsServiceName is the name of the Host Networking Service
+	hnsServiceName = "hns"
+	// kubeletServiceName is the name of the kubelet Windows service
+	kubeletServiceName = "kubelet"
+	// kubeProxyServiceName is the name of the kube-proxy Windows service
+	kubeProxyServiceName = "kube-proxy"
+	// activationCheckInterval is the time between two checks of the Windows activation status, which is slow to query
+	// and changes over days
+	activationCheckInterval = time.Hour
+)
+
+// DefaultHNSNetworks are the HNS networks created on the node once the OpenShift CNI has been configured
+var DefaultHNSNetworks = []string{"BaseOpenShiftNetwork", "OpenShiftNetwork"}
+
+// Condition holds the result of a single health check
+type Condition struct {
+	// Type identifies the check and is used as the suffix of the node annotation
+	Type string
+	// Healthy is true if the check passed
+	Healthy bool
+	// Message describes why the check failed
+	Message string
+}
+
+// annotationValue returns the value of the node annotation for the condition
+func (c Condition) annotationValue() string {
+	if c.Healthy {
+		return healthyValue
+	}
+	return unhealthyValue + ": " + c.Message
+}
+
+// Monitor periodically checks the health of the Windows node and reports it to the cluster
+type Monitor struct {
+	// client is used to report the node health to the cluster
+	client kubernetes.Interface
+	// nodeName is the name of the node object the health is reported against
+	nodeName string
+	// svcMgr is used to interact with the Windows service API
+	svcMgr *mgr.Mgr
+	// installDir is the directory the node components are installed in. The disk pressure check is performed
+	// against the volume of this directory.
+	installDir string
+	// hnsNetworks are the names of the HNS networks that are expected to be present on the node
+	hnsNetworks []string
+	// minFreeDiskPercent is the percentage of free disk space below which the node is reported under disk pressure
+	minFreeDiskPercent int
+	// lastHealthy holds the last reported health of every check, used to only record events on transitions
+	lastHealthy map[string]bool
+	// activation is the result of the last Windows activation check
+	activation Condition
+	// activationChecked is when the Windows activation status was last checked
+	activationChecked time.Time
+}
+
+// NewMonitor returns a Monitor reporting against the given node using the given kubeconfig
+func NewMonitor(kubeconfigPath, nodeName, installDir string, hnsNetworks []string,
+	minFreeDiskPercent int) (*Monitor, error) {
+	if nodeName == "" {
+		return nil, fmt.Errorf("node name cannot be empty")
+	}
+	if minFreeDiskPercent < 0 || minFreeDiskPercent > 100 {
+		return nil, fmt.Errorf("invalid free disk percentage %d", minFreeDiskPercent)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not build config from %s: %v", kubeconfigPath, err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kubernetes client: %v", err)
+	}
+
+	svcMgr, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+
+	return &Monitor{
+		client:             client,
+		nodeName:           nodeName,
+		svcMgr:             svcMgr,
+		installDir:         installDir,
+		hnsNetworks:        hnsNetworks,
+		minFreeDiskPercent: minFreeDiskPercent,
+		lastHealthy:        make(map[string]bool),
+	}, nil
+}
+
+// Run checks the node health every interval and reports it until the stop channel is closed. Failures to report are
+// logged through the given function and do not stop the monitor.
+func (m *Monitor) Run(interval time.Duration, stop <-chan struct{}, logf func(string, ...interface{})) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.report(m.Check()); err != nil {
+			logf("error reporting node health: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs all the health checks once and returns their results
+func (m *Monitor) Check() []Condition {
+	return []Condition{
+		m.checkService("KubeletService", kubeletServiceName),
+		m.checkService("KubeProxyService", kubeProxyServiceName),
+		m.checkHNS(),
+		m.checkDiskPressure(),
+		m.checkActivation(),
+	}
+}
+
+// Close disconnects the monitor from the Windows service API
+func (m *Monitor) Close() error {
+	return m.svcMgr.Disconnect()
+}
+
+// checkService checks that the given Windows service exists and is running
+func (m *Monitor) checkService(conditionType, serviceName string) Condition {
+	condition := Condition{Type: conditionType}
+	state, err := m.serviceState(serviceName)
+	if err != nil {
+		condition.Message = err.Error()
+		return condition
+	}
+	if state != svc.Running {
+		condition.Message = fmt.Sprintf("service %s is in state %d", serviceName, state)
+		return condition
+	}
+	condition.Healthy = true
+	return condition
+}
+
+// serviceState returns the current state of the given Windows service
+func (m *Monitor) serviceState(serviceName string) (svc.State, error) {
+	service, err := m.svcMgr.OpenService(serviceName)
+	if err != nil {
+		return svc.Stopped, fmt.Errorf("service %s not found: %v", serviceName, err)
+	}
+	defer service.Close()
+
+	status, err := service.Query()
+	if err != nil {
+		return svc.Stopped, fmt.Errorf("could not query service %s: %v", serviceName, err)
+	}
+	return status.State, nil
+}
+
+// checkHNS checks that the HNS service is running and that the expected HNS networks are present
+func (m *Monitor) checkHNS() Condition {
+	condition := Condition{Type: "HNS"}
+	state, err := m.serviceState(hnsServiceName)
+	if err != nil {
+		condition.Message = err.Error()
+		return condition
+	}
+	if state != svc.Running {
+		condition.Message = fmt.Sprintf("service %s is in state %d", hnsServiceName, state)
+		return condition
+	}
+
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"Get-HnsNetwork | Select-Object -ExpandProperty Name").CombinedOutput()
+	if err != nil {
+		condition.Message = fmt.Sprintf("could not get HNS networks: %v", err)
+		return condition
+	}
+	networks := make(map[string]bool)
+	for _, name := range strings.Fields(string(out)) {
+		networks[name] = true
+	}
+	var missing []string
+	for _, network := range m.hnsNetworks {
+		if !networks[network] {
+			missing = append(missing, network)
+		}
+	}
+	if len(missing) > 0 {
+		condition.Message = "missing HNS networks " + strings.Join(missing, ",")
+		return condition
+	}
+	condition.Healthy = true
+	return condition
+}
+
+// checkDiskPressure checks that the volume of the install directory has enough free space
+func (m *Monitor) checkDiskPressure() Condition {
+	condition := Condition{Type: "DiskPressure"}
+	free, total, err := diskSpace(filepath.VolumeName(m.installDir) + "\\")
+	if err != nil {
+		condition.Message = err.Error()
+		return condition
+	}
+	if total == 0 {
+		condition.Message = "volume reported zero size"
+		return condition
+	}
+	freePercent := int(free * 100 / total)
+	if freePercent < m.minFreeDiskPercent {
+		condition.Message = fmt.Sprintf("%d%% disk space free, below threshold of %d%%", freePercent,
+			m.minFreeDiskPercent)
+		return condition
+	}
+	condition.Healthy = true
+	return condition
+}
+
+// checkActivation checks that the evaluation or activation grace period of Windows is not about to end or has not
+// ended, in which case the node shuts down every hour. The status is queried at most once per
+// activationCheckInterval.
+func (m *Monitor) checkActivation() Condition {
+	if time.Since(m.activationChecked) < activationCheckInterval {
+		return m.activation
+	}
+	condition := Condition{Type: "WindowsActivation"}
+	status, err := activation.Get()
+	if err != nil {
+		condition.Message = err.Error()
+	} else if warning, err := status.Check(activation.DefaultWarningPeriod); err != nil {
+		condition.Message = err.Error()
+	} else if warning != "" {
+		condition.Message = warning
+	} else {
+		condition.Healthy = true
+	}
+	m.activation = condition
+	m.activationChecked = time.Now()
+	return condition
+}
+
+// getDiskFreeSpaceEx is the kernel32 procedure used to query the space on a volume
+var getDiskFreeSpaceEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace returns the bytes available to the caller and the total bytes of the volume of the given path
+func diskSpace(path string) (uint64, uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free, total, totalFree uint64
+	ret, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(pathPtr)), uintptr(unsafe.Pointer(&free)),
+		uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&totalFree)))
+	if ret == 0 {
+		return 0, 0, fmt.Errorf("could not get disk space of %s: %v", path, err)
+	}
+	return free, total, nil
+}
+
+// report updates the node annotations with the given conditions and records an event for every condition whose
+// health changed since the last report
+func (m *Monitor) report(conditions []Condition) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations(conditions)},
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal node patch: %v", err)
+	}
+	if _, err = m.client.CoreV1().Nodes().Patch(m.nodeName, types.StrategicMergePatchType, patch); err != nil {
+		return fmt.Errorf("could not annotate node %s: %v", m.nodeName, err)
+	}
+
+	for _, condition := range conditions {
+		lastHealthy, reported := m.lastHealthy[condition.Type]
+		if isTransition(lastHealthy, reported, condition.Healthy) {
+			if err = m.recordEvent(condition); err != nil {
+				return err
+			}
+		}
+		m.lastHealthy[condition.Type] = condition.Healthy
+	}
+	return nil
+}
+
+// annotations returns the node annotations reporting the given conditions
+func annotations(conditions []Condition) map[string]string {
+	annotations := make(map[string]string)
+	for _, condition := range conditions {
+		annotations[AnnotationPrefix+condition.Type] = condition.annotationValue()
+	}
+	return annotations
+}
+
+// isTransition returns true if an event is to be recorded for a check whose health is now the given one, given its
+// last reported health if it was reported. Events are only recorded on transitions, or when the very first report is
+// unhealthy.
+func isTransition(lastHealthy, reported, healthy bool) bool {
+	if !reported {
+		return !healthy
+	}
+	return lastHealthy != healthy
+}
+
+// eventFor returns the type, reason and message of the event describing the health of the condition
+func eventFor(condition Condition) (string, string, string) {
+	if condition.Healthy {
+		return v1.EventTypeNormal, condition.Type + "Healthy", condition.Type + " is healthy again"
+	}
+	return v1.EventTypeWarning, condition.Type + "Unhealthy", condition.Message
+}
+
+// recordEvent records an event against the node describing the health of the condition
+func (m *Monitor) recordEvent(condition Condition) error {
+	eventType, reason, message := eventFor(condition)
+
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: m.nodeName + ".",
+			Namespace:    eventNamespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind: "Node",
+			Name: m.nodeName,
+			// The kubelet uses the node name as the UID of node events, we follow the same convention
+			UID: types.UID(m.nodeName),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: eventSource, Host: m.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := m.client.CoreV1().Events(eventNamespace).Create(event); err != nil {
+		return fmt.Errorf("could not record %s event for node %s: %v", reason, m.nodeName, err)
+	}
+	return nil
+}
+
+// InstallService creates the monitor Windows service running the given executable with the given arguments. An
+// existing monitor service is replaced.
+func InstallService(exePath string, args ...string) error {
+	return winservice.Install(ServiceName, "OpenShift Windows node health monitor", exePath, args...)
+}
+
+// RemoveService removes the monitor Windows service if it exists
+func RemoveService() error {
+	return winservice.Remove(ServiceName)
+}
+
+// RestartService restarts the monitor Windows service, e.g. for it to run an updated executable, returning false if
+// the service is not installed
+func RestartService() (bool, error) {
+	return winservice.Restart(ServiceName)
+}
@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+// TestAnnotations tests that every condition is reported as a node annotation
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []Condition
+		expected   map[string]string
+	}{
+		{"no condition", nil, map[string]string{}},
+		{"healthy", []Condition{{Type: "KubeletService", Healthy: true}},
+			map[string]string{"monitor.wmcb.openshift.io/KubeletService": "Healthy"}},
+		{"unhealthy", []Condition{{Type: "HNS", Message: "missing HNS networks OpenShiftNetwork"}},
+			map[string]string{"monitor.wmcb.openshift.io/HNS": "Unhealthy: missing HNS networks OpenShiftNetwork"}},
+		{"healthy condition ignores message", []Condition{{Type: "DiskPressure", Healthy: true, Message: "stale"}},
+			map[string]string{"monitor.wmcb.openshift.io/DiskPressure": "Healthy"}},
+		{"several conditions", []Condition{
+			{Type: "KubeletService", Healthy: true},
+			{Type: "KubeProxyService", Message: "service kube-proxy is in state 1"},
+		}, map[string]string{
+			"monitor.wmcb.openshift.io/KubeletService":   "Healthy",
+			"monitor.wmcb.openshift.io/KubeProxyService": "Unhealthy: service kube-proxy is in state 1",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, annotations(test.conditions))
+		})
+	}
+}
+
+// TestIsTransition tests that events are only recorded when the health of a check changes, or when its first report
+// is unhealthy
+func TestIsTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastHealthy bool
+		reported    bool
+		healthy     bool
+		expected    bool
+	}{
+		{"first report healthy", false, false, true, false},
+		{"first report unhealthy", false, false, false, true},
+		{"still healthy", true, true, true, false},
+		{"still unhealthy", false, true, false, false},
+		{"became unhealthy", true, true, false, true},
+		{"became healthy", false, true, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isTransition(test.lastHealthy, test.reported, test.healthy))
+		})
+	}
+}
+
+// TestEventFor tests the type, reason and message of the events describing the health of a condition
+func TestEventFor(t *testing.T) {
+	tests := []struct {
+		name            string
+		condition       Condition
+		expectedType    string
+		expectedReason  string
+		expectedMessage string
+	}{
+		{"healthy", Condition{Type: "KubeletService", Healthy: true}, v1.EventTypeNormal, "KubeletServiceHealthy",
+			"KubeletService is healthy again"},
+		{"unhealthy", Condition{Type: "DiskPressure", Message: "5% disk space free, below threshold of 10%"},
+			v1.EventTypeWarning, "DiskPressureUnhealthy", "5% disk space free, below threshold of 10%"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventType, reason, message := eventFor(test.condition)
+			assert.Equal(t, test.expectedType, eventType)
+			assert.Equal(t, test.expectedReason, reason)
+			assert.Equal(t, test.expectedMessage, message)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package mtu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/*
+	mtu validates the MTU of the interfaces of a Windows node against the MTU of the cluster network, and can set it.
+	The pod traffic between the Windows and Linux nodes is encapsulated with VXLAN by the hybrid overlay, so the uplink
+	interface of the node has to fit a packet of the cluster network MTU plus the VXLAN headers, while the host
+	interfaces of the HNS networks must not send packets larger than the cluster network MTU. A mismatch is not
+	detected by the bootstrap: small packets go through and only large packets are dropped, which shows as TLS
+	handshakes or image pulls hanging intermittently.
+*/
+
+const (
+	// VXLANOverhead is the size in bytes of the outer IPv4, UDP and VXLAN headers and the inner Ethernet header added
+	// to the packets of the cluster network by the VXLAN encapsulation of the hybrid overlay
+	VXLANOverhead = 50
+	// minMTU is the smallest MTU of an IPv4 interface on Windows
+	minMTU = 576
+	// maxMTU is the largest MTU supported by the jumbo frames of the cloud networks
+	maxMTU = 9216
+	// Uplink is the kind of the interface of the default route of the node, which the encapsulated traffic goes through
+	Uplink = "uplink"
+	// HNSNetwork is the kind of the host interface of an HNS network
+	HNSNetwork = "hns"
+)
+
+// DefaultHNSNetworks are the HNS networks created on the node by the hybrid overlay
+var DefaultHNSNetworks = []string{"BaseOpenShiftNetwork", "OpenShiftNetwork"}
+
+// Interface is an interface of the node whose MTU is validated
+type Interface struct {
+	// Name is the alias of the interface, e.g. Ethernet or vEthernet (OpenShiftNetwork)
+	Name string `json:"name"`
+	// Kind is the kind of the interface, Uplink or HNSNetwork
+	Kind string `json:"kind"`
+	// MTU is the IPv4 MTU of the interface in bytes
+	MTU int `json:"mtu"`
+}
+
+// Result is the result of the validation of the MTU of an interface
+type Result struct {
+	Interface
+	// Expected is the MTU the interface should have
+	Expected int `json:"expected"`
+	// Valid is true if the MTU of the interface fits the cluster network MTU
+	Valid bool `json:"valid"`
+	// Reason explains why the MTU is invalid, empty if it is valid
+	Reason string `json:"reason,omitempty"`
+}
+
+// ValidateClusterMTU returns an error if the given cluster network MTU cannot be carried by an interface
+func ValidateClusterMTU(clusterMTU int) error {
+	if clusterMTU < minMTU || clusterMTU+VXLANOverhead > maxMTU {
+		return fmt.Errorf("invalid cluster network MTU %d, expected between %d and %d", clusterMTU, minMTU,
+			maxMTU-VXLANOverhead)
+	}
+	return nil
+}
+
+// ExpectedMTU returns the MTU an interface of the given kind should have for the given cluster network MTU
+func ExpectedMTU(kind string, clusterMTU int) int {
+	if kind == Uplink {
+		return clusterMTU + VXLANOverhead
+	}
+	return clusterMTU
+}
+
+// Check validates the MTU of the given interfaces against the given cluster network MTU. The uplink interface can
+// have a larger MTU than needed, as the packets it sends are not larger than the MTU of the network, while the host
+// interfaces of the HNS networks must have the cluster network MTU.
+func Check(clusterMTU int, interfaces []Interface) []Result {
+	results := make([]Result, len(interfaces))
+	for i, iface := range interfaces {
+		result := Result{Interface: iface, Expected: ExpectedMTU(iface.Kind, clusterMTU), Valid: true}
+		switch {
+		case iface.Kind == Uplink && iface.MTU < result.Expected:
+			result.Valid = false
+			result.Reason = fmt.Sprintf("MTU %d cannot carry the cluster network MTU %d plus the %d bytes of VXLAN "+
+				"overhead", iface.MTU, clusterMTU, VXLANOverhead)
+		case iface.Kind == HNSNetwork && iface.MTU != result.Expected:
+			result.Valid = false
+			result.Reason = fmt.Sprintf("MTU %d does not match the cluster network MTU %d", iface.MTU, clusterMTU)
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// Interfaces returns the uplink interface of the node, the interface of its default IPv4 route with the lowest
+// metric, and the host interfaces of the given HNS networks that exist on the node
+func Interfaces(hnsNetworks []string) ([]Interface, error) {
+	out, err := powershell("ConvertTo-Json -Compress -InputObject @(Get-NetIPInterface -AddressFamily IPv4 | " +
+		"ForEach-Object { @{name = $_.InterfaceAlias; mtu = $_.NlMtu} })")
+	if err != nil {
+		return nil, fmt.Errorf("could not list the network interfaces: %v", err)
+	}
+	mtus, err := parseInterfaceMTUs(out)
+	if err != nil {
+		return nil, err
+	}
+	uplink, err := powershell("(Get-NetRoute -DestinationPrefix 0.0.0.0/0 | Sort-Object RouteMetric | " +
+		"Select-Object -First 1).InterfaceAlias")
+	if err != nil {
+		return nil, fmt.Errorf("could not find the interface of the default route: %v", err)
+	}
+	uplink = strings.TrimSpace(uplink)
+	uplinkMTU, found := mtus[uplink]
+	if !found {
+		return nil, fmt.Errorf("no IPv4 interface found for the default route of the node")
+	}
+	interfaces := []Interface{{Name: uplink, Kind: Uplink, MTU: uplinkMTU}}
+	for _, network := range hnsNetworks {
+		name := HNSInterfaceName(network)
+		if mtu, found := mtus[name]; found && name != uplink {
+			interfaces = append(interfaces, Interface{Name: name, Kind: HNSNetwork, MTU: mtu})
+		}
+	}
+	return interfaces, nil
+}
+
+// HNSInterfaceName returns the name of the host interface of the HNS network with the given name
+func HNSInterfaceName(network string) string {
+	return "vEthernet (" + network + ")"
+}
+
+// Configure sets the MTU of the interfaces of the given invalid results to their expected MTU. The uplink interface
+// can only be given a larger MTU if the network of the node supports it, e.g. the jumbo frames of a cloud VPC.
+func Configure(results []Result) error {
+	for _, result := range results {
+		if result.Valid {
+			continue
+		}
+		if _, err := powershell(fmt.Sprintf("Set-NetIPInterface -InterfaceAlias '%s' -AddressFamily IPv4 "+
+			"-NlMtuBytes %d", result.Name, result.Expected)); err != nil {
+			return fmt.Errorf("could not set the MTU of %s to %d: %v", result.Name, result.Expected, err)
+		}
+	}
+	return nil
+}
+
+// parseInterfaceMTUs parses the JSON output of the interfaces listed by Interfaces into a map of their MTU by name. A
+// single interface is serialized as an object instead of an array by older versions of PowerShell.
+func parseInterfaceMTUs(out string) (map[string]int, error) {
+	out = strings.TrimSpace(out)
+	if strings.HasPrefix(out, "{") {
+		out = "[" + out + "]"
+	}
+	var interfaces []Interface
+	if err := json.Unmarshal([]byte(out), &interfaces); err != nil {
+		return nil, fmt.Errorf("error parsing network interfaces %s: %v", out, err)
+	}
+	mtus := make(map[string]int, len(interfaces))
+	for _, iface := range interfaces {
+		mtus[iface.Name] = iface.MTU
+	}
+	return mtus, nil
+}
+
+// powershell runs the given PowerShell command and returns its output
+func powershell(command string) (string, error) {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		command).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, out)
+	}
+	return string(out), nil
+}
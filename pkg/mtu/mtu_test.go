@@ -0,0 +1,61 @@
+package mtu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateClusterMTU tests that the cluster network MTU has to fit in an interface along with the VXLAN overhead
+func TestValidateClusterMTU(t *testing.T) {
+	assert.NoError(t, ValidateClusterMTU(1400))
+	assert.NoError(t, ValidateClusterMTU(8951))
+	assert.Error(t, ValidateClusterMTU(0))
+	assert.Error(t, ValidateClusterMTU(575))
+	assert.Error(t, ValidateClusterMTU(9200), "no room left for the VXLAN overhead")
+}
+
+// TestCheck tests that the uplink interface needs room for the VXLAN overhead and that the HNS network interfaces
+// need the cluster network MTU
+func TestCheck(t *testing.T) {
+	results := Check(1400, []Interface{
+		{Name: "Ethernet", Kind: Uplink, MTU: 9001},
+		{Name: "vEthernet (OpenShiftNetwork)", Kind: HNSNetwork, MTU: 1400},
+	})
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.True(t, result.Valid, "%s should be valid", result.Name)
+		assert.Empty(t, result.Reason)
+	}
+	assert.Equal(t, 1450, results[0].Expected)
+	assert.Equal(t, 1400, results[1].Expected)
+
+	results = Check(1500, []Interface{
+		{Name: "Ethernet", Kind: Uplink, MTU: 1500},
+		{Name: "vEthernet (OpenShiftNetwork)", Kind: HNSNetwork, MTU: 1450},
+		{Name: "vEthernet (BaseOpenShiftNetwork)", Kind: HNSNetwork, MTU: 9001},
+	})
+	require.Len(t, results, 3)
+	assert.Equal(t, Result{Interface: Interface{Name: "Ethernet", Kind: Uplink, MTU: 1500}, Expected: 1550,
+		Reason: "MTU 1500 cannot carry the cluster network MTU 1500 plus the 50 bytes of VXLAN overhead"}, results[0])
+	assert.False(t, results[1].Valid, "a smaller HNS network MTU should be invalid")
+	assert.False(t, results[2].Valid, "a larger HNS network MTU should be invalid")
+	assert.Equal(t, "MTU 9001 does not match the cluster network MTU 1500", results[2].Reason)
+}
+
+// TestParseInterfaceMTUs tests the parsing of the interfaces, of which a single one is not serialized as an array
+func TestParseInterfaceMTUs(t *testing.T) {
+	mtus, err := parseInterfaceMTUs(`[{"name":"Ethernet","mtu":9001},{"name":"Loopback Pseudo-Interface 1",` +
+		`"mtu":4294967295},{"name":"vEthernet (OpenShiftNetwork)","mtu":1400}]`)
+	require.NoError(t, err)
+	assert.Equal(t, 9001, mtus["Ethernet"])
+	assert.Equal(t, 1400, mtus[HNSInterfaceName("OpenShiftNetwork")])
+
+	mtus, err = parseInterfaceMTUs(`{"name":"Ethernet","mtu":1500}` + "\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"Ethernet": 1500}, mtus)
+
+	_, err = parseInterfaceMTUs("[")
+	assert.Error(t, err)
+}
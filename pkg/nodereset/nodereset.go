@@ -0,0 +1,118 @@
+package nodereset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+)
+
+/*
+	nodereset removes what the workloads of a Windows node leave behind: the containers of the container runtime, its
+	images and the HNS endpoints of the containers, so that a node can be bootstrapped again, or reused by another test
+	run, without the stale state of the previous one. The space reclaimed on the system drive is reported, as the
+	images of Windows containers take gigabytes.
+*/
+
+const (
+	// containerdNamespace is the containerd namespace of the containers and images of the kubelet
+	containerdNamespace = "k8s.io"
+)
+
+// Report lists what a reset removed from the node
+type Report struct {
+	// Containers is the number of containers removed
+	Containers int `json:"containers"`
+	// Images is the number of images removed
+	Images int `json:"images"`
+	// HNSEndpoints is the number of HNS endpoints removed
+	HNSEndpoints int `json:"hnsEndpoints"`
+	// ReclaimedBytes is the space freed on the system drive, which may be negative if something else wrote to it
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+	// Warnings are the steps that could not be done, e.g. the HNS endpoints when the HNS cmdlets are missing
+	Warnings []string `json:"warnings"`
+}
+
+// String returns a one line summary of the report
+func (r *Report) String() string {
+	summary := fmt.Sprintf("removed %d containers, %d images and %d HNS endpoints, reclaimed %.1f MiB",
+		r.Containers, r.Images, r.HNSEndpoints, float64(r.ReclaimedBytes)/(1<<20))
+	if len(r.Warnings) > 0 {
+		summary += " (" + strings.Join(r.Warnings, "; ") + ")"
+	}
+	return summary
+}
+
+// Script returns the PowerShell script removing the containers of the given runtime, its images unless keepImages is
+// set, and the HNS endpoints, printing the Report as JSON on its last line. The runtime must not be Auto.
+func Script(runtime containerruntime.Runtime, keepImages bool) string {
+	script := `$ErrorActionPreference = 'Stop'
+$drive = Get-PSDrive -Name $env:SystemDrive.TrimEnd(':')
+$free = $drive.Free
+$report = @{containers = 0; images = 0; hnsEndpoints = 0; reclaimedBytes = 0; warnings = @()}
+`
+	if runtime == containerruntime.Containerd {
+		script += `$tasks = @(ctr -n ` + containerdNamespace + ` tasks ls -q)
+foreach ($task in $tasks) { ctr -n ` + containerdNamespace + ` tasks rm -f $task | Out-Null }
+$containers = @(ctr -n ` + containerdNamespace + ` containers ls -q)
+if ($containers.Count -gt 0) { ctr -n ` + containerdNamespace + ` containers rm $containers | Out-Null }
+$report.containers = $containers.Count
+`
+		if !keepImages {
+			script += `$images = @(ctr -n ` + containerdNamespace + ` images ls -q)
+if ($images.Count -gt 0) { ctr -n ` + containerdNamespace + ` images rm $images | Out-Null }
+$report.images = $images.Count
+`
+		}
+	} else {
+		script += `$containers = @(docker ps -aq --no-trunc)
+if ($containers.Count -gt 0) { docker rm -f $containers | Out-Null }
+$report.containers = $containers.Count
+`
+		if !keepImages {
+			script += `$images = @(docker images -aq --no-trunc | Select-Object -Unique)
+if ($images.Count -gt 0) { docker rmi -f $images | Out-Null }
+$report.images = $images.Count
+`
+		}
+	}
+	script += `if (Get-Command -Name Get-HnsEndpoint -ErrorAction SilentlyContinue) {
+    $endpoints = @(Get-HnsEndpoint)
+    $endpoints | Remove-HnsEndpoint | Out-Null
+    $report.hnsEndpoints = $endpoints.Count
+} else {
+    $report.warnings += 'the HNS endpoints were not removed, Get-HnsEndpoint is not available'
+}
+$drive = Get-PSDrive -Name $env:SystemDrive.TrimEnd(':')
+$report.reclaimedBytes = $drive.Free - $free
+$report | ConvertTo-Json -Compress`
+	return script
+}
+
+// ParseReport returns the Report printed by the script of Script on the last line of its output
+func ParseReport(output string) (*Report, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	report := &Report{}
+	if err := json.Unmarshal([]byte(last), report); err != nil {
+		return nil, fmt.Errorf("invalid reset report %q: %v", last, err)
+	}
+	return report, nil
+}
+
+// Reset removes the containers of the given runtime, resolving Auto to the runtime installed on the node, its images
+// unless keepImages is set, and the HNS endpoints of the node
+func Reset(runtime containerruntime.Runtime, keepImages bool) (*Report, error) {
+	runtime, err := containerruntime.Resolve(runtime)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		Script(runtime, keepImages)).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("unable to reset the node: %v, %s", err, out)
+	}
+	return ParseReport(string(out))
+}
@@ -0,0 +1,37 @@
+package nodereset
+
+import (
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/containerruntime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScript tests that the script removes the containers and images of the given runtime, keeping the images when
+// requested
+func TestScript(t *testing.T) {
+	script := Script(containerruntime.Docker, false)
+	assert.Contains(t, script, "docker rm -f $containers")
+	assert.Contains(t, script, "docker rmi -f $images")
+	assert.Contains(t, script, "Remove-HnsEndpoint")
+	assert.NotContains(t, script, "ctr ")
+
+	script = Script(containerruntime.Containerd, true)
+	assert.Contains(t, script, "ctr -n k8s.io containers rm $containers")
+	assert.NotContains(t, script, "images rm")
+	assert.NotContains(t, script, "docker")
+}
+
+// TestParseReport tests that the report is read from the last line of the output of the script
+func TestParseReport(t *testing.T) {
+	report, err := ParseReport("Untagged: mcr.microsoft.com/windows/servercore:ltsc2019\r\n" +
+		`{"containers":3,"images":2,"hnsEndpoints":3,"reclaimedBytes":5368709120,"warnings":[]}` + "\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, &Report{Containers: 3, Images: 2, HNSEndpoints: 3, ReclaimedBytes: 5 << 30, Warnings: []string{}},
+		report)
+	assert.Equal(t, "removed 3 containers, 2 images and 3 HNS endpoints, reclaimed 5120.0 MiB", report.String())
+
+	_, err = ParseReport("docker: command not found")
+	assert.Error(t, err)
+}
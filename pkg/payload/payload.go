@@ -0,0 +1,499 @@
+package payload
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	payload obtains the artifacts needed to bootstrap a Windows node, like the kubelet, the CNI plugins, the hybrid
+	overlay or WMCB itself, from a PayloadSource. The sources are described by a spec, so that where the artifacts come
+	from is configured in a single place instead of URLs being hardcoded by each of their consumers:
+	- dir:<path> or an absolute path, a local directory holding the artifacts
+	- http://<mirror> or https://<mirror>, an HTTP mirror serving the artifacts under the given URL
+	- github:<owner>/<repo>[@<tag>], the assets of a GitHub release, the latest one if no tag is given
+	- release:<component>[:<dir>]@<release image>, the files of the directory of the component image of an OpenShift
+	  release image, extracted from the layers of the image
+*/
+
+const (
+	// githubAPI is the URL of the GitHub REST API
+	githubAPI = "https://api.github.com"
+	// checksumFile is the file listing the SHA256 of the artifacts of an HTTP mirror, in the sha256sum format
+	checksumFile = "sha256sum.txt"
+	// httpTimeout is the timeout of the requests to the HTTP sources
+	httpTimeout = 10 * time.Minute
+)
+
+// PayloadSource is a source of payload artifacts
+type PayloadSource interface {
+	// Fetch writes the artifact with the given name to the given local path
+	Fetch(name, dest string) error
+	// String describes the source
+	String() string
+}
+
+// RemoteSource is implemented by the payload sources whose artifacts can be downloaded by their consumers themselves,
+// e.g. by the Windows VMs of the e2e tests, instead of being fetched locally and copied
+type RemoteSource interface {
+	PayloadSource
+	// URL returns the download URL of the artifact with the given name
+	URL(name string) (string, error)
+}
+
+// ChecksumSource is implemented by the payload sources publishing the SHA256 of their artifacts, so that the artifacts
+// downloaded from their URL can be verified
+type ChecksumSource interface {
+	PayloadSource
+	// SHA256 returns the hex encoded SHA256 of the artifact with the given name
+	SHA256(name string) (string, error)
+}
+
+// ParseSource returns the PayloadSource described by the given spec
+func ParseSource(spec string) (PayloadSource, error) {
+	switch {
+	case strings.HasPrefix(spec, "dir:"):
+		return &LocalDir{Dir: strings.TrimPrefix(spec, "dir:")}, nil
+	case filepath.IsAbs(spec):
+		return &LocalDir{Dir: spec}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &HTTPMirror{BaseURL: spec}, nil
+	case strings.HasPrefix(spec, "github:"):
+		repo := strings.TrimPrefix(spec, "github:")
+		tag := ""
+		if i := strings.Index(repo, "@"); i != -1 {
+			repo, tag = repo[:i], repo[i+1:]
+		}
+		ownerRepo := strings.Split(repo, "/")
+		if len(ownerRepo) != 2 || ownerRepo[0] == "" || ownerRepo[1] == "" {
+			return nil, fmt.Errorf("invalid GitHub payload source %s, expected github:<owner>/<repo>[@<tag>]", spec)
+		}
+		return &GitHubRelease{Owner: ownerRepo[0], Repo: ownerRepo[1], Tag: tag}, nil
+	case strings.HasPrefix(spec, "release:"):
+		// The release image may have a digest, so only the first @ separates the component from the image
+		parts := strings.SplitN(strings.TrimPrefix(spec, "release:"), "@", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid release image payload source %s, expected "+
+				"release:<component>[:<dir>]@<release image>", spec)
+		}
+		source := &ReleaseImage{Component: parts[0], Dir: "/", Release: parts[1]}
+		if i := strings.Index(parts[0], ":"); i != -1 {
+			source.Component, source.Dir = parts[0][:i], parts[0][i+1:]
+		}
+		return source, nil
+	}
+	return nil, fmt.Errorf("unknown payload source %s, expected dir:<path>, an HTTP URL, github:<owner>/<repo> or "+
+		"release:<component>@<release image>", spec)
+}
+
+// FetchAll fetches the artifacts with the given names from the source into the given directory
+func FetchAll(source PayloadSource, names []string, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", dir, err)
+	}
+	if batch, ok := source.(batchSource); ok {
+		if err := batch.fetchAll(names, dir); err != nil {
+			return fmt.Errorf("error fetching %s from %s: %v", strings.Join(names, ", "), source, err)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := source.Fetch(name, filepath.Join(dir, path.Base(name))); err != nil {
+			return fmt.Errorf("error fetching %s from %s: %v", name, source, err)
+		}
+	}
+	return nil
+}
+
+// LocalDir is a local directory holding the artifacts, e.g. copied to a disconnected node
+type LocalDir struct {
+	// Dir is the path of the directory
+	Dir string
+}
+
+// Fetch copies the artifact from the directory
+func (l *LocalDir) Fetch(name, dest string) error {
+	src, err := os.Open(filepath.Join(l.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeFile(src, dest)
+}
+
+// String describes the directory
+func (l *LocalDir) String() string {
+	return "directory " + l.Dir
+}
+
+// HTTPMirror is an HTTP server serving the artifacts under a base URL. If the mirror serves a sha256sum.txt file, the
+// artifacts listed in it are verified against their SHA256.
+type HTTPMirror struct {
+	// BaseURL is the URL the artifacts are served under
+	BaseURL string
+}
+
+// Fetch downloads the artifact from the mirror
+func (h *HTTPMirror) Fetch(name, dest string) error {
+	url, _ := h.URL(name)
+	if err := download(url, dest); err != nil {
+		return err
+	}
+	checksums, err := fetchChecksums(h.checksumsURL())
+	if err != nil {
+		return err
+	}
+	if sum, ok := checksums[path.Base(name)]; ok {
+		return verifySHA256(dest, sum)
+	}
+	return nil
+}
+
+// URL returns the URL of the artifact on the mirror
+func (h *HTTPMirror) URL(name string) (string, error) {
+	return strings.TrimSuffix(h.BaseURL, "/") + "/" + name, nil
+}
+
+// SHA256 returns the SHA256 of the artifact listed in the sha256sum.txt file of the mirror
+func (h *HTTPMirror) SHA256(name string) (string, error) {
+	checksums, err := fetchChecksums(h.checksumsURL())
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := checksums[path.Base(name)]; ok {
+		return sum, nil
+	}
+	return "", fmt.Errorf("%s has no SHA256 of %s", h, name)
+}
+
+// checksumsURL returns the URL of the sha256sum.txt file of the mirror
+func (h *HTTPMirror) checksumsURL() string {
+	url, _ := h.URL(checksumFile)
+	return url
+}
+
+// String describes the mirror
+func (h *HTTPMirror) String() string {
+	return "mirror " + h.BaseURL
+}
+
+// GitHubRelease is a GitHub release whose assets are the artifacts. The SHA256 of the assets listed in the body of the
+// release, in the sha256sum format like in the WMCB releases, are verified.
+type GitHubRelease struct {
+	// Owner is the owner of the repository
+	Owner string
+	// Repo is the name of the repository
+	Repo string
+	// Tag is the tag of the release, the latest release is used if empty
+	Tag string
+	// NameContains selects the latest release whose name contains it when no tag is given, e.g. the OpenShift version
+	// of the WMCB releases
+	NameContains string
+	// release is the release, fetched on first use
+	release *githubRelease
+}
+
+// githubRelease is the subset of a release returned by the GitHub API used to fetch its assets
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Name    string        `json:"name"`
+	Body    string        `json:"body"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+// githubAsset is the subset of a release asset returned by the GitHub API used to download it
+type githubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// Fetch downloads the release asset with the given name
+func (g *GitHubRelease) Fetch(name, dest string) error {
+	url, err := g.URL(name)
+	if err != nil {
+		return err
+	}
+	if err = download(url, dest); err != nil {
+		return err
+	}
+	if sum, ok := parseChecksums(strings.NewReader(g.release.Body))[name]; ok {
+		return verifySHA256(dest, sum)
+	}
+	return nil
+}
+
+// URL returns the download URL of the release asset with the given name
+func (g *GitHubRelease) URL(name string) (string, error) {
+	release, err := g.getRelease()
+	if err != nil {
+		return "", err
+	}
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return asset.BrowserDownloadURL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s of %s/%s has no asset %s", release.TagName, g.Owner, g.Repo, name)
+}
+
+// SHA256 returns the SHA256 of the release asset with the given name listed in the body of the release
+func (g *GitHubRelease) SHA256(name string) (string, error) {
+	release, err := g.getRelease()
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := parseChecksums(strings.NewReader(release.Body))[name]; ok {
+		return sum, nil
+	}
+	return "", fmt.Errorf("release %s of %s/%s has no SHA256 of %s", release.TagName, g.Owner, g.Repo, name)
+}
+
+// getRelease gets the release on first use
+func (g *GitHubRelease) getRelease() (*githubRelease, error) {
+	if g.release != nil {
+		return g.release, nil
+	}
+	var err error
+	switch {
+	case g.Tag != "":
+		g.release, err = getGitHubRelease(fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", githubAPI, g.Owner, g.Repo,
+			g.Tag))
+	case g.NameContains != "":
+		g.release, err = findGitHubRelease(fmt.Sprintf("%s/repos/%s/%s/releases", githubAPI, g.Owner, g.Repo),
+			g.NameContains)
+	default:
+		g.release, err = getGitHubRelease(fmt.Sprintf("%s/repos/%s/%s/releases/latest", githubAPI, g.Owner, g.Repo))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s: %v", g, err)
+	}
+	return g.release, nil
+}
+
+// String describes the release
+func (g *GitHubRelease) String() string {
+	switch {
+	case g.Tag != "":
+		return fmt.Sprintf("GitHub release %s of %s/%s", g.Tag, g.Owner, g.Repo)
+	case g.NameContains != "":
+		return fmt.Sprintf("latest %s GitHub release of %s/%s", g.NameContains, g.Owner, g.Repo)
+	}
+	return fmt.Sprintf("latest GitHub release of %s/%s", g.Owner, g.Repo)
+}
+
+// getGitHubRelease gets the release at the given GitHub API URL
+func getGitHubRelease(url string) (*githubRelease, error) {
+	var release githubRelease
+	if err := getGitHubJSON(url, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// findGitHubRelease gets the latest of the releases at the given GitHub API URL whose name contains the given string
+func findGitHubRelease(url, nameContains string) (*githubRelease, error) {
+	var releases []githubRelease
+	if err := getGitHubJSON(url, &releases); err != nil {
+		return nil, err
+	}
+	// The releases are listed from the latest one
+	for i := range releases {
+		if strings.Contains(releases[i].Name, nameContains) {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no release name contains %s", nameContains)
+}
+
+// getGitHubJSON decodes the response of the GitHub API at the given URL into the given value
+func getGitHubJSON(url string, v interface{}) error {
+	client := http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s: %v", url, err)
+	}
+	return nil
+}
+
+// ReleaseImage is the image of a component of an OpenShift release image holding the artifacts in one of its
+// directories. The artifacts are extracted from the layers of the image, pulled from the registry with the
+// credentials of the pull secret of the cluster, so that they match the version of the cluster exactly and can come
+// from the mirror registry of a disconnected cluster. The component images are referenced by digest in the release
+// image, and the digests of the manifests and layers are verified.
+type ReleaseImage struct {
+	// Release is the pull spec of the release image, e.g. the image of the desired version of the ClusterVersion
+	Release string
+	// Component is the name of the component in the release image, e.g. ovn-kubernetes
+	Component string
+	// Dir is the directory of the component image holding the artifacts
+	Dir string
+	// PullSecret is the path of the pull secret used to pull the images, none if empty
+	PullSecret string
+	// client pulls the images, created on first use
+	client *registryClient
+	// image is the component image, resolved on first use
+	image *imageReference
+}
+
+// batchSource is implemented by the payload sources fetching several artifacts at once more efficiently than one by
+// one
+type batchSource interface {
+	// fetchAll fetches the artifacts with the given names into the given directory
+	fetchAll(names []string, dir string) error
+}
+
+// Fetch extracts the artifact from the component image
+func (r *ReleaseImage) Fetch(name, dest string) error {
+	return r.extract(map[string]string{name: dest})
+}
+
+// fetchAll extracts the artifacts from the component image in a single pass over its layers
+func (r *ReleaseImage) fetchAll(names []string, dir string) error {
+	files := make(map[string]string)
+	for _, name := range names {
+		files[name] = filepath.Join(dir, path.Base(name))
+	}
+	return r.extract(files)
+}
+
+// extract extracts the artifacts with the given names from the component image to the given local paths
+func (r *ReleaseImage) extract(files map[string]string) error {
+	if r.image == nil {
+		var pullSecret []byte
+		if r.PullSecret != "" {
+			var err error
+			if pullSecret, err = ioutil.ReadFile(r.PullSecret); err != nil {
+				return fmt.Errorf("error reading pull secret: %v", err)
+			}
+		}
+		client, err := newRegistryClient(pullSecret)
+		if err != nil {
+			return err
+		}
+		release, err := parseImageReference(r.Release)
+		if err != nil {
+			return err
+		}
+		pullSpec, err := client.componentImage(release, r.Component)
+		if err != nil {
+			return err
+		}
+		if r.image, err = parseImageReference(pullSpec); err != nil {
+			return err
+		}
+		r.client = client
+	}
+	imageFiles := make(map[string]string)
+	for name, dest := range files {
+		imageFiles[path.Join(r.Dir, name)] = dest
+	}
+	return r.client.extractFiles(r.image, imageFiles)
+}
+
+// String describes the component image
+func (r *ReleaseImage) String() string {
+	return fmt.Sprintf("%s image of release %s", r.Component, r.Release)
+}
+
+// download writes the file at the given URL to the given local path
+func download(url, dest string) error {
+	client := http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return writeFile(resp.Body, dest)
+}
+
+// fetchChecksums returns the SHA256 listed in the sha256sum file at the given URL by file name, none if there is no
+// such file
+func fetchChecksums(url string) (map[string]string, error) {
+	client := http.Client{Timeout: httpTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return parseChecksums(resp.Body), nil
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+}
+
+// parseChecksums returns the SHA256 by file name of the given contents in the sha256sum format, i.e. lines of the
+// hex encoded SHA256 followed by the file name. The other lines are ignored.
+func parseChecksums(reader io.Reader) map[string]string {
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && len(fields[0]) == 64 {
+			// sha256sum marks the files hashed in binary mode with a *
+			checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	return checksums
+}
+
+// writeFile writes the contents of the reader to the given path, through a temporary file so that an interrupted
+// fetch does not leave a truncated artifact behind
+func writeFile(reader io.Reader, dest string) error {
+	tmp := dest + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", tmp, err)
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", dest, err)
+	}
+	return os.Rename(tmp, dest)
+}
+
+// verifySHA256 returns an error if the SHA256 of the given file is not the given hex encoded one, removing the file
+func verifySHA256(path, sum string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("error hashing %s: %v", path, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != sum {
+		os.Remove(path)
+		return fmt.Errorf("SHA256 of %s is %s instead of %s", path, actual, sum)
+	}
+	return nil
+}
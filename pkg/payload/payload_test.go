@@ -0,0 +1,146 @@
+package payload
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSource tests that the payload source specs are parsed into their source
+func TestParseSource(t *testing.T) {
+	absDir, err := filepath.Abs("payload")
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		spec     string
+		expected PayloadSource
+		errorMsg string
+	}{
+		{"directory", "dir:payload", &LocalDir{Dir: "payload"}, ""},
+		{"absolute path", absDir, &LocalDir{Dir: absDir}, ""},
+		{"mirror", "https://mirror.example.com/wmcb/", &HTTPMirror{BaseURL: "https://mirror.example.com/wmcb/"}, ""},
+		{"latest GitHub release", "github:openshift/windows-machine-config-bootstrapper",
+			&GitHubRelease{Owner: "openshift", Repo: "windows-machine-config-bootstrapper"}, ""},
+		{"GitHub release", "github:containernetworking/plugins@v0.8.2",
+			&GitHubRelease{Owner: "containernetworking", Repo: "plugins", Tag: "v0.8.2"}, ""},
+		{"invalid GitHub release", "github:plugins", nil, "invalid GitHub payload source"},
+		{"release image", "release:ovn-kubernetes@quay.io/openshift-release-dev/ocp-release@sha256:abc",
+			&ReleaseImage{Release: "quay.io/openshift-release-dev/ocp-release@sha256:abc", Component: "ovn-kubernetes",
+				Dir: "/"}, ""},
+		{"release image directory", "release:ovn-kubernetes:/root/windows@quay.io/ocp-release:4.6",
+			&ReleaseImage{Release: "quay.io/ocp-release:4.6", Component: "ovn-kubernetes", Dir: "/root/windows"}, ""},
+		{"invalid release image", "release:quay.io/ocp-release:4.6", nil, "invalid release image payload source"},
+		{"unknown", "s3://bucket", nil, "unknown payload source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := ParseSource(tt.spec)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, source)
+		})
+	}
+}
+
+// TestParseChecksums tests that the SHA256 of the files are read from the sha256sum format
+func TestParseChecksums(t *testing.T) {
+	sum := strings.Repeat("a", 64)
+	checksums := parseChecksums(strings.NewReader("Release notes\r\n" + sum + "  wmcb.exe\r\n" +
+		strings.ToUpper(sum) + " *hybrid-overlay.exe\n12345  short.exe\n"))
+	assert.Equal(t, map[string]string{"wmcb.exe": sum, "hybrid-overlay.exe": sum}, checksums)
+}
+
+// TestFetch tests that the artifacts are fetched from a local directory and an HTTP mirror, and that the checksums of
+// the mirror are verified
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	srcDir := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "kubelet.exe"), []byte("kubelet"), 0644))
+
+	destDir := filepath.Join(dir, "dest")
+	require.NoError(t, FetchAll(&LocalDir{Dir: srcDir}, []string{"kubelet.exe"}, destDir))
+	contents, err := ioutil.ReadFile(filepath.Join(destDir, "kubelet.exe"))
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet", string(contents))
+	assert.Error(t, FetchAll(&LocalDir{Dir: srcDir}, []string{"wmcb.exe"}, destDir))
+
+	// A wrong SHA256 for wmcb.exe and the SHA256 of an empty file
+	checksums := "6d3d8e1ab8de2a3d5e6a4e0bc2f3d23e16e6d79db8d6c1b5cfb98fc3a8f7d6c0  wmcb.exe\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty.exe\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wmcb/sha256sum.txt":
+			w.Write([]byte(checksums))
+		case "/wmcb/kubelet.exe", "/wmcb/wmcb.exe":
+			w.Write([]byte("kubelet"))
+		case "/wmcb/empty.exe":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	mirror := &HTTPMirror{BaseURL: server.URL + "/wmcb/"}
+	assert.NoError(t, mirror.Fetch("kubelet.exe", filepath.Join(destDir, "kubelet.exe")), "artifact without checksum")
+	assert.NoError(t, mirror.Fetch("empty.exe", filepath.Join(destDir, "empty.exe")))
+	err = mirror.Fetch("wmcb.exe", filepath.Join(destDir, "wmcb.exe"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SHA256")
+	assert.NoFileExists(t, filepath.Join(destDir, "wmcb.exe"), "artifact with a wrong checksum was kept")
+	assert.Error(t, mirror.Fetch("hybrid-overlay.exe", filepath.Join(destDir, "hybrid-overlay.exe")))
+	assert.NoFileExists(t, filepath.Join(destDir, "hybrid-overlay.exe.partial"))
+}
+
+// TestRemoteSources tests the download URLs and the published SHA256 of the artifacts of the mirrors and GitHub
+// releases, which can be downloaded by their consumers themselves
+func TestRemoteSources(t *testing.T) {
+	sum := strings.Repeat("a", 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wmcb/sha256sum.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sum + "  wmcb.exe\n"))
+	}))
+	defer server.Close()
+	var mirror RemoteSource = &HTTPMirror{BaseURL: server.URL + "/wmcb/"}
+	url, err := mirror.URL("wmcb.exe")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/wmcb/wmcb.exe", url)
+	sha, err := mirror.(ChecksumSource).SHA256("wmcb.exe")
+	require.NoError(t, err)
+	assert.Equal(t, sum, sha)
+	_, err = mirror.(ChecksumSource).SHA256("hybrid-overlay.exe")
+	assert.Error(t, err)
+
+	release := &GitHubRelease{Owner: "openshift", Repo: "windows-machine-config-bootstrapper", NameContains: "4.4",
+		release: &githubRelease{TagName: "v4.4.3-alpha", Name: "WMCB 4.4.3",
+			Body: "f819c2df76bc89fe0bd1311eea7dae2a11c40bc26b48b85fd4718e286b0a257e  wmcb.exe\r\n" +
+				"a476f9b7e8b223f5d2efb2066ae48be514d57b66e04038308d1787a770784084  hybrid-overlay.exe",
+			Assets: []githubAsset{{Name: "hybrid-overlay.exe",
+				BrowserDownloadURL: "https://github.com/releases/hybrid-overlay.exe"}}}}
+	assert.Equal(t, "latest 4.4 GitHub release of openshift/windows-machine-config-bootstrapper", release.String())
+	url, err = release.URL("hybrid-overlay.exe")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/releases/hybrid-overlay.exe", url)
+	_, err = release.URL("wni")
+	assert.Error(t, err)
+	sha, err = release.SHA256("hybrid-overlay.exe")
+	require.NoError(t, err)
+	assert.Equal(t, "a476f9b7e8b223f5d2efb2066ae48be514d57b66e04038308d1787a770784084", sha)
+	_, err = release.SHA256("wni")
+	assert.Error(t, err)
+}
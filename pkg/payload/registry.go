@@ -0,0 +1,464 @@
+package payload
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+const (
+	// dockerHub is the registry of the image references without registry
+	dockerHub = "docker.io"
+	// dockerHubHost is the host serving the Docker Hub registry API
+	dockerHubHost = "registry-1.docker.io"
+	// dockerHubAuthKey is the key of the Docker Hub credentials in the pull secrets written by docker login
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+	// whiteoutPrefix prefixes the files of a layer marking the deletion of a file of the lower layers
+	whiteoutPrefix = ".wh."
+	// layerSuffix is the suffix of the files extracted from a layer whose digest is not verified yet
+	layerSuffix = ".layer"
+	// stagedSuffix is the suffix of the files extracted from the verified layers of an image
+	stagedSuffix = ".staged"
+	// imageReferencesFile lists the component images of a release image, as an ImageStream
+	imageReferencesFile = "release-manifests/image-references"
+)
+
+// manifestMediaTypes are the media types of the image manifests and manifest lists accepted from the registries
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// challengeParamRegex matches the parameters of a WWW-Authenticate challenge, e.g. realm="https://quay.io/v2/auth"
+var challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// imageReference is a parsed image pull spec
+type imageReference struct {
+	// registry is the registry of the image, e.g. quay.io
+	registry string
+	// repository is the repository of the image in the registry, e.g. openshift-release-dev/ocp-release
+	repository string
+	// reference is the digest or tag of the image
+	reference string
+}
+
+// parseImageReference parses the given image pull spec, e.g. quay.io/openshift-release-dev/ocp-release:4.6.1-x86_64
+// or quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:<digest>. The images without registry are on Docker Hub.
+func parseImageReference(pullSpec string) (*imageReference, error) {
+	ref := &imageReference{reference: "latest"}
+	name := pullSpec
+	if i := strings.Index(name, "@"); i != -1 {
+		name, ref.reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.reference = name[:i], name[i+1:]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.registry, ref.repository = parts[0], parts[1]
+	} else {
+		ref.registry, ref.repository = dockerHub, name
+		if len(parts) == 1 {
+			ref.repository = "library/" + name
+		}
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return nil, fmt.Errorf("invalid image pull spec %s", pullSpec)
+	}
+	return ref, nil
+}
+
+// String returns the pull spec of the image
+func (i *imageReference) String() string {
+	if strings.Contains(i.reference, ":") {
+		return i.registry + "/" + i.repository + "@" + i.reference
+	}
+	return i.registry + "/" + i.repository + ":" + i.reference
+}
+
+// descriptor describes a blob of an image
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest is an image manifest or a manifest list, in the Docker or OCI format
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// registryClient pulls images from the registries with the Docker Registry HTTP API V2, authenticating with the
+// credentials of a pull secret
+type registryClient struct {
+	// client is the HTTP client of the requests
+	client *http.Client
+	// scheme is the scheme of the registry URLs, http being only used by the tests
+	scheme string
+	// auths are the base64 encoded credentials of the pull secret by registry, or registry and repository prefix
+	auths map[string]string
+	// tokens are the bearer tokens obtained for the repositories
+	tokens map[string]string
+}
+
+// newRegistryClient returns a registryClient authenticating with the credentials of the given pull secret, in the
+// format of the OpenShift pull secrets and of the Docker config.json. The pull secret may be empty for public images.
+func newRegistryClient(pullSecret []byte) (*registryClient, error) {
+	r := &registryClient{
+		client: &http.Client{Timeout: httpTimeout},
+		scheme: "https",
+		auths:  make(map[string]string),
+		tokens: make(map[string]string),
+	}
+	if len(pullSecret) == 0 {
+		return r, nil
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(pullSecret, &config); err != nil {
+		return nil, fmt.Errorf("error parsing pull secret: %v", err)
+	}
+	for key, auth := range config.Auths {
+		if key == dockerHubAuthKey {
+			key = dockerHub
+		}
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		r.auths[strings.TrimSuffix(key, "/")] = auth.Auth
+	}
+	return r, nil
+}
+
+// auth returns the credentials of the pull secret for the given image, the ones of the longest matching repository
+// prefix, or of its registry
+func (r *registryClient) auth(ref *imageReference) string {
+	name := ref.registry + "/" + ref.repository
+	match, auth := "", ""
+	for key, keyAuth := range r.auths {
+		if (key == ref.registry || strings.HasPrefix(name+"/", key+"/")) && len(key) > len(match) {
+			match, auth = key, keyAuth
+		}
+	}
+	return auth
+}
+
+// get gets the given path of the repository of the image from the registry, e.g. manifests/<reference>,
+// authenticating if the registry requests it
+func (r *registryClient) get(ref *imageReference, apiPath string, accept []string) (*http.Response, error) {
+	host := ref.registry
+	if host == dockerHub {
+		host = dockerHubHost
+	}
+	apiURL := fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme, host, ref.repository, apiPath)
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		if token, ok := r.tokens[ref.registry+"/"+ref.repository]; ok {
+			req.Header.Set("Authorization", token)
+		}
+		return r.client.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err = r.authenticate(ref, challenge); err != nil {
+			return nil, fmt.Errorf("error authenticating to %s: %v", ref.registry, err)
+		}
+		if resp, err = do(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s returned %s", apiURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// authenticate answers the given WWW-Authenticate challenge of the registry for the repository of the image, getting
+// a bearer token from the token server of the registry for the Bearer challenges
+func (r *registryClient) authenticate(ref *imageReference, challenge string) error {
+	auth := r.auth(ref)
+	key := ref.registry + "/" + ref.repository
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if auth == "" {
+			return fmt.Errorf("no credentials for %s in the pull secret", ref.registry)
+		}
+		r.tokens[key] = "Basic " + auth
+		return nil
+	}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := make(map[string]string)
+	for _, match := range challengeParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("no realm in authentication challenge %q", challenge)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+ref.repository+":pull")
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request returned %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("error decoding token: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	r.tokens[key] = "Bearer " + token.Token
+	return nil
+}
+
+// manifest returns the manifest of the image for the platform of the node, resolving manifest lists. The manifests
+// referenced by digest are verified against it.
+func (r *registryClient) manifest(ref *imageReference) (*manifest, error) {
+	resp, err := r.get(ref, "manifests/"+ref.reference, manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest of %s: %v", ref, err)
+	}
+	if strings.HasPrefix(ref.reference, "sha256:") {
+		if err = verifyDigest(body, ref.reference); err != nil {
+			return nil, fmt.Errorf("manifest of %s: %v", ref, err)
+		}
+	}
+	var m manifest
+	if err = json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest of %s: %v", ref, err)
+	}
+	if len(m.Manifests) == 0 {
+		return &m, nil
+	}
+	// The images of the release payloads are Linux images, even when the binaries they hold are Windows ones
+	for _, platformManifest := range m.Manifests {
+		if platformManifest.Platform != nil && platformManifest.Platform.OS == "linux" &&
+			platformManifest.Platform.Architecture == runtime.GOARCH {
+			platformRef := *ref
+			platformRef.reference = platformManifest.Digest
+			return r.manifest(&platformRef)
+		}
+	}
+	return nil, fmt.Errorf("no linux/%s image in manifest list of %s", runtime.GOARCH, ref)
+}
+
+// extractFiles extracts the given files of the image, by path in the image, to the given local paths. The layers are
+// applied in order, so that a file of a layer overrides the one of the lower layers, and the digest of every layer is
+// verified. The files are only written to their local path once all the layers are verified, and an error is returned
+// if a file is not in the image.
+func (r *registryClient) extractFiles(ref *imageReference, files map[string]string) error {
+	m, err := r.manifest(ref)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]string)
+	for imagePath, dest := range files {
+		wanted[cleanImagePath(imagePath)] = dest
+	}
+	found := make(map[string]bool)
+	defer func() {
+		for _, dest := range wanted {
+			os.Remove(dest + stagedSuffix)
+		}
+	}()
+	for _, layer := range m.Layers {
+		if err = r.extractLayerFiles(ref, layer, wanted, found); err != nil {
+			return fmt.Errorf("error extracting layer %s of %s: %v", layer.Digest, ref, err)
+		}
+	}
+	for imagePath := range wanted {
+		if !found[imagePath] {
+			return fmt.Errorf("%s not found in %s", imagePath, ref)
+		}
+	}
+	for _, dest := range wanted {
+		if err = os.Rename(dest+stagedSuffix, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractLayerFiles extracts the wanted files of the given layer next to their local path, recording them as found,
+// or as not found if the layer deletes them
+func (r *registryClient) extractLayerFiles(ref *imageReference, layer descriptor, wanted map[string]string,
+	found map[string]bool) error {
+	// The files of the layer are only staged once the digest of the layer is verified
+	extracted := make(map[string]string)
+	defer func() {
+		for _, dest := range extracted {
+			os.Remove(dest + layerSuffix)
+		}
+	}()
+	resp, err := r.get(ref, "blobs/"+layer.Digest, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	hash := sha256.New()
+	reader := io.TeeReader(resp.Body, hash)
+	layerReader := reader
+	switch {
+	case strings.HasSuffix(layer.MediaType, "gzip"):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		layerReader = gzipReader
+	case strings.HasSuffix(layer.MediaType, "tar"):
+	default:
+		return fmt.Errorf("unsupported layer media type %s", layer.MediaType)
+	}
+
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := cleanImagePath(header.Name)
+		if base := path.Base(name); strings.HasPrefix(base, whiteoutPrefix) {
+			deleted := path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix))
+			for imagePath := range wanted {
+				if imagePath == deleted || strings.HasPrefix(imagePath, deleted+"/") {
+					found[imagePath] = false
+				}
+			}
+			continue
+		}
+		dest, ok := wanted[name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err = writeFile(tarReader, dest+layerSuffix); err != nil {
+			return err
+		}
+		extracted[name] = dest
+	}
+	// The rest of the layer is read to verify its digest
+	if _, err = io.Copy(ioutil.Discard, reader); err != nil {
+		return err
+	}
+	if digest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); digest != layer.Digest {
+		return fmt.Errorf("digest of the layer is %s", digest)
+	}
+	for name, dest := range extracted {
+		if err = os.Rename(dest+layerSuffix, dest+stagedSuffix); err != nil {
+			return err
+		}
+		delete(extracted, name)
+		found[name] = true
+	}
+	return nil
+}
+
+// componentImage returns the pull spec of the image of the given component of the release image, listed in the
+// image-references file of the release image
+func (r *registryClient) componentImage(release *imageReference, component string) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "payload")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	referencesPath := path.Join(tmpDir, "image-references")
+	if err = r.extractFiles(release, map[string]string{imageReferencesFile: referencesPath}); err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(referencesPath)
+	if err != nil {
+		return "", err
+	}
+	var imageStream struct {
+		Spec struct {
+			Tags []struct {
+				Name string `json:"name"`
+				From struct {
+					Name string `json:"name"`
+				} `json:"from"`
+			} `json:"tags"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(contents, &imageStream); err != nil {
+		return "", fmt.Errorf("error parsing the image references of %s: %v", release, err)
+	}
+	for _, tag := range imageStream.Spec.Tags {
+		if tag.Name == component {
+			return tag.From.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no component %s in release %s", component, release)
+}
+
+// cleanImagePath returns the given path of a file of an image relative to the root of the image, as in the layers
+func cleanImagePath(imagePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+imagePath), "/")
+}
+
+// verifyDigest returns an error if the given content does not have the given sha256 digest
+func verifyDigest(content []byte, digest string) error {
+	sum := sha256.Sum256(content)
+	if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != digest {
+		return fmt.Errorf("digest is %s instead of %s", actual, digest)
+	}
+	return nil
+}
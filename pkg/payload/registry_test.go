@@ -0,0 +1,219 @@
+package payload
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry is a registry serving blobs and manifests by digest or tag, requiring a bearer token obtained with
+// basic authentication
+type fakeRegistry struct {
+	// blobs are the blobs and manifests by path, e.g. /v2/<repository>/blobs/<digest>
+	blobs map[string][]byte
+	// auth is the base64 encoded credentials required by the token server
+	auth string
+	// server is the server of the registry and its token server
+	server *httptest.Server
+}
+
+// newFakeRegistry returns a running fakeRegistry accepting the given credentials
+func newFakeRegistry(auth string) *fakeRegistry {
+	f := &fakeRegistry{blobs: make(map[string][]byte), auth: auth}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Authorization") != "Basic "+f.auth {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-" + r.URL.Query().Get("scope")})
+			return
+		}
+		repository := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/", 2)[0]
+		repository = strings.SplitN(repository, "/blobs/", 2)[0]
+		if r.Header.Get("Authorization") != "Bearer token-repository:"+repository+":pull" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, f.server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		blob, ok := f.blobs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(blob)
+	}))
+	return f
+}
+
+// host returns the host of the registry
+func (f *fakeRegistry) host() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+// addBlob adds the given blob to the repository and returns its digest
+func (f *fakeRegistry) addBlob(repository string, blob []byte) string {
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	f.blobs["/v2/"+repository+"/blobs/"+digest] = blob
+	return digest
+}
+
+// addManifest adds the given manifest to the repository with the given tag, and returns its digest
+func (f *fakeRegistry) addManifest(t *testing.T, repository, tag string, m interface{}) string {
+	blob, err := json.Marshal(m)
+	require.NoError(t, err)
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	f.blobs["/v2/"+repository+"/manifests/"+digest] = blob
+	if tag != "" {
+		f.blobs["/v2/"+repository+"/manifests/"+tag] = blob
+	}
+	return digest
+}
+
+// layer returns a gzipped tar layer with the given files
+func layer(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)),
+			Typeflag: tar.TypeReg}))
+		_, err := writer.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+// TestParseImageReference tests that the registry, repository and reference are parsed from the pull specs
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		pullSpec string
+		expected imageReference
+	}{
+		{"quay.io/openshift-release-dev/ocp-release:4.6.1-x86_64",
+			imageReference{"quay.io", "openshift-release-dev/ocp-release", "4.6.1-x86_64"}},
+		{"quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:abc",
+			imageReference{"quay.io", "openshift-release-dev/ocp-v4.0-art-dev", "sha256:abc"}},
+		{"mirror.example.com:5000/ocp/release", imageReference{"mirror.example.com:5000", "ocp/release", "latest"}},
+		{"localhost/release:4.6", imageReference{"localhost", "release", "4.6"}},
+		{"openshift/origin-release:4.6", imageReference{"docker.io", "openshift/origin-release", "4.6"}},
+		{"busybox", imageReference{"docker.io", "library/busybox", "latest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pullSpec, func(t *testing.T) {
+			ref, err := parseImageReference(tt.pullSpec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, *ref)
+		})
+	}
+}
+
+// TestRegistryAuth tests that the credentials of the longest matching key of the pull secret are used
+func TestRegistryAuth(t *testing.T) {
+	client, err := newRegistryClient([]byte(`{"auths": {"quay.io": {"auth": "registry"},
+		"quay.io/openshift-release-dev": {"auth": "repository"}, "https://index.docker.io/v1/": {"auth": "hub"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "repository", client.auth(&imageReference{"quay.io", "openshift-release-dev/ocp-release", "4.6"}))
+	assert.Equal(t, "registry", client.auth(&imageReference{"quay.io", "openshift-release-dev-fork/ocp", "4.6"}))
+	assert.Equal(t, "hub", client.auth(&imageReference{"docker.io", "library/busybox", "latest"}))
+	assert.Equal(t, "", client.auth(&imageReference{"registry.redhat.io", "ubi8/ubi", "latest"}))
+	_, err = newRegistryClient([]byte("{"))
+	assert.Error(t, err)
+}
+
+// TestReleaseImage tests that the artifacts are extracted from the layers of the component image of a release image,
+// through a manifest list, and that the layers are verified
+func TestReleaseImage(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	registry := newFakeRegistry(auth)
+	defer registry.server.Close()
+
+	// The component image has a manifest list, the kubelet being overridden by the upper layer
+	layers := []descriptor{
+		{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: registry.addBlob("ocp/art-dev",
+			layer(t, map[string]string{"payload/kubelet.exe": "old kubelet", "payload/kube-proxy.exe": "kube-proxy",
+				"payload/wmcb.exe": "wmcb"}))},
+		{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: registry.addBlob("ocp/art-dev",
+			layer(t, map[string]string{"./payload/kubelet.exe": "kubelet", "payload/.wh.wmcb.exe": ""}))},
+	}
+	componentDigest := registry.addManifest(t, "ocp/art-dev", "", manifest{Layers: layers})
+	platform := descriptor{Digest: componentDigest}
+	platform.Platform = &struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	}{"linux", runtime.GOARCH}
+	listDigest := registry.addManifest(t, "ocp/art-dev", "", manifest{Manifests: []descriptor{platform}})
+
+	references := fmt.Sprintf(`{"kind": "ImageStream", "spec": {"tags": [{"name": "windows-payload", "from": `+
+		`{"kind": "DockerImage", "name": "%s/ocp/art-dev@%s"}}]}}`, registry.host(), listDigest)
+	releaseLayer := descriptor{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+		Digest: registry.addBlob("ocp/release", layer(t, map[string]string{imageReferencesFile: references}))}
+	registry.addManifest(t, "ocp/release", "4.6", manifest{Layers: []descriptor{releaseLayer}})
+
+	dir, err := ioutil.TempDir("", "payload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	source, err := ParseSource("release:windows-payload:/payload@" + registry.host() + "/ocp/release:4.6")
+	require.NoError(t, err)
+	release := source.(*ReleaseImage)
+	// The registry client is created with https, so it is created for the test to use http
+	release.client, err = newRegistryClient([]byte(fmt.Sprintf(`{"auths": {"%s": {"auth": "%s"}}}`,
+		registry.host(), auth)))
+	require.NoError(t, err)
+	release.client.scheme = "http"
+	releaseRef, err := parseImageReference(release.Release)
+	require.NoError(t, err)
+	componentImage, err := release.client.componentImage(releaseRef, release.Component)
+	require.NoError(t, err)
+	assert.Equal(t, registry.host()+"/ocp/art-dev@"+listDigest, componentImage)
+	release.image, err = parseImageReference(componentImage)
+	require.NoError(t, err)
+
+	destDir := filepath.Join(dir, "dest")
+	require.NoError(t, FetchAll(release, []string{"kubelet.exe", "kube-proxy.exe"}, destDir))
+	for name, expected := range map[string]string{"kubelet.exe": "kubelet", "kube-proxy.exe": "kube-proxy"} {
+		contents, err := ioutil.ReadFile(filepath.Join(destDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(contents))
+	}
+	err = release.Fetch("wmcb.exe", filepath.Join(destDir, "wmcb.exe"))
+	require.Error(t, err, "file deleted by the upper layer")
+	assert.Contains(t, err.Error(), "not found")
+	assert.NoFileExists(t, filepath.Join(destDir, "wmcb.exe"))
+
+	// A corrupted layer is refused
+	registry.blobs["/v2/ocp/art-dev/blobs/"+layers[1].Digest] = layer(t, map[string]string{"payload/kubelet.exe": "evil"})
+	err = release.Fetch("kubelet.exe", filepath.Join(destDir, "kubelet.exe"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "digest of the layer")
+	contents, err := ioutil.ReadFile(filepath.Join(destDir, "kubelet.exe"))
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet", string(contents), "file of a corrupted layer was extracted")
+
+	_, err = release.client.componentImage(releaseRef, "hyperkube")
+	assert.Error(t, err, "unknown component")
+	release.client.auths = nil
+	release.client.tokens = make(map[string]string)
+	_, err = release.client.manifest(releaseRef)
+	assert.Error(t, err, "missing credentials")
+}
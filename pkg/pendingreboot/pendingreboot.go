@@ -0,0 +1,180 @@
+package pendingreboot
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+/*
+	pendingreboot detects whether the node waits for a reboot to complete a change. Until then, the features installed
+	are not enabled and the components being serviced are in an intermediate state: the steps depending on them, like
+	starting the kubelet once the Containers feature was installed, fail later with unrelated errors. The registry
+	flags are the ones set by Component Based Servicing, Windows Update, the Session Manager and the computer rename.
+*/
+
+// Reason is a reason for which the node waits for a reboot
+type Reason string
+
+const (
+	// ComponentBasedServicing means that the installation or removal of a Windows feature or update is not complete
+	ComponentBasedServicing Reason = "ComponentBasedServicing"
+	// WindowsUpdate means that Windows Update installed updates which are applied on the next boot
+	WindowsUpdate Reason = "WindowsUpdate"
+	// FileRenameOperations means that files in use are replaced or deleted on the next boot
+	FileRenameOperations Reason = "FileRenameOperations"
+	// ComputerRename means that the computer was renamed, the new name being effective on the next boot
+	ComputerRename Reason = "ComputerRename"
+)
+
+const (
+	// cbsRebootPendingKey exists while Component Based Servicing waits for a reboot
+	cbsRebootPendingKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\RebootPending`
+	// windowsUpdateRebootRequiredKey exists while Windows Update waits for a reboot
+	windowsUpdateRebootRequiredKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`
+	// sessionManagerKey holds the PendingFileRenameOperations value
+	sessionManagerKey = `SYSTEM\CurrentControlSet\Control\Session Manager`
+	// activeComputerNameKey holds the name of the computer until the next boot
+	activeComputerNameKey = `SYSTEM\CurrentControlSet\Control\ComputerName\ActiveComputerName`
+	// computerNameKey holds the name of the computer from the next boot
+	computerNameKey = `SYSTEM\CurrentControlSet\Control\ComputerName\ComputerName`
+)
+
+// Blocking returns true if the steps configuring the node fail until the node is rebooted, false if the reboot only
+// completes changes unrelated to them
+func (r Reason) Blocking() bool {
+	return r == ComponentBasedServicing || r == ComputerRename
+}
+
+// Description describes the change waiting for the reboot
+func (r Reason) Description() string {
+	switch r {
+	case ComponentBasedServicing:
+		return "the installation of a Windows feature or update is not complete"
+	case WindowsUpdate:
+		return "Windows Update installed updates"
+	case FileRenameOperations:
+		return "files are replaced on the next boot"
+	case ComputerRename:
+		return "the computer was renamed"
+	default:
+		return string(r)
+	}
+}
+
+// Get returns the reasons for which the node waits for a reboot, none if it does not
+func Get() ([]Reason, error) {
+	var reasons []Reason
+	for _, key := range []struct {
+		path   string
+		reason Reason
+	}{
+		{cbsRebootPendingKey, ComponentBasedServicing},
+		{windowsUpdateRebootRequiredKey, WindowsUpdate},
+	} {
+		exists, err := keyExists(key.path)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			reasons = append(reasons, key.reason)
+		}
+	}
+
+	renames, err := pendingFileRenames()
+	if err != nil {
+		return nil, err
+	}
+	if renames {
+		reasons = append(reasons, FileRenameOperations)
+	}
+
+	active, err := stringValue(activeComputerNameKey, "ComputerName")
+	if err != nil {
+		return nil, err
+	}
+	next, err := stringValue(computerNameKey, "ComputerName")
+	if err != nil {
+		return nil, err
+	}
+	if computerRenamed(active, next) {
+		reasons = append(reasons, ComputerRename)
+	}
+	return reasons, nil
+}
+
+// Check returns an error if one of the given reasons prevents the node from being configured until it is rebooted. A
+// warning is returned for the other ones.
+func Check(reasons []Reason) (string, error) {
+	var blocking, other []string
+	for _, reason := range reasons {
+		if reason.Blocking() {
+			blocking = append(blocking, reason.Description())
+		} else {
+			other = append(other, reason.Description())
+		}
+	}
+	if len(blocking) > 0 {
+		return "", fmt.Errorf("the node is pending a reboot: %s, reboot the node before configuring it",
+			strings.Join(append(blocking, other...), ", "))
+	}
+	if len(other) > 0 {
+		return fmt.Sprintf("the node is pending a reboot: %s", strings.Join(other, ", ")), nil
+	}
+	return "", nil
+}
+
+// computerRenamed returns true if the name of the computer from the next boot differs from its current one
+func computerRenamed(active, next string) bool {
+	return next != "" && !strings.EqualFold(active, next)
+}
+
+// keyExists returns true if the given registry key of HKLM exists
+func keyExists(path string) (bool, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not open registry key %s: %v", path, err)
+	}
+	key.Close()
+	return true, nil
+}
+
+// pendingFileRenames returns true if the Session Manager has file rename operations to run on the next boot
+func pendingFileRenames() (bool, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, sessionManagerKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false, fmt.Errorf("could not open registry key %s: %v", sessionManagerKey, err)
+	}
+	defer key.Close()
+	operations, _, err := key.GetStringsValue("PendingFileRenameOperations")
+	if err == registry.ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read PendingFileRenameOperations: %v", err)
+	}
+	for _, operation := range operations {
+		if operation != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stringValue returns the given string value of the given registry key of HKLM
+func stringValue(path, name string) (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return "", fmt.Errorf("could not open registry key %s: %v", path, err)
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue(name)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s of %s: %v", name, path, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,39 @@
+package pendingreboot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheck tests that the reboots pending for the servicing of the features and for a computer rename are errors, and
+// that the other ones are warnings
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		reasons []Reason
+		warning bool
+		err     bool
+	}{
+		{"none", nil, false, false},
+		{"feature installed", []Reason{ComponentBasedServicing}, false, true},
+		{"computer renamed", []Reason{ComputerRename}, false, true},
+		{"updates installed", []Reason{WindowsUpdate}, true, false},
+		{"files replaced", []Reason{WindowsUpdate, FileRenameOperations}, true, false},
+		{"feature and files", []Reason{ComponentBasedServicing, FileRenameOperations}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warning, err := Check(test.reasons)
+			assert.Equal(t, test.err, err != nil, "unexpected error %v", err)
+			assert.Equal(t, test.warning, warning != "", "unexpected warning %q", warning)
+		})
+	}
+}
+
+// TestComputerRenamed tests that the computer names are compared case-insensitively
+func TestComputerRenamed(t *testing.T) {
+	assert.False(t, computerRenamed("WIN-NODE-1", "win-node-1"))
+	assert.True(t, computerRenamed("WIN-NODE-1", "WIN-NODE-2"))
+	assert.False(t, computerRenamed("WIN-NODE-1", ""))
+}
@@ -0,0 +1,5 @@
+module github.com/openshift/windows-machine-config-bootstrapper/pkg/poll
+
+go 1.12
+
+require github.com/stretchr/testify v1.7.0
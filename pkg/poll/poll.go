@@ -0,0 +1,125 @@
+package poll
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+/*
+	poll waits for a condition to be reached by checking it at an interval, with jitter so that the pollers started
+	together do not check in lockstep, until a timeout expires, a deadline passes or a context is done. The timeout
+	errors tell what was waited for and the last state observed, e.g. the state a service was stuck in, rather than only
+	that the wait timed out. It is a module of its own, shared by WMCB, WNI and the e2e test framework.
+*/
+
+// DefaultJitter is the jitter of the polls which do not need a specific one, adding up to 10% to their interval
+const DefaultJitter = 0.1
+
+// Clock tells the time and sleeps. The polls take the time from a Clock rather than from the time package, so that
+// they can be unit tested with a fake clock instead of waiting for minutes.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep pauses the current goroutine for the given duration
+	Sleep(time.Duration)
+}
+
+// realClock is the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// ConditionFunc checks whether the state waited for is reached. It returns true once it is, and a description of the
+// state it observed otherwise, e.g. "the kubelet service is in state 3", which the timeout error reports. The errors it
+// returns stop the polling, so the transient errors are to be reported in the observed state instead.
+type ConditionFunc func() (done bool, state string, err error)
+
+// Options are the options of Until
+type Options struct {
+	// Interval is the time waited between two checks of the condition
+	Interval time.Duration
+	// Timeout is the time after which Until gives up, 0 to only give up once the context is done
+	Timeout time.Duration
+	// Deadline is the time at which Until gives up, taking precedence over Timeout if set
+	Deadline time.Time
+	// Jitter is the maximum fraction of the interval randomly added to each wait, e.g. 0.1 for up to 10%
+	Jitter float64
+	// Clock is the clock the waits are taken from, the clock of the time package if nil
+	Clock Clock
+}
+
+// TimeoutError is the error of a condition which was not reached before the timeout expired, the deadline passed or the
+// context was done
+type TimeoutError struct {
+	// Description tells what was waited for, e.g. "the kubelet service to stop"
+	Description string
+	// Elapsed is the time waited
+	Elapsed time.Duration
+	// Err is the error of the context, if it was done first
+	Err error
+	// LastState is the state observed by the last check of the condition
+	LastState string
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("timed out after %s waiting for %s", e.Elapsed, e.Description)
+	if e.Err != nil {
+		msg = fmt.Sprintf("stopped waiting for %s after %s: %v", e.Description, e.Elapsed, e.Err)
+	}
+	if e.LastState != "" {
+		msg += ", last state: " + e.LastState
+	}
+	return msg
+}
+
+// Until checks the condition right away and then every interval, plus its jitter, until it is reached. It returns the
+// error of the condition, or a *TimeoutError with the last observed state once the timeout expires, the deadline
+// passes or the context is done. The condition is checked one last time when the timeout expires.
+func Until(ctx context.Context, description string, options Options, condition ConditionFunc) error {
+	clk := options.Clock
+	if clk == nil {
+		clk = realClock{}
+	}
+	start := clk.Now()
+	deadline := options.Deadline
+	if deadline.IsZero() && options.Timeout > 0 {
+		deadline = start.Add(options.Timeout)
+	}
+	for {
+		done, state, err := condition()
+		if err != nil || done {
+			return err
+		}
+		if ctx.Err() != nil {
+			return &TimeoutError{Description: description, Elapsed: clk.Now().Sub(start), Err: ctx.Err(),
+				LastState: state}
+		}
+		wait := Jittered(options.Interval, options.Jitter)
+		if !deadline.IsZero() {
+			remaining := deadline.Sub(clk.Now())
+			if remaining <= 0 {
+				return &TimeoutError{Description: description, Elapsed: clk.Now().Sub(start), LastState: state}
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+		clk.Sleep(wait)
+	}
+}
+
+// Jittered returns the given interval with up to the given fraction of it randomly added
+func Jittered(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Float64()*jitter*float64(interval))
+}
@@ -0,0 +1,87 @@
+package poll
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock whose time only passes when slept, which returns at once. It records the sleeps.
+type fakeClock struct {
+	// now is the current time of the clock
+	now time.Time
+	// sleeps are the durations slept, in order
+	sleeps []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Sleep(d time.Duration) {
+	f.sleeps = append(f.sleeps, d)
+	f.now = f.now.Add(d)
+}
+
+// TestUntil tests that the condition is polled until it is reached, fails, or the timeout expires, and that the
+// timeout error reports the last observed state
+func TestUntil(t *testing.T) {
+	fake := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	options := Options{Interval: time.Second, Timeout: 10 * time.Second, Clock: fake}
+	checks := 0
+	err := Until(context.Background(), "the third check", options, func() (bool, string, error) {
+		checks++
+		return checks == 3, fmt.Sprintf("check %d", checks), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, fake.sleeps)
+
+	err = Until(context.Background(), "nothing", options, func() (bool, string, error) {
+		return false, "", fmt.Errorf("access denied")
+	})
+	assert.EqualError(t, err, "access denied")
+
+	fake.sleeps = nil
+	options.Interval = 3 * time.Second
+	checks = 0
+	err = Until(context.Background(), "the kubelet service to stop", options, func() (bool, string, error) {
+		checks++
+		return false, "the service is in state 4", nil
+	})
+	assert.Equal(t, &TimeoutError{Description: "the kubelet service to stop", Elapsed: 10 * time.Second,
+		LastState: "the service is in state 4"}, err)
+	assert.EqualError(t, err, "timed out after 10s waiting for the kubelet service to stop, last state: the service "+
+		"is in state 4")
+	assert.Equal(t, []time.Duration{3 * time.Second, 3 * time.Second, 3 * time.Second, time.Second}, fake.sleeps,
+		"the last wait should be cut to the timeout")
+	assert.Equal(t, 5, checks, "the condition should be checked once more when the timeout expires")
+
+	options.Deadline = fake.Now().Add(time.Second)
+	err = Until(context.Background(), "the service to stop", options, func() (bool, string, error) {
+		return false, "", nil
+	})
+	assert.EqualError(t, err, "timed out after 1s waiting for the service to stop")
+}
+
+// TestUntilContext tests that the polling stops once the context is done
+func TestUntilContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Until(ctx, "the context", Options{Interval: time.Second, Clock: &fakeClock{}}, func() (bool, string, error) {
+		cancel()
+		return false, "cancelled", nil
+	})
+	assert.EqualError(t, err, "stopped waiting for the context after 0s: context canceled, last state: cancelled")
+}
+
+// TestJittered tests that the jitter only lengthens the interval, by up to its fraction
+func TestJittered(t *testing.T) {
+	assert.Equal(t, time.Second, Jittered(time.Second, 0))
+	for i := 0; i < 100; i++ {
+		wait := Jittered(time.Second, DefaultJitter)
+		assert.True(t, wait >= time.Second && wait <= 1100*time.Millisecond, "jittered wait %v", wait)
+	}
+}
@@ -0,0 +1,274 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ignitionv2 "github.com/coreos/ignition/config/v2_2"
+	"github.com/vincent-petithory/dataurl"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+/*
+	probe checks from the Windows node that the cluster services it needs to bootstrap are reachable: the API server,
+	the ignition server, the image registries and DNS. A node that never joins the cluster almost always has one of
+	them blocked, by a security group, a firewall, a proxy or the DNS configuration, so each endpoint is checked stage
+	by stage and the result tells at which stage it failed:
+	- dns, the host name of the endpoint does not resolve
+	- connect, no TCP connection can be opened to any of the resolved addresses
+	- tls, the TLS handshake fails, e.g. when a proxy intercepts the connection
+	- http, the endpoint does not answer, or answers with a server error
+*/
+
+const (
+	// DefaultTimeout is the default time given to each endpoint to answer
+	DefaultTimeout = 10 * time.Second
+	// ignitionServerPort is the port the machine config server serves the worker ignition on
+	ignitionServerPort = "22623"
+	// bootstrapKubeconfigPath is the location of the bootstrap kubeconfig in the worker ignition
+	bootstrapKubeconfigPath = "/etc/kubernetes/kubeconfig"
+)
+
+// Kind is the kind of check made on an endpoint
+type Kind string
+
+const (
+	// DNS checks that the host name of the endpoint resolves
+	DNS Kind = "dns"
+	// TCP checks that a connection to the endpoint can be opened
+	TCP Kind = "tcp"
+	// HTTPS checks that the endpoint answers HTTPS requests. Any answer but a server error shows that the endpoint is
+	// reachable, like the unauthorized answer of a registry to an anonymous request.
+	HTTPS Kind = "https"
+)
+
+// The stages of the checks
+const (
+	// StageDNS is the resolution of the host name of the endpoint
+	StageDNS = "dns"
+	// StageConnect is the opening of a TCP connection to the endpoint
+	StageConnect = "connect"
+	// StageTLS is the TLS handshake with the endpoint
+	StageTLS = "tls"
+	// StageHTTP is the HTTP request to the endpoint
+	StageHTTP = "http"
+)
+
+// Endpoint is a service the node needs to reach
+type Endpoint struct {
+	// Name describes the service, e.g. api-server
+	Name string `json:"name"`
+	// Kind is the kind of check made on the endpoint
+	Kind Kind `json:"kind"`
+	// Address is the host name for a DNS check, the host:port for a TCP check and the URL for an HTTPS check
+	Address string `json:"address"`
+}
+
+// Result is the result of the check of an endpoint
+type Result struct {
+	Endpoint
+	// Reachable is true if every stage of the check succeeded
+	Reachable bool `json:"reachable"`
+	// FailedStage is the stage the check failed at, empty if the endpoint is reachable
+	FailedStage string `json:"failedStage,omitempty"`
+	// Error is the reason the check failed
+	Error string `json:"error,omitempty"`
+	// Addresses are the IP addresses the host name of the endpoint resolved to
+	Addresses []string `json:"addresses,omitempty"`
+	// StatusCode is the HTTP status code the endpoint answered with
+	StatusCode int `json:"statusCode,omitempty"`
+	// DurationMilliseconds is the time the check took
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
+}
+
+// Prober checks the reachability of endpoints
+type Prober struct {
+	// Timeout is the time given to each endpoint to answer
+	Timeout time.Duration
+	// lookupHost resolves host names, it is replaced by the tests
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// NewProber returns a prober giving each endpoint the given time to answer
+func NewProber(timeout time.Duration) *Prober {
+	return &Prober{Timeout: timeout, lookupHost: net.DefaultResolver.LookupHost}
+}
+
+// Probe checks the endpoints concurrently and returns their results in the same order
+func (p *Prober) Probe(endpoints []Endpoint) []Result {
+	results := make([]Result, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint Endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = p.probe(endpoint)
+			results[i].DurationMilliseconds = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+		}(i, endpoint)
+	}
+	wg.Wait()
+	return results
+}
+
+// probe checks the given endpoint stage by stage
+func (p *Prober) probe(endpoint Endpoint) Result {
+	result := Result{Endpoint: endpoint}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	var host, port string
+	var requestURL *url.URL
+	switch endpoint.Kind {
+	case DNS:
+		host = endpoint.Address
+	case TCP:
+		var err error
+		if host, port, err = net.SplitHostPort(endpoint.Address); err != nil {
+			return result.fail(StageDNS, fmt.Errorf("invalid address %s: %v", endpoint.Address, err))
+		}
+	case HTTPS:
+		var err error
+		if requestURL, err = url.Parse(endpoint.Address); err != nil || requestURL.Scheme != "https" {
+			return result.fail(StageDNS, fmt.Errorf("invalid HTTPS URL %s", endpoint.Address))
+		}
+		host, port = requestURL.Hostname(), requestURL.Port()
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return result.fail(StageDNS, fmt.Errorf("unknown kind %s", endpoint.Kind))
+	}
+
+	addresses, err := p.lookupHost(ctx, host)
+	if err != nil {
+		return result.fail(StageDNS, err)
+	}
+	result.Addresses = addresses
+	if endpoint.Kind == DNS {
+		result.Reachable = true
+		return result
+	}
+
+	conn, err := dialAny(ctx, addresses, port)
+	if err != nil {
+		return result.fail(StageConnect, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if endpoint.Kind == TCP {
+		result.Reachable = true
+		return result
+	}
+
+	// The certificates of the cluster services are signed by the cluster CA, which the node does not trust before it
+	// is bootstrapped, and the probe is about reachability, so they are not verified
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err = tlsConn.Handshake(); err != nil {
+		return result.fail(StageTLS, err)
+	}
+	request, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return result.fail(StageHTTP, err)
+	}
+	request.Header.Set("User-Agent", "wmcb-probe")
+	if err = request.Write(tlsConn); err != nil {
+		return result.fail(StageHTTP, err)
+	}
+	response, err := http.ReadResponse(bufio.NewReader(tlsConn), request)
+	if err != nil {
+		return result.fail(StageHTTP, err)
+	}
+	response.Body.Close()
+	result.StatusCode = response.StatusCode
+	if response.StatusCode >= http.StatusInternalServerError {
+		return result.fail(StageHTTP, fmt.Errorf("server error %s", response.Status))
+	}
+	result.Reachable = true
+	return result
+}
+
+// fail records that the check failed at the given stage and returns the result
+func (r Result) fail(stage string, err error) Result {
+	r.Reachable = false
+	r.FailedStage = stage
+	r.Error = err.Error()
+	return r
+}
+
+// dialAny opens a TCP connection to the first of the addresses accepting one on the given port
+func dialAny(ctx context.Context, addresses []string, port string) (net.Conn, error) {
+	var dialer net.Dialer
+	var errs []string
+	for _, address := range addresses {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// ClusterEndpoints returns the endpoints the node needs to reach to bootstrap: the API server given by its URL, e.g.
+// https://api-int.cluster.example.com:6443, the ignition server, which defaults to the machine config server on the
+// host of the API server, the given image registries and the given host names to resolve
+func ClusterEndpoints(apiServer, ignitionServer string, registries, dnsNames []string) ([]Endpoint, error) {
+	apiServerURL, err := url.Parse(apiServer)
+	if err != nil || apiServerURL.Scheme != "https" || apiServerURL.Host == "" {
+		return nil, fmt.Errorf("invalid API server URL %q", apiServer)
+	}
+	if ignitionServer == "" {
+		ignitionServer = "https://" + net.JoinHostPort(apiServerURL.Hostname(), ignitionServerPort) + "/healthz"
+	}
+	endpoints := []Endpoint{
+		{Name: "api-server", Kind: HTTPS, Address: strings.TrimSuffix(apiServer, "/") + "/readyz"},
+		{Name: "ignition-server", Kind: HTTPS, Address: ignitionServer},
+	}
+	for _, registry := range registries {
+		endpoints = append(endpoints, Endpoint{Name: "registry " + registry, Kind: HTTPS,
+			Address: "https://" + registry + "/v2/"})
+	}
+	for _, name := range dnsNames {
+		endpoints = append(endpoints, Endpoint{Name: "dns " + name, Kind: DNS, Address: name})
+	}
+	return endpoints, nil
+}
+
+// APIServerFromIgnition returns the URL of the API server from the bootstrap kubeconfig of the given worker ignition
+func APIServerFromIgnition(contents []byte) (string, error) {
+	configuration, _, err := ignitionv2.Parse(contents)
+	if err != nil {
+		return "", fmt.Errorf("could not parse ignition file: %v", err)
+	}
+	for _, file := range configuration.Storage.Files {
+		if file.Node.Path != bootstrapKubeconfigPath {
+			continue
+		}
+		kubeconfig, err := dataurl.DecodeString(file.Contents.Source)
+		if err != nil {
+			return "", fmt.Errorf("could not decode %s: %v", bootstrapKubeconfigPath, err)
+		}
+		config, err := clientcmd.Load(kubeconfig.Data)
+		if err != nil {
+			return "", fmt.Errorf("could not parse %s: %v", bootstrapKubeconfigPath, err)
+		}
+		for _, cluster := range config.Clusters {
+			if cluster.Server != "" {
+				return cluster.Server, nil
+			}
+		}
+		return "", fmt.Errorf("no server in %s", bootstrapKubeconfigPath)
+	}
+	return "", fmt.Errorf("no %s in the ignition file", bootstrapKubeconfigPath)
+}
@@ -0,0 +1,147 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProber returns a prober resolving the given host names to the loopback address and failing to resolve the others
+func testProber(hosts ...string) *Prober {
+	return &Prober{Timeout: 5 * time.Second, lookupHost: func(ctx context.Context, host string) ([]string, error) {
+		for _, h := range hosts {
+			if h == host {
+				return []string{"127.0.0.1"}, nil
+			}
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}}
+}
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	return port
+}
+
+// TestProbe tests that each endpoint is reported as reachable or as failing at the right stage
+func TestProbe(t *testing.T) {
+	ok := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ok.Close()
+	failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	// The servers are reached through a host name, as the cluster services are
+	address := func(server *httptest.Server) string {
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		return "https://registry.example.com:" + u.Port() + "/v2/"
+	}
+	port := closedPort(t)
+	tests := []struct {
+		endpoint   Endpoint
+		stage      string
+		statusCode int
+	}{
+		{Endpoint{"ok", HTTPS, address(ok)}, "", http.StatusUnauthorized},
+		{Endpoint{"server error", HTTPS, address(failing)}, StageHTTP, http.StatusServiceUnavailable},
+		{Endpoint{"not TLS", HTTPS, address(plain)}, StageTLS, 0},
+		{Endpoint{"closed", HTTPS, "https://registry.example.com:" + port + "/v2/"}, StageConnect, 0},
+		{Endpoint{"unresolved", HTTPS, "https://unknown.example.com/v2/"}, StageDNS, 0},
+		{Endpoint{"not HTTPS", HTTPS, "http://registry.example.com/v2/"}, StageDNS, 0},
+		{Endpoint{"tcp", TCP, "registry.example.com:" + port}, StageConnect, 0},
+		{Endpoint{"dns", DNS, "registry.example.com"}, "", 0},
+		{Endpoint{"unresolved dns", DNS, "unknown.example.com"}, StageDNS, 0},
+	}
+	var endpoints []Endpoint
+	for _, tt := range tests {
+		endpoints = append(endpoints, tt.endpoint)
+	}
+	results := testProber("registry.example.com").Probe(endpoints)
+	require.Len(t, results, len(tests))
+	for i, tt := range tests {
+		t.Run(tt.endpoint.Name, func(t *testing.T) {
+			result := results[i]
+			assert.Equal(t, tt.endpoint, result.Endpoint, "the results should be in the order of the endpoints")
+			assert.Equal(t, tt.stage == "", result.Reachable)
+			assert.Equal(t, tt.stage, result.FailedStage)
+			assert.Equal(t, tt.stage == "", result.Error == "", result.Error)
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+// TestProbeTimeout tests that an endpoint accepting connections but never answering fails within the timeout
+func TestProbeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	prober := testProber("api-int.example.com")
+	prober.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	results := prober.Probe([]Endpoint{{"api-server", HTTPS, "https://api-int.example.com:" + port + "/readyz"}})
+	assert.True(t, time.Since(start) < 5*time.Second, "the probe took %v", time.Since(start))
+	assert.False(t, results[0].Reachable)
+	assert.Equal(t, StageTLS, results[0].FailedStage)
+}
+
+// TestClusterEndpoints tests the endpoints derived from the API server URL
+func TestClusterEndpoints(t *testing.T) {
+	endpoints, err := ClusterEndpoints("https://api-int.example.com:6443/", "", []string{"quay.io"},
+		[]string{"api-int.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []Endpoint{
+		{"api-server", HTTPS, "https://api-int.example.com:6443/readyz"},
+		{"ignition-server", HTTPS, "https://api-int.example.com:22623/healthz"},
+		{"registry quay.io", HTTPS, "https://quay.io/v2/"},
+		{"dns api-int.example.com", DNS, "api-int.example.com"},
+	}, endpoints)
+
+	endpoints, err = ClusterEndpoints("https://api.example.com:443", "https://ignition.example.com/ignition", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://ignition.example.com/ignition", endpoints[1].Address)
+
+	for _, apiServer := range []string{"", "api-int.example.com:6443", "http://api-int.example.com:6443"} {
+		_, err = ClusterEndpoints(apiServer, "", nil, nil)
+		assert.Error(t, err, apiServer)
+	}
+}
+
+// TestAPIServerFromIgnition tests that the API server is read from the bootstrap kubeconfig of the ignition
+func TestAPIServerFromIgnition(t *testing.T) {
+	kubeconfig := url.PathEscape("apiVersion: v1\nkind: Config\nclusters:\n- name: local\n  cluster:\n" +
+		"    server: https://api-int.example.com:6443\n")
+	ignition := func(path string) []byte {
+		return []byte(`{"ignition":{"version":"2.2.0"},"storage":{"files":[{"filesystem":"root","path":"` + path +
+			`","contents":{"source":"data:,` + kubeconfig + `"},"mode":420}]}}`)
+	}
+	apiServer, err := APIServerFromIgnition(ignition(bootstrapKubeconfigPath))
+	require.NoError(t, err)
+	assert.Equal(t, "https://api-int.example.com:6443", apiServer)
+
+	_, err = APIServerFromIgnition(ignition("/etc/kubernetes/cloud.conf"))
+	assert.Error(t, err, "an ignition without a kubeconfig has no API server")
+	_, err = APIServerFromIgnition([]byte("{"))
+	assert.Error(t, err)
+}
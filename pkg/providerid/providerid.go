@@ -0,0 +1,213 @@
+package providerid
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+	providerid computes the provider ID of the node, the ID of its instance in the cloud the kubelet registers the
+	node with. The cloud controller managers find the instances of the nodes by their provider ID, e.g. to add them to
+	the backends of the load balancers of the LoadBalancer services, and ignore the nodes without one. The ID is read
+	from the instance metadata service of the platform, or from the BIOS on vSphere, in the format of the cloud
+	provider of the platform:
+	- aws:///<availability zone>/<instance ID>
+	- azure:///subscriptions/<subscription>/resourceGroups/<resource group>/providers/Microsoft.Compute/virtualMachines/<name>
+	- vsphere://<BIOS UUID>
+*/
+
+// Platform is a cloud platform, named after the kubelet cloud provider of its nodes
+type Platform string
+
+const (
+	// AWS is Amazon Web Services
+	AWS Platform = "aws"
+	// Azure is Microsoft Azure
+	Azure Platform = "azure"
+	// VSphere is VMware vSphere
+	VSphere Platform = "vsphere"
+)
+
+const (
+	// DefaultMetadataEndpoint is the address of the instance metadata services of AWS and Azure
+	DefaultMetadataEndpoint = "http://169.254.169.254"
+	// metadataTimeout is the time given to the instance metadata service to answer. It answers right away when it is
+	// reachable.
+	metadataTimeout = 5 * time.Second
+	// awsTokenTTL is the lifetime in seconds of the IMDSv2 session token, which is only used for a couple of requests
+	awsTokenTTL = "60"
+	// azureAPIVersion is the version of the Azure instance metadata service API
+	azureAPIVersion = "2019-06-01"
+	// vmwareSerialPrefix is the prefix of the BIOS serial number of the vSphere VMs, followed by their UUID
+	vmwareSerialPrefix = "VMware-"
+)
+
+// Resolver computes the provider ID of the node
+type Resolver struct {
+	// MetadataEndpoint is the address of the instance metadata service
+	MetadataEndpoint string
+	// Client is the client of the instance metadata service
+	Client *http.Client
+	// SerialNumber returns the BIOS serial number of the node
+	SerialNumber func() (string, error)
+}
+
+// NewResolver returns a Resolver reading the instance metadata service and the BIOS of the node
+func NewResolver() *Resolver {
+	return &Resolver{
+		MetadataEndpoint: DefaultMetadataEndpoint,
+		// The instance metadata service is link-local and must not be reached through a proxy
+		Client:       &http.Client{Timeout: metadataTimeout, Transport: &http.Transport{Proxy: nil}},
+		SerialNumber: biosSerialNumber,
+	}
+}
+
+// ParsePlatform returns the platform of the given kubelet cloud provider, and false if the provider IDs of its nodes
+// are not computed, e.g. for the nodes without a cloud provider
+func ParsePlatform(cloudProvider string) (Platform, bool) {
+	switch platform := Platform(strings.ToLower(cloudProvider)); platform {
+	case AWS, Azure, VSphere:
+		return platform, true
+	}
+	return "", false
+}
+
+// ProviderID returns the provider ID of the node on the given platform
+func (r *Resolver) ProviderID(platform Platform) (string, error) {
+	switch platform {
+	case AWS:
+		return r.aws()
+	case Azure:
+		return r.azure()
+	case VSphere:
+		return r.vsphere()
+	}
+	return "", fmt.Errorf("no provider ID on platform %q, expected %s, %s or %s", platform, AWS, Azure, VSphere)
+}
+
+// Validate returns an error if the given provider ID, e.g. given by the user, is not in the format of the given
+// platform
+func Validate(platform Platform, providerID string) error {
+	prefix := string(platform) + "://"
+	if !strings.HasPrefix(providerID, prefix) || len(providerID) == len(prefix) {
+		return fmt.Errorf("invalid provider ID %q, expected %s<ID> on %s", providerID, prefix, platform)
+	}
+	return nil
+}
+
+// aws returns the provider ID of the EC2 instance, read with an IMDSv2 session token so that it works on the
+// instances requiring IMDSv2
+func (r *Resolver) aws() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, r.MetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", awsTokenTTL)
+	token, err := r.get(req)
+	if err != nil {
+		return "", fmt.Errorf("could not get an instance metadata token: %v", err)
+	}
+	values := make(map[string]string)
+	for _, path := range []string{"placement/availability-zone", "instance-id"} {
+		req, err := http.NewRequest(http.MethodGet, r.MetadataEndpoint+"/latest/meta-data/"+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		if values[path], err = r.get(req); err != nil {
+			return "", fmt.Errorf("could not get the %s of the instance: %v", path, err)
+		}
+	}
+	return "aws:///" + values["placement/availability-zone"] + "/" + values["instance-id"], nil
+}
+
+// azureCompute are the compute metadata of the Azure VM the provider ID is made of
+type azureCompute struct {
+	SubscriptionID    string `json:"subscriptionId"`
+	ResourceGroupName string `json:"resourceGroupName"`
+	Name              string `json:"name"`
+}
+
+// azure returns the provider ID of the Azure VM
+func (r *Resolver) azure() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, r.MetadataEndpoint+"/metadata/instance/compute?api-version="+
+		azureAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	out, err := r.get(req)
+	if err != nil {
+		return "", fmt.Errorf("could not get the compute metadata of the VM: %v", err)
+	}
+	var compute azureCompute
+	if err := json.Unmarshal([]byte(out), &compute); err != nil {
+		return "", fmt.Errorf("could not parse the compute metadata of the VM %s: %v", out, err)
+	}
+	if compute.SubscriptionID == "" || compute.ResourceGroupName == "" || compute.Name == "" {
+		return "", fmt.Errorf("incomplete compute metadata of the VM %s", out)
+	}
+	// The cloud provider lowercases the resource group, so that the IDs it builds from the API responses match
+	return fmt.Sprintf("azure:///subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s",
+		compute.SubscriptionID, strings.ToLower(compute.ResourceGroupName), compute.Name), nil
+}
+
+// get sends the given request to the instance metadata service and returns the body of the answer
+func (r *Resolver) get(req *http.Request) (string, error) {
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// vsphere returns the provider ID of the vSphere VM, made of the UUID in its BIOS serial number
+func (r *Resolver) vsphere() (string, error) {
+	serial, err := r.SerialNumber()
+	if err != nil {
+		return "", err
+	}
+	uuid, err := VSphereUUID(serial)
+	if err != nil {
+		return "", err
+	}
+	return "vsphere://" + uuid, nil
+}
+
+// VSphereUUID returns the UUID of the vSphere VM of the given BIOS serial number, e.g.
+// VMware-42 1e 2f 5c 3d 4b 6a 7e-8f 9a 0b 1c 2d 3e 4f 50, as the vSphere cloud provider reads it
+func VSphereUUID(serial string) (string, error) {
+	serial = strings.TrimSpace(serial)
+	if !strings.HasPrefix(serial, vmwareSerialPrefix) {
+		return "", fmt.Errorf("BIOS serial number %q is not the one of a vSphere VM", serial)
+	}
+	hex := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimPrefix(serial, vmwareSerialPrefix))
+	if len(hex) != 32 {
+		return "", fmt.Errorf("BIOS serial number %q does not hold a UUID", serial)
+	}
+	hex = strings.ToLower(hex)
+	return hex[0:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:32], nil
+}
+
+// biosSerialNumber returns the serial number of the BIOS of the node
+func biosSerialNumber() (string, error) {
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"(Get-CimInstance -ClassName Win32_BIOS).SerialNumber").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("could not get the BIOS serial number: %v, %s", err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,123 @@
+package providerid
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestResolver returns a resolver of the given instance metadata service and BIOS serial number
+func newTestResolver(server *httptest.Server, serial string) *Resolver {
+	return &Resolver{MetadataEndpoint: server.URL, Client: server.Client(),
+		SerialNumber: func() (string, error) { return serial, nil }}
+}
+
+// TestAWSProviderID tests that the provider ID of an EC2 instance is read with an IMDSv2 session token
+func TestAWSProviderID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, awsTokenTTL, r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			fmt.Fprint(w, "token")
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/placement/availability-zone":
+			fmt.Fprint(w, "us-east-1a")
+		case "/latest/meta-data/instance-id":
+			fmt.Fprint(w, "i-0123456789abcdef0\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	providerID, err := newTestResolver(server, "").ProviderID(AWS)
+	require.NoError(t, err)
+	assert.Equal(t, "aws:///us-east-1a/i-0123456789abcdef0", providerID)
+}
+
+// TestAzureProviderID tests that the provider ID of an Azure VM is built from its compute metadata, with the resource
+// group lowercased as the cloud provider does
+func TestAzureProviderID(t *testing.T) {
+	compute := `{"subscriptionId": "8d6f0a3b-1c2d-4e5f-9a8b-7c6d5e4f3a2b", "resourceGroupName": "Cluster-RG",
+		"name": "winnode-0", "location": "eastus"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance/compute" ||
+			r.URL.Query().Get("api-version") != azureAPIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, compute)
+	}))
+	defer server.Close()
+
+	providerID, err := newTestResolver(server, "").ProviderID(Azure)
+	require.NoError(t, err)
+	assert.Equal(t, "azure:///subscriptions/8d6f0a3b-1c2d-4e5f-9a8b-7c6d5e4f3a2b/resourceGroups/cluster-rg/providers/"+
+		"Microsoft.Compute/virtualMachines/winnode-0", providerID)
+
+	compute = `{"subscriptionId": "8d6f0a3b-1c2d-4e5f-9a8b-7c6d5e4f3a2b"}`
+	_, err = newTestResolver(server, "").ProviderID(Azure)
+	assert.Error(t, err, "provider ID built from incomplete metadata")
+}
+
+// TestVSphereProviderID tests that the provider ID of a vSphere VM is made of the UUID in its BIOS serial number
+func TestVSphereProviderID(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	providerID, err := newTestResolver(server, "VMware-42 1e 2f 5c 3d 4b 6a 7e-8f 9a 0b 1c 2d 3e 4f 50\r\n").
+		ProviderID(VSphere)
+	require.NoError(t, err)
+	assert.Equal(t, "vsphere://421e2f5c-3d4b-6a7e-8f9a-0b1c2d3e4f50", providerID)
+
+	for _, serial := range []string{"ec2abcdef-1234", "VMware-42 1e 2f", ""} {
+		_, err = VSphereUUID(serial)
+		assert.Error(t, err, "UUID read from serial number %q", serial)
+	}
+}
+
+// TestProviderIDErrors tests that the failures of the instance metadata service and the unknown platforms are errors
+func TestProviderIDErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	resolver := newTestResolver(server, "")
+
+	_, err := resolver.ProviderID(AWS)
+	assert.Error(t, err)
+	_, err = resolver.ProviderID(Azure)
+	assert.Error(t, err)
+	_, err = resolver.ProviderID("gce")
+	assert.EqualError(t, err, `no provider ID on platform "gce", expected aws, azure or vsphere`)
+}
+
+// TestParsePlatform tests that the platforms are named after the kubelet cloud providers
+func TestParsePlatform(t *testing.T) {
+	platform, ok := ParsePlatform("AWS")
+	assert.True(t, ok)
+	assert.Equal(t, AWS, platform)
+	platform, ok = ParsePlatform("vsphere")
+	assert.True(t, ok)
+	assert.Equal(t, VSphere, platform)
+	_, ok = ParsePlatform("")
+	assert.False(t, ok)
+	_, ok = ParsePlatform("external")
+	assert.False(t, ok)
+}
+
+// TestValidate tests that the provider IDs given by the user are checked against the format of the platform
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(AWS, "aws:///us-east-1a/i-0123456789abcdef0"))
+	assert.NoError(t, Validate(VSphere, "vsphere://421e2f5c-3d4b-6a7e-8f9a-0b1c2d3e4f50"))
+	assert.Error(t, Validate(AWS, "i-0123456789abcdef0"))
+	assert.Error(t, Validate(Azure, "aws:///us-east-1a/i-0123456789abcdef0"))
+	assert.Error(t, Validate(VSphere, "vsphere://"))
+}
@@ -0,0 +1,274 @@
+package registrymirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+	registrymirror generates the registry configuration of the container runtime of a Windows node from the
+	ImageContentSourcePolicies of the cluster, so that the node pulls its images from the same mirrors as the Linux
+	nodes, e.g. from the mirror registry of a disconnected cluster. containerd is configured with a hosts.toml file per
+	registry and Docker with the registry-mirrors of its daemon.json.
+*/
+
+const (
+	// dockerHub is the name of the Docker Hub registry in image references
+	dockerHub = "docker.io"
+	// dockerHubServer is the server of the Docker Hub registry
+	dockerHubServer = "https://registry-1.docker.io"
+	// HostsFileName is the name of the containerd registry host configuration file, in the directory of each registry
+	HostsFileName = "hosts.toml"
+	// registryMirrorsKey is the key of the Docker Hub mirrors in the Docker daemon configuration
+	registryMirrorsKey = "registry-mirrors"
+)
+
+// Mirror is a source repository, or registry, and the mirrors its images are pulled from, as listed by the
+// repositoryDigestMirrors of an ImageContentSourcePolicy
+type Mirror struct {
+	// Source is the repository mirrored, e.g. quay.io/openshift-release-dev/ocp-release, or a whole registry
+	Source string `json:"source"`
+	// Mirrors are the repositories the images of the source are pulled from, in order of preference
+	Mirrors []string `json:"mirrors"`
+}
+
+// imageContentSourcePolicy is the subset of an ImageContentSourcePolicy, or of a list of them, that is needed to
+// configure the mirrors. A list is parsed as is returned by oc get imagecontentsourcepolicy -o json.
+type imageContentSourcePolicy struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		RepositoryDigestMirrors []Mirror `json:"repositoryDigestMirrors"`
+	} `json:"spec"`
+	Items []imageContentSourcePolicy `json:"items"`
+}
+
+// ParseImageContentSourcePolicies returns the mirrors of the given ImageContentSourcePolicy or list of them in JSON.
+// The mirrors of the same source are merged, and the sources are sorted.
+func ParseImageContentSourcePolicies(data []byte) ([]Mirror, error) {
+	var policy imageContentSourcePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing ImageContentSourcePolicies: %v", err)
+	}
+	policies := policy.Items
+	if !strings.HasSuffix(policy.Kind, "List") {
+		policies = []imageContentSourcePolicy{policy}
+	}
+
+	mirrors := make(map[string][]string)
+	for _, policy := range policies {
+		for _, mirror := range policy.Spec.RepositoryDigestMirrors {
+			source := strings.TrimSuffix(mirror.Source, "/")
+			if source == "" {
+				return nil, fmt.Errorf("ImageContentSourcePolicy with an empty source")
+			}
+			for _, repository := range mirror.Mirrors {
+				repository = strings.TrimSuffix(repository, "/")
+				if !contains(mirrors[source], repository) {
+					mirrors[source] = append(mirrors[source], repository)
+				}
+			}
+		}
+	}
+	var merged []Mirror
+	for source, repositories := range mirrors {
+		merged = append(merged, Mirror{Source: source, Mirrors: repositories})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Source < merged[j].Source })
+	return merged, nil
+}
+
+// contains returns true if the given values contain the given value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRepository returns the registry host and the path of the given repository
+func splitRepository(repository string) (string, string) {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// endpoint is a mirror registry endpoint a registry is pulled from
+type endpoint struct {
+	// url is the URL of the endpoint. If overridePath is set, it includes the API path, e.g.
+	// https://mirror.example.com/v2/ocp4, otherwise it is the URL of the registry, e.g. https://mirror.example.com
+	url string
+	// overridePath is set if the image paths are relative to the path of the URL instead of to /v2
+	overridePath bool
+}
+
+// mirrorEndpoint returns the endpoint the images of the given source are pulled from for the given mirror. Runtimes
+// only map registries to registries, keeping the path of the images, so the mirror has to end with the path of the
+// source. An error is returned otherwise.
+func mirrorEndpoint(source, mirror string) (endpoint, error) {
+	_, sourcePath := splitRepository(source)
+	mirrorHost, mirrorPath := splitRepository(mirror)
+	prefix := mirrorPath
+	if sourcePath != "" {
+		if mirrorPath != sourcePath && !strings.HasSuffix(mirrorPath, "/"+sourcePath) {
+			return endpoint{}, fmt.Errorf("mirror %s of %s does not end with the path of the source, which "+
+				"cannot be configured on Windows nodes", mirror, source)
+		}
+		prefix = strings.TrimSuffix(strings.TrimSuffix(mirrorPath, sourcePath), "/")
+	}
+	if prefix == "" {
+		return endpoint{url: "https://" + mirrorHost}, nil
+	}
+	return endpoint{url: "https://" + mirrorHost + "/v2/" + prefix, overridePath: true}, nil
+}
+
+// registryServer returns the URL of the given registry host
+func registryServer(host string) string {
+	if host == dockerHub {
+		return dockerHubServer
+	}
+	return "https://" + host
+}
+
+// ContainerdHosts returns the content of the containerd hosts.toml file of each mirrored registry, by registry host,
+// along with the mirrors that cannot be configured. The mirrors are tried in order before the registry itself.
+// containerd cannot restrict the mirrors to pulls by digest, so pulls by tag of the mirrored registries go to the
+// mirrors as well.
+func ContainerdHosts(mirrors []Mirror) (map[string][]byte, []error) {
+	var hosts []string
+	endpoints := make(map[string][]endpoint)
+	var errs []error
+	for _, mirror := range mirrors {
+		host, _ := splitRepository(mirror.Source)
+		for _, repository := range mirror.Mirrors {
+			e, err := mirrorEndpoint(mirror.Source, repository)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if _, ok := endpoints[host]; !ok {
+				hosts = append(hosts, host)
+			}
+			if !containsEndpoint(endpoints[host], e) {
+				endpoints[host] = append(endpoints[host], e)
+			}
+		}
+	}
+
+	files := make(map[string][]byte)
+	for _, host := range hosts {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "server = %q\n", registryServer(host))
+		for _, e := range endpoints[host] {
+			fmt.Fprintf(&content, "\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", e.url)
+			if e.overridePath {
+				content.WriteString("  override_path = true\n")
+			}
+		}
+		files[host] = content.Bytes()
+	}
+	return files, errs
+}
+
+// containsEndpoint returns true if the given endpoints contain the given endpoint
+func containsEndpoint(endpoints []endpoint, e endpoint) bool {
+	for _, existing := range endpoints {
+		if existing == e {
+			return true
+		}
+	}
+	return false
+}
+
+// HostsDirName returns the name of the directory of the hosts.toml file of the given registry host. Windows does not
+// allow colons in file names, so the port of the host is separated by an underscore instead, as containerd expects on
+// Windows.
+func HostsDirName(host string) string {
+	if i := strings.LastIndex(host, ":"); i > 0 {
+		return host[:i] + "_" + host[i+1:]
+	}
+	return host
+}
+
+// WriteContainerdHosts writes the hosts.toml file of each mirrored registry under the given containerd registry
+// configuration directory, the config_path of the CRI registry configuration, and returns the paths of the files along
+// with the mirrors that cannot be configured
+func WriteContainerdHosts(configDir string, mirrors []Mirror) ([]string, []error, error) {
+	files, errs := ContainerdHosts(mirrors)
+	var hosts []string
+	for host := range files {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var paths []string
+	for _, host := range hosts {
+		dir := filepath.Join(configDir, HostsDirName(host))
+		if err := os.MkdirAll(dir, os.ModeDir); err != nil {
+			return paths, errs, fmt.Errorf("could not make %s directory: %v", dir, err)
+		}
+		path := filepath.Join(dir, HostsFileName)
+		if err := ioutil.WriteFile(path, files[host], 0644); err != nil {
+			return paths, errs, fmt.Errorf("could not write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, errs, nil
+}
+
+// DockerDaemonConfig returns the given Docker daemon configuration with the registry-mirrors of the Docker Hub mirrors,
+// along with the mirrors that cannot be configured. Docker only supports mirrors of Docker Hub, serving its images at
+// their root. The other keys of the configuration are kept.
+func DockerDaemonConfig(existing []byte, mirrors []Mirror) ([]byte, []error, error) {
+	config := make(map[string]interface{})
+	if len(bytes.TrimSpace(existing)) != 0 {
+		if err := json.Unmarshal(existing, &config); err != nil {
+			return nil, nil, fmt.Errorf("error parsing the Docker daemon configuration: %v", err)
+		}
+	}
+
+	var registryMirrors []string
+	if current, ok := config[registryMirrorsKey].([]interface{}); ok {
+		for _, mirror := range current {
+			if url, ok := mirror.(string); ok {
+				registryMirrors = append(registryMirrors, url)
+			}
+		}
+	}
+	var errs []error
+	for _, mirror := range mirrors {
+		host, _ := splitRepository(mirror.Source)
+		for _, repository := range mirror.Mirrors {
+			e, err := mirrorEndpoint(mirror.Source, repository)
+			switch {
+			case err != nil:
+				errs = append(errs, err)
+			case host != dockerHub:
+				errs = append(errs, fmt.Errorf("mirror %s of %s cannot be configured with Docker, which only "+
+					"supports mirrors of %s", repository, mirror.Source, dockerHub))
+			case e.overridePath:
+				errs = append(errs, fmt.Errorf("mirror %s of %s cannot be configured with Docker, which only "+
+					"supports mirrors serving the images at their root", repository, mirror.Source))
+			case !contains(registryMirrors, e.url):
+				registryMirrors = append(registryMirrors, e.url)
+			}
+		}
+	}
+	if len(registryMirrors) > 0 {
+		config[registryMirrorsKey] = registryMirrors
+	}
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, errs, fmt.Errorf("error marshalling the Docker daemon configuration: %v", err)
+	}
+	return append(out, '\n'), errs, nil
+}
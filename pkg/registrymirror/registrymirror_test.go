@@ -0,0 +1,190 @@
+package registrymirror
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicies are the ImageContentSourcePolicies of a disconnected cluster, as returned by
+// oc get imagecontentsourcepolicy -o json
+const testPolicies = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "apiVersion": "operator.openshift.io/v1alpha1",
+      "kind": "ImageContentSourcePolicy",
+      "metadata": {"name": "release"},
+      "spec": {
+        "repositoryDigestMirrors": [
+          {
+            "source": "quay.io/openshift-release-dev/ocp-v4.0-art-dev",
+            "mirrors": ["mirror.example.com:5000/ocp4/openshift-release-dev/ocp-v4.0-art-dev"]
+          },
+          {
+            "source": "quay.io/openshift-release-dev/ocp-release",
+            "mirrors": ["mirror.example.com:5000/ocp4/openshift4"]
+          }
+        ]
+      }
+    },
+    {
+      "apiVersion": "operator.openshift.io/v1alpha1",
+      "kind": "ImageContentSourcePolicy",
+      "metadata": {"name": "workloads"},
+      "spec": {
+        "repositoryDigestMirrors": [
+          {"source": "docker.io", "mirrors": ["hub.example.com"]},
+          {
+            "source": "quay.io/openshift-release-dev/ocp-v4.0-art-dev",
+            "mirrors": [
+              "mirror.example.com:5000/ocp4/openshift-release-dev/ocp-v4.0-art-dev/",
+              "backup.example.com/openshift-release-dev/ocp-v4.0-art-dev"
+            ]
+          }
+        ]
+      }
+    }
+  ]
+}`
+
+// TestParseImageContentSourcePolicies tests that the mirrors of every policy are merged by source
+func TestParseImageContentSourcePolicies(t *testing.T) {
+	mirrors, err := ParseImageContentSourcePolicies([]byte(testPolicies))
+	require.NoError(t, err)
+	assert.Equal(t, []Mirror{
+		{Source: "docker.io", Mirrors: []string{"hub.example.com"}},
+		{Source: "quay.io/openshift-release-dev/ocp-release", Mirrors: []string{"mirror.example.com:5000/ocp4/openshift4"}},
+		{Source: "quay.io/openshift-release-dev/ocp-v4.0-art-dev", Mirrors: []string{
+			"mirror.example.com:5000/ocp4/openshift-release-dev/ocp-v4.0-art-dev",
+			"backup.example.com/openshift-release-dev/ocp-v4.0-art-dev",
+		}},
+	}, mirrors)
+
+	// A single policy is parsed as well
+	mirrors, err = ParseImageContentSourcePolicies([]byte(`{"kind": "ImageContentSourcePolicy", "spec": ` +
+		`{"repositoryDigestMirrors": [{"source": "docker.io", "mirrors": ["hub.example.com"]}]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Mirror{{Source: "docker.io", Mirrors: []string{"hub.example.com"}}}, mirrors)
+
+	// A cluster without policies has no mirrors
+	mirrors, err = ParseImageContentSourcePolicies([]byte(`{"kind": "List", "items": []}`))
+	require.NoError(t, err)
+	assert.Empty(t, mirrors)
+
+	_, err = ParseImageContentSourcePolicies([]byte(`{"kind": "ImageContentSourcePolicy", "spec": ` +
+		`{"repositoryDigestMirrors": [{"source": "", "mirrors": ["hub.example.com"]}]}}`))
+	assert.Error(t, err)
+	_, err = ParseImageContentSourcePolicies([]byte(`[`))
+	assert.Error(t, err)
+}
+
+// TestMirrorEndpoint tests that the mirrors are mapped to registry endpoints when they keep the path of the source
+func TestMirrorEndpoint(t *testing.T) {
+	tests := []struct {
+		source   string
+		mirror   string
+		expected endpoint
+		err      bool
+	}{
+		{source: "docker.io", mirror: "hub.example.com", expected: endpoint{url: "https://hub.example.com"}},
+		{source: "docker.io", mirror: "mirror.example.com/hub",
+			expected: endpoint{url: "https://mirror.example.com/v2/hub", overridePath: true}},
+		{source: "quay.io/org/repo", mirror: "mirror.example.com/org/repo",
+			expected: endpoint{url: "https://mirror.example.com"}},
+		{source: "quay.io/org/repo", mirror: "mirror.example.com:5000/ocp4/org/repo",
+			expected: endpoint{url: "https://mirror.example.com:5000/v2/ocp4", overridePath: true}},
+		{source: "quay.io/org/repo", mirror: "mirror.example.com/ocp4/openshift4", err: true},
+		{source: "quay.io/org/repo", mirror: "mirror.example.com/ocp4/other-org/repo", err: true},
+		{source: "quay.io/org/repo", mirror: "mirror.example.com/ocp4/xorg/repo", err: true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s=%s", test.source, test.mirror), func(t *testing.T) {
+			e, err := mirrorEndpoint(test.source, test.mirror)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, e)
+		})
+	}
+}
+
+// TestContainerdHosts tests that a hosts.toml file is generated per mirrored registry, and that the mirrors that do
+// not keep the path of their source are reported
+func TestContainerdHosts(t *testing.T) {
+	mirrors, err := ParseImageContentSourcePolicies([]byte(testPolicies))
+	require.NoError(t, err)
+	files, errs := ContainerdHosts(mirrors)
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "mirror.example.com:5000/ocp4/openshift4")
+	require.Len(t, files, 2)
+	assert.Equal(t, `server = "https://registry-1.docker.io"
+
+[host."https://hub.example.com"]
+  capabilities = ["pull", "resolve"]
+`, string(files["docker.io"]))
+	assert.Equal(t, `server = "https://quay.io"
+
+[host."https://mirror.example.com:5000/v2/ocp4"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+
+[host."https://backup.example.com"]
+  capabilities = ["pull", "resolve"]
+`, string(files["quay.io"]))
+}
+
+// TestWriteContainerdHosts tests that the hosts.toml files are written in the directory of their registry, with the
+// port separated by an underscore
+func TestWriteContainerdHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs.d")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	paths, errs, err := WriteContainerdHosts(dir, []Mirror{
+		{Source: "registry.example.com:5000", Mirrors: []string{"mirror.example.com"}},
+		{Source: "docker.io", Mirrors: []string{"hub.example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "docker.io", HostsFileName),
+		filepath.Join(dir, "registry.example.com_5000", HostsFileName),
+	}, paths)
+	content, err := ioutil.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `server = "https://registry.example.com:5000"`)
+}
+
+// TestDockerDaemonConfig tests that the Docker Hub mirrors are added to the registry-mirrors of the daemon
+// configuration, keeping its other settings, and that the other mirrors are reported
+func TestDockerDaemonConfig(t *testing.T) {
+	mirrors := []Mirror{
+		{Source: "docker.io", Mirrors: []string{"hub.example.com", "mirror.example.com/hub", "cache.example.com"}},
+		{Source: "quay.io/org/repo", Mirrors: []string{"mirror.example.com/org/repo"}},
+	}
+	config, errs, err := DockerDaemonConfig([]byte(`{"registry-mirrors": ["https://cache.example.com"], `+
+		`"log-level": "debug"}`), mirrors)
+	require.NoError(t, err)
+	assert.Len(t, errs, 2)
+	assert.JSONEq(t, `{"registry-mirrors": ["https://cache.example.com", "https://hub.example.com"], `+
+		`"log-level": "debug"}`, string(config))
+
+	config, errs, err = DockerDaemonConfig(nil, mirrors[:1])
+	require.NoError(t, err)
+	assert.Len(t, errs, 1)
+	assert.JSONEq(t, `{"registry-mirrors": ["https://hub.example.com", "https://cache.example.com"]}`,
+		string(config))
+
+	_, _, err = DockerDaemonConfig([]byte(`{`), mirrors)
+	assert.Error(t, err)
+}
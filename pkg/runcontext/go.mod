@@ -0,0 +1,8 @@
+module github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext
+
+go 1.12
+
+require (
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+)
@@ -0,0 +1,114 @@
+package runcontext
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+/*
+	runcontext carries the context of a test run: the run ID, the cluster ID, the Windows build and the cloud provider
+	of the nodes. The e2e framework sets it in the E2E_RUN_CONTEXT environment variable, and WMCB and WNI attach it to
+	every log line and span, so that the data of large test matrices can be related to the run, the cluster and the
+	image they come from. It is a module of its own, shared by WMCB, WNI and the e2e test framework.
+*/
+
+// EnvVar is the environment variable holding the run context, as run=<ID>,cluster=<ID>,build=<build>,provider=<name>
+const EnvVar = "E2E_RUN_CONTEXT"
+
+const (
+	// runKey is the key of the run ID
+	runKey = "run"
+	// clusterKey is the key of the cluster ID
+	clusterKey = "cluster"
+	// buildKey is the key of the Windows build
+	buildKey = "build"
+	// providerKey is the key of the cloud provider
+	providerKey = "provider"
+)
+
+// Context is the context of the test run, whose fields are empty when unknown
+type Context struct {
+	// RunID is the ID of the test run
+	RunID string `json:"runId,omitempty"`
+	// ClusterID is the ID of the OpenShift cluster
+	ClusterID string `json:"clusterId,omitempty"`
+	// WindowsBuild is the Windows build of the nodes, e.g. 2019 or 10.0.17763
+	WindowsBuild string `json:"windowsBuild,omitempty"`
+	// Provider is the cloud provider of the nodes, e.g. aws
+	Provider string `json:"provider,omitempty"`
+}
+
+// Parse parses a run context given as comma separated <key>=<value> pairs, the keys being run, cluster, build and
+// provider. An empty value is an empty context.
+func Parse(value string) (Context, error) {
+	var c Context
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return Context{}, fmt.Errorf("invalid run context %q, expected <key>=<value> pairs", value)
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case runKey:
+			c.RunID = strings.TrimSpace(kv[1])
+		case clusterKey:
+			c.ClusterID = strings.TrimSpace(kv[1])
+		case buildKey:
+			c.WindowsBuild = strings.TrimSpace(kv[1])
+		case providerKey:
+			c.Provider = strings.TrimSpace(kv[1])
+		default:
+			return Context{}, fmt.Errorf("invalid run context %q, unknown key %s, expected %s, %s, %s or %s", value,
+				kv[0], runKey, clusterKey, buildKey, providerKey)
+		}
+	}
+	return c, nil
+}
+
+// Empty returns true if none of the fields of the context is known
+func (c Context) Empty() bool {
+	return c == Context{}
+}
+
+// String returns the context in the form Parse parses, without the unknown fields
+func (c Context) String() string {
+	var pairs []string
+	for _, field := range c.Fields() {
+		pairs = append(pairs, field[0]+"="+field[1])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// KeyValues returns the known fields of the context as the key value pairs of a logr logger
+func (c Context) KeyValues() []interface{} {
+	var keyValues []interface{}
+	for _, field := range c.Fields() {
+		keyValues = append(keyValues, field[0], field[1])
+	}
+	return keyValues
+}
+
+// Attributes returns the known fields of the context as span attributes
+func (c Context) Attributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, field := range c.Fields() {
+		attrs = append(attrs, attribute.String("e2e."+field[0], field[1]))
+	}
+	return attrs
+}
+
+// Fields returns the keys and values of the known fields of the context, in the order String renders them
+func (c Context) Fields() [][2]string {
+	var fields [][2]string
+	for _, field := range [][2]string{{runKey, c.RunID}, {clusterKey, c.ClusterID}, {buildKey, c.WindowsBuild},
+		{providerKey, c.Provider}} {
+		if field[1] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
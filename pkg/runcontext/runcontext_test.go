@@ -0,0 +1,38 @@
+package runcontext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TestParse tests the parsing of the run context and its rendering as a string, fields, log key values and span
+// attributes
+func TestParse(t *testing.T) {
+	c, err := Parse("run=1234, cluster=5e1c0bd2-cb63-4a0b-9e28-0ae2d3b4ef3b,build=10.0.17763,provider=aws")
+	require.NoError(t, err)
+	assert.Equal(t, Context{RunID: "1234", ClusterID: "5e1c0bd2-cb63-4a0b-9e28-0ae2d3b4ef3b",
+		WindowsBuild: "10.0.17763", Provider: "aws"}, c)
+	assert.Equal(t, "run=1234,cluster=5e1c0bd2-cb63-4a0b-9e28-0ae2d3b4ef3b,build=10.0.17763,provider=aws", c.String())
+
+	c, err = Parse("run=1234,provider=aws")
+	require.NoError(t, err)
+	assert.Equal(t, "run=1234,provider=aws", c.String())
+	assert.Equal(t, [][2]string{{"run", "1234"}, {"provider", "aws"}}, c.Fields())
+	assert.Equal(t, []interface{}{"run", "1234", "provider", "aws"}, c.KeyValues())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("e2e.run", "1234"), attribute.String("e2e.provider", "aws")},
+		c.Attributes())
+
+	c, err = Parse("")
+	require.NoError(t, err)
+	assert.True(t, c.Empty())
+	assert.Equal(t, "", c.String())
+	assert.Nil(t, c.KeyValues())
+
+	for _, invalid := range []string{"1234", "run=1234,zone=us-east-1a"} {
+		_, err = Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+	tracing instruments WMCB, WNI and the e2e test framework with OpenTelemetry spans, so that the creation of the VMs,
+	the bootstrap phases and the tests can be visualized in the waterfall of the CI job that ran them. The spans are
+	exported to an OTLP/HTTP endpoint, appended as JSON to a trace file, or both. Without either, the global no-op
+	tracer provider is kept and instrumentation costs nothing. When the TRACEPARENT environment variable is set, e.g. by
+	the test framework, the root span is a child of the span it identifies. It is a module of its own, so that WNI and
+	the test framework use it without depending on WMCB.
+*/
+
+const (
+	// tracerName is the name of the tracer used for the spans
+	tracerName = "github.com/openshift/windows-machine-config-bootstrapper"
+	// EndpointEnvVar is the standard OpenTelemetry environment variable holding the OTLP endpoint
+	EndpointEnvVar = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// TraceParentEnvVar is the environment variable holding the W3C traceparent of the parent of the root span
+	TraceParentEnvVar = "TRACEPARENT"
+	// FileName is the name of the trace file WMCB writes in the log directory by default
+	FileName = "wmcb-trace.json"
+	// maxCommandLength is the length above which commands recorded as span attributes are truncated
+	maxCommandLength = 256
+)
+
+// rootCtx is the context holding the root span of the command or test suite being run, used as the parent of the
+// spans started by code that has no context of its own
+var rootCtx = context.Background()
+
+// Setup configures the global tracer provider to export the spans of the given service to the OTLP/HTTP endpoint, e.g.
+// http://localhost:4318, and to the trace file. Either can be empty. Spans are appended to the trace file, so that it
+// holds the spans of every command run, e.g. on the node. The given attributes, e.g. the run context, are attached to every
+// span. The returned function flushes the spans and closes the trace file, and has to be called before exiting.
+func Setup(service, endpoint, traceFile string, attrs ...attribute.KeyValue) (func() error, error) {
+	if endpoint == "" && traceFile == "" {
+		return func() error { return nil }, nil
+	}
+
+	var options []sdktrace.TracerProviderOption
+	var file *os.File
+	if traceFile != "" {
+		if err := os.MkdirAll(filepath.Dir(traceFile), os.ModeDir); err != nil {
+			return nil, fmt.Errorf("could not make %s directory: %v", filepath.Dir(traceFile), err)
+		}
+		var err error
+		if file, err = os.OpenFile(traceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return nil, fmt.Errorf("could not open trace file %s: %v", traceFile, err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not create trace file exporter: %v", err)
+		}
+		// The spans are written synchronously so that they are in the file even if the process is killed
+		options = append(options, sdktrace.WithSyncer(exporter))
+	}
+	if endpoint != "" {
+		exporter, err := newOTLPExporter(endpoint)
+		if err != nil {
+			if file != nil {
+				file.Close()
+			}
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	options = append(options, sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+		append([]attribute.KeyValue{semconv.ServiceNameKey.String(service)}, attrs...)...)))
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func() error {
+		err := provider.Shutdown(context.Background())
+		if file != nil {
+			file.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("could not flush spans: %v", err)
+		}
+		return nil
+	}, nil
+}
+
+// newOTLPExporter returns an exporter sending the spans to the given OTLP/HTTP endpoint URL
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s, expected a URL like http://localhost:4318", endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		options = append(options, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid OTLP endpoint scheme %s, expected http or https", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create OTLP exporter for %s: %v", endpoint, err)
+	}
+	return exporter, nil
+}
+
+// StartRoot starts the root span of the command or test suite being run, as a child of the span identified by the
+// TRACEPARENT environment variable if it is set. The spans started without a parent context are its children.
+func StartRoot(name string, attrs ...attribute.KeyValue) trace.Span {
+	parent := context.Background()
+	if traceParent := os.Getenv(TraceParentEnvVar); traceParent != "" {
+		carrier := propagation.HeaderCarrier{}
+		carrier.Set("traceparent", traceParent)
+		parent = propagation.TraceContext{}.Extract(parent, carrier)
+	}
+	var span trace.Span
+	rootCtx, span = Start(parent, name, attrs...)
+	return span
+}
+
+// Context returns the context holding the root span, to be used as parent by code that has no context of its own
+func Context() context.Context {
+	return rootCtx
+}
+
+// Start starts a span with the given name as a child of the span in the given context
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed with the given error if it is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Phase runs fn within a span with the given name, child of the root span, and returns its error
+func Phase(name string, fn func() error) error {
+	_, span := Start(rootCtx, name)
+	err := fn()
+	End(span, err)
+	return err
+}
+
+// Command returns the attribute recording the given remote command, truncated so that large scripts do not bloat
+// the spans
+func Command(cmd string) attribute.KeyValue {
+	if len(cmd) > maxCommandLength {
+		cmd = cmd[:maxCommandLength] + "..."
+	}
+	return attribute.String("command", cmd)
+}
+
+// TraceParent returns the W3C traceparent of the span in the given context, which can be passed to a child process
+// through the TRACEPARENT environment variable so that its spans are children of that span. It is empty if the
+// context holds no span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.HeaderCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exportedSpan holds the fields of the spans written to the trace file that are checked by the tests
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		TraceID string
+		SpanID  string
+	}
+	Status struct {
+		Code string
+	}
+	Resource []struct {
+		Key   string
+		Value struct {
+			Value string
+		}
+	}
+}
+
+// resourceAttribute returns the value of the resource attribute of the span with the given key
+func (s exportedSpan) resourceAttribute(key string) string {
+	for _, attr := range s.Resource {
+		if attr.Key == key {
+			return attr.Value.Value
+		}
+	}
+	return ""
+}
+
+// readSpans returns the spans written to the trace file, indexed by name
+func readSpans(t *testing.T, traceFile string) map[string]exportedSpan {
+	contents, err := ioutil.ReadFile(traceFile)
+	require.NoError(t, err)
+	spans := make(map[string]exportedSpan)
+	decoder := json.NewDecoder(strings.NewReader(string(contents)))
+	for decoder.More() {
+		var s exportedSpan
+		require.NoError(t, decoder.Decode(&s))
+		spans[s.Name] = s
+	}
+	return spans
+}
+
+// TestSetupWithTraceFile tests that the spans of successive commands are appended to the trace file, with their parent
+// relationships, errors and resource attributes
+func TestSetupWithTraceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer func() { rootCtx = context.Background() }()
+	traceFile := filepath.Join(dir, "log", FileName)
+
+	shutdown, err := Setup("wmcb", "", traceFile)
+	require.NoError(t, err)
+	root := StartRoot("wmcb initialize-kubelet")
+	require.NoError(t, Phase("create kubelet service", func() error { return nil }))
+	End(root, nil)
+	require.NoError(t, shutdown())
+
+	// The second command is run with a traceparent, as done by the test framework
+	traceParent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	require.NoError(t, os.Setenv(TraceParentEnvVar, traceParent))
+	defer os.Unsetenv(TraceParentEnvVar)
+	shutdown, err = Setup("wmcb", "", traceFile, attribute.String("e2e.run", "1234"))
+	require.NoError(t, err)
+	root = StartRoot("wmcb configure-cni")
+	require.Error(t, Phase("configure CNI", func() error { return fmt.Errorf("kubelet service is not present") }))
+	End(root, nil)
+	require.NoError(t, shutdown())
+
+	spans := readSpans(t, traceFile)
+	require.Len(t, spans, 4)
+	assert.Equal(t, spans["wmcb initialize-kubelet"].SpanContext.SpanID,
+		spans["create kubelet service"].Parent.SpanID)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans["wmcb configure-cni"].SpanContext.TraceID)
+	assert.Equal(t, "b7ad6b7169203331", spans["wmcb configure-cni"].Parent.SpanID)
+	assert.Equal(t, spans["wmcb configure-cni"].SpanContext.SpanID, spans["configure CNI"].Parent.SpanID)
+	assert.Equal(t, "Error", spans["configure CNI"].Status.Code)
+	assert.NotEqual(t, "Error", spans["create kubelet service"].Status.Code)
+	assert.Equal(t, "wmcb", spans["configure CNI"].resourceAttribute("service.name"))
+	assert.Equal(t, "1234", spans["configure CNI"].resourceAttribute("e2e.run"))
+	assert.Equal(t, "", spans["create kubelet service"].resourceAttribute("e2e.run"))
+}
+
+// TestSetup tests that tracing is disabled without exporter and that invalid endpoints are refused
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup("wmcb", "", "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown())
+
+	for _, endpoint := range []string{"localhost:4318", "ftp://localhost:4318", "http://"} {
+		_, err = Setup("wmcb", endpoint, "")
+		assert.Error(t, err, "no error with endpoint %s", endpoint)
+	}
+}
+
+// TestStart tests that the spans started from the root context, and their children, are in the trace of the root span
+func TestStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer func() { rootCtx = context.Background() }()
+	traceFile := filepath.Join(dir, "trace.json")
+
+	shutdown, err := Setup("wni", "", traceFile)
+	require.NoError(t, err)
+	assert.Empty(t, TraceParent(Context()), "traceparent without root span")
+	root := StartRoot("wni aws create")
+	ctx, span := Start(Context(), "CreateWindowsVM")
+	traceParent := TraceParent(ctx)
+	End(span, nil)
+	End(root, nil)
+	require.NoError(t, shutdown())
+
+	spans := readSpans(t, traceFile)
+	require.Len(t, spans, 2)
+	created := spans["CreateWindowsVM"]
+	assert.Equal(t, spans["wni aws create"].SpanContext.SpanID, created.Parent.SpanID)
+	assert.Equal(t, spans["wni aws create"].SpanContext.TraceID, created.SpanContext.TraceID)
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", created.SpanContext.TraceID, created.SpanContext.SpanID), traceParent)
+}
+
+// TestCommand tests that long commands are truncated
+func TestCommand(t *testing.T) {
+	assert.Equal(t, "hostname", Command("hostname").Value.AsString())
+	long := Command(strings.Repeat("a", 300)).Value.AsString()
+	assert.Len(t, long, maxCommandLength+len("..."))
+}
@@ -0,0 +1,170 @@
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+	trustbundle installs the additional trust bundle of the cluster, like the CA of a proxy or of a custom registry, on
+	a Windows node, so that its image pulls and its communication with the API server succeed in custom CA
+	environments. The certificates of the bundle are added to the Windows certificate store of the machine, which
+	Docker and containerd verify the registries against, and to the registry CA configuration of the container runtime
+	for the registries given.
+*/
+
+const (
+	// ConfigMapKey is the key of the trust bundle in the ConfigMap of the additional trust bundle of the cluster, e.g.
+	// user-ca-bundle in openshift-config
+	ConfigMapKey = "ca-bundle.crt"
+	// CAFileName is the name of the CA file of a registry in the registry configuration directory of the runtime
+	CAFileName = "ca.crt"
+	// RootStore is the Windows certificate store of the trusted root certificates
+	RootStore = "Root"
+	// IntermediateStore is the Windows certificate store of the intermediate certificates
+	IntermediateStore = "CA"
+	// certificatesKey is the registry key of the certificate stores of the machine, relative to HKEY_LOCAL_MACHINE
+	certificatesKey = `SOFTWARE\Microsoft\SystemCertificates`
+	// certificateBlock is the type of the PEM blocks of the certificates
+	certificateBlock = "CERTIFICATE"
+)
+
+var (
+	// hostTableRegex matches the header of the table of a host of a containerd hosts.toml file
+	hostTableRegex = regexp.MustCompile(`^\s*\[host\..*\]\s*$`)
+	// caKeyRegex matches the ca key of a table of a containerd hosts.toml file
+	caKeyRegex = regexp.MustCompile(`^\s*ca\s*=`)
+)
+
+// configMap is the subset of a ConfigMap holding the trust bundle, as returned by
+// oc get configmap user-ca-bundle -n openshift-config -o json
+type configMap struct {
+	Kind string            `json:"kind"`
+	Data map[string]string `json:"data"`
+}
+
+// Parse returns the certificates of the given trust bundle, a PEM file or a ConfigMap holding it in JSON
+func Parse(data []byte) ([]*x509.Certificate, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var cm configMap
+		if err := json.Unmarshal(trimmed, &cm); err != nil {
+			return nil, fmt.Errorf("error parsing ConfigMap: %v", err)
+		}
+		bundle, ok := cm.Data[ConfigMapKey]
+		if cm.Kind != "ConfigMap" || !ok {
+			return nil, fmt.Errorf("expected a ConfigMap with a %s key", ConfigMapKey)
+		}
+		data = []byte(bundle)
+	}
+	var certs []*x509.Certificate
+	seen := make(map[string]bool)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != certificateBlock {
+			return nil, fmt.Errorf("unexpected %s block in trust bundle", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate %d of the trust bundle: %v", len(certs)+1, err)
+		}
+		// Bundles merged from several sources often repeat certificates
+		if thumbprint := Thumbprint(cert); !seen[thumbprint] {
+			seen[thumbprint] = true
+			certs = append(certs, cert)
+		}
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		return nil, fmt.Errorf("trust bundle has trailing data which is not PEM encoded")
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("trust bundle has no certificates")
+	}
+	return certs, nil
+}
+
+// Thumbprint returns the thumbprint the given certificate is identified with in the Windows certificate stores, the
+// upper case hexadecimal SHA-1 hash of its DER encoding
+func Thumbprint(cert *x509.Certificate) string {
+	return fmt.Sprintf("%X", sha1.Sum(cert.Raw))
+}
+
+// Store returns the Windows certificate store the given certificate is installed in: the trusted root store for the
+// self-signed certificates and the intermediate store for the others, which chain up to a root
+func Store(cert *x509.Certificate) string {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+		return RootStore
+	}
+	return IntermediateStore
+}
+
+// RegistryKey returns the registry key of the given certificate in its store of the machine, relative to
+// HKEY_LOCAL_MACHINE. Deleting the key removes the certificate from the store.
+func RegistryKey(cert *x509.Certificate) string {
+	return certificatesKey + `\` + strings.ToUpper(Store(cert)) + `\Certificates\` + Thumbprint(cert)
+}
+
+// Describe returns the subject, store and thumbprint of the given certificate
+func Describe(cert *x509.Certificate) string {
+	return fmt.Sprintf("%s in %s store, thumbprint %s", cert.Subject, Store(cert), Thumbprint(cert))
+}
+
+// EncodePEM returns the given certificates PEM encoded
+func EncodePEM(certs []*x509.Certificate) []byte {
+	var out bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&out, &pem.Block{Type: certificateBlock, Bytes: cert.Raw})
+	}
+	return out.Bytes()
+}
+
+// ContainerdHostsWithCA returns the given containerd hosts.toml file with the given CA file set as the ca of the
+// registry server and of each of its mirrors that has none. containerd ignores the CA files of a registry directory
+// with a hosts.toml file, so the file has to reference them.
+func ContainerdHostsWithCA(hosts []byte, caPath string) []byte {
+	caLine := fmt.Sprintf("ca = %q", caPath)
+	// The first table holds the keys of the registry server, the others the ones of its mirrors
+	tables := [][]string{nil}
+	for _, line := range strings.Split(strings.TrimRight(string(hosts), "\n"), "\n") {
+		if hostTableRegex.MatchString(line) {
+			tables = append(tables, nil)
+		}
+		tables[len(tables)-1] = append(tables[len(tables)-1], line)
+	}
+	var out []string
+	for i, table := range tables {
+		if !hasCA(table) {
+			indent := ""
+			if i > 0 {
+				indent = "  "
+			}
+			// The CA is added after the last key of the table, before the blank lines separating it from the next one
+			end := len(table)
+			for end > 0 && strings.TrimSpace(table[end-1]) == "" {
+				end--
+			}
+			table = append(table[:end:end], append([]string{indent + caLine}, table[end:]...)...)
+		}
+		out = append(out, table...)
+	}
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+// hasCA returns true if the given lines of a table of a hosts.toml file set its ca
+func hasCA(table []string) bool {
+	for _, line := range table {
+		if caKeyRegex.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package trustbundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCert returns a CA certificate with the given common name, and its key. It is self-signed if parent is nil.
+func newCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate,
+	*ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// TestParse tests that the certificates of PEM bundles and of ConfigMaps are parsed once each
+func TestParse(t *testing.T) {
+	root, rootKey := newCert(t, "proxy root", nil, nil)
+	intermediate, _ := newCert(t, "proxy intermediate", root, rootKey)
+	bundle := EncodePEM([]*x509.Certificate{root, intermediate, root})
+
+	certs, err := Parse(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{root, intermediate}, certs)
+
+	cm, err := json.Marshal(map[string]interface{}{"kind": "ConfigMap",
+		"data": map[string]string{ConfigMapKey: string(bundle)}})
+	require.NoError(t, err)
+	certs, err = Parse(cm)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{root, intermediate}, certs)
+
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")})
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"private key":    append(EncodePEM([]*x509.Certificate{root}), key...),
+		"trailing data":  append(EncodePEM([]*x509.Certificate{root}), []byte("garbage")...),
+		"invalid cert":   pem.EncodeToMemory(&pem.Block{Type: certificateBlock, Bytes: []byte("cert")}),
+		"other key":      []byte(`{"kind": "ConfigMap", "data": {"service-ca.crt": ""}}`),
+		"not ConfigMap":  []byte(`{"kind": "Secret", "data": {"ca-bundle.crt": ""}}`),
+		"invalid JSON":   []byte(`{"kind": `),
+		"no certificate": []byte(`{"kind": "ConfigMap", "data": {"ca-bundle.crt": ""}}`),
+	} {
+		_, err := Parse(data)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestStore tests that the self-signed certificates are trusted as roots and the others as intermediates
+func TestStore(t *testing.T) {
+	root, rootKey := newCert(t, "proxy root", nil, nil)
+	intermediate, _ := newCert(t, "proxy intermediate", root, rootKey)
+	assert.Equal(t, RootStore, Store(root))
+	assert.Equal(t, IntermediateStore, Store(intermediate))
+
+	thumbprint := Thumbprint(root)
+	assert.Regexp(t, "^[0-9A-F]{40}$", thumbprint)
+	assert.Equal(t, `SOFTWARE\Microsoft\SystemCertificates\ROOT\Certificates\`+thumbprint, RegistryKey(root))
+	assert.True(t, strings.HasPrefix(RegistryKey(intermediate), `SOFTWARE\Microsoft\SystemCertificates\CA\`))
+}
+
+// TestContainerdHostsWithCA tests that the CA is added to the server and to each mirror without one
+func TestContainerdHostsWithCA(t *testing.T) {
+	hosts := `server = "https://registry.example.com"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+
+[host."https://other.example.com/v2/ocp4"]
+  capabilities = ["pull", "resolve"]
+  ca = "C:\\other.crt"
+  override_path = true
+`
+	expected := `server = "https://registry.example.com"
+ca = "C:\\certs.d\\ca.crt"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "C:\\certs.d\\ca.crt"
+
+[host."https://other.example.com/v2/ocp4"]
+  capabilities = ["pull", "resolve"]
+  ca = "C:\\other.crt"
+  override_path = true
+`
+	updated := ContainerdHostsWithCA([]byte(hosts), `C:\certs.d\ca.crt`)
+	assert.Equal(t, expected, string(updated))
+	// Adding the CA again leaves the file unchanged
+	assert.Equal(t, expected, string(ContainerdHostsWithCA(updated, `C:\certs.d\ca.crt`)))
+}
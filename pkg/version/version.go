@@ -0,0 +1,175 @@
+package version
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+/*
+	version reports the build of WMCB and the versions of the payload it installed, so that the WMCB build of a node
+	can be told, and replaces the WMCB binary of the node with a verified one.
+*/
+
+var (
+	// Version is the version of WMCB, set at build time with -ldflags "-X <package>.Version=<version>"
+	Version = "unknown"
+	// Commit is the git commit WMCB was built from, set at build time
+	Commit = "unknown"
+	// BuildDate is the date WMCB was built, set at build time
+	BuildDate = "unknown"
+)
+
+const (
+	// oldSuffix is the suffix of the previous executable kept by Update for Rollback
+	oldSuffix = ".old"
+	// newSuffix is the suffix of the new executable while it is being put next to the executable
+	newSuffix = ".new"
+)
+
+// PayloadFile is the version of a file installed by WMCB
+type PayloadFile struct {
+	// Path is the location of the file on the node
+	Path string `json:"path"`
+	// SHA256 is the hex encoded SHA256 of the file when it was installed
+	SHA256 string `json:"sha256"`
+	// Version is the version reported by the binary, if it reports one
+	Version string `json:"version,omitempty"`
+}
+
+// Info describes the build of WMCB
+type Info struct {
+	// Version is the version of WMCB
+	Version string `json:"version"`
+	// Commit is the git commit WMCB was built from
+	Commit string `json:"commit"`
+	// BuildDate is the date WMCB was built
+	BuildDate string `json:"buildDate"`
+	// GoVersion is the version of Go WMCB was built with
+	GoVersion string `json:"goVersion"`
+	// Platform is the OS and architecture WMCB was built for
+	Platform string `json:"platform"`
+	// Payload are the files installed by WMCB on the node, if any
+	Payload []PayloadFile `json:"payload,omitempty"`
+}
+
+// Get returns the build info of the running WMCB
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// Update replaces the executable with the given new binary, provided its SHA256 is the expected one and it reports
+// its version with the version command, which is returned. Windows does not allow writing a running executable but
+// allows renaming it, so the executable is renamed to <executable>.old and the new binary is moved in its place: the
+// running processes, like the monitor service, keep running the previous version until they are restarted, and the
+// previous version is kept for Rollback.
+func Update(executable, newBinary, expectedSHA256 string) (*Info, error) {
+	sum, err := fileSHA256(newBinary)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(sum, expectedSHA256) {
+		return nil, fmt.Errorf("%s has SHA256 %s, expected %s", newBinary, sum, expectedSHA256)
+	}
+	out, err := exec.Command(newBinary, "version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s does not report its version: %v", newBinary, err)
+	}
+	var info Info
+	if err = json.Unmarshal(out, &info); err != nil || info.Version == "" {
+		return nil, fmt.Errorf("%s does not report its version: %s", newBinary, out)
+	}
+
+	// The new binary is copied next to the executable first, so that the swap is a rename on the same volume
+	staged := executable + newSuffix
+	if err = copyFile(newBinary, staged); err != nil {
+		return nil, fmt.Errorf("error copying %s --> %s: %v", newBinary, staged, err)
+	}
+	defer os.Remove(staged)
+	old := executable + oldSuffix
+	if err = os.Remove(old); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not remove the previous version %s, it may still be running: %v", old, err)
+	}
+	if err = os.Rename(executable, old); err != nil {
+		return nil, fmt.Errorf("could not move %s --> %s: %v", executable, old, err)
+	}
+	if err = os.Rename(staged, executable); err != nil {
+		if restoreErr := os.Rename(old, executable); restoreErr != nil {
+			return nil, fmt.Errorf("could not move %s --> %s: %v, and could not restore %s: %v", staged, executable,
+				err, executable, restoreErr)
+		}
+		return nil, fmt.Errorf("could not move %s --> %s: %v", staged, executable, err)
+	}
+	return &info, nil
+}
+
+// Rollback restores the executable replaced by Update
+func Rollback(executable string) error {
+	old := executable + oldSuffix
+	if _, err := os.Stat(old); err != nil {
+		return fmt.Errorf("no previous version of %s: %v", executable, err)
+	}
+	// The updated executable may be running, so it is moved out of the way rather than removed
+	failed := executable + newSuffix
+	if err := os.Rename(executable, failed); err != nil {
+		return fmt.Errorf("could not move %s --> %s: %v", executable, failed, err)
+	}
+	if err := os.Rename(old, executable); err != nil {
+		return fmt.Errorf("could not move %s --> %s: %v", old, executable, err)
+	}
+	// Removing the updated executable is best effort, it is removed by the next update otherwise
+	os.Remove(failed)
+	return nil
+}
+
+// fileSHA256 returns the hex encoded SHA256 of the given file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyFile copies the source file to the destination, with the mode of the source
+func copyFile(source, dest string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,74 @@
+package version
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBinary writes an executable script printing the given output to the given path and returns its SHA256
+func writeBinary(t *testing.T, path, output string) string {
+	contents := []byte("#!/bin/sh\necho '" + output + "'\n")
+	require.NoError(t, ioutil.WriteFile(path, contents, 0755))
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestUpdate tests that the executable is only replaced by a verified binary reporting its version, and that the
+// update can be rolled back
+func TestUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test binaries are shell scripts")
+	}
+	dir, err := ioutil.TempDir("", "version")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	executable := filepath.Join(dir, "wmcb.exe")
+	writeBinary(t, executable, `{"version": "v4.5.0"}`)
+
+	newBinary := filepath.Join(dir, "download", "wmcb.exe")
+	require.NoError(t, os.MkdirAll(filepath.Dir(newBinary), 0755))
+	sum := writeBinary(t, newBinary, `{"version": "v4.6.0", "commit": "abc"}`)
+	brokenBinary := filepath.Join(dir, "download", "broken.exe")
+	brokenSum := writeBinary(t, brokenBinary, "not a wmcb")
+
+	_, err = Update(executable, newBinary, "0123")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected 0123")
+	_, err = Update(executable, brokenBinary, brokenSum)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not report its version")
+	assert.NoFileExists(t, executable+oldSuffix, "executable was replaced by an invalid binary")
+
+	info, err := Update(executable, newBinary, sum)
+	require.NoError(t, err)
+	assert.Equal(t, "v4.6.0", info.Version)
+	assert.Equal(t, "abc", info.Commit)
+	contents, err := ioutil.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "v4.6.0")
+	assert.FileExists(t, executable+oldSuffix)
+	assert.NoFileExists(t, executable+newSuffix)
+
+	require.NoError(t, Rollback(executable))
+	contents, err = ioutil.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "v4.5.0")
+	assert.NoFileExists(t, executable+oldSuffix)
+	assert.Error(t, Rollback(executable), "no previous version")
+}
+
+// TestGet tests that the build info defaults to unknown
+func TestGet(t *testing.T) {
+	info := Get()
+	assert.Equal(t, "unknown", info.Version)
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, info.Platform)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
@@ -0,0 +1,196 @@
+package windowsexporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/winservice"
+)
+
+/*
+	windowsexporter installs windows_exporter, the Windows counterpart of the Prometheus node_exporter, as a Windows
+	service of the node, so that the Windows nodes can be scraped like the Linux ones. Only a curated set of collectors
+	is enabled, as some of the others are expensive on a busy node, and the metrics port is opened in the Windows
+	Firewall.
+	https://github.com/prometheus-community/windows_exporter
+*/
+
+const (
+	// ServiceName is the name of the windows_exporter Windows service
+	ServiceName = "windows_exporter"
+	// BinaryName is the name of the windows_exporter executable in the install directory
+	BinaryName = "windows_exporter.exe"
+	// DefaultPort is the port windows_exporter serves its metrics on, as registered with Prometheus
+	DefaultPort = 9182
+	// FirewallRuleName is the name and display name of the Windows Firewall rule opening the metrics port
+	FirewallRuleName = "OpenShift windows_exporter"
+	// MetricsPath is the HTTP path of the metrics
+	MetricsPath = "/metrics"
+)
+
+// DefaultCollectors are the collectors enabled unless others are given, covering what node_exporter reports for the
+// Linux nodes along with the containers and the node services
+var DefaultCollectors = []string{"cpu", "cs", "container", "logical_disk", "memory", "net", "os", "service", "system",
+	"tcp"}
+
+// NodeServices are the services reported by the service collector, which would otherwise report every service of the
+// host
+var NodeServices = []string{"kubelet", "kube-proxy", "hybrid-overlay-node", "containerd", "docker"}
+
+// collectorName matches the names of the windows_exporter collectors
+var collectorName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// collectorSuccess matches the metric reporting whether a collector succeeded in the last scrape, e.g.
+// windows_exporter_collector_success{collector="cpu"} 1
+var collectorSuccess = regexp.MustCompile(`^windows_exporter_collector_success\{collector="([^"]+)"\} (\S+)$`)
+
+// ValidateCollectors returns an error if the given collector list is empty, has duplicates or invalid names
+func ValidateCollectors(collectors []string) error {
+	if len(collectors) == 0 {
+		return fmt.Errorf("no windows_exporter collector given")
+	}
+	seen := make(map[string]bool, len(collectors))
+	for _, collector := range collectors {
+		if !collectorName.MatchString(collector) {
+			return fmt.Errorf("invalid windows_exporter collector name %q", collector)
+		}
+		if seen[collector] {
+			return fmt.Errorf("windows_exporter collector %s given more than once", collector)
+		}
+		seen[collector] = true
+	}
+	return nil
+}
+
+// Args returns the arguments of the windows_exporter service serving the given collectors on the given port. The
+// service collector is limited to the node services.
+func Args(port int, collectors []string) []string {
+	args := []string{
+		"--collectors.enabled=" + strings.Join(collectors, ","),
+		"--telemetry.addr=:" + strconv.Itoa(port),
+		"--telemetry.path=" + MetricsPath,
+	}
+	for _, collector := range collectors {
+		if collector != "service" {
+			continue
+		}
+		var names []string
+		for _, name := range NodeServices {
+			names = append(names, "Name='"+name+"'")
+		}
+		args = append(args, "--collector.service.services-where="+strings.Join(names, " OR "))
+	}
+	return args
+}
+
+// CheckMetrics returns an error unless the given scrape reports each of the given collectors as successful
+func CheckMetrics(metrics io.Reader, collectors []string) error {
+	succeeded := make(map[string]bool)
+	scanner := bufio.NewScanner(metrics)
+	// The lines of the metrics with many labels exceed the default buffer of the scanner
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := collectorSuccess.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(match[2], 64)
+		succeeded[match[1]] = err == nil && value == 1
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading windows_exporter metrics: %v", err)
+	}
+	var failed []string
+	for _, collector := range collectors {
+		if !succeeded[collector] {
+			failed = append(failed, collector)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("windows_exporter collectors not reported as successful: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Install copies the given windows_exporter executable to the given directory and installs the windows_exporter
+// Windows service running it with the given port and collectors, replacing an existing one. It returns the path of
+// the installed executable and the arguments of the service.
+func Install(binaryPath, installDir string, port int, collectors []string) (string, []string, error) {
+	if err := ValidateCollectors(collectors); err != nil {
+		return "", nil, err
+	}
+	if port < 1 || port > 65535 {
+		return "", nil, fmt.Errorf("invalid windows_exporter port %d", port)
+	}
+	// The executable of a running service cannot be replaced, so the service is removed first
+	if err := RemoveService(); err != nil {
+		return "", nil, err
+	}
+	exePath := filepath.Join(installDir, BinaryName)
+	if err := copyFile(binaryPath, exePath); err != nil {
+		return "", nil, err
+	}
+	args := Args(port, collectors)
+	err := winservice.Install(ServiceName, "Prometheus exporter of the OpenShift Windows node metrics", exePath,
+		args...)
+	if err != nil {
+		return "", nil, err
+	}
+	return exePath, args, nil
+}
+
+// copyFile copies the given file to the given destination, replacing it if it exists
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not open windows_exporter executable: %v", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", dst, err)
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("could not copy windows_exporter executable to %s: %v", dst, err)
+	}
+	return out.Close()
+}
+
+// RemoveService removes the windows_exporter Windows service if it exists
+func RemoveService() error {
+	return winservice.Remove(ServiceName)
+}
+
+// firewallRuleScript returns the PowerShell script replacing the Windows Firewall rule of windows_exporter with one
+// allowing the given remote address to the given TCP port
+func firewallRuleScript(port int, remoteAddress string) string {
+	name := "'" + strings.ReplaceAll(FirewallRuleName, "'", "''") + "'"
+	return "Remove-NetFirewallRule -DisplayName " + name + " -ErrorAction SilentlyContinue; " +
+		"New-NetFirewallRule -Name " + name + " -DisplayName " + name + " -Direction Inbound -Action Allow -Protocol TCP " +
+		"-LocalPort " + strconv.Itoa(port) + " -RemoteAddress '" + strings.ReplaceAll(remoteAddress, "'", "''") +
+		"' -ErrorAction Stop | Out-Null"
+}
+
+// OpenFirewall opens the given metrics port to the given remote address, e.g. Any or the machine network CIDR, in the
+// Windows Firewall
+func OpenFirewall(port int, remoteAddress string) error {
+	if remoteAddress == "" {
+		remoteAddress = "Any"
+	}
+	out, err := exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		firewallRuleScript(port, remoteAddress)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not create the %s firewall rule: %v: %s", FirewallRuleName, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package windowsexporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateCollectors tests that empty, duplicate and malformed collector lists are rejected
+func TestValidateCollectors(t *testing.T) {
+	assert.NoError(t, ValidateCollectors(DefaultCollectors))
+	for _, collectors := range [][]string{nil, {"cpu", "cpu"}, {"cpu", ""}, {"cpu,memory"}, {"CPU"}} {
+		assert.Error(t, ValidateCollectors(collectors), "%v", collectors)
+	}
+}
+
+// TestArgs tests that the service collector is limited to the node services
+func TestArgs(t *testing.T) {
+	assert.Equal(t, []string{"--collectors.enabled=cpu,memory", "--telemetry.addr=:9182", "--telemetry.path=/metrics"},
+		Args(DefaultPort, []string{"cpu", "memory"}))
+
+	args := Args(9100, []string{"cpu", "service"})
+	require.Len(t, args, 4)
+	assert.Equal(t, "--telemetry.addr=:9100", args[1])
+	assert.Equal(t, "--collector.service.services-where=Name='kubelet' OR Name='kube-proxy' OR "+
+		"Name='hybrid-overlay-node' OR Name='containerd' OR Name='docker'", args[3])
+}
+
+// TestCheckMetrics tests that the collectors which failed or are not reported are found in a scrape
+func TestCheckMetrics(t *testing.T) {
+	metrics := `# HELP windows_exporter_collector_success windows_exporter: Whether the collector was successful.
+# TYPE windows_exporter_collector_success gauge
+windows_exporter_collector_success{collector="cpu"} 1
+windows_exporter_collector_success{collector="memory"} 1
+windows_exporter_collector_success{collector="container"} 0
+windows_cpu_time_total{core="0,0",mode="idle"} 12345.5
+`
+	assert.NoError(t, CheckMetrics(strings.NewReader(metrics), []string{"cpu", "memory"}))
+	err := CheckMetrics(strings.NewReader(metrics), []string{"cpu", "tcp", "container"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "container, tcp")
+	assert.Error(t, CheckMetrics(strings.NewReader(""), []string{"cpu"}))
+}
+
+// TestFirewallRuleScript tests that the firewall rule replaces the previous one and quotes the remote address
+func TestFirewallRuleScript(t *testing.T) {
+	script := firewallRuleScript(DefaultPort, "10.0.0.0/16")
+	assert.True(t, strings.HasPrefix(script, "Remove-NetFirewallRule -DisplayName 'OpenShift windows_exporter'"))
+	assert.Contains(t, script, "-Protocol TCP -LocalPort 9182 -RemoteAddress '10.0.0.0/16'")
+	assert.Contains(t, firewallRuleScript(DefaultPort, "a'b"), "-RemoteAddress 'a''b'")
+}
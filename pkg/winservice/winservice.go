@@ -0,0 +1,136 @@
+package winservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+/*
+	winservice manages the Windows services WMCB installs next to the kubelet, like the monitor, the agent, the log
+	rotation and windows_exporter. The services are started automatically with the node and restarted by the Service
+	Control Manager (SCM) when they fail.
+*/
+
+const (
+	// deleteWaitTime is an arbitrary amount of time to wait for Windows to clean up a service marked for deletion
+	deleteWaitTime = 10 * time.Second
+	// stopTimeout is the time given to a Windows service to stop
+	stopTimeout = 30 * time.Second
+	// pollInterval is the time between two checks of the state of a Windows service
+	pollInterval = 300 * time.Millisecond
+	// restartDelay is the time the SCM waits before restarting a failed service
+	restartDelay = 5 * time.Second
+	// resetPeriod is the time in seconds without failure after which the SCM resets the failure count of a service
+	resetPeriod = 600
+)
+
+// Install creates and starts the Windows service of the given name and description running the given executable with
+// the given arguments. An existing service of the same name is replaced.
+func Install(name, description, exePath string, args ...string) error {
+	if err := Remove(name); err != nil {
+		return err
+	}
+
+	svcMgr, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	defer svcMgr.Disconnect()
+
+	service, err := svcMgr.CreateService(name, exePath, mgr.Config{
+		StartType:   mgr.StartAutomatic,
+		DisplayName: name,
+		Description: description,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("could not create %s service: %v", name, err)
+	}
+	defer service.Close()
+
+	if err = service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: restartDelay},
+	}, resetPeriod); err != nil {
+		return fmt.Errorf("could not set recovery actions on %s service: %v", name, err)
+	}
+	if err = service.Start(); err != nil {
+		return fmt.Errorf("could not start %s service: %v", name, err)
+	}
+	return nil
+}
+
+// Remove removes the Windows service of the given name if it exists
+func Remove(name string) error {
+	svcMgr, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	existing, err := svcMgr.OpenService(name)
+	if err != nil {
+		// Nothing to remove
+		svcMgr.Disconnect()
+		return nil
+	}
+	// Stopping is best effort, the service may not be running
+	existing.Control(svc.Stop)
+	err = existing.Delete()
+	existing.Close()
+	svcMgr.Disconnect()
+	if err != nil {
+		return fmt.Errorf("could not remove existing %s service: %v", name, err)
+	}
+	// There must be zero handles to the service API for the deletion to complete, give Windows time to clean up
+	time.Sleep(deleteWaitTime)
+	return nil
+}
+
+// Restart restarts the Windows service of the given name, e.g. for it to run an updated executable, returning false
+// if the service is not installed
+func Restart(name string) (bool, error) {
+	svcMgr, err := mgr.Connect()
+	if err != nil {
+		return false, fmt.Errorf("could not connect to Windows SCM: %s", err)
+	}
+	defer svcMgr.Disconnect()
+	service, err := svcMgr.OpenService(name)
+	if err != nil {
+		// Nothing to restart
+		return false, nil
+	}
+	defer service.Close()
+
+	if err = Stop(service); err != nil {
+		return true, err
+	}
+	if err = service.Start(); err != nil {
+		return true, fmt.Errorf("could not start %s service: %v", name, err)
+	}
+	return true, nil
+}
+
+// Stop stops the given Windows service and waits for it to be stopped
+func Stop(service *mgr.Service) error {
+	status, err := service.Query()
+	if err != nil {
+		return fmt.Errorf("could not query %s service: %v", service.Name, err)
+	}
+	if status.State == svc.Stopped {
+		return nil
+	}
+	if status, err = service.Control(svc.Stop); err != nil {
+		return fmt.Errorf("could not stop %s service: %v", service.Name, err)
+	}
+	options := poll.Options{Interval: pollInterval, Timeout: stopTimeout, Jitter: poll.DefaultJitter}
+	return poll.Until(context.Background(), service.Name+" service to stop", options, func() (bool, string, error) {
+		if status.State != svc.Stopped {
+			if status, err = service.Query(); err != nil {
+				return false, "", fmt.Errorf("could not query %s service: %v", service.Name, err)
+			}
+		}
+		return status.State == svc.Stopped, fmt.Sprintf("state=%d", status.State), nil
+	})
+}
@@ -0,0 +1,45 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bitlocker"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBitLocker tests that the node bootstrapped with BitLocker has its data volume, which holds the kubelet root
+// directory, the kubelet log and the container runtime data, encrypted, and that the kubelet keeps running and writing
+// to it
+func TestBitLocker(t *testing.T) {
+	if os.Getenv(bitLockerEnvVar) == "" {
+		t.Skipf("%s is not set", bitLockerEnvVar)
+	}
+	volume, err := bitlocker.Get(os.Getenv("SystemDrive"))
+	require.NoError(t, err, "Could not query the BitLocker status")
+	warning, err := volume.Check()
+	require.NoError(t, err, "data volume is not encrypted")
+	if warning != "" {
+		t.Log(warning)
+	}
+
+	assert.True(t, svcRunning(t, bootstrapper.KubeletServiceName), "The kubelet service is not running")
+	info, err := os.Stat(kubeletLogPath)
+	require.NoError(t, err)
+	size := info.Size()
+	err = poll.Until(context.Background(), "the kubelet to write to "+kubeletLogPath+" on the encrypted volume",
+		poll.Options{Interval: time.Second, Timeout: logWriteTimeout}, func() (bool, string, error) {
+			info, err := os.Stat(kubeletLogPath)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return info.Size() != size, fmt.Sprintf("the log is still %d bytes", size), nil
+		})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,66 @@
+package e2e
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/crashdump"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// crashingBinary is the executable crashed by the test to write a dump, which the test suite retrieves from the
+	// node
+	crashingBinary = "powershell.exe"
+	// dumpTimeout is the time given to Windows Error Reporting to write the dump of the crashed process
+	dumpTimeout = 2 * time.Minute
+)
+
+// TestCrashDumps tests that the crash dumps of the node components, and of the crashing executable, are configured as
+// configure-crash-dumps does, and that a crash of a configured executable writes a dump to the dump directory
+func TestCrashDumps(t *testing.T) {
+	dumpDir := filepath.Join(installDir, "dumps")
+	binaries, err := crashdump.NodeBinaries(filepath.Join(installDir, "cni"), []string{crashingBinary})
+	require.NoError(t, err)
+	require.NoError(t, crashdump.Configure(dumpDir, crashdump.MiniDump, 10, binaries))
+	// Only the node components are configured to write dumps by WMCB, later crashes of the crashing executable must not
+	defer func() {
+		assert.NoError(t, registry.DeleteKey(registry.LOCAL_MACHINE,
+			strings.TrimPrefix(crashdump.RegistryKey(crashingBinary), `HKLM\`)))
+	}()
+
+	assert.Contains(t, binaries, "kubelet.exe")
+	assert.Contains(t, binaries, crashingBinary)
+	for _, binary := range binaries {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, strings.TrimPrefix(crashdump.RegistryKey(binary), `HKLM\`),
+			registry.QUERY_VALUE)
+		if !assert.NoError(t, err, "LocalDumps are not configured for %s", binary) {
+			continue
+		}
+		folder, _, err := key.GetStringValue("DumpFolder")
+		assert.NoError(t, err)
+		assert.Equal(t, dumpDir, folder)
+		key.Close()
+	}
+
+	// FailFast terminates the process through Windows Error Reporting, which writes the dump
+	exec.Command(crashingBinary, "-NonInteractive", "-Command",
+		"[Environment]::FailFast('WMCB e2e crash dump test')").Run()
+	require.NoError(t, waitForDump(dumpDir, crashingBinary), "no dump was written for %s", crashingBinary)
+}
+
+// waitForDump waits until a dump of the given executable is written to the given directory
+func waitForDump(dumpDir, binary string) error {
+	for start := time.Now(); time.Since(start) < dumpTimeout; time.Sleep(5 * time.Second) {
+		if dumps, err := filepath.Glob(filepath.Join(dumpDir, binary+".*.dmp")); err == nil && len(dumps) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("timeout waiting for a dump of %s in %s", binary, dumpDir)
+}
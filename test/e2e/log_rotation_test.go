@@ -0,0 +1,62 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/logrotate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// rotationMaxBackups is the number of backups kept by the log rotation configured by the test
+	rotationMaxBackups = 2
+	// rotationRounds is the number of rotations of the kubelet log, more than the backups kept
+	rotationRounds = 3
+	// logWriteTimeout is the time given to the kubelet to write to its log after it was truncated
+	logWriteTimeout = 2 * time.Minute
+)
+
+// TestLogRotation tests that the log of the running kubelet is rotated in place and that the backups beyond the
+// maximum number are removed. The configuration used is left in the install directory for the test suite to check.
+func TestLogRotation(t *testing.T) {
+	config := &logrotate.Config{
+		// Any log the kubelet has written is rotated
+		MaxSize:    1,
+		MaxAge:     logrotate.Duration(logrotate.DefaultMaxAge),
+		MaxBackups: rotationMaxBackups,
+		Interval:   logrotate.Duration(logrotate.DefaultInterval),
+		Targets:    logrotate.DefaultTargets(kubeletLogDir(), filepath.Join(installDir, "cni")),
+	}
+	require.NoError(t, config.Validate())
+	require.NoError(t, logrotate.WriteConfig(filepath.Join(installDir, logrotate.ConfigFileName), config))
+
+	now := time.Now()
+	for i := 0; i < rotationRounds; i++ {
+		require.NoError(t, waitForLogWrite(kubeletLogPath), "kubelet did not write to its log")
+		// Rotations a second apart, so that the backups are ordered
+		result, err := logrotate.Rotate(config, now.Add(time.Duration(i)*time.Second))
+		require.NoError(t, err, "error rotating logs")
+		assert.Contains(t, result.Rotated, logrotate.BackupPath(kubeletLogPath, now.Add(time.Duration(i)*time.Second)))
+	}
+
+	backups, err := logrotate.Backups(kubeletLogPath)
+	require.NoError(t, err)
+	assert.Len(t, backups, rotationMaxBackups, "expected the oldest kubelet log backups to be removed")
+	// The kubelet keeps its log file open, so it should keep writing to it once truncated
+	assert.NoError(t, waitForLogWrite(kubeletLogPath), "kubelet stopped writing to its log after the rotation")
+}
+
+// waitForLogWrite waits until the given log file is not empty
+func waitForLogWrite(path string) error {
+	for start := time.Now(); time.Since(start) < logWriteTimeout; time.Sleep(time.Second) {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("timeout waiting for %s to be written to", path)
+}
@@ -0,0 +1,68 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/bootstrapper"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/firewall"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUninstall tests that the uninstall path removes the kubelet service and the node credentials, and returns the
+// firewall to the rules it had before the first bootstrap
+func TestUninstall(t *testing.T) {
+	wmcb, err := bootstrapper.NewWinNodeBootstrapper(installDir, "", "", "", "")
+	require.NoError(t, err, "could not create wmcb")
+
+	err = wmcb.Uninstall()
+	require.NoError(t, err, "error uninstalling")
+
+	err = wmcb.Disconnect()
+	assert.NoError(t, err, "could not disconnect from windows svc API")
+
+	assert.False(t, svcExists(t, bootstrapper.KubeletServiceName), "kubelet service still exists after uninstall")
+	for _, path := range []string{"C:\\var\\lib\\kubelet\\pki", filepath.Join(installDir, "kubeconfig"),
+		filepath.Join(installDir, "kubelet.exe")} {
+		_, err := os.Stat(path)
+		assert.Truef(t, os.IsNotExist(err), "%s still exists after uninstall", path)
+	}
+
+	t.Run("Firewall is returned to its prior state", testFirewallAfterUninstall)
+}
+
+// testFirewallAfterUninstall tests that uninstall leaves no firewall rule added or removed since the snapshot taken
+// before the first bootstrap, and that the change journal is consistent with the firewall
+func testFirewallAfterUninstall(t *testing.T) {
+	if _, err := os.Stat(firewallSnapshotPath); os.IsNotExist(err) {
+		t.Skipf("no firewall snapshot at %s", firewallSnapshotPath)
+	}
+	before, err := firewall.Read(firewallSnapshotPath)
+	require.NoError(t, err, "could not read firewall snapshot")
+	after, err := firewall.Take()
+	require.NoError(t, err, "could not take firewall snapshot")
+
+	diff := firewall.Compare(before, after)
+	assert.Empty(t, diff.Added, "firewall rules added since the snapshot remain after uninstall")
+	assert.Empty(t, diff.Removed, "firewall rules removed since the snapshot are not restored by uninstall")
+	// The test framework may modify the existing rules, e.g. restrict the WinRM rules to the cluster network, which
+	// WMCB does not record
+	for _, change := range diff.Changed {
+		t.Logf("firewall rule changed since the snapshot: %s", change)
+	}
+
+	entries, err := journal.Read(bootstrapper.NewJournal(installDir, "").Path())
+	require.NoError(t, err, "could not read the change journal")
+	// Audit the rules added and removed only, the changed ones being accounted for above
+	for _, change := range diff.Changed {
+		for i := range after.Rules {
+			if after.Rules[i].Name == change.After.Name {
+				after.Rules[i] = change.Before
+			}
+		}
+	}
+	assert.Empty(t, firewall.Audit(before, after, entries), "change journal does not match the firewall")
+}
@@ -0,0 +1,58 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/windowsexporter"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// windowsExporterEnvVar is the environment variable holding the location of the windows_exporter executable
+	// installed by the test, which is skipped if not set
+	windowsExporterEnvVar = "WMCB_E2E_WINDOWS_EXPORTER"
+	// scrapeTimeout is the time given to windows_exporter to report its collectors as successful after it started
+	scrapeTimeout = 2 * time.Minute
+)
+
+// TestWindowsExporter tests that windows_exporter is installed as a service serving the default collectors, and that
+// its metrics port is opened in the Windows Firewall. The service is left running for the test suite to scrape it
+// from outside the node.
+func TestWindowsExporter(t *testing.T) {
+	binary := os.Getenv(windowsExporterEnvVar)
+	if binary == "" {
+		t.Skipf("%s not set", windowsExporterEnvVar)
+	}
+	_, _, err := windowsexporter.Install(binary, installDir, windowsexporter.DefaultPort,
+		windowsexporter.DefaultCollectors)
+	require.NoError(t, err, "error installing windows_exporter")
+	require.NoError(t, windowsexporter.OpenFirewall(windowsexporter.DefaultPort, "Any"))
+	require.NoError(t, waitForScrape(fmt.Sprintf("http://localhost:%d%s", windowsexporter.DefaultPort,
+		windowsexporter.MetricsPath), windowsexporter.DefaultCollectors))
+}
+
+// waitForScrape waits until a scrape of the given URL reports the given collectors as successful
+func waitForScrape(url string, collectors []string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return poll.Until(context.Background(), "a successful scrape of windows_exporter",
+		poll.Options{Interval: 5 * time.Second, Timeout: scrapeTimeout}, func() (bool, string, error) {
+			resp, err := client.Get(url)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return false, fmt.Sprintf("unexpected status scraping %s: %s", url, resp.Status), nil
+			}
+			if err = windowsexporter.CheckMetrics(resp.Body, collectors); err != nil {
+				return false, err.Error(), nil
+			}
+			return true, "", nil
+		})
+}
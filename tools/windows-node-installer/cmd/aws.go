@@ -2,8 +2,22 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/bootstrap"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/credentials"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/diagnose"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/export"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/keypair"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -15,16 +29,44 @@ var (
 		imageID string
 		// instanceType is the flavor of VM to be used
 		instanceType string
-		// sshKey is the ssh key to access the VM created. Please note that key should be uploaded to AWS before
-		// using this flag
+		// sshKey is the name of an existing key pair to access the VM created. A key pair is generated if not given.
 		sshKey string
 		// credentialPath is the location of the aws credentials file on the disk
 		credentialPath string
 		// credentialAccountID is the aws account id
 		credentialAccountID string
+		// region is the expected region of the cluster, checked to avoid using the kubeconfig of the wrong cluster
+		region string
 		// privateKeyPath is the location of the private key on the machine for the public key uploaded to AWS
 		// This is used to decrypt the password for the Windows locally
 		privateKeyPath string
+		// networkMode selects whether the instances are reached through their public or private IP
+		networkMode string
+		// registerDNS registers the created instance in the private DNS zone of the cluster
+		registerDNS bool
+		// computerName is the Windows computer name of the created instance
+		computerName string
+		// windowsUpdate is the Windows Update mode of the created instance
+		windowsUpdate string
+		// windowsUpdateKBs are the updates installed on the created instance before freezing it
+		windowsUpdateKBs []string
+		// requireIMDSv2 requires session tokens for the requests to the instance metadata service of the created
+		// instance
+		requireIMDSv2 bool
+		// metadataHopLimit is the hop limit of the responses of the instance metadata service of the created instance
+		metadataHopLimit int
+		// targetGroupARNs are the ARNs of the load balancer target groups the created instance is registered with
+		targetGroupARNs []string
+	}
+
+	// debugAccessInfo contains information for opening and revoking debug access to an instance
+	debugAccessInfo struct {
+		// instanceID is the ID of the instance to open or revoke debug access to
+		instanceID string
+		// enableRDP opens RDP access to the instance
+		enableRDP bool
+		// cidr is the address range to open debug access from
+		cidr string
 	}
 )
 
@@ -33,6 +75,20 @@ func init() {
 	rootCmd.AddCommand(awsCmd)
 	awsCmd.AddCommand(createCmd())
 	awsCmd.AddCommand(destroyCmd())
+	awsCmd.AddCommand(debugAccessCmd())
+	awsCmd.AddCommand(revokeDebugAccessCmd())
+	awsCmd.AddCommand(shellCmd())
+	awsCmd.AddCommand(tunnelCmd())
+	awsCmd.AddCommand(bootstrapCmd())
+	awsCmd.AddCommand(exportCmd())
+	awsCmd.AddCommand(exportCredentialsCmd())
+	awsCmd.AddCommand(costCmd())
+	awsCmd.AddCommand(checkQuotasCmd())
+	awsCmd.AddCommand(snapshotCmd())
+	awsCmd.AddCommand(restoreSnapshotCmd())
+	awsCmd.AddCommand(deleteSnapshotCmd())
+	awsCmd.AddCommand(validateImageCmd())
+	awsCmd.AddCommand(compareImagesCmd())
 }
 
 func newAWSCmd() *cobra.Command {
@@ -49,6 +105,13 @@ func newAWSCmd() *cobra.Command {
 	awsCmd.PersistentFlags().StringVar(&awsInfo.credentialAccountID, "credential-account", "",
 		"account name of a credential used to create the OpenShift Cluster specified in the provider's credentials"+
 			" file (required)")
+
+	awsCmd.PersistentFlags().StringVar(&awsInfo.region, "region", "",
+		"region of the existing OpenShift cluster. If given, the command fails if the cluster is in another region")
+
+	awsCmd.PersistentFlags().StringVar(&awsInfo.networkMode, "network", string(types.NetworkModeAuto),
+		"how the instances are reached: public, private to create them without public IP and reach them through "+
+			"their private IP from within the VPC of the cluster, or auto to use private when running in that VPC")
 	return awsCmd
 }
 
@@ -65,6 +128,121 @@ func requiredAWSFlags(awsCmd *cobra.Command) error {
 	return nil
 }
 
+// newAWSCloud returns the cloud provider of the cluster, with the credentials and the network mode of the aws flags
+func newAWSCloud(imageID, instanceType, sshKey, privateKeyPath string) (cloudprovider.Cloud, error) {
+	return newAWSCloudIn(rootInfo.resourceTrackerDir, imageID, instanceType, sshKey, privateKeyPath)
+}
+
+// newAWSCloudIn returns the cloud provider of the cluster recording the created resources in the given directory
+func newAWSCloudIn(resourceTrackerDir, imageID, instanceType, sshKey, privateKeyPath string) (cloudprovider.Cloud,
+	error) {
+	networkMode, err := types.ParseNetworkMode(awsInfo.networkMode)
+	if err != nil {
+		return nil, err
+	}
+	cloud, err := cloudprovider.CloudProviderFactory(rootInfo.kubeconfigPath, awsInfo.credentialPath,
+		awsInfo.credentialAccountID, resourceTrackerDir, imageID, instanceType, sshKey, privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if setter, ok := cloud.(cloudprovider.NetworkModeSetter); ok {
+		setter.SetNetworkMode(networkMode)
+	} else if networkMode == types.NetworkModePrivate {
+		return nil, fmt.Errorf("the private network mode is not supported by the cloud provider")
+	}
+	return cloud, nil
+}
+
+// setDNSRegistration enables the registration of the created instances in the private DNS zone of the cluster, if
+// requested
+func setDNSRegistration(cloud cloudprovider.Cloud, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	registrar, ok := cloud.(cloudprovider.DNSRegistrar)
+	if !ok {
+		return fmt.Errorf("DNS registration is not supported by the cloud provider")
+	}
+	registrar.SetDNSRegistration(true)
+	return nil
+}
+
+// setLoadBalancerTargets adds the created instances to the given load balancer target groups or backend pools, if any
+func setLoadBalancerTargets(cloud cloudprovider.Cloud, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	registrar, ok := cloud.(cloudprovider.LoadBalancerRegistrar)
+	if !ok {
+		return fmt.Errorf("load balancer registration is not supported by the cloud provider")
+	}
+	return registrar.SetLoadBalancerTargets(targets)
+}
+
+// setComputerName sets the Windows computer name of the created instances, if given
+func setComputerName(cloud cloudprovider.Cloud, name string) error {
+	if name == "" {
+		return nil
+	}
+	namer, ok := cloud.(cloudprovider.ComputerNamer)
+	if !ok {
+		return fmt.Errorf("setting the computer name is not supported by the cloud provider")
+	}
+	return namer.SetComputerName(name)
+}
+
+// setWindowsUpdatePolicy sets the Windows Update policy of the created instances, unless Windows Update is left as
+// configured by the image
+func setWindowsUpdatePolicy(cloud cloudprovider.Cloud, mode string, kbs []string) error {
+	policy, err := types.NewWindowsUpdatePolicy(mode, kbs)
+	if err != nil {
+		return err
+	}
+	if policy.IsDefault() {
+		return nil
+	}
+	controller, ok := cloud.(cloudprovider.WindowsUpdateController)
+	if !ok {
+		return fmt.Errorf("controlling Windows Update is not supported by the cloud provider")
+	}
+	controller.SetWindowsUpdatePolicy(policy)
+	return nil
+}
+
+// setMetadataOptions hardens the instance metadata service of the created instances, if requested
+func setMetadataOptions(cloud cloudprovider.Cloud, requireTokens bool, hopLimit int) error {
+	if hopLimit != 0 && !requireTokens {
+		return fmt.Errorf("--metadata-hop-limit requires --require-imdsv2")
+	}
+	options, err := types.NewMetadataOptions(requireTokens, hopLimit)
+	if err != nil {
+		return err
+	}
+	if options.IsDefault() {
+		return nil
+	}
+	hardener, ok := cloud.(cloudprovider.MetadataHardener)
+	if !ok {
+		return fmt.Errorf("hardening the instance metadata service is not supported by the cloud provider")
+	}
+	hardener.SetMetadataOptions(options)
+	return nil
+}
+
+// checkQuotas fails if the given number of instances does not fit the quotas of the cloud account, so that the
+// creation fails before creating anything rather than halfway with a limit error. Cloud providers that cannot check
+// their quotas are not checked.
+func checkQuotas(cloud cloudprovider.Cloud, count int) error {
+	checker, ok := cloud.(cloudprovider.QuotaChecker)
+	if !ok {
+		return nil
+	}
+	if err := checker.CheckQuotas(count); err != nil {
+		return fmt.Errorf("quota check failed, %v", err)
+	}
+	return nil
+}
+
 // createCmd defines `create` command and creates a Windows instance using parameters from the persistent flags to
 // fill up information in createFlagInfo. It uses PreRunE to check for whether required flags are provided.
 func createCmd() *cobra.Command {
@@ -79,17 +257,37 @@ func createCmd() *cobra.Command {
 		},
 		TraverseChildren: true,
 		RunE: func(_ *cobra.Command, args []string) error {
-			cloud, err := cloudprovider.CloudProviderFactory(rootInfo.kubeconfigPath, awsInfo.credentialPath,
-				awsInfo.credentialAccountID, rootInfo.resourceTrackerDir,
-				awsInfo.imageID, awsInfo.instanceType, awsInfo.sshKey, awsInfo.privateKeyPath)
+			cloud, err := newAWSCloud(awsInfo.imageID, awsInfo.instanceType, awsInfo.sshKey, awsInfo.privateKeyPath)
 			if err != nil {
 				return fmt.Errorf("error creating aws client, %v", err)
 			}
+			if err = setDNSRegistration(cloud, awsInfo.registerDNS); err != nil {
+				return err
+			}
+			if err = setLoadBalancerTargets(cloud, awsInfo.targetGroupARNs); err != nil {
+				return err
+			}
+			if err = setComputerName(cloud, awsInfo.computerName); err != nil {
+				return err
+			}
+			if err = setWindowsUpdatePolicy(cloud, awsInfo.windowsUpdate, awsInfo.windowsUpdateKBs); err != nil {
+				return err
+			}
+			if err = setMetadataOptions(cloud, awsInfo.requireIMDSv2, awsInfo.metadataHopLimit); err != nil {
+				return err
+			}
+			if err = checkQuotas(cloud, 1); err != nil {
+				return err
+			}
 			// TODO: Use the Windows VM object to get password, user name etc here.
-			_, err = cloud.CreateWindowsVM()
+			vm, err := cloud.CreateWindowsVM()
 			if err != nil {
 				return fmt.Errorf("error creating Windows Instance, %v", err)
 			}
+			if hostname := vm.GetCredentials().GetHostname(); hostname != "" {
+				log.Printf("instance %s is reachable in the cluster as %s", vm.GetCredentials().GetInstanceId(),
+					hostname)
+			}
 			return nil
 		},
 	}
@@ -100,25 +298,47 @@ func createCmd() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&awsInfo.instanceType, "instance-type", "",
 		"name of a type of instance (i.e.: m4.large for AWS, etc) (required)")
 	cmd.PersistentFlags().StringVar(&awsInfo.sshKey, "ssh-key", "",
-		"name of existing ssh key on cloud provider for accessing the instance after it is created (required)")
+		"name of an existing key pair on the cloud provider for accessing the instance after it is created. If not "+
+			"given, a key pair is generated and its private key is stored next to 'windows-node-installer.json', "+
+			"encrypted with the passphrase of "+keypair.PassphraseEnvVar)
 	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
-		"path of the private key for accessing the instance after it is created (required)")
+		"path of the private key of the key pair given with --ssh-key (required with --ssh-key)")
+	cmd.PersistentFlags().BoolVar(&awsInfo.registerDNS, "register-dns", false,
+		"register the instance in the private hosted zone of the cluster as <instance name>.<cluster domain>")
+	cmd.PersistentFlags().StringSliceVar(&awsInfo.targetGroupARNs, "target-group-arn", nil,
+		"comma separated ARNs of existing application or network load balancer target groups in the VPC of the "+
+			"cluster to register the instance with, by instance ID or private IP depending on their target type. "+
+			"The instance is deregistered when it is destroyed")
+	cmd.PersistentFlags().StringVar(&awsInfo.computerName, "computer-name", "",
+		"Windows computer name of the instance, or "+types.ComputerNamePrivateDNS+" to name it after its private "+
+			"DNS name like the node name the kubelet registers with. The instance is renamed and rebooted during "+
+			"setup. Defaults to the name given by the image")
+	cmd.PersistentFlags().StringVar(&awsInfo.windowsUpdate, "windows-update", string(types.WindowsUpdateDefault),
+		"Windows Update mode of the instance: default to leave it as configured by the image, paused to turn the "+
+			"automatic updates off, or disabled to also disable the Windows Update service, so that updates do not "+
+			"reboot the instance at any time")
+	cmd.PersistentFlags().StringSliceVar(&awsInfo.windowsUpdateKBs, "windows-update-kb", nil,
+		"comma separated IDs of the updates to install before freezing the instance, e.g. KB5005112. The instance "+
+			"is rebooted if the updates require it, and Windows Update is disabled unless --windows-update is given")
+	cmd.PersistentFlags().BoolVar(&awsInfo.requireIMDSv2, "require-imdsv2", false,
+		"require IMDSv2 session tokens for the requests to the instance metadata service of the instance, so that "+
+			"the credentials of the worker IAM role cannot be read with IMDSv1 requests")
+	cmd.PersistentFlags().IntVar(&awsInfo.metadataHopLimit, "metadata-hop-limit", 0,
+		fmt.Sprintf("hop limit of the responses of the instance metadata service, only with --require-imdsv2: 1 to "+
+			"only let the processes of the host reach it, 2 to also let the containers reach it. Defaults to %d",
+			types.DefaultMetadataHopLimit))
 	return cmd
 }
 
-// validateCreateFlags defines required flags for createCmd.
+// validateCreateFlags defines required flags for createCmd. The private key is only required with an existing key pair,
+// the private key of a generated key pair is used otherwise.
 func validateCreateFlags(createCmd *cobra.Command) error {
 	err := createCmd.MarkPersistentFlagRequired("instance-type")
 	if err != nil {
 		return err
 	}
-	err = createCmd.MarkPersistentFlagRequired("ssh-key")
-	if err != nil {
-		return err
-	}
-	err = createCmd.MarkPersistentFlagRequired("private-key")
-	if err != nil {
-		return err
+	if awsInfo.sshKey != "" && awsInfo.privateKeyPath == "" {
+		return fmt.Errorf("--private-key is required with --ssh-key")
 	}
 	return nil
 }
@@ -133,8 +353,7 @@ func destroyCmd() *cobra.Command {
 			"The security groups still associated with any existing instances will not be deleted.",
 
 		RunE: func(_ *cobra.Command, _ []string) error {
-			cloud, err := cloudprovider.CloudProviderFactory(rootInfo.kubeconfigPath, awsInfo.credentialPath,
-				awsInfo.credentialAccountID, rootInfo.resourceTrackerDir, "", "", "", "")
+			cloud, err := newAWSCloud("", "", "", "")
 			if err != nil {
 				return fmt.Errorf("error creating cloud provider clients, %v", err)
 			}
@@ -147,3 +366,728 @@ func destroyCmd() *cobra.Command {
 	}
 	return cmd
 }
+
+// debugAccessCmd defines `debug-access` command and opens temporary RDP access to an instance from the given CIDR.
+// The changes are recorded next to the 'windows-node-installer.json' file so that they can be revoked.
+func debugAccessCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug-access",
+		Short: "Open temporary RDP access to a Windows instance for debugging.",
+		Long: "Open RDP access to a Windows instance from the given CIDR by adding a rule to the Windows worker " +
+			"security group and a firewall rule on the instance. The changes are recorded in the current or " +
+			"specified directory and are undone by the revoke-debug-access and destroy commands.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return validateDebugAccessFlags(cmd)
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if !debugAccessInfo.enableRDP {
+				return fmt.Errorf("no debug access requested, use --enable-rdp to open RDP access")
+			}
+			debugAccess, err := debugAccessProvider()
+			if err != nil {
+				return err
+			}
+			if err = debugAccess.EnableDebugAccess(debugAccessInfo.instanceID, debugAccessInfo.cidr); err != nil {
+				return fmt.Errorf("error opening debug access, %v", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&debugAccessInfo.instanceID, "instance-id", "",
+		"ID of the instance to open debug access to (required)")
+	cmd.PersistentFlags().BoolVar(&debugAccessInfo.enableRDP, "enable-rdp", false,
+		"open RDP access to the instance")
+	cmd.PersistentFlags().StringVar(&debugAccessInfo.cidr, "cidr", "",
+		"address range to open debug access from, i.e.: 203.0.113.10/32 (required)")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key for accessing the instance, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// validateDebugAccessFlags defines required flags for debugAccessCmd.
+func validateDebugAccessFlags(debugAccessCmd *cobra.Command) error {
+	for _, flag := range []string{"instance-id", "cidr"} {
+		if err := debugAccessCmd.MarkPersistentFlagRequired(flag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeDebugAccessCmd defines `revoke-debug-access` command and revokes the debug access recorded by the
+// `debug-access` command.
+func revokeDebugAccessCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke-debug-access",
+		Short: "Revoke the debug access opened with the debug-access command.",
+		Long: "Revoke the debug access recorded in the current or specified directory, removing the security " +
+			"group and firewall rules. All the recorded debug access is revoked unless an instance is specified.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			debugAccess, err := debugAccessProvider()
+			if err != nil {
+				return err
+			}
+			if err = debugAccess.RevokeDebugAccess(debugAccessInfo.instanceID); err != nil {
+				return fmt.Errorf("error revoking debug access, %v", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&debugAccessInfo.instanceID, "instance-id", "",
+		"ID of the instance to revoke debug access to, all recorded debug access is revoked if not given")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key for accessing the instance, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// debugAccessProvider returns the cloud provider as a DebugAccess interface, or an error if the provider does not
+// support debug access
+func debugAccessProvider() (cloudprovider.DebugAccess, error) {
+	cloud, err := newAWSCloud("", "", "", awsInfo.privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cloud provider clients, %v", err)
+	}
+	debugAccess, ok := cloud.(cloudprovider.DebugAccess)
+	if !ok {
+		return nil, fmt.Errorf("debug access is not supported by the cloud provider")
+	}
+	return debugAccess, nil
+}
+
+// shellCmd defines `shell` command and opens an interactive PowerShell session on an instance over SSH.
+func shellCmd() *cobra.Command {
+	var instanceID string
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Open an interactive PowerShell session on a Windows instance.",
+		Long: "Open an interactive PowerShell session on a Windows instance created by wni over SSH. The password of " +
+			"the instance is decrypted with the private key of the instance, so no credentials need to be looked up.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("instance-id")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cloud, err := newAWSCloud("", "", "", awsInfo.privateKeyPath)
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			getter, ok := cloud.(cloudprovider.WindowsVMGetter)
+			if !ok {
+				return fmt.Errorf("connecting to existing instances is not supported by the cloud provider")
+			}
+			vm, err := getter.GetWindowsVM(instanceID)
+			if err != nil {
+				return fmt.Errorf("error connecting to instance %s, %v", instanceID, err)
+			}
+			if err = vm.Shell(os.Stdin, os.Stdout, os.Stderr); err != nil {
+				return fmt.Errorf("error running shell on instance %s, %v", instanceID, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance to open the shell on (required)")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key for accessing the instance, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// tunnelCmd defines `tunnel` command and forwards a local port to a port on an instance over SSH until interrupted.
+func tunnelCmd() *cobra.Command {
+	var instanceID string
+	var localPort, remotePort int
+	cmd := &cobra.Command{
+		Use:   "tunnel",
+		Short: "Forward a local port to a port on a Windows instance.",
+		Long: "Forward the connections made to a local port to a port on a Windows instance created by wni over " +
+			"SSH, i.e. to reach the kubelet on port 10250. The tunnel is open until the command is interrupted.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			for _, flag := range []string{"instance-id", "remote-port"} {
+				if err := cmd.MarkPersistentFlagRequired(flag); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cloud, err := newAWSCloud("", "", "", awsInfo.privateKeyPath)
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			getter, ok := cloud.(cloudprovider.WindowsVMGetter)
+			if !ok {
+				return fmt.Errorf("connecting to existing instances is not supported by the cloud provider")
+			}
+			vm, err := getter.GetWindowsVM(instanceID)
+			if err != nil {
+				return fmt.Errorf("error connecting to instance %s, %v", instanceID, err)
+			}
+			tunnel, err := vm.Tunnel(localPort, remotePort)
+			if err != nil {
+				return fmt.Errorf("error opening tunnel to instance %s, %v", instanceID, err)
+			}
+			defer tunnel.Close()
+			log.Printf("forwarding %s to port %d on instance %s, press Ctrl+C to stop", tunnel.LocalAddr(),
+				remotePort, instanceID)
+
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			<-interrupt
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance to forward the port to (required)")
+	cmd.PersistentFlags().IntVar(&localPort, "local-port", 0,
+		"local port to listen on, a free port is picked if not given")
+	cmd.PersistentFlags().IntVar(&remotePort, "remote-port", 0,
+		"port on the instance to forward the connections to, i.e.: 10250 (required)")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key for accessing the instance, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// bootstrapCmd defines `bootstrap` command and runs WMCB on an instance until its node joined the cluster.
+func bootstrapCmd() *cobra.Command {
+	var instanceID string
+	options := bootstrap.Options{}
+	cmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Bootstrap a Windows instance as a worker node of the OpenShift cluster.",
+		Long: "Bootstrap a Windows instance created by wni as a worker node: copy WMCB and the kubelet to the " +
+			"instance, run WMCB with the worker ignition file of the cluster, approve the CSRs of the node and wait " +
+			"for it to join the cluster. The instance recorded in the current or specified directory is used if " +
+			"no instance is specified.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("wmcb-path")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if instanceID == "" {
+				var err error
+				if instanceID, err = trackedInstance(); err != nil {
+					return err
+				}
+			}
+			cloud, err := newAWSCloud("", "", "", awsInfo.privateKeyPath)
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			getter, ok := cloud.(cloudprovider.WindowsVMGetter)
+			if !ok {
+				return fmt.Errorf("connecting to existing instances is not supported by the cloud provider")
+			}
+			namer, ok := cloud.(cloudprovider.NodeNamer)
+			if !ok {
+				return fmt.Errorf("getting the node name of instances is not supported by the cloud provider")
+			}
+			if options.NodeName, err = namer.GetNodeName(instanceID); err != nil {
+				return fmt.Errorf("error getting the node name of instance %s, %v", instanceID, err)
+			}
+			vm, err := getter.GetWindowsVM(instanceID)
+			if err != nil {
+				return fmt.Errorf("error connecting to instance %s, %v", instanceID, err)
+			}
+			bootstrapper, err := bootstrap.New(vm, rootInfo.kubeconfigPath, options)
+			if err != nil {
+				return fmt.Errorf("error creating bootstrapper, %v", err)
+			}
+			if err = bootstrapper.Bootstrap(); err != nil {
+				return fmt.Errorf("error bootstrapping instance %s, %v", instanceID, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance to bootstrap, the instance recorded in 'windows-node-installer.json' if not given")
+	cmd.PersistentFlags().StringVar(&options.WMCBPath, "wmcb-path", "",
+		"path of the wmcb.exe binary to run on the instance (required)")
+	cmd.PersistentFlags().StringVar(&options.KubeletPath, "kubelet-path", "",
+		"path of the kubelet.exe binary to install, the kubelet of the cluster version is downloaded if not given")
+	cmd.PersistentFlags().DurationVar(&options.Timeout, "timeout", 15*time.Minute,
+		"how long to wait for the node to join the cluster once WMCB ran")
+	cmd.PersistentFlags().StringVar(&options.ContainerRuntime, "container-runtime", "",
+		"container runtime of the node, docker or containerd, the runtime installed on the instance if not given")
+	cmd.PersistentFlags().BoolVar(&options.InsecureIgnition, "insecure-ignition", false,
+		"skip the verification of the certificate of the Machine Config Server against the root CA of the cluster")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key for accessing the instance, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// exportCmd defines `export` command and describes the infrastructure recorded in 'windows-node-installer.json' file
+// as JSON or as Terraform configuration.
+func exportCmd() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Describe the created instances, security groups and key pairs as JSON or Terraform configuration.",
+		Long: "Describe the instances and security groups recorded in the current or specified directory, the key " +
+			"pairs of the instances and their DNS records, as they currently are on the cloud provider. The " +
+			"terraform format describes them as Terraform resources with import blocks, so that the environment " +
+			"can be managed as code without recreating it.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			exportFormat, err := export.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			cloud, err := newAWSCloud("", "", "", "")
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			exporter, ok := cloud.(cloudprovider.Exporter)
+			if !ok {
+				return fmt.Errorf("exporting the infrastructure is not supported by the cloud provider")
+			}
+			infra, err := exporter.Export()
+			if err != nil {
+				return fmt.Errorf("error describing the infrastructure, %v", err)
+			}
+			return export.Write(os.Stdout, infra, exportFormat)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&format, "format", string(export.FormatJSON),
+		"format of the description: json or terraform")
+	return cmd
+}
+
+// exportCredentialsCmd defines `export-credentials` command and writes the credentials of the instances recorded in
+// 'windows-node-installer.json' file as Kubernetes Secrets, an Ansible inventory or a byoh inventory.
+func exportCredentialsCmd() *cobra.Command {
+	var format, output string
+	cmd := &cobra.Command{
+		Use:   "export-credentials",
+		Short: "Write the credentials of the created instances as Secrets or an inventory.",
+		Long: "Write the addresses, users and passwords of the instances recorded in the current or specified " +
+			"directory, looked up on the cloud provider, to --output, the standard output by default. The secret " +
+			"format writes a List of Kubernetes Secrets, one per instance, the ansible format an Ansible inventory " +
+			"of the win group the WSU playbook runs against, and the byoh format the inventory of existing hosts " +
+			"the e2e tests run against with E2E_INVENTORY.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			credentialsFormat, err := credentials.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			if credentialsFormat == credentials.FormatState {
+				return fmt.Errorf("the credentials are exported from the state file, which hosts are recorded in " +
+					"with `wni convert-credentials --to state`")
+			}
+			cloud, err := newAWSCloud("", "", "", awsInfo.privateKeyPath)
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			getter, ok := cloud.(cloudprovider.CredentialsGetter)
+			if !ok {
+				return fmt.Errorf("exporting the credentials is not supported by the cloud provider")
+			}
+			creds, err := getter.GetCredentials()
+			if err != nil {
+				return fmt.Errorf("error getting the credentials of the instances, %v", err)
+			}
+			return writeCredentials(credentials.FromCredentials(creds), credentialsFormat, output)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&format, "format", string(credentials.FormatBYOH),
+		"format of the credentials: secret, ansible or byoh")
+	cmd.PersistentFlags().StringVar(&output, "output", "",
+		"file the credentials are written to, stdout if not given")
+	cmd.PersistentFlags().StringVar(&awsInfo.privateKeyPath, "private-key", "",
+		"path of the private key decrypting the passwords, the private key of the generated key pair if not given")
+	return cmd
+}
+
+// costCmd defines `cost` command and reports the estimated spend of the instances recorded in
+// 'windows-node-installer.json' file.
+func costCmd() *cobra.Command {
+	var format, pricesPath string
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Estimate the spend of the created instances.",
+		Long: "Estimate the on-demand spend so far of the instances recorded in the current or specified directory " +
+			"and their volumes, from their instance type, volume sizes and running time. The prices are looked up " +
+			"with the AWS Price List API, falling back to built-in us-east-1 prices, unless given by --prices.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			reportFormat, err := cost.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+			var overrides *cost.PriceList
+			if pricesPath != "" {
+				if overrides, err = cost.ReadPriceList(pricesPath); err != nil {
+					return err
+				}
+			}
+			cloud, err := newAWSCloud("", "", "", "")
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			estimator, ok := cloud.(cloudprovider.CostEstimator)
+			if !ok {
+				return fmt.Errorf("estimating the cost is not supported by the cloud provider")
+			}
+			report, err := estimator.EstimateCost(overrides)
+			if err != nil {
+				return fmt.Errorf("error estimating the cost, %v", err)
+			}
+			return cost.Write(os.Stdout, report, reportFormat)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&format, "format", string(cost.FormatText),
+		"format of the report: text or json")
+	cmd.PersistentFlags().StringVar(&pricesPath, "prices", "",
+		"path of a JSON price list whose prices take precedence over the looked up ones, e.g. to apply discounts")
+	return cmd
+}
+
+// checkQuotasCmd defines `check-quotas` command and checks that the given number of instances fits the quotas of the
+// account, e.g. before creating several instances in parallel.
+func checkQuotasCmd() *cobra.Command {
+	var count int
+	cmd := &cobra.Command{
+		Use:   "check-quotas",
+		Short: "Check that the instances to create fit the quotas of the account.",
+		Long: "Check that the given number of instances of the instance type, along with the Windows worker " +
+			"security group and its rules, fit the vCPU and security group quotas of the account, without " +
+			"creating anything. The exceeded quotas are listed with their usage.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("instance-type")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if count < 1 {
+				return fmt.Errorf("invalid instance count %d", count)
+			}
+			cloud, err := newAWSCloud("", awsInfo.instanceType, "", "")
+			if err != nil {
+				return fmt.Errorf("error creating cloud provider clients, %v", err)
+			}
+			if _, ok := cloud.(cloudprovider.QuotaChecker); !ok {
+				return fmt.Errorf("checking the quotas is not supported by the cloud provider")
+			}
+			if err = checkQuotas(cloud, count); err != nil {
+				return err
+			}
+			log.Printf("%d %s instances fit the quotas of the account", count, awsInfo.instanceType)
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&awsInfo.instanceType, "instance-type", "",
+		"name of a type of instance (m5a.large for example)")
+	cmd.PersistentFlags().IntVar(&count, "count", 1, "number of instances to create")
+	return cmd
+}
+
+// snapshotCmd defines `snapshot` command and takes a snapshot of the disks of an instance, so that it can be rolled
+// back to it with the `restore-snapshot` command.
+func snapshotCmd() *cobra.Command {
+	var instanceID, name string
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Take a snapshot of a Windows instance to roll it back to later.",
+		Long: "Take a named snapshot of the volumes of a Windows instance, e.g. once it is configured, so that it " +
+			"can be rolled back to it with restore-snapshot instead of being recreated. The instance is stopped " +
+			"while the snapshots are created and started again. The snapshots are recorded in the current or " +
+			"specified directory and are deleted by the destroy command. The instance recorded in the current or " +
+			"specified directory is used if no instance is specified.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("name")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			instanceID, snapshotter, err := snapshotProvider(instanceID)
+			if err != nil {
+				return err
+			}
+			if err = snapshotter.Snapshot(instanceID, name); err != nil {
+				return fmt.Errorf("error taking snapshot of instance %s, %v", instanceID, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance to snapshot, the instance recorded in 'windows-node-installer.json' if not given")
+	cmd.PersistentFlags().StringVar(&name, "name", "", "name of the snapshot, i.e.: configured (required)")
+	return cmd
+}
+
+// restoreSnapshotCmd defines `restore-snapshot` command and rolls an instance back to a snapshot taken by the
+// `snapshot` command.
+func restoreSnapshotCmd() *cobra.Command {
+	var instanceID, name string
+	cmd := &cobra.Command{
+		Use:   "restore-snapshot",
+		Short: "Roll a Windows instance back to a snapshot.",
+		Long: "Roll a Windows instance back to a snapshot taken by the snapshot command. The instance is stopped, " +
+			"its volumes are replaced by volumes created from the snapshot and it is started again, in minutes " +
+			"rather than the time needed to create and configure a new instance. The public IP of the instance " +
+			"changes. The instance recorded in the current or specified directory is used if no instance is " +
+			"specified.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("name")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			instanceID, snapshotter, err := snapshotProvider(instanceID)
+			if err != nil {
+				return err
+			}
+			if err = snapshotter.RestoreSnapshot(instanceID, name); err != nil {
+				return fmt.Errorf("error restoring instance %s, %v", instanceID, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance to restore, the instance recorded in 'windows-node-installer.json' if not given")
+	cmd.PersistentFlags().StringVar(&name, "name", "", "name of the snapshot to restore (required)")
+	return cmd
+}
+
+// deleteSnapshotCmd defines `delete-snapshot` command and deletes a snapshot taken by the `snapshot` command.
+func deleteSnapshotCmd() *cobra.Command {
+	var instanceID, name string
+	cmd := &cobra.Command{
+		Use:   "delete-snapshot",
+		Short: "Delete a snapshot of a Windows instance.",
+		Long: "Delete a snapshot taken by the snapshot command, before the instance is destroyed. The instance " +
+			"recorded in the current or specified directory is used if no instance is specified.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("name")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			instanceID, snapshotter, err := snapshotProvider(instanceID)
+			if err != nil {
+				return err
+			}
+			if err = snapshotter.DeleteSnapshot(instanceID, name); err != nil {
+				return fmt.Errorf("error deleting snapshot of instance %s, %v", instanceID, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&instanceID, "instance-id", "",
+		"ID of the instance of the snapshot, the instance recorded in 'windows-node-installer.json' if not given")
+	cmd.PersistentFlags().StringVar(&name, "name", "", "name of the snapshot to delete (required)")
+	return cmd
+}
+
+// snapshotProvider returns the given instance, or the instance recorded in the 'windows-node-installer.json' file if
+// none is given, and the cloud provider as a Snapshotter interface, or an error if the provider does not support
+// snapshots
+func snapshotProvider(instanceID string) (string, cloudprovider.Snapshotter, error) {
+	if instanceID == "" {
+		var err error
+		if instanceID, err = trackedInstance(); err != nil {
+			return "", nil, err
+		}
+	}
+	cloud, err := newAWSCloud("", "", "", "")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating cloud provider clients, %v", err)
+	}
+	snapshotter, ok := cloud.(cloudprovider.Snapshotter)
+	if !ok {
+		return "", nil, fmt.Errorf("snapshots are not supported by the cloud provider")
+	}
+	return instanceID, snapshotter, nil
+}
+
+// trackedInstance returns the instance recorded in the 'windows-node-installer.json' file, or an error if there is not
+// exactly one
+func trackedInstance() (string, error) {
+	filePath, err := resource.MakeFilePath(rootInfo.resourceTrackerDir)
+	if err != nil {
+		return "", err
+	}
+	info, err := resource.ReadInstallerInfo(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s, %v", filePath, err)
+	}
+	if len(info.InstanceIDs) != 1 {
+		return "", fmt.Errorf("%d instances recorded in %s, use --instance-id to select one", len(info.InstanceIDs),
+			filePath)
+	}
+	return info.InstanceIDs[0], nil
+}
+
+// validateImageCmd defines `validate-image` command and boots an instance from a candidate image, runs the preflight
+// checks of the image on it and reports whether the image can be used for the Windows nodes, without bootstrapping
+// the instance into the cluster.
+func validateImageCmd() *cobra.Command {
+	var output string
+	var keepInstance, cis bool
+	cmd := &cobra.Command{
+		Use:   "validate-image",
+		Short: "Check whether a candidate image can be used for the Windows nodes.",
+		Long: "Boot an instance from the given image on the same provider as the existing OpenShift cluster, run the " +
+			"preflight checks of the image on it, i.e. the build number, the Containers feature, the required " +
+			"services and the OpenSSH server capability, and write them as a JSON report with the diagnostics " +
+			"describing the image and the timings of the phases of the setup of the instance. The instance is not " +
+			"bootstrapped into the cluster, and is destroyed once checked unless --keep-instance is given. With " +
+			"--cis, the controls of the CIS Windows Server benchmark relevant to container hosts are checked too, " +
+			"and reported without failing the command. The command fails if a check failed.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if err := cmd.MarkPersistentFlagRequired("image-id"); err != nil {
+				return err
+			}
+			return cmd.MarkPersistentFlagRequired("instance-type")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			// The instance is recorded in its own directory, so that destroying it leaves the other instances alone
+			trackerDir := filepath.Join(rootInfo.resourceTrackerDir, "validate-image-"+awsInfo.imageID)
+			if err := os.MkdirAll(trackerDir, os.ModePerm); err != nil {
+				return fmt.Errorf("could not create directory %s, %v", trackerDir, err)
+			}
+			cloud, err := newAWSCloudIn(trackerDir, awsInfo.imageID, awsInfo.instanceType, "", "")
+			if err != nil {
+				return fmt.Errorf("error creating aws client, %v", err)
+			}
+			if err = checkQuotas(cloud, 1); err != nil {
+				return err
+			}
+			if !keepInstance {
+				defer func() {
+					if err := cloud.DestroyWindowsVMs(); err != nil {
+						log.Printf("error destroying the instance recorded in %s, %v", trackerDir, err)
+						return
+					}
+					os.RemoveAll(trackerDir)
+				}()
+			}
+
+			// The phases of the creation of the instance are timed to compare the setup of the images
+			reporter := progress.GetReporter()
+			timer := progress.NewTimer(reporter)
+			progress.SetReporter(timer)
+			vm, err := cloud.CreateWindowsVM()
+			progress.SetReporter(reporter)
+			if err != nil {
+				if vm == nil {
+					return fmt.Errorf("error creating Windows instance, %v", err)
+				}
+				// The instance is reachable over WinRM but was not recorded, the checks tell why its setup failed
+				log.Printf("error setting up Windows instance, %v", err)
+				if err = recordInstance(trackerDir, vm.GetCredentials().GetInstanceId()); err != nil {
+					return err
+				}
+			}
+			address := vm.GetCredentials().GetIPAddress()
+			log.Printf("validating image %s on instance %s at %s", awsInfo.imageID,
+				vm.GetCredentials().GetInstanceId(), address)
+			report := diagnose.ValidateImage(vm, awsInfo.imageID, address)
+			if cis {
+				diagnose.CheckBenchmark(vm, report)
+			}
+			report.Timings = diagnose.SetupTimings(timer.Phases("CreateWindowsVM"))
+			if regionGetter, ok := cloud.(cloudprovider.RegionGetter); ok {
+				report.Region = regionGetter.GetRegion()
+			}
+
+			if output == "" {
+				output = filepath.Join(rootInfo.resourceTrackerDir, "validate-image-"+awsInfo.imageID+".json")
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("could not create report %s, %v", output, err)
+			}
+			defer file.Close()
+			if err = report.WriteJSON(file); err != nil {
+				return fmt.Errorf("could not write report %s, %v", output, err)
+			}
+			if err = report.WriteSummary(os.Stdout); err != nil {
+				return err
+			}
+			log.Printf("report written to %s", output)
+			if report.Failed() {
+				return fmt.Errorf("checks of image %s failed", awsInfo.imageID)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&awsInfo.imageID, "image-id", "",
+		"ami ID of the candidate image to validate (required)")
+	cmd.PersistentFlags().StringVar(&awsInfo.instanceType, "instance-type", "",
+		"name of a type of instance to boot the image on, i.e.: m4.large (required)")
+	cmd.PersistentFlags().StringVar(&output, "output", "",
+		"file to write the report to, 'validate-image-<image>.json' in the current or specified directory if not "+
+			"given")
+	cmd.PersistentFlags().BoolVar(&keepInstance, "keep-instance", false,
+		"keep the instance once checked, recorded in the 'validate-image-<image>' directory of the current or "+
+			"specified directory to be destroyed with --dir")
+	cmd.PersistentFlags().BoolVar(&cis, "cis", false,
+		"also check the controls of the "+diagnose.Benchmark+" relevant to container hosts")
+	return cmd
+}
+
+// recordInstance records the instance of the given ID in the 'windows-node-installer.json' file of the given
+// directory, so that it is destroyed with the other instances of the directory
+func recordInstance(dir, instanceID string) error {
+	filePath, err := resource.MakeFilePath(dir)
+	if err != nil {
+		return err
+	}
+	if err = resource.AppendInstallerInfo([]string{instanceID}, []string{}, filePath); err != nil {
+		return fmt.Errorf("failed to record instance %s in %s, it will have to be terminated manually, %v",
+			instanceID, filePath, err)
+	}
+	return nil
+}
+
+// compareImagesCmd defines `compare-images` command and compares the timings of the setup of the instances booted from
+// candidate images, recorded in the reports of the validate-image command, across images and regions.
+func compareImagesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "compare-images [report]...",
+		Short: "Compare how long the instances booted from candidate images take to set up.",
+		Long: "Read the given reports of the validate-image command, or the 'validate-image-<image>.json' reports " +
+			"in the current or specified directory if none is given, and print the mean of the timings of the " +
+			"phases of the setup of the instances, i.e. the first boot until the instance is reachable over WinRM, " +
+			"the OpenSSH server setup and the Windows Update installs, by image and region, fastest first. The " +
+			"instances run in the region of the cluster, so the reports collected against clusters in several " +
+			"regions can be compared together.",
+		RunE: func(_ *cobra.Command, args []string) error {
+			paths := args
+			if len(paths) == 0 {
+				var err error
+				paths, err = filepath.Glob(filepath.Join(rootInfo.resourceTrackerDir, "validate-image-*.json"))
+				if err != nil {
+					return err
+				}
+				if len(paths) == 0 {
+					return fmt.Errorf("no validate-image report in %s", rootInfo.resourceTrackerDir)
+				}
+			}
+			var reports []*diagnose.Report
+			for _, path := range paths {
+				report, err := readReport(path)
+				if err != nil {
+					return err
+				}
+				reports = append(reports, report)
+			}
+			return diagnose.WriteComparison(os.Stdout, reports)
+		},
+	}
+}
+
+// readReport reads the diagnose report written to the file of the given path
+func readReport(path string) (*diagnose.Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open report %s, %v", path, err)
+	}
+	defer file.Close()
+	report, err := diagnose.ReadReport(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read report %s, %v", path, err)
+	}
+	return report, nil
+}
@@ -26,6 +26,12 @@ var azCreateFlagInfo struct {
 	ipName string
 	// Provide the nic name if the installer doesn't want to create one.
 	nicName string
+	// registerDNS registers the created instance in the private DNS zone of the cluster
+	registerDNS bool
+	// computerName is the Windows computer name of the created instance
+	computerName string
+	// backendPools are the IDs of the load balancer backend pools the created instance is added to
+	backendPools []string
 }
 
 func init() {
@@ -110,6 +116,13 @@ func azCreateCmd() *cobra.Command {
 			} else {
 				return fmt.Errorf("error type asserting. %v", err)
 			}
+			az.SetDNSRegistration(azCreateFlagInfo.registerDNS)
+			if err = setLoadBalancerTargets(cloud, azCreateFlagInfo.backendPools); err != nil {
+				return err
+			}
+			if err = setComputerName(cloud, azCreateFlagInfo.computerName); err != nil {
+				return err
+			}
 			// TODO: Use the Windows VM object to get password, user name etc here.
 			_, err = cloud.CreateWindowsVM()
 			if err != nil {
@@ -142,6 +155,14 @@ func azCreateCmd() *cobra.Command {
 	// one even though we explicitly give `""`.
 	cmd.PersistentFlags().StringVar(&azCreateFlagInfo.nicName, "nicName", "",
 		"nic resource name for the node")
+
+	cmd.PersistentFlags().BoolVar(&azCreateFlagInfo.registerDNS, "register-dns", false,
+		"register the instance in the private DNS zone of the cluster as <instance name>.<cluster domain>")
+	cmd.PersistentFlags().StringVar(&azCreateFlagInfo.computerName, "computer-name", "",
+		"Windows computer name of the instance, at most 15 characters. Defaults to the instance name")
+	cmd.PersistentFlags().StringSliceVar(&azCreateFlagInfo.backendPools, "backend-pool", nil,
+		"comma separated IDs of existing load balancer backend pools of the resource group of the cluster to add "+
+			"the NIC of the instance to. The NIC leaves them when the instance is destroyed")
 	return cmd
 }
 
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/client"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// flagSource is a flag that can be set from a profile or an environment variable
+type flagSource struct {
+	// flag is the name of the flag
+	flag string
+	// envVar is the environment variable the flag is set from, if any
+	envVar string
+	// value returns the value of the flag in the profile
+	value func(config.Profile) string
+}
+
+// flagSources lists the flags that can be set from a profile or an environment variable. The environment variables
+// are the ones used by the e2e test framework.
+var flagSources = []flagSource{
+	{"kubeconfig", "KUBECONFIG", func(p config.Profile) string { return p.Kubeconfig }},
+	{"dir", "ARTIFACT_DIR", func(p config.Profile) string { return p.ArtifactDir }},
+	{"credentials", "", func(p config.Profile) string { return p.Credentials }},
+	{"credential-account", "", func(p config.Profile) string { return p.CredentialAccount }},
+	{"region", "", func(p config.Profile) string { return p.Region }},
+	{"image-id", "", func(p config.Profile) string { return p.ImageID }},
+	{"instance-type", "", func(p config.Profile) string { return p.InstanceType }},
+	{"ssh-key", "", func(p config.Profile) string { return p.SSHKey }},
+	{"private-key", "KUBE_SSH_KEY_PATH", func(p config.Profile) string { return p.PrivateKey }},
+	{"network", "", func(p config.Profile) string { return p.Network }},
+	{"register-dns", "", func(p config.Profile) string {
+		if p.RegisterDNS {
+			return "true"
+		}
+		return ""
+	}},
+	{"computer-name", "", func(p config.Profile) string { return p.ComputerName }},
+}
+
+// applyProfile sets the flags of the given command that were not given from the selected profile of the configuration
+// file, or else from their environment variable. A selected profile takes precedence over the environment variables,
+// so that the cluster of an unrelated KUBECONFIG is not used by mistake.
+func applyProfile(cmd *cobra.Command) error {
+	cfg, err := config.Load(config.ExpandHome(rootInfo.configPath))
+	if err != nil {
+		return err
+	}
+	profile, err := cfg.Profile(rootInfo.profile)
+	if err != nil {
+		return err
+	}
+	if cloud := commandCloud(cmd); profile.Cloud != "" && cloud != "" && profile.Cloud != cloud {
+		return fmt.Errorf("the selected profile is for %s and cannot be used with %s", profile.Cloud, cloud)
+	}
+
+	flags := cmd.Flags()
+	for _, source := range flagSources {
+		flag := flags.Lookup(source.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		value := config.ExpandHome(source.value(profile))
+		if value == "" && source.envVar != "" {
+			value = os.Getenv(source.envVar)
+		}
+		if value == "" {
+			continue
+		}
+		if err = flags.Set(source.flag, value); err != nil {
+			return fmt.Errorf("invalid value %s for --%s: %v", value, source.flag, err)
+		}
+	}
+	return nil
+}
+
+// commandCloud returns the cloud provider of the given command, which is the name of its ancestor directly under the
+// root command, or an empty string for the commands that are not specific to a cloud provider
+func commandCloud(cmd *cobra.Command) string {
+	for ; cmd.HasParent(); cmd = cmd.Parent() {
+		if !cmd.Parent().HasParent() {
+			return cmd.Name()
+		}
+	}
+	return ""
+}
+
+// validateRegion returns an error if the given command has a region and the AWS cluster of the kubeconfig is in another
+// region, which indicates that the kubeconfig of the wrong cluster is used
+func validateRegion(cmd *cobra.Command) error {
+	flag := cmd.Flags().Lookup("region")
+	if flag == nil || flag.Value.String() == "" || rootInfo.kubeconfigPath == "" {
+		return nil
+	}
+	region := flag.Value.String()
+	oc, err := client.GetOpenShift(config.ExpandHome(rootInfo.kubeconfigPath))
+	if err != nil {
+		return err
+	}
+	provider, err := oc.GetCloudProvider()
+	if err != nil {
+		return err
+	}
+	if provider.AWS == nil {
+		return fmt.Errorf("the cluster is not running on AWS")
+	}
+	if provider.AWS.Region != region {
+		return fmt.Errorf("the cluster is in region %s, not %s", provider.AWS.Region, region)
+	}
+	return nil
+}
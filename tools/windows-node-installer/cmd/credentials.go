@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/credentials"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(convertCredentialsCmd())
+}
+
+// convertCredentialsCmd defines `convert-credentials` command and converts the credentials of Windows hosts between
+// Kubernetes Secrets, Ansible inventories and byoh inventories, or records them in 'windows-node-installer.json' file.
+func convertCredentialsCmd() *cobra.Command {
+	var from, to, input, output string
+	cmd := &cobra.Command{
+		Use:   "convert-credentials",
+		Short: "Convert the credentials of Windows hosts between the state file, Secrets and inventory formats.",
+		Long: "Convert the credentials of Windows hosts read from --input, the standard input by default, from the " +
+			"--from format to the --to format, written to --output, the standard output by default. The formats " +
+			"are secret, a List of Kubernetes Secrets, ansible, an Ansible INI inventory, byoh, the inventory of " +
+			"existing hosts of the e2e tests, and state, which records the instance IDs of the hosts in the " +
+			"windows-node-installer.json file of the current or specified directory. The credentials of the " +
+			"state file are exported with `wni aws export-credentials`.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			for _, flag := range []string{"from", "to"} {
+				if err := cmd.MarkPersistentFlagRequired(flag); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			fromFormat, err := credentials.ParseFormat(from)
+			if err != nil {
+				return err
+			}
+			if fromFormat == credentials.FormatState {
+				return fmt.Errorf("the credentials of the state file are looked up on the cloud provider, use " +
+					"`wni aws export-credentials`")
+			}
+			toFormat, err := credentials.ParseFormat(to)
+			if err != nil {
+				return err
+			}
+
+			in := io.Reader(os.Stdin)
+			if input != "" {
+				inFile, err := os.Open(input)
+				if err != nil {
+					return fmt.Errorf("could not open %s, %v", input, err)
+				}
+				defer inFile.Close()
+				in = inFile
+			}
+			hosts, err := credentials.Read(in, fromFormat)
+			if err != nil {
+				return fmt.Errorf("could not read the credentials, %v", err)
+			}
+
+			if toFormat == credentials.FormatState {
+				instanceIDs, err := credentials.InstanceIDs(hosts)
+				if err != nil {
+					return err
+				}
+				filePath, err := resource.MakeFilePath(rootInfo.resourceTrackerDir)
+				if err != nil {
+					return fmt.Errorf("error creating resource tracker file path, %v", err)
+				}
+				if err = resource.AppendInstallerInfo(instanceIDs, nil, filePath); err != nil {
+					return fmt.Errorf("error recording the instances in %s, %v", filePath, err)
+				}
+				log.Printf("%d instances recorded in %s", len(instanceIDs), filePath)
+				return nil
+			}
+			return writeCredentials(hosts, toFormat, output)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&from, "from", "", "format the credentials are read in: secret, ansible or byoh")
+	cmd.PersistentFlags().StringVar(&to, "to", "",
+		"format the credentials are written in: secret, ansible, byoh or state")
+	cmd.PersistentFlags().StringVar(&input, "input", "", "file the credentials are read from, stdin if not given")
+	cmd.PersistentFlags().StringVar(&output, "output", "",
+		"file the credentials are written to, stdout if not given")
+	return cmd
+}
+
+// writeCredentials writes the given hosts in the given format to the given file, or to stdout if it is empty, and
+// logs the fields the format cannot hold
+func writeCredentials(hosts []credentials.Host, format credentials.Format, output string) error {
+	out := io.Writer(os.Stdout)
+	if output != "" {
+		// The credentials are only readable by the user
+		outFile, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("could not create %s, %v", output, err)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	warnings, err := credentials.Write(out, hosts, format)
+	if err != nil {
+		return fmt.Errorf("could not write the credentials, %v", err)
+	}
+	for _, warning := range warnings {
+		log.Printf("warning: %s", warning)
+	}
+	return nil
+}
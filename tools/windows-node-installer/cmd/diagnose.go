@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/diagnose"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func init() {
+	rootCmd.AddCommand(diagnoseCmd())
+}
+
+// diagnoseCmd defines `diagnose` command and runs the preflight checks and collects the diagnostics bundle on an
+// existing node without making any change to it.
+func diagnoseCmd() *cobra.Command {
+	var node, user, password, output string
+	var cis bool
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Diagnose an existing Windows node without making any change to it.",
+		Long: "Connect to an existing Windows node over WinRM with the given credentials, run the preflight checks " +
+			"of WMCB and collect the diagnostics bundle of the e2e tests, i.e. the hotfixes, network adapters, HNS " +
+			"networks and kubelet log, and write them as a JSON report. With --cis, the controls of the CIS Windows " +
+			"Server benchmark relevant to container hosts are checked too, and reported without failing the " +
+			"command. Only queries are run on the node, so it can " +
+			"be used against production nodes. The node is given by name, which requires --kubeconfig to look up " +
+			"its address, or by IP address. The command fails if a check failed.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("node")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if password == "" {
+				return fmt.Errorf("the password of the node is required, use --password or %s",
+					diagnose.PasswordEnvVar)
+			}
+			var kubeClient kubernetes.Interface
+			if rootInfo.kubeconfigPath != "" {
+				restConfig, err := clientcmd.BuildConfigFromFlags("", config.ExpandHome(rootInfo.kubeconfigPath))
+				if err != nil {
+					return fmt.Errorf("unable to build config from kubeconfig %s, %v", rootInfo.kubeconfigPath, err)
+				}
+				if kubeClient, err = kubernetes.NewForConfig(restConfig); err != nil {
+					return fmt.Errorf("unable to create kube client, %v", err)
+				}
+			}
+			nodeName, address, err := diagnose.NodeAddress(kubeClient, node)
+			if err != nil {
+				return err
+			}
+
+			vm := &types.Windows{Credentials: types.NewCredentials("", address, password, user)}
+			if err = vm.SetupWinRMClient(); err != nil {
+				return fmt.Errorf("error connecting to node %s at %s, %v", nodeName, address, err)
+			}
+			log.Printf("diagnosing node %s at %s", nodeName, address)
+			report := diagnose.Run(vm, nodeName, address)
+			if cis {
+				diagnose.CheckBenchmark(vm, report)
+			}
+
+			if output == "" {
+				output = filepath.Join(rootInfo.resourceTrackerDir, "diagnose-"+nodeName+".json")
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("could not create report %s, %v", output, err)
+			}
+			defer file.Close()
+			if err = report.WriteJSON(file); err != nil {
+				return fmt.Errorf("could not write report %s, %v", output, err)
+			}
+			if err = report.WriteSummary(os.Stdout); err != nil {
+				return err
+			}
+			log.Printf("report written to %s", output)
+			if report.Failed() {
+				return fmt.Errorf("checks of node %s failed", nodeName)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&node, "node", "",
+		"name or IP address of the node to diagnose (required)")
+	cmd.PersistentFlags().StringVar(&user, "user", "Administrator",
+		"name of the user to connect to the node as")
+	cmd.PersistentFlags().StringVar(&password, "password", os.Getenv(diagnose.PasswordEnvVar),
+		"password of the user, defaults to "+diagnose.PasswordEnvVar)
+	cmd.PersistentFlags().StringVar(&output, "output", "",
+		"file to write the report to, 'diagnose-<node>.json' in the current or specified directory if not given")
+	cmd.PersistentFlags().BoolVar(&cis, "cis", false,
+		"also check the controls of the "+diagnose.Benchmark+" relevant to container hosts")
+	return cmd
+}
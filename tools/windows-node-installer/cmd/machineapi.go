@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/machineapi"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// machineAPIInfo contains information for creating Windows instances through the machine API
+var machineAPIInfo struct {
+	// imageID is the image of the created instance
+	imageID string
+	// instanceType is the flavor of the created instance
+	instanceType string
+}
+
+func init() {
+	machineAPICmd := &cobra.Command{
+		Use:   "machine-api",
+		Short: "Create and destroy windows instances through the machine API of the cluster",
+	}
+	rootCmd.AddCommand(machineAPICmd)
+	machineAPICmd.AddCommand(machineAPICreateCmd())
+	machineAPICmd.AddCommand(machineAPIDestroyCmd())
+}
+
+// newMachineAPICloud returns the provider creating the instances through the machine API of the cluster of the
+// kubeconfig
+func newMachineAPICloud() (*machineapi.Provider, error) {
+	if rootInfo.kubeconfigPath == "" {
+		return nil, fmt.Errorf("--kubeconfig is required")
+	}
+	return machineapi.New(config.ExpandHome(rootInfo.kubeconfigPath), rootInfo.resourceTrackerDir,
+		machineAPIInfo.imageID, machineAPIInfo.instanceType)
+}
+
+// machineAPICreateCmd defines `create` command and creates a Windows instance by creating a Windows machine set in the
+// cluster
+func machineAPICreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a Windows instance through the machine API of the existing OpenShift cluster.",
+		Long: "creates a machine set of one Windows machine, copied from a Linux worker machine set of the cluster " +
+			"with the given image and a generated user data secret, and waits for the machine API to create its " +
+			"instance. The credentials of the instance are read from the user data secret. The instance is reached " +
+			"through its internal IP, so the command has to run in the network of the cluster.",
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.MarkPersistentFlagRequired("image-id")
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cloud, err := newMachineAPICloud()
+			if err != nil {
+				return fmt.Errorf("error creating machine API clients, %v", err)
+			}
+			vm, err := cloud.CreateWindowsVM()
+			if err != nil {
+				return fmt.Errorf("error creating Windows Instance, %v", err)
+			}
+			log.Printf("instance %s is reachable at %s", vm.GetCredentials().GetInstanceId(),
+				vm.GetCredentials().GetIPAddress())
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&machineAPIInfo.imageID, "image-id", "",
+		"image of the instance, e.g. the ID of a Windows Server AMI on AWS (required)")
+	cmd.PersistentFlags().StringVar(&machineAPIInfo.instanceType, "instance-type", "",
+		"name of a type of instance, e.g. m5a.large on AWS. Defaults to the one of the copied machine set")
+	return cmd
+}
+
+// machineAPIDestroyCmd defines `destroy` command and deletes the machine sets recorded next to the
+// 'windows-node-installer.json' file along with their instances
+func machineAPIDestroyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "destroy",
+		Short: "Destroy the Windows machine sets recorded in the current or specified directory.",
+		Long: "Delete the machine sets created by the create command, which are recorded in the current or " +
+			"specified directory, wait for the machine API to delete their instances, and delete their user data " +
+			"secrets.",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cloud, err := newMachineAPICloud()
+			if err != nil {
+				return fmt.Errorf("error creating machine API clients, %v", err)
+			}
+			if err = cloud.DestroyWindowsVMs(); err != nil {
+				return fmt.Errorf("error destroying Windows instance, %v", err)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/replay"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(replayCmd())
+}
+
+// replayCmd defines `replay` command and renders a session recording of the e2e tests, interactively or as markdown.
+func replayCmd() *cobra.Command {
+	var markdown, failed bool
+	var output string
+	cmd := &cobra.Command{
+		Use:   "replay <session.jsonl>",
+		Short: "Render a session recording of the e2e tests.",
+		Long: "Render a session recording written by the e2e tests to the sessions directory of ARTIFACT_DIR, i.e. " +
+			"the commands run on a Windows VM with their start, duration, exit code and outputs, to audit what a CI " +
+			"run did on the node. The commands are shown one at a time, pressing Enter for the next one, or all at " +
+			"once when the standard input is not a terminal. With --markdown, the session is written as a markdown " +
+			"document to --output, the standard output by default.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("could not open session %s, %v", args[0], err)
+			}
+			defer file.Close()
+			entries, err := replay.Read(file)
+			if err != nil {
+				return fmt.Errorf("could not read session %s, %v", args[0], err)
+			}
+			if failed {
+				entries = replay.Failed(entries)
+			}
+
+			if !markdown {
+				var in io.Reader
+				if isTerminal(os.Stdin) {
+					in = os.Stdin
+				}
+				return replay.Play(in, os.Stdout, entries)
+			}
+			out := io.Writer(os.Stdout)
+			if output != "" {
+				outFile, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("could not create %s, %v", output, err)
+				}
+				defer outFile.Close()
+				out = outFile
+			}
+			if err = replay.WriteMarkdown(out, entries); err != nil {
+				return fmt.Errorf("could not write the session, %v", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().BoolVar(&markdown, "markdown", false,
+		"write the session as a markdown document instead of showing it interactively")
+	cmd.PersistentFlags().BoolVar(&failed, "failed", false,
+		"only render the commands which failed or exited with a non-zero code")
+	cmd.PersistentFlags().StringVar(&output, "output", "",
+		"file to write the markdown document to, the standard output if not given")
+	return cmd
+}
+
+// isTerminal returns true if the given file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
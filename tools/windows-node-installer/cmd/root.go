@@ -2,9 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/config"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -14,7 +20,27 @@ var (
 		credentialPath      string
 		credentialAccountID string
 		resourceTrackerDir  string
+		// otlpEndpoint is the OTLP/HTTP endpoint the spans are exported to
+		otlpEndpoint string
+		// traceFile is the file the spans are written to as JSON
+		traceFile string
+		// configPath is the location of the configuration file holding the profiles
+		configPath string
+		// profile is the name of the profile the flags that are not given are set from
+		profile string
+		// progressOutput is the file the progress events are written to as JSON lines, - for stdout
+		progressOutput string
+		// runContext is the context of the test run WNI is invoked by
+		runContext string
 	}
+	// runContext is the parsed context of the test run, attached to the log lines, progress events and spans
+	runContext runcontext.Context
+	// closeProgressOutput closes the file the progress events are written to
+	closeProgressOutput = func() {}
+	// shutdownTracing flushes the spans of the command being run
+	shutdownTracing = func() error { return nil }
+	// rootSpan is the span covering the command being run
+	rootSpan trace.Span
 	// rootCmd contains the wni root command for the Windows Node Installer
 	rootCmd = &cobra.Command{
 		Use:   "wni",
@@ -22,6 +48,21 @@ var (
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return validateRootFlags(cmd)
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyProfile(cmd); err != nil {
+				return err
+			}
+			if err := validateRegion(cmd); err != nil {
+				return err
+			}
+			if err := setupRunContext(); err != nil {
+				return err
+			}
+			if err := setupProgress(); err != nil {
+				return err
+			}
+			return setupTracing(cmd)
+		},
 	}
 )
 
@@ -33,6 +74,74 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&rootInfo.resourceTrackerDir, "dir", ".",
 		"directory to save or read windows-node-installer.json file from")
+
+	configPath := os.Getenv(config.ConfigEnvVar)
+	if configPath == "" {
+		configPath = config.DefaultPath()
+	}
+	rootCmd.PersistentFlags().StringVar(&rootInfo.configPath, "config", configPath,
+		"file path to the configuration file holding the profiles. Defaults to "+config.ConfigEnvVar+" or "+
+			"~/.wni/config.yaml")
+	rootCmd.PersistentFlags().StringVar(&rootInfo.profile, "profile", os.Getenv(config.ProfileEnvVar),
+		"name of the profile of the configuration file to set the flags that are not given from. Defaults to "+
+			config.ProfileEnvVar+" or the default profile of the configuration file")
+
+	rootCmd.PersistentFlags().StringVar(&rootInfo.otlpEndpoint, "otlp-endpoint", os.Getenv(tracing.EndpointEnvVar),
+		"OTLP/HTTP endpoint to export the trace spans to, e.g. http://localhost:4318. Defaults to "+
+			tracing.EndpointEnvVar)
+	rootCmd.PersistentFlags().StringVar(&rootInfo.traceFile, "trace-file", "",
+		"file to append the trace spans to as JSON")
+	rootCmd.PersistentFlags().StringVar(&rootInfo.progressOutput, "progress-output", "",
+		"file to write the progress events of the long-running operations to as JSON lines, - for stdout")
+	rootCmd.PersistentFlags().StringVar(&rootInfo.runContext, "run-context", os.Getenv(runcontext.EnvVar),
+		"context of the test run, as run=<ID>,cluster=<ID>,build=<build>,provider=<name>, to attach to the log lines, "+
+			"progress events and trace spans. Defaults to "+runcontext.EnvVar)
+}
+
+// setupRunContext attaches the run context, if any, to the log lines and the progress events
+func setupRunContext() error {
+	var err error
+	if runContext, err = runcontext.Parse(rootInfo.runContext); err != nil {
+		return err
+	}
+	if !runContext.Empty() {
+		log.SetPrefix("[" + runContext.String() + "] ")
+	}
+	progress.SetRunContext(runContext.String())
+	return nil
+}
+
+// setupProgress writes the progress events to the progress output, if any
+func setupProgress() error {
+	switch rootInfo.progressOutput {
+	case "":
+		return nil
+	case "-":
+		progress.SetReporter(progress.NewWriterReporter(os.Stdout))
+		return nil
+	}
+	file, err := os.Create(rootInfo.progressOutput)
+	if err != nil {
+		return fmt.Errorf("could not create progress output %s: %v", rootInfo.progressOutput, err)
+	}
+	progress.SetReporter(progress.NewWriterReporter(file))
+	closeProgressOutput = func() {
+		progress.SetReporter(nil)
+		file.Close()
+	}
+	return nil
+}
+
+// setupTracing configures the export of the trace spans, which carry the run context, and starts the span covering the
+// given command
+func setupTracing(cmd *cobra.Command) error {
+	shutdown, err := tracing.Setup("wni", rootInfo.otlpEndpoint, rootInfo.traceFile, runContext.Attributes()...)
+	if err != nil {
+		return err
+	}
+	shutdownTracing = shutdown
+	rootSpan = tracing.StartRoot(cmd.CommandPath())
+	return nil
 }
 
 // validateRootFlags defines required flags for rootCmd
@@ -46,7 +155,15 @@ func validateRootFlags(rootCmd *cobra.Command) error {
 
 // Execute run the actual wmi command
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if rootSpan != nil {
+		tracing.End(rootSpan, err)
+	}
+	if shutdownErr := shutdownTracing(); shutdownErr != nil {
+		fmt.Println(shutdownErr)
+	}
+	closeProgressOutput()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
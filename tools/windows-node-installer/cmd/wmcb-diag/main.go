@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/diagnose"
+)
+
+// main is the entry point for wmcb-diag, which runs the preflight checks and collects the diagnostics bundle on the
+// Windows node it runs on, without cluster access, so that support engineers can diagnose a node they are logged on.
+func main() {
+	output := flag.String("output", "", "file to write the report to, 'diagnose-<node>.json' in the current "+
+		"directory if not given")
+	cis := flag.Bool("cis", false, "also check the controls of the "+diagnose.Benchmark+" relevant to "+
+		"container hosts")
+	flag.Parse()
+
+	if err := run(*output, *cis); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run diagnoses the node, writing the report to the given file and the results of the checks to stdout, along with the
+// controls of the CIS benchmark if cis is set. It returns an error if a check failed.
+func run(output string, cis bool) error {
+	report, err := diagnose.RunLocal(diagnose.LocalRunner{})
+	if err != nil {
+		return err
+	}
+	if cis {
+		diagnose.CheckBenchmark(diagnose.LocalRunner{}, report)
+	}
+	if output == "" {
+		output = "diagnose-" + report.Node + ".json"
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("could not create report %s, %v", output, err)
+	}
+	defer file.Close()
+	if err = report.WriteJSON(file); err != nil {
+		return fmt.Errorf("could not write report %s, %v", output, err)
+	}
+	if err = report.WriteSummary(os.Stdout); err != nil {
+		return err
+	}
+	log.Printf("report written to %s", output)
+	if report.Failed() {
+		return fmt.Errorf("checks of node %s failed", report.Node)
+	}
+	return nil
+}
@@ -5,6 +5,9 @@ go 1.12
 replace (
 	github.com/openshift/api => github.com/openshift/api v0.0.0-20200205145930-e9d93e317dd1 // OpenShift 4.3
 	github.com/openshift/client-go => github.com/openshift/client-go v0.0.0-20191125132246-f6563a70e19a // OpenShift 4.3
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll => ../../pkg/poll
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext => ../../pkg/runcontext
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing => ../../pkg/tracing
 	k8s.io/api => k8s.io/api v0.16.7
 	k8s.io/apimachinery => k8s.io/apimachinery v0.16.7
 	k8s.io/client-go => k8s.io/client-go v0.16.7
@@ -16,18 +19,28 @@ require (
 	github.com/Azure/go-autorest/autorest/azure/auth v0.4.0
 	github.com/Azure/go-autorest/autorest/to v0.3.0
 	github.com/Azure/go-autorest/autorest/validation v0.2.0 // indirect
-	github.com/aws/aws-sdk-go v1.23.2
+	github.com/aws/aws-sdk-go v1.25.38
 	github.com/coreos/etcd v3.3.10+incompatible
 	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e // indirect
 	github.com/coreos/pkg v0.0.0-20180928190104-399ea9e2e55f // indirect
 	github.com/masterzen/winrm v0.0.0-20190308153735-1d17eaf15943
-	github.com/openshift/api v0.0.0-00010101000000-000000000000
-	github.com/openshift/client-go v0.0.0-00010101000000-000000000000
+	github.com/openshift/api v0.0.0-20200205145930-e9d93e317dd1
+	github.com/openshift/client-go v0.0.0-20191125132246-f6563a70e19a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/poll v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext v0.0.0-20261017032934-936b0ff8372a
+	github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing v0.0.0-20261017032934-936b0ff8372a
 	github.com/pkg/sftp v1.11.0
 	github.com/spf13/cobra v0.0.5
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
-	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553 // indirect
-	k8s.io/apimachinery v0.17.3
-	k8s.io/client-go v0.0.0-00010101000000-000000000000
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	k8s.io/api v0.16.7
+	k8s.io/apimachinery v0.16.7
+	k8s.io/client-go v0.16.7
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,446 @@
+package bootstrap
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	certificates "k8s.io/api/certificates/v1beta1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+/*
+	bootstrap runs WMCB end to end on a Windows instance: it copies the WMCB payload and the root CA of the cluster to
+	the instance, runs `wmcb.exe initialize-kubelet`, which fetches the worker ignition file from the Machine Config
+	Server, approves the CSRs of the node and waits for it to join the cluster. This is the happy path of the e2e tests as a user facing operation.
+*/
+
+const (
+	// remoteDir is the directory of the instance the payload is copied to
+	remoteDir = "C:\\Windows\\Temp\\wni"
+	// machineConfigServerPort is the port the Machine Config Server serves the ignition files on
+	machineConfigServerPort = "22623"
+	// rootCANamespace and rootCAConfigMap are the ConfigMap holding the root CA of the cluster, which signed the
+	// serving certificate of the Machine Config Server
+	rootCANamespace, rootCAConfigMap = "kube-system", "root-ca"
+	// rootCAKey is the key of the root CA in its ConfigMap
+	rootCAKey = "ca.crt"
+	// ignitionCAFile is the name of the file of the instance the root CA of the cluster is copied to
+	ignitionCAFile = "ignition-ca.crt"
+	// bootstrapCSRRequestor is the user requesting the client certificate of a new node
+	bootstrapCSRRequestor = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+	// nodeUserPrefix is the prefix of the user name of a node, followed by the node name
+	nodeUserPrefix = "system:node:"
+	// successMessage is logged by WMCB once initialize-kubelet completed
+	successMessage = "Bootstrapping completed successfully"
+	// pollInterval is the interval at which the CSRs and the node are checked
+	pollInterval = 10 * time.Second
+	// imdsv1ProbeCmd prints whether the instance metadata service of an AWS instance answers the IMDSv1 requests
+	// without session token, which the kubelet cloud provider of the older Kubernetes versions makes
+	imdsv1ProbeCmd = "try { Invoke-RestMethod -UseBasicParsing -TimeoutSec 5 " +
+		"-Uri http://169.254.169.254/latest/meta-data/instance-id | Out-Null; 'true' } catch { 'false' }"
+)
+
+// Options configure the bootstrap of an instance
+type Options struct {
+	// WMCBPath is the local path of the wmcb.exe binary to run on the instance
+	WMCBPath string
+	// KubeletPath is the local path of the kubelet.exe binary to install. If empty, the kubelet of the Kubernetes
+	// version of the cluster is downloaded on the instance.
+	KubeletPath string
+	// NodeName is the name the node of the instance registers with. Only the CSRs of this node are approved.
+	NodeName string
+	// Timeout is how long to wait for the node to join the cluster once WMCB ran
+	Timeout time.Duration
+	// ContainerRuntime is the container runtime of the node, docker or containerd. If empty, WMCB uses the runtime
+	// installed on the instance.
+	ContainerRuntime string
+	// InsecureIgnition skips the verification of the certificate of the Machine Config Server, which is otherwise
+	// verified against the root CA of the cluster
+	InsecureIgnition bool
+}
+
+// Bootstrapper bootstraps an instance as a node of a cluster
+type Bootstrapper struct {
+	// vm is the instance being bootstrapped
+	vm types.WindowsVM
+	// kubeClient is the client of the cluster
+	kubeClient kubernetes.Interface
+	// configClient is the OpenShift config client of the cluster
+	configClient configclient.Interface
+	// options configure the bootstrap
+	options Options
+	// ignitionURL is the URL WMCB fetches the worker ignition file from
+	ignitionURL string
+}
+
+// New returns a Bootstrapper bootstrapping the given instance as a node of the cluster of the given kubeconfig
+func New(vm types.WindowsVM, kubeconfigPath string, options Options) (*Bootstrapper, error) {
+	if options.WMCBPath == "" {
+		return nil, fmt.Errorf("the path of wmcb.exe is required")
+	}
+	if options.NodeName == "" {
+		return nil, fmt.Errorf("the node name of the instance is required")
+	}
+	switch options.ContainerRuntime {
+	case "", "docker", "containerd":
+	default:
+		return nil, fmt.Errorf("unknown container runtime %s, expected docker or containerd", options.ContainerRuntime)
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build config from kubeconfig %s: %v", kubeconfigPath, err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kube client: %v", err)
+	}
+	configClient, err := configclient.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OpenShift config client: %v", err)
+	}
+	return &Bootstrapper{vm: vm, kubeClient: kubeClient, configClient: configClient, options: options}, nil
+}
+
+// Bootstrap copies the payload to the instance, runs WMCB on it and approves the CSRs of the node until it joined the
+// cluster
+func (b *Bootstrapper) Bootstrap() (err error) {
+	ctx := tracing.Context()
+	op := progress.Start("Bootstrap", 5)
+	defer func() { op.End(err) }()
+	if err = op.Phase(ctx, "copy payload", b.copyPayload); err != nil {
+		return fmt.Errorf("unable to copy the WMCB payload: %v", err)
+	}
+	if err = op.Phase(ctx, "get ignition", b.getIgnition); err != nil {
+		return fmt.Errorf("unable to get the worker ignition file: %v", err)
+	}
+	if err = op.Phase(ctx, "run WMCB", b.runWMCB); err != nil {
+		return err
+	}
+	if err = op.Phase(ctx, "wait for node", b.waitForNode); err != nil {
+		return fmt.Errorf("node %s did not join the cluster: %v", b.options.NodeName, err)
+	}
+	if err = op.Phase(ctx, "check cloud provider", b.checkCloudProvider); err != nil {
+		return err
+	}
+	log.Printf("node %s joined the cluster", b.options.NodeName)
+	return nil
+}
+
+// copyPayload copies wmcb.exe and the kubelet to the remote directory. The kubelet is downloaded on the instance if
+// no local kubelet is given.
+func (b *Bootstrapper) copyPayload() error {
+	log.Printf("copying %s to %s", b.options.WMCBPath, remoteDir)
+	if err := b.vm.CopyFile(b.options.WMCBPath, remoteDir); err != nil {
+		return err
+	}
+	if b.options.KubeletPath != "" {
+		log.Printf("copying %s to %s", b.options.KubeletPath, remoteDir)
+		return b.copyAs(b.options.KubeletPath, "kubelet.exe")
+	}
+
+	version, err := b.kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("unable to get the Kubernetes version of the cluster: %v", err)
+	}
+	architecture, err := b.architecture()
+	if err != nil {
+		return err
+	}
+	kubeletURL := kubeletURL(version.GitVersion, architecture)
+	log.Printf("downloading the kubelet from %s", kubeletURL)
+	_, stderr, err := b.vm.Run(downloadCmd(kubeletURL, remoteDir+"\\kube.tar.gz")+"; "+
+		"tar -xzf "+remoteDir+"\\kube.tar.gz -C "+remoteDir+"; "+
+		"Copy-Item -Force "+remoteDir+"\\kubernetes\\node\\bin\\kubelet.exe "+remoteDir+"\\kubelet.exe", true)
+	if err != nil {
+		return fmt.Errorf("unable to download the kubelet from %s: %v, %s", kubeletURL, err, stderr)
+	}
+	return nil
+}
+
+// copyAs copies the given local file to the remote directory with the given name
+func (b *Bootstrapper) copyAs(localPath, name string) error {
+	if err := b.vm.CopyFile(localPath, remoteDir); err != nil {
+		return err
+	}
+	if filepath.Base(localPath) == name {
+		return nil
+	}
+	_, stderr, err := b.vm.Run("Move-Item -Force "+remoteDir+"\\"+filepath.Base(localPath)+" "+remoteDir+"\\"+name,
+		true)
+	if err != nil {
+		return fmt.Errorf("unable to rename %s to %s: %v, %s", filepath.Base(localPath), name, err, stderr)
+	}
+	return nil
+}
+
+// architecture returns the architecture of the instance in the format used by the Kubernetes releases, e.g. amd64
+func (b *Bootstrapper) architecture() (string, error) {
+	// PROCESSOR_ARCHITECTURE in the process environment reports the emulated architecture for emulated processes, so
+	// the native architecture is read from the system environment
+	stdout, stderr, err := b.vm.Run("(Get-ItemProperty 'HKLM:\\SYSTEM\\CurrentControlSet\\Control\\Session "+
+		"Manager\\Environment').PROCESSOR_ARCHITECTURE", true)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the architecture of the instance: %v, %s", err, stderr)
+	}
+	return strings.ToLower(strings.TrimSpace(stdout)), nil
+}
+
+// getIgnition finds the worker ignition file served by the Machine Config Server, which WMCB fetches from the instance
+// as the server is only reachable from within the cluster network, and copies the root CA of the cluster the server
+// certificate is verified against to the instance
+func (b *Bootstrapper) getIgnition() error {
+	infra, err := b.configClient.ConfigV1().Infrastructures().Get("cluster", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get the cluster infrastructure: %v", err)
+	}
+	if b.ignitionURL, err = ignitionURL(infra.Status.APIServerInternalURL); err != nil {
+		return err
+	}
+	if b.options.InsecureIgnition {
+		log.Printf("the certificate of %s will not be verified", b.ignitionURL)
+		return nil
+	}
+	ca, err := clusterCA(b.kubeClient)
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "wni")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	caPath := filepath.Join(dir, ignitionCAFile)
+	if err = ioutil.WriteFile(caPath, ca, 0644); err != nil {
+		return fmt.Errorf("unable to write the root CA of the cluster: %v", err)
+	}
+	log.Printf("copying the root CA of the cluster to %s", remoteDir)
+	return b.vm.CopyFile(caPath, remoteDir)
+}
+
+// clusterCA returns the PEM root CA of the cluster, which signed the serving certificate of the Machine Config Server
+func clusterCA(kubeClient kubernetes.Interface) ([]byte, error) {
+	configMap, err := kubeClient.CoreV1().ConfigMaps(rootCANamespace).Get(rootCAConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the root CA of the cluster: %v", err)
+	}
+	ca := configMap.Data[rootCAKey]
+	if block, _ := pem.Decode([]byte(ca)); block == nil {
+		return nil, fmt.Errorf("no PEM certificate in %s of ConfigMap %s/%s", rootCAKey, rootCANamespace,
+			rootCAConfigMap)
+	}
+	return []byte(ca), nil
+}
+
+// runWMCB runs wmcb.exe initialize-kubelet on the instance
+func (b *Bootstrapper) runWMCB() error {
+	cmd := wmcbCommand(b.options, b.ignitionURL)
+	log.Printf("running %s", cmd)
+	stdout, stderr, err := b.vm.Run(cmd, false)
+	if err != nil {
+		return fmt.Errorf("error running WMCB: %v\n%s%s", err, stdout, stderr)
+	}
+	// WMCB logs to stderr
+	if !strings.Contains(stdout+stderr, successMessage) {
+		return fmt.Errorf("WMCB did not complete successfully:\n%s%s", stdout, stderr)
+	}
+	return nil
+}
+
+// wmcbCommand returns the wmcb.exe initialize-kubelet command bootstrapping the instance with the given options and
+// the worker ignition file fetched from the given URL
+func wmcbCommand(options Options, ignitionURL string) string {
+	cmd := remoteDir + "\\wmcb.exe initialize-kubelet --ignition-file " + remoteDir + "\\worker.ign --kubelet-path " +
+		remoteDir + "\\kubelet.exe --ignition-url " + ignitionURL
+	if options.InsecureIgnition {
+		cmd += " --insecure-ignition"
+	} else {
+		cmd += " --ignition-ca-file " + remoteDir + "\\" + ignitionCAFile
+	}
+	if options.ContainerRuntime != "" {
+		cmd += " --container-runtime " + options.ContainerRuntime
+	}
+	return cmd
+}
+
+// waitForNode approves the CSRs of the node until the node exists and its serving certificate was approved
+func (b *Bootstrapper) waitForNode() error {
+	log.Printf("waiting for node %s to join the cluster", b.options.NodeName)
+	return wait.PollImmediate(pollInterval, b.options.Timeout, b.approveCSRs)
+}
+
+// approveCSRs approves the pending CSRs of the node, and returns true once the node exists and the CSR of its serving
+// certificate was approved
+func (b *Bootstrapper) approveCSRs() (bool, error) {
+	csrs, err := b.kubeClient.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+	if err != nil {
+		log.Printf("unable to list CSRs: %v", err)
+		return false, nil
+	}
+	servingApproved := false
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		if !isNodeCSR(csr, b.options.NodeName) {
+			continue
+		}
+		if !isHandled(csr) {
+			if err = b.approve(csr.GetName()); err != nil {
+				log.Printf("unable to approve CSR %s: %v", csr.GetName(), err)
+				continue
+			}
+			log.Printf("approved CSR %s requested by %s", csr.GetName(), csr.Spec.Username)
+		} else if isDenied(csr) {
+			continue
+		}
+		if csr.Spec.Username == nodeUserPrefix+b.options.NodeName {
+			servingApproved = true
+		}
+	}
+
+	_, err = b.kubeClient.CoreV1().Nodes().Get(b.options.NodeName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Printf("unable to get node %s: %v", b.options.NodeName, err)
+		}
+		return false, nil
+	}
+	return servingApproved, nil
+}
+
+// checkCloudProvider returns an error if the kubelet cloud provider did not initialize the node, e.g. because it cannot
+// reach the instance metadata service once it is hardened. Clusters without cloud provider are not checked.
+func (b *Bootstrapper) checkCloudProvider() error {
+	infra, err := b.configClient.ConfigV1().Infrastructures().Get("cluster", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get the cluster infrastructure: %v", err)
+	}
+	node, err := b.kubeClient.CoreV1().Nodes().Get(b.options.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get node %s: %v", b.options.NodeName, err)
+	}
+	err = cloudProviderError(node, infra.Status.Platform)
+	if err == nil || infra.Status.Platform != configv1.AWSPlatformType {
+		return err
+	}
+	stdout, _, probeErr := b.vm.Run(imdsv1ProbeCmd, true)
+	if probeErr == nil && strings.TrimSpace(stdout) == "false" {
+		return fmt.Errorf("%v, the instance metadata service refuses IMDSv1 requests, which the kubelet cloud "+
+			"provider may still make", err)
+	}
+	return err
+}
+
+// cloudProviderError returns an error if the given node was not initialized by the kubelet cloud provider of the given
+// platform, which sets the provider ID of the node from the instance metadata
+func cloudProviderError(node *core.Node, platform configv1.PlatformType) error {
+	if platform == "" || platform == configv1.NonePlatformType {
+		return nil
+	}
+	if node.Spec.ProviderID == "" {
+		return fmt.Errorf("the %s cloud provider of the kubelet did not initialize node %s, it has no provider ID",
+			platform, node.GetName())
+	}
+	return nil
+}
+
+// approve approves the CSR with the given name
+func (b *Bootstrapper) approve(name string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		csr, err := b.kubeClient.CertificatesV1beta1().CertificateSigningRequests().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if isHandled(csr) {
+			return nil
+		}
+		csr.Status.Conditions = append(csr.Status.Conditions, certificates.CertificateSigningRequestCondition{
+			Type:           certificates.CertificateApproved,
+			Reason:         "WNIBootstrapApprove",
+			Message:        "This CSR was approved by wni bootstrap",
+			LastUpdateTime: metav1.Now(),
+		})
+		_, err = b.kubeClient.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(csr)
+		return err
+	})
+}
+
+// isNodeCSR returns true if the CSR was requested by the node bootstrapper or by the given node itself, and is for a
+// certificate of the given node. CSRs of other nodes are left alone.
+func isNodeCSR(csr *certificates.CertificateSigningRequest, nodeName string) bool {
+	if csr.Spec.Username != bootstrapCSRRequestor && csr.Spec.Username != nodeUserPrefix+nodeName {
+		return false
+	}
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return false
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return false
+	}
+	return request.Subject.CommonName == nodeUserPrefix+nodeName
+}
+
+// isHandled returns true if the CSR has been approved or denied
+func isHandled(csr *certificates.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == certificates.CertificateApproved || c.Type == certificates.CertificateDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// isDenied returns true if the CSR has been denied
+func isDenied(csr *certificates.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == certificates.CertificateDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// ignitionURL returns the URL of the worker ignition file served by the Machine Config Server, on the host of the
+// internal API server URL
+func ignitionURL(apiServerInternalURL string) (string, error) {
+	u, err := url.Parse(apiServerInternalURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid internal API server URL %q", apiServerInternalURL)
+	}
+	return "https://" + net.JoinHostPort(u.Hostname(), machineConfigServerPort) + "/config/worker", nil
+}
+
+// kubeletURL returns the URL of the Kubernetes node binaries release for the given server version, e.g.
+// v1.17.1+1aa1c48 on OpenShift, and architecture
+func kubeletURL(gitVersion, architecture string) string {
+	// The OpenShift build metadata is not part of the upstream release
+	version := strings.SplitN(gitVersion, "+", 2)[0]
+	return fmt.Sprintf("https://dl.k8s.io/%s/kubernetes-node-windows-%s.tar.gz", version, architecture)
+}
+
+// downloadCmd returns the PowerShell command downloading the given URL to the given remote file
+func downloadCmd(url, dest string) string {
+	return "$ProgressPreference = 'SilentlyContinue'; " +
+		"[Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12; " +
+		"Invoke-WebRequest -UseBasicParsing -Uri '" + url + "' -OutFile " + dest
+}
@@ -0,0 +1,157 @@
+package bootstrap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const nodeName = "ip-10-0-1-2.us-east-2.compute.internal"
+
+// newCSR returns a CSR with the given name, requested by the given user for a certificate with the given common name
+func newCSR(t *testing.T, name, username, commonName string) *certificates.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader,
+		&x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	require.NoError(t, err)
+	return &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: username,
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+		},
+	}
+}
+
+// TestIsNodeCSR tests that only the CSRs of the given node are matched
+func TestIsNodeCSR(t *testing.T) {
+	tests := []struct {
+		name     string
+		csr      *certificates.CertificateSigningRequest
+		expected bool
+	}{
+		{"client CSR", newCSR(t, "csr", bootstrapCSRRequestor, nodeUserPrefix+nodeName), true},
+		{"serving CSR", newCSR(t, "csr", nodeUserPrefix+nodeName, nodeUserPrefix+nodeName), true},
+		{"client CSR of another node", newCSR(t, "csr", bootstrapCSRRequestor, nodeUserPrefix+"other"), false},
+		{"serving CSR of another node", newCSR(t, "csr", nodeUserPrefix+"other", nodeUserPrefix+nodeName), false},
+		{"other requestor", newCSR(t, "csr", "kube:admin", nodeUserPrefix+nodeName), false},
+		{"invalid request", &certificates.CertificateSigningRequest{
+			Spec: certificates.CertificateSigningRequestSpec{Username: bootstrapCSRRequestor, Request: []byte("csr")},
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isNodeCSR(test.csr, nodeName))
+		})
+	}
+}
+
+// TestApproveCSRs tests that the CSRs of the node are approved until the node joined the cluster
+func TestApproveCSRs(t *testing.T) {
+	client := newCSR(t, "client", bootstrapCSRRequestor, nodeUserPrefix+nodeName)
+	other := newCSR(t, "other", bootstrapCSRRequestor, nodeUserPrefix+"other")
+	kubeClient := fake.NewSimpleClientset(client, other)
+	b := &Bootstrapper{kubeClient: kubeClient, options: Options{NodeName: nodeName}}
+	csrs := kubeClient.CertificatesV1beta1().CertificateSigningRequests()
+
+	// The client CSR is approved, but the node did not join yet
+	done, err := b.approveCSRs()
+	require.NoError(t, err)
+	assert.False(t, done)
+	approved, err := csrs.Get("client", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, isHandled(approved))
+	untouched, err := csrs.Get("other", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, isHandled(untouched))
+
+	// The node joined, but its serving CSR is not approved yet
+	_, err = kubeClient.CoreV1().Nodes().Create(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}})
+	require.NoError(t, err)
+	_, err = csrs.Create(newCSR(t, "serving", nodeUserPrefix+nodeName, nodeUserPrefix+nodeName))
+	require.NoError(t, err)
+	done, err = b.approveCSRs()
+	require.NoError(t, err)
+	assert.True(t, done)
+	approved, err = csrs.Get("serving", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, isHandled(approved))
+}
+
+// TestIgnitionURL tests that the ignition file is served on the host of the internal API server URL
+func TestIgnitionURL(t *testing.T) {
+	url, err := ignitionURL("https://api-int.cluster.example.com:6443")
+	require.NoError(t, err)
+	assert.Equal(t, "https://api-int.cluster.example.com:22623/config/worker", url)
+
+	_, err = ignitionURL("")
+	assert.Error(t, err)
+}
+
+// TestKubeletURL tests that the OpenShift build metadata is removed from the server version
+func TestKubeletURL(t *testing.T) {
+	assert.Equal(t, "https://dl.k8s.io/v1.17.1/kubernetes-node-windows-amd64.tar.gz",
+		kubeletURL("v1.17.1+1aa1c48", "amd64"))
+	assert.Equal(t, "https://dl.k8s.io/v1.18.3/kubernetes-node-windows-amd64.tar.gz",
+		kubeletURL("v1.18.3", "amd64"))
+}
+
+// TestWMCBCommand tests that the container runtime is only given to WMCB when selected, and that the ignition server
+// certificate is verified against the cluster CA unless the verification is skipped
+func TestWMCBCommand(t *testing.T) {
+	const ignitionURL = "https://api-int.cluster.example.com:22623/config/worker"
+	assert.NotContains(t, wmcbCommand(Options{}, ignitionURL), "--container-runtime")
+	assert.True(t, strings.HasSuffix(wmcbCommand(Options{ContainerRuntime: "containerd"}, ignitionURL),
+		" --container-runtime containerd"))
+
+	cmd := wmcbCommand(Options{}, ignitionURL)
+	assert.Contains(t, cmd, "--ignition-url "+ignitionURL)
+	assert.Contains(t, cmd, "--ignition-ca-file "+remoteDir+"\\"+ignitionCAFile)
+	assert.NotContains(t, cmd, "--insecure-ignition")
+	cmd = wmcbCommand(Options{InsecureIgnition: true}, ignitionURL)
+	assert.Contains(t, cmd, "--insecure-ignition")
+	assert.NotContains(t, cmd, "--ignition-ca-file")
+}
+
+// TestClusterCA tests that the root CA of the cluster is read from the root-ca ConfigMap
+func TestClusterCA(t *testing.T) {
+	const ca = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	_, err := clusterCA(fake.NewSimpleClientset())
+	assert.Error(t, err)
+
+	configMap := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: rootCANamespace, Name: rootCAConfigMap},
+		Data: map[string]string{rootCAKey: "not a certificate"}}
+	_, err = clusterCA(fake.NewSimpleClientset(configMap))
+	assert.Error(t, err)
+
+	configMap.Data[rootCAKey] = ca
+	contents, err := clusterCA(fake.NewSimpleClientset(configMap))
+	require.NoError(t, err)
+	assert.Equal(t, ca, string(contents))
+}
+
+// TestCloudProviderError tests that the nodes without provider ID fail the check unless the cluster has no cloud
+// provider
+func TestCloudProviderError(t *testing.T) {
+	node := &core.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	assert.Error(t, cloudProviderError(node, configv1.AWSPlatformType))
+	assert.NoError(t, cloudProviderError(node, configv1.NonePlatformType))
+	assert.NoError(t, cloudProviderError(node, ""))
+
+	node.Spec.ProviderID = "aws:///us-east-2a/i-0123456789abcdef0"
+	assert.NoError(t, cloudProviderError(node, configv1.AWSPlatformType))
+}
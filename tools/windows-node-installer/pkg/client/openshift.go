@@ -56,6 +56,19 @@ func (o *OpenShift) GetCloudProvider() (*v1.PlatformStatus, error) {
 	return infra.Status.PlatformStatus, nil
 }
 
+// GetDNS returns the DNS configuration of the OpenShift cluster, including its base domain and private zone, or an
+// error.
+func (o *OpenShift) GetDNS() (*v1.DNS, error) {
+	dns, err := o.Client.ConfigV1().DNSes().Get("cluster", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting cluster DNS configuration: %v", err)
+	}
+	if dns.Spec.BaseDomain == "" || dns.Spec.PrivateZone == nil {
+		return nil, fmt.Errorf("cluster DNS configuration has no base domain or private zone")
+	}
+	return dns, nil
+}
+
 // getInfrastructure returns the information of current Infrastructure referred by the OpenShift client or an error.
 func (o *OpenShift) getInfrastructure() (*v1.Infrastructure, error) {
 	infra, err := o.Client.ConfigV1().Infrastructures().Get("cluster", metav1.GetOptions{})
@@ -0,0 +1,88 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and sleeps. The retries and waits take the time from a Clock rather than from the time package,
+// so that they can be unit tested with a Fake instead of waiting for minutes.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Sleep pauses the current goroutine for the given duration
+	Sleep(time.Duration)
+}
+
+// Real is the Clock of the time package
+var Real Clock = realClock{}
+
+// realClock is the Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Fake is a Clock whose time only passes when slept or advanced, which returns at once. It records the sleeps, and can
+// be used concurrently.
+type Fake struct {
+	// lock guards now and sleeps
+	lock sync.Mutex
+	// now is the current time of the clock
+	now time.Time
+	// sleeps are the durations slept, in order
+	sleeps []time.Duration
+}
+
+// NewFake returns a Fake clock starting at the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Sleep advances the clock by the given duration and records it
+func (f *Fake) Sleep(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sleeps = append(f.sleeps, d)
+	if d > 0 {
+		f.now = f.now.Add(d)
+	}
+}
+
+// Advance advances the clock by the given duration, as if the operations in between took it
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Sleeps returns the durations slept so far, in order
+func (f *Fake) Sleeps() []time.Duration {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]time.Duration(nil), f.sleeps...)
+}
+
+// Slept returns the total duration slept so far, which the time of the clock advanced by
+func (f *Fake) Slept() time.Duration {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var total time.Duration
+	for _, d := range f.sleeps {
+		if d > 0 {
+			total += d
+		}
+	}
+	return total
+}
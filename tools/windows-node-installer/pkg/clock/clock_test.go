@@ -0,0 +1,24 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFake tests that the time of a fake clock only passes when slept or advanced
+func TestFake(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+	assert.Equal(t, start, clock.Now())
+
+	realStart := time.Now()
+	clock.Sleep(time.Hour)
+	clock.Sleep(-time.Minute)
+	assert.True(t, time.Since(realStart) < time.Second, "the fake clock should not wait")
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Hour+time.Minute), clock.Now())
+	assert.Equal(t, []time.Duration{time.Hour, -time.Minute}, clock.Sleeps())
+	assert.Equal(t, time.Hour, clock.Slept())
+}
@@ -0,0 +1,253 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// apiRequestRate is the sustained number of AWS API requests per second sent by all the providers sharing a client.
+	// It is well below the EC2 request rate limits, which apply to the whole account.
+	apiRequestRate = 5
+	// apiRequestBurst is the number of AWS API requests that can be sent at once before being rate limited
+	apiRequestBurst = 10
+	// apiMaxRetries is the number of times a throttled or failed AWS API request is retried, with exponential backoff
+	apiMaxRetries = 8
+	// describeCacheTTL is how long the results of the read-only calls describing resources that do not change during
+	// a VM creation, like images, VPCs and subnets, are reused
+	describeCacheTTL = 5 * time.Minute
+	// pricingRegion is the region serving the AWS Price List API, which returns the prices of every region
+	pricingRegion = "us-east-1"
+)
+
+// clientKey identifies the AWS account and region a client is for
+type clientKey struct {
+	credentialPath      string
+	credentialAccountID string
+	region              string
+}
+
+// sharedClient holds the EC2, IAM, Route53, ELBv2, pricing and service quotas clients shared by all the providers using the
+// same credentials and region, so that concurrent VM creations are rate limited together and share the results of
+// identical read-only calls instead of repeating them
+type sharedClient struct {
+	// ec2 is the rate limited EC2 client
+	ec2 *ec2.EC2
+	// iam is the rate limited IAM client
+	iam *iam.IAM
+	// route53 is the rate limited Route53 client
+	route53 *route53.Route53
+	// elbv2 is the rate limited client of the application and network load balancers
+	elbv2 *elbv2.ELBV2
+	// pricing is the rate limited client of the AWS Price List API
+	pricing *pricing.Pricing
+	// serviceQuotas is the rate limited client of the Service Quotas API
+	serviceQuotas *servicequotas.ServiceQuotas
+	// cache holds the results of the read-only calls
+	cache *callCache
+	// sgLock serializes the lookup and creation of the Windows worker security group, so that concurrent VM creations
+	// do not create it more than once
+	sgLock sync.Mutex
+}
+
+var (
+	// sharedClientsLock guards sharedClients
+	sharedClientsLock sync.Mutex
+	// sharedClients holds the client of each account and region used in the process
+	sharedClients = make(map[clientKey]*sharedClient)
+)
+
+// getSharedClient returns the client for the given credentials and region, creating it on first use
+func getSharedClient(credentialPath, credentialAccountID, region string) (*sharedClient, error) {
+	sharedClientsLock.Lock()
+	defer sharedClientsLock.Unlock()
+
+	key := clientKey{credentialPath, credentialAccountID, region}
+	if client, ok := sharedClients[key]; ok {
+		return client, nil
+	}
+	session, err := newSession(credentialPath, credentialAccountID, region)
+	if err != nil {
+		return nil, err
+	}
+	addRateLimiter(session, rate.NewLimiter(apiRequestRate, apiRequestBurst))
+	config := aws.NewConfig().WithMaxRetries(apiMaxRetries)
+	client := &sharedClient{
+		ec2:           ec2.New(session, config),
+		iam:           iam.New(session, config),
+		route53:       route53.New(session, config),
+		elbv2:         elbv2.New(session, config),
+		pricing:       pricing.New(session, aws.NewConfig().WithMaxRetries(apiMaxRetries).WithRegion(pricingRegion)),
+		serviceQuotas: servicequotas.New(session, config),
+		cache:         newCallCache(describeCacheTTL),
+	}
+	sharedClients[key] = client
+	return client, nil
+}
+
+// addRateLimiter makes every request sent through the session, including retries, wait for the limiter
+func addRateLimiter(session *awssession.Session, limiter *rate.Limiter) {
+	session.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+		Name: "wni.RateLimiter",
+		Fn: func(r *request.Request) {
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = fmt.Errorf("rate limited request %s cancelled: %v", r.Operation.Name, err)
+			}
+		},
+	})
+}
+
+// callCache deduplicates concurrent identical calls and caches their successful results for a while. Failed calls
+// are not cached, so that they can be retried.
+type callCache struct {
+	// ttl is how long successful results are reused
+	ttl time.Duration
+	// now returns the current time, it is replaced by the tests
+	now func() time.Time
+	// lock guards calls
+	lock sync.Mutex
+	// calls holds the in flight and cached calls by key
+	calls map[string]*call
+}
+
+// call is a call in flight or cached by a callCache
+type call struct {
+	// done is closed once the call returned
+	done chan struct{}
+	// result is the result of the call
+	result interface{}
+	// err is the error returned by the call
+	err error
+	// expiry is when the result stops being reused
+	expiry time.Time
+}
+
+// newCallCache returns a callCache reusing results for the given duration
+func newCallCache(ttl time.Duration) *callCache {
+	return &callCache{ttl: ttl, now: time.Now, calls: make(map[string]*call)}
+}
+
+// do returns the result of the given operation with the given input. If an identical call is in flight its result is
+// waited for, and if one returned successfully within the TTL its result is reused, otherwise fn is called. The
+// results are shared and must not be modified. A nil callCache always calls fn.
+func (c *callCache) do(operation string, input interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return fn()
+	}
+	encodedInput, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode %s input: %v", operation, err)
+	}
+	key := operation + string(encodedInput)
+
+	c.lock.Lock()
+	if existing, ok := c.calls[key]; ok {
+		select {
+		case <-existing.done:
+			if c.now().Before(existing.expiry) {
+				c.lock.Unlock()
+				return existing.result, nil
+			}
+		default:
+			c.lock.Unlock()
+			<-existing.done
+			return existing.result, existing.err
+		}
+	}
+	current := &call{done: make(chan struct{})}
+	c.calls[key] = current
+	c.lock.Unlock()
+
+	current.result, current.err = fn()
+	c.lock.Lock()
+	if current.err != nil {
+		delete(c.calls, key)
+	} else {
+		current.expiry = c.now().Add(c.ttl)
+	}
+	c.lock.Unlock()
+	close(current.done)
+	return current.result, current.err
+}
+
+// describeImages calls DescribeImages through the cache
+func (a *AwsProvider) describeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	out, err := a.cache.do("DescribeImages", input, func() (interface{}, error) {
+		return a.EC2.DescribeImages(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeImagesOutput), nil
+}
+
+// describeVpcs calls DescribeVpcs through the cache
+func (a *AwsProvider) describeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	out, err := a.cache.do("DescribeVpcs", input, func() (interface{}, error) {
+		return a.EC2.DescribeVpcs(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeVpcsOutput), nil
+}
+
+// describeSubnets calls DescribeSubnets through the cache
+func (a *AwsProvider) describeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	out, err := a.cache.do("DescribeSubnets", input, func() (interface{}, error) {
+		return a.EC2.DescribeSubnets(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeSubnetsOutput), nil
+}
+
+// describeReservedInstancesOfferings calls DescribeReservedInstancesOfferings through the cache
+func (a *AwsProvider) describeReservedInstancesOfferings(input *ec2.DescribeReservedInstancesOfferingsInput) (
+	*ec2.DescribeReservedInstancesOfferingsOutput, error) {
+	out, err := a.cache.do("DescribeReservedInstancesOfferings", input, func() (interface{}, error) {
+		return a.EC2.DescribeReservedInstancesOfferings(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeReservedInstancesOfferingsOutput), nil
+}
+
+// describeClusterSecurityGroups calls DescribeSecurityGroups through the cache. It must only be used for the security
+// groups created by the installer, which do not change during a VM creation.
+func (a *AwsProvider) describeClusterSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (
+	*ec2.DescribeSecurityGroupsOutput, error) {
+	out, err := a.cache.do("DescribeSecurityGroups", input, func() (interface{}, error) {
+		return a.EC2.DescribeSecurityGroups(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*ec2.DescribeSecurityGroupsOutput), nil
+}
+
+// getInstanceProfile calls GetInstanceProfile through the cache
+func (a *AwsProvider) getInstanceProfile(input *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	out, err := a.cache.do("GetInstanceProfile", input, func() (interface{}, error) {
+		return a.IAM.GetInstanceProfile(input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.(*iam.GetInstanceProfileOutput), nil
+}
@@ -0,0 +1,119 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// TestCallCache tests that identical calls are deduplicated and cached, and that failed calls are retried
+func TestCallCache(t *testing.T) {
+	now := time.Now()
+	cache := newCallCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "ami-0123456789abcdef0", nil
+	}
+
+	amazonImages := &ec2.DescribeImagesInput{Owners: aws.StringSlice([]string{"amazon"})}
+
+	// Concurrent identical calls share a single call
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			results[i], err = cache.do("DescribeImages", amazonImages, fn)
+			assert.NoError(t, err)
+		}(i)
+	}
+	// Wait for the first call to be in flight before letting it return
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 1, calls)
+	for _, result := range results {
+		assert.Equal(t, "ami-0123456789abcdef0", result)
+	}
+
+	// The result is reused within the TTL, but not for another input
+	_, err := cache.do("DescribeImages", amazonImages, fn)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, calls)
+	_, err = cache.do("DescribeImages", &ec2.DescribeImagesInput{Owners: aws.StringSlice([]string{"self"})}, fn)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls)
+
+	// The call is made again once the TTL expired
+	now = now.Add(2 * time.Minute)
+	_, err = cache.do("DescribeImages", amazonImages, fn)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, calls)
+
+	// Failed calls are not cached
+	failing := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, fmt.Errorf("RequestLimitExceeded")
+	}
+	for i := 0; i < 2; i++ {
+		_, err = cache.do("DescribeVpcs", nil, failing)
+		assert.Error(t, err)
+	}
+	assert.EqualValues(t, 5, calls)
+
+	// A nil cache always makes the call
+	var nilCache *callCache
+	_, err = nilCache.do("DescribeImages", nil, fn)
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, calls)
+}
+
+// TestRateLimiter tests that requests wait for the rate limiter before being sent
+func TestRateLimiter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `<DescribeImagesResponse><imagesSet/></DescribeImagesResponse>`)
+	}))
+	defer server.Close()
+
+	session, err := awssession.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+	})
+	require.NoError(t, err)
+	// A single request is allowed, the next one would have to wait for an hour
+	addRateLimiter(session, rate.NewLimiter(rate.Every(time.Hour), 1))
+	client := ec2.New(session)
+
+	_, err = client.DescribeImages(&ec2.DescribeImagesInput{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.DescribeImagesWithContext(ctx, &ec2.DescribeImagesInput{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rate limited request DescribeImages cancelled")
+	assert.EqualValues(t, 1, requests)
+}
@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+// EstimateCost estimates the on-demand spend so far of the instances recorded in the 'windows-node-installer.json'
+// file and their volumes. The prices of the given price list take precedence, the others are looked up with the AWS
+// Price List API, falling back to the built-in prices.
+func (a *AwsProvider) EstimateCost(overrides *cost.PriceList) (*cost.Report, error) {
+	info, err := resource.ReadInstallerInfo(a.resourceTrackerDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var resources []cost.Resource
+	if len(info.InstanceIDs) > 0 {
+		output, err := a.EC2.DescribeInstances(&ec2.DescribeInstancesInput{
+			InstanceIds: aws.StringSlice(info.InstanceIDs),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing instances %v: %v", info.InstanceIDs, err)
+		}
+		var instances []*ec2.Instance
+		var volumeIDs []string
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				// Terminated instances are no longer billed
+				if instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated {
+					continue
+				}
+				instances = append(instances, instance)
+				for _, mapping := range instance.BlockDeviceMappings {
+					if mapping.Ebs != nil && mapping.Ebs.VolumeId != nil {
+						volumeIDs = append(volumeIDs, *mapping.Ebs.VolumeId)
+					}
+				}
+			}
+		}
+		volumes := make(map[string]*ec2.Volume)
+		if len(volumeIDs) > 0 {
+			output, err := a.EC2.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: aws.StringSlice(volumeIDs)})
+			if err != nil {
+				return nil, fmt.Errorf("error describing volumes %v: %v", volumeIDs, err)
+			}
+			for _, volume := range output.Volumes {
+				volumes[aws.StringValue(volume.VolumeId)] = volume
+			}
+		}
+		for _, instance := range instances {
+			resources = append(resources, CostResource(instance, volumes, now))
+		}
+	}
+	return cost.Estimate(resources, a.priceList(overrides, resources)), nil
+}
+
+// CostResource returns the billed resource of the given instance with the given volumes, running until now
+func CostResource(instance *ec2.Instance, volumes map[string]*ec2.Volume, now time.Time) cost.Resource {
+	billed := cost.Resource{
+		InstanceID:   aws.StringValue(instance.InstanceId),
+		InstanceType: aws.StringValue(instance.InstanceType),
+		Start:        aws.TimeValue(instance.LaunchTime),
+		End:          now,
+	}
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs == nil {
+			continue
+		}
+		if volume, ok := volumes[aws.StringValue(mapping.Ebs.VolumeId)]; ok {
+			billed.Disks = append(billed.Disks, cost.Disk{Type: aws.StringValue(volume.VolumeType),
+				SizeGiB: aws.Int64Value(volume.Size)})
+		}
+	}
+	return billed
+}
+
+// priceList returns the prices of the instance and disk types of the given resources. The prices of the overrides
+// take precedence, the others are looked up with the AWS Price List API, or taken from the built-in prices if the
+// lookup fails. Prices are only looked up if the overrides are in USD, the currency of the AWS prices.
+func (a *AwsProvider) priceList(overrides *cost.PriceList, resources []cost.Resource) *cost.PriceList {
+	prices := &cost.PriceList{Currency: cost.CurrencyUSD, InstanceHourly: map[string]float64{},
+		DiskMonthly: map[string]float64{}}
+	if overrides != nil {
+		prices.Currency = overrides.Currency
+		for instanceType, price := range overrides.InstanceHourly {
+			prices.InstanceHourly[instanceType] = price
+		}
+		for diskType, price := range overrides.DiskMonthly {
+			prices.DiskMonthly[diskType] = price
+		}
+	}
+	if prices.Currency != cost.CurrencyUSD {
+		return prices
+	}
+
+	defaults := cost.DefaultPriceList()
+	region := ""
+	if a.EC2 != nil {
+		region = aws.StringValue(a.EC2.Config.Region)
+	}
+	// lookup sets the price of the given instance or disk type, if not set yet
+	lookup := func(kind string, prices, defaults map[string]float64, name string, filters map[string]string) {
+		if _, ok := prices[name]; ok {
+			return
+		}
+		price, err := a.lookupPrice(filters)
+		if err == nil {
+			prices[name] = price
+			return
+		}
+		if defaultPrice, ok := defaults[name]; ok {
+			log.Printf("using the built-in price of %s %s, unable to look it up: %v", kind, name, err)
+			prices[name] = defaultPrice
+			return
+		}
+		log.Printf("no price for %s %s: %v", kind, name, err)
+	}
+	for _, billed := range resources {
+		lookup("instance type", prices.InstanceHourly, defaults.InstanceHourly, billed.InstanceType,
+			instancePriceFilters(region, billed.InstanceType))
+		for _, disk := range billed.Disks {
+			lookup("volume type", prices.DiskMonthly, defaults.DiskMonthly, disk.Type,
+				volumePriceFilters(region, disk.Type))
+		}
+	}
+	return prices
+}
+
+// instancePriceFilters returns the Price List API filters matching the on-demand price of a Windows instance of the
+// given type, without SQL Server, in the given region
+func instancePriceFilters(region, instanceType string) map[string]string {
+	return map[string]string{
+		"regionCode":      region,
+		"instanceType":    instanceType,
+		"operatingSystem": "Windows",
+		"tenancy":         "Shared",
+		"preInstalledSw":  "NA",
+		"licenseModel":    "No License required",
+		"capacitystatus":  "Used",
+	}
+}
+
+// volumePriceFilters returns the Price List API filters matching the price of an EBS volume of the given type in the
+// given region
+func volumePriceFilters(region, volumeType string) map[string]string {
+	return map[string]string{
+		"regionCode":    region,
+		"productFamily": "Storage",
+		"volumeApiName": volumeType,
+	}
+}
+
+// lookupPrice returns the on-demand USD price of the EC2 product matching the given filters
+func (a *AwsProvider) lookupPrice(filters map[string]string) (float64, error) {
+	if a.pricing == nil {
+		return 0, fmt.Errorf("the AWS Price List API client is not initialized")
+	}
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	input := &pricing.GetProductsInput{ServiceCode: aws.String("AmazonEC2"), MaxResults: aws.Int64(1)}
+	for _, name := range names {
+		input.Filters = append(input.Filters, &pricing.Filter{Type: aws.String(pricing.FilterTypeTermMatch),
+			Field: aws.String(name), Value: aws.String(filters[name])})
+	}
+	output, err := a.pricing.GetProducts(input)
+	if err != nil {
+		return 0, fmt.Errorf("error getting the price of %v: %v", filters, err)
+	}
+	if len(output.PriceList) == 0 {
+		return 0, fmt.Errorf("no product matches %v", filters)
+	}
+	return parseOnDemandPrice(output.PriceList[0])
+}
+
+// parseOnDemandPrice returns the USD price of the first on-demand price dimension of the given Price List API product
+func parseOnDemandPrice(product aws.JSONValue) (float64, error) {
+	terms, _ := product["terms"].(map[string]interface{})
+	onDemand, _ := terms["OnDemand"].(map[string]interface{})
+	for _, term := range onDemand {
+		term, _ := term.(map[string]interface{})
+		dimensions, _ := term["priceDimensions"].(map[string]interface{})
+		for _, dimension := range dimensions {
+			dimension, _ := dimension.(map[string]interface{})
+			pricePerUnit, _ := dimension["pricePerUnit"].(map[string]interface{})
+			usd, ok := pricePerUnit["USD"].(string)
+			if !ok {
+				continue
+			}
+			price, err := strconv.ParseFloat(usd, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid price %q: %v", usd, err)
+			}
+			return price, nil
+		}
+	}
+	return 0, fmt.Errorf("no on-demand USD price in the product")
+}
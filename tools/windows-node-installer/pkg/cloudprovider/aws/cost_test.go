@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCostResource tests that an instance is billed from its launch time with its EBS volumes
+func TestCostResource(t *testing.T) {
+	launched := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	instance := &ec2.Instance{
+		InstanceId:   aws.String("i-0123456789abcdef0"),
+		InstanceType: aws.String("m5a.large"),
+		LaunchTime:   aws.Time(launched),
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sda1"), Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-1")}},
+			{DeviceName: aws.String("xvdb"), Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-2")}},
+			{DeviceName: aws.String("xvdc")},
+		},
+	}
+	volumes := map[string]*ec2.Volume{
+		"vol-1": {VolumeId: aws.String("vol-1"), VolumeType: aws.String("gp2"), Size: aws.Int64(120)},
+		"vol-2": {VolumeId: aws.String("vol-2"), VolumeType: aws.String("gp3"), Size: aws.Int64(50)},
+	}
+	now := launched.Add(3 * time.Hour)
+	assert.Equal(t, cost.Resource{
+		InstanceID:   "i-0123456789abcdef0",
+		InstanceType: "m5a.large",
+		Disks:        []cost.Disk{{Type: "gp2", SizeGiB: 120}, {Type: "gp3", SizeGiB: 50}},
+		Start:        launched,
+		End:          now,
+	}, CostResource(instance, volumes, now))
+}
+
+// TestPriceList tests that the given prices take precedence over the built-in ones, which are used when the prices
+// cannot be looked up, and that no price is looked up for other currencies
+func TestPriceList(t *testing.T) {
+	a := &AwsProvider{}
+	resources := []cost.Resource{
+		{InstanceType: "m5a.large", Disks: []cost.Disk{{Type: "gp2", SizeGiB: 120}}},
+		{InstanceType: "m6i.large", Disks: []cost.Disk{{Type: "gp3", SizeGiB: 120}}},
+	}
+
+	prices := a.priceList(&cost.PriceList{Currency: cost.CurrencyUSD,
+		InstanceHourly: map[string]float64{"m5a.large": 0.15}}, resources)
+	defaults := cost.DefaultPriceList()
+	assert.Equal(t, cost.CurrencyUSD, prices.Currency)
+	assert.Equal(t, map[string]float64{"m5a.large": 0.15}, prices.InstanceHourly)
+	assert.Equal(t, map[string]float64{"gp2": defaults.DiskMonthly["gp2"], "gp3": defaults.DiskMonthly["gp3"]},
+		prices.DiskMonthly)
+
+	prices = a.priceList(&cost.PriceList{Currency: "EUR", InstanceHourly: map[string]float64{"m5a.large": 0.16}},
+		resources)
+	assert.Equal(t, &cost.PriceList{Currency: "EUR", InstanceHourly: map[string]float64{"m5a.large": 0.16},
+		DiskMonthly: map[string]float64{}}, prices)
+}
+
+// TestInstancePriceFilters tests that the price of a Windows instance without SQL Server is looked up
+func TestInstancePriceFilters(t *testing.T) {
+	filters := instancePriceFilters("us-east-2", "m5a.large")
+	assert.Equal(t, "us-east-2", filters["regionCode"])
+	assert.Equal(t, "m5a.large", filters["instanceType"])
+	assert.Equal(t, "Windows", filters["operatingSystem"])
+	assert.Equal(t, "NA", filters["preInstalledSw"])
+}
+
+// onDemandProduct returns a Price List API product with an on-demand term of the given USD price
+func onDemandProduct(usd string) aws.JSONValue {
+	return aws.JSONValue{
+		"product": map[string]interface{}{"sku": "JRTCKXETXF"},
+		"terms": map[string]interface{}{
+			"OnDemand": map[string]interface{}{
+				"JRTCKXETXF.JRTCKXETXF": map[string]interface{}{
+					"priceDimensions": map[string]interface{}{
+						"JRTCKXETXF.JRTCKXETXF.6YS6EN2CT7": map[string]interface{}{
+							"unit":         "Hrs",
+							"pricePerUnit": map[string]interface{}{"USD": usd},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// TestParseOnDemandPrice tests that the USD price of the on-demand term of a Price List API product is returned
+func TestParseOnDemandPrice(t *testing.T) {
+	price, err := parseOnDemandPrice(onDemandProduct("0.1780000000"))
+	require.NoError(t, err)
+	assert.Equal(t, 0.178, price)
+
+	_, err = parseOnDemandPrice(onDemandProduct("n/a"))
+	assert.Error(t, err)
+	_, err = parseOnDemandPrice(aws.JSONValue{"terms": map[string]interface{}{}})
+	assert.Error(t, err)
+}
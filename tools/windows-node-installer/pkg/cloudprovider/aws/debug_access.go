@@ -0,0 +1,247 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+// debugFirewallRulePrefix is the prefix of the names of the firewall rules created on the instances for debug access
+const debugFirewallRulePrefix = "wni-debug-rdp-"
+
+// EnableDebugAccess opens RDP access to the given instance from the given CIDR. An ingress rule is added to the
+// Windows worker security group and a firewall rule is created on the instance. The changes are recorded next to the
+// 'windows-node-installer.json' file so that they can be revoked with RevokeDebugAccess.
+func (a *AwsProvider) EnableDebugAccess(instanceID, cidr string) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %s: %v", cidr, err)
+	}
+	cidr = ipNet.String()
+	access := resource.DebugAccess{
+		InstanceID:       instanceID,
+		CIDR:             cidr,
+		Port:             rdpPort,
+		FirewallRuleName: debugFirewallRuleName(cidr),
+		Opened:           time.Now().UTC(),
+	}
+	debugAccessFilePath := resource.DebugAccessFilePath(a.resourceTrackerDir)
+	records, err := resource.ReadDebugAccess(debugAccessFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading debug access records: %v", err)
+	}
+	for _, record := range records {
+		if record.InstanceID == instanceID && record.CIDR == cidr {
+			return fmt.Errorf("debug access to %s from %s is already open", instanceID, cidr)
+		}
+	}
+
+	infraID, err := a.GetInfraID()
+	if err != nil {
+		return err
+	}
+	sg, err := a.findWindowsWorkerSg(infraID)
+	if err != nil {
+		return err
+	}
+	access.SecurityGroupID = *sg.GroupId
+	added := false
+	if !hasIngressRule(sg.IpPermissions, rdpPort, cidr) {
+		if err = a.addIngressRules(*sg.GroupId, createRDPRules(cidr)); err != nil {
+			return fmt.Errorf("error allowing RDP access from %s in security group %s: %v", cidr, *sg.GroupId, err)
+		}
+		added = true
+	} else if securityGroupRuleInUse(records, access) {
+		// The rule added for the debug access of another instance is shared, it is revoked with the last access
+		log.Printf("sharing the RDP rule for %s of security group %s with the other debug access", cidr, *sg.GroupId)
+	} else {
+		// An identical rule is left as it is and not recorded, so that it is not removed on revoke
+		log.Printf("security group %s already allows RDP access from %s", *sg.GroupId, cidr)
+		access.SecurityGroupID = ""
+	}
+
+	w, err := a.getWindowsClient(instanceID)
+	if err == nil {
+		_, _, err = w.Run(fmt.Sprintf("New-NetFirewallRule -DisplayName %s -Direction Inbound -Action Allow "+
+			"-Protocol TCP -LocalPort %d -RemoteAddress %s", access.FirewallRuleName, rdpPort, cidr), true)
+	}
+	if err != nil {
+		if added {
+			if revokeErr := a.revokeIngressRules(access.SecurityGroupID, createRDPRules(cidr)); revokeErr != nil {
+				log.Printf("failed to revoke RDP access from %s in security group %s: %v", cidr,
+					access.SecurityGroupID, revokeErr)
+			}
+		}
+		return fmt.Errorf("error creating firewall rule on instance %s: %v", instanceID, err)
+	}
+
+	if err = resource.AppendDebugAccess(access, debugAccessFilePath); err != nil {
+		return fmt.Errorf("failed to record debug access to file at '%s', it will need to be revoked manually: %v",
+			debugAccessFilePath, err)
+	}
+	log.Printf("RDP access to %s from %s is open, revoke it with the revoke-debug-access command", instanceID, cidr)
+	return nil
+}
+
+// RevokeDebugAccess revokes the debug access recorded for the given instance, or for all instances if instanceID is
+// empty. The security group rules and the firewall rules are removed and the records are deleted. The firewall rules
+// are skipped for instances which are no longer running.
+func (a *AwsProvider) RevokeDebugAccess(instanceID string) error {
+	debugAccessFilePath := resource.DebugAccessFilePath(a.resourceTrackerDir)
+	records, err := resource.ReadDebugAccess(debugAccessFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading debug access records: %v", err)
+	}
+
+	var failed []string
+	for _, record := range records {
+		if instanceID != "" && record.InstanceID != instanceID {
+			continue
+		}
+		if err = a.revokeDebugAccess(record); err != nil {
+			log.Printf("failed to revoke debug access to %s from %s: %v", record.InstanceID, record.CIDR, err)
+			failed = append(failed, record.InstanceID)
+			continue
+		}
+		if err = resource.RemoveDebugAccess(record, debugAccessFilePath); err != nil {
+			return fmt.Errorf("%s file was not updated: %v", debugAccessFilePath, err)
+		}
+		log.Printf("revoked RDP access to %s from %s", record.InstanceID, record.CIDR)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to revoke debug access to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// revokeDebugAccess removes the security group rule and the firewall rule of the given debug access. The security group
+// rule is kept if the debug access of another instance still uses it.
+func (a *AwsProvider) revokeDebugAccess(access resource.DebugAccess) error {
+	records, err := resource.ReadDebugAccess(resource.DebugAccessFilePath(a.resourceTrackerDir))
+	if err != nil {
+		return fmt.Errorf("error reading debug access records: %v", err)
+	}
+	if securityGroupRuleInUse(records, access) {
+		log.Printf("keeping the RDP rule for %s of security group %s, used by the debug access of another instance",
+			access.CIDR, access.SecurityGroupID)
+	} else if access.SecurityGroupID != "" {
+		err := a.revokeIngressRules(access.SecurityGroupID, createRDPRules(access.CIDR))
+		// The rule may have been removed by hand already
+		if aerr, ok := err.(awserr.Error); err != nil && !(ok && aerr.Code() == "InvalidPermission.NotFound") {
+			return fmt.Errorf("error revoking RDP access in security group %s: %v", access.SecurityGroupID, err)
+		}
+	}
+
+	instance, err := a.GetInstance(access.InstanceID)
+	if err != nil || instance.State == nil || *instance.State.Name != ec2.InstanceStateNameRunning {
+		log.Printf("instance %s is not running, skipping removal of firewall rule %s", access.InstanceID,
+			access.FirewallRuleName)
+		return nil
+	}
+	w, err := a.getWindowsClient(access.InstanceID)
+	if err != nil {
+		return err
+	}
+	if _, _, err = w.Run("Remove-NetFirewallRule -DisplayName "+access.FirewallRuleName, true); err != nil {
+		return fmt.Errorf("error removing firewall rule %s: %v", access.FirewallRuleName, err)
+	}
+	return nil
+}
+
+// revokeDebugAccessOfInstances revokes the security group rules of the debug access recorded for the given
+// instances and deletes the records. It is used once the instances have been terminated, so the firewall rules are not
+// removed.
+func (a *AwsProvider) revokeDebugAccessOfInstances(instanceIDs []string) {
+	debugAccessFilePath := resource.DebugAccessFilePath(a.resourceTrackerDir)
+	records, err := resource.ReadDebugAccess(debugAccessFilePath)
+	if err != nil {
+		log.Printf("error reading debug access records: %v", err)
+		return
+	}
+	terminated := make(map[string]bool, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		terminated[instanceID] = true
+	}
+	for _, record := range records {
+		if !terminated[record.InstanceID] {
+			continue
+		}
+		if err = a.revokeDebugAccess(record); err != nil {
+			log.Printf("failed to revoke debug access to %s from %s: %v", record.InstanceID, record.CIDR, err)
+			continue
+		}
+		if err = resource.RemoveDebugAccess(record, debugAccessFilePath); err != nil {
+			log.Printf("%s file was not updated: %v", debugAccessFilePath, err)
+		}
+	}
+}
+
+// securityGroupRuleInUse returns true if the security group rule of the given debug access is recorded for the debug
+// access of another instance
+func securityGroupRuleInUse(records []resource.DebugAccess, access resource.DebugAccess) bool {
+	if access.SecurityGroupID == "" {
+		return false
+	}
+	for _, record := range records {
+		if record.InstanceID != access.InstanceID && record.SecurityGroupID == access.SecurityGroupID &&
+			record.CIDR == access.CIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeIngressRules makes the call to the AWS RevokeSecurityGroupIngress to remove the given inbound rules from the
+// security group
+func (a *AwsProvider) revokeIngressRules(sgID string, rules []*ec2.IpPermission) error {
+	_, err := a.EC2.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+		GroupId:       aws.String(sgID),
+		IpPermissions: rules,
+	})
+	return err
+}
+
+// createRDPRules returns the rules allowing RDP access from the given CIDR
+func createRDPRules(cidr string) []*ec2.IpPermission {
+	return []*ec2.IpPermission{
+		(&ec2.IpPermission{}).
+			SetIpProtocol("tcp").
+			SetFromPort(rdpPort).
+			SetToPort(rdpPort).
+			SetIpRanges([]*ec2.IpRange{
+				(&ec2.IpRange{}).
+					SetCidrIp(cidr),
+			}),
+	}
+}
+
+// hasIngressRule returns true if the rules allow TCP access on the given port from the given CIDR
+func hasIngressRule(rules []*ec2.IpPermission, port int64, cidr string) bool {
+	for _, rule := range rules {
+		if rule.IpProtocol == nil || *rule.IpProtocol != "tcp" || rule.FromPort == nil || rule.ToPort == nil {
+			continue
+		}
+		if *rule.FromPort > port || *rule.ToPort < port {
+			continue
+		}
+		for _, ipRange := range rule.IpRanges {
+			if ipRange.CidrIp != nil && *ipRange.CidrIp == cidr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// debugFirewallRuleName returns the name of the firewall rule created on the instance for debug access from the given
+// CIDR
+func debugFirewallRuleName(cidr string) string {
+	return debugFirewallRulePrefix + strings.NewReplacer("/", "-", ":", "-").Replace(cidr)
+}
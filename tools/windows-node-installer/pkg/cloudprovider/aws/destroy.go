@@ -0,0 +1,249 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// destroyBatchSize is the number of instances terminated in parallel, so that destroying many instances does not
+	// exhaust the request rate of the account
+	destroyBatchSize = 5
+	// destroyAttempts is the number of times the termination of an instance is attempted before it is reported as
+	// left behind
+	destroyAttempts = 3
+)
+
+// Leftover is a resource DestroyWindowsVMs could not delete
+type Leftover struct {
+	// Kind is the kind of the resource, e.g. instance or network interface
+	Kind string
+	// ID is the ID of the resource
+	ID string
+	// Reason tells why the resource is left behind
+	Reason string
+}
+
+// String returns a description of the resource left behind
+func (l Leftover) String() string {
+	return fmt.Sprintf("%s %s: %s", l.Kind, l.ID, l.Reason)
+}
+
+// DestroyError is returned when DestroyWindowsVMs leaves billable resources behind. The instances left behind are
+// kept in the 'windows-node-installer.json' file, so that destroying them can be retried.
+type DestroyError struct {
+	// Leftovers are the resources left behind
+	Leftovers []Leftover
+}
+
+// Error returns the resources left behind
+func (e *DestroyError) Error() string {
+	var leftovers []string
+	for _, leftover := range e.Leftovers {
+		leftovers = append(leftovers, leftover.String())
+	}
+	return fmt.Sprintf("%d resources were left behind and need to be deleted: %s", len(e.Leftovers),
+		strings.Join(leftovers, "; "))
+}
+
+// instanceResources are the resources of an instance whose release is verified once it is terminated
+type instanceResources struct {
+	// networkInterfaces are the IDs of the network interfaces attached to the instance
+	networkInterfaces []string
+	// addresses are the elastic IPs associated with the instance, which outlive it
+	addresses []*ec2.Address
+}
+
+// terminateInstances terminates the given instances in parallel batches and verifies that their network interfaces
+// are released, retrying the stragglers. It returns the terminated instances and the resources left behind, including
+// the elastic IPs that were associated with the terminated instances, which are not released with them.
+func (a *AwsProvider) terminateInstances(instanceIDs []string) ([]string, []Leftover) {
+	var lock sync.Mutex
+	resources := make(map[string]*instanceResources)
+	terminated, failed := retryBatched(instanceIDs, destroyBatchSize, destroyAttempts, func(instanceID string) error {
+		lock.Lock()
+		known := resources[instanceID]
+		lock.Unlock()
+		// The resources are collected before the first attempt, as they cannot be described once detached
+		if known == nil {
+			var err error
+			if known, err = a.getInstanceResources(instanceID); err != nil {
+				return err
+			}
+			lock.Lock()
+			resources[instanceID] = known
+			lock.Unlock()
+		}
+		return a.terminateAndVerify(instanceID, known)
+	})
+
+	var leftovers []Leftover
+	for _, instanceID := range instanceIDs {
+		if err, ok := failed[instanceID]; ok {
+			leftovers = append(leftovers, Leftover{Kind: "instance", ID: instanceID, Reason: err.Error()})
+		}
+	}
+	for _, instanceID := range terminated {
+		if resources[instanceID] == nil {
+			continue
+		}
+		for _, address := range resources[instanceID].addresses {
+			leftovers = append(leftovers, Leftover{Kind: "elastic IP", ID: aws.StringValue(address.AllocationId),
+				Reason: fmt.Sprintf("%s was associated with instance %s and is still allocated",
+					aws.StringValue(address.PublicIp), instanceID)})
+		}
+	}
+	return terminated, leftovers
+}
+
+// retryBatched calls fn on the given IDs in parallel batches of the given size, and calls it again on the IDs it
+// failed on until it succeeded on all of them or was called the given number of times on each. It returns the IDs it
+// succeeded on, in order, and the last error of each ID it failed on.
+func retryBatched(ids []string, batchSize, attempts int, fn func(id string) error) ([]string, map[string]error) {
+	failed := make(map[string]error)
+	pending := ids
+	for attempt := 1; attempt <= attempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			log.Printf("retrying %d of %d, attempt %d of %d", len(pending), len(ids), attempt, attempts)
+		}
+		var lock sync.Mutex
+		for start := 0; start < len(pending); start += batchSize {
+			end := start + batchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			var wg sync.WaitGroup
+			for _, id := range pending[start:end] {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					err := fn(id)
+					lock.Lock()
+					defer lock.Unlock()
+					if err != nil {
+						failed[id] = err
+					} else {
+						delete(failed, id)
+					}
+				}(id)
+			}
+			wg.Wait()
+		}
+		pending = nil
+		for _, id := range ids {
+			if _, ok := failed[id]; ok {
+				pending = append(pending, id)
+			}
+		}
+	}
+	var succeeded []string
+	for _, id := range ids {
+		if _, ok := failed[id]; !ok {
+			succeeded = append(succeeded, id)
+		}
+	}
+	return succeeded, failed
+}
+
+// getInstanceResources returns the network interfaces and elastic IPs of the given instance, none if it does not
+// exist anymore
+func (a *AwsProvider) getInstanceResources(instanceID string) (*instanceResources, error) {
+	resources := &instanceResources{}
+	instance, err := a.findInstance(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("error describing instance: %v", err)
+	}
+	if instance == nil {
+		return resources, nil
+	}
+	for _, networkInterface := range instance.NetworkInterfaces {
+		resources.networkInterfaces = append(resources.networkInterfaces,
+			aws.StringValue(networkInterface.NetworkInterfaceId))
+	}
+	addresses, err := a.EC2.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("instance-id"), Values: aws.StringSlice([]string{instanceID})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing elastic IPs: %v", err)
+	}
+	resources.addresses = addresses.Addresses
+	return resources, nil
+}
+
+// terminateAndVerify terminates the given instance, waits until it is terminated, and verifies that its network
+// interfaces are released. The network interfaces left detached, e.g. the ones not deleted on termination, are
+// deleted.
+func (a *AwsProvider) terminateAndVerify(instanceID string, resources *instanceResources) error {
+	if err := a.TerminateInstance(instanceID); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to terminate: %v", err)
+	}
+	if err := a.waitUntilInstanceTerminated(instanceID); err != nil && !isNotFound(err) {
+		return fmt.Errorf("timeout waiting for termination: %v", err)
+	}
+	instance, err := a.findInstance(instanceID)
+	if err != nil {
+		return fmt.Errorf("error verifying termination: %v", err)
+	}
+	if instance != nil && aws.StringValue(instance.State.Name) != ec2.InstanceStateNameTerminated {
+		return fmt.Errorf("instance is %s, expected %s", aws.StringValue(instance.State.Name),
+			ec2.InstanceStateNameTerminated)
+	}
+	return a.releaseNetworkInterfaces(resources.networkInterfaces)
+}
+
+// releaseNetworkInterfaces verifies that the given network interfaces of a terminated instance are deleted, and
+// deletes the ones left detached
+func (a *AwsProvider) releaseNetworkInterfaces(networkInterfaceIDs []string) error {
+	for _, id := range networkInterfaceIDs {
+		out, err := a.EC2.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: aws.StringSlice([]string{id}),
+		})
+		if isNotFound(err) || (err == nil && len(out.NetworkInterfaces) == 0) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error verifying the release of network interface %s: %v", id, err)
+		}
+		status := aws.StringValue(out.NetworkInterfaces[0].Status)
+		if status != ec2.NetworkInterfaceStatusAvailable {
+			return fmt.Errorf("network interface %s is %s, expected it to be deleted", id, status)
+		}
+		if _, err = a.EC2.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String(id),
+		}); err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to delete detached network interface %s: %v", id, err)
+		}
+		log.Printf("deleted detached network interface %s", id)
+	}
+	return nil
+}
+
+// findInstance returns the given instance, or nil if it does not exist anymore. The terminated instances are still
+// returned for a while.
+func (a *AwsProvider) findInstance(instanceID string) (*ec2.Instance, error) {
+	out, err := a.EC2.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{instanceID}),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Reservations) == 0 || len(out.Reservations[0].Instances) == 0 {
+		return nil, nil
+	}
+	return out.Reservations[0].Instances[0], nil
+}
+
+// isNotFound returns true if the given error is returned by EC2 for a resource that does not exist
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && strings.HasSuffix(aerr.Code(), ".NotFound")
+}
@@ -0,0 +1,109 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRetryBatched tests that the calls are made in bounded parallel batches and that the failed ones are retried
+// until they succeed or run out of attempts
+func TestRetryBatched(t *testing.T) {
+	ids := []string{"i-1", "i-2", "i-3", "i-4", "i-5", "i-6", "i-7"}
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	var running, maxRunning int32
+	succeeded, failed := retryBatched(ids, 3, 3, func(id string) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		lock.Lock()
+		calls[id]++
+		call := calls[id]
+		if current > maxRunning {
+			maxRunning = current
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		switch {
+		case id == "i-2" && call < 2:
+			return fmt.Errorf("instance is shutting-down")
+		case id == "i-5":
+			return fmt.Errorf("failed to terminate")
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{"i-1", "i-2", "i-3", "i-4", "i-6", "i-7"}, succeeded)
+	require.Len(t, failed, 1)
+	assert.EqualError(t, failed["i-5"], "failed to terminate")
+	assert.Equal(t, 2, calls["i-2"], "the straggler should be retried once")
+	assert.Equal(t, 3, calls["i-5"], "the failed instance should be tried on each attempt")
+	assert.Equal(t, 1, calls["i-1"])
+	assert.True(t, maxRunning <= 3, "%d calls ran in parallel", maxRunning)
+}
+
+// TestDestroyError tests that the resources left behind are listed
+func TestDestroyError(t *testing.T) {
+	err := &DestroyError{Leftovers: []Leftover{
+		{Kind: "instance", ID: "i-0123456789abcdef0", Reason: "instance is shutting-down, expected terminated"},
+		{Kind: "elastic IP", ID: "eipalloc-0123", Reason: "3.4.5.6 was associated with instance i-1 and is still " +
+			"allocated"},
+	}}
+	assert.EqualError(t, err, "2 resources were left behind and need to be deleted: instance i-0123456789abcdef0: "+
+		"instance is shutting-down, expected terminated; elastic IP eipalloc-0123: 3.4.5.6 was associated with "+
+		"instance i-1 and is still allocated")
+}
+
+// TestReleaseNetworkInterfaces tests that the deleted network interfaces are released, the detached ones are deleted
+// and the ones still in use are reported
+func TestReleaseNetworkInterfaces(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		id := r.Form.Get("NetworkInterfaceId.1")
+		switch r.Form.Get("Action") {
+		case "DescribeNetworkInterfaces":
+			status := map[string]string{"eni-detached": "available", "eni-attached": "in-use"}[id]
+			if status == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `<Response><Errors><Error><Code>InvalidNetworkInterfaceID.NotFound</Code>`+
+					`<Message>The networkInterface ID '%s' does not exist</Message></Error></Errors></Response>`, id)
+				return
+			}
+			fmt.Fprintf(w, `<DescribeNetworkInterfacesResponse><networkInterfaceSet><item>`+
+				`<networkInterfaceId>%s</networkInterfaceId><status>%s</status></item></networkInterfaceSet>`+
+				`</DescribeNetworkInterfacesResponse>`, id, status)
+		case "DeleteNetworkInterface":
+			deleted = append(deleted, r.Form.Get("NetworkInterfaceId"))
+			fmt.Fprint(w, `<DeleteNetworkInterfaceResponse><return>true</return></DeleteNetworkInterfaceResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	session, err := awssession.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	a := &AwsProvider{EC2: ec2.New(session)}
+
+	require.NoError(t, a.releaseNetworkInterfaces([]string{"eni-deleted", "eni-detached"}))
+	assert.Equal(t, []string{"eni-detached"}, deleted)
+
+	err = a.releaseNetworkInterfaces([]string{"eni-attached"})
+	assert.EqualError(t, err, "network interface eni-attached is in-use, expected it to be deleted")
+}
@@ -0,0 +1,158 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/openshift/api/config/v1"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+const (
+	// dnsRecordTTL is the time to live in seconds of the DNS records registered for the instances
+	dnsRecordTTL = 60
+	// hostedZonePrefix is the prefix of the IDs of the hosted zones returned by the Route53 API
+	hostedZonePrefix = "/hostedzone/"
+)
+
+// SetDNSRegistration sets whether the created instances are registered in the private hosted zone of the cluster, as
+// <instance name>.<cluster domain> pointing to their private IP
+func (a *AwsProvider) SetDNSRegistration(enabled bool) {
+	a.registerDNS = enabled
+}
+
+// registerDNSRecord registers the given instance in the private hosted zone of the cluster with the given host name,
+// and records it next to the 'windows-node-installer.json' file so that it is removed along with the instance. The
+// fully qualified name of the record is returned.
+func (a *AwsProvider) registerDNSRecord(instance *ec2.Instance, host string) (string, error) {
+	if instance.PrivateIpAddress == nil {
+		return "", fmt.Errorf("instance %s has no private IP address", *instance.InstanceId)
+	}
+	dns, err := a.openShiftClient.GetDNS()
+	if err != nil {
+		return "", err
+	}
+	zoneID, err := a.getPrivateZoneID(dns)
+	if err != nil {
+		return "", fmt.Errorf("error getting private hosted zone of the cluster: %v", err)
+	}
+	record := resource.DNSRecord{
+		InstanceID: *instance.InstanceId,
+		Name:       dnsRecordName(host, dns.Spec.BaseDomain),
+		ZoneID:     zoneID,
+		IPAddress:  *instance.PrivateIpAddress,
+		TTL:        dnsRecordTTL,
+	}
+	if err = a.changeDNSRecord(route53.ChangeActionUpsert, record); err != nil {
+		return "", fmt.Errorf("error registering %s in hosted zone %s: %v", record.Name, zoneID, err)
+	}
+	if err = resource.AppendDNSRecord(record, resource.DNSRecordFilePath(a.resourceTrackerDir)); err != nil {
+		return "", fmt.Errorf("failed to record DNS record %s, it will need to be removed manually: %v", record.Name,
+			err)
+	}
+	log.Printf("registered instance %s as %s", record.InstanceID, record.Name)
+	return record.Name, nil
+}
+
+// deregisterDNSRecords removes the DNS records registered for the given instances. Failures are logged, so that the
+// other instances are still handled.
+func (a *AwsProvider) deregisterDNSRecords(instanceIDs []string) {
+	filePath := resource.DNSRecordFilePath(a.resourceTrackerDir)
+	records, err := resource.ReadDNSRecords(filePath)
+	if err != nil {
+		log.Printf("error reading DNS records: %v", err)
+		return
+	}
+	for _, instanceID := range instanceIDs {
+		for _, record := range records {
+			if record.InstanceID != instanceID {
+				continue
+			}
+			if err = a.changeDNSRecord(route53.ChangeActionDelete, record); err != nil {
+				log.Printf("failed to remove DNS record %s: %v", record.Name, err)
+				continue
+			}
+			if err = resource.RemoveDNSRecord(instanceID, filePath); err != nil {
+				log.Printf("%s file was not updated: %v", filePath, err)
+			}
+		}
+	}
+}
+
+// changeDNSRecord applies the given change to the A record
+func (a *AwsProvider) changeDNSRecord(action string, record resource.DNSRecord) error {
+	_, err := a.Route53.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(record.ZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{{
+				Action: aws.String(action),
+				ResourceRecordSet: &route53.ResourceRecordSet{
+					Name:            aws.String(record.Name),
+					Type:            aws.String(route53.RRTypeA),
+					TTL:             aws.Int64(record.TTL),
+					ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(record.IPAddress)}},
+				},
+			}},
+		},
+	})
+	return err
+}
+
+// getPrivateZoneID returns the ID of the private hosted zone of the cluster. The zone is given by its ID, or by its
+// tags, in which case it is looked up among the private zones of the base domain of the cluster.
+func (a *AwsProvider) getPrivateZoneID(dns *v1.DNS) (string, error) {
+	if dns.Spec.PrivateZone.ID != "" {
+		return strings.TrimPrefix(dns.Spec.PrivateZone.ID, hostedZonePrefix), nil
+	}
+	zoneName := strings.TrimSuffix(dns.Spec.BaseDomain, ".") + "."
+	zones, err := a.Route53.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(zoneName),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, zone := range zones.HostedZones {
+		if *zone.Name != zoneName || zone.Config == nil || !aws.BoolValue(zone.Config.PrivateZone) {
+			continue
+		}
+		zoneID := strings.TrimPrefix(*zone.Id, hostedZonePrefix)
+		tags, err := a.Route53.ListTagsForResource(&route53.ListTagsForResourceInput{
+			ResourceId:   aws.String(zoneID),
+			ResourceType: aws.String(route53.TagResourceTypeHostedzone),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error getting tags of hosted zone %s: %v", zoneID, err)
+		}
+		if tags.ResourceTagSet != nil && hasTags(tags.ResourceTagSet.Tags, dns.Spec.PrivateZone.Tags) {
+			return zoneID, nil
+		}
+	}
+	return "", fmt.Errorf("no private hosted zone %s with tags %v found", zoneName, dns.Spec.PrivateZone.Tags)
+}
+
+// hasTags returns true if all the expected tags are among the given tags
+func hasTags(tags []*route53.Tag, expected map[string]string) bool {
+	for key, value := range expected {
+		found := false
+		for _, tag := range tags {
+			if aws.StringValue(tag.Key) == key && aws.StringValue(tag.Value) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// dnsRecordName returns the fully qualified name of the record of the given host in the given domain. Host names are
+// case insensitive, so it is lower cased to match the name returned by resolvers.
+func dnsRecordName(host, domain string) string {
+	return strings.ToLower(host) + "." + strings.TrimSuffix(domain, ".")
+}
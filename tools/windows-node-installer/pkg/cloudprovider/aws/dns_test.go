@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDNSRecordName tests that the records are named after the instance in the domain of the cluster
+func TestDNSRecordName(t *testing.T) {
+	assert.Equal(t, "cluster-x7k2p-windows-worker-us-east-2a-abcd.cluster.example.com",
+		dnsRecordName("cluster-x7k2p-windows-worker-us-east-2a-abcd", "cluster.example.com"))
+	assert.Equal(t, "i-0123456789abcdef0.cluster.example.com",
+		dnsRecordName("I-0123456789ABCDEF0", "cluster.example.com."))
+}
+
+// TestHasTags tests the matching of the private hosted zone tags
+func TestHasTags(t *testing.T) {
+	tags := []*route53.Tag{
+		{Key: aws.String("Name"), Value: aws.String("cluster-x7k2p-int")},
+		{Key: aws.String("kubernetes.io/cluster/cluster-x7k2p"), Value: aws.String("owned")},
+	}
+	tests := []struct {
+		name     string
+		expected map[string]string
+		matches  bool
+	}{
+		{"all tags", map[string]string{"Name": "cluster-x7k2p-int",
+			"kubernetes.io/cluster/cluster-x7k2p": "owned"}, true},
+		{"some tags", map[string]string{"Name": "cluster-x7k2p-int"}, true},
+		{"no tags", nil, true},
+		{"other value", map[string]string{"Name": "cluster-a1b2c-int"}, false},
+		{"missing tag", map[string]string{"owner": "wni"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.matches, hasTags(tags, test.expected))
+		})
+	}
+}
+
+// TestGetPrivateZoneIDFromConfig tests that the zone ID given by the cluster DNS configuration is used as it is
+func TestGetPrivateZoneIDFromConfig(t *testing.T) {
+	a := &AwsProvider{}
+	for _, id := range []string{"Z0123456789ABCDEFGHIJ", "/hostedzone/Z0123456789ABCDEFGHIJ"} {
+		dns := &v1.DNS{Spec: v1.DNSSpec{BaseDomain: "cluster.example.com", PrivateZone: &v1.DNSZone{ID: id}}}
+		zoneID, err := a.getPrivateZoneID(dns)
+		require.NoError(t, err)
+		assert.Equal(t, "Z0123456789ABCDEFGHIJ", zoneID)
+	}
+}
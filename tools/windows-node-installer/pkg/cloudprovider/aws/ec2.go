@@ -2,35 +2,45 @@ package aws
 
 import (
 	"bytes"
+	"context"
 	crand "crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/base64"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	awssession "github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/client"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/clock"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/keypair"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/util/rand"
 )
 
 const (
 	infraIDTagKeyPrefix = "kubernetes.io/cluster/"
 	infraIDTagValue     = "owned"
-	// durationFactor is amount of time to be multiplied with before each call to AWS api to get password for the
-	// Windows VM created
+	// durationFactor is the time waited between two calls to the AWS api to get the password of the Windows VM created
 	durationFactor = 10 * time.Second
 	// awsPasswordDataTimeout is the maximum amount of time we can wait before password is available
 	// for the Windows node created. From AWS docs:
@@ -43,8 +53,18 @@ const (
 	sshPort = 22
 	//RDP port for requests
 	rdpPort = 3389
+	// computerNameTimeout is the maximum amount of time to wait for the instance to be renamed and rebooted
+	computerNameTimeout = 15 * time.Minute
+	// windowsUpdateTimeout is the maximum amount of time to wait for the requested updates to be installed
+	windowsUpdateTimeout = time.Hour
 )
 
+// gravitonFamily matches the instance type families of the AWS Graviton processors, e.g. m6g, c6gn or t4g
+// clk is the clock the waits for the instances take the time from, faked in the unit tests
+var clk = clock.Real
+
+var gravitonFamily = regexp.MustCompile(`^[a-z]+[0-9]+g[a-z]*$`)
+
 // Constant value
 const (
 	// Winrm port for https request
@@ -63,20 +83,51 @@ type AwsProvider struct {
 	imageID string
 	// instanceType is the flavor of VM to be used
 	instanceType string
-	// sshKey is the ssh key to access the VM created. Please note that key should be uploaded to AWS before
-	// using this flag. AWS encrypts the password of the Windows instance created with this public key
+	// sshKey is the name of the existing key pair to access the VM created. AWS encrypts the password of the Windows
+	// instance created with this public key. If empty, a key pair is generated, see ensureKeyPair.
 	sshKey string
 	// A client for EC2.
 	EC2 *ec2.EC2
 	// A client for IAM.
 	IAM *iam.IAM
+	// A client for Route53.
+	Route53 *route53.Route53
+	// A client for the application and network load balancers.
+	ELBV2 *elbv2.ELBV2
 	// openShiftClient is the client of the existing OpenShift cluster.
 	openShiftClient *client.OpenShift
 	// resourceTrackerDir is where `windows-node-installer.json` file is stored.
 	resourceTrackerDir string
 	// privateKeyPath is the location of the private key on the machine for the public key uploaded to AWS
-	// This is used to decrypt the password for the Windows locally
+	// This is used to decrypt the password for the Windows locally. If empty, the private key of the generated key
+	// pair is used.
 	privateKeyPath string
+	// cache deduplicates and caches the read-only calls shared with the other providers of the process. If nil, the
+	// calls are made directly.
+	cache *callCache
+	// sgLock serializes the handling of the Windows worker security group with the other providers of the process
+	sgLock *sync.Mutex
+	// networkMode selects whether the instances are reached through their public or private IP
+	networkMode types.NetworkMode
+	// privateIP caches whether the instances are reached through their private IP, nil until it is determined
+	privateIP *bool
+	// registerDNS registers the created instances in the private hosted zone of the cluster
+	registerDNS bool
+	// computerName is the Windows computer name of the created instances, or types.ComputerNamePrivateDNS to name
+	// them after their private DNS name. The name given by the image is kept if empty.
+	computerName string
+	// windowsUpdate is the Windows Update policy applied to the created instances, nil to leave Windows Update as
+	// configured by the image
+	windowsUpdate *types.WindowsUpdatePolicy
+	// metadata hardens the instance metadata service of the created instances, nil to leave it as configured by AWS
+	metadata *types.MetadataOptions
+	// pricing is the client of the AWS Price List API, used to estimate the cost of the created instances
+	pricing *pricing.Pricing
+	// serviceQuotas is the client of the Service Quotas API, used to check that the instances fit the quotas of the
+	// account before creating them
+	serviceQuotas *servicequotas.ServiceQuotas
+	// targetGroupARNs are the ARNs of the load balancer target groups the created instances are registered with
+	targetGroupARNs []string
 }
 
 // New returns the AWS implementations of the Cloud interface with AWS session in the same region as OpenShift Cluster.
@@ -91,16 +142,31 @@ func New(openShiftClient *client.OpenShift, imageID, instanceType, sshKey, crede
 	if err != nil {
 		return nil, err
 	}
-	session, err := newSession(credentialPath, credentialAccountID, provider.AWS.Region)
+	// The clients are shared by the providers of the process, so that concurrent VM creations are rate limited
+	// together and do not repeat identical calls
+	client, err := getSharedClient(credentialPath, credentialAccountID, provider.AWS.Region)
 	if err != nil {
 		return nil, err
 	}
 	return &AwsProvider{imageID, instanceType, sshKey,
-		ec2.New(session, aws.NewConfig()),
-		iam.New(session, aws.NewConfig()),
+		client.ec2,
+		client.iam,
+		client.route53,
+		client.elbv2,
 		openShiftClient,
 		resourceTrackerDir,
 		privateKeyPath,
+		client.cache,
+		&client.sgLock,
+		types.NetworkModeAuto,
+		nil,
+		false,
+		"",
+		nil,
+		nil,
+		client.pricing,
+		client.serviceQuotas,
+		nil,
 	}, nil
 }
 
@@ -123,74 +189,126 @@ func newSession(credentialPath, credentialAccountID, region string) (*awssession
 // - uses public subnet,
 // - attaches public ip to allow external access,
 // - adds a security group that allows traffic from within the VPC range and RDP access from user's IP,
+// - or, in private network mode, uses a private subnet without public ip nor access from user's IP,
 // - uses given image id, instance type, and sshKey name
-// - creates a unique name tag for the instance using the same prefix as the OpenShift cluster name, and
+// - creates a unique name tag for the instance using the same prefix as the OpenShift cluster name,
+// - if DNS registration is enabled, registers the instance in the private hosted zone of the cluster with its name tag,
+// - registers the instance with the load balancer target groups, if any, and
 // - logs id and security group information of the created instance in 'windows-node-installer.json' file at the
 // resourceTrackerDir.
 // On success, the function outputs RDP access information in the commandline interface. It also returns the
 // the Windows VM Object to interact with using SSH, Winrm etc.
 func (a *AwsProvider) CreateWindowsVM() (windowsVM types.WindowsVM, err error) {
+	ctx, span := tracing.Start(tracing.Context(), "CreateWindowsVM",
+		attribute.String("instance-type", a.instanceType))
+	phases := 8
+	if a.registerDNS {
+		phases++
+	}
+	if len(a.targetGroupARNs) > 0 {
+		phases++
+	}
+	if a.computerName != "" {
+		phases++
+	}
+	if !a.windowsUpdate.IsDefault() {
+		phases++
+	}
+	op := progress.Start("CreateWindowsVM", phases)
+	defer func() {
+		op.End(err)
+		tracing.End(span, err)
+	}()
+
 	w := &types.Windows{}
-	// If no AMI was provided, use the latest Windows AMI
-	if a.imageID == "" {
-		var err error
-		a.imageID, err = a.getLatestWindowsAMI()
-		if err != nil {
-			return nil, fmt.Errorf("could not find latest Windows AMI: %s", err)
+	architecture := instanceTypeArchitecture(a.instanceType)
+	err = op.Phase(ctx, "resolve image", func() error {
+		// If no AMI was provided, use the latest Windows AMI for the architecture of the instance type
+		if a.imageID == "" {
+			var err error
+			a.imageID, err = a.getLatestWindowsAMI(architecture)
+			if err != nil {
+				return fmt.Errorf("could not find latest Windows AMI: %s", err)
+			}
+			return nil
 		}
-	}
-	// Obtains information from AWS and the existing OpenShift cluster for creating an instance.
-	infraID, err := a.GetInfraID()
+		return a.validateImageArchitecture(a.imageID, architecture)
+	})
 	if err != nil {
 		return nil, err
 	}
-	networkInterface, err := a.getNetworkInterface(infraID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get network interface, %v", err)
-	}
-	workerIAM, err := a.GetIAMWorkerRole(infraID)
+	span.SetAttributes(attribute.String("image-id", a.imageID))
+
+	// Obtains information from AWS and the existing OpenShift cluster for creating an instance.
+	var infraID string
+	var networkInterface *ec2.InstanceNetworkInterfaceSpecification
+	var workerIAM *ec2.IamInstanceProfileSpecification
+	err = op.Phase(ctx, "get cluster infrastructure", func() error {
+		var err error
+		infraID, err = a.GetInfraID()
+		if err != nil {
+			return err
+		}
+		networkInterface, err = a.getNetworkInterface(infraID)
+		if err != nil {
+			return fmt.Errorf("failed to get network interface, %v", err)
+		}
+		workerIAM, err = a.GetIAMWorkerRole(infraID)
+		if err != nil {
+			return fmt.Errorf("failed to get cluster worker IAM, %v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cluster worker IAM, %v", err)
+		return nil, err
 	}
 
-	// PowerShell script to setup WinRM for Ansible, installing OpenSSH server and open firewall
-	// port number 10250 on the Windows node created
-	userDataWinrm := `<powershell>
-        $url = "https://raw.githubusercontent.com/ansible/ansible/devel/examples/scripts/ConfigureRemotingForAnsible.ps1"
-        $file = "$env:temp\ConfigureRemotingForAnsible.ps1"
-        (New-Object -TypeName System.Net.WebClient).DownloadFile($url,  $file)
-        & $file
-        Add-WindowsCapability -Online -Name OpenSSH.Server~~~~0.0.1.0
-        New-NetFirewallRule -DisplayName "` + types.FirewallRuleName + `"
-        -Direction Inbound -Action Allow -Protocol TCP -LocalPort ` + types.ContainerLogsPort + ` -EdgeTraversalPolicy Allow
-        </powershell>
-        <persist>true</persist>`
-
-	instance, err := a.createInstance(a.imageID, a.instanceType, a.sshKey, networkInterface, workerIAM, userDataWinrm)
-
+	var instance *ec2.Instance
+	err = op.Phase(ctx, "create instance", func() error {
+		if err := a.ensureKeyPair(); err != nil {
+			return err
+		}
+		var err error
+		instance, err = a.createInstance(a.imageID, a.instanceType, a.sshKey, networkInterface, workerIAM,
+			windowsUserData(a.computerName))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	instanceID := *instance.InstanceId
+	span.SetAttributes(attribute.String("instance-id", instanceID))
 
 	// Wait until instance is running and associate a unique name tag to the created instance.
-	err = a.waitUntilInstanceRunning(instanceID)
+	err = op.Phase(ctx, "wait for instance running", func() error {
+		return a.waitUntilInstanceRunning(instanceID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to wait till instance is running, %v", err)
 	}
-	_, err = a.createInstanceNameTag(instance, infraID)
+	instanceName, err := a.createInstanceNameTag(instance, infraID)
 	if err != nil {
 		log.Printf("failed to assign name for instance: %s, %v", instanceID, err)
+		instanceName = instanceID
 	}
 
-	// Get the public IP
-	publicIPAddress, err := a.GetPublicIP(instanceID)
+	// Get the IP the instance is reached through, which is only known once it is running
+	instance, err = a.GetInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	ipAddress, err := a.instanceIP(instance)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get the decrypted password
-	decryptedPassword, err := a.GetPassword(instanceID)
+	var decryptedPassword string
+	err = op.Phase(ctx, "get password", func() error {
+		var err error
+		decryptedPassword, err = a.GetPassword(instanceID)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error with instance creation %v", err)
 	}
@@ -198,24 +316,69 @@ func (a *AwsProvider) CreateWindowsVM() (windowsVM types.WindowsVM, err error) {
 	// Build new credentials structure to be used by other actors. The actor is responsible for checking if
 	// the credentials are being generated properly. This method won't guarantee the existence of credentials
 	// if the VM is spun up
-	credentials := types.NewCredentials(instanceID, publicIPAddress, decryptedPassword, winUser)
+	credentials := types.NewCredentials(instanceID, ipAddress, decryptedPassword, winUser)
 	w.Credentials = credentials
 
+	if a.registerDNS {
+		err = op.Phase(ctx, "register DNS record", func() error {
+			hostname, err := a.registerDNSRecord(instance, instanceName)
+			credentials.SetHostname(hostname)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the Windows VM in the private hosted zone: %v", err)
+		}
+	}
+	if len(a.targetGroupARNs) > 0 {
+		err = op.Phase(ctx, "register with target groups", func() error {
+			return a.registerTargets(instance)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the Windows VM with the load balancer target groups: %v", err)
+		}
+	}
+
 	// Setup Winrm and SSH client so that we can interact with the Windows Object we created
-	if err := w.SetupWinRMClient(); err != nil {
+	err = op.Phase(ctx, "setup WinRM client", w.SetupWinRMClient)
+	if err != nil {
 		return nil, fmt.Errorf("failed to setup winRM client for the Windows VM: %v", err)
 	}
-	// Wait for some time before starting configuring of ssh server. This is to let sshd service be available
-	// in the list of services
-	// TODO: Parse the output of the `Get-Service sshd, ssh-agent` on the Windows node to check if the windows nodes
-	// has those services present
-	time.Sleep(time.Minute)
-	if err := w.ConfigureOpenSSHServer(); err != nil {
+	if a.computerName != "" {
+		// The instance renames itself from its user data and reboots, which has to be done before going on
+		err = op.Phase(ctx, "wait for computer name", func() error {
+			name := a.computerName
+			if name == types.ComputerNamePrivateDNS {
+				name = strings.SplitN(aws.StringValue(instance.PrivateDnsName), ".", 2)[0]
+			}
+			return w.WaitForComputerName(name, computerNameTimeout)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to rename the Windows VM: %v", err)
+		}
+	}
+	err = op.Phase(ctx, "configure OpenSSH server", func() error {
+		// Wait for some time before starting configuring of ssh server. This is to let sshd service be available
+		// in the list of services
+		// TODO: Parse the output of the `Get-Service sshd, ssh-agent` on the Windows node to check if the windows
+		// nodes has those services present
+		clk.Sleep(time.Minute)
+		return w.ConfigureOpenSSHServer()
+	})
+	if err != nil {
 		return w, fmt.Errorf("failed to configure OpenSSHServer on the Windows VM: %v", err)
 	}
-	if err := w.GetSSHClient(); err != nil {
+	err = op.Phase(ctx, "setup SSH client", w.GetSSHClient)
+	if err != nil {
 		return w, fmt.Errorf("failed to get ssh client for the Windows VM created: %v", err)
 	}
+	if !a.windowsUpdate.IsDefault() {
+		err = op.Phase(ctx, "configure Windows Update", func() error {
+			return types.ApplyWindowsUpdatePolicy(w, a.windowsUpdate, windowsUpdateTimeout)
+		})
+		if err != nil {
+			return w, fmt.Errorf("failed to configure Windows Update on the Windows VM: %v", err)
+		}
+	}
 
 	err = resource.AppendInstallerInfo([]string{instanceID}, []string{}, a.resourceTrackerDir)
 	if err != nil {
@@ -225,6 +388,70 @@ func (a *AwsProvider) CreateWindowsVM() (windowsVM types.WindowsVM, err error) {
 	return w, nil
 }
 
+// SetComputerName sets the Windows computer name of the created instances. With types.ComputerNamePrivateDNS, they are
+// named after the host part of their private DNS name, which matches the node name the kubelet registers with.
+func (a *AwsProvider) SetComputerName(name string) error {
+	if err := types.ValidateComputerName(name); err != nil {
+		return err
+	}
+	a.computerName = name
+	return nil
+}
+
+// SetWindowsUpdatePolicy sets the Windows Update policy applied to the created instances once they are reachable over
+// WinRM and ssh. Installing updates may take long and reboot the instances.
+func (a *AwsProvider) SetWindowsUpdatePolicy(policy *types.WindowsUpdatePolicy) {
+	a.windowsUpdate = policy
+}
+
+// SetMetadataOptions sets the hardening of the instance metadata service of the created instances. Requiring tokens
+// requires IMDSv2, which the kubelet cloud provider and the EC2Launch agent of the image must support.
+func (a *AwsProvider) SetMetadataOptions(options *types.MetadataOptions) {
+	a.metadata = options
+}
+
+// instanceMetadataOptions returns the instance metadata options requiring IMDSv2 with the hop limit of the given
+// options, or nil to leave the instance metadata service as configured by AWS
+func instanceMetadataOptions(options *types.MetadataOptions) *ec2.InstanceMetadataOptionsRequest {
+	if options.IsDefault() {
+		return nil
+	}
+	return &ec2.InstanceMetadataOptionsRequest{
+		HttpEndpoint:            aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+		HttpTokens:              aws.String(ec2.HttpTokensStateRequired),
+		HttpPutResponseHopLimit: aws.Int64(int64(options.HopLimit)),
+	}
+}
+
+// windowsUserData returns the user data of the instances: the PowerShell script setting up WinRM for Ansible,
+// installing the OpenSSH server and opening the firewall port 10250, and renaming the instance if a computer name is
+// given. The script is run on every boot.
+func windowsUserData(computerName string) string {
+	rename := ""
+	switch computerName {
+	case "":
+	case types.ComputerNamePrivateDNS:
+		// The private DNS name is only known once the instance is created, so it is read from the metadata service
+		rename = types.RenameComputerScript(`(Invoke-RestMethod -Uri "http://169.254.169.254/latest/meta-data/` +
+			`local-hostname" -Headers @{"X-aws-ec2-metadata-token" = (Invoke-RestMethod -Method Put -Uri ` +
+			`"http://169.254.169.254/latest/api/token" -Headers @{"X-aws-ec2-metadata-token-ttl-seconds" = "60"})})` +
+			`.Split(".")[0]`)
+	default:
+		rename = types.RenameComputerScript(types.QuotedComputerName(computerName))
+	}
+	return `<powershell>
+        $url = "https://raw.githubusercontent.com/ansible/ansible/devel/examples/scripts/ConfigureRemotingForAnsible.ps1"
+        $file = "$env:temp\ConfigureRemotingForAnsible.ps1"
+        (New-Object -TypeName System.Net.WebClient).DownloadFile($url,  $file)
+        & $file
+        Add-WindowsCapability -Online -Name OpenSSH.Server~~~~0.0.1.0
+        New-NetFirewallRule -DisplayName "` + types.FirewallRuleName + `"
+        -Direction Inbound -Action Allow -Protocol TCP -LocalPort ` + types.ContainerLogsPort + ` -EdgeTraversalPolicy Allow
+        ` + rename + `
+        </powershell>
+        <persist>true</persist>`
+}
+
 // GetPublicIP returns the public IP address associated with the instance. Make to sure to call this function
 // after the instance is in running state. Exposing this function to be used in testing later.
 func (a *AwsProvider) GetPublicIP(instanceID string) (string, error) {
@@ -239,7 +466,11 @@ func (a *AwsProvider) GetPublicIP(instanceID string) (string, error) {
 
 // GetPassword returns the password associated with the string. Exposing this to be used in tests later
 func (a *AwsProvider) GetPassword(instanceID string) (string, error) {
-	privateKey, err := ioutil.ReadFile(a.privateKeyPath)
+	privateKeyPath, err := a.privateKeyFile()
+	if err != nil {
+		return "", err
+	}
+	privateKey, err := ioutil.ReadFile(privateKeyPath)
 	if err != nil {
 		return "", err
 	}
@@ -255,6 +486,88 @@ func (a *AwsProvider) GetPassword(instanceID string) (string, error) {
 	return string(decryptedPwd), nil
 }
 
+// getCredentials returns the credentials of the given instance, with the name it is registered with in the private DNS
+// zone of the cluster if any
+func (a *AwsProvider) getCredentials(instanceID string) (*types.Credentials, error) {
+	instance, err := a.GetInstance(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance %s: %v", instanceID, err)
+	}
+	ipAddress, err := a.instanceIP(instance)
+	if err != nil {
+		return nil, err
+	}
+	password, err := a.GetPassword(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting password of instance %s: %v", instanceID, err)
+	}
+	credentials := types.NewCredentials(instanceID, ipAddress, password, winUser)
+	record, err := resource.FindDNSRecord(instanceID, resource.DNSRecordFilePath(a.resourceTrackerDir))
+	if err != nil {
+		return nil, fmt.Errorf("error reading DNS records: %v", err)
+	}
+	if record != nil {
+		credentials.SetHostname(record.Name)
+	}
+	return credentials, nil
+}
+
+// getWindowsClient returns a Windows object with a WinRM client for the given instance
+func (a *AwsProvider) getWindowsClient(instanceID string) (*types.Windows, error) {
+	credentials, err := a.getCredentials(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	w := &types.Windows{Credentials: credentials}
+	if err = w.SetupWinRMClient(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// GetCredentials returns the credentials of the instances recorded in the 'windows-node-installer.json' file
+func (a *AwsProvider) GetCredentials() ([]*types.Credentials, error) {
+	info, err := resource.ReadInstallerInfo(a.resourceTrackerDir)
+	if err != nil {
+		return nil, err
+	}
+	creds := make([]*types.Credentials, 0, len(info.InstanceIDs))
+	for _, instanceID := range info.InstanceIDs {
+		credentials, err := a.getCredentials(instanceID)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, credentials)
+	}
+	return creds, nil
+}
+
+// GetWindowsVM returns the Windows VM object of an existing instance created by wni, to interact with it using SSH and
+// WinRM
+func (a *AwsProvider) GetWindowsVM(instanceID string) (types.WindowsVM, error) {
+	w, err := a.getWindowsClient(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.GetSSHClient(); err != nil {
+		return nil, fmt.Errorf("failed to get ssh client for instance %s: %v", instanceID, err)
+	}
+	return w, nil
+}
+
+// GetNodeName returns the name the node of the given instance registers with, which is the private DNS name of the
+// instance as the kubelet uses the AWS cloud provider
+func (a *AwsProvider) GetNodeName(instanceID string) (string, error) {
+	instance, err := a.GetInstance(instanceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get instance %s: %v", instanceID, err)
+	}
+	if instance.PrivateDnsName == nil || *instance.PrivateDnsName == "" {
+		return "", fmt.Errorf("instance %s has no private DNS name", instanceID)
+	}
+	return *instance.PrivateDnsName, nil
+}
+
 // getDecodedPassword gets the decoded password from the AWS cloud provider API
 func (a *AwsProvider) getDecodedPassword(instanceID string) ([]byte, error) {
 	// The docs within the aws-sdk says
@@ -279,24 +592,23 @@ func (a *AwsProvider) getDecodedPassword(instanceID string) ([]byte, error) {
 // AWS sdk's WaitUntilPasswordDataAvailable is returning inspite of password data being available.
 // So, building this function as a wrapper around AWS sdk's GetPasswordData method with constant back-off
 func (a *AwsProvider) waitUntilPasswordDataIsAvailable(instanceID string) (*ec2.GetPasswordDataOutput, error) {
-	startTime := time.Now()
-	for i := 0; ; i++ {
-		currTime := time.Since(startTime)
-		if currTime >= awsPasswordDataTimeOut {
-			return nil, fmt.Errorf("timed out waiting for password to be available")
-		}
+	var pwdData *ec2.GetPasswordDataOutput
+	options := poll.Options{Interval: durationFactor, Timeout: awsPasswordDataTimeOut, Jitter: poll.DefaultJitter,
+		Clock: clk}
+	err := poll.Until(context.Background(), "the password data of "+instanceID, options, func() (bool, string, error) {
+		var err error
 		// Get the ec2 passworddata output.
-		pwdData, err := a.getPasswordDataOutput(instanceID)
-		if err != nil {
+		if pwdData, err = a.getPasswordDataOutput(instanceID); err != nil {
 			// Eventually we may get succeed, so let's continue till we hit 15 min limit
 			log.Printf("error while getting password: %s", err)
-			continue
-		}
-		if len(*pwdData.PasswordData) > 0 {
-			return pwdData, nil
+			return false, err.Error(), nil
 		}
-		time.Sleep(time.Duration(i) * durationFactor)
+		return len(aws.StringValue(pwdData.PasswordData)) > 0, "the password data is empty", nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return pwdData, nil
 }
 
 // getPasswordData returns the password passworddataoutput, if this returns nil, the password is not yet generated for the
@@ -316,10 +628,9 @@ func (a *AwsProvider) getPasswordDataOutput(instanceID string) (*ec2.GetPassword
 // The keys that Amazon EC2 uses are 2048-bit SSH-2 RSA keys. You can have up to five thousand key pairs per Region.
 // Ref: https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-key-pairs.html
 func rsaDecrypt(decodedEncryptedData, privateKeyBytes []byte) ([]byte, error) {
-	privateKeyBlock, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
+	privateKey, err := keypair.DecodePrivateKey(privateKeyBytes, os.Getenv(keypair.PassphraseEnvVar))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key with %v", err)
+		return nil, err
 	}
 	decryptedPassword, err := rsa.DecryptPKCS1v15(crand.Reader, privateKey, decodedEncryptedData)
 	if err != nil {
@@ -328,6 +639,14 @@ func rsaDecrypt(decodedEncryptedData, privateKeyBytes []byte) ([]byte, error) {
 	return decryptedPassword, nil
 }
 
+// GetRegion returns the region of the EC2 client, which the instances are created in
+func (a *AwsProvider) GetRegion() string {
+	if a.EC2 == nil {
+		return ""
+	}
+	return aws.StringValue(a.EC2.Config.Region)
+}
+
 // GetInfraID returns the infrastructure ID associated with the OpenShift cluster. This is public for
 // testing purposes as of now.
 func (a *AwsProvider) GetInfraID() (string, error) {
@@ -339,8 +658,13 @@ func (a *AwsProvider) GetInfraID() (string, error) {
 }
 
 // DestroyWindowsVMs destroys the created instances and security groups on AWS specified in the
-// 'windows-node-installer.json' file. The security groups still in use by other instances will not be deleted.
-func (a *AwsProvider) DestroyWindowsVMs() error {
+// 'windows-node-installer.json' file. The security groups still in use by other instances will not be deleted. The
+// instances are terminated in parallel batches and their termination is verified, and a *DestroyError listing the
+// resources left behind is returned if some could not be deleted.
+func (a *AwsProvider) DestroyWindowsVMs() (err error) {
+	ctx, span := tracing.Start(tracing.Context(), "DestroyWindowsVMs")
+	defer func() { tracing.End(span, err) }()
+
 	// Read from `windows-node-installer.json` file.
 	log.Printf("processing file '%s'", a.resourceTrackerDir)
 	destroyList, err := resource.ReadInstallerInfo(a.resourceTrackerDir)
@@ -348,24 +672,24 @@ func (a *AwsProvider) DestroyWindowsVMs() error {
 		return err
 	}
 
-	var terminatedInstances, deletedSg []string
+	var deletedSg []string
 
-	// Delete all instances from the json file.
-	for _, instanceID := range destroyList.InstanceIDs {
-		err = a.TerminateInstance(instanceID)
-		if err != nil {
-			log.Printf("failed to terminate instance %s: %s", instanceID, err)
-		}
-	}
-	// Wait for instances termination after they are initiated.
-	for _, instanceID := range destroyList.InstanceIDs {
-		err = a.waitUntilInstanceTerminated(instanceID)
-		if err != nil {
-			log.Printf("timeout waiting for instance %s to terminate: %s", instanceID, err)
-		} else {
-			terminatedInstances = append(terminatedInstances, instanceID)
-		}
-	}
+	// Deregister the instances from their load balancer target groups first, so that the load balancers stop sending
+	// them traffic and IP targets do not outlive them.
+	a.deregisterTargets(destroyList.InstanceIDs)
+
+	// Terminate the instances in parallel batches, verifying that they and their network interfaces are gone and
+	// retrying the stragglers, so that partial destroys are reported rather than leaving billable resources behind.
+	_, terminateSpan := tracing.Start(ctx, "terminate instances")
+	terminatedInstances, leftovers := a.terminateInstances(destroyList.InstanceIDs)
+	tracing.End(terminateSpan, nil)
+
+	// Revoke the debug access opened to the terminated instances, as the security group rules would outlive them.
+	a.revokeDebugAccessOfInstances(terminatedInstances)
+	// Remove the DNS records of the terminated instances, so that their names do not resolve to reused addresses.
+	a.deregisterDNSRecords(terminatedInstances)
+	// Delete the snapshots of the terminated instances, which are billed until deleted.
+	a.deleteSnapshotsOfInstances(terminatedInstances)
 
 	// Delete security groups after associated instances are terminated.
 	for _, sgID := range destroyList.SecurityGroupIDs {
@@ -378,10 +702,14 @@ func (a *AwsProvider) DestroyWindowsVMs() error {
 	}
 
 	// Update 'windows-node-installer.json' file.
-	err = resource.RemoveInstallerInfo(terminatedInstances, deletedSg, a.resourceTrackerDir)
-	if err != nil {
+	if err := resource.RemoveInstallerInfo(terminatedInstances, deletedSg, a.resourceTrackerDir); err != nil {
 		log.Printf("%s file was not updated: %s", a.resourceTrackerDir, err)
 	}
+	// Delete the generated key pair once the last instance using it is terminated.
+	a.deleteGeneratedKeyPair()
+	if len(leftovers) > 0 {
+		return &DestroyError{Leftovers: leftovers}
+	}
 	return nil
 }
 
@@ -397,21 +725,46 @@ func (a *AwsProvider) getNetworkInterface(infraID string) (*ec2.InstanceNetworkI
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cluster worker security group, %v", err)
 	}
-	publicSubnetID, err := a.getPublicSubnetId(infraID, vpc)
+	private, err := a.usePrivateIP()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get a Public subnet, %v", err)
+		return nil, err
+	}
+	// Without public IP, the instance is created in a private subnet, like the Linux workers
+	visibility := "public"
+	if private {
+		visibility = "private"
+	}
+	subnet, err := a.getSubnet(infraID, vpc, visibility)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a %s subnet, %v", visibility, err)
 	}
 	sgID, err := a.handleSg(infraID, vpc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Windows worker security group, %v", err)
 	}
-	return &ec2.InstanceNetworkInterfaceSpecification{
-		AssociatePublicIpAddress: aws.Bool(true),
+	networkInterface := &ec2.InstanceNetworkInterfaceSpecification{
+		AssociatePublicIpAddress: aws.Bool(!private),
 		DeleteOnTermination:      aws.Bool(true),
 		DeviceIndex:              aws.Int64(0),
 		Groups:                   aws.StringSlice([]string{workerSG, sgID}),
-		SubnetId:                 aws.String(publicSubnetID),
-	}, nil
+		SubnetId:                 subnet.SubnetId,
+	}
+	// The instances of a dual-stack cluster get an IPv6 address along with their IPv4 one, like the Linux workers
+	if subnetHasIPv6(subnet) {
+		networkInterface.Ipv6AddressCount = aws.Int64(1)
+	}
+	return networkInterface, nil
+}
+
+// subnetHasIPv6 returns true if an IPv6 CIDR block is associated with the subnet
+func subnetHasIPv6(subnet *ec2.Subnet) bool {
+	for _, association := range subnet.Ipv6CidrBlockAssociationSet {
+		if association.Ipv6CidrBlockState != nil &&
+			aws.StringValue(association.Ipv6CidrBlockState.State) == ec2.SubnetCidrBlockStateCodeAssociated {
+			return true
+		}
+	}
+	return false
 }
 
 // createInstance creates one VM instance based on the given information and returns a instance struct with all its
@@ -429,6 +782,7 @@ func (a *AwsProvider) createInstance(imageID, instanceType, sshKey string,
 		NetworkInterfaces:  []*ec2.InstanceNetworkInterfaceSpecification{networkInterface},
 		IamInstanceProfile: iamProfile,
 		UserData:           aws.String(base64.StdEncoding.EncodeToString([]byte(userDataInput))),
+		MetadataOptions:    instanceMetadataOptions(a.metadata),
 	})
 	if err != nil {
 		return nil, err
@@ -441,8 +795,36 @@ func (a *AwsProvider) createInstance(imageID, instanceType, sshKey string,
 	return runResult.Instances[0], nil
 }
 
-// getLatestWindowsAMI returns the imageid of the latest released "Windows Server with Containers" image
-func (a *AwsProvider) getLatestWindowsAMI() (string, error) {
+// instanceTypeArchitecture returns the EC2 architecture of the given instance type. The instance types of the AWS
+// Graviton processors are the a1 family and the families with a 'g' following the generation, e.g. m6g or c6gn.
+func instanceTypeArchitecture(instanceType string) string {
+	family := strings.SplitN(instanceType, ".", 2)[0]
+	if family == "a1" || gravitonFamily.MatchString(family) {
+		return ec2.ArchitectureValuesArm64
+	}
+	return ec2.ArchitectureValuesX8664
+}
+
+// validateImageArchitecture returns an error if the architecture of the given image differs from the given one
+func (a *AwsProvider) validateImageArchitecture(imageID, architecture string) error {
+	describedImages, err := a.describeImages(&ec2.DescribeImagesInput{ImageIds: []*string{&imageID}})
+	if err != nil {
+		return fmt.Errorf("could not describe image %s: %v", imageID, err)
+	}
+	if len(describedImages.Images) != 1 {
+		return fmt.Errorf("found %d images with image id %s", len(describedImages.Images), imageID)
+	}
+	imageArchitecture := aws.StringValue(describedImages.Images[0].Architecture)
+	if imageArchitecture != architecture {
+		return fmt.Errorf("image %s is built for %s and cannot be used with instance type %s, which is %s", imageID,
+			imageArchitecture, a.instanceType, architecture)
+	}
+	return nil
+}
+
+// getLatestWindowsAMI returns the imageid of the latest released "Windows Server with Containers" image for the given
+// architecture
+func (a *AwsProvider) getLatestWindowsAMI(architecture string) (string, error) {
 	// Have to create these variables, as the below functions require pointers to them
 	windowsAMIOwner := "amazon"
 	windowsAMIFilterName := "name"
@@ -451,16 +833,17 @@ func (a *AwsProvider) getLatestWindowsAMI() (string, error) {
 	// so the question marks will match the date of creation
 	windowsAMIFilterValue := "Windows_Server-2019-English-Full-ContainersLatest-????.??.??"
 	searchFilter := ec2.Filter{Name: &windowsAMIFilterName, Values: []*string{&windowsAMIFilterValue}}
+	architectureFilter := ec2.Filter{Name: aws.String("architecture"), Values: []*string{&architecture}}
 
-	describedImages, err := a.EC2.DescribeImages(&ec2.DescribeImagesInput{
-		Filters: []*ec2.Filter{&searchFilter},
+	describedImages, err := a.describeImages(&ec2.DescribeImagesInput{
+		Filters: []*ec2.Filter{&searchFilter, &architectureFilter},
 		Owners:  []*string{&windowsAMIOwner},
 	})
 	if err != nil {
 		return "", err
 	}
 	if len(describedImages.Images) < 1 {
-		return "", fmt.Errorf("found zero images matching given filter: %v", searchFilter)
+		return "", fmt.Errorf("found zero %s images matching given filter: %v", architecture, searchFilter)
 	}
 
 	// Find the last created image
@@ -482,6 +865,15 @@ func (a *AwsProvider) getLatestWindowsAMI() (string, error) {
 	return *latestImage.ImageId, nil
 }
 
+// getMyIP calls GetMyIp through the cache, as the public IP does not change during a VM creation
+func (a *AwsProvider) getMyIP() (string, error) {
+	ip, err := a.cache.do("GetMyIp", nil, func() (interface{}, error) { return GetMyIp() })
+	if err != nil {
+		return "", err
+	}
+	return ip.(string), nil
+}
+
 // getInfrastructureVPC gets the VPC of a given infrastructure or returns error.
 func (a *AwsProvider) getInfrastructureVPC(infraID string) (*ec2.Vpc, error) {
 	vpc, err := a.GetVPCByInfrastructure(infraID)
@@ -498,9 +890,20 @@ func (a *AwsProvider) getInfrastructureVPC(infraID string) (*ec2.Vpc, error) {
 // contains all the rules required for RDP and updates them.
 // The function returns security group ID or error for both finding or creating a security group.
 func (a *AwsProvider) handleSg(infraID string, vpc *ec2.Vpc) (string, error) {
-	myIP, err := GetMyIp()
+	private, err := a.usePrivateIP()
 	if err != nil {
-		return "", fmt.Errorf("error getting IP: %s", err)
+		return "", err
+	}
+	// The instances reached through their private IP are only exposed to the VPC
+	myIP := ""
+	if !private {
+		if myIP, err = a.getMyIP(); err != nil {
+			return "", fmt.Errorf("error getting IP: %s", err)
+		}
+	}
+	if a.sgLock != nil {
+		a.sgLock.Lock()
+		defer a.sgLock.Unlock()
 	}
 	sg, err := a.findWindowsWorkerSg(infraID)
 	if err != nil {
@@ -567,6 +970,7 @@ func (a *AwsProvider) verifyAndUpdateSg(myIP string, sg *ec2.SecurityGroup, vpc
 
 	// Get the list of rules to be updated, returns empty list is there are no rules to be updated
 	rules := a.getRulesForSgUpdate(myIP, sg.IpPermissions, *vpc.CidrBlock)
+	rules = append(rules, getIPv6RulesForSgUpdate(sg.IpPermissions, vpc)...)
 
 	// call addIngressRules() only if there are any rules returned from getRulesForSgUpdate()
 	if len(rules) != 0 {
@@ -597,8 +1001,40 @@ func (a *AwsProvider) getRulesForSgUpdate(myIP string, rules []*ec2.IpPermission
 				}))
 	}
 
-	// create a list of rules to be updated in sg
-	rulesForUpdate = append(rulesForUpdate, createRulesFromPorts(ports, myIP)...)
+	// create a list of rules to be updated in sg, unless there is no local IP to open the ports to
+	if myIP != "" {
+		rulesForUpdate = append(rulesForUpdate, createRulesFromPorts(ports, myIP)...)
+	}
+	return rulesForUpdate
+}
+
+// getIPv6RulesForSgUpdate returns the rules allowing all traffic from the IPv6 CIDR blocks of the VPC of a dual-stack
+// cluster that are missing from the given rules
+func getIPv6RulesForSgUpdate(rules []*ec2.IpPermission, vpc *ec2.Vpc) []*ec2.IpPermission {
+	present := make(map[string]bool)
+	for _, rule := range rules {
+		if aws.StringValue(rule.IpProtocol) != "-1" {
+			continue
+		}
+		for _, ips := range rule.Ipv6Ranges {
+			present[aws.StringValue(ips.CidrIpv6)] = true
+		}
+	}
+	rulesForUpdate := make([]*ec2.IpPermission, 0)
+	for _, association := range vpc.Ipv6CidrBlockAssociationSet {
+		cidr := aws.StringValue(association.Ipv6CidrBlock)
+		if cidr == "" || present[cidr] || association.Ipv6CidrBlockState == nil ||
+			aws.StringValue(association.Ipv6CidrBlockState.State) != ec2.VpcCidrBlockStateCodeAssociated {
+			continue
+		}
+		rulesForUpdate = append(rulesForUpdate,
+			(&ec2.IpPermission{}).
+				SetIpProtocol("-1").
+				SetIpv6Ranges([]*ec2.Ipv6Range{
+					(&ec2.Ipv6Range{}).
+						SetCidrIpv6(cidr),
+				}))
+	}
 	return rulesForUpdate
 }
 
@@ -725,7 +1161,7 @@ func (a *AwsProvider) getInstanceZone(instance *ec2.Instance) (string, error) {
 // GetVPCByInfrastructure finds the VPC of an infrastructure and returns the VPC struct or an error.
 // This function is exposed for testing purpose.
 func (a *AwsProvider) GetVPCByInfrastructure(infraID string) (*ec2.Vpc, error) {
-	res, err := a.EC2.DescribeVpcs(&ec2.DescribeVpcsInput{
+	res, err := a.describeVpcs(&ec2.DescribeVpcsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("tag:" + infraIDTagKeyPrefix + infraID),
@@ -748,11 +1184,11 @@ func (a *AwsProvider) GetVPCByInfrastructure(infraID string) (*ec2.Vpc, error) {
 	return res.Vpcs[0], nil
 }
 
-// getPublicSubnetId tries to find a public subnet under the VPC and returns subnet id or an error.
-// These subnets belongs to the OpenShift cluster.
-func (a *AwsProvider) getPublicSubnetId(infraID string, vpc *ec2.Vpc) (string, error) {
+// getSubnet tries to find a subnet of the given visibility, public or private, under the VPC and returns it or an
+// error. These subnets belongs to the OpenShift cluster.
+func (a *AwsProvider) getSubnet(infraID string, vpc *ec2.Vpc, visibility string) (*ec2.Subnet, error) {
 	// search subnet by the vpcid owned by the vpcID
-	subnets, err := a.EC2.DescribeSubnets(&ec2.DescribeSubnetsInput{
+	subnets, err := a.describeSubnets(&ec2.DescribeSubnetsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("vpc-id"),
@@ -761,14 +1197,14 @@ func (a *AwsProvider) getPublicSubnetId(infraID string, vpc *ec2.Vpc) (string, e
 		},
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Get the instance offerings that support Windows instances
 	scope := "Availability Zone"
 	productDescription := "Windows"
 	f := false
-	offerings, err := a.EC2.DescribeReservedInstancesOfferings(&ec2.DescribeReservedInstancesOfferingsInput{
+	offerings, err := a.describeReservedInstancesOfferings(&ec2.DescribeReservedInstancesOfferingsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("scope"),
@@ -780,38 +1216,38 @@ func (a *AwsProvider) getPublicSubnetId(infraID string, vpc *ec2.Vpc) (string, e
 		ProductDescription: &productDescription,
 	})
 	if err != nil {
-		return "", fmt.Errorf("error checking instance offerings of %s: %v", a.instanceType, err)
+		return nil, fmt.Errorf("error checking instance offerings of %s: %v", a.instanceType, err)
 	}
 	if offerings.ReservedInstancesOfferings == nil {
-		return "", fmt.Errorf("no instance offerings returned for %s", a.instanceType)
+		return nil, fmt.Errorf("no instance offerings returned for %s", a.instanceType)
 	}
 
-	// Finding public subnet within the vpc.
-	foundPublicSubnet := false
+	// Finding subnet of the visibility within the vpc.
+	foundSubnet := false
 	for _, subnet := range subnets.Subnets {
 		for _, tag := range subnet.Tags {
 			// TODO: find public subnet by checking igw gateway in routing.
-			if *tag.Key == "Name" && strings.Contains(*tag.Value, infraID+"-public-") {
-				foundPublicSubnet = true
+			if *tag.Key == "Name" && strings.Contains(*tag.Value, infraID+"-"+visibility+"-") {
+				foundSubnet = true
 				// Ensure that the instance type we want is supported in the zone that the subnet is in
 				for _, instanceOffering := range offerings.ReservedInstancesOfferings {
 					if instanceOffering.AvailabilityZone == nil {
 						continue
 					}
 					if *instanceOffering.AvailabilityZone == *subnet.AvailabilityZone {
-						return *subnet.SubnetId, nil
+						return subnet, nil
 					}
 				}
 			}
 		}
 	}
 
-	err = fmt.Errorf("could not find a public subnet in VPC: %v", *vpc.VpcId)
-	if !foundPublicSubnet {
-		err = fmt.Errorf("could not find a public subnet in a zone that supports %s instance type",
-			a.instanceType)
+	err = fmt.Errorf("could not find a %s subnet in a zone that supports %s instance type", visibility,
+		a.instanceType)
+	if !foundSubnet {
+		err = fmt.Errorf("could not find a %s subnet in VPC: %v", visibility, *vpc.VpcId)
 	}
-	return "", err
+	return nil, err
 }
 
 // GetInstance gets instance ec2 instance object from the given instanceID. We're making this method public
@@ -833,7 +1269,7 @@ func (a *AwsProvider) GetInstance(instanceID string) (*ec2.Instance, error) {
 // GetClusterWorkerSGID gets worker security group id from the existing cluster or returns an error.
 // This function is exposed for testing purpose.
 func (a *AwsProvider) GetClusterWorkerSGID(infraID string) (string, error) {
-	sg, err := a.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+	sg, err := a.describeClusterSecurityGroups(&ec2.DescribeSecurityGroupsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("tag:Name"),
@@ -857,7 +1293,7 @@ func (a *AwsProvider) GetClusterWorkerSGID(infraID string) (string, error) {
 // GetIAMWorkerRole gets worker IAM information from the existing cluster including IAM arn or an error.
 // This function is exposed for testing purpose.
 func (a *AwsProvider) GetIAMWorkerRole(infraID string) (*ec2.IamInstanceProfileSpecification, error) {
-	iamspc, err := a.IAM.GetInstanceProfile(&iam.GetInstanceProfileInput{
+	iamspc, err := a.getInstanceProfile(&iam.GetInstanceProfileInput{
 		InstanceProfileName: aws.String(fmt.Sprintf("%s-worker-profile", infraID)),
 	})
 	if err != nil {
@@ -5,9 +5,22 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/clock"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -152,3 +165,186 @@ func TestGetRulesForSgUpdate(t *testing.T) {
 		assert.ElementsMatch(t, tt.expected, actual, tt.name, "awsProvider.getRulesForSgUpdate(), actual values do not match expected")
 	}
 }
+
+// TestGetIPv6RulesForSgUpdate tests that the traffic from the IPv6 CIDR blocks of the VPC of a dual-stack cluster is
+// allowed
+func TestGetIPv6RulesForSgUpdate(t *testing.T) {
+	association := func(cidr, state string) *ec2.VpcIpv6CidrBlockAssociation {
+		return (&ec2.VpcIpv6CidrBlockAssociation{}).SetIpv6CidrBlock(cidr).
+			SetIpv6CidrBlockState((&ec2.VpcCidrBlockState{}).SetState(state))
+	}
+	ipv6Rule := func(cidr string) *ec2.IpPermission {
+		return (&ec2.IpPermission{}).SetIpProtocol("-1").
+			SetIpv6Ranges([]*ec2.Ipv6Range{(&ec2.Ipv6Range{}).SetCidrIpv6(cidr)})
+	}
+	vpc := (&ec2.Vpc{}).SetIpv6CidrBlockAssociationSet([]*ec2.VpcIpv6CidrBlockAssociation{
+		association("2600:1f18:1234:5600::/56", ec2.VpcCidrBlockStateCodeAssociated),
+		association("2600:1f18:1234:5700::/56", ec2.VpcCidrBlockStateCodeDisassociated),
+	})
+
+	assert.Equal(t, []*ec2.IpPermission{ipv6Rule("2600:1f18:1234:5600::/56")},
+		getIPv6RulesForSgUpdate([]*ec2.IpPermission{getAllPortRule("10.0.0.0/16")}, vpc))
+	assert.Empty(t, getIPv6RulesForSgUpdate([]*ec2.IpPermission{ipv6Rule("2600:1f18:1234:5600::/56")}, vpc),
+		"the rule is already present")
+	assert.Empty(t, getIPv6RulesForSgUpdate(nil, &ec2.Vpc{}), "an IPv4 VPC needs no IPv6 rule")
+}
+
+// TestSubnetHasIPv6 tests that the instances get an IPv6 address in the subnets with an IPv6 CIDR block
+func TestSubnetHasIPv6(t *testing.T) {
+	subnet := func(state string) *ec2.Subnet {
+		return (&ec2.Subnet{}).SetIpv6CidrBlockAssociationSet([]*ec2.SubnetIpv6CidrBlockAssociation{
+			(&ec2.SubnetIpv6CidrBlockAssociation{}).SetIpv6CidrBlock("2600:1f18:1234:5600::/64").
+				SetIpv6CidrBlockState((&ec2.SubnetCidrBlockState{}).SetState(state)),
+		})
+	}
+	assert.True(t, subnetHasIPv6(subnet(ec2.SubnetCidrBlockStateCodeAssociated)))
+	assert.False(t, subnetHasIPv6(subnet(ec2.SubnetCidrBlockStateCodeDisassociating)))
+	assert.False(t, subnetHasIPv6(&ec2.Subnet{}))
+}
+
+// TestInstanceTypeArchitecture tests that the architecture of the instance types is detected
+func TestInstanceTypeArchitecture(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		expected     string
+	}{
+		{"m5a.large", ec2.ArchitectureValuesX8664},
+		{"m4.xlarge", ec2.ArchitectureValuesX8664},
+		{"g4dn.xlarge", ec2.ArchitectureValuesX8664},
+		{"a1.large", ec2.ArchitectureValuesArm64},
+		{"m6g.large", ec2.ArchitectureValuesArm64},
+		{"c6gn.2xlarge", ec2.ArchitectureValuesArm64},
+		{"t4g.micro", ec2.ArchitectureValuesArm64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.instanceType, func(t *testing.T) {
+			assert.Equal(t, tt.expected, instanceTypeArchitecture(tt.instanceType))
+		})
+	}
+}
+
+// TestHasIngressRule tests that existing RDP rules for a CIDR are detected in the security group rules
+func TestHasIngressRule(t *testing.T) {
+	rules := append(createRDPRules("10.0.0.0/16"), createRulesFromPorts([]int64{WINRM_PORT}, "192.168.1.1")...)
+	rules = append(rules, (&ec2.IpPermission{}).SetIpProtocol("-1").
+		SetIpRanges([]*ec2.IpRange{(&ec2.IpRange{}).SetCidrIp("172.16.0.0/16")}))
+	tests := []struct {
+		name     string
+		cidr     string
+		expected bool
+	}{
+		{"RDP rule for the CIDR", "10.0.0.0/16", true},
+		{"rule for another port", "192.168.1.1/32", false},
+		{"all traffic rule", "172.16.0.0/16", false},
+		{"no rule", "10.1.0.0/16", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, hasIngressRule(rules, rdpPort, tt.cidr))
+		})
+	}
+	assert.Equal(t, "wni-debug-rdp-10.0.0.0-16", debugFirewallRuleName("10.0.0.0/16"))
+	assert.Equal(t, "wni-debug-rdp-2001-db8---32", debugFirewallRuleName("2001:db8::/32"))
+}
+
+// TestSecurityGroupRuleInUse tests that the security group rule of a debug access is in use as long as the debug access
+// of another instance from the same CIDR records it
+func TestSecurityGroupRuleInUse(t *testing.T) {
+	access := resource.DebugAccess{InstanceID: "i-1", CIDR: "10.0.0.0/16", SecurityGroupID: "sg-1"}
+	tests := []struct {
+		name     string
+		records  []resource.DebugAccess
+		expected bool
+	}{
+		{"only record", []resource.DebugAccess{access}, false},
+		{"other instance", []resource.DebugAccess{access, {InstanceID: "i-2", CIDR: "10.0.0.0/16",
+			SecurityGroupID: "sg-1"}}, true},
+		{"other instance with a pre-existing rule", []resource.DebugAccess{access, {InstanceID: "i-2",
+			CIDR: "10.0.0.0/16"}}, false},
+		{"other CIDR", []resource.DebugAccess{access, {InstanceID: "i-2", CIDR: "10.1.0.0/16",
+			SecurityGroupID: "sg-1"}}, false},
+		{"other security group", []resource.DebugAccess{access, {InstanceID: "i-2", CIDR: "10.0.0.0/16",
+			SecurityGroupID: "sg-2"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, securityGroupRuleInUse(tt.records, access))
+		})
+	}
+	assert.False(t, securityGroupRuleInUse([]resource.DebugAccess{{InstanceID: "i-2", CIDR: "10.0.0.0/16"}},
+		resource.DebugAccess{InstanceID: "i-1", CIDR: "10.0.0.0/16"}))
+}
+
+// TestWindowsUserData tests that the instances are only renamed if a computer name is given, and that they read their
+// private DNS name from the metadata service
+func TestWindowsUserData(t *testing.T) {
+	assert.NotContains(t, windowsUserData(""), "Rename-Computer")
+	assert.Contains(t, windowsUserData("winworker-abcd"), `$computerName = "winworker-abcd"`)
+	userData := windowsUserData(types.ComputerNamePrivateDNS)
+	assert.Contains(t, userData, "Rename-Computer")
+	assert.Contains(t, userData, "latest/meta-data/local-hostname")
+	assert.True(t, strings.HasSuffix(userData, "<persist>true</persist>"))
+
+	a := &AwsProvider{}
+	assert.Error(t, a.SetComputerName("win_worker"))
+	require.NoError(t, a.SetComputerName(types.ComputerNamePrivateDNS))
+	assert.Equal(t, types.ComputerNamePrivateDNS, a.computerName)
+}
+
+// TestInstanceMetadataOptions tests that IMDSv2 is only required with the hop limit of the metadata options when
+// tokens are required
+func TestInstanceMetadataOptions(t *testing.T) {
+	assert.Nil(t, instanceMetadataOptions(nil))
+	assert.Nil(t, instanceMetadataOptions(&types.MetadataOptions{HopLimit: 2}))
+
+	options := instanceMetadataOptions(&types.MetadataOptions{RequireTokens: true, HopLimit: 2})
+	require.NotNil(t, options)
+	assert.Equal(t, ec2.HttpTokensStateRequired, aws.StringValue(options.HttpTokens))
+	assert.Equal(t, ec2.InstanceMetadataEndpointStateEnabled, aws.StringValue(options.HttpEndpoint))
+	assert.Equal(t, int64(2), aws.Int64Value(options.HttpPutResponseHopLimit))
+}
+
+// TestWaitUntilPasswordDataIsAvailable tests that the password data is polled with a growing back-off until it is
+// available or the timeout expires, on a fake clock
+func TestWaitUntilPasswordDataIsAvailable(t *testing.T) {
+	defer func(c clock.Clock) { clk = c }(clk)
+	availableAfter := 3
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		passwordData := ""
+		if availableAfter > 0 && calls >= availableAfter {
+			passwordData = "encrypted"
+		}
+		fmt.Fprintf(w, `<GetPasswordDataResponse><instanceId>i-0123456789abcdef0</instanceId>`+
+			`<passwordData>%s</passwordData></GetPasswordDataResponse>`, passwordData)
+	}))
+	defer server.Close()
+	session, err := awssession.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+	})
+	require.NoError(t, err)
+	a := &AwsProvider{EC2: ec2.New(session)}
+
+	fake := clock.NewFake(time.Now())
+	clk = fake
+	output, err := a.waitUntilPasswordDataIsAvailable("i-0123456789abcdef0")
+	require.NoError(t, err)
+	assert.Equal(t, "encrypted", aws.StringValue(output.PasswordData))
+	sleeps := fake.Sleeps()
+	require.Len(t, sleeps, 2)
+	for _, sleep := range sleeps {
+		assert.True(t, sleep >= durationFactor && sleep <= durationFactor+durationFactor/10, "slept %v", sleep)
+	}
+
+	availableAfter, calls = 0, 0
+	fake = clock.NewFake(time.Now())
+	clk = fake
+	_, err = a.waitUntilPasswordDataIsAvailable("i-0123456789abcdef0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Contains(t, err.Error(), "the password data is empty")
+	assert.True(t, fake.Slept() >= awsPasswordDataTimeOut, "slept %v", fake.Slept())
+}
@@ -0,0 +1,152 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/export"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+// Export describes the instances and security groups recorded in the 'windows-node-installer.json' file, the key
+// pairs of the instances and their DNS records, as they currently are on AWS
+func (a *AwsProvider) Export() (*export.Infrastructure, error) {
+	info, err := resource.ReadInstallerInfo(a.resourceTrackerDir)
+	if err != nil {
+		return nil, err
+	}
+	infra := &export.Infrastructure{Provider: "aws", Region: aws.StringValue(a.EC2.Config.Region)}
+
+	keyNames := make(map[string]bool)
+	if len(info.InstanceIDs) > 0 {
+		output, err := a.EC2.DescribeInstances(&ec2.DescribeInstancesInput{
+			InstanceIds: aws.StringSlice(info.InstanceIDs),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing instances %v: %v", info.InstanceIDs, err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated {
+					continue
+				}
+				infra.Instances = append(infra.Instances, exportInstance(instance))
+				if instance.KeyName != nil {
+					keyNames[*instance.KeyName] = true
+				}
+			}
+		}
+	}
+
+	if len(info.SecurityGroupIDs) > 0 {
+		output, err := a.EC2.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: aws.StringSlice(info.SecurityGroupIDs),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing security groups %v: %v", info.SecurityGroupIDs, err)
+		}
+		for _, sg := range output.SecurityGroups {
+			infra.SecurityGroups = append(infra.SecurityGroups, exportSecurityGroup(sg))
+		}
+	}
+
+	if len(keyNames) > 0 {
+		names := make([]string, 0, len(keyNames))
+		for name := range keyNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		output, err := a.EC2.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice(names)})
+		if err != nil {
+			return nil, fmt.Errorf("error describing key pairs %v: %v", names, err)
+		}
+		for _, keyPair := range output.KeyPairs {
+			infra.KeyPairs = append(infra.KeyPairs, export.KeyPair{
+				Name:        aws.StringValue(keyPair.KeyName),
+				Fingerprint: aws.StringValue(keyPair.KeyFingerprint),
+			})
+		}
+	}
+
+	records, err := resource.ReadDNSRecords(resource.DNSRecordFilePath(a.resourceTrackerDir))
+	if err != nil {
+		return nil, fmt.Errorf("error reading DNS records: %v", err)
+	}
+	for _, record := range records {
+		infra.DNSRecords = append(infra.DNSRecords, export.DNSRecord{
+			InstanceID: record.InstanceID,
+			Name:       record.Name,
+			ZoneID:     record.ZoneID,
+			IPAddress:  record.IPAddress,
+			TTL:        record.TTL,
+		})
+	}
+	return infra, nil
+}
+
+// exportInstance returns the description of the given instance
+func exportInstance(instance *ec2.Instance) export.Instance {
+	exported := export.Instance{
+		ID:               aws.StringValue(instance.InstanceId),
+		ImageID:          aws.StringValue(instance.ImageId),
+		InstanceType:     aws.StringValue(instance.InstanceType),
+		SubnetID:         aws.StringValue(instance.SubnetId),
+		KeyName:          aws.StringValue(instance.KeyName),
+		PrivateIPAddress: aws.StringValue(instance.PrivateIpAddress),
+		PublicIPAddress:  aws.StringValue(instance.PublicIpAddress),
+		Tags:             exportTags(instance.Tags),
+	}
+	for _, sg := range instance.SecurityGroups {
+		exported.SecurityGroupIDs = append(exported.SecurityGroupIDs, aws.StringValue(sg.GroupId))
+	}
+	if instance.IamInstanceProfile != nil {
+		exported.IAMInstanceProfile = aws.StringValue(instance.IamInstanceProfile.Arn)
+	}
+	return exported
+}
+
+// exportSecurityGroup returns the description of the given security group, with a rule per permission
+func exportSecurityGroup(sg *ec2.SecurityGroup) export.SecurityGroup {
+	exported := export.SecurityGroup{
+		ID:          aws.StringValue(sg.GroupId),
+		Name:        aws.StringValue(sg.GroupName),
+		Description: aws.StringValue(sg.Description),
+		VPCID:       aws.StringValue(sg.VpcId),
+		Tags:        exportTags(sg.Tags),
+	}
+	// Each address range and source security group of a permission gets its own rule, with its own description
+	for _, permission := range sg.IpPermissions {
+		rule := export.Rule{
+			Protocol: aws.StringValue(permission.IpProtocol),
+			FromPort: aws.Int64Value(permission.FromPort),
+			ToPort:   aws.Int64Value(permission.ToPort),
+		}
+		for _, ipRange := range permission.IpRanges {
+			rangeRule := rule
+			rangeRule.CIDRBlocks = []string{aws.StringValue(ipRange.CidrIp)}
+			rangeRule.Description = aws.StringValue(ipRange.Description)
+			exported.Ingress = append(exported.Ingress, rangeRule)
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			pairRule := rule
+			pairRule.SecurityGroupIDs = []string{aws.StringValue(pair.GroupId)}
+			pairRule.Description = aws.StringValue(pair.Description)
+			exported.Ingress = append(exported.Ingress, pairRule)
+		}
+	}
+	return exported
+}
+
+// exportTags returns the given tags as a map, nil if there are none
+func exportTags(tags []*ec2.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	exported := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		exported[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return exported
+}
@@ -0,0 +1,50 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/export"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExportSecurityGroup tests that each address range and source security group of a permission is exported as its
+// own rule
+func TestExportSecurityGroup(t *testing.T) {
+	sg := &ec2.SecurityGroup{
+		GroupId:     aws.String("sg-0a1b2c3d"),
+		GroupName:   aws.String("cluster-x7k2p-windows-worker-sg"),
+		Description: aws.String("Security group for Windows workers"),
+		VpcId:       aws.String("vpc-0a1b2c3d"),
+		IpPermissions: []*ec2.IpPermission{
+			{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(5986),
+				ToPort:     aws.Int64(5986),
+				IpRanges: []*ec2.IpRange{
+					{CidrIp: aws.String("203.0.113.10/32"), Description: aws.String("WinRM")},
+					{CidrIp: aws.String("10.0.0.0/16")},
+				},
+			},
+			{
+				IpProtocol:       aws.String("-1"),
+				UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-0a1b2c3d")}},
+			},
+		},
+		Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("cluster-x7k2p-windows-worker-sg")}},
+	}
+	assert.Equal(t, export.SecurityGroup{
+		ID:          "sg-0a1b2c3d",
+		Name:        "cluster-x7k2p-windows-worker-sg",
+		Description: "Security group for Windows workers",
+		VPCID:       "vpc-0a1b2c3d",
+		Ingress: []export.Rule{
+			{Protocol: "tcp", FromPort: 5986, ToPort: 5986, CIDRBlocks: []string{"203.0.113.10/32"},
+				Description: "WinRM"},
+			{Protocol: "tcp", FromPort: 5986, ToPort: 5986, CIDRBlocks: []string{"10.0.0.0/16"}},
+			{Protocol: "-1", SecurityGroupIDs: []string{"sg-0a1b2c3d"}},
+		},
+		Tags: map[string]string{"Name": "cluster-x7k2p-windows-worker-sg"},
+	}, exportSecurityGroup(sg))
+}
@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/keypair"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// ensureKeyPair selects the key pair the instances are created with when no existing key pair is given: the key pair
+// generated for the resource tracker directory, which is generated on first use and shared by the instances recorded
+// in the directory
+func (a *AwsProvider) ensureKeyPair() error {
+	if a.sshKey != "" {
+		return nil
+	}
+	keyPair, err := resource.ReadKeyPair(resource.KeyPairFilePath(a.resourceTrackerDir))
+	if err != nil {
+		return fmt.Errorf("error reading key pair record: %v", err)
+	}
+	if keyPair == nil {
+		if keyPair, err = a.generateKeyPair(); err != nil {
+			return err
+		}
+	}
+	a.sshKey = keyPair.Name
+	a.privateKeyPath = resource.PrivateKeyFilePath(a.resourceTrackerDir, keyPair.PrivateKeyFile)
+	return nil
+}
+
+// generateKeyPair generates a key pair named after the infrastructure ID of the cluster and imports it, storing its
+// private key next to the 'windows-node-installer.json' file encrypted with the passphrase of the WNI_KEY_PASSPHRASE
+// environment variable. The key pair recorded by another process sharing the directory in the meantime is used
+// instead, if any.
+func (a *AwsProvider) generateKeyPair() (*resource.KeyPair, error) {
+	passphrase := os.Getenv(keypair.PassphraseEnvVar)
+	if passphrase == "" {
+		return nil, fmt.Errorf("no existing key pair given, set %s to the passphrase to encrypt the private key of "+
+			"the generated key pair with", keypair.PassphraseEnvVar)
+	}
+	infraID, err := a.GetInfraID()
+	if err != nil {
+		return nil, err
+	}
+	key, err := keypair.Generate()
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := keypair.EncryptPrivateKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := keypair.AuthorizedKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-wni-%s", infraID, rand.String(5))
+	record := resource.KeyPair{Name: name, PrivateKeyFile: name + ".pem", Created: time.Now().UTC()}
+	privateKeyPath := resource.PrivateKeyFilePath(a.resourceTrackerDir, record.PrivateKeyFile)
+	if err = ioutil.WriteFile(privateKeyPath, privateKey, 0600); err != nil {
+		return nil, fmt.Errorf("error writing private key of key pair %s: %v", name, err)
+	}
+	_, err = a.EC2.ImportKeyPair(&ec2.ImportKeyPairInput{KeyName: aws.String(name), PublicKeyMaterial: publicKey})
+	if err != nil {
+		os.Remove(privateKeyPath)
+		return nil, fmt.Errorf("error importing key pair %s: %v", name, err)
+	}
+
+	filePath := resource.KeyPairFilePath(a.resourceTrackerDir)
+	if err = resource.StoreKeyPair(record, filePath); err != nil {
+		if deleteErr := a.deleteKeyPair(record); deleteErr != nil {
+			log.Printf("failed to delete key pair %s: %v", name, deleteErr)
+		}
+		existing, readErr := resource.ReadKeyPair(filePath)
+		if readErr != nil || existing == nil {
+			return nil, fmt.Errorf("failed to record key pair %s: %v", name, err)
+		}
+		return existing, nil
+	}
+	log.Printf("generated key pair %s, its private key is stored encrypted in %s", name, privateKeyPath)
+	return &record, nil
+}
+
+// privateKeyFile returns the path of the private key decrypting the password of the instances: the given private key,
+// or the private key of the key pair generated for the resource tracker directory
+func (a *AwsProvider) privateKeyFile() (string, error) {
+	if a.privateKeyPath != "" {
+		return a.privateKeyPath, nil
+	}
+	keyPair, err := resource.ReadKeyPair(resource.KeyPairFilePath(a.resourceTrackerDir))
+	if err != nil {
+		return "", fmt.Errorf("error reading key pair record: %v", err)
+	}
+	if keyPair == nil {
+		return "", fmt.Errorf("no private key given and no key pair was generated in the directory of %s",
+			a.resourceTrackerDir)
+	}
+	return resource.PrivateKeyFilePath(a.resourceTrackerDir, keyPair.PrivateKeyFile), nil
+}
+
+// deleteGeneratedKeyPair deletes the key pair generated for the resource tracker directory and its private key once
+// no instance is recorded in the 'windows-node-installer.json' file
+func (a *AwsProvider) deleteGeneratedKeyPair() {
+	info, err := resource.ReadInstallerInfo(a.resourceTrackerDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("error reading %s: %v", a.resourceTrackerDir, err)
+		return
+	}
+	if info != nil && len(info.InstanceIDs) > 0 {
+		return
+	}
+	filePath := resource.KeyPairFilePath(a.resourceTrackerDir)
+	keyPair, err := resource.ReadKeyPair(filePath)
+	if err != nil {
+		log.Printf("error reading key pair record: %v", err)
+		return
+	}
+	if keyPair == nil {
+		return
+	}
+	if err = a.deleteKeyPair(*keyPair); err != nil {
+		log.Printf("failed to delete key pair %s: %v", keyPair.Name, err)
+		return
+	}
+	if err = resource.RemoveKeyPair(filePath); err != nil {
+		log.Printf("%s file was not updated: %v", filePath, err)
+	}
+}
+
+// deleteKeyPair deletes the given generated key pair and its private key
+func (a *AwsProvider) deleteKeyPair(keyPair resource.KeyPair) error {
+	if _, err := a.EC2.DeleteKeyPair(&ec2.DeleteKeyPairInput{KeyName: aws.String(keyPair.Name)}); err != nil {
+		return err
+	}
+	privateKeyPath := resource.PrivateKeyFilePath(a.resourceTrackerDir, keyPair.PrivateKeyFile)
+	if err := os.Remove(privateKeyPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting private key %s: %v", privateKeyPath, err)
+	}
+	return nil
+}
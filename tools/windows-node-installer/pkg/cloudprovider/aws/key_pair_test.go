@@ -0,0 +1,36 @@
+package aws
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrivateKeyFile tests that the given private key takes precedence over the private key of the generated key pair
+func TestPrivateKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+	a := &AwsProvider{resourceTrackerDir: filepath.Join(dir, "windows-node-installer.json")}
+
+	_, err = a.privateKeyFile()
+	assert.Error(t, err, "no private key is available without key pair")
+
+	keyPair := resource.KeyPair{Name: "mycluster-wni-abcde", PrivateKeyFile: "mycluster-wni-abcde.pem",
+		Created: time.Now()}
+	require.NoError(t, resource.StoreKeyPair(keyPair, resource.KeyPairFilePath(a.resourceTrackerDir)))
+	privateKeyPath, err := a.privateKeyFile()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "mycluster-wni-abcde.pem"), privateKeyPath)
+
+	a.privateKeyPath = "/home/user/.ssh/libra.pem"
+	privateKeyPath, err = a.privateKeyFile()
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/.ssh/libra.pem", privateKeyPath)
+}
@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+const (
+	// elbService is the service of the ARNs of the load balancer target groups
+	elbService = "elasticloadbalancing"
+	// targetGroupResourcePrefix is the prefix of the resource of the ARNs of the load balancer target groups
+	targetGroupResourcePrefix = "targetgroup/"
+)
+
+// SetLoadBalancerTargets sets the ARNs of the existing target groups of application or network load balancers the
+// created instances are registered with, as the machine API does for the machines of a machine set. The instances
+// are deregistered before they are terminated. An error is returned if an ARN is not the one of a target group in the
+// region of the cluster.
+func (a *AwsProvider) SetLoadBalancerTargets(targets []string) error {
+	a.targetGroupARNs = nil
+	for _, target := range targets {
+		if err := validateTargetGroupARN(target, a.GetRegion()); err != nil {
+			return err
+		}
+		a.targetGroupARNs = append(a.targetGroupARNs, target)
+	}
+	return nil
+}
+
+// validateTargetGroupARN returns an error if the given ARN is not the one of a target group in the given region. The
+// region is not checked if empty.
+func validateTargetGroupARN(value, region string) error {
+	parsed, err := arn.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid target group ARN %q: %v", value, err)
+	}
+	if parsed.Service != elbService || !strings.HasPrefix(parsed.Resource, targetGroupResourcePrefix) {
+		return fmt.Errorf("invalid target group ARN %q, expected arn:<partition>:%s:<region>:<account>:%s<name>/<id>",
+			value, elbService, targetGroupResourcePrefix)
+	}
+	if region != "" && parsed.Region != region {
+		return fmt.Errorf("target group %s is in region %s, expected the region of the cluster %s", value,
+			parsed.Region, region)
+	}
+	return nil
+}
+
+// registerTargets registers the given instance with the target groups, and records the registrations next to the
+// 'windows-node-installer.json' file so that the instance is deregistered before it is terminated. The target groups
+// are all checked before the instance is registered with any of them.
+func (a *AwsProvider) registerTargets(instance *ec2.Instance) error {
+	groups, err := a.ELBV2.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: aws.StringSlice(a.targetGroupARNs),
+	})
+	if err != nil {
+		return fmt.Errorf("error describing target groups: %v", err)
+	}
+	registrations := make([]resource.TargetRegistration, 0, len(groups.TargetGroups))
+	for _, group := range groups.TargetGroups {
+		targetID, err := targetID(group, instance)
+		if err != nil {
+			return err
+		}
+		registrations = append(registrations, resource.TargetRegistration{
+			InstanceID:     *instance.InstanceId,
+			TargetGroupARN: aws.StringValue(group.TargetGroupArn),
+			TargetID:       targetID,
+		})
+	}
+	filePath := resource.TargetRegistrationFilePath(a.resourceTrackerDir)
+	for _, registration := range registrations {
+		_, err = a.ELBV2.RegisterTargets(&elbv2.RegisterTargetsInput{
+			TargetGroupArn: aws.String(registration.TargetGroupARN),
+			Targets:        []*elbv2.TargetDescription{{Id: aws.String(registration.TargetID)}},
+		})
+		if err != nil {
+			return fmt.Errorf("error registering instance %s with target group %s: %v", registration.InstanceID,
+				registration.TargetGroupARN, err)
+		}
+		if err = resource.AppendTargetRegistration(registration, filePath); err != nil {
+			return fmt.Errorf("failed to record the registration with target group %s, the instance will need to "+
+				"be deregistered manually: %v", registration.TargetGroupARN, err)
+		}
+		log.Printf("registered instance %s with target group %s as %s", registration.InstanceID,
+			registration.TargetGroupARN, registration.TargetID)
+	}
+	return nil
+}
+
+// targetID returns the ID the given instance is registered with in the given target group, which depends on the
+// target type of the group. The group has to be in the VPC of the instance.
+func targetID(group *elbv2.TargetGroup, instance *ec2.Instance) (string, error) {
+	name := aws.StringValue(group.TargetGroupArn)
+	if aws.StringValue(group.VpcId) != aws.StringValue(instance.VpcId) {
+		return "", fmt.Errorf("target group %s is in VPC %s, expected the VPC of the instance %s", name,
+			aws.StringValue(group.VpcId), aws.StringValue(instance.VpcId))
+	}
+	switch aws.StringValue(group.TargetType) {
+	case elbv2.TargetTypeEnumInstance:
+		return aws.StringValue(instance.InstanceId), nil
+	case elbv2.TargetTypeEnumIp:
+		if instance.PrivateIpAddress == nil {
+			return "", fmt.Errorf("instance %s has no private IP address to register with target group %s",
+				aws.StringValue(instance.InstanceId), name)
+		}
+		return *instance.PrivateIpAddress, nil
+	}
+	return "", fmt.Errorf("target group %s has targets of type %s, expected %s or %s", name,
+		aws.StringValue(group.TargetType), elbv2.TargetTypeEnumInstance, elbv2.TargetTypeEnumIp)
+}
+
+// deregisterTargets deregisters the given instances from the target groups they were registered with. Failures are
+// logged, so that the other instances are still handled.
+func (a *AwsProvider) deregisterTargets(instanceIDs []string) {
+	filePath := resource.TargetRegistrationFilePath(a.resourceTrackerDir)
+	registrations, err := resource.ReadTargetRegistrations(filePath)
+	if err != nil {
+		log.Printf("error reading target registrations: %v", err)
+		return
+	}
+	for _, instanceID := range instanceIDs {
+		for _, registration := range registrations {
+			if registration.InstanceID != instanceID {
+				continue
+			}
+			_, err = a.ELBV2.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+				TargetGroupArn: aws.String(registration.TargetGroupARN),
+				Targets:        []*elbv2.TargetDescription{{Id: aws.String(registration.TargetID)}},
+			})
+			if err != nil {
+				log.Printf("failed to deregister instance %s from target group %s: %v", instanceID,
+					registration.TargetGroupARN, err)
+				continue
+			}
+			err = resource.RemoveTargetRegistration(instanceID, registration.TargetGroupARN, filePath)
+			if err != nil {
+				log.Printf("%s file was not updated: %v", filePath, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateTargetGroupARN tests that only the ARNs of target groups in the region of the cluster are accepted
+func TestValidateTargetGroupARN(t *testing.T) {
+	const targetGroup = "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/web/0123456789abcdef"
+	assert.NoError(t, validateTargetGroupARN(targetGroup, "us-east-1"))
+	assert.NoError(t, validateTargetGroupARN(targetGroup, ""), "the region should not be checked if unknown")
+	assert.Error(t, validateTargetGroupARN(targetGroup, "us-west-2"), "target group in another region")
+	assert.Error(t, validateTargetGroupARN("web", "us-east-1"), "target group name")
+	assert.Error(t, validateTargetGroupARN(
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/web/0123456789abcdef", "us-east-1"),
+		"load balancer ARN")
+	assert.Error(t, validateTargetGroupARN("arn:aws:ec2:us-east-1:123456789012:targetgroup/web/0123456789abcdef",
+		"us-east-1"), "ARN of another service")
+}
+
+// TestTargetID tests that the instances are registered by instance ID or private IP depending on the target type of
+// the group
+func TestTargetID(t *testing.T) {
+	instance := &ec2.Instance{InstanceId: aws.String("i-0123456789abcdef0"), VpcId: aws.String("vpc-1234"),
+		PrivateIpAddress: aws.String("10.0.1.2")}
+	group := func(targetType, vpcID string) *elbv2.TargetGroup {
+		return &elbv2.TargetGroup{TargetGroupArn: aws.String("arn:aws:elasticloadbalancing:us-east-1:123456789012:" +
+			"targetgroup/web/0123456789abcdef"), TargetType: aws.String(targetType), VpcId: aws.String(vpcID)}
+	}
+
+	id, err := targetID(group(elbv2.TargetTypeEnumInstance, "vpc-1234"), instance)
+	require.NoError(t, err)
+	assert.Equal(t, "i-0123456789abcdef0", id)
+	id, err = targetID(group(elbv2.TargetTypeEnumIp, "vpc-1234"), instance)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.2", id)
+
+	_, err = targetID(group(elbv2.TargetTypeEnumLambda, "vpc-1234"), instance)
+	assert.Error(t, err, "lambda target group")
+	_, err = targetID(group(elbv2.TargetTypeEnumInstance, "vpc-5678"), instance)
+	assert.Error(t, err, "target group in another VPC")
+}
@@ -0,0 +1,138 @@
+package aws
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+const (
+	// metadataTokenTTL is the lifetime in seconds of the instance metadata service session token, which is only used
+	// for the few calls of the VPC detection
+	metadataTokenTTL = "60"
+	// metadataTimeout is the time the instance metadata service is given to answer. It is short, as it does not
+	// answer at all outside of EC2.
+	metadataTimeout = 2 * time.Second
+)
+
+// MetadataEndpoint is the URL of the EC2 instance metadata service, overridden by the tests of WNI and of the test
+// framework
+var MetadataEndpoint = "http://169.254.169.254/latest"
+
+// SetNetworkMode sets how the instances are reached. With types.NetworkModePrivate, or types.NetworkModeAuto when WNI
+// runs in the VPC of the cluster, the instances are created without public IP, in a private subnet, and no rule is
+// added for the IP of the user.
+func (a *AwsProvider) SetNetworkMode(mode types.NetworkMode) {
+	a.networkMode = mode
+	a.privateIP = nil
+}
+
+// usePrivateIP returns true if the instances are to be reached through their private IP. In auto mode, this is the
+// case if WNI runs on an EC2 instance in the VPC of the cluster.
+func (a *AwsProvider) usePrivateIP() (bool, error) {
+	if a.privateIP != nil {
+		return *a.privateIP, nil
+	}
+	var private bool
+	switch a.networkMode {
+	case types.NetworkModePrivate:
+		private = true
+	case types.NetworkModeAuto:
+		infraID, err := a.GetInfraID()
+		if err != nil {
+			return false, err
+		}
+		vpc, err := a.getInfrastructureVPC(infraID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get VPC, %v", err)
+		}
+		runnerVPC, err := GetRunnerVPC()
+		if err != nil {
+			// Not running on EC2, or without access to the instance metadata
+			log.Printf("using public IPs, could not detect the VPC WNI runs in: %v", err)
+		}
+		private = runnerVPC == *vpc.VpcId
+		if private {
+			log.Printf("running in VPC %s of the cluster, using private IPs", runnerVPC)
+		}
+	}
+	a.privateIP = &private
+	return private, nil
+}
+
+// instanceIP returns the IP address the given instance is reached through
+func (a *AwsProvider) instanceIP(instance *ec2.Instance) (string, error) {
+	private, err := a.usePrivateIP()
+	if err != nil {
+		return "", err
+	}
+	if private {
+		if instance.PrivateIpAddress == nil {
+			return "", fmt.Errorf("instance %s has no private IP address", *instance.InstanceId)
+		}
+		return *instance.PrivateIpAddress, nil
+	}
+	if instance.PublicIpAddress == nil {
+		return "", fmt.Errorf("instance %s has no public IP address, use the private network mode from within the "+
+			"VPC of the cluster", *instance.InstanceId)
+	}
+	return *instance.PublicIpAddress, nil
+}
+
+// GetRunnerVPC returns the ID of the VPC of the EC2 instance WNI, or the test framework, runs on, from the instance
+// metadata service. Both IMDSv2, which can be enforced on the instance, and IMDSv1 are supported.
+func GetRunnerVPC() (string, error) {
+	client := &http.Client{Timeout: metadataTimeout}
+	token := ""
+	request, err := http.NewRequest(http.MethodPut, MetadataEndpoint+"/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", metadataTokenTTL)
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("instance metadata service not reachable: %v", err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	// IMDSv1 only services do not know the token call
+	if err == nil && response.StatusCode == http.StatusOK {
+		token = string(body)
+	}
+
+	mac, err := getMetadata(client, token, "mac")
+	if err != nil {
+		return "", err
+	}
+	return getMetadata(client, token, "network/interfaces/macs/"+mac+"/vpc-id")
+}
+
+// getMetadata returns the instance metadata at the given path
+func getMetadata(client *http.Client, token, path string) (string, error) {
+	request, err := http.NewRequest(http.MethodGet, MetadataEndpoint+"/meta-data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		request.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("error getting instance metadata %s: %v", path, err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading instance metadata %s: %v", path, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error getting instance metadata %s: %s", path, response.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,96 @@
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMetadataServer returns an instance metadata service in the given VPC, which requires a session token if
+// tokenRequired is set
+func newMetadataServer(vpcID string, tokenRequired bool) *httptest.Server {
+	const token = "session-token"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/token" {
+			if !tokenRequired {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(token))
+			return
+		}
+		if tokenRequired && r.Header.Get("X-aws-ec2-metadata-token") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/meta-data/mac":
+			w.Write([]byte("0e:49:61:0f:c3:11"))
+		case "/meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/vpc-id":
+			w.Write([]byte(vpcID))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// TestGetRunnerVPC tests that the VPC is read from the instance metadata service with IMDSv2 and IMDSv1
+func TestGetRunnerVPC(t *testing.T) {
+	defer func(endpoint string) { MetadataEndpoint = endpoint }(MetadataEndpoint)
+
+	for _, tokenRequired := range []bool{true, false} {
+		server := newMetadataServer("vpc-0123456789abcdef0", tokenRequired)
+		MetadataEndpoint = server.URL
+		vpcID, err := GetRunnerVPC()
+		server.Close()
+		require.NoError(t, err, "token required: %v", tokenRequired)
+		assert.Equal(t, "vpc-0123456789abcdef0", vpcID, "token required: %v", tokenRequired)
+	}
+
+	// Outside of EC2, the metadata service does not answer
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	MetadataEndpoint = server.URL
+	_, err := GetRunnerVPC()
+	assert.Error(t, err)
+}
+
+// TestInstanceIP tests that the instances are reached through the IP of the network mode
+func TestInstanceIP(t *testing.T) {
+	instance := &ec2.Instance{
+		InstanceId:       aws.String("i-0123456789abcdef0"),
+		PrivateIpAddress: aws.String("10.0.1.2"),
+		PublicIpAddress:  aws.String("203.0.113.10"),
+	}
+	a := &AwsProvider{}
+
+	a.SetNetworkMode(types.NetworkModePrivate)
+	ip, err := a.instanceIP(instance)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.2", ip)
+
+	a.SetNetworkMode(types.NetworkModePublic)
+	ip, err = a.instanceIP(instance)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.10", ip)
+
+	// An instance created in private mode has no public IP
+	instance.PublicIpAddress = nil
+	_, err = a.instanceIP(instance)
+	assert.Error(t, err)
+}
+
+// TestGetRulesForSgUpdateWithoutLocalIP tests that only the VPC rule is added in private network mode
+func TestGetRulesForSgUpdateWithoutLocalIP(t *testing.T) {
+	a := &AwsProvider{}
+	rules := a.getRulesForSgUpdate("", nil, "10.0.0.0/16")
+	require.Len(t, rules, 1)
+	assert.Equal(t, "-1", *rules[0].IpProtocol)
+	assert.Equal(t, "10.0.0.0/16", *rules[0].IpRanges[0].CidrIp)
+}
@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/quota"
+)
+
+const (
+	// ec2ServiceCode is the code of EC2 in the Service Quotas API
+	ec2ServiceCode = "ec2"
+	// vpcServiceCode is the code of VPC in the Service Quotas API
+	vpcServiceCode = "vpc"
+	// securityGroupsQuotaCode is the code of the quota of the VPC security groups per region
+	securityGroupsQuotaCode = "L-E79EC296"
+	// securityGroupRulesQuotaCode is the code of the quota of the inbound rules per security group, which applies to
+	// the IPv4 and IPv6 rules separately
+	securityGroupRulesQuotaCode = "L-0EA8095F"
+)
+
+// CheckQuotas checks that the given number of instances, along with the Windows worker security group and its rules,
+// fit the quotas of the account: the vCPUs of the running on-demand instances of the instance family, the security
+// groups of the region and the rules of the security group. The instances get auto-assigned public IPs, which do not
+// count against the Elastic IP quota. A *quota.Error listing the exceeded quotas is returned if the resources do not
+// fit. The quotas that cannot be read, e.g. for lack of permissions, are logged and not checked.
+func (a *AwsProvider) CheckQuotas(count int) error {
+	var quotas []quota.Quota
+	vCPUs, err := a.vCPUQuota(count)
+	if err != nil {
+		log.Printf("not checking the vCPU quota of %s instances: %v", a.instanceType, err)
+	} else {
+		quotas = append(quotas, vCPUs)
+	}
+	securityGroupQuotas, err := a.securityGroupQuotas()
+	if err != nil {
+		log.Printf("not checking the security group quotas: %v", err)
+	} else {
+		quotas = append(quotas, securityGroupQuotas...)
+	}
+	return quota.Check(quotas)
+}
+
+// vCPUQuota returns the vCPU quota of the family of the instance type, with the vCPUs of the running instances of the
+// families sharing it and the vCPUs of the given number of instances
+func (a *AwsProvider) vCPUQuota(count int) (quota.Quota, error) {
+	code, name := quota.VCPUQuota(a.instanceType)
+	if code == "" {
+		return quota.Quota{}, fmt.Errorf("no known vCPU quota")
+	}
+	perInstance, err := quota.VCPUs(a.instanceType)
+	if err != nil {
+		return quota.Quota{}, err
+	}
+	limit, err := a.serviceQuota(ec2ServiceCode, code)
+	if err != nil {
+		return quota.Quota{}, err
+	}
+	var instances []*ec2.Instance
+	err = a.EC2.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice([]string{ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning}),
+		}},
+	}, func(output *ec2.DescribeInstancesOutput, _ bool) bool {
+		for _, reservation := range output.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+		return true
+	})
+	if err != nil {
+		return quota.Quota{}, fmt.Errorf("error describing the running instances: %v", err)
+	}
+	return quota.Quota{Name: name + " vCPUs", Code: code, Limit: limit, Used: vCPUsInUse(instances, code),
+		Requested: int64(count) * perInstance}, nil
+}
+
+// vCPUsInUse returns the vCPUs of the given instances whose family has the given vCPU quota
+func vCPUsInUse(instances []*ec2.Instance, code string) int64 {
+	var used int64
+	for _, instance := range instances {
+		instanceType := aws.StringValue(instance.InstanceType)
+		if instanceCode, _ := quota.VCPUQuota(instanceType); instanceCode != code {
+			continue
+		}
+		if options := instance.CpuOptions; options != nil && options.CoreCount != nil {
+			threads := aws.Int64Value(options.ThreadsPerCore)
+			if threads == 0 {
+				threads = 1
+			}
+			used += aws.Int64Value(options.CoreCount) * threads
+			continue
+		}
+		if vCPUs, err := quota.VCPUs(instanceType); err == nil {
+			used += vCPUs
+		}
+	}
+	return used
+}
+
+// securityGroupQuotas returns the quota of the security groups of the region if the Windows worker security group
+// has to be created, and the quotas of the rules of the Windows worker security group with the rules to be added
+func (a *AwsProvider) securityGroupQuotas() ([]quota.Quota, error) {
+	infraID, err := a.GetInfraID()
+	if err != nil {
+		return nil, err
+	}
+	vpc, err := a.getInfrastructureVPC(infraID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VPC, %v", err)
+	}
+	private, err := a.usePrivateIP()
+	if err != nil {
+		return nil, err
+	}
+	myIP := ""
+	if !private {
+		if myIP, err = a.getMyIP(); err != nil {
+			return nil, fmt.Errorf("error getting IP: %s", err)
+		}
+	}
+
+	var quotas []quota.Quota
+	sg, err := a.findWindowsWorkerSg(infraID)
+	if err != nil {
+		// The security group is created along with the first instance
+		sg = &ec2.SecurityGroup{}
+		limit, err := a.serviceQuota(vpcServiceCode, securityGroupsQuotaCode)
+		if err != nil {
+			return nil, err
+		}
+		var used int64
+		err = a.EC2.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{},
+			func(output *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+				used += int64(len(output.SecurityGroups))
+				return true
+			})
+		if err != nil {
+			return nil, fmt.Errorf("error describing the security groups: %v", err)
+		}
+		quotas = append(quotas, quota.Quota{Name: "VPC security groups per Region", Code: securityGroupsQuotaCode,
+			Limit: limit, Used: used, Requested: 1})
+	}
+
+	// The rules are counted as handleSg adds them: the VPC CIDR rule and a rule per port opened to the local IP
+	ports, hasClusterCIDRRule := examineRulesInSg(myIP, sg.IpPermissions, aws.StringValue(vpc.CidrBlock))
+	var requestedIPv4 int64
+	if !hasClusterCIDRRule {
+		requestedIPv4++
+	}
+	if myIP != "" {
+		requestedIPv4 += int64(len(ports))
+	}
+	_, requestedIPv6 := ruleEntries(getIPv6RulesForSgUpdate(sg.IpPermissions, vpc))
+	if requestedIPv4 == 0 && requestedIPv6 == 0 {
+		return quotas, nil
+	}
+	limit, err := a.serviceQuota(vpcServiceCode, securityGroupRulesQuotaCode)
+	if err != nil {
+		return nil, err
+	}
+	usedIPv4, usedIPv6 := ruleEntries(sg.IpPermissions)
+	name := "Inbound rules per security group " + strings.Join([]string{infraID, "windows", "worker", "sg"}, "-")
+	quotas = append(quotas, quota.Quota{Name: name + " (IPv4)", Code: securityGroupRulesQuotaCode, Limit: limit,
+		Used: usedIPv4, Requested: requestedIPv4})
+	if requestedIPv6 > 0 {
+		quotas = append(quotas, quota.Quota{Name: name + " (IPv6)", Code: securityGroupRulesQuotaCode, Limit: limit,
+			Used: usedIPv6, Requested: requestedIPv6})
+	}
+	return quotas, nil
+}
+
+// ruleEntries returns the number of IPv4 and IPv6 rules of the given permissions, as counted by the quota of the rules
+// per security group: each CIDR, security group and prefix list of a permission is a rule, the security groups and
+// prefix lists counting as IPv4 rules
+func ruleEntries(permissions []*ec2.IpPermission) (int64, int64) {
+	var ipv4, ipv6 int64
+	for _, permission := range permissions {
+		ipv4 += int64(len(permission.IpRanges) + len(permission.UserIdGroupPairs) + len(permission.PrefixListIds))
+		ipv6 += int64(len(permission.Ipv6Ranges))
+	}
+	return ipv4, ipv6
+}
+
+// serviceQuota returns the value of the given quota of the given service in the region of the provider. The quotas
+// that were never increased only have their default value.
+func (a *AwsProvider) serviceQuota(serviceCode, quotaCode string) (int64, error) {
+	input := &servicequotas.GetServiceQuotaInput{ServiceCode: aws.String(serviceCode),
+		QuotaCode: aws.String(quotaCode)}
+	output, err := a.serviceQuotas.GetServiceQuota(input)
+	if err == nil {
+		return int64(aws.Float64Value(output.Quota.Value)), nil
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != servicequotas.ErrCodeNoSuchResourceException {
+		return 0, fmt.Errorf("error getting quota %s of %s: %v", quotaCode, serviceCode, err)
+	}
+	defaultOutput, err := a.serviceQuotas.GetAWSDefaultServiceQuota(&servicequotas.GetAWSDefaultServiceQuotaInput{
+		ServiceCode: input.ServiceCode,
+		QuotaCode:   input.QuotaCode,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting the default value of quota %s of %s: %v", quotaCode, serviceCode, err)
+	}
+	return int64(aws.Float64Value(defaultOutput.Quota.Value)), nil
+}
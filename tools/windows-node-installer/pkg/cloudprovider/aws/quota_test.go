@@ -0,0 +1,51 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVCPUsInUse tests that only the vCPUs of the instances sharing the vCPU quota are counted, from their CPU options
+// when available
+func TestVCPUsInUse(t *testing.T) {
+	instances := []*ec2.Instance{
+		{InstanceType: aws.String("m5a.large"),
+			CpuOptions: &ec2.CpuOptions{CoreCount: aws.Int64(1), ThreadsPerCore: aws.Int64(2)}},
+		// CPU options reduce the vCPUs of an instance below the ones of its type
+		{InstanceType: aws.String("c5.2xlarge"),
+			CpuOptions: &ec2.CpuOptions{CoreCount: aws.Int64(2), ThreadsPerCore: aws.Int64(1)}},
+		{InstanceType: aws.String("t3.xlarge")},
+		{InstanceType: aws.String("m5.metal")},
+		{InstanceType: aws.String("g4dn.xlarge"),
+			CpuOptions: &ec2.CpuOptions{CoreCount: aws.Int64(2), ThreadsPerCore: aws.Int64(2)}},
+	}
+	assert.Equal(t, int64(8), vCPUsInUse(instances, "L-1216C47A"))
+	assert.Equal(t, int64(4), vCPUsInUse(instances, "L-DB2E81BA"))
+	assert.Zero(t, vCPUsInUse(instances, "L-417A185B"))
+}
+
+// TestRuleEntries tests that every CIDR, security group and prefix list of the permissions counts as a rule
+func TestRuleEntries(t *testing.T) {
+	permissions := []*ec2.IpPermission{
+		{IpProtocol: aws.String("-1"),
+			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}},
+			Ipv6Ranges: []*ec2.Ipv6Range{{CidrIpv6: aws.String("2600:1f18::/56")}}},
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(3389), ToPort: aws.Int64(3389),
+			IpRanges: []*ec2.IpRange{
+				{CidrIp: aws.String("203.0.113.1/32")},
+				{CidrIp: aws.String("203.0.113.2/32")},
+			},
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-0123456789abcdef0")}},
+			PrefixListIds:    []*ec2.PrefixListId{{PrefixListId: aws.String("pl-0123")}}},
+	}
+	ipv4, ipv6 := ruleEntries(permissions)
+	assert.Equal(t, int64(5), ipv4)
+	assert.Equal(t, int64(1), ipv6)
+
+	ipv4, ipv6 = ruleEntries(nil)
+	assert.Zero(t, ipv4)
+	assert.Zero(t, ipv6)
+}
@@ -0,0 +1,405 @@
+package aws
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// snapshotWaiterAttempts is the number of times the completion of the snapshots is checked, 15 seconds apart. The
+	// first snapshot of a Windows volume takes longer than the 10 minutes the waiter allows by default.
+	snapshotWaiterAttempts = 240
+	// awsTagPrefix is the prefix of the tags reserved by AWS, which cannot be set on the restored volumes
+	awsTagPrefix = "aws:"
+)
+
+// Snapshot takes a snapshot with the given name of the EBS volumes of the given instance, e.g. once it is configured,
+// so that it can be rolled back to it with RestoreSnapshot. The instance is stopped while the snapshots are created so
+// that they are consistent, and started again if it was running. The snapshots are recorded next to the
+// 'windows-node-installer.json' file and are deleted along with the instance.
+func (a *AwsProvider) Snapshot(instanceID, name string) (err error) {
+	_, span := tracing.Start(tracing.Context(), "Snapshot", attribute.String("instance-id", instanceID),
+		attribute.String("snapshot", name))
+	defer func() { tracing.End(span, err) }()
+
+	if name == "" {
+		return fmt.Errorf("the name of the snapshot cannot be empty")
+	}
+	filePath := resource.SnapshotFilePath(a.resourceTrackerDir)
+	existing, err := resource.FindSnapshot(instanceID, name, filePath)
+	if err != nil {
+		return fmt.Errorf("error reading snapshot records: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("snapshot %s of %s already exists", name, instanceID)
+	}
+	instance, err := a.GetInstance(instanceID)
+	if err != nil {
+		return fmt.Errorf("error getting instance %s: %v", instanceID, err)
+	}
+
+	running, err := a.stopInstance(instance)
+	if err != nil {
+		return err
+	}
+	snapshot, err := a.snapshotVolumes(instance, name)
+	if err == nil {
+		if err = resource.AppendSnapshot(*snapshot, filePath); err != nil {
+			if deleteErr := a.deleteVolumeSnapshots(*snapshot); deleteErr != nil {
+				log.Printf("failed to delete the snapshots of %s: %v", instanceID, deleteErr)
+			}
+			err = fmt.Errorf("failed to record snapshot %s of %s: %v", name, instanceID, err)
+		}
+	}
+	// The snapshots capture the volumes as they were when created, so the instance can run while they complete
+	if running {
+		if startErr := a.startInstance(instanceID); startErr != nil {
+			if err != nil {
+				log.Printf("failed to start instance %s: %v", instanceID, startErr)
+			} else {
+				err = startErr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshotIDs []string
+	for _, volume := range snapshot.Volumes {
+		snapshotIDs = append(snapshotIDs, volume.SnapshotID)
+	}
+	err = a.EC2.WaitUntilSnapshotCompletedWithContext(aws.BackgroundContext(),
+		&ec2.DescribeSnapshotsInput{SnapshotIds: aws.StringSlice(snapshotIDs)},
+		request.WithWaiterMaxAttempts(snapshotWaiterAttempts))
+	if err != nil {
+		return fmt.Errorf("error waiting for the snapshots %s to complete: %v", strings.Join(snapshotIDs, ", "),
+			err)
+	}
+	log.Printf("took snapshot %s of instance %s", name, instanceID)
+	return nil
+}
+
+// RestoreSnapshot rolls the given instance back to its snapshot with the given name taken by Snapshot. The instance is
+// stopped, its volumes are replaced by new volumes created from their snapshots, and it is started again if it was
+// running. The replaced volumes are deleted. The public IP of the instance changes if it is restarted.
+func (a *AwsProvider) RestoreSnapshot(instanceID, name string) (err error) {
+	_, span := tracing.Start(tracing.Context(), "RestoreSnapshot", attribute.String("instance-id", instanceID),
+		attribute.String("snapshot", name))
+	defer func() { tracing.End(span, err) }()
+
+	filePath := resource.SnapshotFilePath(a.resourceTrackerDir)
+	snapshot, err := resource.FindSnapshot(instanceID, name, filePath)
+	if err != nil {
+		return fmt.Errorf("error reading snapshot records: %v", err)
+	}
+	if snapshot == nil {
+		return fmt.Errorf("no snapshot %s of %s is recorded in %s", name, instanceID, filePath)
+	}
+	instance, err := a.GetInstance(instanceID)
+	if err != nil {
+		return fmt.Errorf("error getting instance %s: %v", instanceID, err)
+	}
+
+	running, err := a.stopInstance(instance)
+	if err != nil {
+		return err
+	}
+	for _, volume := range snapshot.Volumes {
+		if err = a.replaceVolume(instance, volume); err != nil {
+			err = fmt.Errorf("error restoring %s of instance %s: %v", volume.Device, instanceID, err)
+			break
+		}
+	}
+	if running {
+		if startErr := a.startInstance(instanceID); startErr != nil {
+			if err != nil {
+				log.Printf("failed to start instance %s: %v", instanceID, startErr)
+			} else {
+				err = startErr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if instance, err = a.GetInstance(instanceID); err != nil {
+		return fmt.Errorf("error getting instance %s: %v", instanceID, err)
+	}
+	if ipAddress, err := a.instanceIP(instance); err == nil {
+		log.Printf("restored instance %s to snapshot %s, it is reachable at %s", instanceID, name, ipAddress)
+	} else {
+		log.Printf("restored instance %s to snapshot %s", instanceID, name)
+	}
+	return nil
+}
+
+// DeleteSnapshot deletes the snapshot of the given instance with the given name taken by Snapshot
+func (a *AwsProvider) DeleteSnapshot(instanceID, name string) error {
+	filePath := resource.SnapshotFilePath(a.resourceTrackerDir)
+	snapshot, err := resource.FindSnapshot(instanceID, name, filePath)
+	if err != nil {
+		return fmt.Errorf("error reading snapshot records: %v", err)
+	}
+	if snapshot == nil {
+		return fmt.Errorf("no snapshot %s of %s is recorded in %s", name, instanceID, filePath)
+	}
+	if err = a.deleteVolumeSnapshots(*snapshot); err != nil {
+		return err
+	}
+	if err = resource.RemoveSnapshot(instanceID, name, filePath); err != nil {
+		return fmt.Errorf("%s file was not updated: %v", filePath, err)
+	}
+	log.Printf("deleted snapshot %s of instance %s", name, instanceID)
+	return nil
+}
+
+// deleteSnapshotsOfInstances deletes the snapshots taken of the given instances. Failures are logged, so that the other
+// snapshots are still deleted.
+func (a *AwsProvider) deleteSnapshotsOfInstances(instanceIDs []string) {
+	filePath := resource.SnapshotFilePath(a.resourceTrackerDir)
+	snapshots, err := resource.ReadSnapshots(filePath)
+	if err != nil {
+		log.Printf("error reading snapshot records: %v", err)
+		return
+	}
+	terminated := make(map[string]bool, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		terminated[instanceID] = true
+	}
+	for _, snapshot := range snapshots {
+		if !terminated[snapshot.InstanceID] {
+			continue
+		}
+		if err = a.deleteVolumeSnapshots(snapshot); err != nil {
+			log.Printf("failed to delete snapshot %s of %s: %v", snapshot.Name, snapshot.InstanceID, err)
+			continue
+		}
+		if err = resource.RemoveSnapshot(snapshot.InstanceID, snapshot.Name, filePath); err != nil {
+			log.Printf("%s file was not updated: %v", filePath, err)
+		}
+	}
+}
+
+// snapshotVolumes creates snapshots of the EBS volumes of the given instance and returns them. The snapshots already
+// created are deleted if one of them fails.
+func (a *AwsProvider) snapshotVolumes(instance *ec2.Instance, name string) (*resource.Snapshot, error) {
+	instanceID := aws.StringValue(instance.InstanceId)
+	snapshot := &resource.Snapshot{InstanceID: instanceID, Name: name, Created: time.Now().UTC()}
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs == nil {
+			continue
+		}
+		device := aws.StringValue(mapping.DeviceName)
+		output, err := a.EC2.CreateSnapshot(&ec2.CreateSnapshotInput{
+			VolumeId:    mapping.Ebs.VolumeId,
+			Description: aws.String(fmt.Sprintf("wni snapshot %s of %s %s", name, instanceID, device)),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+				Tags:         []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(instanceID + "-" + name)}},
+			}},
+		})
+		if err != nil {
+			if deleteErr := a.deleteVolumeSnapshots(*snapshot); deleteErr != nil {
+				log.Printf("failed to delete the snapshots of %s: %v", instanceID, deleteErr)
+			}
+			return nil, fmt.Errorf("error creating snapshot of volume %s of instance %s: %v",
+				aws.StringValue(mapping.Ebs.VolumeId), instanceID, err)
+		}
+		snapshot.Volumes = append(snapshot.Volumes, resource.VolumeSnapshot{Device: device,
+			SnapshotID: aws.StringValue(output.SnapshotId)})
+	}
+	if len(snapshot.Volumes) == 0 {
+		return nil, fmt.Errorf("instance %s has no EBS volume", instanceID)
+	}
+	return snapshot, nil
+}
+
+// deleteVolumeSnapshots deletes the snapshots of the volumes of the given snapshot
+func (a *AwsProvider) deleteVolumeSnapshots(snapshot resource.Snapshot) error {
+	var failed []string
+	for _, volume := range snapshot.Volumes {
+		_, err := a.EC2.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(volume.SnapshotID)})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", volume.SnapshotID, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error deleting snapshots %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// replaceVolume replaces the volume attached to the given stopped instance as the device of the given volume
+// snapshot by a new volume created from the snapshot, and deletes the replaced volume. The replaced volume is
+// attached again if the new one cannot be attached.
+func (a *AwsProvider) replaceVolume(instance *ec2.Instance, volume resource.VolumeSnapshot) error {
+	instanceID := aws.StringValue(instance.InstanceId)
+	var current *ec2.InstanceBlockDeviceMapping
+	for _, mapping := range instance.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) == volume.Device && mapping.Ebs != nil {
+			current = mapping
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("no volume is attached as %s", volume.Device)
+	}
+	volumes, err := a.EC2.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{current.Ebs.VolumeId}})
+	if err != nil || len(volumes.Volumes) == 0 {
+		return fmt.Errorf("error getting volume %s: %v", aws.StringValue(current.Ebs.VolumeId), err)
+	}
+	oldVolumeID := aws.StringValue(current.Ebs.VolumeId)
+
+	created, err := a.EC2.CreateVolume(restoredVolumeInput(volumes.Volumes[0], volume.SnapshotID))
+	if err != nil {
+		return fmt.Errorf("error creating volume from snapshot %s: %v", volume.SnapshotID, err)
+	}
+	newVolumeID := aws.StringValue(created.VolumeId)
+	err = a.EC2.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{VolumeIds: aws.StringSlice([]string{newVolumeID})})
+	if err != nil {
+		a.deleteVolume(newVolumeID)
+		return fmt.Errorf("error waiting for volume %s to be available: %v", newVolumeID, err)
+	}
+
+	if err = a.detachVolume(oldVolumeID); err != nil {
+		a.deleteVolume(newVolumeID)
+		return err
+	}
+	if err = a.attachVolume(instanceID, newVolumeID, volume.Device); err != nil {
+		if attachErr := a.attachVolume(instanceID, oldVolumeID, volume.Device); attachErr != nil {
+			log.Printf("failed to attach volume %s back to %s as %s: %v", oldVolumeID, instanceID, volume.Device,
+				attachErr)
+			return err
+		}
+		a.deleteVolume(newVolumeID)
+		return err
+	}
+
+	// The new volume is deleted along with the instance, as the replaced one was
+	_, err = a.EC2.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMappingSpecification{{
+			DeviceName: aws.String(volume.Device),
+			Ebs: &ec2.EbsInstanceBlockDeviceSpecification{
+				VolumeId:            aws.String(newVolumeID),
+				DeleteOnTermination: current.Ebs.DeleteOnTermination,
+			},
+		}},
+	})
+	if err != nil {
+		log.Printf("failed to set the deletion on termination of volume %s, it will need to be deleted manually: %v",
+			newVolumeID, err)
+	}
+	a.deleteVolume(oldVolumeID)
+	return nil
+}
+
+// restoredVolumeInput returns the input creating a volume from the given snapshot with the type, IOPS and tags of the
+// given volume it replaces
+func restoredVolumeInput(volume *ec2.Volume, snapshotID string) *ec2.CreateVolumeInput {
+	input := &ec2.CreateVolumeInput{
+		AvailabilityZone: volume.AvailabilityZone,
+		SnapshotId:       aws.String(snapshotID),
+		VolumeType:       volume.VolumeType,
+	}
+	// The IOPS can only be given for provisioned IOPS volumes
+	if aws.StringValue(volume.VolumeType) == ec2.VolumeTypeIo1 {
+		input.Iops = volume.Iops
+	}
+	var tags []*ec2.Tag
+	for _, tag := range volume.Tags {
+		if !strings.HasPrefix(aws.StringValue(tag.Key), awsTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		input.TagSpecifications = []*ec2.TagSpecification{{ResourceType: aws.String(ec2.ResourceTypeVolume),
+			Tags: tags}}
+	}
+	return input
+}
+
+// detachVolume detaches the given volume from its instance and waits until it is available
+func (a *AwsProvider) detachVolume(volumeID string) error {
+	if _, err := a.EC2.DetachVolume(&ec2.DetachVolumeInput{VolumeId: aws.String(volumeID)}); err != nil {
+		return fmt.Errorf("error detaching volume %s: %v", volumeID, err)
+	}
+	err := a.EC2.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{VolumeIds: aws.StringSlice([]string{volumeID})})
+	if err != nil {
+		return fmt.Errorf("error waiting for volume %s to be detached: %v", volumeID, err)
+	}
+	return nil
+}
+
+// attachVolume attaches the given volume to the given instance as the given device and waits until it is in use
+func (a *AwsProvider) attachVolume(instanceID, volumeID, device string) error {
+	_, err := a.EC2.AttachVolume(&ec2.AttachVolumeInput{
+		InstanceId: aws.String(instanceID),
+		VolumeId:   aws.String(volumeID),
+		Device:     aws.String(device),
+	})
+	if err != nil {
+		return fmt.Errorf("error attaching volume %s to %s as %s: %v", volumeID, instanceID, device, err)
+	}
+	err = a.EC2.WaitUntilVolumeInUse(&ec2.DescribeVolumesInput{VolumeIds: aws.StringSlice([]string{volumeID})})
+	if err != nil {
+		return fmt.Errorf("error waiting for volume %s to be attached: %v", volumeID, err)
+	}
+	return nil
+}
+
+// deleteVolume deletes the given volume, logging failures as the volume then needs to be deleted manually
+func (a *AwsProvider) deleteVolume(volumeID string) {
+	if _, err := a.EC2.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: aws.String(volumeID)}); err != nil {
+		log.Printf("failed to delete volume %s, it will need to be deleted manually: %v", volumeID, err)
+	}
+}
+
+// stopInstance stops the given instance if it is running and waits until it is stopped. It returns true if the
+// instance was running.
+func (a *AwsProvider) stopInstance(instance *ec2.Instance) (bool, error) {
+	instanceID := aws.StringValue(instance.InstanceId)
+	state := ""
+	if instance.State != nil {
+		state = aws.StringValue(instance.State.Name)
+	}
+	switch state {
+	case ec2.InstanceStateNameStopped:
+		return false, nil
+	case ec2.InstanceStateNameRunning:
+	default:
+		return false, fmt.Errorf("instance %s is %s, it needs to be running or stopped", instanceID, state)
+	}
+	log.Printf("stopping instance %s", instanceID)
+	instanceIDs := aws.StringSlice([]string{instanceID})
+	if _, err := a.EC2.StopInstances(&ec2.StopInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return false, fmt.Errorf("error stopping instance %s: %v", instanceID, err)
+	}
+	if err := a.EC2.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs}); err != nil {
+		return false, fmt.Errorf("error waiting for instance %s to stop: %v", instanceID, err)
+	}
+	return true, nil
+}
+
+// startInstance starts the given stopped instance and waits until it is running
+func (a *AwsProvider) startInstance(instanceID string) error {
+	log.Printf("starting instance %s", instanceID)
+	_, err := a.EC2.StartInstances(&ec2.StartInstancesInput{InstanceIds: aws.StringSlice([]string{instanceID})})
+	if err != nil {
+		return fmt.Errorf("error starting instance %s: %v", instanceID, err)
+	}
+	if err := a.waitUntilInstanceRunning(instanceID); err != nil {
+		return fmt.Errorf("error waiting for instance %s to run: %v", instanceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRestoredVolumeInput tests that the restored volume is created like the volume it replaces, without the tags
+// reserved by AWS
+func TestRestoredVolumeInput(t *testing.T) {
+	volume := &ec2.Volume{
+		AvailabilityZone: aws.String("us-east-1a"),
+		VolumeType:       aws.String(ec2.VolumeTypeGp2),
+		Iops:             aws.Int64(300),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("winworker-abcd")},
+			{Key: aws.String("aws:ec2launchtemplate:id"), Value: aws.String("lt-0123456789abcdef0")},
+		},
+	}
+	input := restoredVolumeInput(volume, "snap-0123456789abcdef0")
+	assert.Equal(t, "us-east-1a", aws.StringValue(input.AvailabilityZone))
+	assert.Equal(t, "snap-0123456789abcdef0", aws.StringValue(input.SnapshotId))
+	assert.Equal(t, ec2.VolumeTypeGp2, aws.StringValue(input.VolumeType))
+	assert.Nil(t, input.Iops, "the IOPS of a gp2 volume cannot be given")
+	require.Len(t, input.TagSpecifications, 1)
+	assert.Equal(t, ec2.ResourceTypeVolume, aws.StringValue(input.TagSpecifications[0].ResourceType))
+	assert.Equal(t, volume.Tags[:1], input.TagSpecifications[0].Tags)
+
+	volume = &ec2.Volume{AvailabilityZone: aws.String("us-east-1a"), VolumeType: aws.String(ec2.VolumeTypeIo1),
+		Iops: aws.Int64(1000)}
+	input = restoredVolumeInput(volume, "snap-0123456789abcdef0")
+	assert.Equal(t, int64(1000), aws.Int64Value(input.Iops))
+	assert.Empty(t, input.TagSpecifications, "no tags should be given to a volume without tags")
+}
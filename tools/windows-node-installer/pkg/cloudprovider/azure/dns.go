@@ -0,0 +1,116 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+)
+
+// dnsRecordTTL is the time to live in seconds of the DNS records registered for the instances
+const dnsRecordTTL = 60
+
+// privateZoneIDRegex matches the resource ID of a private DNS zone, capturing its resource group and name
+var privateZoneIDRegex = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/([^/]+)/providers/` +
+	`Microsoft\.Network/privateDnsZones/([^/]+)$`)
+
+// getRecordSetsClient gets the private DNS record sets client by passing the authorizer token.
+func getRecordSetsClient(authorizer autorest.Authorizer, subscriptionID string) privatedns.RecordSetsClient {
+	recordSetsClient := privatedns.NewRecordSetsClient(subscriptionID)
+	recordSetsClient.Authorizer = authorizer
+	return recordSetsClient
+}
+
+// SetDNSRegistration sets whether the created instances are registered in the private DNS zone of the cluster, as
+// <instance name>.<cluster domain> pointing to their private IP
+func (az *AzureProvider) SetDNSRegistration(enabled bool) {
+	az.registerDNS = enabled
+}
+
+// registerDNSRecord registers the instance in the private DNS zone of the cluster with its name, and records it next
+// to the given 'windows-node-installer.json' file so that it is removed along with the instance. The fully qualified
+// name of the record is returned.
+func (az *AzureProvider) registerDNSRecord(ctx context.Context, vmName, resourceTrackerFilePath string) (string,
+	error) {
+	nic, err := az.nicClient.Get(ctx, az.resourceGroupName, az.NicName, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting nic %s: %v", az.NicName, err)
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil || len(*nic.IPConfigurations) == 0 ||
+		(*nic.IPConfigurations)[0].PrivateIPAddress == nil {
+		return "", fmt.Errorf("nic %s has no private IP address", az.NicName)
+	}
+	dns, err := az.openShiftClient.GetDNS()
+	if err != nil {
+		return "", err
+	}
+	zoneID := dns.Spec.PrivateZone.ID
+	if zoneID == "" {
+		zoneID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/privateDnsZones/%s",
+			az.subscriptionID, az.resourceGroupName, strings.TrimSuffix(dns.Spec.BaseDomain, "."))
+	}
+	record := resource.DNSRecord{
+		InstanceID: vmName,
+		Name:       strings.ToLower(vmName) + "." + strings.TrimSuffix(dns.Spec.BaseDomain, "."),
+		ZoneID:     zoneID,
+		IPAddress:  *(*nic.IPConfigurations)[0].PrivateIPAddress,
+		TTL:        dnsRecordTTL,
+	}
+	resourceGroup, zone, relativeName, err := recordSetLocation(record)
+	if err != nil {
+		return "", err
+	}
+	_, err = az.recordSetsClient.CreateOrUpdate(ctx, resourceGroup, zone, privatedns.A, relativeName,
+		privatedns.RecordSet{
+			RecordSetProperties: &privatedns.RecordSetProperties{
+				TTL:      to.Int64Ptr(record.TTL),
+				ARecords: &[]privatedns.ARecord{{Ipv4Address: to.StringPtr(record.IPAddress)}},
+			},
+		}, "", "")
+	if err != nil {
+		return "", fmt.Errorf("error registering %s in private DNS zone %s: %v", record.Name, zone, err)
+	}
+	if err = resource.AppendDNSRecord(record, resource.DNSRecordFilePath(resourceTrackerFilePath)); err != nil {
+		return "", fmt.Errorf("failed to record DNS record %s, it will need to be removed manually: %v", record.Name,
+			err)
+	}
+	log.Printf("registered instance %s as %s", vmName, record.Name)
+	return record.Name, nil
+}
+
+// deregisterDNSRecord removes the DNS record registered for the given instance, if any
+func (az *AzureProvider) deregisterDNSRecord(ctx context.Context, vmName, resourceTrackerFilePath string) error {
+	filePath := resource.DNSRecordFilePath(resourceTrackerFilePath)
+	record, err := resource.FindDNSRecord(vmName, filePath)
+	if err != nil || record == nil {
+		return err
+	}
+	resourceGroup, zone, relativeName, err := recordSetLocation(*record)
+	if err != nil {
+		return err
+	}
+	if _, err = az.recordSetsClient.Delete(ctx, resourceGroup, zone, privatedns.A, relativeName, ""); err != nil {
+		return fmt.Errorf("error removing DNS record %s: %v", record.Name, err)
+	}
+	return resource.RemoveDNSRecord(vmName, filePath)
+}
+
+// recordSetLocation returns the resource group and the name of the private DNS zone of the record, and the name of
+// the record relative to the zone
+func recordSetLocation(record resource.DNSRecord) (string, string, string, error) {
+	matches := privateZoneIDRegex.FindStringSubmatch(record.ZoneID)
+	if matches == nil {
+		return "", "", "", fmt.Errorf("invalid private DNS zone ID %s", record.ZoneID)
+	}
+	resourceGroup, zone := matches[1], matches[2]
+	if !strings.HasSuffix(record.Name, "."+zone) {
+		return "", "", "", fmt.Errorf("record %s is not in private DNS zone %s", record.Name, zone)
+	}
+	return resourceGroup, zone, strings.TrimSuffix(record.Name, "."+zone), nil
+}
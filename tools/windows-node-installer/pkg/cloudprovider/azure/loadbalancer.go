@@ -0,0 +1,36 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetLoadBalancerTargets sets the IDs of the existing load balancer backend pools the NICs of the created instances
+// are added to, as the machine API does for the machines of a machine set. The NICs leave the pools when they are
+// deleted along with the instances. An error is returned if an ID is not the one of a backend pool of the resource
+// group of the cluster.
+func (az *AzureProvider) SetLoadBalancerTargets(targets []string) error {
+	az.backendPools = nil
+	for _, target := range targets {
+		if err := validateBackendPoolID(target, az.subscriptionID, az.resourceGroupName); err != nil {
+			return err
+		}
+		az.backendPools = append(az.backendPools, target)
+	}
+	return nil
+}
+
+// validateBackendPoolID returns an error if the given ID is not the one of a load balancer backend pool of the given
+// resource group, which the NICs have to be in the subscription of. Azure resource IDs are case insensitive.
+func validateBackendPoolID(id, subscriptionID, resourceGroupName string) error {
+	prefix := strings.ToLower(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/"+
+		"loadBalancers/", subscriptionID, resourceGroupName))
+	parts := strings.Split(strings.TrimPrefix(strings.ToLower(id), prefix), "/")
+	if !strings.HasPrefix(strings.ToLower(id), prefix) || len(parts) != 3 || parts[0] == "" ||
+		parts[1] != "backendaddresspools" || parts[2] == "" {
+		return fmt.Errorf("invalid backend pool ID %q, expected /subscriptions/%s/resourceGroups/%s/providers/"+
+			"Microsoft.Network/loadBalancers/<load balancer>/backendAddressPools/<pool>", id, subscriptionID,
+			resourceGroupName)
+	}
+	return nil
+}
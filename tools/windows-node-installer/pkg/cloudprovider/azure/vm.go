@@ -16,6 +16,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-04-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
@@ -50,6 +51,8 @@ const (
 	vnetRuleName = "vnet_traffic"
 	// winUser is the user used to login into the instance.
 	winUser = "core"
+	// maxComputerNameLength is the maximum length of the computer name of Windows VMs accepted by Azure
+	maxComputerNameLength = 15
 )
 
 var windowsWorker string = "winworker-"
@@ -71,6 +74,8 @@ type AzureProvider struct {
 	nsgClient network.SecurityGroupsClient
 	// diskClient to query for disk related operations.
 	diskClient compute.DisksClient
+	// recordSetsClient to query for private DNS record related operations.
+	recordSetsClient privatedns.RecordSetsClient
 	// a request authorization token to supply for clients
 	authorizer autorest.Authorizer
 	// resourceGroupName of the existing openshift cluster.
@@ -93,6 +98,14 @@ type AzureProvider struct {
 	resourceTrackerDir string
 	// requiredRules is the set of SG rules that need to be created or deleted
 	requiredRules map[string]*nsgRuleWrapper
+	// openShiftClient is the client of the existing OpenShift cluster.
+	openShiftClient *client.OpenShift
+	// registerDNS registers the created instances in the private DNS zone of the cluster
+	registerDNS bool
+	// computerName is the Windows computer name of the created instances, the instance name if empty
+	computerName string
+	// backendPools are the IDs of the load balancer backend pools the NICs of the created instances are added to
+	backendPools []string
 }
 
 // nsgRuleWrapper encapsulates an Azure NSG security rule from a WNI perspective
@@ -138,6 +151,7 @@ func New(openShiftClient *client.OpenShift, credentialPath, subscriptionID,
 	nsgClient := getNsgClient(resourceAuthorizer, subscriptionID)
 	diskClient := getDiskClient(resourceAuthorizer, subscriptionID)
 	rulesClient := getRulesClient(resourceAuthorizer, subscriptionID)
+	recordSetsClient := getRecordSetsClient(resourceAuthorizer, subscriptionID)
 
 	requiredRules, err := constructRequiredRules(rulesClient, resourceGroupName)
 	if err != nil {
@@ -147,9 +161,9 @@ func New(openShiftClient *client.OpenShift, credentialPath, subscriptionID,
 	var IpName, NicName, NsgName string
 
 	return &AzureProvider{vnetClient, vmClient, ipClient,
-		subnetClient, nicClient, nsgClient, diskClient, resourceAuthorizer,
+		subnetClient, nicClient, nsgClient, diskClient, recordSetsClient, resourceAuthorizer,
 		resourceGroupName, subscriptionID, infraID, IpName, NicName, NsgName,
-		imageID, instanceType, resourceTrackerDir, requiredRules}, nil
+		imageID, instanceType, resourceTrackerDir, requiredRules, openShiftClient, false, "", nil}, nil
 }
 
 // constructRequiredRules populates the required rules map
@@ -373,6 +387,14 @@ func (az *AzureProvider) createNIC(ctx context.Context, vnetName, subnetName, ns
 		},
 	}
 
+	if len(az.backendPools) > 0 {
+		pools := make([]network.BackendAddressPool, 0, len(az.backendPools))
+		for _, pool := range az.backendPools {
+			pools = append(pools, network.BackendAddressPool{ID: to.StringPtr(pool)})
+		}
+		(*nicParams.IPConfigurations)[0].LoadBalancerBackendAddressPools = &pools
+	}
+
 	if nsgName != "" {
 		nsg, err := az.nsgClient.Get(ctx, az.resourceGroupName, nsgName, "")
 		if errorCheck(err) {
@@ -518,6 +540,22 @@ func (az *AzureProvider) getIPAddress(ctx context.Context) (ipAddress *string, e
 	return
 }
 
+// SetComputerName sets the Windows computer name of the created instances, which Azure limits to 15 characters. The
+// instances are named after their instance name by default.
+func (az *AzureProvider) SetComputerName(name string) error {
+	if name == types.ComputerNamePrivateDNS {
+		return fmt.Errorf("the %s computer name is not supported on Azure", types.ComputerNamePrivateDNS)
+	}
+	if len(name) > maxComputerNameLength {
+		return fmt.Errorf("invalid computer name %q, Azure limits it to %d characters", name, maxComputerNameLength)
+	}
+	if err := types.ValidateComputerName(name); err != nil {
+		return err
+	}
+	az.computerName = name
+	return nil
+}
+
 // constructAdditionalContent constructs the commands needed to be executed on first login into the Windows node.
 func constructAdditionalContent(instanceName, adminPassword string) *[]compute.AdditionalUnattendContent {
 	// On first time Logon it will copy the custom file injected to a temporary directory
@@ -576,8 +614,12 @@ func constructAdditionalContent(instanceName, adminPassword string) *[]compute.A
 // such as configuring remote management listeners, instance access setup.
 func (az *AzureProvider) constructOSProfile(ctx context.Context) (osProfile *compute.OSProfile, vmName, password string) {
 	instanceName := windowsWorker + randomString(5)
+	computerName := instanceName
+	if az.computerName != "" {
+		computerName = az.computerName
+	}
 	adminPassword := randomPasswordString(12)
-	additionalContent := constructAdditionalContent(instanceName, adminPassword)
+	additionalContent := constructAdditionalContent(computerName, adminPassword)
 
 	// the data runs the script from the url location, script sets up both HTTP & HTTPS WinRM listeners so that
 	// ansible can connect to it and run remote scripts on the windows node. Also open firewall port number 10250.
@@ -594,7 +636,7 @@ func (az *AzureProvider) constructOSProfile(ctx context.Context) (osProfile *com
 	}
 	timeZoneMap := getTimeZoneMap()
 	osProfile = &compute.OSProfile{
-		ComputerName:  to.StringPtr(instanceName),
+		ComputerName:  to.StringPtr(computerName),
 		AdminUsername: to.StringPtr(winUser),
 		AdminPassword: to.StringPtr(adminPassword),
 		CustomData:    to.StringPtr(base64.StdEncoding.EncodeToString([]byte(data))),
@@ -786,6 +828,14 @@ func (az *AzureProvider) CreateWindowsVM() (types.WindowsVM, error) {
 	credentials := types.NewCredentials(instanceName, *ipAddress, adminPassword, winUser)
 	w.Credentials = credentials
 
+	if az.registerDNS {
+		hostname, err := az.registerDNSRecord(ctx, instanceName, resourceTrackerFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the Windows VM in the private DNS zone: %v", err)
+		}
+		credentials.SetHostname(hostname)
+	}
+
 	// Setup Winrm and SSH client so that we can interact with the Windows Object we created
 	if err := w.SetupWinRMClient(); err != nil {
 		return nil, fmt.Errorf("failed to setup winRM client for the Windows VM: %v", err)
@@ -978,6 +1028,11 @@ func (az *AzureProvider) DestroyWindowsVMs() error {
 			log.Printf("deleted the disk attached to the instance")
 		}
 
+		err = az.deregisterDNSRecord(ctx, vmName, resourceTrackerFilePath)
+		if errorCheck(err) {
+			log.Printf("failed to remove the DNS record of instance %s: %s", vmName, err)
+		}
+
 		rdpFilePath = az.resourceTrackerDir + vmName
 		err = resource.DeleteCredentialData(rdpFilePath)
 		if errorCheck(err) {
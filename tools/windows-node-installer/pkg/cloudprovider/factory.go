@@ -9,6 +9,8 @@ import (
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/client"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/aws"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cloudprovider/azure"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/cost"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/export"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
 	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
 	"k8s.io/client-go/util/homedir"
@@ -31,6 +33,127 @@ type Cloud interface {
 	DestroyWindowsVMs() error
 }
 
+// DebugAccess is the interface implemented by the cloud providers that support opening temporary RDP access to the
+// created instances for debugging.
+type DebugAccess interface {
+	// EnableDebugAccess opens RDP access to the given instance from the given CIDR, both in the cloud network and
+	// in the firewall of the instance, and records the changes so that they can be revoked.
+	EnableDebugAccess(instanceID, cidr string) error
+	// RevokeDebugAccess revokes the recorded debug access to the given instance, or to all instances if the instance
+	// ID is empty.
+	RevokeDebugAccess(instanceID string) error
+}
+
+// WindowsVMGetter is the interface implemented by the cloud providers that can connect to existing instances.
+type WindowsVMGetter interface {
+	// GetWindowsVM returns the Windows VM object of the given existing instance
+	GetWindowsVM(instanceID string) (types.WindowsVM, error)
+}
+
+// NodeNamer is the interface implemented by the cloud providers that know the name the node of an instance registers
+// with in the cluster.
+type NodeNamer interface {
+	// GetNodeName returns the name of the node of the given existing instance
+	GetNodeName(instanceID string) (string, error)
+}
+
+// NetworkModeSetter is the interface implemented by the cloud providers that can reach the instances through their
+// private IP, without exposing them publicly.
+type NetworkModeSetter interface {
+	// SetNetworkMode sets whether the instances are reached through their public or private IP
+	SetNetworkMode(mode types.NetworkMode)
+}
+
+// DNSRegistrar is the interface implemented by the cloud providers that can register the created instances in the
+// private DNS zone of the cluster.
+type DNSRegistrar interface {
+	// SetDNSRegistration sets whether the created instances are registered in the private DNS zone of the cluster,
+	// with a name derived from the instance name. The name is returned by the GetHostname method of the credentials,
+	// and the record is removed along with the instance.
+	SetDNSRegistration(enabled bool)
+}
+
+// LoadBalancerRegistrar is the interface implemented by the cloud providers that can add the created instances to the
+// backends of existing load balancers, e.g. to test ingress traffic through the Windows nodes.
+type LoadBalancerRegistrar interface {
+	// SetLoadBalancerTargets sets the load balancer target groups or backend pools the created instances are added
+	// to. The instances are removed from them along with the instances. An error is returned if a target is invalid.
+	SetLoadBalancerTargets(targets []string) error
+}
+
+// ComputerNamer is the interface implemented by the cloud providers that can set the Windows computer name of the
+// created instances, which the kubelet uses as the node name unless the cloud provider overrides it.
+type ComputerNamer interface {
+	// SetComputerName sets the computer name of the created instances. types.ComputerNamePrivateDNS names them after
+	// their private DNS name, if supported by the cloud provider. An error is returned if the name is invalid.
+	SetComputerName(name string) error
+}
+
+// WindowsUpdateController is the interface implemented by the cloud providers that can control Windows Update on the
+// created instances, so that automatic updates do not reboot them at any time.
+type WindowsUpdateController interface {
+	// SetWindowsUpdatePolicy sets the Windows Update policy applied to the created instances once they are reachable
+	SetWindowsUpdatePolicy(policy *types.WindowsUpdatePolicy)
+}
+
+// MetadataHardener is the interface implemented by the cloud providers that can harden the instance metadata service
+// of the created instances. Azure does not implement it, as its instance metadata service has no equivalent hardening.
+type MetadataHardener interface {
+	// SetMetadataOptions sets the hardening of the instance metadata service of the created instances
+	SetMetadataOptions(options *types.MetadataOptions)
+}
+
+// Exporter is the interface implemented by the cloud providers that can describe the created infrastructure, so that
+// it can be imported into infrastructure as code tools.
+type Exporter interface {
+	// Export describes the instances, security groups, key pairs and DNS records recorded in the
+	// 'windows-node-installer.json' file and the files next to it.
+	Export() (*export.Infrastructure, error)
+}
+
+// CredentialsGetter is the interface implemented by the cloud providers that can look up the credentials of the
+// created instances, so that they can be handed to other tools.
+type CredentialsGetter interface {
+	// GetCredentials returns the credentials of the instances recorded in the 'windows-node-installer.json' file
+	GetCredentials() ([]*types.Credentials, error)
+}
+
+// CostEstimator is the interface implemented by the cloud providers that can estimate the spend of the created
+// infrastructure.
+type CostEstimator interface {
+	// EstimateCost estimates the on-demand spend so far of the instances recorded in the 'windows-node-installer.json'
+	// file and their disks. The prices of the given price list, if any, take precedence over the ones of the cloud
+	// provider.
+	EstimateCost(overrides *cost.PriceList) (*cost.Report, error)
+}
+
+// QuotaChecker is the interface implemented by the cloud providers that can check the quotas of the account before
+// creating instances.
+type QuotaChecker interface {
+	// CheckQuotas returns a *quota.Error listing the exceeded quotas if the given number of instances, along with the
+	// resources created with them, do not fit the quotas of the account
+	CheckQuotas(count int) error
+}
+
+// Snapshotter is the interface implemented by the cloud providers that can checkpoint the created instances and roll
+// them back, e.g. between iterations on a configured node, instead of recreating them.
+type Snapshotter interface {
+	// Snapshot takes a snapshot with the given name of the disks of the given instance. The snapshots are recorded
+	// next to the 'windows-node-installer.json' file and are deleted along with the instance.
+	Snapshot(instanceID, name string) error
+	// RestoreSnapshot rolls the given instance back to its snapshot with the given name
+	RestoreSnapshot(instanceID, name string) error
+	// DeleteSnapshot deletes the snapshot of the given instance with the given name
+	DeleteSnapshot(instanceID, name string) error
+}
+
+// RegionGetter is the interface implemented by the cloud providers that create the instances in a region, e.g. to
+// compare how long the instances take to boot across regions.
+type RegionGetter interface {
+	// GetRegion returns the region the instances are created in
+	GetRegion() string
+}
+
 // CloudProviderFactory returns cloud specific interface for performing necessary functions related to creating or
 // destroying an instance.
 // The factory takes in kubeconfig of an existing OpenShift cluster and a cloud vendor specific credential file.
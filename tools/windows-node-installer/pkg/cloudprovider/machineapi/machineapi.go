@@ -0,0 +1,305 @@
+package machineapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/openshift/api/config/v1"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/client"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/resource"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+/*
+	machineapi creates the Windows VMs through the machine API of the cluster instead of calling the SDK of the cloud
+	provider, so that the production provisioning path is exercised. A machine set of one Windows machine is copied
+	from a Linux worker machine set with the Windows image and a user data secret, the machine API creates its
+	instance, and the credentials of the instance are read back from the secret.
+*/
+
+const (
+	// provisionTimeout is the time given to the machine API to create the instance of the machine
+	provisionTimeout = 20 * time.Minute
+	// windowsAccessTimeout is the time given to the instance to run its user data and answer WinRM requests
+	windowsAccessTimeout = 20 * time.Minute
+	// deletionTimeout is the time given to the machine API to delete the machines of a machine set
+	deletionTimeout = 15 * time.Minute
+	// pollInterval is the time waited between two checks of the machines and of the instances
+	pollInterval = 15 * time.Second
+)
+
+// Provider creates and destroys the Windows VMs through the machine API of the cluster
+type Provider struct {
+	// dynamic is the client of the machine sets and machines
+	dynamic dynamic.Interface
+	// kube is the client of the user data secrets
+	kube kubernetes.Interface
+	// openShiftClient is the client of the configuration of the cluster
+	openShiftClient *client.OpenShift
+	// platform is the platform of the cluster
+	platform v1.PlatformType
+	// imageID is the image of the created instances
+	imageID string
+	// instanceType is the instance type of the created instances, the one of the copied machine set if empty
+	instanceType string
+	// resourceTrackerDir is where `windows-node-installer.json` file is stored.
+	resourceTrackerDir string
+}
+
+// New returns a Provider creating the Windows VMs of the given image and instance type through the machine API of the
+// cluster of the given kubeconfig. The created machine sets are recorded next to the 'windows-node-installer.json'
+// file of the given directory.
+func New(kubeconfigPath, resourceTrackerDir, imageID, instanceType string) (*Provider, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	openShiftClient, err := client.GetOpenShift(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := openShiftClient.GetCloudProvider()
+	if err != nil {
+		return nil, err
+	}
+	resourceTrackerFilePath, err := resource.MakeFilePath(resourceTrackerDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{dynamicClient, kubeClient, openShiftClient, platform.Type, imageID, instanceType,
+		resourceTrackerFilePath}, nil
+}
+
+// CreateWindowsVM creates a machine set of one Windows machine, copied from a Linux worker machine set, and waits for
+// the machine API to create its instance. The password of the instance is set by the user data of the machine, which
+// is stored in a generated secret along with the credentials, and the credentials are read back from the secret once
+// the instance is provisioned. The machine set is recorded next to the 'windows-node-installer.json' file, so that it
+// is deleted along with its machine by DestroyWindowsVMs. The instance is reached through its internal IP, so the
+// tool has to run in the network of the cluster.
+func (p *Provider) CreateWindowsVM() (windowsVM types.WindowsVM, err error) {
+	ctx, span := tracing.Start(tracing.Context(), "CreateWindowsVM",
+		attribute.String("provisioner", "machine-api"))
+	op := progress.Start("CreateWindowsVM", 7)
+	defer func() {
+		op.End(err)
+		tracing.End(span, err)
+	}()
+
+	record := resource.MachineSet{Namespace: namespace}
+	filePath := resource.MachineSetFilePath(p.resourceTrackerDir)
+	err = op.Phase(ctx, "create user data secret", func() error {
+		infraID, err := p.openShiftClient.GetInfrastructureID()
+		if err != nil {
+			return err
+		}
+		suffix, err := randomSuffix()
+		if err != nil {
+			return err
+		}
+		record.Name = infraID + "-windows-" + suffix
+		record.UserDataSecret = record.Name + "-user-data"
+		password, err := generatePassword()
+		if err != nil {
+			return fmt.Errorf("error generating the password of the instance: %v", err)
+		}
+		_, err = p.kube.CoreV1().Secrets(namespace).Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: record.UserDataSecret, Namespace: namespace},
+			Data: map[string][]byte{
+				userDataKey: []byte(userData(password)),
+				usernameKey: []byte(winUser),
+				passwordKey: []byte(password),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error creating user data secret %s: %v", record.UserDataSecret, err)
+		}
+		// The secret is recorded right away, so that it is deleted even if the machine set cannot be created
+		return resource.AppendMachineSet(record, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("machine-set", record.Name))
+
+	err = op.Phase(ctx, "create machine set", func() error {
+		machineSets, err := p.dynamic.Resource(machineSetResource).Namespace(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing machine sets: %v", err)
+		}
+		template, err := selectTemplate(machineSets.Items)
+		if err != nil {
+			return err
+		}
+		machineSet, err := windowsMachineSet(template, record.Name, p.platform, p.imageID, p.instanceType,
+			record.UserDataSecret)
+		if err != nil {
+			return err
+		}
+		if _, err = p.dynamic.Resource(machineSetResource).Namespace(namespace).Create(machineSet,
+			metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating machine set %s: %v", record.Name, err)
+		}
+		log.Printf("created machine set %s from %s", record.Name, template.GetName())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ipAddress string
+	err = op.Phase(ctx, "wait for machine provisioned", func() error {
+		var err error
+		record.InstanceID, ipAddress, err = p.waitForMachine(ctx, record.Name)
+		if err != nil {
+			return err
+		}
+		return resource.AppendMachineSet(record, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("instance-id", record.InstanceID))
+
+	w := &types.Windows{}
+	err = op.Phase(ctx, "read credentials", func() error {
+		secret, err := p.kube.CoreV1().Secrets(namespace).Get(record.UserDataSecret, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("error getting user data secret %s: %v", record.UserDataSecret, err)
+		}
+		user, password := string(secret.Data[usernameKey]), string(secret.Data[passwordKey])
+		if user == "" || password == "" {
+			return fmt.Errorf("user data secret %s has no credentials", record.UserDataSecret)
+		}
+		w.Credentials = types.NewCredentials(record.InstanceID, ipAddress, password, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = op.Phase(ctx, "setup WinRM client", func() error {
+		if err := w.SetupWinRMClient(); err != nil {
+			return err
+		}
+		// The user data sets the password and configures WinRM once the instance booted
+		return poll.Until(ctx, "WinRM access to instance "+record.InstanceID,
+			poll.Options{Interval: pollInterval, Timeout: windowsAccessTimeout, Jitter: poll.DefaultJitter},
+			func() (bool, string, error) {
+				if _, _, err := w.Run("hostname", true); err != nil {
+					return false, err.Error(), nil
+				}
+				return true, "", nil
+			})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup winRM client for the Windows VM: %v", err)
+	}
+	err = op.Phase(ctx, "configure OpenSSH server", w.ConfigureOpenSSHServer)
+	if err != nil {
+		return w, fmt.Errorf("failed to configure OpenSSHServer on the Windows VM: %v", err)
+	}
+	err = op.Phase(ctx, "setup SSH client", w.GetSSHClient)
+	if err != nil {
+		return w, fmt.Errorf("failed to get ssh client for the Windows VM created: %v", err)
+	}
+	return w, nil
+}
+
+// waitForMachine waits for the machine API to provision the instance of the machine of the given machine set, and
+// returns the ID and the internal IP of the instance
+func (p *Provider) waitForMachine(ctx context.Context, machineSetName string) (string, string, error) {
+	var instance, ipAddress string
+	err := poll.Until(ctx, "the machine of machine set "+machineSetName+" to be provisioned",
+		poll.Options{Interval: pollInterval, Timeout: provisionTimeout, Jitter: poll.DefaultJitter},
+		func() (bool, string, error) {
+			machines, err := p.dynamic.Resource(machineResource).Namespace(namespace).List(metav1.ListOptions{
+				LabelSelector: machineSetLabel + "=" + machineSetName})
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			if len(machines.Items) == 0 {
+				return false, "no machine created", nil
+			}
+			machine := &machines.Items[0]
+			done, state, err := machineState(machine)
+			if err != nil || !done {
+				return false, state, err
+			}
+			providerID, _, _ := unstructured.NestedString(machine.Object, "spec", "providerID")
+			instance, ipAddress = instanceID(providerID), internalIP(machine)
+			return true, "", nil
+		})
+	return instance, ipAddress, err
+}
+
+// DestroyWindowsVMs deletes the machine sets recorded next to the 'windows-node-installer.json' file, waits for the
+// machine API to delete their machines and instances, and deletes their user data secrets. Failures are logged, so
+// that the other machine sets are still deleted.
+func (p *Provider) DestroyWindowsVMs() (err error) {
+	ctx, span := tracing.Start(tracing.Context(), "DestroyWindowsVMs",
+		attribute.String("provisioner", "machine-api"))
+	defer func() { tracing.End(span, err) }()
+
+	filePath := resource.MachineSetFilePath(p.resourceTrackerDir)
+	records, err := resource.ReadMachineSets(filePath)
+	if err != nil {
+		return err
+	}
+	// The machine sets are all deleted before waiting, so that their machines are deleted concurrently
+	background := metav1.DeletePropagationBackground
+	for _, record := range records {
+		err = p.dynamic.Resource(machineSetResource).Namespace(record.Namespace).Delete(record.Name,
+			&metav1.DeleteOptions{PropagationPolicy: &background})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("failed to delete machine set %s: %v", record.Name, err)
+		}
+	}
+	for _, record := range records {
+		err = poll.Until(ctx, "the machines of machine set "+record.Name+" to be deleted",
+			poll.Options{Interval: pollInterval, Timeout: deletionTimeout, Jitter: poll.DefaultJitter},
+			func() (bool, string, error) {
+				machines, err := p.dynamic.Resource(machineResource).Namespace(record.Namespace).List(
+					metav1.ListOptions{LabelSelector: machineSetLabel + "=" + record.Name})
+				if err != nil {
+					return false, err.Error(), nil
+				}
+				return len(machines.Items) == 0, fmt.Sprintf("%d machines left", len(machines.Items)), nil
+			})
+		if err != nil {
+			log.Printf("machines of machine set %s were not deleted: %v", record.Name, err)
+			continue
+		}
+		// The machine API reads the user data secret until the machines are deleted
+		err = p.kube.CoreV1().Secrets(record.Namespace).Delete(record.UserDataSecret, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("failed to delete user data secret %s: %v", record.UserDataSecret, err)
+			continue
+		}
+		if err = resource.RemoveMachineSet(record.Namespace, record.Name, filePath); err != nil {
+			log.Printf("%s file was not updated: %v", filePath, err)
+		}
+		log.Printf("deleted machine set %s", record.Name)
+	}
+	return nil
+}
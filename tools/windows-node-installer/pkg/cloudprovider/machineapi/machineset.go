@@ -0,0 +1,235 @@
+package machineapi
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/openshift/api/config/v1"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// namespace is the namespace of the machine sets, machines and user data secrets of the machine API
+	namespace = "openshift-machine-api"
+	// machineSetLabel is the label selecting the machines of a machine set
+	machineSetLabel = "machine.openshift.io/cluster-api-machineset"
+	// machineRoleLabel is the label holding the role of the machines of a machine set
+	machineRoleLabel = "machine.openshift.io/cluster-api-machine-role"
+	// osIDLabel is the label marking the Windows machines, as the Windows Machine Config Operator expects
+	osIDLabel = "machine.openshift.io/os-id"
+	// windowsOSID is the value of osIDLabel on the Windows machines
+	windowsOSID = "Windows"
+	// workerRole is the role of the machine sets used as template
+	workerRole = "worker"
+	// userDataKey is the key of the user data in the user data secret, which the machine API passes to the instances
+	userDataKey = "userData"
+	// usernameKey is the key of the user name of the instances in the user data secret
+	usernameKey = "username"
+	// passwordKey is the key of the password of the instances in the user data secret
+	passwordKey = "password"
+	// winUser is the user the instances are accessed with, whose password is set by the user data
+	winUser = "Administrator"
+	// passwordLength is the length of the generated passwords
+	passwordLength = 24
+	// nameSuffixLength is the length of the random suffix of the names of the machine sets
+	nameSuffixLength = 5
+)
+
+var (
+	// machineSetResource is the resource of the machine sets
+	machineSetResource = schema.GroupVersionResource{Group: "machine.openshift.io", Version: "v1beta1",
+		Resource: "machinesets"}
+	// machineResource is the resource of the machines
+	machineResource = schema.GroupVersionResource{Group: "machine.openshift.io", Version: "v1beta1",
+		Resource: "machines"}
+)
+
+// machine phases set by the machine API
+const (
+	// phaseProvisioned is the phase of a machine whose instance is created
+	phaseProvisioned = "Provisioned"
+	// phaseRunning is the phase of a machine whose node joined the cluster
+	phaseRunning = "Running"
+	// phaseFailed is the phase of a machine whose instance cannot be created
+	phaseFailed = "Failed"
+)
+
+// selectTemplate returns the worker machine set the Windows machine sets are copied from, the first one by name so
+// that the same zone is used from one run to the next
+func selectTemplate(machineSets []unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	var workers []unstructured.Unstructured
+	for _, machineSet := range machineSets {
+		labels, _, _ := unstructured.NestedStringMap(machineSet.Object, "spec", "template", "metadata", "labels")
+		if labels[machineRoleLabel] == workerRole && labels[osIDLabel] != windowsOSID {
+			workers = append(workers, machineSet)
+		}
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("no Linux worker machine set found in %s to copy", namespace)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].GetName() < workers[j].GetName() })
+	return &workers[0], nil
+}
+
+// windowsMachineSet returns a machine set of one Windows machine with the given name, copied from the given worker
+// machine set with the image, instance type and user data secret of the Windows machines on the given platform
+func windowsMachineSet(template *unstructured.Unstructured, name string, platform v1.PlatformType, imageID,
+	instanceType, userDataSecret string) (*unstructured.Unstructured, error) {
+	spec, found, err := unstructured.NestedMap(template.Object, "spec")
+	if err != nil || !found {
+		return nil, fmt.Errorf("machine set %s has no spec: %v", template.GetName(), err)
+	}
+	machineSet := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	machineSet.SetAPIVersion(template.GetAPIVersion())
+	machineSet.SetKind(template.GetKind())
+	machineSet.SetName(name)
+	machineSet.SetNamespace(namespace)
+	machineSet.SetLabels(template.GetLabels())
+
+	if err = unstructured.SetNestedField(machineSet.Object, int64(1), "spec", "replicas"); err != nil {
+		return nil, err
+	}
+	if err = unstructured.SetNestedStringMap(machineSet.Object, map[string]string{machineSetLabel: name},
+		"spec", "selector", "matchLabels"); err != nil {
+		return nil, err
+	}
+	labels, _, _ := unstructured.NestedStringMap(machineSet.Object, "spec", "template", "metadata", "labels")
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[machineSetLabel] = name
+	labels[osIDLabel] = windowsOSID
+	if err = unstructured.SetNestedStringMap(machineSet.Object, labels, "spec", "template", "metadata",
+		"labels"); err != nil {
+		return nil, err
+	}
+
+	providerSpec := []string{"spec", "template", "spec", "providerSpec", "value"}
+	if _, found, _ = unstructured.NestedMap(machineSet.Object, providerSpec...); !found {
+		return nil, fmt.Errorf("machine set %s has no provider spec", template.GetName())
+	}
+	fields := map[string]interface{}{
+		"userDataSecret": map[string]interface{}{"name": userDataSecret},
+	}
+	switch platform {
+	case v1.AWSPlatformType:
+		if imageID == "" {
+			return nil, fmt.Errorf("the ID of the Windows AMI is required on %s", platform)
+		}
+		fields["ami"] = map[string]interface{}{"id": imageID}
+		if instanceType != "" {
+			fields["instanceType"] = instanceType
+		}
+	default:
+		return nil, fmt.Errorf("creating Windows machines through the machine API is not supported on %s", platform)
+	}
+	for field, value := range fields {
+		if err = unstructured.SetNestedField(machineSet.Object, value, append(providerSpec, field)...); err != nil {
+			return nil, err
+		}
+	}
+	return machineSet, nil
+}
+
+// machineState returns whether the instance of the given machine is provisioned, and its state otherwise. An error
+// is returned if the machine API failed to provision it.
+func machineState(machine *unstructured.Unstructured) (bool, string, error) {
+	phase, _, _ := unstructured.NestedString(machine.Object, "status", "phase")
+	if phase == phaseFailed {
+		message, _, _ := unstructured.NestedString(machine.Object, "status", "errorMessage")
+		return false, "", fmt.Errorf("machine %s failed: %s", machine.GetName(), message)
+	}
+	if phase != phaseProvisioned && phase != phaseRunning {
+		return false, fmt.Sprintf("machine %s is in phase %q", machine.GetName(), phase), nil
+	}
+	if providerID, _, _ := unstructured.NestedString(machine.Object, "spec", "providerID"); providerID == "" {
+		return false, fmt.Sprintf("machine %s has no provider ID", machine.GetName()), nil
+	}
+	if internalIP(machine) == "" {
+		return false, fmt.Sprintf("machine %s has no internal IP", machine.GetName()), nil
+	}
+	return true, "", nil
+}
+
+// internalIP returns the internal IP address of the given machine, empty if it has none yet
+func internalIP(machine *unstructured.Unstructured) string {
+	addresses, _, _ := unstructured.NestedSlice(machine.Object, "status", "addresses")
+	for _, address := range addresses {
+		fields, ok := address.(map[string]interface{})
+		if ok && fields["type"] == "InternalIP" {
+			if ip, ok := fields["address"].(string); ok {
+				return ip
+			}
+		}
+	}
+	return ""
+}
+
+// instanceID returns the ID of the instance of the given provider ID, its last path segment, e.g. i-0123456789abcdef0
+// for aws:///us-east-1a/i-0123456789abcdef0
+func instanceID(providerID string) string {
+	return providerID[strings.LastIndex(providerID, "/")+1:]
+}
+
+// userData returns the user data of the Windows machines, setting the password of the user they are accessed with
+// and preparing WinRM and OpenSSH as the instances created by the cloud providers are
+func userData(password string) string {
+	return `<powershell>
+net user ` + winUser + ` '` + password + `' /active:yes
+$url = "https://raw.githubusercontent.com/ansible/ansible/devel/examples/scripts/ConfigureRemotingForAnsible.ps1"
+$file = "$env:temp\ConfigureRemotingForAnsible.ps1"
+(New-Object -TypeName System.Net.WebClient).DownloadFile($url, $file)
+& $file
+Add-WindowsCapability -Online -Name OpenSSH.Server~~~~0.0.1.0
+New-NetFirewallRule -DisplayName "` + types.FirewallRuleName + `" -Direction Inbound -Action Allow -Protocol TCP ` +
+		`-LocalPort ` + types.ContainerLogsPort + ` -EdgeTraversalPolicy Allow
+</powershell>
+<persist>true</persist>`
+}
+
+// generatePassword returns a random password meeting the complexity requirements of Windows. Its characters need no
+// quoting in a single quoted PowerShell string.
+func generatePassword() (string, error) {
+	classes := []string{"abcdefghijkmnopqrstuvwxyz", "ABCDEFGHJKLMNPQRSTUVWXYZ", "23456789", "!#%*+-=?@^_"}
+	all := strings.Join(classes, "")
+	password := make([]byte, passwordLength)
+	for i := range password {
+		// The first characters are taken from each class so that they are all present
+		class := all
+		if i < len(classes) {
+			class = classes[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(class))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = class[n.Int64()]
+	}
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+// randomSuffix returns a random suffix of lowercase letters and digits for the names of the machine sets
+func randomSuffix() (string, error) {
+	const characters = "bcdfghjklmnpqrstvwxz2456789"
+	suffix := make([]byte, nameSuffixLength)
+	for i := range suffix {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(characters))))
+		if err != nil {
+			return "", err
+		}
+		suffix[i] = characters[n.Int64()]
+	}
+	return string(suffix), nil
+}
@@ -0,0 +1,155 @@
+package machineapi
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newMachineSet returns a machine set of the given name whose machines have the given labels
+func newMachineSet(name string, labels map[string]string) unstructured.Unstructured {
+	templateLabels := map[string]interface{}{}
+	for key, value := range labels {
+		templateLabels[key] = value
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "machine.openshift.io/v1beta1",
+		"kind":       "MachineSet",
+		"metadata": map[string]interface{}{"name": name, "namespace": namespace,
+			"labels": map[string]interface{}{"machine.openshift.io/cluster-api-cluster": "cluster-x7k2p"}},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{machineSetLabel: name}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": templateLabels},
+				"spec": map[string]interface{}{"providerSpec": map[string]interface{}{"value": map[string]interface{}{
+					"ami":            map[string]interface{}{"id": "ami-rhcos"},
+					"instanceType":   "m5.large",
+					"userDataSecret": map[string]interface{}{"name": "worker-user-data"},
+				}}},
+			},
+		},
+	}}
+}
+
+// TestSelectTemplate tests that the first Linux worker machine set by name is copied
+func TestSelectTemplate(t *testing.T) {
+	worker := map[string]string{machineRoleLabel: workerRole}
+	machineSets := []unstructured.Unstructured{
+		newMachineSet("cluster-x7k2p-worker-us-east-1b", worker),
+		newMachineSet("cluster-x7k2p-infra-us-east-1a", map[string]string{machineRoleLabel: "infra"}),
+		newMachineSet("cluster-x7k2p-windows-abcde", map[string]string{machineRoleLabel: workerRole,
+			osIDLabel: windowsOSID}),
+		newMachineSet("cluster-x7k2p-worker-us-east-1a", worker),
+	}
+	template, err := selectTemplate(machineSets)
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-x7k2p-worker-us-east-1a", template.GetName())
+
+	_, err = selectTemplate(machineSets[1:3])
+	assert.Error(t, err, "no Linux worker machine set")
+}
+
+// TestWindowsMachineSet tests that the Windows machine set has one machine with the Windows image, instance type and
+// user data, and leaves the template unchanged
+func TestWindowsMachineSet(t *testing.T) {
+	template := newMachineSet("cluster-x7k2p-worker-us-east-1a", map[string]string{machineRoleLabel: workerRole})
+	machineSet, err := windowsMachineSet(&template, "cluster-x7k2p-windows-abcde", v1.AWSPlatformType,
+		"ami-windows", "m5a.large", "cluster-x7k2p-windows-abcde-user-data")
+	require.NoError(t, err)
+
+	assert.Equal(t, "cluster-x7k2p-windows-abcde", machineSet.GetName())
+	assert.Equal(t, namespace, machineSet.GetNamespace())
+	assert.Equal(t, "MachineSet", machineSet.GetKind())
+	assert.Equal(t, template.GetLabels(), machineSet.GetLabels())
+	replicas, _, _ := unstructured.NestedInt64(machineSet.Object, "spec", "replicas")
+	assert.Equal(t, int64(1), replicas)
+	selector, _, _ := unstructured.NestedStringMap(machineSet.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string{machineSetLabel: "cluster-x7k2p-windows-abcde"}, selector)
+	labels, _, _ := unstructured.NestedStringMap(machineSet.Object, "spec", "template", "metadata", "labels")
+	assert.Equal(t, map[string]string{machineRoleLabel: workerRole, machineSetLabel: "cluster-x7k2p-windows-abcde",
+		osIDLabel: windowsOSID}, labels)
+
+	providerSpec := []string{"spec", "template", "spec", "providerSpec", "value"}
+	for field, expected := range map[string]string{"ami.id": "ami-windows", "instanceType": "m5a.large",
+		"userDataSecret.name": "cluster-x7k2p-windows-abcde-user-data"} {
+		value, _, _ := unstructured.NestedString(machineSet.Object, append(providerSpec, strings.Split(field, ".")...)...)
+		assert.Equal(t, expected, value, field)
+	}
+	ami, _, _ := unstructured.NestedString(template.Object, append(providerSpec, "ami", "id")...)
+	assert.Equal(t, "ami-rhcos", ami, "the template was modified")
+
+	machineSet, err = windowsMachineSet(&template, "cluster-x7k2p-windows-abcde", v1.AWSPlatformType,
+		"ami-windows", "", "cluster-x7k2p-windows-abcde-user-data")
+	require.NoError(t, err)
+	instanceType, _, _ := unstructured.NestedString(machineSet.Object, append(providerSpec, "instanceType")...)
+	assert.Equal(t, "m5.large", instanceType, "the instance type of the template should be kept")
+
+	_, err = windowsMachineSet(&template, "cluster-x7k2p-windows-abcde", v1.AWSPlatformType, "", "", "secret")
+	assert.Error(t, err, "missing AMI")
+	_, err = windowsMachineSet(&template, "cluster-x7k2p-windows-abcde", v1.GCPPlatformType, "image", "", "secret")
+	assert.Error(t, err, "unsupported platform")
+}
+
+// TestMachineState tests that the machines are provisioned once they have a provider ID and an internal IP, and that
+// the failed machines stop the wait
+func TestMachineState(t *testing.T) {
+	machine := func(phase, providerID string, addresses ...interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "cluster-x7k2p-windows-abcde-q2w3e"},
+			"spec":     map[string]interface{}{"providerID": providerID},
+			"status": map[string]interface{}{"phase": phase, "addresses": addresses,
+				"errorMessage": "InvalidAMIID.NotFound"},
+		}}
+	}
+	internal := map[string]interface{}{"type": "InternalIP", "address": "10.0.1.2"}
+	dns := map[string]interface{}{"type": "InternalDNS", "address": "ip-10-0-1-2.ec2.internal"}
+
+	done, _, err := machineState(machine(phaseProvisioned, "aws:///us-east-1a/i-0123456789abcdef0", dns, internal))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "10.0.1.2", internalIP(machine(phaseRunning, "", dns, internal)))
+
+	for name, m := range map[string]*unstructured.Unstructured{
+		"provisioning":   machine("Provisioning", ""),
+		"no provider ID": machine(phaseProvisioned, "", internal),
+		"no internal IP": machine(phaseProvisioned, "aws:///us-east-1a/i-0123456789abcdef0", dns),
+	} {
+		done, state, err := machineState(m)
+		require.NoError(t, err, name)
+		assert.False(t, done, name)
+		assert.NotEmpty(t, state, name)
+	}
+
+	_, _, err = machineState(machine(phaseFailed, ""))
+	assert.EqualError(t, err, "machine cluster-x7k2p-windows-abcde-q2w3e failed: InvalidAMIID.NotFound")
+}
+
+// TestInstanceID tests that the instance IDs are the last segment of the provider IDs
+func TestInstanceID(t *testing.T) {
+	assert.Equal(t, "i-0123456789abcdef0", instanceID("aws:///us-east-1a/i-0123456789abcdef0"))
+	assert.Equal(t, "winnode-0", instanceID("azure:///subscriptions/8d6f0a3b/resourceGroups/cluster-rg/providers/"+
+		"Microsoft.Compute/virtualMachines/winnode-0"))
+}
+
+// TestGeneratePassword tests that the passwords meet the complexity requirements of Windows and can be single quoted
+// in the user data
+func TestGeneratePassword(t *testing.T) {
+	password, err := generatePassword()
+	require.NoError(t, err)
+	assert.Len(t, password, passwordLength)
+	assert.True(t, strings.IndexFunc(password, unicode.IsLower) >= 0, "no lowercase letter in %s", password)
+	assert.True(t, strings.IndexFunc(password, unicode.IsUpper) >= 0, "no uppercase letter in %s", password)
+	assert.True(t, strings.IndexFunc(password, unicode.IsDigit) >= 0, "no digit in %s", password)
+	assert.False(t, strings.ContainsAny(password, "'\"`$"), "characters to quote in %s", password)
+	assert.Contains(t, userData(password), "net user "+winUser+" '"+password+"' /active:yes")
+
+	other, err := generatePassword()
+	require.NoError(t, err)
+	assert.NotEqual(t, password, other)
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	config reads the WNI configuration file, which holds named profiles of the values that are otherwise given as
+	flags, so that long invocations do not have to be copy-pasted. For example:
+
+	default-profile: dev
+	profiles:
+	  dev:
+	    cloud: aws
+	    region: us-east-2
+	    kubeconfig: ~/clusters/dev/auth/kubeconfig
+	    credentials: ~/.aws/credentials
+	    credential-account: default
+	    instance-type: m5a.large
+	    ssh-key: libra
+	    private-key: ~/.ssh/libra.pem
+	    artifact-dir: ~/wni/dev
+*/
+
+const (
+	// ConfigEnvVar is the environment variable holding the location of the configuration file
+	ConfigEnvVar = "WNI_CONFIG"
+	// ProfileEnvVar is the environment variable holding the name of the profile to use
+	ProfileEnvVar = "WNI_PROFILE"
+)
+
+// Profile holds the values of a named set of flags. Empty values are ignored.
+type Profile struct {
+	// Cloud is the cloud provider the profile is for, e.g. aws or azure
+	Cloud string `json:"cloud,omitempty"`
+	// Region is the region of the cluster the profile is for
+	Region string `json:"region,omitempty"`
+	// Kubeconfig is the location of the kubeconfig of the cluster
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Credentials is the location of the cloud provider credentials file
+	Credentials string `json:"credentials,omitempty"`
+	// CredentialAccount is the account to use in the credentials file
+	CredentialAccount string `json:"credential-account,omitempty"`
+	// ImageID is the image the instances are created from
+	ImageID string `json:"image-id,omitempty"`
+	// InstanceType is the type of the instances created
+	InstanceType string `json:"instance-type,omitempty"`
+	// SSHKey is the name of the ssh key pair on the cloud provider
+	SSHKey string `json:"ssh-key,omitempty"`
+	// PrivateKey is the location of the private key of the ssh key pair
+	PrivateKey string `json:"private-key,omitempty"`
+	// ArtifactDir is the directory the windows-node-installer.json file is saved to and read from
+	ArtifactDir string `json:"artifact-dir,omitempty"`
+	// Network is how the instances are reached: auto, public or private
+	Network string `json:"network,omitempty"`
+	// RegisterDNS registers the created instances in the private DNS zone of the cluster
+	RegisterDNS bool `json:"register-dns,omitempty"`
+	// ComputerName is the Windows computer name of the created instances, or private-dns on AWS
+	ComputerName string `json:"computer-name,omitempty"`
+}
+
+// Config is the content of the configuration file
+type Config struct {
+	// DefaultProfile is the profile used when none is selected
+	DefaultProfile string `json:"default-profile,omitempty"`
+	// Profiles holds the profiles by name
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// DefaultPath returns the default location of the configuration file, ~/.wni/config.yaml
+func DefaultPath() string {
+	return filepath.Join(homedir.HomeDir(), ".wni", "config.yaml")
+}
+
+// Load reads the configuration file at the given path. An empty configuration is returned if the file does not exist.
+// Unknown fields are refused, so that typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("could not read configuration file %s: %v", path, err)
+	}
+	config := &Config{}
+	if err = yaml.UnmarshalStrict(contents, config); err != nil {
+		return nil, fmt.Errorf("could not parse configuration file %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Profile returns the profile with the given name, or the default profile if the name is empty. An empty profile is
+// returned if no name is given and there is no default profile.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+		if name == "" {
+			return Profile{}, nil
+		}
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %s not found, available profiles: %s", name,
+			strings.Join(c.ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the sorted names of the profiles
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandHome replaces a leading ~ in the given path with the home directory of the user
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(homedir.HomeDir(), path[1:])
+	}
+	return path
+}
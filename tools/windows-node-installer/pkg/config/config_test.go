@@ -0,0 +1,66 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/homedir"
+)
+
+// TestLoad tests that the configuration file is parsed and that its profiles are selected by name or by default
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	config, err := Load(path)
+	require.NoError(t, err, "error loading missing configuration file")
+	profile, err := config.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{}, profile)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`default-profile: dev
+profiles:
+  dev:
+    cloud: aws
+    region: us-east-2
+    instance-type: m5a.large
+    artifact-dir: ~/wni/dev
+  ci:
+    cloud: aws
+    instance-type: m5a.xlarge
+`), 0644))
+	config, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ci", "dev"}, config.ProfileNames())
+
+	profile, err = config.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Cloud: "aws", Region: "us-east-2", InstanceType: "m5a.large", ArtifactDir: "~/wni/dev"},
+		profile)
+	profile, err = config.Profile("ci")
+	require.NoError(t, err)
+	assert.Equal(t, "m5a.xlarge", profile.InstanceType)
+
+	_, err = config.Profile("prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "available profiles: ci, dev")
+
+	// Typos are refused
+	require.NoError(t, ioutil.WriteFile(path, []byte("profiles:\n  dev:\n    instance_type: m5a.large\n"), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+// TestExpandHome tests that a leading ~ is replaced with the home directory
+func TestExpandHome(t *testing.T) {
+	assert.Equal(t, filepath.Join(homedir.HomeDir(), ".ssh", "libra.pem"), ExpandHome("~/.ssh/libra.pem"))
+	assert.Equal(t, homedir.HomeDir(), ExpandHome("~"))
+	assert.Equal(t, "/tmp/~user", ExpandHome("/tmp/~user"))
+	assert.Equal(t, "~user/key", ExpandHome("~user/key"))
+}
@@ -0,0 +1,247 @@
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+	cost estimates the on-demand spend of the infrastructure created by wni, from the instance type, disks and running
+	time of each instance, so that the spend of the test runs can be reported without going through the bills.
+*/
+
+// Format is the format the cost report is written in
+type Format string
+
+const (
+	// FormatText writes the report as a table
+	FormatText Format = "text"
+	// FormatJSON writes the report as a JSON document
+	FormatJSON Format = "json"
+)
+
+const (
+	// CurrencyUSD is the currency of the default prices
+	CurrencyUSD = "USD"
+	// hoursPerMonth is the number of hours in a month, as used by the cloud providers to prorate monthly prices
+	hoursPerMonth = 730
+	// minimumBilledDuration is the minimum running time an instance is billed for
+	minimumBilledDuration = time.Minute
+)
+
+// defaultInstanceHourly holds the hourly on-demand prices of Windows instances, license included, in us-east-1. They
+// are used when the cloud provider prices are unavailable.
+var defaultInstanceHourly = map[string]float64{
+	"c5.large":   0.177,
+	"c5.xlarge":  0.354,
+	"m4.large":   0.192,
+	"m4.xlarge":  0.384,
+	"m5.large":   0.188,
+	"m5.xlarge":  0.376,
+	"m5.2xlarge": 0.752,
+	"m5a.large":  0.178,
+	"m5a.xlarge": 0.356,
+	"t3.large":   0.1112,
+	"t3.xlarge":  0.2032,
+}
+
+// defaultDiskMonthly holds the monthly prices of a GiB of EBS volume in us-east-1
+var defaultDiskMonthly = map[string]float64{
+	"gp2":      0.10,
+	"gp3":      0.08,
+	"io1":      0.125,
+	"st1":      0.045,
+	"sc1":      0.015,
+	"standard": 0.05,
+}
+
+// ParseFormat returns the format of the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid cost report format %q, must be one of %s and %s", name, FormatText,
+			FormatJSON)
+	}
+}
+
+// PriceList holds the on-demand prices the cost is estimated with
+type PriceList struct {
+	// Currency is the currency of the prices, e.g. USD
+	Currency string `json:"currency"`
+	// InstanceHourly is the hourly price of each instance type, Windows license included
+	InstanceHourly map[string]float64 `json:"instanceHourly"`
+	// DiskMonthly is the monthly price of a GiB of each disk type
+	DiskMonthly map[string]float64 `json:"diskMonthly"`
+}
+
+// DefaultPriceList returns the built-in prices in USD, which are the us-east-1 on-demand prices of the common
+// instance types and disk types
+func DefaultPriceList() *PriceList {
+	prices := &PriceList{Currency: CurrencyUSD, InstanceHourly: map[string]float64{},
+		DiskMonthly: map[string]float64{}}
+	for instanceType, price := range defaultInstanceHourly {
+		prices.InstanceHourly[instanceType] = price
+	}
+	for diskType, price := range defaultDiskMonthly {
+		prices.DiskMonthly[diskType] = price
+	}
+	return prices
+}
+
+// ReadPriceList reads the price list from the given JSON file. The currency defaults to USD.
+func ReadPriceList(filePath string) (*PriceList, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price list %s: %v", filePath, err)
+	}
+	var prices PriceList
+	if err := json.Unmarshal(content, &prices); err != nil {
+		return nil, fmt.Errorf("error parsing price list %s: %v", filePath, err)
+	}
+	if prices.Currency == "" {
+		prices.Currency = CurrencyUSD
+	}
+	for name, price := range prices.InstanceHourly {
+		if price < 0 {
+			return nil, fmt.Errorf("invalid price %v of instance type %s in %s", price, name, filePath)
+		}
+	}
+	for name, price := range prices.DiskMonthly {
+		if price < 0 {
+			return nil, fmt.Errorf("invalid price %v of disk type %s in %s", price, name, filePath)
+		}
+	}
+	return &prices, nil
+}
+
+// Resource is a billed instance and its disks
+type Resource struct {
+	// InstanceID is the ID of the instance
+	InstanceID string
+	// InstanceType is the flavor of the instance
+	InstanceType string
+	// Disks are the disks attached to the instance
+	Disks []Disk
+	// Start is the time the instance was launched
+	Start time.Time
+	// End is the time the instance was terminated, or the time of the estimate if it is still running
+	End time.Time
+}
+
+// Disk is a billed disk of an instance
+type Disk struct {
+	// Type is the type of the disk, e.g. gp2
+	Type string
+	// SizeGiB is the size of the disk in GiB
+	SizeGiB int64
+}
+
+// Report is the estimated cost of a set of instances
+type Report struct {
+	// Currency is the currency of the costs
+	Currency string `json:"currency"`
+	// Instances are the costs of each instance
+	Instances []InstanceCost `json:"instances"`
+	// Total is the total cost of the instances
+	Total float64 `json:"total"`
+	// Unpriced are the instance and disk types without a price, which are not part of the total
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// InstanceCost is the estimated cost of an instance and its disks
+type InstanceCost struct {
+	// InstanceID is the ID of the instance
+	InstanceID string `json:"instanceId"`
+	// InstanceType is the flavor of the instance
+	InstanceType string `json:"instanceType"`
+	// Hours is the billed running time of the instance in hours
+	Hours float64 `json:"hours"`
+	// DiskGiB is the total size of the disks of the instance in GiB
+	DiskGiB int64 `json:"diskGiB"`
+	// InstanceCost is the cost of running the instance
+	InstanceCost float64 `json:"instanceCost"`
+	// DiskCost is the cost of the disks of the instance for the same time
+	DiskCost float64 `json:"diskCost"`
+	// Total is the cost of the instance and its disks
+	Total float64 `json:"total"`
+}
+
+// Estimate returns the estimated cost of the given resources with the given prices. Instances are billed per second,
+// with a minimum of one minute, and disks are billed for the running time of their instance.
+func Estimate(resources []Resource, prices *PriceList) *Report {
+	report := &Report{Currency: prices.Currency}
+	unpriced := make(map[string]bool)
+	for _, resource := range resources {
+		billed := resource.End.Sub(resource.Start)
+		if billed < minimumBilledDuration {
+			billed = minimumBilledDuration
+		}
+		instanceCost := InstanceCost{
+			InstanceID:   resource.InstanceID,
+			InstanceType: resource.InstanceType,
+			Hours:        billed.Hours(),
+		}
+		if price, ok := prices.InstanceHourly[resource.InstanceType]; ok {
+			instanceCost.InstanceCost = price * instanceCost.Hours
+		} else {
+			unpriced["instance type "+resource.InstanceType] = true
+		}
+		for _, disk := range resource.Disks {
+			instanceCost.DiskGiB += disk.SizeGiB
+			if price, ok := prices.DiskMonthly[disk.Type]; ok {
+				instanceCost.DiskCost += price * float64(disk.SizeGiB) * instanceCost.Hours / hoursPerMonth
+			} else {
+				unpriced["disk type "+disk.Type] = true
+			}
+		}
+		instanceCost.Total = instanceCost.InstanceCost + instanceCost.DiskCost
+		report.Total += instanceCost.Total
+		report.Instances = append(report.Instances, instanceCost)
+	}
+	for name := range unpriced {
+		report.Unpriced = append(report.Unpriced, name)
+	}
+	sort.Strings(report.Unpriced)
+	return report
+}
+
+// Write writes the report in the given format to the given writer
+func Write(w io.Writer, report *Report, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case FormatText:
+		return writeText(w, report)
+	default:
+		return fmt.Errorf("invalid cost report format %q", format)
+	}
+}
+
+// writeText writes the report as a table with a line per instance and the total
+func writeText(w io.Writer, report *Report) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "INSTANCE\tTYPE\tHOURS\tDISK GiB\tINSTANCE COST\tDISK COST\tTOTAL\n")
+	for _, instance := range report.Instances {
+		fmt.Fprintf(table, "%s\t%s\t%.2f\t%d\t%.2f\t%.2f\t%.2f\n", instance.InstanceID, instance.InstanceType,
+			instance.Hours, instance.DiskGiB, instance.InstanceCost, instance.DiskCost, instance.Total)
+	}
+	fmt.Fprintf(table, "TOTAL\t\t\t\t\t\t%.2f %s\n", report.Total, report.Currency)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	for _, name := range report.Unpriced {
+		if _, err := fmt.Fprintf(w, "no price for %s, its cost is not part of the total\n", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
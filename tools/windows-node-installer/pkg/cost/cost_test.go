@@ -0,0 +1,132 @@
+package cost
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStart is the launch time of the test instances
+var testStart = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// TestEstimate tests that the instances are billed for their running time with their disks, and that the types
+// without a price are reported
+func TestEstimate(t *testing.T) {
+	prices := &PriceList{
+		Currency:       CurrencyUSD,
+		InstanceHourly: map[string]float64{"m5a.large": 0.178},
+		DiskMonthly:    map[string]float64{"gp2": 0.10},
+	}
+	report := Estimate([]Resource{
+		{
+			InstanceID:   "i-0123456789abcdef0",
+			InstanceType: "m5a.large",
+			Disks:        []Disk{{Type: "gp2", SizeGiB: 120}, {Type: "gp2", SizeGiB: 26}},
+			Start:        testStart,
+			End:          testStart.Add(2 * time.Hour),
+		},
+		{
+			InstanceID:   "i-0fedcba9876543210",
+			InstanceType: "m6i.large",
+			Disks:        []Disk{{Type: "io2", SizeGiB: 100}},
+			Start:        testStart,
+			End:          testStart.Add(10 * time.Second),
+		},
+	}, prices)
+
+	require.Len(t, report.Instances, 2)
+	first := report.Instances[0]
+	assert.Equal(t, 2.0, first.Hours)
+	assert.Equal(t, int64(146), first.DiskGiB)
+	assert.InDelta(t, 0.356, first.InstanceCost, 1e-9)
+	assert.InDelta(t, 0.10*146*2/730, first.DiskCost, 1e-9)
+	assert.InDelta(t, first.InstanceCost+first.DiskCost, first.Total, 1e-9)
+
+	// Instances are billed for at least a minute
+	second := report.Instances[1]
+	assert.InDelta(t, 1.0/60, second.Hours, 1e-9)
+	assert.Zero(t, second.Total)
+
+	assert.InDelta(t, first.Total, report.Total, 1e-9)
+	assert.Equal(t, CurrencyUSD, report.Currency)
+	assert.Equal(t, []string{"disk type io2", "instance type m6i.large"}, report.Unpriced)
+}
+
+// TestReadPriceList tests that the price list file is read with USD as the default currency, and that negative prices
+// are rejected
+func TestReadPriceList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "prices.json")
+	require.NoError(t, ioutil.WriteFile(filePath,
+		[]byte(`{"instanceHourly": {"m5a.large": 0.15}, "diskMonthly": {"gp3": 0.07}}`), 0644))
+	prices, err := ReadPriceList(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, &PriceList{
+		Currency:       CurrencyUSD,
+		InstanceHourly: map[string]float64{"m5a.large": 0.15},
+		DiskMonthly:    map[string]float64{"gp3": 0.07},
+	}, prices)
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`{"instanceHourly": {"m5a.large": -1}}`), 0644))
+	_, err = ReadPriceList(filePath)
+	assert.Error(t, err)
+
+	_, err = ReadPriceList(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+// TestDefaultPriceList tests that the default price list can be modified without affecting the built-in prices
+func TestDefaultPriceList(t *testing.T) {
+	prices := DefaultPriceList()
+	assert.Equal(t, CurrencyUSD, prices.Currency)
+	assert.Contains(t, prices.InstanceHourly, "m5a.large")
+	assert.Contains(t, prices.DiskMonthly, "gp2")
+	prices.InstanceHourly["m5a.large"] = 0
+	assert.NotZero(t, DefaultPriceList().InstanceHourly["m5a.large"])
+}
+
+// TestWrite tests that the report is written as a table or as JSON
+func TestWrite(t *testing.T) {
+	report := &Report{
+		Currency: CurrencyUSD,
+		Instances: []InstanceCost{{InstanceID: "i-0123456789abcdef0", InstanceType: "m5a.large", Hours: 2,
+			DiskGiB: 120, InstanceCost: 0.356, DiskCost: 0.0329, Total: 0.3889}},
+		Total:    0.3889,
+		Unpriced: []string{"disk type io2"},
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, Write(&text, report, FormatText))
+	assert.Equal(t,
+		"INSTANCE             TYPE       HOURS  DISK GiB  INSTANCE COST  DISK COST  TOTAL\n"+
+			"i-0123456789abcdef0  m5a.large  2.00   120       0.36           0.03       0.39\n"+
+			"TOTAL                                                                      0.39 USD\n"+
+			"no price for disk type io2, its cost is not part of the total\n", text.String())
+
+	var encoded bytes.Buffer
+	require.NoError(t, Write(&encoded, report, FormatJSON))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(encoded.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+
+	assert.Error(t, Write(&text, report, Format("yaml")))
+}
+
+// TestParseFormat tests that only the supported formats are accepted
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("json")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
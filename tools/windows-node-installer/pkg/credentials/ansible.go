@@ -0,0 +1,292 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ansibleGroup is the group of the hosts of the written Ansible inventories, the one the WSU playbook runs against
+	ansibleGroup = "win"
+	// ansibleAllGroup is the group every host of an Ansible inventory belongs to
+	ansibleAllGroup = "all"
+	// ansibleInstanceIDVar is the host variable holding the instance ID of a host, which Ansible does not use
+	ansibleInstanceIDVar = "instance_id"
+)
+
+// ansibleVarsSection holds the variables applying to the hosts of the written Ansible inventories
+var ansibleVarsSection = []string{
+	"ansible_connection=winrm",
+	// The WinRM listeners of the created instances have self-signed certificates
+	"ansible_winrm_server_cert_validation=ignore",
+}
+
+// ansibleInventory is a parsed Ansible INI inventory
+type ansibleInventory struct {
+	// hosts are the names of the hosts in the order they first appear
+	hosts []string
+	// hostVars are the variables of the host lines, by host name
+	hostVars map[string]map[string]string
+	// hostGroups are the groups the hosts are listed in, by host name
+	hostGroups map[string][]string
+	// groupVars are the variables of the [<group>:vars] sections, by group
+	groupVars map[string]map[string]string
+	// parents are the groups listing a group in their [<group>:children] section, by group
+	parents map[string][]string
+}
+
+// parseAnsible returns the hosts of the given Ansible INI inventory. The variables of the [<group>:vars] sections,
+// including the ones of the parent groups and [all:vars], apply to the hosts of the group, and the variables of a host
+// line take precedence over them. The port is the WinRM one if ansible_connection is winrm, the ssh one otherwise.
+func parseAnsible(content []byte) ([]Host, error) {
+	inventory := &ansibleInventory{
+		hostVars:   make(map[string]map[string]string),
+		hostGroups: make(map[string][]string),
+		groupVars:  make(map[string]map[string]string),
+		parents:    make(map[string][]string),
+	}
+	group, kind := "ungrouped", ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %s", lineNumber, line)
+			}
+			group, kind = strings.Trim(line, "[]"), ""
+			if i := strings.Index(group, ":"); i != -1 {
+				group, kind = group[:i], group[i+1:]
+			}
+			if kind != "" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: invalid section %s", lineNumber, line)
+			}
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			i := strings.Index(line, "=")
+			if i == -1 {
+				return nil, fmt.Errorf("line %d: expected <key>=<value> in the variables of group %s", lineNumber,
+					group)
+			}
+			if inventory.groupVars[group] == nil {
+				inventory.groupVars[group] = make(map[string]string)
+			}
+			inventory.groupVars[group][strings.TrimSpace(line[:i])] = unquote(strings.TrimSpace(line[i+1:]))
+		case "children":
+			inventory.parents[line] = append(inventory.parents[line], group)
+		default:
+			fields, err := splitFields(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			name := fields[0]
+			if _, ok := inventory.hostVars[name]; !ok {
+				inventory.hosts = append(inventory.hosts, name)
+				inventory.hostVars[name] = make(map[string]string)
+			}
+			inventory.hostGroups[name] = append(inventory.hostGroups[name], group)
+			for _, field := range fields[1:] {
+				i := strings.Index(field, "=")
+				if i == -1 {
+					return nil, fmt.Errorf("line %d: expected <key>=<value> in the variables of host %s, got %s",
+						lineNumber, name, field)
+				}
+				inventory.hostVars[name][field[:i]] = field[i+1:]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0, len(inventory.hosts))
+	for _, name := range inventory.hosts {
+		host, err := ansibleHost(name, inventory.vars(name))
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", name, err)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// vars returns the variables applying to the given host
+func (a *ansibleInventory) vars(host string) map[string]string {
+	vars := make(map[string]string)
+	for key, value := range a.groupVars[ansibleAllGroup] {
+		vars[key] = value
+	}
+	visited := make(map[string]bool)
+	var addGroup func(group string)
+	// The variables of the parent groups are added first, so that the ones of their children take precedence
+	addGroup = func(group string) {
+		if visited[group] {
+			return
+		}
+		visited[group] = true
+		for _, parent := range a.parents[group] {
+			addGroup(parent)
+		}
+		for key, value := range a.groupVars[group] {
+			vars[key] = value
+		}
+	}
+	for _, group := range a.hostGroups[host] {
+		addGroup(group)
+	}
+	for key, value := range a.hostVars[host] {
+		vars[key] = value
+	}
+	return vars
+}
+
+// ansibleHost returns the host of the given name and variables
+func ansibleHost(name string, vars map[string]string) (Host, error) {
+	host := Host{
+		Address:        name,
+		InstanceID:     vars[ansibleInstanceIDVar],
+		User:           firstValue(vars, "ansible_user", "ansible_ssh_user"),
+		Password:       firstValue(vars, "ansible_password", "ansible_ssh_pass"),
+		PrivateKeyPath: firstValue(vars, "ansible_ssh_private_key_file", "ansible_private_key_file"),
+	}
+	// The name of a host reached at another address is an alias
+	if address := vars["ansible_host"]; address != "" {
+		host.Name, host.Address = name, address
+	}
+	port, err := parsePort(firstValue(vars, "ansible_port", "ansible_ssh_port"))
+	if err != nil {
+		return host, err
+	}
+	if vars["ansible_connection"] == "winrm" {
+		host.WinRMPort = port
+		host.WinRMHTTP = vars["ansible_winrm_scheme"] == "http"
+	} else {
+		host.SSHPort = port
+	}
+	return host, nil
+}
+
+// marshalAnsible returns the Ansible INI inventory of the given hosts, in the win group reached over WinRM. The hosts
+// with a name are listed under it with ansible_host set to their address. The ssh ports and certificates are not
+// held, as Ansible reaches the hosts over WinRM.
+func marshalAnsible(hosts []Host) ([]byte, []string) {
+	var buf bytes.Buffer
+	var warnings []string
+	fmt.Fprintf(&buf, "[%s]\n", ansibleGroup)
+	for _, host := range hosts {
+		vars := map[string]string{
+			"ansible_user":                 host.User,
+			"ansible_password":             host.Password,
+			"ansible_ssh_private_key_file": host.PrivateKeyPath,
+			ansibleInstanceIDVar:           host.InstanceID,
+		}
+		name := host.Address
+		if host.Name != "" && host.Name != host.Address {
+			name = host.Name
+			vars["ansible_host"] = host.Address
+		}
+		if host.WinRMPort != 0 {
+			vars["ansible_port"] = strconv.Itoa(host.WinRMPort)
+		}
+		if host.WinRMHTTP {
+			vars["ansible_winrm_scheme"] = "http"
+		}
+		if host.SSHPort != 0 || host.CertificatePath != "" {
+			warnings = append(warnings, fmt.Sprintf("the ssh port and certificate of host %s are not held by the "+
+				"Ansible inventory, which reaches it over WinRM", host.id()))
+		}
+
+		buf.WriteString(quote(name))
+		for _, key := range sortedKeys(vars) {
+			if vars[key] != "" {
+				fmt.Fprintf(&buf, " %s=%s", key, quote(vars[key]))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "\n[%s:vars]\n%s\n", ansibleGroup, strings.Join(ansibleVarsSection, "\n"))
+	return buf.Bytes(), warnings
+}
+
+// firstValue returns the value of the first of the given variables which is set
+func firstValue(vars map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := vars[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// splitFields splits the given host line into its fields, separated by whitespace, as a shell would. Quotes group
+// the characters between them, a backslash escapes the next character outside of single quotes, and a # starting a
+// field starts a comment.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quoteChar rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			field.WriteRune(c)
+			escaped = false
+		case c == '\\' && quoteChar != '\'':
+			escaped, inField = true, true
+		case quoteChar != 0:
+			if c == quoteChar {
+				quoteChar = 0
+			} else {
+				field.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quoteChar, inField = c, true
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case c == '#' && !inField:
+			return fields, nil
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+	if quoteChar != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %s", line)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// quote returns the given value, in double quotes if it holds characters splitFields would otherwise interpret
+func quote(value string) string {
+	if !strings.ContainsAny(value, " \t\"'\\#;") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// unquote returns the given value of a variables section without its surrounding quotes
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,393 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+	credentials converts the credentials of Windows hosts between the formats of the workflows using them: the
+	'windows-node-installer.json' file of wni, Kubernetes Secrets, the Ansible inventory of the WSU playbook and the
+	inventory of existing hosts the e2e tests run against (bring your own host). An environment provisioned by one
+	workflow can then be consumed by another without reformatting it by hand.
+*/
+
+// Format is a format the credentials of Windows hosts are read from or written to
+type Format string
+
+const (
+	// FormatState is the 'windows-node-installer.json' file, which records the instance IDs of the instances created
+	// by wni. Their credentials are looked up on the cloud provider.
+	FormatState Format = "state"
+	// FormatSecret is a list of Kubernetes Secrets, one per host
+	FormatSecret Format = "secret"
+	// FormatAnsible is an Ansible INI inventory, as used by the WSU playbook
+	FormatAnsible Format = "ansible"
+	// FormatBYOH is the YAML inventory of existing hosts the e2e tests run against with E2E_INVENTORY
+	FormatBYOH Format = "byoh"
+)
+
+const (
+	// secretNamePrefix is the prefix of the names of the Secrets of the hosts
+	secretNamePrefix = "windows-credentials-"
+	// hostLabel is the label identifying the Secrets holding the credentials of a Windows host
+	hostLabel = "windows-node-installer.openshift.io/host"
+	// Keys of the data of the Secrets of the hosts
+	secretKeyName       = "name"
+	secretKeyInstanceID = "instance-id"
+	secretKeyAddress    = "address"
+	secretKeyUsername   = "username"
+	secretKeyPassword   = "password"
+	secretKeySSHPort    = "ssh-port"
+	secretKeyWinRMPort  = "winrm-port"
+	secretKeyWinRMHTTP  = "winrm-http"
+)
+
+// invalidNameChars matches the characters which are not allowed in the name of a Secret
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ParseFormat returns the format of the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatState, FormatSecret, FormatAnsible, FormatBYOH:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid credentials format %q, must be one of %s, %s, %s and %s", name, FormatState,
+			FormatSecret, FormatAnsible, FormatBYOH)
+	}
+}
+
+// Host holds the credentials of a Windows host and how it is reached
+type Host struct {
+	// Name identifies the host, e.g. its DNS name, empty if it has none
+	Name string
+	// InstanceID is the ID of the cloud instance of the host, empty if it is not known
+	InstanceID string
+	// Address is the IP address or DNS name the host is reached at
+	Address string
+	// User is the user the host is accessed as
+	User string
+	// Password is the password of the user
+	Password string
+	// PrivateKeyPath is the path of the private key authenticating the user over ssh
+	PrivateKeyPath string
+	// CertificatePath is the path of the ssh certificate of the private key
+	CertificatePath string
+	// SSHPort is the port of the OpenSSH server of the host, 0 for the default one
+	SSHPort int
+	// WinRMPort is the port of the WinRM listener of the host, 0 for the default one
+	WinRMPort int
+	// WinRMHTTP is true if the WinRM listener is unencrypted
+	WinRMHTTP bool
+}
+
+// id returns what identifies the host in the messages and in the formats holding a single identifier
+func (h *Host) id() string {
+	if h.InstanceID != "" {
+		return h.InstanceID
+	}
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Address
+}
+
+// FromCredentials returns the hosts of the given credentials of the instances created by wni
+func FromCredentials(creds []*types.Credentials) []Host {
+	hosts := make([]Host, 0, len(creds))
+	for _, cred := range creds {
+		hosts = append(hosts, Host{
+			Name:       cred.GetHostname(),
+			InstanceID: cred.GetInstanceId(),
+			Address:    cred.GetIPAddress(),
+			User:       cred.GetUserName(),
+			Password:   cred.GetPassword(),
+		})
+	}
+	return hosts
+}
+
+// InstanceIDs returns the instance IDs the given hosts are recorded with in the 'windows-node-installer.json' file.
+// The hosts read from a format without instance IDs are recorded with their name, e.g. the names of the byoh
+// inventory hosts, which are the instance IDs of the instances it was written from.
+func InstanceIDs(hosts []Host) ([]string, error) {
+	ids := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		id := host.InstanceID
+		if id == "" {
+			id = host.Name
+		}
+		if id == "" {
+			return nil, fmt.Errorf("host %s has neither an instance ID nor a name", host.Address)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Read reads the hosts from the given reader in the given format. The state format needs the cloud provider and is
+// not read from a reader.
+func Read(r io.Reader, format Format) ([]Host, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []Host
+	switch format {
+	case FormatSecret:
+		hosts, err = parseSecrets(content)
+	case FormatAnsible:
+		hosts, err = parseAnsible(content)
+	case FormatBYOH:
+		hosts, err = parseBYOH(content)
+	default:
+		return nil, fmt.Errorf("the credentials cannot be read in %s format", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts found")
+	}
+	for _, host := range hosts {
+		if host.Address == "" {
+			return nil, fmt.Errorf("host %s has no address", host.id())
+		}
+	}
+	return hosts, nil
+}
+
+// Write writes the given hosts to the given writer in the given format. It returns warnings for the fields of the
+// hosts which the format cannot hold and are dropped. The state format records the instance IDs in a file and is not
+// written to a writer.
+func Write(w io.Writer, hosts []Host, format Format) ([]string, error) {
+	var content []byte
+	var warnings []string
+	var err error
+	switch format {
+	case FormatSecret:
+		content, warnings, err = marshalSecrets(hosts)
+	case FormatAnsible:
+		content, warnings = marshalAnsible(hosts)
+	case FormatBYOH:
+		content, err = marshalBYOH(hosts)
+	default:
+		return nil, fmt.Errorf("the credentials cannot be written in %s format", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(content)
+	return warnings, err
+}
+
+// byohInventory is the inventory of existing hosts of the e2e tests, see the Inventory type of the test framework
+type byohInventory struct {
+	Hosts []byohHost `json:"hosts"`
+}
+
+// byohHost is a host of the inventory of existing hosts of the e2e tests
+type byohHost struct {
+	Name            string `json:"name,omitempty"`
+	IP              string `json:"ip"`
+	User            string `json:"user,omitempty"`
+	Password        string `json:"password,omitempty"`
+	PrivateKeyPath  string `json:"privateKeyPath,omitempty"`
+	CertificatePath string `json:"certificatePath,omitempty"`
+	SSHPort         int    `json:"sshPort,omitempty"`
+	WinRMPort       int    `json:"winrmPort,omitempty"`
+	WinRMHTTP       bool   `json:"winrmHTTP,omitempty"`
+}
+
+// parseBYOH returns the hosts of the given byoh inventory
+func parseBYOH(content []byte) ([]Host, error) {
+	var inventory byohInventory
+	if err := yaml.UnmarshalStrict(content, &inventory); err != nil {
+		return nil, fmt.Errorf("error parsing byoh inventory: %v", err)
+	}
+	hosts := make([]Host, 0, len(inventory.Hosts))
+	for _, h := range inventory.Hosts {
+		hosts = append(hosts, Host{Name: h.Name, Address: h.IP, User: h.User, Password: h.Password,
+			PrivateKeyPath: h.PrivateKeyPath, CertificatePath: h.CertificatePath, SSHPort: h.SSHPort,
+			WinRMPort: h.WinRMPort, WinRMHTTP: h.WinRMHTTP})
+	}
+	return hosts, nil
+}
+
+// marshalBYOH returns the byoh inventory of the given hosts. The hosts are named after their instance ID, which the
+// e2e tests use in its place.
+func marshalBYOH(hosts []Host) ([]byte, error) {
+	inventory := byohInventory{Hosts: []byohHost{}}
+	for _, h := range hosts {
+		name := h.InstanceID
+		if name == "" {
+			name = h.Name
+		}
+		inventory.Hosts = append(inventory.Hosts, byohHost{Name: name, IP: h.Address, User: h.User,
+			Password: h.Password, PrivateKeyPath: h.PrivateKeyPath, CertificatePath: h.CertificatePath,
+			SSHPort: h.SSHPort, WinRMPort: h.WinRMPort, WinRMHTTP: h.WinRMHTTP})
+	}
+	return yaml.Marshal(inventory)
+}
+
+// parseSecrets returns the hosts of the given Secret, or List of Secrets, as YAML or JSON
+func parseSecrets(content []byte) ([]Host, error) {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(content, &typeMeta); err != nil {
+		return nil, fmt.Errorf("error parsing secrets: %v", err)
+	}
+	var secrets []v1.Secret
+	switch typeMeta.Kind {
+	case "Secret":
+		var secret v1.Secret
+		if err := yaml.Unmarshal(content, &secret); err != nil {
+			return nil, fmt.Errorf("error parsing secret: %v", err)
+		}
+		secrets = append(secrets, secret)
+	case "List", "SecretList":
+		var list v1.List
+		if err := yaml.Unmarshal(content, &list); err != nil {
+			return nil, fmt.Errorf("error parsing list of secrets: %v", err)
+		}
+		for i, item := range list.Items {
+			var secret v1.Secret
+			if err := json.Unmarshal(item.Raw, &secret); err != nil {
+				return nil, fmt.Errorf("error parsing item %d of the list: %v", i, err)
+			}
+			if secret.Kind != "" && secret.Kind != "Secret" {
+				return nil, fmt.Errorf("item %d of the list is a %s, not a Secret", i, secret.Kind)
+			}
+			secrets = append(secrets, secret)
+		}
+	default:
+		return nil, fmt.Errorf("expected a Secret or a List of Secrets, got kind %q", typeMeta.Kind)
+	}
+
+	hosts := make([]Host, 0, len(secrets))
+	for _, secret := range secrets {
+		host, err := secretHost(&secret)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing secret %s: %v", secret.Name, err)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// secretHost returns the host of the given Secret, from its string data or its data
+func secretHost(secret *v1.Secret) (Host, error) {
+	data := make(map[string]string)
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	for key, value := range secret.StringData {
+		data[key] = value
+	}
+	host := Host{Name: data[secretKeyName], InstanceID: data[secretKeyInstanceID], Address: data[secretKeyAddress],
+		User: data[secretKeyUsername], Password: data[secretKeyPassword]}
+	var err error
+	if host.SSHPort, err = parsePort(data[secretKeySSHPort]); err != nil {
+		return host, err
+	}
+	if host.WinRMPort, err = parsePort(data[secretKeyWinRMPort]); err != nil {
+		return host, err
+	}
+	if value := data[secretKeyWinRMHTTP]; value != "" {
+		if host.WinRMHTTP, err = strconv.ParseBool(value); err != nil {
+			return host, fmt.Errorf("invalid %s %q", secretKeyWinRMHTTP, value)
+		}
+	}
+	return host, nil
+}
+
+// marshalSecrets returns a List of Secrets holding the credentials of the given hosts, one per host. The private keys
+// are not held, as the Secrets would need their content rather than their path.
+func marshalSecrets(hosts []Host) ([]byte, []string, error) {
+	list := v1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+	var warnings []string
+	names := make(map[string]bool)
+	for _, host := range hosts {
+		name := secretName(host.id())
+		if names[name] {
+			return nil, nil, fmt.Errorf("hosts share the same secret name %s", name)
+		}
+		names[name] = true
+		if host.PrivateKeyPath != "" || host.CertificatePath != "" {
+			warnings = append(warnings, fmt.Sprintf("the private key and certificate paths of host %s are not "+
+				"held by its secret", host.id()))
+		}
+		data := map[string]string{
+			secretKeyName:       host.Name,
+			secretKeyInstanceID: host.InstanceID,
+			secretKeyAddress:    host.Address,
+			secretKeyUsername:   host.User,
+			secretKeyPassword:   host.Password,
+		}
+		if host.SSHPort != 0 {
+			data[secretKeySSHPort] = strconv.Itoa(host.SSHPort)
+		}
+		if host.WinRMPort != 0 {
+			data[secretKeyWinRMPort] = strconv.Itoa(host.WinRMPort)
+		}
+		if host.WinRMHTTP {
+			data[secretKeyWinRMHTTP] = "true"
+		}
+		for key, value := range data {
+			if value == "" {
+				delete(data, key)
+			}
+		}
+		secret := &v1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{hostLabel: "true"}},
+			Type:       v1.SecretTypeOpaque,
+			StringData: data,
+		}
+		raw, err := json.Marshal(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		list.Items = append(list.Items, runtime.RawExtension{Raw: raw})
+	}
+	content, err := yaml.Marshal(list)
+	return content, warnings, err
+}
+
+// secretName returns the name of the Secret of the host of the given ID, made of the characters a Secret name allows
+func secretName(id string) string {
+	return secretNamePrefix + strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(id), "-"), "-")
+}
+
+// parsePort returns the port of the given value, 0 if it is empty
+func parsePort(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
+
+// sortedKeys returns the keys of the given map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,149 @@
+package credentials
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHosts are hosts holding the fields every format can hold
+var testHosts = []Host{
+	{InstanceID: "i-0123456789abcdef0", Address: "10.0.0.5", User: "Administrator", Password: `p@ss "w#rd"`},
+	{Name: "lab-host-1", Address: "192.168.1.20", User: "admin", Password: "secret", WinRMPort: 5985,
+		WinRMHTTP: true},
+}
+
+// TestParseFormat tests the parsing of the format names
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("ansible")
+	require.NoError(t, err)
+	assert.Equal(t, FormatAnsible, format)
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
+
+// TestRoundTrip tests that the hosts written in a format are read back unchanged
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatSecret, FormatAnsible} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			warnings, err := Write(&buf, testHosts, format)
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			hosts, err := Read(&buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, testHosts, hosts)
+		})
+	}
+
+	// The byoh inventory names the hosts after their instance ID
+	var buf bytes.Buffer
+	_, err := Write(&buf, testHosts, FormatBYOH)
+	require.NoError(t, err)
+	hosts, err := Read(&buf, FormatBYOH)
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "i-0123456789abcdef0", hosts[0].Name)
+	assert.Equal(t, testHosts[1], hosts[1])
+	ids, err := InstanceIDs(hosts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"i-0123456789abcdef0", "lab-host-1"}, ids)
+}
+
+// TestWriteWarnings tests that the fields a format cannot hold are reported
+func TestWriteWarnings(t *testing.T) {
+	hosts := []Host{{Address: "10.0.0.5", Password: "secret", PrivateKeyPath: "/keys/id_rsa", SSHPort: 2222}}
+	var buf bytes.Buffer
+	warnings, err := Write(&buf, hosts, FormatSecret)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	warnings, err = Write(&buf, hosts, FormatAnsible)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	warnings, err = Write(&buf, hosts, FormatBYOH)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	_, err = Write(&buf, hosts, FormatState)
+	assert.Error(t, err, "the state format is not written to a writer")
+}
+
+// TestParseAnsible tests that the variables of the groups, their parents and the hosts apply to the hosts of an
+// inventory such as the one of the WSU playbook
+func TestParseAnsible(t *testing.T) {
+	inventory := `
+# Windows nodes
+[win]
+10.0.0.5 ansible_password='p w' instance_id=i-0123456789abcdef0
+node-2 ansible_host=10.0.0.6 ansible_password=secret ansible_user=admin
+
+[win:vars]
+ansible_user=Administrator
+cluster_address=example.com
+ansible_connection=winrm
+ansible_ssh_port=5986
+
+[lab]
+10.0.0.7 ansible_password=secret ansible_port=22
+
+[windows:children]
+win
+
+[windows:vars]
+ansible_winrm_scheme="http"
+`
+	hosts, err := Read(strings.NewReader(inventory), FormatAnsible)
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{InstanceID: "i-0123456789abcdef0", Address: "10.0.0.5", User: "Administrator", Password: "p w",
+			WinRMPort: 5986, WinRMHTTP: true},
+		{Name: "node-2", Address: "10.0.0.6", User: "admin", Password: "secret", WinRMPort: 5986, WinRMHTTP: true},
+		{Address: "10.0.0.7", Password: "secret", SSHPort: 22},
+	}, hosts)
+
+	for _, invalid := range []string{"[win", "[win:hosts]\n10.0.0.5", "[win:vars]\nansible_user", "10.0.0.5 port",
+		"10.0.0.5 ansible_password='secret", "# no hosts"} {
+		_, err = Read(strings.NewReader(invalid), FormatAnsible)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestParseSecrets tests that a single Secret is read from its data or string data, and that a List holds Secrets
+func TestParseSecrets(t *testing.T) {
+	secret := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: windows-credentials-node
+data:
+  address: MTAuMC4wLjU=
+  password: c2VjcmV0
+stringData:
+  username: Administrator
+  ssh-port: "2222"
+`
+	hosts, err := Read(strings.NewReader(secret), FormatSecret)
+	require.NoError(t, err)
+	assert.Equal(t, []Host{{Address: "10.0.0.5", User: "Administrator", Password: "secret", SSHPort: 2222}}, hosts)
+
+	for _, invalid := range []string{
+		"kind: ConfigMap",
+		"kind: List\nitems:\n- kind: ConfigMap",
+		"kind: Secret\nstringData:\n  address: 10.0.0.5\n  winrm-port: https",
+		"kind: Secret\nstringData:\n  password: secret",
+		"kind: List\nitems: []",
+	} {
+		_, err = Read(strings.NewReader(invalid), FormatSecret)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestSecretName tests that the Secret names only hold the characters the Secret names allow
+func TestSecretName(t *testing.T) {
+	assert.Equal(t, "windows-credentials-i-0123456789abcdef0", secretName("i-0123456789abcdef0"))
+	assert.Equal(t, "windows-credentials-10-0-0-5", secretName("10.0.0.5"))
+	assert.Equal(t, "windows-credentials-ip-10-0-0-5-ec2-internal", secretName("ip-10-0-0-5.EC2.internal."))
+}
@@ -0,0 +1,164 @@
+package diagnose
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+)
+
+const (
+	// Benchmark is the CIS benchmark the controls are taken from, with the level and profile they apply to
+	Benchmark = "CIS Microsoft Windows Server 2019 Benchmark v1.2.1, Level 1 Member Server"
+	// notConfigured is the value reported for a policy which is not set on the node
+	notConfigured = "<not configured>"
+	// controlError prefixes the value reported for a control whose query failed
+	controlError = "<error: "
+)
+
+// ControlResult is the outcome of a control of the CIS benchmark on the node
+type ControlResult struct {
+	// ID is the number of the control in the benchmark, e.g. 2.3.1.3
+	ID string `json:"id"`
+	// Title is the recommendation of the control
+	Title string `json:"title"`
+	// Status is pass if the node meets the control, fail otherwise
+	Status Status `json:"status"`
+	// Actual is the value of the setting on the node
+	Actual string `json:"actual"`
+	// Expected is the value the control requires
+	Expected string `json:"expected"`
+}
+
+// control is a control of the CIS benchmark, checked by comparing the value returned by read-only PowerShell statements
+// with the value the control requires
+type control struct {
+	// id is the number of the control in the benchmark
+	id string
+	// title is the recommendation of the control
+	title string
+	// query is the PowerShell statements returning the value of the setting
+	query string
+	// expected is the value the control requires, compared case-insensitively
+	expected string
+}
+
+// policy returns the PowerShell expression returning the given registry value of HKLM, or notConfigured if it is not
+// set
+func policy(key, name string) string {
+	return fmt.Sprintf("Get-PolicyValue 'HKLM:\\%s' '%s'", key, name)
+}
+
+// controls are the controls of the CIS benchmark relevant to the container hosts: the ones hardening the accounts,
+// the network authentication, the Windows Firewall, SMB and the WinRM service the nodes are configured over. The
+// controls enforced through the security database, like the password policy and the audit policy, are not checked, as
+// reading it writes an export file on the node.
+var controls = []control{
+	// The Guest account is disabled if it was deleted
+	{"2.3.1.2", "Ensure 'Accounts: Guest account status' is set to 'Disabled'",
+		"$guest = Get-LocalUser | Where-Object { $_.SID.Value -like '*-501' }; " +
+			"if ($guest -eq $null) { $false } else { $guest.Enabled }", "False"},
+	{"2.3.1.3", "Ensure 'Accounts: Limit local account use of blank passwords to console logon only' is set to " +
+		"'Enabled'", policy("SYSTEM\\CurrentControlSet\\Control\\Lsa", "LimitBlankPasswordUse"), "1"},
+	{"2.3.10.2", "Ensure 'Network access: Do not allow anonymous enumeration of SAM accounts' is set to 'Enabled'",
+		policy("SYSTEM\\CurrentControlSet\\Control\\Lsa", "RestrictAnonymousSAM"), "1"},
+	{"2.3.10.3", "Ensure 'Network access: Do not allow anonymous enumeration of SAM accounts and shares' is set to " +
+		"'Enabled'", policy("SYSTEM\\CurrentControlSet\\Control\\Lsa", "RestrictAnonymous"), "1"},
+	{"2.3.11.5", "Ensure 'Network security: Do not store LAN Manager hash value on next password change' is set to " +
+		"'Enabled'", policy("SYSTEM\\CurrentControlSet\\Control\\Lsa", "NoLMHash"), "1"},
+	{"2.3.11.7", "Ensure 'Network security: LAN Manager authentication level' is set to 'Send NTLMv2 response " +
+		"only. Refuse LM & NTLM'", policy("SYSTEM\\CurrentControlSet\\Control\\Lsa", "LmCompatibilityLevel"), "5"},
+	{"9.1.1", "Ensure 'Windows Firewall: Domain: Firewall state' is set to 'On'",
+		"(Get-NetFirewallProfile -Name Domain).Enabled", "True"},
+	{"9.2.1", "Ensure 'Windows Firewall: Private: Firewall state' is set to 'On'",
+		"(Get-NetFirewallProfile -Name Private).Enabled", "True"},
+	{"9.3.1", "Ensure 'Windows Firewall: Public: Firewall state' is set to 'On'",
+		"(Get-NetFirewallProfile -Name Public).Enabled", "True"},
+	{"18.3.1", "Ensure 'Apply UAC restrictions to local accounts on network logons' is set to 'Enabled'",
+		policy("SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Policies\\System", "LocalAccountTokenFilterPolicy"),
+		"0"},
+	// The SMB v1 client driver is disabled if it is not installed
+	{"18.3.2", "Ensure 'Configure SMB v1 client driver' is set to 'Enabled: Disable driver'",
+		"if (Test-Path 'HKLM:\\SYSTEM\\CurrentControlSet\\Services\\mrxsmb10') { " +
+			policy("SYSTEM\\CurrentControlSet\\Services\\mrxsmb10", "Start") + " } else { 4 }", "4"},
+	{"18.3.3", "Ensure 'Configure SMB v1 server' is set to 'Disabled'",
+		"(Get-SmbServerConfiguration).EnableSMB1Protocol", "False"},
+	{"18.9.102.1.1", "Ensure 'WinRM Client: Allow Basic authentication' is set to 'Disabled'",
+		policy("SOFTWARE\\Policies\\Microsoft\\Windows\\WinRM\\Client", "AllowBasic"), "0"},
+	{"18.9.102.1.2", "Ensure 'WinRM Client: Allow unencrypted traffic' is set to 'Disabled'",
+		policy("SOFTWARE\\Policies\\Microsoft\\Windows\\WinRM\\Client", "AllowUnencryptedTraffic"), "0"},
+	{"18.9.102.2.1", "Ensure 'WinRM Service: Allow Basic authentication' is set to 'Disabled'",
+		policy("SOFTWARE\\Policies\\Microsoft\\Windows\\WinRM\\Service", "AllowBasic"), "0"},
+	{"18.9.102.2.3", "Ensure 'WinRM Service: Allow unencrypted traffic' is set to 'Disabled'",
+		policy("SOFTWARE\\Policies\\Microsoft\\Windows\\WinRM\\Service", "AllowUnencryptedTraffic"), "0"},
+	{"18.9.102.2.4", "Ensure 'WinRM Service: Disallow WinRM from storing RunAs credentials' is set to 'Enabled'",
+		policy("SOFTWARE\\Policies\\Microsoft\\Windows\\WinRM\\Service", "DisableRunAs"), "1"},
+}
+
+// benchmarkScript returns the PowerShell script printing the value of each of the given controls on a line of its own,
+// as <id>=<value>. Only queries are run, so that the benchmark can be checked on production nodes.
+func benchmarkScript(controls []control) string {
+	var script strings.Builder
+	script.WriteString("function Get-PolicyValue($path, $name) { " +
+		"$item = Get-ItemProperty -Path $path -Name $name -ErrorAction SilentlyContinue; " +
+		"if ($item -eq $null) { '" + notConfigured + "' } else { $item.$name } }\n")
+	for _, c := range controls {
+		fmt.Fprintf(&script, "try { '%s=' + $(%s) } catch { '%s=%s' + $_.Exception.Message + '>' }\n", c.id,
+			c.query, c.id, controlError)
+	}
+	return script.String()
+}
+
+// CheckBenchmark checks the controls of the CIS benchmark on the node with the given runner, adding their results to
+// the given report. The controls are informational: they do not fail the report, as the nodes of a cluster do not
+// have to meet the benchmark.
+func CheckBenchmark(runner Runner, report *Report) {
+	report.Benchmark = Benchmark
+	stdout, stderr, err := runner.Run(types.EncodedPowerShell(benchmarkScript(controls)), false)
+	reason := ""
+	if err != nil {
+		stdout, reason = "", fmt.Sprintf("could not query the node: %v, %s", err, strings.TrimSpace(stderr))
+	}
+	report.Controls = evaluateControls(controls, stdout, reason)
+}
+
+// evaluateControls returns the results of the given controls from the <id>=<value> lines of the output of their
+// script, the controls missing from it failing with the given reason
+func evaluateControls(controls []control, out, reason string) []ControlResult {
+	values := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	if reason == "" {
+		reason = "not reported by the node"
+	}
+	var results []ControlResult
+	for _, c := range controls {
+		result := ControlResult{ID: c.id, Title: c.title, Expected: c.expected, Status: StatusFail}
+		actual, ok := values[c.id]
+		switch {
+		case !ok:
+			result.Actual = "<" + reason + ">"
+		case strings.EqualFold(actual, c.expected):
+			result.Status, result.Actual = StatusPass, actual
+		default:
+			result.Actual = actual
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ControlsPassed returns the number of controls of the CIS benchmark the node meets
+func (r *Report) ControlsPassed() int {
+	passed := 0
+	for _, result := range r.Controls {
+		if result.Status == StatusPass {
+			passed++
+		}
+	}
+	return passed
+}
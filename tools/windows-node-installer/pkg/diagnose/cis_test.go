@@ -0,0 +1,78 @@
+package diagnose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckBenchmark tests that each control passes if its setting has the required value, and fails otherwise or if
+// it is not reported
+func TestCheckBenchmark(t *testing.T) {
+	var lines []string
+	for _, c := range controls {
+		lines = append(lines, c.id+"="+c.expected)
+	}
+	script := benchmarkScript(controls)
+	runner := &fakeRunner{outputs: map[string]string{script: strings.Join(lines, "\r\n") + "\r\n"}}
+	report := &Report{}
+	CheckBenchmark(runner, report)
+	assert.Equal(t, Benchmark, report.Benchmark)
+	require.Len(t, report.Controls, len(controls))
+	assert.Equal(t, len(controls), report.ControlsPassed())
+	assert.False(t, report.Failed(), "the controls fail the report")
+
+	// The values are compared case-insensitively, as PowerShell prints the booleans capitalized
+	lines[0] = "2.3.1.2=false"
+	lines[1] = "2.3.1.3=" + notConfigured
+	lines[6] = "9.1.1=" + controlError + "Get-NetFirewallProfile is not recognized>"
+	runner.outputs[script] = strings.Join(lines[:len(lines)-1], "\r\n")
+	CheckBenchmark(runner, report)
+	require.Len(t, report.Controls, len(controls))
+	assert.Equal(t, StatusPass, report.Controls[0].Status)
+	assert.Equal(t, ControlResult{ID: "2.3.1.3", Title: controls[1].title, Status: StatusFail, Actual: notConfigured,
+		Expected: "1"}, report.Controls[1])
+	assert.Equal(t, StatusFail, report.Controls[6].Status)
+	assert.Contains(t, report.Controls[6].Actual, "is not recognized")
+	last := report.Controls[len(controls)-1]
+	assert.Equal(t, StatusFail, last.Status)
+	assert.Equal(t, "<not reported by the node>", last.Actual)
+	assert.Equal(t, len(controls)-3, report.ControlsPassed())
+
+	CheckBenchmark(&fakeRunner{}, report)
+	assert.Equal(t, 0, report.ControlsPassed())
+	assert.Contains(t, report.Controls[0].Actual, "could not query the node")
+}
+
+// TestBenchmarkScript tests that the script reports every control on a line of its own
+func TestBenchmarkScript(t *testing.T) {
+	script := benchmarkScript(controls)
+	assert.Len(t, strings.Split(strings.TrimSpace(script), "\n"), len(controls)+1)
+	for _, c := range controls {
+		assert.Contains(t, script, "'"+c.id+"=' + $("+c.query+")")
+	}
+}
+
+// TestWriteBenchmarkSummary tests that the controls are summarized after the checks
+func TestWriteBenchmarkSummary(t *testing.T) {
+	report := &Report{
+		Checks:    []CheckResult{{Name: "kubelet", Status: StatusPass, Message: "kubelet service is running"}},
+		Benchmark: Benchmark,
+		Controls: []ControlResult{
+			{ID: "9.1.1", Title: "Firewall state", Status: StatusPass, Actual: "True", Expected: "True"},
+			{ID: "18.3.3", Title: "SMB v1 server", Status: StatusFail, Actual: "True", Expected: "False"},
+		},
+	}
+	var out bytes.Buffer
+	require.NoError(t, report.WriteSummary(&out))
+	assert.Equal(t, "CHECK    STATUS  MESSAGE\n"+
+		"kubelet  pass    kubelet service is running\n"+
+		"\n"+
+		"CONTROL  STATUS  ACTUAL  EXPECTED  TITLE\n"+
+		"9.1.1    pass    True    True      Firewall state\n"+
+		"18.3.3   fail    True    False     SMB v1 server\n"+
+		"1 of 2 controls of the "+Benchmark+" passed\n", out.String())
+}
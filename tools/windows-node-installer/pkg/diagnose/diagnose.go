@@ -0,0 +1,441 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+/*
+	diagnose runs the preflight checks of WMCB and collects the diagnostics bundle of the e2e tests on an existing
+	Windows node, like a production node reported broken, and writes them as a report. Only queries are run on the
+	node: nothing is installed, started, stopped or written on it, so support teams can run it against any node they
+	have the credentials of.
+*/
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// StatusPass means that the check found no issue
+	StatusPass Status = "pass"
+	// StatusWarn means that the check found an issue which does not prevent the node from working
+	StatusWarn Status = "warn"
+	// StatusFail means that the check found an issue which prevents the node from working
+	StatusFail Status = "fail"
+)
+
+const (
+	// PasswordEnvVar is the environment variable holding the password of the node, so that it does not have to be
+	// given on the command line
+	PasswordEnvVar = "WNI_PASSWORD"
+	// minimumBuild is the build of Windows Server 2019, the oldest Windows version supported as a node
+	minimumBuild = 17763
+	// minimumMemory is the physical memory under which WMCB cannot disable the pagefile of the node
+	minimumMemory = 8 * 1024 * 1024 * 1024
+	// minimumFreeDisk is the free space of the system drive under which the kubelet soon evicts pods and fails to pull
+	// images
+	minimumFreeDisk = 10 * 1024 * 1024 * 1024
+	// windowsApplicationID is the application ID of the Windows products in the SoftwareLicensingProduct WMI class
+	windowsApplicationID = "55c92734-d682-4d71-983e-d6ec3f16059f"
+	// kubeletLog is the log file of the kubelet on the node
+	kubeletLog = "C:\\k\\log\\kubelet.log"
+	// kubeletLogLines is the number of lines of the end of the kubelet log collected
+	kubeletLogLines = 500
+	// pendingRebootScript prints the reasons for which the node waits for a reboot, a line each, from the registry
+	// flags WMCB checks before initializing the kubelet
+	pendingRebootScript = "if (Test-Path 'HKLM:\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Component Based " +
+		"Servicing\\RebootPending') { 'ComponentBasedServicing' }\n" +
+		"if (Test-Path 'HKLM:\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\WindowsUpdate\\Auto Update\\" +
+		"RebootRequired') { 'WindowsUpdate' }\n" +
+		"if ((Get-ItemProperty -Path 'HKLM:\\SYSTEM\\CurrentControlSet\\Control\\Session Manager' -Name " +
+		"PendingFileRenameOperations -ErrorAction SilentlyContinue).PendingFileRenameOperations | " +
+		"Where-Object { $_ }) { 'FileRenameOperations' }\n" +
+		"$active = (Get-ItemProperty -Path 'HKLM:\\SYSTEM\\CurrentControlSet\\Control\\ComputerName\\" +
+		"ActiveComputerName').ComputerName\n" +
+		"$next = (Get-ItemProperty -Path 'HKLM:\\SYSTEM\\CurrentControlSet\\Control\\ComputerName\\" +
+		"ComputerName').ComputerName\n" +
+		"if ($next -and $active -ne $next) { 'ComputerRename' }"
+)
+
+// Runner runs the given command on the node and returns its stdout and stderr. If the bool is set, the command is run
+// in PowerShell. The types.WindowsVM of the node implements it.
+type Runner interface {
+	Run(string, bool) (string, string, error)
+}
+
+// CheckResult is the outcome of a preflight check of the node
+type CheckResult struct {
+	// Name is the name of the check
+	Name string `json:"name"`
+	// Status is the outcome of the check
+	Status Status `json:"status"`
+	// Message describes what the check found
+	Message string `json:"message"`
+}
+
+// Diagnostic is the output of a command of the diagnostics bundle
+type Diagnostic struct {
+	// Name is the name of the diagnostic
+	Name string `json:"name"`
+	// Script is the PowerShell script run on the node
+	Script string `json:"script"`
+	// Output is the output of the script
+	Output string `json:"output"`
+	// Error is the error of the script, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// Report holds the results of the checks and the diagnostics of a node, or of an instance booted from an image
+type Report struct {
+	// Node is the name of the node, or its address if it is not known to the cluster
+	Node string `json:"node,omitempty"`
+	// Image is the ID of the candidate image the instance was booted from
+	Image string `json:"image,omitempty"`
+	// Region is the region the instance booted from the candidate image ran in
+	Region string `json:"region,omitempty"`
+	// Address is the address the node was reached at
+	Address string `json:"address"`
+	// Collected is when the report was collected
+	Collected time.Time `json:"collected"`
+	// Checks are the results of the preflight checks
+	Checks []CheckResult `json:"checks"`
+	// Diagnostics are the outputs of the commands of the diagnostics bundle
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Timings are how long the phases of the setup of the instance booted from the candidate image took
+	Timings []Timing `json:"timings,omitempty"`
+	// Benchmark is the CIS benchmark the controls were checked against, empty if they were not checked
+	Benchmark string `json:"benchmark,omitempty"`
+	// Controls are the results of the controls of the CIS benchmark
+	Controls []ControlResult `json:"controls,omitempty"`
+}
+
+// check is a preflight check, which evaluates the output of a read-only PowerShell script run on the node
+type check struct {
+	// name is the name of the check
+	name string
+	// script is the PowerShell script querying the node
+	script string
+	// evaluate returns the outcome of the check from the output of the script
+	evaluate func(out string) (Status, string)
+}
+
+// diagnostic is a read-only PowerShell script of the diagnostics bundle
+type diagnostic struct {
+	// name is the name of the diagnostic
+	name string
+	// script is the PowerShell script querying the node
+	script string
+}
+
+var (
+	// checks are the preflight checks run on the node, which WMCB runs before initializing the kubelet
+	checks = []check{
+		{"windows-build", "[System.Environment]::OSVersion.Version.Build", evaluateBuild},
+		{"memory", "(Get-CimInstance Win32_ComputerSystem).TotalPhysicalMemory", evaluateMemory},
+		{"disk-space", "(Get-PSDrive -Name C).Free", evaluateDiskSpace},
+		{"container-runtime", "Get-Service -Name docker,containerd -ErrorAction SilentlyContinue | " +
+			"ForEach-Object { $_.Name + '=' + $_.Status }", evaluateContainerRuntime},
+		{"kubelet", "(Get-Service -Name kubelet -ErrorAction SilentlyContinue).Status", evaluateKubelet},
+		{"activation", "ConvertTo-Json -InputObject @(Get-CimInstance SoftwareLicensingProduct -Filter " +
+			"\"ApplicationID='" + windowsApplicationID + "' AND PartialProductKey IS NOT NULL\" | " +
+			"Select-Object Name, Description, LicenseStatus, GracePeriodRemaining)", evaluateActivation},
+		{"pending-reboot", pendingRebootScript, evaluatePendingReboot},
+	}
+	// diagnostics is the diagnostics bundle, the artifacts the e2e tests collect from the nodes
+	diagnostics = []diagnostic{
+		{"hotfixes", "Get-HotFix | Sort-Object InstalledOn | Format-Table -AutoSize HotFixID, Description, " +
+			"InstalledOn | Out-String -Width 200"},
+		{"network-adapters", "Get-NetIPConfiguration -Detailed | Out-String -Width 200"},
+		{"hns-networks", "Get-HnsNetwork | Format-List Name, Type, Subnets, ManagementIP | Out-String -Width 200"},
+		{"services", "Get-Service -Name kubelet,docker,containerd,sshd,WinRM -ErrorAction SilentlyContinue | " +
+			"Format-Table -AutoSize Name, Status, StartType | Out-String -Width 200"},
+		{"container-runtime-events", "Get-WinEvent -MaxEvents 100 -ErrorAction SilentlyContinue -FilterHashtable " +
+			"@{LogName='Application'; ProviderName='docker','containerd'} | Format-List TimeCreated, " +
+			"LevelDisplayName, Message | Out-String -Width 200"},
+		{"kubelet-log", fmt.Sprintf("Get-Content -Tail %d -ErrorAction SilentlyContinue -Path '%s'",
+			kubeletLogLines, kubeletLog)},
+	}
+)
+
+// NodeAddress returns the name of the given node, given by name or address, and the address to reach it at. The
+// external IP of a node given by name is preferred to its internal IP. The cluster is only queried for the name of a
+// node given by address if a client is given, and the address is used as its name if it is not found.
+func NodeAddress(client kubernetes.Interface, node string) (string, string, error) {
+	if net.ParseIP(node) != nil {
+		if client == nil {
+			return node, node, nil
+		}
+		nodes, err := client.CoreV1().Nodes().List(metav1.ListOptions{})
+		if err != nil {
+			return "", "", fmt.Errorf("error listing the nodes: %v", err)
+		}
+		for _, n := range nodes.Items {
+			for _, address := range n.Status.Addresses {
+				if address.Address == node {
+					return n.GetName(), node, nil
+				}
+			}
+		}
+		return node, node, nil
+	}
+	if client == nil {
+		return "", "", fmt.Errorf("a kubeconfig is required to look up the address of node %s", node)
+	}
+	n, err := client.CoreV1().Nodes().Get(node, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("error getting node %s: %v", node, err)
+	}
+	for _, addressType := range []v1.NodeAddressType{v1.NodeExternalIP, v1.NodeInternalIP} {
+		for _, address := range n.Status.Addresses {
+			if address.Type == addressType && address.Address != "" {
+				return node, address.Address, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("node %s has no IP address", node)
+}
+
+// Run runs the preflight checks and collects the diagnostics bundle on the node of the given name and address with the
+// given runner. The checks and diagnostics whose script fails are reported as such, so that a report is always
+// returned.
+func Run(runner Runner, node, address string) *Report {
+	report := &Report{Node: node, Address: address, Collected: time.Now().UTC()}
+	run(runner, checks, diagnostics, report)
+	return report
+}
+
+// run runs the given checks and collects the given diagnostics with the given runner, adding them to the given report
+func run(runner Runner, checks []check, diagnostics []diagnostic, report *Report) {
+	for _, c := range checks {
+		stdout, stderr, err := runner.Run(types.EncodedPowerShell(c.script), false)
+		result := CheckResult{Name: c.name}
+		if err != nil {
+			result.Status, result.Message = StatusFail, fmt.Sprintf("could not query the node: %v, %s", err,
+				strings.TrimSpace(stderr))
+		} else {
+			result.Status, result.Message = c.evaluate(strings.TrimSpace(stdout))
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	for _, d := range diagnostics {
+		stdout, stderr, err := runner.Run(types.EncodedPowerShell(d.script), false)
+		diag := Diagnostic{Name: d.name, Script: d.script, Output: stdout}
+		if err != nil {
+			diag.Error = fmt.Sprintf("%v, %s", err, strings.TrimSpace(stderr))
+		}
+		report.Diagnostics = append(report.Diagnostics, diag)
+	}
+}
+
+// Failed returns true if any check failed
+func (r *Report) Failed() bool {
+	for _, result := range r.Checks {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report as an indented JSON document to the given writer
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteSummary writes the results of the checks as a table, followed by the diagnostics which could not be collected
+func (r *Report) WriteSummary(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "CHECK\tSTATUS\tMESSAGE\n")
+	for _, result := range r.Checks {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", result.Name, result.Status, result.Message)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if len(r.Controls) > 0 {
+		fmt.Fprintf(table, "\nCONTROL\tSTATUS\tACTUAL\tEXPECTED\tTITLE\n")
+		for _, result := range r.Controls {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", result.ID, result.Status, result.Actual, result.Expected,
+				result.Title)
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%d of %d controls of the %s passed\n", r.ControlsPassed(), len(r.Controls),
+			r.Benchmark); err != nil {
+			return err
+		}
+	}
+	for _, diag := range r.Diagnostics {
+		if diag.Error == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "could not collect %s: %s\n", diag.Name, diag.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateBuild fails if the Windows build of the node is older than Windows Server 2019
+func evaluateBuild(out string) (Status, string) {
+	build, err := strconv.Atoi(out)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("unexpected Windows build %q", out)
+	}
+	if build < minimumBuild {
+		return StatusFail, fmt.Sprintf("Windows build %d is older than Windows Server 2019, build %d", build,
+			minimumBuild)
+	}
+	return StatusPass, fmt.Sprintf("Windows build %d", build)
+}
+
+// evaluateMemory warns if the node has too little memory for its pagefile to be disabled
+func evaluateMemory(out string) (Status, string) {
+	memory, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("unexpected physical memory %q", out)
+	}
+	if memory < minimumMemory {
+		return StatusWarn, fmt.Sprintf("%s of memory, the pagefile cannot be disabled under %s", formatBytes(memory),
+			formatBytes(minimumMemory))
+	}
+	return StatusPass, fmt.Sprintf("%s of memory", formatBytes(memory))
+}
+
+// evaluateDiskSpace warns if the system drive of the node is almost full
+func evaluateDiskSpace(out string) (Status, string) {
+	free, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		return StatusFail, fmt.Sprintf("unexpected free space %q", out)
+	}
+	if free < minimumFreeDisk {
+		return StatusWarn, fmt.Sprintf("%s free on C:, the kubelet evicts pods and fails to pull images when it is "+
+			"full", formatBytes(free))
+	}
+	return StatusPass, fmt.Sprintf("%s free on C:", formatBytes(free))
+}
+
+// evaluateContainerRuntime fails if neither Docker nor containerd is installed and running, given the name=status
+// lines of their services
+func evaluateContainerRuntime(out string) (Status, string) {
+	if out == "" {
+		return StatusFail, "neither the docker nor the containerd service is installed"
+	}
+	var stopped []string
+	for _, line := range strings.Split(out, "\n") {
+		service := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(service) != 2 {
+			return StatusFail, fmt.Sprintf("unexpected service status %q", line)
+		}
+		if service[1] == "Running" {
+			return StatusPass, fmt.Sprintf("%s service is running", service[0])
+		}
+		stopped = append(stopped, fmt.Sprintf("%s service is %s", service[0], service[1]))
+	}
+	return StatusFail, strings.Join(stopped, ", ")
+}
+
+// evaluateKubelet fails if the kubelet service is installed but not running, and warns if the node is not
+// bootstrapped
+func evaluateKubelet(out string) (Status, string) {
+	switch out {
+	case "":
+		return StatusWarn, "kubelet service is not installed, the node is not bootstrapped"
+	case "Running":
+		return StatusPass, "kubelet service is running"
+	default:
+		return StatusFail, fmt.Sprintf("kubelet service is %s", out)
+	}
+}
+
+// activationProduct is the SoftwareLicensingProduct WMI object as converted to JSON by PowerShell
+type activationProduct struct {
+	Name                 string
+	Description          string
+	LicenseStatus        int
+	GracePeriodRemaining int64
+}
+
+const (
+	// licensed is the license status of an activated Windows
+	licensed = 1
+	// unlicensed is the license status of a Windows that is neither activated nor in a grace period
+	unlicensed = 0
+	// notification is the license status of a Windows whose grace period ended, which shuts down periodically
+	notification = 5
+)
+
+// evaluateActivation fails if the node shuts down periodically because its evaluation or grace period ended, as WMCB
+// does, and warns if Windows is not activated yet
+func evaluateActivation(out string) (Status, string) {
+	var products []activationProduct
+	if err := json.Unmarshal([]byte(out), &products); err != nil {
+		return StatusFail, fmt.Sprintf("unexpected activation status %q", out)
+	}
+	if len(products) == 0 {
+		return StatusFail, "no Windows product key installed"
+	}
+	p := products[0]
+	evaluation := strings.Contains(p.Description, "TIMEBASED_EVAL") || strings.Contains(p.Name, "Eval")
+	remaining := time.Duration(p.GracePeriodRemaining) * time.Minute
+	switch {
+	case evaluation && remaining == 0 && p.LicenseStatus != licensed:
+		return StatusFail, fmt.Sprintf("the evaluation period of %s expired, the node shuts down every hour", p.Name)
+	case p.LicenseStatus == notification || p.LicenseStatus == unlicensed:
+		return StatusFail, fmt.Sprintf("%s is not activated and its grace period ended, the node shuts down every "+
+			"hour", p.Name)
+	case p.LicenseStatus == licensed && !evaluation:
+		return StatusPass, fmt.Sprintf("%s is activated", p.Name)
+	default:
+		return StatusWarn, fmt.Sprintf("%s is not activated, %s left", p.Name, remaining)
+	}
+}
+
+// pendingRebootReasons describes the reasons for which a node waits for a reboot, by the name the script prints
+var pendingRebootReasons = map[string]string{
+	"ComponentBasedServicing": "the installation of a Windows feature or update is not complete",
+	"WindowsUpdate":           "Windows Update installed updates",
+	"FileRenameOperations":    "files are replaced on the next boot",
+	"ComputerRename":          "the computer was renamed",
+}
+
+// evaluatePendingReboot fails if the node waits for a reboot to complete the installation of a Windows feature or a
+// computer rename, as WMCB does, and warns for the other pending reboots
+func evaluatePendingReboot(out string) (Status, string) {
+	if out == "" {
+		return StatusPass, "no reboot pending"
+	}
+	status := StatusWarn
+	var reasons []string
+	for _, line := range strings.Split(out, "\n") {
+		reason := strings.TrimSpace(line)
+		description, ok := pendingRebootReasons[reason]
+		if !ok {
+			return StatusFail, fmt.Sprintf("unexpected pending reboot reason %q", reason)
+		}
+		if reason == "ComponentBasedServicing" || reason == "ComputerRename" {
+			status = StatusFail
+		}
+		reasons = append(reasons, description)
+	}
+	return status, "the node is pending a reboot: " + strings.Join(reasons, ", ")
+}
+
+// formatBytes returns the given size in GiB
+func formatBytes(size uint64) string {
+	return fmt.Sprintf("%.1f GiB", float64(size)/(1024*1024*1024))
+}
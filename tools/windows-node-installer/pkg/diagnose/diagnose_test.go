@@ -0,0 +1,212 @@
+package diagnose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeRunner returns the output of the scripts it is given, failing the other ones, and records the commands run
+type fakeRunner struct {
+	// outputs holds the stdout of the scripts by script
+	outputs map[string]string
+	// commands are the commands run
+	commands []string
+}
+
+// Run returns the output of the script of the given encoded command
+func (f *fakeRunner) Run(cmd string, psCmd bool) (string, string, error) {
+	f.commands = append(f.commands, cmd)
+	for script, out := range f.outputs {
+		if types.EncodedPowerShell(script) == cmd && !psCmd {
+			return out, "", nil
+		}
+	}
+	return "", "access denied", fmt.Errorf("%s returned 1 exit code", cmd)
+}
+
+// healthyOutputs returns the outputs of the checks on a healthy node
+func healthyOutputs() map[string]string {
+	return map[string]string{
+		checks[0].script: "17763\r\n",
+		checks[1].script: "17179398144",
+		checks[2].script: "64424509440",
+		checks[3].script: "containerd=Running\r\n",
+		checks[4].script: "Running",
+		checks[5].script: `[{"Name":"Windows(R), ServerDatacenter edition","Description":"Windows(R) Operating ` +
+			`System, VOLUME_KMSCLIENT channel","LicenseStatus":1,"GracePeriodRemaining":0}]`,
+		checks[6].script: "",
+	}
+}
+
+// TestRun tests that the checks and diagnostics are all run and reported, the failed ones included
+func TestRun(t *testing.T) {
+	outputs := healthyOutputs()
+	outputs[diagnostics[0].script] = "KB4580390 Security Update"
+	runner := &fakeRunner{outputs: outputs}
+	report := Run(runner, "ip-10-0-1-5.ec2.internal", "10.0.1.5")
+
+	assert.Len(t, runner.commands, len(checks)+len(diagnostics))
+	require.Len(t, report.Checks, len(checks))
+	for _, result := range report.Checks {
+		assert.Equal(t, StatusPass, result.Status, "check %s did not pass: %s", result.Name, result.Message)
+	}
+	assert.False(t, report.Failed())
+	require.Len(t, report.Diagnostics, len(diagnostics))
+	assert.Equal(t, "KB4580390 Security Update", report.Diagnostics[0].Output)
+	assert.Empty(t, report.Diagnostics[0].Error)
+	assert.Contains(t, report.Diagnostics[1].Error, "access denied")
+
+	delete(outputs, checks[4].script)
+	report = Run(runner, "ip-10-0-1-5.ec2.internal", "10.0.1.5")
+	assert.Equal(t, StatusFail, report.Checks[4].Status)
+	assert.Contains(t, report.Checks[4].Message, "could not query the node")
+	assert.True(t, report.Failed())
+}
+
+// TestValidateImage tests that the checks of a candidate image skip the checks of the bootstrap of a node, like the
+// kubelet service
+func TestValidateImage(t *testing.T) {
+	outputs := healthyOutputs()
+	outputs[imageChecks[1].script] = "Installed"
+	outputs[imageChecks[2].script] = "WinRM=Running\r\nsshd=Running\r\nhns=Running\r\nvmcompute=Running\r\n"
+	outputs[imageChecks[3].script] = "OpenSSH.Server~~~~0.0.1.0=Installed\r\n"
+	runner := &fakeRunner{outputs: outputs}
+	report := ValidateImage(runner, "ami-06a4e829b8bbad61e", "10.0.1.5")
+
+	assert.Equal(t, "ami-06a4e829b8bbad61e", report.Image)
+	assert.Empty(t, report.Node)
+	assert.Len(t, runner.commands, len(imageChecks)+len(imageDiagnostics))
+	require.Len(t, report.Checks, len(imageChecks))
+	for _, result := range report.Checks {
+		assert.NotEqual(t, "kubelet", result.Name)
+		assert.Equal(t, StatusPass, result.Status, "check %s did not pass: %s", result.Name, result.Message)
+	}
+	assert.False(t, report.Failed())
+
+	outputs[imageChecks[1].script] = "Available"
+	report = ValidateImage(runner, "ami-06a4e829b8bbad61e", "10.0.1.5")
+	assert.Equal(t, StatusFail, report.Checks[1].Status)
+	assert.True(t, report.Failed())
+}
+
+// TestEvaluate tests the outcomes of the checks for the outputs of the node
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		evaluate func(string) (Status, string)
+		out      string
+		expected Status
+	}{
+		{"Windows Server 2019", evaluateBuild, "17763", StatusPass},
+		{"Windows Server 2016", evaluateBuild, "14393", StatusFail},
+		{"unexpected build", evaluateBuild, "", StatusFail},
+		{"16 GiB of memory", evaluateMemory, "17179398144", StatusPass},
+		{"4 GiB of memory", evaluateMemory, "4294967296", StatusWarn},
+		{"60 GiB free", evaluateDiskSpace, "64424509440", StatusPass},
+		{"2 GiB free", evaluateDiskSpace, "2147483648", StatusWarn},
+		{"Docker running", evaluateContainerRuntime, "docker=Running", StatusPass},
+		{"containerd running next to stopped Docker", evaluateContainerRuntime,
+			"docker=Stopped\r\ncontainerd=Running", StatusPass},
+		{"runtime stopped", evaluateContainerRuntime, "containerd=Stopped", StatusFail},
+		{"no runtime", evaluateContainerRuntime, "", StatusFail},
+		{"kubelet running", evaluateKubelet, "Running", StatusPass},
+		{"kubelet stopped", evaluateKubelet, "Stopped", StatusFail},
+		{"node not bootstrapped", evaluateKubelet, "", StatusWarn},
+		{"evaluation expired", evaluateActivation, `[{"Name":"Windows(R), ServerDatacenterEval edition",` +
+			`"Description":"TIMEBASED_EVAL channel","LicenseStatus":5,"GracePeriodRemaining":0}]`, StatusFail},
+		{"grace period", evaluateActivation, `[{"Name":"Windows(R), ServerDatacenter edition",` +
+			`"Description":"VOLUME_KMSCLIENT channel","LicenseStatus":2,"GracePeriodRemaining":43200}]`, StatusWarn},
+		{"no product key", evaluateActivation, `[]`, StatusFail},
+		{"no reboot pending", evaluatePendingReboot, "", StatusPass},
+		{"updates pending reboot", evaluatePendingReboot, "WindowsUpdate\r\nFileRenameOperations", StatusWarn},
+		{"feature pending reboot", evaluatePendingReboot, "ComponentBasedServicing\r\nWindowsUpdate", StatusFail},
+		{"computer renamed", evaluatePendingReboot, "ComputerRename", StatusFail},
+		{"unexpected reason", evaluatePendingReboot, "Unknown", StatusFail},
+		{"Containers installed", evaluateContainersFeature, "Installed", StatusPass},
+		{"Containers pending reboot", evaluateContainersFeature, "InstallPending", StatusFail},
+		{"Containers unavailable", evaluateContainersFeature, "", StatusFail},
+		{"services running", evaluateRequiredServices,
+			"WinRM=Running\r\nsshd=Running\r\nhns=Running\r\nvmcompute=Running", StatusPass},
+		{"sshd stopped", evaluateRequiredServices,
+			"WinRM=Running\r\nsshd=Stopped\r\nhns=Running\r\nvmcompute=Running", StatusFail},
+		{"no container services", evaluateRequiredServices, "WinRM=Running\r\nsshd=Running", StatusFail},
+		{"OpenSSH installed", evaluateOpenSSH, "OpenSSH.Server~~~~0.0.1.0=Installed", StatusPass},
+		{"OpenSSH not present", evaluateOpenSSH, "OpenSSH.Server~~~~0.0.1.0=NotPresent", StatusFail},
+		{"OpenSSH unavailable", evaluateOpenSSH, "", StatusFail},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, message := test.evaluate(test.out)
+			assert.Equal(t, test.expected, status, message)
+			assert.NotEmpty(t, message)
+		})
+	}
+}
+
+// TestNodeAddress tests that nodes given by name are reached at their external IP, and that the names of nodes given
+// by address are looked up
+func TestNodeAddress(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-1-5.ec2.internal"},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "10.0.1.5"},
+			{Type: v1.NodeExternalIP, Address: "3.91.10.20"},
+		}},
+	}
+	client := fake.NewSimpleClientset(node)
+
+	name, address, err := NodeAddress(client, "ip-10-0-1-5.ec2.internal")
+	require.NoError(t, err)
+	assert.Equal(t, "ip-10-0-1-5.ec2.internal", name)
+	assert.Equal(t, "3.91.10.20", address)
+
+	name, address, err = NodeAddress(client, "10.0.1.5")
+	require.NoError(t, err)
+	assert.Equal(t, "ip-10-0-1-5.ec2.internal", name)
+	assert.Equal(t, "10.0.1.5", address)
+
+	name, address, err = NodeAddress(nil, "10.0.9.9")
+	require.NoError(t, err, "nodes given by address do not need the cluster")
+	assert.Equal(t, "10.0.9.9", name)
+	assert.Equal(t, "10.0.9.9", address)
+
+	_, _, err = NodeAddress(client, "missing")
+	assert.Error(t, err)
+	_, _, err = NodeAddress(nil, "ip-10-0-1-5.ec2.internal")
+	assert.Error(t, err, "nodes given by name cannot be looked up without a cluster")
+}
+
+// TestWriteReport tests that the report is written as JSON and summarized as a table
+func TestWriteReport(t *testing.T) {
+	report := &Report{
+		Node:    "ip-10-0-1-5.ec2.internal",
+		Address: "10.0.1.5",
+		Checks: []CheckResult{
+			{Name: "kubelet", Status: StatusFail, Message: "kubelet service is Stopped"},
+		},
+		Diagnostics: []Diagnostic{
+			{Name: "hotfixes", Output: "KB4580390"},
+			{Name: "hns-networks", Error: "Get-HnsNetwork is not recognized"},
+		},
+	}
+	var out bytes.Buffer
+	require.NoError(t, report.WriteJSON(&out))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, report.Checks, decoded.Checks)
+
+	out.Reset()
+	require.NoError(t, report.WriteSummary(&out))
+	assert.Equal(t, "CHECK    STATUS  MESSAGE\n"+
+		"kubelet  fail    kubelet service is Stopped\n"+
+		"could not collect hns-networks: Get-HnsNetwork is not recognized\n", out.String())
+}
@@ -0,0 +1,108 @@
+package diagnose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// requiredServices are the Windows services a node needs from its image: WinRM and the OpenSSH server to be
+// configured remotely, the Host Network Service and the Host Compute Service to run containers
+var requiredServices = []string{"WinRM", "sshd", "hns", "vmcompute"}
+
+var (
+	// imageChecks are the checks of a candidate image, run on an instance booted from it, which tell whether the
+	// image can be used for the Windows nodes. The checks of a node that depend on its bootstrap, like the kubelet
+	// service, are not run.
+	imageChecks = []check{
+		checks[0],
+		{"containers-feature", "(Get-WindowsFeature -Name Containers).InstallState", evaluateContainersFeature},
+		{"required-services", "Get-Service -Name " + strings.Join(requiredServices, ",") +
+			" -ErrorAction SilentlyContinue | ForEach-Object { $_.Name + '=' + $_.Status }", evaluateRequiredServices},
+		{"openssh", "Get-WindowsCapability -Online -Name OpenSSH.Server* | ForEach-Object { $_.Name + '=' + " +
+			"$_.State }", evaluateOpenSSH},
+		checks[3],
+		checks[2],
+		checks[5],
+		checks[6],
+	}
+	// imageDiagnostics are the diagnostics collected from the instance booted from a candidate image, describing the
+	// image to compare it with the previous ones
+	imageDiagnostics = []diagnostic{
+		{"os-version", "Get-ItemProperty -Path 'HKLM:\\SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion' | " +
+			"Format-List ProductName, ReleaseId, CurrentBuild, UBR | Out-String -Width 200"},
+		diagnostics[0],
+		{"windows-features", "Get-WindowsFeature | Where-Object Installed | Format-Table -AutoSize Name, " +
+			"InstallState | Out-String -Width 200"},
+		{"services", "Get-Service -Name " + strings.Join(requiredServices, ",") + ",docker,containerd " +
+			"-ErrorAction SilentlyContinue | Format-Table -AutoSize Name, Status, StartType | Out-String -Width 200"},
+	}
+)
+
+// ValidateImage runs the checks of a candidate image on the instance of the given address booted from the image of
+// the given ID, with the given runner, and collects the diagnostics describing the image. Nothing is changed on the
+// instance. The image is suitable for the Windows nodes if no check failed.
+func ValidateImage(runner Runner, imageID, address string) *Report {
+	report := &Report{Image: imageID, Address: address, Collected: time.Now().UTC()}
+	run(runner, imageChecks, imageDiagnostics, report)
+	return report
+}
+
+// evaluateContainersFeature fails if the Containers Windows feature is not installed, which requires a reboot
+func evaluateContainersFeature(out string) (Status, string) {
+	switch out {
+	case "Installed":
+		return StatusPass, "Containers feature is installed"
+	case "":
+		return StatusFail, "Containers feature is not available on this Windows edition"
+	default:
+		return StatusFail, fmt.Sprintf("Containers feature is %s, installing it requires a reboot of every node",
+			out)
+	}
+}
+
+// evaluateRequiredServices fails if one of the required services is missing or not running, given the name=status
+// lines of the services
+func evaluateRequiredServices(out string) (Status, string) {
+	statuses := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		service := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(service) != 2 {
+			return StatusFail, fmt.Sprintf("unexpected service status %q", line)
+		}
+		statuses[strings.ToLower(service[0])] = service[1]
+	}
+	var issues []string
+	for _, name := range requiredServices {
+		status, ok := statuses[strings.ToLower(name)]
+		switch {
+		case !ok:
+			issues = append(issues, name+" service is not installed")
+		case status != "Running":
+			issues = append(issues, fmt.Sprintf("%s service is %s", name, status))
+		}
+	}
+	if len(issues) > 0 {
+		return StatusFail, strings.Join(issues, ", ")
+	}
+	return StatusPass, strings.Join(requiredServices, ", ") + " services are running"
+}
+
+// evaluateOpenSSH fails if the OpenSSH server capability is not installed, given its name=state line. The instances
+// install it when they boot, which fails on images that cannot reach the Features on Demand source.
+func evaluateOpenSSH(out string) (Status, string) {
+	capability := strings.SplitN(out, "=", 2)
+	if len(capability) != 2 {
+		if out == "" {
+			return StatusFail, "OpenSSH server capability is not available on this image"
+		}
+		return StatusFail, fmt.Sprintf("unexpected capability state %q", out)
+	}
+	if capability[1] != "Installed" {
+		return StatusFail, fmt.Sprintf("%s capability is %s", capability[0], capability[1])
+	}
+	return StatusPass, fmt.Sprintf("%s capability is installed", capability[0])
+}
@@ -0,0 +1,52 @@
+package diagnose
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// localAddress is the address reported for the node diagnosed locally
+const localAddress = "localhost"
+
+// LocalRunner runs the commands on the node it runs on, so that the node can be diagnosed by the wmcb-diag binary
+// without cluster access nor WinRM
+type LocalRunner struct{}
+
+// Run runs the given command in cmd, or in PowerShell if the bool is set, and returns its stdout and stderr
+func (LocalRunner) Run(command string, psCmd bool) (string, string, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := localCommand(command, psCmd)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("error while executing %s: %v", command, err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+// localCommand returns the command running the given command in cmd, or in PowerShell if the bool is set
+func localCommand(command string, psCmd bool) *exec.Cmd {
+	if psCmd {
+		return exec.Command("powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command",
+			command)
+	}
+	return exec.Command("cmd.exe", "/c", command)
+}
+
+// RunLocal runs the preflight checks and collects the diagnostics bundle on the node it runs on with the given runner,
+// a LocalRunner outside of the unit tests. The node is named after its hostname, as the cluster is not queried.
+func RunLocal(runner Runner) (*Report, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the hostname: %v", err)
+	}
+	node := strings.ToLower(hostname)
+	report := &Report{Node: node, Address: localAddress, Collected: time.Now().UTC()}
+	run(runner, checks, diagnostics, report)
+	return report, nil
+}
@@ -0,0 +1,34 @@
+package diagnose
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunLocal tests that the node diagnosed locally is named after its hostname and that the same checks and
+// diagnostics as the remote diagnosis are run
+func TestRunLocal(t *testing.T) {
+	runner := &fakeRunner{outputs: healthyOutputs()}
+	report, err := RunLocal(runner)
+	require.NoError(t, err)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToLower(hostname), report.Node)
+	assert.Equal(t, localAddress, report.Address)
+	assert.Len(t, runner.commands, len(checks)+len(diagnostics))
+	assert.Len(t, report.Checks, len(checks))
+	assert.Len(t, report.Diagnostics, len(diagnostics))
+	assert.False(t, report.Failed())
+}
+
+// TestLocalCommand tests that the commands are run in cmd, or in PowerShell when asked to
+func TestLocalCommand(t *testing.T) {
+	assert.Equal(t, []string{"cmd.exe", "/c", "hostname"}, localCommand("hostname", false).Args)
+	assert.Equal(t, []string{"powershell.exe", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command",
+		"Get-HotFix"}, localCommand("Get-HotFix", true).Args)
+}
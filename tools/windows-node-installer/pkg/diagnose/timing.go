@@ -0,0 +1,140 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
+)
+
+const (
+	// BootToWinRM is the timing from the creation of the instance until it is reachable over WinRM, which is mostly
+	// how long the image takes to boot for the first time
+	BootToWinRM = "boot to WinRM"
+	// createPhase and winRMPhase are the phases of the creation of an instance the first boot is timed between
+	createPhase = "create instance"
+	winRMPhase  = "setup WinRM client"
+)
+
+// Timing is how long a phase of the setup of an instance booted from an image took
+type Timing struct {
+	// Phase is the name of the phase, e.g. configure OpenSSH server
+	Phase string `json:"phase"`
+	// Seconds is how long the phase took
+	Seconds float64 `json:"seconds"`
+}
+
+// SetupTimings returns the timings of the given completed phases of the creation of an instance, preceded by the
+// BootToWinRM timing if the instance was reached over WinRM
+func SetupTimings(phases []progress.PhaseTime) []Timing {
+	var timings []Timing
+	var created, reached *progress.PhaseTime
+	for i := range phases {
+		switch phases[i].Phase {
+		case createPhase:
+			created = &phases[i]
+		case winRMPhase:
+			reached = &phases[i]
+		}
+		timings = append(timings, Timing{Phase: phases[i].Phase, Seconds: phases[i].Duration().Seconds()})
+	}
+	if created != nil && reached != nil {
+		timings = append([]Timing{{Phase: BootToWinRM, Seconds: reached.Completed.Sub(created.Started).Seconds()}},
+			timings...)
+	}
+	return timings
+}
+
+// ReadReport reads a report written as JSON by WriteJSON
+func ReadReport(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// comparisonRow is the mean of the timings of the reports of an image in a region
+type comparisonRow struct {
+	image  string
+	region string
+	// runs is the number of reports of the image in the region
+	runs int
+	// seconds holds the sum of the timings of the reports by phase, and counts the reports having the phase
+	seconds map[string]float64
+	counts  map[string]int
+}
+
+// mean returns the mean of the timings of the given phase, false if no report has the phase
+func (c *comparisonRow) mean(phase string) (float64, bool) {
+	if c.counts[phase] == 0 {
+		return 0, false
+	}
+	return c.seconds[phase] / float64(c.counts[phase]), true
+}
+
+// WriteComparison writes the timings of the given reports of candidate images as a table, with a row per image and
+// region holding the mean of the timings of its reports, and a column per phase. The rows are sorted by their
+// BootToWinRM timing, fastest first, and the reports without timings are skipped.
+func WriteComparison(w io.Writer, reports []*Report) error {
+	var rows []*comparisonRow
+	byKey := make(map[string]*comparisonRow)
+	var phases []string
+	seen := map[string]bool{BootToWinRM: true}
+	for _, report := range reports {
+		if len(report.Timings) == 0 {
+			continue
+		}
+		key := report.Image + "/" + report.Region
+		row, ok := byKey[key]
+		if !ok {
+			row = &comparisonRow{image: report.Image, region: report.Region, seconds: make(map[string]float64),
+				counts: make(map[string]int)}
+			byKey[key] = row
+			rows = append(rows, row)
+		}
+		row.runs++
+		for _, timing := range report.Timings {
+			row.seconds[timing.Phase] += timing.Seconds
+			row.counts[timing.Phase]++
+			if !seen[timing.Phase] {
+				seen[timing.Phase] = true
+				phases = append(phases, timing.Phase)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no timings to compare")
+	}
+	phases = append([]string{BootToWinRM}, phases...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		first, okFirst := rows[i].mean(BootToWinRM)
+		second, okSecond := rows[j].mean(BootToWinRM)
+		if okFirst != okSecond {
+			return okFirst
+		}
+		return first < second
+	})
+
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "IMAGE\tREGION\tRUNS")
+	for _, phase := range phases {
+		fmt.Fprintf(table, "\t%s", phase)
+	}
+	fmt.Fprintln(table)
+	for _, row := range rows {
+		fmt.Fprintf(table, "%s\t%s\t%d", row.image, row.region, row.runs)
+		for _, phase := range phases {
+			if seconds, ok := row.mean(phase); ok {
+				fmt.Fprintf(table, "\t%.0fs", seconds)
+			} else {
+				fmt.Fprintf(table, "\t-")
+			}
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
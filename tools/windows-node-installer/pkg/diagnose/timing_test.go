@@ -0,0 +1,76 @@
+package diagnose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetupTimings tests that the first boot is timed from the creation of the instance until it is reached over WinRM
+func TestSetupTimings(t *testing.T) {
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	phases := []progress.PhaseTime{
+		{Phase: "create instance", Started: start, Completed: start.Add(10 * time.Second)},
+		{Phase: "get password", Started: start.Add(60 * time.Second), Completed: start.Add(240 * time.Second)},
+		{Phase: "setup WinRM client", Started: start.Add(240 * time.Second), Completed: start.Add(300 * time.Second)},
+		{Phase: "configure OpenSSH server", Started: start.Add(300 * time.Second),
+			Completed: start.Add(420 * time.Second)},
+	}
+	assert.Equal(t, []Timing{
+		{Phase: BootToWinRM, Seconds: 300},
+		{Phase: "create instance", Seconds: 10},
+		{Phase: "get password", Seconds: 180},
+		{Phase: "setup WinRM client", Seconds: 60},
+		{Phase: "configure OpenSSH server", Seconds: 120},
+	}, SetupTimings(phases))
+
+	// The instance was never reached
+	assert.Equal(t, []Timing{{Phase: "create instance", Seconds: 10}}, SetupTimings(phases[:1]))
+	assert.Empty(t, SetupTimings(nil))
+}
+
+// TestWriteComparison tests that the timings of the reports are averaged by image and region, fastest first
+func TestWriteComparison(t *testing.T) {
+	reports := []*Report{
+		{Image: "ami-slow", Region: "us-east-1", Timings: []Timing{{BootToWinRM, 400},
+			{"configure OpenSSH server", 100}}},
+		{Image: "ami-fast", Region: "us-east-1", Timings: []Timing{{BootToWinRM, 200},
+			{"configure OpenSSH server", 60}}},
+		{Image: "ami-fast", Region: "us-east-1", Timings: []Timing{{BootToWinRM, 300},
+			{"configure OpenSSH server", 80}, {"configure Windows Update", 500}}},
+		{Image: "ami-fast", Region: "eu-west-1", Timings: []Timing{{BootToWinRM, 350}}},
+		{Image: "ami-unreachable", Region: "us-east-1"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteComparison(&buf, reports))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"IMAGE", "REGION", "RUNS", "boot", "to", "WinRM", "configure", "OpenSSH", "server",
+		"configure", "Windows", "Update"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"ami-fast", "us-east-1", "2", "250s", "70s", "500s"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"ami-fast", "eu-west-1", "1", "350s", "-", "-"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"ami-slow", "us-east-1", "1", "400s", "100s", "-"}, strings.Fields(lines[3]))
+
+	assert.Error(t, WriteComparison(&buf, reports[4:]))
+}
+
+// TestReadReport tests that a written report is read back
+func TestReadReport(t *testing.T) {
+	report := &Report{Image: "ami-06a4e829b8bbad61e", Region: "us-east-1", Address: "10.0.1.5",
+		Collected: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC), Timings: []Timing{{BootToWinRM, 312.5}}}
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+
+	read, err := ReadReport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, report, read)
+
+	_, err = ReadReport(strings.NewReader("not a report"))
+	assert.Error(t, err)
+}
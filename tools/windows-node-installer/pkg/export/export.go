@@ -0,0 +1,142 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+/*
+	export describes the infrastructure created by wni, the instances, their security groups and key pairs and their
+	DNS records, as JSON or as Terraform configuration. Teams that later manage the environment with infrastructure as
+	code can import the existing resources instead of recreating them.
+*/
+
+// Format is the format the infrastructure is described in
+type Format string
+
+const (
+	// FormatJSON describes the infrastructure as a JSON document
+	FormatJSON Format = "json"
+	// FormatTerraform describes the infrastructure as Terraform resources, with an import block for each of them
+	FormatTerraform Format = "terraform"
+)
+
+// ParseFormat returns the format of the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatJSON, FormatTerraform:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid export format %q, must be one of %s and %s", name, FormatJSON,
+			FormatTerraform)
+	}
+}
+
+// Infrastructure describes the resources created by wni
+type Infrastructure struct {
+	// Provider is the cloud provider the resources are on, e.g. aws
+	Provider string `json:"provider"`
+	// Region is the region the resources are in
+	Region string `json:"region"`
+	// Instances are the created instances
+	Instances []Instance `json:"instances"`
+	// SecurityGroups are the security groups created for the instances
+	SecurityGroups []SecurityGroup `json:"securityGroups"`
+	// KeyPairs are the key pairs the instances were created with
+	KeyPairs []KeyPair `json:"keyPairs"`
+	// DNSRecords are the records registered for the instances in the private DNS zone of the cluster
+	DNSRecords []DNSRecord `json:"dnsRecords,omitempty"`
+}
+
+// Instance describes a created instance
+type Instance struct {
+	// ID is the ID of the instance
+	ID string `json:"id"`
+	// ImageID is the ID of the image the instance was created from
+	ImageID string `json:"imageId"`
+	// InstanceType is the flavor of the instance
+	InstanceType string `json:"instanceType"`
+	// SubnetID is the ID of the subnet the instance is in
+	SubnetID string `json:"subnetId"`
+	// KeyName is the name of the key pair the instance was created with
+	KeyName string `json:"keyName"`
+	// SecurityGroupIDs are the IDs of the security groups of the instance
+	SecurityGroupIDs []string `json:"securityGroupIds"`
+	// IAMInstanceProfile is the ARN of the instance profile of the instance, if any
+	IAMInstanceProfile string `json:"iamInstanceProfile,omitempty"`
+	// PrivateIPAddress is the private IP address of the instance
+	PrivateIPAddress string `json:"privateIpAddress"`
+	// PublicIPAddress is the public IP address of the instance, if any
+	PublicIPAddress string `json:"publicIpAddress,omitempty"`
+	// Tags are the tags of the instance
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// SecurityGroup describes a security group created for the instances
+type SecurityGroup struct {
+	// ID is the ID of the security group
+	ID string `json:"id"`
+	// Name is the name of the security group
+	Name string `json:"name"`
+	// Description is the description of the security group
+	Description string `json:"description"`
+	// VPCID is the ID of the VPC the security group is in
+	VPCID string `json:"vpcId"`
+	// Ingress are the ingress rules of the security group
+	Ingress []Rule `json:"ingress"`
+	// Tags are the tags of the security group
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Rule describes an ingress rule of a security group
+type Rule struct {
+	// Protocol is the protocol of the rule, -1 for all protocols
+	Protocol string `json:"protocol"`
+	// FromPort is the start of the port range of the rule
+	FromPort int64 `json:"fromPort"`
+	// ToPort is the end of the port range of the rule
+	ToPort int64 `json:"toPort"`
+	// CIDRBlocks are the address ranges the rule allows
+	CIDRBlocks []string `json:"cidrBlocks,omitempty"`
+	// SecurityGroupIDs are the IDs of the security groups the rule allows
+	SecurityGroupIDs []string `json:"securityGroupIds,omitempty"`
+	// Description is the description of the rule
+	Description string `json:"description,omitempty"`
+}
+
+// KeyPair describes a key pair the instances were created with
+type KeyPair struct {
+	// Name is the name of the key pair
+	Name string `json:"name"`
+	// Fingerprint is the fingerprint of the key pair
+	Fingerprint string `json:"fingerprint"`
+}
+
+// DNSRecord describes an A record registered for an instance
+type DNSRecord struct {
+	// InstanceID is the ID of the instance the record points to
+	InstanceID string `json:"instanceId"`
+	// Name is the fully qualified name of the record
+	Name string `json:"name"`
+	// ZoneID is the ID of the DNS zone of the record
+	ZoneID string `json:"zoneId"`
+	// IPAddress is the address the record points to
+	IPAddress string `json:"ipAddress"`
+	// TTL is the time to live of the record in seconds
+	TTL int64 `json:"ttl"`
+}
+
+// Write describes the infrastructure in the given format to the given writer
+func Write(w io.Writer, infra *Infrastructure, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(infra)
+	case FormatTerraform:
+		return writeTerraform(w, infra)
+	default:
+		return fmt.Errorf("invalid export format %q", format)
+	}
+}
@@ -0,0 +1,103 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testInfrastructure is an instance created by wni with its security group, key pair and DNS record
+var testInfrastructure = &Infrastructure{
+	Provider: "aws",
+	Region:   "us-east-2",
+	Instances: []Instance{{
+		ID:                 "i-0123456789abcdef0",
+		ImageID:            "ami-06a4e829b8bbad61e",
+		InstanceType:       "m5a.large",
+		SubnetID:           "subnet-0a1b2c3d",
+		KeyName:            "libra",
+		SecurityGroupIDs:   []string{"sg-0a1b2c3d", "sg-0f9e8d7c"},
+		IAMInstanceProfile: "arn:aws:iam::123456789012:instance-profile/cluster-x7k2p-worker-profile",
+		PrivateIPAddress:   "10.0.1.23",
+		PublicIPAddress:    "3.135.234.23",
+		Tags:               map[string]string{"Name": "cluster-x7k2p-windows-worker-us-east-2a-abcd"},
+	}},
+	SecurityGroups: []SecurityGroup{{
+		ID:          "sg-0a1b2c3d",
+		Name:        "cluster-x7k2p-windows-worker-sg",
+		Description: "Security group for Windows workers",
+		VPCID:       "vpc-0a1b2c3d",
+		Ingress: []Rule{
+			{Protocol: "tcp", FromPort: 5986, ToPort: 5986, CIDRBlocks: []string{"203.0.113.10/32"},
+				Description: "WinRM from ${user}"},
+			{Protocol: "-1", FromPort: 0, ToPort: 0, SecurityGroupIDs: []string{"sg-0a1b2c3d"}},
+		},
+	}},
+	KeyPairs: []KeyPair{{Name: "libra", Fingerprint: "1f:51:ae:28:bf:89:e9:d8:1f:25:5d:37:2d:7d:b8:ca"}},
+	DNSRecords: []DNSRecord{{
+		InstanceID: "i-0123456789abcdef0",
+		Name:       "cluster-x7k2p-windows-worker-us-east-2a-abcd.cluster.example.com",
+		ZoneID:     "Z0123456789ABCDEFGHIJ",
+		IPAddress:  "10.0.1.23",
+		TTL:        60,
+	}},
+}
+
+// TestParseFormat tests the parsing of the export formats
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"json", "terraform"} {
+		format, err := ParseFormat(name)
+		require.NoError(t, err)
+		assert.Equal(t, Format(name), format)
+	}
+	_, err := ParseFormat("yaml")
+	assert.Error(t, err)
+}
+
+// TestWriteJSON tests that the JSON description can be read back
+func TestWriteJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, testInfrastructure, FormatJSON))
+	infra := &Infrastructure{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), infra))
+	assert.Equal(t, testInfrastructure, infra)
+}
+
+// TestWriteTerraform tests that each resource is imported and that the resources reference each other
+func TestWriteTerraform(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, testInfrastructure, FormatTerraform))
+	out := buf.String()
+
+	for _, expected := range []string{
+		"import {\n  to = aws_instance.i-0123456789abcdef0\n  id = \"i-0123456789abcdef0\"\n}",
+		"import {\n  to = aws_security_group.sg-0a1b2c3d\n  id = \"sg-0a1b2c3d\"\n}",
+		"import {\n  to = aws_key_pair.libra\n  id = \"libra\"\n}",
+		"id = \"Z0123456789ABCDEFGHIJ_cluster-x7k2p-windows-worker-us-east-2a-abcd.cluster.example.com_A\"",
+		// The security groups and key pairs that are exported are referenced, the others are kept as they are
+		"vpc_security_group_ids      = [aws_security_group.sg-0a1b2c3d.id, \"sg-0f9e8d7c\"]",
+		"key_name                    = aws_key_pair.libra.key_name",
+		"records = [aws_instance.i-0123456789abcdef0.private_ip]",
+		"iam_instance_profile        = \"cluster-x7k2p-worker-profile\"",
+		"associate_public_ip_address = true",
+		"    self      = true",
+		// The template sequences of the strings are escaped
+		"description = \"WinRM from $${user}\"",
+		"  tags                        = {\n    \"Name\" = \"cluster-x7k2p-windows-worker-us-east-2a-abcd\"\n  }",
+	} {
+		assert.Contains(t, out, expected)
+	}
+
+	assert.Error(t, Write(buf, &Infrastructure{Provider: "azure"}, FormatTerraform),
+		"terraform is only supported for aws")
+}
+
+// TestIdentifier tests that the names are made valid Terraform identifiers
+func TestIdentifier(t *testing.T) {
+	assert.Equal(t, "i-0123456789abcdef0", identifier("i-0123456789abcdef0"))
+	assert.Equal(t, "host_cluster_example_com", identifier("host.cluster.example.com"))
+	assert.Equal(t, "_2020-key", identifier("2020-key"))
+}
@@ -0,0 +1,272 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// invalidIdentifierChars matches the characters that cannot be used in the name of a Terraform resource
+var invalidIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// attribute is an argument of a Terraform block, with its value already rendered
+type attribute struct {
+	// key is the name of the argument
+	key string
+	// value is the HCL expression of the argument
+	value string
+}
+
+// block is a Terraform block, like a resource or an ingress rule
+type block struct {
+	// header is the type and the labels of the block, e.g. resource "aws_instance" "i-0123456789abcdef0"
+	header string
+	// attributes are the arguments of the block, in order
+	attributes []attribute
+	// blocks are the nested blocks, written after the arguments
+	blocks []*block
+}
+
+// set adds the argument with the given rendered value to the block
+func (b *block) set(key, value string) {
+	b.attributes = append(b.attributes, attribute{key, value})
+}
+
+// setString adds the argument with the given string value to the block, unless the value is empty
+func (b *block) setString(key, value string) {
+	if value != "" {
+		b.set(key, hclString(value))
+	}
+}
+
+// write writes the block at the given indentation level, aligning the equal signs of consecutive single-line
+// arguments like terraform fmt does
+func (b *block) write(buf *bytes.Buffer, level int) {
+	indent := strings.Repeat("  ", level)
+	fmt.Fprintf(buf, "%s%s {\n", indent, b.header)
+	for start := 0; start < len(b.attributes); {
+		// The group of arguments aligned together ends after a multi-line argument
+		end, width := start, 0
+		for end < len(b.attributes) {
+			if len(b.attributes[end].key) > width {
+				width = len(b.attributes[end].key)
+			}
+			end++
+			if strings.Contains(b.attributes[end-1].value, "\n") {
+				break
+			}
+		}
+		for _, attr := range b.attributes[start:end] {
+			value := strings.Replace(attr.value, "\n", "\n"+indent+"  ", -1)
+			fmt.Fprintf(buf, "%s  %-*s = %s\n", indent, width, attr.key, value)
+		}
+		start = end
+	}
+	for _, nested := range b.blocks {
+		if len(b.attributes) > 0 || nested != b.blocks[0] {
+			buf.WriteString("\n")
+		}
+		nested.write(buf, level+1)
+	}
+	fmt.Fprintf(buf, "%s}\n", indent)
+}
+
+// writeTerraform describes the infrastructure as Terraform resources, each preceded by the import block importing the
+// existing resource
+func writeTerraform(w io.Writer, infra *Infrastructure) error {
+	if infra.Provider != "aws" {
+		return fmt.Errorf("the terraform export format is not supported for the %s cloud provider", infra.Provider)
+	}
+	var blocks []*block
+	provider := &block{header: `provider "aws"`}
+	provider.setString("region", infra.Region)
+	blocks = append(blocks, provider)
+
+	keyPairs := make(map[string]string)
+	for _, keyPair := range infra.KeyPairs {
+		name := identifier(keyPair.Name)
+		keyPairs[keyPair.Name] = name
+		variable := &block{header: fmt.Sprintf("variable %s", hclString(name+"_public_key"))}
+		variable.set("description", hclString(fmt.Sprintf("public key of the %s key pair, which AWS does not return",
+			keyPair.Name)))
+		variable.set("type", "string")
+		resource := &block{header: fmt.Sprintf(`resource "aws_key_pair" %s`, hclString(name))}
+		resource.setString("key_name", keyPair.Name)
+		resource.set("public_key", fmt.Sprintf("var.%s_public_key", name))
+		lifecycle := &block{header: "lifecycle"}
+		lifecycle.set("ignore_changes", "[public_key]")
+		resource.blocks = append(resource.blocks, lifecycle)
+		blocks = append(blocks, variable, importBlock("aws_key_pair."+name, keyPair.Name), resource)
+	}
+
+	securityGroups := make(map[string]bool)
+	for _, sg := range infra.SecurityGroups {
+		securityGroups[sg.ID] = true
+	}
+	for _, sg := range infra.SecurityGroups {
+		name := identifier(sg.ID)
+		resource := &block{header: fmt.Sprintf(`resource "aws_security_group" %s`, hclString(name))}
+		resource.setString("name", sg.Name)
+		resource.setString("description", sg.Description)
+		resource.setString("vpc_id", sg.VPCID)
+		if len(sg.Tags) > 0 {
+			resource.set("tags", hclMap(sg.Tags))
+		}
+		for _, rule := range sg.Ingress {
+			ingress := &block{header: "ingress"}
+			ingress.setString("description", rule.Description)
+			ingress.set("from_port", fmt.Sprint(rule.FromPort))
+			ingress.set("to_port", fmt.Sprint(rule.ToPort))
+			ingress.setString("protocol", rule.Protocol)
+			if len(rule.CIDRBlocks) > 0 {
+				ingress.set("cidr_blocks", hclList(rule.CIDRBlocks, nil))
+			}
+			var sources []string
+			for _, id := range rule.SecurityGroupIDs {
+				if id == sg.ID {
+					ingress.set("self", "true")
+					continue
+				}
+				sources = append(sources, id)
+			}
+			if len(sources) > 0 {
+				ingress.set("security_groups", hclList(sources, func(id string) string {
+					if securityGroups[id] {
+						return fmt.Sprintf("aws_security_group.%s.id", identifier(id))
+					}
+					return ""
+				}))
+			}
+			resource.blocks = append(resource.blocks, ingress)
+		}
+		blocks = append(blocks, importBlock("aws_security_group."+name, sg.ID), resource)
+	}
+
+	instances := make(map[string]string)
+	for _, instance := range infra.Instances {
+		name := identifier(instance.ID)
+		instances[instance.ID] = name
+		resource := &block{header: fmt.Sprintf(`resource "aws_instance" %s`, hclString(name))}
+		resource.setString("ami", instance.ImageID)
+		resource.setString("instance_type", instance.InstanceType)
+		resource.setString("subnet_id", instance.SubnetID)
+		if keyPair, ok := keyPairs[instance.KeyName]; ok {
+			resource.set("key_name", fmt.Sprintf("aws_key_pair.%s.key_name", keyPair))
+		} else {
+			resource.setString("key_name", instance.KeyName)
+		}
+		resource.set("vpc_security_group_ids", hclList(instance.SecurityGroupIDs, func(id string) string {
+			if securityGroups[id] {
+				return fmt.Sprintf("aws_security_group.%s.id", identifier(id))
+			}
+			return ""
+		}))
+		if instance.IAMInstanceProfile != "" {
+			// The instance profile is given by name, which is the last part of its ARN
+			profile := instance.IAMInstanceProfile[strings.LastIndex(instance.IAMInstanceProfile, "/")+1:]
+			resource.setString("iam_instance_profile", profile)
+		}
+		resource.set("associate_public_ip_address", fmt.Sprint(instance.PublicIPAddress != ""))
+		if len(instance.Tags) > 0 {
+			resource.set("tags", hclMap(instance.Tags))
+		}
+		// The user data of the instance only ran on its first boot
+		lifecycle := &block{header: "lifecycle"}
+		lifecycle.set("ignore_changes", "[user_data]")
+		resource.blocks = append(resource.blocks, lifecycle)
+		blocks = append(blocks, importBlock("aws_instance."+name, instance.ID), resource)
+	}
+
+	for _, record := range infra.DNSRecords {
+		name := identifier(record.Name)
+		resource := &block{header: fmt.Sprintf(`resource "aws_route53_record" %s`, hclString(name))}
+		resource.setString("zone_id", record.ZoneID)
+		resource.setString("name", record.Name)
+		resource.setString("type", "A")
+		resource.set("ttl", fmt.Sprint(record.TTL))
+		if instance, ok := instances[record.InstanceID]; ok {
+			resource.set("records", fmt.Sprintf("[aws_instance.%s.private_ip]", instance))
+		} else {
+			resource.set("records", hclList([]string{record.IPAddress}, nil))
+		}
+		blocks = append(blocks, importBlock("aws_route53_record."+name,
+			fmt.Sprintf("%s_%s_A", record.ZoneID, record.Name)), resource)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("# Generated by wni export. The import blocks need Terraform 1.5 or later, run terraform plan to " +
+		"review the\n# resources before importing them with terraform apply.\n")
+	for _, b := range blocks {
+		buf.WriteString("\n")
+		b.write(buf, 0)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// importBlock returns the import block importing the resource of the given ID to the given address
+func importBlock(address, id string) *block {
+	b := &block{header: "import"}
+	b.set("to", address)
+	b.set("id", hclString(id))
+	return b
+}
+
+// identifier returns a name usable for a Terraform resource from the given name
+func identifier(name string) string {
+	name = invalidIdentifierChars.ReplaceAllString(name, "_")
+	if name == "" || !(name[0] == '_' || (name[0] >= 'A' && name[0] <= 'Z') || (name[0] >= 'a' && name[0] <= 'z')) {
+		name = "_" + name
+	}
+	return name
+}
+
+// hclString returns the given string as a quoted HCL string, escaping the template sequences
+func hclString(s string) string {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string cannot fail
+	encoder.Encode(s)
+	quoted := strings.TrimSuffix(buf.String(), "\n")
+	quoted = strings.Replace(quoted, "${", "$${", -1)
+	return strings.Replace(quoted, "%{", "%%{", -1)
+}
+
+// hclList returns the given strings as an HCL list. If reference returns an expression for an element, like the
+// attribute of another resource, it is used instead of the quoted element.
+func hclList(elements []string, reference func(string) string) string {
+	values := make([]string, len(elements))
+	for i, element := range elements {
+		if reference != nil {
+			if expression := reference(element); expression != "" {
+				values[i] = expression
+				continue
+			}
+		}
+		values[i] = hclString(element)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// hclMap returns the given map as a multi-line HCL map, sorted by key
+func hclMap(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	width := 0
+	for key := range m {
+		keys = append(keys, key)
+		if len(hclString(key)) > width {
+			width = len(hclString(key))
+		}
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("  %-*s = %s", width, hclString(key), hclString(m[key])))
+	}
+	return "{\n" + strings.Join(lines, "\n") + "\n}"
+}
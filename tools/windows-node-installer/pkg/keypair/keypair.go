@@ -0,0 +1,108 @@
+// Package keypair generates the key pairs the Windows instances are created with, whose private key decrypts the
+// password of the instances, and stores the private key encrypted with a passphrase.
+package keypair
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// PassphraseEnvVar is the environment variable holding the passphrase the generated private keys are encrypted
+	// with
+	PassphraseEnvVar = "WNI_KEY_PASSPHRASE"
+	// bits is the size of the generated keys. The cloud providers decrypt the password of Windows instances with
+	// 2048-bit RSA keys.
+	bits = 2048
+	// privateKeyType is the PEM block type of PKCS #1 RSA private keys
+	privateKeyType = "RSA PRIVATE KEY"
+	// pkcs8PrivateKeyType is the PEM block type of unencrypted PKCS #8 private keys
+	pkcs8PrivateKeyType = "PRIVATE KEY"
+)
+
+// Generate returns a new RSA key
+func Generate() (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("error generating RSA key: %v", err)
+	}
+	return key, nil
+}
+
+// AuthorizedKey returns the public key of the given key in the OpenSSH authorized_keys format, which the cloud
+// providers import key pairs from
+func AuthorizedKey(key *rsa.PrivateKey) ([]byte, error) {
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error converting public key: %v", err)
+	}
+	return ssh.MarshalAuthorizedKey(publicKey), nil
+}
+
+// EncryptPrivateKey returns the given key as a PEM encoded PKCS #8 private key encrypted with the given passphrase
+func EncryptPrivateKey(key *rsa.PrivateKey, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("no passphrase to encrypt the private key with, set %s", PassphraseEnvVar)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling private key: %v", err)
+	}
+	if der, err = encryptPKCS8(der, passphrase); err != nil {
+		return nil, fmt.Errorf("error encrypting private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: encryptedPrivateKeyType, Bytes: der}), nil
+}
+
+// DecodePrivateKey parses the given PEM encoded PKCS #1 or PKCS #8 RSA private key, decrypting it with the given
+// passphrase if it is an encrypted PKCS #8 private key
+func DecodePrivateKey(data []byte, passphrase string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+	// The keys encrypted with the legacy OpenSSL PEM encryption cannot be authenticated
+	if _, ok := block.Headers["DEK-Info"]; ok {
+		return nil, fmt.Errorf("the private key uses the insecure legacy PEM encryption, convert it with openssl " +
+			"pkcs8 -topk8 -v2 aes-256-cbc")
+	}
+	switch block.Type {
+	case privateKeyType:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key with %v", err)
+		}
+		return key, nil
+	case encryptedPrivateKeyType:
+		if passphrase == "" {
+			return nil, fmt.Errorf("the private key is encrypted, set %s to its passphrase", PassphraseEnvVar)
+		}
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting private key: %v", err)
+		}
+		return parsePKCS8(der)
+	case pkcs8PrivateKeyType:
+		return parsePKCS8(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key PEM block type %s", block.Type)
+	}
+}
+
+// parsePKCS8 returns the RSA private key of the given PKCS #8 PrivateKeyInfo
+func parsePKCS8(der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key with %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the private key is a %T, expected an RSA private key", key)
+	}
+	return rsaKey, nil
+}
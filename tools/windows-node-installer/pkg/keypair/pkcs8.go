@@ -0,0 +1,167 @@
+package keypair
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The private keys are encrypted as PKCS #8 EncryptedPrivateKeyInfo (RFC 5958) with PBES2 (RFC 8018), deriving an
+// AES-256-CBC key from the passphrase with PBKDF2-HMAC-SHA256, which is what `openssl pkcs8 -topk8 -v2 aes-256-cbc`
+// writes. The keys written by OpenSSL with its default PBKDF2-HMAC-SHA1 or with AES-128-CBC are decrypted as well.
+
+const (
+	// encryptedPrivateKeyType is the PEM block type of PKCS #8 encrypted private keys
+	encryptedPrivateKeyType = "ENCRYPTED PRIVATE KEY"
+	// iterations is the PBKDF2 iteration count of the encrypted private keys, as recommended by OWASP for
+	// PBKDF2-HMAC-SHA256
+	iterations = 600000
+	// saltSize is the size of the random PBKDF2 salt
+	saltSize = 16
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the PKCS #8 EncryptedPrivateKeyInfo structure
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of the PBES2 encryption scheme
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of the PBKDF2 key derivation function, whose PRF defaults to HMAC-SHA1
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// encryptPKCS8 returns the EncryptedPrivateKeyInfo of the given PKCS #8 PrivateKeyInfo encrypted with the passphrase
+func encryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	iv := make([]byte, aes.BlockSize)
+	for _, b := range [][]byte{salt, iv} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error generating random bytes: %v", err)
+		}
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{Salt: salt, IterationCount: iterations,
+		PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+}
+
+// decryptPKCS8 returns the PKCS #8 PrivateKeyInfo of the given EncryptedPrivateKeyInfo decrypted with the passphrase
+func decryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s, expected PBES2", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, expected PBKDF2",
+			params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+	if kdfParams.IterationCount <= 0 {
+		return nil, fmt.Errorf("invalid PBKDF2 iteration count %d", kdfParams.IterationCount)
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", kdfParams.PRF.Algorithm)
+	}
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	_, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC initialization vector")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key length")
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), kdfParams.Salt, kdfParams.IterationCount, keyLength,
+		prf))
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+	// A wrong passphrase almost always leaves an invalid padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("incorrect passphrase")
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
@@ -0,0 +1,186 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
+)
+
+/*
+	progress reports the progress of the long-running operations, like the creation and the bootstrap of an instance,
+	as structured events, so that wrapping tools and CI UIs can show where an operation is at instead of a silent wait.
+	The events are sent to a Reporter, which writes them as JSON lines to an io.Writer or sends them to a channel.
+	Without a Reporter, the events are dropped.
+*/
+
+const (
+	// MessageStarted is the message of the events reporting that an operation or a phase started
+	MessageStarted = "started"
+	// MessageCompleted is the message of the events reporting that an operation or a phase completed
+	MessageCompleted = "completed"
+	// MessageFailed is the message of the events reporting that an operation or a phase failed
+	MessageFailed = "failed"
+)
+
+// Event reports the progress of an operation
+type Event struct {
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+	// Operation is the name of the operation, e.g. CreateWindowsVM
+	Operation string `json:"operation"`
+	// Phase is the name of the phase of the operation the event is about, empty for the operation itself
+	Phase string `json:"phase,omitempty"`
+	// Percent is the percentage of the phases of the operation that completed
+	Percent int `json:"percent"`
+	// Message is one of MessageStarted, MessageCompleted and MessageFailed
+	Message string `json:"message"`
+	// Error is the error the operation or the phase failed with
+	Error string `json:"error,omitempty"`
+	// Context is the context of the run the operation is part of, as run=<ID>,cluster=<ID>,build=<build>,provider=<name>
+	Context string `json:"context,omitempty"`
+}
+
+// Reporter is the interface implemented by the receivers of the progress events
+type Reporter interface {
+	// Report receives the given event. It must be safe to call concurrently, as the operations on several instances
+	// can run in parallel.
+	Report(Event)
+}
+
+// writerReporter writes the events as JSON lines
+type writerReporter struct {
+	// lock prevents the lines of concurrent events from being interleaved
+	lock sync.Mutex
+	// encoder writes each event on its own line
+	encoder *json.Encoder
+}
+
+// NewWriterReporter returns a Reporter writing the events to the given writer as JSON lines
+func NewWriterReporter(w io.Writer) Reporter {
+	return &writerReporter{encoder: json.NewEncoder(w)}
+}
+
+// Report writes the given event as a JSON line. Write errors are ignored, as progress reporting must not fail the
+// operation.
+func (r *writerReporter) Report(event Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_ = r.encoder.Encode(event)
+}
+
+// ChannelReporter is a Reporter sending the events to a channel. The channel has to be drained, as the operations
+// block until their events are received.
+type ChannelReporter chan<- Event
+
+// Report sends the given event to the channel
+func (c ChannelReporter) Report(event Event) {
+	c <- event
+}
+
+var (
+	// reporterLock protects reporter and runContext
+	reporterLock sync.RWMutex
+	// reporter receives the events of all the operations, nil if they are dropped
+	reporter Reporter
+	// runContext is the context of the run set in all the events
+	runContext string
+)
+
+// SetReporter sets the Reporter receiving the events of all the operations. A nil Reporter drops the events.
+func SetReporter(r Reporter) {
+	reporterLock.Lock()
+	defer reporterLock.Unlock()
+	reporter = r
+}
+
+// SetRunContext sets the context of the run the operations are part of, which is set in all the events
+func SetRunContext(context string) {
+	reporterLock.Lock()
+	defer reporterLock.Unlock()
+	runContext = context
+}
+
+// GetReporter returns the Reporter receiving the events of all the operations, nil if they are dropped
+func GetReporter() Reporter {
+	reporterLock.RLock()
+	defer reporterLock.RUnlock()
+	return reporter
+}
+
+// report sends the given event to the Reporter, if any
+func report(event Event) {
+	reporterLock.RLock()
+	r := reporter
+	event.Context = runContext
+	reporterLock.RUnlock()
+	if r == nil {
+		return
+	}
+	event.Time = time.Now()
+	r.Report(event)
+}
+
+// Operation tracks the progress of an operation made of a known number of phases
+type Operation struct {
+	// name is the name of the operation
+	name string
+	// phases is the number of phases of the operation
+	phases int
+	// lock protects completed
+	lock sync.Mutex
+	// completed is the number of phases that completed
+	completed int
+}
+
+// Start reports the start of the operation with the given name and number of phases, and returns it
+func Start(name string, phases int) *Operation {
+	o := &Operation{name: name, phases: phases}
+	report(Event{Operation: name, Percent: 0, Message: MessageStarted})
+	return o
+}
+
+// percent returns the percentage of the phases that completed
+func (o *Operation) percent() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.phases <= 0 {
+		return 0
+	}
+	percent := o.completed * 100 / o.phases
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// Phase runs fn as the phase of the operation with the given name, within a span child of the span in the given
+// context, and reports its start and its completion or failure
+func (o *Operation) Phase(ctx context.Context, name string, fn func() error) error {
+	report(Event{Operation: o.name, Phase: name, Percent: o.percent(), Message: MessageStarted})
+	_, span := tracing.Start(ctx, name)
+	err := fn()
+	tracing.End(span, err)
+	if err != nil {
+		report(Event{Operation: o.name, Phase: name, Percent: o.percent(), Message: MessageFailed,
+			Error: err.Error()})
+		return err
+	}
+	o.lock.Lock()
+	o.completed++
+	o.lock.Unlock()
+	report(Event{Operation: o.name, Phase: name, Percent: o.percent(), Message: MessageCompleted})
+	return nil
+}
+
+// End reports the completion of the operation, or its failure with the given error if it is not nil
+func (o *Operation) End(err error) {
+	if err != nil {
+		report(Event{Operation: o.name, Percent: o.percent(), Message: MessageFailed, Error: err.Error()})
+		return
+	}
+	report(Event{Operation: o.name, Percent: 100, Message: MessageCompleted})
+}
@@ -0,0 +1,111 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOperation tests the events reported by an operation, written as JSON lines
+func TestOperation(t *testing.T) {
+	var buf bytes.Buffer
+	SetReporter(NewWriterReporter(&buf))
+	defer SetReporter(nil)
+
+	op := Start("CreateWindowsVM", 2)
+	require.NoError(t, op.Phase(context.Background(), "create instance", func() error { return nil }))
+	assert.Error(t, op.Phase(context.Background(), "get password", func() error { return fmt.Errorf("timed out") }))
+	op.End(fmt.Errorf("timed out"))
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event), "each line is an event")
+		assert.False(t, event.Time.IsZero())
+		events = append(events, event)
+	}
+	require.Len(t, events, 6)
+
+	expected := []Event{
+		{Operation: "CreateWindowsVM", Percent: 0, Message: MessageStarted},
+		{Operation: "CreateWindowsVM", Phase: "create instance", Percent: 0, Message: MessageStarted},
+		{Operation: "CreateWindowsVM", Phase: "create instance", Percent: 50, Message: MessageCompleted},
+		{Operation: "CreateWindowsVM", Phase: "get password", Percent: 50, Message: MessageStarted},
+		{Operation: "CreateWindowsVM", Phase: "get password", Percent: 50, Message: MessageFailed,
+			Error: "timed out"},
+		{Operation: "CreateWindowsVM", Percent: 50, Message: MessageFailed, Error: "timed out"},
+	}
+	for i := range expected {
+		expected[i].Time = events[i].Time
+	}
+	assert.Equal(t, expected, events)
+}
+
+// TestChannelReporter tests that the events are sent to the channel with the run context, and that the completion of
+// an operation is reported at 100 percent
+func TestChannelReporter(t *testing.T) {
+	events := make(chan Event, 10)
+	SetReporter(ChannelReporter(events))
+	defer SetReporter(nil)
+	SetRunContext("run=1234,provider=aws")
+	defer SetRunContext("")
+
+	op := Start("Bootstrap", 3)
+	require.NoError(t, op.Phase(context.Background(), "run WMCB", func() error { return nil }))
+	op.End(nil)
+	close(events)
+
+	var percents []int
+	for event := range events {
+		assert.Equal(t, "Bootstrap", event.Operation)
+		assert.Equal(t, "run=1234,provider=aws", event.Context)
+		percents = append(percents, event.Percent)
+	}
+	assert.Equal(t, []int{0, 0, 33, 100}, percents)
+}
+
+// TestNoReporter tests that the operations run without a Reporter
+func TestNoReporter(t *testing.T) {
+	ran := false
+	op := Start("CreateWindowsVM", 1)
+	require.NoError(t, op.Phase(context.Background(), "create instance", func() error {
+		ran = true
+		return nil
+	}))
+	op.End(nil)
+	assert.True(t, ran)
+}
+
+// TestTimer tests that the timer records the completed phases, and passes the events on to the next Reporter
+func TestTimer(t *testing.T) {
+	events := make(chan Event, 10)
+	timer := NewTimer(ChannelReporter(events))
+	SetReporter(timer)
+	defer SetReporter(nil)
+	assert.Equal(t, timer, GetReporter())
+
+	op := Start("CreateWindowsVM", 3)
+	require.NoError(t, op.Phase(context.Background(), "create instance", func() error { return nil }))
+	assert.Error(t, op.Phase(context.Background(), "get password", func() error { return fmt.Errorf("timed out") }))
+	require.NoError(t, op.Phase(context.Background(), "get password", func() error { return nil }))
+	op.End(nil)
+	close(events)
+	assert.Len(t, events, 8)
+
+	phases := timer.Phases("CreateWindowsVM")
+	require.Len(t, phases, 2)
+	assert.Equal(t, "create instance", phases[0].Phase)
+	assert.Equal(t, "get password", phases[1].Phase)
+	for _, phase := range phases {
+		assert.False(t, phase.Started.IsZero())
+		assert.True(t, phase.Duration() >= 0)
+	}
+	assert.Empty(t, timer.Phases("Bootstrap"))
+}
@@ -0,0 +1,77 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// PhaseTime is when a phase of an operation started and completed
+type PhaseTime struct {
+	// Phase is the name of the phase
+	Phase string
+	// Started is when the phase started
+	Started time.Time
+	// Completed is when the phase completed
+	Completed time.Time
+}
+
+// Duration returns how long the phase took
+func (p PhaseTime) Duration() time.Duration {
+	return p.Completed.Sub(p.Started)
+}
+
+// Timer is a Reporter recording when the phases of the operations started and completed, e.g. to compare how long the
+// setup of instances booted from different images takes. The events are passed on to the next Reporter, if any.
+type Timer struct {
+	// next receives the events once recorded, nil if they are dropped
+	next Reporter
+	// lock protects started and phases
+	lock sync.Mutex
+	// started holds when the running phases started by operation and phase
+	started map[string]map[string]time.Time
+	// phases holds the completed phases by operation, in the order they completed
+	phases map[string][]PhaseTime
+}
+
+// NewTimer returns a Timer passing the events on to the given Reporter, which can be nil
+func NewTimer(next Reporter) *Timer {
+	return &Timer{
+		next:    next,
+		started: make(map[string]map[string]time.Time),
+		phases:  make(map[string][]PhaseTime),
+	}
+}
+
+// Report records the start or the completion of the phase of the given event. The failed phases are not recorded.
+func (t *Timer) Report(event Event) {
+	if event.Phase != "" {
+		t.lock.Lock()
+		switch event.Message {
+		case MessageStarted:
+			if t.started[event.Operation] == nil {
+				t.started[event.Operation] = make(map[string]time.Time)
+			}
+			t.started[event.Operation][event.Phase] = event.Time
+		case MessageCompleted:
+			if started, ok := t.started[event.Operation][event.Phase]; ok {
+				t.phases[event.Operation] = append(t.phases[event.Operation],
+					PhaseTime{Phase: event.Phase, Started: started, Completed: event.Time})
+			}
+			delete(t.started[event.Operation], event.Phase)
+		case MessageFailed:
+			delete(t.started[event.Operation], event.Phase)
+		}
+		t.lock.Unlock()
+	}
+	if t.next != nil {
+		t.next.Report(event)
+	}
+}
+
+// Phases returns the completed phases of the operation with the given name, in the order they completed. When the
+// operation ran more than once, the phases of all the runs are returned.
+func (t *Timer) Phases(operation string) []PhaseTime {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]PhaseTime(nil), t.phases[operation]...)
+}
@@ -0,0 +1,157 @@
+package quota
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+	quota checks that the resources requested by wni fit the quotas of the cloud account before creating anything, so
+	that a request that cannot be satisfied fails fast with the quota to increase instead of failing halfway with an
+	opaque limit error.
+*/
+
+// vCPUQuota is the cloud quota limiting the vCPUs of the running on-demand instances of some instance families
+type vCPUQuota struct {
+	// code is the code of the quota in the Service Quotas API
+	code string
+	// name is the name of the quota
+	name string
+}
+
+var (
+	// standardVCPUQuota is the quota of the vCPUs of the standard instance families
+	standardVCPUQuota = vCPUQuota{"L-1216C47A", "Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances"}
+	// vCPUQuotas holds the vCPU quota of the instance families by their letters, the letters of the family without its
+	// generation and attributes, e.g. m for m5a or inf for inf1
+	vCPUQuotas = map[string]vCPUQuota{
+		"a":   standardVCPUQuota,
+		"c":   standardVCPUQuota,
+		"d":   standardVCPUQuota,
+		"h":   standardVCPUQuota,
+		"i":   standardVCPUQuota,
+		"m":   standardVCPUQuota,
+		"r":   standardVCPUQuota,
+		"t":   standardVCPUQuota,
+		"z":   standardVCPUQuota,
+		"dl":  {"L-6E869C2A", "Running On-Demand DL instances"},
+		"f":   {"L-74FC7D96", "Running On-Demand F instances"},
+		"g":   {"L-DB2E81BA", "Running On-Demand G and VT instances"},
+		"vt":  {"L-DB2E81BA", "Running On-Demand G and VT instances"},
+		"inf": {"L-1945791B", "Running On-Demand Inf instances"},
+		"p":   {"L-417A185B", "Running On-Demand P instances"},
+		"x":   {"L-7295265B", "Running On-Demand X instances"},
+	}
+	// familyLetters matches the letters of an instance type family
+	familyLetters = regexp.MustCompile(`^[a-z]+`)
+	// xlargeSize matches the sizes of an instance type with 4 vCPUs per xlarge, e.g. xlarge or 12xlarge
+	xlargeSize = regexp.MustCompile(`^([0-9]*)xlarge$`)
+)
+
+// VCPUQuota returns the code and name of the quota limiting the vCPUs of the running on-demand instances of the family
+// of the given instance type, e.g. L-1216C47A for m5a.large. Empty strings are returned for the families without a
+// known vCPU quota.
+func VCPUQuota(instanceType string) (string, string) {
+	letters := familyLetters.FindString(strings.ToLower(instanceType))
+	q, ok := vCPUQuotas[letters]
+	if !ok && letters != "" {
+		// Families with extra attribute letters, like is4gen, share the quota of their first letter
+		q, ok = vCPUQuotas[letters[:1]]
+	}
+	if !ok {
+		return "", ""
+	}
+	return q.code, q.name
+}
+
+// VCPUs returns the number of vCPUs of the given instance type, derived from its size. An error is returned for the
+// sizes whose number of vCPUs depends on the family, like metal.
+func VCPUs(instanceType string) (int64, error) {
+	parts := strings.SplitN(strings.ToLower(instanceType), ".", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid instance type %s", instanceType)
+	}
+	family, size := parts[0], parts[1]
+	switch size {
+	case "nano", "micro", "small":
+		if family == "t2" {
+			return 1, nil
+		}
+		return 2, nil
+	case "medium":
+		if strings.HasPrefix(family, "t") {
+			return 2, nil
+		}
+		return 1, nil
+	case "large":
+		return 2, nil
+	}
+	if match := xlargeSize.FindStringSubmatch(size); match != nil {
+		if match[1] == "" {
+			return 4, nil
+		}
+		multiplier, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid instance type %s: %v", instanceType, err)
+		}
+		return 4 * multiplier, nil
+	}
+	return 0, fmt.Errorf("unknown number of vCPUs for instance type %s", instanceType)
+}
+
+// Quota is a limit of the cloud account, along with its current usage and the amount a request needs
+type Quota struct {
+	// Name is the name of the quota, with the resource it applies to if it is not account wide
+	Name string
+	// Code is the code of the quota, as used to request an increase
+	Code string
+	// Limit is the value of the quota
+	Limit int64
+	// Used is the amount currently in use
+	Used int64
+	// Requested is the amount the request needs on top of the current usage
+	Requested int64
+}
+
+// Fits returns true if the request fits within the quota
+func (q Quota) Fits() bool {
+	return q.Used+q.Requested <= q.Limit
+}
+
+// String returns a description of the usage of the quota
+func (q Quota) String() string {
+	return fmt.Sprintf("%s (quota %s): %d in use + %d requested, limit %d", q.Name, q.Code, q.Used, q.Requested,
+		q.Limit)
+}
+
+// Error is returned when a request does not fit the quotas of the cloud account
+type Error struct {
+	// Exceeded are the quotas the request does not fit
+	Exceeded []Quota
+}
+
+// Error returns the quotas exceeded by the request
+func (e *Error) Error() string {
+	var exceeded []string
+	for _, q := range e.Exceeded {
+		exceeded = append(exceeded, q.String())
+	}
+	return "the requested resources exceed the quotas of the cloud account, free some resources or request an " +
+		"increase of: " + strings.Join(exceeded, "; ")
+}
+
+// Check returns an *Error listing the given quotas the request does not fit, or nil if it fits all of them
+func Check(quotas []Quota) error {
+	var exceeded []Quota
+	for _, q := range quotas {
+		if !q.Fits() {
+			exceeded = append(exceeded, q)
+		}
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return &Error{Exceeded: exceeded}
+}
@@ -0,0 +1,85 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVCPUQuota tests that the instance families are mapped to their vCPU quota
+func TestVCPUQuota(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		code         string
+	}{
+		{"m5a.large", "L-1216C47A"},
+		{"c5.xlarge", "L-1216C47A"},
+		{"t3.medium", "L-1216C47A"},
+		{"is4gen.large", "L-1216C47A"},
+		{"inf1.xlarge", "L-1945791B"},
+		{"g4dn.xlarge", "L-DB2E81BA"},
+		{"vt1.3xlarge", "L-DB2E81BA"},
+		{"p3.2xlarge", "L-417A185B"},
+		{"x1e.xlarge", "L-7295265B"},
+		{"u-6tb1.metal", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.instanceType, func(t *testing.T) {
+			code, name := VCPUQuota(test.instanceType)
+			assert.Equal(t, test.code, code)
+			assert.Equal(t, test.code == "", name == "")
+		})
+	}
+}
+
+// TestVCPUs tests that the number of vCPUs is derived from the size of the instance type
+func TestVCPUs(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		vCPUs        int64
+	}{
+		{"t2.micro", 1},
+		{"t3.micro", 2},
+		{"t3a.medium", 2},
+		{"a1.medium", 1},
+		{"m5a.large", 2},
+		{"m5.xlarge", 4},
+		{"c5.12xlarge", 48},
+		{"M5.2XLARGE", 8},
+	}
+	for _, test := range tests {
+		t.Run(test.instanceType, func(t *testing.T) {
+			vCPUs, err := VCPUs(test.instanceType)
+			require.NoError(t, err)
+			assert.Equal(t, test.vCPUs, vCPUs)
+		})
+	}
+
+	_, err := VCPUs("m5.metal")
+	assert.Error(t, err)
+	_, err = VCPUs("m5")
+	assert.Error(t, err)
+}
+
+// TestCheck tests that the quotas the request does not fit are reported with their usage
+func TestCheck(t *testing.T) {
+	vCPUs := Quota{Name: "Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances", Code: "L-1216C47A",
+		Limit: 32, Used: 28, Requested: 8}
+	securityGroups := Quota{Name: "VPC security groups per Region", Code: "L-E79EC296", Limit: 2500, Used: 10,
+		Requested: 1}
+
+	assert.NoError(t, Check([]Quota{securityGroups}))
+	assert.NoError(t, Check(nil))
+
+	err := Check([]Quota{vCPUs, securityGroups})
+	require.IsType(t, &Error{}, err)
+	assert.Equal(t, []Quota{vCPUs}, err.(*Error).Exceeded)
+	assert.Contains(t, err.Error(), "Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances "+
+		"(quota L-1216C47A): 28 in use + 8 requested, limit 32")
+
+	// A request using the whole quota fits
+	vCPUs.Requested = 4
+	assert.True(t, vCPUs.Fits())
+}
@@ -0,0 +1,230 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/runcontext"
+)
+
+/*
+	replay renders the session recordings written by the e2e tests, i.e. the commands run on a Windows VM with their
+	timing and outputs, so that reviewers can audit what a CI run did on the node. The recordings are written to the
+	sessions directory of ARTIFACT_DIR, a JSON line per command.
+*/
+
+// maxLineSize is the size of the longest line of a recording read, which holds a command along with its outputs
+const maxLineSize = 1024 * 1024
+
+// Entry is a command of a session recording
+type Entry struct {
+	// Seq is the number of the command in the session, from 1, in the order the commands completed
+	Seq int `json:"seq"`
+	// Transport is the transport the command was run over, WinRM or ssh
+	Transport string `json:"transport"`
+	// Host is the IP address of the Windows VM the command was run on
+	Host string `json:"host"`
+	// Context is the context of the run the command was part of
+	Context runcontext.Context `json:"context"`
+	// Command is the command, with the PowerShell scripts decoded
+	Command string `json:"command"`
+	// Start is when the command was started
+	Start time.Time `json:"start"`
+	// Seconds is the duration of the command
+	Seconds float64 `json:"seconds"`
+	// ExitCode is the exit code of the command, -1 if it did not complete
+	ExitCode int `json:"exitCode"`
+	// Error is the error running the command, empty if it completed
+	Error string `json:"error,omitempty"`
+	// Stdout and Stderr are the beginning of the outputs of the command
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	// Truncated is true if the command or its outputs were cut to their beginning
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Failed returns true if the command did not complete or exited with a non-zero code
+func (e *Entry) Failed() bool {
+	return e.Error != "" || e.ExitCode != 0
+}
+
+// Status returns the outcome of the command, e.g. exit code 0
+func (e *Entry) Status() string {
+	if e.Error != "" {
+		return "error: " + e.Error
+	}
+	return fmt.Sprintf("exit code %d", e.ExitCode)
+}
+
+// Read reads a session recording, skipping its blank lines
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid session entry on line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading session: %v", err)
+	}
+	return entries, nil
+}
+
+// Failed returns the given entries of the commands which failed
+func Failed(entries []Entry) []Entry {
+	var failed []Entry
+	for _, entry := range entries {
+		if entry.Failed() {
+			failed = append(failed, entry)
+		}
+	}
+	return failed
+}
+
+// WriteMarkdown writes the given entries as a markdown document, a section per command with its timing, status and
+// outputs
+func WriteMarkdown(w io.Writer, entries []Entry) error {
+	out := &errWriter{w: w}
+	host := ""
+	if len(entries) > 0 {
+		host = entries[0].Host
+	}
+	out.printf("# Session of %s\n\n", host)
+	failed := len(Failed(entries))
+	out.printf("%d commands, %d failed", len(entries), failed)
+	if len(entries) > 0 {
+		first, last := entries[0], entries[len(entries)-1]
+		out.printf(", from %s to %s", first.Start.UTC().Format(time.RFC3339),
+			last.Start.Add(duration(last.Seconds)).UTC().Format(time.RFC3339))
+	}
+	out.printf(".\n")
+	if len(entries) > 0 && !entries[0].Context.Empty() {
+		out.printf("\nRun context: %s.\n", entries[0].Context)
+	}
+	for i := range entries {
+		entry := &entries[i]
+		out.printf("\n## %d. %s %s\n\n", entry.Seq, entry.Transport, title(entry.Command))
+		out.printf("- Started: %s\n", entry.Start.UTC().Format(time.RFC3339Nano))
+		out.printf("- Duration: %s\n", duration(entry.Seconds))
+		status := entry.Status()
+		if entry.Failed() {
+			status = "**" + status + "**"
+		}
+		out.printf("- Status: %s\n", status)
+		if entry.Truncated {
+			out.printf("- The command or its outputs are truncated\n")
+		}
+		out.printf("\n")
+		out.codeBlock("powershell", entry.Command)
+		if entry.Stdout != "" {
+			out.printf("\nstdout:\n\n")
+			out.codeBlock("", entry.Stdout)
+		}
+		if entry.Stderr != "" {
+			out.printf("\nstderr:\n\n")
+			out.codeBlock("", entry.Stderr)
+		}
+	}
+	return out.err
+}
+
+// Play writes the given entries to the given output one at a time, waiting for a line of the given input before each
+// command after the first one. It stops once the input is closed or q is entered. Without an input, the entries are
+// written at once.
+func Play(in io.Reader, w io.Writer, entries []Entry) error {
+	out := &errWriter{w: w}
+	var input *bufio.Scanner
+	if in != nil {
+		input = bufio.NewScanner(in)
+	}
+	for i := range entries {
+		if i > 0 && input != nil {
+			out.printf("-- %d/%d, press Enter for the next command or q to quit: ", i, len(entries))
+			if out.err != nil {
+				return out.err
+			}
+			if !input.Scan() || strings.TrimSpace(input.Text()) == "q" {
+				out.printf("\n")
+				return out.err
+			}
+		}
+		writeEntry(out, &entries[i])
+	}
+	out.printf("-- end of the session, %d commands, %d failed\n", len(entries), len(Failed(entries)))
+	return out.err
+}
+
+// writeEntry writes the given entry as plain text, like a terminal session
+func writeEntry(out *errWriter, entry *Entry) {
+	out.printf("[%d] %s %s on %s, %s, %s\n", entry.Seq, entry.Start.UTC().Format("15:04:05.000"), entry.Transport,
+		entry.Host, duration(entry.Seconds), entry.Status())
+	out.printf("> %s\n", entry.Command)
+	if entry.Stdout != "" {
+		out.printf("%s\n", strings.TrimRight(entry.Stdout, "\r\n"))
+	}
+	if entry.Stderr != "" {
+		out.printf("stderr:\n%s\n", strings.TrimRight(entry.Stderr, "\r\n"))
+	}
+	if entry.Truncated {
+		out.printf("(truncated)\n")
+	}
+	out.printf("\n")
+}
+
+// title returns the first line of the given command, shortened for a heading
+func title(cmd string) string {
+	const maxTitleLength = 80
+	cmd = strings.TrimSpace(cmd)
+	multiline := false
+	if i := strings.IndexAny(cmd, "\r\n"); i >= 0 {
+		cmd, multiline = strings.TrimSpace(cmd[:i]), true
+	}
+	if len(cmd) > maxTitleLength {
+		cmd, multiline = cmd[:maxTitleLength], true
+	}
+	cmd = strings.Replace(cmd, "`", "'", -1)
+	if multiline {
+		cmd += "..."
+	}
+	return "`" + cmd + "`"
+}
+
+// duration returns the given number of seconds as a duration rounded to the millisecond
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+// errWriter writes until the first error, which it keeps
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+// printf writes the given formatted text unless a previous write failed
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+// codeBlock writes the given text as a fenced code block of the given language, with a fence longer than the runs of
+// backticks of the text
+func (e *errWriter) codeBlock(language, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	e.printf("%s%s\n%s\n%s\n", fence, language, strings.TrimRight(text, "\r\n"), fence)
+}
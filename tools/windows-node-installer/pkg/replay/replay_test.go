@@ -0,0 +1,75 @@
+package replay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// session is a session recording of two commands, the second one failing
+const session = `{"seq":1,"transport":"WinRM","host":"10.0.0.1","context":{"runId":"1234","windowsBuild":"2019"},` +
+	`"command":"Get-Service kubelet\nGet-Service docker","start":"2020-05-04T10:00:00Z",` +
+	`"seconds":1.5,"exitCode":0,"stdout":"Running kubelet\n"}
+
+{"seq":2,"transport":"ssh","host":"10.0.0.1","command":"type C:\\k\\kubelet.log","start":"2020-05-04T10:00:02Z",` +
+	"\"seconds\":0.25,\"exitCode\":1,\"stderr\":\"```not found```\",\"truncated\":true}\n"
+
+// TestRead tests that the entries of a session recording are read, and an invalid line reported
+func TestRead(t *testing.T) {
+	entries, err := Read(strings.NewReader(session))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Get-Service kubelet\nGet-Service docker", entries[0].Command)
+	assert.False(t, entries[0].Failed())
+	assert.True(t, entries[1].Failed())
+	assert.Equal(t, "exit code 1", entries[1].Status())
+	assert.Equal(t, []Entry{entries[1]}, Failed(entries))
+
+	_, err = Read(strings.NewReader(session + "{\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4")
+}
+
+// TestWriteMarkdown tests that each command is written as a section with its status and outputs in code blocks, after
+// the context of the run
+func TestWriteMarkdown(t *testing.T) {
+	entries, err := Read(strings.NewReader(session))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, WriteMarkdown(&buf, entries))
+	doc := buf.String()
+	assert.Contains(t, doc, "# Session of 10.0.0.1\n\n2 commands, 1 failed, from 2020-05-04T10:00:00Z to "+
+		"2020-05-04T10:00:02Z.\n\nRun context: run=1234,build=2019.\n")
+	assert.Contains(t, doc, "## 1. WinRM `Get-Service kubelet...`\n")
+	assert.Contains(t, doc, "- Duration: 1.5s\n- Status: exit code 0\n\n```powershell\nGet-Service kubelet\n"+
+		"Get-Service docker\n```\n\nstdout:\n\n```\nRunning kubelet\n```\n")
+	assert.Contains(t, doc, "- Status: **exit code 1**\n- The command or its outputs are truncated\n")
+	// The fence of an output holding backticks is longer than them
+	assert.Contains(t, doc, "stderr:\n\n````\n```not found```\n````\n")
+}
+
+// TestPlay tests that the commands are written one at a time until the input is closed or q is entered
+func TestPlay(t *testing.T) {
+	entries, err := Read(strings.NewReader(session))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Play(strings.NewReader("\n"), &buf, entries))
+	out := buf.String()
+	assert.Contains(t, out, "[1] 10:00:00.000 WinRM on 10.0.0.1, 1.5s, exit code 0\n> Get-Service kubelet")
+	assert.Contains(t, out, "-- 1/2, press Enter")
+	assert.Contains(t, out, "[2] 10:00:02.000 ssh on 10.0.0.1, 250ms, exit code 1\n")
+	assert.Contains(t, out, "-- end of the session, 2 commands, 1 failed\n")
+
+	buf.Reset()
+	require.NoError(t, Play(strings.NewReader("q\n"), &buf, entries))
+	assert.NotContains(t, buf.String(), "[2]")
+
+	buf.Reset()
+	require.NoError(t, Play(nil, &buf, entries))
+	assert.Contains(t, buf.String(), "[2]")
+	assert.NotContains(t, buf.String(), "press Enter")
+}
@@ -0,0 +1,99 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// debugAccessFileName is the file name of the debug access records. It is stored next to the installer info file.
+const debugAccessFileName = "windows-node-installer-debug-access.json"
+
+// DebugAccess records debug access opened to an instance, so that it can be revoked later
+type DebugAccess struct {
+	// InstanceID is the ID of the instance the access was opened to
+	InstanceID string `json:"InstanceID"`
+	// CIDR is the address range the access was opened to
+	CIDR string `json:"CIDR"`
+	// Port is the port the access was opened on
+	Port int64 `json:"Port"`
+	// SecurityGroupID is the security group the ingress rule was added to. It is empty if an identical rule not added
+	// by WNI already existed, in which case it is not revoked. The rule is shared by the records of the same security
+	// group and CIDR, and only revoked with the last of them.
+	SecurityGroupID string `json:"SecurityGroupID,omitempty"`
+	// FirewallRuleName is the name of the firewall rule created on the instance
+	FirewallRuleName string `json:"FirewallRuleName"`
+	// Opened is the time the access was opened
+	Opened time.Time `json:"Opened"`
+}
+
+// DebugAccessFilePath returns the path of the debug access records for the given installer info file path
+func DebugAccessFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), debugAccessFileName)
+}
+
+// ReadDebugAccess reads the debug access records from the given file. No records are returned if the file does not
+// exist.
+func ReadDebugAccess(filePath string) ([]DebugAccess, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseDebugAccess(filePath, content)
+}
+
+// parseDebugAccess parses the content of the given debug access file, nil if it does not exist
+func parseDebugAccess(filePath string, content []byte) ([]DebugAccess, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var records []DebugAccess
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return records, nil
+}
+
+// AppendDebugAccess adds the debug access record to the given file. Only one record is allowed per instance and CIDR.
+func AppendDebugAccess(access DebugAccess, filePath string) error {
+	return updateDebugAccess(filePath, func(records []DebugAccess) ([]DebugAccess, error) {
+		for _, record := range records {
+			if record.InstanceID == access.InstanceID && record.CIDR == access.CIDR {
+				return nil, fmt.Errorf("debug access to %s from %s already exists", access.InstanceID, access.CIDR)
+			}
+		}
+		return append(records, access), nil
+	})
+}
+
+// RemoveDebugAccess removes the debug access record of the same instance and CIDR from the given file. The file is
+// deleted once it has no records left.
+func RemoveDebugAccess(access DebugAccess, filePath string) error {
+	return updateDebugAccess(filePath, func(records []DebugAccess) ([]DebugAccess, error) {
+		for i, record := range records {
+			if record.InstanceID == access.InstanceID && record.CIDR == access.CIDR {
+				return append(records[:i], records[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("debug access to %s from %s is not found", access.InstanceID, access.CIDR)
+	})
+}
+
+// updateDebugAccess replaces the records of the given file by the ones returned by update under a lock, deleting the
+// file if there are no records
+func updateDebugAccess(filePath string, update func([]DebugAccess) ([]DebugAccess, error)) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		records, err := parseDebugAccess(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if records, err = update(records); err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(records)
+	})
+}
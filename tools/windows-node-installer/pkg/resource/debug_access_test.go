@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDebugAccess appends and removes debug access records and checks that the file is cleaned up once it is empty
+func TestDebugAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	filePath := DebugAccessFilePath(filepath.Join(dir, installerInfoFileName))
+	assert.Equal(t, filepath.Join(dir, debugAccessFileName), filePath)
+
+	records, err := ReadDebugAccess(filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Empty(t, records)
+
+	first := DebugAccess{InstanceID: "i-1234567890", CIDR: "10.0.0.0/16", Port: 3389, SecurityGroupID: "sg-1234567890",
+		FirewallRuleName: "wni-debug-rdp", Opened: time.Now().UTC().Truncate(time.Second)}
+	second := DebugAccess{InstanceID: "i-1234567890", CIDR: "192.168.1.1/32", Port: 3389,
+		FirewallRuleName: "wni-debug-rdp", Opened: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, AppendDebugAccess(first, filePath))
+	require.NoError(t, AppendDebugAccess(second, filePath))
+	assert.Error(t, AppendDebugAccess(first, filePath), "duplicate debug access should not be recorded")
+
+	records, err = ReadDebugAccess(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []DebugAccess{first, second}, records)
+
+	require.NoError(t, RemoveDebugAccess(first, filePath))
+	assert.Error(t, RemoveDebugAccess(first, filePath), "removing a missing record should return an error")
+	records, err = ReadDebugAccess(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []DebugAccess{second}, records)
+
+	require.NoError(t, RemoveDebugAccess(second, filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "empty debug access file was not deleted")
+}
@@ -0,0 +1,109 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// dnsRecordFileName is the file name of the DNS records registered for the instances. It is stored next to the
+// installer info file.
+const dnsRecordFileName = "windows-node-installer-dns.json"
+
+// DNSRecord records the DNS record registered for an instance in the private zone of the cluster, so that it can be
+// removed along with the instance
+type DNSRecord struct {
+	// InstanceID is the ID of the instance the record points to
+	InstanceID string `json:"InstanceID"`
+	// Name is the fully qualified name of the record
+	Name string `json:"Name"`
+	// ZoneID is the ID of the private zone the record is in
+	ZoneID string `json:"ZoneID"`
+	// IPAddress is the address the record resolves to
+	IPAddress string `json:"IPAddress"`
+	// TTL is the time to live of the record in seconds
+	TTL int64 `json:"TTL"`
+}
+
+// DNSRecordFilePath returns the path of the DNS records for the given installer info file path
+func DNSRecordFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), dnsRecordFileName)
+}
+
+// ReadDNSRecords reads the DNS records from the given file. No records are returned if the file does not exist.
+func ReadDNSRecords(filePath string) ([]DNSRecord, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSRecords(filePath, content)
+}
+
+// parseDNSRecords parses the content of the given DNS record file, nil if it does not exist
+func parseDNSRecords(filePath string, content []byte) ([]DNSRecord, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var records []DNSRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return records, nil
+}
+
+// FindDNSRecord returns the DNS record of the given instance from the given file, or nil if the instance has none
+func FindDNSRecord(instanceID, filePath string) (*DNSRecord, error) {
+	records, err := ReadDNSRecords(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.InstanceID == instanceID {
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+// AppendDNSRecord adds the DNS record to the given file. Only one record is allowed per instance.
+func AppendDNSRecord(record DNSRecord, filePath string) error {
+	return updateDNSRecords(filePath, func(records []DNSRecord) ([]DNSRecord, error) {
+		for _, existing := range records {
+			if existing.InstanceID == record.InstanceID {
+				return nil, fmt.Errorf("DNS record of %s already exists", record.InstanceID)
+			}
+		}
+		return append(records, record), nil
+	})
+}
+
+// RemoveDNSRecord removes the DNS record of the given instance from the given file. The file is deleted once it has
+// no records left.
+func RemoveDNSRecord(instanceID, filePath string) error {
+	return updateDNSRecords(filePath, func(records []DNSRecord) ([]DNSRecord, error) {
+		for i, record := range records {
+			if record.InstanceID == instanceID {
+				return append(records[:i], records[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("DNS record of %s is not found", instanceID)
+	})
+}
+
+// updateDNSRecords replaces the records of the given file by the ones returned by update under a lock, deleting the
+// file if there are no records
+func updateDNSRecords(filePath string, update func([]DNSRecord) ([]DNSRecord, error)) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		records, err := parseDNSRecords(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if records, err = update(records); err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(records)
+	})
+}
@@ -0,0 +1,47 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDNSRecords appends, finds and removes DNS records and checks that the file is cleaned up once it is empty
+func TestDNSRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	filePath := DNSRecordFilePath(filepath.Join(dir, installerInfoFileName))
+	assert.Equal(t, filepath.Join(dir, dnsRecordFileName), filePath)
+
+	record, err := FindDNSRecord("i-1234567890", filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Nil(t, record)
+
+	first := DNSRecord{InstanceID: "i-1234567890", Name: "winworker-abcd.cluster.example.com",
+		ZoneID: "Z0123456789", IPAddress: "10.0.1.2", TTL: 60}
+	second := DNSRecord{InstanceID: "i-0987654321", Name: "winworker-efgh.cluster.example.com",
+		ZoneID: "Z0123456789", IPAddress: "10.0.1.3", TTL: 60}
+	require.NoError(t, AppendDNSRecord(first, filePath))
+	require.NoError(t, AppendDNSRecord(second, filePath))
+	assert.Error(t, AppendDNSRecord(first, filePath), "a second record of an instance should not be recorded")
+
+	record, err = FindDNSRecord(second.InstanceID, filePath)
+	require.NoError(t, err)
+	assert.Equal(t, &second, record)
+
+	require.NoError(t, RemoveDNSRecord(first.InstanceID, filePath))
+	assert.Error(t, RemoveDNSRecord(first.InstanceID, filePath), "removing a missing record should return an error")
+	records, err := ReadDNSRecords(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []DNSRecord{second}, records)
+
+	require.NoError(t, RemoveDNSRecord(second.InstanceID, filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "empty DNS record file was not deleted")
+}
@@ -0,0 +1,80 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// keyPairFileName is the file name of the key pair generated for the instances. It is stored next to the installer
+// info file.
+const keyPairFileName = "windows-node-installer-key-pair.json"
+
+// KeyPair records the key pair generated for the instances created in a resource tracker directory, so that the other
+// commands can use its private key and it can be deleted along with the instances
+type KeyPair struct {
+	// Name is the name of the key pair on the cloud provider
+	Name string `json:"Name"`
+	// PrivateKeyFile is the name of the file holding the encrypted private key, next to the installer info file
+	PrivateKeyFile string `json:"PrivateKeyFile"`
+	// Created is the time the key pair was generated
+	Created time.Time `json:"Created"`
+}
+
+// KeyPairFilePath returns the path of the key pair record for the given installer info file path
+func KeyPairFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), keyPairFileName)
+}
+
+// PrivateKeyFilePath returns the path of the private key file with the given name for the given installer info file
+// path
+func PrivateKeyFilePath(installerInfoFilePath, privateKeyFile string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), privateKeyFile)
+}
+
+// ReadKeyPair reads the key pair record from the given file, or returns nil if no key pair was generated
+func ReadKeyPair(filePath string) (*KeyPair, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyPair(filePath, content)
+}
+
+// parseKeyPair parses the content of the given key pair file, nil if it does not exist
+func parseKeyPair(filePath string, content []byte) (*KeyPair, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var keyPair KeyPair
+	if err := json.Unmarshal(content, &keyPair); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return &keyPair, nil
+}
+
+// StoreKeyPair records the key pair in the given file. Only one key pair is recorded per resource tracker directory,
+// an error is returned if another process already recorded one.
+func StoreKeyPair(keyPair KeyPair, filePath string) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		existing, err := parseKeyPair(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("key pair %s is already recorded in %s", existing.Name, filePath)
+		}
+		return json.Marshal(keyPair)
+	})
+}
+
+// RemoveKeyPair deletes the given key pair record file
+func RemoveKeyPair(filePath string) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		if content == nil {
+			return nil, fmt.Errorf("no key pair is recorded in %s", filePath)
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,44 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyPair stores, reads and removes the key pair record and checks that only one key pair is recorded
+func TestKeyPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	installerInfoFilePath := filepath.Join(dir, installerInfoFileName)
+	filePath := KeyPairFilePath(installerInfoFilePath)
+	assert.Equal(t, filepath.Join(dir, keyPairFileName), filePath)
+	assert.Equal(t, filepath.Join(dir, "mycluster-wni-abcde.pem"),
+		PrivateKeyFilePath(installerInfoFilePath, "mycluster-wni-abcde.pem"))
+
+	keyPair, err := ReadKeyPair(filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Nil(t, keyPair)
+	assert.Error(t, RemoveKeyPair(filePath), "removing a missing key pair should return an error")
+
+	generated := KeyPair{Name: "mycluster-wni-abcde", PrivateKeyFile: "mycluster-wni-abcde.pem",
+		Created: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)}
+	require.NoError(t, StoreKeyPair(generated, filePath))
+	assert.Error(t, StoreKeyPair(KeyPair{Name: "mycluster-wni-fghij"}, filePath),
+		"a second key pair should not be recorded")
+
+	keyPair, err = ReadKeyPair(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, &generated, keyPair)
+
+	require.NoError(t, RemoveKeyPair(filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "key pair file was not deleted")
+}
@@ -0,0 +1,146 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/clock"
+)
+
+const (
+	// lockFileSuffix is the suffix of the lock file guarding a state file. The lock file is never deleted, as deleting
+	// it would let two processes lock different files.
+	lockFileSuffix = ".lock"
+	// lockRetryInterval is the interval between two attempts at locking a state file
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// lockTimeout is how long to wait for a state file locked by another process
+var lockTimeout = 2 * time.Minute
+
+// clk is the clock the waits for the locks take the time from, faked in the unit tests
+var clk = clock.Real
+
+// ConflictError is returned when a state file was modified while it was locked, by a process not using the lock
+// like an older installer, so that its change is not overwritten
+type ConflictError struct {
+	// FilePath is the path of the state file
+	FilePath string
+}
+
+// Error returns the description of the conflict
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was modified by another process, retry the operation", e.FilePath)
+}
+
+// updateFile updates the given state file while holding an exclusive lock on it, so that processes sharing the
+// resource tracker directory, like parallel CI steps, do not lose each other's changes. update is given the current
+// content of the file, nil if it does not exist, and returns the new content, nil to delete the file. The new content
+// is written to a temporary file renamed over the state file, so that readers never see a partially written file.
+func updateFile(filePath string, update func(content []byte) ([]byte, error)) error {
+	unlock, err := lockFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := readFile(filePath)
+	if err != nil {
+		return err
+	}
+	newContent, err := update(content)
+	if err != nil {
+		return err
+	}
+
+	// The lock is advisory, so the file is checked for changes made without it before being replaced
+	current, err := readFile(filePath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(content, current) || (content == nil) != (current == nil) {
+		return &ConflictError{FilePath: filePath}
+	}
+
+	if newContent == nil {
+		if err = os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(filePath, newContent)
+}
+
+// lockFile takes an exclusive lock on the lock file of the given state file, waiting up to lockTimeout for other
+// processes to release it, and returns the function releasing it
+func lockFile(filePath string) (func(), error) {
+	lockPath := filePath + lockFileSuffix
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %v", lockPath, err)
+	}
+	options := poll.Options{Interval: lockRetryInterval, Timeout: lockTimeout, Jitter: poll.DefaultJitter, Clock: clk}
+	err = poll.Until(context.Background(), "the lock on "+lockPath, options, func() (bool, string, error) {
+		locked, err := tryLock(file)
+		if err != nil {
+			return false, "", fmt.Errorf("error locking %s: %v", lockPath, err)
+		}
+		return locked, "held by another process", nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Closing the file releases the lock
+	return func() { file.Close() }, nil
+}
+
+// readFile returns the content of the given file, or nil if it does not exist
+func readFile(filePath string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	return content, nil
+}
+
+// writeFileAtomic writes the content to a temporary file in the directory of the given file and renames it over the
+// file, with permission read and write for the owner and read for all other users
+func writeFileAtomic(filePath string, content []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err = tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("error writing %s: %v", tmpPath, err)
+	}
+	if err = tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("error writing %s: %v", tmpPath, err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", tmpPath, err)
+	}
+	if err = os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("error replacing %s: %v", filePath, err)
+	}
+	return nil
+}
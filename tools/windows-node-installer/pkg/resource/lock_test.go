@@ -0,0 +1,99 @@
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentUpdates appends instances and DNS records from concurrent writers and checks that none is lost
+func TestConcurrentUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, installerInfoFileName)
+	dnsFilePath := DNSRecordFilePath(filePath)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			instanceID := fmt.Sprintf("i-%02d", i)
+			errs <- AppendInstallerInfo([]string{instanceID}, []string{fmt.Sprintf("sg-%02d", i)}, filePath)
+			errs <- AppendDNSRecord(DNSRecord{InstanceID: instanceID}, dnsFilePath)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	info, err := ReadInstallerInfo(filePath)
+	require.NoError(t, err)
+	assert.Len(t, info.InstanceIDs, writers)
+	assert.Len(t, info.SecurityGroupIDs, writers)
+	records, err := ReadDNSRecords(dnsFilePath)
+	require.NoError(t, err)
+	assert.Len(t, records, writers)
+
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmpFiles, "temporary files were left behind")
+}
+
+// TestUpdateFileConflict checks that a change made to the state file without the lock is not overwritten
+func TestUpdateFileConflict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, installerInfoFileName)
+	require.NoError(t, AppendInstallerInfo([]string{"i-1234567890"}, nil, filePath))
+
+	err = updateFile(filePath, func(content []byte) ([]byte, error) {
+		// An older installer rewrites the file while it is locked
+		require.NoError(t, ioutil.WriteFile(filePath, []byte(`{"InstanceIDs":["i-0987654321"]}`), 0644))
+		return content, nil
+	})
+	require.Error(t, err)
+	assert.IsType(t, &ConflictError{}, err)
+	info, err := ReadInstallerInfo(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"i-0987654321"}, info.InstanceIDs)
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("{"), 0644))
+	assert.Error(t, AppendInstallerInfo([]string{"i-1234567890"}, nil, filePath),
+		"a corrupted file should not be overwritten")
+}
+
+// TestLockTimeout checks that an update gives up once the lock has been held by another writer for too long
+func TestLockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, installerInfoFileName)
+
+	defer func(c clock.Clock) { clk = c }(clk)
+	fake := clock.NewFake(time.Now())
+	clk = fake
+	unlock, err := lockFile(filePath)
+	require.NoError(t, err)
+	err = AppendInstallerInfo([]string{"i-1234567890"}, nil, filePath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, fake.Slept() >= lockTimeout, "gave up after %v", fake.Slept())
+
+	unlock()
+	assert.NoError(t, AppendInstallerInfo([]string{"i-1234567890"}, nil, filePath))
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package resource
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive lock on the given file without waiting, and returns false if another process holds it
+func tryLock(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,33 @@
+package resource
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// lockfileFailImmediately makes LockFileEx return instead of waiting for the lock
+	lockfileFailImmediately = 0x1
+	// lockfileExclusiveLock makes LockFileEx take an exclusive lock
+	lockfileExclusiveLock = 0x2
+	// errorLockViolation is the error returned by LockFileEx when another process holds the lock
+	errorLockViolation syscall.Errno = 33
+)
+
+// procLockFileEx is the LockFileEx function of kernel32.dll
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// tryLock takes an exclusive lock on the given file without waiting, and returns false if another process holds it
+func tryLock(file *os.File) (bool, error) {
+	var overlapped syscall.Overlapped
+	ret, _, err := procLockFileEx.Call(file.Fd(), lockfileFailImmediately|lockfileExclusiveLock, 0, 1, 0,
+		uintptr(unsafe.Pointer(&overlapped)))
+	if ret != 0 {
+		return true, nil
+	}
+	if err == errorLockViolation {
+		return false, nil
+	}
+	return false, err
+}
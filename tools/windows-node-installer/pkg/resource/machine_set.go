@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// machineSetFileName is the file name of the machine sets created in the cluster for the instances. It is stored next
+// to the installer info file.
+const machineSetFileName = "windows-node-installer-machinesets.json"
+
+// MachineSet records a machine set created in the cluster along with the secret holding the user data of its
+// machines, so that they can be deleted along with the instances the machine API provisioned for them
+type MachineSet struct {
+	// Name is the name of the machine set
+	Name string `json:"Name"`
+	// Namespace is the namespace of the machine set and of its user data secret
+	Namespace string `json:"Namespace"`
+	// UserDataSecret is the name of the secret holding the user data and the credentials of the machines
+	UserDataSecret string `json:"UserDataSecret"`
+	// InstanceID is the ID of the instance provisioned for the machine of the machine set, empty until it is known
+	InstanceID string `json:"InstanceID,omitempty"`
+}
+
+// MachineSetFilePath returns the path of the machine set records for the given installer info file path
+func MachineSetFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), machineSetFileName)
+}
+
+// ReadMachineSets reads the machine set records from the given file. No records are returned if the file does not
+// exist.
+func ReadMachineSets(filePath string) ([]MachineSet, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseMachineSets(filePath, content)
+}
+
+// parseMachineSets parses the content of the given machine set file, nil if it does not exist
+func parseMachineSets(filePath string, content []byte) ([]MachineSet, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var machineSets []MachineSet
+	if err := json.Unmarshal(content, &machineSets); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return machineSets, nil
+}
+
+// AppendMachineSet adds the machine set to the given file, or updates it if it is already recorded, e.g. once the
+// instance of its machine is known
+func AppendMachineSet(machineSet MachineSet, filePath string) error {
+	return updateMachineSets(filePath, func(machineSets []MachineSet) ([]MachineSet, error) {
+		for i, existing := range machineSets {
+			if existing.Namespace == machineSet.Namespace && existing.Name == machineSet.Name {
+				machineSets[i] = machineSet
+				return machineSets, nil
+			}
+		}
+		return append(machineSets, machineSet), nil
+	})
+}
+
+// RemoveMachineSet removes the machine set of the given namespace and name from the given file. The file is deleted
+// once it has no machine sets left.
+func RemoveMachineSet(namespace, name, filePath string) error {
+	return updateMachineSets(filePath, func(machineSets []MachineSet) ([]MachineSet, error) {
+		for i, machineSet := range machineSets {
+			if machineSet.Namespace == namespace && machineSet.Name == name {
+				return append(machineSets[:i], machineSets[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("machine set %s/%s is not found", namespace, name)
+	})
+}
+
+// updateMachineSets replaces the machine sets of the given file by the ones returned by update under a lock, deleting
+// the file if there are no machine sets
+func updateMachineSets(filePath string, update func([]MachineSet) ([]MachineSet, error)) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		machineSets, err := parseMachineSets(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if machineSets, err = update(machineSets); err != nil {
+			return nil, err
+		}
+		if len(machineSets) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(machineSets)
+	})
+}
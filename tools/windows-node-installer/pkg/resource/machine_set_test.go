@@ -0,0 +1,46 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMachineSets appends, updates and removes machine set records and checks that the file is cleaned up once it is
+// empty
+func TestMachineSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	filePath := MachineSetFilePath(filepath.Join(dir, installerInfoFileName))
+	assert.Equal(t, filepath.Join(dir, machineSetFileName), filePath)
+
+	machineSets, err := ReadMachineSets(filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Empty(t, machineSets)
+
+	first := MachineSet{Name: "cluster-x7k2p-windows-abcde", Namespace: "openshift-machine-api",
+		UserDataSecret: "cluster-x7k2p-windows-abcde-user-data"}
+	second := MachineSet{Name: "cluster-x7k2p-windows-fghij", Namespace: "openshift-machine-api",
+		UserDataSecret: "cluster-x7k2p-windows-fghij-user-data"}
+	require.NoError(t, AppendMachineSet(first, filePath))
+	require.NoError(t, AppendMachineSet(second, filePath))
+	first.InstanceID = "i-0123456789abcdef0"
+	require.NoError(t, AppendMachineSet(first, filePath), "a recorded machine set should be updated")
+
+	machineSets, err = ReadMachineSets(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []MachineSet{first, second}, machineSets)
+
+	require.NoError(t, RemoveMachineSet(first.Namespace, first.Name, filePath))
+	assert.Error(t, RemoveMachineSet(first.Namespace, first.Name, filePath),
+		"removing a missing machine set should return an error")
+	require.NoError(t, RemoveMachineSet(second.Namespace, second.Name, filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "empty machine set file was not deleted")
+}
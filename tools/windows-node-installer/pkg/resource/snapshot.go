@@ -0,0 +1,116 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// snapshotFileName is the file name of the snapshots of the instances. It is stored next to the installer info file.
+const snapshotFileName = "windows-node-installer-snapshots.json"
+
+// Snapshot records the snapshots of the volumes of an instance, so that the instance can be restored to them and they
+// can be deleted along with the instance
+type Snapshot struct {
+	// InstanceID is the ID of the instance the snapshot was taken of
+	InstanceID string `json:"InstanceID"`
+	// Name is the name of the snapshot, unique per instance
+	Name string `json:"Name"`
+	// Volumes are the snapshots of the volumes of the instance
+	Volumes []VolumeSnapshot `json:"Volumes"`
+	// Created is the time the snapshot was taken
+	Created time.Time `json:"Created"`
+}
+
+// VolumeSnapshot records the snapshot of a volume of an instance
+type VolumeSnapshot struct {
+	// Device is the device name the volume is attached to the instance as, e.g. /dev/sda1
+	Device string `json:"Device"`
+	// SnapshotID is the ID of the snapshot of the volume
+	SnapshotID string `json:"SnapshotID"`
+}
+
+// SnapshotFilePath returns the path of the snapshot records for the given installer info file path
+func SnapshotFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), snapshotFileName)
+}
+
+// ReadSnapshots reads the snapshot records from the given file. No records are returned if the file does not exist.
+func ReadSnapshots(filePath string) ([]Snapshot, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshots(filePath, content)
+}
+
+// parseSnapshots parses the content of the given snapshot file, nil if it does not exist
+func parseSnapshots(filePath string, content []byte) ([]Snapshot, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var snapshots []Snapshot
+	if err := json.Unmarshal(content, &snapshots); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return snapshots, nil
+}
+
+// FindSnapshot returns the snapshot of the given instance with the given name from the given file, or nil if there
+// is none
+func FindSnapshot(instanceID, name, filePath string) (*Snapshot, error) {
+	snapshots, err := ReadSnapshots(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.InstanceID == instanceID && snapshot.Name == name {
+			return &snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// AppendSnapshot adds the snapshot to the given file. The names of the snapshots of an instance are unique.
+func AppendSnapshot(snapshot Snapshot, filePath string) error {
+	return updateSnapshots(filePath, func(snapshots []Snapshot) ([]Snapshot, error) {
+		for _, existing := range snapshots {
+			if existing.InstanceID == snapshot.InstanceID && existing.Name == snapshot.Name {
+				return nil, fmt.Errorf("snapshot %s of %s already exists", snapshot.Name, snapshot.InstanceID)
+			}
+		}
+		return append(snapshots, snapshot), nil
+	})
+}
+
+// RemoveSnapshot removes the snapshot of the given instance with the given name from the given file. The file is
+// deleted once it has no snapshots left.
+func RemoveSnapshot(instanceID, name, filePath string) error {
+	return updateSnapshots(filePath, func(snapshots []Snapshot) ([]Snapshot, error) {
+		for i, snapshot := range snapshots {
+			if snapshot.InstanceID == instanceID && snapshot.Name == name {
+				return append(snapshots[:i], snapshots[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("snapshot %s of %s is not found", name, instanceID)
+	})
+}
+
+// updateSnapshots replaces the snapshots of the given file by the ones returned by update under a lock, deleting the
+// file if there are no snapshots
+func updateSnapshots(filePath string, update func([]Snapshot) ([]Snapshot, error)) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		snapshots, err := parseSnapshots(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if snapshots, err = update(snapshots); err != nil {
+			return nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(snapshots)
+	})
+}
@@ -0,0 +1,54 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshots appends, finds and removes snapshots and checks that the file is cleaned up once it is empty
+func TestSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	filePath := SnapshotFilePath(filepath.Join(dir, installerInfoFileName))
+	assert.Equal(t, filepath.Join(dir, snapshotFileName), filePath)
+
+	snapshot, err := FindSnapshot("i-1234567890", "configured", filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Nil(t, snapshot)
+
+	created := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	first := Snapshot{InstanceID: "i-1234567890", Name: "configured", Created: created,
+		Volumes: []VolumeSnapshot{{Device: "/dev/sda1", SnapshotID: "snap-0123456789abcdef0"}}}
+	// The same name can be used for the snapshots of other instances
+	second := Snapshot{InstanceID: "i-0987654321", Name: "configured", Created: created,
+		Volumes: []VolumeSnapshot{{Device: "/dev/sda1", SnapshotID: "snap-0fedcba9876543210"}}}
+	require.NoError(t, AppendSnapshot(first, filePath))
+	require.NoError(t, AppendSnapshot(second, filePath))
+	assert.Error(t, AppendSnapshot(first, filePath), "a second snapshot with the same name should not be recorded")
+
+	snapshot, err = FindSnapshot(second.InstanceID, second.Name, filePath)
+	require.NoError(t, err)
+	assert.Equal(t, &second, snapshot)
+	snapshot, err = FindSnapshot(second.InstanceID, "bootstrapped", filePath)
+	require.NoError(t, err)
+	assert.Nil(t, snapshot)
+
+	require.NoError(t, RemoveSnapshot(first.InstanceID, first.Name, filePath))
+	assert.Error(t, RemoveSnapshot(first.InstanceID, first.Name, filePath),
+		"removing a missing snapshot should return an error")
+	snapshots, err := ReadSnapshots(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []Snapshot{second}, snapshots)
+
+	require.NoError(t, RemoveSnapshot(second.InstanceID, second.Name, filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "empty snapshot file was not deleted")
+}
@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// targetRegistrationFileName is the file name of the registrations of the instances with load balancer target groups.
+// It is stored next to the installer info file.
+const targetRegistrationFileName = "windows-node-installer-targets.json"
+
+// TargetRegistration records the registration of an instance with a load balancer target group, so that it can be
+// deregistered along with the instance
+type TargetRegistration struct {
+	// InstanceID is the ID of the registered instance
+	InstanceID string `json:"InstanceID"`
+	// TargetGroupARN is the ARN of the target group the instance is registered with
+	TargetGroupARN string `json:"TargetGroupARN"`
+	// TargetID is the ID the instance is registered with, its instance ID or its private IP depending on the target
+	// type of the group
+	TargetID string `json:"TargetID"`
+}
+
+// TargetRegistrationFilePath returns the path of the target registrations for the given installer info file path
+func TargetRegistrationFilePath(installerInfoFilePath string) string {
+	return filepath.Join(filepath.Dir(installerInfoFilePath), targetRegistrationFileName)
+}
+
+// ReadTargetRegistrations reads the target registrations from the given file. No registrations are returned if the
+// file does not exist.
+func ReadTargetRegistrations(filePath string) ([]TargetRegistration, error) {
+	content, err := readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseTargetRegistrations(filePath, content)
+}
+
+// parseTargetRegistrations parses the content of the given target registration file, nil if it does not exist
+func parseTargetRegistrations(filePath string, content []byte) ([]TargetRegistration, error) {
+	if content == nil {
+		return nil, nil
+	}
+	var registrations []TargetRegistration
+	if err := json.Unmarshal(content, &registrations); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
+	}
+	return registrations, nil
+}
+
+// AppendTargetRegistration adds the target registration to the given file. An instance is registered once per target
+// group.
+func AppendTargetRegistration(registration TargetRegistration, filePath string) error {
+	return updateTargetRegistrations(filePath, func(registrations []TargetRegistration) ([]TargetRegistration, error) {
+		for _, existing := range registrations {
+			if existing.InstanceID == registration.InstanceID &&
+				existing.TargetGroupARN == registration.TargetGroupARN {
+				return nil, fmt.Errorf("registration of %s with %s already exists", registration.InstanceID,
+					registration.TargetGroupARN)
+			}
+		}
+		return append(registrations, registration), nil
+	})
+}
+
+// RemoveTargetRegistration removes the registration of the given instance with the given target group from the given
+// file. The file is deleted once it has no registrations left.
+func RemoveTargetRegistration(instanceID, targetGroupARN, filePath string) error {
+	return updateTargetRegistrations(filePath, func(registrations []TargetRegistration) ([]TargetRegistration, error) {
+		for i, registration := range registrations {
+			if registration.InstanceID == instanceID && registration.TargetGroupARN == targetGroupARN {
+				return append(registrations[:i], registrations[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("registration of %s with %s is not found", instanceID, targetGroupARN)
+	})
+}
+
+// updateTargetRegistrations replaces the registrations of the given file by the ones returned by update under a lock,
+// deleting the file if there are no registrations
+func updateTargetRegistrations(filePath string,
+	update func([]TargetRegistration) ([]TargetRegistration, error)) error {
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		registrations, err := parseTargetRegistrations(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		if registrations, err = update(registrations); err != nil {
+			return nil, err
+		}
+		if len(registrations) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(registrations)
+	})
+}
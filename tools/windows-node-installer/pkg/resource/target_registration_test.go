@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTargetRegistrations appends and removes target registrations and checks that the file is cleaned up once it is
+// empty
+func TestTargetRegistrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wni")
+	require.NoError(t, err, "error making temp directory")
+	defer os.RemoveAll(dir)
+
+	filePath := TargetRegistrationFilePath(filepath.Join(dir, installerInfoFileName))
+	assert.Equal(t, filepath.Join(dir, targetRegistrationFileName), filePath)
+
+	registrations, err := ReadTargetRegistrations(filePath)
+	require.NoError(t, err, "missing file should not be an error")
+	assert.Empty(t, registrations)
+
+	web := TargetRegistration{InstanceID: "i-1234567890",
+		TargetGroupARN: "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/web/0123456789abcdef",
+		TargetID:       "i-1234567890"}
+	api := TargetRegistration{InstanceID: "i-1234567890",
+		TargetGroupARN: "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/api/fedcba9876543210",
+		TargetID:       "10.0.1.2"}
+	require.NoError(t, AppendTargetRegistration(web, filePath))
+	require.NoError(t, AppendTargetRegistration(api, filePath), "an instance can be registered with several groups")
+	assert.Error(t, AppendTargetRegistration(web, filePath), "a second registration with a group should not be "+
+		"recorded")
+
+	require.NoError(t, RemoveTargetRegistration(web.InstanceID, web.TargetGroupARN, filePath))
+	assert.Error(t, RemoveTargetRegistration(web.InstanceID, web.TargetGroupARN, filePath),
+		"removing a missing registration should return an error")
+	registrations, err = ReadTargetRegistrations(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []TargetRegistration{api}, registrations)
+
+	require.NoError(t, RemoveTargetRegistration(api.InstanceID, api.TargetGroupARN, filePath))
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "empty target registration file was not deleted")
+}
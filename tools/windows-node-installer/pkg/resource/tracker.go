@@ -21,32 +21,27 @@ type installerInfo struct {
 const installerInfoFileName = "windows-node-installer.json"
 
 // AppendInstallerInfo appends instance id and security group to a json file and return error if file write fails.
+// The file is updated under a lock, so that processes sharing it do not lose each other's changes.
 func AppendInstallerInfo(instanceIDs, sgIDs []string, filePath string) error {
-	info := installerInfo{InstanceIDs: instanceIDs, SecurityGroupIDs: sgIDs}
-
-	pastInfo, err := ReadInstallerInfo(filePath)
-	if err == nil {
-		info.InstanceIDs, err = writeToInfo(pastInfo.InstanceIDs, info.InstanceIDs, true)
-		if err != nil {
-			return err
-		}
-		info.SecurityGroupIDs, err = writeToInfo(pastInfo.SecurityGroupIDs, info.SecurityGroupIDs, true)
-		if err != nil {
-			return err
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		info := installerInfo{InstanceIDs: instanceIDs, SecurityGroupIDs: sgIDs}
+		// A missing or empty file has no info yet, but a corrupted one is not overwritten
+		if len(content) != 0 {
+			pastInfo, err := parseInstallerInfo(filePath, content)
+			if err != nil {
+				return nil, err
+			}
+			info.InstanceIDs, err = writeToInfo(pastInfo.InstanceIDs, info.InstanceIDs, true)
+			if err != nil {
+				return nil, err
+			}
+			info.SecurityGroupIDs, err = writeToInfo(pastInfo.SecurityGroupIDs, info.SecurityGroupIDs, true)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}
-
-	newInfo, err := json.Marshal(info)
-	if err != nil {
-		return err
-	}
-
-	// Write file with permission read and write for the owner and read for all other users.
-	err = ioutil.WriteFile(filePath, newInfo, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+		return json.Marshal(info)
+	})
 }
 
 // ReadInstallerInfo reads instance id and security group from a json file and return error if file read fails.
@@ -55,48 +50,45 @@ func ReadInstallerInfo(filePath string) (*installerInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseInstallerInfo(filePath, content)
+}
+
+// parseInstallerInfo parses the content of the given installer info file
+func parseInstallerInfo(filePath string, content []byte) (*installerInfo, error) {
 	var info installerInfo
-	err = json.Unmarshal(content, &info)
-	if err != nil {
-		return nil, err
+	if err := json.Unmarshal(content, &info); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filePath, err)
 	}
 	return &info, nil
 }
 
 // RemoveInstallerInfo removes instance id and security group from a json file and return error if removal fails.
+// The file is updated under a lock, so that processes sharing it do not lose each other's changes.
 func RemoveInstallerInfo(instanceIDs, sgIDs []string, filePath string) error {
-	newInfo := installerInfo{InstanceIDs: instanceIDs, SecurityGroupIDs: sgIDs}
-
-	pastInfo, err := ReadInstallerInfo(filePath)
-	if err != nil {
-		return err
-	}
-	newInfo.InstanceIDs, err = writeToInfo(pastInfo.InstanceIDs, newInfo.InstanceIDs, false)
-	if err != nil {
-		return err
-	}
-	newInfo.SecurityGroupIDs, err = writeToInfo(pastInfo.SecurityGroupIDs, newInfo.SecurityGroupIDs, false)
-	if err != nil {
-		return err
-	}
-
-	// Delete file if it is empty.
-	if reflect.DeepEqual(newInfo, installerInfo{[]string{}, []string{}}) {
-		return os.Remove(filePath)
-	}
-
-	// Remove info from existing json file.
-	newMarshalledInfo, err := json.Marshal(&newInfo)
-	if err != nil {
-		return err
-	}
+	return updateFile(filePath, func(content []byte) ([]byte, error) {
+		if content == nil {
+			return nil, &os.PathError{Op: "open", Path: filePath, Err: os.ErrNotExist}
+		}
+		pastInfo, err := parseInstallerInfo(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		newInfo := installerInfo{InstanceIDs: instanceIDs, SecurityGroupIDs: sgIDs}
+		newInfo.InstanceIDs, err = writeToInfo(pastInfo.InstanceIDs, newInfo.InstanceIDs, false)
+		if err != nil {
+			return nil, err
+		}
+		newInfo.SecurityGroupIDs, err = writeToInfo(pastInfo.SecurityGroupIDs, newInfo.SecurityGroupIDs, false)
+		if err != nil {
+			return nil, err
+		}
 
-	// Rewrite the json file
-	err = ioutil.WriteFile(filePath, newMarshalledInfo, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+		// Delete file if it is empty.
+		if reflect.DeepEqual(newInfo, installerInfo{[]string{}, []string{}}) {
+			return nil, nil
+		}
+		return json.Marshal(&newInfo)
+	})
 }
 
 // doesPathExist checks if file or directory path exist and return bool indication or checking error.
@@ -46,6 +46,7 @@ func TestAppendInstallerInfo(t *testing.T) {
 	require.NoError(t, err, "error making temp file in the current folder")
 	filePath := tmpFile.Name()
 	defer os.Remove(filePath)
+	defer os.Remove(filePath + lockFileSuffix)
 
 	for _, info := range infoList {
 		err := AppendInstallerInfo(info.InstanceIDs, info.SecurityGroupIDs, filePath)
@@ -74,6 +75,7 @@ func TestRemoveInstallerInfo(t *testing.T) {
 	tmpFile, err := ioutil.TempFile("."+string(os.PathSeparator), "*.json")
 	require.NoError(t, err, "error making temp file in the current folder")
 	filePath := tmpFile.Name()
+	defer os.Remove(filePath + lockFileSuffix)
 
 	expectedInfoByte, err := json.Marshal(expectedInfo)
 	assert.NoError(t, err)
@@ -0,0 +1,80 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+	"github.com/openshift/windows-machine-config-bootstrapper/tools/windows-node-installer/pkg/clock"
+)
+
+const (
+	// ComputerNamePrivateDNS names the instances after the host part of their private DNS name, e.g.
+	// ip-10-0-1-23, which is the node name the kubelet registers with when it uses the AWS cloud provider
+	ComputerNamePrivateDNS = "private-dns"
+	// maxNetBIOSNameLength is the length the NetBIOS name of a Windows computer is truncated to
+	maxNetBIOSNameLength = 15
+	// computerNameRetryInterval is the time between two checks of the computer name while the instance reboots
+	computerNameRetryInterval = 10 * time.Second
+)
+
+// computerNameRegex matches a valid DNS host name label, which the computer name is used as
+// clk is the clock the waits for the Windows VMs take the time from, faked in the unit tests
+var clk = clock.Real
+
+var computerNameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateComputerName returns an error if the given computer name cannot be set on a Windows instance. Names
+// longer than 15 characters are valid host names, but their NetBIOS name is truncated.
+func ValidateComputerName(name string) error {
+	if name == ComputerNamePrivateDNS {
+		return nil
+	}
+	if !computerNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid computer name %q, it must be 1 to 63 letters, digits or hyphens and cannot start "+
+			"or end with a hyphen", name)
+	}
+	if strings.Trim(name, "0123456789") == "" {
+		return fmt.Errorf("invalid computer name %q, it cannot be only digits", name)
+	}
+	if len(name) > maxNetBIOSNameLength {
+		log.Printf("computer name %s is longer than %d characters, its NetBIOS name is truncated", name,
+			maxNetBIOSNameLength)
+	}
+	return nil
+}
+
+// RenameComputerScript returns the PowerShell script renaming the computer to the name the given PowerShell expression
+// evaluates to and restarting it, unless it is already named so. The script can be run on every boot.
+func RenameComputerScript(nameExpression string) string {
+	return `$computerName = ` + nameExpression + `
+        if ([System.Net.Dns]::GetHostName() -ne $computerName) {
+            Rename-Computer -NewName $computerName -Force -Restart
+        }`
+}
+
+// QuotedComputerName returns the given computer name as a PowerShell string, for RenameComputerScript. The name is
+// expected to be valid, so that it needs no escaping.
+func QuotedComputerName(name string) string {
+	return `"` + name + `"`
+}
+
+// WaitForComputerName waits until the Windows VM is named after the given name, tolerating the errors of the reboot
+// following its rename, or returns an error once the timeout expires. The names are compared case insensitively, like
+// Windows does.
+func (w *Windows) WaitForComputerName(name string, timeout time.Duration) error {
+	options := poll.Options{Interval: computerNameRetryInterval, Timeout: timeout, Jitter: poll.DefaultJitter,
+		Clock: clk}
+	return poll.Until(context.Background(), "computer name "+name, options, func() (bool, string, error) {
+		stdout, _, err := w.Run("[System.Net.Dns]::GetHostName()", true)
+		if err != nil {
+			return false, err.Error(), nil
+		}
+		current := strings.TrimSpace(stdout)
+		return strings.EqualFold(current, name), "the computer is named " + current, nil
+	})
+}
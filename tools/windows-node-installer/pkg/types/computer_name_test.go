@@ -0,0 +1,40 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateComputerName tests the validation of the computer names
+func TestValidateComputerName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"winworker-abcd", true},
+		{"ip-10-0-128-123", true},
+		{ComputerNamePrivateDNS, true},
+		{"cluster-x7k2p-windows-worker", true},
+		{"", false},
+		{"-winworker", false},
+		{"winworker-", false},
+		{"win_worker", false},
+		{"win.worker", false},
+		{"12345", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateComputerName(test.name)
+			assert.Equal(t, test.valid, err == nil, "unexpected error %v", err)
+		})
+	}
+}
+
+// TestRenameComputerScript tests that the computer is only renamed if it is named otherwise
+func TestRenameComputerScript(t *testing.T) {
+	script := RenameComputerScript(QuotedComputerName("winworker-abcd"))
+	assert.Contains(t, script, `$computerName = "winworker-abcd"`)
+	assert.Contains(t, script, "if ([System.Net.Dns]::GetHostName() -ne $computerName)")
+	assert.Contains(t, script, "Rename-Computer -NewName $computerName -Force -Restart")
+}
@@ -0,0 +1,48 @@
+package types
+
+import "fmt"
+
+const (
+	// DefaultMetadataHopLimit is the hop limit of the responses of the instance metadata service when it is hardened.
+	// The processes of the host, like the kubelet, are reached with a hop limit of 1, the containers behind the NAT
+	// of their network need 2.
+	DefaultMetadataHopLimit = 2
+	// maxMetadataHopLimit is the largest hop limit of the responses of the instance metadata service
+	maxMetadataHopLimit = 64
+)
+
+// MetadataOptions harden the instance metadata service of the created instances, which hands out the credentials of
+// the instance role to anything able to send it a request. Only AWS supports them: the instance metadata service of
+// Azure has no session tokens nor hop limit, its requests are only authenticated by the Metadata header.
+type MetadataOptions struct {
+	// RequireTokens requires a session token for the requests to the instance metadata service, i.e. IMDSv2 on AWS,
+	// so that the service cannot be reached through a server side request forgery
+	RequireTokens bool
+	// HopLimit is the number of network hops the responses of the instance metadata service can travel, so that the
+	// tokens cannot leave the instance
+	HopLimit int
+}
+
+// NewMetadataOptions returns the metadata options requiring session tokens, or not, with the given hop limit. The hop
+// limit only applies to the responses carrying session tokens, so it can only be given when they are required, and
+// defaults to DefaultMetadataHopLimit if zero.
+func NewMetadataOptions(requireTokens bool, hopLimit int) (*MetadataOptions, error) {
+	if !requireTokens {
+		if hopLimit != 0 {
+			return nil, fmt.Errorf("a metadata hop limit can only be given when session tokens are required")
+		}
+		return &MetadataOptions{}, nil
+	}
+	if hopLimit == 0 {
+		hopLimit = DefaultMetadataHopLimit
+	}
+	if hopLimit < 1 || hopLimit > maxMetadataHopLimit {
+		return nil, fmt.Errorf("invalid metadata hop limit %d, expected 1 to %d", hopLimit, maxMetadataHopLimit)
+	}
+	return &MetadataOptions{RequireTokens: requireTokens, HopLimit: hopLimit}, nil
+}
+
+// IsDefault returns true if the options leave the instance metadata service as configured by the cloud provider
+func (o *MetadataOptions) IsDefault() bool {
+	return o == nil || !o.RequireTokens
+}
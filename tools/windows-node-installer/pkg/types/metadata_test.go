@@ -0,0 +1,35 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewMetadataOptions tests the validation of the hop limit and that the options only change the instance metadata
+// service when tokens are required
+func TestNewMetadataOptions(t *testing.T) {
+	options, err := NewMetadataOptions(false, 0)
+	require.NoError(t, err)
+	assert.True(t, options.IsDefault())
+
+	// The hop limit is ignored by the instance metadata service unless tokens are required
+	_, err = NewMetadataOptions(false, 1)
+	assert.Error(t, err, "no error on a hop limit without required tokens")
+
+	options, err = NewMetadataOptions(true, 1)
+	require.NoError(t, err)
+	assert.False(t, options.IsDefault())
+	assert.Equal(t, &MetadataOptions{RequireTokens: true, HopLimit: 1}, options)
+
+	options, err = NewMetadataOptions(true, 0)
+	require.NoError(t, err)
+	assert.Equal(t, &MetadataOptions{RequireTokens: true, HopLimit: DefaultMetadataHopLimit}, options)
+
+	for _, hopLimit := range []int{-1, 65} {
+		_, err = NewMetadataOptions(true, hopLimit)
+		assert.Error(t, err, hopLimit)
+	}
+	assert.True(t, (*MetadataOptions)(nil).IsDefault())
+}
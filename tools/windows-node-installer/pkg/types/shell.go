@@ -0,0 +1,102 @@
+package types
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// ShellCmd is the command run for interactive shells on the Windows VM
+	ShellCmd = "powershell.exe -NoLogo -ExecutionPolicy Bypass"
+	// shellTerminalType is the terminal type requested for the PTY of interactive shells
+	shellTerminalType = "xterm-256color"
+	// windowSizePollInterval is the interval at which the local terminal is checked for size changes. Polling is used
+	// as there is no portable signal for terminal size changes.
+	windowSizePollInterval = 500 * time.Millisecond
+)
+
+// Shell opens an interactive PowerShell session on the Windows VM over SSH attached to the given input and outputs. If
+// the input is a terminal, it is put in raw mode for the duration of the session and a PTY of the same size is
+// requested, so that line editing, tab completion and key combinations like Ctrl+C are handled by the remote shell.
+// Shell returns once the session ends.
+func (w *Windows) Shell(stdin *os.File, stdout, stderr io.Writer) error {
+	if w.SSHClient == nil {
+		return fmt.Errorf("Shell cannot be called without a ssh client")
+	}
+	session, err := w.SSHClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("error creating ssh session: %v", err)
+	}
+	defer session.Close()
+	return RunShell(session, stdin, stdout, stderr)
+}
+
+// RunShell runs an interactive PowerShell session in the given ssh session attached to the given input and outputs, as
+// Shell does, for the callers managing their own ssh sessions
+func RunShell(session *ssh.Session, stdin *os.File, stdout, stderr io.Writer) error {
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	fd := int(stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			return fmt.Errorf("error getting terminal size: %v", err)
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err = session.RequestPty(shellTerminalType, height, width, modes); err != nil {
+			return fmt.Errorf("error requesting PTY: %v", err)
+		}
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("error putting terminal in raw mode: %v", err)
+		}
+		defer terminal.Restore(fd, state)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go forwardWindowSize(session, fd, width, height, stop)
+	}
+
+	if err := session.Start(ShellCmd); err != nil {
+		return fmt.Errorf("error starting remote shell: %v", err)
+	}
+	if err := session.Wait(); err != nil {
+		// The exit status of the last command run in the shell is not an error of the session
+		if _, ok := err.(*ssh.ExitError); !ok {
+			return fmt.Errorf("remote shell ended with error: %v", err)
+		}
+	}
+	return nil
+}
+
+// forwardWindowSize sends the size of the local terminal to the remote PTY whenever it changes, until stop is closed
+func forwardWindowSize(session *ssh.Session, fd, width, height int, stop <-chan struct{}) {
+	ticker := time.NewTicker(windowSizePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			newWidth, newHeight, err := terminal.GetSize(fd)
+			if err != nil || (newWidth == width && newHeight == height) {
+				continue
+			}
+			width, height = newWidth, newHeight
+			if err = session.WindowChange(height, width); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package types
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Tunnel forwards the connections made to a local port to a port on the Windows VM over ssh, so that services which
+// are not reachable from the local host, like the kubelet on a node with a private IP, can be accessed directly
+type Tunnel struct {
+	// listener accepts the local connections
+	listener net.Listener
+	// client is the ssh connection the connections are forwarded over
+	client Dialer
+	// remoteAddr is the address the connections are forwarded to, as seen from the Windows VM
+	remoteAddr string
+	// mutex guards conns and closed
+	mutex sync.Mutex
+	// conns are the open local and remote connections, closed along with the tunnel
+	conns map[net.Conn]struct{}
+	// closed is set once the tunnel is closed
+	closed bool
+	// wg tracks the goroutines of the tunnel
+	wg sync.WaitGroup
+}
+
+// Dialer opens connections from the Windows VM, like an ssh client
+type Dialer interface {
+	// Dial connects to the given address from the Windows VM
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// NewTunnel listens on the given local port and forwards the connections to the remote address over the ssh
+// connection. A free port is picked if localPort is 0.
+func NewTunnel(client Dialer, localPort int, remoteAddr string) (*Tunnel, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		return nil, fmt.Errorf("error listening on local port %d: %v", localPort, err)
+	}
+	t := &Tunnel{
+		listener:   listener,
+		client:     client,
+		remoteAddr: remoteAddr,
+		conns:      make(map[net.Conn]struct{}),
+	}
+	t.wg.Add(1)
+	go t.serve()
+	return t, nil
+}
+
+// LocalAddr returns the local address connections to the Windows VM can be made to
+func (t *Tunnel) LocalAddr() string {
+	return t.listener.Addr().String()
+}
+
+// LocalPort returns the local port connections to the Windows VM can be made to
+func (t *Tunnel) LocalPort() int {
+	return t.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops accepting connections, closes the open ones and waits for them to be cleaned up
+func (t *Tunnel) Close() error {
+	t.mutex.Lock()
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mutex.Unlock()
+	err := t.listener.Close()
+	t.wg.Wait()
+	return err
+}
+
+// serve accepts the local connections and forwards them until the listener is closed
+func (t *Tunnel) serve() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.forward(local)
+		}()
+	}
+}
+
+// forward connects to the remote address over ssh and copies data in both directions until both sides are done
+func (t *Tunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.client.Dial("tcp", t.remoteAddr)
+	if err != nil {
+		log.Printf("tunnel: error connecting to %s on the Windows VM: %v", t.remoteAddr, err)
+		return
+	}
+	defer remote.Close()
+	if !t.track(local, remote) {
+		return
+	}
+	defer t.untrack(local, remote)
+
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		defer copies.Done()
+		pipe(remote, local)
+	}()
+	go func() {
+		defer copies.Done()
+		pipe(local, remote)
+	}()
+	copies.Wait()
+}
+
+// track records the open connections so that they are closed along with the tunnel. It returns false if the tunnel is
+// already closed.
+func (t *Tunnel) track(conns ...net.Conn) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return false
+	}
+	for _, conn := range conns {
+		t.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+// untrack removes the connections from the open ones
+func (t *Tunnel) untrack(conns ...net.Conn) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, conn := range conns {
+		delete(t.conns, conn)
+	}
+}
+
+// pipe copies from src to dst and then closes the write side of dst, so that the peer sees the end of the stream while
+// the other direction can still complete
+func pipe(dst, src net.Conn) {
+	io.Copy(dst, src)
+	if conn, ok := dst.(interface{ CloseWrite() error }); ok {
+		conn.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
@@ -0,0 +1,139 @@
+package types
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// directTCPIPRequest is the payload of a direct-tcpip channel request, used by ssh port forwarding
+type directTCPIPRequest struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+// startSSHServer starts an ssh server that accepts any password and serves direct-tcpip channels, and returns a
+// client connected to it
+func startSSHServer(t *testing.T) *ssh.Client {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, channels, requests, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			var request directTCPIPRequest
+			if newChannel.ChannelType() != "direct-tcpip" ||
+				ssh.Unmarshal(newChannel.ExtraData(), &request) != nil {
+				newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+				continue
+			}
+			target, err := net.Dial("tcp", net.JoinHostPort(request.Host, strconv.Itoa(int(request.Port))))
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				target.Close()
+				continue
+			}
+			go ssh.DiscardRequests(channelRequests)
+			go func() {
+				io.Copy(target, channel)
+				target.(*net.TCPConn).CloseWrite()
+			}()
+			go func() {
+				io.Copy(channel, target)
+				channel.CloseWrite()
+			}()
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "Administrator",
+		Auth:            []ssh.AuthMethod{ssh.Password("password")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// startEchoServer starts a TCP server that echoes back every line it receives and returns its port
+func startEchoServer(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestTunnel tests that connections made to the local port of the tunnel reach the remote port and that the tunnel
+// stops accepting connections once closed
+func TestTunnel(t *testing.T) {
+	w := &Windows{SSHClient: startSSHServer(t)}
+	remotePort := startEchoServer(t)
+
+	tunnel, err := w.Tunnel(0, remotePort)
+	require.NoError(t, err, "error opening tunnel")
+	assert.NotZero(t, tunnel.LocalPort())
+
+	for i := 0; i < 2; i++ {
+		t.Run(fmt.Sprintf("connection %d", i), func(t *testing.T) {
+			conn, err := net.Dial("tcp", tunnel.LocalAddr())
+			require.NoError(t, err, "error connecting to tunnel")
+			defer conn.Close()
+			_, err = fmt.Fprintf(conn, "hello %d\n", i)
+			require.NoError(t, err)
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err, "error reading from tunnel")
+			assert.Equal(t, fmt.Sprintf("hello %d\n", i), line)
+		})
+	}
+
+	require.NoError(t, tunnel.Close(), "error closing tunnel")
+	_, err = net.Dial("tcp", tunnel.LocalAddr())
+	assert.Error(t, err, "tunnel accepted connections after being closed")
+
+	_, err = (&Windows{}).Tunnel(0, remotePort)
+	assert.Error(t, err, "tunnel opened without a ssh client")
+}
@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/masterzen/winrm"
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/tracing"
 	"github.com/pkg/sftp"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -30,6 +32,30 @@ const (
 	winRMPort = 5986
 )
 
+// NetworkMode selects how the instances are reached
+type NetworkMode string
+
+const (
+	// NetworkModeAuto uses the private IP of the instances when WNI runs in the network of the cluster, and the public
+	// IP otherwise
+	NetworkModeAuto NetworkMode = "auto"
+	// NetworkModePublic gives the instances a public IP, and opens WinRM, SSH and RDP to the IP of the user
+	NetworkModePublic NetworkMode = "public"
+	// NetworkModePrivate creates the instances without public IP and reaches them through their private IP, which
+	// requires running WNI in the network of the cluster
+	NetworkModePrivate NetworkMode = "private"
+)
+
+// ParseNetworkMode returns the network mode of the given name
+func ParseNetworkMode(mode string) (NetworkMode, error) {
+	switch m := NetworkMode(mode); m {
+	case NetworkModeAuto, NetworkModePublic, NetworkModePrivate:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid network mode %s, expected %s, %s or %s", mode, NetworkModeAuto, NetworkModePublic,
+		NetworkModePrivate)
+}
+
 // Windows represents a Windows host.
 // TODO: Add a struct called Connectivity which has information related to Winrm, SSH and have
 //		getters and setters for it so that it can be exposed as a public method
@@ -62,9 +88,24 @@ type WindowsVM interface {
 	GetCredentials() *Credentials
 	// Reinitialize re-initializes the Windows VM. Presently only the ssh client is reinitialized.
 	Reinitialize() error
+	// Shell opens an interactive PowerShell session on the Windows VM over ssh, attached to the given input and
+	// outputs, and returns once the session ends
+	Shell(*os.File, io.Writer, io.Writer) error
+	// Tunnel forwards the connections made to the given local port to the given port on the Windows VM over ssh. A
+	// free local port is picked if the local port is 0. The returned Tunnel needs to be closed once done.
+	Tunnel(int, int) (*Tunnel, error)
 }
 
 func (w *Windows) CopyFile(filePath, remoteDir string) error {
+	_, span := tracing.Start(tracing.Context(), "copy file", attribute.String("file", filePath),
+		attribute.String("remote-dir", remoteDir))
+	err := w.copyFile(filePath, remoteDir)
+	tracing.End(span, err)
+	return err
+}
+
+// copyFile copies the given file to the remote directory on the Windows VM over sftp
+func (w *Windows) copyFile(filePath, remoteDir string) error {
 	if w.SSHClient == nil {
 		return fmt.Errorf("CopyFile cannot be called without a SSH client")
 	}
@@ -102,6 +143,14 @@ func (w *Windows) CopyFile(filePath, remoteDir string) error {
 }
 
 func (w *Windows) Run(cmd string, psCmd bool) (string, string, error) {
+	_, span := tracing.Start(tracing.Context(), "winrm run", tracing.Command(cmd))
+	stdout, stderr, err := w.run(cmd, psCmd)
+	tracing.End(span, err)
+	return stdout, stderr, err
+}
+
+// run executes the given command over WinRM, returning its stdout and stderr
+func (w *Windows) run(cmd string, psCmd bool) (string, string, error) {
 	if w.WinrmClient == nil {
 		return "", "", fmt.Errorf("Run cannot be called without a WinRM client")
 	}
@@ -126,6 +175,14 @@ func (w *Windows) Run(cmd string, psCmd bool) (string, string, error) {
 }
 
 func (w *Windows) RunOverSSH(cmd string, psCmd bool) (string, error) {
+	_, span := tracing.Start(tracing.Context(), "ssh run", tracing.Command(cmd))
+	out, err := w.runOverSSH(cmd, psCmd)
+	tracing.End(span, err)
+	return out, err
+}
+
+// runOverSSH executes the given command over ssh, returning its combined output
+func (w *Windows) runOverSSH(cmd string, psCmd bool) (string, error) {
 	if w.SSHClient == nil {
 		return "", fmt.Errorf("RunOverSSH cannot be called without a ssh client")
 	}
@@ -147,6 +204,13 @@ func (w *Windows) RunOverSSH(cmd string, psCmd bool) (string, error) {
 	return string(out), nil
 }
 
+func (w *Windows) Tunnel(localPort, remotePort int) (*Tunnel, error) {
+	if w.SSHClient == nil {
+		return nil, fmt.Errorf("Tunnel cannot be called without a ssh client")
+	}
+	return NewTunnel(w.SSHClient, localPort, fmt.Sprintf("127.0.0.1:%d", remotePort))
+}
+
 func (w *Windows) GetCredentials() *Credentials {
 	return w.Credentials
 }
@@ -244,6 +308,9 @@ type Credentials struct {
 	password string
 	// user used for accessing the  instance created
 	user string
+	// hostname is the name the instance is registered with in the private DNS zone of the cluster, empty if it is not
+	// registered
+	hostname string
 }
 
 // NewCredentials takes the instanceID, ip address, password and user of the Windows instance created and returns the
@@ -271,3 +338,14 @@ func (cred *Credentials) GetInstanceId() string {
 func (cred *Credentials) GetUserName() string {
 	return cred.user
 }
+
+// GetHostname returns the name the node is registered with in the private DNS zone of the cluster, or an empty string
+// if it is not registered
+func (cred *Credentials) GetHostname() string {
+	return cred.hostname
+}
+
+// SetHostname sets the name the node is registered with in the private DNS zone of the cluster
+func (cred *Credentials) SetHostname(hostname string) {
+	cred.hostname = hostname
+}
@@ -0,0 +1,323 @@
+package types
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/openshift/windows-machine-config-bootstrapper/pkg/poll"
+)
+
+const (
+	// windowsUpdateDir is the directory of the instance the Windows Update script and its result are written to
+	windowsUpdateDir = "C:\\Windows\\Temp\\wni"
+	// windowsUpdateScript is the name of the script installing the requested updates
+	windowsUpdateScript = "windows-update.ps1"
+	// windowsUpdateResult is the path of the result of the script installing the requested updates
+	windowsUpdateResult = windowsUpdateDir + "\\windows-update.json"
+	// windowsUpdateTask is the name of the scheduled task running the script installing the requested updates
+	windowsUpdateTask = "wni-windows-update"
+	// windowsUpdatePollInterval is the interval at which the result of the update installation is checked
+	windowsUpdatePollInterval = 30 * time.Second
+	// bootTimeCmd prints the last boot time of the instance
+	bootTimeCmd = "(Get-CimInstance -ClassName Win32_OperatingSystem).LastBootUpTime.ToFileTimeUtc()"
+)
+
+// WindowsUpdateMode selects how Windows Update behaves on the created instances
+type WindowsUpdateMode string
+
+const (
+	// WindowsUpdateDefault leaves Windows Update as configured by the image
+	WindowsUpdateDefault WindowsUpdateMode = "default"
+	// WindowsUpdatePaused turns the automatic updates off by policy, so that updates are neither installed nor
+	// followed by reboots on their own, while they can still be installed on demand
+	WindowsUpdatePaused WindowsUpdateMode = "paused"
+	// WindowsUpdateDisabled turns the automatic updates off by policy and disables the Windows Update service
+	WindowsUpdateDisabled WindowsUpdateMode = "disabled"
+)
+
+// kbRegex matches the ID of a Windows update, e.g. KB5005112
+var kbRegex = regexp.MustCompile(`^KB[0-9]{6,8}$`)
+
+// WindowsUpdatePolicy controls Windows Update on the created instances, as automatic updates reboot the instances at
+// any time, e.g. in the middle of a test
+type WindowsUpdatePolicy struct {
+	// Mode selects how Windows Update behaves once the updates are installed
+	Mode WindowsUpdateMode
+	// KBs are the IDs of the updates to install before freezing the instance, e.g. KB5005112
+	KBs []string
+}
+
+// NewWindowsUpdatePolicy returns the policy of the given mode, installing the given updates first. An instance is
+// frozen once the updates are installed, so the mode defaults to disabled if updates are given.
+func NewWindowsUpdatePolicy(mode string, kbs []string) (*WindowsUpdatePolicy, error) {
+	policy := &WindowsUpdatePolicy{Mode: WindowsUpdateMode(mode)}
+	switch policy.Mode {
+	case "", WindowsUpdateDefault:
+		policy.Mode = WindowsUpdateDefault
+		if len(kbs) > 0 {
+			policy.Mode = WindowsUpdateDisabled
+		}
+	case WindowsUpdatePaused, WindowsUpdateDisabled:
+	default:
+		return nil, fmt.Errorf("invalid Windows Update mode %s, expected %s, %s or %s", mode, WindowsUpdateDefault,
+			WindowsUpdatePaused, WindowsUpdateDisabled)
+	}
+	for _, kb := range kbs {
+		kb = strings.ToUpper(strings.TrimSpace(kb))
+		if !strings.HasPrefix(kb, "KB") {
+			kb = "KB" + kb
+		}
+		if !kbRegex.MatchString(kb) {
+			return nil, fmt.Errorf("invalid update ID %s, expected KB followed by its number, e.g. KB5005112", kb)
+		}
+		policy.KBs = append(policy.KBs, kb)
+	}
+	return policy, nil
+}
+
+// IsDefault returns true if the policy leaves Windows Update as configured by the image
+func (p *WindowsUpdatePolicy) IsDefault() bool {
+	return p == nil || p.Mode == WindowsUpdateDefault && len(p.KBs) == 0
+}
+
+// freezeScript returns the PowerShell script turning the automatic updates off according to the mode of the policy
+func (p *WindowsUpdatePolicy) freezeScript() string {
+	if p.Mode == WindowsUpdateDefault {
+		return ""
+	}
+	script := `$au = 'HKLM:\SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU'
+        New-Item -Path $au -Force | Out-Null
+        Set-ItemProperty -Path $au -Name NoAutoUpdate -Value 1 -Type DWord
+        Set-ItemProperty -Path $au -Name NoAutoRebootWithLoggedOnUsers -Value 1 -Type DWord`
+	if p.Mode == WindowsUpdateDisabled {
+		script += `
+        Stop-Service -Name wuauserv -Force
+        Set-Service -Name wuauserv -StartupType Disabled`
+	}
+	return script
+}
+
+// installUpdatesScript returns the PowerShell script installing the given updates with the Windows Update Agent API
+// and writing the result to windowsUpdateResult. The API refuses to download updates in remote sessions, so the
+// script is run as a scheduled task.
+func installUpdatesScript(kbs []string) string {
+	return `$ErrorActionPreference = 'Stop'
+$result = @{installed = @(); notFound = @(); rebootRequired = $false; error = ''}
+try {
+    $present = @(Get-HotFix | ForEach-Object { $_.HotFixID })
+    $missing = @(@('` + strings.Join(kbs, "', '") + `') | Where-Object { $present -notcontains $_ })
+    if ($missing.Count -gt 0) {
+        $session = New-Object -ComObject Microsoft.Update.Session
+        $search = $session.CreateUpdateSearcher().Search("IsInstalled=0 and Type='Software'")
+        $updates = New-Object -ComObject Microsoft.Update.UpdateColl
+        foreach ($update in $search.Updates) {
+            foreach ($id in $update.KBArticleIDs) {
+                if ($missing -contains ('KB' + $id)) {
+                    $update.AcceptEula()
+                    [void]$updates.Add($update)
+                    $result.installed += 'KB' + $id
+                }
+            }
+        }
+        $result.notFound = @($missing | Where-Object { $result.installed -notcontains $_ })
+        if ($updates.Count -gt 0) {
+            $downloader = $session.CreateUpdateDownloader()
+            $downloader.Updates = $updates
+            [void]$downloader.Download()
+            $installer = $session.CreateUpdateInstaller()
+            $installer.Updates = $updates
+            $installation = $installer.Install()
+            $result.rebootRequired = $installation.RebootRequired
+            # 2 is succeeded and 3 succeeded with errors
+            if ($installation.ResultCode -ne 2 -and $installation.ResultCode -ne 3) {
+                throw "installation failed with result code $($installation.ResultCode)"
+            }
+        }
+    }
+} catch {
+    $result.error = $_.Exception.Message
+}
+$result | ConvertTo-Json -Compress | Set-Content -Path '` + windowsUpdateResult + `'
+`
+}
+
+// updateResult is the result of the script installing the requested updates
+type updateResult struct {
+	// Installed are the updates installed by the script
+	Installed []string `json:"installed"`
+	// NotFound are the requested updates which are neither installed nor available
+	NotFound []string `json:"notFound"`
+	// RebootRequired is true if the instance needs to be rebooted to complete the installation
+	RebootRequired bool `json:"rebootRequired"`
+	// Error is the error the installation failed with, if any
+	Error string `json:"error"`
+}
+
+// parseUpdateResult returns the result of the update installation, or nil if it is not written yet
+func parseUpdateResult(out string) (*updateResult, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, nil
+	}
+	var result updateResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		// The result may be read while it is being written
+		return nil, nil
+	}
+	if result.Error != "" {
+		return &result, fmt.Errorf("error installing updates: %s", result.Error)
+	}
+	if len(result.NotFound) > 0 {
+		return &result, fmt.Errorf("updates %s are not available for the instance", strings.Join(result.NotFound, ", "))
+	}
+	return &result, nil
+}
+
+// EncodedPowerShell returns the command running the given PowerShell script, encoded so that it needs no quoting
+// through the command shell
+func EncodedPowerShell(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	bytes := make([]byte, 2*len(encoded))
+	for i, c := range encoded {
+		bytes[2*i] = byte(c)
+		bytes[2*i+1] = byte(c >> 8)
+	}
+	return remotePowerShellCmdPrefix + "-EncodedCommand " + base64.StdEncoding.EncodeToString(bytes)
+}
+
+// WindowsUpdateTarget is the part of a Windows VM the Windows Update policy is applied through. It is implemented by
+// Windows, and by the VMs of the e2e test framework, which apply the same policy.
+type WindowsUpdateTarget interface {
+	// CopyFile copies the given file to the remote directory in the Windows VM
+	CopyFile(string, string) error
+	// Run executes the given command remotely on the Windows VM, in PowerShell if the bool is set
+	Run(string, bool) (string, string, error)
+	// GetCredentials returns the credentials of the Windows VM
+	GetCredentials() *Credentials
+	// Reinitialize re-initializes the ssh client of the Windows VM, e.g. after a reboot
+	Reinitialize() error
+}
+
+// ApplyWindowsUpdatePolicy installs the updates of the policy, rebooting the Windows VM if they require it, and then
+// turns the automatic updates off according to the mode of the policy, or returns an error once the timeout expires.
+// The updates are copied over ssh, so the ssh client has to be set up.
+func ApplyWindowsUpdatePolicy(w WindowsUpdateTarget, policy *WindowsUpdatePolicy, timeout time.Duration) error {
+	if policy.IsDefault() {
+		return nil
+	}
+	deadline := clk.Now().Add(timeout)
+	if len(policy.KBs) > 0 {
+		rebootRequired, err := installUpdates(w, policy.KBs, deadline)
+		if err != nil {
+			return err
+		}
+		if rebootRequired {
+			if err = rebootForUpdates(w, deadline); err != nil {
+				return fmt.Errorf("error rebooting to complete the installation of the updates: %v", err)
+			}
+		}
+	}
+	if _, stderr, err := w.Run(EncodedPowerShell(policy.freezeScript()), false); err != nil {
+		return fmt.Errorf("error turning the automatic updates off: %v, %s", err, stderr)
+	}
+	log.Printf("Windows Update is %s on %s", policy.Mode, w.GetCredentials().GetIPAddress())
+	return nil
+}
+
+// installUpdates installs the given updates on the Windows VM and returns true if it has to be rebooted to complete
+// their installation
+func installUpdates(w WindowsUpdateTarget, kbs []string, deadline time.Time) (bool, error) {
+	localDir, err := ioutil.TempDir("", "wni-windows-update")
+	if err != nil {
+		return false, fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(localDir)
+	scriptPath := filepath.Join(localDir, windowsUpdateScript)
+	if err = ioutil.WriteFile(scriptPath, []byte(installUpdatesScript(kbs)), 0644); err != nil {
+		return false, fmt.Errorf("error writing the Windows Update script: %v", err)
+	}
+	if err = w.CopyFile(scriptPath, windowsUpdateDir); err != nil {
+		return false, fmt.Errorf("error copying the Windows Update script: %v", err)
+	}
+
+	startTask := `Remove-Item -Path '` + windowsUpdateResult + `' -ErrorAction SilentlyContinue
+        $action = New-ScheduledTaskAction -Execute 'powershell.exe' -Argument ('-NonInteractive -ExecutionPolicy ' +
+            'Bypass -File ` + windowsUpdateDir + `\` + windowsUpdateScript + `')
+        Register-ScheduledTask -TaskName '` + windowsUpdateTask + `' -Action $action -User 'NT AUTHORITY\SYSTEM' ` +
+		`-RunLevel Highest -Force | Out-Null
+        Start-ScheduledTask -TaskName '` + windowsUpdateTask + `'`
+	if _, stderr, err := w.Run(EncodedPowerShell(startTask), false); err != nil {
+		return false, fmt.Errorf("error starting the installation of the updates: %v, %s", err, stderr)
+	}
+	defer func() {
+		if _, _, err := w.Run(EncodedPowerShell("Unregister-ScheduledTask -TaskName '"+windowsUpdateTask+
+			"' -Confirm:$false"), false); err != nil {
+			log.Printf("error removing scheduled task %s: %v", windowsUpdateTask, err)
+		}
+	}()
+
+	log.Printf("installing updates %s on %s", strings.Join(kbs, ", "), w.GetCredentials().GetIPAddress())
+	var result *updateResult
+	err = poll.Until(context.Background(), "the installation of updates "+strings.Join(kbs, ", "),
+		windowsUpdatePollOptions(deadline), func() (bool, string, error) {
+			stdout, _, err := w.Run(EncodedPowerShell("Get-Content -Path '"+windowsUpdateResult+
+				"' -ErrorAction SilentlyContinue"), false)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			if result, err = parseUpdateResult(stdout); err != nil {
+				return false, "", err
+			}
+			return result != nil, "the updates are being installed", nil
+		})
+	if err != nil {
+		return false, err
+	}
+	log.Printf("installed updates %v on %s", result.Installed, w.GetCredentials().GetIPAddress())
+	return result.RebootRequired, nil
+}
+
+// rebootForUpdates restarts the Windows VM and waits for it to be reachable again over WinRM and ssh
+func rebootForUpdates(w WindowsUpdateTarget, deadline time.Time) error {
+	bootTime, _, err := w.Run(bootTimeCmd, true)
+	if err != nil {
+		return fmt.Errorf("error getting the boot time: %v", err)
+	}
+	// The connection is usually dropped while the command runs, so errors are only reported if the VM does not reboot
+	_, _, restartErr := w.Run("Restart-Computer -Force", true)
+	err = poll.Until(context.Background(), "the reboot", windowsUpdatePollOptions(deadline),
+		func() (bool, string, error) {
+			newBootTime, _, err := w.Run(bootTimeCmd, true)
+			if err != nil {
+				return false, err.Error(), nil
+			}
+			return newBootTime != bootTime, fmt.Sprintf("not rebooted, restart returned: %v", restartErr), nil
+		})
+	if err != nil {
+		return err
+	}
+	// The ssh server may start after WinRM
+	return poll.Until(context.Background(), "ssh after the reboot", windowsUpdatePollOptions(deadline),
+		func() (bool, string, error) {
+			if err := w.Reinitialize(); err != nil {
+				return false, err.Error(), nil
+			}
+			return true, "", nil
+		})
+}
+
+// windowsUpdatePollOptions returns the options of the polls of the installation of the updates, until the deadline
+func windowsUpdatePollOptions(deadline time.Time) poll.Options {
+	return poll.Options{Interval: windowsUpdatePollInterval, Deadline: deadline, Jitter: poll.DefaultJitter,
+		Clock: clk}
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewWindowsUpdatePolicy tests the validation of the Windows Update modes and update IDs
+func TestNewWindowsUpdatePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		kbs      []string
+		expected *WindowsUpdatePolicy
+	}{
+		{"empty mode", "", nil, &WindowsUpdatePolicy{Mode: WindowsUpdateDefault}},
+		{"paused", "paused", nil, &WindowsUpdatePolicy{Mode: WindowsUpdatePaused}},
+		{"updates freeze the instance", "default", []string{"KB5005112"},
+			&WindowsUpdatePolicy{Mode: WindowsUpdateDisabled, KBs: []string{"KB5005112"}}},
+		{"update IDs are normalized", "paused", []string{"kb5005112", " 4577069"},
+			&WindowsUpdatePolicy{Mode: WindowsUpdatePaused, KBs: []string{"KB5005112", "KB4577069"}}},
+		{"invalid mode", "frozen", nil, nil},
+		{"invalid update ID", "disabled", []string{"KB50051a2"}, nil},
+		{"update ID too short", "disabled", []string{"KB123"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewWindowsUpdatePolicy(test.mode, test.kbs)
+			if test.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, policy)
+		})
+	}
+	assert.True(t, (*WindowsUpdatePolicy)(nil).IsDefault())
+	assert.True(t, (&WindowsUpdatePolicy{Mode: WindowsUpdateDefault}).IsDefault())
+	assert.False(t, (&WindowsUpdatePolicy{Mode: WindowsUpdatePaused}).IsDefault())
+}
+
+// TestFreezeScript tests that only the disabled mode stops the Windows Update service
+func TestFreezeScript(t *testing.T) {
+	assert.Empty(t, (&WindowsUpdatePolicy{Mode: WindowsUpdateDefault}).freezeScript())
+	paused := (&WindowsUpdatePolicy{Mode: WindowsUpdatePaused}).freezeScript()
+	assert.Contains(t, paused, "NoAutoUpdate -Value 1")
+	assert.NotContains(t, paused, "wuauserv")
+	disabled := (&WindowsUpdatePolicy{Mode: WindowsUpdateDisabled}).freezeScript()
+	assert.Contains(t, disabled, "NoAutoUpdate -Value 1")
+	assert.Contains(t, disabled, "Set-Service -Name wuauserv -StartupType Disabled")
+}
+
+// TestInstallUpdatesScript tests that the requested updates are passed to the script
+func TestInstallUpdatesScript(t *testing.T) {
+	script := installUpdatesScript([]string{"KB5005112", "KB4577069"})
+	assert.Contains(t, script, "@('KB5005112', 'KB4577069')")
+	assert.Contains(t, script, "Set-Content -Path '"+windowsUpdateResult+"'")
+}
+
+// TestParseUpdateResult tests the parsing of the result of the update installation
+func TestParseUpdateResult(t *testing.T) {
+	result, err := parseUpdateResult("")
+	assert.NoError(t, err)
+	assert.Nil(t, result, "the result is not written yet")
+	result, err = parseUpdateResult(`{"installed": ["KB5005112"`)
+	assert.NoError(t, err)
+	assert.Nil(t, result, "the result is being written")
+
+	result, err = parseUpdateResult(`{"installed":["KB5005112"],"notFound":[],"rebootRequired":true,"error":""}`)
+	require.NoError(t, err)
+	assert.Equal(t, &updateResult{Installed: []string{"KB5005112"}, NotFound: []string{}, RebootRequired: true},
+		result)
+
+	_, err = parseUpdateResult(`{"installed":[],"notFound":["KB4577069"],"rebootRequired":false,"error":""}`)
+	assert.Error(t, err)
+	_, err = parseUpdateResult(`{"installed":[],"notFound":[],"rebootRequired":false,"error":"0x80240438"}`)
+	assert.Error(t, err)
+}
+
+// TestEncodedPowerShell tests that the script is encoded as base64 UTF-16LE, as expected by -EncodedCommand
+func TestEncodedPowerShell(t *testing.T) {
+	cmd := EncodedPowerShell("Get-Service 'wuauserv' | Select-Object Status")
+	require.True(t, strings.HasPrefix(cmd, remotePowerShellCmdPrefix+"-EncodedCommand "))
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd,
+		remotePowerShellCmdPrefix+"-EncodedCommand "))
+	require.NoError(t, err)
+	units := make([]uint16, len(decoded)/2)
+	for i := range units {
+		units[i] = uint16(decoded[2*i]) | uint16(decoded[2*i+1])<<8
+	}
+	assert.Equal(t, "Get-Service 'wuauserv' | Select-Object Status", string(utf16.Decode(units)))
+}
@@ -3,6 +3,7 @@ package e2e
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,13 +21,15 @@ var (
 	kubeconfig     = os.Getenv("KUBECONFIG")
 	awscredentials = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
 	artifactDir    = os.Getenv("ARTIFACT_DIR")
+	// sshKey is the name of an existing key pair, given along with its private key. If not set, a key pair is
+	// generated, whose private key is encrypted with the passphrase of WNI_KEY_PASSPHRASE.
+	sshKey         = os.Getenv("E2E_SSH_KEY")
 	privateKeyPath = os.Getenv("KUBE_SSH_KEY_PATH")
 
 	// imageID is the image that will be fed to the WNI for the tests. This is being set to empty, as we wish for it
 	// to use the latest Windows image
 	imageID      = ""
 	instanceType = "m4.large"
-	sshKey       = "libra"
 
 	// awsProvider is setup as a variable for both creating, destroying,
 	// and tear down Windows instance in case test fails in the middle.
@@ -105,7 +108,8 @@ func awsSetup() error {
 // setupAWSCloudProvider creates provider ofr Cloud interface and asserts type into AWS provider.
 // This is the first step of the e2e test and fails the test upon error.
 func setupAWSCloudProvider() error {
-	// The e2e test uses Microsoft Windows Server 2019 Base with Containers image, m4.large type, and libra ssh key.
+	// The e2e test uses Microsoft Windows Server 2019 Base with Containers image, m4.large type, and the given or a
+	// generated key pair.
 	cloud, err := cloudprovider.CloudProviderFactory(kubeconfig, awscredentials, "default", artifactDir,
 		imageID, instanceType, sshKey, privateKeyPath)
 	if err != nil {
@@ -295,7 +299,12 @@ func testInstanceProperties(t *testing.T) {
 
 	assert.Equalf(t, instanceType, *createdInstance.InstanceType, "created instance type mismatch")
 
-	assert.Equalf(t, sshKey, *createdInstance.KeyName, "created instance ssh key mismatch")
+	if sshKey == "" {
+		assert.Truef(t, strings.HasPrefix(*createdInstance.KeyName, infraID+"-wni-"),
+			"created instance key pair %s is not the generated one", *createdInstance.KeyName)
+	} else {
+		assert.Equalf(t, sshKey, *createdInstance.KeyName, "created instance ssh key mismatch")
+	}
 }
 
 // testInstanceHasPublicSubnetAndIp asserts if the instance is associated with a public IP address and subnet by